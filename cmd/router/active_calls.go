@@ -0,0 +1,85 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    
+    "github.com/olekukonko/tablewriter"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// showActiveCalls prints the calls the AGI server is routing, falling back to
+// the call_records rows, which lag behind, when its API is unreachable
+func showActiveCalls(ctx context.Context, filter models.CallFilter, opts models.ListOptions) error {
+    calls, total, err := fetchActiveCalls(ctx, filter, opts)
+    if err != nil {
+        fmt.Printf("%s AGI server API unreachable (%v), showing the database state\n\n", yellow("!"), err)
+    
+        records, n, dbErr := routerSvc.ListCalls(ctx, filter, opts)
+        if dbErr != nil {
+            return fmt.Errorf("failed to get calls: %v", dbErr)
+        }
+        calls, total = activeCallsFromRecords(records), n
+    }
+    
+    if total == 0 {
+        fmt.Println("No active calls")
+        return nil
+    }
+    
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"Call ID", "ANI", "DNIS", "DID", "Route", "Status", "Current Leg", "Duration"})
+    table.SetBorder(false)
+    
+    for _, call := range calls {
+        callID := call.CallID
+        if len(callID) > 8 {
+            callID = callID[:8] + "..."
+        }
+    
+        callStatus := string(call.Status)
+        if call.IsTest {
+            callStatus += " " + yellow("[TEST]")
+        }
+    
+        table.Append([]string{
+            callID,
+            cliNumber(call.ANI),
+            cliNumber(call.DNIS),
+            orDash(call.DID),
+            call.Route,
+            callStatus,
+            orDash(formatCurrentLeg(call)),
+            formatElapsed(call.Elapsed),
+        })
+    }
+    
+    table.Render()
+    printPageFooter(len(calls), total, opts)
+    
+    return nil
+}
+
+// formatCurrentLeg describes the leg a call is being worked on, the last one
+// that left pending
+func formatCurrentLeg(call *models.ActiveCall) string {
+    for i := len(call.Legs) - 1; i >= 0; i-- {
+        leg := call.Legs[i]
+        if leg.State == models.LegPending {
+            continue
+        }
+    
+        desc := leg.Leg
+        if leg.Provider != "" {
+            desc += " " + leg.Provider
+        }
+        return fmt.Sprintf("%s %s %s", desc, leg.State, formatElapsed(leg.Elapsed))
+    }
+    return ""
+}
+
+func formatElapsed(seconds int) string {
+    return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+    
+    "github.com/spf13/viper"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// managementURL is the base of the AGI server's management API
+func managementURL() string {
+    if base := strings.TrimRight(viper.GetString("security.api.url"), "/"); base != "" {
+        return base
+    }
+    return fmt.Sprintf("http://127.0.0.1:%d", viper.GetInt("security.api.port"))
+}
+
+// managementGet reads a management API endpoint into dest, authenticating
+// with security.api.auth_token
+func managementGet(ctx context.Context, path string, query url.Values, dest interface{}) error {
+    ctx, cancel := context.WithTimeout(ctx, viper.GetDuration("security.api.client_timeout"))
+    defer cancel()
+    
+    endpoint := managementURL() + "/api/v1" + path
+    if len(query) > 0 {
+        endpoint += "?" + query.Encode()
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+    if err != nil {
+        return err
+    }
+    if token := viper.GetString("security.api.auth_token"); token != "" {
+        req.Header.Set("Authorization", "Bearer "+token)
+    }
+    
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    
+    if resp.StatusCode != http.StatusOK {
+        var apiErr struct {
+            Error string `json:"error"`
+        }
+        json.NewDecoder(resp.Body).Decode(&apiErr)
+        if apiErr.Error == "" {
+            apiErr.Error = resp.Status
+        }
+        return fmt.Errorf("%s: %s", path, apiErr.Error)
+    }
+    
+    return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+// fetchActiveCalls reads one page of the calls the AGI server holds in memory
+func fetchActiveCalls(ctx context.Context, filter models.CallFilter, opts models.ListOptions) ([]*models.ActiveCall, int64, error) {
+    query := url.Values{}
+    set := func(key, value string) {
+        if value != "" {
+            query.Set(key, value)
+        }
+    }
+    set("status", string(filter.Status))
+    set("route", filter.Route)
+    set("provider", filter.Provider)
+    set("ani", filter.ANI)
+    set("dnis", filter.DNIS)
+    if filter.Test != nil {
+        query.Set("test", fmt.Sprintf("%t", *filter.Test))
+    }
+    if opts.Limit > 0 {
+        query.Set("limit", fmt.Sprintf("%d", opts.Limit))
+    }
+    if opts.Offset > 0 {
+        query.Set("offset", fmt.Sprintf("%d", opts.Offset))
+    }
+    set("sort", opts.Sort)
+    if opts.Desc {
+        query.Set("order", "desc")
+    }
+    
+    var page struct {
+        Items []*models.ActiveCall `json:"items"`
+        Total int64                `json:"total"`
+    }
+    if err := managementGet(ctx, "/calls/active", query, &page); err != nil {
+        return nil, 0, err
+    }
+    return page.Items, page.Total, nil
+}
+
+// activeCallsFromRecords stands in for the live snapshot with the
+// call_records rows when the AGI server cannot be reached
+func activeCallsFromRecords(records []*models.CallRecord) []*models.ActiveCall {
+    calls := make([]*models.ActiveCall, len(records))
+    for i, r := range records {
+        calls[i] = &models.ActiveCall{
+            CallID:      r.CallID,
+            ANI:         r.OriginalANI,
+            DNIS:        r.OriginalDNIS,
+            DID:         r.AssignedDID,
+            Route:       r.RouteName,
+            Status:      r.Status,
+            CurrentStep: r.CurrentStep,
+            StartTime:   r.StartTime,
+            Elapsed:     int(time.Since(r.StartTime).Seconds()),
+            IsTest:      r.IsTest,
+        }
+    }
+    return calls
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createAPITokenCommands() *cobra.Command {
+    tokenCmd := &cobra.Command{
+        Use:   "api-token",
+        Short: "Manage customer usage API tokens",
+        Long: `Manage customer usage API tokens.
+
+A token is issued to one customer (inbound provider) and only reads
+/api/v1/usage: that customer's call records, usage minutes and DIDs. Carriers,
+routes and other customers stay hidden. Tokens are shown once when created,
+the database keeps a hash; issuing and revoking is written to the audit log.
+
+With security.masking.enabled, caller and called numbers are masked for tokens
+issued without --pii.`,
+    }
+    
+    tokenCmd.AddCommand(
+        createAPITokenCreateCommand(),
+        createAPITokenListCommand(),
+        createAPITokenRevokeCommand(),
+    )
+    
+    return tokenCmd
+}
+
+func createAPITokenCreateCommand() *cobra.Command {
+    var (
+        description string
+        duration    time.Duration
+        pii         bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "create <customer>",
+        Short: "Issue a token to a customer",
+        Args:  cobra.ExactArgs(1),
+        Example: `  # A token for the customer's billing team, valid for a year
+  router api-token create s1-acme --description "acme billing" --for 8760h`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            t := &models.APIToken{
+                Customer:    args[0],
+                Description: description,
+                CreatedBy:   audit.CurrentUser(),
+                PII:         pii,
+            }
+            if duration > 0 {
+                expires := time.Now().Add(duration)
+                t.ExpiresAt = &expires
+            }
+    
+            token, err := routerSvc.GetAPITokens().Create(ctx, t)
+            if err != nil {
+                return fmt.Errorf("failed to create API token: %v", err)
+            }
+    
+            fmt.Printf("%s API token %d issued to %s\n", green("✓"), t.ID, t.Customer)
+            fmt.Printf("\n  %s\n\n", token)
+            fmt.Println("Store it now, it can't be shown again.")
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&description, "description", "", "Who or what the token is for")
+    cmd.Flags().DurationVar(&duration, "for", 0, "Expire after this long (default never)")
+    cmd.Flags().BoolVar(&pii, "pii", false, "Show caller and called numbers in full when masking is on")
+    
+    return cmd
+}
+
+func createAPITokenListCommand() *cobra.Command {
+    var customer string
+    
+    cmd := &cobra.Command{
+        Use:   "list",
+        Short: "List API tokens",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            tokens, err := routerSvc.GetAPITokens().List(ctx, customer)
+            if err != nil {
+                return fmt.Errorf("failed to list API tokens: %v", err)
+            }
+    
+            if len(tokens) == 0 {
+                fmt.Println("No API tokens")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"ID", "Customer", "Prefix", "Status", "Numbers", "Description", "Created By", "Last Used"})
+            table.SetBorder(false)
+    
+            now := time.Now()
+            for _, t := range tokens {
+                status := green("active")
+                switch {
+                case t.RevokedAt != nil:
+                    status = red("revoked")
+                case !t.Valid(now):
+                    status = "expired"
+                case t.ExpiresAt != nil:
+                    status = green("until " + t.ExpiresAt.Format("2006-01-02"))
+                }
+                pii := "masked"
+                if t.PII {
+                    pii = yellow("full")
+                }
+                lastUsed := "never"
+                if t.LastUsedAt != nil {
+                    lastUsed = t.LastUsedAt.Format("2006-01-02 15:04")
+                }
+                table.Append([]string{
+                    strconv.FormatInt(t.ID, 10),
+                    t.Customer,
+                    t.Prefix + "…",
+                    status,
+                    pii,
+                    t.Description,
+                    t.CreatedBy,
+                    lastUsed,
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&customer, "customer", "", "Only this customer's tokens")
+    
+    return cmd
+}
+
+func createAPITokenRevokeCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "revoke <id>",
+        Short: "Revoke an API token",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            id, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil {
+                return fmt.Errorf("invalid API token id: %s", args[0])
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.GetAPITokens().Revoke(ctx, id, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to revoke API token: %v", err)
+            }
+    
+            fmt.Printf("%s API token %d revoked\n", green("✓"), id)
+            return nil
+        },
+    }
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "time"
+    
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/ami"
+    "github.com/hamzaKhattat/ara-production-system/internal/ara"
+)
+
+func createAsteriskCommands() *cobra.Command {
+    asteriskCmd := &cobra.Command{
+        Use:   "asterisk",
+        Short: "Asterisk side configuration",
+    }
+    
+    asteriskCmd.AddCommand(createAsteriskBootstrapCommand())
+    
+    return asteriskCmd
+}
+
+func createAsteriskBootstrapCommand() *cobra.Command {
+    var (
+        output  string
+        push    string
+        sshHost string
+        files   []string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "bootstrap",
+        Short: "Generate the Asterisk configuration ARA needs",
+        Long: `Generate res_odbc.conf, extconfig.conf, sorcery.conf, manager.conf, the
+extensions.conf contexts and /etc/odbc.ini from the router configuration: the
+database DSN, the realtime tables, the generated dialplan contexts and the AMI user.
+
+Without --output or --push the files are printed. --push ami merges the sections
+into the live config files over AMI (needs the 'config' write permission) and
+leaves other sections alone; odbc.ini is not an Asterisk file and is skipped.
+--push ssh replaces the files on the host, keeping the previous ones as
+<file>.<timestamp>.bak.`,
+        Example: `  router asterisk bootstrap
+  router asterisk bootstrap -o ./asterisk-etc
+  router asterisk bootstrap --push ami --file extconfig.conf --file sorcery.conf
+  router asterisk bootstrap --push ssh --ssh root@pbx1`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := loadConfig(); err != nil {
+                return fmt.Errorf("failed to load config: %v", err)
+            }
+    
+            generated, err := selectConfigFiles(ara.GenerateAsteriskConfig(bootstrapConfig()), files)
+            if err != nil {
+                return err
+            }
+    
+            switch {
+            case push == "ami":
+                if err := initializeForCLI(ctx); err != nil {
+                    return err
+                }
+                if amiManager == nil || !amiManager.IsConnected() {
+                    return fmt.Errorf("AMI is not connected")
+                }
+                return pushConfigAMI(generated)
+    
+            case push == "ssh":
+                if sshHost == "" {
+                    return fmt.Errorf("--ssh is required with --push ssh")
+                }
+                return pushConfigSSH(ctx, sshHost, generated)
+    
+            case push != "":
+                return fmt.Errorf("unknown push method %q, use ami or ssh", push)
+    
+            case output != "":
+                if err := os.MkdirAll(output, 0755); err != nil {
+                    return fmt.Errorf("failed to create %s: %v", output, err)
+                }
+                for _, f := range generated {
+                    path := filepath.Join(output, f.Name)
+                    if err := os.WriteFile(path, []byte(f.Render()), 0640); err != nil {
+                        return fmt.Errorf("failed to write %s: %v", path, err)
+                    }
+                    fmt.Printf("%s %s\n", green("✓"), path)
+                }
+                return nil
+            }
+    
+            for _, f := range generated {
+                fmt.Printf("%s\n%s\n", bold("==> "+configFilePath(f)+" <=="), f.Render())
+            }
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVarP(&output, "output", "o", "", "Write the files to a directory")
+    cmd.Flags().StringVar(&push, "push", "", "Install the files on Asterisk (ami, ssh)")
+    cmd.Flags().StringVar(&sshHost, "ssh", "", "SSH destination for --push ssh, e.g. root@pbx1")
+    cmd.Flags().StringSliceVar(&files, "file", nil, "Only generate these files (repeatable)")
+    
+    return cmd
+}
+
+// selectConfigFiles keeps the requested files, all of them when names is empty
+func selectConfigFiles(all []ara.ConfigFile, names []string) ([]ara.ConfigFile, error) {
+    if len(names) == 0 {
+        return all, nil
+    }
+    
+    var selected []ara.ConfigFile
+    for _, name := range names {
+        found := false
+        for _, f := range all {
+            if f.Name == name {
+                selected = append(selected, f)
+                found = true
+            }
+        }
+        if !found {
+            return nil, fmt.Errorf("unknown file %q", name)
+        }
+    }
+    return selected, nil
+}
+
+// configFilePath is where a generated file is installed
+func configFilePath(f ara.ConfigFile) string {
+    if f.System {
+        return filepath.Join("/etc", f.Name)
+    }
+    return filepath.Join(viper.GetString("asterisk.bootstrap.config_dir"), f.Name)
+}
+
+// pushConfigAMI merges the generated sections into the live files: variables
+// that exist are updated, missing ones and whole sections are appended
+func pushConfigAMI(files []ara.ConfigFile) error {
+    for _, f := range files {
+        if f.System {
+            fmt.Printf("%s %s skipped, install it as %s by hand\n", yellow("!"), f.Name, configFilePath(f))
+            continue
+        }
+    
+        existing, err := amiManager.GetConfig(f.Name)
+        if err != nil {
+            if err := amiManager.CreateConfig(f.Name); err != nil {
+                return fmt.Errorf("failed to create %s: %v", f.Name, err)
+            }
+            existing = map[string]map[string]string{}
+        }
+    
+        var changes []ami.ConfigAction
+        for _, section := range f.Sections {
+            vars, ok := existing[section.Name]
+            if !ok {
+                changes = append(changes, ami.ConfigAction{Action: "NewCat", Cat: section.Name})
+            }
+            for _, v := range section.Vars {
+                action := "Append"
+                if current, ok := vars[v.Name]; ok {
+                    if current == v.Value {
+                        continue
+                    }
+                    action = "Update"
+                }
+                changes = append(changes, ami.ConfigAction{Action: action, Cat: section.Name, Var: v.Name, Value: v.Value})
+            }
+        }
+    
+        if len(changes) == 0 {
+            fmt.Printf("%s %s already up to date\n", green("✓"), f.Name)
+            continue
+        }
+        if err := amiManager.UpdateConfig(f.Name, changes); err != nil {
+            return fmt.Errorf("failed to update %s: %v", f.Name, err)
+        }
+        fmt.Printf("%s %s updated, %d changes\n", green("✓"), f.Name, len(changes))
+    }
+    
+    printBootstrapNextSteps()
+    return nil
+}
+
+// pushConfigSSH copies the files to the host with the system ssh client
+func pushConfigSSH(ctx context.Context, host string, files []ara.ConfigFile) error {
+    suffix := time.Now().Format("20060102150405") + ".bak"
+    
+    for _, f := range files {
+        path := configFilePath(f)
+        quoted := "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+        script := fmt.Sprintf("if [ -f %[1]s ]; then cp -p %[1]s %[1]s.%[2]s; fi && cat > %[1]s", quoted, suffix)
+    
+        var stderr bytes.Buffer
+        ssh := exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", host, script)
+        ssh.Stdin = strings.NewReader(f.Render())
+        ssh.Stderr = &stderr
+        if err := ssh.Run(); err != nil {
+            return fmt.Errorf("failed to copy %s to %s: %v %s", f.Name, host, err, strings.TrimSpace(stderr.String()))
+        }
+        fmt.Printf("%s %s:%s\n", green("✓"), host, path)
+    }
+    
+    printBootstrapNextSteps()
+    return nil
+}
+
+func printBootstrapNextSteps() {
+    fmt.Printf("\n%s\n", bold("Next steps"))
+    fmt.Println("  1. Restart Asterisk so extconfig.conf and sorcery.conf mappings load: core restart when convenient")
+    fmt.Println("  2. Check the installation: router doctor")
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+func createBackupCommands() *cobra.Command {
+    backupCmd := &cobra.Command{
+        Use:   "backup",
+        Short: "Snapshot the routing configuration",
+        Long: `Snapshot the routing configuration.
+
+A snapshot is a compressed dump of the providers, groups, routes, DIDs,
+holidays and ARA tables, written to router.backup.destination, a local
+directory or S3. Routers
+take one each router.backup.interval and keep the last router.backup.keep;
+bring one back with: router restore --snapshot <id>`,
+    }
+    
+    backupCmd.AddCommand(
+        createBackupNowCommand(),
+        createBackupListCommand(),
+    )
+    
+    return backupCmd
+}
+
+func createBackupNowCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "now",
+        Short: "Take a snapshot now",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            snap, err := routerSvc.GetBackups().Snapshot(ctx, models.BackupManual, audit.CurrentUser())
+            if err != nil {
+                return fmt.Errorf("failed to take snapshot: %v", err)
+            }
+    
+            fmt.Printf("%s Snapshot %s written to %s (%d bytes)\n", green("✓"), snap.ID, snap.Location, snap.Size)
+            return nil
+        },
+    }
+}
+
+func createBackupListCommand() *cobra.Command {
+    var limit int
+    
+    cmd := &cobra.Command{
+        Use:   "list",
+        Short: "List snapshots, newest first",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            snapshots, err := routerSvc.GetBackups().List(ctx, limit)
+            if err != nil {
+                return fmt.Errorf("failed to list snapshots: %v", err)
+            }
+    
+            if len(snapshots) == 0 {
+                fmt.Println("No snapshots")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Snapshot", "Taken", "Trigger", "Providers", "Routes", "DIDs", "Size", "By", "Location"})
+            table.SetBorder(false)
+    
+            for _, s := range snapshots {
+                table.Append([]string{
+                    s.ID,
+                    s.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+                    s.Trigger,
+                    strconv.Itoa(s.Rows["providers"]),
+                    strconv.Itoa(s.Rows["provider_routes"]),
+                    strconv.Itoa(s.Rows["dids"]),
+                    strconv.FormatInt(s.Size, 10),
+                    s.CreatedBy,
+                    s.Location,
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().IntVar(&limit, "limit", 50, "Maximum number of snapshots")
+    
+    return cmd
+}
+
+func createRestoreCommand() *cobra.Command {
+    var (
+        snapshot string
+        only     []string
+        yes      bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "restore",
+        Short: "Restore the routing configuration from a snapshot",
+        Long: `Restore the routing configuration from a snapshot.
+
+The parts given with --only are replaced, in one transaction, by their content
+in the snapshot: ` + strings.Join(router.BackupSets(), ", ") + `. Without --only all
+of them are. The configuration being replaced is snapshotted first. DIDs held by
+calls in progress stay allocated to them.
+
+Restore related parts together: groups and DIDs refer to providers by id.`,
+        Args: cobra.NoArgs,
+        Example: `  router restore --snapshot 20261014T090000Z
+  router restore --snapshot 20261014T090000Z --only routes,groups`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if snapshot == "" {
+                return fmt.Errorf("--snapshot is required")
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            backups := routerSvc.GetBackups()
+    
+            sets := "all of " + strings.Join(router.BackupSets(), ", ")
+            if len(only) > 0 {
+                sets = strings.Join(only, ", ")
+            }
+            if info, err := backups.Get(ctx, snapshot); err == nil {
+                fmt.Printf("Snapshot %s taken %s (%s)\n", info.ID, info.CreatedAt.Local().Format("2006-01-02 15:04:05"), info.Trigger)
+            } else {
+                fmt.Printf("Snapshot %s is not recorded in this database, it will be read from %s unverified\n",
+                    snapshot, viper.GetString("router.backup.destination"))
+            }
+            fmt.Printf("Replace %s with the snapshot's content\n", sets)
+            if !yes {
+                fmt.Print("Continue? [y/N]: ")
+                response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+                response = strings.TrimSpace(strings.ToLower(response))
+                if response != "y" && response != "yes" {
+                    fmt.Println("Cancelled")
+                    return nil
+                }
+            }
+    
+            result, err := backups.Restore(ctx, snapshot, only, audit.CurrentUser())
+            if err != nil {
+                return fmt.Errorf("failed to restore snapshot: %v", err)
+            }
+    
+            tables := make([]string, 0, len(result.Rows))
+            for t := range result.Rows {
+                tables = append(tables, t)
+            }
+            sort.Strings(tables)
+            for _, t := range tables {
+                fmt.Printf("  %-28s %d rows\n", t, result.Rows[t])
+            }
+            if result.Kept > 0 {
+                fmt.Printf("  %d DIDs kept allocated to calls in progress\n", result.Kept)
+            }
+            fmt.Printf("%s Restored %s from %s, the previous configuration is snapshot %s\n",
+                green("✓"), strings.Join(result.Sets, ", "), result.Snapshot, result.PreRestore)
+    
+            for _, set := range result.Sets {
+                if set != "ara" {
+                    continue
+                }
+                if amiManager == nil || !amiManager.IsConnected() {
+                    fmt.Printf("%s AMI is not connected, reload PJSIP and the dialplan in Asterisk\n", yellow("!"))
+                    break
+                }
+                if err := amiManager.ReloadPJSIP(); err != nil {
+                    fmt.Printf("%s Failed to reload PJSIP: %v\n", yellow("!"), err)
+                }
+                if err := amiManager.ReloadDialplan(); err != nil {
+                    fmt.Printf("%s Failed to reload the dialplan: %v\n", yellow("!"), err)
+                }
+            }
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&snapshot, "snapshot", "", "Snapshot id, see: router backup list")
+    cmd.Flags().StringSliceVar(&only, "only", nil, "Parts to restore: "+strings.Join(router.BackupSets(), ", "))
+    cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip confirmation")
+    
+    return cmd
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createBlockCommands() *cobra.Command {
+    blockCmd := &cobra.Command{
+        Use:   "block",
+        Short: "Manage blocked destination prefixes and countries",
+        Long: `Manage blocked destinations.
+
+Blocks match a number prefix or a destination country and apply globally, to a
+single customer (inbound provider) or to one route. Blocked calls are rejected
+before a DID is allocated. Every change is written to the audit log.`,
+    }
+    
+    blockCmd.AddCommand(
+        createBlockAddCommand(),
+        createBlockListCommand(),
+        createBlockRemoveCommand(),
+        createBlockUnblockCommand(),
+    )
+    
+    return blockCmd
+}
+
+func createBlockAddCommand() *cobra.Command {
+    var (
+        prefix   string
+        country  string
+        customer string
+        route    string
+        reason   string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "add",
+        Short: "Block a prefix or country",
+        Example: `  # Premium rate numbers for everyone
+  router block add --prefix 1900 --reason "premium rate"
+  
+  # One country for a single customer
+  router block add --country CU --customer s1-acme`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if (prefix == "") == (country == "") {
+                return fmt.Errorf("exactly one of --prefix or --country is required")
+            }
+            if customer != "" && route != "" {
+                return fmt.Errorf("--customer and --route can't be combined")
+            }
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            block := &models.DestinationBlock{
+                Scope:     models.BlockScopeGlobal,
+                MatchType: models.BlockMatchPrefix,
+                Pattern:   prefix,
+                Reason:    reason,
+                CreatedBy: audit.CurrentUser(),
+            }
+            if country != "" {
+                block.MatchType = models.BlockMatchCountry
+                block.Pattern = country
+            }
+            if customer != "" {
+                block.Scope = models.BlockScopeCustomer
+                block.ScopeValue = customer
+            } else if route != "" {
+                block.Scope = models.BlockScopeRoute
+                block.ScopeValue = route
+            }
+            
+            if err := routerSvc.GetBlockManager().AddBlock(ctx, block); err != nil {
+                return fmt.Errorf("failed to add block: %v", err)
+            }
+            
+            fmt.Printf("%s Block %d added (%s %s, %s)\n", green("✓"), block.ID, block.MatchType, block.Pattern, formatBlockScope(block))
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&prefix, "prefix", "", "Destination number prefix")
+    cmd.Flags().StringVar(&country, "country", "", "Destination country (ISO 3166 alpha-2)")
+    cmd.Flags().StringVar(&customer, "customer", "", "Only block calls from this inbound provider")
+    cmd.Flags().StringVar(&route, "route", "", "Only block calls on this route")
+    cmd.Flags().StringVar(&reason, "reason", "", "Why the destination is blocked")
+    
+    return cmd
+}
+
+func createBlockListCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "list",
+        Short: "List destination blocks",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            blocks, err := routerSvc.GetBlockManager().ListBlocks(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to list blocks: %v", err)
+            }
+            
+            if len(blocks) == 0 {
+                fmt.Println("No destination blocks")
+                return nil
+            }
+            
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"ID", "Scope", "Match", "Pattern", "Status", "Reason", "Created By"})
+            table.SetBorder(false)
+            
+            now := time.Now()
+            for _, b := range blocks {
+                status := red("blocked")
+                if b.Overridden(now) {
+                    status = yellow("unblocked until " + b.UnblockedUntil.Format("2006-01-02 15:04"))
+                }
+                table.Append([]string{
+                    fmt.Sprintf("%d", b.ID),
+                    formatBlockScope(b),
+                    b.MatchType,
+                    b.Pattern,
+                    status,
+                    b.Reason,
+                    b.CreatedBy,
+                })
+            }
+            
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createBlockRemoveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove <id>",
+        Short: "Remove a destination block",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            id, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil {
+                return fmt.Errorf("invalid block id: %s", args[0])
+            }
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            if err := routerSvc.GetBlockManager().RemoveBlock(ctx, id, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove block: %v", err)
+            }
+            
+            fmt.Printf("%s Block %d removed\n", green("✓"), id)
+            return nil
+        },
+    }
+}
+
+func createBlockUnblockCommand() *cobra.Command {
+    var (
+        duration time.Duration
+        reason   string
+    )
+    
+    cmd := &cobra.Command{
+        Use:     "unblock <id>",
+        Short:   "Lift a block temporarily",
+        Example: `  router block unblock 12 --for 2h --reason "carrier test calls"`,
+        Args:    cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            id, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil {
+                return fmt.Errorf("invalid block id: %s", args[0])
+            }
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            expiresAt, err := routerSvc.GetBlockManager().Unblock(ctx, id, duration, reason, audit.CurrentUser())
+            if err != nil {
+                return fmt.Errorf("failed to unblock: %v", err)
+            }
+            
+            fmt.Printf("%s Block %d lifted until %s\n", green("✓"), id, expiresAt.Format("2006-01-02 15:04:05"))
+            return nil
+        },
+    }
+    
+    cmd.Flags().DurationVar(&duration, "for", time.Hour, "How long the block is lifted")
+    cmd.Flags().StringVar(&reason, "reason", "", "Why the block is lifted")
+    
+    return cmd
+}
+
+func formatBlockScope(b *models.DestinationBlock) string {
+    if b.Scope == models.BlockScopeGlobal {
+        return string(b.Scope)
+    }
+    return fmt.Sprintf("%s:%s", b.Scope, b.ScopeValue)
+}
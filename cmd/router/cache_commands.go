@@ -0,0 +1,55 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/db"
+)
+
+func createCacheCommands() *cobra.Command {
+    cacheCmd := &cobra.Command{
+        Use:   "cache",
+        Short: "Manage the Redis cache",
+    }
+    
+    cacheCmd.AddCommand(createCacheFlushCommand())
+    
+    return cacheCmd
+}
+
+func createCacheFlushCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "flush [namespace...]",
+        Short: "Invalidate cached entries on every router",
+        Long: `Invalidate cached entries on every router.
+
+Each namespace has a version that is part of its cache keys; flushing bumps it,
+so every router reads fresh data from the database right away and drops its
+in-process copies. Without a namespace all of them are flushed.
+
+Namespaces: ` + strings.Join(db.CacheNamespaces, ", "),
+        Example: `  router cache flush route
+  router cache flush provider providers group`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            if _, err := cache.Ping(ctx); err != nil {
+                return err
+            }
+    
+            flushed, err := cache.Flush(ctx, args...)
+            if err != nil {
+                return fmt.Errorf("failed to flush cache: %v", err)
+            }
+    
+            fmt.Printf("%s Flushed %s\n", green("✓"), strings.Join(flushed, ", "))
+            return nil
+        },
+    }
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "strings"
+    
+    "github.com/olekukonko/tablewriter"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// showCallChannels prints the active call records next to the Asterisk
+// channels carrying them, read over AMI, flagging the calls Asterisk has no
+// channel of and the channels of no call
+func showCallChannels(ctx context.Context, filter models.CallFilter) error {
+    if amiManager == nil || !amiManager.IsConnected() {
+        return fmt.Errorf("AMI is not connected")
+    }
+    
+    report, err := routerSvc.CallChannels(ctx, amiManager, filter)
+    if err != nil {
+        return fmt.Errorf("failed to correlate channels: %v", err)
+    }
+    
+    if len(report.Calls) == 0 {
+        fmt.Println("No active calls")
+    } else {
+        table := tablewriter.NewWriter(os.Stdout)
+        table.SetHeader([]string{"Call ID", "Route", "Status", "Channel", "State", "Codec", "Jitter Rx/Tx", "Lost Rx/Tx", "Bridged With"})
+        table.SetBorder(false)
+    
+        for _, entry := range report.Calls {
+            call := entry.Call
+            callID := call.CallID
+            if len(callID) > 8 {
+                callID = callID[:8] + "..."
+            }
+            callStatus := string(call.Status)
+            if call.IsTest {
+                callStatus += " " + yellow("[TEST]")
+            }
+    
+            if entry.Ghost {
+                table.Append([]string{callID, call.RouteName, callStatus, red("no channel (ghost)"), "-", "-", "-", "-", "-"})
+                continue
+            }
+            for i, ch := range entry.Channels {
+                row := append([]string{callID, call.RouteName, callStatus}, channelColumns(ch)...)
+                if i > 0 {
+                    row[0], row[1], row[2] = "", "", ""
+                }
+                table.Append(row)
+            }
+        }
+    
+        table.Render()
+    }
+    
+    if len(report.Orphans) > 0 {
+        fmt.Printf("\n%s\n", bold("Channels without an active call record:"))
+        table := tablewriter.NewWriter(os.Stdout)
+        table.SetHeader([]string{"Channel", "Context", "Exten", "State", "Application", "Duration", "Bridged With"})
+        table.SetBorder(false)
+    
+        for _, ch := range report.Orphans {
+            table.Append([]string{
+                ch.Channel,
+                ch.Context,
+                cliNumber(ch.Exten),
+                ch.State,
+                orDash(ch.Application),
+                formatElapsed(ch.Duration),
+                orDash(strings.Join(ch.BridgedWith, ", ")),
+            })
+        }
+    
+        table.Render()
+    }
+    
+    fmt.Printf("\n%s, %s, %s\n", countLabel(len(report.Calls), "active call", fmt.Sprint),
+        countLabel(report.Ghosts, "ghost call", red), countLabel(len(report.Orphans), "orphan channel", yellow))
+    return nil
+}
+
+// channelColumns are the channel columns of the correlated calls table
+func channelColumns(ch models.LiveChannel) []string {
+    jitter, lost := "-", "-"
+    if ch.RTP != nil {
+        jitter = fmt.Sprintf("%.1f/%.1f ms", ch.RTP.RxJitter*1000, ch.RTP.TxJitter*1000)
+        lost = fmt.Sprintf("%d/%d", ch.RTP.RxLost, ch.RTP.TxLost)
+    }
+    return []string{
+        ch.Channel,
+        ch.State,
+        orDash(ch.Codec),
+        jitter,
+        lost,
+        orDash(strings.Join(ch.BridgedWith, ", ")),
+    }
+}
+
+// countLabel colours a count of problems when there are any
+func countLabel(n int, label string, colour func(a ...interface{}) string) string {
+    text := fmt.Sprintf("%d %s", n, label)
+    if n != 1 {
+        text += "s"
+    }
+    if n == 0 {
+        return text
+    }
+    return colour(text)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+    
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createCallOriginateCommand() *cobra.Command {
+    var (
+        req        models.OriginateCallRequest
+        outputJSON bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "originate <ani> <dnis>",
+        Short: "Place a test call through a route",
+        Long: `Place a test call end to end through a route, S1 to S2 to S3 and back to
+S4, to verify the route before putting it into production.
+
+The call is originated over AMI into the inbound context as if the route's
+inbound provider had sent it, and takes the route whether it's enabled or not,
+as test traffic: test DIDs are preferred, the route's test call budget
+applies and the call is kept out of production stats. Once the final provider
+answers the call is held for --hold, then hung up.
+
+Routes matching several inbound providers need --inbound to name the one the
+call comes from. The same test call can be placed over the API with
+POST /api/v1/calls/originate.`,
+        Example: `  router call originate 15551234567 442071234567 --route uk-premium
+  router call originate 15551234567 442071234567 --route uk-group --inbound carrier-a --hold 10s`,
+        Args: cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            if amiManager == nil || !amiManager.IsConnected() {
+                return fmt.Errorf("AMI is not connected")
+            }
+    
+            req.ANI, req.DNIS = args[0], args[1]
+            if !outputJSON {
+                fmt.Printf("Calling %s from %s through route '%s'...\n", cliNumber(req.DNIS), cliNumber(req.ANI), req.Route)
+            }
+    
+            result, err := routerSvc.OriginateCall(ctx, amiManager, req)
+            if err != nil {
+                return fmt.Errorf("failed to originate test call: %v", err)
+            }
+    
+            if outputJSON {
+                data, _ := json.MarshalIndent(result, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+    
+            printOriginateResult(result)
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&req.Route, "route", "", "Route the test call goes through (required)")
+    cmd.Flags().StringVar(&req.Inbound, "inbound", "", "Inbound provider the call stands in for (default the route's)")
+    cmd.Flags().DurationVar(&req.Timeout, "timeout", 30*time.Second, "How long to wait for the far end to answer")
+    cmd.Flags().DurationVar(&req.Hold, "hold", 5*time.Second, "How long to keep the answered call up")
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output as JSON")
+    cmd.MarkFlagRequired("route")
+    
+    return cmd
+}
+
+func printOriginateResult(result *models.OriginateCallResult) {
+    switch {
+    case result.Answered:
+        fmt.Printf("%s Answered after %d ms\n", green("✓"), result.PDDMs)
+    case result.Ringing:
+        fmt.Printf("%s Rang after %d ms, not answered\n", yellow("!"), result.PDDMs)
+    default:
+        fmt.Printf("%s Not answered\n", red("✗"))
+    }
+    if result.CauseText != "" {
+        fmt.Printf("Hangup Cause:  %d (%s)\n", result.Cause, result.CauseText)
+    }
+    if result.Reason != "" {
+        fmt.Printf("Reason:        %s\n", result.Reason)
+    }
+    
+    fmt.Printf("\n%s\n", bold("Call Chain:"))
+    fmt.Printf("Call ID:       %s\n", result.CallID)
+    fmt.Printf("Route:         %s\n", result.Route)
+    fmt.Printf("Inbound:       %s\n", result.Inbound)
+    
+    call := result.Call
+    if call == nil {
+        fmt.Printf("%s The router never took the call, check the dialplan and AGI server logs\n", red("✗"))
+        return
+    }
+    fmt.Printf("Intermediate:  %s\n", orDash(call.IntermediateProvider))
+    fmt.Printf("DID:           %s\n", orDash(call.AssignedDID))
+    fmt.Printf("Final:         %s\n", orDash(call.FinalProvider))
+    fmt.Printf("Status:        %s\n", call.Status)
+    if call.CurrentStep != "" {
+        fmt.Printf("Last Step:     %s\n", call.CurrentStep)
+    }
+    if call.FailureReason != "" {
+        fmt.Printf("Failure:       %s\n", call.FailureReason)
+    }
+    if call.Disposition != "" {
+        fmt.Printf("Disposition:   %s\n", call.Disposition)
+    }
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createCDRExportCommands() *cobra.Command {
+    exportCmd := &cobra.Command{
+        Use:   "cdr-export",
+        Short: "Manage scheduled customer CDR exports",
+        Long: `Manage scheduled customer CDR exports.
+
+Each export sends one customer's (inbound provider's) finished production
+calls of the previous day, week or month as CSV or JSON to SFTP, S3, an HTTP
+webhook or email. Fields, their names in the file and the timezone of times
+and periods are set per export; carriers and routes are never included.
+
+An export with --customer '*' covers every customer's calls, for billing, and
+may also contain the customer, route, intermediate_provider, final_provider
+and cost fields. Webhooks receive the file as the body of a POST, signed in
+X-ARA-Signature when router.cdr_export.webhook.secret is set.
+
+Every delivery is tracked with its status, failed ones are retried up to
+router.cdr_export.max_attempts and can be rerun.`,
+    }
+    
+    exportCmd.AddCommand(
+        createCDRExportAddCommand(),
+        createCDRExportListCommand(),
+        createCDRExportEnableCommand(true),
+        createCDRExportEnableCommand(false),
+        createCDRExportRemoveCommand(),
+        createCDRExportRunsCommand(),
+        createCDRExportRunCommand(),
+        createCDRExportRerunCommand(),
+    )
+    
+    return exportCmd
+}
+
+func createCDRExportAddCommand() *cobra.Command {
+    var (
+        e      models.CDRExport
+        format string
+        fields string
+        rename []string
+        freq   string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "add <name>",
+        Short: "Schedule a customer CDR export",
+        Args:  cobra.ExactArgs(1),
+        Example: `  # Daily CSV to the partner's SFTP in their local time
+  router cdr-export add acme-daily --customer s1-acme --timezone Europe/Madrid \
+    --to sftp://acme@sftp.acme.example/incoming
+  
+  # Monthly JSON with a reduced field set to S3
+  router cdr-export add acme-monthly --customer s1-acme --frequency monthly --format json \
+    --fields call_id,start_time,ani,dnis,billable_duration,charge --to s3://acme-cdrs/ara
+  
+  # Weekly by email
+  router cdr-export add acme-weekly --customer s1-acme --frequency weekly --to mailto:billing@acme.example
+  
+  # Daily raw CDRs of all traffic to the billing system's webhook
+  router cdr-export add billing-daily --customer '*' --to https://billing.example/cdrs \
+    --rename call_id=CallID,billable_duration=BilledSeconds`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            e.Name = args[0]
+            e.Format = models.ExportFormat(strings.ToLower(format))
+            e.Frequency = models.ExportFrequency(strings.ToLower(freq))
+            e.Enabled = true
+            e.CreatedBy = audit.CurrentUser()
+            if fields != "" {
+                for _, f := range strings.Split(fields, ",") {
+                    e.Fields = append(e.Fields, strings.TrimSpace(f))
+                }
+            }
+            for _, r := range rename {
+                field, name, ok := strings.Cut(r, "=")
+                if !ok {
+                    return fmt.Errorf("invalid --rename %q, expected field=name", r)
+                }
+                if e.FieldNames == nil {
+                    e.FieldNames = make(map[string]string)
+                }
+                e.FieldNames[strings.TrimSpace(field)] = strings.TrimSpace(name)
+            }
+    
+            if err := routerSvc.GetCDRExports().Create(ctx, &e); err != nil {
+                return fmt.Errorf("failed to create CDR export: %v", err)
+            }
+    
+            start, _, _ := e.Period(time.Now())
+            fmt.Printf("%s CDR export %s created, first run covers %s\n", green("✓"), e.Name, start.Format("2006-01-02"))
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&e.Customer, "customer", "", "Inbound provider whose calls are exported, or '*' for all (required)")
+    cmd.Flags().StringVar(&e.Destination, "to", "", "sftp://user@host/dir, s3://bucket/prefix, https://webhook or mailto:address (required)")
+    cmd.Flags().StringVar(&format, "format", "csv", "File format: csv or json")
+    cmd.Flags().StringVar(&fields, "fields", "", "Comma separated fields (default all: "+strings.Join(models.CDRExportFields, ",")+")")
+    cmd.Flags().StringSliceVar(&rename, "rename", nil, "Name of a field in the file, as field=name (repeatable)")
+    cmd.Flags().StringVar(&e.Timezone, "timezone", "UTC", "Timezone of exported times and of the periods")
+    cmd.Flags().StringVar(&freq, "frequency", "daily", "daily, weekly or monthly")
+    cmd.MarkFlagRequired("customer")
+    cmd.MarkFlagRequired("to")
+    
+    return cmd
+}
+
+func createCDRExportListCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "list",
+        Short: "List scheduled CDR exports",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            exports, err := routerSvc.GetCDRExports().List(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to list CDR exports: %v", err)
+            }
+    
+            if len(exports) == 0 {
+                fmt.Println("No CDR exports")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Name", "Customer", "Schedule", "Format", "Timezone", "Destination", "Status"})
+            table.SetBorder(false)
+    
+            for _, e := range exports {
+                status := green("enabled")
+                if !e.Enabled {
+                    status = yellow("disabled")
+                }
+                table.Append([]string{
+                    e.Name,
+                    e.Customer,
+                    string(e.Frequency),
+                    fmt.Sprintf("%s (%d fields)", e.Format, len(e.Fields)),
+                    e.Timezone,
+                    e.Destination,
+                    status,
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createCDRExportEnableCommand(enabled bool) *cobra.Command {
+    use, short, done := "disable <name>", "Pause an export's schedule", "disabled"
+    if enabled {
+        use, short, done = "enable <name>", "Resume an export's schedule", "enabled"
+    }
+    
+    return &cobra.Command{
+        Use:   use,
+        Short: short,
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.GetCDRExports().SetEnabled(ctx, args[0], enabled, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to update CDR export: %v", err)
+            }
+    
+            fmt.Printf("%s CDR export %s %s\n", green("✓"), args[0], done)
+            return nil
+        },
+    }
+}
+
+func createCDRExportRemoveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove <name>",
+        Short: "Remove an export and its run history",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.GetCDRExports().Delete(ctx, args[0], audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove CDR export: %v", err)
+            }
+    
+            fmt.Printf("%s CDR export %s removed\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
+
+func createCDRExportRunsCommand() *cobra.Command {
+    var limit int
+    
+    cmd := &cobra.Command{
+        Use:   "runs [name]",
+        Short: "Show the latest deliveries",
+        Args:  cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            name := ""
+            if len(args) == 1 {
+                name = args[0]
+            }
+            runs, err := routerSvc.GetCDRExports().Runs(ctx, name, limit)
+            if err != nil {
+                return fmt.Errorf("failed to list CDR export runs: %v", err)
+            }
+    
+            if len(runs) == 0 {
+                fmt.Println("No CDR export runs")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"ID", "Export", "Period", "Status", "Attempts", "Records", "File", "Finished", "Error"})
+            table.SetBorder(false)
+    
+            for _, r := range runs {
+                status := string(r.Status)
+                switch r.Status {
+                case models.ExportRunDelivered:
+                    status = green(status)
+                case models.ExportRunFailed:
+                    status = red(status)
+                }
+                finished := "-"
+                if r.FinishedAt != nil {
+                    finished = r.FinishedAt.Local().Format("2006-01-02 15:04")
+                }
+                table.Append([]string{
+                    strconv.FormatInt(r.ID, 10),
+                    r.ExportName,
+                    r.PeriodStart.Local().Format("2006-01-02") + " - " + r.PeriodEnd.Local().Format("2006-01-02"),
+                    status,
+                    strconv.Itoa(r.Attempts),
+                    strconv.Itoa(r.Records),
+                    r.FileName,
+                    finished,
+                    r.Error,
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().IntVar(&limit, "limit", 20, "Runs shown")
+    
+    return cmd
+}
+
+func createCDRExportRunCommand() *cobra.Command {
+    var date string
+    
+    cmd := &cobra.Command{
+        Use:   "run <name>",
+        Short: "Export a period now",
+        Long:  "Export a period now, by default the last finished one. A period already delivered is delivered again.",
+        Args:  cobra.ExactArgs(1),
+        Example: `  # The period containing October 1st, in the export's timezone
+  router cdr-export run acme-daily --date 2026-10-01`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            exporter := routerSvc.GetCDRExports()
+            e, err := exporter.Get(ctx, args[0])
+            if err != nil {
+                return err
+            }
+    
+            start, end, err := e.Period(time.Now())
+            if date != "" {
+                loc, locErr := e.Location()
+                if locErr != nil {
+                    return locErr
+                }
+                day, parseErr := time.ParseInLocation("2006-01-02", date, loc)
+                if parseErr != nil {
+                    return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+                }
+                start, end, err = e.PeriodContaining(day)
+            }
+            if err != nil {
+                return err
+            }
+    
+            run, err := exporter.Run(ctx, e, start, end)
+            if err != nil {
+                return fmt.Errorf("CDR export failed: %v", err)
+            }
+    
+            fmt.Printf("%s %s delivered, %d records (%d bytes)\n", green("✓"), run.FileName, run.Records, run.Bytes)
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&date, "date", "", "A day of the period to export (YYYY-MM-DD)")
+    
+    return cmd
+}
+
+func createCDRExportRerunCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "rerun <run-id>",
+        Short: "Deliver a past run's period again",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            id, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil {
+                return fmt.Errorf("invalid run id: %s", args[0])
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            run, err := routerSvc.GetCDRExports().Rerun(ctx, id)
+            if err != nil {
+                return fmt.Errorf("CDR export failed: %v", err)
+            }
+    
+            fmt.Printf("%s %s delivered, %d records (%d bytes)\n", green("✓"), run.FileName, run.Records, run.Bytes)
+            return nil
+        },
+    }
+}
@@ -4,8 +4,10 @@ import (
     "bufio"
     "context"
     "encoding/csv"
+    "encoding/json"
     "fmt"
     "os"
+    "strconv"
     "strings"
     "time"
     "database/sql"
@@ -14,9 +16,10 @@ import (
     "github.com/fatih/color"
     "github.com/olekukonko/tablewriter"
     "github.com/spf13/cobra"
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
     "github.com/hamzaKhattat/ara-production-system/internal/models"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
-    "github.com/hamzaKhattat/ara-production-system/internal/provider"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
 )
 
 var (
@@ -41,6 +44,22 @@ func createProviderCommands() *cobra.Command {
         createProviderDeleteCommand(),
         createProviderShowCommand(),
         createProviderTestCommand(),
+        createProviderTagCommand(),
+        createProviderBulkCommand(),
+        createProviderImportCommand(),
+        createProviderExportCommand(),
+        createProviderCredentialsCommand(),
+        createProviderCountryLimitCommand(),
+        createProviderShortCallLimitCommand(),
+        createProviderDialOptionsCommand(),
+        createProviderRotateCredentialsCommand(),
+        createProviderQuarantinedCommand(),
+        createProviderReleaseCommand(),
+        createProviderEventsCommand(),
+        createProviderContractCommand(),
+        createProviderSLACommand(),
+        createProviderConflictsCommand(),
+        createProviderScorecardCommand(),
     )
     
     return providerCmd
@@ -58,6 +77,10 @@ func createProviderAddCommand() *cobra.Command {
         maxChannels  int
         priority     int
         weight       int
+        maxContacts  int
+        billing      string
+        currency     string
+        tagPairs     []string
     )
     
     cmd := &cobra.Command{
@@ -71,6 +94,16 @@ func createProviderAddCommand() *cobra.Command {
                 return err
             }
             
+            tags, err := models.ParseTags(tagPairs, false)
+            if err != nil {
+                return err
+            }
+            
+            rule, err := parseBillingRule(billing)
+            if err != nil {
+                return err
+            }
+    
             provider := &models.Provider{
                 Name:               args[0],
                 Type:               models.ProviderType(providerType),
@@ -83,8 +116,15 @@ func createProviderAddCommand() *cobra.Command {
                 MaxChannels:        maxChannels,
                 Priority:           priority,
                 Weight:             weight,
+                Currency:           currency,
+                MinDuration:        rule.MinDuration,
+                BillingIncrement:   rule.Increment,
                 Active:             true,
                 HealthCheckEnabled: true,
+                Tags:               tags,
+            }
+            if authType == "register" {
+                provider.Metadata = models.JSON{"max_contacts": maxContacts}
             }
             
             if err := providerSvc.CreateProvider(ctx, provider); err != nil {
@@ -101,20 +141,30 @@ func createProviderAddCommand() *cobra.Command {
     cmd.Flags().IntVar(&port, "port", 5060, "Provider port")
     cmd.Flags().StringVarP(&username, "username", "u", "", "Authentication username")
     cmd.Flags().StringVarP(&password, "password", "p", "", "Authentication password")
-    cmd.Flags().StringVar(&authType, "auth", "ip", "Authentication type (ip/credentials/both)")
+    cmd.Flags().StringVar(&authType, "auth", "ip", "Authentication type (ip/credentials/both/register)")
     cmd.Flags().StringSliceVar(&codecs, "codecs", []string{"ulaw", "alaw"}, "Supported codecs")
     cmd.Flags().IntVar(&maxChannels, "max-channels", 0, "Maximum concurrent channels (0=unlimited)")
     cmd.Flags().IntVar(&priority, "priority", 10, "Provider priority")
     cmd.Flags().IntVar(&weight, "weight", 1, "Provider weight for load balancing")
+    cmd.Flags().IntVar(&maxContacts, "max-contacts", 1, "Registrations a customer may hold (register auth)")
+    cmd.Flags().StringVar(&billing, "billing", "1/1", "Billing as minimum/increment seconds, e.g. 60/60 or 30/6")
+    cmd.Flags().StringVar(&currency, "currency", "", "Currency the provider invoices in (default the reporting currency)")
+    cmd.Flags().StringArrayVar(&tagPairs, "tag", nil, "Tag as key=value (repeatable)")
     
     cmd.MarkFlagRequired("type")
-    cmd.MarkFlagRequired("host")
     
     return cmd
 }
 
 func createProviderListCommand() *cobra.Command {
-    var providerType string
+    var (
+        providerType string
+        health       string
+        search       string
+        activeOnly   bool
+        tagPairs     []string
+        opts         models.ListOptions
+    )
     
     cmd := &cobra.Command{
         Use:   "list",
@@ -130,19 +180,35 @@ func createProviderListCommand() *cobra.Command {
             if providerType != "" {
                 filter["type"] = providerType
             }
+            if health != "" {
+                filter["health_status"] = health
+            }
+            if search != "" {
+                filter["search"] = search
+            }
+            if activeOnly {
+                filter["active"] = true
+            }
+            if len(tagPairs) > 0 {
+                tags, err := models.ParseTags(tagPairs, true)
+                if err != nil {
+                    return err
+                }
+                filter["tags"] = tags
+            }
             
-            providers, err := providerSvc.ListProviders(ctx, filter)
+            providers, total, err := providerSvc.ListProvidersPage(ctx, filter, opts)
             if err != nil {
                 return fmt.Errorf("failed to list providers: %v", err)
             }
             
-            if len(providers) == 0 {
+            if total == 0 {
                 fmt.Println("No providers found")
                 return nil
             }
             
             table := tablewriter.NewWriter(os.Stdout)
-            table.SetHeader([]string{"Name", "Type", "Host:Port", "Auth", "Priority", "Weight", "Channels", "Status"})
+            table.SetHeader([]string{"Name", "Type", "Host:Port", "Auth", "Priority", "Weight", "Channels", "Status", "Tags"})
             table.SetBorder(false)
             table.SetAutoWrapText(false)
             
@@ -170,15 +236,23 @@ func createProviderListCommand() *cobra.Command {
                     fmt.Sprintf("%d", p.Weight),
                     channels,
                     status,
+                    p.Tags.String(),
                 })
             }
             
             table.Render()
+            printPageFooter(len(providers), total, opts)
             return nil
         },
+        Annotations: changesNothing,
     }
     
     cmd.Flags().StringVarP(&providerType, "type", "t", "", "Filter by provider type")
+    cmd.Flags().StringVar(&health, "health", "", "Filter by health status (healthy, degraded, unhealthy)")
+    cmd.Flags().StringVar(&search, "search", "", "Filter by name or host substring")
+    cmd.Flags().BoolVar(&activeOnly, "active", false, "Only show active providers")
+    cmd.Flags().StringArrayVar(&tagPairs, "tag", nil, "Filter by tag key=value or key (repeatable)")
+    addListFlags(cmd, &opts, "name, type, priority, channels, cost, health, created")
     
     return cmd
 }
@@ -236,7 +310,11 @@ func createProviderShowCommand() *cobra.Command {
             fmt.Printf("\n%s\n", bold("Provider Details"))
             fmt.Printf("Name:             %s\n", provider.Name)
             fmt.Printf("Type:             %s\n", provider.Type)
-            fmt.Printf("Host:             %s:%d\n", provider.Host, provider.Port)
+            if provider.Registers() {
+                fmt.Printf("Host:             %s\n", "dynamic (registers)")
+            } else {
+                fmt.Printf("Host:             %s:%d\n", provider.Host, provider.Port)
+            }
             fmt.Printf("Transport:        %s\n", provider.Transport)
             fmt.Printf("Auth Type:        %s\n", provider.AuthType)
             if provider.Username != "" {
@@ -247,12 +325,21 @@ func createProviderShowCommand() *cobra.Command {
             fmt.Printf("Weight:           %d\n", provider.Weight)
             fmt.Printf("Max Channels:     %d\n", provider.MaxChannels)
             fmt.Printf("Current Channels: %d\n", provider.CurrentChannels)
-            fmt.Printf("Cost/Min:         $%.4f\n", provider.CostPerMinute)
+            fmt.Printf("Cost/Min:         %.4f %s\n", provider.CostPerMinute, formatCurrency(provider.Currency))
+            fmt.Printf("Billing:          %d/%d\n", provider.MinDuration, provider.BillingIncrement)
             fmt.Printf("Status:           %s\n", formatStatus(provider.Active, provider.HealthStatus))
             fmt.Printf("Health Check:     %s\n", formatBool(provider.HealthCheckEnabled))
+            if len(provider.Tags) > 0 {
+                fmt.Printf("Tags:             %s\n", provider.Tags.String())
+            }
             if provider.LastHealthCheck != nil {
                 fmt.Printf("Last Check:       %s\n", provider.LastHealthCheck.Format(time.RFC3339))
             }
+            if provider.Registers() {
+                if contacts, err := providerSvc.RegisteredContacts(ctx, provider.Name); err == nil {
+                    fmt.Printf("Contacts:         %d registered\n", len(contacts))
+                }
+            }
             fmt.Printf("Created:          %s\n", provider.CreatedAt.Format(time.RFC3339))
             fmt.Printf("Updated:          %s\n", provider.UpdatedAt.Format(time.RFC3339))
             
@@ -271,6 +358,7 @@ func createProviderShowCommand() *cobra.Command {
             
             return nil
         },
+        Annotations: changesNothing,
     }
 }
 
@@ -303,6 +391,7 @@ func createProviderTestCommand() *cobra.Command {
             
             return nil
         },
+        Annotations: changesNothing,
     }
 }
 
@@ -316,8 +405,17 @@ func createDIDCommands() *cobra.Command {
     didCmd.AddCommand(
         createDIDAddCommand(),
         createDIDListCommand(),
+        createDIDShowCommand(),
+        createDIDSearchCommand(),
         createDIDDeleteCommand(),
         createDIDReleaseCommand(),
+        createDIDTestCommand(),
+        createDIDLookupCommand(),
+        createDIDStatsCommand(),
+        createDIDHistoryCommand(),
+        createDIDReleaseQuarantineCommand(),
+        createDIDWatermarkCommand(),
+        createDIDOrderCommand(),
     )
     
     return didCmd
@@ -327,79 +425,110 @@ func createDIDAddCommand() *cobra.Command {
     var (
         provider string
         csvFile  string
+        isTest   bool
+        dryRun   bool
     )
     
     cmd := &cobra.Command{
         Use:   "add [numbers...]",
         Short: "Add DIDs to the pool",
+        Long: `Add DIDs to the pool, given on the command line or read from a CSV file.
+
+Numbers must be E.164, with or without the leading +. Numbers listed twice,
+or already in the pool however they are written, are skipped and reported;
+the others are added in batches, in a single transaction.
+
+A CSV file may start with a header naming its columns: number, country,
+city, rate_center, monthly_cost, per_minute_cost and currency. Without one
+the columns are number, country, city, monthly_cost and per_minute_cost.
+Only the number is required, the country defaults to the one of its calling
+code. With --dry-run the DIDs are checked and reported, nothing is added.`,
+        Example: `  router did add 18001234567 18001234568 --provider s3-1
+  router did add -f dids.csv --provider s3-1 --dry-run
+    
+  # dids.csv
+  number,country,city,monthly_cost,per_minute_cost,currency
+  +584121234567,VE,Caracas,1.50,0.0100,USD`,
         RunE: func(cmd *cobra.Command, args []string) error {
-            ctx := context.Background()
-            
-            if err := initializeForCLI(ctx); err != nil {
-                return err
-            }
-            
-            var numbers []string
-            
+            ctx := cmd.Context()
+    
+            var rows []*router.DIDImportRow
             if csvFile != "" {
-                // Read from CSV file
                 file, err := os.Open(csvFile)
                 if err != nil {
                     return fmt.Errorf("failed to open CSV file: %v", err)
                 }
                 defer file.Close()
-                
-                reader := csv.NewReader(file)
-                records, err := reader.ReadAll()
-                if err != nil {
+    
+                if rows, err = router.ParseDIDFile(file); err != nil {
                     return fmt.Errorf("failed to read CSV: %v", err)
                 }
-                
-                for i, record := range records {
-                    if i == 0 && strings.ToLower(record[0]) == "number" {
-                        continue // Skip header
-                    }
-                    if len(record) > 0 {
-                        numbers = append(numbers, record[0])
-                    }
+                if len(rows) == 0 {
+                    return fmt.Errorf("no DIDs found in %s", csvFile)
                 }
             } else if len(args) > 0 {
-                numbers = args
+                for _, number := range args {
+                    rows = append(rows, &router.DIDImportRow{DID: models.DID{Number: number}})
+                }
             } else {
                 return fmt.Errorf("no DIDs specified")
             }
             
-            // Add DIDs to database
-            added := 0
-            for _, number := range numbers {
-                did := &models.DID{
-                    Number:       number,
-                    ProviderName: provider,
-                    InUse:        false,
-                }
-                
-                if err := addDID(ctx, did); err != nil {
-                    fmt.Printf("%s Failed to add %s: %v\n", red("✗"), number, err)
-                } else {
-                    added++
-                }
+            if err := initializeForCLI(ctx); err != nil {
+                return err
             }
             
-            fmt.Printf("%s Added %d DIDs successfully\n", green("✓"), added)
-            return nil
+            return importDIDs(ctx, rows, router.DIDImportOptions{
+                Provider: provider,
+                IsTest:   isTest,
+                DryRun:   dryRun,
+                User:     audit.CurrentUser(),
+            })
         },
     }
     
     cmd.Flags().StringVarP(&provider, "provider", "p", "", "Associated provider name")
     cmd.Flags().StringVarP(&csvFile, "file", "f", "", "CSV file containing DIDs")
+    cmd.Flags().BoolVar(&isTest, "test", false, "Reserve the DIDs for test routes")
+    cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Check the DIDs and report what would be added without adding them")
     
     return cmd
 }
 
+// readDIDFile reads the numbers in the first column of a CSV file
+func readDIDFile(path string) ([]string, error) {
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open CSV file: %v", err)
+    }
+    defer file.Close()
+    
+    reader := csv.NewReader(file)
+    records, err := reader.ReadAll()
+    if err != nil {
+        return nil, fmt.Errorf("failed to read CSV: %v", err)
+    }
+    
+    var numbers []string
+    for i, record := range records {
+        if i == 0 && strings.ToLower(record[0]) == "number" {
+            continue // Skip header
+        }
+        if len(record) > 0 {
+            numbers = append(numbers, record[0])
+        }
+    }
+    return numbers, nil
+}
+
 func createDIDListCommand() *cobra.Command {
     var (
         showAll  bool
+        inUse    bool
         provider string
+        prefix   string
+        testOnly bool
+        opts     models.ListOptions
     )
     
     cmd := &cobra.Command{
@@ -412,12 +541,23 @@ func createDIDListCommand() *cobra.Command {
                 return err
             }
             
-            dids, err := listDIDs(ctx, provider, !showAll)
+            filter := models.DIDFilter{Provider: provider, Prefix: prefix}
+            switch {
+            case inUse:
+                filter.Status = "in_use"
+            case !showAll:
+                filter.Status = "available"
+            }
+            if testOnly {
+                filter.Test = &testOnly
+            }
+            
+            dids, total, err := routerSvc.ListDIDs(ctx, filter, opts)
             if err != nil {
                 return fmt.Errorf("failed to list DIDs: %v", err)
             }
             
-            if len(dids) == 0 {
+            if total == 0 {
                 fmt.Println("No DIDs found")
                 return nil
             }
@@ -433,6 +573,9 @@ func createDIDListCommand() *cobra.Command {
                     status = yellow("In Use")
                     destination = did.Destination
                 }
+                if did.IsTest {
+                    status += " " + yellow("[TEST]")
+                }
                 
                 lastUsed := "-"
                 if did.LastUsedAt != nil {
@@ -451,35 +594,43 @@ func createDIDListCommand() *cobra.Command {
             
             table.Render()
             
-            // Show summary
-            var available, inUse int
+            // Show summary for this page
+            var available, used int
             for _, did := range dids {
                 if did.InUse {
-                    inUse++
+                    used++
                 } else {
                     available++
                 }
             }
             
-            fmt.Printf("\nTotal: %d | Available: %s | In Use: %s\n",
-                len(dids),
+            printPageFooter(len(dids), total, opts)
+            fmt.Printf("Available: %s | In Use: %s\n",
                 green(fmt.Sprintf("%d", available)),
-                yellow(fmt.Sprintf("%d", inUse)))
+                yellow(fmt.Sprintf("%d", used)))
             
             return nil
         },
+        Annotations: changesNothing,
     }
     
     cmd.Flags().BoolVarP(&showAll, "all", "a", false, "Show all DIDs (including in use)")
+    cmd.Flags().BoolVar(&inUse, "in-use", false, "Only show DIDs in use")
     cmd.Flags().StringVarP(&provider, "provider", "p", "", "Filter by provider")
+    cmd.Flags().StringVar(&prefix, "prefix", "", "Filter by number prefix")
+    cmd.Flags().BoolVar(&testOnly, "test", false, "Only show test DIDs")
+    addListFlags(cmd, &opts, "number, provider, usage, last_used, created")
     
     return cmd
 }
 
 func createDIDDeleteCommand() *cobra.Command {
-    return &cobra.Command{
+    var reason string
+    
+    cmd := &cobra.Command{
         Use:   "delete <number>",
         Short: "Delete a DID from the pool",
+        Long:  "Delete a DID from the pool. The number is kept in its history, if it is added again it is quarantined for router.did_aging.quarantine.",
         Args:  cobra.ExactArgs(1),
         RunE: func(cmd *cobra.Command, args []string) error {
             ctx := context.Background()
@@ -498,7 +649,7 @@ func createDIDDeleteCommand() *cobra.Command {
                 return fmt.Errorf("cannot delete DID %s: currently in use", args[0])
             }
             
-            if err := deleteDID(ctx, args[0]); err != nil {
+            if _, err := routerSvc.GetDIDManager().RemoveDIDs(ctx, []string{args[0]}, reason, audit.CurrentUser()); err != nil {
                 return fmt.Errorf("failed to delete DID: %v", err)
             }
             
@@ -506,6 +657,10 @@ func createDIDDeleteCommand() *cobra.Command {
             return nil
         },
     }
+    
+    cmd.Flags().StringVar(&reason, "reason", "", "Why the number left the pool, e.g. removed by the carrier")
+    
+    return cmd
 }
 
 func createDIDReleaseCommand() *cobra.Command {
@@ -542,6 +697,19 @@ func createRouteCommands() *cobra.Command {
         createRouteListCommand(),
         createRouteDeleteCommand(),
         createRouteShowCommand(),
+        createRouteTestCommand(),
+        createRoutePolicyCommands(),
+        createRouteDialOptionsCommand(),
+        createRouteWeightCurveCommand(),
+        createRouteCostCeilingCommand(),
+        createRouteQueueCommand(),
+        createRouteFailoverCommand(),
+        createRouteScheduleCommand(),
+        createRoutePrefixCommands(),
+        createRouteExcludeCommand(),
+        createRouteParallelCommand(),
+        createRoutePassThroughCommand(),
+        createRouteHopsCommands(),
     )
     
     return routeCmd
@@ -553,8 +721,19 @@ func createRouteAddCommand() *cobra.Command {
         priority    int
         weight      int
         maxCalls    int
+        queueTime   int
         description string
         useGroups   bool
+        policyName  string
+        match       string
+        isTest      bool
+        failover    []string
+        exclude     []string
+        parallel    bool
+        passThrough bool
+        schedule    scheduleFlags
+        overrides   policyFlags
+        dial        dialFlags
     )
     
     cmd := &cobra.Command{
@@ -568,7 +747,23 @@ func createRouteAddCommand() *cobra.Command {
   router route add morocco-route inbound morocco-group panama-group --groups
   
   # Mixed providers and groups
-  router route add mixed s1 intermediate-group s4-term1 --groups`,
+  router route add mixed s1 intermediate-group s4-term1 --groups
+  
+  # One route for every inbound trunk named s1-east-*
+  router route add east s1-east- s3-provider1 s4-termination1 --match prefix
+  
+  # Regex over the whole provider name
+  router route add trunks 's1-(us|ca)-[0-9]+' s3-provider1 s4-termination1 --match regex --priority 20
+  
+  # Inherit settings from a shared policy, overriding the ANI prefix
+  router route add acme s1-acme s3-provider1 s4-termination1 --policy wholesale --ani-add 00
+    
+  # Transit traffic straight to S4, no DID taken from the pool
+  router route add transit s1-wholesale s3-provider1 s4-termination1 --pass-through --ani-add 00
+  
+  # Business hours only, calls at other times go to the next route of s1
+  router route add office s1 s3-provider1 s4-termination1 --priority 20 \
+    --schedule "mon-fri 08:00-18:00 America/Caracas" --schedule-holidays VE`,
         Args:  cobra.ExactArgs(4),
         RunE: func(cmd *cobra.Command, args []string) error {
             ctx := context.Background()
@@ -587,15 +782,82 @@ func createRouteAddCommand() *cobra.Command {
                 Priority:             priority,
                 Weight:               weight,
                 MaxConcurrentCalls:   maxCalls,
+                QueueTimeout:         queueTime,
                 Enabled:              true,
+                PolicyName:           policyName,
+                InboundMatch:         models.InboundMatchType(match),
+                IsTest:               isTest,
+                FailoverRoutes:       failover,
+            }
+            
+            if err := router.ValidateInboundPattern(route.InboundMatch, route.InboundProvider); err != nil {
+                return fmt.Errorf("invalid inbound match: %v", err)
+            }
+            if queueTime < 0 {
+                return fmt.Errorf("queue timeout can't be negative")
+            }
+            for _, name := range failover {
+                if name == route.Name {
+                    return fmt.Errorf("a route can't fail over to itself")
+                }
+                if _, err := routerSvc.GetRoute(ctx, name); err != nil {
+                    return fmt.Errorf("invalid failover route: %v", err)
+                }
+            }
+            
+            // Settings not given on the command line are inherited from the policy
+            if policyName != "" {
+                if _, err := routerSvc.GetRoutePolicy(ctx, policyName); err != nil {
+                    return fmt.Errorf("failed to get route policy: %v", err)
+                }
+                if !cmd.Flags().Changed("mode") {
+                    route.LoadBalanceMode = ""
+                }
+            }
+            route.VerificationEnabled, route.StrictMode, route.Manipulations = overrides.resolve(cmd, nil, nil, nil)
+            route.DialOptions = dial.options()
+            if err := route.DialOptions.Validate(); err != nil {
+                return fmt.Errorf("invalid dial options: %v", err)
+            }
+            windows, err := schedule.schedule()
+            if err != nil {
+                return fmt.Errorf("invalid schedule: %v", err)
+            }
+            rules := models.JSON{}
+            if !windows.IsEmpty() {
+                route.Schedule = windows
+                rules["schedule"] = windows
+            }
+            for _, name := range exclude {
+                if _, err := providerSvc.GetProvider(ctx, name); err != nil {
+                    return fmt.Errorf("invalid excluded provider: %v", err)
+                }
+            }
+            if len(exclude) > 0 {
+                route.ExcludedProviders = exclude
+                rules["exclude_providers"] = exclude
+            }
+            if parallel && passThrough {
+                return fmt.Errorf("a pass-through route has no intermediates to ring at once")
+            }
+            if parallel {
+                route.ParallelDial = true
+                rules["parallel_dial"] = true
+            }
+            if passThrough {
+                route.PassThrough = true
+                rules["pass_through"] = true
+            }
+            if len(rules) > 0 {
+                route.RoutingRules = rules
             }
             
             // Check if using groups
             if useGroups {
-                groupService := provider.NewGroupService(database.DB, cache)
+                groupService := newGroupService()
                 
-                // Check each provider/group
-                if _, err := groupService.GetGroup(ctx, args[1]); err == nil {
+                // Check each provider/group, patterns never name a group
+                if _, err := groupService.GetGroup(ctx, args[1]); err == nil && route.InboundMatch == models.InboundMatchExact {
                     route.InboundIsGroup = true
                 }
                 if _, err := groupService.GetGroup(ctx, args[2]); err == nil {
@@ -614,10 +876,36 @@ func createRouteAddCommand() *cobra.Command {
             
             // Show route details
             fmt.Printf("\nRoute Configuration:\n")
-            fmt.Printf("  Inbound:      %s %s\n", args[1], formatGroupIndicator(route.InboundIsGroup))
+            fmt.Printf("  Inbound:      %s %s%s\n", args[1], formatGroupIndicator(route.InboundIsGroup), formatMatchIndicator(route.InboundMatch))
             fmt.Printf("  Intermediate: %s %s\n", args[2], formatGroupIndicator(route.IntermediateIsGroup))
             fmt.Printf("  Final:        %s %s\n", args[3], formatGroupIndicator(route.FinalIsGroup))
-            fmt.Printf("  Load Balance: %s\n", mode)
+            if policyName != "" {
+                fmt.Printf("  Policy:       %s\n", policyName)
+            }
+            if route.LoadBalanceMode != "" {
+                fmt.Printf("  Load Balance: %s\n", route.LoadBalanceMode)
+            }
+            if route.QueueTimeout > 0 {
+                fmt.Printf("  Queue:        %ds\n", route.QueueTimeout)
+            }
+            if route.IsTest {
+                fmt.Printf("  Traffic:      %s\n", yellow("test"))
+            }
+            if len(route.FailoverRoutes) > 0 {
+                fmt.Printf("  Failover:     %s\n", strings.Join(route.FailoverRoutes, ", "))
+            }
+            if !route.Schedule.IsEmpty() {
+                fmt.Printf("  Schedule:     %s\n", route.Schedule)
+            }
+            if len(route.ExcludedProviders) > 0 {
+                fmt.Printf("  Excluded:     %s\n", strings.Join(route.ExcludedProviders, ", "))
+            }
+            if route.ParallelDial {
+                fmt.Printf("  Dial:         %s\n", "parallel")
+            }
+            if route.PassThrough {
+                fmt.Printf("  Dial:         %s\n", "pass-through, straight to the final provider")
+            }
             
             return nil
         },
@@ -627,8 +915,19 @@ func createRouteAddCommand() *cobra.Command {
     cmd.Flags().IntVar(&priority, "priority", 10, "Route priority")
     cmd.Flags().IntVar(&weight, "weight", 1, "Route weight")
     cmd.Flags().IntVar(&maxCalls, "max-calls", 0, "Maximum concurrent calls")
+    cmd.Flags().IntVar(&queueTime, "queue-timeout", 0, "Seconds calls wait for capacity at the call limit (0=reject)")
     cmd.Flags().StringVarP(&description, "description", "d", "", "Route description")
     cmd.Flags().BoolVar(&useGroups, "groups", false, "Enable group support for this route")
+    cmd.Flags().StringVar(&policyName, "policy", "", "Shared route policy to inherit settings from")
+    cmd.Flags().StringVar(&match, "match", "exact", "Inbound provider matching: exact, prefix or regex (full name)")
+    cmd.Flags().BoolVar(&isTest, "test", false, "Mark the route as test traffic, kept out of production stats")
+    cmd.Flags().StringSliceVar(&failover, "failover", nil, "Routes tried in order when this one has no provider for a call or its provider fails")
+    cmd.Flags().StringSliceVar(&exclude, "exclude", nil, "Providers the route never dials, even as members of its groups")
+    cmd.Flags().BoolVar(&parallel, "parallel", false, "Ring two intermediates at once, the first to bring the call back keeps it")
+    cmd.Flags().BoolVar(&passThrough, "pass-through", false, "Send calls straight to the final provider, without an intermediate or DID")
+    schedule.register(cmd)
+    overrides.register(cmd)
+    dial.register(cmd)
     
     return cmd
 }
@@ -640,8 +939,24 @@ func formatGroupIndicator(isGroup bool) string {
     return ""
 }
 
+func formatMatchIndicator(match models.InboundMatchType) string {
+    if match == "" || match == models.InboundMatchExact {
+        return ""
+    }
+    return yellow("[" + strings.ToUpper(string(match)) + "]")
+}
+
 func createRouteListCommand() *cobra.Command {
-    return &cobra.Command{
+    var (
+        filter       models.RouteFilter
+        enabledOnly  bool
+        disabledOnly bool
+        testOnly     bool
+        tagPairs     []string
+        opts         models.ListOptions
+    )
+    
+    cmd := &cobra.Command{
         Use:   "list",
         Short: "List all routes",
         RunE: func(cmd *cobra.Command, args []string) error {
@@ -651,12 +966,27 @@ func createRouteListCommand() *cobra.Command {
                 return err
             }
             
-            routes, err := listRoutes(ctx)
+            if enabledOnly || disabledOnly {
+                enabled := enabledOnly
+                filter.Enabled = &enabled
+            }
+            if testOnly {
+                filter.Test = &testOnly
+            }
+            if len(tagPairs) > 0 {
+                tags, err := models.ParseTags(tagPairs, true)
+                if err != nil {
+                    return err
+                }
+                filter.Tags = tags
+            }
+            
+            routes, total, err := routerSvc.ListRoutes(ctx, filter, opts)
             if err != nil {
                 return fmt.Errorf("failed to list routes: %v", err)
             }
             
-            if len(routes) == 0 {
+            if total == 0 {
                 fmt.Println("No routes found")
                 return nil
             }
@@ -670,6 +1000,9 @@ func createRouteListCommand() *cobra.Command {
                 if !r.Enabled {
                     status = red("Disabled")
                 }
+                if r.IsTest {
+                    status += " " + yellow("[TEST]")
+                }
                 
                 calls := fmt.Sprintf("%d", r.CurrentCalls)
                 if r.MaxConcurrentCalls > 0 {
@@ -680,6 +1013,8 @@ func createRouteListCommand() *cobra.Command {
                 inbound := r.InboundProvider
                 if r.InboundIsGroup {
                     inbound = fmt.Sprintf("%s %s", r.InboundProvider, blue("[G]"))
+                } else if indicator := formatMatchIndicator(r.InboundMatch); indicator != "" {
+                    inbound = fmt.Sprintf("%s %s", r.InboundProvider, indicator)
                 }
                 
                 intermediate := r.IntermediateProvider
@@ -705,9 +1040,22 @@ func createRouteListCommand() *cobra.Command {
             }
             
             table.Render()
+            printPageFooter(len(routes), total, opts)
             return nil
         },
+        Annotations: changesNothing,
     }
+    
+    cmd.Flags().StringVar(&filter.Inbound, "inbound", "", "Filter by inbound provider")
+    cmd.Flags().StringVarP(&filter.Provider, "provider", "p", "", "Filter by provider on any leg")
+    cmd.Flags().StringVar(&filter.Policy, "policy", "", "Filter by route policy")
+    cmd.Flags().BoolVar(&enabledOnly, "enabled", false, "Only show enabled routes")
+    cmd.Flags().BoolVar(&disabledOnly, "disabled", false, "Only show disabled routes")
+    cmd.Flags().BoolVar(&testOnly, "test", false, "Only show test routes")
+    cmd.Flags().StringArrayVar(&tagPairs, "tag", nil, "Only routes with a provider carrying tag key=value or key (repeatable)")
+    addListFlags(cmd, &opts, "name, priority, inbound, calls, created")
+    
+    return cmd
 }
 
 func createRouteDeleteCommand() *cobra.Command {
@@ -767,24 +1115,61 @@ func createRouteShowCommand() *cobra.Command {
             }
             
             // Show providers with group indicators
-            fmt.Printf("Inbound Provider:   %s %s\n", route.InboundProvider, formatGroupIndicator(route.InboundIsGroup))
+            fmt.Printf("Inbound Provider:   %s %s%s\n", route.InboundProvider, formatGroupIndicator(route.InboundIsGroup), formatMatchIndicator(route.InboundMatch))
             fmt.Printf("Intermediate:       %s %s\n", route.IntermediateProvider, formatGroupIndicator(route.IntermediateIsGroup))
             fmt.Printf("Final Provider:     %s %s\n", route.FinalProvider, formatGroupIndicator(route.FinalIsGroup))
             
+            if route.PolicyName != "" {
+                fmt.Printf("Policy:             %s\n", route.PolicyName)
+            }
             fmt.Printf("Load Balance Mode:  %s\n", route.LoadBalanceMode)
             fmt.Printf("Priority:           %d\n", route.Priority)
             fmt.Printf("Weight:             %d\n", route.Weight)
             fmt.Printf("Max Concurrent:     %d\n", route.MaxConcurrentCalls)
             fmt.Printf("Current Calls:      %d\n", route.CurrentCalls)
+            if route.QueueTimeout > 0 {
+                fmt.Printf("Queue Timeout:      %ds\n", route.QueueTimeout)
+            }
             fmt.Printf("Status:             %s\n", formatBool(route.Enabled))
+            if route.IsTest {
+                fmt.Printf("Traffic:            %s\n", yellow("test"))
+            }
+            fmt.Printf("Verification:       %s\n", formatOptionalBool(route.VerificationEnabled))
+            fmt.Printf("Strict Mode:        %s\n", formatOptionalBool(route.StrictMode))
+            if !route.Manipulations.IsEmpty() {
+                fmt.Printf("Manipulations:      %s\n", formatManipulations(route.Manipulations))
+            }
+            if !route.DialOptions.IsEmpty() {
+                fmt.Printf("Dial Options:       %s\n", formatDialOptions(route.DialOptions))
+            }
             if len(route.FailoverRoutes) > 0 {
                 fmt.Printf("Failover Routes:    %s\n", strings.Join(route.FailoverRoutes, ", "))
             }
+            if !route.Schedule.IsEmpty() {
+                open := red("closed now")
+                if routerSvc.RouteOpen(ctx, route, time.Now()) {
+                    open = green("open now")
+                }
+                fmt.Printf("Schedule:           %s (%s)\n", route.Schedule, open)
+            }
+            if len(route.ExcludedProviders) > 0 {
+                fmt.Printf("Excluded Providers: %s\n", strings.Join(route.ExcludedProviders, ", "))
+            }
+            if route.ParallelDial {
+                fmt.Printf("Parallel Dial:      %s\n", green("on"))
+            }
+            if route.PassThrough {
+                fmt.Printf("Pass-Through:       %s\n", green("on"))
+            }
+            if len(route.Hops) > 0 {
+                fmt.Printf("Topology:           %s\n", strings.Join(route.Topology(), " → "))
+            }
             fmt.Printf("Created:            %s\n", route.CreatedAt.Format(time.RFC3339))
             fmt.Printf("Updated:            %s\n", route.UpdatedAt.Format(time.RFC3339))
             
             return nil
         },
+        Annotations: changesNothing,
     }
 }
 
@@ -793,11 +1178,18 @@ func createStatsCommand() *cobra.Command {
         showProviders bool
         showCalls     bool
         showDIDs      bool
+        showBilling   bool
+        period        string
     )
     
     cmd := &cobra.Command{
         Use:   "stats",
         Short: "Show system statistics",
+        Long: `Show system statistics.
+
+Billing totals the revenue, cost and margin of the production calls that
+ended over --period, per customer, with the DID rental of the period taken
+off the net margin. Customer rates are managed with router rates.`,
         RunE: func(cmd *cobra.Command, args []string) error {
             ctx := context.Background()
             
@@ -806,10 +1198,16 @@ func createStatsCommand() *cobra.Command {
             }
             
             // If no specific flag, show all
-            if !showProviders && !showCalls && !showDIDs {
+            if !showProviders && !showCalls && !showDIDs && !showBilling {
                 showProviders = true
                 showCalls = true
                 showDIDs = true
+                showBilling = true
+            }
+    
+            length, err := parseScorecardPeriod(period)
+            if err != nil {
+                return err
             }
             
             stats, err := routerSvc.GetStatistics(ctx)
@@ -863,17 +1261,81 @@ func createStatsCommand() *cobra.Command {
                 table.Render()
             }
             
+            if showBilling {
+                to := time.Now()
+                report, err := routerSvc.GetBillingReport(ctx, to.Add(-length), to)
+                if err != nil {
+                    return fmt.Errorf("failed to get billing: %v", err)
+                }
+                printBillingReport(report, period)
+            }
+    
             return nil
         },
+        Annotations: changesNothing,
     }
     
     cmd.Flags().BoolVar(&showProviders, "providers", false, "Show provider statistics")
     cmd.Flags().BoolVar(&showCalls, "calls", false, "Show call statistics")
     cmd.Flags().BoolVar(&showDIDs, "dids", false, "Show DID statistics")
+    cmd.Flags().BoolVar(&showBilling, "billing", false, "Show revenue, cost and margin per customer")
+    cmd.Flags().StringVar(&period, "period", "1d", "Billing period ending now, e.g. 24h, 7d or 4w")
+    
+    cmd.AddCommand(
+        createStatsSnapshotCommand(),
+        createStatsHistoryCommand(),
+        createStatsShortCallsCommand(),
+    )
     
     return cmd
 }
 
+// printBillingReport prints the billing of each customer and the totals
+func printBillingReport(report *models.BillingReport, period string) {
+    currency := report.Total.Currency
+    fmt.Printf("\n%s\n", bold(fmt.Sprintf("Billing (last %s, %s)", period, currency)))
+    
+    if len(report.Customers) == 0 {
+        fmt.Println("No rated calls")
+    } else {
+        table := tablewriter.NewWriter(os.Stdout)
+        table.SetHeader([]string{"Customer", "Calls", "Answered", "Minutes", "Revenue", "Cost", "Margin", "Margin %"})
+        table.SetBorder(false)
+    
+        for _, s := range append(report.Customers, &report.Total) {
+            name := orDash(s.Customer)
+            if s == &report.Total {
+                name = bold("Total")
+            }
+            margin := fmt.Sprintf("%.2f", s.Margin)
+            if s.Margin < 0 {
+                margin = red(margin)
+            }
+            table.Append([]string{
+                name,
+                fmt.Sprintf("%d", s.Calls),
+                fmt.Sprintf("%d", s.Answered),
+                fmt.Sprintf("%.1f", s.BilledMinutes),
+                fmt.Sprintf("%.2f", s.Revenue),
+                fmt.Sprintf("%.2f", s.Cost),
+                margin,
+                fmt.Sprintf("%.1f%%", s.MarginPercent),
+            })
+        }
+    
+        table.Render()
+    }
+    
+    net := fmt.Sprintf("%.2f %s", report.NetMargin, currency)
+    if report.NetMargin < 0 {
+        net = red(net)
+    } else {
+        net = green(net)
+    }
+    fmt.Printf("DID Rental:      %.2f %s\n", report.DIDRental, currency)
+    fmt.Printf("Net Margin:      %s\n", net)
+}
+
 func createLoadBalancerCommand() *cobra.Command {
     return &cobra.Command{
         Use:   "lb",
@@ -914,6 +1376,8 @@ func createLoadBalancerCommand() *cobra.Command {
                     health := green("Healthy")
                     if !stat.IsHealthy {
                         health = red("Unhealthy")
+                    } else if stat.WarmingUp {
+                        health = yellow(fmt.Sprintf("Warming up (%.0f%%)", stat.WarmupPercent))
                     }
                     
                     fmt.Printf("  %s:\n", stat.ProviderName)
@@ -926,13 +1390,40 @@ func createLoadBalancerCommand() *cobra.Command {
             
             return nil
         },
+        Annotations: changesNothing,
     }
 }
 
 func createCallsCommand() *cobra.Command {
-    return &cobra.Command{
-        Use:   "calls",
-        Short: "Show active calls",
+    var (
+        filter     models.CallFilter
+        status     string
+        history    bool
+        testOnly   bool
+        production bool
+        channels   bool
+        opts       models.ListOptions
+    )
+    
+    cmd := &cobra.Command{
+        Use:     "calls",
+        Aliases: []string{"call"},
+        Short:   "Show active calls",
+        Long: `Show active calls.
+
+Active calls are read live from the AGI server's management API, with the
+state of the leg each call is on; the database is only used when the API
+cannot be reached. --history and --disposition list call records instead.
+
+--channels correlates the active call records with the channels Asterisk
+holds, listed over AMI with CoreShowChannels: each call's channels with
+their state, codec, RTCP jitter and loss and the channels they're bridged
+with. Calls Asterisk has no channel of are flagged as ghosts, left active in
+call_records after their channels went away, and channels of no active call
+are listed as orphans.`,
+        Example: `  router calls
+  router calls --channels
+  router calls --channels --route uk-premium`,
         RunE: func(cmd *cobra.Command, args []string) error {
             ctx := context.Background()
             
@@ -940,116 +1431,134 @@ func createCallsCommand() *cobra.Command {
                 return err
             }
             
-            calls, err := getActiveCalls(ctx)
+            filter.ActiveOnly = !history
+            filter.Status = models.CallStatus(strings.ToUpper(status))
+            if testOnly || production {
+                isTest := testOnly
+                filter.Test = &isTest
+            }
+    
+            if channels {
+                if history {
+                    return fmt.Errorf("--channels shows active calls only, it can't be used with --history")
+                }
+                return showCallChannels(ctx, filter)
+            }
+            if !history && filter.Disposition == "" {
+                return showActiveCalls(ctx, filter, opts)
+            }
+            
+            calls, total, err := routerSvc.ListCalls(ctx, filter, opts)
             if err != nil {
-                return fmt.Errorf("failed to get active calls: %v", err)
+                return fmt.Errorf("failed to get calls: %v", err)
             }
             
-            if len(calls) == 0 {
-                fmt.Println("No active calls")
+            if total == 0 {
+                if history {
+                    fmt.Println("No calls found")
+                } else {
+                    fmt.Println("No active calls")
+                }
                 return nil
             }
             
             table := tablewriter.NewWriter(os.Stdout)
-            table.SetHeader([]string{"Call ID", "ANI", "DNIS", "DID", "Route", "Status", "Duration"})
+            table.SetHeader([]string{"Call ID", "ANI", "DNIS", "DID", "Route", "Status", "Disposition", "Duration"})
             table.SetBorder(false)
             
             for _, call := range calls {
                 duration := time.Since(call.StartTime)
+                if call.EndTime != nil {
+                    duration = time.Duration(call.Duration) * time.Second
+                }
+                
+                callID := call.CallID
+                if len(callID) > 8 {
+                    callID = callID[:8] + "..."
+                }
+                
+                callStatus := string(call.Status)
+                if call.IsTest {
+                    callStatus += " " + yellow("[TEST]")
+                }
                 
                 table.Append([]string{
-                    call.CallID[:8] + "...",
-                    call.OriginalANI,
-                    call.OriginalDNIS,
+                    callID,
+                    cliNumber(call.OriginalANI),
+                    cliNumber(call.OriginalDNIS),
                     call.AssignedDID,
                     call.RouteName,
-                    string(call.Status),
+                    callStatus,
+                    orDash(call.Disposition),
                     fmt.Sprintf("%02d:%02d", int(duration.Minutes()), int(duration.Seconds())%60),
                 })
             }
             
             table.Render()
-            
-            fmt.Printf("\nTotal active calls: %d\n", len(calls))
+            printPageFooter(len(calls), total, opts)
             
             return nil
         },
+        Annotations: changesNothing,
     }
+    
+    cmd.Flags().BoolVar(&history, "history", false, "Include completed calls")
+    cmd.Flags().StringVar(&status, "status", "", "Filter by call status")
+    cmd.Flags().StringVar(&filter.Route, "route", "", "Filter by route")
+    cmd.Flags().StringVarP(&filter.Provider, "provider", "p", "", "Filter by provider on any leg")
+    cmd.Flags().StringVar(&filter.ANI, "ani", "", "Filter by original ANI")
+    cmd.Flags().StringVar(&filter.DNIS, "dnis", "", "Filter by original DNIS")
+    cmd.Flags().StringVar(&filter.Disposition, "disposition", "", "Filter by hangup disposition")
+    cmd.Flags().BoolVar(&testOnly, "test", false, "Only show test calls")
+    cmd.Flags().BoolVar(&production, "production", false, "Hide test calls")
+    cmd.Flags().BoolVar(&channels, "channels", false, "Correlate the calls with Asterisk's live channels over AMI")
+    addListFlags(cmd, &opts, "start, route, status, duration")
+    
+    cmd.AddCommand(createCallOriginateCommand())
+    
+    return cmd
 }
 
 func createMonitorCommand() *cobra.Command {
-    return &cobra.Command{
+    var interval time.Duration
+    
+    cmd := &cobra.Command{
         Use:   "monitor",
         Short: "Real-time system monitoring",
+        Long: `Interactive dashboard of the router, refreshed every --interval.
+
+Tabs show the active calls, provider health, the DID pool of each provider
+and the latest failed calls. Active calls are read from the AGI server, or
+from the database when its API is unreachable.
+
+Keys:
+  Tab, 1-4   switch tabs
+  s, S       sort by the next or previous column
+  o          reverse the sort order
+  Enter      show the details of the selected call
+  h          hang up the selected call, through AMI
+  p          pause refreshing
+  r          refresh now
+  q, Ctrl+C  quit`,
+        Args: cobra.NoArgs,
         RunE: func(cmd *cobra.Command, args []string) error {
-            ctx := context.Background()
+            if interval <= 0 {
+                return fmt.Errorf("--interval must be positive")
+            }
             
+            ctx := cmd.Context()
             if err := initializeForCLI(ctx); err != nil {
                 return err
             }
             
-            fmt.Println("Starting real-time monitor... Press Ctrl+C to exit")
-            
-            ticker := time.NewTicker(2 * time.Second)
-            defer ticker.Stop()
-            
-            // Clear screen
-            fmt.Print("\033[H\033[2J")
-            
-            for {
-                select {
-                case <-ticker.C:
-                    // Clear screen
-                    fmt.Print("\033[H\033[2J")
-                    
-                    // Get current stats
-                    stats, _ := routerSvc.GetStatistics(ctx)
-                    calls, _ := getActiveCalls(ctx)
-                    providerStats := routerSvc.GetLoadBalancer().GetProviderStats()
-                    
-                    // Display header
-                    fmt.Printf("%s %s\n\n", bold("Asterisk ARA Router Monitor"), time.Now().Format("15:04:05"))
-                    
-                    // Active calls summary
-                    fmt.Printf("%s Active Calls: %s\n", bold("📞"), yellow(fmt.Sprintf("%d", len(calls))))
-                    
-                    // DID utilization
-                    if didUtil, ok := stats["did_utilization"].(float64); ok {
-                        fmt.Printf("%s DID Utilization: %.1f%%\n", bold("📱"), didUtil)
-                    }
-                    
-                    // Provider health
-                    fmt.Printf("\n%s\n", bold("Provider Health:"))
-                    for name, stat := range providerStats {
-                        status := green("●")
-                        if !stat.IsHealthy {
-                            status = red("●")
-                        }
-                        fmt.Printf("  %s %s - Active: %d, Success: %.1f%%\n",
-                            status, name, stat.ActiveCalls, stat.SuccessRate)
-                    }
-                    
-                    // Recent calls
-                    if len(calls) > 0 {
-                        fmt.Printf("\n%s\n", bold("Recent Calls:"))
-                        for i, call := range calls {
-                            if i >= 5 {
-                                break
-                            }
-                            duration := time.Since(call.StartTime)
-                            fmt.Printf("  %s → %s [%s] %02d:%02d\n",
-                                call.OriginalANI, call.OriginalDNIS,
-                                call.Status,
-                                int(duration.Minutes()), int(duration.Seconds())%60)
-                        }
-                    }
-                    
-                case <-cmd.Context().Done():
-                    return nil
-                }
-            }
+            return runMonitor(ctx, interval)
         },
+        Annotations: changesNothing,
     }
+    
+    cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "How often the dashboard refreshes")
+    
+    return cmd
 }
 
 // Helper functions
@@ -1080,6 +1589,7 @@ func initializeForCLI(ctx context.Context) error {
     if logConfig.Format == "" {
         logConfig.Format = "text"  // Use text format for CLI
     }
+    configureMasking(&logConfig)
     
     if err := logger.Init(logConfig); err != nil {
         return fmt.Errorf("failed to initialize logger: %v", err)
@@ -1089,7 +1599,7 @@ func initializeForCLI(ctx context.Context) error {
         return fmt.Errorf("failed to initialize database: %v", err)
     }
     
-    return nil
+    return checkCommandWritable(ctx)
 }
 
 func formatStatus(active bool, healthStatus string) string {
@@ -1114,70 +1624,97 @@ func formatBool(b bool) string {
     return red("No")
 }
 
-// Database helper functions
-func addDID(ctx context.Context, did *models.DID) error {
-    query := `
-        INSERT INTO dids (number, provider_name, in_use, monthly_cost, per_minute_cost)
-        VALUES (?, ?, ?, ?, ?)`
-    
-    _, err := database.ExecContext(ctx, query,
-        did.Number, did.ProviderName, did.InUse,
-        did.MonthlyCost, did.PerMinuteCost)
-    
-    return err
+// formatCurrency names the currency of a rate, empty is the reporting currency
+func formatCurrency(currency string) string {
+    if currency == "" {
+        return routerSvc.GetFX().Currency()
+    }
+    return currency
 }
 
-func listDIDs(ctx context.Context, provider string, availableOnly bool) ([]*models.DID, error) {
-    query := `
-        SELECT id, number, provider_name, in_use, destination,
-               last_used_at, usage_count, created_at, updated_at
-        FROM dids
-        WHERE 1=1`
-    
-    var args []interface{}
-    
-    if provider != "" {
-        query += " AND provider_name = ?"
-        args = append(args, provider)
+// parseBillingRule parses minimum/increment seconds, e.g. 60/60
+func parseBillingRule(s string) (models.BillingRule, error) {
+    parts := strings.SplitN(s, "/", 2)
+    if len(parts) != 2 {
+        return models.BillingRule{}, fmt.Errorf("invalid billing %q, expected minimum/increment", s)
     }
     
-    if availableOnly {
-        query += " AND in_use = 0"
+    minimum, err := strconv.Atoi(parts[0])
+    if err != nil || minimum < 0 {
+        return models.BillingRule{}, fmt.Errorf("invalid billing minimum %q", parts[0])
+    }
+    increment, err := strconv.Atoi(parts[1])
+    if err != nil || increment < 1 {
+        return models.BillingRule{}, fmt.Errorf("invalid billing increment %q", parts[1])
     }
     
-    query += " ORDER BY number"
+    return models.BillingRule{MinDuration: minimum, Increment: increment}, nil
+}
+
+// Database helper functions
+// importDIDs adds DIDs to the pool and reports the rows skipped or failed,
+// the first ten of each kind. Cancelling with Ctrl+C rolls the whole import back.
+func importDIDs(ctx context.Context, rows []*router.DIDImportRow, opts router.DIDImportOptions) error {
+    operation := "DID import"
+    if opts.DryRun {
+        operation += " (dry run)"
+    }
+    summary := &operationSummary{Operation: operation, Total: len(rows), Started: time.Now()}
     
-    rows, err := database.QueryContext(ctx, query, args...)
+    bar := newProgress("Importing DIDs", len(rows))
+    report, err := routerSvc.GetDIDManager().ImportDIDs(ctx, rows, opts, func(n int) { bar.Add(n) })
+    bar.Finish()
     if err != nil {
-        return nil, err
+        return fmt.Errorf("failed to import DIDs: %v", err)
     }
-    defer rows.Close()
-    
-    var dids []*models.DID
-    
-    for rows.Next() {
-        var did models.DID
-        var destination sql.NullString
-        
-        err := rows.Scan(
-            &did.ID, &did.Number, &did.ProviderName, &did.InUse,
-            &destination, &did.LastUsedAt, &did.UsageCount,
-            &did.CreatedAt, &did.UpdatedAt,
-        )
-        
-        if err != nil {
-            logger.WithContext(ctx).WithError(err).Warn("Failed to scan DID")
+    
+    shown := make(map[string]int)
+    for _, row := range report.Rows {
+        if row.Status == "" || row.Status == router.DIDImportAdded || row.Status == router.DIDImportRolledBack {
+            continue
+        }
+        shown[row.Status]++
+        if shown[row.Status] > 10 {
             continue
         }
-        
-        if destination.Valid {
-            did.Destination = destination.String
+        mark := red("✗")
+        if row.Status == router.DIDImportDuplicate || row.Status == router.DIDImportExisting {
+            mark = yellow("!")
+        }
+        if row.Line > 0 {
+            fmt.Fprintf(os.Stderr, "%s Line %d, %s: %s\n", mark, row.Line, row.DID.Number, row.Problem)
+        } else {
+            fmt.Fprintf(os.Stderr, "%s %s: %s\n", mark, row.DID.Number, row.Problem)
         }
-        
-        dids = append(dids, &did)
     }
     
-    return dids, nil
+    summary.Succeeded = report.Count(router.DIDImportAdded)
+    summary.Failed = report.Count(router.DIDImportInvalid) + report.Count(router.DIDImportFailed)
+    summary.Skipped = report.Count(router.DIDImportDuplicate) + report.Count(router.DIDImportExisting) +
+        report.Count(router.DIDImportRolledBack) + report.Count("")
+    summary.Cancelled = report.Cancelled
+    summary.RolledBack = report.Cancelled
+    summary.Print()
+    fmt.Printf("  Duplicates: %d, Already in pool: %d\n",
+        report.Count(router.DIDImportDuplicate), report.Count(router.DIDImportExisting))
+    if report.Cancelled {
+        fmt.Printf("  Rolled back: %d, Not reached: %d\n",
+            report.Count(router.DIDImportRolledBack), report.Count(""))
+    }
+    if opts.DryRun {
+        fmt.Printf("  %s\n", yellow("Dry run, no DID was added"))
+    }
+    if report.Quarantined > 0 {
+        fmt.Printf("  %s\n", yellow(fmt.Sprintf("%d recycled DIDs quarantined, see: router did history <number>", report.Quarantined)))
+    }
+    
+    if report.Cancelled {
+        return fmt.Errorf("import cancelled")
+    }
+    if summary.Failed > 0 {
+        return fmt.Errorf("%d DIDs failed to import", summary.Failed)
+    }
+    return nil
 }
 
 func getDID(ctx context.Context, number string) (*models.DID, error) {
@@ -1207,11 +1744,6 @@ func getDID(ctx context.Context, number string) (*models.DID, error) {
     return &did, nil
 }
 
-func deleteDID(ctx context.Context, number string) error {
-    _, err := database.ExecContext(ctx, "DELETE FROM dids WHERE number = ?", number)
-    return err
-}
-
 func releaseDID(ctx context.Context, number string) error {
     query := `
         UPDATE dids 
@@ -1223,141 +1755,87 @@ func releaseDID(ctx context.Context, number string) error {
 }
 
 func createRoute(ctx context.Context, route *models.ProviderRoute) error {
+    // Unset settings are stored as NULL so they are inherited from the route policy
+    var mode, maxCalls interface{}
+    if route.LoadBalanceMode != "" {
+        mode = string(route.LoadBalanceMode)
+    }
+    if route.PolicyName == "" || route.MaxConcurrentCalls > 0 {
+        maxCalls = route.MaxConcurrentCalls
+    }
+    
+    inboundMatch := route.InboundMatch
+    if inboundMatch == "" {
+        inboundMatch = models.InboundMatchExact
+    }
+    
+    var policyName, manipulations, dialOptions, queueTimeout, failoverRoutes, routingRules interface{}
+    if route.PolicyName != "" {
+        policyName = route.PolicyName
+    }
+    if !route.Manipulations.IsEmpty() {
+        manipulations, _ = json.Marshal(route.Manipulations)
+    }
+    if !route.DialOptions.IsEmpty() {
+        dialOptions, _ = json.Marshal(route.DialOptions)
+    }
+    if route.QueueTimeout > 0 {
+        queueTimeout = route.QueueTimeout
+    }
+    if len(route.FailoverRoutes) > 0 {
+        failoverRoutes, _ = json.Marshal(route.FailoverRoutes)
+    }
+    if len(route.RoutingRules) > 0 {
+        routingRules, _ = json.Marshal(route.RoutingRules)
+    }
+    
     query := `
         INSERT INTO provider_routes (
             name, description, inbound_provider, intermediate_provider,
             final_provider, inbound_is_group, intermediate_is_group,
             final_is_group, load_balance_mode, priority, weight,
-            max_concurrent_calls, enabled
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+            max_concurrent_calls, enabled, policy_name,
+            verification_enabled, strict_mode, manipulations, inbound_match, is_test,
+            dial_options, queue_timeout, failover_routes, routing_rules
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
     
     _, err := database.ExecContext(ctx, query,
         route.Name, route.Description, route.InboundProvider,
         route.IntermediateProvider, route.FinalProvider,
         route.InboundIsGroup, route.IntermediateIsGroup, route.FinalIsGroup,
-        route.LoadBalanceMode, route.Priority, route.Weight,
-        route.MaxConcurrentCalls, route.Enabled)
-    
-    return err
-}
-
-func listRoutes(ctx context.Context) ([]*models.ProviderRoute, error) {
-    query := `
-        SELECT id, name, COALESCE(description, ''), inbound_provider, intermediate_provider,
-               final_provider, COALESCE(inbound_is_group, 0), COALESCE(intermediate_is_group, 0),
-               COALESCE(final_is_group, 0), load_balance_mode, priority, weight,
-               max_concurrent_calls, current_calls, enabled,
-               created_at, updated_at
-        FROM provider_routes
-        ORDER BY priority DESC, name`
-    
-    rows, err := database.QueryContext(ctx, query)
+        mode, route.Priority, route.Weight,
+        maxCalls, route.Enabled, policyName,
+        route.VerificationEnabled, route.StrictMode, manipulations, inboundMatch, route.IsTest,
+        dialOptions, queueTimeout, failoverRoutes, routingRules)
     if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-    
-    var routes []*models.ProviderRoute
-    
-    for rows.Next() {
-        var route models.ProviderRoute
-        
-        err := rows.Scan(
-            &route.ID, &route.Name, &route.Description,
-            &route.InboundProvider, &route.IntermediateProvider,
-            &route.FinalProvider, &route.InboundIsGroup,
-            &route.IntermediateIsGroup, &route.FinalIsGroup,
-            &route.LoadBalanceMode, &route.Priority, &route.Weight,
-            &route.MaxConcurrentCalls, &route.CurrentCalls,
-            &route.Enabled, &route.CreatedAt, &route.UpdatedAt,
-        )
-        
-        if err != nil {
-            logger.WithContext(ctx).WithError(err).Warn("Failed to scan route")
-            continue
-        }
-        
-        routes = append(routes, &route)
+        return err
     }
     
-    return routes, nil
+    // Every router drops its cached routes, group routes are cached per member
+    // and prefix routes under their prefixes
+    if _, err := cache.Flush(ctx, "route"); err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to flush cached routes")
+    }
+    return nil
 }
 
 func getRoute(ctx context.Context, name string) (*models.ProviderRoute, error) {
-    var route models.ProviderRoute
-    
-    query := `
-        SELECT id, name, COALESCE(description, ''), inbound_provider, intermediate_provider,
-               final_provider, COALESCE(inbound_is_group, 0), COALESCE(intermediate_is_group, 0),
-               COALESCE(final_is_group, 0), load_balance_mode, priority, weight,
-               max_concurrent_calls, current_calls, enabled,
-               COALESCE(failover_routes, '[]'), COALESCE(routing_rules, '{}'), 
-               COALESCE(metadata, '{}'), created_at, updated_at
-        FROM provider_routes
-        WHERE name = ?`
-    
-    err := database.QueryRowContext(ctx, query, name).Scan(
-        &route.ID, &route.Name, &route.Description,
-        &route.InboundProvider, &route.IntermediateProvider,
-        &route.FinalProvider, &route.InboundIsGroup,
-        &route.IntermediateIsGroup, &route.FinalIsGroup,
-        &route.LoadBalanceMode, &route.Priority, &route.Weight,
-        &route.MaxConcurrentCalls, &route.CurrentCalls,
-        &route.Enabled, &route.FailoverRoutes,
-        &route.RoutingRules, &route.Metadata,
-        &route.CreatedAt, &route.UpdatedAt,
-    )
-    
-    if err != nil {
-        return nil, err
-    }
-    
-    return &route, nil
+    return routerSvc.GetRoute(ctx, name)
 }
 
 func deleteRoute(ctx context.Context, name string) error {
     _, err := database.ExecContext(ctx, "DELETE FROM provider_routes WHERE name = ?", name)
-    return err
-}
-
-func getActiveCalls(ctx context.Context) ([]*models.CallRecord, error) {
-    query := `
-        SELECT call_id, original_ani, original_dnis, 
-               COALESCE(transformed_ani, ''), COALESCE(assigned_did, ''),
-               inbound_provider, intermediate_provider, final_provider, 
-               COALESCE(route_name, ''), status, COALESCE(current_step, ''),
-               start_time, answer_time
-        FROM call_records
-        WHERE status IN ('INITIATED', 'ACTIVE', 'RETURNED_FROM_S3', 'ROUTING_TO_S4')
-        ORDER BY start_time DESC`
-    
-    rows, err := database.QueryContext(ctx, query)
     if err != nil {
-        return nil, err
+        return err
     }
-    defer rows.Close()
-    
-    var calls []*models.CallRecord
-    
-    for rows.Next() {
-        var call models.CallRecord
-        
-        err := rows.Scan(
-            &call.CallID, &call.OriginalANI, &call.OriginalDNIS,
-            &call.TransformedANI, &call.AssignedDID,
-            &call.InboundProvider, &call.IntermediateProvider,
-            &call.FinalProvider, &call.RouteName,
-            &call.Status, &call.CurrentStep,
-            &call.StartTime, &call.AnswerTime,
-        )
-        
-        if err != nil {
-            logger.WithContext(ctx).WithError(err).Warn("Failed to scan call record")
-            continue
-        }
-        
-        calls = append(calls, &call)
+    
+    // Its destination prefixes would only be skipped from now on
+    if _, err := database.ExecContext(ctx, "DELETE FROM route_prefixes WHERE route_name = ?", name); err != nil {
+        return err
     }
     
-    return calls, nil
+    if _, err := cache.Flush(ctx, "route"); err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to flush cached routes")
+    }
+    return nil
 }
@@ -3,14 +3,24 @@ package main
 import (
     "context"
     "fmt"
+    "os"
+    "strconv"
+    "strings"
     "time"
     
+    "github.com/fsnotify/fsnotify"
     "github.com/spf13/viper"
     "github.com/hamzaKhattat/ara-production-system/internal/ami"
     "github.com/hamzaKhattat/ara-production-system/internal/ara"
+    "github.com/hamzaKhattat/ara-production-system/internal/buildinfo"
     "github.com/hamzaKhattat/ara-production-system/internal/db"
+    "github.com/hamzaKhattat/ara-production-system/internal/drift"
+    "github.com/hamzaKhattat/ara-production-system/internal/faults"
     "github.com/hamzaKhattat/ara-production-system/internal/health"
+    "github.com/hamzaKhattat/ara-production-system/internal/i18n"
+    "github.com/hamzaKhattat/ara-production-system/internal/masking"
     "github.com/hamzaKhattat/ara-production-system/internal/metrics"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
     "github.com/hamzaKhattat/ara-production-system/internal/provider"
     "github.com/hamzaKhattat/ara-production-system/internal/router"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
@@ -40,10 +50,24 @@ func loadConfig() error {
         logger.Warn("No config file found, using defaults and environment")
     }
     
+    // Language of CLI and API messages, API clients may ask for another with Accept-Language
+    if lang := viper.GetString("app.language"); !i18n.SetDefault(lang) {
+        logger.WithField("language", lang).Warn("Unsupported app.language, messages stay in English")
+    }
+    
     return nil
 }
 
 func setDefaults() {
+    viper.SetDefault("app.environment", "development")
+    viper.SetDefault("app.language", "en")
+    
+    // Startup dependency defaults
+    viper.SetDefault("startup.wait_for_deps", false)
+    viper.SetDefault("startup.wait_timeout", "2m")
+    viper.SetDefault("startup.dependencies.redis", "optional")
+    viper.SetDefault("startup.dependencies.ami", "degraded")
+    
     // Database defaults
     viper.SetDefault("database.driver", "mysql")
     viper.SetDefault("database.host", "localhost")
@@ -54,6 +78,12 @@ func setDefaults() {
     viper.SetDefault("database.max_open_conns", 25)
     viper.SetDefault("database.max_idle_conns", 5)
     viper.SetDefault("database.conn_max_lifetime", "5m")
+    viper.SetDefault("database.retry_attempts", 3)
+    viper.SetDefault("database.retry_delay", "1s")
+    viper.SetDefault("database.query_retry_delay", "50ms")
+    viper.SetDefault("database.query_retry_max_delay", "1s")
+    viper.SetDefault("database.schema_check.enabled", true)
+    viper.SetDefault("database.schema_check.heal", true)
     
     // AGI defaults
     viper.SetDefault("agi.listen_address", "0.0.0.0")
@@ -63,12 +93,195 @@ func setDefaults() {
     viper.SetDefault("agi.write_timeout", "30s")
     viper.SetDefault("agi.idle_timeout", "120s")
     viper.SetDefault("agi.shutdown_timeout", "30s")
+    viper.SetDefault("agi.max_headers", 64)
+    viper.SetDefault("agi.max_header_line", 1024)
+    viper.SetDefault("agi.max_header_bytes", 8192)
+    viper.SetDefault("agi.affinity.enabled", false)
+    viper.SetDefault("agi.affinity.advertise_address", "")
+    viper.SetDefault("agi.affinity.ttl", "4h")
+    viper.SetDefault("agi.affinity.dial_timeout", "1s")
     
     // Router defaults
     viper.SetDefault("router.did_allocation_timeout", "5s")
     viper.SetDefault("router.call_cleanup_interval", "5m")
     viper.SetDefault("router.stale_call_timeout", "30m")
     viper.SetDefault("router.verification.enabled", true)
+    viper.SetDefault("router.verification.quarantine.enabled", false)
+    viper.SetDefault("router.verification.quarantine.failure_threshold", 10)
+    viper.SetDefault("router.verification.quarantine.window", "5m")
+    viper.SetDefault("router.verification.quarantine.refresh_interval", "15s")
+    viper.SetDefault("router.blocking.enabled", true)
+    viper.SetDefault("router.blocking.refresh_interval", "15s")
+    viper.SetDefault("router.kill_switch.refresh_interval", "2s")
+    viper.SetDefault("router.alerts.reopen_window", "5m")
+    viper.SetDefault("router.alerts.resolve_after", "6h")
+    viper.SetDefault("router.alerts.interval", "1m")
+    viper.SetDefault("router.alerts.webhook_url", "")
+    viper.SetDefault("router.alerts.webhook_timeout", "5s")
+    viper.SetDefault("router.fx.currency", "USD")
+    viper.SetDefault("router.fx.url", "")
+    viper.SetDefault("router.fx.refresh_interval", "1h")
+    viper.SetDefault("router.cdr_export.enabled", true)
+    viper.SetDefault("router.cdr_export.interval", "5m")
+    viper.SetDefault("router.cdr_export.delay", "1h")
+    viper.SetDefault("router.cdr_export.max_attempts", 5)
+    viper.SetDefault("router.cdr_export.retry_interval", "30m")
+    viper.SetDefault("router.cdr_export.sftp.timeout", "5m")
+    viper.SetDefault("router.cdr_export.s3.region", "us-east-1")
+    viper.SetDefault("router.cdr_export.smtp.port", 587)
+    viper.SetDefault("router.cdr_export.webhook.timeout", "2m")
+    viper.SetDefault("router.contracts.enabled", true)
+    viper.SetDefault("router.contracts.interval", "1h")
+    viper.SetDefault("router.contracts.min_elapsed", "72h")
+    viper.SetDefault("router.contracts.warn_days", 14)
+    viper.SetDefault("router.sla.enabled", true)
+    viper.SetDefault("router.sla.interval", "1h")
+    for metric, weight := range router.DefaultScorecardWeights {
+        viper.SetDefault("router.scorecard.weights."+metric, weight)
+    }
+    viper.SetDefault("router.weight_curves.enabled", true)
+    viper.SetDefault("router.weight_curves.interval", "1m")
+    viper.SetDefault("router.cost_ceilings.enabled", true)
+    viper.SetDefault("router.cost_ceilings.interval", "5m")
+    viper.SetDefault("router.cost_ceilings.window", "1h")
+    viper.SetDefault("router.cost_ceilings.step", 10)
+    viper.SetDefault("router.cost_ceilings.margin", 10)
+    viper.SetDefault("router.cost_ceilings.min_calls", 10)
+    viper.SetDefault("router.route_queue.poll_interval", "250ms")
+    viper.SetDefault("router.route_queue.max_waiting", 100)
+    viper.SetDefault("router.route_queue.max_timeout", "60s")
+    viper.SetDefault("router.did_aging.quarantine", "720h")
+    viper.SetDefault("router.did_rotation.max_per_hour", 0)
+    viper.SetDefault("router.did_rotation.cooldown", "0s")
+    viper.SetDefault("router.did_rotation.order", router.DIDOrderLeastRecent)
+    viper.SetDefault("router.did_procurement.enabled", true)
+    viper.SetDefault("router.did_procurement.interval", "5m")
+    viper.SetDefault("router.backup.enabled", true)
+    viper.SetDefault("router.backup.interval", "1h")
+    viper.SetDefault("router.backup.destination", "/var/lib/ara/backups")
+    viper.SetDefault("router.backup.keep", 168)
+    viper.SetDefault("router.backup.s3.region", "us-east-1")
+    viper.SetDefault("router.test_mode.max_concurrent", 5)
+    viper.SetDefault("router.test_mode.max_cps", 1)
+    viper.SetDefault("router.stats_snapshot.enabled", true)
+    viper.SetDefault("router.stats_snapshot.interval", "1h")
+    viper.SetDefault("router.stats_snapshot.backfill_days", 7)
+    viper.SetDefault("router.stats_snapshot.raw_retention", "0")
+    viper.SetDefault("router.health_check.enabled", true)
+    viper.SetDefault("router.health_check.interval", "30s")
+    viper.SetDefault("router.health_check.timeout", "5s")
+    viper.SetDefault("router.health_check.failure_threshold", 3)
+    viper.SetDefault("router.health_check.concurrency", 10)
+    viper.SetDefault("router.synthetic.enabled", false)
+    viper.SetDefault("router.synthetic.check_interval", "30s")
+    viper.SetDefault("router.synthetic.timeout", "30s")
+    viper.SetDefault("router.synthetic.default_ani", "")
+    viper.SetDefault("router.short_calls.enabled", true)
+    viper.SetDefault("router.short_calls.threshold", "6s")
+    viper.SetDefault("router.short_calls.window", "1h")
+    viper.SetDefault("router.short_calls.interval", "5m")
+    viper.SetDefault("router.short_calls.min_calls", 20)
+    viper.SetDefault("router.short_calls.throttle_factor", 0.5)
+    viper.SetDefault("router.fas.enabled", true)
+    viper.SetDefault("router.fas.interval", "15m")
+    viper.SetDefault("router.fas.window", "24h")
+    viper.SetDefault("router.fas.min_calls", 30)
+    viper.SetDefault("router.fas.fast_answer", "1s")
+    viper.SetDefault("router.fas.short_call", "6s")
+    viper.SetDefault("router.fas.billing_increment", "60s")
+    viper.SetDefault("router.fas.flag_score", 50)
+    viper.SetDefault("router.fas.reduce.enabled", false)
+    viper.SetDefault("router.fas.reduce.factor", 0.25)
+    viper.SetDefault("asterisk.device_state.enabled", false)
+    viper.SetDefault("asterisk.device_state.interval", "10s")
+    viper.SetDefault("asterisk.device_state.prefix", "ara-")
+    viper.SetDefault("asterisk.device_state.hint_context", "ara-trunk-hints")
+    viper.SetDefault("asterisk.restart.enabled", true)
+    viper.SetDefault("asterisk.restart.recent_boot", "2m")
+    viper.SetDefault("asterisk.restart.check_interval", "2s")
+    viper.SetDefault("asterisk.restart.max_pause", "2m")
+    viper.SetDefault("asterisk.restart.contexts", []string{})
+    viper.SetDefault("asterisk.restart.reconcile_records", false)
+    viper.SetDefault("asterisk.bootstrap.config_dir", "/etc/asterisk")
+    viper.SetDefault("asterisk.bootstrap.odbc_class", "asterisk")
+    viper.SetDefault("asterisk.bootstrap.odbc_dsn", "asterisk-ara")
+    viper.SetDefault("asterisk.bootstrap.odbc_driver", "MariaDB")
+    viper.SetDefault("asterisk.bootstrap.ami_permit", "127.0.0.1/255.255.255.255")
+    viper.SetDefault("asterisk.bootstrap.ami_tls_cert_file", "/etc/asterisk/keys/asterisk.pem")
+    viper.SetDefault("asterisk.bootstrap.ami_tls_key_file", "/etc/asterisk/keys/asterisk.key")
+    viper.SetDefault("asterisk.ami.tls.enabled", false)
+    viper.SetDefault("asterisk.ami.tls.min_version", "1.2")
+    viper.SetDefault("router.country_limits.enforce", false)
+    viper.SetDefault("router.country_limits.cps_window", "10s")
+    viper.SetDefault("router.country_limits.refresh_interval", "15s")
+    viper.SetDefault("router.rate_limits.enabled", true)
+    viper.SetDefault("router.rate_limits.refresh_interval", "15s")
+    viper.SetDefault("router.hot_cache_ttl", "5s")
+    viper.SetDefault("router.summary_ttl", "2s")
+    viper.SetDefault("router.group_cache_ttl", "10s")
+    viper.SetDefault("router.group_member_limit", 500)
+    viper.SetDefault("router.dial_timeout", "180s")
+    viper.SetDefault("router.no_answer.enabled", true)
+    viper.SetDefault("router.no_answer.max_attempts", 2)
+    viper.SetDefault("router.serial_fork.enabled", false)
+    viper.SetDefault("router.serial_fork.hops", 2)
+    viper.SetDefault("router.abandoned.enabled", true)
+    viper.SetDefault("router.abandoned.grace", "10s")
+    viper.SetDefault("router.recovery.enabled", true)
+    viper.SetDefault("router.recovery.reconcile_dids", true)
+    viper.SetDefault("router.shared_calls.enabled", false)
+    viper.SetDefault("router.shared_calls.ttl", "0s")
+    viper.SetDefault("router.shared_calls.max_retries", 5)
+    viper.SetDefault("router.catch_all.enabled", false)
+    viper.SetDefault("router.catch_all.route", "")
+    viper.SetDefault("router.load_balancer.hash_virtual_nodes", 160)
+    viper.SetDefault("router.load_balancer.slow_start_window", "2m")
+    viper.SetDefault("router.load_balancer.health.failure_threshold", 5)
+    viper.SetDefault("router.load_balancer.health.consecutive_failure_penalty", 10)
+    viper.SetDefault("router.load_balancer.health.failure_rate_weight", 50)
+    viper.SetDefault("router.load_balancer.health.recovery_window", "5m")
+    viper.SetDefault("router.load_balancer.health.min_samples", 1)
+    viper.SetDefault("router.write_behind.enabled", true)
+    viper.SetDefault("router.write_behind.lanes", 4)
+    viper.SetDefault("router.write_behind.queue_size", 1000)
+    viper.SetDefault("router.write_behind.batch_size", 50)
+    viper.SetDefault("router.write_behind.flush_interval", "100ms")
+    viper.SetDefault("router.write_behind.enqueue_timeout", "50ms")
+    viper.SetDefault("router.correlation.enabled", false)
+    viper.SetDefault("router.correlation.mode", "header")
+    viper.SetDefault("router.correlation.length", 6)
+    
+    // Cluster defaults
+    viper.SetDefault("cluster.node_id", "")
+    viper.SetDefault("cluster.drift.enabled", true)
+    viper.SetDefault("cluster.drift.interval", "30s")
+    viper.SetDefault("cluster.drift.ignore_keys", []string{
+        "cluster.node_id", "app.debug", "agi.listen_address", "agi.affinity.advertise_address", "monitoring.logging", "performance.enable_profiling",
+    })
+    
+    // API defaults
+    viper.SetDefault("security.api.enabled", false)
+    viper.SetDefault("security.api.port", 8081)
+    viper.SetDefault("security.api.url", "")
+    viper.SetDefault("security.api.client_timeout", "3s")
+    viper.SetDefault("security.read_only", false)
+    viper.SetDefault("security.credential_rotation.overlap", "1h")
+    viper.SetDefault("security.credential_rotation.check_interval", "1m")
+    viper.SetDefault("security.masking.enabled", false)
+    viper.SetDefault("security.masking.fields", masking.DefaultFields)
+    viper.SetDefault("security.masking.keep_prefix", 5)
+    viper.SetDefault("security.masking.keep_suffix", 3)
+    viper.SetDefault("security.masking.logs", true)
+    viper.SetDefault("security.masking.operator_pii", true)
+    viper.SetDefault("security.masking.pii_users", []string{})
+    
+    // Fault injection defaults (never honoured in production)
+    viper.SetDefault("fault_injection.enabled", false)
+    viper.SetDefault("fault_injection.db_latency.rate", 0.0)
+    viper.SetDefault("fault_injection.db_latency.latency", "500ms")
+    viper.SetDefault("fault_injection.redis_error.rate", 0.0)
+    viper.SetDefault("fault_injection.ami_disconnect.rate", 0.0)
+    viper.SetDefault("fault_injection.provider_selection.rate", 0.0)
     
     // Monitoring defaults
     viper.SetDefault("monitoring.metrics.enabled", true)
@@ -79,31 +292,60 @@ func setDefaults() {
     viper.SetDefault("monitoring.logging.format", "json")
 }
 
-func initializeDatabase(ctx context.Context) error {
-    // Database configuration
-    dbConfig := db.Config{
-        Driver:          viper.GetString("database.driver"),
-        Host:            viper.GetString("database.host"),
-        Port:            viper.GetInt("database.port"),
-        Username:        viper.GetString("database.username"),
-        Password:        viper.GetString("database.password"),
-        Database:        viper.GetString("database.database"),
-        MaxOpenConns:    viper.GetInt("database.max_open_conns"),
-        MaxIdleConns:    viper.GetInt("database.max_idle_conns"),
-        ConnMaxLifetime: viper.GetDuration("database.conn_max_lifetime"),
-        RetryAttempts:   3,
-        RetryDelay:      time.Second,
+// initializeFaults configures fault injection from the fault_injection section
+func initializeFaults() error {
+    rules := make(map[faults.Fault]faults.Rule)
+    for _, fault := range faults.All {
+        key := "fault_injection." + string(fault)
+        rules[fault] = faults.Rule{
+            Rate:    viper.GetFloat64(key + ".rate"),
+            Latency: viper.GetDuration(key + ".latency"),
+        }
     }
     
-    // Initialize database
-    if err := db.Initialize(dbConfig); err != nil {
-        return err
+    return faults.Initialize(faults.Config{
+        Enabled:     viper.GetBool("fault_injection.enabled"),
+        Environment: viper.GetString("app.environment"),
+        Rules:       rules,
+    })
+}
+
+// verifySchema stops the AGI server before it serves calls on a schema missing
+// tables or columns this build reads and writes
+func verifySchema(ctx context.Context) {
+    report, err := db.VerifySchema(ctx, database.DB, viper.GetBool("database.schema_check.heal"))
+    if err != nil {
+        logger.Fatal("Database schema check failed, run 'router -init-db' (without -flush) to upgrade it", "error", err)
     }
     
-    database = db.GetDB()
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "fingerprint": db.SchemaFingerprint(),
+        "migration":   report.MigrationVersion,
+    }).Info("Database schema verified")
+}
+
+// databaseConfig reads the MySQL connection settings
+func databaseConfig() db.Config {
+    return db.Config{
+        Driver:             viper.GetString("database.driver"),
+        Host:               viper.GetString("database.host"),
+        Port:               viper.GetInt("database.port"),
+        Username:           viper.GetString("database.username"),
+        Password:           viper.GetString("database.password"),
+        Database:           viper.GetString("database.database"),
+        MaxOpenConns:       viper.GetInt("database.max_open_conns"),
+        MaxIdleConns:       viper.GetInt("database.max_idle_conns"),
+        ConnMaxLifetime:    viper.GetDuration("database.conn_max_lifetime"),
+        RetryAttempts:      viper.GetInt("database.retry_attempts"),
+        RetryDelay:         viper.GetDuration("database.retry_delay"),
+        QueryRetryDelay:    viper.GetDuration("database.query_retry_delay"),
+        QueryRetryMaxDelay: viper.GetDuration("database.query_retry_max_delay"),
+    }
+}
     
-    // Initialize cache
-    cacheConfig := db.CacheConfig{
+// cacheConfig reads the Redis connection settings
+func cacheConfig() db.CacheConfig {
+    return db.CacheConfig{
         Host:         viper.GetString("redis.host"),
         Port:         viper.GetInt("redis.port"),
         Password:     viper.GetString("redis.password"),
@@ -112,8 +354,18 @@ func initializeDatabase(ctx context.Context) error {
         MinIdleConns: viper.GetInt("redis.min_idle_conns"),
         MaxRetries:   viper.GetInt("redis.max_retries"),
     }
+}
+    
+func initializeDatabase(ctx context.Context) error {
+    // Initialize database
+    if err := db.Initialize(databaseConfig()); err != nil {
+        return err
+    }
+    
+    database = db.GetDB()
     
-    if err := db.InitializeCache(cacheConfig, "ara-router"); err != nil {
+    // Initialize cache
+    if err := db.InitializeCache(cacheConfig(), "ara-router"); err != nil {
         logger.WithError(err).Warn("Failed to initialize Redis cache, using memory cache")
     }
     
@@ -133,6 +385,15 @@ func initializeDatabase(ctx context.Context) error {
             PingInterval:      viper.GetDuration("asterisk.ami.ping_interval"),
             ActionTimeout:     30 * time.Second, // Ensure we have a good timeout
             BufferSize:        1000,
+            TLS: ami.TLSConfig{
+                Enabled:            viper.GetBool("asterisk.ami.tls.enabled"),
+                CAFile:             viper.GetString("asterisk.ami.tls.ca_file"),
+                CertFile:           viper.GetString("asterisk.ami.tls.cert_file"),
+                KeyFile:            viper.GetString("asterisk.ami.tls.key_file"),
+                ServerName:         viper.GetString("asterisk.ami.tls.server_name"),
+                InsecureSkipVerify: viper.GetBool("asterisk.ami.tls.insecure_skip_verify"),
+                MinVersion:         viper.GetString("asterisk.ami.tls.min_version"),
+            },
         }
         
         amiManager = ami.NewManager(amiConfig)
@@ -155,8 +416,10 @@ func initializeDatabase(ctx context.Context) error {
     
     // Initialize metrics
     metricsSvc = metrics.NewPrometheusMetrics()
+    db.SetMetrics(metricsSvc)
     
     // Initialize router
+    healthPolicy, healthByType := loadHealthPolicies()
     routerConfig := router.Config{
         DIDAllocationTimeout: viper.GetDuration("router.did_allocation_timeout"),
         CallCleanupInterval:  viper.GetDuration("router.call_cleanup_interval"),
@@ -164,6 +427,187 @@ func initializeDatabase(ctx context.Context) error {
         MaxRetries:           viper.GetInt("router.max_retries"),
         VerificationEnabled:  viper.GetBool("router.verification.enabled"),
         StrictMode:           viper.GetBool("router.verification.strict_mode"),
+        HotCacheTTL:          viper.GetDuration("router.hot_cache_ttl"),
+        SummaryTTL:           viper.GetDuration("router.summary_ttl"),
+        GroupCacheTTL:        viper.GetDuration("router.group_cache_ttl"),
+        GroupMemberLimit:     viper.GetInt("router.group_member_limit"),
+        DialTimeout:          viper.GetDuration("router.dial_timeout"),
+        ReadOnly:             viper.GetBool("security.read_only"),
+        NoAnswer: router.NoAnswerConfig{
+            Enabled:     viper.GetBool("router.no_answer.enabled"),
+            MaxAttempts: viper.GetInt("router.no_answer.max_attempts"),
+        },
+        SerialFork: router.SerialForkConfig{
+            Enabled: viper.GetBool("router.serial_fork.enabled"),
+            Hops:    viper.GetInt("router.serial_fork.hops"),
+        },
+        Abandoned: router.AbandonedConfig{
+            Enabled: viper.GetBool("router.abandoned.enabled"),
+            Grace:   viper.GetDuration("router.abandoned.grace"),
+        },
+        Recovery: router.RecoveryConfig{
+            Enabled:       viper.GetBool("router.recovery.enabled"),
+            ReconcileDIDs: viper.GetBool("router.recovery.reconcile_dids"),
+        },
+        SharedCalls: router.SharedCallConfig{
+            Enabled:    viper.GetBool("router.shared_calls.enabled"),
+            TTL:        viper.GetDuration("router.shared_calls.ttl"),
+            MaxRetries: viper.GetInt("router.shared_calls.max_retries"),
+        },
+        NodeID: nodeID(),
+        CatchAll: router.CatchAllConfig{
+            Enabled: viper.GetBool("router.catch_all.enabled"),
+            Route:   viper.GetString("router.catch_all.route"),
+        },
+        Quarantine: router.QuarantineConfig{
+            Enabled:          viper.GetBool("router.verification.quarantine.enabled"),
+            FailureThreshold: viper.GetInt("router.verification.quarantine.failure_threshold"),
+            Window:           viper.GetDuration("router.verification.quarantine.window"),
+            RefreshInterval:  viper.GetDuration("router.verification.quarantine.refresh_interval"),
+        },
+        Blocking: router.BlockingConfig{
+            Enabled:         viper.GetBool("router.blocking.enabled"),
+            RefreshInterval: viper.GetDuration("router.blocking.refresh_interval"),
+        },
+        KillSwitch: router.KillSwitchConfig{
+            RefreshInterval: viper.GetDuration("router.kill_switch.refresh_interval"),
+        },
+        Alerts: router.AlertConfig{
+            ReopenWindow:   viper.GetDuration("router.alerts.reopen_window"),
+            ResolveAfter:   viper.GetDuration("router.alerts.resolve_after"),
+            Interval:       viper.GetDuration("router.alerts.interval"),
+            WebhookURL:     viper.GetString("router.alerts.webhook_url"),
+            WebhookTimeout: viper.GetDuration("router.alerts.webhook_timeout"),
+        },
+        FX: router.FXConfig{
+            Currency:        viper.GetString("router.fx.currency"),
+            Rates:           fxRates(),
+            URL:             viper.GetString("router.fx.url"),
+            RefreshInterval: viper.GetDuration("router.fx.refresh_interval"),
+        },
+        CDRExport: router.CDRExportConfig{
+            Enabled:       viper.GetBool("router.cdr_export.enabled"),
+            Interval:      viper.GetDuration("router.cdr_export.interval"),
+            Delay:         viper.GetDuration("router.cdr_export.delay"),
+            MaxAttempts:   viper.GetInt("router.cdr_export.max_attempts"),
+            RetryInterval: viper.GetDuration("router.cdr_export.retry_interval"),
+            SFTP: router.SFTPConfig{
+                IdentityFile: viper.GetString("router.cdr_export.sftp.identity_file"),
+                Timeout:      viper.GetDuration("router.cdr_export.sftp.timeout"),
+            },
+            S3: router.S3Config{
+                Region:    viper.GetString("router.cdr_export.s3.region"),
+                Endpoint:  viper.GetString("router.cdr_export.s3.endpoint"),
+                AccessKey: viper.GetString("router.cdr_export.s3.access_key"),
+                SecretKey: viper.GetString("router.cdr_export.s3.secret_key"),
+            },
+            SMTP: router.SMTPConfig{
+                Host:     viper.GetString("router.cdr_export.smtp.host"),
+                Port:     viper.GetInt("router.cdr_export.smtp.port"),
+                Username: viper.GetString("router.cdr_export.smtp.username"),
+                Password: viper.GetString("router.cdr_export.smtp.password"),
+                From:     viper.GetString("router.cdr_export.smtp.from"),
+            },
+            Webhook: router.WebhookConfig{
+                Secret:  viper.GetString("router.cdr_export.webhook.secret"),
+                Timeout: viper.GetDuration("router.cdr_export.webhook.timeout"),
+            },
+        },
+        Contracts: router.ContractConfig{
+            Enabled:    viper.GetBool("router.contracts.enabled"),
+            Interval:   viper.GetDuration("router.contracts.interval"),
+            MinElapsed: viper.GetDuration("router.contracts.min_elapsed"),
+            WarnDays:   viper.GetInt("router.contracts.warn_days"),
+        },
+        SLA: router.SLAConfig{
+            Enabled:  viper.GetBool("router.sla.enabled"),
+            Interval: viper.GetDuration("router.sla.interval"),
+        },
+        Scorecard: router.ScorecardConfig{
+            Weights: scorecardWeights(),
+        },
+        WeightCurves: router.WeightCurveConfig{
+            Enabled:  viper.GetBool("router.weight_curves.enabled"),
+            Interval: viper.GetDuration("router.weight_curves.interval"),
+        },
+        CostCeilings: router.CostCeilingConfig{
+            Enabled:  viper.GetBool("router.cost_ceilings.enabled"),
+            Interval: viper.GetDuration("router.cost_ceilings.interval"),
+            Window:   viper.GetDuration("router.cost_ceilings.window"),
+            Step:     viper.GetFloat64("router.cost_ceilings.step"),
+            Margin:   viper.GetFloat64("router.cost_ceilings.margin"),
+            MinCalls: viper.GetInt("router.cost_ceilings.min_calls"),
+        },
+        RouteQueue: router.RouteQueueConfig{
+            PollInterval: viper.GetDuration("router.route_queue.poll_interval"),
+            MaxWaiting:   viper.GetInt("router.route_queue.max_waiting"),
+            MaxTimeout:   viper.GetDuration("router.route_queue.max_timeout"),
+        },
+        DIDAging: router.DIDAgingConfig{
+            Quarantine: viper.GetDuration("router.did_aging.quarantine"),
+        },
+        DIDRotation: router.DIDRotationConfig{
+            MaxPerHour: viper.GetInt("router.did_rotation.max_per_hour"),
+            Cooldown:   viper.GetDuration("router.did_rotation.cooldown"),
+            Order:      viper.GetString("router.did_rotation.order"),
+        },
+        DIDProcurement: router.DIDProcurementConfig{
+            Enabled:  viper.GetBool("router.did_procurement.enabled"),
+            Interval: viper.GetDuration("router.did_procurement.interval"),
+        },
+        Backup: router.BackupConfig{
+            Enabled:     viper.GetBool("router.backup.enabled"),
+            Interval:    viper.GetDuration("router.backup.interval"),
+            Destination: viper.GetString("router.backup.destination"),
+            Keep:        viper.GetInt("router.backup.keep"),
+            S3: router.S3Config{
+                Region:    viper.GetString("router.backup.s3.region"),
+                Endpoint:  viper.GetString("router.backup.s3.endpoint"),
+                AccessKey: viper.GetString("router.backup.s3.access_key"),
+                SecretKey: viper.GetString("router.backup.s3.secret_key"),
+            },
+        },
+        TestMode: router.TestModeConfig{
+            MaxConcurrent: viper.GetInt("router.test_mode.max_concurrent"),
+            MaxCPS:        viper.GetInt("router.test_mode.max_cps"),
+        },
+        CountryLimits: router.CountryLimitConfig{
+            Enforce:         viper.GetBool("router.country_limits.enforce"),
+            CPSWindow:       viper.GetDuration("router.country_limits.cps_window"),
+            RefreshInterval: viper.GetDuration("router.country_limits.refresh_interval"),
+        },
+        RateLimits: router.RateLimitConfig{
+            Enabled:         viper.GetBool("router.rate_limits.enabled"),
+            RefreshInterval: viper.GetDuration("router.rate_limits.refresh_interval"),
+        },
+        ShortCalls: router.ShortCallConfig{
+            Enabled:        viper.GetBool("router.short_calls.enabled"),
+            Threshold:      viper.GetDuration("router.short_calls.threshold"),
+            Window:         viper.GetDuration("router.short_calls.window"),
+            Interval:       viper.GetDuration("router.short_calls.interval"),
+            MinCalls:       viper.GetInt("router.short_calls.min_calls"),
+            ThrottleFactor: viper.GetFloat64("router.short_calls.throttle_factor"),
+        },
+        LoadBalancer: router.LoadBalancerConfig{
+            HashVirtualNodes: viper.GetInt("router.load_balancer.hash_virtual_nodes"),
+            SlowStartWindow:  viper.GetDuration("router.load_balancer.slow_start_window"),
+            Health:           healthPolicy,
+            HealthByType:     healthByType,
+        },
+        WriteBehind: router.WriteBehindConfig{
+            Enabled:        viper.GetBool("router.write_behind.enabled"),
+            Lanes:          viper.GetInt("router.write_behind.lanes"),
+            QueueSize:      viper.GetInt("router.write_behind.queue_size"),
+            BatchSize:      viper.GetInt("router.write_behind.batch_size"),
+            FlushInterval:  viper.GetDuration("router.write_behind.flush_interval"),
+            EnqueueTimeout: viper.GetDuration("router.write_behind.enqueue_timeout"),
+        },
+        Correlation: router.CorrelationConfig{
+            Enabled: viper.GetBool("router.correlation.enabled"),
+            Secret:  viper.GetString("router.correlation.secret"),
+            Mode:    viper.GetString("router.correlation.mode"),
+            Length:  viper.GetInt("router.correlation.length"),
+        },
     }
     
     routerSvc = router.NewRouter(database.DB, cache, metricsSvc, routerConfig)
@@ -188,8 +632,13 @@ func initializeDatabase(ctx context.Context) error {
             return database.PingContext(ctx)
         }))
         
+        // Redis and AMI fail readiness or only degrade it by their startup policy
+        registerDependencyCheck("redis", health.CheckFunc(func(ctx context.Context) error {
+            _, err := cache.Ping(ctx)
+            return err
+        }))
         if amiManager != nil {
-            healthSvc.RegisterReadinessCheck("ami", health.CheckFunc(func(ctx context.Context) error {
+            registerDependencyCheck("ami", health.CheckFunc(func(ctx context.Context) error {
                 if !amiManager.IsConnected() {
                     return fmt.Errorf("AMI not connected")
                 }
@@ -198,6 +647,17 @@ func initializeDatabase(ctx context.Context) error {
             }))
         }
         
+        healthSvc.RegisterInfo("/version", func(ctx context.Context) interface{} {
+            return buildInfo(ctx)
+        })
+        healthSvc.RegisterInfo("/health/kill-switch", func(ctx context.Context) interface{} {
+            engaged := routerSvc.GetKillSwitches().Engaged()
+            return map[string]interface{}{
+                "engaged":  len(engaged) > 0,
+                "switches": engaged,
+            }
+        })
+        
         go healthSvc.Start()
     }
     
@@ -248,3 +708,267 @@ func initializeDatabase(ctx context.Context) error {
     
     return nil
 }*/
+
+// deviceStateConfig reads the provider device state publishing settings
+func deviceStateConfig() router.DeviceStateConfig {
+    return router.DeviceStateConfig{
+        Enabled:     viper.GetBool("asterisk.device_state.enabled"),
+        Interval:    viper.GetDuration("asterisk.device_state.interval"),
+        Prefix:      viper.GetString("asterisk.device_state.prefix"),
+        HintContext: viper.GetString("asterisk.device_state.hint_context"),
+    }
+}
+
+// restartConfig reads the Asterisk restart coordination settings, checking
+// every generated dialplan context unless a list is configured
+func restartConfig() router.RestartConfig {
+    contexts := viper.GetStringSlice("asterisk.restart.contexts")
+    if len(contexts) == 0 {
+        contexts = ara.DialplanContexts
+    }
+    return router.RestartConfig{
+        Enabled:          viper.GetBool("asterisk.restart.enabled"),
+        RecentBoot:       viper.GetDuration("asterisk.restart.recent_boot"),
+        CheckInterval:    viper.GetDuration("asterisk.restart.check_interval"),
+        MaxPause:         viper.GetDuration("asterisk.restart.max_pause"),
+        Contexts:         contexts,
+        ReconcileRecords: viper.GetBool("asterisk.restart.reconcile_records"),
+    }
+}
+
+// bootstrapConfig collects the settings the Asterisk side configuration is generated from
+func bootstrapConfig() ara.BootstrapConfig {
+    return ara.BootstrapConfig{
+        DBHost:      viper.GetString("database.host"),
+        DBPort:      viper.GetInt("database.port"),
+        DBName:      viper.GetString("database.database"),
+        DBUser:      viper.GetString("database.username"),
+        DBPassword:  viper.GetString("database.password"),
+        ODBCClass:   viper.GetString("asterisk.bootstrap.odbc_class"),
+        ODBCDSN:     viper.GetString("asterisk.bootstrap.odbc_dsn"),
+        ODBCDriver:  viper.GetString("asterisk.bootstrap.odbc_driver"),
+        AMIUser:     viper.GetString("asterisk.ami.username"),
+        AMIPassword: viper.GetString("asterisk.ami.password"),
+        AMIPort:     viper.GetInt("asterisk.ami.port"),
+        AMIPermit:   viper.GetString("asterisk.bootstrap.ami_permit"),
+    
+        AMITLS:         viper.GetBool("asterisk.ami.tls.enabled"),
+        AMITLSCertFile: viper.GetString("asterisk.bootstrap.ami_tls_cert_file"),
+        AMITLSKeyFile:  viper.GetString("asterisk.bootstrap.ami_tls_key_file"),
+    }
+}
+
+// statsSnapshotConfig reads the daily statistics snapshot settings
+func statsSnapshotConfig() router.StatsSnapshotConfig {
+    return router.StatsSnapshotConfig{
+        Enabled:      viper.GetBool("router.stats_snapshot.enabled"),
+        Interval:     viper.GetDuration("router.stats_snapshot.interval"),
+        BackfillDays: viper.GetInt("router.stats_snapshot.backfill_days"),
+        RawRetention: viper.GetDuration("router.stats_snapshot.raw_retention"),
+    }
+}
+
+// fasConfig reads the false answer supervision detection settings
+func fasConfig() router.FASConfig {
+    return router.FASConfig{
+        Enabled:          viper.GetBool("router.fas.enabled"),
+        Interval:         viper.GetDuration("router.fas.interval"),
+        Window:           viper.GetDuration("router.fas.window"),
+        MinCalls:         viper.GetInt("router.fas.min_calls"),
+        FastAnswer:       viper.GetDuration("router.fas.fast_answer"),
+        ShortCall:        viper.GetDuration("router.fas.short_call"),
+        BillingIncrement: viper.GetDuration("router.fas.billing_increment"),
+        FlagScore:        viper.GetFloat64("router.fas.flag_score"),
+        Reduce:           viper.GetBool("router.fas.reduce.enabled"),
+        ReduceFactor:     viper.GetFloat64("router.fas.reduce.factor"),
+    }
+}
+
+// driftConfig reads the config drift detection settings
+func driftConfig() drift.Config {
+    return drift.Config{
+        Enabled:  viper.GetBool("cluster.drift.enabled"),
+        NodeID:   nodeID(),
+        Interval: viper.GetDuration("cluster.drift.interval"),
+    }
+}
+
+// nodeID names this router node, the host name unless cluster.node_id is set
+func nodeID() string {
+    if id := viper.GetString("cluster.node_id"); id != "" {
+        return id
+    }
+    host, err := os.Hostname()
+    if err != nil {
+        return "unknown"
+    }
+    return host
+}
+
+// nodeState is what this node publishes for drift detection
+func nodeState(ctx context.Context) drift.NodeState {
+    state := drift.NodeState{
+        ConfigHash: drift.HashSettings(viper.AllSettings(), viper.GetStringSlice("cluster.drift.ignore_keys")),
+        SchemaHash: db.SchemaFingerprint(),
+    }
+    if version, _, err := db.MigrationVersion(ctx, database.DB); err == nil {
+        state.MigrationVersion = version
+    }
+    return state
+}
+
+// buildInfo describes this build and what the loaded config turns on
+func buildInfo(ctx context.Context) buildinfo.Info {
+    info := buildinfo.Get()
+    info.SchemaHash = db.SchemaFingerprint()
+    if database != nil {
+        if version, _, err := db.MigrationVersion(ctx, database.DB); err == nil {
+            info.MigrationVersion = version
+        }
+    }
+    
+    info.Subsystems = make(map[string]bool)
+    for name, key := range map[string]string{
+        "api":                "security.api.enabled",
+        "metrics":            "monitoring.metrics.enabled",
+        "health":             "monitoring.health.enabled",
+        "verification":       "router.verification.enabled",
+        "quarantine":         "router.verification.quarantine.enabled",
+        "blocking":           "router.blocking.enabled",
+        "country_limits":     "router.country_limits.enforce",
+        "rate_limits":        "router.rate_limits.enabled",
+        "no_answer_failover": "router.no_answer.enabled",
+        "serial_fork":        "router.serial_fork.enabled",
+        "catch_all":          "router.catch_all.enabled",
+        "correlation":        "router.correlation.enabled",
+        "write_behind":       "router.write_behind.enabled",
+        "stats_snapshot":     "router.stats_snapshot.enabled",
+        "short_calls":        "router.short_calls.enabled",
+        "fas":                "router.fas.enabled",
+        "sip_options":        "router.health_check.enabled",
+        "synthetic":          "router.synthetic.enabled",
+        "device_state":       "asterisk.device_state.enabled",
+        "restart_pause":      "asterisk.restart.enabled",
+        "config_drift":       "cluster.drift.enabled",
+        "fault_injection":    "fault_injection.enabled",
+    } {
+        info.Subsystems[name] = viper.GetBool(key)
+    }
+    info.Subsystems["ami"] = viper.GetString("asterisk.ami.host") != ""
+    return info
+}
+
+// optionsProbeConfig reads the provider SIP OPTIONS health check settings
+func optionsProbeConfig() router.OptionsProbeConfig {
+    return router.OptionsProbeConfig{
+        Enabled:          viper.GetBool("router.health_check.enabled"),
+        Interval:         viper.GetDuration("router.health_check.interval"),
+        Timeout:          viper.GetDuration("router.health_check.timeout"),
+        FailureThreshold: viper.GetInt("router.health_check.failure_threshold"),
+        Concurrency:      viper.GetInt("router.health_check.concurrency"),
+        UserAgent:        "ARA-Router/" + buildinfo.Version,
+    }
+}
+
+// syntheticConfig reads the synthetic test call settings
+func syntheticConfig() router.SyntheticConfig {
+    return router.SyntheticConfig{
+        Enabled:       viper.GetBool("router.synthetic.enabled"),
+        CheckInterval: viper.GetDuration("router.synthetic.check_interval"),
+        Timeout:       viper.GetDuration("router.synthetic.timeout"),
+        DefaultANI:    viper.GetString("router.synthetic.default_ani"),
+    }
+}
+
+// healthProviderTypes lists the provider types that may override health rules
+var healthProviderTypes = []string{"inbound", "intermediate", "final"}
+
+// loadHealthPolicies reads the default health policy and the per-type overrides
+// under router.load_balancer.health.<type>
+func loadHealthPolicies() (router.HealthPolicy, map[string]router.HealthPolicy) {
+    prefix := "router.load_balancer.health."
+    base := router.HealthPolicy{
+        FailureThreshold:          viper.GetInt(prefix + "failure_threshold"),
+        ConsecutiveFailurePenalty: viper.GetInt(prefix + "consecutive_failure_penalty"),
+        FailureRateWeight:         viper.GetInt(prefix + "failure_rate_weight"),
+        RecoveryWindow:            viper.GetDuration(prefix + "recovery_window"),
+        MinSamples:                viper.GetInt(prefix + "min_samples"),
+    }
+    
+    byType := make(map[string]router.HealthPolicy)
+    for _, providerType := range healthProviderTypes {
+        key := prefix + providerType + "."
+        if !viper.IsSet(prefix + providerType) {
+            continue
+        }
+        
+        policy := base
+        if viper.IsSet(key + "failure_threshold") {
+            policy.FailureThreshold = viper.GetInt(key + "failure_threshold")
+        }
+        if viper.IsSet(key + "consecutive_failure_penalty") {
+            policy.ConsecutiveFailurePenalty = viper.GetInt(key + "consecutive_failure_penalty")
+        }
+        if viper.IsSet(key + "failure_rate_weight") {
+            policy.FailureRateWeight = viper.GetInt(key + "failure_rate_weight")
+        }
+        if viper.IsSet(key + "recovery_window") {
+            policy.RecoveryWindow = viper.GetDuration(key + "recovery_window")
+        }
+        if viper.IsSet(key + "min_samples") {
+            policy.MinSamples = viper.GetInt(key + "min_samples")
+        }
+        byType[providerType] = policy
+    }
+    
+    return base, byType
+}
+
+// fxRates reads the static exchange rates, currency codes are case-insensitive
+// since viper lowercases map keys
+func fxRates() map[string]float64 {
+    rates := make(map[string]float64)
+    for currency, value := range viper.GetStringMapString("router.fx.rates") {
+        rate, err := strconv.ParseFloat(value, 64)
+        if err != nil || rate <= 0 {
+            logger.WithField("currency", currency).Warn("Ignoring invalid exchange rate")
+            continue
+        }
+        rates[strings.ToUpper(currency)] = rate
+    }
+    return rates
+}
+
+// scorecardWeights reads the weight of each scorecard metric, 0 leaves a
+// metric out of the overall score
+func scorecardWeights() map[string]float64 {
+    weights := make(map[string]float64, len(models.ScorecardMetrics))
+    for _, metric := range models.ScorecardMetrics {
+        weight := viper.GetFloat64("router.scorecard.weights." + metric)
+        if weight < 0 {
+            logger.WithField("metric", metric).Warn("Ignoring negative scorecard weight")
+            weight = router.DefaultScorecardWeights[metric]
+        }
+        weights[metric] = weight
+    }
+    return weights
+}
+
+// watchConfig applies health policy changes without a restart
+func watchConfig() {
+    if viper.ConfigFileUsed() == "" {
+        return
+    }
+    
+    viper.OnConfigChange(func(e fsnotify.Event) {
+        if routerSvc == nil {
+            return
+        }
+        
+        base, byType := loadHealthPolicies()
+        routerSvc.GetLoadBalancer().SetHealthPolicies(base, byType)
+        
+        logger.WithField("file", e.Name).Info("Reloaded load balancer health policies")
+    })
+    viper.WatchConfig()
+}
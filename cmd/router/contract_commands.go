@@ -0,0 +1,249 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createProviderContractCommand() *cobra.Command {
+    contractCmd := &cobra.Command{
+        Use:   "contract",
+        Short: "Manage provider contracts and commitment tracking",
+        Long: `Manage provider contracts and commitment tracking.
+
+A contract holds a provider's minimum monthly minutes and spend, the minutes it
+takes at the contracted rate, until when its rates are valid and the notice
+needed to end it. Each leg a provider carries counts towards its commitments;
+the month so far is projected to the whole month, and projected shortfalls or
+overruns, expiring rates and nearing notice deadlines raise alerts.`,
+    }
+    
+    contractCmd.AddCommand(
+        createContractSetCommand(),
+        createContractStatusCommand(),
+        createContractRemoveCommand(),
+    )
+    
+    return contractCmd
+}
+
+func createContractSetCommand() *cobra.Command {
+    var (
+        minMinutes int
+        minSpend   float64
+        maxMinutes int
+        ratesUntil string
+        noticeDays int
+        start      string
+        end        string
+        notes      string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "set <provider>",
+        Short: "Set or update a provider's contract",
+        Long:  "Set or update a provider's contract. Only the flags given change an existing contract; an empty date clears it.",
+        Args:  cobra.ExactArgs(1),
+        Example: `  router provider contract set carrier-a --min-minutes 500000 --max-minutes 800000 \
+    --rates-valid-until 2026-12-31 --notice-days 30 --end 2027-06-30
+  
+  # Spend commitments are in the reporting currency (router.fx.currency)
+  router provider contract set carrier-b --min-spend 10000`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if _, err := providerSvc.GetProvider(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to get provider: %v", err)
+            }
+    
+            contracts, err := routerSvc.ListContracts(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to get contract: %v", err)
+            }
+            c := &models.ProviderContract{ProviderName: args[0]}
+            for _, existing := range contracts {
+                if existing.ProviderName == args[0] {
+                    c = existing
+                }
+            }
+    
+            flags := cmd.Flags()
+            if flags.Changed("min-minutes") {
+                c.MinMonthlyMinutes = minMinutes
+            }
+            if flags.Changed("min-spend") {
+                c.MinMonthlySpend = minSpend
+            }
+            if flags.Changed("max-minutes") {
+                c.MaxMonthlyMinutes = maxMinutes
+            }
+            if flags.Changed("notice-days") {
+                c.NoticeDays = noticeDays
+            }
+            if flags.Changed("notes") {
+                c.Notes = notes
+            }
+            for _, d := range []struct {
+                flag  string
+                value string
+                field **time.Time
+            }{
+                {"rates-valid-until", ratesUntil, &c.RatesValidUntil},
+                {"start", start, &c.StartDate},
+                {"end", end, &c.EndDate},
+            } {
+                if !flags.Changed(d.flag) {
+                    continue
+                }
+                if d.value == "" {
+                    *d.field = nil
+                    continue
+                }
+                t, err := time.Parse("2006-01-02", d.value)
+                if err != nil {
+                    return fmt.Errorf("invalid --%s %q, expected YYYY-MM-DD", d.flag, d.value)
+                }
+                *d.field = &t
+            }
+    
+            if err := routerSvc.SetContract(ctx, c, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set contract: %v", err)
+            }
+    
+            fmt.Printf("%s Contract of '%s' set\n", green("✓"), c.ProviderName)
+            return nil
+        },
+    }
+    
+    cmd.Flags().IntVar(&minMinutes, "min-minutes", 0, "Minutes committed to per month")
+    cmd.Flags().Float64Var(&minSpend, "min-spend", 0, "Spend committed to per month, in the reporting currency")
+    cmd.Flags().IntVar(&maxMinutes, "max-minutes", 0, "Monthly minutes the provider takes at the contracted rate")
+    cmd.Flags().StringVar(&ratesUntil, "rates-valid-until", "", "Last day the rates are valid (YYYY-MM-DD)")
+    cmd.Flags().IntVar(&noticeDays, "notice-days", 0, "Days of notice needed to end or renegotiate")
+    cmd.Flags().StringVar(&start, "start", "", "Contract start (YYYY-MM-DD)")
+    cmd.Flags().StringVar(&end, "end", "", "Contract end (YYYY-MM-DD)")
+    cmd.Flags().StringVar(&notes, "notes", "", "Free text notes")
+    
+    return cmd
+}
+
+func createContractStatusCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "status [provider]",
+        Short: "Show usage this month against contract commitments",
+        Args:  cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            statuses, err := routerSvc.ContractStatuses(ctx, time.Now())
+            if err != nil {
+                return fmt.Errorf("failed to get contract status: %v", err)
+            }
+            if len(args) == 1 {
+                var found []*models.ContractStatus
+                for _, s := range statuses {
+                    if s.Contract.ProviderName == args[0] {
+                        found = append(found, s)
+                    }
+                }
+                if len(found) == 0 {
+                    return fmt.Errorf("provider %s has no contract", args[0])
+                }
+                statuses = found
+            }
+    
+            if len(statuses) == 0 {
+                fmt.Println("No provider contracts")
+                return nil
+            }
+    
+            fmt.Printf("%s, %.0f%% of the month elapsed\n\n", statuses[0].Month, statuses[0].Elapsed*100)
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Provider", "Minutes", "Projected", "Commit", "Ceiling", "Spend", "Projected", "Commit", "Rates Until", "Ends", "Alerts"})
+            table.SetBorder(false)
+    
+            for _, s := range statuses {
+                c := s.Contract
+                alerts := green("none")
+                if len(s.Alerts) > 0 {
+                    messages := make([]string, len(s.Alerts))
+                    for i, a := range s.Alerts {
+                        messages[i] = a.Message
+                    }
+                    alerts = red(strings.Join(messages, "; "))
+                }
+                table.Append([]string{
+                    c.ProviderName,
+                    fmt.Sprintf("%.0f", s.Minutes),
+                    fmt.Sprintf("%.0f", s.ProjectedMinutes),
+                    contractAmount(strconv.Itoa(c.MinMonthlyMinutes), c.MinMonthlyMinutes > 0),
+                    contractAmount(strconv.Itoa(c.MaxMonthlyMinutes), c.MaxMonthlyMinutes > 0),
+                    fmt.Sprintf("%.2f %s", s.Spend, s.Currency),
+                    fmt.Sprintf("%.2f", s.ProjectedSpend),
+                    contractAmount(fmt.Sprintf("%.2f", c.MinMonthlySpend), c.MinMonthlySpend > 0),
+                    contractDay(c.RatesValidUntil),
+                    contractDay(c.EndDate),
+                    alerts,
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createContractRemoveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove <provider>",
+        Short: "Stop tracking a provider's contract",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteContract(ctx, args[0], audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove contract: %v", err)
+            }
+    
+            fmt.Printf("%s Contract of '%s' removed\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
+
+func contractAmount(value string, set bool) string {
+    if !set {
+        return "-"
+    }
+    return value
+}
+
+func contractDay(t *time.Time) string {
+    if t == nil {
+        return "-"
+    }
+    return t.Format("2006-01-02")
+}
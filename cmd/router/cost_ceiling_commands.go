@@ -0,0 +1,178 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createRouteCostCeilingCommand() *cobra.Command {
+    ceilingCmd := &cobra.Command{
+        Use:   "cost-ceiling",
+        Short: "Manage the blended cost targets of routes",
+        Long: `Manage the blended cost targets of routes.
+
+A cost ceiling is the per minute cost a route's outbound legs should average
+over router.cost_ceilings.window. Each router.cost_ceilings.interval one node
+measures the blended cost; while it is over the ceiling, another step of the
+weight of the route's providers rated over the ceiling moves to those under
+it, in proportion to their weight. Cheaper providers whose ASR or PDD miss the
+ceiling's limits get none. The weight is given back a step at a time once the
+blended cost is router.cost_ceilings.margin percent under the ceiling. Every
+adjustment is logged and recorded in the audit log. Other routes dialing the
+providers are not affected.`,
+    }
+    
+    ceilingCmd.AddCommand(
+        createRouteCostCeilingSetCommand(),
+        createRouteCostCeilingShowCommand(),
+        createRouteCostCeilingRemoveCommand(),
+    )
+    
+    return ceilingCmd
+}
+
+func createRouteCostCeilingSetCommand() *cobra.Command {
+    var c models.CostCeiling
+    
+    cmd := &cobra.Command{
+        Use:   "set <route>",
+        Short: "Set the cost ceiling of a route",
+        Example: `  router route cost-ceiling set main-route --max-cost 0.012
+  router route cost-ceiling set main-route --max-cost 0.01 --currency EUR --min-asr 35 --max-pdd 4000`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            c.RouteName = args[0]
+            if err := routerSvc.SetCostCeiling(ctx, &c, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set cost ceiling: %v", err)
+            }
+    
+            fmt.Printf("%s Cost ceiling of route '%s' set to %.4f%s per minute\n",
+                green("✓"), c.RouteName, c.MaxCost, formatCurrencySuffix(c.Currency))
+            return nil
+        },
+    }
+    
+    cmd.Flags().Float64Var(&c.MaxCost, "max-cost", 0, "Blended cost per minute the route should stay under")
+    cmd.Flags().StringVar(&c.Currency, "currency", "", "Currency of --max-cost (default the reporting currency)")
+    cmd.Flags().Float64Var(&c.MinASR, "min-asr", 0, "ASR percent a cheaper provider needs to take weight (0 for no limit)")
+    cmd.Flags().IntVar(&c.MaxPDDMs, "max-pdd", 0, "Average PDD in milliseconds a cheaper provider must stay under to take weight (0 for no limit)")
+    cmd.MarkFlagRequired("max-cost")
+    
+    return cmd
+}
+
+func createRouteCostCeilingShowCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "show [route]",
+        Short: "Show the cost ceiling of a route, or of every route",
+        Args:  cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            route := ""
+            if len(args) > 0 {
+                route = args[0]
+            }
+    
+            ceilings, err := routerSvc.ListCostCeilings(ctx, route)
+            if err != nil {
+                return fmt.Errorf("failed to get cost ceilings: %v", err)
+            }
+    
+            if len(ceilings) == 0 {
+                fmt.Println("No cost ceilings")
+                return nil
+            }
+    
+            // Blended costs are kept in the reporting currency
+            reporting := strings.ToUpper(viper.GetString("router.fx.currency"))
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Route", "Ceiling", "Blended", "Shift", "Min ASR", "Max PDD", "Evaluated"})
+            table.SetBorder(false)
+    
+            for _, c := range ceilings {
+                blended, evaluated := "-", "-"
+                if c.BlendedCost != nil {
+                    blended = fmt.Sprintf("%.4f%s", *c.BlendedCost, formatCurrencySuffix(reporting))
+                }
+                if c.EvaluatedAt != nil {
+                    evaluated = c.EvaluatedAt.Format("2006-01-02 15:04:05")
+                }
+                shift := fmt.Sprintf("%.0f%%", c.Shift)
+                if c.Shift > 0 {
+                    shift = yellow(shift)
+                }
+                minASR, maxPDD := "-", "-"
+                if c.MinASR > 0 {
+                    minASR = fmt.Sprintf("%.1f%%", c.MinASR)
+                }
+                if c.MaxPDDMs > 0 {
+                    maxPDD = fmt.Sprintf("%d ms", c.MaxPDDMs)
+                }
+    
+                table.Append([]string{
+                    c.RouteName,
+                    fmt.Sprintf("%.4f%s", c.MaxCost, formatCurrencySuffix(c.Currency)),
+                    blended,
+                    shift,
+                    minASR,
+                    maxPDD,
+                    evaluated,
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createRouteCostCeilingRemoveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove <route>",
+        Short: "Remove the cost ceiling of a route",
+        Long:  "Remove the cost ceiling of a route. Its providers get their weight back at the next evaluation.",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteCostCeiling(ctx, args[0], audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove cost ceiling: %v", err)
+            }
+    
+            fmt.Printf("%s Cost ceiling of route '%s' removed\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
+
+func formatCurrencySuffix(currency string) string {
+    if currency == "" {
+        return ""
+    }
+    return " " + currency
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createProviderCountryLimitCommand() *cobra.Command {
+    limitCmd := &cobra.Command{
+        Use:   "country-limit",
+        Short: "Manage per destination country call caps of providers",
+        Long: `Manage per destination country call caps of providers.
+
+The destination country is resolved from the dialled number. Limits are only
+enforced when router.country_limits.enforce is set, concurrent calls and CPS
+per country are exported as metrics either way.`,
+    }
+    
+    limitCmd.AddCommand(
+        createCountryLimitSetCommand(),
+        createCountryLimitListCommand(),
+        createCountryLimitDeleteCommand(),
+    )
+    
+    return limitCmd
+}
+
+func createCountryLimitSetCommand() *cobra.Command {
+    var (
+        maxConcurrent int
+        maxCPS        float64
+    )
+    
+    cmd := &cobra.Command{
+        Use:     "set <provider> <country>",
+        Short:   "Set the call cap of a provider for a country",
+        Example: `  router provider country-limit set s3-carrier GB --max-concurrent 50 --max-cps 5`,
+        Args:    cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            if _, err := providerSvc.GetProvider(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to get provider: %v", err)
+            }
+            
+            limit := &models.ProviderCountryLimit{
+                ProviderName:  args[0],
+                CountryCode:   strings.ToUpper(args[1]),
+                MaxConcurrent: maxConcurrent,
+                MaxCPS:        maxCPS,
+            }
+            
+            if err := routerSvc.GetCountryTracker().SetLimit(ctx, limit); err != nil {
+                return fmt.Errorf("failed to set country limit: %v", err)
+            }
+            
+            fmt.Printf("%s Limit for '%s' to %s set\n", green("✓"), limit.ProviderName, limit.CountryCode)
+            return nil
+        },
+    }
+    
+    cmd.Flags().IntVar(&maxConcurrent, "max-concurrent", 0, "Maximum concurrent calls (0=unlimited)")
+    cmd.Flags().Float64Var(&maxCPS, "max-cps", 0, "Maximum new calls per second (0=unlimited)")
+    
+    return cmd
+}
+
+func createCountryLimitListCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "list [provider]",
+        Short: "List provider country limits",
+        Args:  cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            providerName := ""
+            if len(args) > 0 {
+                providerName = args[0]
+            }
+            
+            limits, err := routerSvc.GetCountryTracker().ListLimits(ctx, providerName)
+            if err != nil {
+                return fmt.Errorf("failed to list country limits: %v", err)
+            }
+            
+            if len(limits) == 0 {
+                fmt.Println("No country limits")
+                return nil
+            }
+            
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Provider", "Country", "Max Concurrent", "Max CPS"})
+            table.SetBorder(false)
+            
+            for _, l := range limits {
+                table.Append([]string{
+                    l.ProviderName,
+                    l.CountryCode,
+                    formatLimit(float64(l.MaxConcurrent), "%.0f"),
+                    formatLimit(l.MaxCPS, "%.2f"),
+                })
+            }
+            
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createCountryLimitDeleteCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "delete <provider> <country>",
+        Short: "Remove the call cap of a provider for a country",
+        Args:  cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            country := strings.ToUpper(args[1])
+            if err := routerSvc.GetCountryTracker().DeleteLimit(ctx, args[0], country); err != nil {
+                return fmt.Errorf("failed to delete country limit: %v", err)
+            }
+            
+            fmt.Printf("%s Limit for '%s' to %s removed\n", green("✓"), args[0], country)
+            return nil
+        },
+    }
+}
+
+func formatLimit(value float64, format string) string {
+    if value <= 0 {
+        return "unlimited"
+    }
+    return fmt.Sprintf(format, value)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+)
+
+func createProviderRotateCredentialsCommand() *cobra.Command {
+    var (
+        overlap   time.Duration
+        expireNow bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "rotate-credentials <name>",
+        Short: "Generate a new SIP password for a provider",
+        Long: `Generate a new SIP password and store it on the provider and its ARA auth
+in one transaction, then reload PJSIP.
+
+The previous password keeps working for the overlap window so the carrier can
+switch over without dropped registrations. Use --overlap 0 to revoke it at once,
+or --expire-previous to end a running overlap early.`,
+        Example: `  router provider rotate-credentials s1-carrier
+  router provider rotate-credentials s1-carrier --overlap 24h
+  router provider rotate-credentials s1-carrier --expire-previous`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            if expireNow {
+                if err := providerSvc.ExpirePreviousCredential(ctx, args[0]); err != nil {
+                    return fmt.Errorf("failed to expire previous credential: %v", err)
+                }
+                fmt.Printf("%s Previous password for '%s' revoked\n", green("✓"), args[0])
+                return nil
+            }
+            
+            if !cmd.Flags().Changed("overlap") {
+                overlap = viper.GetDuration("security.credential_rotation.overlap")
+            }
+            
+            rotatedBy := os.Getenv("USER")
+            if rotatedBy == "" {
+                rotatedBy = "cli"
+            }
+            
+            rotation, err := providerSvc.RotateCredentials(ctx, args[0], overlap, rotatedBy)
+            if err != nil {
+                return fmt.Errorf("failed to rotate credentials: %v", err)
+            }
+            
+            fmt.Printf("%s Credentials for '%s' rotated\n", green("✓"), args[0])
+            fmt.Printf("  New password: %s\n", bold(rotation.Password))
+            if rotation.OverlapUntil != nil {
+                fmt.Printf("  Previous password valid until %s\n", rotation.OverlapUntil.Format("2006-01-02 15:04:05"))
+            } else {
+                fmt.Printf("  Previous password %s\n", yellow("revoked"))
+            }
+            fmt.Println("  The new password is not shown again.")
+            
+            return nil
+        },
+    }
+    
+    cmd.Flags().DurationVar(&overlap, "overlap", 0, "How long the previous password stays valid (default from security.credential_rotation.overlap)")
+    cmd.Flags().BoolVar(&expireNow, "expire-previous", false, "Revoke the previous password now instead of rotating")
+    
+    return cmd
+}
+
+func createProviderCredentialsCommand() *cobra.Command {
+    credsCmd := &cobra.Command{
+        Use:   "credentials",
+        Short: "Manage SIP credentials of digest auth customers",
+    }
+    
+    credsCmd.AddCommand(
+        createCredentialsSetCommand(),
+        createCredentialsContactsCommand(),
+    )
+    
+    return credsCmd
+}
+
+func createCredentialsSetCommand() *cobra.Command {
+    var (
+        username string
+        password string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "set <name>",
+        Short: "Change the SIP username or password of a provider",
+        Long: `Change the SIP username and/or password used for digest auth.
+
+Without --password a new password is generated and shown once. Changing the
+username of a registering customer drops its current registrations, the
+customer has to register again with the new username.`,
+        Example: `  router provider credentials set cust-acme --username acme01
+  router provider credentials set cust-acme --password 'S3cret!'`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            newPassword, err := providerSvc.SetCredentials(ctx, args[0], username, password)
+            if err != nil {
+                return fmt.Errorf("failed to set credentials: %v", err)
+            }
+            
+            fmt.Printf("%s Credentials for '%s' updated\n", green("✓"), args[0])
+            if username != "" {
+                fmt.Printf("  Username: %s\n", username)
+            }
+            if password == "" {
+                fmt.Printf("  New password: %s\n", bold(newPassword))
+                fmt.Println("  The new password is not shown again.")
+            }
+            
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVarP(&username, "username", "u", "", "New SIP username")
+    cmd.Flags().StringVarP(&password, "password", "p", "", "New SIP password (generated when empty)")
+    
+    return cmd
+}
+
+func createCredentialsContactsCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "contacts <name>",
+        Short: "List contacts registered by a customer",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            contacts, err := providerSvc.RegisteredContacts(ctx, args[0])
+            if err != nil {
+                return fmt.Errorf("failed to list contacts: %v", err)
+            }
+            
+            if len(contacts) == 0 {
+                fmt.Println("No registered contacts")
+                return nil
+            }
+            
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"URI", "Source", "User Agent", "Expires"})
+            table.SetBorder(false)
+            
+            for _, c := range contacts {
+                source := "-"
+                if c.ViaAddr != "" {
+                    source = fmt.Sprintf("%s:%d", c.ViaAddr, c.ViaPort)
+                }
+                expires := "-"
+                if c.ExpiresAt != nil {
+                    if c.ExpiresAt.Before(time.Now()) {
+                        expires = red("expired")
+                    } else {
+                        expires = time.Until(*c.ExpiresAt).Round(time.Second).String()
+                    }
+                }
+                table.Append([]string{c.URI, source, c.UserAgent, expires})
+            }
+            
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createDeviceStateCommands() *cobra.Command {
+    devstateCmd := &cobra.Command{
+        Use:   "devstate",
+        Short: "Provider trunk state published as Asterisk device states",
+        Long: `Provider trunk state published as Asterisk device states.
+
+When asterisk.device_state.enabled is set the router publishes every provider as
+Custom:<prefix><provider> over AMI: NOT_INUSE when idle, INUSE with calls up,
+BUSY at max channels and UNAVAILABLE when inactive, quarantined or unhealthy.
+Wallboards and operator panels subscribe to the hints generated by 'devstate hints'.`,
+    }
+    
+    devstateCmd.AddCommand(
+        createDeviceStateShowCommand(),
+        createDeviceStateHintsCommand(),
+    )
+    
+    return devstateCmd
+}
+
+func createDeviceStateShowCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "show",
+        Short: "Show the device state Asterisk holds for each provider",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if amiManager == nil || !amiManager.IsConnected() {
+                return fmt.Errorf("AMI is not connected")
+            }
+    
+            states, err := routerSvc.GetDeviceStates(ctx, deviceStateConfig())
+            if err != nil {
+                return fmt.Errorf("failed to list providers: %v", err)
+            }
+    
+            if len(states) == 0 {
+                fmt.Println("No providers found")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Provider", "Device", "State"})
+            table.SetBorder(false)
+    
+            for _, s := range states {
+                state, err := amiManager.GetDeviceState(s.Device)
+                if err != nil {
+                    state = red("error")
+                }
+                table.Append([]string{s.ProviderName, s.Device, formatDeviceState(state)})
+            }
+    
+            table.Render()
+    
+            if !deviceStateConfig().Enabled {
+                fmt.Printf("\n%s publishing is disabled (asterisk.device_state.enabled)\n", yellow("!"))
+            }
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createDeviceStateHintsCommand() *cobra.Command {
+    var output string
+    
+    cmd := &cobra.Command{
+        Use:   "hints",
+        Short: "Generate dialplan hints for the provider device states",
+        Long: `Generate one hint per provider. Realtime extensions can't carry hints, so
+write them to a file and include it from extensions.conf.`,
+        Example: `  router devstate hints -o /etc/asterisk/extensions_ara_hints.conf
+  # extensions.conf: #include extensions_ara_hints.conf`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            hints, err := routerSvc.DeviceStateHints(ctx, deviceStateConfig())
+            if err != nil {
+                return fmt.Errorf("failed to generate hints: %v", err)
+            }
+    
+            if output == "" {
+                fmt.Print(hints)
+                return nil
+            }
+    
+            if err := os.WriteFile(output, []byte(hints), 0644); err != nil {
+                return fmt.Errorf("failed to write hints: %v", err)
+            }
+    
+            fmt.Printf("%s Hints written to %s, run 'dialplan reload' to load them\n", green("✓"), output)
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVarP(&output, "output", "o", "", "Write the hints to a file instead of stdout")
+    
+    return cmd
+}
+
+func formatDeviceState(state string) string {
+    switch state {
+    case models.DeviceStateNotInUse:
+        return green(state)
+    case models.DeviceStateInUse, models.DeviceStateBusy:
+        return yellow(state)
+    case models.DeviceStateUnavailable:
+        return red(state)
+    }
+    return state
+}
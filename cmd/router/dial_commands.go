@@ -0,0 +1,281 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// dialFlags are the dial options a provider or a route may set
+type dialFlags struct {
+    timeout      int
+    callerIDPres string
+    predialSub   string
+    answerSub    string
+    transport    string
+    earlyMedia   string
+    maxAttempts  int
+}
+
+func (f *dialFlags) register(cmd *cobra.Command) {
+    cmd.Flags().IntVar(&f.timeout, "dial-timeout", 0, "Seconds to ring before giving up")
+    cmd.Flags().StringVar(&f.callerIDPres, "callerid-pres", "", "Caller ID presentation ("+strings.Join(models.CallerIDPresentations, ", ")+")")
+    cmd.Flags().StringVar(&f.predialSub, "predial-sub", "", "Dialplan context run on the outbound channel before dialing")
+    cmd.Flags().StringVar(&f.answerSub, "answer-sub", "", "Dialplan context run on the called channel on answer")
+    cmd.Flags().StringVar(&f.transport, "dial-transport", "", "Transport hint for the request URI ("+strings.Join(models.DialTransports, ", ")+")")
+    cmd.Flags().StringVar(&f.earlyMedia, "early-media", "", "Early media policy ("+strings.Join(models.EarlyMediaPolicies, ", ")+")")
+    cmd.Flags().IntVar(&f.maxAttempts, "max-attempts", 0, "Providers tried when a leg isn't answered before its timeout")
+}
+
+func (f *dialFlags) options() *models.DialOptions {
+    options := &models.DialOptions{
+        Timeout:      f.timeout,
+        CallerIDPres: f.callerIDPres,
+        PreDialSub:   f.predialSub,
+        AnswerSub:    f.answerSub,
+        Transport:    f.transport,
+        EarlyMedia:   f.earlyMedia,
+        MaxAttempts:  f.maxAttempts,
+    }
+    if options.IsEmpty() {
+        return nil
+    }
+    return options
+}
+
+func createProviderDialOptionsCommand() *cobra.Command {
+    dialCmd := &cobra.Command{
+        Use:   "dial-options",
+        Short: "Manage how calls are dialed towards providers",
+        Long: `Manage how calls are dialed towards providers.
+
+The router builds the Dial of every outbound leg: ring timeout, caller ID
+presentation, extra pre-dial and answer subroutines, a transport hint and the
+early media policy: pass_through (default), block to pass ringing on without
+the called side's early media, or ringback for local ringback. Route dial
+options win over the options of the provider dialed, a leg without a timeout
+rings for router.dial_timeout.
+
+A leg that isn't answered before its timeout is cancelled and, with
+router.no_answer.enabled, tried on another provider of the route until
+max attempts (router.no_answer.max_attempts by default) providers rang out.
+With router.serial_fork.enabled new calls come with the next intermediates
+already picked, the dialplan dials them in turn on their own DIDs before
+asking the router again; they count towards the max attempts of the leg.`,
+    }
+    
+    dialCmd.AddCommand(
+        createProviderDialOptionsSetCommand(),
+        createProviderDialOptionsListCommand(),
+        createProviderDialOptionsDeleteCommand(),
+    )
+    
+    return dialCmd
+}
+
+func createProviderDialOptionsSetCommand() *cobra.Command {
+    var flags dialFlags
+    
+    cmd := &cobra.Command{
+        Use:     "set <provider>",
+        Short:   "Set the dial options of a provider",
+        Example: `  router provider dial-options set s3-provider1 --dial-timeout 60 --callerid-pres prohib --dial-transport tcp`,
+        Args:    cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if _, err := providerSvc.GetProvider(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to get provider: %v", err)
+            }
+    
+            options := flags.options()
+            if options == nil {
+                return fmt.Errorf("no dial option given")
+            }
+    
+            if err := routerSvc.SetProviderDialOptions(ctx, &models.ProviderDialOptions{
+                ProviderName: args[0],
+                DialOptions:  *options,
+            }); err != nil {
+                return fmt.Errorf("failed to set dial options: %v", err)
+            }
+    
+            fmt.Printf("%s Dial options for '%s' set to %s\n", green("✓"), args[0], formatDialOptions(options))
+            return nil
+        },
+    }
+    
+    flags.register(cmd)
+    
+    return cmd
+}
+
+func createProviderDialOptionsListCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "list",
+        Short: "List provider dial options",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            list, err := routerSvc.ListProviderDialOptions(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to list dial options: %v", err)
+            }
+    
+            if len(list) == 0 {
+                fmt.Println("No provider dial options")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Provider", "Timeout", "Caller ID", "Pre-dial", "On Answer", "Transport", "Early Media", "Attempts"})
+            table.SetBorder(false)
+    
+            for _, o := range list {
+                timeout := "-"
+                if o.Timeout > 0 {
+                    timeout = strconv.Itoa(o.Timeout) + "s"
+                }
+                attempts := "-"
+                if o.MaxAttempts > 0 {
+                    attempts = strconv.Itoa(o.MaxAttempts)
+                }
+                table.Append([]string{
+                    o.ProviderName,
+                    timeout,
+                    orDash(o.CallerIDPres),
+                    orDash(o.PreDialSub),
+                    orDash(o.AnswerSub),
+                    orDash(o.Transport),
+                    orDash(o.EarlyMedia),
+                    attempts,
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createProviderDialOptionsDeleteCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "delete <provider>",
+        Short: "Remove the dial options of a provider",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteProviderDialOptions(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to delete dial options: %v", err)
+            }
+    
+            fmt.Printf("%s Dial options for '%s' removed\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
+
+func createRouteDialOptionsCommand() *cobra.Command {
+    var (
+        flags    dialFlags
+        clearAll bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "dial-options <route>",
+        Short: "Set the dial options of a route",
+        Long:  "Set the dial options of a route, they win over those of the providers the route dials",
+        Example: `  router route dial-options main --dial-timeout 45 --answer-sub sub-announce
+  router route dial-options billed-on-progress --early-media block
+  router route dial-options main --clear`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            options := flags.options()
+            if options == nil && !clearAll {
+                return fmt.Errorf("no dial option given, use --clear to remove them")
+            }
+            if clearAll {
+                options = nil
+            }
+    
+            if err := routerSvc.SetRouteDialOptions(ctx, args[0], options); err != nil {
+                return fmt.Errorf("failed to set dial options: %v", err)
+            }
+    
+            if options == nil {
+                fmt.Printf("%s Dial options of route '%s' cleared\n", green("✓"), args[0])
+                return nil
+            }
+            fmt.Printf("%s Dial options of route '%s' set to %s\n", green("✓"), args[0], formatDialOptions(options))
+            return nil
+        },
+    }
+    
+    flags.register(cmd)
+    cmd.Flags().BoolVar(&clearAll, "clear", false, "Remove the dial options of the route")
+    
+    return cmd
+}
+
+func formatDialOptions(o *models.DialOptions) string {
+    if o.IsEmpty() {
+        return "-"
+    }
+    
+    var parts []string
+    if o.Timeout > 0 {
+        parts = append(parts, fmt.Sprintf("timeout %ds", o.Timeout))
+    }
+    if o.CallerIDPres != "" {
+        parts = append(parts, "caller ID "+o.CallerIDPres)
+    }
+    if o.PreDialSub != "" {
+        parts = append(parts, "pre-dial "+o.PreDialSub)
+    }
+    if o.AnswerSub != "" {
+        parts = append(parts, "on answer "+o.AnswerSub)
+    }
+    if o.Transport != "" {
+        parts = append(parts, "transport "+o.Transport)
+    }
+    if o.EarlyMedia != "" {
+        parts = append(parts, "early media "+o.EarlyMedia)
+    }
+    if o.MaxAttempts > 0 {
+        parts = append(parts, fmt.Sprintf("%d attempts", o.MaxAttempts))
+    }
+    return strings.Join(parts, ", ")
+}
+
+func orDash(s string) string {
+    if s == "" {
+        return "-"
+    }
+    return s
+}
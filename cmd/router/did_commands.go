@@ -0,0 +1,524 @@
+package main
+
+import (
+    "context"
+    "encoding/csv"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createDIDShowCommand() *cobra.Command {
+    var (
+        recent      int
+        includeTest bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "show <number>",
+        Short: "Show DID details, usage statistics and recent calls",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            details, err := routerSvc.GetDIDDetails(ctx, args[0], recent, includeTest)
+            if err != nil {
+                return fmt.Errorf("failed to get DID: %v", err)
+            }
+            
+            did := details.DID
+            status := green("Available")
+            if did.InUse {
+                status = yellow("In Use") + " → " + did.Destination
+            }
+            if did.QuarantinedUntil != nil {
+                status = yellow("Quarantined") + " until " + did.QuarantinedUntil.Local().Format("2006-01-02 15:04")
+            }
+            if did.IsTest {
+                status += " " + yellow("[TEST]")
+            }
+            
+            fmt.Printf("%s\n", bold("DID Details:"))
+            fmt.Printf("  Number:      %s\n", did.Number)
+            fmt.Printf("  Provider:    %s\n", did.ProviderName)
+            fmt.Printf("  Status:      %s\n", status)
+            if did.Country != "" || did.City != "" {
+                fmt.Printf("  Location:    %s %s\n", did.Country, did.City)
+            }
+            fmt.Printf("  Rates:       %.4f/min, %.2f/month %s\n", did.PerMinuteCost, did.MonthlyCost, formatCurrency(did.Currency))
+            
+            usage := details.Usage
+            fmt.Printf("\n%s\n", bold("Usage ("+routerSvc.GetFX().Currency()+"):"))
+            fmt.Printf("  Allocations: %d (pool counter %d)\n", usage.Allocations, did.UsageCount)
+            fmt.Printf("  Answered:    %d (ASR %.1f%%)\n", usage.Answered, usage.ASR)
+            fmt.Printf("  Minutes:     %.1f\n", usage.TotalMinutes)
+            fmt.Printf("  Revenue:     %.4f\n", usage.Revenue)
+            fmt.Printf("  Cost:        %.4f\n", usage.Cost)
+            fmt.Printf("  Margin:      %s\n", formatMargin(usage.Margin))
+            if usage.FirstUsed != nil {
+                fmt.Printf("  First Used:  %s\n", usage.FirstUsed.Format("2006-01-02 15:04:05"))
+            }
+            if usage.LastUsed != nil {
+                fmt.Printf("  Last Used:   %s\n", usage.LastUsed.Format("2006-01-02 15:04:05"))
+            }
+            
+            if len(details.ByRoute) > 0 {
+                fmt.Printf("\n%s\n", bold("By Route:"))
+                table := tablewriter.NewWriter(os.Stdout)
+                table.SetHeader([]string{"Route", "Allocations", "ASR", "Minutes", "Revenue", "Cost", "Margin"})
+                table.SetBorder(false)
+                
+                for _, r := range details.ByRoute {
+                    route := r.Key
+                    if route == "" {
+                        route = "-"
+                    }
+                    table.Append([]string{
+                        route,
+                        fmt.Sprintf("%d", r.Allocations),
+                        fmt.Sprintf("%.1f%%", r.ASR),
+                        fmt.Sprintf("%.1f", r.TotalMinutes),
+                        fmt.Sprintf("%.4f", r.Revenue),
+                        fmt.Sprintf("%.4f", r.Cost),
+                        formatMargin(r.Margin),
+                    })
+                }
+                table.Render()
+            }
+            
+            if len(details.Recent) == 0 {
+                fmt.Println("\nNo calls have used this DID yet")
+                return nil
+            }
+            
+            fmt.Printf("\n%s\n", bold(fmt.Sprintf("Last %d Calls:", len(details.Recent))))
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Released", "Call ID", "Route", "Intermediate", "Final", "Status", "Duration"})
+            table.SetBorder(false)
+            
+            for _, u := range details.Recent {
+                duration := time.Duration(u.Duration) * time.Second
+                callStatus := string(u.Status)
+                if u.IsTest {
+                    callStatus += " " + yellow("[TEST]")
+                }
+                table.Append([]string{
+                    u.ReleasedAt.Format("2006-01-02 15:04:05"),
+                    u.CallID,
+                    u.RouteName,
+                    u.IntermediateProvider,
+                    u.FinalProvider,
+                    callStatus,
+                    fmt.Sprintf("%02d:%02d", int(duration.Minutes()), int(duration.Seconds())%60),
+                })
+            }
+            table.Render()
+            
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().IntVarP(&recent, "calls", "n", 10, "Number of recent calls to show")
+    cmd.Flags().BoolVar(&includeTest, "include-test", false, "Count test calls in the usage totals")
+    
+    return cmd
+}
+
+func formatMargin(margin float64) string {
+    if margin < 0 {
+        return red(fmt.Sprintf("%.4f", margin))
+    }
+    return green(fmt.Sprintf("%.4f", margin))
+}
+
+func createDIDSearchCommand() *cobra.Command {
+    var (
+        filter  models.DIDFilter
+        maxCost float64
+        csvFile string
+        opts    models.ListOptions
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "search",
+        Short: "Search the DID pool by pattern, country and cost",
+        Example: `  router did search --pattern '5841%' --country VE --max-cost 0.02 --status available
+  router did search --country VE --csv ve-dids.csv`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            switch filter.Status {
+            case "", "available", "in_use", "quarantined":
+            case "all":
+                filter.Status = ""
+            default:
+                return fmt.Errorf("--status must be available, in_use, quarantined or all")
+            }
+            if cmd.Flags().Changed("max-cost") {
+                filter.MaxCost = &maxCost
+            }
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            if csvFile != "" {
+                return exportDIDSearch(ctx, filter, opts, csvFile, cmd.Flags().Changed("limit"))
+            }
+            
+            dids, total, err := routerSvc.ListDIDs(ctx, filter, opts)
+            if err != nil {
+                return fmt.Errorf("failed to search DIDs: %v", err)
+            }
+            
+            if total == 0 {
+                fmt.Println("No matching DIDs found")
+                return nil
+            }
+            
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Number", "Provider", "Country", "City", "Status", "Per Minute", "Monthly", "Usage Count"})
+            table.SetBorder(false)
+            
+            for _, did := range dids {
+                status := green("Available")
+                if did.InUse {
+                    status = yellow("In Use")
+                } else if did.QuarantinedUntil != nil {
+                    status = yellow("Quarantined")
+                }
+                
+                table.Append([]string{
+                    did.Number,
+                    did.ProviderName,
+                    did.Country,
+                    did.City,
+                    status,
+                    fmt.Sprintf("%.4f", did.PerMinuteCost),
+                    fmt.Sprintf("%.2f", did.MonthlyCost),
+                    fmt.Sprintf("%d", did.UsageCount),
+                })
+            }
+            
+            table.Render()
+            printPageFooter(len(dids), total, opts)
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&filter.Pattern, "pattern", "", "Number pattern, % or * matches any digits and _ a single digit")
+    cmd.Flags().StringVar(&filter.Prefix, "prefix", "", "Number prefix")
+    cmd.Flags().StringVar(&filter.Country, "country", "", "Country")
+    cmd.Flags().Float64Var(&maxCost, "max-cost", 0, "Maximum per minute cost")
+    cmd.Flags().StringVar(&filter.Status, "status", "", "available, in_use, quarantined or all")
+    cmd.Flags().StringVarP(&filter.Provider, "provider", "p", "", "Filter by provider")
+    cmd.Flags().StringVar(&csvFile, "csv", "", "Export matches to a CSV file (- for stdout)")
+    addListFlags(cmd, &opts, "number, provider, country, cost, monthly, usage, last_used, created")
+    
+    return cmd
+}
+
+// exportDIDSearch writes all matches as CSV, or a single page when --limit was given
+func exportDIDSearch(ctx context.Context, filter models.DIDFilter, opts models.ListOptions, path string, singlePage bool) error {
+    var out io.Writer = os.Stdout
+    if path != "-" {
+        file, err := os.Create(path)
+        if err != nil {
+            return fmt.Errorf("failed to create %s: %v", path, err)
+        }
+        defer file.Close()
+        out = file
+    }
+    
+    w := csv.NewWriter(out)
+    w.Write([]string{"number", "provider", "country", "city", "status", "per_minute_cost", "monthly_cost", "usage_count", "last_used_at"})
+    
+    if !singlePage {
+        opts.Limit = models.MaxListLimit
+    }
+    
+    var exported int
+    for {
+        dids, total, err := routerSvc.ListDIDs(ctx, filter, opts)
+        if err != nil {
+            return fmt.Errorf("failed to search DIDs: %v", err)
+        }
+        
+        for _, did := range dids {
+            status := "available"
+            if did.InUse {
+                status = "in_use"
+            } else if did.QuarantinedUntil != nil {
+                status = "quarantined"
+            }
+            lastUsed := ""
+            if did.LastUsedAt != nil {
+                lastUsed = did.LastUsedAt.Format("2006-01-02 15:04:05")
+            }
+            
+            w.Write([]string{
+                did.Number,
+                did.ProviderName,
+                did.Country,
+                did.City,
+                status,
+                strconv.FormatFloat(did.PerMinuteCost, 'f', 4, 64),
+                strconv.FormatFloat(did.MonthlyCost, 'f', 2, 64),
+                strconv.FormatInt(did.UsageCount, 10),
+                lastUsed,
+            })
+        }
+        exported += len(dids)
+        
+        opts.Offset += len(dids)
+        if singlePage || len(dids) == 0 || int64(opts.Offset) >= total {
+            break
+        }
+    }
+    
+    w.Flush()
+    if err := w.Error(); err != nil {
+        return fmt.Errorf("failed to write CSV: %v", err)
+    }
+    
+    if path != "-" {
+        fmt.Printf("%s Exported %d DIDs to %s\n", green("✓"), exported, path)
+    }
+    return nil
+}
+
+func createDIDHistoryCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "history <number>",
+        Short: "Show when a number left and re-joined the pool",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            history, err := routerSvc.GetDIDManager().DIDHistory(ctx, args[0])
+            if err != nil {
+                return fmt.Errorf("failed to get DID history: %v", err)
+            }
+    
+            if len(history) == 0 {
+                fmt.Printf("No history recorded for %s\n", args[0])
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Time", "Event", "Provider", "Last Used", "Detail", "User"})
+            table.SetBorder(false)
+    
+            for _, h := range history {
+                event := h.Event
+                switch event {
+                case models.DIDHistoryRemoved:
+                    event = red(event)
+                case models.DIDHistoryQuarantined:
+                    event = yellow(event)
+                }
+                lastUsed := "-"
+                if h.LastUsedAt != nil {
+                    lastUsed = h.LastUsedAt.Local().Format("2006-01-02 15:04")
+                }
+                table.Append([]string{
+                    h.CreatedAt.Local().Format("2006-01-02 15:04"),
+                    event,
+                    h.ProviderName,
+                    lastUsed,
+                    h.Detail,
+                    h.UserID,
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createDIDReleaseQuarantineCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "release-quarantine <number>",
+        Short: "Return a recycled DID to rotation before its quarantine ends",
+        Long: `Return a recycled DID to rotation before its quarantine ends.
+
+Only do this once the number's previous calls can no longer send return legs,
+otherwise they may reach the new call using it.`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.GetDIDManager().ReleaseQuarantine(ctx, args[0], audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to release DID quarantine: %v", err)
+            }
+    
+            fmt.Printf("%s DID '%s' is back in rotation\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
+
+func createDIDLookupCommand() *cobra.Command {
+    var (
+        at     string
+        window time.Duration
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "lookup <number>",
+        Short: "Show which call is using a DID now or used it at a given time",
+        Long: `Show which call is using a DID now or used it at a given time, with the
+providers, numbers and outcome of all its legs.
+
+Carrier trouble tickets often only give the number and a time; calls that held
+the DID within --window of --at are listed, those holding it at the time
+itself first.`,
+        Args: cobra.ExactArgs(1),
+        Example: `  router did lookup 15551234567
+  router did lookup 15551234567 --at "2026-10-12 14:32" --window 5m`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            var when time.Time
+            if at != "" {
+                t, err := parseEventTime(at)
+                if err != nil {
+                    return err
+                }
+                when = t
+            }
+    
+            lookup, err := routerSvc.LookupDIDCalls(ctx, args[0], when, window)
+            if err != nil {
+                return fmt.Errorf("failed to look up DID: %v", err)
+            }
+    
+            if len(lookup.Matches) == 0 {
+                if lookup.Live {
+                    fmt.Printf("No call is using %s\n", lookup.Number)
+                } else {
+                    fmt.Printf("No call used %s within %s of %s\n", lookup.Number, lookup.Window,
+                        lookup.At.Local().Format("2006-01-02 15:04:05"))
+                }
+                return nil
+            }
+    
+            for i, m := range lookup.Matches {
+                if i > 0 {
+                    fmt.Println()
+                }
+                printDIDCallMatch(m)
+            }
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&at, "at", "", "Time to look up (RFC3339 or \"2006-01-02 15:04\"), default now")
+    cmd.Flags().DurationVar(&window, "window", 2*time.Minute, "Match calls holding the DID this close to --at")
+    
+    return cmd
+}
+
+func printDIDCallMatch(m *models.DIDCallMatch) {
+    state := yellow("near the time")
+    if m.Exact {
+        state = green("at the time")
+    }
+    if m.Active {
+        state += ", " + yellow("in progress")
+    }
+    
+    callID := ""
+    if m.Call != nil {
+        callID = m.Call.CallID
+    } else if m.Usage != nil {
+        callID = m.Usage.CallID
+    }
+    fmt.Printf("%s %s (%s)\n", bold("Call"), callID, state)
+    
+    if m.Usage != nil {
+        held := "?"
+        if m.Usage.AllocatedAt != nil {
+            held = m.Usage.AllocatedAt.Local().Format("2006-01-02 15:04:05")
+        }
+        fmt.Printf("  DID Held:     %s → %s\n", held, m.Usage.ReleasedAt.Local().Format("15:04:05"))
+    }
+    
+    c := m.Call
+    if c == nil {
+        // Only the usage log is left once call records are pruned
+        u := m.Usage
+        fmt.Printf("  Route:        %s\n", u.RouteName)
+        fmt.Printf("  Legs:         %s → %s → %s\n", u.InboundProvider, u.IntermediateProvider, u.FinalProvider)
+        fmt.Printf("  Status:       %s, %ds\n", u.Status, u.Duration)
+        fmt.Printf("  %s\n", yellow("call record pruned, numbers and leg outcomes unavailable"))
+        return
+    }
+    
+    fmt.Printf("  Route:        %s\n", c.RouteName)
+    fmt.Printf("  ANI/DNIS:     %s → %s", cliNumber(c.OriginalANI), cliNumber(c.OriginalDNIS))
+    if c.TransformedANI != "" && c.TransformedANI != c.OriginalANI {
+        fmt.Printf(" (ANI sent as %s)", cliNumber(c.TransformedANI))
+    }
+    fmt.Println()
+    fmt.Printf("  Started:      %s", c.StartTime.Local().Format("2006-01-02 15:04:05"))
+    if c.AnswerTime != nil {
+        fmt.Printf(", answered %s", c.AnswerTime.Local().Format("15:04:05"))
+    }
+    if c.EndTime != nil {
+        fmt.Printf(", ended %s", c.EndTime.Local().Format("15:04:05"))
+    }
+    fmt.Println()
+    
+    outcome := string(c.Status)
+    if c.Disposition != "" {
+        outcome += ", " + c.Disposition
+    }
+    if c.SIPResponseCode > 0 {
+        outcome += fmt.Sprintf(", SIP %d", c.SIPResponseCode)
+    }
+    if c.HangupCause > 0 {
+        outcome += fmt.Sprintf(", cause %d", c.HangupCause)
+    }
+    if c.FailureReason != "" {
+        outcome += ": " + c.FailureReason
+    }
+    fmt.Printf("  Outcome:      %s\n", outcome)
+    
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"Leg", "Provider", "Billable"})
+    table.SetBorder(false)
+    table.Append([]string{"inbound", c.InboundProvider, fmt.Sprintf("%ds", c.BillableDuration)})
+    table.Append([]string{"intermediate", c.IntermediateProvider, fmt.Sprintf("%ds", c.IntermediateBillable)})
+    table.Append([]string{"final", c.FinalProvider, fmt.Sprintf("%ds", c.FinalBillable)})
+    table.Render()
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+func createDIDWatermarkCommand() *cobra.Command {
+    watermarkCmd := &cobra.Command{
+        Use:   "watermark",
+        Short: "Manage DID pool watermarks",
+        Long: `Manage DID pool watermarks.
+
+A pool is a provider's production DIDs, in one country or all of them. When its
+available numbers fall below the watermark an order for more is created and
+placed with the pool's orderer; the manual orderer queues it for an operator
+and raises an ALERT. Only one order per pool is pending at a time.`,
+    }
+    
+    watermarkCmd.AddCommand(
+        createDIDWatermarkSetCommand(),
+        createDIDWatermarkListCommand(),
+        createDIDWatermarkRemoveCommand(),
+    )
+    
+    return watermarkCmd
+}
+
+func createDIDWatermarkSetCommand() *cobra.Command {
+    var (
+        w        models.DIDWatermark
+        disabled bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:     "set <provider>",
+        Short:   "Set the watermark of a DID pool",
+        Args:    cobra.ExactArgs(1),
+        Example: `  router did watermark set carrier-a --country VE --min-available 50 --order-quantity 200`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if _, err := providerSvc.GetProvider(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to get provider: %v", err)
+            }
+    
+            w.ProviderName = args[0]
+            w.Enabled = !disabled
+            if err := routerSvc.GetDIDProcurement().SetWatermark(ctx, &w, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set DID watermark: %v", err)
+            }
+    
+            fmt.Printf("%s Pool %s orders %d DIDs below %d available\n", green("✓"), poolName(w.ProviderName, w.Country), w.OrderQuantity, w.MinAvailable)
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&w.Country, "country", "", "Country of the pool, all of the provider's DIDs when empty")
+    cmd.Flags().IntVar(&w.MinAvailable, "min-available", 0, "Available DIDs below which more are ordered (required)")
+    cmd.Flags().IntVar(&w.OrderQuantity, "order-quantity", 0, "DIDs ordered at a time (required)")
+    cmd.Flags().StringVar(&w.Orderer, "orderer", router.ManualOrderer, "How orders are placed")
+    cmd.Flags().BoolVar(&disabled, "disabled", false, "Watch the pool without ordering")
+    cmd.MarkFlagRequired("min-available")
+    cmd.MarkFlagRequired("order-quantity")
+    
+    return cmd
+}
+
+func createDIDWatermarkListCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "list",
+        Short: "List DID pool watermarks with the pools' available numbers",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            procurement := routerSvc.GetDIDProcurement()
+            watermarks, err := procurement.ListWatermarks(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to list DID watermarks: %v", err)
+            }
+    
+            if len(watermarks) == 0 {
+                fmt.Println("No DID watermarks")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Pool", "Available", "Watermark", "Order Quantity", "Orderer", "Status"})
+            table.SetBorder(false)
+    
+            for _, w := range watermarks {
+                available := "?"
+                if n, err := procurement.PoolAvailable(ctx, w.ProviderName, w.Country); err == nil {
+                    available = strconv.Itoa(n)
+                    if n < w.MinAvailable {
+                        available = red(available)
+                    }
+                }
+                status := green("enabled")
+                if !w.Enabled {
+                    status = yellow("disabled")
+                }
+                table.Append([]string{
+                    poolName(w.ProviderName, w.Country),
+                    available,
+                    strconv.Itoa(w.MinAvailable),
+                    strconv.Itoa(w.OrderQuantity),
+                    w.Orderer,
+                    status,
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createDIDWatermarkRemoveCommand() *cobra.Command {
+    var country string
+    
+    cmd := &cobra.Command{
+        Use:   "remove <provider>",
+        Short: "Stop watching a DID pool",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.GetDIDProcurement().DeleteWatermark(ctx, args[0], country, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove DID watermark: %v", err)
+            }
+    
+            fmt.Printf("%s Watermark of pool %s removed\n", green("✓"), poolName(args[0], country))
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&country, "country", "", "Country of the pool")
+    
+    return cmd
+}
+
+func createDIDOrderCommand() *cobra.Command {
+    orderCmd := &cobra.Command{
+        Use:   "order",
+        Short: "Track DID orders and activate delivered numbers",
+        Long: `Track DID orders and activate delivered numbers.
+
+Orders are created by pool watermarks or by hand. An open order waits to be
+placed with the supplier, a submitted one for its numbers. Delivered numbers
+are activated into the pool with the order's provider, country and costs; the
+order is delivered once its whole quantity is in the pool.`,
+    }
+    
+    orderCmd.AddCommand(
+        createDIDOrderCreateCommand(),
+        createDIDOrderListCommand(),
+        createDIDOrderSubmitCommand(),
+        createDIDOrderDeliverCommand(),
+        createDIDOrderCancelCommand(),
+    )
+    
+    return orderCmd
+}
+
+func createDIDOrderCreateCommand() *cobra.Command {
+    var o models.DIDOrder
+    
+    cmd := &cobra.Command{
+        Use:     "create <provider>",
+        Short:   "Order DIDs for a pool",
+        Args:    cobra.ExactArgs(1),
+        Example: `  router did order create carrier-a --country VE --quantity 100 --monthly-cost 1.5 --per-minute-cost 0.004`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if _, err := providerSvc.GetProvider(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to get provider: %v", err)
+            }
+    
+            o.ProviderName = args[0]
+            o.CreatedBy = audit.CurrentUser()
+            if err := routerSvc.GetDIDProcurement().CreateOrder(ctx, &o); err != nil {
+                return fmt.Errorf("failed to create DID order: %v", err)
+            }
+    
+            fmt.Printf("%s DID order %d for %d numbers created (%s)\n", green("✓"), o.ID, o.Quantity, o.Status)
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&o.Country, "country", "", "Country of the numbers")
+    cmd.Flags().IntVar(&o.Quantity, "quantity", 0, "Numbers ordered (required)")
+    cmd.Flags().StringVar(&o.Orderer, "orderer", router.ManualOrderer, "How the order is placed")
+    cmd.Flags().StringVar(&o.Reason, "reason", "", "Why the numbers are needed")
+    cmd.Flags().Float64Var(&o.MonthlyCost, "monthly-cost", 0, "Monthly cost of each number")
+    cmd.Flags().Float64Var(&o.PerMinuteCost, "per-minute-cost", 0, "Per minute cost of each number")
+    cmd.Flags().StringVar(&o.Currency, "currency", "", "Currency of the costs, the reporting currency when empty")
+    cmd.MarkFlagRequired("quantity")
+    
+    return cmd
+}
+
+func createDIDOrderListCommand() *cobra.Command {
+    var (
+        all   bool
+        limit int
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "list",
+        Short: "List pending DID orders",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            orders, err := routerSvc.GetDIDProcurement().ListOrders(ctx, !all, limit)
+            if err != nil {
+                return fmt.Errorf("failed to list DID orders: %v", err)
+            }
+    
+            if len(orders) == 0 {
+                fmt.Println("No DID orders")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"ID", "Pool", "Delivered", "Status", "Orderer", "Reference", "Reason", "Created"})
+            table.SetBorder(false)
+    
+            for _, o := range orders {
+                status := string(o.Status)
+                switch o.Status {
+                case models.DIDOrderOpen:
+                    status = yellow(status)
+                case models.DIDOrderDelivered:
+                    status = green(status)
+                case models.DIDOrderFailed:
+                    status = red(status + ": " + o.Error)
+                }
+                table.Append([]string{
+                    strconv.FormatInt(o.ID, 10),
+                    poolName(o.ProviderName, o.Country),
+                    fmt.Sprintf("%d/%d", o.Delivered, o.Quantity),
+                    status,
+                    o.Orderer,
+                    o.Reference,
+                    o.Reason,
+                    o.CreatedAt.Local().Format("2006-01-02 15:04"),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().BoolVar(&all, "all", false, "Include delivered, cancelled and failed orders")
+    cmd.Flags().IntVar(&limit, "limit", 50, "Orders shown")
+    
+    return cmd
+}
+
+func createDIDOrderSubmitCommand() *cobra.Command {
+    var reference string
+    
+    cmd := &cobra.Command{
+        Use:   "submit <order-id>",
+        Short: "Record that an open order was placed with the supplier",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            id, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil {
+                return fmt.Errorf("invalid order id: %s", args[0])
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.GetDIDProcurement().Submit(ctx, id, reference, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to update DID order: %v", err)
+            }
+    
+            fmt.Printf("%s DID order %d submitted\n", green("✓"), id)
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&reference, "reference", "", "The supplier's order or ticket id")
+    
+    return cmd
+}
+
+func createDIDOrderDeliverCommand() *cobra.Command {
+    var csvFile string
+    
+    cmd := &cobra.Command{
+        Use:   "deliver <order-id> [numbers...]",
+        Short: "Activate an order's delivered numbers into its pool",
+        Args:  cobra.MinimumNArgs(1),
+        Example: `  router did order deliver 12 -f delivered.csv
+  router did order deliver 12 584121234567 584121234568`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            id, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil {
+                return fmt.Errorf("invalid order id: %s", args[0])
+            }
+    
+            numbers := args[1:]
+            if csvFile != "" {
+                fromFile, err := readDIDFile(csvFile)
+                if err != nil {
+                    return err
+                }
+                numbers = append(numbers, fromFile...)
+            }
+            if len(numbers) == 0 {
+                return fmt.Errorf("no DIDs specified")
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            delivery, err := routerSvc.GetDIDProcurement().Deliver(ctx, id, numbers, audit.CurrentUser())
+            if err != nil {
+                return fmt.Errorf("failed to deliver DID order: %v", err)
+            }
+    
+            o := delivery.Order
+            fmt.Printf("%s %d DIDs activated into pool %s, order %d is %s (%d/%d)\n", green("✓"),
+                delivery.Activated, poolName(o.ProviderName, o.Country), o.ID, o.Status, o.Delivered, o.Quantity)
+            if delivery.Quarantined > 0 {
+                fmt.Printf("%s %d recycled DIDs quarantined, see: router did history <number>\n", yellow("!"), delivery.Quarantined)
+            }
+            if len(delivery.Skipped) > 0 {
+                fmt.Printf("%s %d DIDs were already in the pool\n", yellow("!"), len(delivery.Skipped))
+            }
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVarP(&csvFile, "file", "f", "", "CSV file containing the delivered DIDs")
+    
+    return cmd
+}
+
+func createDIDOrderCancelCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "cancel <order-id>",
+        Short: "Stop waiting for an order's numbers",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            id, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil {
+                return fmt.Errorf("invalid order id: %s", args[0])
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.GetDIDProcurement().Cancel(ctx, id, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to cancel DID order: %v", err)
+            }
+    
+            fmt.Printf("%s DID order %d cancelled\n", green("✓"), id)
+            return nil
+        },
+    }
+}
+
+// poolName shows a DID pool as provider or provider/country
+func poolName(provider, country string) string {
+    if country == "" {
+        return provider
+    }
+    return provider + "/" + country
+}
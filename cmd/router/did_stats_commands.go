@@ -0,0 +1,154 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+func createDIDStatsCommand() *cobra.Command {
+    var (
+        period     string
+        provider   string
+        top        int
+        outputJSON bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "stats",
+        Short: "Show how allocations spread over the DID pool",
+        Long: `Show how allocations spread over the DID pool over a period: allocations
+per DID, how many DIDs fall in each range, the DIDs allocated most and the
+totals of each provider's DIDs.
+
+The rotation policy keeps the same DIDs from being reused too aggressively:
+router.did_rotation.max_per_hour caps the allocations of a DID in the hour
+from its first one, router.did_rotation.cooldown rests a released DID before
+it is allocated again and router.did_rotation.order picks the DID released
+longest ago (least_recent) or every DID of the pool in turn (round_robin).
+The DIDs the policy holds back right now are counted at the end. Calls the
+policy leaves without a DID fail as when the pool is exhausted.
+
+Allocations are counted from the DID usage log, written as DIDs are released:
+calls still up aren't in it yet.`,
+        Example: `  router did stats
+  router did stats --period 7d --provider s3-provider1
+  router did stats --period 1h --top 20 --json`,
+        Args: cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            length, err := parseScorecardPeriod(period)
+            if err != nil {
+                return err
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            stats, err := routerSvc.GetDIDManager().DIDStats(ctx, router.DIDStatsOptions{
+                Period:   length,
+                Provider: provider,
+                Top:      top,
+            })
+            if err != nil {
+                return fmt.Errorf("failed to get DID stats: %v", err)
+            }
+    
+            if outputJSON {
+                data, _ := json.MarshalIndent(stats, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+    
+            fmt.Printf("\n%s %s - %s\n", bold("DID Allocations"),
+                stats.Since.Local().Format("2006-01-02 15:04"), stats.Until.Local().Format("2006-01-02 15:04"))
+            if stats.Provider != "" {
+                fmt.Printf("Provider: %s\n", stats.Provider)
+            }
+            fmt.Printf("DIDs: %d (%d allocated in the period, %d in use)\n", stats.DIDs, stats.Used, stats.InUse)
+            fmt.Printf("Allocations: %d, per DID: mean %.1f, median %d, p95 %d, max %d\n\n",
+                stats.Allocations, stats.Mean, stats.Median, stats.P95, stats.Max)
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Allocations", "DIDs", "Share"})
+            table.SetBorder(false)
+            for _, b := range stats.Buckets {
+                share := "-"
+                if stats.DIDs > 0 {
+                    share = fmt.Sprintf("%.1f%%", float64(b.DIDs)/float64(stats.DIDs)*100)
+                }
+                table.Append([]string{formatAllocationBucket(b), strconv.Itoa(b.DIDs), share})
+            }
+            table.Render()
+    
+            if len(stats.Top) > 0 {
+                fmt.Printf("\n%s\n", bold("Most Allocated"))
+                table = tablewriter.NewWriter(os.Stdout)
+                table.SetHeader([]string{"Number", "Provider", "Allocations", "This Hour"})
+                table.SetBorder(false)
+                for _, did := range stats.Top {
+                    lastHour := strconv.FormatInt(did.LastHour, 10)
+                    if stats.MaxPerHour > 0 && did.LastHour >= int64(stats.MaxPerHour) {
+                        lastHour = yellow(lastHour)
+                    }
+                    table.Append([]string{did.Number, did.Provider, strconv.FormatInt(did.Allocations, 10), lastHour})
+                }
+                table.Render()
+            }
+    
+            if len(stats.ByProvider) > 1 {
+                fmt.Printf("\n%s\n", bold("By Provider"))
+                table = tablewriter.NewWriter(os.Stdout)
+                table.SetHeader([]string{"Provider", "DIDs", "Allocations", "Per DID", "Max"})
+                table.SetBorder(false)
+                for _, p := range stats.ByProvider {
+                    table.Append([]string{
+                        p.Provider,
+                        strconv.Itoa(p.DIDs),
+                        strconv.FormatInt(p.Allocations, 10),
+                        fmt.Sprintf("%.1f", float64(p.Allocations)/float64(p.DIDs)),
+                        strconv.FormatInt(p.Max, 10),
+                    })
+                }
+                table.Render()
+            }
+    
+            fmt.Printf("\n%s order %s", bold("Rotation:"), stats.Order)
+            if stats.MaxPerHour > 0 {
+                fmt.Printf(", at most %d allocations an hour (%d DIDs at the limit)", stats.MaxPerHour, stats.AtHourlyLimit)
+            }
+            if stats.Cooldown != "0s" {
+                fmt.Printf(", %s cool-down (%d DIDs cooling down)", stats.Cooldown, stats.CoolingDown)
+            }
+            fmt.Println()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&period, "period", "24h", "Length of the period up to now, in days (7d), weeks (4w) or a duration (12h)")
+    cmd.Flags().StringVar(&provider, "provider", "", "Only the DIDs of this provider")
+    cmd.Flags().IntVar(&top, "top", 10, "Most allocated DIDs listed")
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output as JSON")
+    
+    return cmd
+}
+
+func formatAllocationBucket(b *models.DIDAllocationBucket) string {
+    switch {
+    case b.To == nil:
+        return fmt.Sprintf("%d+", b.From)
+    case b.From == *b.To:
+        return strconv.FormatInt(b.From, 10)
+    }
+    return fmt.Sprintf("%d-%d", b.From, *b.To)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createDispositionCommands() *cobra.Command {
+    dispositionCmd := &cobra.Command{
+        Use:   "disposition",
+        Short: "Manage hangup dispositions",
+        Long: `Manage hangup dispositions.
+
+Every call is stored with a disposition (` + strings.Join(models.Dispositions, ", ") + `)
+mapped from the SIP response of the dialed leg, its Q.850 hangup cause and the
+Asterisk DIALSTATUS. ANSWER and CANCEL dial statuses always win, then the SIP
+response, then the Q.850 cause, then the dial status; the raw codes are kept on
+the call record. Mappings set here override the built-in ones.`,
+    }
+    
+    dispositionCmd.AddCommand(
+        createDispositionMapCommand(),
+        createDispositionSetCommand(),
+        createDispositionDeleteCommand(),
+        createDispositionReportCommand(),
+    )
+    
+    return dispositionCmd
+}
+
+func createDispositionMapCommand() *cobra.Command {
+    var source string
+    
+    cmd := &cobra.Command{
+        Use:   "map",
+        Short: "Show the code to disposition mapping in effect",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            mappings, err := routerSvc.ListDispositionMappings(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to list disposition mapping: %v", err)
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Source", "Code", "Disposition", "Origin"})
+            table.SetBorder(false)
+    
+            for _, m := range mappings {
+                if source != "" && m.Source != strings.ToLower(source) {
+                    continue
+                }
+                origin := "built-in"
+                if m.Custom {
+                    origin = yellow("custom")
+                }
+                table.Append([]string{m.Source, m.Code, m.Disposition, origin})
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&source, "source", "", "Only show one code source ("+strings.Join(models.DispositionSources, ", ")+")")
+    
+    return cmd
+}
+
+func createDispositionSetCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "set <source> <code> <disposition>",
+        Short: "Map a code to a disposition",
+        Example: `  router disposition set sip 480 no_answer
+  router disposition set q850 31 congestion
+  router disposition set dialstatus CHANUNAVAIL congestion`,
+        Args: cobra.ExactArgs(3),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            mapping := &models.DispositionMapping{
+                Source:      args[0],
+                Code:        args[1],
+                Disposition: args[2],
+            }
+            if err := routerSvc.SetDispositionMapping(ctx, mapping); err != nil {
+                return fmt.Errorf("failed to set disposition mapping: %v", err)
+            }
+    
+            fmt.Printf("%s %s %s now maps to %s\n", green("✓"), mapping.Source, mapping.Code, mapping.Disposition)
+            return nil
+        },
+    }
+}
+
+func createDispositionDeleteCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "delete <source> <code>",
+        Short: "Remove a custom mapping, built-in codes go back to their default",
+        Args:  cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteDispositionMapping(ctx, args[0], args[1]); err != nil {
+                return fmt.Errorf("failed to delete disposition mapping: %v", err)
+            }
+    
+            fmt.Printf("%s Custom mapping of %s %s removed\n", green("✓"), args[0], args[1])
+            return nil
+        },
+    }
+}
+
+func createDispositionReportCommand() *cobra.Command {
+    var (
+        since    time.Duration
+        provider string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "report",
+        Short: "Count production calls per disposition",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            counts, err := routerSvc.DispositionReport(ctx, time.Now().Add(-since), provider)
+            if err != nil {
+                return fmt.Errorf("failed to get dispositions: %v", err)
+            }
+    
+            if len(counts) == 0 {
+                fmt.Println("No calls in the window")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Disposition", "Calls", "Share"})
+            table.SetBorder(false)
+    
+            for _, c := range counts {
+                table.Append([]string{c.Disposition, strconv.Itoa(c.Calls), fmt.Sprintf("%.2f%%", c.Share)})
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().DurationVar(&since, "since", 24*time.Hour, "How far back to count calls")
+    cmd.Flags().StringVarP(&provider, "provider", "p", "", "Only count calls a provider carried on any leg")
+    
+    return cmd
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/spf13/cobra"
+    "github.com/spf13/viper"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/ara"
+    "github.com/hamzaKhattat/ara-production-system/internal/db"
+    "github.com/hamzaKhattat/ara-production-system/internal/drift"
+)
+
+// Results of a doctor check
+const (
+    doctorOK   = "ok"
+    doctorWarn = "warn"
+    doctorFail = "fail"
+)
+
+// realtimeFamilies are the extconfig.conf mappings the router's tables need
+var realtimeFamilies = []string{"ps_endpoints", "ps_auths", "ps_aors", "ps_endpoint_id_ips", "ps_contacts", "extensions"}
+
+type doctorResult struct {
+    status string
+    name   string
+    detail string
+    fix    string
+}
+
+// doctorReport collects check results in sections, in the order they ran
+type doctorReport struct {
+    sections []string
+    results  map[string][]doctorResult
+}
+
+func newDoctorReport() *doctorReport {
+    return &doctorReport{results: make(map[string][]doctorResult)}
+}
+
+func (r *doctorReport) add(section string, result doctorResult) {
+    if _, ok := r.results[section]; !ok {
+        r.sections = append(r.sections, section)
+    }
+    r.results[section] = append(r.results[section], result)
+}
+
+func (r *doctorReport) ok(section, name, detail string) {
+    r.add(section, doctorResult{status: doctorOK, name: name, detail: detail})
+}
+
+func (r *doctorReport) warn(section, name, detail, fix string) {
+    r.add(section, doctorResult{status: doctorWarn, name: name, detail: detail, fix: fix})
+}
+
+func (r *doctorReport) fail(section, name, detail, fix string) {
+    r.add(section, doctorResult{status: doctorFail, name: name, detail: detail, fix: fix})
+}
+
+func (r *doctorReport) print() (warnings, failures int) {
+    for _, section := range r.sections {
+        fmt.Printf("\n%s\n", bold(section))
+        for _, res := range r.results[section] {
+            var mark string
+            switch res.status {
+            case doctorOK:
+                mark = green("✓")
+            case doctorWarn:
+                mark = yellow("!")
+                warnings++
+            default:
+                mark = red("✗")
+                failures++
+            }
+    
+            if res.detail != "" {
+                fmt.Printf("  %s %s: %s\n", mark, res.name, res.detail)
+            } else {
+                fmt.Printf("  %s %s\n", mark, res.name)
+            }
+            if res.fix != "" {
+                for _, line := range strings.Split(res.fix, "\n") {
+                    fmt.Printf("      %s %s\n", blue("→"), line)
+                }
+            }
+        }
+    }
+    return warnings, failures
+}
+
+func createDoctorCommand() *cobra.Command {
+    var fix bool
+    
+    cmd := &cobra.Command{
+        Use:   "doctor",
+        Short: "Diagnose the router installation",
+        Long: `Check the configuration, database schema, ARA realtime tables, the Asterisk
+side of the realtime setup (over AMI), the generated dialplan, AGI reachability
+and Redis, printing a fix for every problem found.
+
+With --fix, ARA rows that drifted from the providers are recreated, orphaned
+endpoints are removed and the dialplan is regenerated.`,
+        Example: `  router doctor
+  router doctor --fix`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            report := newDoctorReport()
+    
+            if err := loadConfig(); err != nil {
+                report.fail("Configuration", "Config file", err.Error(), "fix the YAML syntax in "+viper.ConfigFileUsed())
+                report.print()
+                return fmt.Errorf("doctor found problems")
+            }
+            checkDoctorConfig(report)
+    
+            if err := initializeForCLI(ctx); err != nil {
+                report.fail("Database", "Connection", err.Error(),
+                    "check database.host, database.port, database.username and that MySQL is running")
+                report.print()
+                return fmt.Errorf("doctor found problems")
+            }
+    
+            checkDoctorDatabase(ctx, report)
+            checkDoctorARA(ctx, report, fix)
+            checkDoctorConflicts(ctx, report)
+            checkDoctorAsterisk(ctx, report)
+            checkDoctorAGI(report)
+            checkDoctorRedis(ctx, report)
+    
+            warnings, failures := report.print()
+            fmt.Println()
+            if failures > 0 {
+                fmt.Printf("%s %d problems, %d warnings\n", red("✗"), failures, warnings)
+                return fmt.Errorf("doctor found %d problems", failures)
+            }
+            if warnings > 0 {
+                fmt.Printf("%s No problems, %d warnings\n", yellow("!"), warnings)
+                return nil
+            }
+            fmt.Printf("%s All checks passed\n", green("✓"))
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().BoolVar(&fix, "fix", false, "Repair ARA table and dialplan problems")
+    
+    return cmd
+}
+
+func checkDoctorConfig(report *doctorReport) {
+    const section = "Configuration"
+    
+    if used := viper.ConfigFileUsed(); used != "" {
+        report.ok(section, "Config file", used)
+    } else {
+        report.warn(section, "Config file", "none found, using defaults and environment",
+            "copy configs/production.yaml to ./configs or /etc/asterisk-router")
+    }
+    
+    for _, key := range []string{"database.host", "database.username", "database.database"} {
+        if viper.GetString(key) == "" {
+            report.fail(section, key, "not set", "set "+key)
+        }
+    }
+    
+    // The generated dialplan hardcodes the AGI address
+    agiPort := viper.GetInt("agi.port")
+    if u, err := url.Parse(ara.AGIBaseURL); err == nil && u.Port() != strconv.Itoa(agiPort) {
+        report.fail(section, "agi.port", fmt.Sprintf("%d, but the dialplan calls %s", agiPort, ara.AGIBaseURL),
+            "set agi.port: "+u.Port())
+    } else {
+        report.ok(section, "agi.port", strconv.Itoa(agiPort))
+    }
+    
+    for _, key := range []string{"router.did_allocation_timeout", "router.call_cleanup_interval", "router.stale_call_timeout"} {
+        if viper.GetDuration(key) <= 0 {
+            report.fail(section, key, "must be a positive duration", fmt.Sprintf("set %s, e.g. 5m", key))
+        }
+    }
+    
+    if viper.GetString("app.environment") == "production" {
+        if viper.GetBool("app.debug") {
+            report.warn(section, "app.debug", "enabled in production", "set app.debug: false")
+        }
+        if viper.GetBool("fault_injection.enabled") {
+            report.warn(section, "fault_injection.enabled", "set in production, faults stay inactive",
+                "set fault_injection.enabled: false")
+        }
+    }
+    
+    if viper.GetString("asterisk.ami.host") == "" {
+        report.warn(section, "asterisk.ami.host", "not set, reloads and Asterisk checks are unavailable",
+            "set asterisk.ami.host, port, username and password")
+    }
+    switch viper.GetString("asterisk.ami.host") {
+    case "", "localhost", "127.0.0.1", "::1":
+    default:
+        if !viper.GetBool("asterisk.ami.tls.enabled") {
+            report.warn(section, "asterisk.ami.tls", "disabled, the AMI password crosses the network in clear text",
+                "enable tlsenable in manager.conf and set asterisk.ami.tls.enabled: true")
+        }
+    }
+    if viper.GetBool("asterisk.ami.tls.enabled") && viper.GetBool("asterisk.ami.tls.insecure_skip_verify") {
+        report.warn(section, "asterisk.ami.tls.insecure_skip_verify", "the Asterisk certificate is not verified",
+            "set asterisk.ami.tls.ca_file to the CA that signed it")
+    }
+}
+
+func checkDoctorDatabase(ctx context.Context, report *doctorReport) {
+    const section = "Database"
+    
+    start := time.Now()
+    if err := database.PingContext(ctx); err != nil {
+        report.fail(section, "Connection", err.Error(), "check that MySQL is running and reachable")
+        return
+    }
+    report.ok(section, "Connection", fmt.Sprintf("%s, %s", viper.GetString("database.database"), time.Since(start).Round(time.Millisecond)))
+    
+    schema, err := db.CheckSchema(ctx, database.DB)
+    if err != nil {
+        report.fail(section, "Schema", err.Error(), "grant the router user SELECT on information_schema")
+        return
+    }
+    
+    version := "no migrations table"
+    if schema.MigrationVersion > 0 {
+        version = fmt.Sprintf("migration %d", schema.MigrationVersion)
+    }
+    if schema.UpToDate() {
+        report.ok(section, "Schema", "up to date, "+version)
+        if expected := db.SchemaFingerprint(); schema.Fingerprint != "" && schema.Fingerprint != expected {
+            report.warn(section, "Schema version", fmt.Sprintf("initialized as %s by %s, this build expects %s",
+                schema.Fingerprint, schema.RouterVersion, expected), "run 'router -init-db' (without -flush) with this build")
+        }
+        return
+    }
+    
+    const upgrade = "run 'router -init-db' (without -flush) to create and upgrade tables"
+    if schema.MigrationDirty {
+        report.fail(section, "Schema", version+" is dirty, a migration failed half way",
+            "repair the failed migration, then clear schema_migrations.dirty")
+    }
+    if len(schema.MissingTables) > 0 {
+        report.fail(section, "Missing tables", strings.Join(schema.MissingTables, ", "), upgrade)
+    }
+    if len(schema.MissingColumns) > 0 {
+        report.fail(section, "Missing columns", strings.Join(schema.MissingColumns, ", "), upgrade)
+    }
+    if len(schema.OutdatedColumns) > 0 {
+        report.fail(section, "Outdated columns", strings.Join(schema.OutdatedColumns, ", "), upgrade)
+    }
+    if len(schema.MissingIndexes) > 0 {
+        report.warn(section, "Missing indexes", strings.Join(schema.MissingIndexes, ", "), upgrade)
+    }
+    if len(schema.MissingProcedures) > 0 {
+        report.warn(section, "Missing procedures", strings.Join(schema.MissingProcedures, ", "), upgrade)
+    }
+    if len(schema.MissingViews) > 0 {
+        report.warn(section, "Missing views", strings.Join(schema.MissingViews, ", "), upgrade)
+    }
+}
+
+func checkDoctorARA(ctx context.Context, report *doctorReport, fix bool) {
+    const section = "ARA tables"
+    
+    issues, err := araManager.CheckConsistency(ctx)
+    if err != nil {
+        report.fail(section, "Consistency", err.Error(), "run 'router -init-db' to create the ARA tables")
+        return
+    }
+    if len(issues) == 0 {
+        report.ok(section, "Consistency", "providers, endpoints and dialplan match")
+        return
+    }
+    
+    if fix {
+        repairARA(ctx, report, issues)
+        return
+    }
+    
+    for _, issue := range issues {
+        name := issue.Object
+        if issue.Provider != "" {
+            name = fmt.Sprintf("%s (%s)", issue.Provider, issue.Object)
+        }
+    
+        switch issue.Kind {
+        case ara.IssueOrphanEndpoint:
+            report.warn(section, name, issue.Detail, "run 'router doctor --fix' to remove it")
+        case ara.IssueMissingDialplan:
+            report.fail(section, name, issue.Detail, "run 'router doctor --fix' to regenerate the dialplan")
+        default:
+            report.fail(section, name, issue.Detail, "run 'router doctor --fix' to recreate the provider's ARA rows")
+        }
+    }
+}
+
+// checkDoctorConflicts reports providers Asterisk can't tell apart by address
+func checkDoctorConflicts(ctx context.Context, report *doctorReport) {
+    const section = "ARA tables"
+    
+    conflicts, err := providerSvc.FindConflicts(ctx)
+    if err != nil {
+        report.fail(section, "Provider conflicts", err.Error(), "run 'router -init-db' to create the ARA tables")
+        return
+    }
+    if len(conflicts) == 0 {
+        report.ok(section, "Provider conflicts", "no two providers share an address")
+        return
+    }
+    
+    for _, c := range conflicts {
+        report.fail(section, c.Value, fmt.Sprintf("%s claimed by %s", formatConflictKind(c.Kind), strings.Join(c.Providers, ", ")),
+            "change the host or identify match of all but one of them, see 'router provider conflicts'")
+    }
+}
+
+// repairARA recreates what CheckConsistency found broken and reloads Asterisk
+func repairARA(ctx context.Context, report *doctorReport, issues []ara.ConsistencyIssue) {
+    const section = "ARA tables"
+    
+    repaired := make(map[string]bool)
+    dialplan, endpoints := false, false
+    for _, issue := range issues {
+        switch {
+        case issue.Kind == ara.IssueMissingDialplan:
+            if dialplan {
+                continue
+            }
+            dialplan = true
+            if err := araManager.CreateDialplan(ctx); err != nil {
+                report.fail(section, "Dialplan", err.Error(), "check the database error above")
+                continue
+            }
+            report.ok(section, "Dialplan", "regenerated")
+    
+        case repaired[issue.Provider]:
+    
+        case issue.Kind == ara.IssueOrphanEndpoint:
+            repaired[issue.Provider] = true
+            endpoints = true
+            if err := araManager.DeleteEndpoint(ctx, issue.Provider); err != nil {
+                report.fail(section, issue.Object, err.Error(), "delete it from ps_endpoints by hand")
+                continue
+            }
+            report.ok(section, issue.Object, "orphaned endpoint removed")
+    
+        default:
+            repaired[issue.Provider] = true
+            endpoints = true
+            p, err := providerSvc.GetProvider(ctx, issue.Provider)
+            if err == nil {
+                err = araManager.CreateEndpoint(ctx, p)
+            }
+            if err != nil {
+                report.fail(section, issue.Provider, err.Error(), "check the provider with 'router provider show "+issue.Provider+"'")
+                continue
+            }
+            report.ok(section, issue.Provider, "ARA rows recreated")
+        }
+    }
+    
+    if amiManager == nil || !amiManager.IsConnected() {
+        report.warn(section, "Reload", "AMI not connected", "run 'pjsip reload' and 'dialplan reload' in the Asterisk CLI")
+        return
+    }
+    if endpoints {
+        if err := amiManager.ReloadPJSIP(); err != nil {
+            report.warn(section, "PJSIP reload", err.Error(), "run 'pjsip reload' in the Asterisk CLI")
+        }
+    }
+    if dialplan {
+        if err := amiManager.ReloadDialplan(); err != nil {
+            report.warn(section, "Dialplan reload", err.Error(), "run 'dialplan reload' in the Asterisk CLI")
+        }
+    }
+}
+
+func checkDoctorAsterisk(ctx context.Context, report *doctorReport) {
+    const section = "Asterisk"
+    
+    if amiManager == nil {
+        report.warn(section, "AMI", "not configured, Asterisk checks skipped", "set asterisk.ami.host")
+        return
+    }
+    if !amiManager.IsConnected() || !amiManager.IsLoggedIn() {
+        report.fail(section, "AMI", fmt.Sprintf("cannot log in to %s:%d", viper.GetString("asterisk.ami.host"), viper.GetInt("asterisk.ami.port")),
+            "check asterisk.ami.username/password against manager.conf and that Asterisk is running")
+        return
+    }
+    report.ok(section, "AMI", fmt.Sprintf("logged in to %s:%d", viper.GetString("asterisk.ami.host"), viper.GetInt("asterisk.ami.port")))
+    
+    mappings, err := amiManager.Command("core show config mappings")
+    if err != nil {
+        report.fail(section, "Realtime mappings", err.Error(), "grant the AMI user the 'command' permission in manager.conf")
+        return
+    }
+    
+    var missing []string
+    for _, family := range realtimeFamilies {
+        if !strings.Contains(mappings, family) {
+            missing = append(missing, family)
+        }
+    }
+    if len(missing) > 0 {
+        var lines []string
+        for _, family := range missing {
+            lines = append(lines, fmt.Sprintf("%s => odbc,%s,%s", family, viper.GetString("asterisk.bootstrap.odbc_class"), family))
+        }
+        report.fail(section, "Realtime mappings", "missing "+strings.Join(missing, ", "),
+            "add to the [settings] section of extconfig.conf and restart Asterisk, or run 'router asterisk bootstrap':\n"+strings.Join(lines, "\n"))
+    } else {
+        report.ok(section, "Realtime mappings", strings.Join(realtimeFamilies, ", "))
+    }
+    
+    if strings.Contains(strings.ToLower(mappings), "odbc") {
+        out, err := amiManager.Command("odbc show")
+        switch {
+        case err != nil:
+            report.warn(section, "ODBC", err.Error(), "check that res_odbc is loaded: 'module load res_odbc.so'")
+        case !strings.Contains(out, "Connected: Yes"):
+            report.fail(section, "ODBC", "no connected ODBC class",
+                "check the DSN and credentials in res_odbc.conf and odbc.ini, then 'module reload res_odbc.so'")
+        default:
+            report.ok(section, "ODBC", "connected")
+        }
+    }
+    
+    // Asterisk must see the endpoints through sorcery, not just the mappings
+    var endpoint string
+    database.QueryRowContext(ctx, "SELECT id FROM ps_endpoints WHERE id LIKE 'endpoint-%' ORDER BY id LIMIT 1").Scan(&endpoint)
+    if endpoint != "" {
+        out, err := amiManager.Command("pjsip show endpoint " + endpoint)
+        if err != nil || strings.Contains(out, "Unable to find") {
+            report.fail(section, "PJSIP realtime", endpoint+" is not visible to Asterisk",
+                "map the objects to realtime in sorcery.conf [res_pjsip]:\nendpoint = realtime,ps_endpoints\nauth = realtime,ps_auths\naor = realtime,ps_aors")
+        } else {
+            report.ok(section, "PJSIP realtime", endpoint+" loaded")
+        }
+    }
+    
+    for _, context := range ara.DialplanContexts {
+        out, err := amiManager.Command("dialplan show " + context)
+        if err != nil {
+            report.warn(section, "Dialplan "+context, err.Error(), "")
+            continue
+        }
+        if strings.Contains(out, "no existence") {
+            report.fail(section, "Dialplan "+context, "context unknown to Asterisk",
+                fmt.Sprintf("add to extensions.conf, then 'dialplan reload':\n[%s]\nswitch => Realtime/%s@extensions", context, context))
+            continue
+        }
+        report.ok(section, "Dialplan "+context, "")
+    }
+}
+
+func checkDoctorAGI(report *doctorReport) {
+    const section = "AGI"
+    
+    host := viper.GetString("agi.listen_address")
+    if host == "" || host == "0.0.0.0" || host == "::" {
+        host = "127.0.0.1"
+    }
+    addr := net.JoinHostPort(host, strconv.Itoa(viper.GetInt("agi.port")))
+    
+    conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+    if err != nil {
+        report.fail(section, "Listener", fmt.Sprintf("nothing listening on %s", addr), "start the AGI server: router -agi")
+    } else {
+        conn.Close()
+        report.ok(section, "Listener", addr)
+    }
+    
+    // The dialplan reaches AGI on localhost, so Asterisk and the router share a host
+    switch amiHost := viper.GetString("asterisk.ami.host"); amiHost {
+    case "", "localhost", "127.0.0.1", "::1":
+        report.ok(section, "Reachable from Asterisk", ara.AGIBaseURL)
+    default:
+        report.warn(section, "Reachable from Asterisk", fmt.Sprintf("Asterisk runs on %s but the dialplan calls %s", amiHost, ara.AGIBaseURL),
+            "run the AGI server on the Asterisk host")
+    }
+}
+
+func checkDoctorRedis(ctx context.Context, report *doctorReport) {
+    const section = "Redis"
+    
+    latency, err := cache.Ping(ctx)
+    if err != nil {
+        report.warn(section, "Connection", err.Error(),
+            fmt.Sprintf("check redis.host/port (%s:%d) and that Redis is running; locks and shared caches are off without it",
+                viper.GetString("redis.host"), viper.GetInt("redis.port")))
+        return
+    }
+    report.ok(section, "Connection", fmt.Sprintf("%s:%d, %s", viper.GetString("redis.host"), viper.GetInt("redis.port"), latency.Round(time.Millisecond)))
+    
+    drifted, err := drift.Compare(ctx, cache, 3*driftConfig().Interval)
+    switch {
+    case err != nil:
+        report.warn(section, "Node drift", err.Error(), "")
+    case len(drifted.Nodes) == 0:
+        report.ok(section, "Node drift", "no router nodes publishing")
+    case drifted.ConfigDrift() || drifted.SchemaDrift():
+        report.warn(section, "Node drift",
+            fmt.Sprintf("%d config and %d schema variants across %d nodes", len(drifted.ConfigGroups), len(drifted.SchemaGroups), len(drifted.Nodes)),
+            "run 'router drift' and redeploy the nodes that differ")
+    default:
+        report.ok(section, "Node drift", fmt.Sprintf("%d nodes agree", len(drifted.Nodes)))
+    }
+}
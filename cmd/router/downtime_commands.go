@@ -0,0 +1,161 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createDowntimeCommand() *cobra.Command {
+    var (
+        filter     models.DowntimeFilter
+        period     string
+        outputJSON bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "downtime",
+        Short: "Show provider and system downtime with MTTR and MTBF",
+        Long: `Show provider and system downtime with MTTR and MTBF.
+
+A provider is down from the health check that marks it down to the one that
+marks it up again. The system is down while new calls are held back: while a
+global kill switch is engaged, or while a node pauses new calls for an
+Asterisk restart, recorded once the node resumes them. Downtime is cut to the
+period. Each provider down during the period is summarised by its failures,
+its MTTR (mean time down per failure) and its MTBF (mean time up between
+failures); SLA reports and scorecards carry the same figures.`,
+        Example: `  router downtime
+  router downtime --provider s1-provider1 --period 90d
+  router downtime --scope system --period 4w --json`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            length, err := parseScorecardPeriod(period)
+            if err != nil {
+                return err
+            }
+            if filter.Scope != "" && filter.Scope != models.DowntimeProvider && filter.Scope != models.DowntimeSystem {
+                return fmt.Errorf("invalid scope %q, expected provider or system", filter.Scope)
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            filter.Until = time.Now()
+            filter.Since = filter.Until.Add(-length)
+            list, err := routerSvc.ListDowntime(ctx, filter)
+            if err != nil {
+                return fmt.Errorf("failed to get downtime: %v", err)
+            }
+    
+            var reliability map[string]models.Reliability
+            if filter.Scope != models.DowntimeSystem {
+                reliability, err = routerSvc.ProviderReliability(ctx, filter.Since, filter.Until, filter.Provider)
+                if err != nil {
+                    return fmt.Errorf("failed to get provider reliability: %v", err)
+                }
+            }
+    
+            if outputJSON {
+                data, _ := json.MarshalIndent(map[string]interface{}{
+                    "since":       filter.Since,
+                    "until":       filter.Until,
+                    "downtime":    list,
+                    "reliability": reliability,
+                }, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+    
+            if len(list) == 0 {
+                fmt.Printf("No downtime since %s\n", filter.Since.Format("2006-01-02 15:04"))
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Scope", "Entity", "Cause", "Start", "End", "Duration", "Reason"})
+            table.SetBorder(false)
+    
+            for _, d := range list {
+                end := yellow("ongoing")
+                if d.End != nil {
+                    end = d.End.Format("2006-01-02 15:04:05")
+                }
+                table.Append([]string{
+                    d.Scope,
+                    orDash(d.Entity),
+                    d.Cause,
+                    d.Start.Format("2006-01-02 15:04:05"),
+                    end,
+                    (time.Duration(d.Seconds) * time.Second).String(),
+                    orDash(d.Reason),
+                })
+            }
+    
+            table.Render()
+    
+            if len(reliability) == 0 {
+                return nil
+            }
+    
+            names := make([]string, 0, len(reliability))
+            for name := range reliability {
+                names = append(names, name)
+            }
+            sort.Strings(names)
+    
+            fmt.Printf("\n%s\n", bold("Provider Reliability"))
+            summary := tablewriter.NewWriter(os.Stdout)
+            summary.SetHeader([]string{"Provider", "Failures", "Downtime", "MTTR", "MTBF"})
+            summary.SetBorder(false)
+    
+            for _, name := range names {
+                rel := reliability[name]
+                summary.Append([]string{
+                    name,
+                    strconv.Itoa(rel.Failures),
+                    (time.Duration(rel.DowntimeSeconds) * time.Second).String(),
+                    formatMeanSeconds(rel.MTTRSeconds),
+                    formatMeanSeconds(rel.MTBFSeconds),
+                })
+            }
+    
+            summary.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&filter.Provider, "provider", "", "Only this provider's downtime")
+    cmd.Flags().StringVar(&filter.Scope, "scope", "", "Only provider or system downtime")
+    cmd.Flags().StringVar(&period, "period", "30d", "Length of the period up to now, in days (90d), weeks (4w) or a duration (12h)")
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output as JSON")
+    
+    return cmd
+}
+
+// formatMeanSeconds shows an MTTR or MTBF, a dash for a period without failures
+func formatMeanSeconds(seconds *int64) string {
+    if seconds == nil {
+        return "-"
+    }
+    return (time.Duration(*seconds) * time.Second).String()
+}
+
+// formatOptionalSeconds writes an MTTR or MTBF to CSV, empty without failures
+func formatOptionalSeconds(seconds *int64) string {
+    if seconds == nil {
+        return ""
+    }
+    return strconv.FormatInt(*seconds, 10)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/drift"
+)
+
+func createDriftCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "drift",
+        Short: "Compare config and schema version across router nodes",
+        Long: `Compare config and schema version across router nodes.
+
+Every AGI server with cluster.drift.enabled publishes a hash of its effective
+configuration, the schema its build expects and the migration version of the
+database to Redis every cluster.drift.interval. Node specific settings listed
+in cluster.drift.ignore_keys are left out of the hash. Nodes that differ from
+the majority are highlighted; the AGI servers log an alert and set the
+router_config_drift gauge while they disagree.`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            config := driftConfig()
+            report, err := drift.Compare(ctx, cache, 3*config.Interval)
+            if err != nil {
+                return fmt.Errorf("failed to read node states: %v", err)
+            }
+    
+            local := nodeState(ctx)
+            fmt.Printf("This host: config %s, schema %s\n\n", local.ConfigHash, local.SchemaKey())
+    
+            if len(report.Nodes) == 0 {
+                fmt.Println("No router nodes are publishing their state")
+                return nil
+            }
+    
+            majorityConfig, majoritySchema := report.Majority()
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Node", "Config", "Schema", "Migration", "Up Since", "Last Seen"})
+            table.SetBorder(false)
+    
+            for _, n := range report.Nodes {
+                configHash := n.ConfigHash
+                if configHash != majorityConfig {
+                    configHash = red(configHash)
+                }
+                schemaHash := n.SchemaHash
+                migration := strconv.FormatUint(uint64(n.MigrationVersion), 10)
+                if n.SchemaKey() != majoritySchema {
+                    schemaHash = red(schemaHash)
+                    migration = red(migration)
+                }
+                table.Append([]string{
+                    n.Node,
+                    configHash,
+                    schemaHash,
+                    migration,
+                    n.StartedAt.Format("2006-01-02 15:04:05"),
+                    time.Since(n.PublishedAt).Round(time.Second).String() + " ago",
+                })
+            }
+    
+            table.Render()
+    
+            switch {
+            case report.ConfigDrift() && report.SchemaDrift():
+                fmt.Printf("\n%s Nodes disagree on config and schema version\n", red("✗"))
+            case report.ConfigDrift():
+                fmt.Printf("\n%s Nodes disagree on config\n", red("✗"))
+            case report.SchemaDrift():
+                fmt.Printf("\n%s Nodes disagree on schema version\n", red("✗"))
+            default:
+                fmt.Printf("\n%s %d nodes agree\n", green("✓"), len(report.Nodes))
+            }
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
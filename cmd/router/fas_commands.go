@@ -0,0 +1,116 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createFASCommands() *cobra.Command {
+    fasCmd := &cobra.Command{
+        Use:   "fas",
+        Short: "False answer supervision detection",
+        Long: `False answer supervision detection.
+
+Providers are scored 0-100 on the answered calls of router.fas.window: answers
+quicker than router.fas.fast_answer, calls shorter than router.fas.short_call and
+calls ending right at a router.fas.billing_increment. Providers with at least
+router.fas.min_calls answered calls and a score from router.fas.flag_score are
+flagged; with router.fas.reduce.enabled they keep router.fas.reduce.factor of
+their traffic until the score drops again.`,
+    }
+    
+    fasCmd.AddCommand(
+        createFASReportCommand(),
+        createFASEvaluateCommand(),
+    )
+    
+    return fasCmd
+}
+
+func createFASReportCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "report",
+        Short: "Show the last FAS scores",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            scores, err := routerSvc.GetFASScores(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to get FAS scores: %v", err)
+            }
+    
+            if len(scores) == 0 {
+                fmt.Println("No FAS scores yet")
+                return nil
+            }
+    
+            printFASScores(scores)
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createFASEvaluateCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "evaluate",
+        Short: "Recompute the FAS scores now",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            scores, err := routerSvc.EvaluateFAS(ctx, fasConfig())
+            if err != nil {
+                return fmt.Errorf("FAS evaluation failed: %v", err)
+            }
+    
+            if len(scores) == 0 {
+                fmt.Println("No answered calls in the detection window")
+                return nil
+            }
+    
+            printFASScores(scores)
+            return nil
+        },
+    }
+}
+
+func printFASScores(scores []*models.FASScore) {
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"Provider", "Answered", "Fast Answer", "Short", "At Increment", "Score", "Status"})
+    table.SetBorder(false)
+    
+    for _, s := range scores {
+        status := green("ok")
+        switch {
+        case s.Reduced:
+            status = red("flagged, reduced")
+        case s.Flagged:
+            status = red("flagged")
+        }
+        table.Append([]string{
+            s.ProviderName,
+            strconv.Itoa(s.AnsweredCalls),
+            fmt.Sprintf("%.1f%%", s.FastAnswerRatio*100),
+            fmt.Sprintf("%.1f%%", s.ShortCallRatio*100),
+            fmt.Sprintf("%.1f%%", s.IncrementRatio*100),
+            fmt.Sprintf("%.1f", s.Score),
+            status,
+        })
+    }
+    
+    table.Render()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "os"
+    "strings"
+    
+    "github.com/spf13/viper"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/db"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// guardFlush decides whether -init-db -flush goes ahead. It lists what would
+// be dropped, stops there with -dry-run, refuses production databases without
+// -force-production, has the operator type the database name and snapshots
+// the routing configuration before anything is dropped.
+func guardFlush(ctx context.Context) bool {
+    dbName := viper.GetString("database.database")
+    environment := viper.GetString("app.environment")
+    
+    tables, err := db.ListTables(ctx, database.DB)
+    if err != nil {
+        logger.Fatal("Failed to list tables", "error", err)
+    }
+    
+    fmt.Printf("\nFlushing drops every table of database %s (app.environment=%s):\n", dbName, environment)
+    var total int64
+    for _, t := range tables {
+        fmt.Printf("  %-32s ~%d rows\n", t.Name, t.Rows)
+        total += t.Rows
+    }
+    fmt.Printf("  %d tables, ~%d rows\n", len(tables), total)
+    
+    if dryRun {
+        fmt.Println("\nDry run, nothing was dropped")
+        return false
+    }
+    
+    if environment == "production" && !forceProd {
+        logger.Fatal("Refusing to flush a production database, pass -force-production if this is intended")
+    }
+    
+    fmt.Printf("\nWARNING: This will DELETE ALL existing data. Type the database name (%s) to continue: ", dbName)
+    response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+    if strings.TrimSpace(response) != dbName {
+        logger.Info("Database initialization cancelled")
+        return false
+    }
+    
+    if len(tables) == 0 {
+        return true
+    }
+    
+    // The schema is brought up to date first so every table the snapshot reads exists
+    if err := db.InitializeDatabase(ctx, database.DB, false); err != nil {
+        logger.Fatal("Failed to prepare the schema for the pre-flush snapshot, nothing was dropped", "error", err)
+    }
+    snap, err := routerSvc.GetBackups().Snapshot(ctx, models.BackupPreFlush, audit.CurrentUser())
+    if err != nil {
+        logger.Fatal("Failed to snapshot the routing configuration, nothing was dropped", "error", err)
+    }
+    
+    fmt.Printf("Routing configuration saved to %s\n", snap.Location)
+    fmt.Printf("Bring it back after the flush with: router restore --snapshot %s\n\n", snap.ID)
+    return true
+}
@@ -5,9 +5,10 @@ import (
     "encoding/json"
     "fmt"
     "os"
-//    "strings"
+    "strings"
     
     "github.com/spf13/cobra"
+    "github.com/spf13/viper"
     "github.com/olekukonko/tablewriter"
     "github.com/hamzaKhattat/ara-production-system/internal/models"
     "github.com/hamzaKhattat/ara-production-system/internal/provider"
@@ -24,15 +25,25 @@ func createGroupCommands() *cobra.Command {
         createGroupAddCommand(),
         createGroupListCommand(),
         createGroupShowCommand(),
+        createGroupMembersCommand(),
         createGroupDeleteCommand(),
         createGroupAddMemberCommand(),
         createGroupRemoveMemberCommand(),
+        createGroupAddSubgroupCommand(),
+        createGroupRemoveSubgroupCommand(),
         createGroupRefreshCommand(),
     )
     
     return groupCmd
 }
 
+// newGroupService creates the group service with the configured member limit
+func newGroupService() *provider.GroupService {
+    groupService := provider.NewGroupService(database.DB, cache)
+    groupService.SetMemberLimit(viper.GetInt("router.group_member_limit"))
+    return groupService
+}
+
 func createGroupAddCommand() *cobra.Command {
     var (
         description  string
@@ -43,6 +54,7 @@ func createGroupAddCommand() *cobra.Command {
         value        string
         providerType string
         priority     int
+        rules        []string
     )
     
     cmd := &cobra.Command{
@@ -56,7 +68,13 @@ func createGroupAddCommand() *cobra.Command {
   router group add panama --type metadata --field country --operator equals --value Panama
   
   # Create a group for providers in specific regions
-  router group add latam --type metadata --field region --operator in --value '["Central America","South America"]'`,
+  router group add latam --type metadata --field region --operator in --value '["Central America","South America"]'
+  
+  # Create a group from provider tags
+  router group add premium --type metadata --field tag.tier --operator equals --value premium
+    
+  # Create a dynamic group, providers must match every rule
+  router group add ve-premium --type dynamic --rule country:equals:Venezuela --rule tag.tier:in:'["gold","platinum"]'`,
         RunE: func(cmd *cobra.Command, args []string) error {
             ctx := context.Background()
             
@@ -64,7 +82,7 @@ func createGroupAddCommand() *cobra.Command {
                 return err
             }
             
-            groupService := provider.NewGroupService(database.DB, cache)
+            groupService := newGroupService()
             
             group := &models.ProviderGroup{
                 Name:        args[0],
@@ -88,14 +106,17 @@ func createGroupAddCommand() *cobra.Command {
                 }
                 group.MatchField = field
                 group.MatchOperator = models.MatchOperator(operator)
+                group.MatchValue, _ = json.Marshal(parseMatchValue(value))
                 
-                // Try to parse value as JSON first (for arrays)
-                var parsedValue interface{}
-                if err := json.Unmarshal([]byte(value), &parsedValue); err != nil {
-                    // If not valid JSON, use as string
-                    parsedValue = value
+            case models.GroupTypeDynamic:
+                if len(rules) == 0 {
+                    return fmt.Errorf("at least one --rule is required for dynamic groups")
                 }
-                group.MatchValue, _ = json.Marshal(parsedValue)
+                matchRules, err := parseMatchRules(rules)
+                if err != nil {
+                    return err
+                }
+                group.Metadata = models.JSON{"match_rules": matchRules}
             
             case models.GroupTypeManual:
                 // No additional fields needed
@@ -130,17 +151,64 @@ func createGroupAddCommand() *cobra.Command {
     }
     
     cmd.Flags().StringVarP(&description, "description", "d", "", "Group description")
-    cmd.Flags().StringVar(&groupType, "type", "manual", "Group type (manual/regex/metadata)")
+    cmd.Flags().StringVar(&groupType, "type", "manual", "Group type (manual/regex/metadata/dynamic)")
     cmd.Flags().StringVar(&pattern, "pattern", "", "Regex pattern for matching provider names")
-    cmd.Flags().StringVar(&field, "field", "", "Field to match (name/country/region/city/metadata.key)")
+    cmd.Flags().StringVar(&field, "field", "", "Field to match (name/country/region/city/metadata.key/tag.key)")
     cmd.Flags().StringVar(&operator, "operator", "equals", "Match operator (equals/contains/starts_with/ends_with/regex/in/not_in)")
     cmd.Flags().StringVar(&value, "value", "", "Value to match against")
     cmd.Flags().StringVar(&providerType, "provider-type", "", "Filter by provider type (inbound/intermediate/final)")
     cmd.Flags().IntVar(&priority, "priority", 10, "Group priority")
+    cmd.Flags().StringArrayVar(&rules, "rule", nil, "Dynamic group rule as field:operator:value, every rule must match (repeatable)")
     
     return cmd
 }
 
+// parseMatchValue reads a JSON array as a list of values, anything else as a string
+func parseMatchValue(value string) interface{} {
+    if strings.HasPrefix(strings.TrimSpace(value), "[") {
+        var values []interface{}
+        if err := json.Unmarshal([]byte(value), &values); err == nil {
+            return values
+        }
+    }
+    return value
+}
+
+// parseMatchRules reads dynamic group rules given as field:operator:value
+func parseMatchRules(rules []string) ([]interface{}, error) {
+    matchRules := make([]interface{}, 0, len(rules))
+    for _, rule := range rules {
+        parts := strings.SplitN(rule, ":", 3)
+        if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+            return nil, fmt.Errorf("invalid rule %q, expected field:operator:value", rule)
+        }
+        matchRules = append(matchRules, map[string]interface{}{
+            "field":    parts[0],
+            "operator": parts[1],
+            "value":    parseMatchValue(parts[2]),
+        })
+    }
+    return matchRules, nil
+}
+
+// formatMatchRules shows the rules of a dynamic group joined by AND
+func formatMatchRules(group *models.ProviderGroup) string {
+    rules, _ := group.Metadata["match_rules"].([]interface{})
+    var parts []string
+    for _, rule := range rules {
+        r, ok := rule.(map[string]interface{})
+        if !ok {
+            continue
+        }
+        value, _ := json.Marshal(r["value"])
+        parts = append(parts, fmt.Sprintf("%v %v %s", r["field"], r["operator"], value))
+    }
+    if len(parts) == 0 {
+        return "-"
+    }
+    return strings.Join(parts, " AND ")
+}
+
 func createGroupListCommand() *cobra.Command {
     var (
         groupType    string
@@ -158,7 +226,7 @@ func createGroupListCommand() *cobra.Command {
                 return err
             }
             
-            groupService := provider.NewGroupService(database.DB, cache)
+            groupService := newGroupService()
             
             filter := make(map[string]interface{})
             if groupType != "" {
@@ -189,6 +257,8 @@ func createGroupListCommand() *cobra.Command {
                     match = fmt.Sprintf("Pattern: %s", g.MatchPattern)
                 case models.GroupTypeMetadata:
                     match = fmt.Sprintf("%s %s %s", g.MatchField, g.MatchOperator, string(g.MatchValue))
+                case models.GroupTypeDynamic:
+                    match = formatMatchRules(g)
                 }
                 
                 status := green("Enabled")
@@ -234,6 +304,7 @@ func createGroupListCommand() *cobra.Command {
             
             return nil
         },
+        Annotations: changesNothing,
     }
     
     cmd.Flags().StringVar(&groupType, "type", "", "Filter by group type")
@@ -244,9 +315,12 @@ func createGroupListCommand() *cobra.Command {
 }
 
 func createGroupShowCommand() *cobra.Command {
-    return &cobra.Command{
+    var opts models.ListOptions
+    
+    cmd := &cobra.Command{
         Use:   "show <name>",
         Short: "Show detailed group information",
+        Long:  "Show a group and one page of its members, inactive members included.",
         Args:  cobra.ExactArgs(1),
         RunE: func(cmd *cobra.Command, args []string) error {
             ctx := context.Background()
@@ -255,7 +329,7 @@ func createGroupShowCommand() *cobra.Command {
                 return err
             }
             
-            groupService := provider.NewGroupService(database.DB, cache)
+            groupService := newGroupService()
             
             group, err := groupService.GetGroup(ctx, args[0])
             if err != nil {
@@ -276,6 +350,8 @@ func createGroupShowCommand() *cobra.Command {
                 fmt.Printf("Match Field:  %s\n", group.MatchField)
                 fmt.Printf("Operator:     %s\n", group.MatchOperator)
                 fmt.Printf("Value:        %s\n", string(group.MatchValue))
+            case models.GroupTypeDynamic:
+                fmt.Printf("Rules:        %s\n", formatMatchRules(group))
             }
             
             if group.ProviderType != "" && group.ProviderType != "any" {
@@ -285,12 +361,21 @@ func createGroupShowCommand() *cobra.Command {
             fmt.Printf("Priority:     %d\n", group.Priority)
             fmt.Printf("Status:       %s\n", formatBool(group.Enabled))
             fmt.Printf("Members:      %d\n", group.MemberCount)
+            if subgroups, err := groupService.GetSubgroups(ctx, args[0]); err == nil && len(subgroups) > 0 {
+                fmt.Printf("Subgroups:    %s\n", strings.Join(subgroups, ", "))
+                if resolved, err := groupService.GetGroupMembers(ctx, args[0]); err == nil {
+                    fmt.Printf("Resolved:     %d active providers, subgroups included\n", len(resolved))
+                }
+            }
+            if parents, err := groupService.GetParentGroups(ctx, args[0]); err == nil && len(parents) > 0 {
+                fmt.Printf("Nested In:    %s\n", strings.Join(parents, ", "))
+            }
             fmt.Printf("Created:      %s\n", group.CreatedAt.Format("2006-01-02 15:04:05"))
             fmt.Printf("Updated:      %s\n", group.UpdatedAt.Format("2006-01-02 15:04:05"))
             
-            // Show members
-            members, err := groupService.GetGroupMembers(ctx, args[0])
-            if err == nil && len(members) > 0 {
+            // Show members, large groups a page at a time
+            members, total, err := groupService.ListGroupMembersPage(ctx, args[0], opts)
+            if err == nil && total > 0 {
                 fmt.Printf("\n%s\n", bold("Group Members"))
                 
                 table := tablewriter.NewWriter(os.Stdout)
@@ -316,10 +401,75 @@ func createGroupShowCommand() *cobra.Command {
                 }
                 
                 table.Render()
+                printPageFooter(len(members), total, opts)
             }
             
             return nil
         },
+        Annotations: changesNothing,
+    }
+    
+    addListFlags(cmd, &opts, "name, type, priority, weight")
+    return cmd
+}
+
+func createGroupMembersCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "members <name>",
+        Short: "Show the providers a group resolves to",
+        Long: `Show the providers routes using the group select from: its active members
+and those of the groups nested in it, with the priority and weight overrides
+of the group applied, at most the group member limit of them. Use show for
+the group's own members, inactive ones included.`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            groupService := newGroupService()
+    
+            if _, err := groupService.GetGroup(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to get group: %v", err)
+            }
+            members, err := groupService.GetGroupMembers(ctx, args[0])
+            if err != nil {
+                return fmt.Errorf("failed to get group members: %v", err)
+            }
+    
+            if len(members) == 0 {
+                fmt.Printf("Group '%s' has no active providers\n", args[0])
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Provider", "Type", "Host", "Priority", "Weight", "Channels", "Status"})
+            table.SetBorder(false)
+    
+            for _, m := range members {
+                channels := fmt.Sprintf("%d/%d", m.CurrentChannels, m.MaxChannels)
+                if m.MaxChannels == 0 {
+                    channels = fmt.Sprintf("%d/∞", m.CurrentChannels)
+                }
+    
+                table.Append([]string{
+                    m.Name,
+                    string(m.Type),
+                    fmt.Sprintf("%s:%d", m.Host, m.Port),
+                    fmt.Sprintf("%d", m.Priority),
+                    fmt.Sprintf("%d", m.Weight),
+                    channels,
+                    formatStatus(m.Active, m.HealthStatus),
+                })
+            }
+    
+            table.Render()
+            fmt.Printf("\n%d providers\n", len(members))
+            return nil
+        },
+        Annotations: changesNothing,
     }
 }
 
@@ -335,7 +485,7 @@ func createGroupDeleteCommand() *cobra.Command {
                 return err
             }
             
-            groupService := provider.NewGroupService(database.DB, cache)
+            groupService := newGroupService()
             
             if err := groupService.DeleteGroup(ctx, args[0]); err != nil {
                 return fmt.Errorf("failed to delete group: %v", err)
@@ -356,7 +506,13 @@ func createGroupAddMemberCommand() *cobra.Command {
     cmd := &cobra.Command{
         Use:   "add-member <group> <provider>",
         Short: "Add a provider to a group",
-        Args:  cobra.ExactArgs(2),
+        Long: `Add a provider to a group, optionally with the priority and weight it has
+in the group instead of its own. Adding a provider already in the group
+replaces its overrides, those not given are cleared. Members added by hand
+stay in dynamic groups when they are refreshed.`,
+        Example: `  router group add-member latam s3-panama1
+  router group add-member latam s3-panama2 --priority 20 --weight 3`,
+        Args: cobra.ExactArgs(2),
         RunE: func(cmd *cobra.Command, args []string) error {
             ctx := context.Background()
             
@@ -364,7 +520,11 @@ func createGroupAddMemberCommand() *cobra.Command {
                 return err
             }
             
-            groupService := provider.NewGroupService(database.DB, cache)
+            groupService := newGroupService()
+    
+            if weight < 0 {
+                return fmt.Errorf("weight can't be negative")
+            }
             
             overrides := make(map[string]interface{})
             if cmd.Flags().Changed("priority") {
@@ -401,7 +561,7 @@ func createGroupRemoveMemberCommand() *cobra.Command {
                 return err
             }
             
-            groupService := provider.NewGroupService(database.DB, cache)
+            groupService := newGroupService()
             
             if err := groupService.RemoveProviderFromGroup(ctx, args[0], args[1]); err != nil {
                 return fmt.Errorf("failed to remove provider from group: %v", err)
@@ -413,19 +573,113 @@ func createGroupRemoveMemberCommand() *cobra.Command {
     }
 }
 
-func createGroupRefreshCommand() *cobra.Command {
+func createGroupAddSubgroupCommand() *cobra.Command {
     return &cobra.Command{
-        Use:   "refresh <name>",
+        Use:   "add-subgroup <group> <subgroup>",
+        Short: "Nest a group in another",
+        Long: `Nest a group in another. Routes using the group then select from its own
+providers and those of its subgroups, at any depth: regional groups such as
+us-east and us-west can make up a country group us. A provider in several of
+them takes the highest priority it is given. Nestings that would make a group
+contain itself are refused.`,
+        Example: `  router group add-subgroup us us-east
+  router group add-subgroup us us-west`,
+        Args: cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            groupService := newGroupService()
+    
+            if err := groupService.AddSubgroup(ctx, args[0], args[1]); err != nil {
+                return fmt.Errorf("failed to nest group: %v", err)
+            }
+    
+            fmt.Printf("%s Group '%s' nested in group '%s'\n", green("✓"), args[1], args[0])
+            if members, err := groupService.GetGroupMembers(ctx, args[0]); err == nil {
+                fmt.Printf("Group '%s' now resolves to %d active providers\n", args[0], len(members))
+            }
+            return nil
+        },
+    }
+}
+
+func createGroupRemoveSubgroupCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove-subgroup <group> <subgroup>",
+        Short: "Take a nested group out of a group",
+        Args:  cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            groupService := newGroupService()
+    
+            if err := groupService.RemoveSubgroup(ctx, args[0], args[1]); err != nil {
+                return fmt.Errorf("failed to remove nested group: %v", err)
+            }
+    
+            fmt.Printf("%s Group '%s' removed from group '%s'\n", green("✓"), args[1], args[0])
+            return nil
+        },
+    }
+}
+
+func createGroupRefreshCommand() *cobra.Command {
+    var all bool
+    
+    cmd := &cobra.Command{
+        Use:   "refresh [name]",
         Short: "Refresh dynamic group members",
-        Args:  cobra.ExactArgs(1),
+        Long: `Match the providers again against the rules of a regex, metadata or dynamic
+group, or of every one with --all. Members added by hand are kept.`,
+        Example: `  router group refresh panama
+  router group refresh --all`,
+        Args: cobra.MaximumNArgs(1),
         RunE: func(cmd *cobra.Command, args []string) error {
             ctx := context.Background()
+    
+            if all == (len(args) == 1) {
+                return fmt.Errorf("give a group or --all")
+            }
             
             if err := initializeForCLI(ctx); err != nil {
                 return err
             }
             
-            groupService := provider.NewGroupService(database.DB, cache)
+            groupService := newGroupService()
+    
+            if all {
+                groups, err := groupService.ListGroups(ctx, nil)
+                if err != nil {
+                    return fmt.Errorf("failed to list groups: %v", err)
+                }
+    
+                refreshed, failed := 0, 0
+                for _, g := range groups {
+                    if g.GroupType == models.GroupTypeManual {
+                        continue
+                    }
+                    if err := groupService.RefreshGroupMembers(ctx, g.Name); err != nil {
+                        fmt.Fprintf(os.Stderr, "%s Group '%s': %v\n", red("✗"), g.Name, err)
+                        failed++
+                        continue
+                    }
+                    refreshed++
+                }
+    
+                fmt.Printf("%s %d groups refreshed\n", green("✓"), refreshed)
+                if failed > 0 {
+                    return fmt.Errorf("failed to refresh %d groups", failed)
+                }
+                return nil
+            }
             
             if err := groupService.RefreshGroupMembers(ctx, args[0]); err != nil {
                 return fmt.Errorf("failed to refresh group: %v", err)
@@ -445,4 +699,8 @@ func createGroupRefreshCommand() *cobra.Command {
             return nil
         },
     }
+    
+    cmd.Flags().BoolVar(&all, "all", false, "Refresh every regex, metadata and dynamic group")
+    
+    return cmd
 }
@@ -0,0 +1,239 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+func createHolidayCommands() *cobra.Command {
+    holidayCmd := &cobra.Command{
+        Use:   "holiday",
+        Short: "Manage the public holiday calendar",
+        Long: `Manage the public holiday calendar.
+
+Holidays are kept per country (ISO 3166 alpha-2 code), added one by one or
+imported from an iCalendar file such as a public holiday feed. Time-based
+routing and business hours look them up, and daily statistics can leave them
+out so baselines are built from ordinary days:
+  router stats history --dimension country --exclude-holidays`,
+    }
+    
+    holidayCmd.AddCommand(
+        createHolidayAddCommand(),
+        createHolidayListCommand(),
+        createHolidayRemoveCommand(),
+        createHolidayImportCommand(),
+        createHolidayCheckCommand(),
+    )
+    
+    return holidayCmd
+}
+
+func createHolidayAddCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:     "add <country> <date> <name>",
+        Short:   "Add a holiday to a country, or rename it",
+        Example: `  router holiday add FR 2025-07-14 "Fête nationale"`,
+        Args:    cobra.ExactArgs(3),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            holiday := &models.Holiday{CountryCode: args[0], Date: args[1], Name: args[2]}
+            if err := routerSvc.AddHoliday(ctx, holiday, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to add holiday: %v", err)
+            }
+    
+            fmt.Printf("%s Holiday '%s' added to %s on %s\n", green("✓"), holiday.Name, holiday.CountryCode, holiday.Date)
+            return nil
+        },
+    }
+}
+
+func createHolidayListCommand() *cobra.Command {
+    var year int
+    
+    cmd := &cobra.Command{
+        Use:   "list [country]",
+        Short: "List holidays",
+        Args:  cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            country := ""
+            if len(args) > 0 {
+                country = args[0]
+            }
+    
+            holidays, err := routerSvc.ListHolidays(ctx, country, year)
+            if err != nil {
+                return fmt.Errorf("failed to list holidays: %v", err)
+            }
+    
+            if len(holidays) == 0 {
+                fmt.Println("No holidays found")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Date", "Day", "Country", "Name", "Source"})
+            table.SetBorder(false)
+    
+            for _, h := range holidays {
+                day := ""
+                if t, err := time.Parse(models.HolidayDateFormat, h.Date); err == nil {
+                    day = t.Weekday().String()[:3]
+                }
+                table.Append([]string{h.Date, day, h.CountryCode, h.Name, h.Source})
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().IntVar(&year, "year", time.Now().Year(), "Year to list, 0 for every year")
+    
+    return cmd
+}
+
+func createHolidayRemoveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove <country> <date>",
+        Short: "Remove a holiday from a country",
+        Args:  cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteHoliday(ctx, args[0], args[1], audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove holiday: %v", err)
+            }
+    
+            fmt.Printf("%s Holiday on %s removed from %s\n", green("✓"), args[1], strings.ToUpper(args[0]))
+            return nil
+        },
+    }
+}
+
+func createHolidayImportCommand() *cobra.Command {
+    var (
+        replace bool
+        dryRun  bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "import <country> <file.ics>",
+        Short: "Import the holidays of a country from an iCalendar file",
+        Long: `Import the holidays of a country from an iCalendar file (- for stdin).
+
+Every day an event covers becomes a holiday named after its summary. Yearly
+recurring events on a fixed date are expanded; holidays added by hand are kept
+on their dates. With --replace the holidays of earlier imports are removed
+first, so a feed can be re-imported as it changes.`,
+        Example: `  router holiday import DE de-holidays.ics --replace
+  curl -s https://example.com/us-holidays.ics | router holiday import US -`,
+        Args: cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            in := os.Stdin
+            if args[1] != "-" {
+                f, err := os.Open(args[1])
+                if err != nil {
+                    return fmt.Errorf("failed to open calendar: %v", err)
+                }
+                defer f.Close()
+                in = f
+            }
+    
+            holidays, err := router.ParseHolidayCalendar(in)
+            if err != nil {
+                return fmt.Errorf("failed to read calendar: %v", err)
+            }
+    
+            if dryRun {
+                table := tablewriter.NewWriter(os.Stdout)
+                table.SetHeader([]string{"Date", "Name"})
+                table.SetBorder(false)
+                for _, h := range holidays {
+                    table.Append([]string{h.Date, h.Name})
+                }
+                table.Render()
+                fmt.Printf("\n%d holidays would be imported to %s\n", len(holidays), strings.ToUpper(args[0]))
+                return nil
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            count, err := routerSvc.ImportHolidays(ctx, args[0], holidays, replace, audit.CurrentUser())
+            if err != nil {
+                return fmt.Errorf("failed to import holidays: %v", err)
+            }
+    
+            fmt.Printf("%s %d holidays imported to %s\n", green("✓"), count, strings.ToUpper(args[0]))
+            return nil
+        },
+    }
+    
+    cmd.Flags().BoolVar(&replace, "replace", false, "Remove the holidays of earlier imports first")
+    cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the holidays read from the file without importing them")
+    
+    return cmd
+}
+
+func createHolidayCheckCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "check <country> [date]",
+        Short: "Tell whether a day is a holiday of a country",
+        Args:  cobra.RangeArgs(1, 2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            day := time.Now()
+            if len(args) > 1 {
+                parsed, err := time.Parse(models.HolidayDateFormat, args[1])
+                if err != nil {
+                    return fmt.Errorf("invalid date, expected YYYY-MM-DD")
+                }
+                day = parsed
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            date := day.Format(models.HolidayDateFormat)
+            country := strings.ToUpper(args[0])
+            if h := routerSvc.HolidayOn(ctx, country, day); h != nil {
+                fmt.Printf("%s %s is a holiday in %s: %s\n", yellow("!"), date, country, h.Name)
+                return nil
+            }
+            fmt.Printf("%s %s is not a holiday in %s\n", green("✓"), date, country)
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
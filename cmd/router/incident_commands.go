@@ -0,0 +1,227 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createIncidentCommands() *cobra.Command {
+    incidentCmd := &cobra.Command{
+        Use:   "incidents",
+        Short: "Show alerts grouped into incidents",
+        Long: `Show alerts grouped into incidents.
+
+Alerts of one kind, such as providers going down, raised while any of them
+still fires are grouped into one incident from the first alert until the last
+is resolved. Only opening and resolving an incident is notified, as an ALERT
+log and to router.alerts.webhook_url: a provider flapping or a carrier outage
+taking down many providers at once makes one notification, not one per failed
+health check. An incident resolved less than router.alerts.reopen_window ago
+is reopened rather than a new one started.`,
+    }
+    
+    incidentCmd.AddCommand(
+        createIncidentListCommand(),
+        createIncidentShowCommand(),
+        createIncidentResolveCommand(),
+    )
+    
+    return incidentCmd
+}
+
+func createIncidentListCommand() *cobra.Command {
+    var (
+        filter     models.IncidentFilter
+        since      time.Duration
+        outputJSON bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "list",
+        Short: "List incidents, newest first",
+        Example: `  router incidents list --open
+  router incidents list --kind provider_down --since 168h`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if since > 0 {
+                filter.Since = time.Now().Add(-since)
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            incidents, err := routerSvc.GetAlerts().List(ctx, filter)
+            if err != nil {
+                return fmt.Errorf("failed to list incidents: %v", err)
+            }
+    
+            if outputJSON {
+                data, _ := json.MarshalIndent(incidents, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+    
+            if len(incidents) == 0 {
+                fmt.Println("No incidents")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"ID", "Incident", "Severity", "Alerts", "Started", "Duration", "Status"})
+            table.SetBorder(false)
+    
+            now := time.Now()
+            for _, i := range incidents {
+                table.Append([]string{
+                    strconv.FormatInt(i.ID, 10),
+                    i.Title,
+                    colorSeverity(i.Severity),
+                    strconv.Itoa(i.AlertCount),
+                    i.StartedAt.Local().Format("2006-01-02 15:04:05"),
+                    i.Duration(now).Round(time.Second).String(),
+                    formatIncidentStatus(i),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&filter.Kind, "kind", "", "Only show incidents of one alert kind")
+    cmd.Flags().BoolVar(&filter.OpenOnly, "open", false, "Only show incidents still going on")
+    cmd.Flags().DurationVar(&since, "since", 0, "Only show incidents started this recently")
+    cmd.Flags().IntVar(&filter.Limit, "limit", 50, "Maximum number of incidents")
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output as JSON")
+    
+    return cmd
+}
+
+func createIncidentShowCommand() *cobra.Command {
+    var outputJSON bool
+    
+    cmd := &cobra.Command{
+        Use:   "show <id>",
+        Short: "Show an incident and its alerts",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            id, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil {
+                return fmt.Errorf("invalid incident id: %s", args[0])
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            incident, err := routerSvc.GetAlerts().Get(ctx, id)
+            if err != nil {
+                return fmt.Errorf("failed to get incident: %v", err)
+            }
+    
+            if outputJSON {
+                data, _ := json.MarshalIndent(incident, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+    
+            fmt.Printf("%s %d: %s\n", bold("Incident"), incident.ID, incident.Title)
+            fmt.Printf("Severity: %s\n", colorSeverity(incident.Severity))
+            fmt.Printf("Status:   %s\n", formatIncidentStatus(incident))
+            fmt.Printf("Started:  %s\n", incident.StartedAt.Local().Format("2006-01-02 15:04:05"))
+            if incident.ResolvedAt != nil {
+                fmt.Printf("Resolved: %s by %s\n", incident.ResolvedAt.Local().Format("2006-01-02 15:04:05"),
+                    orDash(incident.ResolvedBy))
+            }
+            fmt.Printf("Duration: %s\n", incident.Duration(time.Now()).Round(time.Second))
+            fmt.Printf("Alerts:   %d raised, %d distinct\n\n", incident.AlertCount, len(incident.Alerts))
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Entity", "Severity", "Count", "First Seen", "Last Seen", "Resolved", "Message"})
+            table.SetBorder(false)
+            table.SetAutoWrapText(false)
+    
+            for _, a := range incident.Alerts {
+                resolved := red("firing")
+                if a.ResolvedAt != nil {
+                    resolved = a.ResolvedAt.Local().Format("15:04:05")
+                }
+                table.Append([]string{
+                    a.Entity,
+                    colorSeverity(a.Severity),
+                    strconv.Itoa(a.Count),
+                    a.FirstSeen.Local().Format("2006-01-02 15:04:05"),
+                    a.LastSeen.Local().Format("15:04:05"),
+                    resolved,
+                    orDash(a.Message),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output as JSON")
+    
+    return cmd
+}
+
+func createIncidentResolveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "resolve <id>",
+        Short: "Resolve an open incident and its alerts",
+        Long: `Resolve an open incident and its alerts, when their conditions ended without
+being seen to. Alerts raised again after open a new incident, or reopen this
+one within router.alerts.reopen_window.`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            id, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil {
+                return fmt.Errorf("invalid incident id: %s", args[0])
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.GetAlerts().ResolveIncident(ctx, id, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to resolve incident: %v", err)
+            }
+    
+            fmt.Printf("%s Incident %d resolved\n", green("✓"), id)
+            return nil
+        },
+    }
+}
+
+func formatIncidentStatus(i *models.Incident) string {
+    if i.Open() {
+        return red("open")
+    }
+    return green("resolved")
+}
+
+func colorSeverity(severity string) string {
+    if severity == models.AlertCritical {
+        return red(severity)
+    }
+    return yellow(severity)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createKillSwitchCommands() *cobra.Command {
+    killCmd := &cobra.Command{
+        Use:   "kill-switch",
+        Short: "Emergency stop of new inbound calls",
+        Long: `Emergency stop of new inbound calls.
+
+An engaged kill switch rejects every new call globally, from one customer
+(inbound provider) or on one route; calls already up continue until they hang
+up. AGI servers pick up switches within router.kill_switch.refresh_interval.
+Engaged switches show in 'router monitor' and at /health/kill-switch, every
+change is written to the audit log.`,
+    }
+    
+    killCmd.AddCommand(
+        createKillSwitchEngageCommand(),
+        createKillSwitchStatusCommand(),
+        createKillSwitchReleaseCommand(),
+    )
+    
+    return killCmd
+}
+
+func createKillSwitchEngageCommand() *cobra.Command {
+    var (
+        customer string
+        route    string
+        reason   string
+        duration time.Duration
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "engage",
+        Short: "Stop new calls",
+        Example: `  # Everything, during a fraud event
+  router kill-switch engage --reason "fraud on VE routes"
+  
+  # One customer for the length of a carrier dispute
+  router kill-switch engage --customer s1-acme --for 4h --reason "carrier dispute"`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if customer != "" && route != "" {
+                return fmt.Errorf("--customer and --route can't be combined")
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            k := &models.KillSwitch{
+                Scope:     models.BlockScopeGlobal,
+                Reason:    reason,
+                EngagedBy: audit.CurrentUser(),
+            }
+            if customer != "" {
+                k.Scope = models.BlockScopeCustomer
+                k.ScopeValue = customer
+            }
+            if route != "" {
+                k.Scope = models.BlockScopeRoute
+                k.ScopeValue = route
+            }
+            if duration > 0 {
+                expires := time.Now().Add(duration)
+                k.ExpiresAt = &expires
+            }
+    
+            if err := routerSvc.GetKillSwitches().Engage(ctx, k); err != nil {
+                return fmt.Errorf("failed to engage kill switch: %v", err)
+            }
+    
+            fmt.Printf("%s Kill switch %d engaged for %s, new calls are rejected\n", red("■"), k.ID, formatKillSwitchScope(k))
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&customer, "customer", "", "Only stop calls from this inbound provider")
+    cmd.Flags().StringVar(&route, "route", "", "Only stop calls on this route")
+    cmd.Flags().StringVar(&reason, "reason", "", "Why new calls are stopped (required)")
+    cmd.Flags().DurationVar(&duration, "for", 0, "Release automatically after this long (default until released)")
+    
+    return cmd
+}
+
+func createKillSwitchStatusCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "status",
+        Short: "Show the kill switches",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            switches, err := routerSvc.GetKillSwitches().List(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to list kill switches: %v", err)
+            }
+    
+            if len(switches) == 0 {
+                fmt.Printf("%s No kill switch engaged\n", green("✓"))
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"ID", "Scope", "Status", "Reason", "Engaged By", "Engaged At"})
+            table.SetBorder(false)
+    
+            now := time.Now()
+            for _, k := range switches {
+                status := red("engaged")
+                switch {
+                case !k.Active(now):
+                    status = "expired"
+                case k.ExpiresAt != nil:
+                    status = red("engaged until " + k.ExpiresAt.Format("2006-01-02 15:04"))
+                }
+                table.Append([]string{
+                    strconv.FormatInt(k.ID, 10),
+                    formatKillSwitchScope(k),
+                    status,
+                    k.Reason,
+                    k.EngagedBy,
+                    k.EngagedAt.Format("2006-01-02 15:04:05"),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createKillSwitchReleaseCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "release <id>",
+        Short: "Let new calls in again",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            id, err := strconv.ParseInt(args[0], 10, 64)
+            if err != nil {
+                return fmt.Errorf("invalid kill switch id: %s", args[0])
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.GetKillSwitches().Release(ctx, id, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to release kill switch: %v", err)
+            }
+    
+            fmt.Printf("%s Kill switch %d released\n", green("✓"), id)
+            return nil
+        },
+    }
+}
+
+func formatKillSwitchScope(k *models.KillSwitch) string {
+    if k.Scope == models.BlockScopeGlobal {
+        return "all calls"
+    }
+    return fmt.Sprintf("%s:%s", k.Scope, k.ScopeValue)
+}
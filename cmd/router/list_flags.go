@@ -0,0 +1,32 @@
+package main
+
+import (
+    "fmt"
+    
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// addListFlags registers the paging and sorting flags shared by list commands
+func addListFlags(cmd *cobra.Command, opts *models.ListOptions, sortKeys string) {
+    cmd.Flags().IntVar(&opts.Limit, "limit", models.DefaultListLimit, fmt.Sprintf("Maximum rows to show (max %d)", models.MaxListLimit))
+    cmd.Flags().IntVar(&opts.Offset, "offset", 0, "Number of rows to skip")
+    cmd.Flags().StringVar(&opts.Sort, "sort", "", "Sort by: "+sortKeys)
+    cmd.Flags().BoolVar(&opts.Desc, "desc", false, "Sort in descending order")
+}
+
+// printPageFooter tells the user which slice of the result set is shown
+func printPageFooter(shown int, total int64, opts models.ListOptions) {
+    opts = opts.Normalize()
+    if shown == 0 {
+        fmt.Printf("\nNo rows at offset %d (total %d)\n", opts.Offset, total)
+        return
+    }
+    
+    fmt.Printf("\nShowing %d-%d of %d", opts.Offset+1, opts.Offset+shown, total)
+    if int64(opts.Offset+shown) < total {
+        fmt.Printf(" (use --offset %d for more)", opts.Offset+shown)
+    }
+    fmt.Println()
+}
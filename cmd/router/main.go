@@ -6,15 +6,20 @@ import (
     "fmt"
     "os"
     "os/signal"
+    "strconv"
     "syscall"
+    "time"
     
     "github.com/spf13/cobra"
     "github.com/spf13/viper"
     "github.com/hamzaKhattat/ara-production-system/internal/agi"
+    "github.com/hamzaKhattat/ara-production-system/internal/api"
     "github.com/hamzaKhattat/ara-production-system/internal/ami"
     "github.com/hamzaKhattat/ara-production-system/internal/ara"
     "github.com/hamzaKhattat/ara-production-system/internal/db"
+    "github.com/hamzaKhattat/ara-production-system/internal/drift"
     "github.com/hamzaKhattat/ara-production-system/internal/health"
+    "github.com/hamzaKhattat/ara-production-system/internal/i18n"
     "github.com/hamzaKhattat/ara-production-system/internal/metrics"
     "github.com/hamzaKhattat/ara-production-system/internal/provider"
     "github.com/hamzaKhattat/ara-production-system/internal/router"
@@ -25,9 +30,14 @@ var (
     configFile string
     initDB     bool
     flushDB    bool
+    dryRun     bool
+    forceProd  bool
     agiMode    bool
     verbose    bool
     
+    waitForDeps bool
+    waitTimeout time.Duration
+    
     // Global services - these are shared with commands.go
     database     *db.DB
     cache        *db.Cache
@@ -38,6 +48,7 @@ var (
     agiServer    *agi.Server
     healthSvc    *health.HealthService
     metricsSvc   *metrics.PrometheusMetrics
+    apiServer    *api.Server
 )
 
 func main() {
@@ -45,8 +56,12 @@ func main() {
     flag.StringVar(&configFile, "config", "", "Configuration file path")
     flag.BoolVar(&initDB, "init-db", false, "Initialize database (WARNING: Drops existing data if --flush is used)")
     flag.BoolVar(&flushDB, "flush", false, "Flush existing database before initialization")
+    flag.BoolVar(&dryRun, "dry-run", false, "With -flush, list the tables that would be dropped and stop")
+    flag.BoolVar(&forceProd, "force-production", false, "Allow -flush when app.environment is production")
     flag.BoolVar(&agiMode, "agi", false, "Run AGI server")
     flag.BoolVar(&verbose, "verbose", false, "Enable verbose logging")
+    flag.BoolVar(&waitForDeps, "wait-for-deps", false, "Wait for the database, and Redis and AMI unless optional, before starting")
+    flag.DurationVar(&waitTimeout, "wait-timeout", 0, "How long -wait-for-deps waits (default startup.wait_timeout)")
     flag.Parse()
     
     // If flags are set, run in server mode
@@ -86,28 +101,51 @@ func runServerMode() {
     if verbose {
         logConfig.Level = "debug"
     }
+    configureMasking(&logConfig)
     
     if err := logger.Init(logConfig); err != nil {
         fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
         os.Exit(1)
     }
     
+    // Fault injection must be configured before connections are opened
+    if agiMode {
+        if err := initializeFaults(); err != nil {
+            logger.WithError(err).Warn("Fault injection disabled")
+        }
+    }
+    
+    // Wait for dependencies if asked to, checked against their policy once connected
+    finishPreflight := runPreflight(ctx)
+    
     // Initialize database connection
     if err := initializeDatabase(ctx); err != nil {
         logger.Fatal("Failed to initialize database", "error", err)
     }
+    finishPreflight()
+    
+    // Refuse to serve on a schema this build can't use
+    if agiMode && !initDB && viper.GetBool("database.schema_check.enabled") {
+        verifySchema(ctx)
+    }
+    
+    // Pick up health policy edits from the config file while serving
+    if agiMode {
+        watchConfig()
+    }
     
     // Initialize database schema if requested
     if initDB {
         logger.Info("Initializing database schema")
         
+        // A new database has no read_only_mode table yet, nothing is frozen then
+        if mode, err := routerSvc.ReadOnlyMode(ctx); err == nil && mode.Enabled {
+            logger.Fatal("Management plane is read-only, not initializing the database")
+        }
+    
         if flushDB {
             logger.Warn("FLUSH mode enabled - All existing data will be deleted!")
-            fmt.Print("\nWARNING: This will DELETE ALL existing data. Continue? [y/N]: ")
-            var response string
-            fmt.Scanln(&response)
-            if response != "y" && response != "Y" {
-                logger.Info("Database initialization cancelled")
+            if !guardFlush(ctx) {
                 return
             }
         }
@@ -147,15 +185,38 @@ func runServerMode() {
     fmt.Println("  router -agi              # Run AGI server")
     fmt.Println("  router -init-db          # Initialize database")
     fmt.Println("  router -init-db -flush   # Flush and reinitialize database")
+    fmt.Println("  router -init-db -flush -dry-run  # Show what a flush would drop")
+    fmt.Println("  router -agi -wait-for-deps -wait-timeout 2m  # Wait for MySQL, Redis and AMI first")
     fmt.Println("")
     fmt.Println("Run 'router --help' for more information")
 }
 
 func runCLI() {
+    rootCmd := newRootCommand()
+    
+    // Ctrl+C cancels the command context so long operations can stop cleanly
+    ctx, stop := signalContext()
+    defer stop()
+    
+    if err := rootCmd.ExecuteContext(ctx); err != nil {
+        lang := i18n.Default()
+        fmt.Fprintf(os.Stderr, "%s: %s\n", i18n.T(lang, "Error"), i18n.T(lang, err.Error()))
+        os.Exit(1)
+    }
+}
+
+// newRootCommand builds the command tree of the CLI
+func newRootCommand() *cobra.Command {
     rootCmd := &cobra.Command{
         Use:   "router",
         Short: "Asterisk ARA Dynamic Call Router",
         Long:  "Production-level dynamic call routing system with full ARA integration",
+        // Printed below in the configured language
+        SilenceErrors: true,
+        // Commands are checked against read-only mode by their annotation
+        PersistentPreRun: func(cmd *cobra.Command, args []string) {
+            cliReadOnly = cmd.Annotations[readOnlyAnnotation] != ""
+        },
     }
     
     // Add commands
@@ -168,12 +229,31 @@ func runCLI() {
         createLoadBalancerCommand(),
         createCallsCommand(),
         createMonitorCommand(),
+        createVerificationCommands(),
+        createBlockCommands(),
+        createKillSwitchCommands(),
+        createIncidentCommands(),
+        createDowntimeCommand(),
+        createRateLimitCommands(),
+        createRateCommands(),
+        createAPITokenCommands(),
+        createCDRExportCommands(),
+        createBackupCommands(),
+        createRestoreCommand(),
+        createCacheCommands(),
+        createDeviceStateCommands(),
+        createDoctorCommand(),
+        createAsteriskCommands(),
+        createSyntheticCommands(),
+        createFASCommands(),
+        createDispositionCommands(),
+        createHolidayCommands(),
+        createDriftCommand(),
+        createReadOnlyCommands(),
+        createVersionCommand(),
     )
     
-    if err := rootCmd.Execute(); err != nil {
-        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-        os.Exit(1)
-    }
+    return rootCmd
 }
 
 func runAGIServer(ctx context.Context) {
@@ -188,9 +268,29 @@ func runAGIServer(ctx context.Context) {
         WriteTimeout:    viper.GetDuration("agi.write_timeout"),
         IdleTimeout:     viper.GetDuration("agi.idle_timeout"),
         ShutdownTimeout: viper.GetDuration("agi.shutdown_timeout"),
+        MaxHeaders:      viper.GetInt("agi.max_headers"),
+        MaxHeaderLine:   viper.GetInt("agi.max_header_line"),
+        MaxHeaderBytes:  viper.GetInt("agi.max_header_bytes"),
     }
     
     agiServer = agi.NewServer(routerSvc, agiConfig, metricsSvc)
+    agiServer.EnableAffinity(agi.AffinityConfig{
+        Enabled:          viper.GetBool("agi.affinity.enabled"),
+        AdvertiseAddress: viper.GetString("agi.affinity.advertise_address"),
+        TTL:              viper.GetDuration("agi.affinity.ttl"),
+        DialTimeout:      viper.GetDuration("agi.affinity.dial_timeout"),
+    }, cache)
+    
+    // Take back the calls a previous run left up before new sessions arrive
+    if viper.GetBool("router.recovery.enabled") {
+        var asterisk router.AsteriskCommander
+        if amiManager != nil && amiManager.IsLoggedIn() {
+            asterisk = amiManager
+        }
+        if _, err := routerSvc.RecoverCalls(ctx, asterisk); err != nil {
+            logger.WithError(err).Error("Failed to recover active calls")
+        }
+    }
     
     // Handle shutdown
     sigChan := make(chan os.Signal, 1)
@@ -202,6 +302,124 @@ func runAGIServer(ctx context.Context) {
         }
     }()
     
+    // Start API server
+    if viper.GetBool("security.api.enabled") {
+        apiServer = api.NewServer(api.Config{
+            Port:         viper.GetInt("security.api.port"),
+            AuthToken:    viper.GetString("security.api.auth_token"),
+            OperatorPII:  viper.GetBool("security.masking.operator_pii"),
+            ReadTimeout:  viper.GetDuration("security.api.read_timeout"),
+            WriteTimeout: viper.GetDuration("security.api.write_timeout"),
+        }, routerSvc, providerSvc)
+        if amiManager != nil {
+            apiServer.EnableOriginate(amiManager)
+        }
+        
+        go func() {
+            if err := apiServer.Start(); err != nil {
+                logger.WithError(err).Error("API server failed")
+            }
+        }()
+    }
+    
+    // Drop previous provider passwords once their rotation overlap has passed
+    go providerSvc.RunCredentialExpiry(ctx, viper.GetDuration("security.credential_rotation.check_interval"))
+    
+    // Skip providers that stop answering SIP OPTIONS before calls to them fail
+    if hcConfig := optionsProbeConfig(); hcConfig.Enabled {
+        go router.NewOptionsProber(routerSvc, hcConfig).Run(ctx)
+    }
+    
+    // Mirror provider health into Asterisk device states for BLF hints
+    if dsConfig := deviceStateConfig(); dsConfig.Enabled && amiManager != nil {
+        go router.NewDeviceStatePublisher(routerSvc, amiManager, dsConfig).Run(ctx)
+    }
+    
+    // Hold new calls after an Asterisk restart until it has loaded ARA
+    if rConfig := restartConfig(); rConfig.Enabled && amiManager != nil {
+        coordinator := router.NewRestartCoordinator(routerSvc, amiManager, rConfig)
+        amiManager.RegisterEventHandler("FullyBooted", func(event ami.Event) {
+            coordinator.HandleFullyBooted(ctx, event.Time(), event["Uptime"])
+        })
+    }
+    
+    // Close calls whose inbound channel hung up without the AGI hangup hook
+    if viper.GetBool("router.abandoned.enabled") && amiManager != nil {
+        amiManager.RegisterEventHandler("Hangup", func(event ami.Event) {
+            // Only the originating channel carries the call ID, dialed legs link to it
+            if event["Uniqueid"] == "" || event["Uniqueid"] != event["Linkedid"] {
+                return
+            }
+            cause, _ := strconv.Atoi(event["Cause"])
+            routerSvc.ProcessChannelHangup(ctx, event["Uniqueid"], cause, event.Time())
+        })
+    }
+    
+    // Drop cached routes and providers as soon as any node changes them
+    go cache.SubscribeInvalidations(ctx)
+    
+    // Keep daily aggregates for trend analysis after raw call records are pruned
+    if ssConfig := statsSnapshotConfig(); ssConfig.Enabled {
+        go routerSvc.RunStatsSnapshots(ctx, ssConfig)
+    }
+    
+    // Deliver scheduled customer CDR exports
+    if viper.GetBool("router.cdr_export.enabled") {
+        go routerSvc.GetCDRExports().RunSchedule(ctx)
+    }
+    
+    // Order DIDs for pools below their watermark
+    if viper.GetBool("router.did_procurement.enabled") {
+        go routerSvc.GetDIDProcurement().RunChecks(ctx)
+    }
+    
+    // Snapshot the routing configuration
+    if viper.GetBool("router.backup.enabled") {
+        go routerSvc.GetBackups().RunSchedule(ctx)
+    }
+    
+    // Track provider usage against contract commitments
+    if viper.GetBool("router.contracts.enabled") {
+        go routerSvc.RunContractChecks(ctx)
+    }
+    
+    // Measure providers against their SLAs and store the monthly reports
+    if viper.GetBool("router.sla.enabled") {
+        go routerSvc.RunSLAReports(ctx)
+    }
+    
+    // Apply the hourly weights of route weight curves
+    if viper.GetBool("router.weight_curves.enabled") {
+        go routerSvc.RunWeightCurves(ctx)
+    }
+    
+    // Shift weight to cheaper providers on routes over their cost ceiling
+    if viper.GetBool("router.cost_ceilings.enabled") {
+        go routerSvc.RunCostCeilings(ctx)
+    }
+    
+    // Resolve alerts of incidents whose end went unseen
+    go routerSvc.GetAlerts().Run(ctx)
+    
+    // Score providers for false answer supervision
+    if fConfig := fasConfig(); fConfig.Enabled {
+        go routerSvc.RunFASDetection(ctx, fConfig)
+    }
+    
+    // Scheduled synthetic test calls through providers and routes
+    if synConfig := syntheticConfig(); synConfig.Enabled && amiManager != nil {
+        go router.NewSyntheticProber(routerSvc, amiManager, synConfig).Run(ctx)
+    }
+    
+    // Compare effective config and schema version with the other router nodes
+    if dConfig := driftConfig(); dConfig.Enabled {
+        if _, err := cache.Ping(ctx); err != nil {
+            logger.WithError(err).Warn("Config drift detection needs Redis, not started")
+        } else {
+            go drift.NewDetector(cache, metricsSvc, dConfig, nodeState).Run(ctx)
+        }
+    }
+    
     <-sigChan
     logger.Info("Shutting down AGI server")
     
@@ -209,7 +427,14 @@ func runAGIServer(ctx context.Context) {
         logger.WithError(err).Error("Error stopping AGI server")
     }
     
+    // Flush queued verification and health writes
+    routerSvc.Close()
+    
     // Cleanup
+    if apiServer != nil {
+        apiServer.Stop()
+    }
+    
     if amiManager != nil {
         amiManager.Close()
     }
@@ -0,0 +1,37 @@
+package main
+
+import (
+    "github.com/spf13/viper"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/masking"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// configureMasking sets up number masking from security.masking, masking the
+// fields of logConfig too unless security.masking.logs is off
+func configureMasking(logConfig *logger.Config) {
+    masking.Configure(masking.Config{
+        Enabled:    viper.GetBool("security.masking.enabled"),
+        Fields:     viper.GetStringSlice("security.masking.fields"),
+        KeepPrefix: viper.GetInt("security.masking.keep_prefix"),
+        KeepSuffix: viper.GetInt("security.masking.keep_suffix"),
+    })
+    
+    if masking.Enabled() && viper.GetBool("security.masking.logs") {
+        logConfig.MaskFields = masking.Fields()
+        logConfig.Mask = masking.Number
+    }
+}
+
+// cliNumber shows a caller or called number masked, unless the CLI user is
+// one of security.masking.pii_users
+func cliNumber(number string) string {
+    user := audit.CurrentUser()
+    for _, allowed := range viper.GetStringSlice("security.masking.pii_users") {
+        if allowed == user {
+            return number
+        }
+    }
+    return masking.Number(number)
+}
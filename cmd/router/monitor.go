@@ -0,0 +1,793 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "sync/atomic"
+    "time"
+    
+    "github.com/gdamore/tcell/v2"
+    "github.com/rivo/tview"
+    "github.com/spf13/viper"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+const (
+    // monitorFailures is how many of the latest failed calls the failures tab shows
+    monitorFailures = 200
+    
+    // hangupCauseNormal is Q.850 normal clearing, sent when an operator hangs up a call
+    hangupCauseNormal = 16
+)
+
+// Tabs of the dashboard, in the order of their number keys
+const (
+    monitorTabCalls = iota
+    monitorTabProviders
+    monitorTabDIDs
+    monitorTabFailures
+)
+
+type monitorColumn struct {
+    title string
+    align int
+}
+
+// monitorRow is one line of a dashboard table. values holds what each
+// column sorts by, a string, int64, float64 or time.Time.
+type monitorRow struct {
+    key    string // call ID on the calls and failures tabs
+    cells  []string
+    values []interface{}
+    color  tcell.Color
+}
+
+// monitorTab is a sortable table on the dashboard
+type monitorTab struct {
+    name    string
+    columns []monitorColumn
+    empty   string
+    calls   bool // rows are calls, which can be drilled into and hung up
+    table   *tview.Table
+    rows    []monitorRow
+    sortBy  int
+    desc    bool
+}
+
+// monitorSnapshot is what one refresh read, collected off the UI goroutine
+type monitorSnapshot struct {
+    at           time.Time
+    calls        []*models.ActiveCall
+    totalCalls   int64
+    source       string
+    providers    map[string]*models.ProviderStats
+    didStats     map[string]interface{}
+    didPools     []map[string]interface{}
+    failures     []*models.CallRecord
+    killSwitches []*models.KillSwitch
+    errs         []string
+}
+
+// monitor is the interactive dashboard of `router monitor`. Everything but
+// fetch runs on the tview event loop.
+type monitor struct {
+    ctx      context.Context
+    interval time.Duration
+    app      *tview.Application
+    pages    *tview.Pages
+    header   *tview.TextView
+    tabBar   *tview.TextView
+    footer   *tview.TextView
+    tabs     []*monitorTab
+    current  int
+    overlay  string // name of the page over the tabs, empty when none is
+    message  string
+    paused   atomic.Bool
+    refresh  chan struct{}
+    snapshot *monitorSnapshot
+}
+
+func runMonitor(ctx context.Context, interval time.Duration) error {
+    // Log lines would be drawn over the dashboard
+    if !viper.GetBool("monitoring.logging.file.enabled") {
+        logger.SetOutput(io.Discard)
+    }
+    
+    m := newMonitor(ctx, interval)
+    
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    go func() {
+        <-ctx.Done()
+        m.app.Stop()
+    }()
+    go m.refreshLoop(ctx)
+    
+    if err := m.app.Run(); err != nil {
+        return fmt.Errorf("failed to run monitor: %v", err)
+    }
+    return nil
+}
+
+func newMonitor(ctx context.Context, interval time.Duration) *monitor {
+    m := &monitor{
+        ctx:      ctx,
+        interval: interval,
+        app:      tview.NewApplication(),
+        pages:    tview.NewPages(),
+        header:   tview.NewTextView().SetDynamicColors(true).SetWrap(false),
+        tabBar:   tview.NewTextView().SetDynamicColors(true),
+        footer:   tview.NewTextView().SetDynamicColors(true),
+        refresh:  make(chan struct{}, 1),
+    }
+    
+    left, right := tview.AlignLeft, tview.AlignRight
+    m.tabs = []*monitorTab{
+        {
+            name:  "Calls",
+            empty: "No active calls",
+            calls: true,
+            columns: []monitorColumn{
+                {"Call ID", left}, {"ANI", left}, {"DNIS", left}, {"DID", left}, {"Route", left},
+                {"Status", left}, {"Current Leg", left}, {"Duration", right},
+            },
+            sortBy: 7,
+            desc:   true,
+        },
+        {
+            name:  "Providers",
+            empty: "No provider statistics yet",
+            columns: []monitorColumn{
+                {"Provider", left}, {"Health", left}, {"Active", right}, {"Calls", right}, {"Failed", right},
+                {"Success", right}, {"Avg Duration", right}, {"Response", right}, {"Last Call", left},
+            },
+        },
+        {
+            name:  "DID Pool",
+            empty: "No DIDs",
+            columns: []monitorColumn{
+                {"Provider", left}, {"Total", right}, {"In Use", right}, {"Available", right}, {"Utilization", right},
+            },
+            sortBy: 4,
+            desc:   true,
+        },
+        {
+            name:  "Failures",
+            empty: "No failed calls",
+            calls: true,
+            columns: []monitorColumn{
+                {"Time", left}, {"Call ID", left}, {"ANI", left}, {"DNIS", left}, {"Route", left},
+                {"Provider", left}, {"Status", left}, {"Reason", left}, {"SIP", right}, {"Cause", right},
+            },
+            sortBy: 0,
+            desc:   true,
+        },
+    }
+    
+    for i, tab := range m.tabs {
+        tab.table = tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+        if tab.calls {
+            tab.table.SetSelectedFunc(func(row, column int) {
+                if callID := m.selectedCall(); callID != "" {
+                    m.showCall(callID)
+                }
+            })
+        }
+        tab.render()
+        m.pages.AddPage(tab.name, tab.table, true, i == 0)
+    }
+    
+    layout := tview.NewFlex().SetDirection(tview.FlexRow).
+        AddItem(m.header, 2, 0, false).
+        AddItem(m.tabBar, 1, 0, false).
+        AddItem(m.pages, 0, 1, true).
+        AddItem(m.footer, 1, 0, false)
+    
+    m.app.SetRoot(layout, true).SetInputCapture(m.handleKey)
+    m.drawChrome()
+    return m
+}
+
+// refreshLoop reads the dashboard data every interval, or at once when
+// something changed it
+func (m *monitor) refreshLoop(ctx context.Context) {
+    ticker := time.NewTicker(m.interval)
+    defer ticker.Stop()
+    
+    for {
+        if !m.paused.Load() {
+            snapshot := m.fetch(ctx)
+            m.app.QueueUpdateDraw(func() {
+                m.apply(snapshot)
+            })
+        }
+    
+        select {
+        case <-ticker.C:
+        case <-m.refresh:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (m *monitor) refreshNow() {
+    select {
+    case m.refresh <- struct{}{}:
+    default:
+    }
+}
+
+// fetch reads the live calls from the AGI server, falling back to the
+// database like `router calls`, and the rest from the database
+func (m *monitor) fetch(ctx context.Context) *monitorSnapshot {
+    s := &monitorSnapshot{at: time.Now(), source: "live"}
+    
+    calls, total, err := fetchActiveCalls(ctx, models.CallFilter{}, models.ListOptions{Limit: models.MaxListLimit})
+    if err != nil {
+        s.source = "database"
+        records, n, dbErr := routerSvc.ListCalls(ctx, models.CallFilter{ActiveOnly: true}, models.ListOptions{Limit: models.MaxListLimit})
+        if dbErr != nil {
+            s.errs = append(s.errs, fmt.Sprintf("calls: %v", dbErr))
+        }
+        calls, total = activeCallsFromRecords(records), n
+    }
+    s.calls, s.totalCalls = calls, total
+    
+    s.providers = routerSvc.GetLoadBalancer().GetProviderStats()
+    s.killSwitches = routerSvc.GetKillSwitches().Engaged()
+    
+    if s.didStats, err = routerSvc.GetDIDManager().GetStatistics(ctx); err != nil {
+        s.errs = append(s.errs, fmt.Sprintf("DIDs: %v", err))
+    }
+    if s.didPools, err = routerSvc.GetDIDManager().GetProviderDIDUtilization(ctx); err != nil {
+        s.errs = append(s.errs, fmt.Sprintf("DID pool: %v", err))
+    }
+    
+    s.failures, _, err = routerSvc.ListCalls(ctx, models.CallFilter{FailedOnly: true}, models.ListOptions{Limit: monitorFailures})
+    if err != nil {
+        s.errs = append(s.errs, fmt.Sprintf("failures: %v", err))
+    }
+    
+    return s
+}
+
+func (m *monitor) apply(s *monitorSnapshot) {
+    if m.paused.Load() {
+        return
+    }
+    m.snapshot = s
+    
+    calls := m.tabs[monitorTabCalls]
+    calls.rows = calls.rows[:0]
+    for _, call := range s.calls {
+        status := string(call.Status)
+        if call.IsTest {
+            status += " [TEST]"
+        }
+        row := monitorRow{
+            key: call.CallID,
+            cells: []string{
+                call.CallID, cliNumber(call.ANI), cliNumber(call.DNIS), orDash(call.DID), call.Route,
+                status, orDash(formatCurrentLeg(call)), formatElapsed(call.Elapsed),
+            },
+            values: []interface{}{
+                call.CallID, call.ANI, call.DNIS, call.DID, call.Route,
+                status, formatCurrentLeg(call), int64(call.Elapsed),
+            },
+        }
+        if call.IsTest {
+            row.color = tcell.ColorYellow
+        }
+        calls.rows = append(calls.rows, row)
+    }
+    
+    providers := m.tabs[monitorTabProviders]
+    providers.rows = providers.rows[:0]
+    for name, stat := range s.providers {
+        health, color := "healthy", tcell.ColorGreen
+        switch {
+        case !stat.IsHealthy:
+            health, color = "unhealthy", tcell.ColorRed
+        case stat.WarmingUp:
+            health, color = fmt.Sprintf("warming %.0f%%", stat.WarmupPercent), tcell.ColorYellow
+        }
+        lastCall := "-"
+        if !stat.LastCallTime.IsZero() {
+            lastCall = stat.LastCallTime.Format("15:04:05")
+        }
+        providers.rows = append(providers.rows, monitorRow{
+            key: name,
+            cells: []string{
+                name, health, fmt.Sprintf("%d", stat.ActiveCalls), fmt.Sprintf("%d", stat.TotalCalls),
+                fmt.Sprintf("%d", stat.FailedCalls), fmt.Sprintf("%.1f%%", stat.SuccessRate),
+                formatElapsed(int(stat.AvgCallDuration)), fmt.Sprintf("%dms", stat.AvgResponseTime), lastCall,
+            },
+            values: []interface{}{
+                name, health, stat.ActiveCalls, stat.TotalCalls, stat.FailedCalls, stat.SuccessRate,
+                stat.AvgCallDuration, int64(stat.AvgResponseTime), stat.LastCallTime,
+            },
+            color: color,
+        })
+    }
+    
+    dids := m.tabs[monitorTabDIDs]
+    dids.rows = dids.rows[:0]
+    for _, pool := range s.didPools {
+        name, _ := pool["provider_name"].(string)
+        total, _ := pool["total_dids"].(int)
+        used, _ := pool["used_dids"].(int)
+        available, _ := pool["available_dids"].(int)
+        utilization, _ := pool["utilization_percent"].(float64)
+    
+        row := monitorRow{
+            key: name,
+            cells: []string{
+                name, fmt.Sprintf("%d", total), fmt.Sprintf("%d", used), fmt.Sprintf("%d", available),
+                fmt.Sprintf("%.1f%%", utilization),
+            },
+            values: []interface{}{name, int64(total), int64(used), int64(available), utilization},
+        }
+        switch {
+        case available == 0:
+            row.color = tcell.ColorRed
+        case utilization >= 80:
+            row.color = tcell.ColorYellow
+        }
+        dids.rows = append(dids.rows, row)
+    }
+    
+    failures := m.tabs[monitorTabFailures]
+    failures.rows = failures.rows[:0]
+    for _, call := range s.failures {
+        provider := call.FinalProvider
+        if provider == "" {
+            provider = call.IntermediateProvider
+        }
+        reason := call.FailureReason
+        if reason == "" {
+            reason = call.Disposition
+        }
+        failures.rows = append(failures.rows, monitorRow{
+            key: call.CallID,
+            cells: []string{
+                call.StartTime.Format("15:04:05"), call.CallID, cliNumber(call.OriginalANI), cliNumber(call.OriginalDNIS),
+                orDash(call.RouteName), orDash(provider), string(call.Status), orDash(reason),
+                formatCode(call.SIPResponseCode), formatCode(call.HangupCause),
+            },
+            values: []interface{}{
+                call.StartTime, call.CallID, call.OriginalANI, call.OriginalDNIS, call.RouteName, provider,
+                string(call.Status), reason, int64(call.SIPResponseCode), int64(call.HangupCause),
+            },
+            color: tcell.ColorRed,
+        })
+    }
+    
+    for _, tab := range m.tabs {
+        tab.render()
+    }
+    m.drawChrome()
+}
+
+// drawChrome redraws the header, tab bar and key help
+func (m *monitor) drawChrome() {
+    var header strings.Builder
+    fmt.Fprintf(&header, "[::b]Asterisk ARA Router Monitor[::-]  %s", time.Now().Format("15:04:05"))
+    if s := m.snapshot; s != nil {
+        fmt.Fprintf(&header, "   Calls: [yellow]%d[-] (%s)", s.totalCalls, s.source)
+        if util, ok := s.didStats["did_utilization"].(float64); ok {
+            fmt.Fprintf(&header, "   DIDs: %v/%v in use (%.1f%%)", s.didStats["used_dids"], s.didStats["total_dids"], util)
+        }
+        if m.paused.Load() {
+            header.WriteString("   [black:yellow] PAUSED [-:-]")
+        }
+        header.WriteString("\n")
+    
+        // Engaged kill switches come first, new calls are being rejected
+        if len(s.killSwitches) > 0 {
+            for _, k := range s.killSwitches {
+                fmt.Fprintf(&header, "[red]■ KILL SWITCH ENGAGED: %s - %s[-]  ", tview.Escape(formatKillSwitchScope(k)), tview.Escape(k.Reason))
+            }
+        } else if len(s.errs) > 0 {
+            fmt.Fprintf(&header, "[yellow]! %s[-]", tview.Escape(strings.Join(s.errs, "; ")))
+        }
+    } else {
+        header.WriteString("   loading...")
+    }
+    m.header.SetText(header.String())
+    
+    var bar strings.Builder
+    for i, tab := range m.tabs {
+        label := fmt.Sprintf(" %d %s (%d) ", i+1, tab.name, len(tab.rows))
+        if i == m.current {
+            fmt.Fprintf(&bar, "[black:yellow]%s[-:-] ", label)
+        } else {
+            fmt.Fprintf(&bar, "%s ", label)
+        }
+    }
+    m.tabBar.SetText(bar.String())
+    
+    keys := "[yellow]Tab/1-4[-] switch  [yellow]s/S[-] sort  [yellow]o[-] order  [yellow]p[-] pause  [yellow]r[-] refresh  [yellow]q[-] quit"
+    if m.tabs[m.current].calls {
+        keys = "[yellow]Enter[-] details  [yellow]h[-] hang up  " + keys
+    }
+    if m.message != "" {
+        keys += "   " + m.message
+    }
+    m.footer.SetText(keys)
+}
+
+func (m *monitor) handleKey(event *tcell.EventKey) *tcell.EventKey {
+    // Detail views and prompts take their own keys
+    if m.overlay != "" {
+        return event
+    }
+    
+    tab := m.tabs[m.current]
+    switch event.Key() {
+    case tcell.KeyTab:
+        m.switchTab((m.current + 1) % len(m.tabs))
+        return nil
+    case tcell.KeyBacktab:
+        m.switchTab((m.current + len(m.tabs) - 1) % len(m.tabs))
+        return nil
+    case tcell.KeyRune:
+    default:
+        return event
+    }
+    
+    switch r := event.Rune(); r {
+    case 'q':
+        m.app.Stop()
+    case '1', '2', '3', '4':
+        m.switchTab(int(r - '1'))
+    case 's', 'S':
+        step := 1
+        if r == 'S' {
+            step = len(tab.columns) - 1
+        }
+        tab.sortBy = (tab.sortBy + step) % len(tab.columns)
+        tab.render()
+    case 'o':
+        tab.desc = !tab.desc
+        tab.render()
+    case 'p':
+        m.paused.Store(!m.paused.Load())
+        if !m.paused.Load() {
+            m.refreshNow()
+        }
+        m.drawChrome()
+    case 'r':
+        m.refreshNow()
+    case 'h':
+        if callID := m.selectedCall(); callID != "" {
+            m.confirmHangup(callID)
+        }
+    default:
+        return event
+    }
+    return nil
+}
+
+func (m *monitor) switchTab(i int) {
+    m.current = i
+    m.pages.SwitchToPage(m.tabs[i].name)
+    m.app.SetFocus(m.tabs[i].table)
+    m.drawChrome()
+}
+
+// selectedCall is the call ID of the selected row, empty on tabs not
+// listing calls
+func (m *monitor) selectedCall() string {
+    tab := m.tabs[m.current]
+    if !tab.calls {
+        return ""
+    }
+    return tab.selectedKey()
+}
+
+// showOverlay puts a detail view or prompt over the tabs until closeOverlay
+func (m *monitor) showOverlay(name string, item tview.Primitive) {
+    m.overlay = name
+    m.pages.AddPage(name, item, true, true)
+    m.app.SetFocus(item)
+}
+
+func (m *monitor) closeOverlay() {
+    if m.overlay == "" {
+        return
+    }
+    m.pages.RemovePage(m.overlay)
+    m.overlay = ""
+    m.pages.SwitchToPage(m.tabs[m.current].name)
+    m.app.SetFocus(m.tabs[m.current].table)
+}
+
+// showCall drills into a call, the live snapshot and its call record
+func (m *monitor) showCall(callID string) {
+    var live *models.ActiveCall
+    if m.snapshot != nil {
+        for _, call := range m.snapshot.calls {
+            if call.CallID == callID {
+                live = call
+                break
+            }
+        }
+    }
+    
+    view := tview.NewTextView().SetDynamicColors(true).SetText(formatCallDetails(callID, live, nil, nil))
+    view.SetBorder(true).SetTitle(" Call " + tview.Escape(callID) + " ")
+    view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+        switch {
+        case event.Key() == tcell.KeyEscape, event.Key() == tcell.KeyEnter, event.Rune() == 'q':
+            m.closeOverlay()
+            return nil
+        case event.Rune() == 'h' && live != nil:
+            m.closeOverlay()
+            m.confirmHangup(callID)
+            return nil
+        }
+        return event
+    })
+    m.showOverlay("call", view)
+    
+    go func() {
+        records, _, err := routerSvc.ListCalls(m.ctx, models.CallFilter{CallID: callID}, models.ListOptions{Limit: 1})
+        var record *models.CallRecord
+        if len(records) > 0 {
+            record = records[0]
+        }
+        m.app.QueueUpdateDraw(func() {
+            if m.overlay == "call" {
+                view.SetText(formatCallDetails(callID, live, record, err))
+            }
+        })
+    }()
+}
+
+func formatCallDetails(callID string, live *models.ActiveCall, record *models.CallRecord, err error) string {
+    var b strings.Builder
+    field := func(name, value string) {
+        if value != "" {
+            fmt.Fprintf(&b, "[yellow]%-14s[-] %s\n", name, tview.Escape(value))
+        }
+    }
+    
+    field("Call ID", callID)
+    if live != nil {
+        field("ANI", cliNumber(live.ANI))
+        field("DNIS", cliNumber(live.DNIS))
+        field("DID", live.DID)
+        field("Route", live.Route)
+        field("Status", strings.TrimSpace(string(live.Status)+" "+live.CurrentStep))
+        field("Started", fmt.Sprintf("%s (%s ago)", live.StartTime.Format("2006-01-02 15:04:05"), formatElapsed(live.Elapsed)))
+        if live.IsTest {
+            field("Test", "yes")
+        }
+    
+        b.WriteString("\n[yellow]Legs[-]\n")
+        for _, leg := range live.Legs {
+            fmt.Fprintf(&b, "  %-13s %-16s %-9s %s\n", leg.Leg, tview.Escape(orDash(leg.Provider)), leg.State, formatElapsed(leg.Elapsed))
+        }
+    }
+    
+    switch {
+    case err != nil:
+        fmt.Fprintf(&b, "\n[red]Failed to load the call record: %s[-]\n", tview.Escape(err.Error()))
+    case record != nil:
+        b.WriteString("\n[yellow]Call record[-]\n")
+        if live == nil {
+            field("ANI", cliNumber(record.OriginalANI))
+            field("DNIS", cliNumber(record.OriginalDNIS))
+            field("DID", record.AssignedDID)
+            field("Route", record.RouteName)
+        }
+        field("Status", string(record.Status))
+        field("Providers", strings.Join(nonEmpty(record.InboundProvider, record.IntermediateProvider, record.FinalProvider), " → "))
+        field("Started", record.StartTime.Format("2006-01-02 15:04:05"))
+        if record.AnswerTime != nil {
+            field("Answered", record.AnswerTime.Format("15:04:05"))
+        }
+        if record.EndTime != nil {
+            field("Ended", fmt.Sprintf("%s (%s)", record.EndTime.Format("15:04:05"), formatElapsed(record.Duration)))
+        }
+        field("Failure", record.FailureReason)
+        field("Disposition", record.Disposition)
+        field("Dial status", record.DialStatus)
+        if record.SIPResponseCode > 0 {
+            field("SIP code", fmt.Sprintf("%d", record.SIPResponseCode))
+        }
+        if record.HangupCause > 0 {
+            field("Hangup cause", fmt.Sprintf("%d", record.HangupCause))
+        }
+    case live == nil:
+        b.WriteString("\nLoading...\n")
+    }
+    
+    b.WriteString("\n[yellow]Esc[-] back")
+    if live != nil {
+        b.WriteString("  [yellow]h[-] hang up")
+    }
+    return b.String()
+}
+
+// confirmHangup asks before hanging up a call
+func (m *monitor) confirmHangup(callID string) {
+    modal := tview.NewModal().
+        SetText(fmt.Sprintf("Hang up call %s?", callID)).
+        AddButtons([]string{"Hang up", "Cancel"}).
+        SetDoneFunc(func(index int, label string) {
+            m.closeOverlay()
+            if label != "Hang up" {
+                return
+            }
+    
+            m.message = "[yellow]Hanging up " + tview.Escape(callID) + "...[-]"
+            m.drawChrome()
+            go func() {
+                err := hangupCall(m.ctx, callID)
+                m.app.QueueUpdateDraw(func() {
+                    if err != nil {
+                        m.message = "[red]" + tview.Escape(err.Error()) + "[-]"
+                    } else {
+                        m.message = "[green]✓ Call " + tview.Escape(callID) + " hung up[-]"
+                    }
+                    m.drawChrome()
+                })
+                m.refreshNow()
+            }()
+        })
+    m.showOverlay("hangup", modal)
+}
+
+// hangupCall hangs up the inbound channel of a call through AMI, the other
+// legs go down with it and the hangup hook closes the call as usual
+func hangupCall(ctx context.Context, callID string) error {
+    if amiManager == nil || !amiManager.IsConnected() {
+        return fmt.Errorf("AMI is not connected")
+    }
+    
+    channels, err := amiManager.ShowChannels()
+    if err != nil {
+        return fmt.Errorf("failed to list channels: %v", err)
+    }
+    var channel string
+    for _, ch := range channels {
+        if ch["Uniqueid"] == callID {
+            channel = ch["Channel"]
+            break
+        }
+    }
+    if channel == "" {
+        return fmt.Errorf("call %s has no channel on Asterisk", callID)
+    }
+    
+    if err := amiManager.HangupChannel(channel, hangupCauseNormal); err != nil {
+        return fmt.Errorf("failed to hang up call: %v", err)
+    }
+    
+    if err := audit.Record(ctx, database.DB, audit.Entry{
+        EventType:  "call_hangup",
+        EntityType: "call",
+        EntityID:   callID,
+        UserID:     audit.CurrentUser(),
+        Action:     "hangup",
+        Metadata:   map[string]interface{}{"channel": channel},
+    }); err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to audit call hangup")
+    }
+    return nil
+}
+
+// render redraws the table sorted, keeping the selected row selected
+func (t *monitorTab) render() {
+    selected := t.selectedKey()
+    
+    sort.SliceStable(t.rows, func(i, j int) bool {
+        c := compareMonitorValues(t.rows[i].values[t.sortBy], t.rows[j].values[t.sortBy])
+        if t.desc {
+            return c > 0
+        }
+        return c < 0
+    })
+    
+    t.table.Clear()
+    for i, col := range t.columns {
+        title := col.title
+        if i == t.sortBy {
+            if t.desc {
+                title += " ▼"
+            } else {
+                title += " ▲"
+            }
+        }
+        t.table.SetCell(0, i, tview.NewTableCell(title).
+            SetSelectable(false).
+            SetAttributes(tcell.AttrBold).
+            SetTextColor(tcell.ColorYellow).
+            SetAlign(col.align).
+            SetExpansion(1))
+    }
+    
+    if len(t.rows) == 0 {
+        t.table.SetCell(1, 0, tview.NewTableCell(t.empty).SetSelectable(false))
+        return
+    }
+    
+    selectedRow := 1
+    for i, row := range t.rows {
+        for j, text := range row.cells {
+            cell := tview.NewTableCell(tview.Escape(text)).SetAlign(t.columns[j].align).SetExpansion(1)
+            if row.color != tcell.ColorDefault {
+                cell.SetTextColor(row.color)
+            }
+            if j == 0 {
+                cell.SetReference(row.key)
+            }
+            t.table.SetCell(i+1, j, cell)
+        }
+        if row.key == selected {
+            selectedRow = i + 1
+        }
+    }
+    t.table.Select(selectedRow, 0)
+}
+
+func (t *monitorTab) selectedKey() string {
+    row, _ := t.table.GetSelection()
+    if cell := t.table.GetCell(row, 0); cell != nil {
+        if key, ok := cell.GetReference().(string); ok {
+            return key
+        }
+    }
+    return ""
+}
+
+func compareMonitorValues(a, b interface{}) int {
+    var less, greater bool
+    switch av := a.(type) {
+    case int64:
+        bv, _ := b.(int64)
+        less, greater = av < bv, av > bv
+    case float64:
+        bv, _ := b.(float64)
+        less, greater = av < bv, av > bv
+    case time.Time:
+        bv, _ := b.(time.Time)
+        less, greater = av.Before(bv), av.After(bv)
+    case string:
+        bv, _ := b.(string)
+        return strings.Compare(strings.ToLower(av), strings.ToLower(bv))
+    }
+    
+    switch {
+    case less:
+        return -1
+    case greater:
+        return 1
+    }
+    return 0
+}
+
+func formatCode(code int) string {
+    if code == 0 {
+        return "-"
+    }
+    return fmt.Sprintf("%d", code)
+}
+
+func nonEmpty(values ...string) []string {
+    var out []string
+    for _, v := range values {
+        if v != "" {
+            out = append(out, v)
+        }
+    }
+    return out
+}
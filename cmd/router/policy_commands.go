@@ -0,0 +1,353 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "os"
+    "strings"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// policyFlags are the settings a policy defines and a route may override
+type policyFlags struct {
+    verify    bool
+    strict    bool
+    aniStrip  string
+    aniAdd    string
+    dnisStrip string
+    dnisAdd   string
+}
+
+func (f *policyFlags) register(cmd *cobra.Command) {
+    cmd.Flags().BoolVar(&f.verify, "verify", true, "Verify return and final legs")
+    cmd.Flags().BoolVar(&f.strict, "strict", false, "Reject calls that fail verification")
+    cmd.Flags().StringVar(&f.aniStrip, "ani-strip", "", "Prefix to strip from the ANI sent to the final provider")
+    cmd.Flags().StringVar(&f.aniAdd, "ani-add", "", "Prefix to add to the ANI sent to the final provider")
+    cmd.Flags().StringVar(&f.dnisStrip, "dnis-strip", "", "Prefix to strip from the DNIS sent to the final provider")
+    cmd.Flags().StringVar(&f.dnisAdd, "dnis-add", "", "Prefix to add to the DNIS sent to the final provider")
+}
+
+// resolve applies the flags given on the command line to the current values
+func (f *policyFlags) resolve(cmd *cobra.Command, verify, strict *bool, m *models.NumberManipulations) (*bool, *bool, *models.NumberManipulations) {
+    if cmd.Flags().Changed("verify") {
+        verify = &f.verify
+    }
+    if cmd.Flags().Changed("strict") {
+        strict = &f.strict
+    }
+    
+    manipulations := models.NumberManipulations{}
+    if m != nil {
+        manipulations = *m
+    }
+    if cmd.Flags().Changed("ani-strip") {
+        manipulations.ANIStripPrefix = f.aniStrip
+    }
+    if cmd.Flags().Changed("ani-add") {
+        manipulations.ANIAddPrefix = f.aniAdd
+    }
+    if cmd.Flags().Changed("dnis-strip") {
+        manipulations.DNISStripPrefix = f.dnisStrip
+    }
+    if cmd.Flags().Changed("dnis-add") {
+        manipulations.DNISAddPrefix = f.dnisAdd
+    }
+    
+    if manipulations.IsEmpty() {
+        return verify, strict, nil
+    }
+    return verify, strict, &manipulations
+}
+
+func createRoutePolicyCommands() *cobra.Command {
+    policyCmd := &cobra.Command{
+        Use:   "policy",
+        Short: "Manage shared route policies",
+        Long:  "Policies hold verification, load balancing, quota and number manipulation settings shared by many routes",
+    }
+    
+    policyCmd.AddCommand(
+        createRoutePolicyAddCommand(),
+        createRoutePolicyUpdateCommand(),
+        createRoutePolicyListCommand(),
+        createRoutePolicyShowCommand(),
+        createRoutePolicyDeleteCommand(),
+    )
+    
+    return policyCmd
+}
+
+func createRoutePolicyAddCommand() *cobra.Command {
+    var (
+        mode        string
+        maxCalls    int
+        description string
+        flags       policyFlags
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "add <name>",
+        Short: "Add a route policy",
+        Example: `  router route policy add wholesale --mode weighted --max-calls 200 --strict
+  router route add acme s1-acme s3-group s4-group --groups --policy wholesale`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            policy := &models.RoutePolicy{
+                Name:            args[0],
+                Description:     description,
+                LoadBalanceMode: models.LoadBalanceMode(mode),
+            }
+            if cmd.Flags().Changed("max-calls") {
+                policy.MaxConcurrentCalls = &maxCalls
+            }
+            policy.VerificationEnabled, policy.StrictMode, policy.Manipulations = flags.resolve(cmd, nil, nil, nil)
+            
+            if err := routerSvc.CreateRoutePolicy(ctx, policy); err != nil {
+                return fmt.Errorf("failed to create route policy: %v", err)
+            }
+            
+            fmt.Printf("%s Route policy '%s' created successfully\n", green("✓"), args[0])
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&mode, "mode", "", "Load balance mode")
+    cmd.Flags().IntVar(&maxCalls, "max-calls", 0, "Maximum concurrent calls per route")
+    cmd.Flags().StringVarP(&description, "description", "d", "", "Policy description")
+    flags.register(cmd)
+    
+    return cmd
+}
+
+func createRoutePolicyUpdateCommand() *cobra.Command {
+    var (
+        mode        string
+        maxCalls    int
+        description string
+        clear       []string
+        flags       policyFlags
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "update <name>",
+        Short: "Update a route policy",
+        Long:  "Update a route policy. Only the given flags change; routes using the policy pick up the change on their next call.",
+        Example: `  router route policy update wholesale --max-calls 300
+  router route policy update wholesale --clear mode,max-calls`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            policy, err := routerSvc.GetRoutePolicy(ctx, args[0])
+            if err != nil {
+                return fmt.Errorf("failed to get route policy: %v", err)
+            }
+            
+            if cmd.Flags().Changed("description") {
+                policy.Description = description
+            }
+            if cmd.Flags().Changed("mode") {
+                policy.LoadBalanceMode = models.LoadBalanceMode(mode)
+            }
+            if cmd.Flags().Changed("max-calls") {
+                policy.MaxConcurrentCalls = &maxCalls
+            }
+            policy.VerificationEnabled, policy.StrictMode, policy.Manipulations =
+                flags.resolve(cmd, policy.VerificationEnabled, policy.StrictMode, policy.Manipulations)
+            
+            // Cleared settings fall back to the global configuration
+            for _, field := range clear {
+                switch strings.TrimSpace(field) {
+                case "mode":
+                    policy.LoadBalanceMode = ""
+                case "max-calls":
+                    policy.MaxConcurrentCalls = nil
+                case "verify":
+                    policy.VerificationEnabled = nil
+                case "strict":
+                    policy.StrictMode = nil
+                case "manipulations":
+                    policy.Manipulations = nil
+                default:
+                    return fmt.Errorf("unknown setting to clear: %s", field)
+                }
+            }
+            
+            if err := routerSvc.UpdateRoutePolicy(ctx, policy); err != nil {
+                return fmt.Errorf("failed to update route policy: %v", err)
+            }
+            
+            fmt.Printf("%s Route policy '%s' updated (%d routes)\n", green("✓"), args[0], policy.RouteCount)
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&mode, "mode", "", "Load balance mode")
+    cmd.Flags().IntVar(&maxCalls, "max-calls", 0, "Maximum concurrent calls per route")
+    cmd.Flags().StringVarP(&description, "description", "d", "", "Policy description")
+    cmd.Flags().StringSliceVar(&clear, "clear", nil, "Settings to unset: mode, max-calls, verify, strict, manipulations")
+    flags.register(cmd)
+    
+    return cmd
+}
+
+func createRoutePolicyListCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "list",
+        Short: "List route policies",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            policies, err := routerSvc.ListRoutePolicies(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to list route policies: %v", err)
+            }
+            
+            if len(policies) == 0 {
+                fmt.Println("No route policies found")
+                return nil
+            }
+            
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Name", "Mode", "Max Calls", "Verify", "Strict", "Manipulations", "Routes"})
+            table.SetBorder(false)
+            
+            for _, p := range policies {
+                table.Append([]string{
+                    p.Name,
+                    formatOptionalMode(p.LoadBalanceMode),
+                    formatOptionalInt(p.MaxConcurrentCalls),
+                    formatOptionalBool(p.VerificationEnabled),
+                    formatOptionalBool(p.StrictMode),
+                    formatManipulations(p.Manipulations),
+                    fmt.Sprintf("%d", p.RouteCount),
+                })
+            }
+            
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createRoutePolicyShowCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "show <name>",
+        Short: "Show route policy details",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            policy, err := routerSvc.GetRoutePolicy(ctx, args[0])
+            if err != nil {
+                return fmt.Errorf("failed to get route policy: %v", err)
+            }
+            
+            fmt.Printf("\n%s\n", bold("Route Policy Details"))
+            fmt.Printf("Name:               %s\n", policy.Name)
+            if policy.Description != "" {
+                fmt.Printf("Description:        %s\n", policy.Description)
+            }
+            fmt.Printf("Load Balance Mode:  %s\n", formatOptionalMode(policy.LoadBalanceMode))
+            fmt.Printf("Max Concurrent:     %s\n", formatOptionalInt(policy.MaxConcurrentCalls))
+            fmt.Printf("Verification:       %s\n", formatOptionalBool(policy.VerificationEnabled))
+            fmt.Printf("Strict Mode:        %s\n", formatOptionalBool(policy.StrictMode))
+            fmt.Printf("Manipulations:      %s\n", formatManipulations(policy.Manipulations))
+            fmt.Printf("Routes:             %d\n", policy.RouteCount)
+            
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createRoutePolicyDeleteCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "delete <name>",
+        Short: "Delete an unused route policy",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            fmt.Printf("Are you sure you want to delete route policy '%s'? [y/N]: ", args[0])
+            reader := bufio.NewReader(os.Stdin)
+            response, _ := reader.ReadString('\n')
+            response = strings.TrimSpace(strings.ToLower(response))
+            
+            if response != "y" && response != "yes" {
+                fmt.Println("Deletion cancelled")
+                return nil
+            }
+            
+            if err := routerSvc.DeleteRoutePolicy(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to delete route policy: %v", err)
+            }
+            
+            fmt.Printf("%s Route policy '%s' deleted successfully\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
+
+func formatOptionalBool(b *bool) string {
+    if b == nil {
+        return "global"
+    }
+    return formatBool(*b)
+}
+
+func formatOptionalInt(v *int) string {
+    if v == nil {
+        return "-"
+    }
+    return fmt.Sprintf("%d", *v)
+}
+
+func formatOptionalMode(mode models.LoadBalanceMode) string {
+    if mode == "" {
+        return "-"
+    }
+    return string(mode)
+}
+
+func formatManipulations(m *models.NumberManipulations) string {
+    if m.IsEmpty() {
+        return "-"
+    }
+    
+    var parts []string
+    if m.ANIStripPrefix != "" || m.ANIAddPrefix != "" {
+        parts = append(parts, fmt.Sprintf("ANI -%s +%s", m.ANIStripPrefix, m.ANIAddPrefix))
+    }
+    if m.DNISStripPrefix != "" || m.DNISAddPrefix != "" {
+        parts = append(parts, fmt.Sprintf("DNIS -%s +%s", m.DNISStripPrefix, m.DNISAddPrefix))
+    }
+    return strings.Join(parts, ", ")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/spf13/viper"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/db"
+    "github.com/hamzaKhattat/ara-production-system/internal/health"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// What the router does when a dependency is unavailable at startup
+const (
+    dependencyRequired = "required" // refuse to start, readiness fails while it is down
+    dependencyDegraded = "degraded" // start with a warning, readiness reports degraded
+    dependencyOptional = "optional" // start quietly, readiness ignores it
+)
+
+const dependencyProbeInterval = 2 * time.Second
+
+// dependency is a service the router connects to at startup
+type dependency struct {
+    Name    string
+    Policy  string
+    Address string
+    Probe   func(ctx context.Context) error // nil when not configured
+}
+
+// dependencyStatus is the state of a dependency once the router initialized
+type dependencyStatus struct {
+    dependency
+    Up     bool
+    Detail string
+}
+
+// dependencyPolicy reads the startup policy of a dependency. The database is
+// always required, the router can route nothing without it.
+func dependencyPolicy(name string) (string, error) {
+    if name == "database" {
+        return dependencyRequired, nil
+    }
+    
+    policy := strings.ToLower(viper.GetString("startup.dependencies." + name))
+    switch policy {
+    case dependencyRequired, dependencyDegraded, dependencyOptional:
+        return policy, nil
+    }
+    return "", errors.New(errors.ErrConfiguration,
+        fmt.Sprintf("startup.dependencies.%s must be required, degraded or optional, not %q", name, policy))
+}
+
+// startupDependencies lists the database, Redis and AMI with their policies
+func startupDependencies() ([]dependency, error) {
+    dbConfig := databaseConfig()
+    redisConfig := cacheConfig()
+    
+    deps := []dependency{
+        {
+            Name:    "database",
+            Address: net.JoinHostPort(dbConfig.Host, strconv.Itoa(dbConfig.Port)),
+            Probe: func(ctx context.Context) error {
+                return db.Probe(ctx, dbConfig)
+            },
+        },
+        {
+            Name:    "redis",
+            Address: net.JoinHostPort(redisConfig.Host, strconv.Itoa(redisConfig.Port)),
+            Probe: func(ctx context.Context) error {
+                return db.ProbeCache(ctx, redisConfig)
+            },
+        },
+        {Name: "ami"},
+    }
+    
+    // AMI is only probed for a listener, logging in needs the manager
+    if host := viper.GetString("asterisk.ami.host"); host != "" {
+        deps[2].Address = net.JoinHostPort(host, strconv.Itoa(viper.GetInt("asterisk.ami.port")))
+        deps[2].Probe = func(ctx context.Context) error {
+            conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", deps[2].Address)
+            if err != nil {
+                return err
+            }
+            return conn.Close()
+        }
+    }
+    
+    for i := range deps {
+        policy, err := dependencyPolicy(deps[i].Name)
+        if err != nil {
+            return nil, err
+        }
+        deps[i].Policy = policy
+        if deps[i].Probe == nil && policy == dependencyRequired {
+            return nil, errors.New(errors.ErrConfiguration,
+                fmt.Sprintf("%s is required at startup but not configured", deps[i].Name))
+        }
+    }
+    return deps, nil
+}
+
+// waitForDependencies probes the required and degraded dependencies until
+// they all answer or timeout passes. It returns the ones still down, whether
+// the router may start without them is decided once it initialized.
+func waitForDependencies(ctx context.Context, deps []dependency, timeout time.Duration) []string {
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+    
+    pending := make(map[string]dependency)
+    for _, dep := range deps {
+        if dep.Policy != dependencyOptional && dep.Probe != nil {
+            pending[dep.Name] = dep
+        }
+    }
+    
+    start := time.Now()
+    ticker := time.NewTicker(dependencyProbeInterval)
+    defer ticker.Stop()
+    
+    for {
+        for name, dep := range pending {
+            probeCtx, cancelProbe := context.WithTimeout(ctx, dependencyProbeInterval)
+            err := dep.Probe(probeCtx)
+            cancelProbe()
+    
+            if err == nil {
+                logger.WithField("dependency", name).WithField("waited", time.Since(start).Round(time.Second).String()).Info("Dependency is up")
+                delete(pending, name)
+                continue
+            }
+            logger.WithField("dependency", name).WithField("address", dep.Address).WithField("error", err.Error()).Info("Waiting for dependency")
+        }
+        if len(pending) == 0 {
+            return nil
+        }
+    
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            var down []string
+            for _, dep := range deps {
+                if _, ok := pending[dep.Name]; ok {
+                    down = append(down, dep.Name)
+                }
+            }
+            logger.WithField("dependencies", strings.Join(down, ", ")).WithField("timeout", timeout.String()).Warn("Gave up waiting for dependencies")
+            return down
+        }
+    }
+}
+
+// checkDependencies reports each dependency as the initialized router sees it
+func checkDependencies(ctx context.Context, deps []dependency) []dependencyStatus {
+    ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+    defer cancel()
+    
+    statuses := make([]dependencyStatus, 0, len(deps))
+    for _, dep := range deps {
+        status := dependencyStatus{dependency: dep}
+    
+        switch dep.Name {
+        case "database":
+            if err := database.PingContext(ctx); err != nil {
+                status.Detail = err.Error()
+            } else {
+                status.Up = true
+                status.Detail = fmt.Sprintf("%s/%s", dep.Address, viper.GetString("database.database"))
+            }
+        case "redis":
+            if latency, err := cache.Ping(ctx); err != nil {
+                status.Detail = "unavailable, caching, locks and shared state are local to this node"
+            } else {
+                status.Up = true
+                status.Detail = fmt.Sprintf("%s, %s", dep.Address, latency.Round(time.Millisecond))
+            }
+        case "ami":
+            switch {
+            case amiManager == nil:
+                status.Detail = "not configured, asterisk.ami.host is empty"
+            case amiManager.IsConnected() && amiManager.IsLoggedIn():
+                status.Up = true
+                status.Detail = "logged in to " + dep.Address
+            default:
+                status.Detail = fmt.Sprintf("cannot log in to %s, retrying in the background", dep.Address)
+            }
+        }
+        statuses = append(statuses, status)
+    }
+    return statuses
+}
+
+// printStartupSummary prints the dependency matrix and logs each dependency
+func printStartupSummary(statuses []dependencyStatus) {
+    nameWidth, policyWidth := len("Dependency"), len("Policy")
+    for _, s := range statuses {
+        if len(s.Name) > nameWidth {
+            nameWidth = len(s.Name)
+        }
+        if len(s.Policy) > policyWidth {
+            policyWidth = len(s.Policy)
+        }
+    }
+    
+    fmt.Println("Startup dependencies:")
+    fmt.Printf("  %-*s  %-*s  %-6s  %s\n", nameWidth, "Dependency", policyWidth, "Policy", "Status", "Detail")
+    for _, s := range statuses {
+        state := "down"
+        if s.Up {
+            state = "up"
+        }
+        fmt.Printf("  %-*s  %-*s  %-6s  %s\n", nameWidth, s.Name, policyWidth, s.Policy, state, s.Detail)
+    
+        log := logger.WithField("dependency", s.Name).WithField("policy", s.Policy).WithField("detail", s.Detail)
+        switch {
+        case s.Up:
+            log.Info("Dependency up")
+        case s.Policy == dependencyOptional:
+            log.Info("Optional dependency down")
+        default:
+            log.Warn("Dependency down")
+        }
+    }
+}
+
+// runPreflight waits for the dependencies when asked to, before anything
+// connects. finish prints the summary once the router initialized and
+// refuses to start without a required dependency.
+func runPreflight(ctx context.Context) (finish func()) {
+    deps, err := startupDependencies()
+    if err != nil {
+        logger.WithError(err).Fatal("Invalid startup dependency policy")
+    }
+    
+    // -init-db only needs the database
+    if initDB {
+        deps = deps[:1]
+    }
+    
+    if waitForDeps || viper.GetBool("startup.wait_for_deps") {
+        timeout := waitTimeout
+        if timeout <= 0 {
+            timeout = viper.GetDuration("startup.wait_timeout")
+        }
+        waitForDependencies(ctx, deps, timeout)
+    }
+    
+    return func() {
+        statuses := checkDependencies(ctx, deps)
+        printStartupSummary(statuses)
+    
+        for _, s := range statuses {
+            if !s.Up && s.Policy == dependencyRequired {
+                logger.WithField("dependency", s.Name).WithField("detail", s.Detail).Fatal("Required dependency unavailable")
+            }
+        }
+    }
+}
+
+// registerDependencyCheck adds the readiness check of a dependency by its
+// startup policy: required fails readiness, degraded only degrades it
+func registerDependencyCheck(name string, check health.Checker) {
+    policy, err := dependencyPolicy(name)
+    if err != nil {
+        logger.WithError(err).Warn("Dependency readiness check skipped")
+        return
+    }
+    
+    switch policy {
+    case dependencyRequired:
+        healthSvc.RegisterReadinessCheck(name, check)
+    case dependencyDegraded:
+        healthSvc.RegisterDegradedCheck(name, check)
+    }
+}
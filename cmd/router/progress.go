@@ -0,0 +1,127 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "os/signal"
+    "strings"
+    "syscall"
+    "time"
+)
+
+// signalContext is cancelled on Ctrl+C or SIGTERM so long operations can roll back
+func signalContext() (context.Context, context.CancelFunc) {
+    return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// progress renders a progress bar on stderr, or a line per 10% when stderr is not a terminal
+type progress struct {
+    label    string
+    total    int
+    done     int
+    start    time.Time
+    last     time.Time
+    terminal bool
+    step     int
+}
+
+func newProgress(label string, total int) *progress {
+    terminal := false
+    if info, err := os.Stderr.Stat(); err == nil {
+        terminal = info.Mode()&os.ModeCharDevice != 0
+    }
+    
+    p := &progress{
+        label:    label,
+        total:    total,
+        start:    time.Now(),
+        terminal: terminal,
+    }
+    p.render()
+    return p
+}
+
+// Add advances the bar by n items
+func (p *progress) Add(n int) {
+    p.done += n
+    
+    // Redraw at most 10 times a second
+    if p.terminal && p.done < p.total && time.Since(p.last) < 100*time.Millisecond {
+        return
+    }
+    p.render()
+}
+
+// Finish draws the final state and ends the line
+func (p *progress) Finish() {
+    p.render()
+    if p.terminal {
+        fmt.Fprintln(os.Stderr)
+    }
+}
+
+func (p *progress) percent() int {
+    if p.total <= 0 {
+        return 100
+    }
+    return p.done * 100 / p.total
+}
+
+func (p *progress) render() {
+    p.last = time.Now()
+    percent := p.percent()
+    
+    if !p.terminal {
+        if step := percent / 10; step > p.step || p.done == 0 {
+            p.step = step
+            fmt.Fprintf(os.Stderr, "%s: %d%% (%d/%d)\n", p.label, percent, p.done, p.total)
+        }
+        return
+    }
+    
+    const width = 30
+    filled := width * percent / 100
+    bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+    
+    eta := ""
+    if elapsed := time.Since(p.start); p.done > 0 && p.done < p.total {
+        remaining := time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+        eta = " ETA " + remaining.Round(time.Second).String()
+    }
+    
+    fmt.Fprintf(os.Stderr, "\r%s [%s] %3d%% (%d/%d)%s   ", p.label, bar, percent, p.done, p.total, eta)
+}
+
+// operationSummary is printed at the end of every long-running CLI operation
+type operationSummary struct {
+    Operation  string
+    Total      int
+    Succeeded  int
+    Failed     int
+    Skipped    int
+    Cancelled  bool
+    RolledBack bool
+    Started    time.Time
+}
+
+func (s *operationSummary) Print() {
+    status := green("completed")
+    if s.Cancelled {
+        status = yellow("cancelled")
+    }
+    
+    fmt.Printf("\n%s %s\n", bold(s.Operation), status)
+    fmt.Printf("  Total:     %d\n", s.Total)
+    fmt.Printf("  Succeeded: %d\n", s.Succeeded)
+    if s.Failed > 0 {
+        fmt.Printf("  Failed:    %s\n", red(fmt.Sprintf("%d", s.Failed)))
+    }
+    if s.Skipped > 0 {
+        fmt.Printf("  Skipped:   %d\n", s.Skipped)
+    }
+    if s.RolledBack {
+        fmt.Printf("  %s\n", yellow("All changes were rolled back"))
+    }
+    fmt.Printf("  Elapsed:   %s\n", time.Since(s.Started).Round(time.Millisecond))
+}
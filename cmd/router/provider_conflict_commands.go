@@ -0,0 +1,67 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/provider"
+)
+
+func createProviderConflictsCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "conflicts",
+        Short: "Find providers whose addresses overlap",
+        Long: `Find providers whose addresses overlap.
+
+Asterisk identifies the endpoint of an incoming call by its source address, so
+two providers at the same host and port, or an address matched by the
+identify entries of two endpoints, send calls to whichever endpoint it finds
+first. New and updated providers are checked for this; the audit finds the
+overlaps created before, or by hand in the ARA tables. It exits non-zero when
+any are found.`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            conflicts, err := providerSvc.FindConflicts(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to check provider conflicts: %v", err)
+            }
+    
+            if len(conflicts) == 0 {
+                fmt.Printf("%s No provider conflicts\n", green("✓"))
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Conflict", "Address", "Providers"})
+            table.SetBorder(false)
+    
+            for _, c := range conflicts {
+                table.Append([]string{formatConflictKind(c.Kind), c.Value, red(strings.Join(c.Providers, ", "))})
+            }
+    
+            table.Render()
+            fmt.Println()
+            return fmt.Errorf("%d provider conflicts found", len(conflicts))
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func formatConflictKind(kind string) string {
+    switch kind {
+    case provider.ConflictHostPort:
+        return "same host and port"
+    case provider.ConflictIdentifyIP:
+        return "same identify address"
+    }
+    return kind
+}
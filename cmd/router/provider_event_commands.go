@@ -0,0 +1,130 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createProviderEventsCommand() *cobra.Command {
+    var (
+        filter models.ProviderEventFilter
+        since  time.Duration
+        around string
+        window time.Duration
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "events [name]",
+        Short: "Show the lifecycle event timeline of a provider",
+        Long: `Show the lifecycle event timeline of a provider, newest first, or of every
+provider without a name. Events are ` + strings.Join(models.ProviderEventTypes, ", ") + `.`,
+        Example: `  router provider events s3-provider1 --since 24h
+  router provider events --type health_down --since 168h
+  router provider events s4-provider1 --around "2026-03-02 14:05" --window 30m`,
+        Args: cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if len(args) == 1 {
+                filter.Provider = args[0]
+            }
+            if filter.EventType != "" && !containsValue(models.ProviderEventTypes, filter.EventType) {
+                return fmt.Errorf("unknown event type %q", filter.EventType)
+            }
+    
+            switch {
+            case around != "":
+                at, err := parseEventTime(around)
+                if err != nil {
+                    return err
+                }
+                filter.Since = at.Add(-window)
+                filter.Until = at.Add(window)
+            case since > 0:
+                filter.Since = time.Now().Add(-since)
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            events, err := providerSvc.ListProviderEvents(ctx, filter)
+            if err != nil {
+                return fmt.Errorf("failed to list provider events: %v", err)
+            }
+    
+            if len(events) == 0 {
+                fmt.Println("No provider events")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Time", "Provider", "Event", "By", "Detail"})
+            table.SetBorder(false)
+            table.SetAutoWrapText(false)
+    
+            for _, e := range events {
+                table.Append([]string{
+                    e.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+                    e.ProviderName,
+                    colorEventType(e.EventType),
+                    orDash(e.Actor),
+                    orDash(e.Detail),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&filter.EventType, "type", "", "Only show one event type")
+    cmd.Flags().DurationVar(&since, "since", 0, "Only show events this recent")
+    cmd.Flags().StringVar(&around, "around", "", "Show events around this time (RFC3339 or \"2006-01-02 15:04\")")
+    cmd.Flags().DurationVar(&window, "window", 30*time.Minute, "Time either side of --around")
+    cmd.Flags().IntVar(&filter.Limit, "limit", 50, "Maximum number of events")
+    
+    return cmd
+}
+
+// parseEventTime accepts RFC3339 or a local date and time to the minute
+func parseEventTime(value string) (time.Time, error) {
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+    t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("invalid time %q: use RFC3339 or \"2006-01-02 15:04\"", value)
+    }
+    return t, nil
+}
+
+func colorEventType(eventType string) string {
+    switch eventType {
+    case models.ProviderEventHealthDown, models.ProviderEventQuarantined, models.ProviderEventDrained,
+        models.ProviderEventDeleted:
+        return red(eventType)
+    case models.ProviderEventHealthUp, models.ProviderEventQuarantineReleased, models.ProviderEventEnabled,
+        models.ProviderEventCreated:
+        return green(eventType)
+    default:
+        return yellow(eventType)
+    }
+}
+
+func containsValue(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "time"
+    
+    "github.com/spf13/cobra"
+    "gopkg.in/yaml.v3"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/provider"
+)
+
+func createProviderImportCommand() *cobra.Command {
+    var (
+        file   string
+        dryRun bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "import",
+        Short: "Create or update providers from a YAML file",
+        Long: `Create or update providers and their ARA endpoints from a YAML file.
+
+Each provider is applied in its own transaction, a failing entry is reported
+and the import continues. Fields left out of an existing provider keep their
+current value. PJSIP is reloaded once at the end.`,
+        Example: `  router provider import -f providers.yaml --dry-run
+  router provider import -f providers.yaml
+  
+  # providers.yaml
+  providers:
+    - name: s3-carrier-a
+      type: intermediate
+      host: 10.0.0.10
+      auth_type: ip
+      codecs: [ulaw, alaw]
+      max_channels: 200
+      tags:
+        tier: premium`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            var in io.Reader = os.Stdin
+            if file != "-" {
+                f, err := os.Open(file)
+                if err != nil {
+                    return fmt.Errorf("failed to open %s: %v", file, err)
+                }
+                defer f.Close()
+                in = f
+            }
+            
+            var doc provider.ProviderFile
+            decoder := yaml.NewDecoder(in)
+            decoder.KnownFields(true)
+            if err := decoder.Decode(&doc); err != nil {
+                return fmt.Errorf("failed to parse %s: %v", file, err)
+            }
+            if len(doc.Providers) == 0 {
+                return fmt.Errorf("no providers found in %s", file)
+            }
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            operation := "Provider import"
+            if dryRun {
+                operation += " (dry run)"
+            }
+            summary := &operationSummary{Operation: operation, Total: len(doc.Providers), Started: time.Now()}
+            counts := make(map[string]int)
+            
+            bar := newProgress("Importing providers", len(doc.Providers))
+            results := providerSvc.ImportProviders(ctx, doc.Providers, dryRun, func(r *provider.ImportResult) {
+                bar.Add(1)
+            })
+            bar.Finish()
+            
+            for _, r := range results {
+                counts[r.Action]++
+                switch r.Action {
+                case provider.ImportFailed:
+                    summary.Failed++
+                    fmt.Printf("%s %s: %v\n", red("✗"), r.Name, r.Err)
+                case provider.ImportUnchanged:
+                    summary.Skipped++
+                default:
+                    summary.Succeeded++
+                    fmt.Printf("%s %s %s\n", green("✓"), r.Name, r.Action)
+                }
+            }
+            if len(results) < len(doc.Providers) {
+                summary.Cancelled = true
+                summary.Skipped += len(doc.Providers) - len(results)
+            }
+            
+            summary.Print()
+            fmt.Printf("  Created: %d, Updated: %d, Unchanged: %d\n",
+                counts[provider.ImportCreated], counts[provider.ImportUpdated], counts[provider.ImportUnchanged])
+            
+            if summary.Failed > 0 {
+                return fmt.Errorf("%d providers failed to import", summary.Failed)
+            }
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVarP(&file, "file", "f", "", "YAML file to import (- for stdin)")
+    cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would change without writing")
+    cmd.MarkFlagRequired("file")
+    
+    return cmd
+}
+
+func createProviderExportCommand() *cobra.Command {
+    var (
+        output         string
+        providerType   string
+        tagPairs       []string
+        includeSecrets bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "export",
+        Short: "Export providers to a YAML file usable by provider import",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            filter := make(map[string]interface{})
+            if providerType != "" {
+                filter["type"] = providerType
+            }
+            if len(tagPairs) > 0 {
+                tags, err := models.ParseTags(tagPairs, true)
+                if err != nil {
+                    return err
+                }
+                filter["tags"] = tags
+            }
+            
+            providers, err := providerSvc.ListProviders(ctx, filter)
+            if err != nil {
+                return fmt.Errorf("failed to list providers: %v", err)
+            }
+            
+            doc := provider.ProviderFile{}
+            for _, p := range providers {
+                doc.Providers = append(doc.Providers, provider.SpecFromProvider(p, includeSecrets))
+            }
+            
+            var out io.Writer = os.Stdout
+            if output != "-" {
+                f, err := os.Create(output)
+                if err != nil {
+                    return fmt.Errorf("failed to create %s: %v", output, err)
+                }
+                defer f.Close()
+                out = f
+            }
+            
+            encoder := yaml.NewEncoder(out)
+            encoder.SetIndent(2)
+            if err := encoder.Encode(doc); err != nil {
+                return fmt.Errorf("failed to write YAML: %v", err)
+            }
+            encoder.Close()
+            
+            if output != "-" {
+                fmt.Printf("%s Exported %d providers to %s\n", green("✓"), len(doc.Providers), output)
+                if !includeSecrets {
+                    fmt.Println("  Passwords were left out, use --include-secrets to export them")
+                }
+            }
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVarP(&output, "output", "o", "-", "Output file (- for stdout)")
+    cmd.Flags().StringVarP(&providerType, "type", "t", "", "Only export this provider type")
+    cmd.Flags().StringArrayVar(&tagPairs, "tag", nil, "Only export providers carrying tag key=value or key (repeatable)")
+    cmd.Flags().BoolVar(&includeSecrets, "include-secrets", false, "Include SIP passwords in the export")
+    
+    return cmd
+}
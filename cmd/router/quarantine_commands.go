@@ -0,0 +1,80 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "time"
+    
+    "github.com/spf13/cobra"
+    "github.com/olekukonko/tablewriter"
+)
+
+func createProviderQuarantinedCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "quarantined",
+        Short: "List providers quarantined for failing verification",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            quarantines, err := routerSvc.GetQuarantineManager().ListQuarantined(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to list quarantined providers: %v", err)
+            }
+            
+            if len(quarantines) == 0 {
+                fmt.Println("No quarantined providers")
+                return nil
+            }
+            
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Provider", "Failures", "Reason", "Quarantined", "Since"})
+            table.SetBorder(false)
+            
+            for _, q := range quarantines {
+                table.Append([]string{
+                    red(q.ProviderName),
+                    fmt.Sprintf("%d", q.FailureCount),
+                    q.Reason,
+                    q.QuarantinedAt.Format("2006-01-02 15:04:05"),
+                    time.Since(q.QuarantinedAt).Round(time.Second).String(),
+                })
+            }
+            
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createProviderReleaseCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "release <name>",
+        Short: "Release a quarantined provider",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            releasedBy := os.Getenv("USER")
+            if releasedBy == "" {
+                releasedBy = "cli"
+            }
+            
+            if err := routerSvc.GetQuarantineManager().Release(ctx, args[0], releasedBy); err != nil {
+                return fmt.Errorf("failed to release provider: %v", err)
+            }
+            
+            fmt.Printf("%s Provider '%s' released from quarantine\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+func createRateCommands() *cobra.Command {
+    ratesCmd := &cobra.Command{
+        Use:   "rates",
+        Short: "Manage customer rate decks",
+        Long: `Manage the rate decks customers are billed from.
+
+A customer is an inbound provider. Every finished call is rated: the customer
+is billed the billable minutes at the rate of the longest prefix of its deck
+matching the number dialled, plus the connection fee of the line when the call
+was answered, or at the provider's cost_per_minute when no line matches. The
+cost is the DID and provider rates of each leg. Billed amount, cost and margin
+are stored on the call record and totalled by:
+  router stats --billing --period 7d`,
+    }
+    
+    ratesCmd.AddCommand(
+        createRateSetCommand(),
+        createRateListCommand(),
+        createRateRemoveCommand(),
+        createRateImportCommand(),
+    )
+    
+    return ratesCmd
+}
+
+func createRateSetCommand() *cobra.Command {
+    var rate models.CustomerRate
+    
+    cmd := &cobra.Command{
+        Use:   "set <customer> <prefix> <rate>",
+        Short: "Set the per minute rate of a customer for a destination prefix",
+        Example: `  router rates set s1-customer 44 0.012
+  router rates set s1-customer 447 0.085 --connection-fee 0.01 --description "UK mobile"`,
+        Args: cobra.ExactArgs(3),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            value, err := strconv.ParseFloat(args[2], 64)
+            if err != nil {
+                return fmt.Errorf("invalid rate %q", args[2])
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            rate.Customer, rate.Prefix, rate.Rate = args[0], args[1], value
+            if err := routerSvc.SetCustomerRate(ctx, &rate, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set rate: %v", err)
+            }
+    
+            fmt.Printf("%s Rate of %s for %s set to %s per minute\n", green("✓"), rate.Customer, rate.Prefix,
+                formatRate(rate.Rate, rate.Currency))
+            return nil
+        },
+    }
+    
+    cmd.Flags().Float64Var(&rate.ConnectionFee, "connection-fee", 0, "Charge per answered call")
+    cmd.Flags().StringVar(&rate.Currency, "currency", "", "Currency of the rate, the reporting currency by default")
+    cmd.Flags().StringVar(&rate.Description, "description", "", "Destination name")
+    
+    return cmd
+}
+
+func createRateListCommand() *cobra.Command {
+    var outputJSON bool
+    
+    cmd := &cobra.Command{
+        Use:   "list [customer]",
+        Short: "List customer rate decks",
+        Args:  cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            customer := ""
+            if len(args) > 0 {
+                customer = args[0]
+            }
+    
+            rates, err := routerSvc.ListCustomerRates(ctx, customer)
+            if err != nil {
+                return fmt.Errorf("failed to list rates: %v", err)
+            }
+    
+            if outputJSON {
+                data, _ := json.MarshalIndent(rates, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+    
+            if len(rates) == 0 {
+                fmt.Println("No customer rates")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Customer", "Prefix", "Rate", "Connection Fee", "Description", "Updated By", "Updated"})
+            table.SetBorder(false)
+    
+            for _, r := range rates {
+                fee := "-"
+                if r.ConnectionFee > 0 {
+                    fee = formatRate(r.ConnectionFee, r.Currency)
+                }
+                table.Append([]string{
+                    r.Customer,
+                    r.Prefix,
+                    formatRate(r.Rate, r.Currency),
+                    fee,
+                    orDash(r.Description),
+                    orDash(r.UpdatedBy),
+                    r.UpdatedAt.Format("2006-01-02 15:04:05"),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output as JSON")
+    
+    return cmd
+}
+
+func createRateRemoveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove <customer> <prefix>",
+        Short: "Remove a prefix from a customer's rate deck",
+        Args:  cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteCustomerRate(ctx, args[0], args[1], audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove rate: %v", err)
+            }
+    
+            fmt.Printf("%s Rate for %s removed from %s\n", green("✓"), args[1], args[0])
+            return nil
+        },
+    }
+}
+
+func createRateImportCommand() *cobra.Command {
+    var replace bool
+    
+    cmd := &cobra.Command{
+        Use:   "import <customer> <file.csv>",
+        Short: "Import a customer's rate deck from a CSV file",
+        Long: `Import a customer's rate deck from a CSV file (- for stdin).
+
+Each line holds a prefix and a per minute rate, optionally followed by a
+connection fee, a currency and a description. A header line is skipped. Lines
+of the deck are updated by prefix; with --replace the prefixes missing from
+the file are removed, so a supplier's full deck can be loaded as it changes.`,
+        Example: `  router rates import s1-customer deck.csv --replace
+  printf '44,0.012\n447,0.085,0.01,EUR,UK mobile\n' | router rates import s1-customer -`,
+        Args: cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            in := os.Stdin
+            if args[1] != "-" {
+                f, err := os.Open(args[1])
+                if err != nil {
+                    return fmt.Errorf("failed to open rate deck: %v", err)
+                }
+                defer f.Close()
+                in = f
+            }
+    
+            rates, err := router.ParseRateDeck(in)
+            if err != nil {
+                return fmt.Errorf("failed to read rate deck: %v", err)
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            count, err := routerSvc.ImportCustomerRates(ctx, args[0], rates, replace, audit.CurrentUser())
+            if err != nil {
+                return fmt.Errorf("failed to import rates: %v", err)
+            }
+    
+            fmt.Printf("%s %d rates imported to %s\n", green("✓"), count, args[0])
+            return nil
+        },
+    }
+    
+    cmd.Flags().BoolVar(&replace, "replace", false, "Remove the prefixes missing from the file")
+    
+    return cmd
+}
+
+func formatRate(rate float64, currency string) string {
+    value := strconv.FormatFloat(rate, 'f', -1, 64)
+    if currency == "" {
+        return value
+    }
+    return value + " " + currency
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// rateLimitTarget holds the --route, --provider and --prefix flags, one of
+// which names what a limit applies to
+type rateLimitTarget struct {
+    route    string
+    provider string
+    prefix   string
+}
+
+func (t *rateLimitTarget) addFlags(cmd *cobra.Command) {
+    cmd.Flags().StringVar(&t.route, "route", "", "Limit of a route")
+    cmd.Flags().StringVar(&t.provider, "provider", "", "Limit of a provider")
+    cmd.Flags().StringVar(&t.prefix, "prefix", "", "Limit of destinations starting with a prefix")
+}
+
+// scope returns the scope and value of the limit named by the flags
+func (t *rateLimitTarget) scope() (string, string, error) {
+    var scope, value string
+    set := 0
+    for _, flag := range []struct{ scope, value string }{
+        {models.RateLimitRoute, t.route},
+        {models.RateLimitProvider, t.provider},
+        {models.RateLimitPrefix, t.prefix},
+    } {
+        if flag.value != "" {
+            scope, value = flag.scope, flag.value
+            set++
+        }
+    }
+    if set != 1 {
+        return "", "", fmt.Errorf("exactly one of --route, --provider or --prefix is required")
+    }
+    return scope, value, nil
+}
+
+func createRateLimitCommands() *cobra.Command {
+    limitsCmd := &cobra.Command{
+        Use:   "limits",
+        Short: "Manage CPS and concurrent call limits",
+        Long: `Manage the CPS and concurrent call limits of routes, providers and
+destination prefixes.
+
+A new call counts against the limit of its route, of its intermediate and
+final providers and of the longest limited prefix of the number dialled. A
+call over any of them is rejected with RATE_LIMITED, which the dialplan
+answers with congestion; a provider at its limit is skipped when another
+provider of its group can take the call. CPS is counted over the last second.
+Limits are stored in the database and picked up by every router within
+router.rate_limits.refresh_interval; each router counts the calls it routes.`,
+    }
+    
+    limitsCmd.AddCommand(
+        createRateLimitSetCommand(),
+        createRateLimitShowCommand(),
+        createRateLimitRemoveCommand(),
+    )
+    
+    return limitsCmd
+}
+
+func createRateLimitSetCommand() *cobra.Command {
+    var (
+        target rateLimitTarget
+        limit  models.RateLimit
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "set",
+        Short: "Set the limit of a route, provider or destination prefix",
+        Example: `  router limits set --route main-route --max-cps 20
+  router limits set --provider s3-provider1 --max-cps 5 --max-concurrent 100
+  router limits set --prefix 4420 --max-concurrent 30`,
+        Args: cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            scope, value, err := target.scope()
+            if err != nil {
+                return err
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            limit.Scope, limit.Value = scope, value
+            if err := routerSvc.SetRateLimit(ctx, &limit, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set rate limit: %v", err)
+            }
+    
+            fmt.Printf("%s Limit of %s '%s' set, max CPS %s, max concurrent calls %s\n",
+                green("✓"), limit.Scope, limit.Value, formatRateLimitCPS(limit.MaxCPS), formatRateLimitConcurrent(limit.MaxConcurrent))
+            return nil
+        },
+    }
+    
+    target.addFlags(cmd)
+    cmd.Flags().Float64Var(&limit.MaxCPS, "max-cps", 0, "Call setups per second (0 for no limit)")
+    cmd.Flags().IntVar(&limit.MaxConcurrent, "max-concurrent", 0, "Concurrent calls (0 for no limit)")
+    
+    return cmd
+}
+
+func createRateLimitShowCommand() *cobra.Command {
+    var (
+        scope      string
+        outputJSON bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "show",
+        Short: "Show the limits with the live usage of this router",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            switch scope {
+            case "", models.RateLimitRoute, models.RateLimitProvider, models.RateLimitPrefix:
+            default:
+                return fmt.Errorf("invalid scope %q, expected route, provider or prefix", scope)
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            limits, err := routerSvc.ListRateLimits(ctx, scope)
+            if err != nil {
+                return fmt.Errorf("failed to get rate limits: %v", err)
+            }
+    
+            if outputJSON {
+                data, _ := json.MarshalIndent(limits, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+    
+            if len(limits) == 0 {
+                fmt.Println("No rate limits")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Scope", "Value", "Max CPS", "Max Concurrent", "CPS", "Active", "Updated By", "Updated"})
+            table.SetBorder(false)
+    
+            for _, l := range limits {
+                active := strconv.Itoa(l.ActiveCalls)
+                if l.MaxConcurrent > 0 && l.ActiveCalls >= l.MaxConcurrent {
+                    active = red(active)
+                }
+                cps := fmt.Sprintf("%.0f", l.CPS)
+                if l.MaxCPS > 0 && l.CPS >= l.MaxCPS {
+                    cps = red(cps)
+                }
+    
+                table.Append([]string{
+                    l.Scope,
+                    l.Value,
+                    formatRateLimitCPS(l.MaxCPS),
+                    formatRateLimitConcurrent(l.MaxConcurrent),
+                    cps,
+                    active,
+                    orDash(l.UpdatedBy),
+                    l.UpdatedAt.Format("2006-01-02 15:04:05"),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&scope, "scope", "", "Only route, provider or prefix limits")
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output as JSON")
+    
+    return cmd
+}
+
+func createRateLimitRemoveCommand() *cobra.Command {
+    var target rateLimitTarget
+    
+    cmd := &cobra.Command{
+        Use:     "remove",
+        Short:   "Remove the limit of a route, provider or destination prefix",
+        Example: `  router limits remove --prefix 4420`,
+        Args:    cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            scope, value, err := target.scope()
+            if err != nil {
+                return err
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteRateLimit(ctx, scope, value, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove rate limit: %v", err)
+            }
+    
+            fmt.Printf("%s Limit of %s '%s' removed\n", green("✓"), scope, value)
+            return nil
+        },
+    }
+    
+    target.addFlags(cmd)
+    
+    return cmd
+}
+
+func formatRateLimitCPS(cps float64) string {
+    if cps <= 0 {
+        return "-"
+    }
+    return strconv.FormatFloat(cps, 'f', -1, 64)
+}
+
+func formatRateLimitConcurrent(calls int) string {
+    if calls <= 0 {
+        return "-"
+    }
+    return strconv.Itoa(calls)
+}
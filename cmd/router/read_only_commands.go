@@ -0,0 +1,158 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+)
+
+// readOnlyAnnotation marks the commands that change nothing, the only ones
+// allowed while the management plane is read-only. Commands without it are
+// refused, so a new command has to be marked where it is defined to run in a
+// freeze. Read-only mode itself is marked too, or it could never be lifted.
+const readOnlyAnnotation = "read_only"
+
+// changesNothing are the annotations of a command marked read-only
+var changesNothing = map[string]string{readOnlyAnnotation: "true"}
+
+// cliReadOnly tells whether the command being run is marked read-only
+var cliReadOnly bool
+
+// checkCommandWritable refuses the running command while the management
+// plane is read-only, unless it changes nothing
+func checkCommandWritable(ctx context.Context) error {
+    if cliReadOnly {
+        return nil
+    }
+    return routerSvc.CheckWritable(ctx)
+}
+
+func createReadOnlyCommands() *cobra.Command {
+    readOnlyCmd := &cobra.Command{
+        Use:   "read-only",
+        Short: "Freeze the management plane",
+        Long: `Freeze the management plane for a change freeze or an audit.
+
+While read-only, every command and API request that would change providers,
+routes, DIDs or any other setting is refused with READ_ONLY, on every node;
+listings and reports keep working and calls keep being routed, rated and
+recorded as usual. Kill switches are management changes too: lift read-only
+mode to engage one. security.read_only sets it from the configuration
+instead, it can then only be lifted there.`,
+    }
+    
+    readOnlyCmd.AddCommand(
+        createReadOnlyOnCommand(),
+        createReadOnlyOffCommand(),
+        createReadOnlyStatusCommand(),
+    )
+    
+    return readOnlyCmd
+}
+
+func createReadOnlyOnCommand() *cobra.Command {
+    var reason string
+    
+    cmd := &cobra.Command{
+        Use:     "on",
+        Short:   "Refuse every management change",
+        Example: `  router read-only on --reason "year end audit"`,
+        Args:    cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.SetReadOnly(ctx, true, reason, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to enable read-only mode: %v", err)
+            }
+    
+            fmt.Printf("%s Management plane is read-only, calls keep routing\n", yellow("■"))
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&reason, "reason", "", "Why changes are frozen, shown to those refused")
+    
+    return cmd
+}
+
+func createReadOnlyOffCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "off",
+        Short: "Allow management changes again",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.SetReadOnly(ctx, false, "", audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to disable read-only mode: %v", err)
+            }
+    
+            fmt.Printf("%s Management changes are allowed again\n", green("✓"))
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createReadOnlyStatusCommand() *cobra.Command {
+    var outputJSON bool
+    
+    cmd := &cobra.Command{
+        Use:   "status",
+        Short: "Show whether the management plane is read-only",
+        Args:  cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            mode, err := routerSvc.ReadOnlyMode(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to get read-only mode: %v", err)
+            }
+    
+            if outputJSON {
+                data, _ := json.MarshalIndent(mode, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+    
+            if !mode.Enabled {
+                fmt.Printf("%s Management plane is writable\n", green("✓"))
+                return nil
+            }
+    
+            fmt.Printf("%s Management plane is read-only\n", yellow("■"))
+            if mode.Configured {
+                fmt.Println("  Set by:  security.read_only in the configuration")
+            }
+            if mode.SetBy != "" {
+                fmt.Printf("  Set by:  %s at %s\n", mode.SetBy, mode.SetAt.Format("2006-01-02 15:04:05"))
+            }
+            if mode.Reason != "" {
+                fmt.Printf("  Reason:  %s\n", mode.Reason)
+            }
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output as JSON")
+    
+    return cmd
+}
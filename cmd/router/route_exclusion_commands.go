@@ -0,0 +1,96 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+)
+
+func createRouteExcludeCommand() *cobra.Command {
+    var (
+        add    bool
+        remove bool
+        clear  bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "exclude <route> [provider...]",
+        Short: "Set the providers a route never dials",
+        Long: `Set the providers a route never dials, whatever its legs name.
+
+Exclusions are applied to the providers a leg resolves to, after groups and
+the groups nested in them are flattened: a provider excluded on the route is
+never picked by it, even while it is a member of the group the route dials.
+A leg left with no provider fails the call over to the failover routes or
+rejects it, an excluded provider is never used as a fallback. Unanswered
+legs retry on the providers not excluded, and synthetic probes of the route
+skip excluded providers too.
+
+The providers given replace the exclusions of the route, with --add they
+are excluded on top of them and with --remove they are dialed again.`,
+        Example: `  router route exclude acme s3-carrier-x
+  router route exclude acme s4-carrier-y --add
+  router route exclude acme s3-carrier-x --remove
+  router route exclude acme --clear`,
+        Args: cobra.MinimumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            providers := args[1:]
+            switch {
+            case add && remove:
+                return fmt.Errorf("--add and --remove can't be used together")
+            case clear && len(providers) > 0:
+                return fmt.Errorf("--clear takes no providers")
+            case len(providers) == 0 && !clear:
+                return fmt.Errorf("no provider given, use --clear to remove the exclusions")
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            route, err := routerSvc.GetRoute(ctx, args[0])
+            if err != nil {
+                return fmt.Errorf("failed to get route: %v", err)
+            }
+    
+            excluded := providers
+            switch {
+            case add:
+                excluded = append(append([]string{}, route.ExcludedProviders...), providers...)
+            case remove:
+                excluded = nil
+                for _, name := range route.ExcludedProviders {
+                    if !containsValue(providers, name) {
+                        excluded = append(excluded, name)
+                    }
+                }
+            }
+    
+            if err := routerSvc.SetRouteExclusions(ctx, args[0], excluded, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set route exclusions: %v", err)
+            }
+    
+            route, err = routerSvc.GetRoute(ctx, args[0])
+            if err != nil {
+                return fmt.Errorf("failed to get route: %v", err)
+            }
+            if len(route.ExcludedProviders) == 0 {
+                fmt.Printf("%s Route '%s' dials every provider of its legs\n", green("✓"), args[0])
+                return nil
+            }
+            fmt.Printf("%s Route '%s' never dials %s\n", green("✓"), args[0], strings.Join(route.ExcludedProviders, ", "))
+            return nil
+        },
+    }
+    
+    cmd.Flags().BoolVar(&add, "add", false, "Exclude the providers on top of those already excluded")
+    cmd.Flags().BoolVar(&remove, "remove", false, "Dial the providers again")
+    cmd.Flags().BoolVar(&clear, "clear", false, "Remove every exclusion")
+    
+    return cmd
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    
+    "github.com/spf13/cobra"
+)
+
+func createRouteFailoverCommand() *cobra.Command {
+    var clear bool
+    
+    cmd := &cobra.Command{
+        Use:   "failover <route> [failover-route...]",
+        Short: "Set the routes a route fails over to",
+        Long: `Set the routes a call is moved to, in order, when its route fails it.
+
+A new call moves to the first failover route with providers for it when the
+route has no intermediate or final provider available. A call whose provider
+couldn't take it, Dial ended with CHANUNAVAIL or CONGESTION, moves to the
+next failover route it hasn't tried: the leg to S3 is dialled again on the
+providers and a DID of that route, the leg to S4 on its final providers.
+Disabled routes, routes closed by their schedule, routes stopped by a kill
+switch or blocking the destination, and test routes for production calls, or
+the reverse, are passed over. Only the failover routes of the route the call
+first matched are followed.`,
+        Example: `  router route failover main backup-1 backup-2
+  router route failover main --clear`,
+        Args: cobra.MinimumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            failover := args[1:]
+            if len(failover) == 0 && !clear {
+                return fmt.Errorf("no failover route given, use --clear to remove them")
+            }
+            if clear {
+                failover = nil
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.SetRouteFailover(ctx, args[0], failover); err != nil {
+                return fmt.Errorf("failed to set failover routes: %v", err)
+            }
+    
+            if len(failover) == 0 {
+                fmt.Printf("%s Route '%s' no longer fails over\n", green("✓"), args[0])
+                return nil
+            }
+            fmt.Printf("%s Route '%s' fails over to %s\n", green("✓"), args[0], strings.Join(failover, ", "))
+            return nil
+        },
+    }
+    
+    cmd.Flags().BoolVar(&clear, "clear", false, "Remove the failover routes")
+    
+    return cmd
+}
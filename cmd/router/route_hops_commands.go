@@ -0,0 +1,223 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createRouteHopsCommands() *cobra.Command {
+    hopsCmd := &cobra.Command{
+        Use:   "hops",
+        Short: "Send the calls of a route through several intermediates",
+        Long: `Send the calls of a route through several intermediates in turn before its
+final provider, S1 to S2 to S3 and back, to the next intermediate and back,
+and so on to S4.
+
+The route's own intermediate is hop 1, the hops added here follow from 2 in
+order. Each hop is dialed from the call the hop before brought back, on a
+DID of its own, and brings the call back to S2 like the first. A hop is sent
+DNIS-1 as ANI, through its own --ani-strip and --ani-add when given, and
+verifies its return leg with its own --verify and --strict, the route's
+otherwise. Hops are always sent their DID as DNIS.
+
+Hops apply to new calls. Route limits, load balancer active counts and
+rates cover the route's own intermediate, hops are picked by the route's
+load balance mode. Routes passing calls through have no intermediates to
+add hops to.`,
+    }
+    
+    hopsCmd.AddCommand(
+        createRouteHopsShowCommand(),
+        createRouteHopsAddCommand(),
+        createRouteHopsRemoveCommand(),
+        createRouteHopsClearCommand(),
+    )
+    
+    return hopsCmd
+}
+
+func createRouteHopsShowCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "show <route>",
+        Short: "Show the path calls of a route take",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            route, err := routerSvc.GetRoute(ctx, args[0])
+            if err != nil {
+                return fmt.Errorf("failed to get route: %v", err)
+            }
+    
+            fmt.Printf("Topology: %s\n\n", strings.Join(route.Topology(), " → "))
+            if route.PassThrough {
+                fmt.Println("Route passes calls straight to its final provider")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Hop", "Intermediate", "ANI", "Verification", "Strict Mode"})
+            table.SetBorder(false)
+    
+            table.Append([]string{
+                "1",
+                strings.TrimSpace(route.IntermediateProvider + " " + formatGroupIndicator(route.IntermediateIsGroup)),
+                "DNIS-1",
+                formatOptionalBool(route.VerificationEnabled),
+                formatOptionalBool(route.StrictMode),
+            })
+            for i, hop := range route.Hops {
+                table.Append([]string{
+                    strconv.Itoa(i + 2),
+                    strings.TrimSpace(hop.Provider + " " + formatGroupIndicator(hop.IsGroup)),
+                    formatHopANI(hop.Manipulations),
+                    formatHopBool(hop.VerificationEnabled),
+                    formatHopBool(hop.StrictMode),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createRouteHopsAddCommand() *cobra.Command {
+    var (
+        hop      models.RouteHop
+        aniStrip string
+        aniAdd   string
+        verify   bool
+        strict   bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "add <route> <provider>",
+        Short: "Add an intermediate after the last hop of a route",
+        Example: `  router route hops add uk-premium s3-carrier-b
+  router route hops add uk-premium s3-pool --group --ani-add 44 --strict`,
+        Args: cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            route, err := routerSvc.GetRoute(ctx, args[0])
+            if err != nil {
+                return fmt.Errorf("failed to get route: %v", err)
+            }
+    
+            hop.Provider = args[1]
+            if aniStrip != "" || aniAdd != "" {
+                hop.Manipulations = &models.NumberManipulations{ANIStripPrefix: aniStrip, ANIAddPrefix: aniAdd}
+            }
+            if cmd.Flags().Changed("verify") {
+                hop.VerificationEnabled = &verify
+            }
+            if cmd.Flags().Changed("strict") {
+                hop.StrictMode = &strict
+            }
+    
+            hops := append(append([]models.RouteHop{}, route.Hops...), hop)
+            if err := routerSvc.SetRouteHops(ctx, args[0], hops, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set route hops: %v", err)
+            }
+    
+            fmt.Printf("%s Route '%s' hands calls to %s as hop %d\n", green("✓"), args[0], hop.Provider, len(hops)+1)
+            return nil
+        },
+    }
+    
+    cmd.Flags().BoolVar(&hop.IsGroup, "group", false, "The provider is a group")
+    cmd.Flags().StringVar(&aniStrip, "ani-strip", "", "Prefix to strip from the ANI sent to the hop")
+    cmd.Flags().StringVar(&aniAdd, "ani-add", "", "Prefix to add to the ANI sent to the hop")
+    cmd.Flags().BoolVar(&verify, "verify", true, "Verify the hop's return leg (default the route's)")
+    cmd.Flags().BoolVar(&strict, "strict", false, "Reject calls the hop returns that fail verification (default the route's)")
+    
+    return cmd
+}
+
+func createRouteHopsRemoveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove <route> <hop>",
+        Short: "Remove a hop of a route, those after it move up",
+        Example: `  router route hops remove uk-premium 2`,
+        Args: cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            route, err := routerSvc.GetRoute(ctx, args[0])
+            if err != nil {
+                return fmt.Errorf("failed to get route: %v", err)
+            }
+    
+            number, err := strconv.Atoi(args[1])
+            if err != nil || number < 2 || number-2 >= len(route.Hops) {
+                return fmt.Errorf("route '%s' has no hop %s, its hops are numbered from 2 after its own intermediate", args[0], args[1])
+            }
+    
+            hops := append(append([]models.RouteHop{}, route.Hops[:number-2]...), route.Hops[number-1:]...)
+            if err := routerSvc.SetRouteHops(ctx, args[0], hops, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set route hops: %v", err)
+            }
+    
+            fmt.Printf("%s Hop %d (%s) removed from route '%s'\n", green("✓"), number, route.Hops[number-2].Provider, args[0])
+            return nil
+        },
+    }
+}
+
+func createRouteHopsClearCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "clear <route>",
+        Short: "Send the calls of a route through its own intermediate only",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.SetRouteHops(ctx, args[0], nil, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set route hops: %v", err)
+            }
+    
+            fmt.Printf("%s Route '%s' sends calls through its own intermediate only\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
+
+func formatHopANI(m *models.NumberManipulations) string {
+    if m.IsEmpty() {
+        return "DNIS-1"
+    }
+    return fmt.Sprintf("DNIS-1 -%s +%s", m.ANIStripPrefix, m.ANIAddPrefix)
+}
+
+func formatHopBool(b *bool) string {
+    if b == nil {
+        return "route"
+    }
+    return formatBool(*b)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+    "fmt"
+    
+    "github.com/spf13/cobra"
+)
+
+func createRoutePassThroughCommand() *cobra.Command {
+    var off bool
+    
+    cmd := &cobra.Command{
+        Use:   "passthrough <route>",
+        Short: "Send the calls of a route straight to its final provider",
+        Long: `Send the calls of a route straight to its final provider, carrying simple
+transit traffic without taking DIDs from the pool.
+
+New calls of the route skip the intermediate leg: no DID is allocated and the
+dialplan dials the final provider from S1's call, with the ANI and DNIS of the
+route's manipulations (router route add --ani-add, --dnis-strip and the
+others, or those of its policy). Parallel dial and serial forks don't apply.
+The route keeps its intermediate for when pass-through is turned off.
+
+Unanswered calls move to another final provider of the route, those the
+provider couldn't take to the final provider of a failover route. New calls
+the route has no final provider for fail over to routes that pass through as
+well.`,
+        Example: `  router route passthrough transit
+  router route passthrough transit --off`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.SetRoutePassThrough(ctx, args[0], !off); err != nil {
+                return fmt.Errorf("failed to set route pass-through: %v", err)
+            }
+    
+            if off {
+                fmt.Printf("%s Route '%s' sends calls through its intermediate\n", green("✓"), args[0])
+                return nil
+            }
+            fmt.Printf("%s Route '%s' sends calls straight to its final provider\n", green("✓"), args[0])
+            return nil
+        },
+    }
+    
+    cmd.Flags().BoolVar(&off, "off", false, "Send calls through the intermediate again")
+    
+    return cmd
+}
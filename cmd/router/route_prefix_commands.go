@@ -0,0 +1,159 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createRoutePrefixCommands() *cobra.Command {
+    prefixCmd := &cobra.Command{
+        Use:   "prefix",
+        Short: "Route calls by destination prefix",
+        Long: `Route calls by the prefix of the number dialed, whichever provider they
+come in from.
+
+The longest prefix matching the destination picks the route: with 58414 on
+route-ve and 58 on route-latam, 584141234567 goes to route-ve and 582121234567
+to route-latam. Prefixes are tried before the routes of the inbound provider;
+a destination matching no prefix, or only prefixes of disabled routes or
+routes closed by their schedule, is routed by its inbound provider as before.
+Prefixes are digits, a trailing * is allowed and + or 00 is dropped.`,
+    }
+    
+    prefixCmd.AddCommand(
+        createRoutePrefixAddCommand(),
+        createRoutePrefixListCommand(),
+        createRoutePrefixRemoveCommand(),
+    )
+    
+    return prefixCmd
+}
+
+func createRoutePrefixAddCommand() *cobra.Command {
+    var description string
+    
+    cmd := &cobra.Command{
+        Use:   "add <prefix> <route>",
+        Short: "Send calls to a destination prefix to a route",
+        Long:  "Send calls to a destination prefix to a route. A prefix already routed moves to the new route.",
+        Example: `  router route prefix add 58414* route-ve --description "Movistar Venezuela"
+  router route prefix add 1* route-us`,
+        Args: cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            prefix := &models.RoutePrefix{Prefix: args[0], Route: args[1], Description: description}
+            if err := routerSvc.AddRoutePrefix(ctx, prefix, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to add route prefix: %v", err)
+            }
+    
+            fmt.Printf("%s Calls to %s* go to route '%s'\n", green("✓"), prefix.Prefix, prefix.Route)
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&description, "description", "", "What the prefix is")
+    
+    return cmd
+}
+
+func createRoutePrefixListCommand() *cobra.Command {
+    var (
+        route  string
+        number string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "list",
+        Short: "List destination prefixes",
+        Example: `  router route prefix list
+  router route prefix list --route route-ve
+  router route prefix list --number 584141234567`,
+        Args: cobra.NoArgs,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if number != "" {
+                prefix, err := routerSvc.MatchRoutePrefix(ctx, number)
+                if err != nil {
+                    return fmt.Errorf("failed to match route prefix: %v", err)
+                }
+                if prefix == nil {
+                    fmt.Printf("No prefix matches %s, it is routed by its inbound provider\n", number)
+                    return nil
+                }
+                fmt.Printf("%s matches %s*, route '%s'\n", number, prefix.Prefix, prefix.Route)
+                return nil
+            }
+    
+            prefixes, err := routerSvc.ListRoutePrefixes(ctx, route)
+            if err != nil {
+                return fmt.Errorf("failed to list route prefixes: %v", err)
+            }
+    
+            if len(prefixes) == 0 {
+                fmt.Println("No route prefixes found")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Prefix", "Route", "Description", "Updated By", "Updated"})
+            table.SetBorder(false)
+    
+            for _, p := range prefixes {
+                table.Append([]string{
+                    p.Prefix + "*",
+                    p.Route,
+                    p.Description,
+                    p.UpdatedBy,
+                    p.UpdatedAt.Format("2006-01-02 15:04"),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&route, "route", "", "Only the prefixes of this route")
+    cmd.Flags().StringVar(&number, "number", "", "Show the prefix the number would be routed by")
+    
+    return cmd
+}
+
+func createRoutePrefixRemoveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove <prefix>",
+        Short: "Stop routing a destination prefix",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteRoutePrefix(ctx, args[0], audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove route prefix: %v", err)
+            }
+    
+            fmt.Printf("%s Route prefix %s removed\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
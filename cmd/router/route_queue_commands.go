@@ -0,0 +1,56 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    
+    "github.com/spf13/cobra"
+)
+
+func createRouteQueueCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "queue <route> <seconds>",
+        Short: "Set how long calls wait for capacity on a saturated route",
+        Long: `Set how long calls wait for capacity on a saturated route.
+
+When the route is at its max concurrent calls, a new call waits up to the
+queue timeout for one of them to end instead of being rejected. Calls get the
+freed slots first come first served on each node, up to
+router.route_queue.max_waiting per route. The dialplan sees the call's place
+in the queue, its wait and the timeout in ROUTER_QUEUE_POSITION,
+ROUTER_QUEUE_WAIT and ROUTER_QUEUE_TIMEOUT; a call that times out fails with
+ROUTER_STATUS=failed so the dialplan can fail over or reject it. Zero turns
+queueing off.`,
+        Example: `  router route queue main-route 15
+  router route queue main-route 0`,
+        Args: cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            seconds, err := strconv.Atoi(args[1])
+            if err != nil || seconds < 0 {
+                return fmt.Errorf("queue timeout must be a number of seconds")
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.SetRouteQueueTimeout(ctx, args[0], seconds); err != nil {
+                return fmt.Errorf("failed to set route queue timeout: %v", err)
+            }
+    
+            if seconds == 0 {
+                fmt.Printf("%s Calls over the limit of route '%s' are rejected right away\n", green("✓"), args[0])
+                return nil
+            }
+            fmt.Printf("%s Calls over the limit of route '%s' wait up to %ds for capacity\n", green("✓"), args[0], seconds)
+    
+            route, err := routerSvc.GetRoute(ctx, args[0])
+            if err == nil && route.MaxConcurrentCalls == 0 {
+                fmt.Printf("%s The route has no max concurrent calls, calls are never queued\n", yellow("!"))
+            }
+            return nil
+        },
+    }
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "fmt"
+    
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+// scheduleFlags are the schedule flags of route add
+type scheduleFlags struct {
+    windows  []string
+    holidays string
+}
+
+func (f *scheduleFlags) register(cmd *cobra.Command) {
+    cmd.Flags().StringArrayVar(&f.windows, "schedule", nil, `Window the route takes calls in, "mon-fri 08:00-18:00 America/Caracas" (repeatable)`)
+    cmd.Flags().StringVar(&f.holidays, "schedule-holidays", "", "Country whose holidays the route is closed on")
+}
+
+// schedule returns the schedule given, nil without windows
+func (f *scheduleFlags) schedule() (*models.RouteSchedule, error) {
+    return parseScheduleArgs(f.windows, f.holidays)
+}
+
+func parseScheduleArgs(windows []string, holidays string) (*models.RouteSchedule, error) {
+    if len(windows) == 0 {
+        if holidays != "" {
+            return nil, fmt.Errorf("holidays need a schedule window")
+        }
+        return nil, nil
+    }
+    
+    schedule := &models.RouteSchedule{Holidays: holidays}
+    for _, spec := range windows {
+        window, err := router.ParseScheduleWindow(spec)
+        if err != nil {
+            return nil, err
+        }
+        schedule.Windows = append(schedule.Windows, window)
+    }
+    if err := router.ValidateRouteSchedule(schedule); err != nil {
+        return nil, err
+    }
+    return schedule, nil
+}
+
+func createRouteScheduleCommand() *cobra.Command {
+    var (
+        holidays string
+        clear    bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "schedule <route> [window...]",
+        Short: "Set the hours a route takes calls",
+        Long: `Set the weekly windows a route takes calls in.
+
+A window is "days HH:MM-HH:MM [timezone]": days are names or ranges separated
+by commas (mon-fri, sat,sun, fri-mon) or daily, the timezone an IANA zone,
+UTC when left out. A window ending before it starts runs past midnight, 24:00
+ends a window at midnight. With --holidays the route is also closed on the
+holidays of that country, see 'router holiday'.
+
+Outside its windows the route is passed over: the call goes to the next route
+matching its inbound provider by priority, a pattern route or the catch-all
+route, as if the route were disabled. Calls to its destination prefixes go to
+the next shorter prefix. Failover skips closed routes too. A
+route without windows is always open. Windows open and close on time to
+within router.hot_cache_ttl, the routes chosen are cached in process that long.`,
+        Example: `  router route schedule office "mon-fri 08:00-18:00 America/Caracas" --holidays VE
+  router route schedule night "daily 22:00-06:00 Europe/Madrid"
+  router route schedule office "mon-fri 08:00-13:00" "mon-fri 15:00-19:00"
+  router route schedule office --clear`,
+        Args: cobra.MinimumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            windows := args[1:]
+            if len(windows) == 0 && !clear {
+                return fmt.Errorf("no schedule window given, use --clear to remove the schedule")
+            }
+            if clear {
+                windows, holidays = nil, ""
+            }
+            schedule, err := parseScheduleArgs(windows, holidays)
+            if err != nil {
+                return fmt.Errorf("invalid schedule: %v", err)
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.SetRouteSchedule(ctx, args[0], schedule); err != nil {
+                return fmt.Errorf("failed to set route schedule: %v", err)
+            }
+    
+            if schedule.IsEmpty() {
+                fmt.Printf("%s Route '%s' is open at all times\n", green("✓"), args[0])
+                return nil
+            }
+            fmt.Printf("%s Route '%s' takes calls %s\n", green("✓"), args[0], schedule)
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&holidays, "holidays", "", "Country whose holidays the route is closed on")
+    cmd.Flags().BoolVar(&clear, "clear", false, "Remove the schedule")
+    
+    return cmd
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// scorecardTrendThreshold is the score change, in points, shown as a trend
+const scorecardTrendThreshold = 2
+
+func createProviderScorecardCommand() *cobra.Command {
+    var (
+        period     string
+        outputJSON bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "scorecard <provider>",
+        Short: "Score a provider's quality, compliance and cost over a period",
+        Long: `Score a provider's quality, compliance and cost over a period.
+
+Each metric is scored from 0 to 100 and the scores are weighed into one, by
+router.scorecard.weights. ASR, ACD, PDD and MOS are measured on the legs the
+provider carried, verification failures on the steps it was verified at and
+SLA breaches from the reports of the months overlapping the period. Cost is
+the provider's current rate against the active providers of the same type.
+
+Trends compare against the period before; metrics without data are left out
+of the score.`,
+        Example: `  # The last quarter, for a carrier review
+  router provider scorecard s3-provider1 --period 90d
+
+  router provider scorecard s3-provider1 --period 4w --json`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            length, err := parseScorecardPeriod(period)
+            if err != nil {
+                return err
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            card, err := routerSvc.ProviderScorecard(ctx, args[0], length)
+            if err != nil {
+                return fmt.Errorf("failed to build scorecard: %v", err)
+            }
+    
+            if outputJSON {
+                data, _ := json.MarshalIndent(card, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+    
+            fmt.Printf("\n%s %s (%s) %s - %s\n", bold("Provider Scorecard"), card.ProviderName, card.Type,
+                card.Since.Format("2006-01-02"), card.Until.Format("2006-01-02"))
+            fmt.Printf("Calls: %d (previous period %d)\n\n", card.Calls, card.PreviousCalls)
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Metric", "Value", "Previous", "Score", "Weight", "Trend"})
+            table.SetBorder(false)
+    
+            for _, m := range card.Metrics {
+                table.Append([]string{
+                    formatScorecardMetric(m.Name),
+                    formatScorecardValue(m.Name, m.Value, card.Currency),
+                    formatScorecardValue(m.Name, m.PreviousValue, card.Currency),
+                    formatScore(m.Score),
+                    strconv.FormatFloat(m.Weight, 'f', -1, 64),
+                    scoreTrend(m.Score, m.PreviousScore),
+                })
+            }
+    
+            table.Render()
+    
+            fmt.Printf("\n%s %s %s", bold("Score:"), formatScore(card.Score), scoreTrend(card.Score, card.PreviousScore))
+            if card.PreviousScore != nil {
+                fmt.Printf(" (previous period %.1f)", *card.PreviousScore)
+            }
+            fmt.Println()
+            fmt.Printf("%s %d failures, %s down, MTTR %s, MTBF %s\n", bold("Reliability:"),
+                card.Reliability.Failures, time.Duration(card.Reliability.DowntimeSeconds)*time.Second,
+                formatMeanSeconds(card.Reliability.MTTRSeconds), formatMeanSeconds(card.Reliability.MTBFSeconds))
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&period, "period", "30d", "Length of the period up to now, in days (90d), weeks (4w) or a duration (12h)")
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output as JSON")
+    
+    return cmd
+}
+
+// parseScorecardPeriod reads a period in days or weeks, or as a duration
+func parseScorecardPeriod(period string) (time.Duration, error) {
+    unit := time.Duration(0)
+    switch {
+    case strings.HasSuffix(period, "d"):
+        unit = 24 * time.Hour
+    case strings.HasSuffix(period, "w"):
+        unit = 7 * 24 * time.Hour
+    }
+    
+    var length time.Duration
+    if unit > 0 {
+        n, err := strconv.Atoi(period[:len(period)-1])
+        if err != nil {
+            return 0, fmt.Errorf("invalid period %q", period)
+        }
+        length = time.Duration(n) * unit
+    } else {
+        d, err := time.ParseDuration(period)
+        if err != nil {
+            return 0, fmt.Errorf("invalid period %q", period)
+        }
+        length = d
+    }
+    
+    if length <= 0 {
+        return 0, fmt.Errorf("period must be positive")
+    }
+    return length, nil
+}
+
+func formatScorecardMetric(name string) string {
+    switch name {
+    case models.ScoreASR:
+        return "ASR"
+    case models.ScoreACD:
+        return "ACD"
+    case models.ScorePDD:
+        return "PDD"
+    case models.ScoreMOS:
+        return "MOS"
+    case models.ScoreVerification:
+        return "Verification failures"
+    case models.ScoreSLA:
+        return "SLA breaches"
+    case models.ScoreCost:
+        return "Cost"
+    }
+    return name
+}
+
+func formatScorecardValue(name string, value *float64, currency string) string {
+    if value == nil {
+        return "-"
+    }
+    switch name {
+    case models.ScoreASR, models.ScoreVerification:
+        return fmt.Sprintf("%.1f%%", *value)
+    case models.ScoreACD:
+        return fmt.Sprintf("%.0fs", *value)
+    case models.ScorePDD:
+        return fmt.Sprintf("%.0f ms", *value)
+    case models.ScoreMOS:
+        return fmt.Sprintf("%.2f", *value)
+    case models.ScoreSLA:
+        return fmt.Sprintf("%.0f", *value)
+    case models.ScoreCost:
+        return fmt.Sprintf("%.4f %s/min", *value, currency)
+    }
+    return fmt.Sprintf("%.2f", *value)
+}
+
+func formatScore(score *float64) string {
+    if score == nil {
+        return "-"
+    }
+    text := fmt.Sprintf("%.1f", *score)
+    switch {
+    case *score >= 75:
+        return green(text)
+    case *score >= 50:
+        return yellow(text)
+    }
+    return red(text)
+}
+
+// scoreTrend shows whether a score went up or down since the previous period
+func scoreTrend(score, previous *float64) string {
+    if score == nil || previous == nil {
+        return "-"
+    }
+    switch change := *score - *previous; {
+    case change > scorecardTrendThreshold:
+        return green("↑")
+    case change < -scorecardTrendThreshold:
+        return red("↓")
+    }
+    return "→"
+}
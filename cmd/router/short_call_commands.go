@@ -0,0 +1,191 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createProviderShortCallLimitCommand() *cobra.Command {
+    limitCmd := &cobra.Command{
+        Use:   "short-call-limit",
+        Short: "Manage contractual short call ratio limits of providers",
+        Long: `Manage contractual short call ratio limits of providers.
+
+The short call ratio is the percentage of answered calls shorter than
+router.short_calls.threshold over router.short_calls.window, per inbound customer
+and per outbound provider. Over its limit a provider raises an alert; with the
+throttle action an inbound customer has part of its new calls rejected and an
+outbound provider gets less traffic, router.short_calls.throttle_factor is kept.`,
+    }
+    
+    limitCmd.AddCommand(
+        createShortCallLimitSetCommand(),
+        createShortCallLimitListCommand(),
+        createShortCallLimitDeleteCommand(),
+    )
+    
+    return limitCmd
+}
+
+func createShortCallLimitSetCommand() *cobra.Command {
+    var (
+        maxRatio float64
+        action   string
+    )
+    
+    cmd := &cobra.Command{
+        Use:     "set <provider>",
+        Short:   "Set the short call ratio limit of a provider",
+        Example: `  router provider short-call-limit set s1-customer --max-ratio 15 --action throttle`,
+        Args:    cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if _, err := providerSvc.GetProvider(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to get provider: %v", err)
+            }
+    
+            limit := &models.ShortCallLimit{
+                ProviderName: args[0],
+                MaxRatio:     maxRatio,
+                Action:       action,
+            }
+    
+            if err := routerSvc.GetShortCallMonitor().SetLimit(ctx, limit); err != nil {
+                return fmt.Errorf("failed to set short call limit: %v", err)
+            }
+    
+            fmt.Printf("%s Short call limit for '%s' set to %.2f%% (%s)\n", green("✓"), limit.ProviderName, limit.MaxRatio, limit.Action)
+            return nil
+        },
+    }
+    
+    cmd.Flags().Float64Var(&maxRatio, "max-ratio", 0, "Maximum percentage of short answered calls")
+    cmd.Flags().StringVar(&action, "action", models.ShortCallActionAlert, "What to do over the limit (alert, throttle)")
+    cmd.MarkFlagRequired("max-ratio")
+    
+    return cmd
+}
+
+func createShortCallLimitListCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "list",
+        Short: "List provider short call limits",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            limits, err := routerSvc.GetShortCallMonitor().ListLimits(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to list short call limits: %v", err)
+            }
+    
+            if len(limits) == 0 {
+                fmt.Println("No short call limits")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Provider", "Max Ratio", "Action"})
+            table.SetBorder(false)
+    
+            for _, l := range limits {
+                table.Append([]string{l.ProviderName, fmt.Sprintf("%.2f%%", l.MaxRatio), l.Action})
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createShortCallLimitDeleteCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "delete <provider>",
+        Short: "Remove the short call limit of a provider",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.GetShortCallMonitor().DeleteLimit(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to delete short call limit: %v", err)
+            }
+    
+            fmt.Printf("%s Short call limit for '%s' removed\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
+
+func createStatsShortCallsCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "short-calls",
+        Short: "Show short call ratios per customer and provider",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            stats, err := routerSvc.GetShortCallMonitor().Compute(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to compute short call ratios: %v", err)
+            }
+    
+            if len(stats) == 0 {
+                fmt.Println("No answered calls in the window")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Provider", "Direction", "Answered", "Short", "Ratio", "Limit", "Status"})
+            table.SetBorder(false)
+    
+            for _, s := range stats {
+                limit := "-"
+                status := green("ok")
+                if s.MaxRatio > 0 {
+                    limit = fmt.Sprintf("%.2f%% (%s)", s.MaxRatio, s.Action)
+                }
+                switch {
+                case s.Throttled:
+                    status = red("over limit, throttled")
+                case s.Exceeded:
+                    status = red("over limit")
+                }
+                table.Append([]string{
+                    s.ProviderName,
+                    s.Direction,
+                    strconv.Itoa(s.AnsweredCalls),
+                    strconv.Itoa(s.ShortCalls),
+                    fmt.Sprintf("%.2f%%", s.Ratio),
+                    limit,
+                    status,
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
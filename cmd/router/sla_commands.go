@@ -0,0 +1,474 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+func createProviderSLACommand() *cobra.Command {
+    slaCmd := &cobra.Command{
+        Use:   "sla",
+        Short: "Manage provider SLA targets and compliance reports",
+        Long: `Manage provider SLA targets and compliance reports.
+
+An SLA holds the average post dial delay, answer seizure ratio and availability
+a provider agreed to, and the share of the month's spend credited when each is
+missed. Calls count for each provider they went through from S2; availability
+is the part of the month health checks did not mark the provider down.
+
+A report is stored for every provider with an SLA once a month is over, with
+the breaches, outages and credits, and kept after the SLA is removed.`,
+    }
+    
+    slaCmd.AddCommand(
+        createSLASetCommand(),
+        createSLAShowCommand(),
+        createSLARemoveCommand(),
+        createSLAReportCommand(),
+        createSLAGenerateCommand(),
+    )
+    
+    return slaCmd
+}
+
+func createSLASetCommand() *cobra.Command {
+    var (
+        maxPDD             int
+        minASR             float64
+        minAvailability    float64
+        pddCredit          float64
+        asrCredit          float64
+        availabilityCredit float64
+        maxCredit          float64
+        notes              string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "set <provider>",
+        Short: "Set or update a provider's SLA targets",
+        Long:  "Set or update a provider's SLA targets. Only the flags given change an existing SLA; zero stops tracking a target.",
+        Args:  cobra.ExactArgs(1),
+        Example: `  router provider sla set carrier-a --max-pdd 3000 --min-asr 40 --min-availability 99.9 \
+    --pdd-credit 2 --asr-credit 3 --availability-credit 5 --max-credit 10`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if _, err := providerSvc.GetProvider(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to get provider: %v", err)
+            }
+    
+            slas, err := routerSvc.ListSLAs(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to get SLA: %v", err)
+            }
+            s := &models.ProviderSLA{ProviderName: args[0]}
+            for _, existing := range slas {
+                if existing.ProviderName == args[0] {
+                    s = existing
+                }
+            }
+    
+            flags := cmd.Flags()
+            if flags.Changed("max-pdd") {
+                s.MaxPDDMs = maxPDD
+            }
+            for _, f := range []struct {
+                flag  string
+                value float64
+                field *float64
+            }{
+                {"min-asr", minASR, &s.MinASR},
+                {"min-availability", minAvailability, &s.MinAvailability},
+                {"pdd-credit", pddCredit, &s.PDDCredit},
+                {"asr-credit", asrCredit, &s.ASRCredit},
+                {"availability-credit", availabilityCredit, &s.AvailabilityCredit},
+                {"max-credit", maxCredit, &s.MaxCredit},
+            } {
+                if flags.Changed(f.flag) {
+                    *f.field = f.value
+                }
+            }
+            if flags.Changed("notes") {
+                s.Notes = notes
+            }
+    
+            if err := routerSvc.SetSLA(ctx, s, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set SLA: %v", err)
+            }
+    
+            fmt.Printf("%s SLA of '%s' set\n", green("✓"), s.ProviderName)
+            return nil
+        },
+    }
+    
+    cmd.Flags().IntVar(&maxPDD, "max-pdd", 0, "Maximum average post dial delay in milliseconds")
+    cmd.Flags().Float64Var(&minASR, "min-asr", 0, "Minimum answer seizure ratio, percent")
+    cmd.Flags().Float64Var(&minAvailability, "min-availability", 0, "Minimum availability, percent of the month")
+    cmd.Flags().Float64Var(&pddCredit, "pdd-credit", 0, "Percent of the month's spend credited when PDD is missed")
+    cmd.Flags().Float64Var(&asrCredit, "asr-credit", 0, "Percent of the month's spend credited when ASR is missed")
+    cmd.Flags().Float64Var(&availabilityCredit, "availability-credit", 0, "Percent of the month's spend credited when availability is missed")
+    cmd.Flags().Float64Var(&maxCredit, "max-credit", 0, "Cap on the credits of a month, percent of spend (0 for none)")
+    cmd.Flags().StringVar(&notes, "notes", "", "Free text notes")
+    
+    return cmd
+}
+
+func createSLAShowCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "show [provider]",
+        Short: "Show SLA targets",
+        Args:  cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            var slas []*models.ProviderSLA
+            if len(args) == 1 {
+                s, err := routerSvc.GetSLA(ctx, args[0])
+                if err != nil {
+                    return fmt.Errorf("failed to get SLA: %v", err)
+                }
+                slas = append(slas, s)
+            } else {
+                var err error
+                if slas, err = routerSvc.ListSLAs(ctx); err != nil {
+                    return fmt.Errorf("failed to get SLA: %v", err)
+                }
+            }
+    
+            if len(slas) == 0 {
+                fmt.Println("No provider SLAs")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Provider", "Max PDD", "Min ASR", "Min Availability", "PDD Credit", "ASR Credit", "Avail. Credit", "Credit Cap", "Notes"})
+            table.SetBorder(false)
+    
+            for _, s := range slas {
+                table.Append([]string{
+                    s.ProviderName,
+                    contractAmount(fmt.Sprintf("%d ms", s.MaxPDDMs), s.MaxPDDMs > 0),
+                    contractAmount(fmt.Sprintf("%.2f%%", s.MinASR), s.MinASR > 0),
+                    contractAmount(fmt.Sprintf("%.3f%%", s.MinAvailability), s.MinAvailability > 0),
+                    contractAmount(fmt.Sprintf("%.2f%%", s.PDDCredit), s.PDDCredit > 0),
+                    contractAmount(fmt.Sprintf("%.2f%%", s.ASRCredit), s.ASRCredit > 0),
+                    contractAmount(fmt.Sprintf("%.2f%%", s.AvailabilityCredit), s.AvailabilityCredit > 0),
+                    contractAmount(fmt.Sprintf("%.2f%%", s.MaxCredit), s.MaxCredit > 0),
+                    orDash(s.Notes),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createSLARemoveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove <provider>",
+        Short: "Stop tracking a provider's SLA, keeping its reports",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteSLA(ctx, args[0], audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove SLA: %v", err)
+            }
+    
+            fmt.Printf("%s SLA of '%s' removed\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
+
+func createSLAReportCommand() *cobra.Command {
+    var (
+        month      string
+        live       bool
+        csvFile    string
+        outputJSON bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "report [provider]",
+        Short: "Show stored SLA compliance reports",
+        Long: `Show stored SLA compliance reports, newest month first, with the breaches
+and outages behind them. With --live the month is measured now instead,
+which also works for the month still running.`,
+        Args: cobra.MaximumNArgs(1),
+        Example: `  # Every report of a provider
+  router provider sla report carrier-a
+    
+  # How this month is going
+  router provider sla report --live
+    
+  # Export last month for invoicing
+  router provider sla report --month 2026-09 --csv sla-2026-09.csv`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            provider := ""
+            if len(args) == 1 {
+                provider = args[0]
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            var reports []*models.SLAReport
+            if live {
+                at := time.Now()
+                if month != "" {
+                    var err error
+                    if at, err = router.ParseSLAMonth(month); err != nil {
+                        return err
+                    }
+                }
+                var err error
+                if reports, err = routerSvc.BuildSLAReports(ctx, at, provider); err != nil {
+                    return fmt.Errorf("failed to build SLA reports: %v", err)
+                }
+            } else {
+                if month != "" {
+                    if _, err := router.ParseSLAMonth(month); err != nil {
+                        return err
+                    }
+                }
+                var err error
+                if reports, err = routerSvc.ListSLAReports(ctx, provider, month); err != nil {
+                    return fmt.Errorf("failed to get SLA reports: %v", err)
+                }
+            }
+    
+            if csvFile != "" {
+                return exportSLAReports(reports, csvFile)
+            }
+            if outputJSON {
+                data, _ := json.MarshalIndent(reports, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+    
+            if len(reports) == 0 {
+                fmt.Println("No SLA reports")
+                return nil
+            }
+            printSLAReports(reports)
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&month, "month", "", "Only this month (YYYY-MM)")
+    cmd.Flags().BoolVar(&live, "live", false, "Measure the month now instead of reading stored reports")
+    cmd.Flags().StringVar(&csvFile, "csv", "", "Export the reports to a CSV file (- for stdout)")
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output reports as JSON")
+    
+    return cmd
+}
+
+func createSLAGenerateCommand() *cobra.Command {
+    var month string
+    
+    cmd := &cobra.Command{
+        Use:   "generate [provider]",
+        Short: "Generate and store the SLA reports of a month",
+        Long: `Generate and store the SLA reports of a month, replacing the ones stored for
+it. Reports of last month are generated on their own once it is over; this
+regenerates them after late data or a changed SLA.`,
+        Args:    cobra.MaximumNArgs(1),
+        Example: `  router provider sla generate --month 2026-09`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if month == "" {
+                return fmt.Errorf("--month is required")
+            }
+            at, err := router.ParseSLAMonth(month)
+            if err != nil {
+                return err
+            }
+            provider := ""
+            if len(args) == 1 {
+                provider = args[0]
+            }
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            reports, err := routerSvc.GenerateSLAReports(ctx, at, provider)
+            if err != nil {
+                return fmt.Errorf("failed to generate SLA reports: %v", err)
+            }
+            if len(reports) == 0 {
+                fmt.Println("No provider SLAs")
+                return nil
+            }
+    
+            printSLAReports(reports)
+            fmt.Printf("\n%s Stored %d SLA reports for %s\n", green("✓"), len(reports), month)
+            if !reports[0].Complete {
+                fmt.Println(yellow("The month is still running, its reports are replaced once it ends"))
+            }
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&month, "month", "", "Month to report on (YYYY-MM)")
+    
+    return cmd
+}
+
+func printSLAReports(reports []*models.SLAReport) {
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"Month", "Provider", "Calls", "ASR", "Avg PDD", "Availability", "Downtime", "MTTR", "MTBF", "Spend", "Credit", "Status"})
+    table.SetBorder(false)
+    
+    for _, r := range reports {
+        status := green("met")
+        if !r.Compliant() {
+            metrics := make([]string, len(r.Breaches))
+            for i, b := range r.Breaches {
+                metrics[i] = b.Metric
+            }
+            status = red("breached " + strings.Join(metrics, ", "))
+        }
+        monthLabel := r.Month
+        if !r.Complete {
+            monthLabel += yellow(" (running)")
+        }
+        table.Append([]string{
+            monthLabel,
+            r.ProviderName,
+            fmt.Sprintf("%d", r.Calls),
+            fmt.Sprintf("%.2f%%", r.ASR),
+            fmt.Sprintf("%d ms", r.AvgPDDMs),
+            fmt.Sprintf("%.3f%%", r.Availability),
+            (time.Duration(r.DowntimeSeconds) * time.Second).String(),
+            formatMeanSeconds(r.MTTRSeconds),
+            formatMeanSeconds(r.MTBFSeconds),
+            fmt.Sprintf("%.2f %s", r.Spend, r.Currency),
+            fmt.Sprintf("%.2f (%.2f%%)", r.Credit, r.CreditPercent),
+            status,
+        })
+    }
+    table.Render()
+    
+    for _, r := range reports {
+        if r.Compliant() && len(r.Outages) == 0 {
+            continue
+        }
+        fmt.Printf("\n%s %s\n", bold(r.ProviderName), r.Month)
+        for _, b := range r.Breaches {
+            fmt.Printf("  %s %s %s, target %s, credit %.2f%%\n", red("✗"), b.Metric,
+                slaValue(b.Metric, b.Actual), slaValue(b.Metric, b.Target), b.Credit)
+        }
+        for _, o := range r.Outages {
+            fmt.Printf("  down %s to %s (%s)\n", o.Start.Format("2006-01-02 15:04:05"),
+                o.End.Format("2006-01-02 15:04:05"), time.Duration(o.Seconds)*time.Second)
+        }
+    }
+}
+
+func slaValue(metric string, v float64) string {
+    switch metric {
+    case models.SLAMetricPDD:
+        return fmt.Sprintf("%.0f ms", v)
+    case models.SLAMetricAvailability:
+        return fmt.Sprintf("%.3f%%", v)
+    }
+    return fmt.Sprintf("%.2f%%", v)
+}
+
+// exportSLAReports writes one CSV row per report, the breaches and outages
+// summarized in a column each
+func exportSLAReports(reports []*models.SLAReport, path string) error {
+    var out io.Writer = os.Stdout
+    if path != "-" {
+        file, err := os.Create(path)
+        if err != nil {
+            return fmt.Errorf("failed to create %s: %v", path, err)
+        }
+        defer file.Close()
+        out = file
+    }
+    
+    w := csv.NewWriter(out)
+    w.Write([]string{"month", "provider", "complete", "calls", "answered", "asr", "avg_pdd_ms", "availability",
+        "downtime_seconds", "failures", "mttr_seconds", "mtbf_seconds", "minutes", "spend", "currency", "credit_percent", "credit", "breaches", "outages"})
+    
+    for _, r := range reports {
+        breaches := make([]string, len(r.Breaches))
+        for i, b := range r.Breaches {
+            breaches[i] = fmt.Sprintf("%s %.2f<%.2f", b.Metric, b.Actual, b.Target)
+            if b.Metric == models.SLAMetricPDD {
+                breaches[i] = fmt.Sprintf("%s %.0f>%.0f", b.Metric, b.Actual, b.Target)
+            }
+        }
+        outages := make([]string, len(r.Outages))
+        for i, o := range r.Outages {
+            outages[i] = o.Start.Format(time.RFC3339) + "/" + o.End.Format(time.RFC3339)
+        }
+    
+        w.Write([]string{
+            r.Month,
+            r.ProviderName,
+            strconv.FormatBool(r.Complete),
+            strconv.FormatInt(r.Calls, 10),
+            strconv.FormatInt(r.Answered, 10),
+            strconv.FormatFloat(r.ASR, 'f', 2, 64),
+            strconv.Itoa(r.AvgPDDMs),
+            strconv.FormatFloat(r.Availability, 'f', 3, 64),
+            strconv.FormatInt(r.DowntimeSeconds, 10),
+            strconv.Itoa(r.Failures),
+            formatOptionalSeconds(r.MTTRSeconds),
+            formatOptionalSeconds(r.MTBFSeconds),
+            strconv.FormatFloat(r.Minutes, 'f', 2, 64),
+            strconv.FormatFloat(r.Spend, 'f', 4, 64),
+            r.Currency,
+            strconv.FormatFloat(r.CreditPercent, 'f', 2, 64),
+            strconv.FormatFloat(r.Credit, 'f', 4, 64),
+            strings.Join(breaches, "; "),
+            strings.Join(outages, "; "),
+        })
+    }
+    
+    w.Flush()
+    if err := w.Error(); err != nil {
+        return fmt.Errorf("failed to write CSV: %v", err)
+    }
+    
+    if path != "-" {
+        fmt.Printf("%s Exported %d SLA reports to %s\n", green("✓"), len(reports), path)
+    }
+    return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+func createStatsSnapshotCommand() *cobra.Command {
+    var date string
+    
+    cmd := &cobra.Command{
+        Use:   "snapshot",
+        Short: "Snapshot daily provider, route and country statistics",
+        Long: `Aggregate a day of production call records into call_stats_daily. Without
+--date every finished day of the backfill window that has no snapshot yet is
+written, which is what the router does on router.stats_snapshot.interval.`,
+        Example: `  router stats snapshot
+  router stats snapshot --date 2026-01-31`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if date != "" {
+                day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+                if err != nil {
+                    return fmt.Errorf("invalid date %q, use YYYY-MM-DD", date)
+                }
+    
+                rows, err := routerSvc.SnapshotDailyStats(ctx, day)
+                if err != nil {
+                    return fmt.Errorf("failed to snapshot %s: %v", date, err)
+                }
+                fmt.Printf("%s %s snapshotted, %d rows\n", green("✓"), date, rows)
+                return nil
+            }
+    
+            days, err := routerSvc.SnapshotPendingDays(ctx, statsSnapshotConfig().BackfillDays)
+            for _, day := range days {
+                fmt.Printf("%s %s snapshotted\n", green("✓"), day.Format("2006-01-02"))
+            }
+            if err != nil {
+                return fmt.Errorf("failed to snapshot statistics: %v", err)
+            }
+            if len(days) == 0 {
+                fmt.Println("All finished days are already snapshotted")
+            }
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&date, "date", "", "Snapshot a single day (YYYY-MM-DD), replacing an existing snapshot")
+    
+    return cmd
+}
+
+func createStatsHistoryCommand() *cobra.Command {
+    var (
+        dimension       string
+        key             string
+        days            int
+        excludeHolidays bool
+        holidayCountry  string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "history",
+        Short: "Show snapshotted daily statistics",
+        Example: `  router stats history --dimension provider --key s3-main --days 90
+  router stats history --dimension country --exclude-holidays
+  router stats history --dimension route --exclude-holidays --holiday-country US`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            now := time.Now()
+            stats, err := routerSvc.GetDailyStats(ctx, router.StatsFilter{
+                Dimension:       dimension,
+                Key:             key,
+                Since:           now.AddDate(0, 0, -days),
+                Until:           now.AddDate(0, 0, 1),
+                ExcludeHolidays: excludeHolidays,
+                HolidayCountry:  holidayCountry,
+            })
+            if err != nil {
+                return fmt.Errorf("failed to get daily statistics: %v", err)
+            }
+    
+            if len(stats) == 0 {
+                fmt.Println("No snapshotted statistics found")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            currency := routerSvc.GetFX().Currency()
+            table.SetHeader([]string{"Date", dimension, "Calls", "Answered", "Failed", "ASR", "ACD", "Minutes",
+                "Cost " + currency, "Revenue " + currency})
+            table.SetBorder(false)
+    
+            for _, s := range stats {
+                table.Append([]string{
+                    s.Date.Format("2006-01-02"),
+                    s.Key,
+                    fmt.Sprintf("%d", s.TotalCalls),
+                    fmt.Sprintf("%d", s.AnsweredCalls),
+                    fmt.Sprintf("%d", s.FailedCalls),
+                    fmt.Sprintf("%.1f%%", s.ASR),
+                    fmt.Sprintf("%.0fs", s.ACD),
+                    fmt.Sprintf("%.1f", float64(s.BillableDuration)/60),
+                    fmt.Sprintf("%.2f", s.Cost),
+                    fmt.Sprintf("%.2f", s.Revenue),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&dimension, "dimension", models.StatsDimensionProvider, "Dimension (provider, route, country)")
+    cmd.Flags().StringVar(&key, "key", "", "Only show one provider, route or country")
+    cmd.Flags().IntVar(&days, "days", 30, "Days of history to show")
+    cmd.Flags().BoolVar(&excludeHolidays, "exclude-holidays", false, "Leave out holidays, of each country in the country dimension (see: router holiday)")
+    cmd.Flags().StringVar(&holidayCountry, "holiday-country", "", "Country whose holidays --exclude-holidays leaves out")
+    
+    return cmd
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+func createSyntheticCommands() *cobra.Command {
+    syntheticCmd := &cobra.Command{
+        Use:   "synthetic",
+        Short: "Scheduled synthetic test calls",
+        Long: `Scheduled synthetic test calls through providers and routes.
+
+A probe calls a test number through one provider, or through every outbound
+provider of a route, at its interval. In cancel mode the call is hung up as soon
+as the far end rings, in answer mode it plays a short announcement once answered.
+Results and post dial delay are stored in synthetic_results and exported as the
+synthetic_calls_total and synthetic_pdd_seconds metrics, apart from customer
+traffic. Probes run when router.synthetic.enabled is set.`,
+    }
+    
+    syntheticCmd.AddCommand(
+        createSyntheticAddCommand(),
+        createSyntheticListCommand(),
+        createSyntheticDeleteCommand(),
+        createSyntheticToggleCommand("enable", "Resume scheduling of a synthetic probe", true),
+        createSyntheticToggleCommand("disable", "Stop scheduling a synthetic probe", false),
+        createSyntheticRunCommand(),
+        createSyntheticResultsCommand(),
+    )
+    
+    return syntheticCmd
+}
+
+func createSyntheticAddCommand() *cobra.Command {
+    var probe models.SyntheticProbe
+    var disabled bool
+    
+    cmd := &cobra.Command{
+        Use:   "add <name>",
+        Short: "Add or replace a synthetic probe",
+        Example: `  router synthetic add uk-carrier1 --provider carrier1 --dnis 442071838750
+  router synthetic add main-route --route main --dnis 442071838750 --mode answer --interval 15m`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            probe.Name = args[0]
+            probe.Enabled = !disabled
+            if err := routerSvc.AddSyntheticProbe(ctx, &probe); err != nil {
+                return fmt.Errorf("failed to save probe: %v", err)
+            }
+    
+            fmt.Printf("%s Probe %s saved, every %s\n", green("✓"), probe.Name, probe.Interval)
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&probe.Provider, "provider", "", "Provider to call through")
+    cmd.Flags().StringVar(&probe.Route, "route", "", "Route whose outbound providers are called")
+    cmd.Flags().StringVar(&probe.DNIS, "dnis", "", "Test number to call")
+    cmd.Flags().StringVar(&probe.ANI, "ani", "", "Caller ID, router.synthetic.default_ani when empty")
+    cmd.Flags().StringVar(&probe.Mode, "mode", models.SyntheticModeCancel, "cancel on ring or answer and play an announcement")
+    cmd.Flags().DurationVar(&probe.Interval, "interval", 5*time.Minute, "How often the probe runs")
+    cmd.Flags().BoolVar(&disabled, "disabled", false, "Save the probe without scheduling it")
+    cmd.MarkFlagRequired("dnis")
+    
+    return cmd
+}
+
+func createSyntheticListCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "list",
+        Short: "List synthetic probes",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            probes, err := routerSvc.ListSyntheticProbes(ctx)
+            if err != nil {
+                return fmt.Errorf("failed to list probes: %v", err)
+            }
+    
+            if len(probes) == 0 {
+                fmt.Println("No synthetic probes found")
+                return nil
+            }
+    
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Name", "Target", "DNIS", "Mode", "Interval", "Enabled", "Last Run"})
+            table.SetBorder(false)
+    
+            for _, p := range probes {
+                target := "provider " + p.Provider
+                if p.Route != "" {
+                    target = "route " + p.Route
+                }
+                enabled := green("yes")
+                if !p.Enabled {
+                    enabled = yellow("no")
+                }
+                lastRun := "never"
+                if p.LastRunAt != nil {
+                    lastRun = p.LastRunAt.Local().Format("2006-01-02 15:04:05")
+                }
+                table.Append([]string{p.Name, target, p.DNIS, p.Mode, p.Interval.String(), enabled, lastRun})
+            }
+    
+            table.Render()
+    
+            if !syntheticConfig().Enabled {
+                fmt.Printf("\n%s probes are not scheduled (router.synthetic.enabled)\n", yellow("!"))
+            }
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createSyntheticDeleteCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "delete <name>",
+        Short: "Delete a synthetic probe, its results are kept",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteSyntheticProbe(ctx, args[0]); err != nil {
+                return fmt.Errorf("failed to delete probe: %v", err)
+            }
+    
+            fmt.Printf("%s Probe %s deleted\n", green("✓"), args[0])
+            return nil
+        },
+    }
+}
+
+func createSyntheticToggleCommand(use, short string, enabled bool) *cobra.Command {
+    return &cobra.Command{
+        Use:   use + " <name>",
+        Short: short,
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.SetSyntheticProbeEnabled(ctx, args[0], enabled); err != nil {
+                return fmt.Errorf("failed to update probe: %v", err)
+            }
+    
+            fmt.Printf("%s Probe %s %sd\n", green("✓"), args[0], use)
+            return nil
+        },
+    }
+}
+
+func createSyntheticRunCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "run <name>",
+        Short: "Run a synthetic probe now",
+        Args:  cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if amiManager == nil || !amiManager.IsConnected() {
+                return fmt.Errorf("AMI is not connected")
+            }
+    
+            probe, err := routerSvc.GetSyntheticProbe(ctx, args[0])
+            if err != nil {
+                return err
+            }
+    
+            results, err := router.NewSyntheticProber(routerSvc, amiManager, syntheticConfig()).RunProbe(ctx, probe)
+            if err != nil {
+                return fmt.Errorf("probe failed: %v", err)
+            }
+    
+            printSyntheticResults(results)
+            return nil
+        },
+    }
+}
+
+func createSyntheticResultsCommand() *cobra.Command {
+    var filter router.SyntheticResultFilter
+    var since time.Duration
+    
+    cmd := &cobra.Command{
+        Use:   "results",
+        Short: "Show recent synthetic probe results",
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if since > 0 {
+                filter.Since = time.Now().Add(-since)
+            }
+            results, err := routerSvc.GetSyntheticResults(ctx, filter)
+            if err != nil {
+                return fmt.Errorf("failed to get results: %v", err)
+            }
+    
+            if len(results) == 0 {
+                fmt.Println("No synthetic results found")
+                return nil
+            }
+    
+            printSyntheticResults(results)
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().StringVar(&filter.Probe, "probe", "", "Only this probe")
+    cmd.Flags().StringVar(&filter.Provider, "provider", "", "Only this provider")
+    cmd.Flags().DurationVar(&since, "since", 24*time.Hour, "How far back to look")
+    cmd.Flags().IntVar(&filter.Limit, "limit", 50, "Maximum results")
+    
+    return cmd
+}
+
+func printSyntheticResults(results []*models.SyntheticResult) {
+    table := tablewriter.NewWriter(os.Stdout)
+    table.SetHeader([]string{"Time", "Probe", "Provider", "Outcome", "PDD", "Cause", "Reason"})
+    table.SetBorder(false)
+    
+    for _, r := range results {
+        outcome := red(r.Outcome)
+        if r.Success {
+            outcome = green(r.Outcome)
+        }
+        pdd := "-"
+        if r.PDD > 0 {
+            pdd = fmt.Sprintf("%dms", r.PDD)
+        }
+        table.Append([]string{
+            r.StartedAt.Local().Format("2006-01-02 15:04:05"),
+            r.Probe,
+            r.Provider,
+            outcome,
+            pdd,
+            strconv.Itoa(r.Cause),
+            r.Reason,
+        })
+    }
+    
+    table.Render()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "os"
+    "strings"
+    "time"
+    
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createProviderTagCommand() *cobra.Command {
+    var (
+        remove []string
+        where  []string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "tag [name] [key=value...]",
+        Short: "Set or remove provider tags",
+        Example: `  # Tag a single provider
+  router provider tag s3-carrier-a tier=premium contract=2024
+  
+  # Remove a tag
+  router provider tag s3-carrier-a --remove contract
+  
+  # Tag every provider that already carries tier=premium
+  router provider tag --where tier=premium sla=gold`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            
+            if len(where) == 0 && len(args) == 0 {
+                return fmt.Errorf("provider name or --where is required")
+            }
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            targets, pairs, err := resolveTagTargets(ctx, args, where)
+            if err != nil {
+                return err
+            }
+            
+            set, err := models.ParseTags(pairs, false)
+            if err != nil {
+                return err
+            }
+            if len(set) == 0 && len(remove) == 0 {
+                return fmt.Errorf("nothing to change, give key=value pairs or --remove")
+            }
+            
+            summary := &operationSummary{Operation: "Provider tagging", Total: len(targets), Started: time.Now()}
+            for _, name := range targets {
+                if ctx.Err() != nil {
+                    summary.Cancelled = true
+                    break
+                }
+                if err := providerSvc.SetTags(ctx, name, set, remove); err != nil {
+                    summary.Failed++
+                    fmt.Printf("%s %s: %v\n", red("✗"), name, err)
+                    continue
+                }
+                summary.Succeeded++
+            }
+            summary.Skipped = summary.Total - summary.Succeeded - summary.Failed
+            
+            refreshTagGroups(ctx)
+            
+            if len(targets) == 1 && summary.Succeeded == 1 {
+                fmt.Printf("%s Tags updated for provider '%s'\n", green("✓"), targets[0])
+                return nil
+            }
+            summary.Print()
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringArrayVar(&remove, "remove", nil, "Tag key to remove (repeatable)")
+    cmd.Flags().StringArrayVar(&where, "where", nil, "Apply to all providers carrying tag key=value or key (repeatable)")
+    
+    return cmd
+}
+
+func createProviderBulkCommand() *cobra.Command {
+    var (
+        where []string
+        yes   bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "bulk <enable|disable|delete>",
+        Short: "Apply an operation to all providers matching a tag selector",
+        Example: `  # Take every provider under the 2023 contract out of rotation
+  router provider bulk disable --where contract=2023`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+            action := args[0]
+            
+            if action != "enable" && action != "disable" && action != "delete" {
+                return fmt.Errorf("unknown action %q, use enable, disable or delete", action)
+            }
+            if len(where) == 0 {
+                return fmt.Errorf("--where is required")
+            }
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            targets, _, err := resolveTagTargets(ctx, nil, where)
+            if err != nil {
+                return err
+            }
+            
+            fmt.Printf("%s %d providers: %s\n", strings.ToUpper(action[:1])+action[1:], len(targets), strings.Join(targets, ", "))
+            if !yes {
+                fmt.Print("Continue? [y/N]: ")
+                response, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+                response = strings.TrimSpace(strings.ToLower(response))
+                if response != "y" && response != "yes" {
+                    fmt.Println("Cancelled")
+                    return nil
+                }
+            }
+            
+            summary := &operationSummary{Operation: "Provider bulk " + action, Total: len(targets), Started: time.Now()}
+            for _, name := range targets {
+                if ctx.Err() != nil {
+                    summary.Cancelled = true
+                    break
+                }
+                
+                var err error
+                switch action {
+                case "enable":
+                    err = providerSvc.UpdateProvider(ctx, name, map[string]interface{}{"active": true})
+                case "disable":
+                    err = providerSvc.UpdateProvider(ctx, name, map[string]interface{}{"active": false})
+                case "delete":
+                    err = providerSvc.DeleteProvider(ctx, name)
+                }
+                
+                if err != nil {
+                    summary.Failed++
+                    fmt.Printf("%s %s: %v\n", red("✗"), name, err)
+                    continue
+                }
+                summary.Succeeded++
+            }
+            summary.Skipped = summary.Total - summary.Succeeded - summary.Failed
+            
+            summary.Print()
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringArrayVar(&where, "where", nil, "Tag selector key=value or key (repeatable)")
+    cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Skip confirmation")
+    
+    return cmd
+}
+
+// resolveTagTargets returns the providers to act on and the remaining key=value arguments
+func resolveTagTargets(ctx context.Context, args, where []string) ([]string, []string, error) {
+    if len(where) == 0 {
+        return []string{args[0]}, args[1:], nil
+    }
+    
+    selector, err := models.ParseTags(where, true)
+    if err != nil {
+        return nil, nil, err
+    }
+    
+    names, err := providerSvc.ProvidersByTags(ctx, selector)
+    if err != nil {
+        return nil, nil, err
+    }
+    if len(names) == 0 {
+        return nil, nil, fmt.Errorf("no providers match %s", selector.String())
+    }
+    
+    return names, args, nil
+}
+
+// refreshTagGroups re-evaluates rule based groups so tag changes show up in group membership
+func refreshTagGroups(ctx context.Context) {
+    groupService := newGroupService()
+    
+    groups, err := groupService.ListGroups(ctx, nil)
+    if err != nil {
+        fmt.Printf("%s Failed to refresh groups: %v\n", yellow("!"), err)
+        return
+    }
+    
+    for _, g := range groups {
+        if g.GroupType == models.GroupTypeDynamic || strings.HasPrefix(g.MatchField, "tag.") {
+            if err := groupService.RefreshGroupMembers(ctx, g.Name); err != nil {
+                fmt.Printf("%s Failed to refresh group '%s': %v\n", yellow("!"), g.Name, err)
+            }
+        }
+    }
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+    "fmt"
+    
+    "github.com/spf13/cobra"
+)
+
+func createDIDTestCommand() *cobra.Command {
+    var clear bool
+    
+    cmd := &cobra.Command{
+        Use:   "test <numbers...>",
+        Short: "Reserve DIDs for test routes",
+        Long: `Mark DIDs as test numbers. Test DIDs are only allocated to calls on test
+routes and their usage is left out of the DID usage totals by default.`,
+        Example: `  router did test 15551230001 15551230002
+  router did test 15551230001 --clear`,
+        Args: cobra.MinimumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            updated, err := routerSvc.SetDIDTest(ctx, args, !clear)
+            if err != nil {
+                return fmt.Errorf("failed to update DIDs: %v", err)
+            }
+    
+            state := "marked as test"
+            if clear {
+                state = "returned to production"
+            }
+            fmt.Printf("%s %d of %d DIDs %s\n", green("✓"), updated, len(args), state)
+            return nil
+        },
+    }
+    
+    cmd.Flags().BoolVar(&clear, "clear", false, "Return the DIDs to production")
+    
+    return cmd
+}
+
+func createRouteTestCommand() *cobra.Command {
+    var clear bool
+    
+    cmd := &cobra.Command{
+        Use:   "test <name>",
+        Short: "Mark a route as test traffic",
+        Long: `Mark a route as test traffic. Its calls are flagged in call_records, use test
+DIDs first, are rate limited by router.test_mode and are kept out of provider
+ASR statistics, billing totals and the production call metrics.`,
+        Example: `  router route test lab-route
+  router route test lab-route --clear`,
+        Args: cobra.ExactArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.SetRouteTest(ctx, args[0], !clear); err != nil {
+                return fmt.Errorf("failed to update route: %v", err)
+            }
+    
+            if clear {
+                fmt.Printf("%s Route '%s' returned to production\n", green("✓"), args[0])
+            } else {
+                fmt.Printf("%s Route '%s' marked as test traffic\n", green("✓"), args[0])
+            }
+            return nil
+        },
+    }
+    
+    cmd.Flags().BoolVar(&clear, "clear", false, "Return the route to production")
+    
+    return cmd
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "time"
+    
+    "github.com/spf13/cobra"
+    "github.com/olekukonko/tablewriter"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+func createVerificationCommands() *cobra.Command {
+    verificationCmd := &cobra.Command{
+        Use:   "verifications",
+        Short: "Inspect call verification results",
+    }
+    
+    verificationCmd.AddCommand(
+        createVerificationReportCommand(),
+    )
+    
+    return verificationCmd
+}
+
+func createVerificationReportCommand() *cobra.Command {
+    var (
+        since      time.Duration
+        provider   string
+        tagPairs   []string
+        step       string
+        interval   string
+        outputJSON bool
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "report",
+        Short: "Aggregate verification results by step, reason and provider",
+        Example: `  # Failures over the last 24 hours
+  router verifications report
+  
+  # Drill down into a single carrier over the last week, bucketed by day
+  router verifications report --provider s3-intermediate --since 168h --interval day`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := context.Background()
+            
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+            
+            tags, err := models.ParseTags(tagPairs, true)
+            if err != nil {
+                return err
+            }
+            
+            until := time.Now()
+            report, err := routerSvc.GetVerificationReport(ctx, router.VerificationReportFilter{
+                Since:    until.Add(-since),
+                Until:    until,
+                Provider: provider,
+                Tags:     tags,
+                Step:     step,
+                Interval: interval,
+            })
+            if err != nil {
+                return fmt.Errorf("failed to build verification report: %v", err)
+            }
+            
+            if outputJSON {
+                data, _ := json.MarshalIndent(report, "", "  ")
+                fmt.Println(string(data))
+                return nil
+            }
+            
+            fmt.Printf("\n%s %s - %s\n", bold("Verification Report"),
+                report.Since.Format("2006-01-02 15:04"), report.Until.Format("2006-01-02 15:04"))
+            fmt.Printf("Total:        %d\n", report.Total)
+            fmt.Printf("Failed:       %s\n", red(fmt.Sprintf("%d", report.Failed)))
+            fmt.Printf("Failure Rate: %.1f%%\n", report.FailureRate)
+            
+            if report.Total == 0 {
+                return nil
+            }
+            
+            fmt.Printf("\n%s\n", bold("By Step"))
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Step", "Total", "Failed", "Failure Rate"})
+            table.SetBorder(false)
+            for _, b := range report.ByStep {
+                table.Append([]string{b.Key, fmt.Sprintf("%d", b.Total), fmt.Sprintf("%d", b.Failed), fmt.Sprintf("%.1f%%", b.FailureRate)})
+            }
+            table.Render()
+            
+            fmt.Printf("\n%s\n", bold("By Provider"))
+            table = tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Provider", "Total", "Failed", "Failure Rate"})
+            table.SetBorder(false)
+            for _, b := range report.ByProvider {
+                table.Append([]string{b.Key, fmt.Sprintf("%d", b.Total), fmt.Sprintf("%d", b.Failed), fmt.Sprintf("%.1f%%", b.FailureRate)})
+            }
+            table.Render()
+            
+            if len(report.Failures) > 0 {
+                fmt.Printf("\n%s\n", bold("Failures"))
+                table = tablewriter.NewWriter(os.Stdout)
+                table.SetHeader([]string{"Provider", "Step", "Reason", "Count", "Last Seen"})
+                table.SetBorder(false)
+                for _, f := range report.Failures {
+                    table.Append([]string{
+                        f.Provider,
+                        f.Step,
+                        f.Reason,
+                        fmt.Sprintf("%d", f.Count),
+                        f.LastSeen.Format("2006-01-02 15:04:05"),
+                    })
+                }
+                table.Render()
+            }
+            
+            if len(report.Timeline) > 0 {
+                fmt.Printf("\n%s\n", bold("Timeline"))
+                table = tablewriter.NewWriter(os.Stdout)
+                table.SetHeader([]string{"Period", "Step", "Total", "Failed"})
+                table.SetBorder(false)
+                for _, b := range report.Timeline {
+                    failed := fmt.Sprintf("%d", b.Failed)
+                    if b.Failed > 0 {
+                        failed = red(failed)
+                    }
+                    table.Append([]string{
+                        b.PeriodStart.Format("2006-01-02 15:04"),
+                        b.Step,
+                        fmt.Sprintf("%d", b.Total),
+                        failed,
+                    })
+                }
+                table.Render()
+            }
+            
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().DurationVar(&since, "since", 24*time.Hour, "Report window, counted back from now")
+    cmd.Flags().StringVar(&provider, "provider", "", "Only include this provider")
+    cmd.Flags().StringArrayVar(&tagPairs, "tag", nil, "Only include providers carrying tag key=value or key (repeatable)")
+    cmd.Flags().StringVar(&step, "step", "", "Only include this verification step (S3_TO_S2, S4_TO_S2)")
+    cmd.Flags().StringVar(&interval, "interval", "hour", "Timeline bucket size (hour, day)")
+    cmd.Flags().BoolVar(&outputJSON, "json", false, "Output report as JSON")
+    
+    return cmd
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    
+    "github.com/spf13/cobra"
+)
+
+func createVersionCommand() *cobra.Command {
+    var asJSON bool
+    
+    cmd := &cobra.Command{
+        Use:   "version",
+        Short: "Show build, schema and enabled subsystems",
+        Long: `Show what this deployment runs: version, git commit and build date of the
+binary, the schema it expects and the migration version of the database, the
+supported Asterisk versions and the subsystems the config turns on. AGI
+servers serve the same on the health port at /version.`,
+        Example: `  router version
+  router version --json`,
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            // The build is still worth showing when the database is down
+            if err := initializeForCLI(ctx); err != nil {
+                fmt.Fprintf(os.Stderr, "%s %v, migration version unknown\n", yellow("!"), err)
+            }
+    
+            info := buildInfo(ctx)
+            if asJSON {
+                enc := json.NewEncoder(os.Stdout)
+                enc.SetIndent("", "  ")
+                return enc.Encode(info)
+            }
+    
+            commit := info.Commit
+            if info.Modified {
+                commit += " (modified)"
+            }
+            migration := "unknown"
+            if info.MigrationVersion > 0 {
+                migration = strconv.FormatUint(uint64(info.MigrationVersion), 10)
+            }
+    
+            fmt.Printf("%s %s\n", bold("Version:"), info.Version)
+            fmt.Printf("%s %s\n", bold("Commit:"), commit)
+            fmt.Printf("%s %s\n", bold("Built:"), info.BuildTime)
+            fmt.Printf("%s %s %s\n", bold("Go:"), info.GoVersion, info.Platform)
+            fmt.Printf("%s %s, migration %s\n", bold("Schema:"), info.SchemaHash, migration)
+            fmt.Printf("%s %s to %s\n", bold("Asterisk:"), info.Asterisk.Min, info.Asterisk.Max)
+    
+            names := make([]string, 0, len(info.Subsystems))
+            for name := range info.Subsystems {
+                names = append(names, name)
+            }
+            sort.Strings(names)
+    
+            fmt.Println(bold("Subsystems:"))
+            for _, name := range names {
+                state := red("off")
+                if info.Subsystems[name] {
+                    state = green("on")
+                }
+                fmt.Printf("  %-20s %s\n", name, state)
+            }
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+    
+    cmd.Flags().BoolVar(&asJSON, "json", false, "Print as JSON")
+    
+    return cmd
+}
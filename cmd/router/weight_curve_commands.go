@@ -0,0 +1,235 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/olekukonko/tablewriter"
+    "github.com/spf13/cobra"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+func createRouteWeightCurveCommand() *cobra.Command {
+    curveCmd := &cobra.Command{
+        Use:   "weight-curve",
+        Short: "Manage hourly provider weights on routes",
+        Long: `Manage hourly provider weights on routes.
+
+A weight curve gives a provider of a route one weight per hour of the day, in
+the curve's time zone (the server's by default). With
+router.weight_curves.enabled, every node applies the weight of the current
+hour each router.weight_curves.interval, in place of the provider's own weight
+when the route picks between its providers. Other routes dialing the provider
+are not affected. Each change is logged and shows on the provider's timeline.`,
+    }
+    
+    curveCmd.AddCommand(
+        createRouteWeightCurveSetCommand(),
+        createRouteWeightCurveShowCommand(),
+        createRouteWeightCurveRemoveCommand(),
+    )
+    
+    return curveCmd
+}
+
+func createRouteWeightCurveSetCommand() *cobra.Command {
+    var (
+        weights  string
+        timezone string
+    )
+    
+    cmd := &cobra.Command{
+        Use:   "set <route> <provider>",
+        Short: "Set the weight curve of a provider on a route",
+        Example: `  router route weight-curve set main-route s3-provider1 --weights "0-6=80,7-19=20,20-23=80"
+  router route weight-curve set main-route s3-provider2 --weights "20,20,20,20,20,20,50,80,80,80,80,80,80,80,80,80,80,80,80,50,20,20,20,20" --timezone Europe/Paris`,
+        Args: cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            curve := &models.WeightCurve{
+                RouteName:    args[0],
+                ProviderName: args[1],
+                Timezone:     timezone,
+            }
+            hours, err := parseWeightCurve(weights)
+            if err != nil {
+                return err
+            }
+            curve.Weights = hours
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if _, err := providerSvc.GetProvider(ctx, args[1]); err != nil {
+                return fmt.Errorf("failed to get provider: %v", err)
+            }
+    
+            if err := routerSvc.SetWeightCurve(ctx, curve, audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to set weight curve: %v", err)
+            }
+    
+            fmt.Printf("%s Weight curve of '%s' on route '%s' set, weight now %d\n",
+                green("✓"), args[1], args[0], curve.WeightAt(time.Now()))
+            return nil
+        },
+    }
+    
+    cmd.Flags().StringVar(&weights, "weights", "", "24 comma separated weights, or hour ranges like 0-6=80,7-19=20,20-23=80")
+    cmd.Flags().StringVar(&timezone, "timezone", "", "Time zone of the curve's hours, e.g. America/New_York (default server time)")
+    cmd.MarkFlagRequired("weights")
+    
+    return cmd
+}
+
+func createRouteWeightCurveShowCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "show [route]",
+        Short: "Show the weight curves of a route, or of every route",
+        Args:  cobra.MaximumNArgs(1),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            route := ""
+            if len(args) > 0 {
+                route = args[0]
+            }
+    
+            curves, err := routerSvc.ListWeightCurves(ctx, route)
+            if err != nil {
+                return fmt.Errorf("failed to get weight curves: %v", err)
+            }
+    
+            if len(curves) == 0 {
+                fmt.Println("No weight curves")
+                return nil
+            }
+    
+            now := time.Now()
+            table := tablewriter.NewWriter(os.Stdout)
+            table.SetHeader([]string{"Route", "Provider", "Time Zone", "Now", "Hours"})
+            table.SetBorder(false)
+            table.SetAutoWrapText(false)
+    
+            for _, c := range curves {
+                table.Append([]string{
+                    c.RouteName,
+                    c.ProviderName,
+                    orDash(c.Timezone),
+                    bold(strconv.Itoa(c.WeightAt(now))),
+                    formatWeightCurve(c.Weights),
+                })
+            }
+    
+            table.Render()
+            return nil
+        },
+        Annotations: changesNothing,
+    }
+}
+
+func createRouteWeightCurveRemoveCommand() *cobra.Command {
+    return &cobra.Command{
+        Use:   "remove <route> <provider>",
+        Short: "Remove the weight curve of a provider on a route",
+        Long:  "Remove the weight curve of a provider on a route. The provider's own weight applies again at the next scheduler run.",
+        Args:  cobra.ExactArgs(2),
+        RunE: func(cmd *cobra.Command, args []string) error {
+            ctx := cmd.Context()
+    
+            if err := initializeForCLI(ctx); err != nil {
+                return err
+            }
+    
+            if err := routerSvc.DeleteWeightCurve(ctx, args[0], args[1], audit.CurrentUser()); err != nil {
+                return fmt.Errorf("failed to remove weight curve: %v", err)
+            }
+    
+            fmt.Printf("%s Weight curve of '%s' on route '%s' removed\n", green("✓"), args[1], args[0])
+            return nil
+        },
+    }
+}
+
+// parseWeightCurve reads 24 comma separated weights, or hour ranges such as
+// 0-6=80,7-19=20,20-23=80 that must cover the whole day
+func parseWeightCurve(s string) ([models.HoursPerDay]int, error) {
+    var weights [models.HoursPerDay]int
+    
+    parts := strings.Split(s, ",")
+    if !strings.Contains(s, "=") {
+        if len(parts) != models.HoursPerDay {
+            return weights, fmt.Errorf("expected %d weights, got %d", models.HoursPerDay, len(parts))
+        }
+        for i, part := range parts {
+            w, err := strconv.Atoi(strings.TrimSpace(part))
+            if err != nil || w < 0 {
+                return weights, fmt.Errorf("invalid weight %q", part)
+            }
+            weights[i] = w
+        }
+        return weights, nil
+    }
+    
+    var set [models.HoursPerDay]bool
+    for _, part := range parts {
+        hours, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+        if !ok {
+            return weights, fmt.Errorf("invalid hour range %q", part)
+        }
+        w, err := strconv.Atoi(strings.TrimSpace(value))
+        if err != nil || w < 0 {
+            return weights, fmt.Errorf("invalid weight %q", part)
+        }
+        from, to, isRange := strings.Cut(hours, "-")
+        if !isRange {
+            to = from
+        }
+        start, err1 := strconv.Atoi(strings.TrimSpace(from))
+        end, err2 := strconv.Atoi(strings.TrimSpace(to))
+        if err1 != nil || err2 != nil || start < 0 || end >= models.HoursPerDay || start > end {
+            return weights, fmt.Errorf("invalid hour range %q", part)
+        }
+        for h := start; h <= end; h++ {
+            if set[h] {
+                return weights, fmt.Errorf("hour %d is set twice", h)
+            }
+            set[h] = true
+            weights[h] = w
+        }
+    }
+    for h, ok := range set {
+        if !ok {
+            return weights, fmt.Errorf("hour %d has no weight", h)
+        }
+    }
+    return weights, nil
+}
+
+// formatWeightCurve writes a curve as the hour ranges parseWeightCurve reads
+func formatWeightCurve(weights [models.HoursPerDay]int) string {
+    var ranges []string
+    start := 0
+    for h := 1; h <= models.HoursPerDay; h++ {
+        if h < models.HoursPerDay && weights[h] == weights[start] {
+            continue
+        }
+        if start == h-1 {
+            ranges = append(ranges, fmt.Sprintf("%d=%d", start, weights[start]))
+        } else {
+            ranges = append(ranges, fmt.Sprintf("%d-%d=%d", start, h-1, weights[start]))
+        }
+        start = h
+    }
+    return strings.Join(ranges, ",")
+}
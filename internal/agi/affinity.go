@@ -0,0 +1,282 @@
+package agi
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net"
+    "os"
+    "strings"
+    "sync"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/agivars"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// forwardedHeader marks a session relayed by another node, which the owner
+// handles itself even if its own lookup disagrees
+const forwardedHeader = "agi_ara_forwarded"
+
+// AffinityConfig controls dispatching AGI sessions to the node that owns the
+// call when several AGI servers sit behind a TCP load balancer
+type AffinityConfig struct {
+    Enabled          bool
+    AdvertiseAddress string        // host:port other nodes reach this AGI server on
+    TTL              time.Duration // how long ownership outlives the call's last event
+    DialTimeout      time.Duration
+}
+
+// OwnershipStore keeps which node owns each call, shared by all nodes
+type OwnershipStore interface {
+    Get(ctx context.Context, key string, dest interface{}) error
+    Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+    Delete(ctx context.Context, keys ...string) error
+}
+
+// affinity records the calls this node routes and finds the owner of the
+// calls it does not. A call is known by its UNIQUEID on the inbound leg, by
+// its DID when S3 brings it back and by the ANI/DNIS sent to S4 when it
+// comes back from there.
+type affinity struct {
+    config AffinityConfig
+    store  OwnershipStore
+}
+
+func ownerCallKey(callID string) string { return "affinity:call:" + callID }
+
+func ownerDIDKey(did string) string { return "affinity:did:" + did }
+
+func ownerFinalKey(ani, dnis string) string { return "affinity:final:" + ani + ":" + dnis }
+
+// EnableAffinity dispatches AGI sessions of calls owned by other nodes to
+// them, recording ownership in store
+func (s *Server) EnableAffinity(config AffinityConfig, store OwnershipStore) {
+    if !config.Enabled || store == nil {
+        return
+    }
+    if config.AdvertiseAddress == "" {
+        config.AdvertiseAddress = defaultAdvertiseAddress(s.config.Port)
+    }
+    if config.TTL <= 0 {
+        config.TTL = 4 * time.Hour
+    }
+    if config.DialTimeout <= 0 {
+        config.DialTimeout = time.Second
+    }
+    
+    s.affinity = &affinity{config: config, store: store}
+    logger.Info("AGI session affinity enabled", "advertise_address", config.AdvertiseAddress)
+}
+
+// defaultAdvertiseAddress is the host name with the AGI port
+func defaultAdvertiseAddress(port int) string {
+    host, err := os.Hostname()
+    if err != nil {
+        host = "127.0.0.1"
+    }
+    return fmt.Sprintf("%s:%d", host, port)
+}
+
+// claim records this node as the owner of the call under each key
+func (a *affinity) claim(ctx context.Context, keys ...string) {
+    for _, key := range keys {
+        if err := a.store.Set(ctx, key, a.config.AdvertiseAddress, a.config.TTL); err != nil {
+            logger.WithContext(ctx).WithField("key", key).WithError(err).Warn("Failed to record call ownership")
+        }
+    }
+}
+
+// owner returns the address of the node owning the call under the first key
+// found, empty when none is recorded or this node owns it
+func (a *affinity) owner(ctx context.Context, keys ...string) string {
+    for _, key := range keys {
+        var addr string
+        if err := a.store.Get(ctx, key, &addr); err != nil || addr == "" {
+            continue
+        }
+        if addr == a.config.AdvertiseAddress {
+            return ""
+        }
+        return addr
+    }
+    return ""
+}
+
+// lookupKeys are the ownership keys of the call an AGI request belongs to
+func (session *Session) lookupKeys(request string) []string {
+    callID := session.headers["agi_uniqueid"]
+    ani := session.headers["agi_callerid"]
+    exten := session.headers["agi_extension"]
+    
+    switch {
+    case strings.Contains(request, agivars.RequestProcessReturn):
+        return []string{ownerDIDKey(session.dialedDID(exten))}
+    case strings.Contains(request, agivars.RequestProcessFinal):
+        return []string{ownerFinalKey(ani, exten)}
+    case strings.Contains(request, agivars.RequestHangup):
+        return []string{ownerCallKey(callID)}
+    case strings.Contains(request, agivars.RequestNoAnswer), strings.Contains(request, agivars.RequestDialFailed):
+        return []string{ownerCallKey(callID), ownerDIDKey(session.dialedDID(exten))}
+    }
+    // New calls are owned by whichever node takes them
+    return nil
+}
+
+// dialedDID is the DID of an extension, without the correlation token a
+// dnis_suffix deployment appends to it. Ownership is claimed on the DID.
+func (session *Session) dialedDID(exten string) string {
+    if session.server.router == nil {
+        return exten
+    }
+    did, _ := session.server.router.GetCorrelation().SplitDNIS(exten)
+    return did
+}
+
+// dispatch relays the session to the node owning its call, reporting whether
+// it did. Sessions are handled here when the owner cannot be reached.
+func (session *Session) dispatch(request string) bool {
+    a := session.server.affinity
+    if a == nil || session.headers[forwardedHeader] != "" {
+        return false
+    }
+    
+    keys := session.lookupKeys(request)
+    if len(keys) == 0 {
+        return false
+    }
+    addr := a.owner(session.ctx, keys...)
+    if addr == "" {
+        return false
+    }
+    
+    action := requestAction(request)
+    log := logger.WithContext(session.ctx).WithField("owner", addr).WithField("action", action)
+    
+    upstream, err := net.DialTimeout("tcp", addr, a.config.DialTimeout)
+    if err != nil {
+        log.WithError(err).Warn("Call owner unreachable, handling the AGI session locally")
+        session.server.metrics.IncrementCounter("agi_forwarded", map[string]string{
+            "action": action,
+            "result": "unreachable",
+        })
+        return false
+    }
+    defer upstream.Close()
+    
+    log.Debug("Forwarding AGI session to the call owner")
+    session.server.metrics.IncrementCounter("agi_forwarded", map[string]string{
+        "action": action,
+        "result": "forwarded",
+    })
+    
+    if err := session.relay(upstream, a.config.AdvertiseAddress); err != nil {
+        log.WithError(err).Warn("AGI session relay ended with an error")
+    }
+    return true
+}
+
+// relay replays the headers to the owner, marked as forwarded, and then
+// copies the session both ways until either side hangs up
+func (session *Session) relay(upstream net.Conn, self string) error {
+    deadline := time.Now().Add(session.server.config.IdleTimeout)
+    session.conn.SetDeadline(deadline)
+    upstream.SetDeadline(deadline)
+    
+    var headers strings.Builder
+    for key, value := range session.headers {
+        fmt.Fprintf(&headers, "%s: %s\n", key, value)
+    }
+    fmt.Fprintf(&headers, "%s: %s\n\n", forwardedHeader, self)
+    if _, err := io.WriteString(upstream, headers.String()); err != nil {
+        return err
+    }
+    
+    var wg sync.WaitGroup
+    var upErr error
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        // Asterisk may have sent past the headers, the buffered reader holds it
+        _, upErr = io.Copy(upstream, session.reader)
+        if tcp, ok := upstream.(*net.TCPConn); ok {
+            tcp.CloseWrite()
+        }
+    }()
+    
+    _, downErr := io.Copy(session.conn, upstream)
+    session.conn.SetReadDeadline(time.Now())
+    wg.Wait()
+    
+    if downErr != nil {
+        return downErr
+    }
+    if upErr != nil && !isDeadline(upErr) {
+        return upErr
+    }
+    return nil
+}
+
+func isDeadline(err error) bool {
+    netErr, ok := err.(net.Error)
+    return ok && netErr.Timeout()
+}
+
+// claimIncoming records this node as the owner of a call it just routed to S3
+func (session *Session) claimIncoming(callID string, response *models.CallResponse) {
+    if a := session.server.affinity; a != nil {
+        keys := []string{ownerCallKey(callID)}
+        if response.DIDAssigned != "" {
+            keys = append(keys, ownerDIDKey(response.DIDAssigned))
+        }
+        // Either intermediate of a parallel dial may bring the call back
+        if response.ParallelDID != "" {
+            keys = append(keys, ownerDIDKey(response.ParallelDID))
+        }
+        // Any hop of a serial fork may bring the call back
+        for _, hop := range response.ForkHops {
+            keys = append(keys, ownerDIDKey(hop.DIDAssigned))
+        }
+        a.claim(session.ctx, keys...)
+    }
+}
+
+// claimReturn records this node as the owner of the leg it just sent to S4
+func (session *Session) claimReturn(response *models.CallResponse) {
+    if a := session.server.affinity; a != nil && response.ANIToSend != "" {
+        a.claim(session.ctx, ownerFinalKey(response.ANIToSend, response.DNISToSend))
+    }
+}
+
+// claimRouteHop records this node as the owner of the DID the next hop of a
+// route brings the call back on
+func (session *Session) claimRouteHop(response *models.CallResponse) {
+    if a := session.server.affinity; a != nil && response.DIDAssigned != "" {
+        a.claim(session.ctx, ownerDIDKey(response.DIDAssigned))
+    }
+}
+
+// releaseCall forgets the ownership of a call that hung up. Its DID and final
+// leg keys are overwritten by the next call to use them or expire.
+func (session *Session) releaseCall(callID string) {
+    if a := session.server.affinity; a != nil {
+        a.store.Delete(session.ctx, ownerCallKey(callID))
+    }
+}
+
+func requestAction(request string) string {
+    switch {
+    case strings.Contains(request, agivars.RequestProcessReturn):
+        return "process_return"
+    case strings.Contains(request, agivars.RequestProcessFinal):
+        return "process_final"
+    case strings.Contains(request, agivars.RequestHangup):
+        return "hangup"
+    case strings.Contains(request, agivars.RequestNoAnswer):
+        return "no_answer"
+    case strings.Contains(request, agivars.RequestDialFailed):
+        return "dial_failed"
+    }
+    return "process_incoming"
+}
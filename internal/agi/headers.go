@@ -0,0 +1,142 @@
+package agi
+
+import (
+    "bufio"
+    "fmt"
+    "regexp"
+    "strings"
+    "unicode/utf8"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/agivars"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// Header limits used when the configuration leaves them unset. Asterisk sends
+// about 25 headers of well under a hundred bytes each.
+const (
+    defaultMaxHeaders     = 64
+    defaultMaxHeaderLine  = 1024
+    defaultMaxHeaderBytes = 8192
+)
+
+var (
+    headerNamePattern = regexp.MustCompile(`^agi_[a-z0-9_]+$`)
+    uniqueIDPattern   = regexp.MustCompile(`^[A-Za-z0-9._-]{1,150}$`)
+    extensionPattern  = regexp.MustCompile(`^[A-Za-z0-9+*#_.-]{1,80}$`)
+)
+
+// Headers every session must carry, and those the requests read on top
+var (
+    sessionHeaders = []string{"agi_request", "agi_uniqueid", "agi_channel"}
+    requestHeaders = map[string][]string{
+        agivars.RequestProcessIncoming: {"agi_callerid", "agi_extension"},
+        agivars.RequestProcessReturn:   {"agi_callerid", "agi_extension"},
+        agivars.RequestProcessFinal:    {"agi_callerid", "agi_extension"},
+        agivars.RequestNoAnswer:        {"agi_extension"},
+        agivars.RequestDialFailed:      {"agi_extension"},
+    }
+)
+
+// malformed rejects a session, reason labels the rejection metric
+func malformed(reason, message string) error {
+    return errors.New(errors.ErrAGIMalformedRequest, message).WithContext("reason", reason)
+}
+
+func (s *Server) headerLimits() (count, line, total int) {
+    count, line, total = s.config.MaxHeaders, s.config.MaxHeaderLine, s.config.MaxHeaderBytes
+    if count <= 0 {
+        count = defaultMaxHeaders
+    }
+    if line <= 0 {
+        line = defaultMaxHeaderLine
+    }
+    if total <= 0 {
+        total = defaultMaxHeaderBytes
+    }
+    return count, line, total
+}
+
+// readHeaderLine reads a line of at most limit bytes, so a peer can't make
+// the server buffer an endless header
+func (session *Session) readHeaderLine(limit int) (string, error) {
+    var line []byte
+    for {
+        chunk, err := session.reader.ReadSlice('\n')
+        line = append(line, chunk...)
+        if len(line) > limit {
+            return "", malformed("header_too_long", fmt.Sprintf("AGI header longer than %d bytes", limit))
+        }
+        if err == bufio.ErrBufferFull {
+            continue
+        }
+        if err != nil {
+            return "", err
+        }
+        return string(line), nil
+    }
+}
+
+// parseHeader splits a header line and checks its name and value
+func parseHeader(line string) (string, string, error) {
+    parts := strings.SplitN(line, ":", 2)
+    if len(parts) != 2 {
+        return "", "", malformed("malformed_header", "AGI header without a colon")
+    }
+    
+    key := strings.TrimSpace(parts[0])
+    value := strings.TrimSpace(parts[1])
+    if !headerNamePattern.MatchString(key) {
+        return "", "", malformed("invalid_header", fmt.Sprintf("invalid AGI header name %q", key))
+    }
+    if !utf8.ValidString(value) {
+        return "", "", malformed("invalid_header", "AGI header "+key+" is not valid UTF-8")
+    }
+    for _, c := range value {
+        if (c < 0x20 && c != '\t') || c == 0x7f {
+            return "", "", malformed("invalid_header", "AGI header "+key+" contains control characters")
+        }
+    }
+    return key, value, nil
+}
+
+// validateHeaders checks that the headers the request needs are there and
+// that the ones used as identifiers look like them
+func (session *Session) validateHeaders() error {
+    required := append([]string{}, sessionHeaders...)
+    request := session.headers["agi_request"]
+    for name, headers := range requestHeaders {
+        if strings.Contains(request, name) {
+            required = append(required, headers...)
+            break
+        }
+    }
+    
+    for _, key := range required {
+        if session.headers[key] == "" {
+            return malformed("missing_header", "AGI header "+key+" is missing")
+        }
+    }
+    
+    if !uniqueIDPattern.MatchString(session.headers["agi_uniqueid"]) {
+        return malformed("invalid_header", fmt.Sprintf("invalid AGI unique ID %q", session.headers["agi_uniqueid"]))
+    }
+    if exten, ok := session.headers["agi_extension"]; ok && exten != "" && !extensionPattern.MatchString(exten) {
+        return malformed("invalid_header", fmt.Sprintf("invalid AGI extension %q", exten))
+    }
+    return nil
+}
+
+// rejectMalformed logs and counts a session dropped for its headers
+func (session *Session) rejectMalformed(err *errors.AppError) {
+    reason, _ := err.Context["reason"].(string)
+    logger.Warn("Rejecting malformed AGI session",
+        "session_id", session.id,
+        "remote_addr", session.conn.RemoteAddr().String(),
+        "reason", reason,
+        "error", err.Message)
+    
+    session.server.metrics.IncrementCounter("agi_connections_rejected", map[string]string{
+        "reason": reason,
+    })
+}
@@ -6,11 +6,15 @@ import (
     "fmt"
     "io"
     "net"
+    "regexp"
+    "strconv"
     "strings"
     "sync"
     "sync/atomic"
     "time"
     
+    "github.com/hamzaKhattat/ara-production-system/internal/agivars"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
     "github.com/hamzaKhattat/ara-production-system/internal/router"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
     "github.com/hamzaKhattat/ara-production-system/pkg/errors"
@@ -22,6 +26,9 @@ const (
     AGIError   = "510 Invalid or unknown command"
 )
 
+// sipCausePattern finds the response code in a PJSIP technology hangup cause
+var sipCausePattern = regexp.MustCompile(`^SIP (\d{3})`)
+
 type Server struct {
     router  *router.Router
     config  Config
@@ -38,6 +45,9 @@ type Server struct {
     
     // Metrics
     metrics MetricsInterface
+    
+    // Dispatch to the node owning the call, nil when disabled
+    affinity *affinity
 }
 
 type Config struct {
@@ -48,6 +58,9 @@ type Config struct {
     WriteTimeout     time.Duration
     IdleTimeout      time.Duration
     ShutdownTimeout  time.Duration
+    MaxHeaders       int // headers a session may send
+    MaxHeaderLine    int // bytes of one header line
+    MaxHeaderBytes   int // bytes of all headers of a session
 }
 
 type MetricsInterface interface {
@@ -222,16 +235,17 @@ func (s *Server) handleConnection(conn net.Conn) {
 }
 
 func (session *Session) handle() error {
-    // Read AGI headers
+    // Read AGI headers, sessions with malformed ones are dropped unanswered
     if err := session.readHeaders(); err != nil {
+        if appErr, ok := err.(*errors.AppError); ok && appErr.Code == errors.ErrAGIMalformedRequest {
+            session.rejectMalformed(appErr)
+            return nil
+        }
         return errors.Wrap(err, errors.ErrAGIConnection, "failed to read headers")
     }
     
     // Extract request info
     request := session.headers["agi_request"]
-    if request == "" {
-        return errors.New(errors.ErrAGIInvalidCmd, "no AGI request found")
-    }
     
     // Add context values
     session.ctx = context.WithValue(session.ctx, "session_id", session.id)
@@ -246,16 +260,25 @@ func (session *Session) handle() error {
         "callerid", session.headers["agi_callerid"],
         "extension", session.headers["agi_extension"])
     
+    // Events of a call another node routes are handled where its state is
+    if session.dispatch(request) {
+        return nil
+    }
+    
     // Route request
     switch {
-    case strings.Contains(request, "processIncoming"):
+    case strings.Contains(request, agivars.RequestProcessIncoming):
         return session.handleProcessIncoming()
-    case strings.Contains(request, "processReturn"):
+    case strings.Contains(request, agivars.RequestProcessReturn):
         return session.handleProcessReturn()
-    case strings.Contains(request, "processFinal"):
+    case strings.Contains(request, agivars.RequestProcessFinal):
         return session.handleProcessFinal()
-    case strings.Contains(request, "hangup"):
+    case strings.Contains(request, agivars.RequestHangup):
         return session.handleHangup()
+    case strings.Contains(request, agivars.RequestNoAnswer):
+        return session.handleNoAnswer()
+    case strings.Contains(request, agivars.RequestDialFailed):
+        return session.handleDialFailed()
     default:
         log.Warn("Unknown AGI request", "request", request)
         return session.sendResponse(AGIFailure)
@@ -264,12 +287,18 @@ func (session *Session) handle() error {
 
 func (session *Session) readHeaders() error {
     session.updateActivity()
+    maxCount, maxLine, maxTotal := session.server.headerLimits()
+    total := 0
     
     for {
-        line, err := session.reader.ReadString('\n')
+        line, err := session.readHeaderLine(maxLine)
         if err != nil {
             return err
         }
+    
+        if total += len(line); total > maxTotal {
+            return malformed("headers_too_large", fmt.Sprintf("AGI headers larger than %d bytes", maxTotal))
+        }
         
         line = strings.TrimSpace(line)
         
@@ -279,15 +308,20 @@ func (session *Session) readHeaders() error {
         }
         
         // Parse header
-        parts := strings.SplitN(line, ":", 2)
-        if len(parts) == 2 {
-            key := strings.TrimSpace(parts[0])
-            value := strings.TrimSpace(parts[1])
-            session.headers[key] = value
+        key, value, err := parseHeader(line)
+        if err != nil {
+            return err
+        }
+        if _, exists := session.headers[key]; exists {
+            return malformed("duplicate_header", "AGI header "+key+" sent twice")
         }
+        if len(session.headers) >= maxCount {
+            return malformed("too_many_headers", fmt.Sprintf("more than %d AGI headers", maxCount))
+        }
+        session.headers[key] = value
     }
     
-    return nil
+    return session.validateHeaders()
 }
 
 func (session *Session) handleProcessIncoming() error {
@@ -300,9 +334,19 @@ func (session *Session) handleProcessIncoming() error {
     // Extract provider from channel
     inboundProvider := session.extractProviderFromChannel(channel)
     
+    // Test calls the router originated come in on a Local channel, standing in
+    // for the provider of the route they test
+    ctx := session.ctx
+    if strings.HasPrefix(channel, "Local/") {
+        if route := session.getVariable(agivars.OriginateRoute); route != "" {
+            inboundProvider = session.getVariable(agivars.OriginateInbound)
+            ctx = router.WithOriginatedRoute(ctx, route)
+        }
+    }
+    
     // Process through router
     startTime := time.Now()
-    response, err := session.server.router.ProcessIncomingCall(session.ctx, callID, ani, dnis, inboundProvider)
+    response, err := session.server.router.ProcessIncomingCall(ctx, callID, ani, dnis, inboundProvider)
     processingTime := time.Since(startTime)
     
     // Update metrics
@@ -313,13 +357,19 @@ func (session *Session) handleProcessIncoming() error {
     if err != nil {
         log := logger.WithContext(session.ctx)
         log.Error("Failed to process incoming call", "error", err.Error())
-        session.setVariable("ROUTER_STATUS", "failed")
-        session.setVariable("ROUTER_ERROR", err.Error())
+        session.setVariable(agivars.RouterStatus, agivars.StatusFailed)
+        session.setVariable(agivars.RouterError, err.Error())
         
         errorCode := "UNKNOWN_ERROR"
         if appErr, ok := err.(*errors.AppError); ok {
             errorCode = string(appErr.Code)
+    
+            // A call that timed out in a route queue, for the dialplan to fail over or reject
+            if position, queued := appErr.Context["queue_position"].(int); queued {
+                session.setQueueVariables(position, appErr.Context["queue_wait"], appErr.Context["queue_timeout"])
+            }
         }
+        session.setVariable(agivars.RouterErrorCode, errorCode)
         
         session.server.metrics.IncrementCounter("agi_requests_failed", map[string]string{
             "action": "process_incoming",
@@ -329,13 +379,20 @@ func (session *Session) handleProcessIncoming() error {
         return session.sendResponse(AGISuccess)
     }
     
-    // Set channel variables for dialplan
-    session.setVariable("ROUTER_STATUS", "success")
-    session.setVariable("DID_ASSIGNED", response.DIDAssigned)
-    session.setVariable("NEXT_HOP", response.NextHop)
-    session.setVariable("ANI_TO_SEND", response.ANIToSend)
-    session.setVariable("DNIS_TO_SEND", response.DNISToSend)
-    session.setVariable("INTERMEDIATE_PROVIDER", strings.TrimPrefix(response.NextHop, "endpoint-"))
+    // Set channel variables for dialplan, a pass-through route sends the
+    // call straight to S4 without a DID
+    if response.DIDAssigned != "" {
+        session.setIncomingVariables(response)
+        session.claimIncoming(callID, response)
+    } else {
+        session.setReturnVariables(response)
+        if response.QueueTimeout > 0 {
+            session.setQueueVariables(response.QueuePosition, response.QueueWait, response.QueueTimeout)
+        }
+        session.setForkVariables(response)
+        session.claimIncoming(callID, response)
+        session.claimReturn(response)
+    }
     
     session.server.metrics.IncrementCounter("agi_requests_success", map[string]string{
         "action": "process_incoming",
@@ -350,15 +407,16 @@ func (session *Session) handleProcessReturn() error {
     did := session.headers["agi_extension"]
     channel := session.headers["agi_channel"]
     
-    // Get source IP from channel variable
-    sourceIP := session.getVariable("SOURCE_IP")
+    // Get source IP and correlation token from channel variables
+    sourceIP := session.getVariable(agivars.SourceIP)
+    token := session.getVariable(agivars.CorrelationToken)
     
     // Extract provider from channel
     intermediateProvider := session.extractProviderFromChannel(channel)
     
     // Process through router
     startTime := time.Now()
-    response, err := session.server.router.ProcessReturnCall(session.ctx, ani2, did, intermediateProvider, sourceIP)
+    response, err := session.server.router.ProcessReturnCall(session.ctx, ani2, did, token, intermediateProvider, sourceIP)
     processingTime := time.Since(startTime)
     
     // Update metrics
@@ -369,13 +427,14 @@ func (session *Session) handleProcessReturn() error {
     if err != nil {
         log := logger.WithContext(session.ctx)
         log.Error("Failed to process return call", "error", err.Error())
-        session.setVariable("ROUTER_STATUS", "failed")
-        session.setVariable("ROUTER_ERROR", err.Error())
+        session.setVariable(agivars.RouterStatus, agivars.StatusFailed)
+        session.setVariable(agivars.RouterError, err.Error())
         
         errorCode := "UNKNOWN_ERROR"
         if appErr, ok := err.(*errors.AppError); ok {
             errorCode = string(appErr.Code)
         }
+        session.setVariable(agivars.RouterErrorCode, errorCode)
         
         session.server.metrics.IncrementCounter("agi_requests_failed", map[string]string{
             "action": "process_return",
@@ -385,12 +444,20 @@ func (session *Session) handleProcessReturn() error {
         return session.sendResponse(AGISuccess)
     }
     
+    // Routes of several intermediates hand the call to their next hop before S4
+    if response.Hop > 0 {
+        session.setRouteHopVariables(response)
+        session.claimRouteHop(response)
+    
+        session.server.metrics.IncrementCounter("agi_requests_success", map[string]string{
+            "action": "process_return",
+        })
+        return session.sendResponse(AGISuccess)
+    }
+    
     // Set channel variables for routing to S4
-    session.setVariable("ROUTER_STATUS", "success")
-    session.setVariable("NEXT_HOP", response.NextHop)
-    session.setVariable("ANI_TO_SEND", response.ANIToSend)
-    session.setVariable("DNIS_TO_SEND", response.DNISToSend)
-    session.setVariable("FINAL_PROVIDER", strings.TrimPrefix(response.NextHop, "endpoint-"))
+    session.setReturnVariables(response)
+    session.claimReturn(response)
     
     session.server.metrics.IncrementCounter("agi_requests_success", map[string]string{
         "action": "process_return",
@@ -399,6 +466,164 @@ func (session *Session) handleProcessReturn() error {
     return session.sendResponse(AGISuccess)
 }
 
+// setQueueVariables tells the dialplan how the call fared in a route queue
+func (session *Session) setQueueVariables(position int, wait, timeout interface{}) {
+    session.setVariable(agivars.QueuePosition, strconv.Itoa(position))
+    session.setVariable(agivars.QueueWait, fmt.Sprint(wait))
+    session.setVariable(agivars.QueueTimeout, fmt.Sprint(timeout))
+}
+
+// setIncomingVariables hands the leg to S3 to the dialplan
+func (session *Session) setIncomingVariables(response *models.CallResponse) {
+    session.setVariable(agivars.RouterStatus, agivars.StatusSuccess)
+    if response.QueueTimeout > 0 {
+        session.setQueueVariables(response.QueuePosition, response.QueueWait, response.QueueTimeout)
+    }
+    session.setVariable(agivars.DIDAssigned, response.DIDAssigned)
+    session.setVariable(agivars.NextHop, response.NextHop)
+    session.setVariable(agivars.ANIToSend, response.ANIToSend)
+    session.setVariable(agivars.DNISToSend, response.DNISToSend)
+    session.setVariable(agivars.IntermediateProvider, strings.TrimPrefix(response.NextHop, "endpoint-"))
+    session.setDialVariables(response)
+    if response.CorrelationToken != "" {
+        session.setVariable(agivars.CorrelationToken, response.CorrelationToken)
+    }
+    session.setForkVariables(response)
+}
+
+// setForkVariables hands the dialplan the hops of a serial fork, dialed in
+// turn when the intermediate before doesn't take the call. A leg without
+// one resets the count left by an earlier response.
+func (session *Session) setForkVariables(response *models.CallResponse) {
+    session.setVariable(agivars.ForkHops, strconv.Itoa(len(response.ForkHops)))
+    for i, hop := range response.ForkHops {
+        n := i + 1
+        session.setVariable(agivars.ForkVar(agivars.DIDAssigned, n), hop.DIDAssigned)
+        session.setVariable(agivars.ForkVar(agivars.IntermediateProvider, n), strings.TrimPrefix(hop.NextHop, "endpoint-"))
+        session.setVariable(agivars.ForkVar(agivars.DNISToSend, n), hop.DNISToSend)
+        session.setVariable(agivars.ForkVar(agivars.CorrelationToken, n), hop.CorrelationToken)
+        session.setVariable(agivars.ForkVar(agivars.DialString, n), hop.DialString)
+        session.setVariable(agivars.ForkVar(agivars.DialTimeout, n), strconv.Itoa(hop.DialTimeout))
+        session.setVariable(agivars.ForkVar(agivars.DialOptions, n), hop.DialOptions)
+    }
+}
+
+// setRouteHopVariables hands the dialplan the next intermediate of a route of
+// several hops, dialed from the return leg as the first was from S1's call
+func (session *Session) setRouteHopVariables(response *models.CallResponse) {
+    session.setIncomingVariables(response)
+    session.setVariable(agivars.RouteHop, strconv.Itoa(response.Hop))
+}
+
+// setReturnVariables hands the leg to S4 to the dialplan
+func (session *Session) setReturnVariables(response *models.CallResponse) {
+    session.setVariable(agivars.RouterStatus, agivars.StatusSuccess)
+    session.setVariable(agivars.NextHop, response.NextHop)
+    session.setVariable(agivars.ANIToSend, response.ANIToSend)
+    session.setVariable(agivars.DNISToSend, response.DNISToSend)
+    session.setVariable(agivars.FinalProvider, strings.TrimPrefix(response.NextHop, "endpoint-"))
+    session.setDialVariables(response)
+}
+
+func (session *Session) handleNoAnswer() error {
+    // The inbound leg is known by its call ID, the return leg by its DID
+    callID := session.headers["agi_uniqueid"]
+    did := session.headers["agi_extension"]
+    
+    startTime := time.Now()
+    response, err := session.server.router.ProcessNoAnswer(session.ctx, callID, did)
+    processingTime := time.Since(startTime)
+    
+    session.server.metrics.ObserveHistogram("agi_processing_time", processingTime.Seconds(), map[string]string{
+        "action": "no_answer",
+    })
+    
+    if err != nil {
+        log := logger.WithContext(session.ctx)
+        log.Warn("No failover for unanswered leg", "error", err.Error())
+        session.setVariable(agivars.RouterStatus, agivars.StatusFailed)
+        session.setVariable(agivars.RouterError, err.Error())
+        
+        errorCode := "UNKNOWN_ERROR"
+        if appErr, ok := err.(*errors.AppError); ok {
+            errorCode = string(appErr.Code)
+        }
+        session.setVariable(agivars.RouterErrorCode, errorCode)
+        
+        session.server.metrics.IncrementCounter("agi_requests_failed", map[string]string{
+            "action": "no_answer",
+            "error": errorCode,
+        })
+        
+        return session.sendResponse(AGISuccess)
+    }
+    
+    // Only the leg to S3 carries a DID
+    if response.DIDAssigned != "" {
+        session.setIncomingVariables(response)
+        session.claimIncoming(callID, response)
+    } else {
+        session.setReturnVariables(response)
+        session.claimReturn(response)
+    }
+    
+    session.server.metrics.IncrementCounter("agi_requests_success", map[string]string{
+        "action": "no_answer",
+    })
+    
+    return session.sendResponse(AGISuccess)
+}
+
+func (session *Session) handleDialFailed() error {
+    // Found like an unanswered leg, by its call ID or its DID
+    callID := session.headers["agi_uniqueid"]
+    did := session.headers["agi_extension"]
+    dialStatus := session.getVariable(agivars.DialStatus)
+    
+    startTime := time.Now()
+    response, err := session.server.router.ProcessDialFailure(session.ctx, callID, did, dialStatus)
+    processingTime := time.Since(startTime)
+    
+    session.server.metrics.ObserveHistogram("agi_processing_time", processingTime.Seconds(), map[string]string{
+        "action": "dial_failed",
+    })
+    
+    if err != nil {
+        log := logger.WithContext(session.ctx)
+        log.Warn("No failover route for failed leg", "error", err.Error())
+        session.setVariable(agivars.RouterStatus, agivars.StatusFailed)
+        session.setVariable(agivars.RouterError, err.Error())
+    
+        errorCode := "UNKNOWN_ERROR"
+        if appErr, ok := err.(*errors.AppError); ok {
+            errorCode = string(appErr.Code)
+        }
+        session.setVariable(agivars.RouterErrorCode, errorCode)
+    
+        session.server.metrics.IncrementCounter("agi_requests_failed", map[string]string{
+            "action": "dial_failed",
+            "error": errorCode,
+        })
+    
+        return session.sendResponse(AGISuccess)
+    }
+    
+    // Only the leg to S3 carries a DID
+    if response.DIDAssigned != "" {
+        session.setIncomingVariables(response)
+        session.claimIncoming(callID, response)
+    } else {
+        session.setReturnVariables(response)
+        session.claimReturn(response)
+    }
+    
+    session.server.metrics.IncrementCounter("agi_requests_success", map[string]string{
+        "action": "dial_failed",
+    })
+    
+    return session.sendResponse(AGISuccess)
+}
+
 func (session *Session) handleProcessFinal() error {
     // Extract call information
     callID := session.headers["agi_uniqueid"]
@@ -407,7 +632,7 @@ func (session *Session) handleProcessFinal() error {
     channel := session.headers["agi_channel"]
     
     // Get source IP from channel variable
-    sourceIP := session.getVariable("SOURCE_IP")
+    sourceIP := session.getVariable(agivars.SourceIP)
     
     // Extract provider from channel
     finalProvider := session.extractProviderFromChannel(channel)
@@ -447,9 +672,17 @@ func (session *Session) handleProcessFinal() error {
 func (session *Session) handleHangup() error {
     callID := session.headers["agi_uniqueid"]
     
+    timing := models.CallTiming{
+        DialStatus: session.getVariable(agivars.DialStatus),
+        Dialed:     session.durationVariable(agivars.DialedTimeMS, agivars.DialedTime),
+        Answered:   session.durationVariable(agivars.AnsweredTimeMS, agivars.AnsweredTime),
+    }
+    timing.HangupCause, _ = strconv.Atoi(session.getVariable(agivars.HangupCause))
+    timing.SIPCode = session.sipResponseCode()
+    
     // Process hangup
     startTime := time.Now()
-    err := session.server.router.ProcessHangup(session.ctx, callID)
+    err := session.server.router.ProcessHangup(session.ctx, callID, timing)
     processingTime := time.Since(startTime)
     
     // Update metrics
@@ -461,6 +694,7 @@ func (session *Session) handleHangup() error {
         log := logger.WithContext(session.ctx)
         log.Warn("Failed to process hangup", "error", err.Error())
     }
+    session.releaseCall(callID)
     
     session.server.metrics.IncrementCounter("agi_requests_success", map[string]string{
         "action": "hangup",
@@ -469,6 +703,42 @@ func (session *Session) handleHangup() error {
     return session.sendResponse(AGISuccess)
 }
 
+// durationVariable reads a dial time in milliseconds, or in seconds when
+// Asterisk is too old to set the milliseconds variable
+func (session *Session) durationVariable(msName, secName string) time.Duration {
+    if ms, err := strconv.ParseInt(session.getVariable(msName), 10, 64); err == nil {
+        return time.Duration(ms) * time.Millisecond
+    }
+    if sec, err := strconv.ParseInt(session.getVariable(secName), 10, 64); err == nil {
+        return time.Duration(sec) * time.Second
+    }
+    return 0
+}
+
+// sipResponseCode is the final SIP response of the last channel dialed, 0
+// when it never got one
+func (session *Session) sipResponseCode() int {
+    keys := strings.Split(session.getVariable(agivars.HangupCauseKeys), ",")
+    channel := strings.TrimSpace(keys[len(keys)-1])
+    if channel == "" {
+        return 0
+    }
+    
+    match := sipCausePattern.FindStringSubmatch(session.getVariable(agivars.HangupCauseTech(channel)))
+    if match == nil {
+        return 0
+    }
+    code, _ := strconv.Atoi(match[1])
+    return code
+}
+
+// setDialVariables hands the Dial the router built for the next leg to the dialplan
+func (session *Session) setDialVariables(response *models.CallResponse) {
+    session.setVariable(agivars.DialString, response.DialString)
+    session.setVariable(agivars.DialTimeout, strconv.Itoa(response.DialTimeout))
+    session.setVariable(agivars.DialOptions, response.DialOptions)
+}
+
 func (session *Session) setVariable(name, value string) error {
     session.updateActivity()
     
@@ -0,0 +1,241 @@
+// Package agivars is the single source of truth for the channel variables and
+// AGI requests shared by the dialplan generator and the AGI server.
+package agivars
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+// Variables set by the router with SET VARIABLE
+const (
+    RouterStatus         = "ROUTER_STATUS"
+    RouterError          = "ROUTER_ERROR"
+    RouterErrorCode      = "ROUTER_ERROR_CODE" // error code of a failed request, RATE_LIMITED plays congestion
+    DIDAssigned          = "DID_ASSIGNED"
+    NextHop              = "NEXT_HOP"
+    ANIToSend            = "ANI_TO_SEND"
+    DNISToSend           = "DNIS_TO_SEND"
+    IntermediateProvider = "INTERMEDIATE_PROVIDER"
+    FinalProvider        = "FINAL_PROVIDER"
+    CorrelationToken     = "CORRELATION_TOKEN"
+    DialString           = "DIAL_STRING"
+    DialTimeout          = "DIAL_TIMEOUT"
+    DialOptions          = "DIAL_OPTIONS"
+    QueuePosition        = "ROUTER_QUEUE_POSITION" // place the call took in a saturated route's queue
+    QueueWait            = "ROUTER_QUEUE_WAIT"     // seconds it waited for capacity
+    QueueTimeout         = "ROUTER_QUEUE_TIMEOUT"
+    ForkHops             = "ROUTER_FORK_HOPS" // intermediates to dial in turn after the first, each in ForkVariables suffixed with its number
+    RouteHop             = "ROUTER_ROUTE_HOP" // hop of a route of several intermediates the return leg goes on to, numbered from 2
+)
+
+// ForkVariables are set once more for each hop of a serial fork, as ForkVar names them
+var ForkVariables = []string{
+    DIDAssigned, IntermediateProvider, DNISToSend, CorrelationToken, DialString, DialTimeout, DialOptions,
+}
+
+// ForkVar returns the name of a variable of a serial fork's hop, numbered from 1
+func ForkVar(name string, hop int) string {
+    return name + "_" + strconv.Itoa(hop)
+}
+
+// ForkRef returns a dialplan reference to a variable of the hop ForkHop counts
+func ForkRef(name string) string {
+    return "${" + name + "_" + Ref(ForkHop) + "}"
+}
+
+// Variables set by the dialplan and read by the router with GET VARIABLE
+const (
+    SourceIP = "SOURCE_IP"
+)
+
+// Variables the router sets on the test calls it originates into InboundContext,
+// read by the AGI server on Local channels only
+const (
+    OriginateRoute   = "ROUTER_ORIGINATE_ROUTE"   // route the call tests, enabled or not
+    OriginateInbound = "ROUTER_ORIGINATE_INBOUND" // provider the call stands in for
+)
+
+// InboundContext is the dialplan context calls from S1 enter
+const InboundContext = "from-provider-inbound"
+
+// Dial results Asterisk leaves on the calling channel, read at hangup. The
+// _MS variants need Asterisk 20 and fall back to the whole seconds ones.
+const (
+    DialStatus      = "DIALSTATUS"
+    DialedTime      = "DIALEDTIME"
+    DialedTimeMS    = "DIALEDTIME_MS"
+    AnsweredTime    = "ANSWEREDTIME"
+    AnsweredTimeMS  = "ANSWEREDTIME_MS"
+    HangupCause     = "HANGUPCAUSE"
+    HangupCauseKeys = "HANGUPCAUSE_KEYS()" // channels with a technology cause, comma separated
+)
+
+// HangupCauseTech returns the function reading the technology specific cause
+// of a dialed channel, "SIP 486 Busy Here" for PJSIP
+func HangupCauseTech(channel string) string {
+    return "HANGUPCAUSE(" + channel + ",tech)"
+}
+
+// Variables only used inside the dialplan
+const (
+    CallID          = "CALLID"
+    InboundProvider = "INBOUND_PROVIDER"
+    OriginalANI     = "ORIGINAL_ANI"
+    OriginalDNIS    = "ORIGINAL_DNIS"
+    ForkHop         = "ROUTER_FORK_HOP" // hop of the serial fork being dialed, 0 for the first intermediate
+)
+
+// ROUTER_STATUS values
+const (
+    StatusSuccess = "success"
+    StatusFailed  = "failed"
+)
+
+// AGI request names, the path part of the agi:// URL
+const (
+    RequestProcessIncoming = "processIncoming"
+    RequestProcessReturn   = "processReturn"
+    RequestProcessFinal    = "processFinal"
+    RequestHangup          = "hangup"
+    RequestNoAnswer        = "noAnswer"
+    RequestDialFailed      = "dialFailed" // the provider of a leg was congested or unavailable
+)
+
+// RouterOutputs are written by the AGI server
+var RouterOutputs = []string{
+    RouterStatus, RouterError, RouterErrorCode, DIDAssigned, NextHop, ANIToSend,
+    DNISToSend, IntermediateProvider, FinalProvider, CorrelationToken,
+    DialString, DialTimeout, DialOptions, QueuePosition, QueueWait, QueueTimeout,
+    ForkHops, RouteHop,
+}
+
+// RouterInputs are read by the AGI server and must be set by the dialplan
+var RouterInputs = []string{
+    SourceIP, CorrelationToken,
+}
+
+// DialplanOnly are shared between dialplan steps but never touched by the AGI server
+var DialplanOnly = []string{
+    CallID, InboundProvider, OriginalANI, OriginalDNIS, ForkHop,
+}
+
+// DialResults are read by the AGI server at hangup, Asterisk sets them rather than the dialplan
+var DialResults = []string{
+    DialStatus, DialedTime, DialedTimeMS, AnsweredTime, AnsweredTimeMS, HangupCause, HangupCauseKeys,
+}
+
+// OriginateInputs are read by the AGI server off the test calls the router originates
+var OriginateInputs = []string{
+    OriginateRoute, OriginateInbound,
+}
+
+// Requests lists every AGI request the server handles
+var Requests = []string{
+    RequestProcessIncoming, RequestProcessReturn, RequestProcessFinal, RequestHangup,
+    RequestNoAnswer, RequestDialFailed,
+}
+
+// asteriskBuiltins are variables provided by Asterisk itself
+var asteriskBuiltins = map[string]bool{
+    "EXTEN":       true,
+    "UNIQUEID":    true,
+    "HANGUPCAUSE": true,
+    "DIALSTATUS":  true,
+    "EPOCH":       true,
+    "ARG1":        true,
+    "ARG2":        true,
+}
+
+var (
+    refPattern  = regexp.MustCompile(`\$\{([A-Z0-9_]+)\}`)
+    forkPattern = regexp.MustCompile(`\$\{([A-Z0-9_]+)_\$\{`)
+    setPattern  = regexp.MustCompile(`^(?:__?)?([A-Z0-9_]+)=`)
+)
+
+// Ref returns a dialplan reference to the variable
+func Ref(name string) string {
+    return "${" + name + "}"
+}
+
+// Inherit returns the variable name with infinite inheritance to child channels
+func Inherit(name string) string {
+    return "__" + name
+}
+
+// AGIURL returns the FastAGI URL for a request
+func AGIURL(baseURL, request string) string {
+    return strings.TrimRight(baseURL, "/") + "/" + request
+}
+
+// IsKnown reports whether name is part of the router contract
+func IsKnown(name string) bool {
+    for _, list := range [][]string{RouterOutputs, RouterInputs, DialplanOnly} {
+        for _, v := range list {
+            if v == name {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+func isForkVariable(name string) bool {
+    for _, v := range ForkVariables {
+        if v == name {
+            return true
+        }
+    }
+    return false
+}
+
+// DialplanStep is the part of a dialplan priority the contract cares about
+type DialplanStep struct {
+    App     string
+    AppData string
+}
+
+// CheckDialplan verifies that the dialplan only references variables of the
+// router contract and sets every variable the AGI server reads
+func CheckDialplan(steps []DialplanStep) error {
+    set := make(map[string]bool)
+    var unknown []string
+    
+    for _, step := range steps {
+        for _, match := range refPattern.FindAllStringSubmatch(step.AppData, -1) {
+            name := match[1]
+            if !asteriskBuiltins[name] && !IsKnown(name) {
+                unknown = append(unknown, name)
+            }
+        }
+        for _, match := range forkPattern.FindAllStringSubmatch(step.AppData, -1) {
+            if !isForkVariable(match[1]) {
+                unknown = append(unknown, match[1]+"_n")
+            }
+        }
+        
+        if step.App == "Set" {
+            if match := setPattern.FindStringSubmatch(step.AppData); match != nil {
+                set[match[1]] = true
+            }
+        }
+    }
+    
+    if len(unknown) > 0 {
+        return fmt.Errorf("dialplan references variables outside the router contract: %s", strings.Join(unknown, ", "))
+    }
+    
+    var missing []string
+    for _, name := range RouterInputs {
+        if !set[name] {
+            missing = append(missing, name)
+        }
+    }
+    if len(missing) > 0 {
+        return fmt.Errorf("dialplan never sets variables read by the router: %s", strings.Join(missing, ", "))
+    }
+    
+    return nil
+}
@@ -0,0 +1,238 @@
+package agivars_test
+
+import (
+    "go/ast"
+    "go/parser"
+    "go/token"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "testing"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/agivars"
+    "github.com/hamzaKhattat/ara-production-system/internal/ara"
+)
+
+func TestGeneratedDialplanKeepsContract(t *testing.T) {
+    contexts := ara.DialplanExtensions()
+    if len(contexts) != len(ara.DialplanContexts) {
+        t.Fatalf("dialplan generates %d contexts, DialplanContexts lists %d", len(contexts), len(ara.DialplanContexts))
+    }
+    
+    var steps []agivars.DialplanStep
+    for _, context := range ara.DialplanContexts {
+        extensions, ok := contexts[context]
+        if !ok || len(extensions) == 0 {
+            t.Fatalf("dialplan generates no extensions for %s", context)
+        }
+        for _, ext := range extensions {
+            steps = append(steps, agivars.DialplanStep{App: ext.App, AppData: ext.AppData})
+        }
+    }
+    
+    if err := agivars.CheckDialplan(steps); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestCheckDialplanRejectsUnknownVariable(t *testing.T) {
+    steps := contractSteps()
+    steps = append(steps, agivars.DialplanStep{App: "Set", AppData: "CDR(carrier)=${CARRIER_NAME}"})
+    
+    err := agivars.CheckDialplan(steps)
+    if err == nil || !strings.Contains(err.Error(), "CARRIER_NAME") {
+        t.Fatalf("expected CARRIER_NAME to be reported outside the contract, got %v", err)
+    }
+}
+
+func TestCheckDialplanRejectsUnknownForkVariable(t *testing.T) {
+    steps := contractSteps()
+    steps = append(steps, agivars.DialplanStep{App: "Set", AppData: "CARRIER=" + agivars.ForkRef("CARRIER")})
+    
+    err := agivars.CheckDialplan(steps)
+    if err == nil || !strings.Contains(err.Error(), "CARRIER_n") {
+        t.Fatalf("expected CARRIER_n to be reported outside the contract, got %v", err)
+    }
+}
+
+func TestCheckDialplanRequiresRouterInputs(t *testing.T) {
+    for _, name := range agivars.RouterInputs {
+        var steps []agivars.DialplanStep
+        for _, step := range contractSteps() {
+            if !strings.Contains(step.AppData, name+"=") {
+                steps = append(steps, step)
+            }
+        }
+    
+        err := agivars.CheckDialplan(steps)
+        if err == nil || !strings.Contains(err.Error(), name) {
+            t.Errorf("expected %s to be reported never set, got %v", name, err)
+        }
+    }
+}
+
+// contractSteps set every variable the router reads and use some it writes
+func contractSteps() []agivars.DialplanStep {
+    var steps []agivars.DialplanStep
+    for _, name := range agivars.RouterInputs {
+        steps = append(steps, agivars.DialplanStep{App: "Set", AppData: agivars.Inherit(name) + "=${CHANNEL(pjsip,remote_addr)}"})
+    }
+    return append(steps,
+        agivars.DialplanStep{App: "AGI", AppData: agivars.AGIURL(ara.AGIBaseURL, agivars.RequestProcessIncoming)},
+        agivars.DialplanStep{App: "Dial", AppData: "${DIAL_STRING},${DIAL_TIMEOUT},${DIAL_OPTIONS}"},
+    )
+}
+
+// sessionAccessors are the agi.Session methods reading and writing channel
+// variables, by the list of the contract the names they take must be in
+var sessionAccessors = map[string]string{
+    "setVariable":      "write",
+    "getVariable":      "read",
+    "durationVariable": "read",
+}
+
+func TestSessionVariablesInContract(t *testing.T) {
+    constants := agivarsConstants(t)
+    
+    outputs := contains(agivars.RouterOutputs)
+    reads := contains(agivars.RouterInputs, agivars.DialResults, agivars.OriginateInputs)
+    forks := contains(agivars.ForkVariables)
+    
+    files, err := filepath.Glob(filepath.Join("..", "agi", "*.go"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    fset := token.NewFileSet()
+    found := 0
+    for _, path := range files {
+        if strings.HasSuffix(path, "_test.go") {
+            continue
+        }
+        file, err := parser.ParseFile(fset, path, nil, 0)
+        if err != nil {
+            t.Fatal(err)
+        }
+    
+        for _, decl := range file.Decls {
+            fn, ok := decl.(*ast.FuncDecl)
+            // The accessors themselves pass on the names given to them
+            if !ok || fn.Body == nil || sessionAccessors[fn.Name.Name] != "" {
+                continue
+            }
+    
+            ast.Inspect(fn.Body, func(n ast.Node) bool {
+                call, ok := n.(*ast.CallExpr)
+                if !ok {
+                    return true
+                }
+                sel, ok := call.Fun.(*ast.SelectorExpr)
+                if !ok {
+                    return true
+                }
+                access := sessionAccessors[sel.Sel.Name]
+                if access == "" {
+                    return true
+                }
+    
+                args := call.Args
+                if access == "write" {
+                    args = args[:1]
+                }
+                for _, arg := range args {
+                    found++
+                    pos := fset.Position(arg.Pos())
+                    name, fork, ok := variableName(arg, constants)
+                    switch {
+                    case !ok:
+                        t.Errorf("%s: %s takes a variable name not from agivars", pos, sel.Sel.Name)
+                    case fork && !forks[name]:
+                        t.Errorf("%s: %s is set per fork hop but not in ForkVariables", pos, name)
+                    case access == "write" && !outputs[name]:
+                        t.Errorf("%s: session sets %s, not in RouterOutputs", pos, name)
+                    case access == "read" && !reads[name]:
+                        t.Errorf("%s: session reads %s, not in RouterInputs, DialResults or OriginateInputs", pos, name)
+                    }
+                }
+                return true
+            })
+        }
+    }
+    
+    if found == 0 {
+        t.Fatal("found no variables the AGI session sets or reads")
+    }
+}
+
+// variableName resolves a variable name passed to a session accessor: an
+// agivars constant, a fork hop's variable or a dial result function
+func variableName(expr ast.Expr, constants map[string]string) (name string, fork bool, ok bool) {
+    switch e := expr.(type) {
+    case *ast.SelectorExpr:
+        if pkg, isIdent := e.X.(*ast.Ident); isIdent && pkg.Name == "agivars" {
+            name, ok = constants[e.Sel.Name]
+            return name, false, ok
+        }
+    case *ast.CallExpr:
+        sel, isSel := e.Fun.(*ast.SelectorExpr)
+        if !isSel || len(e.Args) == 0 {
+            return "", false, false
+        }
+        if pkg, isIdent := sel.X.(*ast.Ident); !isIdent || pkg.Name != "agivars" {
+            return "", false, false
+        }
+        switch sel.Sel.Name {
+        case "ForkVar":
+            name, _, ok = variableName(e.Args[0], constants)
+            return name, true, ok
+        case "HangupCauseTech":
+            return agivars.HangupCause, false, true
+        }
+    }
+    return "", false, false
+}
+
+// agivarsConstants reads the string constants of the package by name
+func agivarsConstants(t *testing.T) map[string]string {
+    t.Helper()
+    
+    source, err := os.ReadFile("vars.go")
+    if err != nil {
+        t.Fatal(err)
+    }
+    file, err := parser.ParseFile(token.NewFileSet(), "vars.go", source, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    
+    constants := make(map[string]string)
+    for _, decl := range file.Decls {
+        gen, ok := decl.(*ast.GenDecl)
+        if !ok || gen.Tok != token.CONST {
+            continue
+        }
+        for _, spec := range gen.Specs {
+            value := spec.(*ast.ValueSpec)
+            for i, ident := range value.Names {
+                if i >= len(value.Values) {
+                    continue
+                }
+                if lit, ok := value.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+                    constants[ident.Name], _ = strconv.Unquote(lit.Value)
+                }
+            }
+        }
+    }
+    return constants
+}
+
+func contains(lists ...[]string) map[string]bool {
+    set := make(map[string]bool)
+    for _, list := range lists {
+        for _, name := range list {
+            set[name] = true
+        }
+    }
+    return set
+}
@@ -0,0 +1,107 @@
+package ami
+
+import (
+    "context"
+    "strconv"
+    "strings"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// LiveChannels lists the channels Asterisk holds. Channels carrying media
+// of their own, PJSIP ones that are up, get their codec and RTCP stats;
+// reading those costs two actions per channel.
+func (m *Manager) LiveChannels(ctx context.Context) ([]models.LiveChannel, error) {
+    events, err := m.ShowChannels()
+    if err != nil {
+        return nil, err
+    }
+    
+    channels := make([]models.LiveChannel, 0, len(events))
+    for _, event := range events {
+        ch := models.LiveChannel{
+            Channel:     event["Channel"],
+            UniqueID:    event["Uniqueid"],
+            LinkedID:    event["Linkedid"],
+            Context:     event["Context"],
+            Exten:       event["Exten"],
+            State:       event["ChannelStateDesc"],
+            Application: event["Application"],
+            CallerID:    event["CallerIDNum"],
+            Duration:    parseDuration(event["Duration"]),
+            BridgeID:    event["BridgeId"],
+        }
+    
+        if strings.HasPrefix(ch.Channel, "PJSIP/") && event["ChannelState"] == channelStateUp {
+            if err := ctx.Err(); err != nil {
+                return nil, err
+            }
+            ch.Codec, _ = m.ChannelVar(ch.Channel, "CHANNEL(audionativeformat)")
+            if quality, err := m.ChannelVar(ch.Channel, "CHANNEL(rtcp,all)"); err == nil && quality != "" {
+                ch.RTP = parseRTCPQuality(quality)
+            }
+        }
+        channels = append(channels, ch)
+    }
+    return channels, nil
+}
+
+// ChannelVar reads a variable or dialplan function of a channel
+func (m *Manager) ChannelVar(channel, variable string) (string, error) {
+    response, err := m.SendAction(Action{
+        Action: "Getvar",
+        Fields: map[string]string{
+            "Channel":  channel,
+            "Variable": variable,
+        },
+    })
+    if err != nil {
+        return "", err
+    }
+    
+    if response["Response"] != "Success" {
+        return "", errors.New(errors.ErrInternal, "Getvar failed").
+            WithContext("channel", channel).
+            WithContext("message", response["Message"])
+    }
+    return response["Value"], nil
+}
+
+// parseDuration reads the HH:MM:SS duration of CoreShowChannel
+func parseDuration(value string) int {
+    seconds := 0
+    for _, part := range strings.Split(value, ":") {
+        n, err := strconv.Atoi(part)
+        if err != nil {
+            return 0
+        }
+        seconds = seconds*60 + n
+    }
+    return seconds
+}
+
+// parseRTCPQuality reads the quality string of CHANNEL(rtcp,all), as in
+// ssrc=..;themssrc=..;lp=0;rxjitter=0.000125;rxcount=..;txjitter=..;txcount=..;rlp=0;rtt=0.002
+func parseRTCPQuality(quality string) *models.RTPStats {
+    stats := &models.RTPStats{}
+    for _, field := range strings.Split(quality, ";") {
+        key, value, ok := strings.Cut(field, "=")
+        if !ok {
+            continue
+        }
+        switch key {
+        case "rxjitter":
+            stats.RxJitter, _ = strconv.ParseFloat(value, 64)
+        case "txjitter":
+            stats.TxJitter, _ = strconv.ParseFloat(value, 64)
+        case "lp":
+            stats.RxLost, _ = strconv.Atoi(value)
+        case "rlp":
+            stats.TxLost, _ = strconv.Atoi(value)
+        case "rtt":
+            stats.RTT, _ = strconv.ParseFloat(value, 64)
+        }
+    }
+    return stats
+}
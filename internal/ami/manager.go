@@ -3,13 +3,17 @@ package ami
 import (
     "bufio"
     "context"
+    "crypto/tls"
     "fmt"
+    "math"
     "net"
+    "strconv"
     "strings"
     "sync"
     "sync/atomic"
     "time"
     
+    "github.com/hamzaKhattat/ara-production-system/internal/faults"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
     "github.com/hamzaKhattat/ara-production-system/pkg/errors"
 )
@@ -35,6 +39,12 @@ type Manager struct {
     pendingActions map[string]chan Event
     actionMutex    sync.Mutex
     
+    // Channel event watchers keyed by Uniqueid or ActionID, and the events
+    // of listing actions keyed by ActionID
+    watchers map[string]chan Event
+    listings map[string]*eventListing
+    watchMu  sync.Mutex
+    
     // Connection management
     shutdown      chan struct{}
     reconnectChan chan struct{}
@@ -58,11 +68,22 @@ type Config struct {
     ConnectTimeout    time.Duration
     ReadTimeout       time.Duration
     BufferSize        int
+    TLS               TLSConfig
 }
 
 // Event represents an AMI event
 type Event map[string]string
 
+// Time is when Asterisk raised the event, read from the Timestamp header that
+// timestampevents in manager.conf adds; without it the current time is used
+func (e Event) Time() time.Time {
+    if ts, err := strconv.ParseFloat(e["Timestamp"], 64); err == nil && ts > 0 {
+        sec, frac := math.Modf(ts)
+        return time.Unix(int64(sec), int64(frac*1e9))
+    }
+    return time.Now()
+}
+
 // EventHandler is a function that handles AMI events
 type EventHandler func(event Event)
 
@@ -78,6 +99,9 @@ func NewManager(config Config) *Manager {
     // Set defaults
     if config.Port == 0 {
         config.Port = 5038
+        if config.TLS.Enabled {
+            config.Port = 5039
+        }
     }
     if config.ReconnectInterval == 0 {
         config.ReconnectInterval = 5 * time.Second
@@ -103,6 +127,8 @@ func NewManager(config Config) *Manager {
         eventChan:      make(chan Event, config.BufferSize),
         eventHandlers:  make(map[string][]EventHandler),
         pendingActions: make(map[string]chan Event),
+        watchers:       make(map[string]chan Event),
+        listings:       make(map[string]*eventListing),
         loginChan:      make(chan Event, 10),
         shutdown:       make(chan struct{}),
         reconnectChan:  make(chan struct{}, 1),
@@ -119,16 +145,11 @@ func (m *Manager) Connect(ctx context.Context) error {
     }
     
     addr := fmt.Sprintf("%s:%d", m.config.Host, m.config.Port)
-    logger.Info("Connecting to Asterisk AMI", "addr", addr)
-    
-    // Connect with timeout
-    dialer := net.Dialer{
-        Timeout: m.config.ConnectTimeout,
-    }
+    logger.Info("Connecting to Asterisk AMI", "addr", addr, "tls", m.config.TLS.Enabled)
     
-    conn, err := dialer.DialContext(ctx, "tcp", addr)
+    conn, err := m.dial(ctx, addr)
     if err != nil {
-        return errors.Wrap(err, errors.ErrInternal, "failed to connect to AMI")
+        return err
     }
     
     m.conn = conn
@@ -181,6 +202,36 @@ func (m *Manager) Connect(ctx context.Context) error {
     return nil
 }
 
+// dial opens the connection, over TLS when configured
+func (m *Manager) dial(ctx context.Context, addr string) (net.Conn, error) {
+    dialer := &net.Dialer{
+        Timeout: m.config.ConnectTimeout,
+    }
+    
+    if !m.config.TLS.Enabled {
+        conn, err := dialer.DialContext(ctx, "tcp", addr)
+        if err != nil {
+            return nil, errors.Wrap(err, errors.ErrInternal, "failed to connect to AMI")
+        }
+        return conn, nil
+    }
+    
+    tlsConfig, err := m.config.TLS.clientConfig(m.config.Host)
+    if err != nil {
+        return nil, err
+    }
+    if tlsConfig.InsecureSkipVerify {
+        logger.Warn("AMI TLS certificate verification is disabled", "addr", addr)
+    }
+    
+    tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+    conn, err := tlsDialer.DialContext(ctx, "tcp", addr)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to connect to AMI over TLS")
+    }
+    return conn, nil
+}
+
 // performLogin handles the login process
 func (m *Manager) performLogin() error {
     logger.Debug("Performing AMI login", "username", m.config.Username)
@@ -271,8 +322,21 @@ func (m *Manager) SendAction(action Action) (Event, error) {
     }
     m.mu.RUnlock()
     
-    // Generate action ID
-    actionID := fmt.Sprintf("%d", atomic.AddUint64(&m.actionID, 1))
+    if action.Action != "Login" && faults.Get().Should(faults.AMIDisconnect) {
+        logger.Warn("Injecting AMI disconnect", "action", action.Action)
+        m.mu.Lock()
+        if m.conn != nil {
+            m.conn.Close()
+        }
+        m.mu.Unlock()
+        return nil, errors.New(errors.ErrInternal, "AMI connection lost (injected fault)")
+    }
+    
+    // Generate action ID, unless the caller picked one to watch the events of the action
+    actionID := action.ActionID
+    if actionID == "" {
+        actionID = fmt.Sprintf("%d", atomic.AddUint64(&m.actionID, 1))
+    }
     action.ActionID = actionID
     
     // Create response channel
@@ -358,8 +422,7 @@ func (m *Manager) eventReader() {
                 atomic.AddUint64(&m.totalEvents, 1)
                 
                 // Check if this is a login response (no ActionID)
-                if response, hasResponse := event["Response"]; hasResponse {
-                fmt.Println(response)
+                if _, hasResponse := event["Response"]; hasResponse {
                     if _, hasActionID := event["ActionID"]; !hasActionID {
                         // This is a login response
                         select {
@@ -382,6 +445,12 @@ func (m *Manager) eventReader() {
                     m.actionMutex.Unlock()
                 }
                 
+                // Listed events carry the Uniqueid of the channel they list, not
+                // one its watcher follows
+                if _, isEvent := event["Event"]; isEvent && !m.collectListed(event) {
+                    m.dispatchWatched(event)
+                }
+                
                 // Send to general event channel
                 select {
                 case m.eventChan <- event:
@@ -427,6 +496,10 @@ func (m *Manager) readEvent() (Event, error) {
         if idx := strings.Index(line, ":"); idx > 0 {
             key := strings.TrimSpace(line[:idx])
             value := strings.TrimSpace(line[idx+1:])
+            // Command responses repeat Output once per CLI line
+            if key == "Output" && event[key] != "" {
+                value = event[key] + "\n" + value
+            }
             event[key] = value
         }
     }
@@ -643,49 +716,166 @@ func (m *Manager) ReloadDialplan() error {
     return nil
 }
 
-// ShowChannels returns active channels
-func (m *Manager) ShowChannels() ([]map[string]string, error) {
+// Command runs an Asterisk CLI command and returns its output
+func (m *Manager) Command(command string) (string, error) {
     action := Action{
-        Action: "CoreShowChannels",
+        Action: "Command",
+        Fields: map[string]string{
+            "Command": command,
+        },
     }
     
     response, err := m.SendAction(action)
+    if err != nil {
+        return "", err
+    }
+    
+    if response["Response"] != "Success" && response["Response"] != "Follows" {
+        return "", errors.New(errors.ErrInternal, "CLI command failed").
+            WithContext("command", command).
+            WithContext("message", response["Message"])
+    }
+    
+    return response["Output"], nil
+}
+
+// ConfigAction is one change of an UpdateConfig action
+type ConfigAction struct {
+    Action string // NewCat, Update, Append, ...
+    Cat    string
+    Var    string
+    Value  string
+}
+
+// GetConfig returns the variables of every category of an Asterisk config file
+func (m *Manager) GetConfig(filename string) (map[string]map[string]string, error) {
+    response, err := m.SendAction(Action{
+        Action: "GetConfig",
+        Fields: map[string]string{
+            "Filename": filename,
+        },
+    })
     if err != nil {
         return nil, err
     }
     
     if response["Response"] != "Success" {
-        return nil, errors.New(errors.ErrInternal, "Failed to get channels")
+        return nil, errors.New(errors.ErrInternal, "failed to read config").
+            WithContext("filename", filename).
+            WithContext("message", response["Message"])
     }
     
-    var channels []map[string]string
-    completeChan := make(chan bool, 1)
-    
-    handler := func(event Event) {
-        if event["Event"] == "CoreShowChannel" {
-            channels = append(channels, event)
-        } else if event["Event"] == "CoreShowChannelsComplete" {
-            select {
-            case completeChan <- true:
-            default:
+    // Category-000000: name, Line-000000-000001: var=value
+    categories := make(map[string]map[string]string)
+    for key, value := range response {
+        if strings.HasPrefix(key, "Category-") {
+            if _, ok := categories[value]; !ok {
+                categories[value] = make(map[string]string)
             }
         }
     }
+    for key, value := range response {
+        if !strings.HasPrefix(key, "Line-") {
+            continue
+        }
+        parts := strings.SplitN(key, "-", 3)
+        if len(parts) != 3 {
+            continue
+        }
+        cat := response["Category-"+parts[1]]
+        if name, val, ok := strings.Cut(value, "="); ok && categories[cat] != nil {
+            categories[cat][strings.TrimSpace(name)] = strings.TrimSpace(strings.TrimPrefix(val, ">"))
+        }
+    }
     
-    m.RegisterEventHandler("CoreShowChannel", handler)
-    m.RegisterEventHandler("CoreShowChannelsComplete", handler)
+    return categories, nil
+}
+
+// CreateConfig creates an empty config file, it fails if the file exists
+func (m *Manager) CreateConfig(filename string) error {
+    response, err := m.SendAction(Action{
+        Action: "CreateConfig",
+        Fields: map[string]string{
+            "Filename": filename,
+        },
+    })
+    if err != nil {
+        return err
+    }
     
-    defer func() {
-        m.UnregisterEventHandler("CoreShowChannel", "")
-        m.UnregisterEventHandler("CoreShowChannelsComplete", "")
-    }()
+    if response["Response"] != "Success" {
+        return errors.New(errors.ErrInternal, "failed to create config").
+            WithContext("filename", filename).
+            WithContext("message", response["Message"])
+    }
+    return nil
+}
+
+// UpdateConfig applies changes to a config file in one action
+func (m *Manager) UpdateConfig(filename string, changes []ConfigAction) error {
+    fields := map[string]string{
+        "SrcFilename": filename,
+        "DstFilename": filename,
+    }
+    for i, c := range changes {
+        n := fmt.Sprintf("%06d", i)
+        fields["Action-"+n] = c.Action
+        fields["Cat-"+n] = c.Cat
+        if c.Var != "" {
+            fields["Var-"+n] = c.Var
+            fields["Value-"+n] = c.Value
+        }
+    }
     
-    select {
-    case <-completeChan:
-        return channels, nil
-    case <-time.After(5 * time.Second):
-        return channels, nil
+    response, err := m.SendAction(Action{
+        Action: "UpdateConfig",
+        Fields: fields,
+    })
+    if err != nil {
+        return err
+    }
+    
+    if response["Response"] != "Success" {
+        return errors.New(errors.ErrInternal, "failed to update config").
+            WithContext("filename", filename).
+            WithContext("message", response["Message"])
     }
+    return nil
+}
+
+// ShowChannels returns active channels, failing rather than returning part
+// of them when Asterisk doesn't finish the list in time
+func (m *Manager) ShowChannels() ([]map[string]string, error) {
+    // The events carry the ActionID of the action and may follow its response
+    // before SendAction returns, so they are collected from the start
+    action := Action{
+        Action:   "CoreShowChannels",
+        ActionID: fmt.Sprintf("channels-%d", atomic.AddUint64(&m.actionID, 1)),
+    }
+    listing, stop := m.listEvents(action.ActionID, "CoreShowChannelsComplete")
+    defer stop()
+    
+    response, err := m.SendAction(action)
+    if err != nil {
+        return nil, err
+    }
+    
+    if response["Response"] != "Success" {
+        return nil, errors.New(errors.ErrInternal, "Failed to get channels")
+    }
+    
+    events, err := listing.wait(m.config.ActionTimeout)
+    if err != nil {
+        return nil, err
+    }
+    
+    channels := make([]map[string]string, 0, len(events))
+    for _, event := range events {
+        if event["Event"] == "CoreShowChannel" {
+            channels = append(channels, event)
+        }
+    }
+    return channels, nil
 }
 
 // HangupChannel hangs up a channel
@@ -756,6 +946,17 @@ func (m *Manager) SetVar(variable, value string) error {
     return nil
 }
 
+// SetDeviceState sets a custom device state, e.g. Custom:ara-s1 to NOT_INUSE.
+// Asterisk keeps custom states in its database so they survive restarts.
+func (m *Manager) SetDeviceState(device, state string) error {
+    return m.SetVar(fmt.Sprintf("DEVICE_STATE(%s)", device), state)
+}
+
+// GetDeviceState returns the current state of a device as Asterisk sees it
+func (m *Manager) GetDeviceState(device string) (string, error) {
+    return m.GetVar(fmt.Sprintf("DEVICE_STATE(%s)", device))
+}
+
 // QueueStatus gets queue status
 func (m *Manager) QueueStatus(queue string) ([]Event, error) {
     fields := make(map[string]string)
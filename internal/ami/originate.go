@@ -0,0 +1,347 @@
+package ami
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/agivars"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// Channel states reported in Newstate events
+const (
+    channelStateRinging = "5"
+    channelStateUp      = "6"
+)
+
+var probeSeq uint64
+
+// OriginateRequest holds the fields of an Originate action
+type OriginateRequest struct {
+    Channel     string
+    Context     string // with Exten and Priority, or Application and Data
+    Exten       string
+    Priority    int
+    Application string
+    Data        string
+    CallerID    string
+    Timeout     time.Duration
+    ChannelID   string // Uniqueid given to the new channel
+    OtherID     string // Uniqueid given to the dialplan half of a Local channel
+    Variables   map[string]string
+    Async       bool
+}
+
+// Originate places a call. With Async the call proceeds in the background
+// and an OriginateResponse event reports its result.
+func (m *Manager) Originate(req OriginateRequest) (Event, error) {
+    fields := map[string]string{
+        "Channel": req.Channel,
+    }
+    if req.Application != "" {
+        fields["Application"] = req.Application
+        fields["Data"] = req.Data
+    } else {
+        fields["Context"] = req.Context
+        fields["Exten"] = req.Exten
+        fields["Priority"] = strconv.Itoa(req.Priority)
+    }
+    if req.CallerID != "" {
+        fields["CallerID"] = req.CallerID
+    }
+    if req.Timeout > 0 {
+        fields["Timeout"] = strconv.FormatInt(req.Timeout.Milliseconds(), 10)
+    }
+    if req.ChannelID != "" {
+        fields["ChannelId"] = req.ChannelID
+    }
+    if req.OtherID != "" {
+        fields["OtherChannelId"] = req.OtherID
+    }
+    if req.Async {
+        fields["Async"] = "true"
+    }
+    if len(req.Variables) > 0 {
+        vars := make([]string, 0, len(req.Variables))
+        for k, v := range req.Variables {
+            vars = append(vars, k+"="+v)
+        }
+        fields["Variable"] = strings.Join(vars, ",")
+    }
+    
+    response, err := m.SendAction(Action{
+        Action: "Originate",
+        Fields: fields,
+    })
+    if err != nil {
+        return nil, err
+    }
+    
+    if response["Response"] != "Success" {
+        return response, errors.New(errors.ErrInternal, "originate failed").
+            WithContext("channel", req.Channel).
+            WithContext("message", response["Message"])
+    }
+    return response, nil
+}
+
+// WatchChannel delivers the events of one channel, matched on Uniqueid or an
+// Originate ActionID, until the returned stop function is called
+func (m *Manager) WatchChannel(keys ...string) (<-chan Event, func()) {
+    ch := make(chan Event, 32)
+    
+    m.watchMu.Lock()
+    for _, key := range keys {
+        m.watchers[key] = ch
+    }
+    m.watchMu.Unlock()
+    
+    return ch, func() {
+        m.watchMu.Lock()
+        for key, c := range m.watchers {
+            if c == ch {
+                delete(m.watchers, key)
+            }
+        }
+        m.watchMu.Unlock()
+    }
+}
+
+// addWatchKey routes a further key to an existing watcher
+func (m *Manager) addWatchKey(existing, key string) {
+    m.watchMu.Lock()
+    if ch, ok := m.watchers[existing]; ok {
+        m.watchers[key] = ch
+    }
+    m.watchMu.Unlock()
+}
+
+// dispatchWatched hands an event to the watcher of its channel, dropping it if the watcher is behind
+func (m *Manager) dispatchWatched(event Event) {
+    m.watchMu.Lock()
+    ch, ok := m.watchers[event["Uniqueid"]]
+    if !ok && event["ActionID"] != "" {
+        ch, ok = m.watchers[event["ActionID"]]
+    }
+    m.watchMu.Unlock()
+    
+    if ok {
+        select {
+        case ch <- event:
+        default:
+        }
+    }
+}
+
+// eventListing collects the events a listing action answers with, every one
+// of them however many arrive at once, up to the event completing the list
+type eventListing struct {
+    mu       sync.Mutex
+    events   []Event
+    complete string
+    done     chan struct{}
+}
+
+// listEvents collects the events carrying actionID until the complete event,
+// until the returned stop function is called
+func (m *Manager) listEvents(actionID, complete string) (*eventListing, func()) {
+    listing := &eventListing{complete: complete, done: make(chan struct{})}
+    
+    m.watchMu.Lock()
+    m.listings[actionID] = listing
+    m.watchMu.Unlock()
+    
+    return listing, func() {
+        m.watchMu.Lock()
+        delete(m.listings, actionID)
+        m.watchMu.Unlock()
+    }
+}
+
+// collectListed hands an event to the listing of its action, reporting whether there is one
+func (m *Manager) collectListed(event Event) bool {
+    if event["ActionID"] == "" {
+        return false
+    }
+    
+    m.watchMu.Lock()
+    listing, ok := m.listings[event["ActionID"]]
+    if ok && event["Event"] == listing.complete {
+        delete(m.listings, event["ActionID"])
+    }
+    m.watchMu.Unlock()
+    if !ok {
+        return false
+    }
+    
+    if event["Event"] == listing.complete {
+        close(listing.done)
+        return true
+    }
+    listing.mu.Lock()
+    listing.events = append(listing.events, event)
+    listing.mu.Unlock()
+    return true
+}
+
+// wait returns the listed events once the list is complete
+func (l *eventListing) wait(timeout time.Duration) ([]Event, error) {
+    timer := time.NewTimer(timeout)
+    defer timer.Stop()
+    
+    select {
+    case <-l.done:
+        l.mu.Lock()
+        defer l.mu.Unlock()
+        return l.events, nil
+    case <-timer.C:
+        l.mu.Lock()
+        listed := len(l.events)
+        l.mu.Unlock()
+        return nil, errors.New(errors.ErrInternal, "timed out waiting for the list to complete").
+            WithContext("complete_event", l.complete).
+            WithContext("listed", listed)
+    }
+}
+
+// ProbeCall places a synthetic call to an endpoint and reports how far it got:
+// post dial delay until ringing or answer, and the hangup cause. With CancelOnRing
+// the call is hung up as soon as the far end rings, otherwise it plays a short
+// announcement once answered.
+func (m *Manager) ProbeCall(ctx context.Context, req models.ProbeCallRequest) (*models.ProbeCallResult, error) {
+    if req.Timeout <= 0 {
+        req.Timeout = 30 * time.Second
+    }
+    
+    uniqueID := fmt.Sprintf("synthetic-%d-%d", time.Now().Unix(), atomic.AddUint64(&probeSeq, 1))
+    events, stop := m.WatchChannel(uniqueID)
+    defer stop()
+    
+    start := time.Now()
+    response, err := m.Originate(OriginateRequest{
+        Channel:     fmt.Sprintf("PJSIP/%s@%s", req.DNIS, req.Endpoint),
+        Application: "Playback",
+        Data:        "silence/1&hello-world",
+        CallerID:    req.CallerID,
+        Timeout:     req.Timeout,
+        ChannelID:   uniqueID,
+        Variables:   map[string]string{"SYNTHETIC_PROBE": "1"},
+        Async:       true,
+    })
+    if err != nil {
+        return nil, err
+    }
+    // The OriginateResponse event carries the action's ID
+    m.addWatchKey(uniqueID, response["ActionID"])
+    
+    return m.followCall(ctx, events, start, req.Timeout+15*time.Second, req.CancelOnRing)
+}
+
+// OriginateInbound places a test call into the inbound context as if S1 had
+// sent it, through a Local channel whose dialplan half is given the call ID,
+// and follows it until it hangs up. Once the far end answers the call is held
+// up for req.Hold.
+func (m *Manager) OriginateInbound(ctx context.Context, req models.InboundCallRequest) (*models.ProbeCallResult, error) {
+    if req.Timeout <= 0 {
+        req.Timeout = 30 * time.Second
+    }
+    
+    // The half placing the call is watched, the dialplan half runs the AGI
+    uniqueID := req.CallID + "-caller"
+    events, stop := m.WatchChannel(uniqueID)
+    defer stop()
+    
+    start := time.Now()
+    response, err := m.Originate(OriginateRequest{
+        Channel:     fmt.Sprintf("Local/%s@%s/n", req.DNIS, agivars.InboundContext),
+        Application: "Wait",
+        Data:        strconv.Itoa(int(req.Hold.Seconds())),
+        CallerID:    req.ANI,
+        Timeout:     req.Timeout,
+        ChannelID:   uniqueID,
+        OtherID:     req.CallID,
+        Variables:   req.Variables,
+        Async:       true,
+    })
+    if err != nil {
+        return nil, err
+    }
+    m.addWatchKey(uniqueID, response["ActionID"])
+    
+    return m.followCall(ctx, events, start, req.Timeout+req.Hold+15*time.Second, false)
+}
+
+// followCall reports how far a call placed with Originate got from its
+// channel's events: post dial delay until ringing or answer, and the hangup
+// cause. With cancelOnRing the call is hung up as soon as the far end rings.
+func (m *Manager) followCall(ctx context.Context, events <-chan Event, start time.Time, timeout time.Duration,
+    cancelOnRing bool) (*models.ProbeCallResult, error) {
+    result := &models.ProbeCallResult{}
+    deadline := time.NewTimer(timeout)
+    defer deadline.Stop()
+    
+    var channel string
+    for {
+        select {
+        case event := <-events:
+            if event["Channel"] != "" {
+                channel = event["Channel"]
+            }
+            
+            switch event["Event"] {
+            case "Newstate":
+                switch event["ChannelState"] {
+                case channelStateRinging:
+                    if !result.Ringing {
+                        result.Ringing = true
+                        result.PDD = time.Since(start)
+                        if cancelOnRing {
+                            m.HangupChannel(channel, 16)
+                        }
+                    }
+                case channelStateUp:
+                    if !result.Answered {
+                        result.Answered = true
+                        if result.PDD == 0 {
+                            result.PDD = time.Since(start)
+                        }
+                        if cancelOnRing {
+                            m.HangupChannel(channel, 16)
+                        }
+                    }
+                }
+                
+            case "Hangup":
+                result.Cause, _ = strconv.Atoi(event["Cause"])
+                result.CauseText = event["Cause-txt"]
+                return result, nil
+                
+            case "OriginateResponse":
+                // Failures before a channel exists never produce a Hangup
+                if event["Response"] == "Failure" && !result.Ringing && !result.Answered {
+                    result.Reason = "originate failed, reason " + event["Reason"]
+                    return result, nil
+                }
+            }
+            
+        case <-deadline.C:
+            if channel != "" {
+                m.HangupChannel(channel, 16)
+            }
+            result.Reason = "timeout"
+            return result, nil
+            
+        case <-ctx.Done():
+            if channel != "" {
+                m.HangupChannel(channel, 16)
+            }
+            return result, ctx.Err()
+        }
+    }
+}
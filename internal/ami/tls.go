@@ -0,0 +1,65 @@
+package ami
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "os"
+    
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// TLSConfig connects to AMI over TLS, as served with tlsenable in
+// manager.conf. The server certificate is verified unless InsecureSkipVerify
+// is set.
+type TLSConfig struct {
+    Enabled            bool
+    CAFile             string // CA bundle the server certificate is checked against, the system roots when empty
+    CertFile           string // client certificate, for servers that ask for one
+    KeyFile            string
+    ServerName         string // name expected in the server certificate, Host when empty
+    InsecureSkipVerify bool   // accept any server certificate, for testing only
+    MinVersion         string // "1.2" or "1.3", 1.2 when empty
+}
+
+// clientConfig builds the crypto/tls configuration for connecting to host
+func (c TLSConfig) clientConfig(host string) (*tls.Config, error) {
+    config := &tls.Config{
+        ServerName:         c.ServerName,
+        InsecureSkipVerify: c.InsecureSkipVerify,
+        MinVersion:         tls.VersionTLS12,
+    }
+    if config.ServerName == "" {
+        config.ServerName = host
+    }
+    
+    switch c.MinVersion {
+    case "", "1.2":
+    case "1.3":
+        config.MinVersion = tls.VersionTLS13
+    default:
+        return nil, errors.New(errors.ErrConfiguration, fmt.Sprintf("unsupported AMI TLS version: %s", c.MinVersion))
+    }
+    
+    if c.CAFile != "" {
+        pem, err := os.ReadFile(c.CAFile)
+        if err != nil {
+            return nil, errors.Wrap(err, errors.ErrConfiguration, "failed to read AMI CA file")
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(pem) {
+            return nil, errors.New(errors.ErrConfiguration, "no certificates in AMI CA file").WithContext("file", c.CAFile)
+        }
+        config.RootCAs = pool
+    }
+    
+    if c.CertFile != "" || c.KeyFile != "" {
+        cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+        if err != nil {
+            return nil, errors.Wrap(err, errors.ErrConfiguration, "failed to load AMI client certificate")
+        }
+        config.Certificates = []tls.Certificate{cert}
+    }
+    
+    return config, nil
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+    "net/http"
+    "strings"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// handleActiveCalls serves GET /api/v1/calls/active
+//
+// Returns the calls this node is routing from memory, with the provider, state
+// and elapsed time of each leg. Filters: status, route, provider (any leg), ani,
+// dnis and test; sort by start, route, status or duration.
+func (s *Server) handleActiveCalls(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    opts, err := parseListOptions(q)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    
+    filter := models.CallFilter{
+        ActiveOnly: true,
+        Status:     models.CallStatus(strings.ToUpper(q.Get("status"))),
+        Route:      q.Get("route"),
+        Provider:   q.Get("provider"),
+        ANI:        q.Get("ani"),
+        DNIS:       q.Get("dnis"),
+    }
+    if test, ok, err := parseBoolParam(q, "test"); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    } else if ok {
+        filter.Test = &test
+    }
+    
+    calls, total := s.routerSvc.ActiveCallSnapshot(filter, opts)
+    writeJSON(w, http.StatusOK, models.NewPage(calls, total, opts))
+}
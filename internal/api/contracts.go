@@ -0,0 +1,20 @@
+package api
+
+import (
+    "net/http"
+    "time"
+)
+
+// handleContracts serves GET /api/v1/providers/contracts, each contracted
+// provider's usage this month against its commitments, with projections and alerts
+func (s *Server) handleContracts(w http.ResponseWriter, r *http.Request) {
+    statuses, err := s.routerSvc.ContractStatuses(r.Context(), time.Now())
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "contracts": statuses,
+    })
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+    "net/http"
+)
+
+// handleCountryStats serves GET /api/v1/calls/countries
+//
+// Returns concurrent calls and CPS per destination country along with the
+// provider country limits and their current usage.
+func (s *Server) handleCountryStats(w http.ResponseWriter, r *http.Request) {
+    tracker := s.routerSvc.GetCountryTracker()
+    
+    limits, err := tracker.ListLimits(r.Context(), r.URL.Query().Get("provider"))
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "countries": tracker.Stats(),
+        "limits":    limits,
+    })
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+// handleDailyStats serves GET /api/v1/stats/daily
+//
+// Query parameters: dimension (provider, route or country, default provider), key,
+// since (duration such as 720h, or RFC3339, default 30 days), until (RFC3339) and
+// exclude_holidays to leave out the holidays of holiday_country, or of each
+// row's country in the country dimension.
+func (s *Server) handleDailyStats(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    
+    filter := router.StatsFilter{
+        Dimension:      q.Get("dimension"),
+        Key:            q.Get("key"),
+        HolidayCountry: q.Get("holiday_country"),
+    }
+    switch filter.Dimension {
+    case "":
+        filter.Dimension = models.StatsDimensionProvider
+    case models.StatsDimensionProvider, models.StatsDimensionRoute, models.StatsDimensionCountry:
+    default:
+        writeError(w, http.StatusBadRequest, fmt.Errorf("dimension must be provider, route or country"))
+        return
+    }
+    
+    var err error
+    if filter.ExcludeHolidays, _, err = parseBoolParam(q, "exclude_holidays"); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if filter.ExcludeHolidays && filter.HolidayCountry == "" && filter.Dimension != models.StatsDimensionCountry {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("holiday_country is required to exclude holidays outside the country dimension"))
+        return
+    }
+    if filter.Until, err = parseTimeParam(q.Get("until"), time.Now()); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if filter.Until.IsZero() {
+        // Include today's row once it has been snapshotted
+        filter.Until = time.Now().AddDate(0, 0, 1)
+    }
+    if filter.Since, err = parseTimeParam(q.Get("since"), filter.Until); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    
+    stats, err := s.routerSvc.GetDailyStats(r.Context(), filter)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "dimension": filter.Dimension,
+        "currency":  s.routerSvc.GetFX().Currency(),
+        "days":      stats,
+    })
+}
+
+// handleExchangeRates serves GET /api/v1/stats/exchange-rates, the rates cost
+// and revenue are converted to the reporting currency with
+func (s *Server) handleExchangeRates(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, s.routerSvc.GetFX().Rates())
+}
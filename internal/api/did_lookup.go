@@ -0,0 +1,45 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "time"
+    
+    "github.com/gorilla/mux"
+)
+
+// maxLookupWindow bounds the window of a DID lookup, it matches a moment not a day
+const maxLookupWindow = 24 * time.Hour
+
+// handleDIDCalls serves GET /api/v1/dids/{number}/calls
+//
+// Returns the calls that held the DID at a moment with all their legs, for
+// trouble tickets that only reference a number and a time. at is RFC3339 or a
+// duration back from now and defaults to now; window (default 2m) is how far
+// either side of it allocations are matched.
+func (s *Server) handleDIDCalls(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    
+    at, err := parseTimeParam(q.Get("at"), time.Now())
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    window := 2 * time.Minute
+    if v := q.Get("window"); v != "" {
+        d, err := time.ParseDuration(v)
+        if err != nil || d < 0 || d > maxLookupWindow {
+            writeError(w, http.StatusBadRequest, fmt.Errorf("invalid window %q", v))
+            return
+        }
+        window = d
+    }
+    
+    lookup, err := s.routerSvc.LookupDIDCalls(r.Context(), mux.Vars(r)["number"], at, window)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, lookup)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+)
+
+// handleDIDOrders serves GET /api/v1/dids/orders, the latest DID orders and
+// the pool watermarks that raise them. pending=true leaves out finished orders.
+func (s *Server) handleDIDOrders(w http.ResponseWriter, r *http.Request) {
+    limit := 50
+    if v := r.URL.Query().Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n <= 0 {
+            writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v))
+            return
+        }
+        limit = n
+    }
+    
+    procurement := s.routerSvc.GetDIDProcurement()
+    orders, err := procurement.ListOrders(r.Context(), r.URL.Query().Get("pending") == "true", limit)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    watermarks, err := procurement.ListWatermarks(r.Context())
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "orders":     orders,
+        "watermarks": watermarks,
+    })
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+    "net/http"
+    "time"
+)
+
+// handleDispositionStats serves GET /api/v1/stats/dispositions
+//
+// Returns production calls per hangup disposition since the since parameter,
+// 24h by default, optionally only those a provider carried on any leg.
+func (s *Server) handleDispositionStats(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    
+    since, err := parseTimeParam(q.Get("since"), time.Now())
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if since.IsZero() {
+        since = time.Now().Add(-24 * time.Hour)
+    }
+    
+    counts, err := s.routerSvc.DispositionReport(r.Context(), since, q.Get("provider"))
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "since":        since,
+        "dispositions": counts,
+    })
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+    "net/http"
+)
+
+// handleFASScores serves GET /api/v1/providers/fas, the last false answer
+// supervision scores, most suspicious first
+func (s *Server) handleFASScores(w http.ResponseWriter, r *http.Request) {
+    scores, err := s.routerSvc.GetFASScores(r.Context())
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "providers": scores,
+    })
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+    
+    "github.com/gorilla/mux"
+    "github.com/hamzaKhattat/ara-production-system/internal/faults"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// faultRequest is the body of PUT /api/v1/faults/{fault}
+type faultRequest struct {
+    Rate    float64 `json:"rate"`
+    Latency string  `json:"latency"`
+}
+
+func (s *Server) handleListFaults(w http.ResponseWriter, r *http.Request) {
+    injector := faults.Get()
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "enabled": injector.Enabled(),
+        "faults":  injector.Snapshot(),
+    })
+}
+
+func (s *Server) handleSetFault(w http.ResponseWriter, r *http.Request) {
+    fault, err := faults.Parse(mux.Vars(r)["fault"])
+    if err != nil {
+        writeError(w, http.StatusNotFound, err)
+        return
+    }
+    
+    var req faultRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, errors.Wrap(err, errors.ErrConfiguration, "invalid request body"))
+        return
+    }
+    
+    rule := faults.Rule{Rate: req.Rate}
+    if req.Latency != "" {
+        if rule.Latency, err = time.ParseDuration(req.Latency); err != nil {
+            writeError(w, http.StatusBadRequest, errors.Wrap(err, errors.ErrConfiguration, "invalid latency"))
+            return
+        }
+    }
+    
+    if err := faults.Get().Set(fault, rule); err != nil {
+        writeError(w, http.StatusConflict, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, faults.Get().Snapshot())
+}
+
+func (s *Server) handleClearFaults(w http.ResponseWriter, r *http.Request) {
+    faults.Get().Clear()
+    writeJSON(w, http.StatusOK, faults.Get().Snapshot())
+}
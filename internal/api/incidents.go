@@ -0,0 +1,94 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+    
+    "github.com/gorilla/mux"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// handleListIncidents serves GET /api/v1/incidents
+//
+// Returns incidents newest first, without their alerts. Filters: kind, open
+// (true for those still going on), since (RFC3339 or a duration back from
+// now) and limit.
+func (s *Server) handleListIncidents(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    
+    filter := models.IncidentFilter{
+        Kind:     q.Get("kind"),
+        OpenOnly: q.Get("open") == "true",
+    }
+    
+    var err error
+    if filter.Since, err = parseTimeParam(q.Get("since"), time.Now()); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if v := q.Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 1 || n > models.MaxListLimit {
+            writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v))
+            return
+        }
+        filter.Limit = n
+    }
+    
+    incidents, err := s.routerSvc.GetAlerts().List(r.Context(), filter)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{"incidents": incidents})
+}
+
+// handleGetIncident serves GET /api/v1/incidents/{id}, with the incident's alerts
+func (s *Server) handleGetIncident(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, errors.New(errors.ErrConfiguration, "invalid incident id"))
+        return
+    }
+    
+    incident, err := s.routerSvc.GetAlerts().Get(r.Context(), id)
+    if err != nil {
+        status := http.StatusNotFound
+        if errors.GetCode(err) == string(errors.ErrDatabase) {
+            status = http.StatusInternalServerError
+        }
+        writeError(w, status, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, incident)
+}
+
+// handleResolveIncident serves POST /api/v1/incidents/{id}/resolve
+func (s *Server) handleResolveIncident(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, errors.New(errors.ErrConfiguration, "invalid incident id"))
+        return
+    }
+    
+    by := r.URL.Query().Get("by")
+    if by == "" {
+        by = "api"
+    }
+    
+    if err := s.routerSvc.GetAlerts().ResolveIncident(r.Context(), id, by); err != nil {
+        status := http.StatusNotFound
+        if errors.GetCode(err) == string(errors.ErrDatabase) {
+            status = http.StatusInternalServerError
+        }
+        writeError(w, status, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{"resolved": id})
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "time"
+    
+    "github.com/gorilla/mux"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// killSwitchRequest is the body of POST /api/v1/kill-switches. Without a
+// customer or route all new calls are stopped.
+type killSwitchRequest struct {
+    Customer string `json:"customer"`
+    Route    string `json:"route"`
+    Reason   string `json:"reason"`
+    Duration string `json:"duration"` // released automatically after, empty until released
+    By       string `json:"by"`
+}
+
+func (s *Server) handleListKillSwitches(w http.ResponseWriter, r *http.Request) {
+    switches, err := s.routerSvc.GetKillSwitches().List(r.Context())
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "engaged":  len(s.routerSvc.GetKillSwitches().Engaged()) > 0,
+        "switches": switches,
+    })
+}
+
+func (s *Server) handleEngageKillSwitch(w http.ResponseWriter, r *http.Request) {
+    var req killSwitchRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, errors.Wrap(err, errors.ErrConfiguration, "invalid request body"))
+        return
+    }
+    if req.Customer != "" && req.Route != "" {
+        writeError(w, http.StatusBadRequest, errors.New(errors.ErrConfiguration, "customer and route can't be combined"))
+        return
+    }
+    
+    k := &models.KillSwitch{
+        Scope:     models.BlockScopeGlobal,
+        Reason:    req.Reason,
+        EngagedBy: req.By,
+    }
+    if k.EngagedBy == "" {
+        k.EngagedBy = "api"
+    }
+    if req.Customer != "" {
+        k.Scope, k.ScopeValue = models.BlockScopeCustomer, req.Customer
+    }
+    if req.Route != "" {
+        k.Scope, k.ScopeValue = models.BlockScopeRoute, req.Route
+    }
+    if req.Duration != "" {
+        duration, err := time.ParseDuration(req.Duration)
+        if err != nil || duration <= 0 {
+            writeError(w, http.StatusBadRequest, errors.New(errors.ErrConfiguration, "invalid duration"))
+            return
+        }
+        expires := time.Now().Add(duration)
+        k.ExpiresAt = &expires
+    }
+    
+    if err := s.routerSvc.GetKillSwitches().Engage(r.Context(), k); err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusCreated, k)
+}
+
+func (s *Server) handleReleaseKillSwitch(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, errors.New(errors.ErrConfiguration, "invalid kill switch id"))
+        return
+    }
+    
+    by := r.URL.Query().Get("by")
+    if by == "" {
+        by = "api"
+    }
+    
+    if err := s.routerSvc.GetKillSwitches().Release(r.Context(), id, by); err != nil {
+        writeError(w, http.StatusNotFound, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{"released": id})
+}
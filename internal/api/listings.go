@@ -0,0 +1,279 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    
+    "github.com/gorilla/mux"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// List endpoints share the query parameters limit, offset, sort and order (asc or desc)
+// and return a models.Page.
+
+// handleListProviders serves GET /api/v1/providers
+//
+// Filters: type, active, health, search (name or host substring) and tag
+// (key=value or key, repeatable).
+func (s *Server) handleListProviders(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    opts, err := parseListOptions(q)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    
+    filter := make(map[string]interface{})
+    if v := q.Get("type"); v != "" {
+        filter["type"] = v
+    }
+    if v := q.Get("health"); v != "" {
+        filter["health_status"] = v
+    }
+    if v := q.Get("search"); v != "" {
+        filter["search"] = v
+    }
+    if active, ok, err := parseBoolParam(q, "active"); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    } else if ok {
+        filter["active"] = active
+    }
+    if tags, err := parseTagParam(q); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    } else if len(tags) > 0 {
+        filter["tags"] = tags
+    }
+    
+    providers, total, err := s.providerSvc.ListProvidersPage(r.Context(), filter, opts)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    // Never expose SIP credentials over the API
+    for _, p := range providers {
+        p.Password = ""
+    }
+    
+    writeJSON(w, http.StatusOK, models.NewPage(providers, total, opts))
+}
+
+// handleListDIDs serves GET /api/v1/dids
+//
+// Filters: provider, status (available, in_use or quarantined), prefix, pattern, country, max_cost and test.
+func (s *Server) handleListDIDs(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    opts, err := parseListOptions(q)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    
+    filter := models.DIDFilter{
+        Provider: q.Get("provider"),
+        Status:   q.Get("status"),
+        Prefix:   q.Get("prefix"),
+        Pattern:  q.Get("pattern"),
+        Country:  q.Get("country"),
+    }
+    if v := q.Get("max_cost"); v != "" {
+        maxCost, err := strconv.ParseFloat(v, 64)
+        if err != nil {
+            writeError(w, http.StatusBadRequest, fmt.Errorf("invalid max_cost %q", v))
+            return
+        }
+        filter.MaxCost = &maxCost
+    }
+    if test, ok, err := parseBoolParam(q, "test"); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    } else if ok {
+        filter.Test = &test
+    }
+    switch filter.Status {
+    case "", "available", "in_use", "quarantined":
+    default:
+        writeError(w, http.StatusBadRequest, fmt.Errorf("status must be available, in_use or quarantined"))
+        return
+    }
+    
+    dids, total, err := s.routerSvc.ListDIDs(r.Context(), filter, opts)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, models.NewPage(dids, total, opts))
+}
+
+// handleGetDID serves GET /api/v1/dids/{number}
+//
+// Query parameters: calls is the number of recent calls to include (default 10),
+// include_test counts test calls in the usage totals of production DIDs.
+func (s *Server) handleGetDID(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    recent := 10
+    if v := q.Get("calls"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 0 || n > models.MaxListLimit {
+            writeError(w, http.StatusBadRequest, fmt.Errorf("invalid calls %q", v))
+            return
+        }
+        recent = n
+    }
+    includeTest, _, err := parseBoolParam(q, "include_test")
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    
+    details, err := s.routerSvc.GetDIDDetails(r.Context(), mux.Vars(r)["number"], recent, includeTest)
+    if err != nil {
+        status := http.StatusInternalServerError
+        if errors.GetCode(err) == string(errors.ErrDIDNotAvailable) {
+            status = http.StatusNotFound
+        }
+        writeError(w, status, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, details)
+}
+
+// handleListRoutes serves GET /api/v1/routes
+//
+// Filters: inbound, provider (any leg), policy, enabled, test and tag (any leg, repeatable).
+func (s *Server) handleListRoutes(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    opts, err := parseListOptions(q)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    
+    filter := models.RouteFilter{
+        Inbound:  q.Get("inbound"),
+        Provider: q.Get("provider"),
+        Policy:   q.Get("policy"),
+    }
+    if enabled, ok, err := parseBoolParam(q, "enabled"); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    } else if ok {
+        filter.Enabled = &enabled
+    }
+    if test, ok, err := parseBoolParam(q, "test"); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    } else if ok {
+        filter.Test = &test
+    }
+    if filter.Tags, err = parseTagParam(q); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    
+    routes, total, err := s.routerSvc.ListRoutes(r.Context(), filter, opts)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, models.NewPage(routes, total, opts))
+}
+
+// handleListCalls serves GET /api/v1/calls
+//
+// Filters: active (defaults to true), status, route, provider (any leg), ani, dnis and test.
+func (s *Server) handleListCalls(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    opts, err := parseListOptions(q)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    
+    filter := models.CallFilter{
+        ActiveOnly:  true,
+        Status:      models.CallStatus(strings.ToUpper(q.Get("status"))),
+        Route:       q.Get("route"),
+        Provider:    q.Get("provider"),
+        ANI:         q.Get("ani"),
+        DNIS:        q.Get("dnis"),
+        Disposition: q.Get("disposition"),
+    }
+    if active, ok, err := parseBoolParam(q, "active"); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    } else if ok {
+        filter.ActiveOnly = active
+    }
+    if test, ok, err := parseBoolParam(q, "test"); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    } else if ok {
+        filter.Test = &test
+    }
+    
+    calls, total, err := s.routerSvc.ListCalls(r.Context(), filter, opts)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, models.NewPage(calls, total, opts))
+}
+
+func parseListOptions(q url.Values) (models.ListOptions, error) {
+    var opts models.ListOptions
+    var err error
+    
+    if v := q.Get("limit"); v != "" {
+        if opts.Limit, err = strconv.Atoi(v); err != nil || opts.Limit < 0 {
+            return opts, fmt.Errorf("invalid limit %q", v)
+        }
+    }
+    if v := q.Get("offset"); v != "" {
+        if opts.Offset, err = strconv.Atoi(v); err != nil || opts.Offset < 0 {
+            return opts, fmt.Errorf("invalid offset %q", v)
+        }
+    }
+    
+    opts.Sort = q.Get("sort")
+    switch strings.ToLower(q.Get("order")) {
+    case "", "asc":
+    case "desc":
+        opts.Desc = true
+    default:
+        return opts, fmt.Errorf("order must be asc or desc")
+    }
+    
+    return opts.Normalize(), nil
+}
+
+// parseTagParam reads repeated tag=key=value selectors
+func parseTagParam(q url.Values) (models.Tags, error) {
+    if len(q["tag"]) == 0 {
+        return nil, nil
+    }
+    return models.ParseTags(q["tag"], true)
+}
+
+func parseBoolParam(q url.Values, name string) (bool, bool, error) {
+    v := q.Get(name)
+    if v == "" {
+        return false, false, nil
+    }
+    
+    b, err := strconv.ParseBool(v)
+    if err != nil {
+        return false, false, fmt.Errorf("invalid %s %q", name, v)
+    }
+    return b, true, nil
+}
@@ -0,0 +1,13 @@
+package api
+
+import (
+    "net/http"
+)
+
+// handleHashRings serves GET /api/v1/debug/hash-rings
+//
+// Query parameters: ani resolves which provider each ring assigns to that caller.
+func (s *Server) handleHashRings(w http.ResponseWriter, r *http.Request) {
+    rings := s.routerSvc.GetLoadBalancer().GetHashRings(r.URL.Query().Get("ani"))
+    writeJSON(w, http.StatusOK, rings)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// originateRequest is the body of POST /api/v1/calls/originate
+type originateRequest struct {
+    ANI     string `json:"ani"`
+    DNIS    string `json:"dnis"`
+    Route   string `json:"route"`
+    Inbound string `json:"inbound"` // the route's inbound provider when empty
+    Timeout string `json:"timeout"` // 30s when empty
+    Hold    string `json:"hold"`    // 5s when empty
+}
+
+// EnableOriginate lets operators place test calls through the AMI connection
+func (s *Server) EnableOriginate(originator router.CallOriginator) {
+    s.originator = originator
+}
+
+func (s *Server) handleOriginateCall(w http.ResponseWriter, r *http.Request) {
+    if s.originator == nil {
+        writeError(w, http.StatusServiceUnavailable, errors.New(errors.ErrConfiguration, "AMI is not connected"))
+        return
+    }
+    
+    var req originateRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, errors.Wrap(err, errors.ErrConfiguration, "invalid request body"))
+        return
+    }
+    
+    timeout, err := optionalDuration(req.Timeout, 30*time.Second)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    hold, err := optionalDuration(req.Hold, 5*time.Second)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    // The response is written once the call hung up
+    if timeout+hold+5*time.Second >= s.config.WriteTimeout {
+        writeError(w, http.StatusBadRequest, errors.New(errors.ErrConfiguration, "test call outlasts the API write timeout").
+            WithContext("write_timeout", s.config.WriteTimeout.String()))
+        return
+    }
+    
+    result, err := s.routerSvc.OriginateCall(r.Context(), s.originator, models.OriginateCallRequest{
+        ANI:     req.ANI,
+        DNIS:    req.DNIS,
+        Route:   req.Route,
+        Inbound: req.Inbound,
+        Timeout: timeout,
+        Hold:    hold,
+    })
+    if err != nil {
+        status := http.StatusInternalServerError
+        switch errors.GetCode(err) {
+        case string(errors.ErrConfiguration):
+            status = http.StatusBadRequest
+        case string(errors.ErrRouteNotFound):
+            status = http.StatusNotFound
+        }
+        writeError(w, status, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, result)
+}
+
+// optionalDuration parses a duration of a request body, the fallback when empty
+func optionalDuration(value string, fallback time.Duration) (time.Duration, error) {
+    if value == "" {
+        return fallback, nil
+    }
+    duration, err := time.ParseDuration(value)
+    if err != nil || duration <= 0 {
+        return 0, errors.New(errors.ErrConfiguration, "invalid duration")
+    }
+    return duration, nil
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "time"
+    
+    "github.com/gorilla/mux"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// handleProviderEvents serves GET /api/v1/providers/{name}/events
+//
+// Returns the provider's timeline newest first. Filters: type, since and until
+// (RFC3339 or a duration back from now) and limit.
+func (s *Server) handleProviderEvents(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    
+    filter := models.ProviderEventFilter{
+        Provider:  mux.Vars(r)["name"],
+        EventType: q.Get("type"),
+    }
+    
+    var err error
+    if filter.Since, err = parseTimeParam(q.Get("since"), time.Now()); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if filter.Until, err = parseTimeParam(q.Get("until"), time.Now()); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if v := q.Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 1 || n > models.MaxListLimit {
+            writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", v))
+            return
+        }
+        filter.Limit = n
+    }
+    
+    events, err := s.providerSvc.ListProviderEvents(r.Context(), filter)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "provider": filter.Provider,
+        "events":   events,
+    })
+}
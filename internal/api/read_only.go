@@ -0,0 +1,81 @@
+package api
+
+import (
+    "encoding/json"
+    "net/http"
+    
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// readOnlyPath is the route that lifts read-only mode, never refused by it
+const readOnlyPath = "/api/v1/read-only"
+
+// readOnlyRequest is the body of PUT /api/v1/read-only
+type readOnlyRequest struct {
+    Enabled bool   `json:"enabled"`
+    Reason  string `json:"reason"`
+    By      string `json:"by"`
+}
+
+// readOnlyMiddleware refuses every request that can change something while
+// the management plane is read-only
+func (s *Server) readOnlyMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.Method {
+        case http.MethodGet, http.MethodHead, http.MethodOptions:
+            next.ServeHTTP(w, r)
+            return
+        }
+        if r.URL.Path == readOnlyPath {
+            next.ServeHTTP(w, r)
+            return
+        }
+    
+        if err := s.routerSvc.CheckWritable(r.Context()); err != nil {
+            status := http.StatusInternalServerError
+            if errors.GetCode(err) == string(errors.ErrReadOnly) {
+                status = http.StatusForbidden
+            }
+            writeError(w, status, err)
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+func (s *Server) handleGetReadOnly(w http.ResponseWriter, r *http.Request) {
+    mode, err := s.routerSvc.ReadOnlyMode(r.Context())
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, mode)
+}
+
+func (s *Server) handleSetReadOnly(w http.ResponseWriter, r *http.Request) {
+    var req readOnlyRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        writeError(w, http.StatusBadRequest, errors.Wrap(err, errors.ErrConfiguration, "invalid request body"))
+        return
+    }
+    if req.By == "" {
+        req.By = "api"
+    }
+    
+    if err := s.routerSvc.SetReadOnly(r.Context(), req.Enabled, req.Reason, req.By); err != nil {
+        status := http.StatusInternalServerError
+        if errors.GetCode(err) == string(errors.ErrConfiguration) {
+            status = http.StatusConflict
+        }
+        writeError(w, status, err)
+        return
+    }
+    
+    mode, err := s.routerSvc.ReadOnlyMode(r.Context())
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, mode)
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+    "context"
+    "crypto/subtle"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+    
+    "github.com/gorilla/mux"
+    "github.com/hamzaKhattat/ara-production-system/internal/i18n"
+    "github.com/hamzaKhattat/ara-production-system/internal/masking"
+    "github.com/hamzaKhattat/ara-production-system/internal/provider"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// Config holds API server configuration
+type Config struct {
+    Port         int
+    AuthToken    string
+    OperatorPII  bool // the operator token sees numbers in full when masking is on
+    ReadTimeout  time.Duration
+    WriteTimeout time.Duration
+}
+
+// Server exposes router data over HTTP
+type Server struct {
+    config      Config
+    routerSvc   *router.Router
+    providerSvc *provider.Service
+    originator  router.CallOriginator // nil without an AMI connection
+    mux         *mux.Router
+    server      *http.Server
+}
+
+// NewServer creates a new API server
+func NewServer(config Config, routerSvc *router.Router, providerSvc *provider.Service) *Server {
+    if config.ReadTimeout == 0 {
+        config.ReadTimeout = 30 * time.Second
+    }
+    if config.WriteTimeout == 0 {
+        config.WriteTimeout = 30 * time.Second
+    }
+    
+    s := &Server{
+        config:      config,
+        routerSvc:   routerSvc,
+        providerSvc: providerSvc,
+        mux:         mux.NewRouter(),
+    }
+    
+    s.mux.Use(languageMiddleware)
+    s.mux.Use(s.authMiddleware)
+    s.mux.Use(s.readOnlyMiddleware)
+    s.registerRoutes()
+    
+    s.server = &http.Server{
+        Addr:         fmt.Sprintf(":%d", config.Port),
+        Handler:      s.mux,
+        ReadTimeout:  config.ReadTimeout,
+        WriteTimeout: config.WriteTimeout,
+    }
+    
+    return s
+}
+
+func (s *Server) registerRoutes() {
+    api := s.mux.PathPrefix("/api/v1").Subrouter()
+    api.HandleFunc("/summary", s.handleSummary).Methods("GET")
+    api.HandleFunc("/verifications/report", s.handleVerificationReport).Methods("GET")
+    api.HandleFunc("/debug/hash-rings", s.handleHashRings).Methods("GET")
+    api.HandleFunc("/providers/fas", s.handleFASScores).Methods("GET")
+    api.HandleFunc("/providers/contracts", s.handleContracts).Methods("GET")
+    api.HandleFunc("/providers/slas", s.handleSLAs).Methods("GET")
+    api.HandleFunc("/providers/sla/reports", s.handleSLAReports).Methods("GET")
+    api.HandleFunc("/providers/{name}/events", s.handleProviderEvents).Methods("GET")
+    
+    // Paginated listings
+    api.HandleFunc("/providers", s.handleListProviders).Methods("GET")
+    api.HandleFunc("/dids", s.handleListDIDs).Methods("GET")
+    api.HandleFunc("/dids/orders", s.handleDIDOrders).Methods("GET")
+    api.HandleFunc("/dids/{number}", s.handleGetDID).Methods("GET")
+    api.HandleFunc("/dids/{number}/calls", s.handleDIDCalls).Methods("GET")
+    api.HandleFunc("/routes", s.handleListRoutes).Methods("GET")
+    api.HandleFunc("/calls", s.handleListCalls).Methods("GET")
+    api.HandleFunc("/calls/active", s.handleActiveCalls).Methods("GET")
+    api.HandleFunc("/calls/countries", s.handleCountryStats).Methods("GET")
+    api.HandleFunc("/calls/originate", s.handleOriginateCall).Methods("POST")
+    api.HandleFunc("/stats/daily", s.handleDailyStats).Methods("GET")
+    api.HandleFunc("/stats/short-calls", s.handleShortCallStats).Methods("GET")
+    api.HandleFunc("/stats/dispositions", s.handleDispositionStats).Methods("GET")
+    api.HandleFunc("/stats/exchange-rates", s.handleExchangeRates).Methods("GET")
+    
+    // Emergency stop of new inbound calls
+    api.HandleFunc("/kill-switches", s.handleListKillSwitches).Methods("GET")
+    api.HandleFunc("/kill-switches", s.handleEngageKillSwitch).Methods("POST")
+    api.HandleFunc("/kill-switches/{id}", s.handleReleaseKillSwitch).Methods("DELETE")
+    
+    // Provider alerts grouped into incidents
+    api.HandleFunc("/incidents", s.handleListIncidents).Methods("GET")
+    api.HandleFunc("/incidents/{id}", s.handleGetIncident).Methods("GET")
+    api.HandleFunc("/incidents/{id}/resolve", s.handleResolveIncident).Methods("POST")
+    
+    // Management plane freeze, the only change allowed while frozen
+    api.HandleFunc("/read-only", s.handleGetReadOnly).Methods("GET")
+    api.HandleFunc("/read-only", s.handleSetReadOnly).Methods("PUT")
+    
+    // Fault injection, only effective when enabled outside production
+    api.HandleFunc("/faults", s.handleListFaults).Methods("GET")
+    api.HandleFunc("/faults", s.handleClearFaults).Methods("DELETE")
+    api.HandleFunc("/faults/{fault}", s.handleSetFault).Methods("PUT")
+    
+    // Customer usage, the only routes customer tokens may read
+    api.HandleFunc("/usage/calls", s.handleUsageCalls).Methods("GET")
+    api.HandleFunc("/usage/summary", s.handleUsageSummary).Methods("GET")
+    api.HandleFunc("/usage/dids", s.handleUsageDIDs).Methods("GET")
+}
+
+// Start starts serving requests
+func (s *Server) Start() error {
+    logger.WithField("addr", s.server.Addr).Info("API server started")
+    if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+        return err
+    }
+    return nil
+}
+
+// Stop gracefully shuts down the server
+func (s *Server) Stop() error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    return s.server.Shutdown(ctx)
+}
+
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+        if strings.HasPrefix(token, router.APITokenPrefix) {
+            scoped, ok := s.authenticateCustomer(w, r, token)
+            if !ok {
+                return
+            }
+            next.ServeHTTP(w, scoped)
+            return
+        }
+        if s.config.AuthToken != "" {
+            // Compared in constant time, the timing would give the token away
+            if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AuthToken)) != 1 {
+                writeError(w, http.StatusUnauthorized, errors.New(errors.ErrAuthFailed, "invalid or missing API token"))
+                return
+            }
+        }
+        maskNumbers(w, !s.config.OperatorPII)
+        next.ServeHTTP(w, r)
+    })
+}
+
+// localizedWriter carries the language a request's messages are written in,
+// and whether the numbers in its responses are masked
+type localizedWriter struct {
+    http.ResponseWriter
+    lang string
+    mask bool
+}
+
+// maskNumbers masks the caller and called numbers of the response when the
+// token has no PII access
+func maskNumbers(w http.ResponseWriter, mask bool) {
+    if lw, ok := w.(*localizedWriter); ok {
+        lw.mask = mask
+    }
+}
+
+// languageMiddleware picks the language of error messages from Accept-Language,
+// app.language when it names none that is supported
+func languageMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        lang := i18n.Negotiate(r.Header.Get("Accept-Language"))
+        w.Header().Set("Content-Language", lang)
+        next.ServeHTTP(&localizedWriter{ResponseWriter: w, lang: lang}, r)
+    })
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    if lw, ok := w.(*localizedWriter); ok && lw.mask && masking.Enabled() {
+        masked, err := masking.JSON(v)
+        if err != nil {
+            // Never fall back to the raw numbers
+            status, masked = http.StatusInternalServerError, map[string]string{"error": "failed to mask response"}
+        }
+        v = masked
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+    lang := i18n.Default()
+    if lw, ok := w.(*localizedWriter); ok {
+        lang = lw.lang
+    }
+    writeJSON(w, status, map[string]string{
+        "error": i18n.T(lang, err.Error()),
+        "code":  errors.GetCode(err),
+    })
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+    "net/http"
+)
+
+// handleShortCallStats serves GET /api/v1/stats/short-calls
+//
+// Returns the share of short answered calls per inbound customer and outbound
+// provider from the last evaluation, with their limits and whether they are throttled.
+func (s *Server) handleShortCallStats(w http.ResponseWriter, r *http.Request) {
+    monitor := s.routerSvc.GetShortCallMonitor()
+    
+    stats := monitor.Stats()
+    if stats == nil {
+        var err error
+        if stats, err = monitor.Compute(r.Context()); err != nil {
+            writeError(w, http.StatusInternalServerError, err)
+            return
+        }
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "providers": stats,
+    })
+}
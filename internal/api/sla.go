@@ -0,0 +1,70 @@
+package api
+
+import (
+    "net/http"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// handleSLAs serves GET /api/v1/providers/slas, the SLA targets of every
+// provider that has them
+func (s *Server) handleSLAs(w http.ResponseWriter, r *http.Request) {
+    slas, err := s.routerSvc.ListSLAs(r.Context())
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "slas": slas,
+    })
+}
+
+// handleSLAReports serves GET /api/v1/providers/sla/reports
+//
+// Returns the stored monthly SLA reports newest first. Filters: provider and
+// month (YYYY-MM). With live=true the month, this one by default, is measured
+// now instead and nothing is stored.
+func (s *Server) handleSLAReports(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    provider := q.Get("provider")
+    month := q.Get("month")
+    
+    live, _, err := parseBoolParam(q, "live")
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    at := time.Now()
+    if month != "" {
+        if at, err = router.ParseSLAMonth(month); err != nil {
+            writeError(w, http.StatusBadRequest, err)
+            return
+        }
+    }
+    
+    var reports []*models.SLAReport
+    if live {
+        reports, err = s.routerSvc.BuildSLAReports(r.Context(), at, provider)
+    } else {
+        reports, err = s.routerSvc.ListSLAReports(r.Context(), provider, month)
+    }
+    if err != nil {
+        status := http.StatusInternalServerError
+        if errors.GetCode(err) == string(errors.ErrProviderNotFound) {
+            status = http.StatusNotFound
+        }
+        writeError(w, status, err)
+        return
+    }
+    if reports == nil {
+        reports = []*models.SLAReport{}
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "reports": reports,
+    })
+}
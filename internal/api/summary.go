@@ -0,0 +1,17 @@
+package api
+
+import "net/http"
+
+// handleSummary serves GET /api/v1/summary, active calls, CPS, ASR over the
+// last hour, DID utilization, unhealthy providers and the top failure reasons
+// in one response. It is cached for router.summary_ttl, wallboards can poll
+// it every few seconds.
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+    summary, err := s.routerSvc.Summary(r.Context())
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, summary)
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// usagePrefix is the only part of the API customer tokens may read
+const usagePrefix = "/api/v1/usage/"
+
+type contextKey string
+
+// customerKey holds the customer a request authenticated with a customer token is scoped to
+const customerKey contextKey = "customer"
+
+// authenticateCustomer accepts a customer token for the usage endpoints and
+// scopes the request to its customer
+func (s *Server) authenticateCustomer(w http.ResponseWriter, r *http.Request, token string) (*http.Request, bool) {
+    t, err := s.routerSvc.GetAPITokens().Authenticate(r.Context(), token)
+    if err != nil {
+        writeError(w, http.StatusUnauthorized, err)
+        return nil, false
+    }
+    if !strings.HasPrefix(r.URL.Path, usagePrefix) {
+        writeError(w, http.StatusForbidden, errors.New(errors.ErrAuthFailed, "customer tokens may only read /api/v1/usage"))
+        return nil, false
+    }
+    maskNumbers(w, !t.PII)
+    return r.WithContext(context.WithValue(r.Context(), customerKey, t.Customer)), true
+}
+
+// usageCustomer returns the customer a usage request is for: the token's own,
+// or for operators the customer query parameter
+func usageCustomer(w http.ResponseWriter, r *http.Request) (string, bool) {
+    if customer, ok := r.Context().Value(customerKey).(string); ok {
+        return customer, true
+    }
+    if customer := r.URL.Query().Get("customer"); customer != "" {
+        return customer, true
+    }
+    writeError(w, http.StatusBadRequest, fmt.Errorf("customer is required"))
+    return "", false
+}
+
+// usagePeriod parses since (default 30 days) and until (default now)
+func usagePeriod(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+    q := r.URL.Query()
+    
+    until, err := parseTimeParam(q.Get("until"), time.Now())
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return until, until, false
+    }
+    if until.IsZero() {
+        until = time.Now()
+    }
+    since, err := parseTimeParam(q.Get("since"), until)
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return since, until, false
+    }
+    if since.IsZero() {
+        since = until.AddDate(0, 0, -30)
+    }
+    return since, until, true
+}
+
+// handleUsageCalls serves GET /api/v1/usage/calls, the customer's call records
+// newest first, paginated with limit and offset
+func (s *Server) handleUsageCalls(w http.ResponseWriter, r *http.Request) {
+    customer, ok := usageCustomer(w, r)
+    if !ok {
+        return
+    }
+    opts, err := parseListOptions(r.URL.Query())
+    if err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    // Routes aren't part of the customer's view
+    if opts.Sort == "route" {
+        opts.Sort = ""
+    }
+    
+    calls, total, err := s.routerSvc.CustomerCalls(r.Context(), customer, opts)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, models.NewPage(calls, total, opts))
+}
+
+// handleUsageSummary serves GET /api/v1/usage/summary, calls and billable
+// minutes per day between since and until
+func (s *Server) handleUsageSummary(w http.ResponseWriter, r *http.Request) {
+    customer, ok := usageCustomer(w, r)
+    if !ok {
+        return
+    }
+    since, until, ok := usagePeriod(w, r)
+    if !ok {
+        return
+    }
+    
+    days, err := s.routerSvc.CustomerUsage(r.Context(), customer, since, until)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    total := models.CustomerUsageDay{}
+    for _, d := range days {
+        total.Calls += d.Calls
+        total.Answered += d.Answered
+        total.BillableMinutes += d.BillableMinutes
+    }
+    if total.Calls > 0 {
+        total.ASR = float64(total.Answered) / float64(total.Calls) * 100
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "customer":         customer,
+        "since":            since,
+        "until":            until,
+        "calls":            total.Calls,
+        "answered":         total.Answered,
+        "asr":              total.ASR,
+        "billable_minutes": total.BillableMinutes,
+        "days":             days,
+    })
+}
+
+// handleUsageDIDs serves GET /api/v1/usage/dids, the DIDs the customer's calls
+// used between since and until
+func (s *Server) handleUsageDIDs(w http.ResponseWriter, r *http.Request) {
+    customer, ok := usageCustomer(w, r)
+    if !ok {
+        return
+    }
+    since, until, ok := usagePeriod(w, r)
+    if !ok {
+        return
+    }
+    
+    dids, err := s.routerSvc.CustomerDIDs(r.Context(), customer, since, until)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "customer": customer,
+        "dids":     dids,
+    })
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+    "fmt"
+    "net/http"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/router"
+)
+
+// handleVerificationReport serves GET /api/v1/verifications/report
+//
+// Query parameters: since (duration such as 24h, or RFC3339), until (RFC3339),
+// provider, tag (key=value or key, repeatable), step and interval (hour or day).
+func (s *Server) handleVerificationReport(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    
+    filter := router.VerificationReportFilter{
+        Provider: q.Get("provider"),
+        Step:     q.Get("step"),
+        Interval: q.Get("interval"),
+    }
+    
+    var err error
+    if filter.Tags, err = parseTagParam(q); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if filter.Until, err = parseTimeParam(q.Get("until"), time.Now()); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if filter.Until.IsZero() {
+        filter.Until = time.Now()
+    }
+    if filter.Since, err = parseTimeParam(q.Get("since"), filter.Until); err != nil {
+        writeError(w, http.StatusBadRequest, err)
+        return
+    }
+    if filter.Interval != "" && filter.Interval != "hour" && filter.Interval != "day" {
+        writeError(w, http.StatusBadRequest, fmt.Errorf("interval must be hour or day"))
+        return
+    }
+    
+    report, err := s.routerSvc.GetVerificationReport(r.Context(), filter)
+    if err != nil {
+        writeError(w, http.StatusInternalServerError, err)
+        return
+    }
+    
+    writeJSON(w, http.StatusOK, report)
+}
+
+// parseTimeParam accepts either an RFC3339 timestamp or a duration relative to ref
+func parseTimeParam(value string, ref time.Time) (time.Time, error) {
+    if value == "" {
+        return time.Time{}, nil
+    }
+    
+    if d, err := time.ParseDuration(value); err == nil {
+        return ref.Add(-d), nil
+    }
+    
+    t, err := time.Parse(time.RFC3339, value)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("invalid time %q: use RFC3339 or a duration like 24h", value)
+    }
+    return t, nil
+}
@@ -0,0 +1,205 @@
+package ara
+
+import (
+    "fmt"
+    "strings"
+)
+
+// BootstrapConfig holds the settings the Asterisk side configuration is generated from
+type BootstrapConfig struct {
+    DBHost     string
+    DBPort     int
+    DBName     string
+    DBUser     string
+    DBPassword string
+    
+    ODBCClass  string // res_odbc.conf class referenced by extconfig.conf
+    ODBCDSN    string // odbc.ini data source
+    ODBCDriver string // unixODBC driver name
+    
+    AMIUser     string
+    AMIPassword string
+    AMIPort     int
+    AMIPermit   string // network allowed to log in as AMIUser
+    
+    AMITLS         bool   // serve AMI over TLS on AMIPort, plain AMI only on localhost
+    AMITLSCertFile string // certificate and key Asterisk presents
+    AMITLSKeyFile  string
+}
+
+// ConfigVar is one line of an Asterisk config section
+type ConfigVar struct {
+    Name   string
+    Value  string
+    Object bool // written as "name => value"
+}
+
+// ConfigSection is a [category] of an Asterisk config file
+type ConfigSection struct {
+    Name string
+    Vars []ConfigVar
+}
+
+// ConfigFile is a generated configuration file
+type ConfigFile struct {
+    Name     string
+    Comment  string
+    System   bool // lives outside the Asterisk config directory, e.g. /etc/odbc.ini
+    Sections []ConfigSection
+}
+
+// Render formats the file the way Asterisk writes its own configs
+func (f ConfigFile) Render() string {
+    var b strings.Builder
+    for _, line := range strings.Split(f.Comment, "\n") {
+        fmt.Fprintf(&b, "; %s\n", line)
+    }
+    
+    for _, section := range f.Sections {
+        fmt.Fprintf(&b, "\n[%s]\n", section.Name)
+        for _, v := range section.Vars {
+            op := "="
+            if v.Object {
+                op = "=>"
+            }
+            fmt.Fprintf(&b, "%s %s %s\n", v.Name, op, v.Value)
+        }
+    }
+    return b.String()
+}
+
+// realtimeTables maps the extconfig.conf families to the tables the router maintains
+var realtimeTables = []string{
+    "ps_endpoints", "ps_auths", "ps_aors", "ps_endpoint_id_ips",
+    "ps_contacts", "ps_domain_aliases", "extensions",
+}
+
+// GenerateAsteriskConfig builds the Asterisk configuration ARA needs: the ODBC
+// connection, realtime mappings, PJSIP sorcery wiring, the AMI user and the
+// dialplan contexts that switch into the realtime extensions table
+func GenerateAsteriskConfig(cfg BootstrapConfig) []ConfigFile {
+    if cfg.ODBCClass == "" {
+        cfg.ODBCClass = "asterisk"
+    }
+    if cfg.ODBCDSN == "" {
+        cfg.ODBCDSN = "asterisk-ara"
+    }
+    if cfg.AMIPermit == "" {
+        cfg.AMIPermit = "127.0.0.1/255.255.255.255"
+    }
+    
+    managerGeneral := []ConfigVar{
+        {Name: "enabled", Value: "yes"},
+        {Name: "port", Value: fmt.Sprintf("%d", cfg.AMIPort)},
+        {Name: "bindaddr", Value: "0.0.0.0"},
+    }
+    if cfg.AMITLS {
+        // Credentials only cross the network encrypted
+        managerGeneral = []ConfigVar{
+            {Name: "enabled", Value: "yes"},
+            {Name: "port", Value: "5038"},
+            {Name: "bindaddr", Value: "127.0.0.1"},
+            {Name: "tlsenable", Value: "yes"},
+            {Name: "tlsbindaddr", Value: fmt.Sprintf("0.0.0.0:%d", cfg.AMIPort)},
+            {Name: "tlscertfile", Value: cfg.AMITLSCertFile},
+            {Name: "tlsprivatekey", Value: cfg.AMITLSKeyFile},
+        }
+    }
+    
+    var mappings []ConfigVar
+    for _, table := range realtimeTables {
+        mappings = append(mappings, ConfigVar{Name: table, Value: fmt.Sprintf("odbc,%s,%s", cfg.ODBCClass, table), Object: true})
+    }
+    
+    var contexts []ConfigSection
+    for _, context := range DialplanContexts {
+        contexts = append(contexts, ConfigSection{
+            Name: context,
+            Vars: []ConfigVar{{Name: "switch", Value: "Realtime/" + context + "@extensions", Object: true}},
+        })
+    }
+    
+    return []ConfigFile{
+        {
+            Name:    "odbc.ini",
+            Comment: "unixODBC data source for Asterisk, install as /etc/odbc.ini",
+            System:  true,
+            Sections: []ConfigSection{{
+                Name: cfg.ODBCDSN,
+                Vars: []ConfigVar{
+                    {Name: "Driver", Value: cfg.ODBCDriver},
+                    {Name: "Server", Value: cfg.DBHost},
+                    {Name: "Port", Value: fmt.Sprintf("%d", cfg.DBPort)},
+                    {Name: "Database", Value: cfg.DBName},
+                    {Name: "Option", Value: "3"},
+                    {Name: "Charset", Value: "utf8mb4"},
+                },
+            }},
+        },
+        {
+            Name:    "res_odbc.conf",
+            Comment: "ODBC connection the realtime engine uses",
+            Sections: []ConfigSection{{
+                Name: cfg.ODBCClass,
+                Vars: []ConfigVar{
+                    {Name: "enabled", Value: "yes", Object: true},
+                    {Name: "dsn", Value: cfg.ODBCDSN, Object: true},
+                    {Name: "username", Value: cfg.DBUser, Object: true},
+                    {Name: "password", Value: cfg.DBPassword, Object: true},
+                    {Name: "pre-connect", Value: "yes", Object: true},
+                    {Name: "max_connections", Value: "20", Object: true},
+                },
+            }},
+        },
+        {
+            Name:     "extconfig.conf",
+            Comment:  "Realtime families served from the router database",
+            Sections: []ConfigSection{{Name: "settings", Vars: mappings}},
+        },
+        {
+            Name:    "sorcery.conf",
+            Comment: "PJSIP objects are read from the realtime tables",
+            Sections: []ConfigSection{
+                {
+                    Name: "res_pjsip",
+                    Vars: []ConfigVar{
+                        {Name: "endpoint", Value: "realtime,ps_endpoints"},
+                        {Name: "auth", Value: "realtime,ps_auths"},
+                        {Name: "aor", Value: "realtime,ps_aors"},
+                        {Name: "domain_alias", Value: "realtime,ps_domain_aliases"},
+                        {Name: "contact", Value: "realtime,ps_contacts"},
+                    },
+                },
+                {
+                    Name: "res_pjsip_endpoint_identifier_ip",
+                    Vars: []ConfigVar{{Name: "identify", Value: "realtime,ps_endpoint_id_ips"}},
+                },
+            },
+        },
+        {
+            Name:    "manager.conf",
+            Comment: "AMI user the router logs in with",
+            Sections: []ConfigSection{
+                {
+                    Name: "general",
+                    Vars: managerGeneral,
+                },
+                {
+                    Name: cfg.AMIUser,
+                    Vars: []ConfigVar{
+                        {Name: "secret", Value: cfg.AMIPassword},
+                        {Name: "deny", Value: "0.0.0.0/0.0.0.0"},
+                        {Name: "permit", Value: cfg.AMIPermit},
+                        {Name: "read", Value: "system,call,agent,command,reporting,originate"},
+                        {Name: "write", Value: "system,call,agent,command,reporting,originate,config"},
+                    },
+                },
+            },
+        },
+        {
+            Name:     "extensions.conf",
+            Comment:  "Router contexts are served from the extensions table via ARA",
+            Sections: contexts,
+        },
+    }
+}
@@ -0,0 +1,143 @@
+package ara
+
+import (
+    "context"
+    "strings"
+    
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// Kinds of ConsistencyIssue
+const (
+    IssueMissingEndpoint = "missing_endpoint"
+    IssueOrphanEndpoint  = "orphan_endpoint"
+    IssueMissingAOR      = "missing_aor"
+    IssueMissingAuth     = "missing_auth"
+    IssueMissingIdentify = "missing_identify"
+    IssueContextMismatch = "context_mismatch"
+    IssueMissingDialplan = "missing_dialplan"
+)
+
+// ConsistencyIssue is a mismatch between the providers and the realtime tables Asterisk reads
+type ConsistencyIssue struct {
+    Kind     string
+    Provider string // empty for dialplan issues
+    Object   string // endpoint, AOR, auth or context id
+    Detail   string
+}
+
+// CheckConsistency compares providers with their PJSIP realtime rows and checks
+// that every generated dialplan context has extensions
+func (m *Manager) CheckConsistency(ctx context.Context) ([]ConsistencyIssue, error) {
+    var issues []ConsistencyIssue
+    
+    checks := []struct {
+        kind   string
+        query  string
+        detail string
+    }{
+        {IssueMissingEndpoint, `
+            SELECT p.name, CONCAT('endpoint-', p.name) FROM providers p
+            LEFT JOIN ps_endpoints e ON e.id = CONCAT('endpoint-', p.name)
+            WHERE e.id IS NULL`, "provider has no PJSIP endpoint"},
+        {IssueOrphanEndpoint, `
+            SELECT SUBSTRING(e.id, 10), e.id FROM ps_endpoints e
+            LEFT JOIN providers p ON e.id = CONCAT('endpoint-', p.name)
+            WHERE e.id LIKE 'endpoint-%' AND p.name IS NULL`, "endpoint has no provider"},
+        {IssueMissingAOR, `
+            SELECT SUBSTRING(e.id, 10), e.aors FROM ps_endpoints e
+            LEFT JOIN ps_aors a ON a.id = e.aors
+            WHERE e.id LIKE 'endpoint-%' AND e.aors IS NOT NULL AND e.aors <> '' AND a.id IS NULL`, "endpoint references a missing AOR"},
+        {IssueMissingIdentify, `
+            SELECT p.name, CONCAT('endpoint-', p.name) FROM providers p
+            JOIN ps_endpoints e ON e.id = CONCAT('endpoint-', p.name)
+            LEFT JOIN ps_endpoint_id_ips i ON i.endpoint = e.id
+            WHERE p.auth_type IN ('ip', 'both') AND i.id IS NULL`, "IP authenticated provider has no identify entry"},
+        {IssueContextMismatch, `
+            SELECT p.name, e.context FROM providers p
+            JOIN ps_endpoints e ON e.id = CONCAT('endpoint-', p.name)
+            WHERE e.context <> CONCAT('from-provider-', p.type)`, "endpoint context doesn't match the provider type"},
+    }
+    
+    for _, check := range checks {
+        rows, err := m.db.QueryContext(ctx, check.query)
+        if err != nil {
+            return nil, errors.Wrap(err, errors.ErrDatabase, "failed to check ARA tables").
+                WithContext("check", check.kind)
+        }
+        for rows.Next() {
+            issue := ConsistencyIssue{Kind: check.kind, Detail: check.detail}
+            if err := rows.Scan(&issue.Provider, &issue.Object); err == nil {
+                issues = append(issues, issue)
+            }
+        }
+        rows.Close()
+    }
+    
+    authIssues, err := m.checkAuths(ctx)
+    if err != nil {
+        return nil, err
+    }
+    issues = append(issues, authIssues...)
+    
+    for _, context := range DialplanContexts {
+        var count int
+        if err := m.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM extensions WHERE context = ?", context).Scan(&count); err != nil {
+            return nil, errors.Wrap(err, errors.ErrDatabase, "failed to check dialplan")
+        }
+        if count == 0 {
+            issues = append(issues, ConsistencyIssue{
+                Kind:   IssueMissingDialplan,
+                Object: context,
+                Detail: "dialplan context has no extensions",
+            })
+        }
+    }
+    
+    return issues, nil
+}
+
+// checkAuths finds endpoints whose auth list names a missing ps_auths row
+func (m *Manager) checkAuths(ctx context.Context) ([]ConsistencyIssue, error) {
+    auths := make(map[string]bool)
+    rows, err := m.db.QueryContext(ctx, "SELECT id FROM ps_auths")
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query auths")
+    }
+    for rows.Next() {
+        var id string
+        if err := rows.Scan(&id); err == nil {
+            auths[id] = true
+        }
+    }
+    rows.Close()
+    
+    rows, err = m.db.QueryContext(ctx, `
+        SELECT id, auth FROM ps_endpoints
+        WHERE id LIKE 'endpoint-%' AND auth IS NOT NULL AND auth <> ''`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query endpoints")
+    }
+    defer rows.Close()
+    
+    var issues []ConsistencyIssue
+    for rows.Next() {
+        var id, authList string
+        if err := rows.Scan(&id, &authList); err != nil {
+            continue
+        }
+        // Rotations list the previous auth next to the current one
+        for _, auth := range strings.Split(authList, ",") {
+            if auth = strings.TrimSpace(auth); auth != "" && !auths[auth] {
+                issues = append(issues, ConsistencyIssue{
+                    Kind:     IssueMissingAuth,
+                    Provider: strings.TrimPrefix(id, "endpoint-"),
+                    Object:   auth,
+                    Detail:   "endpoint references a missing auth",
+                })
+            }
+        }
+    }
+    
+    return issues, rows.Err()
+}
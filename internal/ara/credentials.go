@@ -0,0 +1,149 @@
+package ara
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// previousAuthID names the auth section that keeps the old password valid during a rotation
+func previousAuthID(providerName string) string {
+    return fmt.Sprintf("auth-%s-prev", providerName)
+}
+
+// RotateAuthTx sets a new password on the provider's auth section. With
+// keepPrevious the current password is copied to a second auth section that
+// the endpoint also accepts, so peers can switch over during the overlap.
+func (m *Manager) RotateAuthTx(ctx context.Context, tx *sql.Tx, providerName, password string, keepPrevious bool) error {
+    authID := fmt.Sprintf("auth-%s", providerName)
+    endpointID := fmt.Sprintf("endpoint-%s", providerName)
+    prevID := previousAuthID(providerName)
+    
+    authRef := authID
+    if keepPrevious {
+        _, err := tx.ExecContext(ctx, `
+            INSERT INTO ps_auths (id, auth_type, username, password, realm)
+            SELECT ?, auth_type, username, password, realm FROM ps_auths WHERE id = ?
+            ON DUPLICATE KEY UPDATE
+                username = VALUES(username),
+                password = VALUES(password),
+                realm = VALUES(realm)`,
+            prevID, authID)
+        if err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to keep previous auth")
+        }
+        authRef = authID + "," + prevID
+    } else {
+        if _, err := tx.ExecContext(ctx, "DELETE FROM ps_auths WHERE id = ?", prevID); err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to remove previous auth")
+        }
+    }
+    
+    result, err := tx.ExecContext(ctx, "UPDATE ps_auths SET password = ? WHERE id = ?", password, authID)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update auth")
+    }
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return errors.New(errors.ErrProviderNotFound, "provider has no auth section").
+            WithContext("provider", providerName)
+    }
+    
+    if _, err := tx.ExecContext(ctx, "UPDATE ps_endpoints SET auth = ? WHERE id = ?", authRef, endpointID); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update endpoint auth")
+    }
+    
+    m.cache.Invalidate(ctx, fmt.Sprintf("endpoint:%s", providerName))
+    return nil
+}
+
+// DropPreviousAuthTx ends a rotation overlap, only the current password stays valid
+func (m *Manager) DropPreviousAuthTx(ctx context.Context, tx *sql.Tx, providerName string) error {
+    if _, err := tx.ExecContext(ctx, "DELETE FROM ps_auths WHERE id = ?", previousAuthID(providerName)); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to remove previous auth")
+    }
+    
+    _, err := tx.ExecContext(ctx, "UPDATE ps_endpoints SET auth = ? WHERE id = ? AND auth LIKE '%,%'",
+        fmt.Sprintf("auth-%s", providerName), fmt.Sprintf("endpoint-%s", providerName))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update endpoint auth")
+    }
+    
+    m.cache.Invalidate(ctx, fmt.Sprintf("endpoint:%s", providerName))
+    return nil
+}
+
+// aorIDFor returns the AOR name of a provider. The registrar looks up the AOR
+// by the To or Authorization username, so registering customers use their
+// SIP username while static peers keep aor-<provider>.
+func aorIDFor(provider *models.Provider) string {
+    if provider.Registers() && provider.Username != "" {
+        return provider.Username
+    }
+    return fmt.Sprintf("aor-%s", provider.Name)
+}
+
+// maxContacts is the number of registrations a customer may hold, set via
+// the max_contacts metadata key
+func maxContacts(provider *models.Provider) int {
+    if !provider.Registers() {
+        return 1
+    }
+    switch v := provider.Metadata["max_contacts"].(type) {
+    case float64:
+        if v >= 1 {
+            return int(v)
+        }
+    case int:
+        if v >= 1 {
+            return v
+        }
+    }
+    return 1
+}
+
+func deleteAORTx(ctx context.Context, tx *sql.Tx, aorID string) error {
+    if _, err := tx.ExecContext(ctx, "DELETE FROM ps_contacts WHERE id LIKE ?", aorID+";@%"); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to remove contacts")
+    }
+    if _, err := tx.ExecContext(ctx, "DELETE FROM ps_aors WHERE id = ?", aorID); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to remove AOR")
+    }
+    return nil
+}
+
+// ListContacts returns the contacts a registering customer currently holds
+func (m *Manager) ListContacts(ctx context.Context, provider *models.Provider) ([]*models.SIPContact, error) {
+    endpointID := fmt.Sprintf("endpoint-%s", provider.Name)
+    
+    rows, err := m.db.QueryContext(ctx, `
+        SELECT id, COALESCE(uri, ''), COALESCE(user_agent, ''), COALESCE(via_addr, ''),
+               COALESCE(via_port, 0), COALESCE(expiration_time, 0)
+        FROM ps_contacts
+        WHERE endpoint = ? OR id LIKE ?
+        ORDER BY expiration_time DESC`,
+        endpointID, aorIDFor(provider)+";@%")
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query contacts")
+    }
+    defer rows.Close()
+    
+    var contacts []*models.SIPContact
+    for rows.Next() {
+        var c models.SIPContact
+        var expires int64
+        if err := rows.Scan(&c.ID, &c.URI, &c.UserAgent, &c.ViaAddr, &c.ViaPort, &expires); err != nil {
+            continue
+        }
+        if expires > 0 {
+            t := time.Unix(expires, 0)
+            c.ExpiresAt = &t
+        }
+        contacts = append(contacts, &c)
+    }
+    
+    return contacts, rows.Err()
+}
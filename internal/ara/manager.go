@@ -7,6 +7,7 @@ import (
     "strings"
     "time"
     
+    "github.com/hamzaKhattat/ara-production-system/internal/agivars"
     "github.com/hamzaKhattat/ara-production-system/internal/models"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
     "github.com/hamzaKhattat/ara-production-system/pkg/errors"
@@ -21,6 +22,7 @@ type CacheInterface interface {
     Get(ctx context.Context, key string, dest interface{}) error
     Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
     Delete(ctx context.Context, keys ...string) error
+    Invalidate(ctx context.Context, keys ...string) error // Delete after a configuration change, on every node
 }
 
 func NewManager(db *sql.DB, cache CacheInterface) *Manager {
@@ -42,13 +44,33 @@ func (m *Manager) CreateEndpoint(ctx context.Context, provider *models.Provider)
     
     endpointID := fmt.Sprintf("endpoint-%s", provider.Name)
     authID := fmt.Sprintf("auth-%s", provider.Name)
-    aorID := fmt.Sprintf("aor-%s", provider.Name)
+    aorID := aorIDFor(provider)
+    
+    if provider.Registers() {
+        var taken int
+        tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM ps_endpoints WHERE aors = ? AND id <> ?", aorID, endpointID).Scan(&taken)
+        if taken > 0 {
+            return errors.New(errors.ErrInternal, "SIP username is already used by another customer").
+                WithContext("username", provider.Username)
+        }
+    }
+    
+    // Drop the old AOR and its contacts when the AOR name changed, e.g. a new username
+    var currentAOR sql.NullString
+    tx.QueryRowContext(ctx, "SELECT aors FROM ps_endpoints WHERE id = ?", endpointID).Scan(&currentAOR)
+    if currentAOR.Valid && currentAOR.String != "" && currentAOR.String != aorID {
+        if err := deleteAORTx(ctx, tx, currentAOR.String); err != nil {
+            return err
+        }
+    }
     
-    // Create/update AOR
+    // Create/update AOR. Registering customers get no static contact, the
+    // registrar stores their contacts in ps_contacts.
     aorQuery := `
         INSERT INTO ps_aors (id, max_contacts, remove_existing, qualify_frequency)
-        VALUES (?, 1, 'yes', ?)
+        VALUES (?, ?, 'yes', ?)
         ON DUPLICATE KEY UPDATE
+            max_contacts = VALUES(max_contacts),
             qualify_frequency = VALUES(qualify_frequency)`
     
     qualifyFreq := 60
@@ -56,12 +78,12 @@ func (m *Manager) CreateEndpoint(ctx context.Context, provider *models.Provider)
         qualifyFreq = 30
     }
     
-    if _, err := tx.ExecContext(ctx, aorQuery, aorID, qualifyFreq); err != nil {
+    if _, err := tx.ExecContext(ctx, aorQuery, aorID, maxContacts(provider), qualifyFreq); err != nil {
         return errors.Wrap(err, errors.ErrDatabase, "failed to create AOR")
     }
     
     // Create/update Auth if using credentials
-    if provider.AuthType == "credentials" || provider.AuthType == "both" {
+    if provider.UsesCredentials() {
         authQuery := `
             INSERT INTO ps_auths (id, auth_type, username, password, realm)
             VALUES (?, 'userpass', ?, ?, ?)
@@ -84,12 +106,14 @@ func (m *Manager) CreateEndpoint(ctx context.Context, provider *models.Provider)
     // Determine context based on provider type
     context := fmt.Sprintf("from-provider-%s", provider.Type)
     
-    // CRITICAL: Set identify_by correctly based on auth type
-    identifyBy := "username"
+    // CRITICAL: Set identify_by correctly based on auth type. Endpoints are
+    // named endpoint-<provider>, so digest peers are matched by the username
+    // in their Authorization header rather than the From user.
+    identifyBy := "auth_username,username"
     if provider.AuthType == "ip" {
         identifyBy = "ip"
     } else if provider.AuthType == "both" {
-        identifyBy = "username,ip"
+        identifyBy = "auth_username,username,ip"
     }
     
     // Build endpoint query
@@ -117,8 +141,15 @@ func (m *Manager) CreateEndpoint(ctx context.Context, provider *models.Provider)
             identify_by = VALUES(identify_by)`
     
     authRef := ""
-    if provider.AuthType == "credentials" || provider.AuthType == "both" {
+    if provider.UsesCredentials() {
         authRef = authID
+        
+        // Keep accepting the previous password while a rotation overlap is running
+        var prevExists int
+        tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM ps_auths WHERE id = ?", previousAuthID(provider.Name)).Scan(&prevExists)
+        if prevExists > 0 {
+            authRef += "," + previousAuthID(provider.Name)
+        }
     }
     
     if _, err := tx.ExecContext(ctx, endpointQuery, endpointID, aorID, authRef, context, codecs, identifyBy); err != nil {
@@ -150,6 +181,11 @@ func (m *Manager) CreateEndpoint(ctx context.Context, provider *models.Provider)
             "ip_match": match,
             "identify_by": identifyBy,
         }).Debug("Created IP identifier")
+    } else {
+        // Stale IP identifiers would still match after switching to digest auth
+        if _, err := tx.ExecContext(ctx, "DELETE FROM ps_endpoint_id_ips WHERE endpoint = ?", endpointID); err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to remove IP auth")
+        }
     }
     
     // Commit transaction
@@ -158,7 +194,7 @@ func (m *Manager) CreateEndpoint(ctx context.Context, provider *models.Provider)
     }
     
     // Clear cache
-    m.cache.Delete(ctx, fmt.Sprintf("endpoint:%s", provider.Name))
+    m.cache.Invalidate(ctx, fmt.Sprintf("endpoint:%s", provider.Name))
     
     log.WithFields(map[string]interface{}{
         "provider": provider.Name,
@@ -183,12 +219,23 @@ func (m *Manager) DeleteEndpoint(ctx context.Context, providerName string) error
     aorID := fmt.Sprintf("aor-%s", providerName)
     ipID := fmt.Sprintf("ip-%s", providerName)
     
+    // Registering customers use their username as AOR
+    var currentAOR sql.NullString
+    tx.QueryRowContext(ctx, "SELECT aors FROM ps_endpoints WHERE id = ?", endpointID).Scan(&currentAOR)
+    if currentAOR.Valid && currentAOR.String != "" && currentAOR.String != aorID {
+        if err := deleteAORTx(ctx, tx, currentAOR.String); err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to delete ARA component")
+        }
+    }
+    
     // Delete in reverse order
     queries := []string{
         fmt.Sprintf("DELETE FROM ps_endpoint_id_ips WHERE id = '%s'", ipID),
         fmt.Sprintf("DELETE FROM ps_endpoints WHERE id = '%s'", endpointID),
         fmt.Sprintf("DELETE FROM ps_auths WHERE id = '%s'", authID),
+        fmt.Sprintf("DELETE FROM ps_auths WHERE id = '%s'", previousAuthID(providerName)),
         fmt.Sprintf("DELETE FROM ps_aors WHERE id = '%s'", aorID),
+        fmt.Sprintf("DELETE FROM ps_contacts WHERE endpoint = '%s'", endpointID),
     }
     
     for _, query := range queries {
@@ -202,38 +249,114 @@ func (m *Manager) DeleteEndpoint(ctx context.Context, providerName string) error
     }
     
     // Clear cache
-    m.cache.Delete(ctx, fmt.Sprintf("endpoint:%s", providerName))
+    m.cache.Invalidate(ctx, fmt.Sprintf("endpoint:%s", providerName))
     
     return nil
 }
 
-// CreateDialplan creates the complete dialplan in ARA
-func (m *Manager) CreateDialplan(ctx context.Context) error {
-    log := logger.WithContext(ctx)
-    
-    // Clear existing dialplan for our contexts
-    contexts := []string{
-        "from-provider-inbound",
-        "from-provider-intermediate",
-        "from-provider-final",
-        "router-outbound",
-        "router-internal",
-        "hangup-handler",
-        "sub-recording",
+// AGIBaseURL is where the generated dialplan reaches the AGI server
+const AGIBaseURL = "agi://localhost:4573"
+
+// DialplanContexts are the contexts CreateDialplan generates in the extensions table
+var DialplanContexts = []string{
+    agivars.InboundContext,
+    "from-provider-intermediate",
+    "from-provider-final",
+    "hangup-handler",
+    "sub-predial",
+    "sub-answer",
+}
+
+// legacyDialplanContexts were generated by earlier releases and are cleared with the dialplan
+var legacyDialplanContexts = []string{
+    "router-outbound",
+    "router-internal",
+    "sub-recording",
+    "sub-correlation-header",
+}
+
+// dialAppData dials what the router built for the leg, so timeouts, options and
+// transports change per provider and route without regenerating the dialplan
+const dialAppData = "${DIAL_STRING},${DIAL_TIMEOUT},${DIAL_OPTIONS}"
+
+// routerStatusCheck branches on the result of an AGI routing request
+var routerStatusCheck = fmt.Sprintf("$[\"%s\" = \"%s\"]?route:failed", agivars.Ref(agivars.RouterStatus), agivars.StatusSuccess)
+
+// routerCongestion plays congestion to calls the router rejected at a rate
+// limit, so the caller backs off instead of retrying at once
+var routerCongestion = fmt.Sprintf("$[\"%s\" = \"%s\"]?Congestion(5)", agivars.Ref(agivars.RouterErrorCode), errors.ErrRateLimited)
+
+// routerStatusRetry dials the provider a leg failed over to, or hangs up as dialed
+var routerStatusRetry = fmt.Sprintf("$[\"%s\" = \"%s\"]?route:end", agivars.Ref(agivars.RouterStatus), agivars.StatusSuccess)
+
+// dialNoAnswerCheck sends a leg that rang out to another provider of its route
+var dialNoAnswerCheck = fmt.Sprintf("$[\"%s\" = \"NOANSWER\"]?noanswer", agivars.Ref(agivars.DialStatus))
+
+// dialForkCheck dials the next hop of a serial fork when the intermediate
+// rang out or couldn't take the call, before asking the router for another
+var dialForkCheck = fmt.Sprintf("$[%s < %s & (\"%s\" = \"NOANSWER\" | \"%s\" = \"CHANUNAVAIL\" | \"%s\" = \"CONGESTION\")]?fork",
+    agivars.Ref(agivars.ForkHop), agivars.Ref(agivars.ForkHops),
+    agivars.Ref(agivars.DialStatus), agivars.Ref(agivars.DialStatus), agivars.Ref(agivars.DialStatus))
+
+// forkAttemptCDR annotates the CDR of a forked call with how each hop went
+var forkAttemptCDR = fmt.Sprintf("$[%s > 0]?Set(CDR(fork_attempt_%s)=%s/%s/%s)",
+    agivars.Ref(agivars.ForkHops), agivars.Ref(agivars.ForkHop),
+    agivars.Ref(agivars.IntermediateProvider), agivars.Ref(agivars.DIDAssigned), agivars.Ref(agivars.DialStatus))
+
+// forkHopExtensions move the leg to S3 on to the next hop of its serial fork
+func forkHopExtensions(priority int) []DialplanExtension {
+    extensions := []DialplanExtension{
+        {Exten: "_X.", Priority: priority, App: "Set", AppData: agivars.ForkHop + "=$[" + agivars.Ref(agivars.ForkHop) + " + 1]", Label: "fork"},
     }
-    
-    tx, err := m.db.BeginTx(ctx, nil)
-    if err != nil {
-        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    for _, name := range agivars.ForkVariables {
+        priority++
+        extensions = append(extensions, DialplanExtension{Exten: "_X.", Priority: priority, App: "Set", AppData: name + "=" + agivars.ForkRef(name)})
     }
-    defer tx.Rollback()
-    
-    // Clear existing extensions
-    for _, context := range contexts {
-        if _, err := tx.ExecContext(ctx, "DELETE FROM extensions WHERE context = ?", context); err != nil {
-            log.WithError(err).Warn("Failed to clear context")
+    return append(extensions, DialplanExtension{Exten: "_X.", Priority: priority + 1, App: "Goto", AppData: "dial"})
+}
+
+// routeHopCheck sends a returned call on to the next intermediate of a route
+// of several hops rather than to S4
+var routeHopCheck = fmt.Sprintf("$[\"%s\" != \"\"]?hop", agivars.Ref(agivars.RouteHop))
+
+// routeHopExtensions dial the next hop of a route of several intermediates.
+// The hop brings the call back into this same context, Asterisk picks it by
+// the endpoint the call comes from, so one context serves every hop.
+func routeHopExtensions(priority int) []DialplanExtension {
+    cdr := "CDR(hop_" + agivars.Ref(agivars.RouteHop) + "_"
+    return []DialplanExtension{
+        {Exten: "_X.", Priority: priority, App: "Set", AppData: cdr + "provider)=${INTERMEDIATE_PROVIDER}", Label: "hop"},
+        {Exten: "_X.", Priority: priority + 1, App: "Set", AppData: cdr + "did)=${DID_ASSIGNED}"},
+        {Exten: "_X.", Priority: priority + 2, App: "Set", AppData: "__CORRELATION_TOKEN=${CORRELATION_TOKEN}"},
+        {Exten: "_X.", Priority: priority + 3, App: "Dial", AppData: dialAppData},
+        {Exten: "_X.", Priority: priority + 4, App: "Set", AppData: cdr + "sip_response)=${HANGUPCAUSE}"},
+        {Exten: "_X.", Priority: priority + 5, App: "Hangup", AppData: ""},
+    }
+}
+
+// dialFailedCheck jumps to label unless the provider couldn't take the call at
+// all, only then the call moves to a failover route. A busy or cancelled call
+// is up to the called party.
+func dialFailedCheck(label string) string {
+    status := agivars.Ref(agivars.DialStatus)
+    return fmt.Sprintf("$[\"%s\" != \"CHANUNAVAIL\" & \"%s\" != \"CONGESTION\"]?%s", status, status, label)
+}
+
+// checkDialplanContract validates the generated contexts against the AGI variable contract
+func checkDialplanContract(contexts map[string][]DialplanExtension) error {
+    var steps []agivars.DialplanStep
+    for _, context := range DialplanContexts {
+        for _, ext := range contexts[context] {
+            steps = append(steps, agivars.DialplanStep{App: ext.App, AppData: ext.AppData})
         }
     }
+    return agivars.CheckDialplan(steps)
+}
+
+// DialplanExtensions returns the extensions CreateDialplan generates, by the
+// contexts DialplanContexts lists
+func DialplanExtensions() map[string][]DialplanExtension {
+    contexts := make(map[string][]DialplanExtension, len(DialplanContexts))
     
     // Create inbound context (from S1)
     inboundExtensions := []DialplanExtension{
@@ -248,41 +371,61 @@ func (m *Manager) CreateDialplan(ctx context.Context) error {
         {Exten: "_X.", Priority: 9, App: "Set", AppData: "CDR(original_ani)=${ORIGINAL_ANI}"},
         {Exten: "_X.", Priority: 10, App: "Set", AppData: "CDR(original_dnis)=${ORIGINAL_DNIS}"},
         {Exten: "_X.", Priority: 11, App: "MixMonitor", AppData: "${UNIQUEID}.wav,b,/usr/local/bin/post-recording.sh ${UNIQUEID}"},
-        {Exten: "_X.", Priority: 12, App: "AGI", AppData: "agi://localhost:4573/processIncoming"},
-        {Exten: "_X.", Priority: 13, App: "GotoIf", AppData: "$[\"${ROUTER_STATUS}\" = \"success\"]?route:failed"},
-        {Exten: "_X.", Priority: 14, App: "Hangup", AppData: "21", Label: "failed"},
-        {Exten: "_X.", Priority: 15, App: "Set", AppData: "CALLERID(num)=${ANI_TO_SEND}", Label: "route"},
-        {Exten: "_X.", Priority: 16, App: "Set", AppData: "CDR(intermediate_provider)=${INTERMEDIATE_PROVIDER}"},
-        {Exten: "_X.", Priority: 17, App: "Set", AppData: "CDR(assigned_did)=${DID_ASSIGNED}"},
-        {Exten: "_X.", Priority: 18, App: "Dial", AppData: "PJSIP/${DNIS_TO_SEND}@${NEXT_HOP},180,U(sub-recording^${UNIQUEID})"},
-        {Exten: "_X.", Priority: 19, App: "Set", AppData: "CDR(sip_response)=${HANGUPCAUSE}"},
-        {Exten: "_X.", Priority: 20, App: "GotoIf", AppData: "$[\"${DIALSTATUS}\" = \"ANSWER\"]?end:failed"},
-        {Exten: "_X.", Priority: 21, App: "Hangup", AppData: "", Label: "end"},
-    }
-    
-    if err := m.insertExtensions(tx, "from-provider-inbound", inboundExtensions); err != nil {
-        return err
-    }
+        {Exten: "_X.", Priority: 12, App: "AGI", AppData: agivars.AGIURL(AGIBaseURL, agivars.RequestProcessIncoming)},
+        {Exten: "_X.", Priority: 13, App: "GotoIf", AppData: routerStatusCheck},
+        {Exten: "_X.", Priority: 14, App: "ExecIf", AppData: routerCongestion, Label: "failed"},
+        {Exten: "_X.", Priority: 15, App: "Hangup", AppData: "21"},
+        {Exten: "_X.", Priority: 16, App: "Set", AppData: "CALLERID(num)=${ANI_TO_SEND}", Label: "route"},
+        {Exten: "_X.", Priority: 17, App: "Set", AppData: agivars.ForkHop + "=0"},
+        {Exten: "_X.", Priority: 18, App: "Set", AppData: "CDR(intermediate_provider)=${INTERMEDIATE_PROVIDER}", Label: "dial"},
+        {Exten: "_X.", Priority: 19, App: "Set", AppData: "CDR(assigned_did)=${DID_ASSIGNED}"},
+        {Exten: "_X.", Priority: 20, App: "Set", AppData: "__CORRELATION_TOKEN=${CORRELATION_TOKEN}"},
+        {Exten: "_X.", Priority: 21, App: "Dial", AppData: dialAppData},
+        {Exten: "_X.", Priority: 22, App: "Set", AppData: "CDR(sip_response)=${HANGUPCAUSE}"},
+        {Exten: "_X.", Priority: 23, App: "ExecIf", AppData: forkAttemptCDR},
+        {Exten: "_X.", Priority: 24, App: "GotoIf", AppData: "$[\"${DIALSTATUS}\" = \"ANSWER\"]?end"},
+        {Exten: "_X.", Priority: 25, App: "GotoIf", AppData: dialForkCheck},
+        {Exten: "_X.", Priority: 26, App: "GotoIf", AppData: dialNoAnswerCheck},
+        {Exten: "_X.", Priority: 27, App: "GotoIf", AppData: dialFailedCheck("failed")},
+        {Exten: "_X.", Priority: 28, App: "AGI", AppData: agivars.AGIURL(AGIBaseURL, agivars.RequestDialFailed)},
+        {Exten: "_X.", Priority: 29, App: "GotoIf", AppData: routerStatusCheck},
+        {Exten: "_X.", Priority: 30, App: "AGI", AppData: agivars.AGIURL(AGIBaseURL, agivars.RequestNoAnswer), Label: "noanswer"},
+        {Exten: "_X.", Priority: 31, App: "GotoIf", AppData: routerStatusCheck},
+        {Exten: "_X.", Priority: 32, App: "Hangup", AppData: "", Label: "end"},
+    }
+    
+    inboundExtensions = append(inboundExtensions, forkHopExtensions(33)...)
+    
+    contexts[agivars.InboundContext] = inboundExtensions
     
     // Create intermediate context (from S3)
     intermediateExtensions := []DialplanExtension{
         {Exten: "_X.", Priority: 1, App: "NoOp", AppData: "Return call from S3: ${CALLERID(num)} -> ${EXTEN}"},
         {Exten: "_X.", Priority: 2, App: "Set", AppData: "__INTERMEDIATE_PROVIDER=${CHANNEL(endpoint)}"},
         {Exten: "_X.", Priority: 3, App: "Set", AppData: "__SOURCE_IP=${CHANNEL(pjsip,remote_addr)}"},
-        {Exten: "_X.", Priority: 4, App: "Set", AppData: "CDR(intermediate_return)=true"},
-        {Exten: "_X.", Priority: 5, App: "AGI", AppData: "agi://localhost:4573/processReturn"},
-        {Exten: "_X.", Priority: 6, App: "GotoIf", AppData: "$[\"${ROUTER_STATUS}\" = \"success\"]?route:failed"},
-        {Exten: "_X.", Priority: 7, App: "Hangup", AppData: "21", Label: "failed"},
-        {Exten: "_X.", Priority: 8, App: "Set", AppData: "CALLERID(num)=${ANI_TO_SEND}", Label: "route"},
-        {Exten: "_X.", Priority: 9, App: "Set", AppData: "CDR(final_provider)=${FINAL_PROVIDER}"},
-        {Exten: "_X.", Priority: 10, App: "Dial", AppData: "PJSIP/${DNIS_TO_SEND}@${NEXT_HOP},180"},
-        {Exten: "_X.", Priority: 11, App: "Set", AppData: "CDR(final_sip_response)=${HANGUPCAUSE}"},
-        {Exten: "_X.", Priority: 12, App: "Hangup", AppData: ""},
+        {Exten: "_X.", Priority: 4, App: "Set", AppData: "CORRELATION_TOKEN=${PJSIP_HEADER(read,X-ARA-Token)}"},
+        {Exten: "_X.", Priority: 5, App: "Set", AppData: "CDR(intermediate_return)=true"},
+        {Exten: "_X.", Priority: 6, App: "AGI", AppData: agivars.AGIURL(AGIBaseURL, agivars.RequestProcessReturn)},
+        {Exten: "_X.", Priority: 7, App: "GotoIf", AppData: routerStatusCheck},
+        {Exten: "_X.", Priority: 8, App: "ExecIf", AppData: routerCongestion, Label: "failed"},
+        {Exten: "_X.", Priority: 9, App: "Hangup", AppData: "21"},
+        {Exten: "_X.", Priority: 10, App: "Set", AppData: "CALLERID(num)=${ANI_TO_SEND}", Label: "route"},
+        {Exten: "_X.", Priority: 11, App: "GotoIf", AppData: routeHopCheck},
+        {Exten: "_X.", Priority: 12, App: "Set", AppData: "CDR(final_provider)=${FINAL_PROVIDER}"},
+        {Exten: "_X.", Priority: 13, App: "Dial", AppData: dialAppData},
+        {Exten: "_X.", Priority: 14, App: "Set", AppData: "CDR(final_sip_response)=${HANGUPCAUSE}"},
+        {Exten: "_X.", Priority: 15, App: "GotoIf", AppData: dialNoAnswerCheck},
+        {Exten: "_X.", Priority: 16, App: "GotoIf", AppData: dialFailedCheck("end")},
+        {Exten: "_X.", Priority: 17, App: "AGI", AppData: agivars.AGIURL(AGIBaseURL, agivars.RequestDialFailed)},
+        {Exten: "_X.", Priority: 18, App: "GotoIf", AppData: routerStatusRetry},
+        {Exten: "_X.", Priority: 19, App: "AGI", AppData: agivars.AGIURL(AGIBaseURL, agivars.RequestNoAnswer), Label: "noanswer"},
+        {Exten: "_X.", Priority: 20, App: "GotoIf", AppData: routerStatusRetry},
+        {Exten: "_X.", Priority: 21, App: "Hangup", AppData: "", Label: "end"},
     }
     
-    if err := m.insertExtensions(tx, "from-provider-intermediate", intermediateExtensions); err != nil {
-        return err
-    }
+    intermediateExtensions = append(intermediateExtensions, routeHopExtensions(22)...)
+    
+    contexts["from-provider-intermediate"] = intermediateExtensions
     
     // Create final context (from S4)
     finalExtensions := []DialplanExtension{
@@ -290,38 +433,80 @@ func (m *Manager) CreateDialplan(ctx context.Context) error {
         {Exten: "_X.", Priority: 2, App: "Set", AppData: "__FINAL_PROVIDER=${CHANNEL(endpoint)}"},
         {Exten: "_X.", Priority: 3, App: "Set", AppData: "__SOURCE_IP=${CHANNEL(pjsip,remote_addr)}"},
         {Exten: "_X.", Priority: 4, App: "Set", AppData: "CDR(final_confirmation)=true"},
-        {Exten: "_X.", Priority: 5, App: "AGI", AppData: "agi://localhost:4573/processFinal"},
+        {Exten: "_X.", Priority: 5, App: "AGI", AppData: agivars.AGIURL(AGIBaseURL, agivars.RequestProcessFinal)},
         {Exten: "_X.", Priority: 6, App: "Congestion", AppData: "5"},
         {Exten: "_X.", Priority: 7, App: "Hangup", AppData: ""},
     }
     
-    if err := m.insertExtensions(tx, "from-provider-final", finalExtensions); err != nil {
-        return err
-    }
+    contexts["from-provider-final"] = finalExtensions
     
     // Create hangup handler
     hangupExtensions := []DialplanExtension{
         {Exten: "s", Priority: 1, App: "NoOp", AppData: "Call ended: ${UNIQUEID}"},
         {Exten: "s", Priority: 2, App: "Set", AppData: "CDR(end_time)=${EPOCH}"},
         {Exten: "s", Priority: 3, App: "Set", AppData: "CDR(duration)=${CDR(billsec)}"},
-        {Exten: "s", Priority: 4, App: "AGI", AppData: "agi://localhost:4573/hangup"},
+        {Exten: "s", Priority: 4, App: "AGI", AppData: agivars.AGIURL(AGIBaseURL, agivars.RequestHangup)},
         {Exten: "s", Priority: 5, App: "Return", AppData: ""},
     }
     
-    if err := m.insertExtensions(tx, "hangup-handler", hangupExtensions); err != nil {
-        return err
+    contexts["hangup-handler"] = hangupExtensions
+    
+    // Create pre-dial handler of the outbound channel: carries the correlation
+    // token to S3, sets the caller ID presentation (ARG1) and runs the extra
+    // pre-dial context of the provider or route (ARG2)
+    predialExtensions := []DialplanExtension{
+        {Exten: "s", Priority: 1, App: "ExecIf", AppData: "$[\"${CORRELATION_TOKEN}\" != \"\"]?Set(PJSIP_HEADER(add,X-ARA-Token)=${CORRELATION_TOKEN})"},
+        {Exten: "s", Priority: 2, App: "ExecIf", AppData: "$[\"${ARG1}\" != \"\"]?Set(CALLERID(pres)=${ARG1})"},
+        {Exten: "s", Priority: 3, App: "GotoIf", AppData: "$[\"${ARG2}\" = \"\"]?done"},
+        {Exten: "s", Priority: 4, App: "Gosub", AppData: "${ARG2},s,1"},
+        {Exten: "s", Priority: 5, App: "Return", AppData: "", Label: "done"},
     }
     
-    // Create recording subroutine
-    recordingExtensions := []DialplanExtension{
-        {Exten: "s", Priority: 1, App: "NoOp", AppData: "Starting recording on originated channel"},
+    contexts["sub-predial"] = predialExtensions
+    
+    // Create answer subroutine of the called channel: records it when given a
+    // call ID (ARG1) and runs the extra answer context (ARG2)
+    answerExtensions := []DialplanExtension{
+        {Exten: "s", Priority: 1, App: "GotoIf", AppData: "$[\"${ARG1}\" = \"\"]?extra"},
         {Exten: "s", Priority: 2, App: "Set", AppData: "AUDIOHOOK_INHERIT(MixMonitor)=yes"},
         {Exten: "s", Priority: 3, App: "MixMonitor", AppData: "${ARG1}-out.wav,b"},
-        {Exten: "s", Priority: 4, App: "Return", AppData: ""},
+        {Exten: "s", Priority: 4, App: "GotoIf", AppData: "$[\"${ARG2}\" = \"\"]?done", Label: "extra"},
+        {Exten: "s", Priority: 5, App: "Gosub", AppData: "${ARG2},s,1"},
+        {Exten: "s", Priority: 6, App: "Return", AppData: "", Label: "done"},
     }
     
-    if err := m.insertExtensions(tx, "sub-recording", recordingExtensions); err != nil {
-        return err
+    contexts["sub-answer"] = answerExtensions
+    
+    return contexts
+}
+
+// CreateDialplan creates the complete dialplan in ARA
+func (m *Manager) CreateDialplan(ctx context.Context) error {
+    log := logger.WithContext(ctx)
+    
+    // Refuse to ship a dialplan that drifted from the AGI variable contract
+    contexts := DialplanExtensions()
+    if err := checkDialplanContract(contexts); err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "dialplan violates AGI variable contract")
+    }
+    
+    tx, err := m.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+    
+    // Clear existing extensions
+    for _, context := range append(legacyDialplanContexts, DialplanContexts...) {
+        if _, err := tx.ExecContext(ctx, "DELETE FROM extensions WHERE context = ?", context); err != nil {
+            log.WithError(err).Warn("Failed to clear context")
+        }
+    }
+    
+    for _, context := range DialplanContexts {
+        if err := m.insertExtensions(tx, context, contexts[context]); err != nil {
+            return err
+        }
     }
     
     if err := tx.Commit(); err != nil {
@@ -329,7 +514,7 @@ func (m *Manager) CreateDialplan(ctx context.Context) error {
     }
     
     // Clear dialplan cache
-    m.cache.Delete(ctx, "dialplan:*")
+    m.cache.Invalidate(ctx, "dialplan:*")
     
     log.Info("Dialplan created successfully in ARA")
     return nil
@@ -0,0 +1,62 @@
+package audit
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "os"
+    
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// Execer is satisfied by *sql.DB and *sql.Tx so entries can join a transaction
+type Execer interface {
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Entry is one row of audit_log
+type Entry struct {
+    EventType  string
+    EntityType string
+    EntityID   string
+    UserID     string
+    Action     string
+    OldValue   interface{}
+    NewValue   interface{}
+    Metadata   map[string]interface{}
+}
+
+// Record writes an audit entry
+func Record(ctx context.Context, db Execer, entry Entry) error {
+    _, err := db.ExecContext(ctx, `
+        INSERT INTO audit_log (event_type, entity_type, entity_id, user_id, action, old_value, new_value, metadata)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+        entry.EventType, entry.EntityType, entry.EntityID, entry.UserID, entry.Action,
+        jsonValue(entry.OldValue), jsonValue(entry.NewValue), jsonValue(entry.Metadata))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to write audit entry")
+    }
+    return nil
+}
+
+// CurrentUser names the operator running a CLI command
+func CurrentUser() string {
+    if user := os.Getenv("USER"); user != "" {
+        return user
+    }
+    return "cli"
+}
+
+func jsonValue(v interface{}) interface{} {
+    if v == nil {
+        return nil
+    }
+    if m, ok := v.(map[string]interface{}); ok && len(m) == 0 {
+        return nil
+    }
+    data, err := json.Marshal(v)
+    if err != nil {
+        return nil
+    }
+    return data
+}
@@ -0,0 +1,42 @@
+package audit
+
+import (
+    "context"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// SystemActor is the actor of events the router triggers on its own
+const SystemActor = "router"
+
+// ProviderEventInsert stores a provider event from its provider name, type,
+// actor and detail; hot paths queue it on their write-behind writer
+const ProviderEventInsert = `
+    INSERT INTO provider_events (provider_name, event_type, actor, detail)
+    VALUES (?, ?, ?, ?)`
+
+// RecordProviderEvent adds an event to a provider's timeline
+func RecordProviderEvent(ctx context.Context, db Execer, event models.ProviderEvent) error {
+    _, err := db.ExecContext(ctx, ProviderEventInsert,
+        event.ProviderName, event.EventType, nullable(event.Actor), nullable(truncate(event.Detail, 255)))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to record provider event").
+            WithContext("provider", event.ProviderName)
+    }
+    return nil
+}
+
+func nullable(s string) interface{} {
+    if s == "" {
+        return nil
+    }
+    return s
+}
+
+func truncate(s string, max int) string {
+    if len(s) <= max {
+        return s
+    }
+    return s[:max]
+}
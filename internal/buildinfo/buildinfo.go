@@ -0,0 +1,80 @@
+// Package buildinfo describes the router binary a deployment runs, so support
+// can tell exactly which build, schema and Asterisk versions it belongs to.
+package buildinfo
+
+import (
+    "runtime"
+    "runtime/debug"
+)
+
+// Set at build time, see the Makefile LDFLAGS
+var (
+    Version   = "dev"
+    Commit    = ""
+    BuildTime = ""
+)
+
+// Asterisk releases the dialplan, AGI variables and realtime schema the router
+// generates are supported on
+const (
+    MinAsteriskVersion = "18"
+    MaxAsteriskVersion = "22"
+)
+
+// AsteriskRange is the supported range of Asterisk major versions
+type AsteriskRange struct {
+    Min string `json:"min"`
+    Max string `json:"max"`
+}
+
+// Info is what a build and its deployment run
+type Info struct {
+    Version          string          `json:"version"`
+    Commit           string          `json:"commit"`
+    Modified         bool            `json:"modified,omitempty"` // built from a dirty tree
+    BuildTime        string          `json:"build_time"`
+    GoVersion        string          `json:"go_version"`
+    Platform         string          `json:"platform"`
+    SchemaHash       string          `json:"schema_hash"`
+    MigrationVersion uint            `json:"migration_version"`
+    Asterisk         AsteriskRange   `json:"asterisk"`
+    Subsystems       map[string]bool `json:"subsystems,omitempty"`
+}
+
+// Get returns the build's own information. Commit and build time fall back to
+// the VCS stamp go build embeds when the binary wasn't built with LDFLAGS.
+func Get() Info {
+    info := Info{
+        Version:   Version,
+        Commit:    Commit,
+        BuildTime: BuildTime,
+        GoVersion: runtime.Version(),
+        Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+        Asterisk:  AsteriskRange{Min: MinAsteriskVersion, Max: MaxAsteriskVersion},
+    }
+    
+    if build, ok := debug.ReadBuildInfo(); ok {
+        for _, s := range build.Settings {
+            switch s.Key {
+            case "vcs.revision":
+                if info.Commit == "" {
+                    info.Commit = s.Value
+                }
+            case "vcs.time":
+                if info.BuildTime == "" {
+                    info.BuildTime = s.Value
+                }
+            case "vcs.modified":
+                info.Modified = s.Value == "true"
+            }
+        }
+    }
+    
+    if info.Commit == "" {
+        info.Commit = "unknown"
+    }
+    if info.BuildTime == "" {
+        info.BuildTime = "unknown"
+    }
+    return info
+}
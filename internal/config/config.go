@@ -95,6 +95,18 @@ type AMIConfig struct {
     ActionTimeout       time.Duration `mapstructure:"action_timeout"`
     ConnectTimeout      time.Duration `mapstructure:"connect_timeout"`
     EventBufferSize     int           `mapstructure:"event_buffer_size"`
+    TLS                 AMITLSConfig  `mapstructure:"tls"`
+}
+
+// AMITLSConfig holds the settings of AMI over TLS (tlsenable in manager.conf)
+type AMITLSConfig struct {
+    Enabled            bool   `mapstructure:"enabled"`
+    CAFile             string `mapstructure:"ca_file"`
+    CertFile           string `mapstructure:"cert_file"`
+    KeyFile            string `mapstructure:"key_file"`
+    ServerName         string `mapstructure:"server_name"`
+    InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+    MinVersion         string `mapstructure:"min_version"`
 }
 
 // ARAConfig holds Asterisk Realtime Architecture configuration
@@ -4,9 +4,12 @@ import (
     "context"
     "encoding/json"
     "fmt"
+    "os"
+    "sync"
     "time"
     
     "github.com/go-redis/redis/v8"
+    "github.com/hamzaKhattat/ara-production-system/internal/faults"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
     "github.com/hamzaKhattat/ara-production-system/pkg/errors"
 )
@@ -24,10 +27,35 @@ type CacheConfig struct {
 type Cache struct {
     client *redis.Client
     prefix string
+    origin string // tells this process's invalidations apart from other nodes'
+    
+    mu       sync.RWMutex
+    handlers []func(keys []string)
+    
+    versionMu sync.RWMutex
+    versions  map[string]namespaceVersion
+}
+
+// invalidationChannel carries the keys of configuration changes to every node
+const invalidationChannel = "invalidate"
+
+// invalidation is a message on the invalidation channel
+type invalidation struct {
+    Origin string   `json:"origin"`
+    Keys   []string `json:"keys"`
 }
 
 var (
     cacheInstance *Cache
+    
+    // noCache stands in for Redis when it isn't connected
+    noCache = &Cache{origin: cacheOrigin()}
+    
+    // ErrCacheMiss is returned by Get when the value could not be served from cache
+    ErrCacheMiss = errors.New(errors.ErrRedis, "cache miss")
+    
+    // ErrCacheConflict is returned by Update when other writers kept changing the key
+    ErrCacheConflict = errors.New(errors.ErrRedis, "cache key changed concurrently")
 )
 
 func InitializeCache(cfg CacheConfig, prefix string) error {
@@ -50,44 +78,65 @@ func InitializeCache(cfg CacheConfig, prefix string) error {
     cacheInstance = &Cache{
         client: client,
         prefix: prefix,
+        origin: cacheOrigin(),
     }
     
     logger.Info("Redis cache initialized")
     return nil
 }
 
+// ProbeCache checks that Redis answers a ping with cfg
+func ProbeCache(ctx context.Context, cfg CacheConfig) error {
+    client := redis.NewClient(&redis.Options{
+        Addr:       fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+        Password:   cfg.Password,
+        DB:         cfg.DB,
+        PoolSize:   1,
+        MaxRetries: -1,
+    })
+    defer client.Close()
+    
+    if err := client.Ping(ctx).Err(); err != nil {
+        return errors.Wrap(err, errors.ErrRedis, "failed to connect to Redis")
+    }
+    return nil
+}
+
 func GetCache() *Cache {
     if cacheInstance == nil {
         // Return nil cache that doesn't error
-        return &Cache{}
+        return noCache
     }
     return cacheInstance
 }
 
 func (c *Cache) key(k string) string {
     if c.prefix != "" {
-        return fmt.Sprintf("%s:%s", c.prefix, k)
+        return c.prefix + ":" + k
     }
     return k
 }
 
 func (c *Cache) Get(ctx context.Context, key string, dest interface{}) error {
     if c.client == nil {
-        return nil // Cache miss
+        return ErrCacheMiss
     }
     
-    val, err := c.client.Get(ctx, c.key(key)).Result()
+    val, err := c.client.Get(ctx, c.entryKey(ctx, key)).Result()
+    err = c.redisFault(err)
+    c.countLookup(key, err == nil)
     if err == redis.Nil {
-        return nil // Cache miss
+        return ErrCacheMiss
     }
     if err != nil {
+        // Degrade to a miss so callers fall back to the database
         logger.WithContext(ctx).WithField("key", key).WithField("error", err.Error()).Warn("Cache get failed")
-        return nil // Don't fail on cache errors
+        return ErrCacheMiss
     }
     
     if err := json.Unmarshal([]byte(val), dest); err != nil {
         logger.WithContext(ctx).WithField("key", key).WithField("error", err.Error()).Warn("Cache unmarshal failed")
-        return nil
+        return ErrCacheMiss
     }
     
     return nil
@@ -103,7 +152,7 @@ func (c *Cache) Set(ctx context.Context, key string, value interface{}, expirati
         return nil // Don't fail on cache errors
     }
     
-    if err := c.client.Set(ctx, c.key(key), data, expiration).Err(); err != nil {
+    if err := c.redisFault(c.client.Set(ctx, c.entryKey(ctx, key), data, expiration).Err()); err != nil {
         logger.WithContext(ctx).WithField("key", key).WithField("error", err.Error()).Warn("Cache set failed")
     }
     
@@ -117,16 +166,231 @@ func (c *Cache) Delete(ctx context.Context, keys ...string) error {
     
     fullKeys := make([]string, len(keys))
     for i, k := range keys {
-        fullKeys[i] = c.key(k)
+        fullKeys[i] = c.entryKey(ctx, k)
     }
     
-    if err := c.client.Del(ctx, fullKeys...).Err(); err != nil {
+    if err := c.redisFault(c.client.Del(ctx, fullKeys...).Err()); err != nil {
         logger.WithContext(ctx).WithField("error", err.Error()).Warn("Cache delete failed")
     }
     
     return nil
 }
 
+// Invalidate deletes keys after a configuration change and tells every node,
+// this one included, to drop what it holds in process for them
+func (c *Cache) Invalidate(ctx context.Context, keys ...string) error {
+    c.Delete(ctx, keys...)
+    c.notify(keys)
+    
+    if c.client == nil {
+        return nil
+    }
+    
+    data, _ := json.Marshal(invalidation{Origin: c.origin, Keys: keys})
+    if err := c.redisFault(c.client.Publish(ctx, c.key(invalidationChannel), data).Err()); err != nil {
+        // Other nodes catch up when their in-process entries expire
+        logger.WithContext(ctx).WithField("keys", keys).WithField("error", err.Error()).Warn("Cache invalidation publish failed")
+    }
+    
+    return nil
+}
+
+// OnInvalidate registers fn to run with the keys of every invalidation
+func (c *Cache) OnInvalidate(fn func(keys []string)) {
+    c.mu.Lock()
+    c.handlers = append(c.handlers, fn)
+    c.mu.Unlock()
+}
+
+// SubscribeInvalidations runs the OnInvalidate handlers for invalidations
+// published by other processes until ctx is done. Messages sent while Redis
+// is unreachable are lost, in-process entries then expire on their own.
+func (c *Cache) SubscribeInvalidations(ctx context.Context) {
+    if c.client == nil {
+        return
+    }
+    
+    pubsub := c.client.Subscribe(ctx, c.key(invalidationChannel))
+    defer pubsub.Close()
+    
+    messages := pubsub.Channel()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case msg, ok := <-messages:
+            if !ok {
+                return
+            }
+            var inv invalidation
+            if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+                logger.WithField("error", err.Error()).Warn("Invalid cache invalidation message")
+                continue
+            }
+            if inv.Origin == c.origin {
+                continue
+            }
+            logger.WithField("keys", inv.Keys).WithField("origin", inv.Origin).Debug("Cache invalidated by another node")
+            c.reloadFlushed(ctx, inv.Keys)
+            c.notify(inv.Keys)
+        }
+    }
+}
+
+func (c *Cache) notify(keys []string) {
+    c.mu.RLock()
+    handlers := c.handlers
+    c.mu.RUnlock()
+    
+    for _, fn := range handlers {
+        fn(keys)
+    }
+}
+
+// cacheOrigin identifies this process among the nodes sharing Redis
+func cacheOrigin() string {
+    host, _ := os.Hostname()
+    return fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
+// Ping checks the Redis connection, failing when the cache runs without Redis
+func (c *Cache) Ping(ctx context.Context) (time.Duration, error) {
+    if c.client == nil {
+        return 0, errors.New(errors.ErrRedis, "Redis not connected, caching disabled")
+    }
+    
+    start := time.Now()
+    if err := c.redisFault(c.client.Ping(ctx).Err()); err != nil {
+        return 0, errors.Wrap(err, errors.ErrRedis, "Redis ping failed")
+    }
+    return time.Since(start), nil
+}
+
+// HashSet stores one field of a Redis hash, the whole hash expires ttl after
+// its last write
+func (c *Cache) HashSet(ctx context.Context, key, field, value string, ttl time.Duration) error {
+    if c.client == nil {
+        return errors.New(errors.ErrRedis, "Redis not connected")
+    }
+    
+    fullKey := c.key(key)
+    pipe := c.client.TxPipeline()
+    pipe.HSet(ctx, fullKey, field, value)
+    pipe.Expire(ctx, fullKey, ttl)
+    _, err := pipe.Exec(ctx)
+    if err := c.redisFault(err); err != nil {
+        return errors.Wrap(err, errors.ErrRedis, "failed to set hash field")
+    }
+    return nil
+}
+
+// HashGetAll returns every field of a Redis hash
+func (c *Cache) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+    if c.client == nil {
+        return nil, errors.New(errors.ErrRedis, "Redis not connected")
+    }
+    
+    fields, err := c.client.HGetAll(ctx, c.key(key)).Result()
+    if err := c.redisFault(err); err != nil {
+        return nil, errors.Wrap(err, errors.ErrRedis, "failed to read hash")
+    }
+    return fields, nil
+}
+
+// HashDelete removes fields of a Redis hash
+func (c *Cache) HashDelete(ctx context.Context, key string, fields ...string) error {
+    if c.client == nil {
+        return nil
+    }
+    
+    if err := c.redisFault(c.client.HDel(ctx, c.key(key), fields...).Err()); err != nil {
+        return errors.Wrap(err, errors.ErrRedis, "failed to delete hash fields")
+    }
+    return nil
+}
+
+// Update changes a key with optimistic locking: fn gets the current value, nil
+// when the key is missing, and returns the new one, nil to delete the key. The
+// value is written only if no one else wrote the key in between, otherwise fn
+// runs again on the new value, up to retries more times. An error from fn
+// aborts the update and is returned as is.
+func (c *Cache) Update(ctx context.Context, key string, ttl time.Duration, retries int, fn func(current []byte) ([]byte, error)) error {
+    if c.client == nil {
+        return errors.New(errors.ErrRedis, "Redis not connected")
+    }
+    
+    fullKey := c.key(key)
+    for attempt := 0; attempt <= retries; attempt++ {
+        var fnErr error
+        err := c.client.Watch(ctx, func(tx *redis.Tx) error {
+            current, err := tx.Get(ctx, fullKey).Bytes()
+            if err != nil && err != redis.Nil {
+                return err
+            }
+    
+            var next []byte
+            if next, fnErr = fn(current); fnErr != nil {
+                return fnErr
+            }
+    
+            _, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+                if next == nil {
+                    pipe.Del(ctx, fullKey)
+                } else {
+                    pipe.Set(ctx, fullKey, next, ttl)
+                }
+                return nil
+            })
+            return err
+        }, fullKey)
+        if fnErr != nil {
+            return fnErr
+        }
+        if err == redis.TxFailedErr {
+            continue
+        }
+        if err := c.redisFault(err); err != nil {
+            return errors.Wrap(err, errors.ErrRedis, "failed to update key")
+        }
+        return nil
+    }
+    return ErrCacheConflict
+}
+
+// Exists reports which of the keys are set
+func (c *Cache) Exists(ctx context.Context, keys ...string) ([]bool, error) {
+    if c.client == nil {
+        return nil, errors.New(errors.ErrRedis, "Redis not connected")
+    }
+    if len(keys) == 0 {
+        return nil, nil
+    }
+    
+    pipe := c.client.Pipeline()
+    results := make([]*redis.IntCmd, len(keys))
+    for i, k := range keys {
+        results[i] = pipe.Exists(ctx, c.key(k))
+    }
+    _, err := pipe.Exec(ctx)
+    if err := c.redisFault(err); err != nil {
+        return nil, errors.Wrap(err, errors.ErrRedis, "failed to check keys")
+    }
+    
+    exists := make([]bool, len(keys))
+    for i, result := range results {
+        exists[i] = result.Val() > 0
+    }
+    return exists, nil
+}
+
+// redisFault replaces a successful result with an injected Redis error
+func (c *Cache) redisFault(err error) error {
+    if err != nil {
+        return err
+    }
+    return faults.Get().Error(faults.RedisError)
+}
+
 // Distributed lock
 func (c *Cache) Lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
     if c.client == nil {
@@ -137,6 +401,7 @@ func (c *Cache) Lock(ctx context.Context, key string, ttl time.Duration) (func()
     value := fmt.Sprintf("%d", time.Now().UnixNano())
     
     ok, err := c.client.SetNX(ctx, lockKey, value, ttl).Result()
+    err = c.redisFault(err)
     if err != nil {
         return nil, errors.Wrap(err, errors.ErrRedis, "failed to acquire lock")
     }
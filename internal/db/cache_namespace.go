@@ -0,0 +1,199 @@
+package db
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+    
+    "github.com/go-redis/redis/v8"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// CacheNamespaces are the classes of cached entries, the first segment of
+// their keys. Each has a version in Redis that is part of its entries' keys,
+// bumping it invalidates the whole class at once.
+var CacheNamespaces = []string{
+    "provider", "providers", "group", "groups", "route", "dial", "dispositions", "did", "endpoint", "dialplan",
+}
+
+// versionRefresh bounds how long a node keeps using a namespace version after
+// a flush whose invalidation message it missed
+const versionRefresh = 10 * time.Second
+
+type namespaceVersion struct {
+    version int64
+    loaded  time.Time
+}
+
+// namespaceStats counts lookups of one namespace for its hit ratio
+type namespaceStats struct {
+    hits   int64
+    misses int64
+}
+
+var (
+    cacheNamespaceSet = make(map[string]bool)
+    cacheStats        = make(map[string]*namespaceStats)
+)
+
+func init() {
+    for _, ns := range CacheNamespaces {
+        cacheNamespaceSet[ns] = true
+        cacheStats[ns] = &namespaceStats{}
+    }
+}
+
+// namespaceOf returns the namespace of a key, empty for keys outside them
+// like locks and the drift hash
+func namespaceOf(key string) string {
+    ns := key
+    if i := strings.IndexByte(key, ':'); i >= 0 {
+        ns = key[:i]
+    }
+    if cacheNamespaceSet[ns] {
+        return ns
+    }
+    return ""
+}
+
+// entryKey is the Redis key of a cached entry, including the version of its
+// namespace once that was bumped
+func (c *Cache) entryKey(ctx context.Context, key string) string {
+    ns := namespaceOf(key)
+    if ns == "" {
+        return c.key(key)
+    }
+    
+    version := c.namespaceVersion(ctx, ns)
+    if version == 0 {
+        return c.key(key)
+    }
+    return c.key(fmt.Sprintf("%s@%d%s", ns, version, key[len(ns):]))
+}
+
+func (c *Cache) namespaceVersion(ctx context.Context, ns string) int64 {
+    c.versionMu.RLock()
+    v, ok := c.versions[ns]
+    c.versionMu.RUnlock()
+    if ok && time.Since(v.loaded) < versionRefresh {
+        return v.version
+    }
+    
+    return c.loadNamespaceVersion(ctx, ns, v.version)
+}
+
+// loadNamespaceVersion reads the version of a namespace from Redis, keeping
+// the last one known while Redis is unreachable
+func (c *Cache) loadNamespaceVersion(ctx context.Context, ns string, fallback int64) int64 {
+    version := fallback
+    val, err := c.client.Get(ctx, c.key("version:"+ns)).Result()
+    switch {
+    case err == redis.Nil:
+        version = 0
+    case err == nil:
+        version, _ = strconv.ParseInt(val, 10, 64)
+    default:
+        logger.WithContext(ctx).WithField("namespace", ns).WithField("error", err.Error()).Warn("Cache namespace version read failed")
+    }
+    
+    c.versionMu.Lock()
+    if c.versions == nil {
+        c.versions = make(map[string]namespaceVersion)
+    }
+    c.versions[ns] = namespaceVersion{version: version, loaded: time.Now()}
+    c.versionMu.Unlock()
+    return version
+}
+
+// Flush invalidates every entry of the given namespaces, all of them without
+// any, on every node. Entries of the older version expire with their TTL.
+func (c *Cache) Flush(ctx context.Context, namespaces ...string) ([]string, error) {
+    if len(namespaces) == 0 {
+        namespaces = CacheNamespaces
+    }
+    for _, ns := range namespaces {
+        if !cacheNamespaceSet[ns] {
+            return nil, errors.New(errors.ErrConfiguration, "unknown cache namespace").
+                WithContext("namespace", ns).
+                WithContext("namespaces", strings.Join(CacheNamespaces, ", "))
+        }
+    }
+    
+    keys := make([]string, len(namespaces))
+    for i, ns := range namespaces {
+        keys[i] = ns + ":*"
+    }
+    
+    if c.client == nil {
+        c.notify(keys)
+        return namespaces, nil
+    }
+    
+    pipe := c.client.TxPipeline()
+    versions := make([]*redis.IntCmd, len(namespaces))
+    for i, ns := range namespaces {
+        versions[i] = pipe.Incr(ctx, c.key("version:"+ns))
+    }
+    if _, err := pipe.Exec(ctx); err != nil {
+        return nil, errors.Wrap(err, errors.ErrRedis, "failed to bump cache namespace versions")
+    }
+    
+    c.versionMu.Lock()
+    if c.versions == nil {
+        c.versions = make(map[string]namespaceVersion)
+    }
+    for i, ns := range namespaces {
+        c.versions[ns] = namespaceVersion{version: versions[i].Val(), loaded: time.Now()}
+    }
+    c.versionMu.Unlock()
+    
+    // Other nodes reload the versions and drop what they hold in process
+    c.Invalidate(ctx, keys...)
+    
+    logger.WithContext(ctx).WithField("namespaces", namespaces).Info("Cache namespaces flushed")
+    return namespaces, nil
+}
+
+// reloadFlushed rereads the version of namespaces another node flushed
+func (c *Cache) reloadFlushed(ctx context.Context, keys []string) {
+    for _, key := range keys {
+        if ns := strings.TrimSuffix(key, ":*"); ns != key && cacheNamespaceSet[ns] {
+            c.versionMu.RLock()
+            known := c.versions[ns].version
+            c.versionMu.RUnlock()
+            c.loadNamespaceVersion(ctx, ns, known)
+        }
+    }
+}
+
+// countLookup records a Get of a key as a hit or a miss of its namespace
+func (c *Cache) countLookup(key string, hit bool) {
+    ns := namespaceOf(key)
+    if ns == "" {
+        return
+    }
+    
+    stats := cacheStats[ns]
+    result := "miss"
+    if hit {
+        result = "hit"
+        atomic.AddInt64(&stats.hits, 1)
+    } else {
+        atomic.AddInt64(&stats.misses, 1)
+    }
+    
+    retryMu.RLock()
+    m := metrics
+    retryMu.RUnlock()
+    if m == nil {
+        return
+    }
+    
+    hits, misses := atomic.LoadInt64(&stats.hits), atomic.LoadInt64(&stats.misses)
+    m.IncrementCounter("cache_requests", map[string]string{"namespace": ns, "result": result})
+    m.SetGauge("cache_hit_ratio", float64(hits)/float64(hits+misses), map[string]string{"namespace": ns})
+}
@@ -4,27 +4,29 @@ import (
     "context"
     "database/sql"
     "fmt"
-    "strings"
     "sync"
     "time"
     
     _ "github.com/go-sql-driver/mysql"
+    "github.com/hamzaKhattat/ara-production-system/internal/faults"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
     "github.com/hamzaKhattat/ara-production-system/pkg/errors"
 )
 
 type Config struct {
-    Driver           string
-    Host             string
-    Port             int
-    Username         string
-    Password         string
-    Database         string
-    MaxOpenConns     int
-    MaxIdleConns     int
-    ConnMaxLifetime  time.Duration
-    RetryAttempts    int
-    RetryDelay       time.Duration
+    Driver             string
+    Host               string
+    Port               int
+    Username           string
+    Password           string
+    Database           string
+    MaxOpenConns       int
+    MaxIdleConns       int
+    ConnMaxLifetime    time.Duration
+    RetryAttempts      int
+    RetryDelay         time.Duration
+    QueryRetryDelay    time.Duration // first backoff of statement and transaction retries
+    QueryRetryMaxDelay time.Duration
 }
 
 type DB struct {
@@ -54,16 +56,40 @@ func GetDB() *DB {
     return instance
 }
 
-func newDB(cfg Config) (*DB, error) {
-    dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&multiStatements=true&interpolateParams=true",
+// Probe checks that the database takes connections with cfg, without
+// retrying or keeping the connection
+func Probe(ctx context.Context, cfg Config) error {
+    conn, err := sql.Open(cfg.Driver, cfg.dsn())
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to open database")
+    }
+    defer conn.Close()
+    
+    if err := conn.PingContext(ctx); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to connect to database")
+    }
+    return nil
+}
+
+func (cfg Config) dsn() string {
+    return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&multiStatements=true&interpolateParams=true",
         cfg.Username, cfg.Password, cfg.Host, cfg.Port, cfg.Database)
+}
+
+func newDB(cfg Config) (*DB, error) {
+    dsn := cfg.dsn()
     
     var db *sql.DB
     var err error
     
+    driverName := cfg.Driver
+    if driverName == "mysql" && faults.Get().Enabled() {
+        driverName = faultDriverName
+    }
+    
     // Retry connection
     for i := 0; i <= cfg.RetryAttempts; i++ {
-        db, err = sql.Open(cfg.Driver, dsn)
+        db, err = sql.Open(driverName, dsn)
         if err == nil {
             err = db.Ping()
             if err == nil {
@@ -81,6 +107,12 @@ func newDB(cfg Config) (*DB, error) {
         return nil, errors.Wrap(err, errors.ErrDatabase, "failed to connect to database")
     }
     
+    SetRetryPolicy(RetryPolicy{
+        Attempts: cfg.RetryAttempts,
+        Delay:    cfg.QueryRetryDelay,
+        MaxDelay: cfg.QueryRetryMaxDelay,
+    })
+    
     // Configure connection pool
     db.SetMaxOpenConns(cfg.MaxOpenConns)
     db.SetMaxIdleConns(cfg.MaxIdleConns)
@@ -129,76 +161,12 @@ func (db *DB) IsHealthy() bool {
     return db.health
 }
 
-// Transaction with retry
+// Transaction runs fn in a transaction, retried on deadlocks and lock wait timeouts
 func (db *DB) Transaction(ctx context.Context, fn func(*sql.Tx) error) error {
-    var err error
-    for i := 0; i <= db.cfg.RetryAttempts; i++ {
-        err = db.transaction(ctx, fn)
-        if err == nil {
-            return nil
-        }
-        
-        if !isRetryableError(err) {
-            return err
-        }
-        
-        if i < db.cfg.RetryAttempts {
-            select {
-            case <-ctx.Done():
-                return ctx.Err()
-            case <-time.After(db.cfg.RetryDelay * time.Duration(i+1)):
-                logger.WithField("attempt", i+1).WithField("error", err.Error()).Warn("Transaction failed, retrying...")
-            }
-        }
-    }
-    
-    return errors.Wrap(err, errors.ErrDatabase, "transaction failed after retries")
-}
-
-func (db *DB) transaction(ctx context.Context, fn func(*sql.Tx) error) error {
-    tx, err := db.BeginTx(ctx, nil)
-    if err != nil {
-        return err
-    }
-    
-    defer func() {
-        if p := recover(); p != nil {
-            tx.Rollback()
-            panic(p)
-        }
-    }()
-    
-    err = fn(tx)
-    if err != nil {
-        tx.Rollback()
-        return err
+    if err := RetryTx(ctx, db.DB, "transaction", fn); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "transaction failed")
     }
-    
-    return tx.Commit()
-}
-
-func isRetryableError(err error) bool {
-    if err == nil {
-        return false
-    }
-    
-    errStr := err.Error()
-    retryableErrors := []string{
-        "connection refused",
-        "connection reset",
-        "broken pipe",
-        "timeout",
-        "deadlock",
-        "try restarting transaction",
-    }
-    
-    for _, e := range retryableErrors {
-        if strings.Contains(strings.ToLower(errStr), e) {
-            return true
-        }
-    }
-    
-    return false
+    return nil
 }
 
 // Prepared statement cache
@@ -0,0 +1,114 @@
+package db
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    
+    "github.com/go-sql-driver/mysql"
+    "github.com/hamzaKhattat/ara-production-system/internal/faults"
+)
+
+// faultDriverName is the MySQL driver with fault injection hooks
+const faultDriverName = "mysql-faults"
+
+func init() {
+    sql.Register(faultDriverName, &faultDriver{driver: &mysql.MySQLDriver{}})
+}
+
+// faultDriver wraps a driver and delays statements when the db_latency fault fires
+type faultDriver struct {
+    driver driver.Driver
+}
+
+func (d *faultDriver) Open(dsn string) (driver.Conn, error) {
+    faults.Get().Delay(context.Background(), faults.DBLatency)
+    
+    conn, err := d.driver.Open(dsn)
+    if err != nil {
+        return nil, err
+    }
+    return &faultConn{conn: conn}, nil
+}
+
+type faultConn struct {
+    conn driver.Conn
+}
+
+func (c *faultConn) Prepare(query string) (driver.Stmt, error) {
+    return c.conn.Prepare(query)
+}
+
+func (c *faultConn) Close() error {
+    return c.conn.Close()
+}
+
+func (c *faultConn) Begin() (driver.Tx, error) {
+    return c.conn.Begin()
+}
+
+func (c *faultConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+    faults.Get().Delay(ctx, faults.DBLatency)
+    
+    if b, ok := c.conn.(driver.ConnBeginTx); ok {
+        return b.BeginTx(ctx, opts)
+    }
+    return c.conn.Begin()
+}
+
+func (c *faultConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+    faults.Get().Delay(ctx, faults.DBLatency)
+    
+    if p, ok := c.conn.(driver.ConnPrepareContext); ok {
+        return p.PrepareContext(ctx, query)
+    }
+    return c.conn.Prepare(query)
+}
+
+func (c *faultConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+    e, ok := c.conn.(driver.ExecerContext)
+    if !ok {
+        return nil, driver.ErrSkip
+    }
+    
+    faults.Get().Delay(ctx, faults.DBLatency)
+    return e.ExecContext(ctx, query, args)
+}
+
+func (c *faultConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    q, ok := c.conn.(driver.QueryerContext)
+    if !ok {
+        return nil, driver.ErrSkip
+    }
+    
+    faults.Get().Delay(ctx, faults.DBLatency)
+    return q.QueryContext(ctx, query, args)
+}
+
+func (c *faultConn) Ping(ctx context.Context) error {
+    if p, ok := c.conn.(driver.Pinger); ok {
+        return p.Ping(ctx)
+    }
+    return nil
+}
+
+func (c *faultConn) ResetSession(ctx context.Context) error {
+    if r, ok := c.conn.(driver.SessionResetter); ok {
+        return r.ResetSession(ctx)
+    }
+    return nil
+}
+
+func (c *faultConn) IsValid() bool {
+    if v, ok := c.conn.(driver.Validator); ok {
+        return v.IsValid()
+    }
+    return true
+}
+
+func (c *faultConn) CheckNamedValue(nv *driver.NamedValue) error {
+    if n, ok := c.conn.(driver.NamedValueChecker); ok {
+        return n.CheckNamedValue(nv)
+    }
+    return driver.ErrSkip
+}
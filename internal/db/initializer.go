@@ -31,6 +31,18 @@ func InitializeDatabase(ctx context.Context, db *sql.DB, dropExisting bool) erro
         return fmt.Errorf("failed to create ARA tables: %w", err)
     }
     
+    if err := addMissingColumns(ctx, db); err != nil {
+        return fmt.Errorf("failed to upgrade tables: %w", err)
+    }
+    
+    if err := upgradeColumnTypes(ctx, db); err != nil {
+        return fmt.Errorf("failed to upgrade column types: %w", err)
+    }
+    
+    if err := addMissingIndexes(ctx, db); err != nil {
+        return fmt.Errorf("failed to upgrade core indexes: %w", err)
+    }
+    
     if err := createStoredProcedures(ctx, db); err != nil {
         return fmt.Errorf("failed to create stored procedures: %w", err)
     }
@@ -47,40 +59,59 @@ func InitializeDatabase(ctx context.Context, db *sql.DB, dropExisting bool) erro
         return fmt.Errorf("failed to create dialplan: %w", err)
     }
     
+    if err := recordSchemaVersion(ctx, db); err != nil {
+        return fmt.Errorf("failed to record schema version: %w", err)
+    }
+    
     log.Info("Database initialization completed successfully")
     return nil
 }
 
-func dropAllTables(ctx context.Context, db *sql.DB) error {
-    // Disable foreign key checks
-    if _, err := db.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
-        return err
-    }
-    
-    // Get all tables
+// TableRows is a table of the database and its approximate number of rows
+type TableRows struct {
+    Name string
+    Rows int64
+}
+
+// ListTables returns the tables of the database, those a flush drops
+func ListTables(ctx context.Context, db *sql.DB) ([]TableRows, error) {
     rows, err := db.QueryContext(ctx, `
-        SELECT table_name 
+        SELECT table_name, COALESCE(table_rows, 0)
         FROM information_schema.tables 
         WHERE table_schema = DATABASE()
+        ORDER BY table_name
     `)
     if err != nil {
-        return err
+        return nil, err
     }
     defer rows.Close()
     
-    var tables []string
+    var tables []TableRows
     for rows.Next() {
-        var tableName string
-        if err := rows.Scan(&tableName); err != nil {
+        var t TableRows
+        if err := rows.Scan(&t.Name, &t.Rows); err != nil {
             continue
         }
-        tables = append(tables, tableName)
+        tables = append(tables, t)
+    }
+    return tables, rows.Err()
+}
+
+func dropAllTables(ctx context.Context, db *sql.DB) error {
+    // Disable foreign key checks
+    if _, err := db.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+        return err
+    }
+    
+    tables, err := ListTables(ctx, db)
+    if err != nil {
+        return err
     }
     
     // Drop each table
     for _, table := range tables {
-        if _, err := db.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS `%s`", table)); err != nil {
-            logger.WithContext(ctx).WithError(err).WithField("table", table).Warn("Failed to drop table")
+        if _, err := db.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS `%s`", table.Name)); err != nil {
+            logger.WithContext(ctx).WithError(err).WithField("table", table.Name).Warn("Failed to drop table")
         }
     }
     
@@ -103,7 +134,7 @@ func createCoreTables(ctx context.Context, db *sql.DB) error {
             port INT DEFAULT 5060,
             username VARCHAR(100),
             password VARCHAR(100),
-            auth_type ENUM('ip', 'credentials', 'both') DEFAULT 'ip',
+            auth_type ENUM('ip', 'credentials', 'both', 'register') DEFAULT 'ip',
             transport VARCHAR(10) DEFAULT 'udp',
             codecs JSON,
             max_channels INT DEFAULT 0,
@@ -111,6 +142,9 @@ func createCoreTables(ctx context.Context, db *sql.DB) error {
             priority INT DEFAULT 10,
             weight INT DEFAULT 1,
             cost_per_minute DECIMAL(10,4) DEFAULT 0,
+            currency CHAR(3) NULL,
+            min_duration INT DEFAULT 0,
+            billing_increment INT DEFAULT 1,
             active BOOLEAN DEFAULT TRUE,
             health_check_enabled BOOLEAN DEFAULT TRUE,
             last_health_check TIMESTAMP NULL,
@@ -126,6 +160,170 @@ func createCoreTables(ctx context.Context, db *sql.DB) error {
             INDEX idx_priority (priority DESC)
         ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
         
+        // Free-form provider labels
+        `CREATE TABLE IF NOT EXISTS provider_tags (
+            provider_name VARCHAR(100) NOT NULL,
+            tag_key VARCHAR(64) NOT NULL,
+            tag_value VARCHAR(255) NOT NULL DEFAULT '',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (provider_name, tag_key),
+            INDEX idx_tag (tag_key, tag_value),
+            FOREIGN KEY (provider_name) REFERENCES providers(name) ON DELETE CASCADE ON UPDATE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Provider call caps per destination country
+        `CREATE TABLE IF NOT EXISTS provider_country_limits (
+            provider_name VARCHAR(100) NOT NULL,
+            country_code CHAR(2) NOT NULL,
+            max_concurrent INT DEFAULT 0,
+            max_cps DECIMAL(8,2) DEFAULT 0,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            PRIMARY KEY (provider_name, country_code),
+            FOREIGN KEY (provider_name) REFERENCES providers(name) ON DELETE CASCADE ON UPDATE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Contractual caps on the share of short calls per provider
+        `CREATE TABLE IF NOT EXISTS provider_short_call_limits (
+            provider_name VARCHAR(100) PRIMARY KEY,
+            max_ratio DECIMAL(5,2) NOT NULL,
+            action ENUM('alert', 'throttle') DEFAULT 'alert',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            FOREIGN KEY (provider_name) REFERENCES providers(name) ON DELETE CASCADE ON UPDATE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // How the legs towards a provider are dialed, NULL columns use the defaults
+        `CREATE TABLE IF NOT EXISTS provider_dial_options (
+            provider_name VARCHAR(100) PRIMARY KEY,
+            timeout INT NULL,
+            callerid_pres VARCHAR(32) NULL,
+            predial_sub VARCHAR(80) NULL,
+            answer_sub VARCHAR(80) NULL,
+            transport ENUM('udp', 'tcp', 'tls') NULL,
+            early_media ENUM('pass_through', 'block', 'ringback') NULL,
+            max_attempts INT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            FOREIGN KEY (provider_name) REFERENCES providers(name) ON DELETE CASCADE ON UPDATE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Provider lifecycle timeline, kept after the provider is deleted
+        `CREATE TABLE IF NOT EXISTS provider_events (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            provider_name VARCHAR(100) NOT NULL,
+            event_type VARCHAR(32) NOT NULL,
+            actor VARCHAR(100) NULL,
+            detail VARCHAR(255) NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_provider_time (provider_name, created_at),
+            INDEX idx_type_time (event_type, created_at),
+            INDEX idx_created (created_at)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Alerts grouped by kind, open_key holds the kind while the incident is
+        // open so nodes raising the same alert join one incident
+        `CREATE TABLE IF NOT EXISTS incidents (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            kind VARCHAR(50) NOT NULL,
+            open_key VARCHAR(50) NULL,
+            title VARCHAR(255) NOT NULL,
+            severity VARCHAR(20) NOT NULL,
+            alert_count INT NOT NULL DEFAULT 0,
+            started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            last_alert_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            resolved_at TIMESTAMP NULL,
+            resolved_by VARCHAR(100) NULL,
+            UNIQUE KEY uk_open (open_key),
+            INDEX idx_kind_resolved (kind, resolved_at),
+            INDEX idx_started (started_at)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        `CREATE TABLE IF NOT EXISTS incident_alerts (
+            incident_id BIGINT NOT NULL,
+            alert_key VARCHAR(200) NOT NULL,
+            kind VARCHAR(50) NOT NULL,
+            entity VARCHAR(100) NOT NULL,
+            severity VARCHAR(20) NOT NULL,
+            message VARCHAR(255) NULL,
+            count INT NOT NULL DEFAULT 1,
+            first_seen TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            last_seen TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            resolved_at TIMESTAMP NULL,
+            PRIMARY KEY (incident_id, alert_key),
+            INDEX idx_unresolved (resolved_at, last_seen),
+            FOREIGN KEY (incident_id) REFERENCES incidents(id) ON DELETE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Blocked destination prefixes and countries
+        `CREATE TABLE IF NOT EXISTS destination_blocks (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            scope ENUM('global', 'customer', 'route') NOT NULL DEFAULT 'global',
+            scope_value VARCHAR(100) NOT NULL DEFAULT '',
+            match_type ENUM('prefix', 'country') NOT NULL DEFAULT 'prefix',
+            pattern VARCHAR(32) NOT NULL,
+            reason VARCHAR(255),
+            created_by VARCHAR(100),
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE KEY uk_block (scope, scope_value, match_type, pattern)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Temporary unblocks of destination blocks
+        `CREATE TABLE IF NOT EXISTS destination_block_overrides (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            block_id BIGINT NOT NULL,
+            reason VARCHAR(255),
+            created_by VARCHAR(100),
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            expires_at TIMESTAMP NOT NULL,
+            INDEX idx_block_expires (block_id, expires_at),
+            FOREIGN KEY (block_id) REFERENCES destination_blocks(id) ON DELETE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Emergency stops of new inbound calls
+        `CREATE TABLE IF NOT EXISTS kill_switches (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            scope ENUM('global', 'customer', 'route') NOT NULL DEFAULT 'global',
+            scope_value VARCHAR(100) NOT NULL DEFAULT '',
+            reason VARCHAR(255),
+            engaged_by VARCHAR(100),
+            engaged_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            expires_at TIMESTAMP NULL,
+            UNIQUE KEY uk_scope (scope, scope_value)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Management plane freeze, a single row
+        `CREATE TABLE IF NOT EXISTS read_only_mode (
+            id TINYINT PRIMARY KEY,
+            enabled BOOLEAN NOT NULL DEFAULT FALSE,
+            reason VARCHAR(255) NULL,
+            set_by VARCHAR(100) NULL,
+            set_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Stretches the router took no new calls, once they are over
+        `CREATE TABLE IF NOT EXISTS system_downtime (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            cause VARCHAR(50) NOT NULL,
+            entity VARCHAR(100) NOT NULL DEFAULT '',
+            reason VARCHAR(255) NULL,
+            started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            ended_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_started (started_at)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Provider SIP credential rotations and their overlap windows
+        `CREATE TABLE IF NOT EXISTS credential_rotations (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            provider_name VARCHAR(100) NOT NULL,
+            rotated_by VARCHAR(100),
+            rotated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            overlap_until TIMESTAMP NULL,
+            previous_expired_at TIMESTAMP NULL,
+            INDEX idx_provider (provider_name),
+            INDEX idx_pending (previous_expired_at, overlap_until)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
         // DIDs table
         `CREATE TABLE IF NOT EXISTS dids (
             id BIGINT AUTO_INCREMENT PRIMARY KEY,
@@ -138,17 +336,25 @@ func createCoreTables(ctx context.Context, db *sql.DB) error {
             released_at TIMESTAMP NULL,
             last_used_at TIMESTAMP NULL,
             usage_count BIGINT DEFAULT 0,
+            last_allocated_at TIMESTAMP(6) NULL,
+            hour_allocations INT DEFAULT 0,
+            hour_started_at TIMESTAMP NULL,
             country VARCHAR(50),
             city VARCHAR(100),
             rate_center VARCHAR(100),
             monthly_cost DECIMAL(10,2) DEFAULT 0,
             per_minute_cost DECIMAL(10,4) DEFAULT 0,
+            currency CHAR(3) NULL,
+            is_test BOOLEAN DEFAULT FALSE,
+            quarantined_until TIMESTAMP NULL,
             metadata JSON,
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
             updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
             INDEX idx_in_use (in_use),
             INDEX idx_provider (provider_name),
             INDEX idx_last_used (last_used_at),
+            INDEX idx_last_allocated (last_allocated_at),
+            INDEX idx_country_cost (country, in_use, per_minute_cost),
             FOREIGN KEY (provider_id) REFERENCES providers(id) ON DELETE SET NULL
         ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
         
@@ -191,6 +397,17 @@ func createCoreTables(ctx context.Context, db *sql.DB) error {
             FOREIGN KEY (group_id) REFERENCES provider_groups(id) ON DELETE CASCADE,
             FOREIGN KEY (provider_id) REFERENCES providers(id) ON DELETE CASCADE
         ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Groups nested in other groups, whose members include their providers
+        `CREATE TABLE IF NOT EXISTS provider_group_children (
+            parent_group_id INT NOT NULL,
+            child_group_id INT NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (parent_group_id, child_group_id),
+            INDEX idx_child (child_group_id),
+            FOREIGN KEY (parent_group_id) REFERENCES provider_groups(id) ON DELETE CASCADE,
+            FOREIGN KEY (child_group_id) REFERENCES provider_groups(id) ON DELETE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
         
         // Provider routes with group support
         `CREATE TABLE IF NOT EXISTS provider_routes (
@@ -203,20 +420,122 @@ func createCoreTables(ctx context.Context, db *sql.DB) error {
             inbound_is_group BOOLEAN DEFAULT FALSE,
             intermediate_is_group BOOLEAN DEFAULT FALSE,
             final_is_group BOOLEAN DEFAULT FALSE,
+            inbound_match ENUM('exact', 'prefix', 'regex') DEFAULT 'exact',
             load_balance_mode ENUM('round_robin', 'weighted', 'priority', 'failover', 'least_connections', 'response_time', 'hash') DEFAULT 'round_robin',
             priority INT DEFAULT 0,
             weight INT DEFAULT 1,
             max_concurrent_calls INT DEFAULT 0,
             current_calls INT DEFAULT 0,
             enabled BOOLEAN DEFAULT TRUE,
+            is_test BOOLEAN DEFAULT FALSE,
             failover_routes JSON,
             routing_rules JSON,
             metadata JSON,
+            policy_name VARCHAR(100),
+            verification_enabled BOOLEAN NULL,
+            strict_mode BOOLEAN NULL,
+            manipulations JSON,
+            dial_options JSON,
+            queue_timeout INT NULL,
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
             updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
             INDEX idx_inbound (inbound_provider),
             INDEX idx_enabled (enabled),
-            INDEX idx_priority (priority DESC)
+            INDEX idx_priority (priority DESC),
+            INDEX idx_policy (policy_name)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Shared route policies, NULL columns are inherited from the global config
+        `CREATE TABLE IF NOT EXISTS route_policies (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            name VARCHAR(100) UNIQUE NOT NULL,
+            description TEXT,
+            load_balance_mode ENUM('round_robin', 'weighted', 'priority', 'failover', 'least_connections', 'response_time', 'hash') NULL,
+            max_concurrent_calls INT NULL,
+            verification_enabled BOOLEAN NULL,
+            strict_mode BOOLEAN NULL,
+            manipulations JSON,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Hourly weights of providers on routes, applied by the weight curve scheduler
+        `CREATE TABLE IF NOT EXISTS route_weight_curves (
+            route_name VARCHAR(100) NOT NULL,
+            provider_name VARCHAR(100) NOT NULL,
+            weights JSON NOT NULL,
+            timezone VARCHAR(64) NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            PRIMARY KEY (route_name, provider_name),
+            FOREIGN KEY (route_name) REFERENCES provider_routes(name) ON DELETE CASCADE ON UPDATE CASCADE,
+            FOREIGN KEY (provider_name) REFERENCES providers(name) ON DELETE CASCADE ON UPDATE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Blended cost targets of routes, weight is shifted to cheaper providers above them
+        `CREATE TABLE IF NOT EXISTS route_cost_ceilings (
+            route_name VARCHAR(100) PRIMARY KEY,
+            max_cost DECIMAL(10,4) NOT NULL,
+            currency CHAR(3) NULL,
+            min_asr DECIMAL(5,2) NOT NULL DEFAULT 0,
+            max_pdd_ms INT NOT NULL DEFAULT 0,
+            shift DECIMAL(5,2) NOT NULL DEFAULT 0,
+            blended_cost DECIMAL(10,4) NULL,
+            evaluated_at TIMESTAMP NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            FOREIGN KEY (route_name) REFERENCES provider_routes(name) ON DELETE CASCADE ON UPDATE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // CPS and concurrent call caps of routes, providers and destination prefixes
+        `CREATE TABLE IF NOT EXISTS rate_limits (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            scope ENUM('route', 'provider', 'prefix') NOT NULL,
+            scope_value VARCHAR(100) NOT NULL,
+            max_cps DECIMAL(10,2) NOT NULL DEFAULT 0,
+            max_concurrent INT NOT NULL DEFAULT 0,
+            updated_by VARCHAR(100) NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            UNIQUE KEY uk_scope (scope, scope_value)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Customer rate decks, the longest destination prefix prices a call
+        `CREATE TABLE IF NOT EXISTS customer_rates (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            customer VARCHAR(100) NOT NULL,
+            prefix VARCHAR(20) NOT NULL,
+            rate DECIMAL(10,4) NOT NULL,
+            connection_fee DECIMAL(10,4) NOT NULL DEFAULT 0,
+            currency CHAR(3) NULL,
+            description VARCHAR(255) NULL,
+            updated_by VARCHAR(100) NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            UNIQUE KEY uk_customer_prefix (customer, prefix)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Destination prefixes routed whatever the inbound provider, the longest wins
+        `CREATE TABLE IF NOT EXISTS route_prefixes (
+            prefix VARCHAR(20) NOT NULL PRIMARY KEY,
+            route_name VARCHAR(100) NOT NULL,
+            description VARCHAR(255) NULL,
+            updated_by VARCHAR(100) NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            INDEX idx_route (route_name)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Public holidays per country, for time-based routing and reporting
+        `CREATE TABLE IF NOT EXISTS holidays (
+            country_code CHAR(2) NOT NULL,
+            holiday_date DATE NOT NULL,
+            name VARCHAR(200) NOT NULL,
+            source VARCHAR(20) NOT NULL DEFAULT 'manual',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            PRIMARY KEY (country_code, holiday_date),
+            INDEX idx_date (holiday_date)
         ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
         
         // Call records
@@ -239,15 +558,39 @@ func createCoreTables(ctx context.Context, db *sql.DB) error {
             end_time TIMESTAMP NULL,
             duration INT DEFAULT 0,
             billable_duration INT DEFAULT 0,
+            intermediate_billable_duration INT DEFAULT 0,
+            final_billable_duration INT DEFAULT 0,
+            billed_amount DECIMAL(12,4) NULL,
+            cost DECIMAL(12,4) NULL,
+            margin DECIMAL(12,4) NULL,
+            currency CHAR(3) NULL,
+            rate_prefix VARCHAR(20) NULL,
+            answer_delay_ms INT NULL,
             recording_path VARCHAR(255),
             sip_response_code INT,
+            hangup_cause INT NULL,
+            dial_status VARCHAR(20) NULL,
+            disposition VARCHAR(32) NULL,
             quality_score DECIMAL(3,2),
+            is_test BOOLEAN DEFAULT FALSE,
             metadata JSON,
+            router_node VARCHAR(100) NULL,
             INDEX idx_call_id (call_id),
             INDEX idx_status (status),
             INDEX idx_start_time (start_time),
             INDEX idx_providers (inbound_provider, intermediate_provider, final_provider),
-            INDEX idx_did (assigned_did)
+            INDEX idx_did (assigned_did),
+            INDEX idx_disposition (disposition, start_time)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Operator overrides of the built-in hangup code to disposition mapping
+        `CREATE TABLE IF NOT EXISTS disposition_map (
+            source ENUM('sip', 'q850', 'dialstatus') NOT NULL,
+            code VARCHAR(32) NOT NULL,
+            disposition VARCHAR(32) NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            PRIMARY KEY (source, code)
         ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
         
         // Call verifications
@@ -269,12 +612,312 @@ func createCoreTables(ctx context.Context, db *sql.DB) error {
             INDEX idx_created (created_at)
         ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
         
+        // Daily production traffic per provider, route and destination country,
+        // kept for trend analysis after raw call_records are pruned
+        `CREATE TABLE IF NOT EXISTS call_stats_daily (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            stat_date DATE NOT NULL,
+            dimension ENUM('provider', 'route', 'country') NOT NULL,
+            dimension_key VARCHAR(100) NOT NULL,
+            total_calls INT DEFAULT 0,
+            answered_calls INT DEFAULT 0,
+            completed_calls INT DEFAULT 0,
+            failed_calls INT DEFAULT 0,
+            total_duration BIGINT DEFAULT 0,
+            billable_duration BIGINT DEFAULT 0,
+            cost DECIMAL(14,4) DEFAULT 0,
+            revenue DECIMAL(14,4) DEFAULT 0,
+            currency CHAR(3) NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE KEY uk_date_dimension (stat_date, dimension, dimension_key),
+            INDEX idx_dimension_key (dimension, dimension_key, stat_date)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Days already written to call_stats_daily
+        `CREATE TABLE IF NOT EXISTS call_stats_snapshots (
+            stat_date DATE PRIMARY KEY,
+            call_count INT DEFAULT 0,
+            row_count INT DEFAULT 0,
+            raw_pruned BOOLEAN DEFAULT FALSE,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Scheduled synthetic test calls and their results, kept out of call_records
+        `CREATE TABLE IF NOT EXISTS synthetic_probes (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            name VARCHAR(100) UNIQUE NOT NULL,
+            provider VARCHAR(100),
+            route_name VARCHAR(100),
+            dnis VARCHAR(50) NOT NULL,
+            ani VARCHAR(50),
+            mode ENUM('cancel', 'answer') DEFAULT 'cancel',
+            interval_seconds INT DEFAULT 300,
+            enabled BOOLEAN DEFAULT TRUE,
+            last_run_at TIMESTAMP NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        `CREATE TABLE IF NOT EXISTS synthetic_results (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            probe_name VARCHAR(100) NOT NULL,
+            provider VARCHAR(100) NOT NULL,
+            route_name VARCHAR(100),
+            started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            outcome VARCHAR(20) NOT NULL,
+            success BOOLEAN DEFAULT FALSE,
+            pdd_ms INT DEFAULT 0,
+            cause INT DEFAULT 0,
+            reason VARCHAR(255),
+            
+            INDEX idx_probe_started (probe_name, started_at),
+            INDEX idx_provider_started (provider, started_at)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // DID usage, one row per allocation written when the DID is released
+        `CREATE TABLE IF NOT EXISTS did_usage_log (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            did_number VARCHAR(20) NOT NULL,
+            call_id VARCHAR(100) NOT NULL,
+            route_name VARCHAR(100),
+            inbound_provider VARCHAR(100),
+            intermediate_provider VARCHAR(100),
+            final_provider VARCHAR(100),
+            status VARCHAR(50),
+            answered BOOLEAN DEFAULT FALSE,
+            allocated_at TIMESTAMP NULL,
+            released_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            duration INT DEFAULT 0,
+            billable_duration INT DEFAULT 0,
+            cost DECIMAL(12,4) DEFAULT 0,
+            revenue DECIMAL(12,4) DEFAULT 0,
+            currency CHAR(3) NULL,
+            is_test BOOLEAN DEFAULT FALSE,
+            INDEX idx_did_released (did_number, released_at),
+            INDEX idx_call_id (call_id)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Read-only customer usage API tokens, only their hash is kept
+        `CREATE TABLE IF NOT EXISTS api_tokens (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            token_hash CHAR(64) NOT NULL,
+            prefix VARCHAR(16) NOT NULL,
+            customer VARCHAR(100) NOT NULL,
+            description VARCHAR(255),
+            created_by VARCHAR(100),
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            last_used_at TIMESTAMP NULL,
+            expires_at TIMESTAMP NULL,
+            revoked_at TIMESTAMP NULL,
+            pii BOOLEAN NOT NULL DEFAULT FALSE,
+            UNIQUE KEY uk_token_hash (token_hash),
+            INDEX idx_customer (customer)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Scheduled per-customer and billing CDR exports and their deliveries
+        `CREATE TABLE IF NOT EXISTS cdr_exports (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            name VARCHAR(100) UNIQUE NOT NULL,
+            customer VARCHAR(100) NOT NULL,
+            format ENUM('csv', 'json') DEFAULT 'csv',
+            fields JSON,
+            field_names JSON NULL,
+            timezone VARCHAR(64) DEFAULT 'UTC',
+            frequency ENUM('daily', 'weekly', 'monthly') DEFAULT 'daily',
+            destination VARCHAR(512) NOT NULL,
+            enabled BOOLEAN DEFAULT TRUE,
+            created_by VARCHAR(100),
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            INDEX idx_customer (customer)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        `CREATE TABLE IF NOT EXISTS cdr_export_runs (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            export_id BIGINT NOT NULL,
+            period_start DATETIME NOT NULL,
+            period_end DATETIME NOT NULL,
+            status ENUM('running', 'delivered', 'failed') DEFAULT 'running',
+            attempts INT DEFAULT 0,
+            records INT DEFAULT 0,
+            bytes BIGINT DEFAULT 0,
+            file_name VARCHAR(255),
+            error TEXT,
+            started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            finished_at TIMESTAMP NULL,
+            UNIQUE KEY uk_export_period (export_id, period_start),
+            INDEX idx_status (status),
+            FOREIGN KEY (export_id) REFERENCES cdr_exports(id) ON DELETE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Numbers that left or re-joined the DID pool, so recycled ones are quarantined
+        `CREATE TABLE IF NOT EXISTS did_history (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            number VARCHAR(20) NOT NULL,
+            event ENUM('added', 'removed', 'quarantined', 'released') NOT NULL,
+            provider_name VARCHAR(100),
+            last_used_at TIMESTAMP NULL,
+            detail VARCHAR(255),
+            user_id VARCHAR(100),
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_number_event (number, event, created_at)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // DID pool watermarks and the orders they raise
+        `CREATE TABLE IF NOT EXISTS did_watermarks (
+            provider_name VARCHAR(100) NOT NULL,
+            country VARCHAR(50) NOT NULL DEFAULT '',
+            min_available INT NOT NULL,
+            order_quantity INT NOT NULL,
+            orderer VARCHAR(50) DEFAULT 'manual',
+            enabled BOOLEAN DEFAULT TRUE,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            PRIMARY KEY (provider_name, country),
+            FOREIGN KEY (provider_name) REFERENCES providers(name) ON DELETE CASCADE ON UPDATE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        `CREATE TABLE IF NOT EXISTS did_orders (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            provider_name VARCHAR(100) NOT NULL,
+            country VARCHAR(50) NOT NULL DEFAULT '',
+            quantity INT NOT NULL,
+            delivered INT DEFAULT 0,
+            status ENUM('open', 'submitted', 'delivered', 'cancelled', 'failed') DEFAULT 'open',
+            orderer VARCHAR(50) DEFAULT 'manual',
+            reference VARCHAR(255),
+            reason VARCHAR(255),
+            monthly_cost DECIMAL(10,2) DEFAULT 0,
+            per_minute_cost DECIMAL(10,4) DEFAULT 0,
+            currency CHAR(3) NULL,
+            error TEXT,
+            created_by VARCHAR(100),
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            delivered_at TIMESTAMP NULL,
+            INDEX idx_pool_status (provider_name, country, status),
+            INDEX idx_status (status)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Snapshots of the routing configuration, the files are kept at router.backup.destination
+        `CREATE TABLE IF NOT EXISTS backup_snapshots (
+            id VARCHAR(32) PRIMARY KEY,
+            location VARCHAR(512) NOT NULL,
+            size BIGINT DEFAULT 0,
+            checksum CHAR(64) NOT NULL,
+            row_counts JSON,
+            trigger_type VARCHAR(20) NOT NULL,
+            version VARCHAR(50),
+            created_by VARCHAR(100),
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_trigger_created (trigger_type, created_at)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Schemas InitializeDatabase brought the database to, checked at startup
+        `CREATE TABLE IF NOT EXISTS schema_versions (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            fingerprint VARCHAR(16) NOT NULL,
+            router_version VARCHAR(50),
+            applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+    
+        // Commercial terms of providers, usage is tracked against them
+        `CREATE TABLE IF NOT EXISTS provider_contracts (
+            provider_name VARCHAR(100) PRIMARY KEY,
+            min_monthly_minutes INT DEFAULT 0,
+            min_monthly_spend DECIMAL(12,2) DEFAULT 0,
+            max_monthly_minutes INT DEFAULT 0,
+            rates_valid_until DATE NULL,
+            notice_days INT DEFAULT 0,
+            start_date DATE NULL,
+            end_date DATE NULL,
+            notes TEXT,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            FOREIGN KEY (provider_name) REFERENCES providers(name) ON DELETE CASCADE ON UPDATE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Provider SLA targets
+        `CREATE TABLE IF NOT EXISTS provider_slas (
+            provider_name VARCHAR(100) PRIMARY KEY,
+            max_pdd_ms INT DEFAULT 0,
+            min_asr DECIMAL(5,2) DEFAULT 0,
+            min_availability DECIMAL(6,3) DEFAULT 0,
+            pdd_credit DECIMAL(5,2) DEFAULT 0,
+            asr_credit DECIMAL(5,2) DEFAULT 0,
+            availability_credit DECIMAL(5,2) DEFAULT 0,
+            max_credit DECIMAL(5,2) DEFAULT 0,
+            notes TEXT,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            FOREIGN KEY (provider_name) REFERENCES providers(name) ON DELETE CASCADE ON UPDATE CASCADE
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Monthly SLA compliance reports, kept after the SLA or provider is gone
+        `CREATE TABLE IF NOT EXISTS provider_sla_reports (
+            provider_name VARCHAR(100) NOT NULL,
+            month CHAR(7) NOT NULL,
+            calls BIGINT DEFAULT 0,
+            answered BIGINT DEFAULT 0,
+            asr DECIMAL(5,2) DEFAULT 0,
+            avg_pdd_ms INT DEFAULT 0,
+            availability DECIMAL(6,3) DEFAULT 100,
+            downtime_seconds BIGINT DEFAULT 0,
+            minutes DECIMAL(14,2) DEFAULT 0,
+            spend DECIMAL(14,4) DEFAULT 0,
+            currency VARCHAR(3) NULL,
+            credit_percent DECIMAL(5,2) DEFAULT 0,
+            credit DECIMAL(14,4) DEFAULT 0,
+            breaches JSON,
+            outages JSON,
+            target JSON,
+            complete BOOLEAN DEFAULT FALSE,
+            generated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (provider_name, month),
+            INDEX idx_month (month)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Provider quarantine
+        `CREATE TABLE IF NOT EXISTS provider_quarantine (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            provider_name VARCHAR(100) NOT NULL,
+            reason VARCHAR(255),
+            failure_count INT DEFAULT 0,
+            quarantined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            released_at TIMESTAMP NULL,
+            released_by VARCHAR(100),
+            INDEX idx_provider_active (provider_name, released_at),
+            INDEX idx_quarantined (quarantined_at)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // False answer supervision scores, one row per provider
+        `CREATE TABLE IF NOT EXISTS provider_fas_scores (
+            provider_name VARCHAR(100) PRIMARY KEY,
+            answered_calls INT DEFAULT 0,
+            fast_answers INT DEFAULT 0,
+            short_calls INT DEFAULT 0,
+            increment_calls INT DEFAULT 0,
+            score DECIMAL(5,2) DEFAULT 0,
+            flagged BOOLEAN DEFAULT FALSE,
+            reduced BOOLEAN DEFAULT FALSE,
+            flagged_at TIMESTAMP NULL,
+            window_start TIMESTAMP NULL,
+            evaluated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
+        // Round-robin positions, restored on startup
+        `CREATE TABLE IF NOT EXISTS lb_round_robin (
+            rr_key VARCHAR(255) PRIMARY KEY,
+            position BIGINT UNSIGNED NOT NULL DEFAULT 0,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+        
         // Provider statistics
         `CREATE TABLE IF NOT EXISTS provider_stats (
             id BIGINT AUTO_INCREMENT PRIMARY KEY,
             provider_name VARCHAR(100) NOT NULL,
             stat_type ENUM('minute', 'hour', 'day') NOT NULL,
-            period_start TIMESTAMP NOT NULL,
+            period_start DATETIME NOT NULL,
             total_calls BIGINT DEFAULT 0,
             completed_calls BIGINT DEFAULT 0,
             failed_calls BIGINT DEFAULT 0,
@@ -337,6 +980,164 @@ func createCoreTables(ctx context.Context, db *sql.DB) error {
     return nil
 }
 
+// schemaColumn is a column added after the table was first released
+type schemaColumn struct {
+    table      string
+    column     string
+    definition string
+}
+
+// addedColumns lists columns that CREATE TABLE IF NOT EXISTS won't add to existing installs
+var addedColumns = []schemaColumn{
+    {"provider_routes", "policy_name", "VARCHAR(100) NULL"},
+    {"provider_routes", "verification_enabled", "BOOLEAN NULL"},
+    {"provider_routes", "strict_mode", "BOOLEAN NULL"},
+    {"provider_routes", "manipulations", "JSON NULL"},
+    {"provider_routes", "inbound_match", "ENUM('exact', 'prefix', 'regex') DEFAULT 'exact'"},
+    {"ps_contacts", "expiration_time", "BIGINT NULL"},
+    {"ps_contacts", "qualify_timeout", "DECIMAL(5,3) NULL"},
+    {"ps_contacts", "outbound_proxy", "VARCHAR(255) NULL"},
+    {"ps_contacts", "path", "TEXT NULL"},
+    {"ps_contacts", "reg_server", "VARCHAR(255) NULL"},
+    {"ps_contacts", "authenticate_qualify", "VARCHAR(3) NULL"},
+    {"ps_contacts", "via_addr", "VARCHAR(40) NULL"},
+    {"ps_contacts", "via_port", "INT NULL"},
+    {"ps_contacts", "call_id", "VARCHAR(255) NULL"},
+    {"ps_contacts", "endpoint", "VARCHAR(40) NULL"},
+    {"ps_contacts", "prune_on_boot", "VARCHAR(3) NULL"},
+    {"dids", "is_test", "BOOLEAN DEFAULT FALSE"},
+    {"provider_routes", "is_test", "BOOLEAN DEFAULT FALSE"},
+    {"call_records", "is_test", "BOOLEAN DEFAULT FALSE"},
+    {"did_usage_log", "is_test", "BOOLEAN DEFAULT FALSE"},
+    {"call_records", "answer_delay_ms", "INT NULL"},
+    {"provider_routes", "dial_options", "JSON NULL"},
+    {"provider_dial_options", "early_media", "ENUM('pass_through', 'block', 'ringback') NULL"},
+    {"provider_dial_options", "max_attempts", "INT NULL"},
+    {"call_records", "hangup_cause", "INT NULL"},
+    {"call_records", "dial_status", "VARCHAR(20) NULL"},
+    {"call_records", "disposition", "VARCHAR(32) NULL"},
+    {"providers", "min_duration", "INT DEFAULT 0"},
+    {"providers", "billing_increment", "INT DEFAULT 1"},
+    {"call_records", "intermediate_billable_duration", "INT DEFAULT 0"},
+    {"call_records", "final_billable_duration", "INT DEFAULT 0"},
+    {"providers", "currency", "CHAR(3) NULL"},
+    {"dids", "currency", "CHAR(3) NULL"},
+    {"did_usage_log", "currency", "CHAR(3) NULL"},
+    {"call_stats_daily", "currency", "CHAR(3) NULL"},
+    {"dids", "quarantined_until", "TIMESTAMP NULL"},
+    {"provider_routes", "queue_timeout", "INT NULL"},
+    {"api_tokens", "pii", "BOOLEAN NOT NULL DEFAULT FALSE"},
+    {"call_records", "router_node", "VARCHAR(100) NULL"},
+    {"cdr_exports", "field_names", "JSON NULL"},
+    {"call_records", "billed_amount", "DECIMAL(12,4) NULL"},
+    {"call_records", "cost", "DECIMAL(12,4) NULL"},
+    {"call_records", "margin", "DECIMAL(12,4) NULL"},
+    {"call_records", "currency", "CHAR(3) NULL"},
+    {"call_records", "rate_prefix", "VARCHAR(20) NULL"},
+    {"dids", "last_allocated_at", "TIMESTAMP(6) NULL"},
+    {"dids", "hour_allocations", "INT DEFAULT 0"},
+    {"dids", "hour_started_at", "TIMESTAMP NULL"},
+}
+
+func addMissingColumns(ctx context.Context, db *sql.DB) error {
+    for _, c := range addedColumns {
+        var exists int
+        err := db.QueryRowContext(ctx, `
+            SELECT COUNT(*) FROM information_schema.columns
+            WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+            c.table, c.column).Scan(&exists)
+        if err != nil {
+            return err
+        }
+        if exists > 0 {
+            continue
+        }
+        
+        query := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", c.table, c.column, c.definition)
+        if _, err := db.ExecContext(ctx, query); err != nil {
+            return fmt.Errorf("failed to add %s.%s: %w", c.table, c.column, err)
+        }
+        logger.WithContext(ctx).WithField("column", c.table+"."+c.column).Info("Added missing column")
+    }
+    
+    return nil
+}
+
+// schemaColumnType is a column whose type changed after the table was first released
+type schemaColumnType struct {
+    table      string
+    column     string
+    columnType string // as reported by information_schema.columns.column_type
+    definition string
+}
+
+// changedColumnTypes lists columns that existing installs must be altered to
+var changedColumnTypes = []schemaColumnType{
+    {"providers", "auth_type", "enum('ip','credentials','both','register')", "ENUM('ip', 'credentials', 'both', 'register') DEFAULT 'ip'"},
+    {"ps_contacts", "id", "varchar(255)", "VARCHAR(255) NOT NULL"},
+}
+
+func upgradeColumnTypes(ctx context.Context, db *sql.DB) error {
+    for _, c := range changedColumnTypes {
+        var columnType string
+        err := db.QueryRowContext(ctx, `
+            SELECT column_type FROM information_schema.columns
+            WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+            c.table, c.column).Scan(&columnType)
+        if err != nil {
+            return err
+        }
+        if strings.EqualFold(columnType, c.columnType) {
+            continue
+        }
+        
+        query := fmt.Sprintf("ALTER TABLE `%s` MODIFY COLUMN `%s` %s", c.table, c.column, c.definition)
+        if _, err := db.ExecContext(ctx, query); err != nil {
+            return fmt.Errorf("failed to change %s.%s: %w", c.table, c.column, err)
+        }
+        logger.WithContext(ctx).WithField("column", c.table+"."+c.column).Info("Changed column type")
+    }
+    
+    return nil
+}
+
+// schemaIndex is an index added after the table was first released
+type schemaIndex struct {
+    table   string
+    name    string
+    columns string
+}
+
+// addedIndexes lists indexes that CREATE TABLE IF NOT EXISTS won't add to existing installs
+var addedIndexes = []schemaIndex{
+    {"dids", "idx_country_cost", "country, in_use, per_minute_cost"},
+    {"call_records", "idx_disposition", "disposition, start_time"},
+}
+
+func addMissingIndexes(ctx context.Context, db *sql.DB) error {
+    for _, idx := range addedIndexes {
+        var exists int
+        err := db.QueryRowContext(ctx, `
+            SELECT COUNT(*) FROM information_schema.statistics
+            WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`,
+            idx.table, idx.name).Scan(&exists)
+        if err != nil {
+            return err
+        }
+        if exists > 0 {
+            continue
+        }
+        
+        query := fmt.Sprintf("ALTER TABLE `%s` ADD INDEX `%s` (%s)", idx.table, idx.name, idx.columns)
+        if _, err := db.ExecContext(ctx, query); err != nil {
+            return fmt.Errorf("failed to add index %s.%s: %w", idx.table, idx.name, err)
+        }
+        logger.WithContext(ctx).WithField("index", idx.table+"."+idx.name).Info("Added missing index")
+    }
+    
+    return nil
+}
+
 func createARATables(ctx context.Context, db *sql.DB) error {
     queries := []string{
         // PJSIP transports
@@ -520,12 +1321,23 @@ func createARATables(ctx context.Context, db *sql.DB) error {
         
         // PJSIP contacts
         `CREATE TABLE IF NOT EXISTS ps_contacts (
-            id VARCHAR(40) PRIMARY KEY,
+            id VARCHAR(255) PRIMARY KEY,
             uri VARCHAR(255),
             endpoint_name VARCHAR(40),
             aor VARCHAR(40),
             qualify_frequency INT DEFAULT 0,
-            user_agent VARCHAR(255)
+            user_agent VARCHAR(255),
+            expiration_time BIGINT NULL,
+            qualify_timeout DECIMAL(5,3) NULL,
+            outbound_proxy VARCHAR(255) NULL,
+            path TEXT NULL,
+            reg_server VARCHAR(255) NULL,
+            authenticate_qualify VARCHAR(3) NULL,
+            via_addr VARCHAR(40) NULL,
+            via_port INT NULL,
+            call_id VARCHAR(255) NULL,
+            endpoint VARCHAR(40) NULL,
+            prune_on_boot VARCHAR(3) NULL
         ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
         
         // PJSIP globals
@@ -639,6 +1451,7 @@ func createStoredProcedures(ctx context.Context, db *sql.DB) error {
             SELECT number INTO v_did
             FROM dids
             WHERE in_use = 0 
+                AND (quarantined_until IS NULL OR quarantined_until <= NOW())
                 AND (p_provider_name IS NULL OR provider_name = p_provider_name)
             ORDER BY IFNULL(last_used_at, '1970-01-01'), RAND()
             LIMIT 1
@@ -813,7 +1626,10 @@ func createDialplan(ctx context.Context, db *sql.DB) error {
             'router-outbound',
             'router-internal',
             'hangup-handler',
-            'sub-recording'
+            'sub-recording',
+            'sub-correlation-header',
+            'sub-predial',
+            'sub-answer'
         )`); err != nil {
         return fmt.Errorf("failed to clear existing dialplan: %w", err)
     }
@@ -851,7 +1667,7 @@ INSERT INTO extensions (context, exten, priority, app, appdata) VALUES
 ('from-provider-inbound', '_X.', 18, 'Set', 'CALLERID(num)=${ANI_TO_SEND}'),
 ('from-provider-inbound', '_X.', 19, 'Set', 'CDR(intermediate_provider)=${INTERMEDIATE_PROVIDER}'),
 ('from-provider-inbound', '_X.', 20, 'Set', 'CDR(assigned_did)=${DID_ASSIGNED}'),
-('from-provider-inbound', '_X.', 21, 'Dial', 'PJSIP/${DNIS_TO_SEND}@${NEXT_HOP},180,U(sub-recording^${UNIQUEID})'),
+('from-provider-inbound', '_X.', 21, 'Dial', '${DIAL_STRING},${DIAL_TIMEOUT},${DIAL_OPTIONS}'),
 ('from-provider-inbound', '_X.', 22, 'Set', 'CDR(sip_response)=${HANGUPCAUSE}'),
 ('from-provider-inbound', '_X.', 23, 'GotoIf', '$["${DIALSTATUS}" = "ANSWER"]?end:dial_failed'),
 ('from-provider-inbound', '_X.', 24, 'NoOp', 'Dial failed: ${DIALSTATUS}'),
@@ -870,7 +1686,7 @@ INSERT INTO extensions (context, exten, priority, app, appdata) VALUES
 ('from-provider-intermediate', '_X.', 9, 'NoOp', 'Routing to final: ${FINAL_PROVIDER}'),
 ('from-provider-intermediate', '_X.', 10, 'Set', 'CALLERID(num)=${ANI_TO_SEND}'),
 ('from-provider-intermediate', '_X.', 11, 'Set', 'CDR(final_provider)=${FINAL_PROVIDER}'),
-('from-provider-intermediate', '_X.', 12, 'Dial', 'PJSIP/${DNIS_TO_SEND}@${NEXT_HOP},180'),
+('from-provider-intermediate', '_X.', 12, 'Dial', '${DIAL_STRING},${DIAL_TIMEOUT},${DIAL_OPTIONS}'),
 ('from-provider-intermediate', '_X.', 13, 'Set', 'CDR(final_sip_response)=${HANGUPCAUSE}'),
 ('from-provider-intermediate', '_X.', 14, 'Hangup', ''),
 
@@ -890,9 +1706,18 @@ INSERT INTO extensions (context, exten, priority, app, appdata) VALUES
 ('hangup-handler', 's', 4, 'AGI', 'agi://localhost:4573/hangup'),
 ('hangup-handler', 's', 5, 'Return', ''),
 
--- RECORDING SUBROUTINE
-('sub-recording', 's', 1, 'NoOp', 'Starting recording on originated channel'),
-('sub-recording', 's', 2, 'Set', 'AUDIOHOOK_INHERIT(MixMonitor)=yes'),
-('sub-recording', 's', 3, 'MixMonitor', '${ARG1}-out.wav,b'),
-('sub-recording', 's', 4, 'Return', '');`
+-- PRE-DIAL HANDLER (ARG1 caller ID presentation, ARG2 extra context)
+('sub-predial', 's', 1, 'ExecIf', '$["${CORRELATION_TOKEN}" != ""]?Set(PJSIP_HEADER(add,X-ARA-Token)=${CORRELATION_TOKEN})'),
+('sub-predial', 's', 2, 'ExecIf', '$["${ARG1}" != ""]?Set(CALLERID(pres)=${ARG1})'),
+('sub-predial', 's', 3, 'GotoIf', '$["${ARG2}" = ""]?5'),
+('sub-predial', 's', 4, 'Gosub', '${ARG2},s,1'),
+('sub-predial', 's', 5, 'Return', ''),
+
+-- ANSWER SUBROUTINE (ARG1 call ID to record, ARG2 extra context)
+('sub-answer', 's', 1, 'GotoIf', '$["${ARG1}" = ""]?4'),
+('sub-answer', 's', 2, 'Set', 'AUDIOHOOK_INHERIT(MixMonitor)=yes'),
+('sub-answer', 's', 3, 'MixMonitor', '${ARG1}-out.wav,b'),
+('sub-answer', 's', 4, 'GotoIf', '$["${ARG2}" = ""]?6'),
+('sub-answer', 's', 5, 'Gosub', '${ARG2},s,1'),
+('sub-answer', 's', 6, 'Return', '');`
 }
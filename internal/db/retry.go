@@ -0,0 +1,236 @@
+package db
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    stderrors "errors"
+    "math/rand"
+    "net"
+    "strings"
+    "sync"
+    "time"
+    
+    "github.com/go-sql-driver/mysql"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// Classes of database errors, used for retry decisions and the class label of db_errors_total
+const (
+    ClassDeadlock    = "deadlock"          // the transaction was rolled back, safe to run again
+    ClassLockTimeout = "lock_wait_timeout" // the statement was rolled back, safe to run again
+    ClassConnection  = "connection"        // the statement may or may not have run
+    ClassTimeout     = "timeout"           // context deadline or query timeout
+    ClassOverloaded  = "overloaded"        // too many connections
+    ClassDuplicate   = "duplicate_key"
+    ClassSchema      = "schema"            // missing table or column, see VerifySchema
+    ClassConstraint  = "constraint"
+    ClassNoRows      = "no_rows"
+    ClassOther       = "other"
+)
+
+// RetryPolicy bounds the retries of idempotent statements and transactions
+type RetryPolicy struct {
+    Attempts int           // retries after the first try
+    Delay    time.Duration // before the first retry, doubled each retry
+    MaxDelay time.Duration
+}
+
+// Metrics receives the db_errors and db_retries counters and the cache
+// lookups of each namespace
+type Metrics interface {
+    IncrementCounter(name string, labels map[string]string)
+    SetGauge(name string, value float64, labels map[string]string)
+}
+
+var (
+    retryMu     sync.RWMutex
+    retryPolicy = RetryPolicy{Attempts: 3, Delay: 50 * time.Millisecond, MaxDelay: time.Second}
+    metrics     Metrics
+)
+
+// SetRetryPolicy replaces the policy Retry and RetryTx follow
+func SetRetryPolicy(policy RetryPolicy) {
+    if policy.Delay <= 0 {
+        policy.Delay = 50 * time.Millisecond
+    }
+    if policy.MaxDelay < policy.Delay {
+        policy.MaxDelay = policy.Delay
+    }
+    retryMu.Lock()
+    retryPolicy = policy
+    retryMu.Unlock()
+}
+
+// SetMetrics counts classified errors and retries from now on
+func SetMetrics(m Metrics) {
+    retryMu.Lock()
+    metrics = m
+    retryMu.Unlock()
+}
+
+// Classify names the kind of a database error, nil for success
+func Classify(err error) string {
+    if err == nil {
+        return ""
+    }
+    if stderrors.Is(err, sql.ErrNoRows) {
+        return ClassNoRows
+    }
+    if stderrors.Is(err, context.DeadlineExceeded) {
+        return ClassTimeout
+    }
+    
+    var mysqlErr *mysql.MySQLError
+    if stderrors.As(err, &mysqlErr) {
+        switch mysqlErr.Number {
+        case 1213:
+            return ClassDeadlock
+        case 1205:
+            return ClassLockTimeout
+        case 1040, 1203:
+            return ClassOverloaded
+        case 1062:
+            return ClassDuplicate
+        case 1146, 1054:
+            return ClassSchema
+        case 1451, 1452:
+            return ClassConstraint
+        case 3024, 1969:
+            return ClassTimeout
+        case 1053, 1927, 2006, 2013:
+            return ClassConnection
+        }
+        return ClassOther
+    }
+    
+    if stderrors.Is(err, driver.ErrBadConn) || stderrors.Is(err, mysql.ErrInvalidConn) || stderrors.Is(err, sql.ErrConnDone) {
+        return ClassConnection
+    }
+    var netErr net.Error
+    if stderrors.As(err, &netErr) {
+        if netErr.Timeout() {
+            return ClassTimeout
+        }
+        return ClassConnection
+    }
+    
+    // Errors that lost their type on the way, e.g. through fmt.Errorf("%v")
+    msg := strings.ToLower(err.Error())
+    switch {
+    case strings.Contains(msg, "deadlock"):
+        return ClassDeadlock
+    case strings.Contains(msg, "lock wait timeout"):
+        return ClassLockTimeout
+    case strings.Contains(msg, "connection refused"), strings.Contains(msg, "connection reset"),
+        strings.Contains(msg, "broken pipe"), strings.Contains(msg, "invalid connection"):
+        return ClassConnection
+    }
+    return ClassOther
+}
+
+// Retryable reports whether running the statement or transaction again can
+// succeed. A dropped connection is only worth retrying for idempotent work,
+// the statement may have run before the connection went.
+func Retryable(class string, idempotent bool) bool {
+    switch class {
+    case ClassDeadlock, ClassLockTimeout:
+        return true
+    case ClassConnection, ClassOverloaded:
+        return idempotent
+    }
+    return false
+}
+
+// IsRetryable reports whether a transaction that failed with err can run again
+func IsRetryable(err error) bool {
+    return Retryable(Classify(err), false)
+}
+
+// Retry runs an idempotent statement, running it again with jittered backoff
+// while it fails with a deadlock, lock wait timeout or dropped connection
+func Retry(ctx context.Context, operation string, fn func() error) error {
+    return retry(ctx, operation, true, fn)
+}
+
+// RetryTx runs fn in a transaction, running it again when the transaction is
+// rolled back by a deadlock or lock wait timeout. A connection lost before
+// the commit is retried too; fn must only touch the database through tx.
+func RetryTx(ctx context.Context, db *sql.DB, operation string, fn func(*sql.Tx) error) error {
+    return retry(ctx, operation, false, func() error {
+        tx, err := db.BeginTx(ctx, nil)
+        if err != nil {
+            return idempotentErr{err}
+        }
+        if err := fn(tx); err != nil {
+            tx.Rollback()
+            if Classify(err) == ClassConnection {
+                return idempotentErr{err}
+            }
+            return err
+        }
+        return tx.Commit()
+    })
+}
+
+// idempotentErr marks a failure before anything was committed
+type idempotentErr struct {
+    err error
+}
+
+func (e idempotentErr) Error() string { return e.err.Error() }
+
+func (e idempotentErr) Unwrap() error { return e.err }
+
+func retry(ctx context.Context, operation string, idempotent bool, fn func() error) error {
+    retryMu.RLock()
+    policy, m := retryPolicy, metrics
+    retryMu.RUnlock()
+    
+    delay := policy.Delay
+    for attempt := 0; ; attempt++ {
+        err := fn()
+        if err == nil {
+            return nil
+        }
+    
+        var before idempotentErr
+        safe := idempotent || stderrors.As(err, &before)
+        if safe && before.err != nil {
+            err = before.err
+        }
+    
+        class := Classify(err)
+        if class == ClassNoRows {
+            return err
+        }
+        again := attempt < policy.Attempts && Retryable(class, safe) && ctx.Err() == nil
+        if m != nil {
+            m.IncrementCounter("db_errors", map[string]string{"operation": operation, "class": class})
+            if again {
+                m.IncrementCounter("db_retries", map[string]string{"operation": operation, "class": class})
+            }
+        }
+        if !again {
+            return err
+        }
+    
+        // Full jitter keeps callers that deadlocked on each other from retrying in step
+        wait := time.Duration(rand.Int63n(int64(delay)) + 1)
+        logger.WithContext(ctx).WithFields(map[string]interface{}{
+            "operation": operation,
+            "class":     class,
+            "attempt":   attempt + 1,
+            "wait":      wait,
+        }).Warn("Database operation failed, retrying")
+    
+        select {
+        case <-ctx.Done():
+            return err
+        case <-time.After(wait):
+        }
+        if delay *= 2; delay > policy.MaxDelay {
+            delay = policy.MaxDelay
+        }
+    }
+}
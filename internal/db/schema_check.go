@@ -0,0 +1,326 @@
+package db
+
+import (
+    "context"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "fmt"
+    "strings"
+    
+    "github.com/go-sql-driver/mysql"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/buildinfo"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// requiredTables are the tables InitializeDatabase creates
+var requiredTables = []string{
+    "providers", "provider_tags", "provider_country_limits", "provider_short_call_limits",
+    "provider_dial_options", "provider_events", "incidents", "incident_alerts", "destination_blocks", "kill_switches", "read_only_mode", "system_downtime",
+    "destination_block_overrides", "credential_rotations", "dids", "provider_groups",
+    "provider_group_members", "provider_group_children", "provider_routes", "route_policies", "route_weight_curves", "route_cost_ceilings", "route_prefixes", "rate_limits", "customer_rates", "holidays", "call_records",
+    "disposition_map", "call_verifications", "call_stats_daily", "call_stats_snapshots", "synthetic_probes",
+    "synthetic_results", "did_usage_log", "api_tokens", "cdr_exports", "cdr_export_runs",
+    "provider_contracts", "provider_slas", "provider_sla_reports", "did_history", "did_watermarks", "did_orders", "backup_snapshots", "schema_versions", "provider_quarantine", "provider_fas_scores", "lb_round_robin", "provider_stats", "provider_health", "audit_log",
+    "ps_transports", "ps_systems", "ps_endpoints", "ps_auths", "ps_aors", "ps_endpoint_id_ips",
+    "ps_contacts", "ps_globals", "ps_domain_aliases", "extensions", "cdr",
+}
+
+// requiredProcedures and requiredViews are the routines and views
+// InitializeDatabase creates. The router doesn't read them itself, so missing
+// ones are recreated at startup rather than refusing to start
+var requiredProcedures = []string{"GetAvailableDID", "ReleaseDID", "UpdateProviderStats"}
+
+var requiredViews = []string{"v_active_calls", "v_provider_summary", "v_did_utilization"}
+
+// SchemaReport lists what an install is missing compared to the schema this build creates
+type SchemaReport struct {
+    MigrationVersion  uint // golang-migrate version, 0 without schema_migrations
+    MigrationDirty    bool
+    MissingTables     []string
+    MissingColumns    []string // table.column
+    OutdatedColumns   []string // table.column with an old type
+    MissingIndexes    []string // table.index
+    MissingProcedures []string
+    MissingViews      []string
+    Fingerprint       string // recorded by the last InitializeDatabase, empty before schema_versions existed
+    RouterVersion     string // of the router that recorded it
+}
+
+// UpToDate reports whether nothing needs upgrading
+func (r *SchemaReport) UpToDate() bool {
+    return !r.MigrationDirty && len(r.MissingTables) == 0 && len(r.MissingColumns) == 0 &&
+        len(r.OutdatedColumns) == 0 && len(r.MissingIndexes) == 0 &&
+        len(r.MissingProcedures) == 0 && len(r.MissingViews) == 0
+}
+
+// Broken reports whether something the router reads or writes is missing or
+// of an old type, queries would fail on it at runtime
+func (r *SchemaReport) Broken() bool {
+    return r.MigrationDirty || len(r.MissingTables) > 0 || len(r.MissingColumns) > 0 || len(r.OutdatedColumns) > 0
+}
+
+// Problems describes what is missing or outdated, one entry per kind
+func (r *SchemaReport) Problems() []string {
+    var problems []string
+    if r.MigrationDirty {
+        problems = append(problems, fmt.Sprintf("migration %d is dirty", r.MigrationVersion))
+    }
+    for _, p := range []struct {
+        kind  string
+        names []string
+    }{
+        {"missing tables", r.MissingTables},
+        {"missing columns", r.MissingColumns},
+        {"outdated columns", r.OutdatedColumns},
+        {"missing indexes", r.MissingIndexes},
+        {"missing procedures", r.MissingProcedures},
+        {"missing views", r.MissingViews},
+    } {
+        if len(p.names) > 0 {
+            problems = append(problems, p.kind+": "+strings.Join(p.names, ", "))
+        }
+    }
+    return problems
+}
+
+// SchemaFingerprint identifies the schema this build creates and upgrades to;
+// builds with different fingerprints expect different tables, columns or indexes
+func SchemaFingerprint() string {
+    h := sha256.New()
+    for _, table := range requiredTables {
+        fmt.Fprintln(h, "table", table)
+    }
+    for _, c := range addedColumns {
+        fmt.Fprintln(h, "column", c.table, c.column, c.definition)
+    }
+    for _, c := range changedColumnTypes {
+        fmt.Fprintln(h, "type", c.table, c.column, c.columnType)
+    }
+    for _, idx := range addedIndexes {
+        fmt.Fprintln(h, "index", idx.table, idx.name, idx.columns)
+    }
+    for _, proc := range requiredProcedures {
+        fmt.Fprintln(h, "procedure", proc)
+    }
+    for _, view := range requiredViews {
+        fmt.Fprintln(h, "view", view)
+    }
+    return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// MigrationVersion returns the golang-migrate version of the database, 0
+// without schema_migrations
+func MigrationVersion(ctx context.Context, db *sql.DB) (uint, bool, error) {
+    var version sql.NullInt64
+    var dirty sql.NullBool
+    err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+    if err == sql.ErrNoRows || isMissingTable(err) {
+        return 0, false, nil
+    }
+    if err != nil {
+        return 0, false, err
+    }
+    return uint(version.Int64), dirty.Bool, nil
+}
+
+// isMissingTable reports a MySQL "table doesn't exist" error
+func isMissingTable(err error) bool {
+    mysqlErr, ok := err.(*mysql.MySQLError)
+    return ok && mysqlErr.Number == 1146
+}
+
+// CheckSchema compares the database with the tables, columns and indexes that
+// InitializeDatabase would create or upgrade, without changing anything
+func CheckSchema(ctx context.Context, db *sql.DB) (*SchemaReport, error) {
+    report := &SchemaReport{}
+    
+    tables := make(map[string]bool)
+    rows, err := db.QueryContext(ctx, "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()")
+    if err != nil {
+        return nil, err
+    }
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err == nil {
+            tables[strings.ToLower(name)] = true
+        }
+    }
+    rows.Close()
+    
+    for _, table := range requiredTables {
+        if !tables[table] {
+            report.MissingTables = append(report.MissingTables, table)
+        }
+    }
+    
+    if tables["schema_migrations"] {
+        var version sql.NullInt64
+        var dirty sql.NullBool
+        err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+        if err != nil && err != sql.ErrNoRows {
+            return nil, err
+        }
+        report.MigrationVersion = uint(version.Int64)
+        report.MigrationDirty = dirty.Bool
+    }
+    
+    for _, c := range addedColumns {
+        if !tables[c.table] {
+            continue
+        }
+        var exists int
+        err := db.QueryRowContext(ctx, `
+            SELECT COUNT(*) FROM information_schema.columns
+            WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+            c.table, c.column).Scan(&exists)
+        if err != nil {
+            return nil, err
+        }
+        if exists == 0 {
+            report.MissingColumns = append(report.MissingColumns, c.table+"."+c.column)
+        }
+    }
+    
+    for _, c := range changedColumnTypes {
+        if !tables[c.table] {
+            continue
+        }
+        var columnType string
+        err := db.QueryRowContext(ctx, `
+            SELECT column_type FROM information_schema.columns
+            WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+            c.table, c.column).Scan(&columnType)
+        if err != nil && err != sql.ErrNoRows {
+            return nil, err
+        }
+        if !strings.EqualFold(columnType, c.columnType) {
+            report.OutdatedColumns = append(report.OutdatedColumns, c.table+"."+c.column)
+        }
+    }
+    
+    for _, idx := range addedIndexes {
+        if !tables[idx.table] {
+            continue
+        }
+        var exists int
+        err := db.QueryRowContext(ctx, `
+            SELECT COUNT(*) FROM information_schema.statistics
+            WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`,
+            idx.table, idx.name).Scan(&exists)
+        if err != nil {
+            return nil, err
+        }
+        if exists == 0 {
+            report.MissingIndexes = append(report.MissingIndexes, idx.table+"."+idx.name)
+        }
+    }
+    
+    procedures, err := schemaObjects(ctx, db,
+        "SELECT routine_name FROM information_schema.routines WHERE routine_schema = DATABASE() AND routine_type = 'PROCEDURE'")
+    if err != nil {
+        return nil, err
+    }
+    for _, proc := range requiredProcedures {
+        if !procedures[strings.ToLower(proc)] {
+            report.MissingProcedures = append(report.MissingProcedures, proc)
+        }
+    }
+    
+    views, err := schemaObjects(ctx, db, "SELECT table_name FROM information_schema.views WHERE table_schema = DATABASE()")
+    if err != nil {
+        return nil, err
+    }
+    for _, view := range requiredViews {
+        if !views[view] {
+            report.MissingViews = append(report.MissingViews, view)
+        }
+    }
+    
+    if tables["schema_versions"] {
+        err := db.QueryRowContext(ctx, `
+            SELECT fingerprint, COALESCE(router_version, '') FROM schema_versions
+            ORDER BY id DESC LIMIT 1`).Scan(&report.Fingerprint, &report.RouterVersion)
+        if err != nil && err != sql.ErrNoRows {
+            return nil, err
+        }
+    }
+    
+    return report, nil
+}
+
+// schemaObjects returns the lowercased names a query over information_schema lists
+func schemaObjects(ctx context.Context, db *sql.DB, query string) (map[string]bool, error) {
+    rows, err := db.QueryContext(ctx, query)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    names := make(map[string]bool)
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err == nil {
+            names[strings.ToLower(name)] = true
+        }
+    }
+    return names, rows.Err()
+}
+
+// VerifySchema checks the schema before serving. Missing procedures and views
+// are recreated when heal is set; missing tables, columns or a dirty migration
+// are returned as an error so the router stops with a clear message instead of
+// failing scans on every call. Missing indexes and a schema recorded by another
+// build only slow queries down or hint at a skipped upgrade, they are logged.
+func VerifySchema(ctx context.Context, db *sql.DB, heal bool) (*SchemaReport, error) {
+    log := logger.WithContext(ctx)
+    
+    report, err := CheckSchema(ctx, db)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read schema: %w", err)
+    }
+    
+    if heal && len(report.MissingProcedures) > 0 {
+        if err := createStoredProcedures(ctx, db); err != nil {
+            log.WithError(err).WithField("procedures", report.MissingProcedures).Warn("Failed to recreate stored procedures")
+        } else {
+            log.WithField("procedures", report.MissingProcedures).Info("Recreated missing stored procedures")
+            report.MissingProcedures = nil
+        }
+    }
+    // Views select from tables, recreating them only works once those exist
+    if heal && len(report.MissingViews) > 0 && len(report.MissingTables) == 0 {
+        if err := createViews(ctx, db); err != nil {
+            log.WithError(err).WithField("views", report.MissingViews).Warn("Failed to recreate views")
+        } else {
+            log.WithField("views", report.MissingViews).Info("Recreated missing views")
+            report.MissingViews = nil
+        }
+    }
+    
+    if report.Broken() {
+        return report, fmt.Errorf("schema does not match this build (%s)", strings.Join(report.Problems(), "; "))
+    }
+    
+    if problems := report.Problems(); len(problems) > 0 {
+        log.WithField("problems", problems).Warn("Schema is incomplete, run 'router -init-db' to upgrade it")
+    }
+    if expected := SchemaFingerprint(); report.Fingerprint != "" && report.Fingerprint != expected {
+        log.WithFields(map[string]interface{}{
+            "recorded":    report.Fingerprint,
+            "recorded_by": report.RouterVersion,
+            "expected":    expected,
+        }).Warn("Schema was last initialized by a different build")
+    }
+    
+    return report, nil
+}
+
+// recordSchemaVersion notes the schema InitializeDatabase brought the database to
+func recordSchemaVersion(ctx context.Context, db *sql.DB) error {
+    _, err := db.ExecContext(ctx, `
+        INSERT INTO schema_versions (fingerprint, router_version) VALUES (?, ?)`,
+        SchemaFingerprint(), buildinfo.Get().Version)
+    return err
+}
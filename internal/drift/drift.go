@@ -0,0 +1,295 @@
+// Package drift detects router nodes that run with a different effective
+// configuration or expect a different database schema than their peers, as
+// happens after a partial deployment.
+package drift
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// nodesKey is the Redis hash holding one published state per node
+const nodesKey = "drift:nodes"
+
+// Store is the shared hash the nodes publish their state to
+type Store interface {
+    HashSet(ctx context.Context, key, field, value string, ttl time.Duration) error
+    HashGetAll(ctx context.Context, key string) (map[string]string, error)
+    HashDelete(ctx context.Context, key string, fields ...string) error
+}
+
+// MetricsInterface is the part of the metrics service the detector uses
+type MetricsInterface interface {
+    SetGauge(name string, value float64, labels map[string]string)
+}
+
+// Config controls drift detection
+type Config struct {
+    Enabled  bool
+    NodeID   string
+    Interval time.Duration // how often the node publishes and compares
+}
+
+// staleAfter is how long a node that stopped publishing still counts
+func (c Config) staleAfter() time.Duration {
+    return 3 * c.Interval
+}
+
+// NodeState is what a node publishes about itself
+type NodeState struct {
+    Node             string    `json:"node"`
+    ConfigHash       string    `json:"config_hash"`
+    SchemaHash       string    `json:"schema_hash"` // schema the build expects
+    MigrationVersion uint      `json:"migration_version"`
+    StartedAt        time.Time `json:"started_at"`
+    PublishedAt      time.Time `json:"published_at"`
+}
+
+// Report groups the live nodes by what they run
+type Report struct {
+    Nodes        []NodeState         `json:"nodes"`
+    ConfigGroups map[string][]string `json:"config_groups"` // config hash to nodes
+    SchemaGroups map[string][]string `json:"schema_groups"` // schema hash and migration to nodes
+}
+
+// ConfigDrift reports whether live nodes run different configurations
+func (r *Report) ConfigDrift() bool {
+    return len(r.ConfigGroups) > 1
+}
+
+// SchemaDrift reports whether live nodes expect different schemas
+func (r *Report) SchemaDrift() bool {
+    return len(r.SchemaGroups) > 1
+}
+
+// Majority returns the config and schema keys most nodes share
+func (r *Report) Majority() (config, schema string) {
+    return largestGroup(r.ConfigGroups), largestGroup(r.SchemaGroups)
+}
+
+// SchemaKey is the value nodes are grouped by for schema drift
+func (s NodeState) SchemaKey() string {
+    return fmt.Sprintf("%s@%d", s.SchemaHash, s.MigrationVersion)
+}
+
+// Detector publishes the node's state and alerts when the nodes disagree
+type Detector struct {
+    store   Store
+    metrics MetricsInterface
+    config  Config
+    state   func(ctx context.Context) NodeState
+    
+    startedAt time.Time
+    lastAlert string // drift signature last alerted on
+}
+
+// NewDetector creates a drift detector. state is called before every publish
+// so configuration reloads are picked up.
+func NewDetector(store Store, metrics MetricsInterface, config Config, state func(ctx context.Context) NodeState) *Detector {
+    if config.Interval <= 0 {
+        config.Interval = 30 * time.Second
+    }
+    return &Detector{
+        store:     store,
+        metrics:   metrics,
+        config:    config,
+        state:     state,
+        startedAt: time.Now(),
+    }
+}
+
+// Run publishes and compares until ctx is done, then withdraws the node
+func (d *Detector) Run(ctx context.Context) {
+    log := logger.WithField("node", d.config.NodeID)
+    log.WithField("interval", d.config.Interval.String()).Info("Config drift detection started")
+    
+    ticker := time.NewTicker(d.config.Interval)
+    defer ticker.Stop()
+    
+    for {
+        if _, err := d.Check(ctx); err != nil {
+            log.WithError(err).Warn("Config drift check failed")
+        }
+    
+        select {
+        case <-ctx.Done():
+            d.store.HashDelete(context.Background(), nodesKey, d.config.NodeID)
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Check publishes the node's state and compares it with the other live nodes
+func (d *Detector) Check(ctx context.Context) (*Report, error) {
+    state := d.state(ctx)
+    state.Node = d.config.NodeID
+    state.StartedAt = d.startedAt
+    state.PublishedAt = time.Now()
+    
+    data, err := json.Marshal(state)
+    if err != nil {
+        return nil, err
+    }
+    if err := d.store.HashSet(ctx, nodesKey, state.Node, string(data), d.config.staleAfter()); err != nil {
+        return nil, err
+    }
+    
+    report, err := Compare(ctx, d.store, d.config.staleAfter())
+    if err != nil {
+        return nil, err
+    }
+    
+    d.metrics.SetGauge("router_config_drift", boolGauge(report.ConfigDrift()), map[string]string{"kind": "config"})
+    d.metrics.SetGauge("router_config_drift", boolGauge(report.SchemaDrift()), map[string]string{"kind": "schema"})
+    d.metrics.SetGauge("router_cluster_nodes", float64(len(report.Nodes)), nil)
+    d.alert(ctx, report)
+    
+    return report, nil
+}
+
+// alert logs once per distinct disagreement and once when it is resolved
+func (d *Detector) alert(ctx context.Context, report *Report) {
+    signature := ""
+    if report.ConfigDrift() || report.SchemaDrift() {
+        signature = groupSignature(report.ConfigGroups) + "|" + groupSignature(report.SchemaGroups)
+    }
+    if signature == d.lastAlert {
+        return
+    }
+    
+    previous := d.lastAlert
+    d.lastAlert = signature
+    if signature == "" {
+        if previous != "" {
+            logger.WithContext(ctx).WithField("nodes", len(report.Nodes)).Info("Router nodes agree on config and schema again")
+        }
+        return
+    }
+    
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "node":          d.config.NodeID,
+        "config_drift":  report.ConfigDrift(),
+        "schema_drift":  report.SchemaDrift(),
+        "config_groups": report.ConfigGroups,
+        "schema_groups": report.SchemaGroups,
+    }).Error("ALERT: router nodes disagree on effective config or schema version")
+}
+
+// Compare reads the published states and groups the live ones; nodes that
+// stopped publishing longer than staleAfter ago are dropped
+func Compare(ctx context.Context, store Store, staleAfter time.Duration) (*Report, error) {
+    fields, err := store.HashGetAll(ctx, nodesKey)
+    if err != nil {
+        return nil, err
+    }
+    
+    report := &Report{
+        ConfigGroups: make(map[string][]string),
+        SchemaGroups: make(map[string][]string),
+    }
+    cutoff := time.Now().Add(-staleAfter)
+    var stale []string
+    
+    for node, value := range fields {
+        var state NodeState
+        if err := json.Unmarshal([]byte(value), &state); err != nil || state.PublishedAt.Before(cutoff) {
+            stale = append(stale, node)
+            continue
+        }
+        report.Nodes = append(report.Nodes, state)
+        report.ConfigGroups[state.ConfigHash] = append(report.ConfigGroups[state.ConfigHash], state.Node)
+        report.SchemaGroups[state.SchemaKey()] = append(report.SchemaGroups[state.SchemaKey()], state.Node)
+    }
+    if len(stale) > 0 {
+        store.HashDelete(ctx, nodesKey, stale...)
+    }
+    
+    sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].Node < report.Nodes[j].Node })
+    for _, groups := range []map[string][]string{report.ConfigGroups, report.SchemaGroups} {
+        for _, nodes := range groups {
+            sort.Strings(nodes)
+        }
+    }
+    return report, nil
+}
+
+// HashSettings hashes the effective settings with the ignored keys left out.
+// An ignored key also drops everything below it, node specific settings like
+// listen addresses belong there.
+func HashSettings(settings map[string]interface{}, ignore []string) string {
+    flat := make(map[string]interface{})
+    flatten("", settings, flat)
+    
+    keys := make([]string, 0, len(flat))
+    for key := range flat {
+        if !ignored(key, ignore) {
+            keys = append(keys, key)
+        }
+    }
+    sort.Strings(keys)
+    
+    h := sha256.New()
+    for _, key := range keys {
+        value, _ := json.Marshal(flat[key])
+        fmt.Fprintf(h, "%s=%s\n", key, value)
+    }
+    return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func flatten(prefix string, settings map[string]interface{}, flat map[string]interface{}) {
+    for key, value := range settings {
+        if prefix != "" {
+            key = prefix + "." + key
+        }
+        if nested, ok := value.(map[string]interface{}); ok {
+            flatten(key, nested, flat)
+            continue
+        }
+        flat[key] = value
+    }
+}
+
+func ignored(key string, ignore []string) bool {
+    for _, prefix := range ignore {
+        prefix = strings.ToLower(prefix)
+        if key == prefix || strings.HasPrefix(key, prefix+".") {
+            return true
+        }
+    }
+    return false
+}
+
+func groupSignature(groups map[string][]string) string {
+    parts := make([]string, 0, len(groups))
+    for key, nodes := range groups {
+        parts = append(parts, key+"="+strings.Join(nodes, ","))
+    }
+    sort.Strings(parts)
+    return strings.Join(parts, ";")
+}
+
+func largestGroup(groups map[string][]string) string {
+    best := ""
+    for key, nodes := range groups {
+        if best == "" || len(nodes) > len(groups[best]) || (len(nodes) == len(groups[best]) && key < best) {
+            best = key
+        }
+    }
+    return best
+}
+
+func boolGauge(v bool) float64 {
+    if v {
+        return 1
+    }
+    return 0
+}
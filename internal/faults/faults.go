@@ -0,0 +1,232 @@
+// Package faults injects failures into the database, cache, AMI and provider
+// selection paths so resilience behaviour can be exercised outside production.
+package faults
+
+import (
+    "context"
+    "math/rand"
+    "sync"
+    "sync/atomic"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// Fault identifies an injection point
+type Fault string
+
+const (
+    DBLatency         Fault = "db_latency"
+    RedisError        Fault = "redis_error"
+    AMIDisconnect     Fault = "ami_disconnect"
+    ProviderSelection Fault = "provider_selection"
+)
+
+// All lists every supported fault
+var All = []Fault{DBLatency, RedisError, AMIDisconnect, ProviderSelection}
+
+// Rule controls how often a fault fires
+type Rule struct {
+    Rate    float64       // probability between 0 and 1
+    Latency time.Duration // delay added by latency faults
+}
+
+// Config holds the fault injection configuration
+type Config struct {
+    Enabled     bool
+    Environment string
+    Rules       map[Fault]Rule
+}
+
+// Status is a snapshot of a fault for the API and CLI
+type Status struct {
+    Fault    Fault   `json:"fault"`
+    Rate     float64 `json:"rate"`
+    Latency  string  `json:"latency,omitempty"`
+    Injected uint64  `json:"injected"`
+}
+
+// Injector decides whether a fault fires
+type Injector struct {
+    enabled     int32
+    environment string
+    
+    mu       sync.Mutex
+    rules    map[Fault]Rule
+    injected map[Fault]uint64
+    rand     *rand.Rand
+}
+
+var (
+    instance = &Injector{
+        rules:    make(map[Fault]Rule),
+        injected: make(map[Fault]uint64),
+        rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+    }
+)
+
+// Initialize configures the global injector. It refuses to run in production.
+func Initialize(config Config) error {
+    if !config.Enabled {
+        return nil
+    }
+    
+    if config.Environment == "production" {
+        return errors.New(errors.ErrConfiguration, "fault injection cannot be enabled in production")
+    }
+    
+    instance.mu.Lock()
+    instance.environment = config.Environment
+    for fault, rule := range config.Rules {
+        if err := validate(fault, rule); err != nil {
+            instance.mu.Unlock()
+            return err
+        }
+        instance.rules[fault] = rule
+    }
+    instance.mu.Unlock()
+    
+    atomic.StoreInt32(&instance.enabled, 1)
+    
+    logger.WithField("environment", config.Environment).Warn("Fault injection enabled")
+    return nil
+}
+
+// Get returns the global injector
+func Get() *Injector {
+    return instance
+}
+
+// Enabled reports whether fault injection is active
+func (i *Injector) Enabled() bool {
+    return atomic.LoadInt32(&i.enabled) == 1
+}
+
+// Should reports whether the fault fires for this call
+func (i *Injector) Should(fault Fault) bool {
+    if !i.Enabled() {
+        return false
+    }
+    
+    i.mu.Lock()
+    defer i.mu.Unlock()
+    
+    rule, exists := i.rules[fault]
+    if !exists || rule.Rate <= 0 {
+        return false
+    }
+    
+    if rule.Rate < 1 && i.rand.Float64() >= rule.Rate {
+        return false
+    }
+    
+    i.injected[fault]++
+    return true
+}
+
+// Error returns an injected error when the fault fires
+func (i *Injector) Error(fault Fault) error {
+    if !i.Should(fault) {
+        return nil
+    }
+    
+    return errors.New(errors.ErrInternal, "injected fault").WithContext("fault", string(fault))
+}
+
+// Delay sleeps for the configured latency when the fault fires
+func (i *Injector) Delay(ctx context.Context, fault Fault) {
+    if !i.Should(fault) {
+        return
+    }
+    
+    i.mu.Lock()
+    latency := i.rules[fault].Latency
+    i.mu.Unlock()
+    
+    if latency <= 0 {
+        return
+    }
+    
+    timer := time.NewTimer(latency)
+    defer timer.Stop()
+    
+    select {
+    case <-timer.C:
+    case <-ctx.Done():
+    }
+}
+
+// Set changes a fault rule at runtime
+func (i *Injector) Set(fault Fault, rule Rule) error {
+    if !i.Enabled() {
+        return errors.New(errors.ErrConfiguration, "fault injection is not enabled")
+    }
+    
+    if err := validate(fault, rule); err != nil {
+        return err
+    }
+    
+    i.mu.Lock()
+    i.rules[fault] = rule
+    i.mu.Unlock()
+    
+    logger.WithField("fault", string(fault)).WithField("rate", rule.Rate).Warn("Fault injection rule updated")
+    return nil
+}
+
+// Clear disables every fault without turning injection off
+func (i *Injector) Clear() {
+    i.mu.Lock()
+    i.rules = make(map[Fault]Rule)
+    i.mu.Unlock()
+    
+    logger.Warn("Fault injection rules cleared")
+}
+
+// Snapshot returns the current rules and how many times each fault fired
+func (i *Injector) Snapshot() []Status {
+    i.mu.Lock()
+    defer i.mu.Unlock()
+    
+    statuses := make([]Status, 0, len(All))
+    for _, fault := range All {
+        rule := i.rules[fault]
+        status := Status{
+            Fault:    fault,
+            Rate:     rule.Rate,
+            Injected: i.injected[fault],
+        }
+        if rule.Latency > 0 {
+            status.Latency = rule.Latency.String()
+        }
+        statuses = append(statuses, status)
+    }
+    
+    return statuses
+}
+
+// Parse converts a fault name into a Fault
+func Parse(name string) (Fault, error) {
+    for _, fault := range All {
+        if string(fault) == name {
+            return fault, nil
+        }
+    }
+    return "", errors.New(errors.ErrConfiguration, "unknown fault").WithContext("fault", name)
+}
+
+func validate(fault Fault, rule Rule) error {
+    if _, err := Parse(string(fault)); err != nil {
+        return err
+    }
+    if rule.Rate < 0 || rule.Rate > 1 {
+        return errors.New(errors.ErrConfiguration, "fault rate must be between 0 and 1").
+            WithContext("fault", string(fault))
+    }
+    if fault == DBLatency && rule.Rate > 0 && rule.Latency <= 0 {
+        return errors.New(errors.ErrConfiguration, "db_latency requires a latency").
+            WithContext("fault", string(fault))
+    }
+    return nil
+}
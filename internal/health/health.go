@@ -16,6 +16,8 @@ type HealthService struct {
     mu          sync.RWMutex
     checks      map[string]Checker
     readyChecks map[string]Checker
+    degraded    map[string]bool
+    router      *mux.Router
     server      *http.Server
 }
 
@@ -46,11 +48,13 @@ func NewHealthService(port int) *HealthService {
     hs := &HealthService{
 checks:      make(map[string]Checker),
        readyChecks: make(map[string]Checker),
+       degraded:    make(map[string]bool),
    }
    
    router := mux.NewRouter()
    router.HandleFunc("/health/live", hs.handleLiveness).Methods("GET")
    router.HandleFunc("/health/ready", hs.handleReadiness).Methods("GET")
+   hs.router = router
    
    hs.server = &http.Server{
        Addr:         fmt.Sprintf(":%d", port),
@@ -83,17 +87,38 @@ func (hs *HealthService) RegisterReadinessCheck(name string, check Checker) {
    hs.mu.Lock()
    defer hs.mu.Unlock()
    hs.readyChecks[name] = check
+   delete(hs.degraded, name)
+}
+
+// RegisterDegradedCheck adds a readiness check for a dependency the router
+// can serve without. Its failure reports the service degraded, still ready.
+func (hs *HealthService) RegisterDegradedCheck(name string, check Checker) {
+   hs.mu.Lock()
+   defer hs.mu.Unlock()
+   hs.readyChecks[name] = check
+   hs.degraded[name] = true
+}
+
+// RegisterInfo serves what info returns as JSON on path, for build and
+// deployment details next to the health checks
+func (hs *HealthService) RegisterInfo(path string, info func(ctx context.Context) interface{}) {
+   hs.router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+       w.Header().Set("Content-Type", "application/json")
+       json.NewEncoder(w).Encode(info(r.Context()))
+   }).Methods("GET")
 }
 
 func (hs *HealthService) handleLiveness(w http.ResponseWriter, r *http.Request) {
-   hs.handleCheck(w, r, hs.checks)
+   hs.handleCheck(w, r, hs.checks, nil)
 }
 
 func (hs *HealthService) handleReadiness(w http.ResponseWriter, r *http.Request) {
-   hs.handleCheck(w, r, hs.readyChecks)
+   hs.handleCheck(w, r, hs.readyChecks, hs.degraded)
 }
 
-func (hs *HealthService) handleCheck(w http.ResponseWriter, r *http.Request, checks map[string]Checker) {
+// handleCheck runs checks, the status is degraded rather than failed when
+// only checks in degraded fail
+func (hs *HealthService) handleCheck(w http.ResponseWriter, r *http.Request, checks map[string]Checker, degraded map[string]bool) {
    ctx := r.Context()
    start := time.Now()
    
@@ -129,7 +154,6 @@ func (hs *HealthService) handleCheck(w http.ResponseWriter, r *http.Request, che
            if err != nil {
                result.Status = "failed"
                result.Error = err.Error()
-               response.Status = "failed"
            }
            
            resultChan <- struct {
@@ -146,12 +170,20 @@ func (hs *HealthService) handleCheck(w http.ResponseWriter, r *http.Request, che
    
    for res := range resultChan {
        response.Checks[res.name] = res.result
+       if res.result.Status == "ok" || response.Status == "failed" {
+           continue
+       }
+       if degraded[res.name] {
+           response.Status = "degraded"
+       } else {
+           response.Status = "failed"
+       }
    }
    
    response.TotalTime = time.Since(start).String()
    
    w.Header().Set("Content-Type", "application/json")
-   if response.Status != "ok" {
+   if response.Status == "failed" {
        w.WriteHeader(http.StatusServiceUnavailable)
    }
    
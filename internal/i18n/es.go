@@ -0,0 +1,541 @@
+package i18n
+
+// spanish translates the CLI and API messages operators and customers see
+var spanish = map[string]string{
+    // CLI
+    "Error":                         "Error",
+    "failed to load config":         "no se pudo cargar la configuración",
+    "failed to initialize logger":   "no se pudo inicializar el registro",
+    "failed to initialize database": "no se pudo inicializar la base de datos",
+    "database not healthy":          "la base de datos no está operativa",
+    "AMI is not connected":          "AMI no está conectado",
+    "AMI not connected":             "AMI no está conectado",
+    "doctor found problems":         "el diagnóstico encontró problemas",
+    "doctor found %d problems":      "el diagnóstico encontró %d problemas",
+    "import cancelled":              "importación cancelada",
+    "%d providers failed to import": "%d proveedores no se pudieron importar",
+    "failed to start transaction":   "no se pudo iniciar la transacción",
+    "failed to commit transaction":  "no se pudo confirmar la transacción",
+    "failed to commit import":       "no se pudo confirmar la importación",
+    "failed to prepare insert":      "no se pudo preparar la inserción",
+    "failed to open %s":             "no se pudo abrir %s",
+    "failed to parse %s":            "no se pudo interpretar %s",
+    "failed to write %s":            "no se pudo escribir %s",
+    "failed to create %s":           "no se pudo crear %s",
+    "failed to update %s":           "no se pudo actualizar %s",
+    "failed to snapshot %s":         "no se pudo consolidar %s",
+    "failed to open CSV file":       "no se pudo abrir el archivo CSV",
+    "failed to read CSV":            "no se pudo leer el CSV",
+    "failed to write CSV":           "no se pudo escribir el CSV",
+    "failed to write YAML":          "no se pudo escribir el YAML",
+    "unknown file %q":               "archivo desconocido %q",
+
+    // Providers
+    "failed to create provider":                           "no se pudo crear el proveedor",
+    "failed to get provider":                              "no se pudo obtener el proveedor",
+    "failed to list providers":                            "no se pudieron listar los proveedores",
+    "failed to delete provider":                           "no se pudo eliminar el proveedor",
+    "failed to test provider":                             "no se pudo probar el proveedor",
+    "failed to release provider":                          "no se pudo liberar el proveedor",
+    "failed to list quarantined providers":                "no se pudieron listar los proveedores en cuarentena",
+    "failed to list provider events":                      "no se pudieron listar los eventos del proveedor",
+    "failed to set credentials":                           "no se pudieron establecer las credenciales",
+    "failed to rotate credentials":                        "no se pudieron rotar las credenciales",
+    "failed to expire previous credential":                "no se pudo caducar la credencial anterior",
+    "failed to list contacts":                             "no se pudieron listar los contactos",
+    "failed to set dial options":                          "no se pudieron establecer las opciones de marcación",
+    "failed to list dial options":                         "no se pudieron listar las opciones de marcación",
+    "failed to delete dial options":                       "no se pudieron eliminar las opciones de marcación",
+    "invalid dial options":                                "opciones de marcación no válidas",
+    "no dial option given":                                "no se indicó ninguna opción de marcación",
+    "no dial option given, use --clear to remove them":    "no se indicó ninguna opción de marcación, use --clear para eliminarlas",
+    "provider name or --where is required":                "se requiere el nombre del proveedor o --where",
+    "--where is required":                                 "se requiere --where",
+    "no providers match %s":                               "ningún proveedor coincide con %s",
+    "no providers found in %s":                            "no se encontraron proveedores en %s",
+    "nothing to change, give key=value pairs or --remove": "nada que cambiar, indique pares clave=valor o --remove",
+    "unknown setting to clear: %s":                        "ajuste desconocido para borrar: %s",
+    "unknown event type %q":                               "tipo de evento desconocido %q",
+    "invalid billing %q, expected minimum/increment":      "facturación %q no válida, se espera mínimo/incremento",
+    "invalid billing minimum %q":                          "mínimo de facturación %q no válido",
+    "invalid billing increment %q":                        "incremento de facturación %q no válido",
+    "provider not found":                                  "proveedor no encontrado",
+    "provider already exists":                             "el proveedor ya existe",
+    "provider name is required":                           "se requiere el nombre del proveedor",
+    "provider type is required":                           "se requiere el tipo de proveedor",
+    "provider host is required":                           "se requiere el host del proveedor",
+    "invalid provider type":                               "tipo de proveedor no válido",
+    "provider is in use by routes":                        "el proveedor está en uso por rutas",
+    "provider is quarantined":                             "el proveedor está en cuarentena",
+    "provider is not quarantined":                         "el proveedor no está en cuarentena",
+    "no providers available":                              "no hay proveedores disponibles",
+    "failed to update provider":                           "no se pudo actualizar el proveedor",
+    "host and port already used by another provider":      "el host y el puerto ya los usa otro proveedor",
+    "address already identifies another endpoint":         "la dirección ya identifica a otro endpoint",
+    "failed to check provider hosts":                      "no se pudieron comprobar los hosts de los proveedores",
+    "failed to check identify entries":                    "no se pudieron comprobar las entradas de identificación",
+    "failed to check provider conflicts":                  "no se pudieron comprobar los conflictos entre proveedores",
+    "%d provider conflicts found":                         "se encontraron %d conflictos entre proveedores",
+
+    // Groups
+    "failed to create group":                                      "no se pudo crear el grupo",
+    "failed to get group":                                         "no se pudo obtener el grupo",
+    "failed to list groups":                                       "no se pudieron listar los grupos",
+    "failed to delete group":                                      "no se pudo eliminar el grupo",
+    "failed to refresh group":                                     "no se pudo actualizar el grupo",
+    "failed to add provider to group":                             "no se pudo añadir el proveedor al grupo",
+    "failed to remove provider from group":                        "no se pudo quitar el proveedor del grupo",
+    "invalid group type: %s":                                      "tipo de grupo no válido: %s",
+    "group not found":                                             "grupo no encontrado",
+    "group name is required":                                      "se requiere el nombre del grupo",
+    "pattern is required for regex groups":                        "los grupos regex requieren un patrón",
+    "field, operator, and value are required for metadata groups": "los grupos de metadatos requieren campo, operador y valor",
+    "group is at its member limit":                                "el grupo alcanzó su límite de miembros",
+    "failed to count group members":                               "no se pudieron contar los miembros del grupo",
+    "failed to query group members":                               "no se pudieron consultar los miembros del grupo",
+    "failed to nest group":                                        "no se pudo anidar el grupo",
+    "failed to remove nested group":                               "no se pudo quitar el grupo anidado",
+    "failed to query nested groups":                               "no se pudieron consultar los grupos anidados",
+    "failed to query provider groups":                             "no se pudieron consultar los grupos del proveedor",
+    "a group cannot contain itself":                               "un grupo no puede contenerse a sí mismo",
+    "group nesting would create a cycle":                          "el anidamiento de grupos crearía un ciclo",
+    "groups would nest %d levels deep, at most %d are resolved":   "los grupos se anidarían %d niveles, se resuelven como máximo %d",
+    "group is not nested in the group":                            "el grupo no está anidado en el grupo",
+    "group is nested in other groups":                             "el grupo está anidado en otros grupos",
+    "failed to get group members":                                 "no se pudieron obtener los miembros del grupo",
+    "at least one --rule is required for dynamic groups":          "los grupos dinámicos requieren al menos una --rule",
+    "invalid rule %q, expected field:operator:value":              "regla %q no válida, se esperaba campo:operador:valor",
+    "match rules are required for dynamic groups":                 "los grupos dinámicos requieren reglas de coincidencia",
+    "match rules need a field":                                    "las reglas de coincidencia requieren un campo",
+    "unknown match operator":                                      "operador de coincidencia desconocido",
+    "invalid group type":                                          "tipo de grupo no válido",
+    "weight can't be negative":                                    "el peso no puede ser negativo",
+    "give a group or --all":                                       "indique un grupo o --all",
+    "failed to refresh %d groups":                                 "no se pudieron actualizar %d grupos",
+
+    // DIDs
+    "failed to get DID":                           "no se pudo obtener el DID",
+    "failed to list DIDs":                         "no se pudieron listar los DID",
+    "failed to search DIDs":                       "no se pudieron buscar los DID",
+    "failed to update DIDs":                       "no se pudieron actualizar los DID",
+    "failed to delete DID":                        "no se pudo eliminar el DID",
+    "failed to release DID":                       "no se pudo liberar el DID",
+    "cannot delete DID %s: currently in use":      "no se puede eliminar el DID %s: está en uso",
+    "no DIDs specified":                           "no se indicaron DID",
+    "--status must be available, in_use or all":   "--status debe ser available, in_use o all",
+    "DID not found":                               "DID no encontrado",
+    "no available DIDs":                           "no hay DID disponibles",
+    "failed to read DID file":                     "no se pudo leer el archivo de DID",
+    "failed to import DIDs":                       "no se pudieron importar los DID",
+    "failed to query DIDs":                        "no se pudieron consultar los DID",
+    "no DIDs found in %s":                         "no se encontraron DID en %s",
+    "%d DIDs failed to import":                    "%d DID no se pudieron importar",
+    "unknown column in DID file header":           "columna desconocida en la cabecera del archivo de DID",
+    "DID file header has no number column":        "la cabecera del archivo de DID no tiene columna number",
+    "no DIDs available under the rotation policy": "no hay DID disponibles según la política de rotación",
+    "DID stats period must be positive":           "el período de las estadísticas de DID debe ser positivo",
+    "failed to query DID allocations":             "no se pudieron consultar las asignaciones de DID",
+    "failed to scan DID allocations":              "no se pudieron leer las asignaciones de DID",
+    "failed to get DID stats":                     "no se pudieron obtener las estadísticas de DID",
+
+    // Routes
+    "failed to create route":        "no se pudo crear la ruta",
+    "failed to get route":           "no se pudo obtener la ruta",
+    "failed to list routes":         "no se pudieron listar las rutas",
+    "failed to update route":        "no se pudo actualizar la ruta",
+    "failed to delete route":        "no se pudo eliminar la ruta",
+    "failed to create route policy": "no se pudo crear la política de ruta",
+    "failed to get route policy":    "no se pudo obtener la política de ruta",
+    "failed to list route policies": "no se pudieron listar las políticas de ruta",
+    "failed to update route policy": "no se pudo actualizar la política de ruta",
+    "failed to delete route policy": "no se pudo eliminar la política de ruta",
+    "invalid inbound match":         "coincidencia de entrada no válida",
+    "route not found":               "ruta no encontrada",
+    "route policy not found":        "política de ruta no encontrada",
+    "route policy is in use":        "la política de ruta está en uso",
+    "route at maximum capacity":     "la ruta está a su capacidad máxima",
+    "no route for provider":         "no hay ruta para el proveedor",
+
+    // Limits, blocks and kill switches
+    "failed to set country limit":                      "no se pudo establecer el límite por país",
+    "failed to list country limits":                    "no se pudieron listar los límites por país",
+    "failed to delete country limit":                   "no se pudo eliminar el límite por país",
+    "failed to set short call limit":                   "no se pudo establecer el límite de llamadas cortas",
+    "failed to list short call limits":                 "no se pudieron listar los límites de llamadas cortas",
+    "failed to delete short call limit":                "no se pudo eliminar el límite de llamadas cortas",
+    "failed to compute short call ratios":              "no se pudieron calcular las proporciones de llamadas cortas",
+    "failed to add block":                              "no se pudo añadir el bloqueo",
+    "failed to list blocks":                            "no se pudieron listar los bloqueos",
+    "failed to remove block":                           "no se pudo eliminar el bloqueo",
+    "failed to unblock":                                "no se pudo desbloquear",
+    "invalid block id: %s":                             "id de bloqueo no válido: %s",
+    "exactly one of --prefix or --country is required": "se requiere exactamente uno de --prefix o --country",
+    "failed to engage kill switch":                     "no se pudo activar el paro de emergencia",
+    "failed to list kill switches":                     "no se pudieron listar los paros de emergencia",
+    "failed to release kill switch":                    "no se pudo liberar el paro de emergencia",
+    "invalid kill switch id: %s":                       "id de paro de emergencia no válido: %s",
+    "--customer and --route can't be combined":         "--customer y --route no se pueden combinar",
+    "kill switch not found":                            "paro de emergencia no encontrado",
+    "kill switch needs a reason":                       "el paro de emergencia necesita un motivo",
+    "new calls are suspended":                          "las llamadas nuevas están suspendidas",
+    "new calls are paused while Asterisk restarts":     "las llamadas nuevas están en pausa mientras Asterisk se reinicia",
+    "country must be an ISO 3166 alpha-2 code":         "el país debe ser un código ISO 3166 alfa-2",
+
+    // Incidents
+    "failed to list incidents":      "no se pudieron listar los incidentes",
+    "failed to get incident":        "no se pudo obtener el incidente",
+    "failed to resolve incident":    "no se pudo resolver el incidente",
+    "invalid incident id: %s":       "id de incidente no válido: %s",
+    "invalid incident id":           "id de incidente no válido",
+    "incident not found":            "incidente no encontrado",
+    "no open incident with that id": "no hay ningún incidente abierto con ese id",
+
+    // Statistics, dispositions and probes
+    "failed to get statistics":                         "no se pudieron obtener las estadísticas",
+    "failed to get daily statistics":                   "no se pudieron obtener las estadísticas diarias",
+    "failed to snapshot statistics":                    "no se pudieron consolidar las estadísticas",
+    "failed to get calls":                              "no se pudieron obtener las llamadas",
+    "failed to get dispositions":                       "no se pudieron obtener las disposiciones",
+    "failed to set disposition mapping":                "no se pudo establecer la correspondencia de disposiciones",
+    "failed to list disposition mapping":               "no se pudo listar la correspondencia de disposiciones",
+    "failed to delete disposition mapping":             "no se pudo eliminar la correspondencia de disposiciones",
+    "failed to get FAS scores":                         "no se pudieron obtener las puntuaciones FAS",
+    "FAS evaluation failed":                            "la evaluación FAS falló",
+    "failed to build verification report":              "no se pudo generar el informe de verificación",
+    "failed to save probe":                             "no se pudo guardar la sonda",
+    "failed to update probe":                           "no se pudo actualizar la sonda",
+    "failed to delete probe":                           "no se pudo eliminar la sonda",
+    "failed to list probes":                            "no se pudieron listar las sondas",
+    "failed to get results":                            "no se pudieron obtener los resultados",
+    "probe failed":                                     "la sonda falló",
+    "failed to read node states":                       "no se pudieron leer los estados de los nodos",
+    "failed to generate hints":                         "no se pudieron generar las pistas",
+    "failed to write hints":                            "no se pudieron escribir las pistas",
+    "--ssh is required with --push ssh":                "se requiere --ssh con --push ssh",
+    "unknown push method %q, use ami or ssh":           "método de envío desconocido %q, use ami o ssh",
+    "unknown action %q, use enable, disable or delete": "acción desconocida %q, use enable, disable o delete",
+    "raw call records of this day have been pruned":    "los registros de llamadas de este día ya se depuraron",
+    "call not found":                                   "llamada no encontrada",
+
+    // API tokens and CDR exports
+    "failed to create API token":                      "no se pudo crear el token de API",
+    "failed to list API tokens":                       "no se pudieron listar los tokens de API",
+    "failed to revoke API token":                      "no se pudo revocar el token de API",
+    "invalid API token id: %s":                        "id de token de API no válido: %s",
+    "API token not found":                             "token de API no encontrado",
+    "API tokens are issued to inbound providers only": "los tokens de API solo se emiten a proveedores de entrada",
+    "failed to create CDR export":                     "no se pudo crear la exportación de CDR",
+    "failed to list CDR exports":                      "no se pudieron listar las exportaciones de CDR",
+    "failed to update CDR export":                     "no se pudo actualizar la exportación de CDR",
+    "failed to remove CDR export":                     "no se pudo eliminar la exportación de CDR",
+    "failed to list CDR export runs":                  "no se pudieron listar las ejecuciones de exportación de CDR",
+    "CDR export failed":                               "la exportación de CDR falló",
+    "CDR export not found":                            "exportación de CDR no encontrada",
+    "CDR export run not found":                        "ejecución de exportación de CDR no encontrada",
+    "invalid CDR export":                              "exportación de CDR no válida",
+    "CDR exports are for inbound providers only":      "las exportaciones de CDR son solo para proveedores de entrada",
+    "invalid --rename %q, expected field=name":        "--rename %q no válido, se espera campo=nombre",
+    "webhook request failed":                          "la petición al webhook falló",
+    "invalid webhook destination":                     "destino de webhook no válido",
+    "invalid run id: %s":                              "id de ejecución no válido: %s",
+    "invalid date %q, expected YYYY-MM-DD":            "fecha %q no válida, se espera AAAA-MM-DD",
+    "invalid date %q, use YYYY-MM-DD":                 "fecha %q no válida, use AAAA-MM-DD",
+
+    // Provider contracts
+    "failed to set contract":                                         "no se pudo establecer el contrato",
+    "failed to get contract":                                         "no se pudo obtener el contrato",
+    "failed to remove contract":                                      "no se pudo eliminar el contrato",
+    "failed to get contract status":                                  "no se pudo obtener el estado de los contratos",
+    "provider has no contract":                                       "el proveedor no tiene contrato",
+    "provider %s has no contract":                                    "el proveedor %s no tiene contrato",
+    "contract commitments can't be negative":                         "los compromisos del contrato no pueden ser negativos",
+    "maximum monthly minutes are below the minimum commitment":       "los minutos mensuales máximos son inferiores al compromiso mínimo",
+    "contract ends before it starts":                                 "el contrato termina antes de empezar",
+    "invalid --%s %q, expected YYYY-MM-DD":                           "--%s %q no válido, se espera AAAA-MM-DD",
+
+    // Provider SLAs
+    "failed to set SLA":                   "no se pudo establecer el SLA",
+    "failed to get SLA":                   "no se pudo obtener el SLA",
+    "failed to remove SLA":                "no se pudo eliminar el SLA",
+    "failed to get SLA reports":           "no se pudieron obtener los informes de SLA",
+    "failed to build SLA reports":         "no se pudieron calcular los informes de SLA",
+    "failed to generate SLA reports":      "no se pudieron generar los informes de SLA",
+    "provider has no SLA":                 "el proveedor no tiene SLA",
+    "SLA targets can't be negative":       "los objetivos del SLA no pueden ser negativos",
+    "SLA percentages can't exceed 100":    "los porcentajes del SLA no pueden superar 100",
+    "invalid SLA month, expected YYYY-MM": "mes de SLA no válido, se espera AAAA-MM",
+    "SLA month hasn't started":            "el mes del SLA no ha empezado",
+    "--month is required":                 "--month es obligatorio",
+
+    // Provider scorecards
+    "failed to build scorecard":         "no se pudo calcular la puntuación",
+    "scorecard period must be positive": "el periodo de la puntuación debe ser positivo",
+    "period must be positive":           "el periodo debe ser positivo",
+    "invalid period %q":                 "periodo %q no válido",
+
+    // Downtime
+    "failed to get downtime":                        "no se pudo obtener el tiempo de inactividad",
+    "failed to get provider reliability":            "no se pudo obtener la fiabilidad de los proveedores",
+    "downtime period must end after it starts":      "el periodo de inactividad debe terminar después de empezar",
+    "invalid scope %q, expected provider or system": "ámbito %q no válido, se esperaba provider o system",
+
+    // Rate limits
+    "failed to set rate limit":                                   "no se pudo establecer el límite de tráfico",
+    "failed to get rate limits":                                  "no se pudieron obtener los límites de tráfico",
+    "failed to remove rate limit":                                "no se pudo eliminar el límite de tráfico",
+    "rate limit reached":                                         "límite de tráfico alcanzado",
+    "all providers at their rate limit":                          "todos los proveedores están en su límite de tráfico",
+    "rate limit not found":                                       "límite de tráfico no encontrado",
+    "rate limit caps can't be negative":                          "los topes del límite de tráfico no pueden ser negativos",
+    "rate limit needs a CPS or concurrent call cap":              "el límite de tráfico necesita un tope de CPS o de llamadas simultáneas",
+    "rate limit scope must be route, provider or prefix":         "el ámbito del límite de tráfico debe ser route, provider o prefix",
+    "exactly one of --route, --provider or --prefix is required": "se requiere exactamente uno de --route, --provider o --prefix",
+    "invalid scope %q, expected route, provider or prefix":       "ámbito %q no válido, se esperaba route, provider o prefix",
+    "No rate limits":                                             "No hay límites de tráfico",
+
+    // Route weight curves
+    "failed to set weight curve":                 "no se pudo establecer la curva de pesos",
+    "failed to get weight curves":                "no se pudieron obtener las curvas de pesos",
+    "failed to remove weight curve":              "no se pudo eliminar la curva de pesos",
+    "curve weights can't be negative":            "los pesos de la curva no pueden ser negativos",
+    "unknown time zone":                          "zona horaria desconocida",
+    "provider is not dialed by the route":        "la ruta no marca al proveedor",
+    "route has no weight curve for the provider": "la ruta no tiene curva de pesos para el proveedor",
+    "expected %d weights, got %d":                "se esperaban %d pesos, se recibieron %d",
+    "invalid weight %q":                          "peso %q no válido",
+    "invalid hour range %q":                      "rango de horas %q no válido",
+    "hour %d is set twice":                       "la hora %d está definida dos veces",
+    "hour %d has no weight":                      "la hora %d no tiene peso",
+
+    // Route cost ceilings
+    "failed to set cost ceiling":                "no se pudo establecer el tope de coste",
+    "failed to get cost ceilings":               "no se pudieron obtener los topes de coste",
+    "failed to remove cost ceiling":             "no se pudo eliminar el tope de coste",
+    "cost ceiling must be positive":             "el tope de coste debe ser positivo",
+    "minimum ASR must be between 0 and 100":     "el ASR mínimo debe estar entre 0 y 100",
+    "maximum PDD can't be negative":             "el PDD máximo no puede ser negativo",
+    "currency must be a 3 letter ISO 4217 code": "la moneda debe ser un código ISO 4217 de 3 letras",
+    "route has no cost ceiling":                 "la ruta no tiene tope de coste",
+
+    // Route queues
+    "route queue timed out":                     "se agotó la espera en la cola de la ruta",
+    "route queue full":                          "la cola de la ruta está llena",
+    "call left the route queue":                 "la llamada abandonó la cola de la ruta",
+    "queue timeout can't be negative":           "el tiempo de espera en cola no puede ser negativo",
+    "queue timeout must be a number of seconds": "el tiempo de espera en cola debe ser un número de segundos",
+    "failed to update route queue timeout":      "no se pudo actualizar el tiempo de espera en cola de la ruta",
+    "failed to set route queue timeout":         "no se pudo establecer el tiempo de espera en cola de la ruta",
+    "failed to reserve route slot":              "no se pudo reservar un hueco en la ruta",
+
+    // Holidays
+    "failed to add holiday":                                                         "no se pudo añadir el festivo",
+    "failed to list holidays":                                                       "no se pudieron listar los festivos",
+    "failed to remove holiday":                                                      "no se pudo eliminar el festivo",
+    "failed to import holidays":                                                     "no se pudieron importar los festivos",
+    "failed to open calendar":                                                       "no se pudo abrir el calendario",
+    "failed to read calendar":                                                       "no se pudo leer el calendario",
+    "holiday not found":                                                             "festivo no encontrado",
+    "holiday name is required":                                                      "el nombre del festivo es obligatorio",
+    "invalid holiday date, expected YYYY-MM-DD":                                     "fecha de festivo no válida, se espera AAAA-MM-DD",
+    "invalid date, expected YYYY-MM-DD":                                             "fecha no válida, se espera AAAA-MM-DD",
+    "calendar has no events":                                                        "el calendario no tiene eventos",
+    "invalid event start in calendar":                                               "inicio de evento no válido en el calendario",
+    "calendar event covers too many days":                                           "el evento del calendario abarca demasiados días",
+    "unsupported recurrence in calendar":                                            "recurrencia no admitida en el calendario",
+    "a holiday country is needed to exclude holidays outside the country dimension": "se necesita un país de festivos para excluirlos fuera de la dimensión de país",
+    "holiday_country is required to exclude holidays outside the country dimension": "holiday_country es obligatorio para excluir festivos fuera de la dimensión de país",
+
+    // Billing and rating
+    "failed to set rate":                             "no se pudo establecer la tarifa",
+    "failed to list rates":                           "no se pudieron listar las tarifas",
+    "failed to remove rate":                          "no se pudo eliminar la tarifa",
+    "failed to import rates":                         "no se pudieron importar las tarifas",
+    "failed to open rate deck":                       "no se pudo abrir la tabla de tarifas",
+    "failed to read rate deck":                       "no se pudo leer la tabla de tarifas",
+    "failed to get billing":                          "no se pudo obtener la facturación",
+    "failed to set customer rate":                    "no se pudo establecer la tarifa del cliente",
+    "failed to query customer rates":                 "no se pudieron consultar las tarifas de clientes",
+    "failed to remove customer rates":                "no se pudieron eliminar las tarifas del cliente",
+    "failed to delete customer rate":                 "no se pudo eliminar la tarifa del cliente",
+    "customer rate not found":                        "tarifa de cliente no encontrada",
+    "rate decks are for inbound providers only":      "las tablas de tarifas son solo para proveedores de entrada",
+    "rate deck is empty":                             "la tabla de tarifas está vacía",
+    "prefix must contain digits":                     "el prefijo debe contener dígitos",
+    "negative rate for prefix %s":                    "tarifa negativa para el prefijo %s",
+    "invalid currency %q, expected an ISO 4217 code": "moneda %q no válida, se espera un código ISO 4217",
+    "prefix %s listed twice in rate deck":            "prefijo %s repetido en la tabla de tarifas",
+    "line %d: expected prefix and rate":              "línea %d: se esperan prefijo y tarifa",
+    "line %d: invalid rate %q":                       "línea %d: tarifa %q no válida",
+    "line %d: invalid connection fee %q":             "línea %d: cargo de conexión %q no válido",
+    "invalid rate %q":                                "tarifa %q no válida",
+    "failed to query billing":                        "no se pudo consultar la facturación",
+    "failed to query DID costs":                      "no se pudieron consultar los costes de los DIDs",
+
+    // DID procurement
+    "failed to set DID watermark":     "no se pudo establecer la marca mínima de DIDs",
+    "failed to list DID watermarks":   "no se pudieron listar las marcas mínimas de DIDs",
+    "failed to remove DID watermark":  "no se pudo eliminar la marca mínima de DIDs",
+    "DID watermark not found":         "marca mínima de DIDs no encontrada",
+    "failed to create DID order":      "no se pudo crear el pedido de DIDs",
+    "failed to list DID orders":       "no se pudieron listar los pedidos de DIDs",
+    "failed to update DID order":      "no se pudo actualizar el pedido de DIDs",
+    "failed to deliver DID order":     "no se pudo entregar el pedido de DIDs",
+    "failed to cancel DID order":      "no se pudo cancelar el pedido de DIDs",
+    "failed to place DID order":       "no se pudo colocar el pedido de DIDs",
+    "DID order not found":             "pedido de DIDs no encontrado",
+    "DID order is already %s":         "el pedido de DIDs ya está %s",
+    "unknown DID orderer %q":          "gestor de pedidos de DIDs %q desconocido",
+    "order quantity must be positive": "la cantidad del pedido debe ser positiva",
+    "invalid order id: %s":            "id de pedido no válido: %s",
+
+    // DID aging
+    "failed to get DID history":                              "no se pudo obtener el historial del DID",
+    "failed to check DID history":                            "no se pudo comprobar el historial del DID",
+    "failed to record DID history":                           "no se pudo registrar el historial del DID",
+    "failed to quarantine DID":                               "no se pudo poner el DID en cuarentena",
+    "failed to release DID quarantine":                       "no se pudo levantar la cuarentena del DID",
+    "DID is not quarantined":                                 "el DID no está en cuarentena",
+    "--status must be available, in_use, quarantined or all": "--status debe ser available, in_use, quarantined o all",
+
+    // DID lookup
+    "failed to look up DID": "no se pudo consultar el DID",
+    "invalid window %q":     "ventana %q no válida",
+
+    // Backups
+    "failed to take snapshot":                               "no se pudo tomar la instantánea",
+    "failed to list snapshots":                              "no se pudieron listar las instantáneas",
+    "failed to restore snapshot":                            "no se pudo restaurar la instantánea",
+    "failed to query snapshots":                             "no se pudieron consultar las instantáneas",
+    "failed to record snapshot":                             "no se pudo registrar la instantánea",
+    "failed to snapshot the configuration before restoring": "no se pudo tomar una instantánea de la configuración antes de restaurar",
+    "failed to fetch snapshot":                              "no se pudo descargar la instantánea",
+    "failed to open snapshot":                               "no se pudo abrir la instantánea",
+    "failed to read snapshot":                               "no se pudo leer la instantánea",
+    "failed to write snapshot file":                         "no se pudo escribir el archivo de la instantánea",
+    "failed to read table":                                  "no se pudo leer la tabla",
+    "failed to empty table":                                 "no se pudo vaciar la tabla",
+    "failed to restore table":                               "no se pudo restaurar la tabla",
+    "snapshot not found":                                    "instantánea no encontrada",
+    "invalid snapshot id":                                   "id de instantánea no válido",
+    "unknown backup set":                                    "conjunto de respaldo desconocido",
+    "snapshot checksum mismatch":                            "la suma de verificación de la instantánea no coincide",
+    "snapshot file holds another snapshot":                  "el archivo contiene otra instantánea",
+    "s3 backups need router.backup.s3 credentials":          "los respaldos en s3 necesitan las credenciales router.backup.s3",
+    "s3 request failed":                                     "la petición a s3 falló",
+    "--snapshot is required":                                "--snapshot es obligatorio",
+
+    // Cache
+    "failed to flush cache":                   "no se pudo vaciar la caché",
+    "unknown cache namespace":                 "espacio de nombres de caché desconocido",
+    "failed to bump cache namespace versions": "no se pudieron incrementar las versiones de los espacios de nombres de caché",
+    "Redis not connected, caching disabled":   "Redis no conectado, caché desactivada",
+
+    // Failover routes
+    "a route can't fail over to itself":                   "una ruta no puede conmutar a sí misma",
+    "failover route %s given twice":                       "ruta de conmutación %s indicada dos veces",
+    "failed to update route failover":                     "no se pudieron actualizar las rutas de conmutación",
+    "no failover route left for route %s":                 "no quedan rutas de conmutación para la ruta %s",
+    "no active call for failed leg":                       "no hay llamada activa para el tramo fallido",
+    "call is not dialing a provider":                      "la llamada no está marcando a un proveedor",
+    "no failover route given, use --clear to remove them": "no se indicó ninguna ruta de conmutación, use --clear para eliminarlas",
+    "failed to set failover routes":                       "no se pudieron establecer las rutas de conmutación",
+    "invalid failover route":                              "ruta de conmutación no válida",
+
+    // Read-only mode
+    "management plane is read-only":              "el plano de gestión está en solo lectura",
+    "read-only mode is set in the configuration": "el modo de solo lectura está fijado en la configuración",
+    "failed to query read-only mode":             "no se pudo consultar el modo de solo lectura",
+    "failed to set read-only mode":               "no se pudo establecer el modo de solo lectura",
+    "failed to enable read-only mode":            "no se pudo activar el modo de solo lectura",
+    "failed to disable read-only mode":           "no se pudo desactivar el modo de solo lectura",
+    "failed to get read-only mode":               "no se pudo obtener el modo de solo lectura",
+
+    // Route schedules
+    "invalid schedule %q, expected days HH:MM-HH:MM [timezone]":    "horario %q no válido, se esperaba días HH:MM-HH:MM [zona horaria]",
+    "invalid schedule hours %q, expected HH:MM-HH:MM":              "horas de horario %q no válidas, se esperaba HH:MM-HH:MM",
+    "unknown day %q in schedule":                                   "día %q desconocido en el horario",
+    "schedule holidays must be an ISO 3166 alpha-2 country code":   "los festivos del horario deben ser un código de país ISO 3166 alfa-2",
+    "schedule window has no days":                                  "la franja del horario no tiene días",
+    "empty schedule window %s-%s, use 00:00-24:00 for a whole day": "franja de horario %s-%s vacía, use 00:00-24:00 para el día completo",
+    "invalid time %q in schedule, expected HH:MM":                  "hora %q no válida en el horario, se esperaba HH:MM",
+    "unknown time zone %q in schedule":                             "zona horaria %q desconocida en el horario",
+    "failed to update route schedule":                              "no se pudo actualizar el horario de la ruta",
+    "holidays need a schedule window":                              "los festivos necesitan una franja de horario",
+    "invalid schedule":                                             "horario no válido",
+    "no schedule window given, use --clear to remove the schedule": "no se indicó ninguna franja de horario, use --clear para eliminar el horario",
+    "failed to set route schedule":                                 "no se pudo establecer el horario de la ruta",
+
+    // Route prefixes
+    "failed to add route prefix":     "no se pudo añadir el prefijo de ruta",
+    "failed to delete route prefix":  "no se pudo eliminar el prefijo de ruta",
+    "failed to remove route prefix":  "no se pudo quitar el prefijo de ruta",
+    "failed to list route prefixes":  "no se pudieron listar los prefijos de ruta",
+    "failed to match route prefix":   "no se pudo buscar el prefijo de ruta",
+    "failed to query route prefixes": "no se pudieron consultar los prefijos de ruta",
+    "failed to query prefix routes":  "no se pudieron consultar las rutas por prefijo",
+    "failed to read prefix routes":   "no se pudieron leer las rutas por prefijo",
+    "route prefix not found":         "prefijo de ruta no encontrado",
+    "prefix is too long":             "el prefijo es demasiado largo",
+
+    // Monitor
+    "--interval must be positive":        "--interval debe ser positivo",
+    "failed to run monitor":              "no se pudo ejecutar el monitor",
+    "failed to list channels":            "no se pudieron listar los canales",
+    "failed to hang up call":             "no se pudo colgar la llamada",
+    "call %s has no channel on Asterisk": "la llamada %s no tiene canal en Asterisk",
+
+    // Route exclusions
+    "failed to update route exclusions":                       "no se pudieron actualizar las exclusiones de la ruta",
+    "every provider of the leg is excluded by the route":      "todos los proveedores del tramo están excluidos por la ruta",
+    "failed to set route exclusions":                          "no se pudieron establecer las exclusiones de la ruta",
+    "invalid excluded provider":                               "proveedor excluido no válido",
+    "--add and --remove can't be used together":               "--add y --remove no se pueden usar juntos",
+    "--clear takes no providers":                              "--clear no admite proveedores",
+    "no provider given, use --clear to remove the exclusions": "no se indicó ningún proveedor, use --clear para quitar las exclusiones",
+
+    // Parallel dial
+    "failed to update route parallel dial":                   "no se pudo actualizar la marcación en paralelo de la ruta",
+    "failed to set route parallel dial":                      "no se pudo establecer la marcación en paralelo de la ruta",
+    "another intermediate of the call brought it back first": "otro intermediario de la llamada la devolvió primero",
+
+    // Test calls
+    "test call needs an ANI and a DNIS":                                              "la llamada de prueba necesita un ANI y un DNIS",
+    "route matches several inbound providers, name the one the test call comes from": "la ruta coincide con varios proveedores de entrada, indique del que viene la llamada de prueba",
+    "test call outlasts the API write timeout":                                       "la llamada de prueba dura más que el tiempo de escritura de la API",
+    "failed to originate test call":                                                  "no se pudo originar la llamada de prueba",
+    "originate failed":                                                               "la originación falló",
+
+    // Route hops
+    "a pass-through route has no intermediates to add hops to":                          "una ruta directa no tiene intermediarios a los que añadir saltos",
+    "hops are sent their DID as DNIS, only the ANI can be manipulated":                  "los saltos reciben su DID como DNIS, solo se puede manipular el ANI",
+    "provider group not found":                                                          "grupo de proveedores no encontrado",
+    "failed to update route hops":                                                       "no se pudieron actualizar los saltos de la ruta",
+    "failed to set route hops":                                                          "no se pudieron establecer los saltos de la ruta",
+    "route '%s' has no hop %s, its hops are numbered from 2 after its own intermediate": "la ruta '%s' no tiene el salto %s, sus saltos se numeran desde 2 tras su propio intermediario",
+
+    // Live channels
+    "failed to correlate channels":                                        "no se pudieron correlacionar los canales",
+    "Getvar failed":                                                       "Getvar falló",
+    "--channels shows active calls only, it can't be used with --history": "--channels solo muestra llamadas activas, no se puede usar con --history",
+
+    // API
+    "invalid or missing API token":                        "token de API no válido o ausente",
+    "invalid, expired or revoked API token":               "token de API no válido, caducado o revocado",
+    "customer tokens may only read /api/v1/usage":         "los tokens de cliente solo pueden leer /api/v1/usage",
+    "customer is required":                                "se requiere el cliente",
+    "customer and route can't be combined":                "cliente y ruta no se pueden combinar",
+    "dimension must be provider, route or country":        "la dimensión debe ser provider, route o country",
+    "interval must be hour or day":                        "el intervalo debe ser hour o day",
+    "order must be asc or desc":                           "el orden debe ser asc o desc",
+    "status must be available or in_use":                  "el estado debe ser available o in_use",
+    "status must be available, in_use or quarantined":     "el estado debe ser available, in_use o quarantined",
+    "invalid duration":                                    "duración no válida",
+    "invalid kill switch id":                              "id de paro de emergencia no válido",
+    "invalid limit %q":                                    "límite %q no válido",
+    "invalid offset %q":                                   "desplazamiento %q no válido",
+    "invalid calls %q":                                    "número de llamadas %q no válido",
+    "invalid max_cost %q":                                 "max_cost %q no válido",
+    "invalid time %q: use RFC3339 or a duration like 24h": "hora %q no válida: use RFC3339 o una duración como 24h",
+    "invalid %s %q":                                       "%s %q no válido",
+    "failed to look up customer":                          "no se pudo consultar el cliente",
+}
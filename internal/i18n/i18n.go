@@ -0,0 +1,243 @@
+// Package i18n translates user facing CLI and API messages.
+//
+// Catalogs are keyed by the English message, so errors keep being written in
+// English where they are raised and are translated where they are shown. Keys
+// may hold %s, %q, %d and %v verbs, matching any formatted message; other
+// languages reuse the captured values in the same order. Messages chained
+// with ": ", as wrapped errors are, are translated part by part, and parts
+// without a translation are shown in English.
+package i18n
+
+import (
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+const (
+    English = "en"
+    Spanish = "es"
+)
+
+// catalogs holds the translations of each language but English
+var catalogs = map[string]map[string]string{
+    Spanish: spanish,
+}
+
+var (
+    mu          sync.RWMutex
+    defaultLang = English
+    compiled    = make(map[string]*catalog)
+)
+
+// SetDefault sets the language used when a request or command asks for none
+// or only unsupported ones. It reports false, keeping the current default, for
+// an unsupported language.
+func SetDefault(lang string) bool {
+    lang = normalize(lang)
+    if !Supported(lang) {
+        return false
+    }
+    mu.Lock()
+    defaultLang = lang
+    mu.Unlock()
+    return true
+}
+
+// Default returns the configured default language
+func Default() string {
+    mu.RLock()
+    defer mu.RUnlock()
+    return defaultLang
+}
+
+// Supported reports whether messages can be shown in lang
+func Supported(lang string) bool {
+    if lang == English {
+        return true
+    }
+    _, ok := catalogs[lang]
+    return ok
+}
+
+// Languages returns the supported languages
+func Languages() []string {
+    langs := []string{English}
+    for lang := range catalogs {
+        langs = append(langs, lang)
+    }
+    sort.Strings(langs[1:])
+    return langs
+}
+
+// Negotiate picks the supported language an Accept-Language header prefers,
+// the default when it names none
+func Negotiate(acceptLanguage string) string {
+    best, bestQ := "", 0.0
+    for _, part := range strings.Split(acceptLanguage, ",") {
+        tag, q := strings.TrimSpace(part), 1.0
+        if i := strings.Index(tag, ";"); i >= 0 {
+            params := strings.TrimSpace(tag[i+1:])
+            tag = strings.TrimSpace(tag[:i])
+            if strings.HasPrefix(params, "q=") {
+                v, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+                if err != nil {
+                    continue
+                }
+                q = v
+            }
+        }
+        lang := normalize(tag)
+        if q > bestQ && Supported(lang) {
+            best, bestQ = lang, q
+        }
+    }
+    if best == "" {
+        return Default()
+    }
+    return best
+}
+
+// T translates msg to lang
+func T(lang, msg string) string {
+    lang = normalize(lang)
+    if lang == English || msg == "" {
+        return msg
+    }
+    c := catalogFor(lang)
+    if c == nil {
+        return msg
+    }
+
+    // Longest run of parts with a translation first, so keys holding ": " match
+    parts := strings.Split(msg, ": ")
+    out := make([]string, 0, len(parts))
+    for i := 0; i < len(parts); {
+        j := len(parts)
+        for ; j > i; j-- {
+            if t, ok := c.lookup(strings.Join(parts[i:j], ": ")); ok {
+                out = append(out, t)
+                break
+            }
+        }
+        if j == i {
+            out = append(out, parts[i])
+            j = i + 1
+        }
+        i = j
+    }
+    return strings.Join(out, ": ")
+}
+
+// normalize reduces a language tag such as es-VE to its primary language
+func normalize(tag string) string {
+    tag = strings.ToLower(strings.TrimSpace(tag))
+    if i := strings.IndexAny(tag, "-_."); i >= 0 {
+        tag = tag[:i]
+    }
+    if tag == "" || tag == "*" || tag == "c" || tag == "posix" {
+        return English
+    }
+    return tag
+}
+
+// catalog is a language's translations ready for lookup
+type catalog struct {
+    exact    map[string]string
+    patterns []pattern
+}
+
+type pattern struct {
+    key         string
+    re          *regexp.Regexp
+    translation []string // literal pieces around the values
+}
+
+var verbs = regexp.MustCompile(`%[sqdv]`)
+
+func catalogFor(lang string) *catalog {
+    mu.RLock()
+    c, ok := compiled[lang]
+    mu.RUnlock()
+    if ok {
+        return c
+    }
+
+    messages, ok := catalogs[lang]
+    if !ok {
+        return nil
+    }
+
+    c = &catalog{exact: make(map[string]string)}
+    for key, translation := range messages {
+        if !verbs.MatchString(key) {
+            c.exact[key] = translation
+            continue
+        }
+
+        var expr strings.Builder
+        expr.WriteString("^")
+        last := 0
+        for _, loc := range verbs.FindAllStringIndex(key, -1) {
+            expr.WriteString(regexp.QuoteMeta(key[last:loc[0]]))
+            switch key[loc[1]-1] {
+            case 'q':
+                expr.WriteString(`("(?:[^"\\]|\\.)*")`)
+            case 'd':
+                expr.WriteString(`(-?\d+)`)
+            default:
+                // A value never spans a ": ", that starts the next part
+                expr.WriteString(`((?:[^:]|:[^ ])+?)`)
+            }
+            last = loc[1]
+        }
+        expr.WriteString(regexp.QuoteMeta(key[last:]))
+        expr.WriteString("$")
+
+        c.patterns = append(c.patterns, pattern{
+            key:         key,
+            re:          regexp.MustCompile(expr.String()),
+            translation: verbs.Split(translation, -1),
+        })
+    }
+    // The most specific key wins when several match
+    sort.Slice(c.patterns, func(i, j int) bool {
+        return len(c.patterns[i].key) > len(c.patterns[j].key)
+    })
+
+    mu.Lock()
+    compiled[lang] = c
+    mu.Unlock()
+    return c
+}
+
+// lookup translates one message, keeping an error code prefix like [AUTH_FAILED]
+func (c *catalog) lookup(msg string) (string, bool) {
+    prefix := ""
+    if strings.HasPrefix(msg, "[") {
+        if i := strings.Index(msg, "] "); i > 0 {
+            prefix, msg = msg[:i+2], msg[i+2:]
+        }
+    }
+
+    if t, ok := c.exact[msg]; ok {
+        return prefix + t, true
+    }
+    for _, p := range c.patterns {
+        values := p.re.FindStringSubmatch(msg)
+        if values == nil || len(values)-1 != len(p.translation)-1 {
+            continue
+        }
+        var b strings.Builder
+        for i, piece := range p.translation {
+            b.WriteString(piece)
+            if i < len(values)-1 {
+                b.WriteString(values[i+1])
+            }
+        }
+        return prefix + b.String(), true
+    }
+    return "", false
+}
@@ -46,6 +46,54 @@ func (pm *PrometheusMetrics) registerMetrics() {
         []string{"reason", "provider", "route"},
     )
     
+    pm.counters["router_route_matches"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_route_matches_total",
+            Help: "Incoming calls by how their route was matched, catch_all for the default route",
+        },
+        []string{"match", "route"},
+    )
+    
+    pm.counters["router_country_calls"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_country_calls_total",
+            Help: "Incoming calls by destination country",
+        },
+        []string{"country"},
+    )
+    
+    pm.counters["router_calls_blocked"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_calls_blocked_total",
+            Help: "Calls rejected by destination blocks",
+        },
+        []string{"scope", "match"},
+    )
+    
+    pm.counters["router_test_calls"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_test_calls_total",
+            Help: "Calls on test routes, kept out of the production call metrics",
+        },
+        []string{"route", "outcome"},
+    )
+    
+    pm.counters["router_originated_calls"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_originated_calls_total",
+            Help: "Test calls operators placed through a route, by outcome",
+        },
+        []string{"route", "outcome"},
+    )
+    
+    pm.counters["router_route_hops"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_route_hops_total",
+            Help: "Returned calls handed to the next hop of a route of several intermediates, by hop and outcome",
+        },
+        []string{"route", "hop", "outcome"},
+    )
+    
     pm.counters["agi_connections_total"] = prometheus.NewCounterVec(
         prometheus.CounterOpts{
             Name: "agi_connections_total",
@@ -54,6 +102,30 @@ func (pm *PrometheusMetrics) registerMetrics() {
         []string{},
     )
     
+    pm.counters["agi_connections_rejected"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "agi_connections_rejected_total",
+            Help: "AGI connections refused at the connection limit or dropped for malformed headers",
+        },
+        []string{"reason"},
+    )
+    
+    pm.counters["agi_forwarded"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "agi_forwarded_total",
+            Help: "AGI sessions relayed to the node owning the call, or handled locally when it was unreachable",
+        },
+        []string{"action", "result"},
+    )
+    
+    pm.counters["asterisk_restarts"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "asterisk_restarts_total",
+            Help: "Asterisk restarts detected from FullyBooted events",
+        },
+        []string{},
+    )
+    
     pm.counters["provider_calls_total"] = prometheus.NewCounterVec(
         prometheus.CounterOpts{
             Name: "provider_calls_total",
@@ -62,6 +134,246 @@ func (pm *PrometheusMetrics) registerMetrics() {
         []string{"provider", "status"},
     )
     
+    pm.counters["router_verification_failed"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_verification_failed_total",
+            Help: "Total number of failed call verifications",
+        },
+        []string{"stage", "reason"},
+    )
+    
+    pm.counters["provider_quarantined"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "provider_quarantined_total",
+            Help: "Total number of automatic provider quarantines",
+        },
+        []string{"provider"},
+    )
+    
+    pm.counters["router_replay_attempts"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_replay_attempts_total",
+            Help: "Total number of rejected return/final leg replays",
+        },
+        []string{"stage", "provider"},
+    )
+    
+    pm.counters["write_behind_events"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "write_behind_events_total",
+            Help: "Write-behind batches, overflows and failed writes",
+        },
+        []string{"event"},
+    )
+    
+    pm.counters["router_call_map_contention"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_call_map_contention_total",
+            Help: "Active call map lock acquisitions that had to wait",
+        },
+        []string{"op"},
+    )
+    
+    pm.counters["synthetic_calls"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "synthetic_calls_total",
+            Help: "Synthetic probe calls by outcome, not part of customer traffic",
+        },
+        []string{"provider", "route", "outcome"},
+    )
+    
+    pm.counters["router_negative_margin_calls"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_negative_margin_calls_total",
+            Help: "Rated production calls that cost more than they were billed",
+        },
+        []string{"customer", "route"},
+    )
+    
+    pm.counters["provider_options_checks"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "provider_options_checks_total",
+            Help: "SIP OPTIONS health checks of providers by result",
+        },
+        []string{"provider", "result"},
+    )
+    
+    pm.counters["router_no_answer"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_no_answer_total",
+            Help: "Legs not answered before their ring timeout, by failover outcome",
+        },
+        []string{"stage", "provider", "route", "outcome"},
+    )
+    
+    pm.counters["router_parallel_dial"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_parallel_dial_total",
+            Help: "Calls of parallel dial routes, by the intermediate that brought the call back",
+        },
+        []string{"route", "outcome"},
+    )
+    
+    pm.counters["router_serial_fork"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_serial_fork_total",
+            Help: "Forked calls brought back, by the hop of the intermediate that took them",
+        },
+        []string{"route", "hop"},
+    )
+    
+    pm.counters["router_route_failovers"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_route_failovers_total",
+            Help: "Calls moved to a failover route, by what failed and outcome",
+        },
+        []string{"stage", "route", "trigger", "outcome"},
+    )
+    
+    pm.counters["router_call_dispositions"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_call_dispositions_total",
+            Help: "Calls hung up, by normalized disposition",
+        },
+        []string{"disposition"},
+    )
+    
+    pm.counters["router_abandoned_calls"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_abandoned_calls_total",
+            Help: "Calls closed from an AMI Hangup because their AGI hangup hook never ran",
+        },
+        []string{"scope"},
+    )
+    
+    pm.counters["router_shared_calls"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_shared_calls_total",
+            Help: "Calls taken over from, reloaded after, dropped for or conflicting with another AGI instance, and failed Redis writes",
+        },
+        []string{"event"},
+    )
+    
+    pm.counters["router_rate_limited"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_rate_limited_total",
+            Help: "Calls rejected at a route, provider or destination prefix rate limit",
+        },
+        []string{"scope", "value"},
+    )
+    
+    pm.counters["router_fx_missing_rate"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_fx_missing_rate_total",
+            Help: "Amounts left unconverted because their currency has no exchange rate",
+        },
+        []string{"currency"},
+    )
+    
+    pm.counters["router_fx_refresh_failures"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_fx_refresh_failures_total",
+            Help: "Failed fetches from the exchange rate source",
+        },
+        []string{},
+    )
+    
+    pm.counters["router_alerts"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_alerts_total",
+            Help: "Alerts raised by kind and how they were grouped into incidents",
+        },
+        []string{"kind", "outcome"},
+    )
+    
+    pm.counters["router_incidents_resolved"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_incidents_resolved_total",
+            Help: "Incidents resolved by this node",
+        },
+        []string{},
+    )
+    
+    pm.counters["router_alert_webhook_failures"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_alert_webhook_failures_total",
+            Help: "Incident notifications the alert webhook failed or rejected",
+        },
+        []string{},
+    )
+    
+    pm.counters["router_cdr_exports"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_cdr_exports_total",
+            Help: "Customer CDR export deliveries by status",
+        },
+        []string{"export", "status"},
+    )
+    
+    pm.counters["router_backups"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_backups_total",
+            Help: "Routing configuration snapshots by trigger and outcome",
+        },
+        []string{"trigger", "status"},
+    )
+    
+    pm.counters["router_did_orders"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_did_orders_total",
+            Help: "DID orders by provider and the status they reached",
+        },
+        []string{"provider", "status"},
+    )
+    
+    pm.counters["db_errors"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "db_errors_total",
+            Help: "Database errors by operation and class (deadlock, lock_wait_timeout, connection, ...)",
+        },
+        []string{"operation", "class"},
+    )
+    
+    pm.counters["db_retries"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "db_retries_total",
+            Help: "Database statements and transactions run again after a retryable error",
+        },
+        []string{"operation", "class"},
+    )
+    
+    pm.counters["cache_requests"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "cache_requests_total",
+            Help: "Redis cache lookups by namespace and result (hit, miss)",
+        },
+        []string{"namespace", "result"},
+    )
+    
+    pm.counters["router_route_queue"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_route_queue_total",
+            Help: "Calls queued on saturated routes by outcome (slot, timeout, full)",
+        },
+        []string{"route", "outcome"},
+    )
+    
+    pm.counters["router_did_allocation_failures"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_did_allocation_failures_total",
+            Help: "DID allocations that failed by reason (lock, exhausted, database)",
+        },
+        []string{"provider", "reason"},
+    )
+    
+    pm.counters["router_local_cache_requests"] = prometheus.NewCounterVec(
+        prometheus.CounterOpts{
+            Name: "router_local_cache_requests_total",
+            Help: "In-process cache lookups by cache and result (hit, miss)",
+        },
+        []string{"cache", "result"},
+    )
+    
     // Histograms
     pm.histograms["router_call_duration"] = prometheus.NewHistogramVec(
         prometheus.HistogramOpts{
@@ -81,6 +393,24 @@ func (pm *PrometheusMetrics) registerMetrics() {
         []string{"action"},
     )
     
+    pm.histograms["router_processing_time"] = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name:    "router_processing_time_seconds",
+            Help:    "In-process routing latency per stage",
+            Buckets: []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.1},
+        },
+        []string{"stage"},
+    )
+    
+    pm.histograms["router_call_map_lock_wait"] = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name:    "router_call_map_lock_wait_seconds",
+            Help:    "Time spent waiting for a contended active call map shard",
+            Buckets: []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05},
+        },
+        []string{"op"},
+    )
+    
     pm.histograms["provider_call_duration"] = prometheus.NewHistogramVec(
         prometheus.HistogramOpts{
             Name:    "provider_call_duration_seconds",
@@ -90,6 +420,51 @@ func (pm *PrometheusMetrics) registerMetrics() {
         []string{"provider"},
     )
     
+    pm.histograms["provider_options_latency"] = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name:    "provider_options_latency_seconds",
+            Help:    "Time providers took to answer SIP OPTIONS",
+            Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 5},
+        },
+        []string{"provider"},
+    )
+    
+    pm.histograms["synthetic_pdd"] = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name:    "synthetic_pdd_seconds",
+            Help:    "Post dial delay of synthetic probe calls",
+            Buckets: []float64{0.5, 1, 2, 3, 5, 8, 12, 20, 30},
+        },
+        []string{"provider"},
+    )
+    
+    pm.histograms["router_route_queue_wait"] = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name:    "router_route_queue_wait_seconds",
+            Help:    "Time calls waited for capacity on saturated routes",
+            Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60},
+        },
+        []string{"route"},
+    )
+    
+    pm.histograms["router_did_allocation_duration"] = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name:    "router_did_allocation_duration_seconds",
+            Help:    "Time to allocate a DID, lock wait included, by result (allocated, failed)",
+            Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+        },
+        []string{"provider", "result"},
+    )
+    
+    pm.histograms["router_route_lookup_duration"] = prometheus.NewHistogramVec(
+        prometheus.HistogramOpts{
+            Name:    "router_route_lookup_duration_seconds",
+            Help:    "Time to find the route of an inbound provider by source (memory, redis, database)",
+            Buckets: []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5},
+        },
+        []string{"source"},
+    )
+    
     // Gauges
     pm.gauges["router_active_calls"] = prometheus.NewGaugeVec(
         prometheus.GaugeOpts{
@@ -107,6 +482,38 @@ func (pm *PrometheusMetrics) registerMetrics() {
         []string{"provider"},
     )
     
+    pm.gauges["router_country_active_calls"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_country_active_calls",
+            Help: "Concurrent calls by destination country",
+        },
+        []string{"country"},
+    )
+    
+    pm.gauges["router_country_cps"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_country_cps",
+            Help: "Calls per second by destination country, averaged over the CPS window",
+        },
+        []string{"country"},
+    )
+    
+    pm.gauges["router_inbound_paused"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_inbound_paused",
+            Help: "1 while new calls are held back after an Asterisk restart",
+        },
+        []string{},
+    )
+    
+    pm.gauges["router_recovered_calls"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_recovered_calls",
+            Help: "Calls still up that the last AGI server start restored from call records",
+        },
+        []string{},
+    )
+    
     pm.gauges["agi_connections_active"] = prometheus.NewGaugeVec(
         prometheus.GaugeOpts{
             Name: "agi_connections_active",
@@ -115,6 +522,14 @@ func (pm *PrometheusMetrics) registerMetrics() {
         []string{},
     )
     
+    pm.gauges["write_behind_pending"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "write_behind_pending",
+            Help: "Writes queued in the write-behind queue",
+        },
+        []string{},
+    )
+    
     pm.gauges["did_pool_available"] = prometheus.NewGaugeVec(
         prometheus.GaugeOpts{
             Name: "did_pool_available",
@@ -123,6 +538,142 @@ func (pm *PrometheusMetrics) registerMetrics() {
         []string{"provider"},
     )
     
+    pm.gauges["did_pool_in_use"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "did_pool_in_use",
+            Help: "DIDs in use in pool",
+        },
+        []string{"provider"},
+    )
+    
+    pm.gauges["router_short_call_ratio"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_short_call_ratio",
+            Help: "Percentage of answered calls under the short call threshold",
+        },
+        []string{"provider", "direction"},
+    )
+    
+    pm.gauges["provider_fas_score"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "provider_fas_score",
+            Help: "False answer supervision score per provider, 0-100",
+        },
+        []string{"provider"},
+    )
+    
+    pm.gauges["router_backup_last_success"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_backup_last_success_timestamp_seconds",
+            Help: "When the last routing configuration snapshot was stored",
+        },
+        []string{},
+    )
+    
+    pm.gauges["router_did_pool_available"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_did_pool_available",
+            Help: "Available production DIDs of pools with a watermark",
+        },
+        []string{"provider", "country"},
+    )
+    
+    pm.gauges["router_contract_projected_minutes"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_contract_projected_minutes",
+            Help: "Minutes a contracted provider is projected to carry this month",
+        },
+        []string{"provider"},
+    )
+    
+    pm.gauges["router_contract_projected_spend"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_contract_projected_spend",
+            Help: "Projected monthly spend with a contracted provider, in the reporting currency",
+        },
+        []string{"provider"},
+    )
+    
+    pm.gauges["router_contract_alert"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_contract_alert",
+            Help: "Whether a provider contract raises an alert of a kind",
+        },
+        []string{"provider", "kind"},
+    )
+    
+    pm.gauges["router_curve_weight"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_curve_weight",
+            Help: "Weight a route's weight curve gives a provider this hour",
+        },
+        []string{"route", "provider"},
+    )
+    
+    pm.gauges["router_route_queue_waiting"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_route_queue_waiting",
+            Help: "Calls waiting for capacity on a route on this node",
+        },
+        []string{"route"},
+    )
+    
+    pm.gauges["router_cost_ceiling_shift"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_cost_ceiling_shift",
+            Help: "Percent of the weight of providers over a route's cost ceiling moved to cheaper ones",
+        },
+        []string{"route"},
+    )
+    
+    pm.gauges["router_route_blended_cost"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_route_blended_cost",
+            Help: "Per minute cost of a route's outbound legs over the cost ceiling window, in the reporting currency",
+        },
+        []string{"route"},
+    )
+    
+    pm.gauges["router_sla_breach"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_sla_breach",
+            Help: "Whether a provider misses an SLA target so far this month",
+        },
+        []string{"provider", "metric"},
+    )
+    
+    pm.gauges["router_kill_switches_engaged"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_kill_switches_engaged",
+            Help: "Kill switches rejecting new inbound calls, by scope",
+        },
+        []string{"scope"},
+    )
+
+    pm.gauges["router_config_drift"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_config_drift",
+            Help: "1 while live router nodes disagree on effective config or schema version",
+        },
+        []string{"kind"},
+    )
+    
+    pm.gauges["router_cluster_nodes"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "router_cluster_nodes",
+            Help: "Router nodes publishing their state for drift detection",
+        },
+        []string{},
+    )
+    
+    pm.gauges["cache_hit_ratio"] = prometheus.NewGaugeVec(
+        prometheus.GaugeOpts{
+            Name: "cache_hit_ratio",
+            Help: "Share of Redis cache lookups served from cache since start, by namespace",
+        },
+        []string{"namespace"},
+    )
+    
     // Register all metrics
     for _, counter := range pm.counters {
         prometheus.MustRegister(counter)
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Legs of a call through the ARA topology
+const (
+    LegInbound      = "inbound"      // S1 to S2
+    LegIntermediate = "intermediate" // S2 to S3 on the assigned DID
+    LegFinal        = "final"        // S2 to S4 once S3 brought the call back
+)
+
+// Leg states in the active calls snapshot
+const (
+    LegPending  = "pending"  // not dialed yet
+    LegRouting  = "routing"  // the router is picking a provider
+    LegDialing  = "dialing"  // ringing the provider
+    LegUp       = "up"       // carrying the call
+    LegReturned = "returned" // the provider sent the call back on the DID
+)
+
+// CallLeg is the live state of one leg of a call in progress
+type CallLeg struct {
+    Leg      string     `json:"leg"`
+    Provider string     `json:"provider,omitempty"`
+    State    string     `json:"state"`
+    Since    *time.Time `json:"since,omitempty"` // when the leg entered its state
+    Elapsed  int        `json:"elapsed"`         // seconds in the state
+}
+
+// ActiveCall is a call in progress as the AGI server holds it in memory,
+// more current than its call_records row which is written behind
+type ActiveCall struct {
+    CallID      string     `json:"call_id"`
+    ANI         string     `json:"ani"`
+    DNIS        string     `json:"dnis"`
+    DID         string     `json:"did,omitempty"`
+    Route       string     `json:"route,omitempty"`
+    Status      CallStatus `json:"status"`
+    CurrentStep string     `json:"current_step,omitempty"`
+    StartTime   time.Time  `json:"start_time"`
+    Elapsed     int        `json:"elapsed"` // seconds since the call came in
+    IsTest      bool       `json:"is_test,omitempty"`
+    Legs        []CallLeg  `json:"legs"`
+}
+
+// Leg returns the named leg, nil when the snapshot has none
+func (c *ActiveCall) Leg(name string) *CallLeg {
+    for i := range c.Legs {
+        if c.Legs[i].Leg == name {
+            return &c.Legs[i]
+        }
+    }
+    return nil
+}
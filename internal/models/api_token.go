@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// APIToken is a read-only token of the customer usage API, scoped to one
+// customer (inbound provider). Only a hash of the token is stored.
+type APIToken struct {
+    ID          int64      `json:"id"`
+    Customer    string     `json:"customer"`
+    Description string     `json:"description,omitempty"`
+    Prefix      string     `json:"prefix"` // first characters, to tell tokens apart
+    CreatedBy   string     `json:"created_by,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+    LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+    ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+    RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+    PII         bool       `json:"pii,omitempty"` // sees numbers in full when masking is on
+}
+
+// Valid reports whether the token still grants access
+func (t *APIToken) Valid(now time.Time) bool {
+    return t.RevokedAt == nil && (t.ExpiresAt == nil || t.ExpiresAt.After(now))
+}
+
+// CustomerCall is a call record as its customer sees it, without the carriers
+// and routing it went through
+type CustomerCall struct {
+    CallID           string     `json:"call_id"`
+    ANI              string     `json:"ani"`
+    DNIS             string     `json:"dnis"`
+    DID              string     `json:"did,omitempty"`
+    Status           CallStatus `json:"status"`
+    Disposition      string     `json:"disposition,omitempty"`
+    StartTime        time.Time  `json:"start_time"`
+    AnswerTime       *time.Time `json:"answer_time,omitempty"`
+    EndTime          *time.Time `json:"end_time,omitempty"`
+    Duration         int        `json:"duration"`
+    BillableDuration int        `json:"billable_duration"`
+}
+
+// CustomerUsageDay is one day of a customer's production traffic
+type CustomerUsageDay struct {
+    Date            time.Time `json:"date"`
+    Calls           int64     `json:"calls"`
+    Answered        int64     `json:"answered"`
+    BillableMinutes float64   `json:"billable_minutes"`
+    ASR             float64   `json:"asr"`
+}
+
+// CustomerDIDUsage is the use a customer's calls made of one DID
+type CustomerDIDUsage struct {
+    Number          string     `json:"number"`
+    Calls           int64      `json:"calls"`
+    Answered        int64      `json:"answered"`
+    BillableMinutes float64    `json:"billable_minutes"`
+    LastUsed        *time.Time `json:"last_used,omitempty"`
+}
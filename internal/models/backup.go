@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Backup triggers
+const (
+    BackupScheduled  = "schedule"
+    BackupManual     = "manual"
+    BackupPreRestore = "pre-restore" // taken automatically before each restore
+    BackupPreFlush   = "pre-flush"   // taken automatically before -init-db -flush
+)
+
+// BackupSnapshot is a compressed dump of the routing configuration
+type BackupSnapshot struct {
+    ID        string         `json:"id"` // UTC time it was taken, ids sort in time order
+    Location  string         `json:"location"`
+    Size      int64          `json:"size"`
+    Checksum  string         `json:"checksum"` // SHA-256 of the compressed file
+    Rows      map[string]int `json:"rows"`     // per table
+    Trigger   string         `json:"trigger"`
+    Version   string         `json:"version"` // of the router that took it
+    CreatedBy string         `json:"created_by,omitempty"`
+    CreatedAt time.Time      `json:"created_at"`
+}
+
+// BackupRestore is the outcome of restoring parts of a snapshot
+type BackupRestore struct {
+    Snapshot   string         `json:"snapshot"`
+    Sets       []string       `json:"sets"`
+    Rows       map[string]int `json:"rows"`                  // restored per table
+    Kept       int            `json:"kept_allocations"`      // DIDs left allocated to calls in progress
+    PreRestore string         `json:"pre_restore,omitempty"` // snapshot of the configuration replaced
+}
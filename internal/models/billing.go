@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// BillingRule is how a provider rounds the talk time of a leg, written as
+// minimum/increment: 1/1 bills per second, 60/60 per started minute and 30/6
+// the first 30 seconds then every started 6. The zero rule bills per second.
+type BillingRule struct {
+    MinDuration int `json:"min_duration"` // seconds billed for any answered call
+    Increment   int `json:"increment"`    // seconds billed per step past the minimum
+}
+
+// Billable returns the seconds billed for the given talk time
+func (b BillingRule) Billable(seconds int) int {
+    if seconds <= 0 {
+        return 0
+    }
+    if seconds <= b.MinDuration {
+        return b.MinDuration
+    }
+
+    increment := b.Increment
+    if increment <= 0 {
+        increment = 1
+    }
+    steps := (seconds - b.MinDuration + increment - 1) / increment
+    return b.MinDuration + steps*increment
+}
+
+// ExchangeRates convert amounts in provider and DID currencies to the
+// reporting currency cost and margin reports are in
+type ExchangeRates struct {
+    Currency  string             `json:"currency"`
+    Rates     map[string]float64 `json:"rates"`  // units of each currency per unit of Currency
+    Source    string             `json:"source"` // "config" or the rate source URL
+    UpdatedAt time.Time          `json:"updated_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Destination block scopes. Customer blocks apply to one inbound provider,
+// route blocks to calls matched to one route.
+type BlockScope string
+
+const (
+    BlockScopeGlobal   BlockScope = "global"
+    BlockScopeCustomer BlockScope = "customer"
+    BlockScopeRoute    BlockScope = "route"
+)
+
+// Destination block match types
+const (
+    BlockMatchPrefix  = "prefix"
+    BlockMatchCountry = "country"
+)
+
+// DestinationBlock rejects calls to a number prefix or destination country
+type DestinationBlock struct {
+    ID             int64      `json:"id"`
+    Scope          BlockScope `json:"scope"`
+    ScopeValue     string     `json:"scope_value,omitempty"`
+    MatchType      string     `json:"match_type"`
+    Pattern        string     `json:"pattern"`
+    Reason         string     `json:"reason,omitempty"`
+    CreatedBy      string     `json:"created_by,omitempty"`
+    CreatedAt      time.Time  `json:"created_at"`
+    UnblockedUntil *time.Time `json:"unblocked_until,omitempty"` // active temporary override
+}
+
+// Overridden reports whether a temporary unblock is in effect
+func (b *DestinationBlock) Overridden(now time.Time) bool {
+    return b.UnblockedUntil != nil && b.UnblockedUntil.After(now)
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+    "fmt"
+    "strings"
+    "time"
+)
+
+// ExportFormat is the file format of a CDR export
+type ExportFormat string
+
+const (
+    ExportFormatCSV  ExportFormat = "csv"
+    ExportFormatJSON ExportFormat = "json"
+)
+
+// ExportFrequency is how often a CDR export runs, each run covering the
+// previous day, week (starting Monday) or month in the export's timezone
+type ExportFrequency string
+
+const (
+    ExportDaily   ExportFrequency = "daily"
+    ExportWeekly  ExportFrequency = "weekly"
+    ExportMonthly ExportFrequency = "monthly"
+)
+
+// ExportRunStatus is the delivery status of one CDR export run
+type ExportRunStatus string
+
+const (
+    ExportRunRunning   ExportRunStatus = "running"
+    ExportRunDelivered ExportRunStatus = "delivered"
+    ExportRunFailed    ExportRunStatus = "failed"
+)
+
+// CDRExportFields are the fields an export may contain, in their default
+// order. Carriers and routes are left out, exports go to the customer.
+var CDRExportFields = []string{
+    "call_id", "start_time", "answer_time", "end_time", "ani", "dnis", "did",
+    "status", "disposition", "duration", "billable_duration", "charge", "currency",
+}
+
+// CDRExportAllCustomers as the customer exports the calls of every customer,
+// for billing. Such exports may also contain the CDRExportBillingFields.
+const CDRExportAllCustomers = "*"
+
+// CDRExportBillingFields are the raw fields of exports of all customers
+var CDRExportBillingFields = []string{
+    "customer", "route", "intermediate_provider", "final_provider", "cost",
+}
+
+// CDRExport is a scheduled export of one customer's call records, or of all
+// customers'. The destination is an sftp://user@host/path,
+// s3://bucket/prefix, https:// webhook or mailto:address URL, credentials
+// come from the router configuration.
+type CDRExport struct {
+    ID          int64             `json:"id"`
+    Name        string            `json:"name"`
+    Customer    string            `json:"customer"`
+    Format      ExportFormat      `json:"format"`
+    Fields      []string          `json:"fields"`
+    FieldNames  map[string]string `json:"field_names,omitempty"` // CSV columns and JSON keys of renamed fields
+    Timezone    string            `json:"timezone"`
+    Frequency   ExportFrequency   `json:"frequency"`
+    Destination string            `json:"destination"`
+    Enabled     bool              `json:"enabled"`
+    CreatedBy   string            `json:"created_by,omitempty"`
+    CreatedAt   time.Time         `json:"created_at"`
+    UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// AllCustomers reports whether the export covers every customer
+func (e *CDRExport) AllCustomers() bool {
+    return e.Customer == CDRExportAllCustomers
+}
+
+// DefaultFields returns the fields of an export that doesn't pick its own
+func (e *CDRExport) DefaultFields() []string {
+    if e.AllCustomers() {
+        return append(append([]string{}, CDRExportFields...), CDRExportBillingFields...)
+    }
+    return CDRExportFields
+}
+
+// Columns returns the names the fields carry in the file
+func (e *CDRExport) Columns() []string {
+    columns := make([]string, len(e.Fields))
+    for i, f := range e.Fields {
+        columns[i] = f
+        if name := e.FieldNames[f]; name != "" {
+            columns[i] = name
+        }
+    }
+    return columns
+}
+
+// Location returns the export's timezone
+func (e *CDRExport) Location() (*time.Location, error) {
+    if e.Timezone == "" {
+        return time.UTC, nil
+    }
+    return time.LoadLocation(e.Timezone)
+}
+
+// Period returns the period before the one containing t, the one a run at t exports
+func (e *CDRExport) Period(t time.Time) (time.Time, time.Time, error) {
+    start, err := e.periodStart(t)
+    if err != nil {
+        return time.Time{}, time.Time{}, err
+    }
+    return e.advance(start, -1), start, nil
+}
+
+// PeriodContaining returns the period t falls in
+func (e *CDRExport) PeriodContaining(t time.Time) (time.Time, time.Time, error) {
+    start, err := e.periodStart(t)
+    if err != nil {
+        return time.Time{}, time.Time{}, err
+    }
+    return start, e.advance(start, 1), nil
+}
+
+func (e *CDRExport) periodStart(t time.Time) (time.Time, error) {
+    loc, err := e.Location()
+    if err != nil {
+        return time.Time{}, err
+    }
+    t = t.In(loc)
+    day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+    switch e.Frequency {
+    case ExportDaily:
+        return day, nil
+    case ExportWeekly:
+        return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)), nil
+    case ExportMonthly:
+        return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc), nil
+    }
+    return time.Time{}, fmt.Errorf("invalid export frequency: %s", e.Frequency)
+}
+
+func (e *CDRExport) advance(start time.Time, n int) time.Time {
+    switch e.Frequency {
+    case ExportWeekly:
+        return start.AddDate(0, 0, 7*n)
+    case ExportMonthly:
+        return start.AddDate(0, n, 0)
+    }
+    return start.AddDate(0, 0, n)
+}
+
+// Validate checks the export's format, fields, timezone and frequency
+func (e *CDRExport) Validate() error {
+    if e.Name == "" || e.Customer == "" {
+        return fmt.Errorf("export needs a name and a customer")
+    }
+    if e.Format != ExportFormatCSV && e.Format != ExportFormatJSON {
+        return fmt.Errorf("invalid export format: %s", e.Format)
+    }
+    allowed := e.DefaultFields()
+    for _, f := range e.Fields {
+        if !isCDRExportField(allowed, f) {
+            return fmt.Errorf("unknown export field: %s (one of %s)", f, strings.Join(allowed, ", "))
+        }
+    }
+    for f, name := range e.FieldNames {
+        if !isCDRExportField(e.Fields, f) {
+            return fmt.Errorf("renamed field %s is not exported", f)
+        }
+        if strings.TrimSpace(name) == "" {
+            return fmt.Errorf("field %s needs a name", f)
+        }
+    }
+    seen := make(map[string]bool, len(e.Fields))
+    for _, column := range e.Columns() {
+        if seen[column] {
+            return fmt.Errorf("export has two fields named %s", column)
+        }
+        seen[column] = true
+    }
+    if _, err := e.Location(); err != nil {
+        return fmt.Errorf("invalid timezone: %s", e.Timezone)
+    }
+    if _, err := e.periodStart(time.Now()); err != nil {
+        return err
+    }
+    switch {
+    case strings.HasPrefix(e.Destination, "sftp://"),
+        strings.HasPrefix(e.Destination, "s3://"),
+        strings.HasPrefix(e.Destination, "https://"),
+        strings.HasPrefix(e.Destination, "http://"),
+        strings.HasPrefix(e.Destination, "mailto:"):
+    default:
+        return fmt.Errorf("destination must be an sftp://, s3://, https:// or mailto: URL")
+    }
+    return nil
+}
+
+func isCDRExportField(fields []string, name string) bool {
+    for _, f := range fields {
+        if f == name {
+            return true
+        }
+    }
+    return false
+}
+
+// CDRExportRun is one delivery of an export's period
+type CDRExportRun struct {
+    ID          int64           `json:"id"`
+    ExportID    int64           `json:"export_id"`
+    ExportName  string          `json:"export_name,omitempty"`
+    PeriodStart time.Time       `json:"period_start"`
+    PeriodEnd   time.Time       `json:"period_end"`
+    Status      ExportRunStatus `json:"status"`
+    Attempts    int             `json:"attempts"`
+    Records     int             `json:"records"`
+    Bytes       int64           `json:"bytes"`
+    FileName    string          `json:"file_name,omitempty"`
+    Error       string          `json:"error,omitempty"`
+    StartedAt   time.Time       `json:"started_at"`
+    FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// ProviderContract is the commercial agreement with a provider. Zero
+// commitments are not tracked.
+type ProviderContract struct {
+    ProviderName      string     `json:"provider_name"`
+    MinMonthlyMinutes int        `json:"min_monthly_minutes,omitempty"` // minutes committed to per calendar month
+    MinMonthlySpend   float64    `json:"min_monthly_spend,omitempty"`   // spend committed to, in the reporting currency
+    MaxMonthlyMinutes int        `json:"max_monthly_minutes,omitempty"` // minutes the provider takes at the contracted rate
+    RatesValidUntil   *time.Time `json:"rates_valid_until,omitempty"`
+    NoticeDays        int        `json:"notice_days,omitempty"` // notice needed to end or renegotiate
+    StartDate         *time.Time `json:"start_date,omitempty"`
+    EndDate           *time.Time `json:"end_date,omitempty"`
+    Notes             string     `json:"notes,omitempty"`
+    UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// Contract alert kinds
+const (
+    ContractAlertMinutesShortfall = "minutes_shortfall" // projected to miss the minute commitment
+    ContractAlertSpendShortfall   = "spend_shortfall"   // projected to miss the spend commitment
+    ContractAlertMinutesExceeded  = "minutes_exceeded"  // projected over the minute ceiling
+    ContractAlertRatesExpiring    = "rates_expiring"    // rates end within the notice period
+    ContractAlertRatesExpired     = "rates_expired"
+    ContractAlertNoticeDeadline   = "notice_deadline" // last day to give notice is near or past
+)
+
+// ContractAlertKinds lists the alert kinds a contract can raise
+var ContractAlertKinds = []string{
+    ContractAlertMinutesShortfall, ContractAlertSpendShortfall, ContractAlertMinutesExceeded,
+    ContractAlertRatesExpiring, ContractAlertRatesExpired, ContractAlertNoticeDeadline,
+}
+
+// ContractAlert is one problem with how a contract is going
+type ContractAlert struct {
+    Kind    string `json:"kind"`
+    Message string `json:"message"`
+}
+
+// ContractStatus is a contract's usage this month against its commitments.
+// Projections extrapolate the month so far to the whole month.
+type ContractStatus struct {
+    Contract         *ProviderContract `json:"contract"`
+    Month            string            `json:"month"`
+    Elapsed          float64           `json:"elapsed"` // share of the month gone, 0 to 1
+    Minutes          float64           `json:"minutes"`
+    Spend            float64           `json:"spend"`
+    Currency         string            `json:"currency"`
+    ProjectedMinutes float64           `json:"projected_minutes"`
+    ProjectedSpend   float64           `json:"projected_spend"`
+    Alerts           []ContractAlert   `json:"alerts,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// CostCeiling is the blended per minute cost a route should stay under. Above
+// it, weight is moved from the route's providers over the ceiling to those
+// under it that meet the quality limits, a step each evaluation, and given
+// back once the blended cost is comfortably under it again.
+type CostCeiling struct {
+    RouteName   string     `json:"route_name"`
+    MaxCost     float64    `json:"max_cost"`           // per minute, over the route's outbound legs
+    Currency    string     `json:"currency,omitempty"` // of MaxCost, the reporting currency when empty
+    MinASR      float64    `json:"min_asr,omitempty"`  // percent, cheaper providers under it get no weight
+    MaxPDDMs    int        `json:"max_pdd_ms,omitempty"`
+    Shift       float64    `json:"shift"`                  // percent of the weight of providers over the ceiling moved
+    BlendedCost *float64   `json:"blended_cost,omitempty"` // at the last evaluation, in the reporting currency
+    EvaluatedAt *time.Time `json:"evaluated_at,omitempty"`
+    UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// ProviderCountryLimit caps the calls a provider takes to one destination country
+type ProviderCountryLimit struct {
+    ProviderName  string  `json:"provider_name"`
+    CountryCode   string  `json:"country_code"`
+    MaxConcurrent int     `json:"max_concurrent"`
+    MaxCPS        float64 `json:"max_cps"`
+    ActiveCalls   int     `json:"active_calls"`
+}
+
+// CountryCallStats is the live traffic to one destination country
+type CountryCallStats struct {
+    Country     string  `json:"country"`
+    ActiveCalls int     `json:"active_calls"`
+    CPS         float64 `json:"cps"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// CredentialRotation records a provider SIP password change. Until
+// PreviousExpiredAt is set the old password is still accepted.
+type CredentialRotation struct {
+    ID                int64      `json:"id"`
+    ProviderName      string     `json:"provider_name"`
+    RotatedBy         string     `json:"rotated_by,omitempty"`
+    RotatedAt         time.Time  `json:"rotated_at"`
+    OverlapUntil      *time.Time `json:"overlap_until,omitempty"`
+    PreviousExpiredAt *time.Time `json:"previous_expired_at,omitempty"`
+    
+    // Password is the new secret, only set on the rotation result
+    Password string `json:"-"`
+}
+
+// SIPContact is a contact registered by a digest auth customer
+type SIPContact struct {
+    ID        string     `json:"id"`
+    URI       string     `json:"uri"`
+    UserAgent string     `json:"user_agent,omitempty"`
+    ViaAddr   string     `json:"via_addr,omitempty"`
+    ViaPort   int        `json:"via_port,omitempty"`
+    ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Dimensions of the daily statistics snapshot
+const (
+    StatsDimensionProvider = "provider"
+    StatsDimensionRoute    = "route"
+    StatsDimensionCountry  = "country"
+)
+
+// DailyCallStats is one day of production traffic for a provider, route or destination country
+type DailyCallStats struct {
+    Date             time.Time `json:"date"`
+    Dimension        string    `json:"dimension"`
+    Key              string    `json:"key"`
+    TotalCalls       int64     `json:"total_calls"`
+    AnsweredCalls    int64     `json:"answered_calls"`
+    CompletedCalls   int64     `json:"completed_calls"`
+    FailedCalls      int64     `json:"failed_calls"`
+    TotalDuration    int64     `json:"total_duration"` // seconds
+    BillableDuration int64     `json:"billable_duration"`
+    Cost             float64   `json:"cost"`
+    Revenue          float64   `json:"revenue"`
+    Currency         string    `json:"currency"`
+    ASR              float64   `json:"asr"`
+    ACD              float64   `json:"acd"` // seconds per answered call
+}
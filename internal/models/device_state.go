@@ -0,0 +1,19 @@
+package models
+
+// Asterisk device states published for providers
+const (
+    DeviceStateNotInUse    = "NOT_INUSE"
+    DeviceStateInUse       = "INUSE"
+    DeviceStateBusy        = "BUSY"
+    DeviceStateUnavailable = "UNAVAILABLE"
+)
+
+// ProviderDeviceState is the trunk state of a provider as published to Asterisk
+type ProviderDeviceState struct {
+    ProviderName string `json:"provider_name"`
+    Device       string `json:"device"` // Custom:<prefix><provider>
+    State        string `json:"state"`
+    ActiveCalls  int64  `json:"active_calls"`
+    MaxChannels  int    `json:"max_channels"`
+    Reason       string `json:"reason,omitempty"` // why the trunk is unavailable
+}
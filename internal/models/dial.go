@@ -0,0 +1,121 @@
+package models
+
+import (
+    "fmt"
+    "regexp"
+)
+
+// CallerIDPresentations are the values Asterisk accepts for CALLERID(pres)
+var CallerIDPresentations = []string{
+    "allowed", "allowed_not_screened", "allowed_passed_screen", "allowed_failed_screen",
+    "prohib", "prohib_not_screened", "prohib_passed_screen", "prohib_failed_screen",
+    "unavailable",
+}
+
+// Early media policies of a route
+const (
+    EarlyMediaPassThrough = "pass_through" // the caller hears the called side's early media
+    EarlyMediaBlock       = "block"        // ringing is passed on, early media is not
+    EarlyMediaRingback    = "ringback"     // the caller hears local ringback whatever the called side sends
+)
+
+// EarlyMediaPolicies are the accepted early media policies
+var EarlyMediaPolicies = []string{EarlyMediaPassThrough, EarlyMediaBlock, EarlyMediaRingback}
+
+// DialTransports are the transports a dial string may ask for in its request URI
+var DialTransports = []string{"udp", "tcp", "tls"}
+
+var dialContextName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// DialOptions shape the Dial of an outbound leg. Route options win over the
+// options of the provider dialed, unset fields fall back to the defaults.
+type DialOptions struct {
+    Timeout      int    `json:"timeout,omitempty"`       // seconds to ring
+    CallerIDPres string `json:"callerid_pres,omitempty"` // CALLERID(pres) on the outbound channel
+    PreDialSub   string `json:"predial_sub,omitempty"`   // extra pre-dial handler context (b)
+    AnswerSub    string `json:"answer_sub,omitempty"`    // extra context run on answer (U)
+    Transport    string `json:"transport,omitempty"`     // transport hint for the request URI
+    EarlyMedia   string `json:"early_media,omitempty"`   // early media policy, pass_through when unset
+    MaxAttempts  int    `json:"max_attempts,omitempty"`  // providers tried when a leg rings out
+}
+
+// ProviderDialOptions are the dial options stored for a provider
+type ProviderDialOptions struct {
+    ProviderName string `json:"provider_name"`
+    DialOptions
+}
+
+// IsEmpty reports whether no option is set
+func (o *DialOptions) IsEmpty() bool {
+    return o == nil || *o == DialOptions{}
+}
+
+// Merge returns the options with the fields set in override replacing its own
+func (o *DialOptions) Merge(override *DialOptions) *DialOptions {
+    merged := DialOptions{}
+    if o != nil {
+        merged = *o
+    }
+    if override == nil {
+        return &merged
+    }
+    if override.Timeout > 0 {
+        merged.Timeout = override.Timeout
+    }
+    if override.CallerIDPres != "" {
+        merged.CallerIDPres = override.CallerIDPres
+    }
+    if override.PreDialSub != "" {
+        merged.PreDialSub = override.PreDialSub
+    }
+    if override.AnswerSub != "" {
+        merged.AnswerSub = override.AnswerSub
+    }
+    if override.Transport != "" {
+        merged.Transport = override.Transport
+    }
+    if override.EarlyMedia != "" {
+        merged.EarlyMedia = override.EarlyMedia
+    }
+    if override.MaxAttempts > 0 {
+        merged.MaxAttempts = override.MaxAttempts
+    }
+    return &merged
+}
+
+// Validate checks the options can be put in a Dial application call
+func (o *DialOptions) Validate() error {
+    if o == nil {
+        return nil
+    }
+    if o.Timeout < 0 || o.Timeout > 3600 {
+        return fmt.Errorf("timeout must be between 1 and 3600 seconds")
+    }
+    if o.CallerIDPres != "" && !containsString(CallerIDPresentations, o.CallerIDPres) {
+        return fmt.Errorf("unknown caller ID presentation %q", o.CallerIDPres)
+    }
+    if o.Transport != "" && !containsString(DialTransports, o.Transport) {
+        return fmt.Errorf("unknown transport %q", o.Transport)
+    }
+    if o.EarlyMedia != "" && !containsString(EarlyMediaPolicies, o.EarlyMedia) {
+        return fmt.Errorf("unknown early media policy %q", o.EarlyMedia)
+    }
+    if o.MaxAttempts < 0 || o.MaxAttempts > 10 {
+        return fmt.Errorf("max attempts must be between 1 and 10")
+    }
+    for _, sub := range []string{o.PreDialSub, o.AnswerSub} {
+        if sub != "" && !dialContextName.MatchString(sub) {
+            return fmt.Errorf("invalid dialplan context name %q", sub)
+        }
+    }
+    return nil
+}
+
+func containsString(values []string, value string) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
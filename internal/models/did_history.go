@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// DID history events
+const (
+    DIDHistoryAdded       = "added"
+    DIDHistoryRemoved     = "removed"
+    DIDHistoryQuarantined = "quarantined" // re-added within the quarantine period
+    DIDHistoryReleased    = "released"    // quarantine lifted early
+)
+
+// DIDHistoryEntry is one recorded event in the life of a number
+type DIDHistoryEntry struct {
+    ID           int64      `json:"id"`
+    Number       string     `json:"number"`
+    Event        string     `json:"event"`
+    ProviderName string     `json:"provider_name,omitempty"`
+    LastUsedAt   *time.Time `json:"last_used_at,omitempty"` // when removed
+    Detail       string     `json:"detail,omitempty"`
+    UserID       string     `json:"user_id,omitempty"`
+    CreatedAt    time.Time  `json:"created_at"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// DIDWatermark orders more numbers for a DID pool, a provider's DIDs in one
+// country or all of them, once its available numbers fall below MinAvailable
+type DIDWatermark struct {
+    ProviderName  string    `json:"provider_name"`
+    Country       string    `json:"country,omitempty"` // empty for the whole provider pool
+    MinAvailable  int       `json:"min_available"`
+    OrderQuantity int       `json:"order_quantity"`
+    Orderer       string    `json:"orderer"` // how orders are placed, manual queues them for an operator
+    Enabled       bool      `json:"enabled"`
+    UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// DIDOrderStatus is where a DID order is in procurement
+type DIDOrderStatus string
+
+const (
+    DIDOrderOpen      DIDOrderStatus = "open"      // created, waiting to be placed
+    DIDOrderSubmitted DIDOrderStatus = "submitted" // placed with the supplier
+    DIDOrderDelivered DIDOrderStatus = "delivered" // all numbers activated into the pool
+    DIDOrderCancelled DIDOrderStatus = "cancelled"
+    DIDOrderFailed    DIDOrderStatus = "failed"
+)
+
+// Pending reports whether the order still waits for numbers
+func (s DIDOrderStatus) Pending() bool {
+    return s == DIDOrderOpen || s == DIDOrderSubmitted
+}
+
+// DIDOrder is a request for new numbers for a DID pool
+type DIDOrder struct {
+    ID            int64          `json:"id"`
+    ProviderName  string         `json:"provider_name"`
+    Country       string         `json:"country,omitempty"`
+    Quantity      int            `json:"quantity"`
+    Delivered     int            `json:"delivered"` // numbers activated so far
+    Status        DIDOrderStatus `json:"status"`
+    Orderer       string         `json:"orderer"`
+    Reference     string         `json:"reference,omitempty"` // the supplier's order or ticket id
+    Reason        string         `json:"reason,omitempty"`
+    MonthlyCost   float64        `json:"monthly_cost"`    // given to the delivered DIDs
+    PerMinuteCost float64        `json:"per_minute_cost"` // given to the delivered DIDs
+    Currency      string         `json:"currency,omitempty"`
+    Error         string         `json:"error,omitempty"`
+    CreatedBy     string         `json:"created_by,omitempty"`
+    CreatedAt     time.Time      `json:"created_at"`
+    UpdatedAt     time.Time      `json:"updated_at"`
+    DeliveredAt   *time.Time     `json:"delivered_at,omitempty"`
+}
+
+// DIDDelivery is the outcome of activating an order's numbers into the pool
+type DIDDelivery struct {
+    Order       *DIDOrder `json:"order"`
+    Activated   int       `json:"activated"`
+    Quarantined int       `json:"quarantined,omitempty"` // recycled numbers held back from rotation
+    Skipped     []string  `json:"skipped,omitempty"`     // numbers already in the pool
+}
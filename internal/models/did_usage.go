@@ -0,0 +1,114 @@
+package models
+
+import "time"
+
+// DIDUsage is one allocation of a DID, logged when the DID is released
+type DIDUsage struct {
+    ID                   int64      `json:"id"`
+    DIDNumber            string     `json:"did_number"`
+    CallID               string     `json:"call_id"`
+    RouteName            string     `json:"route_name,omitempty"`
+    InboundProvider      string     `json:"inbound_provider,omitempty"`
+    IntermediateProvider string     `json:"intermediate_provider,omitempty"`
+    FinalProvider        string     `json:"final_provider,omitempty"`
+    Status               CallStatus `json:"status"`
+    Answered             bool       `json:"answered"`
+    AllocatedAt          *time.Time `json:"allocated_at,omitempty"`
+    ReleasedAt           time.Time  `json:"released_at"`
+    Duration             int        `json:"duration"`
+    BillableDuration     int        `json:"billable_duration"`
+    Cost                 float64    `json:"cost"`
+    Revenue              float64    `json:"revenue"`
+    Currency             string     `json:"currency"`
+    IsTest               bool       `json:"is_test,omitempty"`
+}
+
+// DIDUsageSummary aggregates the usage log of a DID, overall or for one route
+type DIDUsageSummary struct {
+    Key          string     `json:"key,omitempty"`
+    Allocations  int64      `json:"allocations"`
+    Answered     int64      `json:"answered"`
+    ASR          float64    `json:"asr"`
+    TotalMinutes float64    `json:"total_minutes"`
+    Cost         float64    `json:"cost"`
+    Revenue      float64    `json:"revenue"`
+    Margin       float64    `json:"margin"`
+    Currency     string     `json:"currency"`
+    FirstUsed    *time.Time `json:"first_used,omitempty"`
+    LastUsed     *time.Time `json:"last_used,omitempty"`
+}
+
+// DIDDetails is the full view of a single DID
+type DIDDetails struct {
+    DID     *DID               `json:"did"`
+    Usage   DIDUsageSummary    `json:"usage"`
+    ByRoute []*DIDUsageSummary `json:"by_route"`
+    Recent  []*DIDUsage        `json:"recent"`
+}
+
+// DIDCallLookup answers which calls held a DID at a moment, for carrier
+// trouble tickets that give only the number and a time
+type DIDCallLookup struct {
+    Number  string          `json:"number"`
+    At      time.Time       `json:"at"`
+    Window  string          `json:"window"` // how far either side of At allocations are matched
+    Live    bool            `json:"live"`   // At is the time of the lookup
+    Matches []*DIDCallMatch `json:"matches"`
+}
+
+// DIDCallMatch is a call that held the DID at or around the time looked up
+type DIDCallMatch struct {
+    Call   *CallRecord `json:"call,omitempty"`  // all legs, nil once the call record was pruned
+    Usage  *DIDUsage   `json:"usage,omitempty"` // the allocation, nil while the call is in progress
+    Active bool        `json:"active"`
+    Exact  bool        `json:"exact"` // held the DID at the time itself rather than within the window
+}
+
+// DIDRotationStats shows how allocations spread over the DID pool in a period
+// and the DIDs the rotation policy holds back
+type DIDRotationStats struct {
+    Since         time.Time                 `json:"since"`
+    Until         time.Time                 `json:"until"`
+    Provider      string                    `json:"provider,omitempty"`
+    DIDs          int                       `json:"dids"`
+    Used          int                       `json:"used"` // allocated at least once in the period
+    InUse         int                       `json:"in_use"`
+    Allocations   int64                     `json:"allocations"`
+    Mean          float64                   `json:"mean"` // allocations per DID
+    Median        int64                     `json:"median"`
+    P95           int64                     `json:"p95"`
+    Max           int64                     `json:"max"`
+    Buckets       []*DIDAllocationBucket    `json:"buckets"`
+    Top           []*DIDAllocationCount     `json:"top"`
+    ByProvider    []*DIDProviderAllocations `json:"by_provider"`
+    CoolingDown   int                       `json:"cooling_down"`    // released within the cool-down
+    AtHourlyLimit int                       `json:"at_hourly_limit"` // allocated the most times an hour allows
+    MaxPerHour    int                       `json:"max_per_hour"`
+    Cooldown      string                    `json:"cooldown"`
+    Order         string                    `json:"order"`
+}
+
+// DIDAllocationBucket counts the DIDs allocated From to To times, To is nil
+// for the open range
+type DIDAllocationBucket struct {
+    From int64  `json:"from"`
+    To   *int64 `json:"to,omitempty"`
+    DIDs int    `json:"dids"`
+}
+
+// DIDAllocationCount is how often a DID was allocated in the period and in
+// its current allocation hour
+type DIDAllocationCount struct {
+    Number      string `json:"number"`
+    Provider    string `json:"provider"`
+    Allocations int64  `json:"allocations"`
+    LastHour    int64  `json:"last_hour"`
+}
+
+// DIDProviderAllocations sums the allocations of the DIDs of a provider
+type DIDProviderAllocations struct {
+    Provider    string `json:"provider"`
+    DIDs        int    `json:"dids"`
+    Allocations int64  `json:"allocations"`
+    Max         int64  `json:"max"`
+}
@@ -0,0 +1,97 @@
+package models
+
+// Dispositions are the unified call outcomes stored on call_records, whatever
+// code system Asterisk or the far end reported the outcome in
+const (
+    DispositionAnswered      = "answered"
+    DispositionBusy          = "busy"
+    DispositionNoAnswer      = "no_answer"
+    DispositionRejected      = "rejected"
+    DispositionUnavailable   = "unavailable"
+    DispositionCongestion    = "congestion"
+    DispositionInvalidNumber = "invalid_number"
+    DispositionCancelled     = "cancelled"
+    DispositionFailed        = "failed"
+    DispositionUnknown       = "unknown"
+)
+
+// Dispositions lists the accepted dispositions
+var Dispositions = []string{
+    DispositionAnswered, DispositionBusy, DispositionNoAnswer, DispositionRejected,
+    DispositionUnavailable, DispositionCongestion, DispositionInvalidNumber,
+    DispositionCancelled, DispositionFailed, DispositionUnknown,
+}
+
+// Code systems a disposition is mapped from
+const (
+    DispositionSourceSIP        = "sip"        // SIP final response of the dialed leg
+    DispositionSourceQ850       = "q850"       // HANGUPCAUSE
+    DispositionSourceDialStatus = "dialstatus" // DIALSTATUS
+)
+
+// DispositionSources lists the code systems in the order they are listed
+var DispositionSources = []string{
+    DispositionSourceSIP, DispositionSourceQ850, DispositionSourceDialStatus,
+}
+
+// DispositionMapping maps one code of a code system to a disposition
+type DispositionMapping struct {
+    Source      string `json:"source"`
+    Code        string `json:"code"`
+    Disposition string `json:"disposition"`
+    Custom      bool   `json:"custom"` // set by an operator rather than built in
+}
+
+// DefaultDispositionMappings are used for every code the disposition_map
+// table doesn't override. Codes missing from every source map to unknown.
+var DefaultDispositionMappings = []DispositionMapping{
+    {Source: DispositionSourceSIP, Code: "200", Disposition: DispositionAnswered},
+    {Source: DispositionSourceSIP, Code: "403", Disposition: DispositionRejected},
+    {Source: DispositionSourceSIP, Code: "404", Disposition: DispositionInvalidNumber},
+    {Source: DispositionSourceSIP, Code: "408", Disposition: DispositionNoAnswer},
+    {Source: DispositionSourceSIP, Code: "410", Disposition: DispositionInvalidNumber},
+    {Source: DispositionSourceSIP, Code: "480", Disposition: DispositionUnavailable},
+    {Source: DispositionSourceSIP, Code: "484", Disposition: DispositionInvalidNumber},
+    {Source: DispositionSourceSIP, Code: "486", Disposition: DispositionBusy},
+    {Source: DispositionSourceSIP, Code: "487", Disposition: DispositionCancelled},
+    {Source: DispositionSourceSIP, Code: "488", Disposition: DispositionFailed},
+    {Source: DispositionSourceSIP, Code: "500", Disposition: DispositionCongestion},
+    {Source: DispositionSourceSIP, Code: "502", Disposition: DispositionCongestion},
+    {Source: DispositionSourceSIP, Code: "503", Disposition: DispositionCongestion},
+    {Source: DispositionSourceSIP, Code: "504", Disposition: DispositionCongestion},
+    {Source: DispositionSourceSIP, Code: "600", Disposition: DispositionBusy},
+    {Source: DispositionSourceSIP, Code: "603", Disposition: DispositionRejected},
+    {Source: DispositionSourceSIP, Code: "604", Disposition: DispositionInvalidNumber},
+    {Source: DispositionSourceQ850, Code: "1", Disposition: DispositionInvalidNumber},
+    {Source: DispositionSourceQ850, Code: "3", Disposition: DispositionInvalidNumber},
+    {Source: DispositionSourceQ850, Code: "17", Disposition: DispositionBusy},
+    {Source: DispositionSourceQ850, Code: "18", Disposition: DispositionNoAnswer},
+    {Source: DispositionSourceQ850, Code: "19", Disposition: DispositionNoAnswer},
+    {Source: DispositionSourceQ850, Code: "20", Disposition: DispositionUnavailable},
+    {Source: DispositionSourceQ850, Code: "21", Disposition: DispositionRejected},
+    {Source: DispositionSourceQ850, Code: "22", Disposition: DispositionInvalidNumber},
+    {Source: DispositionSourceQ850, Code: "27", Disposition: DispositionUnavailable},
+    {Source: DispositionSourceQ850, Code: "28", Disposition: DispositionInvalidNumber},
+    {Source: DispositionSourceQ850, Code: "34", Disposition: DispositionCongestion},
+    {Source: DispositionSourceQ850, Code: "38", Disposition: DispositionCongestion},
+    {Source: DispositionSourceQ850, Code: "41", Disposition: DispositionCongestion},
+    {Source: DispositionSourceQ850, Code: "42", Disposition: DispositionCongestion},
+    {Source: DispositionSourceQ850, Code: "44", Disposition: DispositionCongestion},
+    {Source: DispositionSourceQ850, Code: "58", Disposition: DispositionCongestion},
+    {Source: DispositionSourceDialStatus, Code: "ANSWER", Disposition: DispositionAnswered},
+    {Source: DispositionSourceDialStatus, Code: "BUSY", Disposition: DispositionBusy},
+    {Source: DispositionSourceDialStatus, Code: "NOANSWER", Disposition: DispositionNoAnswer},
+    {Source: DispositionSourceDialStatus, Code: "CANCEL", Disposition: DispositionCancelled},
+    {Source: DispositionSourceDialStatus, Code: "CONGESTION", Disposition: DispositionCongestion},
+    {Source: DispositionSourceDialStatus, Code: "CHANUNAVAIL", Disposition: DispositionUnavailable},
+    {Source: DispositionSourceDialStatus, Code: "DONTCALL", Disposition: DispositionRejected},
+    {Source: DispositionSourceDialStatus, Code: "TORTURE", Disposition: DispositionRejected},
+    {Source: DispositionSourceDialStatus, Code: "INVALIDARGS", Disposition: DispositionFailed},
+}
+
+// DispositionCount is the number of calls that ended with a disposition
+type DispositionCount struct {
+    Disposition string  `json:"disposition"`
+    Calls       int     `json:"calls"`
+    Share       float64 `json:"share"` // percentage of the calls counted
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Downtime scopes
+const (
+    DowntimeProvider = "provider" // marked down by health checks
+    DowntimeSystem   = "system"   // the router took no new calls
+)
+
+// Causes of system downtime
+const (
+    DowntimeAsteriskRestart = "asterisk_restart"
+    DowntimeKillSwitch      = "kill_switch"
+)
+
+// Downtime is a stretch a provider was down or the system took no calls
+type Downtime struct {
+    Scope   string     `json:"scope"`
+    Entity  string     `json:"entity"` // the provider, or the node for an Asterisk restart
+    Cause   string     `json:"cause,omitempty"`
+    Reason  string     `json:"reason,omitempty"`
+    Start   time.Time  `json:"start"`
+    End     *time.Time `json:"end,omitempty"` // nil while still down
+    Seconds int64      `json:"seconds"`       // up to now while still down
+}
+
+// Reliability summarises the failures of a provider over a period. MTTR is
+// the mean time down per failure, MTBF the mean time up between failures;
+// both are nil for a period without failures.
+type Reliability struct {
+    Failures        int    `json:"failures"`
+    DowntimeSeconds int64  `json:"downtime_seconds"`
+    MTTRSeconds     *int64 `json:"mttr_seconds,omitempty"`
+    MTBFSeconds     *int64 `json:"mtbf_seconds,omitempty"`
+}
+
+// DowntimeFilter selects downtime overlapping a period
+type DowntimeFilter struct {
+    Scope    string // empty for both
+    Provider string
+    Since    time.Time
+    Until    time.Time
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// CallTiming is what Asterisk reports about the dialed leg when the caller hangs up
+type CallTiming struct {
+    DialStatus  string
+    Dialed      time.Duration // DIALEDTIME, from dial start to hangup
+    Answered    time.Duration // ANSWEREDTIME, from answer to hangup
+    HangupCause int           // Q.850 cause, HANGUPCAUSE
+    SIPCode     int           // final SIP response of the dialed leg, 0 when unknown
+}
+
+// IsAnswered reports whether the dialed leg was answered
+func (t CallTiming) IsAnswered() bool {
+    return t.DialStatus == "ANSWER"
+}
+
+// AnswerDelay is the time the far end took to answer
+func (t CallTiming) AnswerDelay() time.Duration {
+    if t.Dialed < t.Answered {
+        return 0
+    }
+    return t.Dialed - t.Answered
+}
+
+// FASScore is the false answer supervision assessment of a provider over the
+// detection window. The ratios are shares of answered calls.
+type FASScore struct {
+    ProviderName    string     `json:"provider_name"`
+    AnsweredCalls   int        `json:"answered_calls"`
+    FastAnswers     int        `json:"fast_answers"`     // answered quicker than the fast answer threshold
+    ShortCalls      int        `json:"short_calls"`      // hung up before the short call threshold
+    IncrementCalls  int        `json:"increment_calls"`  // ended right at a billing increment
+    FastAnswerRatio float64    `json:"fast_answer_ratio"`
+    ShortCallRatio  float64    `json:"short_call_ratio"`
+    IncrementRatio  float64    `json:"increment_ratio"`
+    Score           float64    `json:"score"` // 0-100, higher is more suspicious
+    Flagged         bool       `json:"flagged"`
+    Reduced         bool       `json:"reduced"` // traffic is being reduced
+    FlaggedAt       *time.Time `json:"flagged_at,omitempty"`
+    WindowStart     time.Time  `json:"window_start"`
+    EvaluatedAt     time.Time  `json:"evaluated_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Holiday sources
+const (
+    HolidaySourceManual = "manual"
+    HolidaySourceICal   = "ical"
+)
+
+// HolidayDateFormat is the layout of holiday dates
+const HolidayDateFormat = "2006-01-02"
+
+// Holiday is a public holiday of a country
+type Holiday struct {
+    CountryCode string    `json:"country_code"` // ISO 3166-1 alpha-2
+    Date        string    `json:"date"`         // YYYY-MM-DD
+    Name        string    `json:"name"`
+    Source      string    `json:"source"`
+    UpdatedAt   time.Time `json:"updated_at"`
+}
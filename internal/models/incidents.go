@@ -0,0 +1,86 @@
+package models
+
+import "time"
+
+// Alert kinds
+const (
+    AlertProviderDown = "provider_down"
+)
+
+// Alert severities
+const (
+    AlertWarning  = "warning"
+    AlertCritical = "critical"
+)
+
+// alertTitles name the incidents alerts of each kind are grouped into
+var alertTitles = map[string]string{
+    AlertProviderDown: "Providers down",
+}
+
+// AlertTitle names the incidents of an alert kind
+func AlertTitle(kind string) string {
+    if title, ok := alertTitles[kind]; ok {
+        return title
+    }
+    return kind
+}
+
+// Alert is a condition raised about one entity, a provider for most kinds.
+// The same kind and entity raised again while firing is a repeat.
+type Alert struct {
+    Kind     string `json:"kind"`
+    Entity   string `json:"entity"`
+    Severity string `json:"severity"`
+    Message  string `json:"message"`
+}
+
+// Key identifies the alert within its incident
+func (a *Alert) Key() string {
+    return a.Kind + ":" + a.Entity
+}
+
+// IncidentAlert is an alert as grouped into an incident
+type IncidentAlert struct {
+    Alert
+    Count      int        `json:"count"` // times raised, repeats included
+    FirstSeen  time.Time  `json:"first_seen"`
+    LastSeen   time.Time  `json:"last_seen"`
+    ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Incident groups the alerts of a kind raised while any of them fires, from
+// the first until the last is resolved
+type Incident struct {
+    ID          int64            `json:"id"`
+    Kind        string           `json:"kind"`
+    Title       string           `json:"title"`
+    Severity    string           `json:"severity"` // the highest of its alerts
+    AlertCount  int              `json:"alert_count"`
+    StartedAt   time.Time        `json:"started_at"`
+    LastAlertAt time.Time        `json:"last_alert_at"`
+    ResolvedAt  *time.Time       `json:"resolved_at,omitempty"`
+    ResolvedBy  string           `json:"resolved_by,omitempty"`
+    Alerts      []*IncidentAlert `json:"alerts,omitempty"`
+}
+
+// Open reports whether the incident is still going on
+func (i *Incident) Open() bool {
+    return i.ResolvedAt == nil
+}
+
+// Duration is how long the incident lasted, up to now while it is open
+func (i *Incident) Duration(now time.Time) time.Duration {
+    if i.ResolvedAt != nil {
+        return i.ResolvedAt.Sub(i.StartedAt)
+    }
+    return now.Sub(i.StartedAt)
+}
+
+// IncidentFilter selects incidents, newest first
+type IncidentFilter struct {
+    Kind     string
+    OpenOnly bool
+    Since    time.Time // started at or after
+    Limit    int
+}
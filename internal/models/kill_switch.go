@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// KillSwitch stops all new inbound calls, globally, from one customer (inbound
+// provider) or on one route, while calls already up continue. Its scopes are
+// the destination block scopes.
+type KillSwitch struct {
+    ID         int64      `json:"id"`
+    Scope      BlockScope `json:"scope"`
+    ScopeValue string     `json:"scope_value,omitempty"`
+    Reason     string     `json:"reason,omitempty"`
+    EngagedBy  string     `json:"engaged_by,omitempty"`
+    EngagedAt  time.Time  `json:"engaged_at"`
+    ExpiresAt  *time.Time `json:"expires_at,omitempty"` // released automatically after
+}
+
+// Active reports whether the switch still stops calls
+func (k *KillSwitch) Active(now time.Time) bool {
+    return k.ExpiresAt == nil || k.ExpiresAt.After(now)
+}
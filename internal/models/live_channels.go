@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// LiveChannel is a channel Asterisk holds, as CoreShowChannels lists it, with
+// the codec and RTCP stats read from the channel itself
+type LiveChannel struct {
+    Channel     string    `json:"channel"`
+    UniqueID    string    `json:"uniqueid"`
+    LinkedID    string    `json:"linkedid"` // Uniqueid of the channel the call started on, shared by those it dialed
+    Context     string    `json:"context"`
+    Exten       string    `json:"exten"`
+    State       string    `json:"state"`
+    Application string    `json:"application,omitempty"`
+    CallerID    string    `json:"caller_id,omitempty"`
+    Duration    int       `json:"duration"` // seconds
+    BridgeID    string    `json:"bridge_id,omitempty"`
+    BridgedWith []string  `json:"bridged_with,omitempty"` // channels in the same bridge
+    Codec       string    `json:"codec,omitempty"`
+    RTP         *RTPStats `json:"rtp,omitempty"` // nil for channels without media of their own, Local ones
+}
+
+// RTPStats is the media quality of a channel as its RTCP reports it
+type RTPStats struct {
+    RxJitter float64 `json:"rx_jitter"` // seconds
+    TxJitter float64 `json:"tx_jitter"` // seconds
+    RxLost   int     `json:"rx_lost"`   // packets lost coming in
+    TxLost   int     `json:"tx_lost"`   // packets the far end reported lost
+    RTT      float64 `json:"rtt"`       // seconds
+}
+
+// CallChannels is an active call record with the Asterisk channels carrying it
+type CallChannels struct {
+    Call     *CallRecord   `json:"call"`
+    Channels []LiveChannel `json:"channels"`
+    Ghost    bool          `json:"ghost,omitempty"` // the router holds the call, Asterisk has no channel of it
+}
+
+// ChannelReport correlates the channels of Asterisk with the router's active
+// call records
+type ChannelReport struct {
+    TakenAt time.Time      `json:"taken_at"`
+    Calls   []CallChannels `json:"calls"`
+    Ghosts  int            `json:"ghosts"`
+    Orphans []LiveChannel  `json:"orphans"` // channels of no active call record
+}
@@ -28,6 +28,15 @@ const (
     LoadBalanceModeHash             LoadBalanceMode = "hash"
 )
 
+// Inbound provider matching for routes
+type InboundMatchType string
+
+const (
+    InboundMatchExact  InboundMatchType = "exact"
+    InboundMatchPrefix InboundMatchType = "prefix"
+    InboundMatchRegex  InboundMatchType = "regex"
+)
+
 // Call status
 type CallStatus string
 
@@ -80,35 +89,52 @@ type Provider struct {
     Priority           int             `json:"priority" db:"priority"`
     Weight             int             `json:"weight" db:"weight"`
     CostPerMinute      float64         `json:"cost_per_minute" db:"cost_per_minute"`
+    Currency           string          `json:"currency,omitempty" db:"currency"` // of CostPerMinute, empty for the reporting currency
+    MinDuration        int             `json:"min_duration" db:"min_duration"`           // seconds billed for any answered call
+    BillingIncrement   int             `json:"billing_increment" db:"billing_increment"` // seconds billed per step past the minimum
     Active             bool            `json:"active" db:"active"`
     HealthCheckEnabled bool            `json:"health_check_enabled" db:"health_check_enabled"`
     LastHealthCheck    *time.Time      `json:"last_health_check,omitempty" db:"last_health_check"`
     HealthStatus       string          `json:"health_status" db:"health_status"`
     Metadata           JSON            `json:"metadata,omitempty" db:"metadata"`
+    Tags               Tags            `json:"tags,omitempty" db:"-"`
     CreatedAt          time.Time       `json:"created_at" db:"created_at"`
     UpdatedAt          time.Time       `json:"updated_at" db:"updated_at"`
 }
 
+// UsesCredentials reports whether the provider authenticates with a SIP username and password
+func (p *Provider) UsesCredentials() bool {
+    return p.AuthType == "credentials" || p.AuthType == "both" || p.AuthType == "register"
+}
+
+// Registers reports whether the provider registers its contacts instead of using a static host
+func (p *Provider) Registers() bool {
+    return p.AuthType == "register"
+}
+
 // DID represents a phone number
 type DID struct {
-    ID            int64      `json:"id" db:"id"`
-    Number        string     `json:"number" db:"number"`
-    ProviderID    *int       `json:"provider_id,omitempty" db:"provider_id"`
-    ProviderName  string     `json:"provider_name" db:"provider_name"`
-    InUse         bool       `json:"in_use" db:"in_use"`
-    Destination   string     `json:"destination,omitempty" db:"destination"`
-    Country       string     `json:"country,omitempty" db:"country"`
-    City          string     `json:"city,omitempty" db:"city"`
-    RateCenter    string     `json:"rate_center,omitempty" db:"rate_center"`
-    MonthlyCost   float64    `json:"monthly_cost" db:"monthly_cost"`
-    PerMinuteCost float64    `json:"per_minute_cost" db:"per_minute_cost"`
-    AllocatedAt   *time.Time `json:"allocated_at,omitempty" db:"allocated_at"`
-    ReleasedAt    *time.Time `json:"released_at,omitempty" db:"released_at"`
-    LastUsedAt    *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
-    UsageCount    int64      `json:"usage_count" db:"usage_count"`
-    Metadata      JSON       `json:"metadata,omitempty" db:"metadata"`
-    CreatedAt     time.Time  `json:"created_at" db:"created_at"`
-    UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+    ID               int64      `json:"id" db:"id"`
+    Number           string     `json:"number" db:"number"`
+    ProviderID       *int       `json:"provider_id,omitempty" db:"provider_id"`
+    ProviderName     string     `json:"provider_name" db:"provider_name"`
+    InUse            bool       `json:"in_use" db:"in_use"`
+    Destination      string     `json:"destination,omitempty" db:"destination"`
+    Country          string     `json:"country,omitempty" db:"country"`
+    City             string     `json:"city,omitempty" db:"city"`
+    RateCenter       string     `json:"rate_center,omitempty" db:"rate_center"`
+    MonthlyCost      float64    `json:"monthly_cost" db:"monthly_cost"`
+    PerMinuteCost    float64    `json:"per_minute_cost" db:"per_minute_cost"`
+    Currency         string     `json:"currency,omitempty" db:"currency"` // of the costs, empty for the reporting currency
+    AllocatedAt      *time.Time `json:"allocated_at,omitempty" db:"allocated_at"`
+    ReleasedAt       *time.Time `json:"released_at,omitempty" db:"released_at"`
+    LastUsedAt       *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+    UsageCount       int64      `json:"usage_count" db:"usage_count"`
+    QuarantinedUntil *time.Time `json:"quarantined_until,omitempty" db:"quarantined_until"` // recycled numbers rest until then
+    IsTest           bool       `json:"is_test,omitempty" db:"is_test"`
+    Metadata         JSON       `json:"metadata,omitempty" db:"metadata"`
+    CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+    UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // Update the ProviderRoute struct to include group support fields
@@ -125,6 +151,7 @@ type ProviderRoute struct {
     MaxConcurrentCalls   int             `json:"max_concurrent_calls" db:"max_concurrent_calls"`
     CurrentCalls         int             `json:"current_calls" db:"current_calls"`
     Enabled              bool            `json:"enabled" db:"enabled"`
+    IsTest               bool            `json:"is_test,omitempty" db:"is_test"`
     FailoverRoutes       []string        `json:"failover_routes,omitempty" db:"failover_routes"`
     RoutingRules         JSON            `json:"routing_rules,omitempty" db:"routing_rules"`
     Metadata             JSON            `json:"metadata,omitempty" db:"metadata"`
@@ -135,6 +162,75 @@ type ProviderRoute struct {
     InboundIsGroup      bool `json:"inbound_is_group" db:"inbound_is_group"`
     IntermediateIsGroup bool `json:"intermediate_is_group" db:"intermediate_is_group"`
     FinalIsGroup        bool `json:"final_is_group" db:"final_is_group"`
+    
+    // How inbound_provider is matched when it is not a group
+    InboundMatch InboundMatchType `json:"inbound_match,omitempty" db:"inbound_match"`
+    
+    // How the route was selected for a call: exact, group, prefix, regex or catch_all
+    MatchedBy string `json:"matched_by,omitempty" db:"-"`
+    
+    // Shared policy; the settings below are resolved against it, route values win
+    PolicyName          string               `json:"policy_name,omitempty" db:"policy_name"`
+    VerificationEnabled *bool                `json:"verification_enabled,omitempty" db:"verification_enabled"`
+    StrictMode          *bool                `json:"strict_mode,omitempty" db:"strict_mode"`
+    Manipulations       *NumberManipulations `json:"manipulations,omitempty" db:"manipulations"`
+    
+    // Dial options of the outbound legs, over those of the providers dialed
+    DialOptions *DialOptions `json:"dial_options,omitempty" db:"dial_options"`
+    
+    // Seconds calls wait for capacity at the concurrent call limit, zero rejects them
+    QueueTimeout int `json:"queue_timeout,omitempty" db:"queue_timeout"`
+    
+    // Weekly windows the route takes calls in, read from routing_rules
+    Schedule *RouteSchedule `json:"schedule,omitempty" db:"-"`
+    
+    // Providers the route never dials, even as members of its groups, read from routing_rules
+    ExcludedProviders []string `json:"excluded_providers,omitempty" db:"-"`
+    
+    // Rings two intermediates at once, read from routing_rules
+    ParallelDial bool `json:"parallel_dial,omitempty" db:"-"`
+    
+    // Sends calls straight to the final provider, without an intermediate or DID, read from routing_rules
+    PassThrough bool `json:"pass_through,omitempty" db:"-"`
+    
+    // Intermediates calls go through in turn after the route's own, each
+    // bringing the call back to S2, read from routing_rules
+    Hops []RouteHop `json:"hops,omitempty" db:"-"`
+}
+
+// RouteHop is an intermediate a route hands its calls to after the one
+// before brought them back, on a DID of its own. The ANI it is sent and how
+// its return leg is verified are its own, the route's policy otherwise.
+type RouteHop struct {
+    Provider            string               `json:"provider"`
+    IsGroup             bool                 `json:"is_group,omitempty"`
+    Manipulations       *NumberManipulations `json:"manipulations,omitempty"` // of the ANI sent, DNIS-1 as for the first intermediate
+    VerificationEnabled *bool                `json:"verification_enabled,omitempty"`
+    StrictMode          *bool                `json:"strict_mode,omitempty"`
+}
+
+// Topology returns the path calls of the route take, S1 to S4 through S2
+// and each of its intermediates
+func (r *ProviderRoute) Topology() []string {
+    path := []string{"S1", "S2"}
+    if r.PassThrough {
+        return append(path, "S4")
+    }
+    path = append(path, r.IntermediateProvider, "S2")
+    for _, hop := range r.Hops {
+        path = append(path, hop.Provider, "S2")
+    }
+    return append(path, "S4")
+}
+
+// Excludes reports whether the route never dials a provider
+func (r *ProviderRoute) Excludes(provider string) bool {
+    for _, name := range r.ExcludedProviders {
+        if name == provider {
+            return true
+        }
+    }
+    return false
 }
 
 // CallRecord tracks call flow
@@ -156,11 +252,140 @@ type CallRecord struct {
     AnswerTime           *time.Time `json:"answer_time,omitempty" db:"answer_time"`
     EndTime              *time.Time `json:"end_time,omitempty" db:"end_time"`
     Duration             int        `json:"duration" db:"duration"`
-    BillableDuration     int        `json:"billable_duration" db:"billable_duration"`
+    BillableDuration     int        `json:"billable_duration" db:"billable_duration"` // inbound leg, what the customer is billed
+    IntermediateBillable int        `json:"intermediate_billable_duration,omitempty" db:"intermediate_billable_duration"`
+    FinalBillable        int        `json:"final_billable_duration,omitempty" db:"final_billable_duration"`
+    BilledAmount         float64    `json:"billed_amount,omitempty" db:"billed_amount"` // inbound leg at the customer's rate
+    Cost                 float64    `json:"cost,omitempty" db:"cost"`                   // DID, intermediate and final legs
+    Margin               float64    `json:"margin,omitempty" db:"margin"`
+    Currency             string     `json:"currency,omitempty" db:"currency"`       // of the amounts, the reporting currency when rated
+    RatePrefix           string     `json:"rate_prefix,omitempty" db:"rate_prefix"` // rate deck line billed, empty for the flat rate
     RecordingPath        string     `json:"recording_path,omitempty" db:"recording_path"`
     SIPResponseCode      int        `json:"sip_response_code,omitempty" db:"sip_response_code"`
+    HangupCause          int        `json:"hangup_cause,omitempty" db:"hangup_cause"`
+    DialStatus           string     `json:"dial_status,omitempty" db:"dial_status"`
+    Disposition          string     `json:"disposition,omitempty" db:"disposition"`
     QualityScore         float64    `json:"quality_score,omitempty" db:"quality_score"`
+    IsTest               bool       `json:"is_test,omitempty" db:"is_test"` // engineering test traffic, kept out of KPIs
     Metadata             JSON       `json:"metadata,omitempty" db:"metadata"`
+    
+    // Route policy in effect when the call was routed
+    VerificationEnabled *bool                `json:"verification_enabled,omitempty" db:"-"`
+    StrictMode          *bool                `json:"strict_mode,omitempty" db:"-"`
+    Manipulations       *NumberManipulations `json:"manipulations,omitempty" db:"-"`
+    DialOptions         *DialOptions         `json:"dial_options,omitempty" db:"-"`
+    
+    // Providers that let a leg ring out, skipped when it fails over
+    SkippedIntermediate []string `json:"skipped_intermediate,omitempty" db:"-"`
+    SkippedFinal        []string `json:"skipped_final,omitempty" db:"-"`
+    
+    // Routes the call failed over from, the first one matched the call
+    SkippedRoutes []string `json:"skipped_routes,omitempty" db:"-"`
+    
+    // When S3 brought the call back and the final leg started, kept in memory only
+    ReturnedAt *time.Time `json:"returned_at,omitempty" db:"-"`
+    
+    // Second intermediate of a parallel dial and its DID, until one of them brings the call back
+    ParallelIntermediate string `json:"parallel_intermediate,omitempty" db:"-"`
+    ParallelDID          string `json:"parallel_did,omitempty" db:"-"`
+    
+    // Intermediates the dialplan dials in turn when the current one doesn't take the call
+    ForkHops []ForkHop `json:"fork_hops,omitempty" db:"-"`
+    
+    // Hops of the route the call goes through after its intermediate, and
+    // those it was handed to so far
+    Hops    []RouteHop `json:"hops,omitempty" db:"-"`
+    HopLegs []HopLeg   `json:"hop_legs,omitempty" db:"-"`
+}
+
+// HopLeg is a hop of a route a call was handed to, the intermediate picked
+// for it and the DID it was given
+type HopLeg struct {
+    Provider   string     `json:"provider"`
+    DID        string     `json:"did"`
+    DialedAt   time.Time  `json:"dialed_at"`
+    ReturnedAt *time.Time `json:"returned_at,omitempty"`
+    Billable   int        `json:"billable_duration,omitempty"` // seconds the hop's provider bills
+}
+
+// ForkHop is an intermediate of a serial fork and the DID it was given
+type ForkHop struct {
+    Provider string `json:"provider"`
+    DID      string `json:"did"`
+}
+
+// ParallelLeg returns the call as the second intermediate of a parallel dial
+// was given it, nil when no second intermediate is ringing
+func (c *CallRecord) ParallelLeg() *CallRecord {
+    if c.ParallelDID == "" {
+        return nil
+    }
+    return c.legOn(c.ParallelIntermediate, c.ParallelDID)
+}
+
+// ForkLegs returns the call as each hop of its serial fork was given it, in
+// the order the dialplan dials them
+func (c *CallRecord) ForkLegs() []*CallRecord {
+    legs := make([]*CallRecord, 0, len(c.ForkHops))
+    for _, hop := range c.ForkHops {
+        legs = append(legs, c.legOn(hop.Provider, hop.DID))
+    }
+    return legs
+}
+
+// PendingLegs returns the legs of the call holding a DID besides the current
+// one: a second intermediate ringing and the hops of a serial fork
+func (c *CallRecord) PendingLegs() []*CallRecord {
+    legs := c.ForkLegs()
+    if leg := c.ParallelLeg(); leg != nil {
+        legs = append([]*CallRecord{leg}, legs...)
+    }
+    return legs
+}
+
+// ReachedHops returns the call as each hop it was handed to was given it. The
+// call is billed once, on its first intermediate.
+func (c *CallRecord) ReachedHops() []*CallRecord {
+    legs := make([]*CallRecord, 0, len(c.HopLegs))
+    for _, hop := range c.HopLegs {
+        leg := c.legOn(hop.Provider, hop.DID)
+        leg.Hops, leg.HopLegs = nil, nil
+        leg.Cost, leg.BilledAmount, leg.Margin = 0, 0, 0
+        legs = append(legs, leg)
+    }
+    return legs
+}
+
+// HopANI is the ANI sent to the intermediate of the call's hop, numbered from
+// 2 after the route's own intermediate: DNIS-1, through the hop's manipulations
+func (c *CallRecord) HopANI(hop int) string {
+    if hop < 2 || hop-2 >= len(c.Hops) {
+        return c.OriginalDNIS
+    }
+    return c.Hops[hop-2].Manipulations.ApplyANI(c.OriginalDNIS)
+}
+
+// ClearPendingLegs forgets the legs of the call besides the current one
+func (c *CallRecord) ClearPendingLegs() {
+    c.ParallelIntermediate, c.ParallelDID = "", ""
+    c.ForkHops = nil
+}
+
+func (c *CallRecord) legOn(provider, did string) *CallRecord {
+    leg := *c
+    leg.IntermediateProvider, leg.AssignedDID = provider, did
+    leg.ClearPendingLegs()
+    return &leg
+}
+
+// FinalANI is the ANI sent to the final provider
+func (c *CallRecord) FinalANI() string {
+    return c.Manipulations.ApplyANI(c.OriginalANI)
+}
+
+// FinalDNIS is the DNIS sent to the final provider
+func (c *CallRecord) FinalDNIS() string {
+    return c.Manipulations.ApplyDNIS(c.OriginalDNIS)
 }
 
 // CallVerification for security tracking
@@ -198,12 +423,28 @@ type ProviderHealth struct {
 
 // AGI Response for call routing
 type CallResponse struct {
-    Status      string `json:"status"`
-    DIDAssigned string `json:"did_assigned,omitempty"`
-    NextHop     string `json:"next_hop,omitempty"`
-    ANIToSend   string `json:"ani_to_send,omitempty"`
-    DNISToSend  string `json:"dnis_to_send,omitempty"`
-    Error       string `json:"error,omitempty"`
+    Status           string `json:"status"`
+    DIDAssigned      string `json:"did_assigned,omitempty"`
+    NextHop          string `json:"next_hop,omitempty"`
+    ANIToSend        string `json:"ani_to_send,omitempty"`
+    DNISToSend       string `json:"dnis_to_send,omitempty"`
+    CorrelationToken string `json:"correlation_token,omitempty"`
+    DialString       string `json:"dial_string,omitempty"`
+    DialTimeout      int    `json:"dial_timeout,omitempty"`
+    DialOptions      string `json:"dial_options,omitempty"`
+    QueuePosition    int    `json:"queue_position,omitempty"` // place in the route queue, zero when the call didn't wait
+    QueueWait        int    `json:"queue_wait,omitempty"`     // seconds waited for route capacity
+    QueueTimeout     int    `json:"queue_timeout,omitempty"`
+    Error            string `json:"error,omitempty"`
+    
+    // Legs the dialplan dials in turn when this one isn't answered, without asking the router again
+    ForkHops []*CallResponse `json:"fork_hops,omitempty"`
+    
+    // Hop of a route of several intermediates the leg goes to, numbered from 2, zero for other legs
+    Hop int `json:"hop,omitempty"`
+    
+    // DID of the second intermediate a parallel dial rings along with this leg
+    ParallelDID string `json:"parallel_did,omitempty"`
 }
 
 // Provider statistics
@@ -218,4 +459,67 @@ type ProviderStats struct {
     AvgResponseTime  int       `json:"avg_response_time"`
     LastCallTime     time.Time `json:"last_call_time"`
     IsHealthy        bool      `json:"is_healthy"`
+    WarmingUp        bool      `json:"warming_up"`
+    WarmupPercent    float64   `json:"warmup_percent"`
+}
+
+// HashRingState describes a consistent hash ring used by hash load balancing
+type HashRingState struct {
+    Key          string             `json:"key"`
+    Members      []string           `json:"members"`
+    VirtualNodes int                `json:"virtual_nodes"`
+    Ownership    map[string]float64 `json:"ownership"`
+    LookupKey    string             `json:"lookup_key,omitempty"`
+    LookupResult string             `json:"lookup_result,omitempty"`
+}
+
+// VerificationReport aggregates call verification outcomes over a period
+type VerificationReport struct {
+    Since       time.Time                `json:"since"`
+    Until       time.Time                `json:"until"`
+    Interval    string                   `json:"interval"`
+    Total       int64                    `json:"total"`
+    Failed      int64                    `json:"failed"`
+    FailureRate float64                  `json:"failure_rate"`
+    ByStep      []*VerificationBreakdown `json:"by_step"`
+    ByReason    []*VerificationBreakdown `json:"by_reason"`
+    ByProvider  []*VerificationBreakdown `json:"by_provider"`
+    Failures    []*VerificationFailure   `json:"failures"`
+    Timeline    []*VerificationBucket    `json:"timeline"`
+}
+
+// VerificationBreakdown holds totals for a single aggregation key
+type VerificationBreakdown struct {
+    Key         string  `json:"key"`
+    Total       int64   `json:"total"`
+    Failed      int64   `json:"failed"`
+    FailureRate float64 `json:"failure_rate"`
+}
+
+// VerificationFailure is a drill-down row of failures per provider, step and reason
+type VerificationFailure struct {
+    Provider string    `json:"provider"`
+    Step     string    `json:"step"`
+    Reason   string    `json:"reason"`
+    Count    int64     `json:"count"`
+    LastSeen time.Time `json:"last_seen"`
+}
+
+// VerificationBucket holds verification totals for one time period
+type VerificationBucket struct {
+    PeriodStart time.Time `json:"period_start"`
+    Step        string    `json:"step"`
+    Total       int64     `json:"total"`
+    Failed      int64     `json:"failed"`
+}
+
+// ProviderQuarantine records a provider blocked after repeated verification failures
+type ProviderQuarantine struct {
+    ID            int64      `json:"id" db:"id"`
+    ProviderName  string     `json:"provider_name" db:"provider_name"`
+    Reason        string     `json:"reason" db:"reason"`
+    FailureCount  int        `json:"failure_count" db:"failure_count"`
+    QuarantinedAt time.Time  `json:"quarantined_at" db:"quarantined_at"`
+    ReleasedAt    *time.Time `json:"released_at,omitempty" db:"released_at"`
+    ReleasedBy    string     `json:"released_by,omitempty" db:"released_by"`
 }
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// OriginateCallRequest is a test call an operator places through a route,
+// entering the inbound context as if S1 had sent it
+type OriginateCallRequest struct {
+    ANI     string
+    DNIS    string
+    Route   string
+    Inbound string        // provider the call stands in for, the route's own when empty
+    Timeout time.Duration // until the far end of the chain answers
+    Hold    time.Duration // the answered call is kept up for
+}
+
+// InboundCallRequest describes a call originated over AMI into the inbound context
+type InboundCallRequest struct {
+    CallID    string // Uniqueid of the channel running the dialplan, the router's call ID
+    ANI       string
+    DNIS      string
+    Timeout   time.Duration
+    Hold      time.Duration
+    Variables map[string]string
+}
+
+// OriginateCallResult is how a test call went: what Asterisk reported for it
+// and the legs the router set up
+type OriginateCallResult struct {
+    CallID    string      `json:"call_id"`
+    Route     string      `json:"route"`
+    Inbound   string      `json:"inbound"`
+    Ringing   bool        `json:"ringing"`
+    Answered  bool        `json:"answered"`
+    PDDMs     int64       `json:"pdd_ms"`
+    Cause     int         `json:"hangup_cause"`
+    CauseText string      `json:"hangup_cause_text,omitempty"`
+    Reason    string      `json:"reason,omitempty"` // set when the call never reached Asterisk's Hangup
+    Call      *CallRecord `json:"call,omitempty"`   // nil when the router never took the call
+}
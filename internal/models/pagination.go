@@ -0,0 +1,99 @@
+package models
+
+import (
+    "strings"
+)
+
+// List limits
+const (
+    DefaultListLimit = 100
+    MaxListLimit     = 1000
+)
+
+// ListOptions controls paging and sorting of list queries
+type ListOptions struct {
+    Limit  int    `json:"limit"`
+    Offset int    `json:"offset"`
+    Sort   string `json:"sort,omitempty"`
+    Desc   bool   `json:"desc,omitempty"`
+}
+
+// Normalize applies the default and maximum page size
+func (o ListOptions) Normalize() ListOptions {
+    if o.Limit <= 0 {
+        o.Limit = DefaultListLimit
+    }
+    if o.Limit > MaxListLimit {
+        o.Limit = MaxListLimit
+    }
+    if o.Offset < 0 {
+        o.Offset = 0
+    }
+    return o
+}
+
+// OrderClause builds ORDER BY and LIMIT from the whitelisted sort columns.
+// Unknown sort keys fall back to defaultOrder.
+func (o ListOptions) OrderClause(columns map[string]string, defaultOrder string) (string, []interface{}) {
+    o = o.Normalize()
+    
+    order := defaultOrder
+    if column, ok := columns[strings.ToLower(o.Sort)]; ok {
+        order = column
+        if o.Desc {
+            order += " DESC"
+        }
+    }
+    
+    return " ORDER BY " + order + " LIMIT ? OFFSET ?", []interface{}{o.Limit, o.Offset}
+}
+
+// Page is one page of list results
+type Page struct {
+    Items  interface{} `json:"items"`
+    Total  int64       `json:"total"`
+    Limit  int         `json:"limit"`
+    Offset int         `json:"offset"`
+}
+
+// NewPage wraps items with the paging used to fetch them
+func NewPage(items interface{}, total int64, opts ListOptions) *Page {
+    opts = opts.Normalize()
+    return &Page{Items: items, Total: total, Limit: opts.Limit, Offset: opts.Offset}
+}
+
+// DIDFilter narrows down DID listings
+type DIDFilter struct {
+    Provider string   `json:"provider,omitempty"`
+    Status   string   `json:"status,omitempty"` // available, in_use or quarantined
+    Prefix   string   `json:"prefix,omitempty"`
+    Pattern  string   `json:"pattern,omitempty"` // SQL LIKE pattern, * is accepted for %
+    Country  string   `json:"country,omitempty"`
+    MaxCost  *float64 `json:"max_cost,omitempty"` // per minute
+    Test     *bool    `json:"test,omitempty"`
+}
+
+// RouteFilter narrows down route listings
+type RouteFilter struct {
+    Inbound  string `json:"inbound,omitempty"`
+    Provider string `json:"provider,omitempty"` // inbound, intermediate or final
+    Policy   string `json:"policy,omitempty"`
+    Enabled  *bool  `json:"enabled,omitempty"`
+    Tags     Tags   `json:"tags,omitempty"` // a provider on any leg carries the tags
+    Test     *bool  `json:"test,omitempty"`
+}
+
+// CallFilter narrows down call record listings
+type CallFilter struct {
+    CallID      string     `json:"call_id,omitempty"`
+    ActiveOnly  bool       `json:"active_only,omitempty"`
+    FailedOnly  bool       `json:"failed_only,omitempty"` // failed or timed out
+    Status      CallStatus `json:"status,omitempty"`
+    Route       string     `json:"route,omitempty"`
+    Provider    string     `json:"provider,omitempty"` // any leg
+    Customer    string     `json:"customer,omitempty"` // inbound leg only
+    ANI         string     `json:"ani,omitempty"`
+    DNIS        string     `json:"dnis,omitempty"`
+    Disposition string     `json:"disposition,omitempty"`
+    Test        *bool      `json:"test,omitempty"` // nil includes test calls
+}
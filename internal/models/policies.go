@@ -0,0 +1,51 @@
+package models
+
+import (
+    "strings"
+    "time"
+)
+
+// NumberManipulations rewrites ANI/DNIS on the leg sent to the final provider
+type NumberManipulations struct {
+    ANIStripPrefix  string `json:"ani_strip_prefix,omitempty"`
+    ANIAddPrefix    string `json:"ani_add_prefix,omitempty"`
+    DNISStripPrefix string `json:"dnis_strip_prefix,omitempty"`
+    DNISAddPrefix   string `json:"dnis_add_prefix,omitempty"`
+}
+
+// IsEmpty reports whether no manipulation is configured
+func (m *NumberManipulations) IsEmpty() bool {
+    return m == nil || *m == NumberManipulations{}
+}
+
+// ApplyANI returns the ANI after manipulation
+func (m *NumberManipulations) ApplyANI(ani string) string {
+    if m == nil {
+        return ani
+    }
+    return m.ANIAddPrefix + strings.TrimPrefix(ani, m.ANIStripPrefix)
+}
+
+// ApplyDNIS returns the DNIS after manipulation
+func (m *NumberManipulations) ApplyDNIS(dnis string) string {
+    if m == nil {
+        return dnis
+    }
+    return m.DNISAddPrefix + strings.TrimPrefix(dnis, m.DNISStripPrefix)
+}
+
+// RoutePolicy holds settings shared by many routes. Routes inherit every field
+// they leave unset; fields unset here fall back to the global configuration.
+type RoutePolicy struct {
+    ID                  int                  `json:"id" db:"id"`
+    Name                string               `json:"name" db:"name"`
+    Description         string               `json:"description,omitempty" db:"description"`
+    LoadBalanceMode     LoadBalanceMode      `json:"load_balance_mode,omitempty" db:"load_balance_mode"`
+    MaxConcurrentCalls  *int                 `json:"max_concurrent_calls,omitempty" db:"max_concurrent_calls"`
+    VerificationEnabled *bool                `json:"verification_enabled,omitempty" db:"verification_enabled"`
+    StrictMode          *bool                `json:"strict_mode,omitempty" db:"strict_mode"`
+    Manipulations       *NumberManipulations `json:"manipulations,omitempty" db:"manipulations"`
+    RouteCount          int                  `json:"route_count" db:"-"`
+    CreatedAt           time.Time            `json:"created_at" db:"created_at"`
+    UpdatedAt           time.Time            `json:"updated_at" db:"updated_at"`
+}
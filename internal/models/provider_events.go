@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Provider lifecycle event types
+const (
+    ProviderEventCreated            = "created"
+    ProviderEventDeleted            = "deleted"
+    ProviderEventEnabled            = "enabled"
+    ProviderEventDrained            = "drained" // deactivated, gets no new calls
+    ProviderEventHealthDown         = "health_down"
+    ProviderEventHealthUp           = "health_up"
+    ProviderEventQuarantined        = "quarantined"
+    ProviderEventQuarantineReleased = "quarantine_released"
+    ProviderEventCredentialsRotated = "credentials_rotated"
+    ProviderEventWeightsChanged     = "weights_changed" // weight or priority
+)
+
+// ProviderEventTypes lists the recorded event types
+var ProviderEventTypes = []string{
+    ProviderEventCreated, ProviderEventDeleted, ProviderEventEnabled, ProviderEventDrained,
+    ProviderEventHealthDown, ProviderEventHealthUp, ProviderEventQuarantined,
+    ProviderEventQuarantineReleased, ProviderEventCredentialsRotated, ProviderEventWeightsChanged,
+}
+
+// ProviderEvent is one entry of a provider's timeline. Events outlive the
+// provider so deleted providers keep their history.
+type ProviderEvent struct {
+    ID           int64     `json:"id"`
+    ProviderName string    `json:"provider_name"`
+    EventType    string    `json:"event_type"`
+    Actor        string    `json:"actor,omitempty"` // operator, or "router" for automatic changes
+    Detail       string    `json:"detail,omitempty"`
+    CreatedAt    time.Time `json:"created_at"`
+}
+
+// ProviderEventFilter narrows down a provider event search
+type ProviderEventFilter struct {
+    Provider  string    `json:"provider,omitempty"` // empty for every provider
+    EventType string    `json:"event_type,omitempty"`
+    Since     time.Time `json:"since,omitempty"`
+    Until     time.Time `json:"until,omitempty"`
+    Limit     int       `json:"limit,omitempty"`
+}
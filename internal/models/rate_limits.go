@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Rate limit scopes
+const (
+    RateLimitRoute    = "route"
+    RateLimitProvider = "provider"
+    RateLimitPrefix   = "prefix" // the longest prefix matching the destination applies
+)
+
+// RateLimit caps the call setups per second and concurrent calls of a route,
+// a provider or a destination prefix. A zero cap is not enforced.
+type RateLimit struct {
+    Scope         string    `json:"scope"`
+    Value         string    `json:"value"`
+    MaxCPS        float64   `json:"max_cps"`
+    MaxConcurrent int       `json:"max_concurrent"`
+    UpdatedBy     string    `json:"updated_by,omitempty"`
+    UpdatedAt     time.Time `json:"updated_at"`
+    ActiveCalls   int       `json:"active_calls"` // live usage on this router instance
+    CPS           float64   `json:"cps"`          // over the last second
+}
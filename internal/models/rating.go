@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// CustomerRate is one line of a customer's rate deck: the per minute price of
+// calls to destinations starting with Prefix. The longest matching prefix
+// applies; calls matching none are billed at the customer's cost_per_minute.
+type CustomerRate struct {
+    Customer      string    `json:"customer"`
+    Prefix        string    `json:"prefix"`
+    Rate          float64   `json:"rate"`                     // per billable minute
+    ConnectionFee float64   `json:"connection_fee,omitempty"` // per answered call
+    Currency      string    `json:"currency,omitempty"`       // empty for the reporting currency
+    Description   string    `json:"description,omitempty"`
+    UpdatedBy     string    `json:"updated_by,omitempty"`
+    UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// BillingSummary totals the revenue, cost and margin of a customer's rated
+// production calls over a period
+type BillingSummary struct {
+    Customer      string  `json:"customer"`
+    Calls         int64   `json:"calls"`
+    Answered      int64   `json:"answered"`
+    BilledMinutes float64 `json:"billed_minutes"`
+    Revenue       float64 `json:"revenue"`
+    Cost          float64 `json:"cost"`
+    Margin        float64 `json:"margin"`
+    MarginPercent float64 `json:"margin_percent"` // of revenue
+    Currency      string  `json:"currency"`
+}
+
+// BillingReport is the billing of all customers over a period. DID rental is
+// the monthly_cost of the DIDs prorated to the period, left out of the per
+// call margins and taken off the net margin.
+type BillingReport struct {
+    From      time.Time         `json:"from"`
+    To        time.Time         `json:"to"`
+    Customers []*BillingSummary `json:"customers"`
+    Total     BillingSummary    `json:"total"`
+    DIDRental float64           `json:"did_rental"`
+    NetMargin float64           `json:"net_margin"`
+}
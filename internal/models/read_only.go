@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// ReadOnlyMode is the state of the management plane freeze. While it is on,
+// the CLI and API refuse every change and calls keep being routed. A freeze
+// set in the configuration can't be lifted at runtime.
+type ReadOnlyMode struct {
+    Enabled    bool       `json:"enabled"`
+    Configured bool       `json:"configured"` // security.read_only is set
+    Reason     string     `json:"reason,omitempty"`
+    SetBy      string     `json:"set_by,omitempty"`
+    SetAt      *time.Time `json:"set_at,omitempty"`
+}
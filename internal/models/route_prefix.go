@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RoutePrefix sends calls to destinations starting with Prefix to a route,
+// whichever provider they come in from. The longest matching prefix wins;
+// calls matching none are routed by their inbound provider.
+type RoutePrefix struct {
+    Prefix      string    `json:"prefix"` // digits, without + or 00
+    Route       string    `json:"route"`
+    Description string    `json:"description,omitempty"`
+    UpdatedBy   string    `json:"updated_by,omitempty"`
+    UpdatedAt   time.Time `json:"updated_at"`
+}
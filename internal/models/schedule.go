@@ -0,0 +1,91 @@
+package models
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Weekdays are the day names of schedule windows, in time.Weekday order
+var Weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// RouteSchedule limits a route to weekly windows, it is kept under
+// "schedule" in the route's routing_rules. Outside its windows the route is
+// passed over and the next route matching the call takes it.
+type RouteSchedule struct {
+    Windows  []ScheduleWindow `json:"windows"`
+    Holidays string           `json:"holidays,omitempty"` // country whose holidays the route is closed on
+}
+
+// ScheduleWindow is a time of day range on some days of the week. A window
+// ending before it starts runs past midnight into the next day.
+type ScheduleWindow struct {
+    Days     []string `json:"days"`               // mon, tue, ...
+    Start    string   `json:"start"`              // HH:MM
+    End      string   `json:"end"`                // HH:MM, exclusive
+    Timezone string   `json:"timezone,omitempty"` // IANA zone, UTC when empty
+}
+
+// IsEmpty reports whether the schedule has no window
+func (s *RouteSchedule) IsEmpty() bool {
+    return s == nil || len(s.Windows) == 0
+}
+
+// String renders the windows as given to route add --schedule
+func (s *RouteSchedule) String() string {
+    if s.IsEmpty() {
+        return ""
+    }
+
+    windows := make([]string, len(s.Windows))
+    for i, w := range s.Windows {
+        windows[i] = w.String()
+    }
+    out := strings.Join(windows, "; ")
+    if s.Holidays != "" {
+        out += fmt.Sprintf("; closed on %s holidays", s.Holidays)
+    }
+    return out
+}
+
+// String renders the window as "mon-fri 08:00-18:00 America/Caracas"
+func (w ScheduleWindow) String() string {
+    out := formatDays(w.Days) + " " + w.Start + "-" + w.End
+    if w.Timezone != "" {
+        out += " " + w.Timezone
+    }
+    return out
+}
+
+// formatDays joins days, runs of three or more as ranges
+func formatDays(days []string) string {
+    on := make(map[string]bool, len(days))
+    for _, d := range days {
+        on[d] = true
+    }
+    if len(on) == len(Weekdays) {
+        return "daily"
+    }
+
+    // Weeks read monday first
+    order := append(append([]string{}, Weekdays[1:]...), Weekdays[0])
+    var parts []string
+    for i := 0; i < len(order); i++ {
+        if !on[order[i]] {
+            continue
+        }
+        j := i
+        for j+1 < len(order) && on[order[j+1]] {
+            j++
+        }
+        switch {
+        case j-i >= 2:
+            parts = append(parts, order[i]+"-"+order[j])
+        case j > i:
+            parts = append(parts, order[i], order[j])
+        default:
+            parts = append(parts, order[i])
+        }
+        i = j
+    }
+    return strings.Join(parts, ",")
+}
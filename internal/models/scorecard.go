@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Scorecard metrics
+const (
+    ScoreASR          = "asr"
+    ScoreACD          = "acd"
+    ScorePDD          = "pdd"
+    ScoreMOS          = "mos"
+    ScoreVerification = "verification"
+    ScoreSLA          = "sla"
+    ScoreCost         = "cost"
+)
+
+// ScorecardMetrics lists the metrics in the order scorecards show them
+var ScorecardMetrics = []string{ScoreASR, ScoreACD, ScorePDD, ScoreMOS, ScoreVerification, ScoreSLA, ScoreCost}
+
+// ScorecardMetric is one measure of a provider over the period, scored from
+// 0 (poor) to 100 (good), with the previous period for the trend
+type ScorecardMetric struct {
+    Name          string   `json:"name"`
+    Value         *float64 `json:"value"` // nil when nothing was measured
+    Score         *float64 `json:"score"`
+    Weight        float64  `json:"weight"`
+    PreviousValue *float64 `json:"previous_value,omitempty"`
+    PreviousScore *float64 `json:"previous_score,omitempty"`
+}
+
+// ProviderScorecard combines a provider's quality, compliance and cost over a
+// period into one weighted score
+type ProviderScorecard struct {
+    ProviderName  string            `json:"provider_name"`
+    Type          ProviderType      `json:"type"`
+    Since         time.Time         `json:"since"`
+    Until         time.Time         `json:"until"`
+    Calls         int64             `json:"calls"`
+    PreviousCalls int64             `json:"previous_calls"`
+    Score         *float64          `json:"score"` // weighted over the measured metrics
+    PreviousScore *float64          `json:"previous_score,omitempty"`
+    Currency      string            `json:"currency"` // of the cost metric
+    Metrics       []ScorecardMetric `json:"metrics"`
+    Reliability   Reliability       `json:"reliability"` // health check outages over the period, not scored
+}
+
+// Metric returns the named metric, nil when the scorecard has none
+func (s *ProviderScorecard) Metric(name string) *ScorecardMetric {
+    for i := range s.Metrics {
+        if s.Metrics[i].Name == name {
+            return &s.Metrics[i]
+        }
+    }
+    return nil
+}
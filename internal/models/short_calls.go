@@ -0,0 +1,34 @@
+package models
+
+// Short call limit actions
+const (
+    ShortCallActionAlert    = "alert"
+    ShortCallActionThrottle = "throttle"
+)
+
+// Traffic directions of a provider
+const (
+    DirectionInbound  = "inbound"
+    DirectionOutbound = "outbound"
+)
+
+// ShortCallLimit is the contractual cap on the share of short calls of a provider
+type ShortCallLimit struct {
+    ProviderName string  `json:"provider_name"`
+    MaxRatio     float64 `json:"max_ratio"` // percent of answered calls
+    Action       string  `json:"action"`
+}
+
+// ShortCallStats is the share of answered calls below the short call threshold
+// for an inbound customer or an outbound provider
+type ShortCallStats struct {
+    ProviderName  string  `json:"provider_name"`
+    Direction     string  `json:"direction"`
+    AnsweredCalls int     `json:"answered_calls"`
+    ShortCalls    int     `json:"short_calls"`
+    Ratio         float64 `json:"ratio"`               // percent
+    MaxRatio      float64 `json:"max_ratio,omitempty"` // contractual limit, 0 when none
+    Action        string  `json:"action,omitempty"`
+    Exceeded      bool    `json:"exceeded"`
+    Throttled     bool    `json:"throttled"`
+}
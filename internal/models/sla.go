@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// ProviderSLA is the service level a provider agreed to. Zero targets are not
+// tracked; credits are shares of the month's spend with the provider.
+type ProviderSLA struct {
+    ProviderName       string    `json:"provider_name"`
+    MaxPDDMs           int       `json:"max_pdd_ms,omitempty"`          // average post dial delay of answered calls
+    MinASR             float64   `json:"min_asr,omitempty"`             // percent of calls answered
+    MinAvailability    float64   `json:"min_availability,omitempty"`    // percent of the month not marked down by health checks
+    PDDCredit          float64   `json:"pdd_credit,omitempty"`          // percent credited when PDD is missed
+    ASRCredit          float64   `json:"asr_credit,omitempty"`          // percent credited when ASR is missed
+    AvailabilityCredit float64   `json:"availability_credit,omitempty"` // percent credited when availability is missed
+    MaxCredit          float64   `json:"max_credit,omitempty"`          // cap on the credits of a month, percent
+    Notes              string    `json:"notes,omitempty"`
+    UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// SLA metrics
+const (
+    SLAMetricPDD          = "pdd"
+    SLAMetricASR          = "asr"
+    SLAMetricAvailability = "availability"
+)
+
+// SLABreach is a target a provider missed in a month
+type SLABreach struct {
+    Metric string  `json:"metric"`
+    Target float64 `json:"target"`
+    Actual float64 `json:"actual"`
+    Credit float64 `json:"credit"` // percent of spend, before the cap
+}
+
+// SLAOutage is a stretch a provider was marked down by health checks
+type SLAOutage struct {
+    Start   time.Time `json:"start"`
+    End     time.Time `json:"end"`
+    Seconds int64     `json:"seconds"`
+}
+
+// SLAReport is how a provider did against its SLA in a calendar month. Calls
+// are the legs it carried from S2, as PDD and ASR are only measured there.
+type SLAReport struct {
+    ProviderName    string       `json:"provider_name"`
+    Month           string       `json:"month"` // YYYY-MM
+    Calls           int64        `json:"calls"`
+    Answered        int64        `json:"answered"`
+    ASR             float64      `json:"asr"`
+    AvgPDDMs        int          `json:"avg_pdd_ms"`
+    Availability    float64      `json:"availability"`
+    DowntimeSeconds int64        `json:"downtime_seconds"`
+    Failures        int          `json:"failures"`               // outages in the month
+    MTTRSeconds     *int64       `json:"mttr_seconds,omitempty"` // see Reliability
+    MTBFSeconds     *int64       `json:"mtbf_seconds,omitempty"`
+    Minutes         float64      `json:"minutes"`
+    Spend           float64      `json:"spend"`
+    Currency        string       `json:"currency"`
+    CreditPercent   float64      `json:"credit_percent"`
+    Credit          float64      `json:"credit"`
+    Breaches        []SLABreach  `json:"breaches,omitempty"`
+    Outages         []SLAOutage  `json:"outages,omitempty"`
+    Target          *ProviderSLA `json:"target"`   // the SLA as it was when generated
+    Complete        bool         `json:"complete"` // false for a month still running
+    GeneratedAt     time.Time    `json:"generated_at"`
+}
+
+// Compliant reports whether the provider met every target
+func (r *SLAReport) Compliant() bool {
+    return len(r.Breaches) == 0
+}
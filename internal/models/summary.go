@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Summary is the state of the platform at a glance, for wallboards polling
+// every few seconds. Call figures leave test calls out.
+type Summary struct {
+    GeneratedAt        time.Time           `json:"generated_at"`
+    ActiveCalls        int64               `json:"active_calls"`      // open call records of every node
+    NodeActiveCalls    int                 `json:"node_active_calls"` // calls this node is routing
+    CPS                float64             `json:"cps"`               // calls per second over the last minute
+    CallsLastHour      int64               `json:"calls_last_hour"`
+    AnsweredLastHour   int64               `json:"answered_last_hour"`
+    ASRLastHour        float64             `json:"asr_last_hour"` // percent of the calls of the last hour that ended
+    DIDs               DIDUtilization      `json:"dids"`
+    UnhealthyProviders []UnhealthyProvider `json:"unhealthy_providers"`
+    TopFailures        []FailureCount      `json:"top_failures"` // last hour, by disposition
+}
+
+// DIDUtilization is how much of the DID pool is allocated to calls
+type DIDUtilization struct {
+    Total       int64   `json:"total"`
+    InUse       int64   `json:"in_use"`
+    Available   int64   `json:"available"`
+    Utilization float64 `json:"utilization"` // percent in use
+}
+
+// UnhealthyProvider is an active provider its health checks marked down
+type UnhealthyProvider struct {
+    Name                string     `json:"name"`
+    HealthScore         int        `json:"health_score"`
+    ConsecutiveFailures int        `json:"consecutive_failures"`
+    LastFailure         *time.Time `json:"last_failure,omitempty"`
+}
+
+// FailureCount is the number of calls that failed for one reason
+type FailureCount struct {
+    Reason string `json:"reason"`
+    Calls  int64  `json:"calls"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Synthetic probe modes
+const (
+    SyntheticModeCancel = "cancel" // INVITE, hang up on ringing
+    SyntheticModeAnswer = "answer" // short announced call
+)
+
+// Synthetic probe outcomes
+const (
+    SyntheticOutcomeAnswered = "answered"
+    SyntheticOutcomeRinging  = "ringing"
+    SyntheticOutcomeBusy     = "busy"
+    SyntheticOutcomeNoAnswer = "no_answer"
+    SyntheticOutcomeFailed   = "failed"
+    SyntheticOutcomeTimeout  = "timeout"
+)
+
+// SyntheticProbe is a scheduled test call through a provider or every provider of a route
+type SyntheticProbe struct {
+    ID        int64         `json:"id"`
+    Name      string        `json:"name"`
+    Provider  string        `json:"provider,omitempty"`
+    Route     string        `json:"route,omitempty"`
+    DNIS      string        `json:"dnis"`
+    ANI       string        `json:"ani,omitempty"`
+    Mode      string        `json:"mode"`
+    Interval  time.Duration `json:"interval"`
+    Enabled   bool          `json:"enabled"`
+    LastRunAt *time.Time    `json:"last_run_at,omitempty"`
+    CreatedAt time.Time     `json:"created_at"`
+}
+
+// SyntheticResult is one probe call, kept apart from call_records
+type SyntheticResult struct {
+    ID        int64     `json:"id"`
+    Probe     string    `json:"probe"`
+    Provider  string    `json:"provider"`
+    Route     string    `json:"route,omitempty"`
+    StartedAt time.Time `json:"started_at"`
+    Outcome   string    `json:"outcome"`
+    Success   bool      `json:"success"`
+    PDD       int64     `json:"pdd_ms"` // post dial delay until ringing or answer, 0 if neither
+    Cause     int       `json:"cause,omitempty"`
+    Reason    string    `json:"reason,omitempty"`
+}
+
+// ProbeCallRequest describes a synthetic call placed over AMI
+type ProbeCallRequest struct {
+    Endpoint     string
+    DNIS         string
+    CallerID     string
+    Timeout      time.Duration
+    CancelOnRing bool
+}
+
+// ProbeCallResult is what Asterisk reported for a probe call
+type ProbeCallResult struct {
+    Ringing   bool
+    Answered  bool
+    PDD       time.Duration
+    Cause     int    // Q.850 hangup cause
+    CauseText string
+    Reason    string // set when the call never reached Asterisk's Hangup, e.g. timeout
+}
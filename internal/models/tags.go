@@ -0,0 +1,86 @@
+package models
+
+import (
+    "fmt"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+var tagKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// Tags are free-form key/value labels such as tier=premium or contract=2024
+type Tags map[string]string
+
+// ParseTags parses key=value pairs. With allowBare a bare key is accepted and
+// maps to an empty value, which selectors treat as "key is set".
+func ParseTags(pairs []string, allowBare bool) (Tags, error) {
+    tags := make(Tags, len(pairs))
+    for _, pair := range pairs {
+        key, value, hasValue := strings.Cut(pair, "=")
+        key = strings.TrimSpace(key)
+        
+        if !tagKeyPattern.MatchString(key) {
+            return nil, fmt.Errorf("invalid tag key %q", key)
+        }
+        if !hasValue && !allowBare {
+            return nil, fmt.Errorf("tag %q must be key=value", pair)
+        }
+        if len(value) > 255 {
+            return nil, fmt.Errorf("tag %q value is longer than 255 characters", key)
+        }
+        
+        tags[key] = strings.TrimSpace(value)
+    }
+    return tags, nil
+}
+
+// Matches reports whether every selector tag is present, empty selector values match any value
+func (t Tags) Matches(selector Tags) bool {
+    for key, want := range selector {
+        got, ok := t[key]
+        if !ok || (want != "" && got != want) {
+            return false
+        }
+    }
+    return true
+}
+
+// String renders the tags sorted by key
+func (t Tags) String() string {
+    keys := make([]string, 0, len(t))
+    for k := range t {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    
+    parts := make([]string, len(keys))
+    for i, k := range keys {
+        parts[i] = k + "=" + t[k]
+    }
+    return strings.Join(parts, ",")
+}
+
+// TagSelectorSQL returns one condition per selector tag requiring a matching
+// provider_tags row. providerMatch ties pt.provider_name to the outer query,
+// e.g. "pt.provider_name = providers.name".
+func TagSelectorSQL(providerMatch string, selector Tags) ([]string, []interface{}) {
+    keys := make([]string, 0, len(selector))
+    for k := range selector {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    
+    var conditions []string
+    var args []interface{}
+    for _, key := range keys {
+        cond := "EXISTS (SELECT 1 FROM provider_tags pt WHERE " + providerMatch + " AND pt.tag_key = ?"
+        args = append(args, key)
+        if value := selector[key]; value != "" {
+            cond += " AND pt.tag_value = ?"
+            args = append(args, value)
+        }
+        conditions = append(conditions, cond+")")
+    }
+    return conditions, args
+}
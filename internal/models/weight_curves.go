@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// HoursPerDay is the length of a weight curve
+const HoursPerDay = 24
+
+// WeightCurve is the weight a provider gets on a route for each hour of the
+// day, applied over its provider or group member weight
+type WeightCurve struct {
+    RouteName    string           `json:"route_name"`
+    ProviderName string           `json:"provider_name"`
+    Weights      [HoursPerDay]int `json:"weights"`            // weight from each hour to the next, 0 to 23
+    Timezone     string           `json:"timezone,omitempty"` // IANA zone of the hours, the server's when empty
+    UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// Location is the zone the curve's hours are in
+func (c *WeightCurve) Location() *time.Location {
+    if c.Timezone != "" {
+        if loc, err := time.LoadLocation(c.Timezone); err == nil {
+            return loc
+        }
+    }
+    return time.Local
+}
+
+// WeightAt returns the weight of the hour holding t
+func (c *WeightCurve) WeightAt(t time.Time) int {
+    return c.Weights[t.In(c.Location()).Hour()]
+}
@@ -0,0 +1,105 @@
+package numbering
+
+import (
+    "strings"
+    "sync"
+)
+
+// Unknown is returned for numbers that match no calling code
+const Unknown = "ZZ"
+
+// maxPrefixLength is the longest prefix in the plan, NANP area codes are 4 digits
+const maxPrefixLength = 4
+
+// Country is the result of a numbering plan lookup
+type Country struct {
+    Code     string `json:"code"`      // ISO 3166-1 alpha-2
+    DialCode string `json:"dial_code"` // matched prefix without +
+}
+
+var (
+    planOnce sync.Once
+    plan     map[string]string
+)
+
+// Normalize strips formatting and international prefixes, leaving the digits
+// of an E.164 number without the leading +
+func Normalize(number string) string {
+    number = strings.TrimSpace(number)
+    number = strings.TrimPrefix(number, "+")
+    
+    var b strings.Builder
+    for _, c := range number {
+        if c >= '0' && c <= '9' {
+            b.WriteRune(c)
+        }
+    }
+    
+    digits := b.String()
+    if strings.HasPrefix(digits, "00") {
+        digits = digits[2:]
+    }
+    return digits
+}
+
+// IsE164 reports whether number is an E.164 number, written with or without
+// the leading +: up to 15 digits starting with a calling code the plan knows
+func IsE164(number string) bool {
+    digits := strings.TrimPrefix(number, "+")
+    if len(digits) < 7 || len(digits) > 15 || digits[0] == '0' {
+        return false
+    }
+    for _, c := range digits {
+        if c < '0' || c > '9' {
+            return false
+        }
+    }
+    
+    _, known := Lookup(digits)
+    return known
+}
+
+// Lookup resolves the destination country of a number by longest calling code prefix
+func Lookup(number string) (Country, bool) {
+    planOnce.Do(loadPlan)
+    
+    digits := Normalize(number)
+    for n := maxPrefixLength; n > 0; n-- {
+        if len(digits) < n {
+            continue
+        }
+        if code, ok := plan[digits[:n]]; ok {
+            return Country{Code: code, DialCode: digits[:n]}, true
+        }
+    }
+    
+    return Country{Code: Unknown}, false
+}
+
+// CountryOf returns the ISO code of a number, Unknown when it can't be resolved
+func CountryOf(number string) string {
+    country, _ := Lookup(number)
+    return country.Code
+}
+
+// IsCountryCode reports whether code is a country the plan knows
+func IsCountryCode(code string) bool {
+    planOnce.Do(loadPlan)
+    
+    for _, c := range plan {
+        if c == code {
+            return true
+        }
+    }
+    return false
+}
+
+func loadPlan() {
+    plan = make(map[string]string, len(callingCodes)+len(nanpCodes))
+    for prefix, code := range callingCodes {
+        plan[prefix] = code
+    }
+    for areaCode, code := range nanpCodes {
+        plan["1"+areaCode] = code
+    }
+}
@@ -0,0 +1,196 @@
+package provider
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "net"
+    "sort"
+    "strings"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// Conflict kinds
+const (
+    ConflictHostPort   = "host_port"   // two providers at the same host and port
+    ConflictIdentifyIP = "identify_ip" // an address matched by the identify entries of two endpoints
+)
+
+// Conflict is an overlap between provider definitions that leaves Asterisk
+// unable to tell which endpoint a call comes from
+type Conflict struct {
+    Kind      string   `json:"kind"`
+    Value     string   `json:"value"`
+    Providers []string `json:"providers"` // endpoints that aren't a provider's are listed by id
+}
+
+// identifyEntry is one address or network of a ps_endpoint_id_ips match
+type identifyEntry struct {
+    endpoint string
+    raw      string
+    network  *net.IPNet // nil for host names, compared by name
+}
+
+// FindConflicts lists the providers sharing a host and port and the identify
+// entries matching the same addresses
+func (s *Service) FindConflicts(ctx context.Context) ([]*Conflict, error) {
+    rows, err := s.db.QueryContext(ctx, `
+        SELECT LOWER(host), port, GROUP_CONCAT(name ORDER BY name)
+        FROM providers
+        WHERE host <> ''
+        GROUP BY LOWER(host), port
+        HAVING COUNT(*) > 1
+        ORDER BY LOWER(host), port`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to check provider hosts")
+    }
+    defer rows.Close()
+
+    var conflicts []*Conflict
+    for rows.Next() {
+        var host, names string
+        var port int
+        if err := rows.Scan(&host, &port, &names); err != nil {
+            continue
+        }
+        conflicts = append(conflicts, &Conflict{
+            Kind:      ConflictHostPort,
+            Value:     fmt.Sprintf("%s:%d", host, port),
+            Providers: strings.Split(names, ","),
+        })
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to check provider hosts")
+    }
+
+    entries, err := s.identifyEntries(ctx, "")
+    if err != nil {
+        return nil, err
+    }
+    seen := make(map[string]bool)
+    for i, a := range entries {
+        for _, b := range entries[i+1:] {
+            if a.endpoint == b.endpoint || !a.overlaps(b) {
+                continue
+            }
+            value := a.raw
+            if a.raw != b.raw {
+                value = a.raw + " / " + b.raw
+            }
+            providers := []string{endpointProvider(a.endpoint), endpointProvider(b.endpoint)}
+            sort.Strings(providers)
+            key := value + "|" + strings.Join(providers, ",")
+            if seen[key] {
+                continue
+            }
+            seen[key] = true
+            conflicts = append(conflicts, &Conflict{Kind: ConflictIdentifyIP, Value: value, Providers: providers})
+        }
+    }
+
+    return conflicts, nil
+}
+
+// checkConflicts rejects a provider whose host and port, or identify address,
+// is already claimed by another provider
+func (s *Service) checkConflicts(ctx context.Context, provider *models.Provider) error {
+    // Registering customers have no static host
+    if provider.Host == "" {
+        return nil
+    }
+
+    var other string
+    err := s.db.QueryRowContext(ctx, `
+        SELECT name FROM providers
+        WHERE LOWER(host) = LOWER(?) AND port = ? AND name <> ?
+        ORDER BY name LIMIT 1`,
+        provider.Host, provider.Port, provider.Name).Scan(&other)
+    if err == nil {
+        return errors.New(errors.ErrInternal, "host and port already used by another provider").
+            WithContext("provider", other).
+            WithContext("host", fmt.Sprintf("%s:%d", provider.Host, provider.Port))
+    }
+    if err != sql.ErrNoRows {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to check provider hosts")
+    }
+
+    if provider.AuthType != "ip" && provider.AuthType != "both" {
+        return nil
+    }
+
+    entries, err := s.identifyEntries(ctx, "endpoint-"+provider.Name)
+    if err != nil {
+        return err
+    }
+    for _, match := range parseIdentifyMatch("endpoint-"+provider.Name, provider.Host) {
+        for _, entry := range entries {
+            if match.overlaps(entry) {
+                return errors.New(errors.ErrInternal, "address already identifies another endpoint").
+                    WithContext("provider", endpointProvider(entry.endpoint)).
+                    WithContext("match", entry.raw)
+            }
+        }
+    }
+    return nil
+}
+
+// identifyEntries loads the identify entries of every endpoint but exclude
+func (s *Service) identifyEntries(ctx context.Context, exclude string) ([]*identifyEntry, error) {
+    rows, err := s.db.QueryContext(ctx, "SELECT endpoint, `match` FROM ps_endpoint_id_ips WHERE endpoint <> ? ORDER BY endpoint", exclude)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to check identify entries")
+    }
+    defer rows.Close()
+
+    var entries []*identifyEntry
+    for rows.Next() {
+        var endpoint, match string
+        if err := rows.Scan(&endpoint, &match); err != nil {
+            continue
+        }
+        entries = append(entries, parseIdentifyMatch(endpoint, match)...)
+    }
+    return entries, rows.Err()
+}
+
+// parseIdentifyMatch splits a match, a comma separated list of addresses,
+// networks and host names as Asterisk reads it
+func parseIdentifyMatch(endpoint, match string) []*identifyEntry {
+    var entries []*identifyEntry
+    for _, raw := range strings.Split(match, ",") {
+        raw = strings.TrimSpace(raw)
+        if raw == "" {
+            continue
+        }
+        entry := &identifyEntry{endpoint: endpoint, raw: raw}
+        if _, network, err := net.ParseCIDR(raw); err == nil {
+            entry.network = network
+        } else if ip := net.ParseIP(raw); ip != nil {
+            bits := 128
+            if ip.To4() != nil {
+                ip, bits = ip.To4(), 32
+            }
+            entry.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+        }
+        entries = append(entries, entry)
+    }
+    return entries
+}
+
+func (e *identifyEntry) overlaps(other *identifyEntry) bool {
+    if e.network == nil || other.network == nil {
+        return strings.EqualFold(e.raw, other.raw)
+    }
+    return e.network.Contains(other.network.IP) || other.network.Contains(e.network.IP)
+}
+
+// endpointProvider names the provider of an endpoint, or the endpoint itself
+// when it wasn't created for one
+func endpointProvider(endpoint string) string {
+    if name := strings.TrimPrefix(endpoint, "endpoint-"); name != endpoint {
+        return name
+    }
+    return endpoint
+}
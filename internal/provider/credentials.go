@@ -0,0 +1,296 @@
+package provider
+
+import (
+    "context"
+    "crypto/rand"
+    "fmt"
+    "math/big"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+const (
+    generatedPasswordLength = 24
+    passwordAlphabet        = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789"
+)
+
+// RotateCredentials generates a new SIP password and stores it on the provider
+// and its ARA auth in one transaction. With a positive overlap the old password
+// keeps working until ExpireCredentialOverlaps runs after the window.
+func (s *Service) RotateCredentials(ctx context.Context, name string, overlap time.Duration, rotatedBy string) (*models.CredentialRotation, error) {
+    provider, err := s.GetProvider(ctx, name)
+    if err != nil {
+        return nil, err
+    }
+    if !provider.UsesCredentials() {
+        return nil, errors.New(errors.ErrInternal, "provider does not use credential auth").
+            WithContext("provider", name).
+            WithContext("auth_type", provider.AuthType)
+    }
+    
+    password, err := generatePassword(generatedPasswordLength)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to generate password")
+    }
+    
+    rotation := &models.CredentialRotation{
+        ProviderName: name,
+        RotatedBy:    rotatedBy,
+        RotatedAt:    time.Now(),
+        Password:     password,
+    }
+    if overlap > 0 {
+        until := rotation.RotatedAt.Add(overlap)
+        rotation.OverlapUntil = &until
+    } else {
+        rotation.PreviousExpiredAt = &rotation.RotatedAt
+    }
+    
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+    
+    if _, err := tx.ExecContext(ctx, "UPDATE providers SET password = ?, updated_at = NOW() WHERE name = ?", password, name); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to update provider password")
+    }
+    
+    if err := s.araManager.RotateAuthTx(ctx, tx, name, password, overlap > 0); err != nil {
+        return nil, err
+    }
+    
+    // An earlier overlap ends now, its password was just replaced by the current one
+    if _, err := tx.ExecContext(ctx, `
+        UPDATE credential_rotations SET previous_expired_at = NOW()
+        WHERE provider_name = ? AND previous_expired_at IS NULL`, name); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to close previous rotation")
+    }
+    
+    result, err := tx.ExecContext(ctx, `
+        INSERT INTO credential_rotations (provider_name, rotated_by, rotated_at, overlap_until, previous_expired_at)
+        VALUES (?, ?, ?, ?, ?)`,
+        name, rotatedBy, rotation.RotatedAt, rotation.OverlapUntil, rotation.PreviousExpiredAt)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to record rotation")
+    }
+    rotation.ID, _ = result.LastInsertId()
+    
+    detail := "previous password expired"
+    if rotation.OverlapUntil != nil {
+        detail = "previous password valid for " + overlap.String()
+    }
+    if err := audit.RecordProviderEvent(ctx, tx, models.ProviderEvent{
+        ProviderName: name,
+        EventType:    models.ProviderEventCredentialsRotated,
+        Actor:        rotatedBy,
+        Detail:       detail,
+    }); err != nil {
+        return nil, err
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    
+    s.cache.Invalidate(ctx, fmt.Sprintf("provider:%s", name))
+    s.cache.Invalidate(ctx, fmt.Sprintf("providers:%s", provider.Type))
+    s.reloadPJSIP(ctx)
+    
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "provider":   name,
+        "overlap":    overlap.String(),
+        "rotated_by": rotatedBy,
+    }).Info("Provider credentials rotated")
+    
+    return rotation, nil
+}
+
+// ExpirePreviousCredential ends the overlap for one provider right away
+func (s *Service) ExpirePreviousCredential(ctx context.Context, name string) error {
+    if err := s.expireOverlap(ctx, name); err != nil {
+        return err
+    }
+    s.reloadPJSIP(ctx)
+    return nil
+}
+
+// ExpireCredentialOverlaps drops previous passwords whose overlap window has passed
+func (s *Service) ExpireCredentialOverlaps(ctx context.Context) (int, error) {
+    rows, err := s.db.QueryContext(ctx, `
+        SELECT DISTINCT provider_name FROM credential_rotations
+        WHERE previous_expired_at IS NULL AND overlap_until <= NOW()`)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to query credential rotations")
+    }
+    
+    var names []string
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err == nil {
+            names = append(names, name)
+        }
+    }
+    rows.Close()
+    
+    expired := 0
+    for _, name := range names {
+        if err := s.expireOverlap(ctx, name); err != nil {
+            logger.WithContext(ctx).WithError(err).WithField("provider", name).Warn("Failed to expire previous credential")
+            continue
+        }
+        expired++
+    }
+    
+    if expired > 0 {
+        s.reloadPJSIP(ctx)
+        logger.WithContext(ctx).WithField("providers", expired).Info("Expired previous provider credentials")
+    }
+    
+    return expired, nil
+}
+
+// RunCredentialExpiry expires overlap windows periodically until ctx is done
+func (s *Service) RunCredentialExpiry(ctx context.Context, interval time.Duration) {
+    if interval <= 0 {
+        interval = time.Minute
+    }
+    
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    
+    for {
+        select {
+        case <-ticker.C:
+            if _, err := s.ExpireCredentialOverlaps(ctx); err != nil {
+                logger.WithContext(ctx).WithError(err).Warn("Credential expiry check failed")
+            }
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (s *Service) expireOverlap(ctx context.Context, name string) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+    
+    if err := s.araManager.DropPreviousAuthTx(ctx, tx, name); err != nil {
+        return err
+    }
+    
+    if _, err := tx.ExecContext(ctx, `
+        UPDATE credential_rotations SET previous_expired_at = NOW()
+        WHERE provider_name = ? AND previous_expired_at IS NULL`, name); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to close rotation")
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+func (s *Service) reloadPJSIP(ctx context.Context) {
+    if s.amiManager == nil {
+        return
+    }
+    if err := s.amiManager.ReloadPJSIP(); err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to reload PJSIP via AMI")
+    }
+}
+
+func generatePassword(length int) (string, error) {
+    max := big.NewInt(int64(len(passwordAlphabet)))
+    buf := make([]byte, length)
+    for i := range buf {
+        n, err := rand.Int(rand.Reader, max)
+        if err != nil {
+            return "", err
+        }
+        buf[i] = passwordAlphabet[n.Int64()]
+    }
+    return string(buf), nil
+}
+
+// SetCredentials changes the SIP username and/or password of a digest auth
+// provider. An empty password generates a new one, which is returned.
+func (s *Service) SetCredentials(ctx context.Context, name, username, password string) (string, error) {
+    provider, err := s.GetProvider(ctx, name)
+    if err != nil {
+        return "", err
+    }
+    if !provider.UsesCredentials() {
+        return "", errors.New(errors.ErrInternal, "provider does not use credential auth").
+            WithContext("provider", name).
+            WithContext("auth_type", provider.AuthType)
+    }
+    
+    if password == "" {
+        if password, err = generatePassword(generatedPasswordLength); err != nil {
+            return "", errors.Wrap(err, errors.ErrInternal, "failed to generate password")
+        }
+    }
+    
+    updates := map[string]interface{}{"password": password}
+    if username != "" {
+        updates["username"] = username
+    }
+    
+    if err := s.UpdateProvider(ctx, name, updates); err != nil {
+        return "", err
+    }
+    
+    return password, nil
+}
+
+// RegisteredContacts returns the contacts a registering customer currently holds
+func (s *Service) RegisteredContacts(ctx context.Context, name string) ([]*models.SIPContact, error) {
+    provider, err := s.GetProvider(ctx, name)
+    if err != nil {
+        return nil, err
+    }
+    return s.araManager.ListContacts(ctx, provider)
+}
+
+func (s *Service) testRegistration(ctx context.Context, provider *models.Provider) TestResult {
+    start := time.Now()
+    
+    contacts, err := s.araManager.ListContacts(ctx, provider)
+    if err != nil {
+        return TestResult{
+            Success:  false,
+            Message:  fmt.Sprintf("Failed to read contacts: %v", err),
+            Duration: time.Since(start),
+        }
+    }
+    
+    var active []*models.SIPContact
+    for _, c := range contacts {
+        if c.ExpiresAt == nil || c.ExpiresAt.After(time.Now()) {
+            active = append(active, c)
+        }
+    }
+    
+    if len(active) == 0 {
+        return TestResult{
+            Success:  false,
+            Message:  "No registered contacts",
+            Duration: time.Since(start),
+        }
+    }
+    
+    return TestResult{
+        Success:  true,
+        Message:  fmt.Sprintf("%d registered contact(s)", len(active)),
+        Duration: time.Since(start),
+        Details:  active,
+    }
+}
@@ -0,0 +1,106 @@
+package provider
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+const defaultEventLimit = 100
+
+// ListProviderEvents returns the matching provider events, newest first
+func (s *Service) ListProviderEvents(ctx context.Context, filter models.ProviderEventFilter) ([]*models.ProviderEvent, error) {
+    var conditions []string
+    var args []interface{}
+
+    if filter.Provider != "" {
+        conditions = append(conditions, "provider_name = ?")
+        args = append(args, filter.Provider)
+    }
+    if filter.EventType != "" {
+        conditions = append(conditions, "event_type = ?")
+        args = append(args, filter.EventType)
+    }
+    if !filter.Since.IsZero() {
+        conditions = append(conditions, "created_at >= ?")
+        args = append(args, filter.Since)
+    }
+    if !filter.Until.IsZero() {
+        conditions = append(conditions, "created_at < ?")
+        args = append(args, filter.Until)
+    }
+
+    where := ""
+    if len(conditions) > 0 {
+        where = " WHERE " + strings.Join(conditions, " AND ")
+    }
+    limit := filter.Limit
+    if limit <= 0 {
+        limit = defaultEventLimit
+    }
+
+    rows, err := s.db.QueryContext(ctx, `
+        SELECT id, provider_name, event_type, COALESCE(actor, ''), COALESCE(detail, ''), created_at
+        FROM provider_events`+where+`
+        ORDER BY created_at DESC, id DESC
+        LIMIT ?`, append(args, limit)...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query provider events")
+    }
+    defer rows.Close()
+
+    var events []*models.ProviderEvent
+    for rows.Next() {
+        var e models.ProviderEvent
+        if err := rows.Scan(&e.ID, &e.ProviderName, &e.EventType, &e.Actor, &e.Detail, &e.CreatedAt); err != nil {
+            continue
+        }
+        events = append(events, &e)
+    }
+
+    return events, rows.Err()
+}
+
+// updateEvents are the timeline events an update of the provider amounts to
+func updateEvents(provider *models.Provider, updates map[string]interface{}) []models.ProviderEvent {
+    var events []models.ProviderEvent
+    actor := audit.CurrentUser()
+
+    if active, ok := updates["active"].(bool); ok && active != provider.Active {
+        eventType := models.ProviderEventDrained
+        if active {
+            eventType = models.ProviderEventEnabled
+        }
+        events = append(events, models.ProviderEvent{
+            ProviderName: provider.Name,
+            EventType:    eventType,
+            Actor:        actor,
+        })
+    }
+
+    var changes []string
+    for _, field := range []struct {
+        key string
+        old int
+    }{{"weight", provider.Weight}, {"priority", provider.Priority}} {
+        value, ok := updates[field.key]
+        if !ok || fmt.Sprint(value) == fmt.Sprint(field.old) {
+            continue
+        }
+        changes = append(changes, fmt.Sprintf("%s %d -> %v", field.key, field.old, value))
+    }
+    if len(changes) > 0 {
+        events = append(events, models.ProviderEvent{
+            ProviderName: provider.Name,
+            EventType:    models.ProviderEventWeightsChanged,
+            Actor:        actor,
+            Detail:       strings.Join(changes, ", "),
+        })
+    }
+
+    return events
+}
@@ -0,0 +1,280 @@
+package provider
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+    
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// maxGroupDepth bounds how many levels of groups a group resolves through
+const maxGroupDepth = 8
+
+// groupNesting loads which groups every group contains, by name
+func (gs *GroupService) groupNesting(ctx context.Context) (map[string][]string, error) {
+    rows, err := gs.db.QueryContext(ctx, `
+        SELECT parent.name, child.name
+        FROM provider_group_children n
+        JOIN provider_groups parent ON parent.id = n.parent_group_id
+        JOIN provider_groups child ON child.id = n.child_group_id
+        ORDER BY parent.name, child.name`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query nested groups")
+    }
+    defer rows.Close()
+    
+    children := make(map[string][]string)
+    for rows.Next() {
+        var parent, child string
+        if err := rows.Scan(&parent, &child); err != nil {
+            continue
+        }
+        children[parent] = append(children[parent], child)
+    }
+    return children, rows.Err()
+}
+
+// AddSubgroup nests a group in another, whose members then include the
+// providers of the subgroup. Nestings that would make a group contain itself
+// or resolve through more than maxGroupDepth levels are refused.
+func (gs *GroupService) AddSubgroup(ctx context.Context, groupName, subgroupName string) error {
+    if groupName == subgroupName {
+        return errors.New(errors.ErrInternal, "a group cannot contain itself")
+    }
+    group, err := gs.GetGroup(ctx, groupName)
+    if err != nil {
+        return err
+    }
+    subgroup, err := gs.GetGroup(ctx, subgroupName)
+    if err != nil {
+        return err
+    }
+    
+    children, err := gs.groupNesting(ctx)
+    if err != nil {
+        return err
+    }
+    if path := nestingPath(children, subgroupName, groupName); path != nil {
+        return errors.New(errors.ErrInternal, "group nesting would create a cycle").
+            WithContext("cycle", strings.Join(append([]string{groupName}, path...), " > "))
+    }
+    if depth := nestingDepth(children, subgroupName) + nestingHeight(children, groupName) + 1; depth > maxGroupDepth {
+        return errors.New(errors.ErrInternal, fmt.Sprintf("groups would nest %d levels deep, at most %d are resolved", depth, maxGroupDepth))
+    }
+    
+    _, err = gs.db.ExecContext(ctx, `
+        INSERT IGNORE INTO provider_group_children (parent_group_id, child_group_id)
+        VALUES (?, ?)`, group.ID, subgroup.ID)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to nest group")
+    }
+    
+    children[groupName] = append(children[groupName], subgroupName)
+    gs.invalidateMembers(ctx, children, groupName)
+    return nil
+}
+
+// RemoveSubgroup takes a group out of another
+func (gs *GroupService) RemoveSubgroup(ctx context.Context, groupName, subgroupName string) error {
+    children, err := gs.groupNesting(ctx)
+    if err != nil {
+        return err
+    }
+    
+    result, err := gs.db.ExecContext(ctx, `
+        DELETE n FROM provider_group_children n
+        JOIN provider_groups parent ON parent.id = n.parent_group_id
+        JOIN provider_groups child ON child.id = n.child_group_id
+        WHERE parent.name = ? AND child.name = ?`, groupName, subgroupName)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to remove nested group")
+    }
+    
+    rows, _ := result.RowsAffected()
+    if rows == 0 {
+        return errors.New(errors.ErrInternal, "group is not nested in the group")
+    }
+    
+    gs.invalidateMembers(ctx, children, groupName)
+    return nil
+}
+
+// GetSubgroups returns the groups nested directly in a group
+func (gs *GroupService) GetSubgroups(ctx context.Context, groupName string) ([]string, error) {
+    children, err := gs.groupNesting(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return children[groupName], nil
+}
+
+// GetParentGroups returns the groups a group is nested in directly
+func (gs *GroupService) GetParentGroups(ctx context.Context, groupName string) ([]string, error) {
+    children, err := gs.groupNesting(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return parentsOf(children, groupName), nil
+}
+
+// resolveGroupNames returns the group and every group nested in it, at most
+// maxGroupDepth levels down
+func (gs *GroupService) resolveGroupNames(ctx context.Context, groupName string) ([]string, error) {
+    children, err := gs.groupNesting(ctx)
+    if err != nil {
+        return nil, err
+    }
+    
+    names := []string{groupName}
+    seen := map[string]bool{groupName: true}
+    level := []string{groupName}
+    for depth := 0; depth < maxGroupDepth && len(level) > 0; depth++ {
+        var next []string
+        for _, name := range level {
+            for _, child := range children[name] {
+                if !seen[child] {
+                    seen[child] = true
+                    names = append(names, child)
+                    next = append(next, child)
+                }
+            }
+        }
+        level = next
+    }
+    return names, nil
+}
+
+// GetProviderGroups returns the groups a provider is a member of, directly
+// or through the groups nesting those
+func (gs *GroupService) GetProviderGroups(ctx context.Context, providerName string) ([]string, error) {
+    rows, err := gs.db.QueryContext(ctx, `
+        SELECT pg.name FROM provider_group_members pgm
+        JOIN provider_groups pg ON pgm.group_id = pg.id
+        WHERE pgm.provider_name = ?`, providerName)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query provider groups")
+    }
+    var direct []string
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err == nil {
+            direct = append(direct, name)
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query provider groups")
+    }
+    if len(direct) == 0 {
+        return nil, nil
+    }
+    
+    children, err := gs.groupNesting(ctx)
+    if err != nil {
+        return nil, err
+    }
+    return append(direct, ancestorsOf(children, direct)...), nil
+}
+
+// invalidateMembers drops the cached members of a group and of the groups
+// nesting it, which resolve through it
+func (gs *GroupService) invalidateMembers(ctx context.Context, children map[string][]string, groupName string) {
+    var keys []string
+    for _, name := range append([]string{groupName}, ancestorsOf(children, []string{groupName})...) {
+        keys = append(keys, fmt.Sprintf("group:%s:members", name), fmt.Sprintf("providers:%s", name))
+    }
+    gs.cache.Invalidate(ctx, keys...)
+}
+
+// invalidateNestedMembers is invalidateMembers loading the nesting itself
+func (gs *GroupService) invalidateNestedMembers(ctx context.Context, groupName string) {
+    children, _ := gs.groupNesting(ctx)
+    gs.invalidateMembers(ctx, children, groupName)
+}
+
+// nestingPath returns the groups from one group down to another, nil when
+// from doesn't contain to
+func nestingPath(children map[string][]string, from, to string) []string {
+    seen := make(map[string]bool)
+    var walk func(name string) []string
+    walk = func(name string) []string {
+        if name == to {
+            return []string{name}
+        }
+        if seen[name] {
+            return nil
+        }
+        seen[name] = true
+        for _, child := range children[name] {
+            if path := walk(child); path != nil {
+                return append([]string{name}, path...)
+            }
+        }
+        return nil
+    }
+    return walk(from)
+}
+
+// nestingDepth counts the levels of a group and the groups nested in it.
+// Walks stop past maxGroupDepth, so a cycle restored from a backup ends too.
+func nestingDepth(children map[string][]string, name string) int {
+    return nestingWalk(name, 1, func(n string) []string { return children[n] })
+}
+
+// nestingHeight counts the groups above a group on its longest nesting chain
+func nestingHeight(children map[string][]string, name string) int {
+    return nestingWalk(name, 1, func(n string) []string { return parentsOf(children, n) }) - 1
+}
+
+func nestingWalk(name string, level int, next func(string) []string) int {
+    deepest := level
+    if level > maxGroupDepth {
+        return deepest
+    }
+    for _, n := range next(name) {
+        if d := nestingWalk(n, level+1, next); d > deepest {
+            deepest = d
+        }
+    }
+    return deepest
+}
+
+func parentsOf(children map[string][]string, name string) []string {
+    var parents []string
+    for parent, kids := range children {
+        for _, kid := range kids {
+            if kid == name {
+                parents = append(parents, parent)
+            }
+        }
+    }
+    sort.Strings(parents)
+    return parents
+}
+
+// ancestorsOf returns every group nesting one of names, at any level
+func ancestorsOf(children map[string][]string, names []string) []string {
+    seen := make(map[string]bool)
+    for _, name := range names {
+        seen[name] = true
+    }
+    
+    var ancestors []string
+    level := names
+    for len(level) > 0 {
+        var next []string
+        for _, name := range level {
+            for _, parent := range parentsOf(children, name) {
+                if !seen[parent] {
+                    seen[parent] = true
+                    ancestors = append(ancestors, parent)
+                    next = append(next, parent)
+                }
+            }
+        }
+        level = next
+    }
+    return ancestors
+}
@@ -14,17 +14,31 @@ import (
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
 )
 
+// DefaultGroupMemberLimit caps the members of a group unless configured
+const DefaultGroupMemberLimit = 500
+
 // GroupService handles provider group operations
 type GroupService struct {
     db    *sql.DB
     cache CacheInterface
+    
+    // Most members a group takes, and that are loaded for routing
+    memberLimit int
 }
 
 // NewGroupService creates a new group service
 func NewGroupService(db *sql.DB, cache CacheInterface) *GroupService {
     return &GroupService{
-        db:    db,
-        cache: cache,
+        db:          db,
+        cache:       cache,
+        memberLimit: DefaultGroupMemberLimit,
+    }
+}
+
+// SetMemberLimit changes the member cap of groups, zero keeps the default
+func (gs *GroupService) SetMemberLimit(limit int) {
+    if limit > 0 {
+        gs.memberLimit = limit
     }
 }
 
@@ -80,8 +94,8 @@ func (gs *GroupService) CreateGroup(ctx context.Context, group *models.ProviderG
     }
     
     // Clear cache
-    gs.cache.Delete(ctx, fmt.Sprintf("group:%s", group.Name))
-    gs.cache.Delete(ctx, "groups:all")
+    gs.cache.Invalidate(ctx, fmt.Sprintf("group:%s", group.Name))
+    gs.cache.Invalidate(ctx, "groups:all")
     
     logger.WithContext(ctx).WithFields(map[string]interface{}{
         "group_id": group.ID,
@@ -112,6 +126,24 @@ func (gs *GroupService) populateGroupMembers(ctx context.Context, tx *sql.Tx, gr
     }
     defer stmt.Close()
     
+    // Manual members stay, rule matches fill what is left under the cap
+    var current int
+    if err := tx.QueryRowContext(ctx,
+        "SELECT COUNT(*) FROM provider_group_members WHERE group_id = ?", group.ID).Scan(&current); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to count group members")
+    }
+    if room := gs.memberLimit - current; len(providers) > room {
+        logger.WithContext(ctx).WithFields(map[string]interface{}{
+            "group":   group.Name,
+            "matched": len(providers),
+            "limit":   gs.memberLimit,
+        }).Warn("Group rules match more providers than the member limit, extra providers left out")
+        if room < 0 {
+            room = 0
+        }
+        providers = providers[:room]
+    }
+    
     for _, provider := range providers {
         if _, err := stmt.ExecContext(ctx, group.ID, provider.ID, provider.Name); err != nil {
             logger.WithContext(ctx).WithError(err).Warn("Failed to add provider to group")
@@ -132,6 +164,12 @@ func (gs *GroupService) getMatchingProviders(ctx context.Context, tx *sql.Tx, gr
         args = append(args, group.ProviderType)
     }
     
+    // Tags are loaded up front, the transaction can't run a query while rows are open
+    tags, err := loadAllTags(ctx, tx)
+    if err != nil {
+        return nil, err
+    }
+    
     rows, err := tx.QueryContext(ctx, query, args...)
     if err != nil {
         return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query providers")
@@ -177,6 +215,10 @@ func (gs *GroupService) getMatchingProviders(ctx context.Context, tx *sql.Tx, gr
             }
         }
         
+        for k, v := range tags[provider.Name] {
+            providerData["tag."+k] = v
+        }
+        
         // Check if provider matches group criteria
         if gs.providerMatchesGroup(group, providerData) {
             matchingProviders = append(matchingProviders, &provider)
@@ -326,6 +368,21 @@ func (gs *GroupService) AddProviderToGroup(ctx context.Context, groupName, provi
         return errors.New(errors.ErrProviderNotFound, "provider not found")
     }
     
+    // Updating an existing member is fine at the cap
+    var members int
+    var isMember bool
+    err = gs.db.QueryRowContext(ctx, `
+        SELECT COUNT(*), COALESCE(SUM(provider_id = ?), 0) > 0
+        FROM provider_group_members WHERE group_id = ?`, providerID, group.ID).Scan(&members, &isMember)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to count group members")
+    }
+    if !isMember && members >= gs.memberLimit {
+        return errors.New(errors.ErrQuotaExceeded, "group is at its member limit").
+            WithContext("group", groupName).
+            WithContext("limit", gs.memberLimit)
+    }
+    
     // Insert member
     query := `
         INSERT INTO provider_group_members (
@@ -362,7 +419,7 @@ func (gs *GroupService) AddProviderToGroup(ctx context.Context, groupName, provi
     }
     
     // Clear cache
-    gs.cache.Delete(ctx, fmt.Sprintf("group:%s:members", groupName))
+    gs.invalidateNestedMembers(ctx, groupName)
     
     return nil
 }
@@ -385,7 +442,7 @@ func (gs *GroupService) RemoveProviderFromGroup(ctx context.Context, groupName,
     }
     
     // Clear cache
-    gs.cache.Delete(ctx, fmt.Sprintf("group:%s:members", groupName))
+    gs.invalidateNestedMembers(ctx, groupName)
     
     return nil
 }
@@ -443,18 +500,8 @@ func (gs *GroupService) GetGroup(ctx context.Context, name string) (*models.Prov
     return &group, nil
 }
 
-// GetGroupMembers retrieves all providers in a group
-func (gs *GroupService) GetGroupMembers(ctx context.Context, groupName string) ([]*models.Provider, error) {
-    // Try cache first
-    cacheKey := fmt.Sprintf("group:%s:members", groupName)
-    var members []*models.Provider
-    
-    if err := gs.cache.Get(ctx, cacheKey, &members); err == nil {
-        return members, nil
-    }
-    
-    // Query database
-    query := `
+// groupMemberSelect reads members with their group overrides applied
+const groupMemberSelect = `
         SELECT p.id, p.name, p.type, p.host, p.port, p.username, p.password,
                p.auth_type, p.transport, p.codecs, p.max_channels, p.current_channels,
                COALESCE(pgm.priority_override, p.priority) as priority,
@@ -464,17 +511,110 @@ func (gs *GroupService) GetGroupMembers(ctx context.Context, groupName string) (
                p.created_at, p.updated_at
         FROM providers p
         JOIN provider_group_members pgm ON p.id = pgm.provider_id
-        JOIN provider_groups pg ON pgm.group_id = pg.id
-        WHERE pg.name = ? AND p.active = 1
+        JOIN provider_groups pg ON pgm.group_id = pg.id`
+
+var groupMemberSortColumns = map[string]string{
+    "name":     "p.name",
+    "type":     "p.type",
+    "priority": "priority",
+    "weight":   "weight",
+}
+
+// GetGroupMembers retrieves the active providers in a group, at most the
+// member limit of them
+func (gs *GroupService) GetGroupMembers(ctx context.Context, groupName string) ([]*models.Provider, error) {
+    // Try cache first
+    cacheKey := fmt.Sprintf("group:%s:members", groupName)
+    var members []*models.Provider
+    
+    if err := gs.cache.Get(ctx, cacheKey, &members); err == nil {
+        return members, nil
+    }
+    
+    // Nested groups add their providers, at the priority of the group giving
+    // them the highest
+    names, err := gs.resolveGroupNames(ctx, groupName)
+    if err != nil {
+        return nil, err
+    }
+    
+    args := make([]interface{}, 0, len(names)+1)
+    for _, name := range names {
+        args = append(args, name)
+    }
+    query := groupMemberSelect + `
+        WHERE pg.name IN (?` + strings.Repeat(", ?", len(names)-1) + `) AND p.active = 1
         ORDER BY priority DESC, p.name`
     
-    rows, err := gs.db.QueryContext(ctx, query, groupName)
+    // One past the limit tells a group that outgrew it, providers in several
+    // nested groups make rows past it count
+    if len(names) == 1 {
+        query += " LIMIT ?"
+        args = append(args, gs.memberLimit+1)
+    }
+    
+    members, err = gs.queryMembers(ctx, query, args...)
+    if err != nil {
+        return nil, err
+    }
+    members = uniqueMembers(members)
+    if len(members) > gs.memberLimit {
+        logger.WithContext(ctx).WithFields(map[string]interface{}{
+            "group": groupName,
+            "limit": gs.memberLimit,
+        }).Warn("Group has more members than the member limit, lowest priority members ignored")
+        members = members[:gs.memberLimit]
+    }
+    
+    // Cache for 1 minute
+    gs.cache.Set(ctx, cacheKey, members, time.Minute)
+    
+    return members, nil
+}
+
+// uniqueMembers keeps the first row of every provider
+func uniqueMembers(members []*models.Provider) []*models.Provider {
+    seen := make(map[int]bool, len(members))
+    unique := members[:0]
+    for _, m := range members {
+        if !seen[m.ID] {
+            seen[m.ID] = true
+            unique = append(unique, m)
+        }
+    }
+    return unique
+}
+
+// ListGroupMembersPage returns one page of a group's own members, inactive
+// ones included, and how many it has. Providers of nested groups aren't listed.
+func (gs *GroupService) ListGroupMembersPage(ctx context.Context, groupName string, opts models.ListOptions) ([]*models.Provider, int64, error) {
+    var total int64
+    err := gs.db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM provider_group_members pgm
+        JOIN provider_groups pg ON pgm.group_id = pg.id
+        WHERE pg.name = ?`, groupName).Scan(&total)
+    if err != nil {
+        return nil, 0, errors.Wrap(err, errors.ErrDatabase, "failed to count group members")
+    }
+    
+    order, pageArgs := opts.OrderClause(groupMemberSortColumns, "priority DESC, p.name")
+    members, err := gs.queryMembers(ctx, groupMemberSelect+" WHERE pg.name = ?"+order,
+        append([]interface{}{groupName}, pageArgs...)...)
+    if err != nil {
+        return nil, 0, err
+    }
+    
+    return members, total, nil
+}
+
+func (gs *GroupService) queryMembers(ctx context.Context, query string, args ...interface{}) ([]*models.Provider, error) {
+    rows, err := gs.db.QueryContext(ctx, query, args...)
     if err != nil {
         return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query group members")
     }
     defer rows.Close()
     
-    members = make([]*models.Provider, 0)
+    members := make([]*models.Provider, 0)
     
     for rows.Next() {
         var provider models.Provider
@@ -506,9 +646,6 @@ func (gs *GroupService) GetGroupMembers(ctx context.Context, groupName string) (
         members = append(members, &provider)
     }
     
-    // Cache for 1 minute
-    gs.cache.Set(ctx, cacheKey, members, time.Minute)
-    
     return members, nil
 }
 
@@ -658,8 +795,8 @@ func (gs *GroupService) UpdateGroup(ctx context.Context, name string, updates ma
     }
     
     // Clear cache
-    gs.cache.Delete(ctx, fmt.Sprintf("group:%s", name))
-    gs.cache.Delete(ctx, fmt.Sprintf("group:%s:members", name))
+    gs.cache.Invalidate(ctx, fmt.Sprintf("group:%s", name))
+    gs.invalidateNestedMembers(ctx, name)
     
     return nil
 }
@@ -684,6 +821,16 @@ func (gs *GroupService) DeleteGroup(ctx context.Context, name string) error {
         return errors.New(errors.ErrInternal, "group is in use by routes")
     }
     
+    // Groups nesting it would silently lose its providers
+    parents, err := gs.GetParentGroups(ctx, name)
+    if err != nil {
+        return err
+    }
+    if len(parents) > 0 {
+        return errors.New(errors.ErrInternal, "group is nested in other groups").
+            WithContext("groups", strings.Join(parents, ", "))
+    }
+    
     // Delete group (members will be cascade deleted)
     result, err := gs.db.ExecContext(ctx, "DELETE FROM provider_groups WHERE name = ?", name)
     if err != nil {
@@ -696,9 +843,9 @@ func (gs *GroupService) DeleteGroup(ctx context.Context, name string) error {
     }
     
     // Clear cache
-    gs.cache.Delete(ctx, fmt.Sprintf("group:%s", name))
-    gs.cache.Delete(ctx, fmt.Sprintf("group:%s:members", name))
-    gs.cache.Delete(ctx, "groups:all")
+    gs.cache.Invalidate(ctx, fmt.Sprintf("group:%s", name))
+    gs.cache.Invalidate(ctx, fmt.Sprintf("group:%s:members", name), fmt.Sprintf("providers:%s", name))
+    gs.cache.Invalidate(ctx, "groups:all")
     
     return nil
 }
@@ -738,7 +885,7 @@ func (gs *GroupService) RefreshGroupMembers(ctx context.Context, groupName strin
     }
     
     // Clear cache
-    gs.cache.Delete(ctx, fmt.Sprintf("group:%s:members", groupName))
+    gs.invalidateNestedMembers(ctx, groupName)
     
     logger.WithContext(ctx).WithField("group", groupName).Info("Group members refreshed")
     
@@ -766,12 +913,45 @@ func (gs *GroupService) validateGroup(group *models.ProviderGroup) error {
         if group.MatchField == "" || group.MatchOperator == "" {
             return errors.New(errors.ErrInternal, "match field and operator are required for metadata groups")
         }
+        if !knownMatchOperator(group.MatchOperator) {
+            return errors.New(errors.ErrInternal, "unknown match operator").WithContext("operator", string(group.MatchOperator))
+        }
     
     case models.GroupTypeDynamic:
         if group.Metadata == nil || group.Metadata["match_rules"] == nil {
             return errors.New(errors.ErrInternal, "match rules are required for dynamic groups")
         }
+        rules, ok := group.Metadata["match_rules"].([]interface{})
+        if !ok || len(rules) == 0 {
+            return errors.New(errors.ErrInternal, "match rules are required for dynamic groups")
+        }
+        for _, rule := range rules {
+            r, _ := rule.(map[string]interface{})
+            field, _ := r["field"].(string)
+            operator, _ := r["operator"].(string)
+            if field == "" {
+                return errors.New(errors.ErrInternal, "match rules need a field")
+            }
+            if !knownMatchOperator(models.MatchOperator(operator)) {
+                return errors.New(errors.ErrInternal, "unknown match operator").WithContext("operator", operator)
+            }
+        }
+    
+    default:
+        if group.GroupType != models.GroupTypeManual {
+            return errors.New(errors.ErrInternal, "invalid group type").WithContext("type", string(group.GroupType))
+        }
     }
     
     return nil
 }
+
+// knownMatchOperator reports whether matchValue knows the operator
+func knownMatchOperator(operator models.MatchOperator) bool {
+    switch operator {
+    case models.MatchOperatorEquals, models.MatchOperatorContains, models.MatchOperatorStartsWith,
+        models.MatchOperatorEndsWith, models.MatchOperatorRegex, models.MatchOperatorIn, models.MatchOperatorNotIn:
+        return true
+    }
+    return false
+}
@@ -0,0 +1,321 @@
+package provider
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "strings"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// ProviderFile is the YAML document read by provider import and written by export
+type ProviderFile struct {
+    Providers []*ProviderSpec `yaml:"providers"`
+}
+
+// ProviderSpec describes a provider in an import file. On update, fields left
+// out keep their current value; tags and metadata are replaced when present.
+type ProviderSpec struct {
+    Name               string                 `yaml:"name"`
+    Type               models.ProviderType    `yaml:"type,omitempty"`
+    Host               string                 `yaml:"host,omitempty"`
+    Port               int                    `yaml:"port,omitempty"`
+    Username           string                 `yaml:"username,omitempty"`
+    Password           string                 `yaml:"password,omitempty"`
+    AuthType           string                 `yaml:"auth_type,omitempty"`
+    Transport          string                 `yaml:"transport,omitempty"`
+    Codecs             []string               `yaml:"codecs,omitempty"`
+    MaxChannels        *int                   `yaml:"max_channels,omitempty"`
+    Priority           *int                   `yaml:"priority,omitempty"`
+    Weight             *int                   `yaml:"weight,omitempty"`
+    CostPerMinute      *float64               `yaml:"cost_per_minute,omitempty"`
+    Currency           string                 `yaml:"currency,omitempty"`
+    MinDuration        *int                   `yaml:"min_duration,omitempty"`
+    BillingIncrement   *int                   `yaml:"billing_increment,omitempty"`
+    Active             *bool                  `yaml:"active,omitempty"`
+    HealthCheckEnabled *bool                  `yaml:"health_check_enabled,omitempty"`
+    Tags               models.Tags            `yaml:"tags,omitempty"`
+    Metadata           map[string]interface{} `yaml:"metadata,omitempty"`
+}
+
+// Import actions
+const (
+    ImportCreated   = "created"
+    ImportUpdated   = "updated"
+    ImportUnchanged = "unchanged"
+    ImportFailed    = "failed"
+)
+
+// ImportResult is the outcome for one provider of an import
+type ImportResult struct {
+    Name   string
+    Action string
+    Err    error
+}
+
+// SpecFromProvider converts a stored provider for export, the password is only
+// included when includeSecrets is set
+func SpecFromProvider(p *models.Provider, includeSecrets bool) *ProviderSpec {
+    spec := &ProviderSpec{
+        Name:               p.Name,
+        Type:               p.Type,
+        Host:               p.Host,
+        Port:               p.Port,
+        Username:           p.Username,
+        AuthType:           p.AuthType,
+        Transport:          p.Transport,
+        Codecs:             p.Codecs,
+        MaxChannels:        &p.MaxChannels,
+        Priority:           &p.Priority,
+        Weight:             &p.Weight,
+        CostPerMinute:      &p.CostPerMinute,
+        Currency:           p.Currency,
+        MinDuration:        &p.MinDuration,
+        BillingIncrement:   &p.BillingIncrement,
+        Active:             &p.Active,
+        HealthCheckEnabled: &p.HealthCheckEnabled,
+        Tags:               p.Tags,
+    }
+    if includeSecrets {
+        spec.Password = p.Password
+    }
+    if len(p.Metadata) > 0 {
+        spec.Metadata = p.Metadata
+    }
+    return spec
+}
+
+// apply merges the spec onto a copy of base, or onto new defaults when base is nil
+func (spec *ProviderSpec) apply(base *models.Provider) *models.Provider {
+    var p models.Provider
+    if base != nil {
+        p = *base
+    } else {
+        p = models.Provider{Active: true, HealthCheckEnabled: true}
+    }
+    p.Name = spec.Name
+    
+    if spec.Type != "" {
+        p.Type = spec.Type
+    }
+    if spec.Host != "" {
+        p.Host = spec.Host
+    }
+    if spec.Port != 0 {
+        p.Port = spec.Port
+    }
+    if spec.Username != "" {
+        p.Username = spec.Username
+    }
+    if spec.Password != "" {
+        p.Password = spec.Password
+    }
+    if spec.AuthType != "" {
+        p.AuthType = spec.AuthType
+    }
+    if spec.Transport != "" {
+        p.Transport = spec.Transport
+    }
+    if spec.Codecs != nil {
+        p.Codecs = spec.Codecs
+    }
+    if spec.MaxChannels != nil {
+        p.MaxChannels = *spec.MaxChannels
+    }
+    if spec.Priority != nil {
+        p.Priority = *spec.Priority
+    }
+    if spec.Weight != nil {
+        p.Weight = *spec.Weight
+    }
+    if spec.CostPerMinute != nil {
+        p.CostPerMinute = *spec.CostPerMinute
+    }
+    if spec.Currency != "" {
+        p.Currency = strings.ToUpper(spec.Currency)
+    }
+    if spec.MinDuration != nil {
+        p.MinDuration = *spec.MinDuration
+    }
+    if spec.BillingIncrement != nil {
+        p.BillingIncrement = *spec.BillingIncrement
+    }
+    if spec.Active != nil {
+        p.Active = *spec.Active
+    }
+    if spec.HealthCheckEnabled != nil {
+        p.HealthCheckEnabled = *spec.HealthCheckEnabled
+    }
+    if spec.Tags != nil {
+        p.Tags = spec.Tags
+    }
+    if spec.Metadata != nil {
+        p.Metadata = spec.Metadata
+    }
+    
+    return &p
+}
+
+// ImportProviders creates or updates each provider in its own transaction so one
+// bad entry doesn't block the rest. PJSIP is reloaded once at the end.
+func (s *Service) ImportProviders(ctx context.Context, specs []*ProviderSpec, dryRun bool, progress func(*ImportResult)) []*ImportResult {
+    results := make([]*ImportResult, 0, len(specs))
+    changed := false
+    
+    for _, spec := range specs {
+        if ctx.Err() != nil {
+            break
+        }
+        
+        result := &ImportResult{Name: spec.Name}
+        result.Action, result.Err = s.importProvider(ctx, spec, dryRun)
+        if result.Err != nil {
+            result.Action = ImportFailed
+        }
+        if result.Action == ImportCreated || result.Action == ImportUpdated {
+            changed = true
+        }
+        
+        results = append(results, result)
+        if progress != nil {
+            progress(result)
+        }
+    }
+    
+    if changed && !dryRun && s.amiManager != nil {
+        if err := s.amiManager.ReloadPJSIP(); err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to reload PJSIP via AMI")
+        }
+    }
+    
+    return results
+}
+
+func (s *Service) importProvider(ctx context.Context, spec *ProviderSpec, dryRun bool) (string, error) {
+    if spec.Name == "" {
+        return "", errors.New(errors.ErrInternal, "provider name is required")
+    }
+    
+    existing, err := s.GetProvider(ctx, spec.Name)
+    if err != nil && errors.GetCode(err) != string(errors.ErrProviderNotFound) {
+        return "", err
+    }
+    
+    if existing == nil {
+        provider := spec.apply(nil)
+        if err := s.validateProvider(provider); err != nil {
+            return "", err
+        }
+        applyProviderDefaults(provider)
+        if err := s.checkConflicts(ctx, provider); err != nil {
+            return "", err
+        }
+        
+        if dryRun {
+            return ImportCreated, nil
+        }
+        if err := s.insertProvider(ctx, provider); err != nil {
+            return "", err
+        }
+        return ImportCreated, nil
+    }
+    
+    provider := spec.apply(existing)
+    if reflect.DeepEqual(SpecFromProvider(existing, true), SpecFromProvider(provider, true)) {
+        return ImportUnchanged, nil
+    }
+    if err := s.validateProvider(provider); err != nil {
+        return "", err
+    }
+    if provider.Type != existing.Type {
+        return "", errors.New(errors.ErrInternal, "provider type can't be changed by import").
+            WithContext("provider", spec.Name)
+    }
+    if err := s.checkConflicts(ctx, provider); err != nil {
+        return "", err
+    }
+    
+    if dryRun {
+        return ImportUpdated, nil
+    }
+    if err := s.replaceProvider(ctx, provider, spec.Tags != nil); err != nil {
+        return "", err
+    }
+    return ImportUpdated, nil
+}
+
+// replaceProvider rewrites all provider settings and regenerates the ARA endpoint
+func (s *Service) replaceProvider(ctx context.Context, provider *models.Provider, replaceTags bool) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+    
+    codecsJSON, _ := json.Marshal(provider.Codecs)
+    metadataJSON, _ := json.Marshal(provider.Metadata)
+    
+    _, err = tx.ExecContext(ctx, `
+        UPDATE providers SET
+            host = ?, port = ?, username = ?, password = ?, auth_type = ?,
+            transport = ?, codecs = ?, max_channels = ?, priority = ?, weight = ?,
+            cost_per_minute = ?, currency = ?, min_duration = ?, billing_increment = ?,
+            active = ?, health_check_enabled = ?, metadata = ?, updated_at = NOW()
+        WHERE name = ?`,
+        provider.Host, provider.Port, provider.Username, provider.Password, provider.AuthType,
+        provider.Transport, codecsJSON, provider.MaxChannels, provider.Priority, provider.Weight,
+        provider.CostPerMinute, provider.Currency, provider.MinDuration, provider.BillingIncrement,
+        provider.Active, provider.HealthCheckEnabled, metadataJSON,
+        provider.Name)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update provider")
+    }
+    
+    if replaceTags {
+        if _, err := tx.ExecContext(ctx, "DELETE FROM provider_tags WHERE provider_name = ?", provider.Name); err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to clear tags")
+        }
+        if err := setTagsTx(ctx, tx, provider.Name, provider.Tags); err != nil {
+            return err
+        }
+    }
+    
+    if err := s.araManager.CreateEndpoint(ctx, provider); err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "failed to update ARA endpoint")
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    
+    s.cache.Invalidate(ctx, fmt.Sprintf("provider:%s", provider.Name))
+    s.cache.Invalidate(ctx, fmt.Sprintf("providers:%s", provider.Type))
+    
+    return nil
+}
+
+func applyProviderDefaults(provider *models.Provider) {
+    if provider.Transport == "" {
+        provider.Transport = "udp"
+    }
+    if provider.AuthType == "" {
+        provider.AuthType = "ip"
+    }
+    if provider.Port == 0 {
+        provider.Port = 5060
+    }
+    if provider.Priority == 0 {
+        provider.Priority = 10
+    }
+    if provider.Weight == 0 {
+        provider.Weight = 1
+    }
+    if provider.BillingIncrement == 0 {
+        provider.BillingIncrement = 1
+    }
+    provider.Currency = strings.ToUpper(provider.Currency)
+}
@@ -11,7 +11,10 @@ import (
     
     "github.com/hamzaKhattat/ara-production-system/internal/ara"
     "github.com/hamzaKhattat/ara-production-system/internal/ami"
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/buildinfo"
     "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/sip"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
     "github.com/hamzaKhattat/ara-production-system/pkg/errors"
 )
@@ -27,6 +30,7 @@ type CacheInterface interface {
     Get(ctx context.Context, key string, dest interface{}) error
     Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
     Delete(ctx context.Context, keys ...string) error
+    Invalidate(ctx context.Context, keys ...string) error // Delete after a configuration change, on every node
 }
 
 func NewService(db *sql.DB, araManager *ara.Manager, amiManager *ami.Manager, cache CacheInterface) *Service {
@@ -47,22 +51,34 @@ func (s *Service) CreateProvider(ctx context.Context, provider *models.Provider)
     }
     
     // Set defaults
-    if provider.Transport == "" {
-        provider.Transport = "udp"
-    }
-    if provider.AuthType == "" {
-        provider.AuthType = "ip"
-    }
-    if provider.Port == 0 {
-        provider.Port = 5060
+    applyProviderDefaults(provider)
+    
+    if err := s.checkConflicts(ctx, provider); err != nil {
+        return err
     }
-    if provider.Priority == 0 {
-        provider.Priority = 10
+    
+    if err := s.insertProvider(ctx, provider); err != nil {
+        return err
     }
-    if provider.Weight == 0 {
-        provider.Weight = 1
+    
+    // Reload PJSIP
+    if s.amiManager != nil {
+        if err := s.amiManager.ReloadPJSIP(); err != nil {
+            log.WithError(err).Warn("Failed to reload PJSIP via AMI")
+        }
     }
     
+    log.WithFields(map[string]interface{}{
+        "provider_id": provider.ID,
+        "name": provider.Name,
+        "type": provider.Type,
+    }).Info("Provider created successfully")
+    
+    return nil
+}
+
+// insertProvider stores the provider, its tags and its ARA endpoint without reloading PJSIP
+func (s *Service) insertProvider(ctx context.Context, provider *models.Provider) error {
     // Start transaction
     tx, err := s.db.BeginTx(ctx, nil)
     if err != nil {
@@ -78,14 +94,15 @@ func (s *Service) CreateProvider(ctx context.Context, provider *models.Provider)
         INSERT INTO providers (
             name, type, host, port, username, password, auth_type,
             transport, codecs, max_channels, priority, weight,
-            cost_per_minute, active, health_check_enabled, metadata
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+            cost_per_minute, currency, min_duration, billing_increment, active, health_check_enabled, metadata
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
     
     result, err := tx.ExecContext(ctx, query,
         provider.Name, provider.Type, provider.Host, provider.Port,
         provider.Username, provider.Password, provider.AuthType,
         provider.Transport, codecsJSON, provider.MaxChannels,
         provider.Priority, provider.Weight, provider.CostPerMinute,
+        provider.Currency, provider.MinDuration, provider.BillingIncrement,
         provider.Active, provider.HealthCheckEnabled, metadataJSON,
     )
     
@@ -99,6 +116,19 @@ func (s *Service) CreateProvider(ctx context.Context, provider *models.Provider)
     providerID, _ := result.LastInsertId()
     provider.ID = int(providerID)
     
+    if err := setTagsTx(ctx, tx, provider.Name, provider.Tags); err != nil {
+        return err
+    }
+    
+    if err := audit.RecordProviderEvent(ctx, tx, models.ProviderEvent{
+        ProviderName: provider.Name,
+        EventType:    models.ProviderEventCreated,
+        Actor:        audit.CurrentUser(),
+        Detail:       fmt.Sprintf("%s provider at %s:%d", provider.Type, provider.Host, provider.Port),
+    }); err != nil {
+        return err
+    }
+    
     // Create ARA endpoint
     if err := s.araManager.CreateEndpoint(ctx, provider); err != nil {
         return errors.Wrap(err, errors.ErrInternal, "failed to create ARA endpoint")
@@ -109,22 +139,9 @@ func (s *Service) CreateProvider(ctx context.Context, provider *models.Provider)
         return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
     }
     
-    // Reload PJSIP
-    if s.amiManager != nil {
-        if err := s.amiManager.ReloadPJSIP(); err != nil {
-            log.WithError(err).Warn("Failed to reload PJSIP via AMI")
-        }
-    }
-    
     // Clear cache
-    s.cache.Delete(ctx, fmt.Sprintf("provider:%s", provider.Name))
-    s.cache.Delete(ctx, fmt.Sprintf("providers:%s", provider.Type))
-    
-    log.WithFields(map[string]interface{}{
-        "provider_id": provider.ID,
-        "name": provider.Name,
-        "type": provider.Type,
-    }).Info("Provider created successfully")
+    s.cache.Invalidate(ctx, fmt.Sprintf("provider:%s", provider.Name))
+    s.cache.Invalidate(ctx, fmt.Sprintf("providers:%s", provider.Type))
     
     return nil
 }
@@ -144,7 +161,8 @@ func (s *Service) UpdateProvider(ctx context.Context, name string, updates map[s
         switch key {
         case "host", "port", "username", "password", "auth_type",
              "transport", "max_channels", "priority", "weight",
-             "cost_per_minute", "active", "health_check_enabled":
+             "cost_per_minute", "currency", "min_duration", "billing_increment",
+             "active", "health_check_enabled":
             setClause = append(setClause, fmt.Sprintf("%s = ?", key))
             args = append(args, value)
         case "codecs":
@@ -162,6 +180,23 @@ func (s *Service) UpdateProvider(ctx context.Context, name string, updates map[s
         return nil // Nothing to update
     }
     
+    // A new address must not be claimed by another provider
+    if _, hostChanged := updates["host"]; hostChanged || updates["port"] != nil || updates["auth_type"] != nil {
+        updated := *provider
+        if host, ok := updates["host"].(string); ok {
+            updated.Host = host
+        }
+        if port, ok := updates["port"].(int); ok {
+            updated.Port = port
+        }
+        if authType, ok := updates["auth_type"].(string); ok {
+            updated.AuthType = authType
+        }
+        if err := s.checkConflicts(ctx, &updated); err != nil {
+            return err
+        }
+    }
+    
     // Add updated_at
     setClause = append(setClause, "updated_at = NOW()")
     
@@ -174,6 +209,12 @@ func (s *Service) UpdateProvider(ctx context.Context, name string, updates map[s
         return errors.Wrap(err, errors.ErrDatabase, "failed to update provider")
     }
     
+    for _, event := range updateEvents(provider, updates) {
+        if err := audit.RecordProviderEvent(ctx, s.db, event); err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to record provider event")
+        }
+    }
+    
     // Update ARA endpoint if needed
     needsARAUpdate := false
     for key := range updates {
@@ -204,8 +245,8 @@ func (s *Service) UpdateProvider(ctx context.Context, name string, updates map[s
     }
     
     // Clear cache
-    s.cache.Delete(ctx, fmt.Sprintf("provider:%s", name))
-    s.cache.Delete(ctx, fmt.Sprintf("providers:%s", provider.Type))
+    s.cache.Invalidate(ctx, fmt.Sprintf("provider:%s", name), fmt.Sprintf("providers:%s", name))
+    s.cache.Invalidate(ctx, fmt.Sprintf("providers:%s", provider.Type))
     
     return nil
 }
@@ -239,6 +280,14 @@ func (s *Service) DeleteProvider(ctx context.Context, name string) error {
         return errors.Wrap(err, errors.ErrDatabase, "failed to delete provider")
     }
     
+    if err := audit.RecordProviderEvent(ctx, tx, models.ProviderEvent{
+        ProviderName: name,
+        EventType:    models.ProviderEventDeleted,
+        Actor:        audit.CurrentUser(),
+    }); err != nil {
+        return err
+    }
+    
     // Delete from ARA
     if err := s.araManager.DeleteEndpoint(ctx, name); err != nil {
         logger.WithContext(ctx).WithError(err).Warn("Failed to delete ARA endpoint")
@@ -256,7 +305,7 @@ func (s *Service) DeleteProvider(ctx context.Context, name string) error {
     }
     
     // Clear cache
-    s.cache.Delete(ctx, fmt.Sprintf("provider:%s", name))
+    s.cache.Invalidate(ctx, fmt.Sprintf("provider:%s", name), fmt.Sprintf("providers:%s", name))
     
     return nil
 }
@@ -274,7 +323,7 @@ func (s *Service) GetProvider(ctx context.Context, name string) (*models.Provide
     query := `
         SELECT id, name, type, host, port, username, password, auth_type,
                transport, codecs, max_channels, current_channels, priority,
-               weight, cost_per_minute, active, health_check_enabled,
+               weight, cost_per_minute, COALESCE(currency, ''), min_duration, billing_increment, active, health_check_enabled,
                last_health_check, health_status, metadata, created_at, updated_at
         FROM providers
         WHERE name = ?`
@@ -287,6 +336,7 @@ func (s *Service) GetProvider(ctx context.Context, name string) (*models.Provide
         &provider.Username, &provider.Password, &provider.AuthType, &provider.Transport,
         &codecsJSON, &provider.MaxChannels, &provider.CurrentChannels,
         &provider.Priority, &provider.Weight, &provider.CostPerMinute,
+        &provider.Currency, &provider.MinDuration, &provider.BillingIncrement,
         &provider.Active, &provider.HealthCheckEnabled, &provider.LastHealthCheck,
         &provider.HealthStatus, &metadataJSON, &provider.CreatedAt, &provider.UpdatedAt,
     )
@@ -306,35 +356,93 @@ func (s *Service) GetProvider(ctx context.Context, name string) (*models.Provide
         json.Unmarshal([]byte(metadataJSON.String), &provider.Metadata)
     }
     
+    if err := s.loadTags(ctx, []*models.Provider{&provider}); err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to load provider tags")
+    }
+    
     // Cache for 5 minutes
     s.cache.Set(ctx, cacheKey, provider, 5*time.Minute)
     
     return &provider, nil
 }
 
-func (s *Service) ListProviders(ctx context.Context, filter map[string]interface{}) ([]*models.Provider, error) {
-    query := `
+// Sort keys accepted by ListProvidersPage
+var providerSortColumns = map[string]string{
+    "name":     "name",
+    "type":     "type",
+    "priority": "priority",
+    "channels": "current_channels",
+    "cost":     "cost_per_minute",
+    "health":   "health_status",
+    "created":  "created_at",
+}
+
+const providerSelect = `
         SELECT id, name, type, host, port, username, password, auth_type,
                transport, codecs, max_channels, current_channels, priority,
-               weight, cost_per_minute, active, health_check_enabled,
+               weight, cost_per_minute, COALESCE(currency, ''), min_duration, billing_increment, active, health_check_enabled,
                last_health_check, health_status, metadata, created_at, updated_at
-        FROM providers
-        WHERE 1=1`
+        FROM providers`
+
+func (s *Service) ListProviders(ctx context.Context, filter map[string]interface{}) ([]*models.Provider, error) {
+    where, args := providerWhere(filter)
+    return s.queryProviders(ctx, providerSelect+where+" ORDER BY type, priority DESC, name", args)
+}
+
+// ListProvidersPage returns one page of providers and the total matching the filter
+func (s *Service) ListProvidersPage(ctx context.Context, filter map[string]interface{}, opts models.ListOptions) ([]*models.Provider, int64, error) {
+    where, args := providerWhere(filter)
+    
+    var total int64
+    if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM providers"+where, args...).Scan(&total); err != nil {
+        return nil, 0, errors.Wrap(err, errors.ErrDatabase, "failed to count providers")
+    }
     
+    order, pageArgs := opts.OrderClause(providerSortColumns, "type, priority DESC, name")
+    providers, err := s.queryProviders(ctx, providerSelect+where+order, append(args, pageArgs...))
+    if err != nil {
+        return nil, 0, err
+    }
+    
+    return providers, total, nil
+}
+
+// providerWhere builds the WHERE clause for the type, active, health_status, search and tags filters
+func providerWhere(filter map[string]interface{}) (string, []interface{}) {
+    where := " WHERE 1=1"
     var args []interface{}
     
     if providerType, ok := filter["type"].(string); ok && providerType != "" {
-        query += " AND type = ?"
+        where += " AND type = ?"
         args = append(args, providerType)
     }
     
     if active, ok := filter["active"].(bool); ok {
-        query += " AND active = ?"
+        where += " AND active = ?"
         args = append(args, active)
     }
     
-    query += " ORDER BY type, priority DESC, name"
+    if health, ok := filter["health_status"].(string); ok && health != "" {
+        where += " AND health_status = ?"
+        args = append(args, health)
+    }
     
+    if search, ok := filter["search"].(string); ok && search != "" {
+        where += " AND (name LIKE ? OR host LIKE ?)"
+        pattern := "%" + search + "%"
+        args = append(args, pattern, pattern)
+    }
+    
+    if tags, ok := filter["tags"].(models.Tags); ok && len(tags) > 0 {
+        conditions, tagArgs := models.TagSelectorSQL("pt.provider_name = providers.name", tags)
+        where += " AND " + strings.Join(conditions, " AND ")
+        args = append(args, tagArgs...)
+    }
+    
+    return where, args
+}
+
+func (s *Service) queryProviders(ctx context.Context, query string, args []interface{}) ([]*models.Provider, error) {
     rows, err := s.db.QueryContext(ctx, query, args...)
     if err != nil {
         return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query providers")
@@ -353,6 +461,7 @@ func (s *Service) ListProviders(ctx context.Context, filter map[string]interface
             &provider.Username, &provider.Password, &provider.AuthType, &provider.Transport,
             &codecsJSON, &provider.MaxChannels, &provider.CurrentChannels,
             &provider.Priority, &provider.Weight, &provider.CostPerMinute,
+            &provider.Currency, &provider.MinDuration, &provider.BillingIncrement,
             &provider.Active, &provider.HealthCheckEnabled, &provider.LastHealthCheck,
             &provider.HealthStatus, &metadataJSON, &provider.CreatedAt, &provider.UpdatedAt,
         )
@@ -372,6 +481,14 @@ func (s *Service) ListProviders(ctx context.Context, filter map[string]interface
         
         providers = append(providers, &provider)
     }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read providers")
+    }
+    rows.Close()
+    
+    if err := s.loadTags(ctx, providers); err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to load provider tags")
+    }
     
     return providers, nil
 }
@@ -395,7 +512,8 @@ func (s *Service) validateProvider(provider *models.Provider) error {
         return errors.New(errors.ErrInternal, "invalid provider type")
     }
     
-    if provider.Host == "" {
+    // Registering customers send their contact, they have no static host
+    if provider.Host == "" && !provider.Registers() {
         return errors.New(errors.ErrInternal, "provider host is required")
     }
     
@@ -404,17 +522,32 @@ func (s *Service) validateProvider(provider *models.Provider) error {
             "ip":          true,
             "credentials": true,
             "both":        true,
+            "register":    true,
         }
         
         if !validAuthTypes[provider.AuthType] {
             return errors.New(errors.ErrInternal, "invalid auth type")
         }
         
-        if provider.AuthType == "credentials" || provider.AuthType == "both" {
+        if provider.UsesCredentials() {
             if provider.Username == "" || provider.Password == "" {
                 return errors.New(errors.ErrInternal, "username and password required for credential auth")
             }
         }
+        
+        if provider.Registers() && provider.Type != models.ProviderTypeInbound {
+            return errors.New(errors.ErrInternal, "only inbound customers can register").
+                WithContext("type", string(provider.Type))
+        }
+    }
+    
+    if provider.Currency != "" && len(provider.Currency) != 3 {
+        return errors.New(errors.ErrInternal, "currency must be a 3 letter ISO 4217 code").
+            WithContext("currency", provider.Currency)
+    }
+    
+    if provider.MinDuration < 0 || provider.BillingIncrement < 0 {
+        return errors.New(errors.ErrInternal, "billing minimum and increment can't be negative")
     }
     
     return nil
@@ -432,13 +565,17 @@ func (s *Service) TestProvider(ctx context.Context, name string) (*ProviderTestR
         Tests:        make(map[string]TestResult),
     }
     
-    // Test connectivity
-    connTest := s.testConnectivity(provider)
-    result.Tests["connectivity"] = connTest
+    // Registering customers have no static host to reach, check their contacts instead
+    if provider.Registers() {
+        result.Tests["registration"] = s.testRegistration(ctx, provider)
+    } else {
+        connTest := s.testConnectivity(provider)
+        result.Tests["connectivity"] = connTest
+    }
     
     // Test OPTIONS if SIP
-    if provider.Transport == "udp" || provider.Transport == "tcp" {
-        optionsTest := s.testSIPOptions(provider)
+    if !provider.Registers() && (provider.Transport == "udp" || provider.Transport == "tcp" || provider.Transport == "tls") {
+        optionsTest := s.testSIPOptions(ctx, provider)
         result.Tests["sip_options"] = optionsTest
     }
     
@@ -491,12 +628,28 @@ func (s *Service) testConnectivity(provider *models.Provider) TestResult {
     }
 }
 
-func (s *Service) testSIPOptions(provider *models.Provider) TestResult {
-    // This would implement SIP OPTIONS testing
-    // For now, return a placeholder
+func (s *Service) testSIPOptions(ctx context.Context, provider *models.Provider) TestResult {
+    start := time.Now()
+    
+    resp, err := sip.SendOptions(ctx, sip.OptionsRequest{
+        Host:      provider.Host,
+        Port:      provider.Port,
+        Transport: provider.Transport,
+        UserAgent: "ARA-Router/" + buildinfo.Version,
+    })
+    if err != nil {
+        return TestResult{
+            Success:  false,
+            Message:  fmt.Sprintf("OPTIONS failed: %v", err),
+            Duration: time.Since(start),
+        }
+    }
+    
     return TestResult{
-        Success: true,
-        Message: "SIP OPTIONS test not implemented",
+        Success:  resp.Reachable(),
+        Message:  fmt.Sprintf("%d %s", resp.StatusCode, resp.Reason),
+        Duration: resp.Latency,
+        Details:  map[string]interface{}{"server": resp.Server},
     }
 }
 
@@ -508,7 +661,15 @@ func (s *Service) BatchCreateProviders(ctx context.Context, providers []*models.
     }
     defer tx.Rollback()
     
+    // Providers of the batch are checked against each other as well as the stored ones
+    claimed := make(map[string]string)
+    
     for _, provider := range providers {
+        // Stop between providers when cancelled, the deferred rollback undoes the batch
+        if err := ctx.Err(); err != nil {
+            return errors.Wrap(err, errors.ErrInternal, "batch create cancelled")
+        }
+        
         if err := s.validateProvider(provider); err != nil {
             return fmt.Errorf("validation failed for provider %s: %w", provider.Name, err)
         }
@@ -523,6 +684,23 @@ func (s *Service) BatchCreateProviders(ctx context.Context, providers []*models.
         if provider.Port == 0 {
             provider.Port = 5060
         }
+        if provider.BillingIncrement == 0 {
+            provider.BillingIncrement = 1
+        }
+        provider.Currency = strings.ToUpper(provider.Currency)
+        
+        if err := s.checkConflicts(ctx, provider); err != nil {
+            return fmt.Errorf("validation failed for provider %s: %w", provider.Name, err)
+        }
+        if provider.Host != "" {
+            address := fmt.Sprintf("%s:%d", strings.ToLower(provider.Host), provider.Port)
+            if other, ok := claimed[address]; ok {
+                return errors.New(errors.ErrInternal, "host and port already used by another provider").
+                    WithContext("provider", other).
+                    WithContext("host", address)
+            }
+            claimed[address] = provider.Name
+        }
         
         codecsJSON, _ := json.Marshal(provider.Codecs)
         metadataJSON, _ := json.Marshal(provider.Metadata)
@@ -531,14 +709,15 @@ func (s *Service) BatchCreateProviders(ctx context.Context, providers []*models.
             INSERT INTO providers (
                 name, type, host, port, username, password, auth_type,
                 transport, codecs, max_channels, priority, weight,
-                cost_per_minute, active, health_check_enabled, metadata
-            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+                cost_per_minute, currency, min_duration, billing_increment, active, health_check_enabled, metadata
+            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
         
         if _, err := tx.ExecContext(ctx, query,
             provider.Name, provider.Type, provider.Host, provider.Port,
             provider.Username, provider.Password, provider.AuthType,
             provider.Transport, codecsJSON, provider.MaxChannels,
             provider.Priority, provider.Weight, provider.CostPerMinute,
+            provider.Currency, provider.MinDuration, provider.BillingIncrement,
             provider.Active, provider.HealthCheckEnabled, metadataJSON,
         ); err != nil {
             return errors.Wrap(err, errors.ErrDatabase, fmt.Sprintf("failed to insert provider %s", provider.Name))
@@ -0,0 +1,152 @@
+package provider
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "strings"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// SetTags adds or overwrites tags and removes the given keys in one transaction
+func (s *Service) SetTags(ctx context.Context, name string, set models.Tags, remove []string) error {
+    provider, err := s.GetProvider(ctx, name)
+    if err != nil {
+        return err
+    }
+    
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+    
+    if err := setTagsTx(ctx, tx, name, set); err != nil {
+        return err
+    }
+    
+    for _, key := range remove {
+        if _, err := tx.ExecContext(ctx, "DELETE FROM provider_tags WHERE provider_name = ? AND tag_key = ?", name, key); err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to remove tag")
+        }
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    
+    s.cache.Invalidate(ctx, fmt.Sprintf("provider:%s", name))
+    s.cache.Invalidate(ctx, fmt.Sprintf("providers:%s", provider.Type))
+    
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "provider": name,
+        "set":      set.String(),
+        "removed":  strings.Join(remove, ","),
+    }).Info("Provider tags updated")
+    
+    return nil
+}
+
+// ProvidersByTags returns the names of all providers carrying the selector tags
+func (s *Service) ProvidersByTags(ctx context.Context, selector models.Tags) ([]string, error) {
+    if len(selector) == 0 {
+        return nil, errors.New(errors.ErrInternal, "tag selector is empty")
+    }
+    
+    conditions, args := models.TagSelectorSQL("pt.provider_name = providers.name", selector)
+    rows, err := s.db.QueryContext(ctx,
+        "SELECT name FROM providers WHERE "+strings.Join(conditions, " AND ")+" ORDER BY name", args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query providers by tag")
+    }
+    defer rows.Close()
+    
+    var names []string
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err == nil {
+            names = append(names, name)
+        }
+    }
+    
+    return names, rows.Err()
+}
+
+func setTagsTx(ctx context.Context, tx *sql.Tx, name string, tags models.Tags) error {
+    for key, value := range tags {
+        _, err := tx.ExecContext(ctx, `
+            INSERT INTO provider_tags (provider_name, tag_key, tag_value)
+            VALUES (?, ?, ?)
+            ON DUPLICATE KEY UPDATE tag_value = VALUES(tag_value)`,
+            name, key, value)
+        if err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to set tag").WithContext("tag", key)
+        }
+    }
+    return nil
+}
+
+// loadTags attaches tags to the providers with a single query
+func (s *Service) loadTags(ctx context.Context, providers []*models.Provider) error {
+    if len(providers) == 0 {
+        return nil
+    }
+    
+    byName := make(map[string]*models.Provider, len(providers))
+    placeholders := make([]string, 0, len(providers))
+    args := make([]interface{}, 0, len(providers))
+    for _, p := range providers {
+        byName[p.Name] = p
+        placeholders = append(placeholders, "?")
+        args = append(args, p.Name)
+    }
+    
+    rows, err := s.db.QueryContext(ctx, `
+        SELECT provider_name, tag_key, tag_value FROM provider_tags
+        WHERE provider_name IN (`+strings.Join(placeholders, ",")+`)`, args...)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to query provider tags")
+    }
+    defer rows.Close()
+    
+    for rows.Next() {
+        var name, key, value string
+        if err := rows.Scan(&name, &key, &value); err != nil {
+            continue
+        }
+        if p := byName[name]; p != nil {
+            if p.Tags == nil {
+                p.Tags = make(models.Tags)
+            }
+            p.Tags[key] = value
+        }
+    }
+    
+    return rows.Err()
+}
+
+// loadAllTags returns every provider's tags, used when evaluating group rules
+func loadAllTags(ctx context.Context, tx *sql.Tx) (map[string]models.Tags, error) {
+    rows, err := tx.QueryContext(ctx, "SELECT provider_name, tag_key, tag_value FROM provider_tags")
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query provider tags")
+    }
+    defer rows.Close()
+    
+    tags := make(map[string]models.Tags)
+    for rows.Next() {
+        var name, key, value string
+        if err := rows.Scan(&name, &key, &value); err != nil {
+            continue
+        }
+        if tags[name] == nil {
+            tags[name] = make(models.Tags)
+        }
+        tags[name][key] = value
+    }
+    
+    return tags, rows.Err()
+}
@@ -0,0 +1,140 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/db"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// AbandonedConfig controls closing calls whose channel hung up without the
+// AGI hangup hook running, after an Asterisk crash or a masquerade
+type AbandonedConfig struct {
+    Enabled bool
+    Grace   time.Duration // time the AGI hangup hook gets to close the call first
+}
+
+// ProcessChannelHangup closes the call whose inbound channel Asterisk reported
+// hung up at the given time, unless the AGI hangup hook does so within the
+// grace period. Calls this node doesn't hold are closed in the database.
+func (r *Router) ProcessChannelHangup(ctx context.Context, callID string, cause int, at time.Time) {
+    if !r.config.Abandoned.Enabled || callID == "" {
+        return
+    }
+
+    time.AfterFunc(r.config.Abandoned.Grace, func() {
+        ctx := context.Background()
+        if err := r.closeAbandonedCall(ctx, callID, "AMI_HANGUP", cause, at); err != nil {
+            logger.WithContext(ctx).WithError(err).WithField("call_id", callID).Warn("Failed to close abandoned call")
+        }
+    })
+}
+
+// closeAbandonedCall closes a call whose inbound channel is gone, step records
+// what noticed it
+func (r *Router) closeAbandonedCall(ctx context.Context, callID, step string, cause int, at time.Time) error {
+    disposition := r.hangupDisposition(ctx, models.CallTiming{HangupCause: cause})
+
+    record, exists := r.activeCalls.Get(callID)
+    // Removing the call first keeps a late hangup hook from completing it twice
+    if !exists || !r.activeCalls.Delete(callID) {
+        return r.closeAbandonedRecord(ctx, callID, step, cause, disposition, at)
+    }
+
+    status := models.CallStatusAbandoned
+    if record.Status != models.CallStatusInitiated {
+        status = models.CallStatusFailed
+    }
+    record.Status = status
+    record.CurrentStep = step
+    record.EndTime = &at
+    record.Duration = int(at.Sub(record.StartTime).Seconds())
+
+    // Only a deadlock or lock wait timeout fails the transaction, to run it again
+    err := db.RetryTx(ctx, r.db, "abandoned_call", func(tx *sql.Tx) error {
+        r.rateCall(ctx, tx, record)
+        if err := r.updateCallRecord(ctx, tx, record); db.IsRetryable(err) {
+            return err
+        }
+        if _, err := tx.ExecContext(ctx, "UPDATE call_records SET hangup_cause = ?, disposition = ? WHERE call_id = ?",
+            cause, disposition, callID); db.IsRetryable(err) {
+            return err
+        }
+        if err := r.didManager.ReleaseCallDID(ctx, tx, record); db.IsRetryable(err) {
+            return err
+        }
+        if err := r.decrementRouteCalls(ctx, tx, record.RouteName); db.IsRetryable(err) {
+            return err
+        }
+        return nil
+    })
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).WithField("call_id", callID).Error("Failed to close abandoned call record")
+    }
+    r.routeQueues.wake(record.RouteName)
+
+    if !record.IsTest {
+        r.loadBalancer.UpdateCallComplete(record.IntermediateProvider, false, 0)
+        r.loadBalancer.UpdateCallComplete(record.FinalProvider, false, 0)
+    }
+    r.loadBalancer.DecrementActiveCalls(record.IntermediateProvider)
+    r.loadBalancer.DecrementActiveCalls(record.FinalProvider)
+    r.decrementHopCalls(record)
+
+    r.didManager.UnregisterCall(record)
+    r.unshareCall(ctx, record)
+    r.countries.Release(callID)
+    r.rateLimits.Release(callID)
+    r.testTraffic.Release(callID)
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "call_id":      callID,
+        "status":       status,
+        "hangup_cause": cause,
+    }).Warn("Channel hung up without the AGI hangup hook, call closed")
+    r.metrics.IncrementCounter("router_abandoned_calls", map[string]string{"scope": "active"})
+
+    if record.IsTest {
+        r.metrics.IncrementCounter("router_test_calls", testCallLabels(record, string(status)))
+        return nil
+    }
+    r.metrics.IncrementCounter("router_calls_failed", map[string]string{
+        "reason":   string(status),
+        "provider": record.InboundProvider,
+        "route":    record.RouteName,
+    })
+    return nil
+}
+
+// closeAbandonedRecord closes a call record still open in the database, left
+// by a node that restarted or that runs the call elsewhere. Its DID is left to
+// the stale DID cleanup since it can't be told apart from a reallocation here.
+func (r *Router) closeAbandonedRecord(ctx context.Context, callID, step string, cause int, disposition string, at time.Time) error {
+    result, err := r.db.ExecContext(ctx, `
+        UPDATE call_records
+        SET status = CASE WHEN status = ? THEN ? ELSE ? END,
+            current_step = ?, end_time = ?,
+            duration = GREATEST(TIMESTAMPDIFF(SECOND, start_time, ?), 0),
+            hangup_cause = ?, disposition = ?
+        WHERE call_id = ? AND end_time IS NULL AND status IN (?, ?, ?, ?)`,
+        models.CallStatusInitiated, models.CallStatusAbandoned, models.CallStatusFailed,
+        step, at, at, cause, disposition, callID,
+        models.CallStatusInitiated, models.CallStatusActive,
+        models.CallStatusReturnedFromS3, models.CallStatusRoutingToS4)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to close abandoned call record")
+    }
+
+    if rows, _ := result.RowsAffected(); rows > 0 {
+        logger.WithContext(ctx).WithFields(map[string]interface{}{
+            "call_id":      callID,
+            "hangup_cause": cause,
+        }).Warn("Closed call record left open by its AGI session")
+        r.metrics.IncrementCounter("router_abandoned_calls", map[string]string{"scope": "record"})
+    }
+    return nil
+}
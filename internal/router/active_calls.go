@@ -0,0 +1,151 @@
+package router
+
+import (
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// ActiveCallSnapshot returns one page of the calls this node is routing, with
+// the state of each leg, taken from memory rather than call_records. Sorting
+// takes the keys of ListCalls; calls are newest first by default.
+func (r *Router) ActiveCallSnapshot(filter models.CallFilter, opts models.ListOptions) ([]*models.ActiveCall, int64) {
+    now := time.Now()
+
+    var calls []*models.ActiveCall
+    r.activeCalls.Range(func(_ string, record *models.CallRecord) bool {
+        // Copied under the shard lock Range holds, the one Update changes records under
+        if matchesCallFilter(record, filter) {
+            calls = append(calls, snapshotCall(record, now))
+        }
+        return true
+    })
+
+    sortActiveCalls(calls, opts)
+
+    total := int64(len(calls))
+    opts = opts.Normalize()
+    if opts.Offset >= len(calls) {
+        return []*models.ActiveCall{}, total
+    }
+    calls = calls[opts.Offset:]
+    if len(calls) > opts.Limit {
+        calls = calls[:opts.Limit]
+    }
+    return calls, total
+}
+
+// matchesCallFilter applies a call listing filter to an in-memory record,
+// every call held in memory is active
+func matchesCallFilter(record *models.CallRecord, filter models.CallFilter) bool {
+    switch {
+    case filter.Status != "" && record.Status != filter.Status:
+        return false
+    case filter.Route != "" && record.RouteName != filter.Route:
+        return false
+    case filter.Provider != "" && record.InboundProvider != filter.Provider &&
+        record.IntermediateProvider != filter.Provider && record.FinalProvider != filter.Provider:
+        return false
+    case filter.Customer != "" && record.InboundProvider != filter.Customer:
+        return false
+    case filter.ANI != "" && record.OriginalANI != filter.ANI:
+        return false
+    case filter.DNIS != "" && record.OriginalDNIS != filter.DNIS:
+        return false
+    case filter.Disposition != "" && record.Disposition != filter.Disposition:
+        return false
+    case filter.Test != nil && record.IsTest != *filter.Test:
+        return false
+    }
+    return true
+}
+
+// snapshotCall copies a record and works out its legs from the routing step.
+// A call comes in on the inbound leg and is sent to S3 right away; the final
+// leg to S4 starts when S3 brings it back on the DID.
+func snapshotCall(record *models.CallRecord, now time.Time) *models.ActiveCall {
+    start := record.StartTime
+
+    call := &models.ActiveCall{
+        CallID:      record.CallID,
+        ANI:         record.OriginalANI,
+        DNIS:        record.OriginalDNIS,
+        DID:         record.AssignedDID,
+        Route:       record.RouteName,
+        Status:      record.Status,
+        CurrentStep: record.CurrentStep,
+        StartTime:   start,
+        Elapsed:     elapsedSeconds(&start, now),
+        IsTest:      record.IsTest,
+    }
+
+    leg := func(name, provider, state string, since *time.Time) models.CallLeg {
+        l := models.CallLeg{Leg: name, Provider: provider, State: state}
+        if since != nil {
+            t := *since
+            l.Since = &t
+            l.Elapsed = elapsedSeconds(since, now)
+        }
+        return l
+    }
+
+    switch record.Status {
+    case models.CallStatusInitiated:
+        call.Legs = []models.CallLeg{
+            leg(models.LegInbound, record.InboundProvider, models.LegUp, &start),
+            leg(models.LegIntermediate, record.IntermediateProvider, models.LegRouting, &start),
+            leg(models.LegFinal, record.FinalProvider, models.LegPending, nil),
+        }
+    case models.CallStatusReturnedFromS3, models.CallStatusRoutingToS4:
+        returned := record.ReturnedAt
+        if returned == nil {
+            returned = &start
+        }
+        call.Legs = []models.CallLeg{
+            leg(models.LegInbound, record.InboundProvider, models.LegUp, &start),
+            leg(models.LegIntermediate, record.IntermediateProvider, models.LegReturned, returned),
+            leg(models.LegFinal, record.FinalProvider, models.LegDialing, returned),
+        }
+    default:
+        call.Legs = []models.CallLeg{
+            leg(models.LegInbound, record.InboundProvider, models.LegUp, &start),
+            leg(models.LegIntermediate, record.IntermediateProvider, models.LegDialing, &start),
+            leg(models.LegFinal, record.FinalProvider, models.LegPending, nil),
+        }
+    }
+
+    return call
+}
+
+func elapsedSeconds(since *time.Time, now time.Time) int {
+    if since == nil || since.IsZero() || now.Before(*since) {
+        return 0
+    }
+    return int(now.Sub(*since).Seconds())
+}
+
+func sortActiveCalls(calls []*models.ActiveCall, opts models.ListOptions) {
+    var less func(a, b *models.ActiveCall) bool
+    switch strings.ToLower(opts.Sort) {
+    case "route":
+        less = func(a, b *models.ActiveCall) bool { return a.Route < b.Route }
+    case "status":
+        less = func(a, b *models.ActiveCall) bool { return a.Status < b.Status }
+    case "duration":
+        less = func(a, b *models.ActiveCall) bool { return a.Elapsed < b.Elapsed }
+    case "start":
+        less = func(a, b *models.ActiveCall) bool { return a.StartTime.Before(b.StartTime) }
+    default:
+        sort.SliceStable(calls, func(i, j int) bool { return calls[i].StartTime.After(calls[j].StartTime) })
+        return
+    }
+
+    sort.SliceStable(calls, func(i, j int) bool {
+        if opts.Desc {
+            return less(calls[j], calls[i])
+        }
+        return less(calls[i], calls[j])
+    })
+}
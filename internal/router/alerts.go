@@ -0,0 +1,540 @@
+package router
+
+import (
+    "bytes"
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/db"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// AlertConfig controls how alerts are grouped into incidents and notified
+type AlertConfig struct {
+    ReopenWindow   time.Duration // a resolved incident reopens on an alert of its kind within it, so flapping isn't renotified
+    ResolveAfter   time.Duration // firing alerts not raised again for this long are resolved, for ends no node saw
+    Interval       time.Duration // how often quiet alerts are resolved
+    WebhookURL     string        // opened and resolved incidents are posted to it as JSON, logged only when empty
+    WebhookTimeout time.Duration
+}
+
+func (c *AlertConfig) setDefaults() {
+    if c.ReopenWindow < 0 {
+        c.ReopenWindow = 0
+    }
+    if c.ResolveAfter <= 0 {
+        c.ResolveAfter = 6 * time.Hour
+    }
+    if c.Interval <= 0 {
+        c.Interval = time.Minute
+    }
+    if c.WebhookTimeout <= 0 {
+        c.WebhookTimeout = 5 * time.Second
+    }
+}
+
+// Notification events
+const (
+    incidentOpened   = "opened"
+    incidentResolved = "resolved"
+)
+
+// incidentNotification is the body posted to the webhook
+type incidentNotification struct {
+    Event    string           `json:"event"`
+    Incident *models.Incident `json:"incident"`
+}
+
+// AlertManager dedupes alerts and groups them into incidents. Only opening
+// and resolving an incident is notified: repeats of a firing alert, alerts
+// joining an open incident and incidents reopened within the reopen window
+// are logged at lower levels. State is kept in the database, so the nodes
+// raising the same alert share one incident.
+type AlertManager struct {
+    db      *sql.DB
+    metrics MetricsInterface
+    config  AlertConfig
+    client  *http.Client
+}
+
+// NewAlertManager creates an alert manager
+func NewAlertManager(db *sql.DB, metrics MetricsInterface, config AlertConfig) *AlertManager {
+    config.setDefaults()
+
+    return &AlertManager{
+        db:      db,
+        metrics: metrics,
+        config:  config,
+        client:  &http.Client{Timeout: config.WebhookTimeout},
+    }
+}
+
+// Raise records an alert in the open incident of its kind, opening one when
+// there is none
+func (am *AlertManager) Raise(ctx context.Context, alert models.Alert) error {
+    if alert.Severity == "" {
+        alert.Severity = models.AlertWarning
+    }
+    now := time.Now()
+
+    // Alerts raised together by a carrier outage contend for the open incident
+    var id int64
+    var outcome string
+    err := db.RetryTx(ctx, am.db, "raise_alert", func(tx *sql.Tx) error {
+        var err error
+        id, outcome, err = am.raise(ctx, tx, alert, now)
+        return err
+    })
+    if err != nil {
+        return err
+    }
+    am.metrics.IncrementCounter("router_alerts", map[string]string{"kind": alert.Kind, "outcome": outcome})
+
+    log := logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "incident": id,
+        "kind":     alert.Kind,
+        "entity":   alert.Entity,
+        "severity": alert.Severity,
+        "message":  alert.Message,
+    })
+    switch outcome {
+    case incidentOpened:
+        log.Error("ALERT: " + models.AlertTitle(alert.Kind) + ", incident opened")
+        am.notify(ctx, incidentOpened, id)
+    case "reopened":
+        log.Warn("Incident reopened by an alert soon after it resolved")
+    case "grouped":
+        log.Warn("Alert grouped into open incident")
+    default:
+        log.Debug("Repeated alert deduplicated")
+    }
+    return nil
+}
+
+// raise records the alert, returning its incident and whether the incident
+// was opened, reopened, joined or the alert was already firing in it
+func (am *AlertManager) raise(ctx context.Context, tx *sql.Tx, alert models.Alert, now time.Time) (int64, string, error) {
+    outcome := ""
+    var id int64
+    err := tx.QueryRowContext(ctx, "SELECT id FROM incidents WHERE open_key = ? FOR UPDATE", alert.Kind).Scan(&id)
+    if err != nil && err != sql.ErrNoRows {
+        return 0, "", errors.Wrap(err, errors.ErrDatabase, "failed to query incidents")
+    }
+
+    if err == sql.ErrNoRows && am.config.ReopenWindow > 0 {
+        err = tx.QueryRowContext(ctx, `
+            SELECT id FROM incidents
+            WHERE kind = ? AND open_key IS NULL AND resolved_at >= ?
+            ORDER BY resolved_at DESC LIMIT 1 FOR UPDATE`,
+            alert.Kind, now.Add(-am.config.ReopenWindow)).Scan(&id)
+        switch {
+        case err == nil:
+            result, err := tx.ExecContext(ctx, `
+                UPDATE incidents SET open_key = ?, resolved_at = NULL, resolved_by = NULL
+                WHERE id = ? AND resolved_at IS NOT NULL`,
+                alert.Kind, id)
+            if err != nil {
+                return 0, "", errors.Wrap(err, errors.ErrDatabase, "failed to reopen incident")
+            }
+            if n, _ := result.RowsAffected(); n == 1 {
+                outcome = "reopened"
+            } else {
+                id = 0
+            }
+        case err != sql.ErrNoRows:
+            return 0, "", errors.Wrap(err, errors.ErrDatabase, "failed to query incidents")
+        }
+    }
+
+    if id == 0 {
+        // Another node opening the same incident meanwhile makes this a join
+        result, err := tx.ExecContext(ctx, `
+            INSERT INTO incidents (kind, open_key, title, severity, started_at, last_alert_at)
+            VALUES (?, ?, ?, ?, ?, ?)
+            ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`,
+            alert.Kind, alert.Kind, models.AlertTitle(alert.Kind), alert.Severity, now, now)
+        if err != nil {
+            return 0, "", errors.Wrap(err, errors.ErrDatabase, "failed to open incident")
+        }
+        id, _ = result.LastInsertId()
+        if n, _ := result.RowsAffected(); n == 1 {
+            outcome = incidentOpened
+        }
+    }
+
+    var resolved sql.NullTime
+    err = tx.QueryRowContext(ctx,
+        "SELECT resolved_at FROM incident_alerts WHERE incident_id = ? AND alert_key = ? FOR UPDATE",
+        id, alert.Key()).Scan(&resolved)
+    if err != nil && err != sql.ErrNoRows {
+        return 0, "", errors.Wrap(err, errors.ErrDatabase, "failed to query incident alerts")
+    }
+    if outcome == "" {
+        outcome = "grouped"
+        if err == nil && !resolved.Valid {
+            outcome = "deduplicated"
+        }
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+        INSERT INTO incident_alerts (incident_id, alert_key, kind, entity, severity, message, first_seen, last_seen)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE count = count + 1, severity = VALUES(severity), message = VALUES(message),
+            last_seen = VALUES(last_seen), resolved_at = NULL`,
+        id, alert.Key(), alert.Kind, alert.Entity, alert.Severity, nullString(truncateString(alert.Message, 255)), now, now); err != nil {
+        return 0, "", errors.Wrap(err, errors.ErrDatabase, "failed to record alert")
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+        UPDATE incidents
+        SET alert_count = alert_count + 1, last_alert_at = ?,
+            severity = CASE WHEN ? = ? THEN ? ELSE severity END
+        WHERE id = ?`,
+        now, alert.Severity, models.AlertCritical, models.AlertCritical, id); err != nil {
+        return 0, "", errors.Wrap(err, errors.ErrDatabase, "failed to record alert")
+    }
+
+    return id, outcome, nil
+}
+
+// Resolve marks an alert's condition over, resolving its incident once none
+// of its alerts fires
+func (am *AlertManager) Resolve(ctx context.Context, kind, entity string) error {
+    now := time.Now()
+    alert := models.Alert{Kind: kind, Entity: entity}
+
+    var id int64
+    var closed bool
+    err := db.RetryTx(ctx, am.db, "resolve_alert", func(tx *sql.Tx) error {
+        id, closed = 0, false
+        err := tx.QueryRowContext(ctx, "SELECT id FROM incidents WHERE open_key = ? FOR UPDATE", kind).Scan(&id)
+        if err == sql.ErrNoRows {
+            return nil
+        }
+        if err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to query incidents")
+        }
+
+        if _, err := tx.ExecContext(ctx, `
+            UPDATE incident_alerts SET resolved_at = ?
+            WHERE incident_id = ? AND alert_key = ? AND resolved_at IS NULL`,
+            now, id, alert.Key()); err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to resolve alert")
+        }
+
+        closed, err = closeQuietIncident(ctx, tx, id, now, audit.SystemActor)
+        return err
+    })
+    if err != nil {
+        return err
+    }
+
+    if closed {
+        am.resolved(ctx, id)
+    }
+    return nil
+}
+
+// ResolveIncident resolves an open incident and all of its alerts by hand
+func (am *AlertManager) ResolveIncident(ctx context.Context, id int64, user string) error {
+    now := time.Now()
+
+    tx, err := am.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx,
+        "UPDATE incident_alerts SET resolved_at = ? WHERE incident_id = ? AND resolved_at IS NULL",
+        now, id); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to resolve incident")
+    }
+    closed, err := closeQuietIncident(ctx, tx, id, now, user)
+    if err != nil {
+        return err
+    }
+    if !closed {
+        return errors.New(errors.ErrInternal, "no open incident with that id").WithContext("incident", id)
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "incident",
+        EntityType: "incident",
+        EntityID:   fmt.Sprintf("%d", id),
+        UserID:     user,
+        Action:     "resolve",
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    am.resolved(ctx, id)
+    return nil
+}
+
+// closeQuietIncident resolves an open incident none of whose alerts fires,
+// reporting whether this call did
+func closeQuietIncident(ctx context.Context, tx *sql.Tx, id int64, now time.Time, by string) (bool, error) {
+    result, err := tx.ExecContext(ctx, `
+        UPDATE incidents SET open_key = NULL, resolved_at = ?, resolved_by = ?
+        WHERE id = ? AND open_key IS NOT NULL
+          AND NOT EXISTS (SELECT 1 FROM incident_alerts WHERE incident_id = ? AND resolved_at IS NULL)`,
+        now, by, id, id)
+    if err != nil {
+        return false, errors.Wrap(err, errors.ErrDatabase, "failed to resolve incident")
+    }
+    n, _ := result.RowsAffected()
+    return n == 1, nil
+}
+
+// Run resolves alerts gone quiet for the resolve window until the context
+// ends, such as those of a node that restarted before seeing them end
+func (am *AlertManager) Run(ctx context.Context) {
+    ticker := time.NewTicker(am.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+            if err := am.resolveQuiet(ctx, time.Now()); err != nil {
+                logger.WithContext(ctx).WithError(err).Warn("Failed to resolve quiet alerts")
+            }
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (am *AlertManager) resolveQuiet(ctx context.Context, now time.Time) error {
+    cutoff := now.Add(-am.config.ResolveAfter)
+
+    rows, err := am.db.QueryContext(ctx, `
+        SELECT DISTINCT ia.incident_id
+        FROM incident_alerts ia
+        JOIN incidents i ON i.id = ia.incident_id
+        WHERE i.open_key IS NOT NULL AND ia.resolved_at IS NULL AND ia.last_seen < ?`,
+        cutoff)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to query quiet alerts")
+    }
+    var ids []int64
+    for rows.Next() {
+        var id int64
+        if rows.Scan(&id) == nil {
+            ids = append(ids, id)
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to read quiet alerts")
+    }
+
+    for _, id := range ids {
+        closed, err := am.resolveQuietIncident(ctx, id, now, cutoff)
+        if err != nil {
+            return err
+        }
+        if closed {
+            am.resolved(ctx, id)
+        }
+    }
+    return nil
+}
+
+func (am *AlertManager) resolveQuietIncident(ctx context.Context, id int64, now, cutoff time.Time) (bool, error) {
+    tx, err := am.db.BeginTx(ctx, nil)
+    if err != nil {
+        return false, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx,
+        "UPDATE incident_alerts SET resolved_at = ? WHERE incident_id = ? AND resolved_at IS NULL AND last_seen < ?",
+        now, id, cutoff); err != nil {
+        return false, errors.Wrap(err, errors.ErrDatabase, "failed to resolve alert")
+    }
+    closed, err := closeQuietIncident(ctx, tx, id, now, audit.SystemActor)
+    if err != nil {
+        return false, err
+    }
+    if err := tx.Commit(); err != nil {
+        return false, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return closed, nil
+}
+
+// resolved notifies an incident this node resolved
+func (am *AlertManager) resolved(ctx context.Context, id int64) {
+    am.metrics.IncrementCounter("router_incidents_resolved", nil)
+
+    fields := map[string]interface{}{"incident": id}
+    if incident, err := am.Get(ctx, id); err == nil {
+        fields["kind"] = incident.Kind
+        fields["alerts"] = len(incident.Alerts)
+        fields["duration"] = incident.Duration(time.Now()).Round(time.Second).String()
+        fields["resolved_by"] = incident.ResolvedBy
+    }
+    logger.WithContext(ctx).WithFields(fields).Info("Incident resolved")
+    am.notify(ctx, incidentResolved, id)
+}
+
+// notify posts an incident to the webhook
+func (am *AlertManager) notify(ctx context.Context, event string, id int64) {
+    if am.config.WebhookURL == "" {
+        return
+    }
+    log := logger.WithContext(ctx).WithFields(map[string]interface{}{"incident": id, "event": event})
+
+    incident, err := am.Get(ctx, id)
+    if err != nil {
+        log.WithError(err).Warn("Failed to load incident for notification")
+        return
+    }
+    body, _ := json.Marshal(incidentNotification{Event: event, Incident: incident})
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, am.config.WebhookURL, bytes.NewReader(body))
+    if err != nil {
+        log.WithError(err).Warn("Invalid alert webhook")
+        return
+    }
+    req.Header.Set("Content-Type", "application/json")
+
+    resp, err := am.client.Do(req)
+    if err != nil {
+        am.metrics.IncrementCounter("router_alert_webhook_failures", nil)
+        log.WithError(err).Warn("Failed to post incident to alert webhook")
+        return
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        am.metrics.IncrementCounter("router_alert_webhook_failures", nil)
+        reply, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        log.WithField("status", resp.Status).WithField("response", strings.TrimSpace(string(reply))).
+            Warn("Alert webhook rejected incident")
+    }
+}
+
+// List returns incidents newest first, without their alerts
+func (am *AlertManager) List(ctx context.Context, filter models.IncidentFilter) ([]*models.Incident, error) {
+    where := "WHERE started_at >= ?"
+    args := []interface{}{filter.Since}
+    if filter.Kind != "" {
+        where += " AND kind = ?"
+        args = append(args, filter.Kind)
+    }
+    if filter.OpenOnly {
+        where += " AND open_key IS NOT NULL"
+    }
+    limit := filter.Limit
+    if limit <= 0 || limit > models.MaxListLimit {
+        limit = models.DefaultListLimit
+    }
+    args = append(args, limit)
+
+    return am.queryIncidents(ctx, where+" ORDER BY started_at DESC, id DESC LIMIT ?", args...)
+}
+
+// Get returns an incident with its alerts
+func (am *AlertManager) Get(ctx context.Context, id int64) (*models.Incident, error) {
+    incidents, err := am.queryIncidents(ctx, "WHERE id = ?", id)
+    if err != nil {
+        return nil, err
+    }
+    if len(incidents) == 0 {
+        return nil, errors.New(errors.ErrInternal, "incident not found").WithContext("incident", id)
+    }
+    incident := incidents[0]
+
+    rows, err := am.db.QueryContext(ctx, `
+        SELECT kind, entity, severity, COALESCE(message, ''), count, first_seen, last_seen, resolved_at
+        FROM incident_alerts
+        WHERE incident_id = ?
+        ORDER BY first_seen, alert_key`, id)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query incident alerts")
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var a models.IncidentAlert
+        var resolved sql.NullTime
+        if err := rows.Scan(&a.Kind, &a.Entity, &a.Severity, &a.Message, &a.Count,
+            &a.FirstSeen, &a.LastSeen, &resolved); err != nil {
+            continue
+        }
+        if resolved.Valid {
+            a.ResolvedAt = &resolved.Time
+        }
+        incident.Alerts = append(incident.Alerts, &a)
+    }
+    return incident, rows.Err()
+}
+
+func (am *AlertManager) queryIncidents(ctx context.Context, where string, args ...interface{}) ([]*models.Incident, error) {
+    rows, err := am.db.QueryContext(ctx, `
+        SELECT id, kind, title, severity, alert_count, started_at, last_alert_at, resolved_at, COALESCE(resolved_by, '')
+        FROM incidents
+        `+where, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query incidents")
+    }
+    defer rows.Close()
+
+    var incidents []*models.Incident
+    for rows.Next() {
+        var i models.Incident
+        var resolved sql.NullTime
+        if err := rows.Scan(&i.ID, &i.Kind, &i.Title, &i.Severity, &i.AlertCount, &i.StartedAt,
+            &i.LastAlertAt, &resolved, &i.ResolvedBy); err != nil {
+            continue
+        }
+        if resolved.Valid {
+            i.ResolvedAt = &resolved.Time
+        }
+        incidents = append(incidents, &i)
+    }
+    return incidents, rows.Err()
+}
+
+// healthAlert raises and resolves provider down alerts from health transitions
+func (am *AlertManager) healthAlert(provider, eventType, detail string) {
+    ctx := context.Background()
+
+    var err error
+    switch eventType {
+    case models.ProviderEventHealthDown:
+        err = am.Raise(ctx, models.Alert{
+            Kind:     models.AlertProviderDown,
+            Entity:   provider,
+            Severity: models.AlertCritical,
+            Message:  detail,
+        })
+    case models.ProviderEventHealthUp:
+        err = am.Resolve(ctx, models.AlertProviderDown, provider)
+    default:
+        return
+    }
+    if err != nil {
+        logger.WithError(err).WithField("provider", provider).Warn("Failed to record provider down alert")
+    }
+}
+
+func truncateString(s string, n int) string {
+    if len(s) <= n {
+        return s
+    }
+    return s[:n]
+}
@@ -0,0 +1,198 @@
+package router
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "fmt"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// APITokenPrefix marks customer tokens so a leaked one is easy to recognise
+const APITokenPrefix = "ara_"
+
+// APITokenManager issues and checks the tokens of the customer usage API
+type APITokenManager struct {
+    db *sql.DB
+}
+
+// NewAPITokenManager creates an API token manager
+func NewAPITokenManager(db *sql.DB) *APITokenManager {
+    return &APITokenManager{db: db}
+}
+
+// Create issues a token for the customer of t. The token is returned only
+// here, the database keeps its hash.
+func (tm *APITokenManager) Create(ctx context.Context, t *models.APIToken) (string, error) {
+    var customers int
+    err := tm.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM providers WHERE name = ? AND type = ?",
+        t.Customer, models.ProviderTypeInbound).Scan(&customers)
+    if err != nil {
+        return "", errors.Wrap(err, errors.ErrDatabase, "failed to look up customer")
+    }
+    if customers == 0 {
+        return "", errors.New(errors.ErrProviderNotFound, "API tokens are issued to inbound providers only").
+            WithContext("customer", t.Customer)
+    }
+
+    secret := make([]byte, 24)
+    if _, err := rand.Read(secret); err != nil {
+        return "", errors.Wrap(err, errors.ErrInternal, "failed to generate token")
+    }
+    token := APITokenPrefix + hex.EncodeToString(secret)
+    t.Prefix = token[:len(APITokenPrefix)+8]
+
+    tx, err := tm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return "", errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    result, err := tx.ExecContext(ctx, `
+        INSERT INTO api_tokens (token_hash, prefix, customer, description, created_by, expires_at, pii)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`,
+        hashAPIToken(token), t.Prefix, t.Customer, t.Description, t.CreatedBy, t.ExpiresAt, t.PII)
+    if err != nil {
+        return "", errors.Wrap(err, errors.ErrDatabase, "failed to store API token")
+    }
+    t.ID, _ = result.LastInsertId()
+    t.CreatedAt = time.Now()
+
+    if err := tm.audit(ctx, tx, t.ID, t.CreatedBy, "create", nil, t); err != nil {
+        return "", err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return "", errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "customer":   t.Customer,
+        "prefix":     t.Prefix,
+        "created_by": t.CreatedBy,
+    }).Info("API token issued")
+    return token, nil
+}
+
+// Authenticate returns the valid token matching the presented one
+func (tm *APITokenManager) Authenticate(ctx context.Context, token string) (*models.APIToken, error) {
+    tokens, err := tm.query(ctx, "WHERE token_hash = ?", hashAPIToken(token))
+    if err != nil {
+        return nil, err
+    }
+    if len(tokens) == 0 || !tokens[0].Valid(time.Now()) {
+        return nil, errors.New(errors.ErrAuthFailed, "invalid, expired or revoked API token")
+    }
+
+    // Coarse, it only tells operators whether a token is still in use
+    tm.db.ExecContext(ctx, `
+        UPDATE api_tokens SET last_used_at = NOW()
+        WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE)`, tokens[0].ID)
+
+    return tokens[0], nil
+}
+
+// List returns the tokens of a customer, all customers when empty
+func (tm *APITokenManager) List(ctx context.Context, customer string) ([]*models.APIToken, error) {
+    if customer == "" {
+        return tm.query(ctx, "")
+    }
+    return tm.query(ctx, "WHERE customer = ?", customer)
+}
+
+// Revoke stops a token from granting access, it stays listed for the record
+func (tm *APITokenManager) Revoke(ctx context.Context, id int64, revokedBy string) error {
+    tokens, err := tm.query(ctx, "WHERE id = ?", id)
+    if err != nil {
+        return err
+    }
+    if len(tokens) == 0 {
+        return errors.New(errors.ErrInternal, "API token not found").WithContext("id", id)
+    }
+    if tokens[0].RevokedAt != nil {
+        return nil
+    }
+
+    tx, err := tm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "UPDATE api_tokens SET revoked_at = NOW() WHERE id = ?", id); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to revoke API token")
+    }
+
+    if err := tm.audit(ctx, tx, id, revokedBy, "revoke", tokens[0], nil); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "customer":   tokens[0].Customer,
+        "prefix":     tokens[0].Prefix,
+        "revoked_by": revokedBy,
+    }).Info("API token revoked")
+    return nil
+}
+
+func (tm *APITokenManager) query(ctx context.Context, where string, args ...interface{}) ([]*models.APIToken, error) {
+    rows, err := tm.db.QueryContext(ctx, fmt.Sprintf(`
+        SELECT id, customer, COALESCE(description, ''), prefix, COALESCE(created_by, ''),
+               created_at, last_used_at, expires_at, revoked_at, pii
+        FROM api_tokens
+        %s
+        ORDER BY customer, created_at`, where), args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query API tokens")
+    }
+    defer rows.Close()
+
+    var tokens []*models.APIToken
+    for rows.Next() {
+        var t models.APIToken
+        var lastUsed, expires, revoked sql.NullTime
+        if err := rows.Scan(&t.ID, &t.Customer, &t.Description, &t.Prefix, &t.CreatedBy,
+            &t.CreatedAt, &lastUsed, &expires, &revoked, &t.PII); err != nil {
+            continue
+        }
+        if lastUsed.Valid {
+            t.LastUsedAt = &lastUsed.Time
+        }
+        if expires.Valid {
+            t.ExpiresAt = &expires.Time
+        }
+        if revoked.Valid {
+            t.RevokedAt = &revoked.Time
+        }
+        tokens = append(tokens, &t)
+    }
+    return tokens, rows.Err()
+}
+
+func (tm *APITokenManager) audit(ctx context.Context, tx *sql.Tx, id int64, user, action string, oldValue, newValue interface{}) error {
+    return audit.Record(ctx, tx, audit.Entry{
+        EventType:  "api_token",
+        EntityType: "api_token",
+        EntityID:   fmt.Sprintf("%d", id),
+        UserID:     user,
+        Action:     action,
+        OldValue:   oldValue,
+        NewValue:   newValue,
+    })
+}
+
+func hashAPIToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,349 @@
+package router
+
+import (
+    "context"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// RestartConfig controls pausing new calls while a restarted Asterisk loads
+// its endpoints and dialplan from ARA
+type RestartConfig struct {
+    Enabled          bool
+    RecentBoot       time.Duration // a first FullyBooted with less uptime counts as a restart
+    CheckInterval    time.Duration // between checks that the ARA objects are loaded
+    MaxPause         time.Duration // new calls resume after this even while checks fail
+    Contexts         []string      // dialplan contexts Asterisk must know
+    ReconcileRecords bool          // also close call_records rows of other nodes' calls started before the boot
+}
+
+// AsteriskCommander runs Asterisk CLI commands, implemented by the AMI manager
+type AsteriskCommander interface {
+    Command(command string) (string, error)
+}
+
+// restartHangupCause closes the calls whose channels went down with Asterisk,
+// Q.850 network out of order
+const restartHangupCause = 38
+
+// bootTolerance absorbs the rounding of Uptime when comparing boot times
+const bootTolerance = 5 * time.Second
+
+// RestartCoordinator watches for Asterisk restarts. New calls are rejected from
+// the FullyBooted of a restarted Asterisk until it can see the ARA endpoints
+// and dialplan, and the calls that died with the old process are closed.
+type RestartCoordinator struct {
+    router   *Router
+    asterisk AsteriskCommander
+    config   RestartConfig
+
+    mu          sync.RWMutex
+    bootedAt    time.Time // start of the Asterisk process last seen
+    pausedSince *time.Time
+    pauseReason string // why the pause started
+    pending     string // what the last check found missing
+    checking    bool   // a waitReady loop runs
+}
+
+// NewRestartCoordinator creates a coordinator and has the router consult it
+// before accepting new calls
+func NewRestartCoordinator(r *Router, asterisk AsteriskCommander, config RestartConfig) *RestartCoordinator {
+    if config.RecentBoot <= 0 {
+        config.RecentBoot = 2 * time.Minute
+    }
+    if config.CheckInterval <= 0 {
+        config.CheckInterval = 2 * time.Second
+    }
+    if config.MaxPause <= 0 {
+        config.MaxPause = 2 * time.Minute
+    }
+
+    rc := &RestartCoordinator{
+        router:   r,
+        asterisk: asterisk,
+        config:   config,
+    }
+    r.restart.Store(rc)
+    r.metrics.SetGauge("router_inbound_paused", 0, nil)
+    return rc
+}
+
+// HandleFullyBooted takes the FullyBooted event Asterisk sends once it has
+// started and on every AMI login. Only a process that started after the one
+// seen before, or recently when none was, is treated as a restart.
+func (rc *RestartCoordinator) HandleFullyBooted(ctx context.Context, at time.Time, uptime string) {
+    seconds, err := strconv.ParseInt(uptime, 10, 64)
+    if err != nil {
+        // Asterisk before 13 sends no Uptime, the boot time is unknown
+        logger.WithContext(ctx).Debug("FullyBooted without Uptime, checking ARA objects only")
+        if problem := rc.check(ctx); problem != "" {
+            rc.pause("ARA objects missing after AMI login: " + problem)
+            go rc.waitReady(ctx)
+        }
+        return
+    }
+    booted := at.Add(-time.Duration(seconds) * time.Second)
+
+    rc.mu.Lock()
+    previous := rc.bootedAt
+    restarted := booted.Sub(previous) > bootTolerance
+    if previous.IsZero() {
+        restarted = time.Duration(seconds)*time.Second < rc.config.RecentBoot
+    }
+    if restarted || previous.IsZero() {
+        rc.bootedAt = booted
+    }
+    rc.mu.Unlock()
+
+    if !restarted {
+        return
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "booted_at": booted,
+        "uptime":    seconds,
+    }).Warn("Asterisk restarted, pausing new calls until ARA is loaded")
+    rc.router.metrics.IncrementCounter("asterisk_restarts", nil)
+
+    rc.pause("Asterisk restarted")
+    rc.reconcile(ctx, booted)
+    go rc.waitReady(ctx)
+}
+
+// Paused returns since when new calls have been held back, nil while they are accepted
+func (rc *RestartCoordinator) Paused() *time.Time {
+    rc.mu.RLock()
+    defer rc.mu.RUnlock()
+    return rc.pausedSince
+}
+
+func (rc *RestartCoordinator) pause(reason string) {
+    rc.mu.Lock()
+    if rc.pausedSince == nil {
+        now := time.Now()
+        rc.pausedSince = &now
+        rc.pauseReason = reason
+    }
+    rc.pending = reason
+    rc.mu.Unlock()
+
+    rc.router.metrics.SetGauge("router_inbound_paused", 1, nil)
+}
+
+func (rc *RestartCoordinator) resume(ctx context.Context, confirmed bool) {
+    rc.mu.Lock()
+    since := rc.pausedSince
+    pending := rc.pending
+    reason := rc.pauseReason
+    rc.pausedSince = nil
+    rc.pending = ""
+    rc.mu.Unlock()
+    if since == nil {
+        return
+    }
+
+    rc.router.metrics.SetGauge("router_inbound_paused", 0, nil)
+    now := time.Now()
+    log := logger.WithContext(ctx).WithField("paused_for", now.Sub(*since).Round(time.Second))
+    if err := recordSystemDowntime(ctx, rc.router.db, &models.Downtime{
+        Cause:  models.DowntimeAsteriskRestart,
+        Entity: rc.router.config.NodeID,
+        Reason: reason,
+        Start:  *since,
+        End:    &now,
+    }); err != nil {
+        log.WithError(err).Warn("Failed to record the pause as system downtime")
+    }
+    if confirmed {
+        log.Info("Asterisk has the ARA endpoints and dialplan, new calls resumed")
+    } else {
+        log.WithField("missing", pending).Error("Asterisk still misses ARA objects, new calls resumed after the maximum pause")
+    }
+}
+
+// waitReady checks the ARA objects until they are all loaded or the pause
+// runs out. Only one check loop runs at a time.
+func (rc *RestartCoordinator) waitReady(ctx context.Context) {
+    rc.mu.Lock()
+    if rc.checking {
+        rc.mu.Unlock()
+        return
+    }
+    rc.checking = true
+    rc.mu.Unlock()
+    defer func() {
+        rc.mu.Lock()
+        rc.checking = false
+        rc.mu.Unlock()
+    }()
+
+    ticker := time.NewTicker(rc.config.CheckInterval)
+    defer ticker.Stop()
+
+    for {
+        since := rc.Paused()
+        if since == nil {
+            return
+        }
+
+        problem := rc.check(ctx)
+        if problem == "" {
+            rc.resume(ctx, true)
+            return
+        }
+        rc.mu.Lock()
+        rc.pending = problem
+        rc.mu.Unlock()
+
+        if time.Since(*since) >= rc.config.MaxPause {
+            rc.resume(ctx, false)
+            return
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// check returns what Asterisk is still missing, empty when every provider's
+// endpoint and every configured dialplan context is loaded
+func (rc *RestartCoordinator) check(ctx context.Context) string {
+    for _, name := range rc.config.Contexts {
+        out, err := rc.asterisk.Command("dialplan show " + name)
+        if err != nil {
+            return "AMI: " + err.Error()
+        }
+        if strings.Contains(out, "no existence") {
+            return "dialplan context " + name
+        }
+    }
+
+    rows, err := rc.router.db.QueryContext(ctx, "SELECT CONCAT('endpoint-', name) FROM providers WHERE active = 1")
+    if err != nil {
+        return "providers: " + err.Error()
+    }
+    var endpoints []string
+    for rows.Next() {
+        var id string
+        if rows.Scan(&id) == nil {
+            endpoints = append(endpoints, id)
+        }
+    }
+    rows.Close()
+    if len(endpoints) == 0 {
+        return ""
+    }
+
+    out, err := rc.asterisk.Command("pjsip show endpoints")
+    if err != nil {
+        return "AMI: " + err.Error()
+    }
+    var missing []string
+    for _, id := range endpoints {
+        if !strings.Contains(out, " "+id+" ") && !strings.Contains(out, " "+id+"/") {
+            missing = append(missing, id)
+        }
+    }
+    if len(missing) > 0 {
+        if len(missing) > 5 {
+            missing = append(missing[:5], "...")
+        }
+        return "endpoints " + strings.Join(missing, ", ")
+    }
+    return ""
+}
+
+// reconcile closes the calls this node held on the Asterisk that went down,
+// and with ReconcileRecords the call_records rows left open from before it
+func (rc *RestartCoordinator) reconcile(ctx context.Context, booted time.Time) {
+    r := rc.router
+    log := logger.WithContext(ctx)
+
+    var orphaned []string
+    r.activeCalls.Range(func(callID string, record *models.CallRecord) bool {
+        if record.StartTime.Before(booted) {
+            orphaned = append(orphaned, callID)
+        }
+        return true
+    })
+
+    for _, callID := range orphaned {
+        if err := r.closeAbandonedCall(ctx, callID, "ASTERISK_RESTART", restartHangupCause, booted); err != nil {
+            log.WithError(err).WithField("call_id", callID).Warn("Failed to close call orphaned by the Asterisk restart")
+        }
+    }
+
+    closed := int64(0)
+    if rc.config.ReconcileRecords {
+        var err error
+        if closed, err = r.closeRecordsStartedBefore(ctx, booted); err != nil {
+            log.WithError(err).Warn("Failed to close call records orphaned by the Asterisk restart")
+        }
+    }
+
+    if len(orphaned) > 0 || closed > 0 {
+        log.WithFields(map[string]interface{}{
+            "active_calls": len(orphaned),
+            "records":      closed,
+        }).Warn("Closed calls orphaned by the Asterisk restart")
+    }
+}
+
+// closeRecordsStartedBefore closes every call record still open that started
+// before the given time. Their DIDs are left to the stale DID cleanup.
+func (r *Router) closeRecordsStartedBefore(ctx context.Context, before time.Time) (int64, error) {
+    disposition := r.hangupDisposition(ctx, models.CallTiming{HangupCause: restartHangupCause})
+
+    result, err := r.db.ExecContext(ctx, `
+        UPDATE call_records
+        SET status = CASE WHEN status = ? THEN ? ELSE ? END,
+            current_step = 'ASTERISK_RESTART', end_time = ?,
+            duration = GREATEST(TIMESTAMPDIFF(SECOND, start_time, ?), 0),
+            hangup_cause = ?, disposition = ?
+        WHERE start_time < ? AND end_time IS NULL AND status IN (?, ?, ?, ?)`,
+        models.CallStatusInitiated, models.CallStatusAbandoned, models.CallStatusFailed,
+        before, before, restartHangupCause, disposition, before,
+        models.CallStatusInitiated, models.CallStatusActive,
+        models.CallStatusReturnedFromS3, models.CallStatusRoutingToS4)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to close orphaned call records")
+    }
+
+    rows, _ := result.RowsAffected()
+    if rows > 0 {
+        r.metrics.IncrementCounter("router_abandoned_calls", map[string]string{"scope": "restart"})
+    }
+    return rows, nil
+}
+
+// checkAsteriskRestart rejects new calls while a restarted Asterisk is not
+// confirmed to have loaded ARA
+func (r *Router) checkAsteriskRestart(ctx context.Context, customer string) error {
+    rc := r.restart.Load()
+    if rc == nil {
+        return nil
+    }
+    since := rc.Paused()
+    if since == nil {
+        return nil
+    }
+
+    r.metrics.IncrementCounter("router_calls_failed", map[string]string{
+        "reason":   "asterisk_restart",
+        "provider": customer,
+        "route":    "",
+    })
+    logger.WithContext(ctx).WithField("customer", customer).Warn("Call rejected while Asterisk restarts")
+
+    return errors.New(errors.ErrCallsSuspended, "new calls are paused while Asterisk restarts").
+        WithContext("paused_since", since.Format(time.RFC3339))
+}
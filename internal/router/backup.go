@@ -0,0 +1,789 @@
+package router
+
+import (
+    "compress/gzip"
+    "context"
+    "crypto/sha256"
+    "database/sql"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/buildinfo"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// BackupConfig controls the scheduled snapshots of the routing configuration
+type BackupConfig struct {
+    Enabled     bool
+    Interval    time.Duration
+    Destination string // a local directory or s3://bucket/prefix
+    Keep        int    // snapshots kept by the schedule, zero keeps them all
+    S3          S3Config
+}
+
+// backupSets are the parts of the configuration a snapshot holds, each of
+// which can be restored on its own. Tables are restored in this order.
+var backupSets = []struct {
+    name   string
+    tables []string
+}{
+    {"providers", []string{"providers", "provider_tags", "provider_country_limits", "provider_short_call_limits",
+        "provider_dial_options", "provider_contracts", "provider_slas"}},
+    {"groups", []string{"provider_groups", "provider_group_members", "provider_group_children"}},
+    {"routes", []string{"provider_routes", "route_policies", "route_weight_curves", "route_cost_ceilings", "route_prefixes"}},
+    {"dids", []string{"dids", "did_watermarks"}},
+    {"holidays", []string{"holidays"}},
+    {"ara", []string{"ps_transports", "ps_systems", "ps_globals", "ps_endpoints", "ps_auths", "ps_aors",
+        "ps_endpoint_id_ips", "ps_domain_aliases", "extensions"}},
+}
+
+// backupIDFormat names snapshots by the UTC time they were taken
+const backupIDFormat = "20060102T150405Z"
+
+// BackupSets names the parts of a snapshot that can be restored on their own
+func BackupSets() []string {
+    names := make([]string, len(backupSets))
+    for i, set := range backupSets {
+        names[i] = set.name
+    }
+    return names
+}
+
+// backupFile is the content of a snapshot, gzipped JSON
+type backupFile struct {
+    ID        string                  `json:"id"`
+    CreatedAt time.Time               `json:"created_at"`
+    Version   string                  `json:"version"`
+    Tables    map[string]*backupTable `json:"tables"`
+}
+
+// backupTable holds the rows of a table, times as RFC 3339
+type backupTable struct {
+    Columns []string        `json:"columns"`
+    Times   []string        `json:"times,omitempty"` // columns holding times
+    Rows    [][]interface{} `json:"rows"`
+}
+
+// BackupManager takes and restores snapshots of the providers, groups,
+// routes, DIDs, holidays and Asterisk realtime tables
+type BackupManager struct {
+    db      *sql.DB
+    cache   CacheInterface
+    metrics MetricsInterface
+    config  BackupConfig
+}
+
+// NewBackupManager creates a backup manager
+func NewBackupManager(db *sql.DB, cache CacheInterface, metrics MetricsInterface, config BackupConfig) *BackupManager {
+    if config.Interval <= 0 {
+        config.Interval = time.Hour
+    }
+    if config.Destination == "" {
+        config.Destination = "/var/lib/ara/backups"
+    }
+    if config.Keep < 0 {
+        config.Keep = 0
+    }
+
+    return &BackupManager{
+        db:      db,
+        cache:   cache,
+        metrics: metrics,
+        config:  config,
+    }
+}
+
+// Snapshot dumps the routing configuration to a new snapshot
+func (bm *BackupManager) Snapshot(ctx context.Context, trigger, user string) (*models.BackupSnapshot, error) {
+    file, err := bm.dump(ctx)
+    if err != nil {
+        bm.metrics.IncrementCounter("router_backups", map[string]string{"trigger": trigger, "status": "failed"})
+        return nil, err
+    }
+    return bm.store(ctx, file, trigger, user)
+}
+
+// List returns the recorded snapshots, newest first
+func (bm *BackupManager) List(ctx context.Context, limit int) ([]*models.BackupSnapshot, error) {
+    if limit <= 0 {
+        limit = 50
+    }
+    return bm.query(ctx, "ORDER BY id DESC LIMIT ?", limit)
+}
+
+// Get returns a recorded snapshot
+func (bm *BackupManager) Get(ctx context.Context, id string) (*models.BackupSnapshot, error) {
+    snapshots, err := bm.query(ctx, "WHERE id = ?", id)
+    if err != nil {
+        return nil, err
+    }
+    if len(snapshots) == 0 {
+        return nil, errors.New(errors.ErrInternal, "snapshot not found").WithContext("snapshot", id)
+    }
+    return snapshots[0], nil
+}
+
+// Restore replaces the given sets, all of them when none are given, with
+// their content in a snapshot. The configuration replaced is snapshotted
+// first. DIDs allocated to calls in progress stay allocated.
+func (bm *BackupManager) Restore(ctx context.Context, id string, sets []string, user string) (*models.BackupRestore, error) {
+    tables, names, err := selectBackupSets(sets)
+    if err != nil {
+        return nil, err
+    }
+    snap, err := bm.load(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+
+    current, err := bm.dump(ctx)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to snapshot the configuration before restoring")
+    }
+    pre, err := bm.store(ctx, current, models.BackupPreRestore, user)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to snapshot the configuration before restoring")
+    }
+
+    // Foreign key checks are off so a set restores without the others and
+    // emptying a table doesn't cascade into tables of other sets
+    conn, err := bm.db.Conn(ctx)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to get connection")
+    }
+    defer conn.Close()
+    if _, err := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to disable foreign key checks")
+    }
+    defer conn.ExecContext(context.Background(), "SET FOREIGN_KEY_CHECKS = 1")
+
+    tx, err := conn.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    result := &models.BackupRestore{Snapshot: snap.ID, Sets: names, Rows: make(map[string]int), PreRestore: pre.ID}
+    for _, table := range tables {
+        t, ok := snap.Tables[table]
+        if !ok {
+            logger.WithContext(ctx).WithFields(map[string]interface{}{
+                "snapshot": snap.ID,
+                "table":    table,
+            }).Warn("Table not in snapshot, left as is")
+            continue
+        }
+
+        var allocations []didAllocation
+        if table == "dids" {
+            if allocations, err = allocatedDIDs(ctx, tx); err != nil {
+                return nil, err
+            }
+        }
+
+        n, err := restoreTable(ctx, tx, table, t)
+        if err != nil {
+            return nil, err
+        }
+        result.Rows[table] = n
+
+        if table == "dids" {
+            if result.Kept, err = reallocateDIDs(ctx, tx, allocations); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "backup",
+        EntityType: "backup_snapshot",
+        EntityID:   snap.ID,
+        UserID:     user,
+        Action:     "restore",
+        NewValue:   result,
+    }); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    bm.cache.Invalidate(ctx, restoredCacheKeys(current, snap)...)
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "snapshot":    snap.ID,
+        "sets":        strings.Join(names, ","),
+        "pre_restore": pre.ID,
+        "user":        user,
+    }).Warn("Routing configuration restored from snapshot")
+
+    return result, nil
+}
+
+// RunSchedule takes a snapshot each interval until the context ends
+func (bm *BackupManager) RunSchedule(ctx context.Context) {
+    ticker := time.NewTicker(bm.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        bm.runDue(ctx)
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// runDue takes the scheduled snapshot unless another router instance took
+// one this interval, then deletes those beyond Keep
+func (bm *BackupManager) runDue(ctx context.Context) {
+    log := logger.WithContext(ctx)
+
+    unlock, err := bm.cache.Lock(ctx, "backup:snapshot", 10*time.Minute)
+    if err != nil {
+        log.WithError(err).Debug("Backup already running elsewhere")
+        return
+    }
+    defer unlock()
+
+    var last sql.NullTime
+    if err := bm.db.QueryRowContext(ctx, "SELECT MAX(created_at) FROM backup_snapshots WHERE trigger_type = ?",
+        models.BackupScheduled).Scan(&last); err != nil {
+        log.WithError(err).Warn("Failed to check last backup")
+        return
+    }
+    if last.Valid && time.Since(last.Time) < bm.config.Interval/2 {
+        return
+    }
+
+    snap, err := bm.Snapshot(ctx, models.BackupScheduled, "")
+    if err != nil {
+        log.WithError(err).WithField("destination", bm.config.Destination).
+            Error("ALERT: routing configuration backup failed")
+        return
+    }
+    log.WithFields(map[string]interface{}{
+        "snapshot": snap.ID,
+        "location": snap.Location,
+        "size":     snap.Size,
+    }).Info("Routing configuration backed up")
+
+    bm.prune(ctx)
+}
+
+// dump reads every table of every set in one consistent read
+func (bm *BackupManager) dump(ctx context.Context) (*backupFile, error) {
+    tx, err := bm.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    now := time.Now().UTC()
+    file := &backupFile{
+        ID:        now.Format(backupIDFormat),
+        CreatedAt: now,
+        Version:   buildinfo.Version,
+        Tables:    make(map[string]*backupTable),
+    }
+    for _, set := range backupSets {
+        for _, table := range set.tables {
+            t, err := dumpTable(ctx, tx, table)
+            if err != nil {
+                return nil, err
+            }
+            file.Tables[table] = t
+        }
+    }
+    return file, nil
+}
+
+func dumpTable(ctx context.Context, tx *sql.Tx, table string) (*backupTable, error) {
+    rows, err := tx.QueryContext(ctx, "SELECT * FROM "+table)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read table").WithContext("table", table)
+    }
+    defer rows.Close()
+
+    types, err := rows.ColumnTypes()
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read table").WithContext("table", table)
+    }
+    t := &backupTable{Columns: make([]string, len(types)), Rows: [][]interface{}{}}
+    for i, ct := range types {
+        t.Columns[i] = ct.Name()
+        switch ct.DatabaseTypeName() {
+        case "DATETIME", "TIMESTAMP", "DATE":
+            t.Times = append(t.Times, ct.Name())
+        }
+    }
+
+    values := make([]interface{}, len(types))
+    dest := make([]interface{}, len(types))
+    for i := range values {
+        dest[i] = &values[i]
+    }
+    for rows.Next() {
+        if err := rows.Scan(dest...); err != nil {
+            return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read table").WithContext("table", table)
+        }
+        row := make([]interface{}, len(values))
+        for i, v := range values {
+            switch v := v.(type) {
+            case []byte:
+                row[i] = string(v)
+            case time.Time:
+                row[i] = v.Format(time.RFC3339Nano)
+            default:
+                row[i] = v
+            }
+        }
+        t.Rows = append(t.Rows, row)
+    }
+    return t, rows.Err()
+}
+
+// store writes a snapshot to the destination and records it
+func (bm *BackupManager) store(ctx context.Context, file *backupFile, trigger, user string) (*models.BackupSnapshot, error) {
+    snap, err := bm.write(ctx, file)
+    if err != nil {
+        bm.metrics.IncrementCounter("router_backups", map[string]string{"trigger": trigger, "status": "failed"})
+        return nil, err
+    }
+    snap.Trigger = trigger
+    snap.CreatedBy = user
+
+    rowCounts, _ := json.Marshal(snap.Rows)
+    if _, err := bm.db.ExecContext(ctx, `
+        INSERT INTO backup_snapshots (id, location, size, checksum, row_counts, trigger_type, version, created_by, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+        snap.ID, snap.Location, snap.Size, snap.Checksum, string(rowCounts), snap.Trigger, snap.Version,
+        nullString(user), snap.CreatedAt); err != nil {
+        bm.metrics.IncrementCounter("router_backups", map[string]string{"trigger": trigger, "status": "failed"})
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to record snapshot").WithContext("location", snap.Location)
+    }
+
+    bm.metrics.IncrementCounter("router_backups", map[string]string{"trigger": trigger, "status": "succeeded"})
+    bm.metrics.SetGauge("router_backup_last_success", float64(snap.CreatedAt.Unix()), nil)
+    return snap, nil
+}
+
+// write compresses a snapshot to a temporary file and moves it to the
+// destination. Snapshots hold provider credentials, local files are 0600.
+func (bm *BackupManager) write(ctx context.Context, file *backupFile) (*models.BackupSnapshot, error) {
+    tmp, err := os.CreateTemp("", "ara-backup-*")
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to create snapshot file")
+    }
+    defer os.Remove(tmp.Name())
+    defer tmp.Close()
+
+    hash := sha256.New()
+    gz := gzip.NewWriter(io.MultiWriter(tmp, hash))
+    if err := json.NewEncoder(gz).Encode(file); err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to write snapshot file")
+    }
+    if err := gz.Close(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to write snapshot file")
+    }
+    info, err := tmp.Stat()
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to stat snapshot file")
+    }
+    if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to rewind snapshot file")
+    }
+
+    snap := &models.BackupSnapshot{
+        ID:        file.ID,
+        Location:  bm.location(file.ID),
+        Size:      info.Size(),
+        Checksum:  hex.EncodeToString(hash.Sum(nil)),
+        Rows:      make(map[string]int, len(file.Tables)),
+        Version:   file.Version,
+        CreatedAt: file.CreatedAt,
+    }
+    for table, t := range file.Tables {
+        snap.Rows[table] = len(t.Rows)
+    }
+
+    if strings.HasPrefix(bm.config.Destination, "s3://") {
+        if err := bm.checkS3(); err != nil {
+            return nil, err
+        }
+        if err := putS3(ctx, bm.config.S3, bm.config.Destination, backupFileName(file.ID), tmp, info.Size()); err != nil {
+            return nil, err
+        }
+        return snap, nil
+    }
+
+    if err := os.MkdirAll(bm.config.Destination, 0700); err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to create backup directory").
+            WithContext("destination", bm.config.Destination)
+    }
+    out, err := os.OpenFile(snap.Location+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to create snapshot file").WithContext("location", snap.Location)
+    }
+    _, err = io.Copy(out, tmp)
+    if closeErr := out.Close(); err == nil {
+        err = closeErr
+    }
+    if err == nil {
+        err = os.Rename(snap.Location+".tmp", snap.Location)
+    }
+    if err != nil {
+        os.Remove(snap.Location + ".tmp")
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to write snapshot file").WithContext("location", snap.Location)
+    }
+    return snap, nil
+}
+
+// load reads a snapshot, verifying it against the checksum recorded when it
+// was taken. Snapshots the database has no record of, as after losing it,
+// are read from the configured destination unverified.
+func (bm *BackupManager) load(ctx context.Context, id string) (*backupFile, error) {
+    if _, err := time.Parse(backupIDFormat, id); err != nil {
+        return nil, errors.New(errors.ErrInternal, "invalid snapshot id").WithContext("snapshot", id)
+    }
+
+    location, checksum := bm.location(id), ""
+    if recorded, err := bm.Get(ctx, id); err == nil {
+        location, checksum = recorded.Location, recorded.Checksum
+    }
+
+    var reader io.ReadCloser
+    if strings.HasPrefix(location, "s3://") {
+        if err := bm.checkS3(); err != nil {
+            return nil, err
+        }
+        resp, err := doS3(ctx, bm.config.S3, http.MethodGet, strings.TrimSuffix(location, "/"+backupFileName(id)),
+            backupFileName(id), nil, 0, emptyPayloadHash)
+        if err != nil {
+            return nil, errors.Wrap(err, errors.ErrInternal, "failed to fetch snapshot").WithContext("location", location)
+        }
+        reader = resp.Body
+    } else {
+        f, err := os.Open(location)
+        if err != nil {
+            return nil, errors.Wrap(err, errors.ErrInternal, "failed to open snapshot").WithContext("location", location)
+        }
+        reader = f
+    }
+    defer reader.Close()
+
+    hash := sha256.New()
+    tee := io.TeeReader(reader, hash)
+    gz, err := gzip.NewReader(tee)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to read snapshot").WithContext("location", location)
+    }
+    decoder := json.NewDecoder(gz)
+    decoder.UseNumber()
+
+    var file backupFile
+    if err := decoder.Decode(&file); err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to read snapshot").WithContext("location", location)
+    }
+    io.Copy(io.Discard, tee)
+
+    if checksum != "" && hex.EncodeToString(hash.Sum(nil)) != checksum {
+        return nil, errors.New(errors.ErrInternal, "snapshot checksum mismatch").WithContext("location", location)
+    }
+    if file.ID != id {
+        return nil, errors.New(errors.ErrInternal, "snapshot file holds another snapshot").
+            WithContext("location", location).WithContext("holds", file.ID)
+    }
+    return &file, nil
+}
+
+// restoreTable replaces a table's rows with a snapshot's. Columns the table
+// no longer has are dropped and columns added since take their defaults.
+func restoreTable(ctx context.Context, tx *sql.Tx, table string, t *backupTable) (int, error) {
+    rows, err := tx.QueryContext(ctx, "SELECT * FROM "+table+" LIMIT 0")
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to read table").WithContext("table", table)
+    }
+    current, err := rows.Columns()
+    rows.Close()
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to read table").WithContext("table", table)
+    }
+    has := make(map[string]bool, len(current))
+    for _, c := range current {
+        has[c] = true
+    }
+    isTime := make(map[string]bool, len(t.Times))
+    for _, c := range t.Times {
+        isTime[c] = true
+    }
+
+    var columns []string
+    var indexes []int
+    for i, c := range t.Columns {
+        if has[c] {
+            columns = append(columns, "`"+c+"`")
+            indexes = append(indexes, i)
+        }
+    }
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to empty table").WithContext("table", table)
+    }
+    if len(columns) == 0 {
+        return 0, nil
+    }
+
+    placeholders := "(?" + strings.Repeat(", ?", len(columns)-1) + ")"
+    const batch = 200
+    for start := 0; start < len(t.Rows); start += batch {
+        end := start + batch
+        if end > len(t.Rows) {
+            end = len(t.Rows)
+        }
+
+        values := make([]string, 0, end-start)
+        args := make([]interface{}, 0, (end-start)*len(columns))
+        for _, row := range t.Rows[start:end] {
+            values = append(values, placeholders)
+            for _, i := range indexes {
+                var v interface{}
+                if i < len(row) {
+                    v = row[i]
+                }
+                switch value := v.(type) {
+                case json.Number:
+                    v = value.String()
+                case string:
+                    if isTime[t.Columns[i]] {
+                        if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+                            v = parsed
+                        }
+                    }
+                }
+                args = append(args, v)
+            }
+        }
+
+        if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+            table, strings.Join(columns, ", "), strings.Join(values, ", ")), args...); err != nil {
+            return 0, errors.Wrap(err, errors.ErrDatabase, "failed to restore table").WithContext("table", table)
+        }
+    }
+    return len(t.Rows), nil
+}
+
+// didAllocation is a DID held by a call when a restore starts
+type didAllocation struct {
+    number      string
+    destination sql.NullString
+    allocated   sql.NullTime
+}
+
+func allocatedDIDs(ctx context.Context, tx *sql.Tx) ([]didAllocation, error) {
+    rows, err := tx.QueryContext(ctx, "SELECT number, destination, allocation_time FROM dids WHERE in_use = 1")
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query allocated DIDs")
+    }
+    defer rows.Close()
+
+    var allocations []didAllocation
+    for rows.Next() {
+        var a didAllocation
+        if err := rows.Scan(&a.number, &a.destination, &a.allocated); err != nil {
+            return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query allocated DIDs")
+        }
+        allocations = append(allocations, a)
+    }
+    return allocations, rows.Err()
+}
+
+// reallocateDIDs frees the numbers a snapshot has in use and gives calls in
+// progress back the restored numbers they hold
+func reallocateDIDs(ctx context.Context, tx *sql.Tx, allocations []didAllocation) (int, error) {
+    if _, err := tx.ExecContext(ctx, "UPDATE dids SET in_use = 0, destination = NULL WHERE in_use = 1"); err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to release restored DIDs")
+    }
+
+    var kept int
+    for _, a := range allocations {
+        result, err := tx.ExecContext(ctx, "UPDATE dids SET in_use = 1, destination = ?, allocation_time = ? WHERE number = ?",
+            a.destination, a.allocated, a.number)
+        if err != nil {
+            return 0, errors.Wrap(err, errors.ErrDatabase, "failed to keep DID allocation").WithContext("number", a.number)
+        }
+        if n, _ := result.RowsAffected(); n > 0 {
+            kept++
+        }
+    }
+    return kept, nil
+}
+
+// restoredCacheKeys are the cache entries of the providers, groups and routes
+// before and after a restore
+func restoredCacheKeys(files ...*backupFile) []string {
+    keys := []string{"did:stats", "groups:all", patternRoutesKey, prefixRoutesKey}
+    for _, f := range files {
+        for _, name := range f.values("providers", "name") {
+            keys = append(keys, "provider:"+name)
+        }
+        for _, providerType := range f.values("providers", "type") {
+            keys = append(keys, "providers:"+providerType)
+        }
+        for _, name := range f.values("provider_groups", "name") {
+            keys = append(keys, "group:"+name, "group:"+name+":members")
+        }
+        for _, inbound := range f.values("provider_routes", "inbound_provider") {
+            keys = append(keys, "route:inbound:"+inbound)
+        }
+    }
+    return keys
+}
+
+// values returns the distinct values of a column of a table in the snapshot
+func (f *backupFile) values(table, column string) []string {
+    t, ok := f.Tables[table]
+    if !ok {
+        return nil
+    }
+    index := -1
+    for i, c := range t.Columns {
+        if c == column {
+            index = i
+        }
+    }
+    if index < 0 {
+        return nil
+    }
+
+    seen := make(map[string]bool)
+    var values []string
+    for _, row := range t.Rows {
+        if index >= len(row) {
+            continue
+        }
+        if v, ok := row[index].(string); ok && !seen[v] {
+            seen[v] = true
+            values = append(values, v)
+        }
+    }
+    return values
+}
+
+// prune deletes the oldest snapshots beyond Keep
+func (bm *BackupManager) prune(ctx context.Context) {
+    if bm.config.Keep == 0 {
+        return
+    }
+
+    snapshots, err := bm.query(ctx, "ORDER BY id DESC")
+    if err != nil || len(snapshots) <= bm.config.Keep {
+        return
+    }
+
+    for _, snap := range snapshots[bm.config.Keep:] {
+        if err := bm.remove(ctx, snap); err != nil {
+            logger.WithContext(ctx).WithError(err).WithField("snapshot", snap.ID).Warn("Failed to delete old snapshot")
+            continue
+        }
+        bm.db.ExecContext(ctx, "DELETE FROM backup_snapshots WHERE id = ?", snap.ID)
+    }
+}
+
+func (bm *BackupManager) remove(ctx context.Context, snap *models.BackupSnapshot) error {
+    if !strings.HasPrefix(snap.Location, "s3://") {
+        if err := os.Remove(snap.Location); err != nil && !os.IsNotExist(err) {
+            return err
+        }
+        return nil
+    }
+
+    name := backupFileName(snap.ID)
+    resp, err := doS3(ctx, bm.config.S3, http.MethodDelete, strings.TrimSuffix(snap.Location, "/"+name), name,
+        nil, 0, emptyPayloadHash)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+func (bm *BackupManager) checkS3() error {
+    if bm.config.S3.AccessKey == "" || bm.config.S3.SecretKey == "" {
+        return errors.New(errors.ErrConfiguration, "s3 backups need router.backup.s3 credentials")
+    }
+    return nil
+}
+
+// location is where the destination holds a snapshot
+func (bm *BackupManager) location(id string) string {
+    if strings.HasPrefix(bm.config.Destination, "s3://") {
+        return strings.TrimSuffix(bm.config.Destination, "/") + "/" + backupFileName(id)
+    }
+    return filepath.Join(bm.config.Destination, backupFileName(id))
+}
+
+func backupFileName(id string) string {
+    return id + ".json.gz"
+}
+
+// selectBackupSets returns the tables of the named sets in restore order
+func selectBackupSets(sets []string) ([]string, []string, error) {
+    wanted := make(map[string]bool, len(sets))
+    for _, name := range sets {
+        wanted[strings.TrimSpace(name)] = true
+    }
+
+    var tables, names []string
+    for _, set := range backupSets {
+        if len(sets) > 0 && !wanted[set.name] {
+            continue
+        }
+        delete(wanted, set.name)
+        tables = append(tables, set.tables...)
+        names = append(names, set.name)
+    }
+    for name := range wanted {
+        return nil, nil, errors.New(errors.ErrInternal, "unknown backup set").
+            WithContext("set", name).WithContext("sets", strings.Join(BackupSets(), ", "))
+    }
+    return tables, names, nil
+}
+
+func (bm *BackupManager) query(ctx context.Context, clause string, args ...interface{}) ([]*models.BackupSnapshot, error) {
+    rows, err := bm.db.QueryContext(ctx, `
+        SELECT id, location, size, checksum, COALESCE(row_counts, '{}'), trigger_type,
+               COALESCE(version, ''), COALESCE(created_by, ''), created_at
+        FROM backup_snapshots
+        `+clause, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query snapshots")
+    }
+    defer rows.Close()
+
+    var snapshots []*models.BackupSnapshot
+    for rows.Next() {
+        var s models.BackupSnapshot
+        var rowCounts string
+        if err := rows.Scan(&s.ID, &s.Location, &s.Size, &s.Checksum, &rowCounts, &s.Trigger,
+            &s.Version, &s.CreatedBy, &s.CreatedAt); err != nil {
+            continue
+        }
+        json.Unmarshal([]byte(rowCounts), &s.Rows)
+        snapshots = append(snapshots, &s)
+    }
+    return snapshots, rows.Err()
+}
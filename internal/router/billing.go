@@ -0,0 +1,99 @@
+package router
+
+import (
+    "context"
+    "encoding/json"
+    "strings"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// billingRules returns the billing rule of each named provider. Providers
+// that can't be looked up get the zero rule and are billed per second.
+func (r *Router) billingRules(ctx context.Context, names ...string) map[string]models.BillingRule {
+    rules := make(map[string]models.BillingRule, len(names))
+
+    args := make([]interface{}, 0, len(names))
+    for _, name := range names {
+        if name != "" {
+            args = append(args, name)
+        }
+    }
+    if len(args) == 0 {
+        return rules
+    }
+
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT name, COALESCE(min_duration, 0), COALESCE(billing_increment, 1)
+        FROM providers
+        WHERE name IN (?`+strings.Repeat(", ?", len(args)-1)+`)`, args...)
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to load billing rules, billing per second")
+        return rules
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var name string
+        var rule models.BillingRule
+        if err := rows.Scan(&name, &rule.MinDuration, &rule.Increment); err != nil {
+            continue
+        }
+        rules[name] = rule
+    }
+    return rules
+}
+
+// hopLegsMetadata is the call record metadata key of the hops a call went
+// through, their legs have no columns of their own
+const hopLegsMetadata = "hop_legs"
+
+// rateLegs sets the billable duration of each leg from the talk time, every
+// provider rounding it by its own billing rule. The inbound leg is what the
+// customer is billed, the intermediate, hop and final legs what the carriers
+// bill. A pass-through call has no intermediate leg to bill.
+func (r *Router) rateLegs(ctx context.Context, record *models.CallRecord, seconds int) {
+    names := append([]string{record.InboundProvider, record.IntermediateProvider, record.FinalProvider}, hopProviders(record)...)
+    rules := r.billingRules(ctx, names...)
+
+    record.BillableDuration = rules[record.InboundProvider].Billable(seconds)
+    if record.IntermediateProvider != "" {
+        record.IntermediateBillable = rules[record.IntermediateProvider].Billable(seconds)
+    }
+    record.FinalBillable = rules[record.FinalProvider].Billable(seconds)
+
+    if len(record.HopLegs) == 0 {
+        return
+    }
+    // The legs are shared with the active call the record was copied from
+    legs := append([]models.HopLeg(nil), record.HopLegs...)
+    for i := range legs {
+        legs[i].Billable = rules[legs[i].Provider].Billable(seconds)
+    }
+    record.HopLegs = legs
+
+    metadata := make(models.JSON, len(record.Metadata)+1)
+    for k, v := range record.Metadata {
+        metadata[k] = v
+    }
+    metadata[hopLegsMetadata] = legs
+    record.Metadata = metadata
+}
+
+// storedHopLegs reads back the hops of a closed call from its metadata
+func storedHopLegs(metadata models.JSON) []models.HopLeg {
+    value, ok := metadata[hopLegsMetadata]
+    if !ok {
+        return nil
+    }
+    data, err := json.Marshal(value)
+    if err != nil {
+        return nil
+    }
+    var legs []models.HopLeg
+    if err := json.Unmarshal(data, &legs); err != nil {
+        return nil
+    }
+    return legs
+}
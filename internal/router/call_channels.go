@@ -0,0 +1,146 @@
+package router
+
+import (
+    "context"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// ChannelLister lists the channels Asterisk holds, implemented by the AMI manager
+type ChannelLister interface {
+    LiveChannels(ctx context.Context) ([]models.LiveChannel, error)
+}
+
+// CallChannels correlates the channels Asterisk holds with the active call
+// records matching filter. Channels are grouped by the call they started on:
+// the inbound channel's Uniqueid is the call ID and the channels it dials
+// share it as Linkedid. The return leg from S3 comes in as a call of its own,
+// known by the DID it dials, and brings the final leg along. Calls without a
+// channel are ghosts, left active in call_records after Asterisk let go of
+// them; channels of no active call are orphans. A channel list Asterisk
+// doesn't complete fails the report, it would show ghosts that aren't.
+func (r *Router) CallChannels(ctx context.Context, lister ChannelLister, filter models.CallFilter) (*models.ChannelReport, error) {
+    takenAt := time.Now()
+    channels, err := lister.LiveChannels(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    // Every active call claims its channels, whether the filter shows it or not
+    filter.ActiveOnly = true
+    all, err := r.listAllCalls(ctx, models.CallFilter{ActiveOnly: true})
+    if err != nil {
+        return nil, err
+    }
+    shown := all
+    if filter != (models.CallFilter{ActiveOnly: true}) {
+        if shown, err = r.listAllCalls(ctx, filter); err != nil {
+            return nil, err
+        }
+    }
+
+    byCallID := make(map[string]*models.CallRecord, len(all))
+    byDID := make(map[string]*models.CallRecord, len(all))
+    for _, call := range all {
+        byCallID[call.CallID] = call
+        if call.AssignedDID != "" {
+            byDID[call.AssignedDID] = call
+        }
+    }
+
+    bridges := make(map[string][]string)
+    groups := make(map[string][]int)
+    var order []string
+    for i, ch := range channels {
+        if ch.BridgeID != "" {
+            bridges[ch.BridgeID] = append(bridges[ch.BridgeID], ch.Channel)
+        }
+        linked := ch.LinkedID
+        if linked == "" {
+            linked = ch.UniqueID
+        }
+        if _, seen := groups[linked]; !seen {
+            order = append(order, linked)
+        }
+        groups[linked] = append(groups[linked], i)
+    }
+    for i := range channels {
+        for _, peer := range bridges[channels[i].BridgeID] {
+            if peer != channels[i].Channel {
+                channels[i].BridgedWith = append(channels[i].BridgedWith, peer)
+            }
+        }
+    }
+
+    report := &models.ChannelReport{TakenAt: takenAt}
+    claimed := make(map[string][]models.LiveChannel)
+    for _, linked := range order {
+        call := channelCall(channels, groups[linked], byCallID, byDID)
+        for _, i := range groups[linked] {
+            if call == nil {
+                report.Orphans = append(report.Orphans, channels[i])
+                continue
+            }
+            claimed[call.CallID] = append(claimed[call.CallID], channels[i])
+        }
+    }
+
+    for _, call := range shown {
+        entry := models.CallChannels{Call: call, Channels: claimed[call.CallID]}
+        // Calls routed since the channels were listed can't be told apart from ghosts
+        if len(entry.Channels) == 0 && call.StartTime.Before(takenAt) {
+            entry.Ghost = true
+            report.Ghosts++
+        }
+        report.Calls = append(report.Calls, entry)
+    }
+    return report, nil
+}
+
+// channelCall finds the call a group of linked channels belongs to, by the
+// call ID they carry or by the DID a return leg dialed
+func channelCall(channels []models.LiveChannel, group []int, byCallID, byDID map[string]*models.CallRecord) *models.CallRecord {
+    for _, i := range group {
+        if call, ok := byCallID[channels[i].UniqueID]; ok {
+            return call
+        }
+        if call, ok := byCallID[channels[i].LinkedID]; ok {
+            return call
+        }
+    }
+    for _, i := range group {
+        ch := channels[i]
+        if ch.Context != "from-provider-intermediate" {
+            continue
+        }
+        if call, ok := byDID[ch.Exten]; ok {
+            return call
+        }
+        // The DNIS may carry the correlation token as a suffix
+        for did, call := range byDID {
+            if strings.HasPrefix(ch.Exten, did) {
+                return call
+            }
+        }
+    }
+    return nil
+}
+
+// listAllCalls reads every page of the call records matching filter
+func (r *Router) listAllCalls(ctx context.Context, filter models.CallFilter) ([]*models.CallRecord, error) {
+    var calls []*models.CallRecord
+    opts := models.ListOptions{Limit: models.MaxListLimit}
+    for {
+        page, total, err := r.ListCalls(ctx, filter, opts)
+        if err != nil {
+            return nil, err
+        }
+        calls = append(calls, page...)
+        opts.Offset += len(page)
+        if len(page) == 0 || int64(opts.Offset) >= total {
+            return calls, nil
+        }
+    }
+}
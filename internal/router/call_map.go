@@ -0,0 +1,134 @@
+package router
+
+import (
+    "hash/fnv"
+    "sync"
+    "sync/atomic"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// callMapShards must be a power of two
+const callMapShards = 64
+
+var (
+    callMapReadLabels  = map[string]string{"op": "read"}
+    callMapWriteLabels = map[string]string{"op": "write"}
+)
+
+// callMap is a sharded map of active calls. Each shard has its own lock so
+// AGI events for different calls don't serialize on a single mutex.
+type callMap struct {
+    shards  [callMapShards]callShard
+    count   int64
+    metrics MetricsInterface
+}
+
+type callShard struct {
+    mu    sync.RWMutex
+    calls map[string]*models.CallRecord
+}
+
+func newCallMap(metrics MetricsInterface) *callMap {
+    cm := &callMap{metrics: metrics}
+    for i := range cm.shards {
+        cm.shards[i].calls = make(map[string]*models.CallRecord)
+    }
+    return cm
+}
+
+func (cm *callMap) shard(callID string) *callShard {
+    h := fnv.New32a()
+    h.Write([]byte(callID))
+    return &cm.shards[h.Sum32()&(callMapShards-1)]
+}
+
+// lock takes the shard write lock and records contention when it had to wait
+func (cm *callMap) lock(s *callShard) {
+    if s.mu.TryLock() {
+        return
+    }
+    start := time.Now()
+    s.mu.Lock()
+    cm.metrics.IncrementCounter("router_call_map_contention", callMapWriteLabels)
+    cm.metrics.ObserveHistogram("router_call_map_lock_wait", time.Since(start).Seconds(), callMapWriteLabels)
+}
+
+// rlock takes the shard read lock and records contention when it had to wait
+func (cm *callMap) rlock(s *callShard) {
+    if s.mu.TryRLock() {
+        return
+    }
+    start := time.Now()
+    s.mu.RLock()
+    cm.metrics.IncrementCounter("router_call_map_contention", callMapReadLabels)
+    cm.metrics.ObserveHistogram("router_call_map_lock_wait", time.Since(start).Seconds(), callMapReadLabels)
+}
+
+// Get returns the active call
+func (cm *callMap) Get(callID string) (*models.CallRecord, bool) {
+    s := cm.shard(callID)
+    cm.rlock(s)
+    record, exists := s.calls[callID]
+    s.mu.RUnlock()
+    return record, exists
+}
+
+// Set stores an active call
+func (cm *callMap) Set(callID string, record *models.CallRecord) {
+    s := cm.shard(callID)
+    cm.lock(s)
+    if _, exists := s.calls[callID]; !exists {
+        atomic.AddInt64(&cm.count, 1)
+    }
+    s.calls[callID] = record
+    s.mu.Unlock()
+}
+
+// Delete removes an active call and reports whether it was present
+func (cm *callMap) Delete(callID string) bool {
+    s := cm.shard(callID)
+    cm.lock(s)
+    _, exists := s.calls[callID]
+    if exists {
+        delete(s.calls, callID)
+        atomic.AddInt64(&cm.count, -1)
+    }
+    s.mu.Unlock()
+    return exists
+}
+
+// Update mutates an active call while holding its shard lock
+func (cm *callMap) Update(callID string, fn func(record *models.CallRecord)) bool {
+    s := cm.shard(callID)
+    cm.lock(s)
+    defer s.mu.Unlock()
+    
+    record, exists := s.calls[callID]
+    if exists {
+        fn(record)
+    }
+    return exists
+}
+
+// Len returns the number of active calls without locking
+func (cm *callMap) Len() int {
+    return int(atomic.LoadInt64(&cm.count))
+}
+
+// Range calls fn for every active call until it returns false. Shards are
+// locked one at a time, so fn must not call back into the map.
+func (cm *callMap) Range(fn func(callID string, record *models.CallRecord) bool) {
+    for i := range cm.shards {
+        s := &cm.shards[i]
+        cm.rlock(s)
+        for callID, record := range s.calls {
+            if !fn(callID, record) {
+                s.mu.RUnlock()
+                return
+            }
+        }
+        s.mu.RUnlock()
+    }
+}
@@ -0,0 +1,226 @@
+package router
+
+import (
+    "context"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// RecoveryConfig controls rebuilding the active calls of a restarted AGI server
+type RecoveryConfig struct {
+    Enabled       bool
+    ReconcileDIDs bool // release DIDs in use without a live channel, only when every node shares the Asterisk
+}
+
+// CallRecovery is what RecoverCalls found after a restart
+type CallRecovery struct {
+    Restored     int  // open calls of this node put back in memory
+    Closed       int  // of those, calls whose inbound channel is gone
+    ReleasedDIDs int  // DIDs in use without a live call on Asterisk
+    Verified     bool // the calls were checked against Asterisk's channels
+}
+
+// RecoverCalls rebuilds the active calls of this node from the call records a
+// previous run left open, so calls up across a restart of the AGI server can
+// still return from S3, hang up and release their DID. The route policy and
+// dial options the calls were routed with are not stored and fall back to the
+// defaults. With an Asterisk to ask, calls whose inbound channel is gone are
+// closed and, with ReconcileDIDs, DIDs marked in use by no live call are
+// released; without one the calls are restored as they are and left to hang
+// up or go stale. Run it before the AGI server takes calls.
+func (r *Router) RecoverCalls(ctx context.Context, asterisk AsteriskCommander) (*CallRecovery, error) {
+    log := logger.WithContext(ctx).WithField("node", r.config.NodeID)
+    recovery := &CallRecovery{}
+
+    var live map[string]bool
+    var listedAt time.Time
+    if asterisk != nil {
+        var err error
+        listedAt = time.Now()
+        if live, err = liveChannels(asterisk); err != nil {
+            log.WithError(err).Warn("Failed to list Asterisk channels, restoring calls unverified")
+        }
+    }
+    recovery.Verified = live != nil
+
+    records, err := r.openCallRecords(ctx, time.Now().Add(-r.config.StaleCallTimeout))
+    if err != nil {
+        return nil, err
+    }
+
+    var restored []*models.CallRecord
+    for _, record := range records {
+        // Already known when a hangup or return raced the recovery
+        if _, exists := r.activeCalls.Get(record.CallID); exists {
+            continue
+        }
+        r.restoreCall(record)
+        restored = append(restored, record)
+    }
+    recovery.Restored = len(restored)
+
+    if live != nil {
+        now := time.Now()
+        for _, record := range restored {
+            if live[record.CallID] {
+                continue
+            }
+            // The hangup went unseen, its cause is not known
+            if err := r.closeAbandonedCall(ctx, record.CallID, "AGI_RESTART", 0, now); err != nil {
+                log.WithError(err).WithField("call_id", record.CallID).Warn("Failed to close call that ended during the restart")
+                continue
+            }
+            recovery.Closed++
+        }
+
+    }
+    if live != nil && r.config.Recovery.ReconcileDIDs {
+        released, err := r.releaseOrphanedDIDs(ctx, live, listedAt)
+        if err != nil {
+            log.WithError(err).Warn("Failed to reconcile DIDs with Asterisk channels")
+        }
+        recovery.ReleasedDIDs = released
+    }
+
+    r.metrics.SetGauge("router_recovered_calls", float64(recovery.Restored-recovery.Closed), nil)
+    log.WithFields(map[string]interface{}{
+        "restored":      recovery.Restored,
+        "closed":        recovery.Closed,
+        "released_dids": recovery.ReleasedDIDs,
+        "verified":      recovery.Verified,
+    }).Info("Recovered active calls from call records")
+
+    return recovery, nil
+}
+
+// restoreCall puts a call back in memory with what routing it holds
+func (r *Router) restoreCall(record *models.CallRecord) {
+    r.activeCalls.Set(record.CallID, record)
+    if record.AssignedDID != "" {
+        r.didManager.RegisterCallDID(record.AssignedDID, record.CallID)
+    }
+    r.loadBalancer.IncrementActiveCalls(record.IntermediateProvider)
+    r.loadBalancer.IncrementActiveCalls(record.FinalProvider)
+
+    // A DID that already brought its call back may not do so again
+    switch record.Status {
+    case models.CallStatusReturnedFromS3, models.CallStatusRoutingToS4:
+        if record.AssignedDID != "" {
+            r.replayGuard.Consume(returnLegKey(record.AssignedDID), record.CallID)
+        }
+    }
+}
+
+// openCallRecords returns the calls this node started since the given time
+// that are not closed
+func (r *Router) openCallRecords(ctx context.Context, since time.Time) ([]*models.CallRecord, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT call_id, original_ani, original_dnis,
+               COALESCE(transformed_ani, ''), COALESCE(assigned_did, ''),
+               COALESCE(inbound_provider, ''), COALESCE(intermediate_provider, ''), COALESCE(final_provider, ''),
+               COALESCE(route_name, ''), status, COALESCE(current_step, ''),
+               start_time, answer_time, COALESCE(is_test, 0), metadata
+        FROM call_records
+        WHERE router_node = ? AND end_time IS NULL AND start_time >= ? AND status IN (?, ?, ?, ?)`,
+        r.config.NodeID, since,
+        models.CallStatusInitiated, models.CallStatusActive,
+        models.CallStatusReturnedFromS3, models.CallStatusRoutingToS4)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query open call records")
+    }
+    defer rows.Close()
+
+    var records []*models.CallRecord
+    for rows.Next() {
+        var call models.CallRecord
+        err := rows.Scan(
+            &call.CallID, &call.OriginalANI, &call.OriginalDNIS,
+            &call.TransformedANI, &call.AssignedDID,
+            &call.InboundProvider, &call.IntermediateProvider, &call.FinalProvider,
+            &call.RouteName, &call.Status, &call.CurrentStep,
+            &call.StartTime, &call.AnswerTime, &call.IsTest, &call.Metadata,
+        )
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to scan call record")
+            continue
+        }
+        records = append(records, &call)
+    }
+    return records, rows.Err()
+}
+
+// releaseOrphanedDIDs releases the DIDs marked in use that no open call with
+// a live channel holds. DIDs allocated after the channels were listed are
+// left alone, their calls may have started since.
+func (r *Router) releaseOrphanedDIDs(ctx context.Context, live map[string]bool, listedAt time.Time) (int, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT d.number, COALESCE(c.call_id, '')
+        FROM dids d
+        LEFT JOIN call_records c ON c.assigned_did = d.number AND c.end_time IS NULL
+        WHERE d.in_use = 1 AND (d.allocation_time IS NULL OR d.allocation_time < ?)`,
+        listedAt)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to query DIDs in use")
+    }
+    held := make(map[string]bool)
+    var numbers []string
+    for rows.Next() {
+        var number, callID string
+        if rows.Scan(&number, &callID) != nil {
+            continue
+        }
+        if _, seen := held[number]; !seen {
+            numbers = append(numbers, number)
+        }
+        held[number] = held[number] || live[callID]
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to read DIDs in use")
+    }
+
+    released := 0
+    for _, number := range numbers {
+        if held[number] {
+            continue
+        }
+        ok, err := r.didManager.ReleaseOrphanedDID(ctx, number, listedAt)
+        if err != nil {
+            return released, err
+        }
+        if !ok {
+            continue
+        }
+
+        logger.WithContext(ctx).WithField("did", number).Warn("Released DID in use without a live call")
+        released++
+    }
+    return released, nil
+}
+
+// liveChannels returns the unique IDs of the channels up on Asterisk. The
+// inbound channel of a call has the call's ID.
+func liveChannels(asterisk AsteriskCommander) (map[string]bool, error) {
+    out, err := asterisk.Command("core show channels concise")
+    if err != nil {
+        return nil, err
+    }
+
+    // Channel!Context!Exten!Priority!State!Application!Data!CallerID!
+    // Accountcode!PeerAccount!AMAFlags!Duration!BridgeID!Uniqueid
+    live := make(map[string]bool)
+    for _, line := range strings.Split(out, "\n") {
+        fields := strings.Split(strings.TrimSpace(line), "!")
+        if len(fields) < 14 {
+            continue
+        }
+        if id := fields[len(fields)-1]; id != "" {
+            live[id] = true
+        }
+    }
+    return live, nil
+}
@@ -0,0 +1,677 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// CDRExportConfig controls the CDR export scheduler and how files are delivered
+type CDRExportConfig struct {
+    Enabled       bool
+    Interval      time.Duration // how often due exports are looked for
+    Delay         time.Duration // wait after a period ends for its last calls to close
+    MaxAttempts   int           // automatic deliveries of a period before giving up
+    RetryInterval time.Duration
+    SFTP          SFTPConfig
+    S3            S3Config
+    SMTP          SMTPConfig
+    Webhook       WebhookConfig
+}
+
+// CDRExporter runs the scheduled per-customer and billing CDR exports
+type CDRExporter struct {
+    db      *sql.DB
+    cache   CacheInterface
+    metrics MetricsInterface
+    fx      *FXRates
+    config  CDRExportConfig
+}
+
+// NewCDRExporter creates a CDR exporter
+func NewCDRExporter(db *sql.DB, cache CacheInterface, metrics MetricsInterface, fx *FXRates, config CDRExportConfig) *CDRExporter {
+    if config.Interval <= 0 {
+        config.Interval = 5 * time.Minute
+    }
+    if config.Delay < 0 {
+        config.Delay = 0
+    }
+    if config.MaxAttempts <= 0 {
+        config.MaxAttempts = 1
+    }
+    if config.RetryInterval <= 0 {
+        config.RetryInterval = 30 * time.Minute
+    }
+
+    return &CDRExporter{
+        db:      db,
+        cache:   cache,
+        metrics: metrics,
+        fx:      fx,
+        config:  config,
+    }
+}
+
+// Create adds a scheduled export. Format, fields, timezone and frequency
+// default to CSV with every field, UTC and daily. The customer is an inbound
+// provider, or models.CDRExportAllCustomers for a billing export.
+func (ce *CDRExporter) Create(ctx context.Context, e *models.CDRExport) error {
+    if e.Format == "" {
+        e.Format = models.ExportFormatCSV
+    }
+    if len(e.Fields) == 0 {
+        e.Fields = e.DefaultFields()
+    }
+    if e.Timezone == "" {
+        e.Timezone = "UTC"
+    }
+    if e.Frequency == "" {
+        e.Frequency = models.ExportDaily
+    }
+    if err := e.Validate(); err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "invalid CDR export")
+    }
+
+    if !e.AllCustomers() {
+        var customers int
+        err := ce.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM providers WHERE name = ? AND type = ?",
+            e.Customer, models.ProviderTypeInbound).Scan(&customers)
+        if err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to look up customer")
+        }
+        if customers == 0 {
+            return errors.New(errors.ErrProviderNotFound, "CDR exports are for inbound providers only").
+                WithContext("customer", e.Customer)
+        }
+    }
+
+    fields, _ := json.Marshal(e.Fields)
+    var fieldNames interface{}
+    if len(e.FieldNames) > 0 {
+        names, _ := json.Marshal(e.FieldNames)
+        fieldNames = string(names)
+    }
+
+    tx, err := ce.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    result, err := tx.ExecContext(ctx, `
+        INSERT INTO cdr_exports (name, customer, format, fields, field_names, timezone, frequency, destination, enabled, created_by)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+        e.Name, e.Customer, e.Format, string(fields), fieldNames, e.Timezone, e.Frequency, e.Destination, e.Enabled, e.CreatedBy)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to create CDR export")
+    }
+    e.ID, _ = result.LastInsertId()
+
+    if err := ce.audit(ctx, tx, e.Name, e.CreatedBy, "create", nil, e); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "export":   e.Name,
+        "customer": e.Customer,
+        "schedule": e.Frequency,
+    }).Info("CDR export created")
+    return nil
+}
+
+// List returns the scheduled exports
+func (ce *CDRExporter) List(ctx context.Context) ([]*models.CDRExport, error) {
+    return ce.query(ctx, "")
+}
+
+// Get returns one export by name
+func (ce *CDRExporter) Get(ctx context.Context, name string) (*models.CDRExport, error) {
+    exports, err := ce.query(ctx, "WHERE name = ?", name)
+    if err != nil {
+        return nil, err
+    }
+    if len(exports) == 0 {
+        return nil, errors.New(errors.ErrInternal, "CDR export not found").WithContext("name", name)
+    }
+    return exports[0], nil
+}
+
+// SetEnabled pauses or resumes an export's schedule
+func (ce *CDRExporter) SetEnabled(ctx context.Context, name string, enabled bool, user string) error {
+    e, err := ce.Get(ctx, name)
+    if err != nil {
+        return err
+    }
+
+    tx, err := ce.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "UPDATE cdr_exports SET enabled = ? WHERE id = ?", enabled, e.ID); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update CDR export")
+    }
+
+    action := "disable"
+    if enabled {
+        action = "enable"
+    }
+    if err := ce.audit(ctx, tx, name, user, action, e.Enabled, enabled); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+// Delete removes an export and its run history
+func (ce *CDRExporter) Delete(ctx context.Context, name, user string) error {
+    e, err := ce.Get(ctx, name)
+    if err != nil {
+        return err
+    }
+
+    tx, err := ce.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM cdr_exports WHERE id = ?", e.ID); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete CDR export")
+    }
+
+    if err := ce.audit(ctx, tx, name, user, "delete", e, nil); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+// Runs returns the latest runs, of one export when name is set
+func (ce *CDRExporter) Runs(ctx context.Context, name string, limit int) ([]*models.CDRExportRun, error) {
+    where, args := "", []interface{}{}
+    if name != "" {
+        where, args = "WHERE e.name = ?", append(args, name)
+    }
+    if limit <= 0 {
+        limit = 20
+    }
+    return ce.queryRuns(ctx, fmt.Sprintf("%s ORDER BY r.started_at DESC LIMIT %d", where, limit), args...)
+}
+
+// Rerun delivers the period of a past run again, whatever its status
+func (ce *CDRExporter) Rerun(ctx context.Context, runID int64) (*models.CDRExportRun, error) {
+    runs, err := ce.queryRuns(ctx, "WHERE r.id = ?", runID)
+    if err != nil {
+        return nil, err
+    }
+    if len(runs) == 0 {
+        return nil, errors.New(errors.ErrInternal, "CDR export run not found").WithContext("id", runID)
+    }
+
+    e, err := ce.Get(ctx, runs[0].ExportName)
+    if err != nil {
+        return nil, err
+    }
+    return ce.Run(ctx, e, runs[0].PeriodStart, runs[0].PeriodEnd)
+}
+
+// Run exports and delivers the calls of one period, replacing an earlier
+// run of the same period. The returned run carries the delivery status.
+func (ce *CDRExporter) Run(ctx context.Context, e *models.CDRExport, start, end time.Time) (*models.CDRExportRun, error) {
+    log := logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "export":   e.Name,
+        "customer": e.Customer,
+        "period":   start.Format("2006-01-02"),
+    })
+
+    _, err := ce.db.ExecContext(ctx, `
+        INSERT INTO cdr_export_runs (export_id, period_start, period_end, status, attempts, started_at)
+        VALUES (?, ?, ?, ?, 1, NOW())
+        ON DUPLICATE KEY UPDATE status = VALUES(status), attempts = attempts + 1, records = 0, bytes = 0,
+            error = NULL, started_at = NOW(), finished_at = NULL`,
+        e.ID, start, end, models.ExportRunRunning)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to record CDR export run")
+    }
+
+    run := &models.CDRExportRun{ExportID: e.ID, ExportName: e.Name, PeriodStart: start, PeriodEnd: end}
+    run.FileName = exportFileName(e, start, end)
+    run.Records, run.Bytes, err = ce.export(ctx, e, start, end, run.FileName)
+
+    status, message := models.ExportRunDelivered, ""
+    if err != nil {
+        status, message = models.ExportRunFailed, err.Error()
+    }
+
+    if _, dbErr := ce.db.ExecContext(ctx, `
+        UPDATE cdr_export_runs SET status = ?, records = ?, bytes = ?, file_name = ?, error = ?, finished_at = NOW()
+        WHERE export_id = ? AND period_start = ?`,
+        status, run.Records, run.Bytes, run.FileName, nullString(message), e.ID, start); dbErr != nil {
+        log.WithError(dbErr).Warn("Failed to record CDR export status")
+    }
+
+    ce.metrics.IncrementCounter("router_cdr_exports", map[string]string{
+        "export": e.Name,
+        "status": string(status),
+    })
+
+    runs, qErr := ce.queryRuns(ctx, "WHERE r.export_id = ? AND r.period_start = ?", e.ID, start)
+    if qErr == nil && len(runs) > 0 {
+        run = runs[0]
+    } else {
+        run.Status, run.Error = status, message
+    }
+
+    if err != nil {
+        log.WithError(err).WithField("attempt", run.Attempts).Warn("CDR export delivery failed")
+        return run, err
+    }
+
+    log.WithFields(map[string]interface{}{
+        "records": run.Records,
+        "bytes":   run.Bytes,
+        "file":    run.FileName,
+    }).Info("CDR export delivered")
+    return run, nil
+}
+
+// RunSchedule delivers due exports until the context ends
+func (ce *CDRExporter) RunSchedule(ctx context.Context) {
+    ticker := time.NewTicker(ce.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        ce.runDue(ctx)
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// runDue runs each enabled export whose last finished period hasn't been
+// delivered yet, retrying failed deliveries up to MaxAttempts
+func (ce *CDRExporter) runDue(ctx context.Context) {
+    log := logger.WithContext(ctx)
+
+    // Only one router instance exports at a time
+    unlock, err := ce.cache.Lock(ctx, "cdr:export", 30*time.Minute)
+    if err != nil {
+        log.WithError(err).Debug("CDR export already running elsewhere")
+        return
+    }
+    defer unlock()
+
+    exports, err := ce.query(ctx, "WHERE enabled = TRUE")
+    if err != nil {
+        log.WithError(err).Warn("Failed to load CDR exports")
+        return
+    }
+
+    now := time.Now()
+    for _, e := range exports {
+        start, end, err := e.Period(now.Add(-ce.config.Delay))
+        if err != nil {
+            log.WithError(err).WithField("export", e.Name).Warn("Invalid CDR export schedule")
+            continue
+        }
+
+        runs, err := ce.queryRuns(ctx, "WHERE r.export_id = ? AND r.period_start = ?", e.ID, start)
+        if err != nil {
+            log.WithError(err).WithField("export", e.Name).Warn("Failed to load CDR export runs")
+            continue
+        }
+        if len(runs) > 0 {
+            last := runs[0]
+            if last.Status == models.ExportRunDelivered || last.Attempts >= ce.config.MaxAttempts {
+                continue
+            }
+            // A run left running by a router that stopped is retried like a failed one
+            if last.Status == models.ExportRunRunning && now.Sub(last.StartedAt) < 30*time.Minute {
+                continue
+            }
+            if last.FinishedAt != nil && now.Sub(*last.FinishedAt) < ce.config.RetryInterval {
+                continue
+            }
+        }
+
+        run, err := ce.Run(ctx, e, start, end)
+        if err != nil && run != nil && run.Attempts >= ce.config.MaxAttempts {
+            log.WithError(err).WithFields(map[string]interface{}{
+                "export":   e.Name,
+                "customer": e.Customer,
+                "period":   start.Format("2006-01-02"),
+                "attempts": run.Attempts,
+            }).Error("ALERT: CDR export could not be delivered, rerun it once the destination is fixed")
+        }
+    }
+}
+
+// export writes the period's calls to a temporary file and delivers it
+func (ce *CDRExporter) export(ctx context.Context, e *models.CDRExport, start, end time.Time, name string) (int, int64, error) {
+    file, err := os.CreateTemp("", "cdr-export-*")
+    if err != nil {
+        return 0, 0, errors.Wrap(err, errors.ErrInternal, "failed to create export file")
+    }
+    defer os.Remove(file.Name())
+    defer file.Close()
+
+    records, err := ce.write(ctx, file, e, start, end)
+    if err != nil {
+        return records, 0, err
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        return records, 0, errors.Wrap(err, errors.ErrInternal, "failed to stat export file")
+    }
+    if _, err := file.Seek(0, io.SeekStart); err != nil {
+        return records, 0, errors.Wrap(err, errors.ErrInternal, "failed to rewind export file")
+    }
+
+    if err := ce.deliver(ctx, e, file, info.Size(), name); err != nil {
+        return records, info.Size(), err
+    }
+    return records, info.Size(), nil
+}
+
+// write streams the customer's finished production calls of the period, or
+// every customer's, in the export's format and field set, times in its
+// timezone
+func (ce *CDRExporter) write(ctx context.Context, w io.Writer, e *models.CDRExport, start, end time.Time) (int, error) {
+    loc, err := e.Location()
+    if err != nil {
+        return 0, err
+    }
+
+    where := "cr.start_time >= ? AND cr.start_time < ?"
+    args := []interface{}{start, end}
+    if !e.AllCustomers() {
+        where = "cr.inbound_provider = ? AND " + where
+        args = append([]interface{}{e.Customer}, args...)
+    }
+    args = append(args, models.CallStatusCompleted, models.CallStatusFailed, models.CallStatusAbandoned, models.CallStatusTimeout)
+
+    rows, err := ce.db.QueryContext(ctx, `
+        SELECT cr.call_id, cr.start_time, cr.answer_time, cr.end_time, cr.original_ani, cr.original_dnis,
+               COALESCE(cr.assigned_did, ''), cr.status, COALESCE(cr.disposition, ''),
+               COALESCE(cr.duration, 0), COALESCE(cr.billable_duration, 0),
+               COALESCE(u.revenue, 0), COALESCE(u.cost, 0), COALESCE(u.currency, ''),
+               COALESCE(cr.inbound_provider, ''), COALESCE(cr.route_name, ''),
+               COALESCE(cr.intermediate_provider, ''), COALESCE(cr.final_provider, '')
+        FROM call_records cr
+        LEFT JOIN did_usage_log u ON u.call_id = cr.call_id
+        WHERE `+where+`
+          AND cr.status IN (?, ?, ?, ?) AND COALESCE(cr.is_test, 0) = 0
+        ORDER BY cr.start_time`, args...)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to query call records")
+    }
+    defer rows.Close()
+
+    formatTime := func(t sql.NullTime) string {
+        if !t.Valid {
+            return ""
+        }
+        return t.Time.In(loc).Format(time.RFC3339)
+    }
+
+    var out cdrWriter
+    if e.Format == models.ExportFormatJSON {
+        out = newJSONCDRWriter(w, e.Fields, e.Columns())
+    } else {
+        out = newCSVCDRWriter(w, e.Fields, e.Columns())
+    }
+    if err := out.begin(); err != nil {
+        return 0, errors.Wrap(err, errors.ErrInternal, "failed to write export file")
+    }
+
+    records := 0
+    for rows.Next() {
+        var (
+            callID, ani, dnis, did, status, disposition, currency string
+            customer, route, intermediate, final                  string
+            startTime, answerTime, endTime                        sql.NullTime
+            duration, billable                                    int
+            revenue, cost                                         float64
+        )
+        if err := rows.Scan(&callID, &startTime, &answerTime, &endTime, &ani, &dnis, &did, &status,
+            &disposition, &duration, &billable, &revenue, &cost, &currency,
+            &customer, &route, &intermediate, &final); err != nil {
+            return records, errors.Wrap(err, errors.ErrDatabase, "failed to read call record")
+        }
+
+        values := map[string]interface{}{
+            "call_id":           callID,
+            "start_time":        formatTime(startTime),
+            "answer_time":       formatTime(answerTime),
+            "end_time":          formatTime(endTime),
+            "ani":               ani,
+            "dnis":              dnis,
+            "did":               did,
+            "status":            status,
+            "disposition":       disposition,
+            "duration":          duration,
+            "billable_duration": billable,
+            "charge":            ce.fx.Convert(ctx, revenue, currency),
+            "currency":          ce.fx.Currency(),
+        }
+        if e.AllCustomers() {
+            values["customer"] = customer
+            values["route"] = route
+            values["intermediate_provider"] = intermediate
+            values["final_provider"] = final
+            values["cost"] = ce.fx.Convert(ctx, cost, currency)
+        }
+        if err := out.record(values); err != nil {
+            return records, errors.Wrap(err, errors.ErrInternal, "failed to write export file")
+        }
+        records++
+    }
+    if err := rows.Err(); err != nil {
+        return records, errors.Wrap(err, errors.ErrDatabase, "failed to read call records")
+    }
+
+    if err := out.end(); err != nil {
+        return records, errors.Wrap(err, errors.ErrInternal, "failed to write export file")
+    }
+    return records, nil
+}
+
+// cdrWriter writes the records of one export file
+type cdrWriter interface {
+    begin() error
+    record(values map[string]interface{}) error
+    end() error
+}
+
+type csvCDRWriter struct {
+    w       *csv.Writer
+    fields  []string
+    columns []string
+}
+
+func newCSVCDRWriter(w io.Writer, fields, columns []string) *csvCDRWriter {
+    return &csvCDRWriter{w: csv.NewWriter(w), fields: fields, columns: columns}
+}
+
+func (c *csvCDRWriter) begin() error {
+    return c.w.Write(c.columns)
+}
+
+func (c *csvCDRWriter) record(values map[string]interface{}) error {
+    row := make([]string, len(c.fields))
+    for i, f := range c.fields {
+        switch v := values[f].(type) {
+        case float64:
+            row[i] = strconv.FormatFloat(v, 'f', 4, 64)
+        default:
+            row[i] = fmt.Sprint(v)
+        }
+    }
+    return c.w.Write(row)
+}
+
+func (c *csvCDRWriter) end() error {
+    c.w.Flush()
+    return c.w.Error()
+}
+
+// jsonCDRWriter writes a JSON array of objects keeping the export's field
+// order, the columns are the keys
+type jsonCDRWriter struct {
+    w       io.Writer
+    fields  []string
+    columns []string
+    n       int
+}
+
+func newJSONCDRWriter(w io.Writer, fields, columns []string) *jsonCDRWriter {
+    return &jsonCDRWriter{w: w, fields: fields, columns: columns}
+}
+
+func (j *jsonCDRWriter) begin() error {
+    _, err := io.WriteString(j.w, "[")
+    return err
+}
+
+func (j *jsonCDRWriter) record(values map[string]interface{}) error {
+    var b strings.Builder
+    if j.n > 0 {
+        b.WriteString(",")
+    }
+    b.WriteString("\n  {")
+    for i, f := range j.fields {
+        if i > 0 {
+            b.WriteString(", ")
+        }
+        key, _ := json.Marshal(j.columns[i])
+        value, err := json.Marshal(values[f])
+        if err != nil {
+            return err
+        }
+        b.Write(key)
+        b.WriteString(": ")
+        b.Write(value)
+    }
+    b.WriteString("}")
+    j.n++
+    _, err := io.WriteString(j.w, b.String())
+    return err
+}
+
+func (j *jsonCDRWriter) end() error {
+    _, err := io.WriteString(j.w, "\n]\n")
+    return err
+}
+
+// exportFileName names a period's file after the export and the days it covers
+func exportFileName(e *models.CDRExport, start, end time.Time) string {
+    loc, err := e.Location()
+    if err != nil {
+        loc = time.UTC
+    }
+    first, last := start.In(loc), end.In(loc).AddDate(0, 0, -1)
+
+    days := first.Format("20060102")
+    if !last.Equal(first) {
+        days += "-" + last.Format("20060102")
+    }
+    return fmt.Sprintf("%s_%s.%s", e.Name, days, e.Format)
+}
+
+func (ce *CDRExporter) query(ctx context.Context, where string, args ...interface{}) ([]*models.CDRExport, error) {
+    rows, err := ce.db.QueryContext(ctx, fmt.Sprintf(`
+        SELECT id, name, customer, format, COALESCE(fields, '[]'), COALESCE(field_names, '{}'),
+               COALESCE(timezone, 'UTC'), frequency, destination, enabled, COALESCE(created_by, ''), created_at, updated_at
+        FROM cdr_exports
+        %s
+        ORDER BY name`, where), args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query CDR exports")
+    }
+    defer rows.Close()
+
+    var exports []*models.CDRExport
+    for rows.Next() {
+        var e models.CDRExport
+        var fields, fieldNames string
+        if err := rows.Scan(&e.ID, &e.Name, &e.Customer, &e.Format, &fields, &fieldNames, &e.Timezone, &e.Frequency,
+            &e.Destination, &e.Enabled, &e.CreatedBy, &e.CreatedAt, &e.UpdatedAt); err != nil {
+            continue
+        }
+        json.Unmarshal([]byte(fields), &e.Fields)
+        json.Unmarshal([]byte(fieldNames), &e.FieldNames)
+        if len(e.Fields) == 0 {
+            e.Fields = e.DefaultFields()
+        }
+        exports = append(exports, &e)
+    }
+    return exports, rows.Err()
+}
+
+func (ce *CDRExporter) queryRuns(ctx context.Context, where string, args ...interface{}) ([]*models.CDRExportRun, error) {
+    rows, err := ce.db.QueryContext(ctx, `
+        SELECT r.id, r.export_id, e.name, r.period_start, r.period_end, r.status, r.attempts,
+               r.records, r.bytes, COALESCE(r.file_name, ''), COALESCE(r.error, ''), r.started_at, r.finished_at
+        FROM cdr_export_runs r
+        JOIN cdr_exports e ON e.id = r.export_id
+        `+where, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query CDR export runs")
+    }
+    defer rows.Close()
+
+    var runs []*models.CDRExportRun
+    for rows.Next() {
+        var r models.CDRExportRun
+        var finished sql.NullTime
+        if err := rows.Scan(&r.ID, &r.ExportID, &r.ExportName, &r.PeriodStart, &r.PeriodEnd, &r.Status,
+            &r.Attempts, &r.Records, &r.Bytes, &r.FileName, &r.Error, &r.StartedAt, &finished); err != nil {
+            continue
+        }
+        if finished.Valid {
+            r.FinishedAt = &finished.Time
+        }
+        runs = append(runs, &r)
+    }
+    return runs, rows.Err()
+}
+
+func (ce *CDRExporter) audit(ctx context.Context, tx *sql.Tx, name, user, action string, oldValue, newValue interface{}) error {
+    return audit.Record(ctx, tx, audit.Entry{
+        EventType:  "cdr_export",
+        EntityType: "cdr_export",
+        EntityID:   name,
+        UserID:     user,
+        Action:     action,
+        OldValue:   oldValue,
+        NewValue:   newValue,
+    })
+}
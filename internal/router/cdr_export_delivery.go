@@ -0,0 +1,362 @@
+package router
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "mime/multipart"
+    "net"
+    "net/http"
+    "net/smtp"
+    "net/textproto"
+    "net/url"
+    "os"
+    "os/exec"
+    "path"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// SFTPConfig sets how sftp:// exports log in. Files are uploaded with the
+// system sftp client in batch mode, so host keys must already be known.
+type SFTPConfig struct {
+    IdentityFile string
+    Timeout      time.Duration
+}
+
+// S3Config holds the credentials of s3:// exports. Endpoint is only set for
+// S3 compatible stores, objects are then addressed path style.
+type S3Config struct {
+    Region    string
+    Endpoint  string
+    AccessKey string
+    SecretKey string
+}
+
+// SMTPConfig sets the mail server mailto: exports are sent through
+type SMTPConfig struct {
+    Host     string
+    Port     int
+    Username string
+    Password string
+    From     string
+}
+
+// WebhookConfig sets how http(s):// exports are posted. With a secret set
+// each request carries X-ARA-Signature, sha256= and the hex HMAC-SHA256 of
+// the body, for the receiver to check.
+type WebhookConfig struct {
+    Secret  string
+    Timeout time.Duration
+}
+
+// deliver sends an export file to the export's destination
+func (ce *CDRExporter) deliver(ctx context.Context, e *models.CDRExport, file *os.File, size int64, name string) error {
+    switch {
+    case strings.HasPrefix(e.Destination, "sftp://"):
+        return ce.deliverSFTP(ctx, e.Destination, file, name)
+    case strings.HasPrefix(e.Destination, "s3://"):
+        return ce.deliverS3(ctx, e.Destination, file, size, name)
+    case strings.HasPrefix(e.Destination, "https://"), strings.HasPrefix(e.Destination, "http://"):
+        return ce.deliverWebhook(ctx, e, file, size, name)
+    case strings.HasPrefix(e.Destination, "mailto:"):
+        return ce.deliverEmail(e, file, name)
+    }
+    return errors.New(errors.ErrInternal, "unsupported export destination").
+        WithContext("destination", e.Destination)
+}
+
+// deliverSFTP uploads to sftp://user@host[:port]/directory
+func (ce *CDRExporter) deliverSFTP(ctx context.Context, destination string, file *os.File, name string) error {
+    u, err := url.Parse(destination)
+    if err != nil || u.Host == "" {
+        return errors.New(errors.ErrInternal, "invalid sftp destination").WithContext("destination", destination)
+    }
+
+    timeout := ce.config.SFTP.Timeout
+    if timeout <= 0 {
+        timeout = 5 * time.Minute
+    }
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    args := []string{"-b", "-", "-o", "BatchMode=yes"}
+    if ce.config.SFTP.IdentityFile != "" {
+        args = append(args, "-i", ce.config.SFTP.IdentityFile)
+    }
+    if port := u.Port(); port != "" {
+        args = append(args, "-P", port)
+    }
+    target := u.Hostname()
+    if u.User != nil {
+        target = u.User.Username() + "@" + target
+    }
+    args = append(args, target)
+
+    // Uploaded under a temporary name and renamed, so pollers never pick up half a file
+    remote := path.Join(strings.TrimPrefix(u.Path, "/"), name)
+    batch := fmt.Sprintf("put %q %q\nrename %q %q\n", file.Name(), remote+".part", remote+".part", remote)
+
+    cmd := exec.CommandContext(ctx, "sftp", args...)
+    cmd.Stdin = strings.NewReader(batch)
+    if output, err := cmd.CombinedOutput(); err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "sftp upload failed").
+            WithContext("output", strings.TrimSpace(string(output)))
+    }
+    return nil
+}
+
+// deliverS3 uploads to s3://bucket/prefix
+func (ce *CDRExporter) deliverS3(ctx context.Context, destination string, file *os.File, size int64, name string) error {
+    config := ce.config.S3
+    if config.AccessKey == "" || config.SecretKey == "" {
+        return errors.New(errors.ErrInternal, "s3 exports need router.cdr_export.s3 credentials")
+    }
+    return putS3(ctx, config, destination, name, file, size)
+}
+
+// putS3 uploads a file as name under s3://bucket/prefix with a SigV4 signed PUT
+func putS3(ctx context.Context, config S3Config, destination, name string, file *os.File, size int64) error {
+    hash := sha256.New()
+    if _, err := io.Copy(hash, file); err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "failed to hash upload")
+    }
+    if _, err := file.Seek(0, io.SeekStart); err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "failed to rewind upload")
+    }
+
+    resp, err := doS3(ctx, config, http.MethodPut, destination, name, file, size, hex.EncodeToString(hash.Sum(nil)))
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// doS3 sends a signed request for object name under s3://bucket/prefix,
+// failing unless S3 answers 2xx. The caller closes the response body.
+func doS3(ctx context.Context, config S3Config, method, destination, name string, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+    u, err := url.Parse(destination)
+    if err != nil || u.Host == "" {
+        return nil, errors.New(errors.ErrInternal, "invalid s3 destination").WithContext("destination", destination)
+    }
+    region := config.Region
+    if region == "" {
+        region = "us-east-1"
+    }
+
+    key := path.Join(strings.TrimPrefix(u.Path, "/"), name)
+    endpoint := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", u.Host, region, key)
+    if config.Endpoint != "" {
+        endpoint = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(config.Endpoint, "/"), u.Host, key)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "invalid s3 request")
+    }
+    req.ContentLength = size
+    signS3Request(req, payloadHash, region, config.AccessKey, config.SecretKey, time.Now().UTC())
+
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "s3 request failed")
+    }
+
+    if resp.StatusCode/100 != 2 {
+        defer resp.Body.Close()
+        body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return nil, errors.New(errors.ErrInternal, fmt.Sprintf("s3 answered %s", resp.Status)).
+            WithContext("response", strings.TrimSpace(string(body)))
+    }
+    return resp, nil
+}
+
+// signS3Request adds AWS Signature Version 4 headers to req
+func signS3Request(req *http.Request, payloadHash, region, accessKey, secretKey string, now time.Time) {
+    date := now.Format("20060102")
+    stamp := now.Format("20060102T150405Z")
+
+    req.Header.Set("Host", req.URL.Host)
+    req.Header.Set("X-Amz-Date", stamp)
+    req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+    signed := "host;x-amz-content-sha256;x-amz-date"
+    canonical := strings.Join([]string{
+        req.Method,
+        req.URL.EscapedPath(),
+        req.URL.RawQuery,
+        "host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + stamp + "\n",
+        signed,
+        payloadHash,
+    }, "\n")
+
+    scope := date + "/" + region + "/s3/aws4_request"
+    canonicalHash := sha256.Sum256([]byte(canonical))
+    toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+    key := hmacSHA256([]byte("AWS4"+secretKey), date)
+    key = hmacSHA256(key, region)
+    key = hmacSHA256(key, "s3")
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        accessKey, scope, signed, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
+
+// deliverWebhook posts the file as the request body, failing unless the
+// webhook answers 2xx
+func (ce *CDRExporter) deliverWebhook(ctx context.Context, e *models.CDRExport, file *os.File, size int64, name string) error {
+    timeout := ce.config.Webhook.Timeout
+    if timeout <= 0 {
+        timeout = 2 * time.Minute
+    }
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    var signature string
+    if ce.config.Webhook.Secret != "" {
+        mac := hmac.New(sha256.New, []byte(ce.config.Webhook.Secret))
+        if _, err := io.Copy(mac, file); err != nil {
+            return errors.Wrap(err, errors.ErrInternal, "failed to sign export file")
+        }
+        if _, err := file.Seek(0, io.SeekStart); err != nil {
+            return errors.Wrap(err, errors.ErrInternal, "failed to rewind export file")
+        }
+        signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Destination, file)
+    if err != nil {
+        return errors.New(errors.ErrInternal, "invalid webhook destination").WithContext("destination", e.Destination)
+    }
+    req.ContentLength = size
+    contentType := "text/csv"
+    if e.Format == models.ExportFormatJSON {
+        contentType = "application/json"
+    }
+    req.Header.Set("Content-Type", contentType)
+    req.Header.Set("Content-Disposition", "attachment; filename=\""+name+"\"")
+    req.Header.Set("X-ARA-Export", e.Name)
+    if signature != "" {
+        req.Header.Set("X-ARA-Signature", signature)
+    }
+
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "webhook request failed")
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode/100 != 2 {
+        body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+        return errors.New(errors.ErrInternal, fmt.Sprintf("webhook answered %s", resp.Status)).
+            WithContext("response", strings.TrimSpace(string(body)))
+    }
+    return nil
+}
+
+// deliverEmail sends the file as an attachment to mailto:a@example.com,b@example.com
+func (ce *CDRExporter) deliverEmail(e *models.CDRExport, file *os.File, name string) error {
+    config := ce.config.SMTP
+    if config.Host == "" || config.From == "" {
+        return errors.New(errors.ErrInternal, "email exports need router.cdr_export.smtp host and from")
+    }
+    port := config.Port
+    if port == 0 {
+        port = 587
+    }
+
+    var to []string
+    for _, address := range strings.Split(strings.TrimPrefix(e.Destination, "mailto:"), ",") {
+        if address = strings.TrimSpace(address); address != "" {
+            to = append(to, address)
+        }
+    }
+    if len(to) == 0 {
+        return errors.New(errors.ErrInternal, "mailto destination has no address")
+    }
+
+    var msg bytes.Buffer
+    body := multipart.NewWriter(&msg)
+    fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: Call records %s\r\nMIME-Version: 1.0\r\n",
+        config.From, strings.Join(to, ", "), name)
+    fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", body.Boundary())
+
+    text, _ := body.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+    fmt.Fprintf(text, "Attached are the call records of %s.\r\n", e.Customer)
+
+    contentType := "text/csv"
+    if e.Format == models.ExportFormatJSON {
+        contentType = "application/json"
+    }
+    attachment, _ := body.CreatePart(textproto.MIMEHeader{
+        "Content-Type":              {contentType + "; name=\"" + name + "\""},
+        "Content-Disposition":       {"attachment; filename=\"" + name + "\""},
+        "Content-Transfer-Encoding": {"base64"},
+    })
+    encoder := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: attachment})
+    if _, err := io.Copy(encoder, file); err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "failed to attach export file")
+    }
+    encoder.Close()
+    body.Close()
+
+    var auth smtp.Auth
+    if config.Username != "" {
+        auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+    }
+    addr := net.JoinHostPort(config.Host, strconv.Itoa(port))
+    if err := smtp.SendMail(addr, auth, config.From, to, msg.Bytes()); err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "failed to send export email")
+    }
+    return nil
+}
+
+// lineWrapper breaks base64 output into the 76 character lines mail requires
+type lineWrapper struct {
+    w   io.Writer
+    col int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+    written := 0
+    for len(p) > 0 {
+        n := 76 - l.col
+        if n > len(p) {
+            n = len(p)
+        }
+        if _, err := l.w.Write(p[:n]); err != nil {
+            return written, err
+        }
+        written += n
+        l.col += n
+        p = p[n:]
+        if l.col == 76 {
+            if _, err := l.w.Write([]byte("\r\n")); err != nil {
+                return written, err
+            }
+            l.col = 0
+        }
+    }
+    return written, nil
+}
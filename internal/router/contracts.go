@@ -0,0 +1,414 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// ContractConfig controls provider contract commitment tracking
+type ContractConfig struct {
+    Enabled    bool
+    Interval   time.Duration // how often commitments are checked
+    MinElapsed time.Duration // time into the month before projections can raise alerts
+    WarnDays   int           // days ahead rate expiry and notice deadlines are warned of
+}
+
+func (c *ContractConfig) setDefaults() {
+    if c.Interval <= 0 {
+        c.Interval = time.Hour
+    }
+    if c.MinElapsed <= 0 {
+        c.MinElapsed = 72 * time.Hour
+    }
+    if c.WarnDays <= 0 {
+        c.WarnDays = 14
+    }
+}
+
+// SetContract creates or replaces the contract of a provider
+func (r *Router) SetContract(ctx context.Context, c *models.ProviderContract, user string) error {
+    if c.MinMonthlyMinutes < 0 || c.MaxMonthlyMinutes < 0 || c.MinMonthlySpend < 0 || c.NoticeDays < 0 {
+        return errors.New(errors.ErrInternal, "contract commitments can't be negative")
+    }
+    if c.MaxMonthlyMinutes > 0 && c.MaxMonthlyMinutes < c.MinMonthlyMinutes {
+        return errors.New(errors.ErrInternal, "maximum monthly minutes are below the minimum commitment")
+    }
+    if c.StartDate != nil && c.EndDate != nil && c.EndDate.Before(*c.StartDate) {
+        return errors.New(errors.ErrInternal, "contract ends before it starts")
+    }
+
+    old, err := r.GetContract(ctx, c.ProviderName)
+    if err != nil && errors.GetCode(err) != string(errors.ErrProviderNotFound) {
+        return err
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `
+        INSERT INTO provider_contracts (provider_name, min_monthly_minutes, min_monthly_spend, max_monthly_minutes,
+            rates_valid_until, notice_days, start_date, end_date, notes)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            min_monthly_minutes = VALUES(min_monthly_minutes),
+            min_monthly_spend = VALUES(min_monthly_spend),
+            max_monthly_minutes = VALUES(max_monthly_minutes),
+            rates_valid_until = VALUES(rates_valid_until),
+            notice_days = VALUES(notice_days),
+            start_date = VALUES(start_date),
+            end_date = VALUES(end_date),
+            notes = VALUES(notes)`,
+        c.ProviderName, c.MinMonthlyMinutes, c.MinMonthlySpend, c.MaxMonthlyMinutes,
+        contractDate(c.RatesValidUntil), c.NoticeDays, contractDate(c.StartDate), contractDate(c.EndDate), nullString(c.Notes))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to set contract")
+    }
+
+    action := "update"
+    var oldValue interface{}
+    if old == nil {
+        action = "create"
+    } else {
+        oldValue = old
+    }
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "provider_contract",
+        EntityType: "provider",
+        EntityID:   c.ProviderName,
+        UserID:     user,
+        Action:     action,
+        OldValue:   oldValue,
+        NewValue:   c,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithField("provider", c.ProviderName).Info("Provider contract set")
+    return nil
+}
+
+// GetContract returns the contract of a provider
+func (r *Router) GetContract(ctx context.Context, provider string) (*models.ProviderContract, error) {
+    contracts, err := r.queryContracts(ctx, "WHERE provider_name = ?", provider)
+    if err != nil {
+        return nil, err
+    }
+    if len(contracts) == 0 {
+        return nil, errors.New(errors.ErrProviderNotFound, "provider has no contract").WithContext("provider", provider)
+    }
+    return contracts[0], nil
+}
+
+// ListContracts returns all provider contracts
+func (r *Router) ListContracts(ctx context.Context) ([]*models.ProviderContract, error) {
+    return r.queryContracts(ctx, "")
+}
+
+// DeleteContract stops tracking a provider's contract
+func (r *Router) DeleteContract(ctx context.Context, provider, user string) error {
+    old, err := r.GetContract(ctx, provider)
+    if err != nil {
+        return err
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM provider_contracts WHERE provider_name = ?", provider); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete contract")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "provider_contract",
+        EntityType: "provider",
+        EntityID:   provider,
+        UserID:     user,
+        Action:     "delete",
+        OldValue:   old,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+// ContractStatuses returns this month's usage of every contracted provider
+// against its commitments, with the alerts it raises
+func (r *Router) ContractStatuses(ctx context.Context, now time.Time) ([]*models.ContractStatus, error) {
+    config := r.config.Contracts
+    config.setDefaults()
+
+    contracts, err := r.ListContracts(ctx)
+    if err != nil || len(contracts) == 0 {
+        return nil, err
+    }
+
+    monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+    monthEnd := monthStart.AddDate(0, 1, 0)
+    elapsed := now.Sub(monthStart).Seconds() / monthEnd.Sub(monthStart).Seconds()
+
+    minutes, err := r.providerMinutes(ctx, monthStart, now)
+    if err != nil {
+        return nil, err
+    }
+
+    rates := make(map[string]float64)
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT p.name, p.cost_per_minute, COALESCE(p.currency, '')
+        FROM providers p
+        JOIN provider_contracts c ON c.provider_name = p.name`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query provider rates")
+    }
+    for rows.Next() {
+        var name, currency string
+        var rate float64
+        if err := rows.Scan(&name, &rate, &currency); err != nil {
+            continue
+        }
+        rates[name] = r.fx.Convert(ctx, rate, currency)
+    }
+    rows.Close()
+
+    statuses := make([]*models.ContractStatus, 0, len(contracts))
+    for _, c := range contracts {
+        s := &models.ContractStatus{
+            Contract: c,
+            Month:    monthStart.Format("2006-01"),
+            Elapsed:  elapsed,
+            Minutes:  minutes[c.ProviderName],
+            Currency: r.fx.Currency(),
+        }
+        s.Spend = s.Minutes * rates[c.ProviderName]
+        if elapsed > 0 {
+            s.ProjectedMinutes = s.Minutes / elapsed
+            s.ProjectedSpend = s.Spend / elapsed
+        }
+        s.Alerts = contractAlerts(s, now, now.Sub(monthStart) >= config.MinElapsed, config.WarnDays)
+        statuses = append(statuses, s)
+    }
+    return statuses, nil
+}
+
+// providerMinutes sums the billable production minutes of each provider's leg
+func (r *Router) providerMinutes(ctx context.Context, since, until time.Time) (map[string]float64, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT provider, COALESCE(SUM(seconds), 0) / 60
+        FROM (
+            SELECT inbound_provider AS provider, billable_duration AS seconds
+            FROM call_records WHERE start_time >= ? AND start_time < ? AND COALESCE(is_test, 0) = 0
+            UNION ALL
+            SELECT intermediate_provider, intermediate_billable_duration
+            FROM call_records WHERE start_time >= ? AND start_time < ? AND COALESCE(is_test, 0) = 0
+            UNION ALL
+            SELECT final_provider, final_billable_duration
+            FROM call_records WHERE start_time >= ? AND start_time < ? AND COALESCE(is_test, 0) = 0
+        ) legs
+        WHERE provider IS NOT NULL AND provider IN (SELECT provider_name FROM provider_contracts)
+        GROUP BY provider`,
+        since, until, since, until, since, until)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query provider minutes")
+    }
+    defer rows.Close()
+
+    minutes := make(map[string]float64)
+    for rows.Next() {
+        var provider string
+        var m float64
+        if err := rows.Scan(&provider, &m); err != nil {
+            continue
+        }
+        minutes[provider] = m
+    }
+    return minutes, rows.Err()
+}
+
+// contractAlerts checks a status against its contract. Projections only count
+// once enough of the month has gone to extrapolate from.
+func contractAlerts(s *models.ContractStatus, now time.Time, project bool, warnDays int) []models.ContractAlert {
+    c := s.Contract
+    var alerts []models.ContractAlert
+    add := func(kind, format string, args ...interface{}) {
+        alerts = append(alerts, models.ContractAlert{Kind: kind, Message: fmt.Sprintf(format, args...)})
+    }
+
+    if project && c.MinMonthlyMinutes > 0 && s.ProjectedMinutes < float64(c.MinMonthlyMinutes) {
+        add(models.ContractAlertMinutesShortfall, "projected %.0f of %d committed minutes", s.ProjectedMinutes, c.MinMonthlyMinutes)
+    }
+    if project && c.MinMonthlySpend > 0 && s.ProjectedSpend < c.MinMonthlySpend {
+        add(models.ContractAlertSpendShortfall, "projected %.2f of %.2f %s committed spend", s.ProjectedSpend, c.MinMonthlySpend, s.Currency)
+    }
+    if c.MaxMonthlyMinutes > 0 && (s.Minutes > float64(c.MaxMonthlyMinutes) || project && s.ProjectedMinutes > float64(c.MaxMonthlyMinutes)) {
+        add(models.ContractAlertMinutesExceeded, "projected %.0f minutes, over the %d minute ceiling", s.ProjectedMinutes, c.MaxMonthlyMinutes)
+    }
+
+    today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+    daysUntil := func(d time.Time) int {
+        return int(time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC).Sub(today).Hours() / 24)
+    }
+
+    if c.RatesValidUntil != nil {
+        ahead := warnDays
+        if c.NoticeDays > ahead {
+            ahead = c.NoticeDays
+        }
+        switch days := daysUntil(*c.RatesValidUntil); {
+        case days < 0:
+            add(models.ContractAlertRatesExpired, "rates expired on %s", c.RatesValidUntil.Format("2006-01-02"))
+        case days <= ahead:
+            add(models.ContractAlertRatesExpiring, "rates expire in %d days, on %s", days, c.RatesValidUntil.Format("2006-01-02"))
+        }
+    }
+
+    if c.EndDate != nil {
+        deadline := c.EndDate.AddDate(0, 0, -c.NoticeDays)
+        switch days := daysUntil(deadline); {
+        case days < 0 && daysUntil(*c.EndDate) >= 0:
+            add(models.ContractAlertNoticeDeadline, "notice deadline passed on %s, contract ends %s",
+                deadline.Format("2006-01-02"), c.EndDate.Format("2006-01-02"))
+        case days >= 0 && days <= warnDays:
+            add(models.ContractAlertNoticeDeadline, "notice must be given within %d days, by %s", days, deadline.Format("2006-01-02"))
+        }
+    }
+    return alerts
+}
+
+// RunContractChecks alerts on contract commitments until the context ends
+func (r *Router) RunContractChecks(ctx context.Context) {
+    config := r.config.Contracts
+    config.setDefaults()
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    // Alerts already raised, each is logged once until it clears
+    raised := make(map[string]bool)
+    for {
+        r.runContractChecks(ctx, raised)
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (r *Router) runContractChecks(ctx context.Context, raised map[string]bool) {
+    log := logger.WithContext(ctx)
+
+    // Every instance exports the gauges, one alerts
+    statuses, err := r.ContractStatuses(ctx, time.Now())
+    if err != nil {
+        log.WithError(err).Warn("Contract check failed")
+        return
+    }
+    unlock, lockErr := r.cache.Lock(ctx, "contracts:alert", 5*time.Minute)
+    if lockErr == nil {
+        defer unlock()
+    }
+
+    active := make(map[string]bool)
+    for _, s := range statuses {
+        provider := s.Contract.ProviderName
+        r.metrics.SetGauge("router_contract_projected_minutes", s.ProjectedMinutes, map[string]string{"provider": provider})
+        r.metrics.SetGauge("router_contract_projected_spend", s.ProjectedSpend, map[string]string{"provider": provider})
+
+        kinds := make(map[string]bool)
+        for _, a := range s.Alerts {
+            kinds[a.Kind] = true
+            key := provider + "\x00" + a.Kind
+            active[key] = true
+            if raised[key] || lockErr != nil {
+                continue
+            }
+            raised[key] = true
+            log.WithFields(map[string]interface{}{
+                "provider": provider,
+                "kind":     a.Kind,
+                "month":    s.Month,
+            }).Error("ALERT: provider contract " + a.Message)
+        }
+        for _, kind := range models.ContractAlertKinds {
+            value := 0.0
+            if kinds[kind] {
+                value = 1
+            }
+            r.metrics.SetGauge("router_contract_alert", value, map[string]string{"provider": provider, "kind": kind})
+        }
+    }
+
+    for key := range raised {
+        if !active[key] {
+            delete(raised, key)
+        }
+    }
+}
+
+func (r *Router) queryContracts(ctx context.Context, where string, args ...interface{}) ([]*models.ProviderContract, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT provider_name, min_monthly_minutes, min_monthly_spend, max_monthly_minutes,
+               rates_valid_until, notice_days, start_date, end_date, COALESCE(notes, ''), updated_at
+        FROM provider_contracts
+        `+where, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query contracts")
+    }
+    defer rows.Close()
+
+    var contracts []*models.ProviderContract
+    for rows.Next() {
+        var c models.ProviderContract
+        var ratesUntil, start, end sql.NullTime
+        if err := rows.Scan(&c.ProviderName, &c.MinMonthlyMinutes, &c.MinMonthlySpend, &c.MaxMonthlyMinutes,
+            &ratesUntil, &c.NoticeDays, &start, &end, &c.Notes, &c.UpdatedAt); err != nil {
+            continue
+        }
+        if ratesUntil.Valid {
+            c.RatesValidUntil = &ratesUntil.Time
+        }
+        if start.Valid {
+            c.StartDate = &start.Time
+        }
+        if end.Valid {
+            c.EndDate = &end.Time
+        }
+        contracts = append(contracts, &c)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    sort.Slice(contracts, func(i, j int) bool { return contracts[i].ProviderName < contracts[j].ProviderName })
+    return contracts, nil
+}
+
+// contractDate stores a contract date as a DATE, nil for none
+func contractDate(t *time.Time) interface{} {
+    if t == nil {
+        return nil
+    }
+    return t.Format("2006-01-02")
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/binary"
+    "fmt"
+    "strings"
+)
+
+// Correlation token transport modes
+const (
+    CorrelationModeHeader     = "header"
+    CorrelationModeDNISSuffix = "dnis_suffix"
+)
+
+// CorrelationConfig controls signed DID correlation tokens
+type CorrelationConfig struct {
+    Enabled bool
+    Secret  string
+    Mode    string // header or dnis_suffix
+    Length  int    // number of digits in the token
+}
+
+// CorrelationSigner generates and verifies HMAC tokens binding a DID to a call
+type CorrelationSigner struct {
+    config CorrelationConfig
+}
+
+// NewCorrelationSigner creates a new signer
+func NewCorrelationSigner(config CorrelationConfig) *CorrelationSigner {
+    if config.Mode == "" {
+        config.Mode = CorrelationModeHeader
+    }
+    if config.Length <= 0 || config.Length > 18 {
+        config.Length = 6
+    }
+    if config.Secret == "" {
+        config.Enabled = false
+    }
+
+    return &CorrelationSigner{config: config}
+}
+
+// Enabled reports whether tokens are generated and checked, return legs
+// carrying no token are then rejected
+func (cs *CorrelationSigner) Enabled() bool {
+    return cs.config.Enabled
+}
+
+// Mode returns the configured token transport mode
+func (cs *CorrelationSigner) Mode() string {
+    return cs.config.Mode
+}
+
+// Sign returns a numeric token so it can travel as a DNIS suffix as well as a header
+func (cs *CorrelationSigner) Sign(callID, did string) string {
+    mac := hmac.New(sha256.New, []byte(cs.config.Secret))
+    mac.Write([]byte(callID))
+    mac.Write([]byte{0})
+    mac.Write([]byte(did))
+    sum := mac.Sum(nil)
+
+    modulus := uint64(1)
+    for i := 0; i < cs.config.Length; i++ {
+        modulus *= 10
+    }
+
+    return fmt.Sprintf("%0*d", cs.config.Length, binary.BigEndian.Uint64(sum[:8])%modulus)
+}
+
+// Verify checks a token in constant time
+func (cs *CorrelationSigner) Verify(callID, did, token string) bool {
+    return hmac.Equal([]byte(cs.Sign(callID, did)), []byte(token))
+}
+
+// SplitDNIS separates the DID from a token appended as DNIS suffix
+func (cs *CorrelationSigner) SplitDNIS(dnis string) (string, string) {
+    if !cs.config.Enabled || cs.config.Mode != CorrelationModeDNISSuffix || len(dnis) <= cs.config.Length {
+        return dnis, ""
+    }
+
+    return dnis[:len(dnis)-cs.config.Length], dnis[len(dnis)-cs.config.Length:]
+}
+
+// AppendToDNIS appends the token to the DID when running in dnis_suffix mode
+func (cs *CorrelationSigner) AppendToDNIS(did, token string) string {
+    if cs.config.Mode != CorrelationModeDNISSuffix {
+        return did
+    }
+    return did + strings.TrimSpace(token)
+}
@@ -0,0 +1,526 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "math"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// CostCeilingConfig controls the evaluation of route cost ceilings
+type CostCeilingConfig struct {
+    Enabled  bool
+    Interval time.Duration // how often blended costs are evaluated and shifts applied
+    Window   time.Duration // traffic the blended cost and provider quality are measured over
+    Step     float64       // percent of weight moved, or given back, per evaluation
+    Margin   float64       // percent under the ceiling the blended cost must fall before weight is given back
+    MinCalls int           // calls a provider needs in the window for its quality to be judged
+}
+
+func (c *CostCeilingConfig) setDefaults() {
+    if c.Interval <= 0 {
+        c.Interval = 5 * time.Minute
+    }
+    if c.Window <= 0 {
+        c.Window = time.Hour
+    }
+    if c.Step <= 0 {
+        c.Step = 10
+    }
+    if c.Margin < 0 {
+        c.Margin = 0
+    }
+}
+
+// costShift is the weight a route moves off its providers over the ceiling
+type costShift struct {
+    share     float64         // part of their weight moved, 0 to 1
+    expensive map[string]bool // over the ceiling
+    cheaper   map[string]bool // under it and within its quality limits
+}
+
+// costShifts are the shifts in force, by route
+type costShifts map[string]*costShift
+
+// legQuality is how a provider did on the legs it carried from S2
+type legQuality struct {
+    calls    int64
+    answered int64
+    pddSum   float64
+    pddCount int64
+}
+
+// SetCostCeiling creates or replaces the cost ceiling of a route. A shift
+// already in force is kept and evaluated against the new ceiling.
+func (r *Router) SetCostCeiling(ctx context.Context, c *models.CostCeiling, user string) error {
+    if c.MaxCost <= 0 {
+        return errors.New(errors.ErrInternal, "cost ceiling must be positive")
+    }
+    if c.MinASR < 0 || c.MinASR > 100 {
+        return errors.New(errors.ErrInternal, "minimum ASR must be between 0 and 100")
+    }
+    if c.MaxPDDMs < 0 {
+        return errors.New(errors.ErrInternal, "maximum PDD can't be negative")
+    }
+    c.Currency = strings.ToUpper(c.Currency)
+    if c.Currency != "" && len(c.Currency) != 3 {
+        return errors.New(errors.ErrInternal, "currency must be a 3 letter ISO 4217 code").
+            WithContext("currency", c.Currency)
+    }
+
+    if _, err := r.GetRoute(ctx, c.RouteName); err != nil {
+        return err
+    }
+
+    var old interface{}
+    if ceilings, err := r.queryCostCeilings(ctx, "WHERE route_name = ?", c.RouteName); err != nil {
+        return err
+    } else if len(ceilings) > 0 {
+        old = ceilings[0]
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `
+        INSERT INTO route_cost_ceilings (route_name, max_cost, currency, min_asr, max_pdd_ms)
+        VALUES (?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE max_cost = VALUES(max_cost), currency = VALUES(currency),
+            min_asr = VALUES(min_asr), max_pdd_ms = VALUES(max_pdd_ms)`,
+        c.RouteName, c.MaxCost, nullString(c.Currency), c.MinASR, c.MaxPDDMs)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to set cost ceiling")
+    }
+
+    action := "update"
+    if old == nil {
+        action = "create"
+    }
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "route_cost_ceiling",
+        EntityType: "route",
+        EntityID:   c.RouteName,
+        UserID:     user,
+        Action:     action,
+        OldValue:   old,
+        NewValue:   c,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "route":    c.RouteName,
+        "max_cost": c.MaxCost,
+    }).Info("Route cost ceiling set")
+    return nil
+}
+
+// ListCostCeilings returns the cost ceiling of a route, or of every route when
+// route is empty
+func (r *Router) ListCostCeilings(ctx context.Context, route string) ([]*models.CostCeiling, error) {
+    if route == "" {
+        return r.queryCostCeilings(ctx, "")
+    }
+    return r.queryCostCeilings(ctx, "WHERE route_name = ?", route)
+}
+
+// DeleteCostCeiling removes the cost ceiling of a route, whose providers get
+// their weight back at the next evaluation
+func (r *Router) DeleteCostCeiling(ctx context.Context, route, user string) error {
+    ceilings, err := r.queryCostCeilings(ctx, "WHERE route_name = ?", route)
+    if err != nil {
+        return err
+    }
+    if len(ceilings) == 0 {
+        return errors.New(errors.ErrRouteNotFound, "route has no cost ceiling").WithContext("route", route)
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM route_cost_ceilings WHERE route_name = ?", route); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete cost ceiling")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "route_cost_ceiling",
+        EntityType: "route",
+        EntityID:   route,
+        UserID:     user,
+        Action:     "delete",
+        OldValue:   ceilings[0],
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+// RunCostCeilings evaluates the cost ceilings of routes until the context
+// ends. One node an interval steps the shifts, which every node applies.
+func (r *Router) RunCostCeilings(ctx context.Context) {
+    config := r.config.CostCeilings
+    config.setDefaults()
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    for {
+        r.applyCostCeilings(ctx, config, time.Now())
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (r *Router) applyCostCeilings(ctx context.Context, config CostCeilingConfig, now time.Time) {
+    log := logger.WithContext(ctx)
+
+    ceilings, err := r.ListCostCeilings(ctx, "")
+    if err != nil {
+        log.WithError(err).Warn("Failed to load route cost ceilings")
+        return
+    }
+    if len(ceilings) == 0 {
+        r.costShifts.Store(nil)
+        return
+    }
+
+    rates, err := r.providerRates(ctx)
+    if err != nil {
+        log.WithError(err).Warn("Failed to load provider rates for cost ceilings")
+        return
+    }
+    minutes, quality, err := r.costCeilingTraffic(ctx, now.Add(-config.Window), now)
+    if err != nil {
+        log.WithError(err).Warn("Failed to measure traffic for cost ceilings")
+        return
+    }
+
+    // The lock is left to expire, so the shifts step once an interval
+    // whichever nodes run the evaluation
+    _, lockErr := r.cache.Lock(ctx, "cost_ceilings:evaluate", config.Interval*9/10)
+    evaluate := lockErr == nil
+
+    shifts := make(costShifts)
+    for _, c := range ceilings {
+        ceiling := r.fx.Convert(ctx, c.MaxCost, c.Currency)
+
+        shift := &costShift{expensive: make(map[string]bool), cheaper: make(map[string]bool)}
+        if route, err := r.GetRoute(ctx, c.RouteName); err == nil {
+            for _, p := range r.routeCandidates(ctx, route) {
+                switch {
+                case rates[p.Name] > ceiling:
+                    shift.expensive[p.Name] = true
+                case costCeilingQualityMet(c, quality[p.Name], config.MinCalls):
+                    shift.cheaper[p.Name] = true
+                }
+            }
+        }
+
+        if evaluate {
+            if err := r.evaluateCostCeiling(ctx, config, c, ceiling, minutes[c.RouteName], rates, shift, now); err != nil {
+                log.WithError(err).WithField("route", c.RouteName).Warn("Failed to evaluate route cost ceiling")
+            }
+        }
+
+        if c.Shift > 0 {
+            shift.share = c.Shift / 100
+            shifts[c.RouteName] = shift
+        }
+    }
+    r.costShifts.Store(&shifts)
+}
+
+// evaluateCostCeiling steps the shift of a route by its blended cost and
+// stores it, the route keeps its shift while it has no traffic
+func (r *Router) evaluateCostCeiling(ctx context.Context, config CostCeilingConfig, c *models.CostCeiling, ceiling float64,
+    legs map[string]float64, rates map[string]float64, shift *costShift, now time.Time) error {
+    var minutes, cost float64
+    for provider, m := range legs {
+        minutes += m
+        cost += m * rates[provider]
+    }
+
+    from := c.Shift
+    var blended *float64
+    if minutes > 0 {
+        b := cost / minutes
+        blended = &b
+
+        switch {
+        case b > ceiling && len(shift.cheaper) == 0:
+            logger.WithContext(ctx).WithFields(map[string]interface{}{
+                "route":        c.RouteName,
+                "blended_cost": b,
+                "max_cost":     ceiling,
+            }).Warn("Route over its cost ceiling with no cheaper provider within its quality limits")
+        case b > ceiling && len(shift.expensive) > 0:
+            c.Shift = math.Min(100, c.Shift+config.Step)
+        case b < ceiling*(1-config.Margin/100):
+            c.Shift = math.Max(0, c.Shift-config.Step)
+        }
+    }
+
+    _, err := r.db.ExecContext(ctx, `
+        UPDATE route_cost_ceilings
+        SET shift = ?, blended_cost = ?, evaluated_at = ?, updated_at = updated_at
+        WHERE route_name = ?`,
+        c.Shift, blended, now, c.RouteName)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to store cost ceiling shift")
+    }
+    c.BlendedCost, c.EvaluatedAt = blended, &now
+
+    labels := map[string]string{"route": c.RouteName}
+    r.metrics.SetGauge("router_cost_ceiling_shift", c.Shift, labels)
+    if blended != nil {
+        r.metrics.SetGauge("router_route_blended_cost", *blended, labels)
+    }
+
+    if c.Shift == from {
+        return nil
+    }
+
+    fields := map[string]interface{}{
+        "route":      c.RouteName,
+        "max_cost":   ceiling,
+        "shift_from": from,
+        "shift_to":   c.Shift,
+        "over":       sortedNames(shift.expensive),
+        "cheaper":    sortedNames(shift.cheaper),
+    }
+    if blended != nil {
+        fields["blended_cost"] = *blended
+    }
+    logger.WithContext(ctx).WithFields(fields).Info("Route cost ceiling weight shift adjusted")
+
+    return audit.Record(ctx, r.db, audit.Entry{
+        EventType:  "route_cost_ceiling",
+        EntityType: "route",
+        EntityID:   c.RouteName,
+        UserID:     audit.SystemActor,
+        Action:     "adjust",
+        OldValue:   map[string]interface{}{"shift": from},
+        NewValue:   fields,
+    })
+}
+
+// costCeilingTraffic measures the minutes of each provider on each route and
+// the quality of each provider from start to end, over the legs from S2
+func (r *Router) costCeilingTraffic(ctx context.Context, start, end time.Time) (map[string]map[string]float64, map[string]*legQuality, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT COALESCE(route_name, ''), provider, COUNT(*), COALESCE(SUM(answered), 0),
+               COALESCE(SUM(CASE WHEN answered THEN pdd END), 0), COUNT(CASE WHEN answered THEN pdd END),
+               COALESCE(SUM(seconds), 0) / 60
+        FROM (
+            SELECT route_name, intermediate_provider AS provider, answer_time IS NOT NULL AS answered,
+                   answer_delay_ms AS pdd, intermediate_billable_duration AS seconds
+            FROM call_records
+            WHERE start_time >= ? AND start_time < ? AND COALESCE(is_test, 0) = 0
+              AND COALESCE(intermediate_provider, '') <> ''
+            UNION ALL
+            SELECT route_name, final_provider, answer_time IS NOT NULL, answer_delay_ms, final_billable_duration
+            FROM call_records
+            WHERE start_time >= ? AND start_time < ? AND COALESCE(is_test, 0) = 0
+              AND COALESCE(final_provider, '') <> ''
+        ) legs
+        GROUP BY route_name, provider`,
+        start, end, start, end)
+    if err != nil {
+        return nil, nil, errors.Wrap(err, errors.ErrDatabase, "failed to query route traffic")
+    }
+    defer rows.Close()
+
+    minutes := make(map[string]map[string]float64)
+    quality := make(map[string]*legQuality)
+    for rows.Next() {
+        var route, provider string
+        var leg legQuality
+        var m float64
+        if err := rows.Scan(&route, &provider, &leg.calls, &leg.answered, &leg.pddSum, &leg.pddCount, &m); err != nil {
+            return nil, nil, errors.Wrap(err, errors.ErrDatabase, "failed to scan route traffic")
+        }
+        if minutes[route] == nil {
+            minutes[route] = make(map[string]float64)
+        }
+        minutes[route][provider] += m
+
+        q := quality[provider]
+        if q == nil {
+            q = &legQuality{}
+            quality[provider] = q
+        }
+        q.calls += leg.calls
+        q.answered += leg.answered
+        q.pddSum += leg.pddSum
+        q.pddCount += leg.pddCount
+    }
+    if err := rows.Err(); err != nil {
+        return nil, nil, errors.Wrap(err, errors.ErrDatabase, "failed to read route traffic")
+    }
+    return minutes, quality, nil
+}
+
+// costCeilingQualityMet reports whether a provider may take weight under the
+// ceiling. Providers with too few calls to judge may, so new ones get tried.
+func costCeilingQualityMet(c *models.CostCeiling, q *legQuality, minCalls int) bool {
+    if q == nil || q.calls < int64(minCalls) || q.calls == 0 {
+        return true
+    }
+    if c.MinASR > 0 && float64(q.answered)/float64(q.calls)*100 < c.MinASR {
+        return false
+    }
+    if c.MaxPDDMs > 0 && q.pddCount > 0 && q.pddSum/float64(q.pddCount) > float64(c.MaxPDDMs) {
+        return false
+    }
+    return true
+}
+
+// providerRates returns the per minute rate of every provider, in the
+// reporting currency
+func (r *Router) providerRates(ctx context.Context) (map[string]float64, error) {
+    rows, err := r.db.QueryContext(ctx, "SELECT name, cost_per_minute, COALESCE(currency, '') FROM providers")
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query provider rates")
+    }
+    defer rows.Close()
+
+    rates := make(map[string]float64)
+    for rows.Next() {
+        var name, currency string
+        var rate float64
+        if err := rows.Scan(&name, &rate, &currency); err != nil {
+            continue
+        }
+        rates[name] = r.fx.Convert(ctx, rate, currency)
+    }
+    return rates, rows.Err()
+}
+
+// routeCostShift returns the cost ceiling shift in force on a route, nil when
+// it has none
+func (r *Router) routeCostShift(route string) *costShift {
+    shifts := r.costShifts.Load()
+    if shifts == nil {
+        return nil
+    }
+    return (*shifts)[route]
+}
+
+// applyCostShift moves the share of the weight of the providers over the
+// ceiling to the cheaper ones, in proportion to their weight. Providers over
+// it keep a weight of 1 to stay reachable, and nothing moves when none of the
+// providers is cheaper. Providers are copied, the cached ones are shared.
+func applyCostShift(providers []*models.Provider, shift *costShift) []*models.Provider {
+    if shift == nil || shift.share <= 0 {
+        return providers
+    }
+
+    cheaperWeight, cheaperCount := 0, 0
+    for _, p := range providers {
+        if shift.cheaper[p.Name] {
+            cheaperWeight += p.Weight
+            cheaperCount++
+        }
+    }
+    if cheaperCount == 0 {
+        return providers
+    }
+
+    result := make([]*models.Provider, len(providers))
+    moved := 0
+    for i, p := range providers {
+        result[i] = p
+        if !shift.expensive[p.Name] || p.Weight <= 1 {
+            continue
+        }
+        keep := int(math.Round(float64(p.Weight) * (1 - shift.share)))
+        if keep < 1 {
+            keep = 1
+        }
+        moved += p.Weight - keep
+        copied := *p
+        copied.Weight = keep
+        result[i] = &copied
+    }
+    if moved == 0 {
+        return providers
+    }
+
+    for i, p := range result {
+        if !shift.cheaper[p.Name] {
+            continue
+        }
+        share := float64(moved) / float64(cheaperCount)
+        if cheaperWeight > 0 {
+            share = float64(moved) * float64(p.Weight) / float64(cheaperWeight)
+        }
+        copied := *p
+        copied.Weight += int(math.Round(share))
+        result[i] = &copied
+    }
+    return result
+}
+
+func (r *Router) queryCostCeilings(ctx context.Context, where string, args ...interface{}) ([]*models.CostCeiling, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT route_name, max_cost, COALESCE(currency, ''), min_asr, max_pdd_ms, shift,
+               blended_cost, evaluated_at, updated_at
+        FROM route_cost_ceilings
+        `+where+`
+        ORDER BY route_name`, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query cost ceilings")
+    }
+    defer rows.Close()
+
+    var ceilings []*models.CostCeiling
+    for rows.Next() {
+        var c models.CostCeiling
+        var blended sql.NullFloat64
+        var evaluated sql.NullTime
+        if err := rows.Scan(&c.RouteName, &c.MaxCost, &c.Currency, &c.MinASR, &c.MaxPDDMs, &c.Shift,
+            &blended, &evaluated, &c.UpdatedAt); err != nil {
+            continue
+        }
+        c.BlendedCost = nullFloat(blended)
+        if evaluated.Valid {
+            c.EvaluatedAt = &evaluated.Time
+        }
+        ceilings = append(ceilings, &c)
+    }
+    return ceilings, rows.Err()
+}
+
+func sortedNames(set map[string]bool) []string {
+    names := make([]string, 0, len(set))
+    for name := range set {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
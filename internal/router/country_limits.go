@@ -0,0 +1,373 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "sort"
+    "sync"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// CountryLimitConfig controls per destination country call tracking
+type CountryLimitConfig struct {
+    Enforce         bool          // reject calls over provider_country_limits
+    CPSWindow       time.Duration // window the calls per second are averaged over
+    RefreshInterval time.Duration // reload of limits and gauge publishing
+}
+
+// CountryTracker counts concurrent calls and call attempts per destination
+// country, overall and per provider, and enforces provider country limits.
+// Counts are per router instance like the load balancer active calls.
+type CountryTracker struct {
+    db      *sql.DB
+    metrics MetricsInterface
+    config  CountryLimitConfig
+    
+    mu        sync.Mutex
+    calls     map[string]*countryReservation // by call ID
+    active    map[string]int                 // by country
+    providers map[string]int                 // by provider and country
+    starts    map[string][]time.Time         // call starts by country and by provider and country
+    limits    map[string]*models.ProviderCountryLimit
+}
+
+type countryReservation struct {
+    country   string
+    providers []string
+}
+
+// NewCountryTracker creates a tracker and starts its refresh routine
+func NewCountryTracker(db *sql.DB, metrics MetricsInterface, config CountryLimitConfig) *CountryTracker {
+    if config.CPSWindow <= 0 {
+        config.CPSWindow = 10 * time.Second
+    }
+    if config.RefreshInterval <= 0 {
+        config.RefreshInterval = 15 * time.Second
+    }
+    
+    ct := &CountryTracker{
+        db:        db,
+        metrics:   metrics,
+        config:    config,
+        calls:     make(map[string]*countryReservation),
+        active:    make(map[string]int),
+        providers: make(map[string]int),
+        starts:    make(map[string][]time.Time),
+        limits:    make(map[string]*models.ProviderCountryLimit),
+    }
+    
+    go ct.refreshRoutine()
+    
+    return ct
+}
+
+func providerCountryKey(provider, country string) string {
+    return provider + "|" + country
+}
+
+// Allows reports whether the provider may take another call to the country
+func (ct *CountryTracker) Allows(provider, country string) bool {
+    if !ct.config.Enforce {
+        return true
+    }
+    
+    ct.mu.Lock()
+    defer ct.mu.Unlock()
+    
+    return ct.allowsLocked(provider, country, time.Now()) == ""
+}
+
+// allowsLocked returns the exceeded limit, empty when the call fits
+func (ct *CountryTracker) allowsLocked(provider, country string, now time.Time) string {
+    key := providerCountryKey(provider, country)
+    limit, exists := ct.limits[key]
+    if !exists {
+        return ""
+    }
+    
+    if limit.MaxConcurrent > 0 && ct.providers[key] >= limit.MaxConcurrent {
+        return "max_concurrent"
+    }
+    
+    // CPS caps are enforced over the last second
+    if limit.MaxCPS > 0 {
+        count := 0
+        cutoff := now.Add(-time.Second)
+        for _, t := range ct.starts[key] {
+            if t.After(cutoff) {
+                count++
+            }
+        }
+        if float64(count) >= limit.MaxCPS {
+            return "max_cps"
+        }
+    }
+    
+    return ""
+}
+
+// Reserve counts a new call to the destination country on the given providers.
+// With enforcement on it fails when any provider is at its country limit.
+// Empty names are skipped, a pass-through call has no intermediate.
+func (ct *CountryTracker) Reserve(callID, country string, providers ...string) error {
+    now := time.Now()
+    providers = namedProviders(providers)
+    
+    ct.mu.Lock()
+    
+    if ct.config.Enforce {
+        for _, provider := range providers {
+            if exceeded := ct.allowsLocked(provider, country, now); exceeded != "" {
+                ct.mu.Unlock()
+                return errors.New(errors.ErrQuotaExceeded, "provider at country limit").
+                    WithContext("provider", provider).
+                    WithContext("country", country).
+                    WithContext("limit", exceeded)
+            }
+        }
+    }
+    
+    ct.calls[callID] = &countryReservation{country: country, providers: providers}
+    ct.active[country]++
+    ct.recordStartLocked(country, now)
+    for _, provider := range providers {
+        key := providerCountryKey(provider, country)
+        ct.providers[key]++
+        ct.recordStartLocked(key, now)
+    }
+    active := ct.active[country]
+    
+    ct.mu.Unlock()
+    
+    labels := map[string]string{"country": country}
+    ct.metrics.IncrementCounter("router_country_calls", labels)
+    ct.metrics.SetGauge("router_country_active_calls", float64(active), labels)
+    
+    return nil
+}
+
+func (ct *CountryTracker) recordStartLocked(key string, now time.Time) {
+    cutoff := now.Add(-ct.config.CPSWindow)
+    recent := ct.starts[key][:0]
+    for _, t := range ct.starts[key] {
+        if t.After(cutoff) {
+            recent = append(recent, t)
+        }
+    }
+    ct.starts[key] = append(recent, now)
+}
+
+// Release ends the call, it is a no-op for calls that were never reserved
+func (ct *CountryTracker) Release(callID string) {
+    ct.mu.Lock()
+    reservation, exists := ct.calls[callID]
+    if !exists {
+        ct.mu.Unlock()
+        return
+    }
+    delete(ct.calls, callID)
+    
+    if ct.active[reservation.country]--; ct.active[reservation.country] <= 0 {
+        ct.active[reservation.country] = 0
+    }
+    for _, provider := range reservation.providers {
+        key := providerCountryKey(provider, reservation.country)
+        if ct.providers[key]--; ct.providers[key] <= 0 {
+            delete(ct.providers, key)
+        }
+    }
+    active := ct.active[reservation.country]
+    ct.mu.Unlock()
+    
+    ct.metrics.SetGauge("router_country_active_calls", float64(active), map[string]string{
+        "country": reservation.country,
+    })
+}
+
+// Stats returns concurrent calls and CPS per destination country
+func (ct *CountryTracker) Stats() []*models.CountryCallStats {
+    now := time.Now()
+    cutoff := now.Add(-ct.config.CPSWindow)
+    
+    ct.mu.Lock()
+    defer ct.mu.Unlock()
+    
+    stats := make([]*models.CountryCallStats, 0, len(ct.active))
+    for country, active := range ct.active {
+        recent := 0
+        for _, t := range ct.starts[country] {
+            if t.After(cutoff) {
+                recent++
+            }
+        }
+        if active == 0 && recent == 0 {
+            continue
+        }
+        stats = append(stats, &models.CountryCallStats{
+            Country:     country,
+            ActiveCalls: active,
+            CPS:         float64(recent) / ct.config.CPSWindow.Seconds(),
+        })
+    }
+    
+    sort.Slice(stats, func(i, j int) bool {
+        if stats[i].ActiveCalls != stats[j].ActiveCalls {
+            return stats[i].ActiveCalls > stats[j].ActiveCalls
+        }
+        return stats[i].Country < stats[j].Country
+    })
+    
+    return stats
+}
+
+// SetLimit creates or updates the limit of a provider for a country
+func (ct *CountryTracker) SetLimit(ctx context.Context, limit *models.ProviderCountryLimit) error {
+    if !numbering.IsCountryCode(limit.CountryCode) {
+        return errors.New(errors.ErrInternal, "country must be an ISO 3166 alpha-2 code").
+            WithContext("country", limit.CountryCode)
+    }
+    
+    _, err := ct.db.ExecContext(ctx, `
+        INSERT INTO provider_country_limits (provider_name, country_code, max_concurrent, max_cps)
+        VALUES (?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            max_concurrent = VALUES(max_concurrent),
+            max_cps = VALUES(max_cps),
+            updated_at = NOW()`,
+        limit.ProviderName, limit.CountryCode, limit.MaxConcurrent, limit.MaxCPS)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to store country limit")
+    }
+    
+    ct.refresh(ctx)
+    return nil
+}
+
+// DeleteLimit removes the limit of a provider for a country
+func (ct *CountryTracker) DeleteLimit(ctx context.Context, providerName, countryCode string) error {
+    result, err := ct.db.ExecContext(ctx,
+        "DELETE FROM provider_country_limits WHERE provider_name = ? AND country_code = ?",
+        providerName, countryCode)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete country limit")
+    }
+    
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return errors.New(errors.ErrProviderNotFound, "country limit not found").
+            WithContext("provider", providerName).
+            WithContext("country", countryCode)
+    }
+    
+    ct.refresh(ctx)
+    return nil
+}
+
+// ListLimits returns the configured limits, optionally for one provider
+func (ct *CountryTracker) ListLimits(ctx context.Context, providerName string) ([]*models.ProviderCountryLimit, error) {
+    query := `
+        SELECT provider_name, country_code, max_concurrent, max_cps
+        FROM provider_country_limits`
+    var args []interface{}
+    if providerName != "" {
+        query += " WHERE provider_name = ?"
+        args = append(args, providerName)
+    }
+    query += " ORDER BY provider_name, country_code"
+    
+    rows, err := ct.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query country limits")
+    }
+    defer rows.Close()
+    
+    var limits []*models.ProviderCountryLimit
+    for rows.Next() {
+        var l models.ProviderCountryLimit
+        if err := rows.Scan(&l.ProviderName, &l.CountryCode, &l.MaxConcurrent, &l.MaxCPS); err != nil {
+            continue
+        }
+        limits = append(limits, &l)
+    }
+    
+    // Live usage is only known to the running router
+    ct.mu.Lock()
+    for _, l := range limits {
+        l.ActiveCalls = ct.providers[providerCountryKey(l.ProviderName, l.CountryCode)]
+    }
+    ct.mu.Unlock()
+    
+    return limits, rows.Err()
+}
+
+func (ct *CountryTracker) refreshRoutine() {
+    ticker := time.NewTicker(ct.config.RefreshInterval)
+    defer ticker.Stop()
+    
+    ct.refresh(context.Background())
+    for range ticker.C {
+        ct.refresh(context.Background())
+        ct.publishCPS()
+    }
+}
+
+func (ct *CountryTracker) refresh(ctx context.Context) {
+    rows, err := ct.db.QueryContext(ctx, `
+        SELECT provider_name, country_code, max_concurrent, max_cps
+        FROM provider_country_limits`)
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Debug("Failed to refresh country limits")
+        return
+    }
+    defer rows.Close()
+    
+    limits := make(map[string]*models.ProviderCountryLimit)
+    for rows.Next() {
+        var l models.ProviderCountryLimit
+        if err := rows.Scan(&l.ProviderName, &l.CountryCode, &l.MaxConcurrent, &l.MaxCPS); err != nil {
+            continue
+        }
+        limits[providerCountryKey(l.ProviderName, l.CountryCode)] = &l
+    }
+    
+    ct.mu.Lock()
+    ct.limits = limits
+    ct.mu.Unlock()
+}
+
+func (ct *CountryTracker) publishCPS() {
+    for _, s := range ct.Stats() {
+        ct.metrics.SetGauge("router_country_cps", s.CPS, map[string]string{"country": s.Country})
+    }
+}
+
+// SetCountryLimits makes provider selection skip providers at their country limit
+func (lb *LoadBalancer) SetCountryLimits(countries *CountryTracker) {
+    lb.countries = countries
+}
+
+// applyCountryLimits drops providers that can't take another call to the
+// destination country carried in ctx
+func (lb *LoadBalancer) applyCountryLimits(ctx context.Context, providers []*models.Provider) ([]*models.Provider, error) {
+    country, _ := ctx.Value("country").(string)
+    if lb.countries == nil || !lb.countries.config.Enforce || country == "" {
+        return providers, nil
+    }
+    
+    allowed := providers[:0:0]
+    for _, p := range providers {
+        if lb.countries.Allows(p.Name, country) {
+            allowed = append(allowed, p)
+        }
+    }
+    
+    if len(allowed) == 0 {
+        return nil, errors.New(errors.ErrQuotaExceeded, "all providers at country limit").
+            WithContext("country", country)
+    }
+    return allowed, nil
+}
@@ -0,0 +1,98 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// CustomerCalls returns one page of a customer's production calls as the
+// customer sees them
+func (r *Router) CustomerCalls(ctx context.Context, customer string, opts models.ListOptions) ([]*models.CustomerCall, int64, error) {
+    production := false
+    records, total, err := r.ListCalls(ctx, models.CallFilter{Customer: customer, Test: &production}, opts)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    calls := make([]*models.CustomerCall, 0, len(records))
+    for _, c := range records {
+        calls = append(calls, &models.CustomerCall{
+            CallID:           c.CallID,
+            ANI:              c.OriginalANI,
+            DNIS:             c.OriginalDNIS,
+            DID:              c.AssignedDID,
+            Status:           c.Status,
+            Disposition:      c.Disposition,
+            StartTime:        c.StartTime,
+            AnswerTime:       c.AnswerTime,
+            EndTime:          c.EndTime,
+            Duration:         c.Duration,
+            BillableDuration: c.BillableDuration,
+        })
+    }
+    return calls, total, nil
+}
+
+// CustomerUsage returns a customer's production traffic per day
+func (r *Router) CustomerUsage(ctx context.Context, customer string, since, until time.Time) ([]*models.CustomerUsageDay, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT DATE(start_time) AS day, COUNT(*),
+               COALESCE(SUM(answer_time IS NOT NULL OR status = ?), 0),
+               COALESCE(SUM(billable_duration), 0) / 60
+        FROM call_records
+        WHERE inbound_provider = ? AND start_time >= ? AND start_time < ? AND COALESCE(is_test, 0) = 0
+        GROUP BY day
+        ORDER BY day`,
+        models.CallStatusCompleted, customer, since, until)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query customer usage")
+    }
+    defer rows.Close()
+
+    var days []*models.CustomerUsageDay
+    for rows.Next() {
+        var d models.CustomerUsageDay
+        if err := rows.Scan(&d.Date, &d.Calls, &d.Answered, &d.BillableMinutes); err != nil {
+            continue
+        }
+        if d.Calls > 0 {
+            d.ASR = float64(d.Answered) / float64(d.Calls) * 100
+        }
+        days = append(days, &d)
+    }
+    return days, rows.Err()
+}
+
+// CustomerDIDs returns the DIDs a customer's production calls were assigned
+func (r *Router) CustomerDIDs(ctx context.Context, customer string, since, until time.Time) ([]*models.CustomerDIDUsage, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT did_number, COUNT(*), COALESCE(SUM(answered), 0),
+               COALESCE(SUM(billable_duration), 0) / 60, MAX(released_at)
+        FROM did_usage_log
+        WHERE inbound_provider = ? AND released_at >= ? AND released_at < ? AND COALESCE(is_test, 0) = 0
+        GROUP BY did_number
+        ORDER BY COUNT(*) DESC`,
+        customer, since, until)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query customer DIDs")
+    }
+    defer rows.Close()
+
+    var dids []*models.CustomerDIDUsage
+    for rows.Next() {
+        var d models.CustomerDIDUsage
+        var lastUsed sql.NullTime
+        if err := rows.Scan(&d.Number, &d.Calls, &d.Answered, &d.BillableMinutes, &lastUsed); err != nil {
+            continue
+        }
+        if lastUsed.Valid {
+            d.LastUsed = &lastUsed.Time
+        }
+        dids = append(dids, &d)
+    }
+    return dids, rows.Err()
+}
@@ -0,0 +1,356 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// BlockingConfig controls destination blocking
+type BlockingConfig struct {
+    Enabled         bool
+    RefreshInterval time.Duration
+}
+
+// BlockManager rejects calls to blocked prefixes and countries before a DID is allocated
+type BlockManager struct {
+    db      *sql.DB
+    metrics MetricsInterface
+    config  BlockingConfig
+    
+    mu     sync.RWMutex
+    blocks []*models.DestinationBlock
+}
+
+// NewBlockManager creates a new block manager
+func NewBlockManager(db *sql.DB, metrics MetricsInterface, config BlockingConfig) *BlockManager {
+    if config.RefreshInterval <= 0 {
+        config.RefreshInterval = 15 * time.Second
+    }
+    
+    bm := &BlockManager{
+        db:      db,
+        metrics: metrics,
+        config:  config,
+    }
+    
+    if config.Enabled {
+        go bm.refreshRoutine()
+    }
+    
+    return bm
+}
+
+// Check returns the block that stops a call to dnis, nil when the call may proceed.
+// The most specific scope wins so a report names the rule an operator would look for.
+func (bm *BlockManager) Check(dnis, customer, route string) *models.DestinationBlock {
+    if !bm.config.Enabled {
+        return nil
+    }
+    
+    number := numbering.Normalize(dnis)
+    country := numbering.CountryOf(dnis)
+    now := time.Now()
+    
+    bm.mu.RLock()
+    defer bm.mu.RUnlock()
+    
+    var match *models.DestinationBlock
+    for _, b := range bm.blocks {
+        if b.Overridden(now) || !blockApplies(b, customer, route) || !blockMatches(b, number, country) {
+            continue
+        }
+        if match == nil || scopeRank(b.Scope) > scopeRank(match.Scope) {
+            match = b
+        }
+    }
+    
+    return match
+}
+
+func scopeRank(scope models.BlockScope) int {
+    switch scope {
+    case models.BlockScopeRoute:
+        return 2
+    case models.BlockScopeCustomer:
+        return 1
+    }
+    return 0
+}
+
+// checkBlocked rejects a call matching a destination block
+func (r *Router) checkBlocked(ctx context.Context, dnis, customer string, route *models.ProviderRoute) error {
+    block := r.blocks.Check(dnis, customer, route.Name)
+    if block == nil {
+        return nil
+    }
+    
+    r.metrics.IncrementCounter("router_calls_blocked", map[string]string{
+        "scope": string(block.Scope),
+        "match": block.MatchType,
+    })
+    
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "dnis":     dnis,
+        "customer": customer,
+        "route":    route.Name,
+        "block_id": block.ID,
+        "pattern":  block.Pattern,
+    }).Warn("Call to blocked destination rejected")
+    
+    return errors.New(errors.ErrDestinationBlocked, "destination is blocked").
+        WithContext("block_id", block.ID).
+        WithContext("scope", string(block.Scope)).
+        WithContext("pattern", block.Pattern)
+}
+
+// AddBlock stores a new destination block
+func (bm *BlockManager) AddBlock(ctx context.Context, block *models.DestinationBlock) error {
+    if err := validateBlock(block); err != nil {
+        return err
+    }
+    
+    tx, err := bm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+    
+    result, err := tx.ExecContext(ctx, `
+        INSERT INTO destination_blocks (scope, scope_value, match_type, pattern, reason, created_by)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+        block.Scope, block.ScopeValue, block.MatchType, block.Pattern, block.Reason, block.CreatedBy)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to store destination block")
+    }
+    block.ID, _ = result.LastInsertId()
+    block.CreatedAt = time.Now()
+    
+    if err := bm.audit(ctx, tx, block.ID, block.CreatedBy, "create", nil, block, nil); err != nil {
+        return err
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    
+    bm.refresh(ctx)
+    return nil
+}
+
+// RemoveBlock deletes a destination block with its overrides
+func (bm *BlockManager) RemoveBlock(ctx context.Context, id int64, removedBy string) error {
+    block, err := bm.getBlock(ctx, id)
+    if err != nil {
+        return err
+    }
+    
+    tx, err := bm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+    
+    if _, err := tx.ExecContext(ctx, "DELETE FROM destination_blocks WHERE id = ?", id); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete destination block")
+    }
+    
+    if err := bm.audit(ctx, tx, id, removedBy, "delete", block, nil, nil); err != nil {
+        return err
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    
+    bm.refresh(ctx)
+    return nil
+}
+
+// Unblock lifts a block temporarily, it applies again once the override expires
+func (bm *BlockManager) Unblock(ctx context.Context, id int64, duration time.Duration, reason, unblockedBy string) (time.Time, error) {
+    if duration <= 0 {
+        return time.Time{}, errors.New(errors.ErrInternal, "unblock duration must be positive")
+    }
+    
+    block, err := bm.getBlock(ctx, id)
+    if err != nil {
+        return time.Time{}, err
+    }
+    
+    expiresAt := time.Now().Add(duration)
+    
+    tx, err := bm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return time.Time{}, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+    
+    if _, err := tx.ExecContext(ctx, `
+        INSERT INTO destination_block_overrides (block_id, reason, created_by, expires_at)
+        VALUES (?, ?, ?, ?)`,
+        id, reason, unblockedBy, expiresAt); err != nil {
+        return time.Time{}, errors.Wrap(err, errors.ErrDatabase, "failed to store unblock override")
+    }
+    
+    metadata := map[string]interface{}{
+        "expires_at": expiresAt,
+        "reason":     reason,
+    }
+    if err := bm.audit(ctx, tx, id, unblockedBy, "unblock", nil, block, metadata); err != nil {
+        return time.Time{}, err
+    }
+    
+    if err := tx.Commit(); err != nil {
+        return time.Time{}, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    
+    bm.refresh(ctx)
+    return expiresAt, nil
+}
+
+// ListBlocks returns all destination blocks with their active override
+func (bm *BlockManager) ListBlocks(ctx context.Context) ([]*models.DestinationBlock, error) {
+    return bm.queryBlocks(ctx, "", nil)
+}
+
+func (bm *BlockManager) getBlock(ctx context.Context, id int64) (*models.DestinationBlock, error) {
+    blocks, err := bm.queryBlocks(ctx, "WHERE b.id = ?", []interface{}{id})
+    if err != nil {
+        return nil, err
+    }
+    if len(blocks) == 0 {
+        return nil, errors.New(errors.ErrInternal, "destination block not found").
+            WithContext("id", id)
+    }
+    return blocks[0], nil
+}
+
+func (bm *BlockManager) queryBlocks(ctx context.Context, where string, args []interface{}) ([]*models.DestinationBlock, error) {
+    query := fmt.Sprintf(`
+        SELECT b.id, b.scope, COALESCE(b.scope_value, ''), b.match_type, b.pattern,
+               COALESCE(b.reason, ''), COALESCE(b.created_by, ''), b.created_at,
+               (SELECT MAX(o.expires_at) FROM destination_block_overrides o
+                WHERE o.block_id = b.id AND o.expires_at > NOW())
+        FROM destination_blocks b
+        %s
+        ORDER BY b.scope, b.scope_value, b.pattern`, where)
+    
+    rows, err := bm.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query destination blocks")
+    }
+    defer rows.Close()
+    
+    var blocks []*models.DestinationBlock
+    for rows.Next() {
+        var b models.DestinationBlock
+        var until sql.NullTime
+        if err := rows.Scan(&b.ID, &b.Scope, &b.ScopeValue, &b.MatchType, &b.Pattern,
+            &b.Reason, &b.CreatedBy, &b.CreatedAt, &until); err != nil {
+            continue
+        }
+        if until.Valid {
+            b.UnblockedUntil = &until.Time
+        }
+        blocks = append(blocks, &b)
+    }
+    
+    return blocks, rows.Err()
+}
+
+func (bm *BlockManager) audit(ctx context.Context, tx *sql.Tx, id int64, user, action string, oldValue, newValue interface{}, metadata map[string]interface{}) error {
+    return audit.Record(ctx, tx, audit.Entry{
+        EventType:  "destination_block",
+        EntityType: "destination_block",
+        EntityID:   fmt.Sprintf("%d", id),
+        UserID:     user,
+        Action:     action,
+        OldValue:   oldValue,
+        NewValue:   newValue,
+        Metadata:   metadata,
+    })
+}
+
+func validateBlock(block *models.DestinationBlock) error {
+    switch block.Scope {
+    case models.BlockScopeGlobal:
+        block.ScopeValue = ""
+    case models.BlockScopeCustomer, models.BlockScopeRoute:
+        if block.ScopeValue == "" {
+            return errors.New(errors.ErrInternal, "scoped block needs a customer or route").
+                WithContext("scope", string(block.Scope))
+        }
+    default:
+        return errors.New(errors.ErrInternal, "invalid block scope").
+            WithContext("scope", string(block.Scope))
+    }
+    
+    switch block.MatchType {
+    case models.BlockMatchPrefix:
+        block.Pattern = numbering.Normalize(block.Pattern)
+        if block.Pattern == "" {
+            return errors.New(errors.ErrInternal, "prefix must contain digits")
+        }
+    case models.BlockMatchCountry:
+        block.Pattern = strings.ToUpper(block.Pattern)
+        if !numbering.IsCountryCode(block.Pattern) {
+            return errors.New(errors.ErrInternal, "country must be an ISO 3166 alpha-2 code").
+                WithContext("country", block.Pattern)
+        }
+    default:
+        return errors.New(errors.ErrInternal, "invalid block match type").
+            WithContext("match_type", block.MatchType)
+    }
+    
+    return nil
+}
+
+func blockApplies(b *models.DestinationBlock, customer, route string) bool {
+    switch b.Scope {
+    case models.BlockScopeCustomer:
+        return b.ScopeValue == customer
+    case models.BlockScopeRoute:
+        return b.ScopeValue == route
+    }
+    return true
+}
+
+func blockMatches(b *models.DestinationBlock, number, country string) bool {
+    if b.MatchType == models.BlockMatchCountry {
+        return b.Pattern == country
+    }
+    return strings.HasPrefix(number, b.Pattern)
+}
+
+// refreshRoutine picks up blocks and overrides changed from the CLI
+func (bm *BlockManager) refreshRoutine() {
+    ticker := time.NewTicker(bm.config.RefreshInterval)
+    defer ticker.Stop()
+    
+    bm.refresh(context.Background())
+    for range ticker.C {
+        bm.refresh(context.Background())
+    }
+}
+
+func (bm *BlockManager) refresh(ctx context.Context) {
+    blocks, err := bm.ListBlocks(ctx)
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Debug("Failed to refresh destination blocks")
+        return
+    }
+    
+    bm.mu.Lock()
+    bm.blocks = blocks
+    bm.mu.Unlock()
+}
@@ -0,0 +1,192 @@
+package router
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// DeviceStateConfig controls publishing provider state as Asterisk custom device states
+type DeviceStateConfig struct {
+    Enabled     bool
+    Interval    time.Duration
+    Prefix      string // device and hint extension name prefix
+    HintContext string // dialplan context the generated hints live in
+}
+
+// DeviceStateSetter pushes a device state to Asterisk, implemented by the AMI manager
+type DeviceStateSetter interface {
+    SetDeviceState(device, state string) error
+}
+
+// DeviceStatePublisher keeps Custom:<prefix><provider> device states in Asterisk in
+// sync with provider health so BLF hints on wallboards and operator panels follow it
+type DeviceStatePublisher struct {
+    router *Router
+    setter DeviceStateSetter
+    config DeviceStateConfig
+
+    published map[string]string // device -> last state Asterisk accepted
+}
+
+// NewDeviceStatePublisher creates a new publisher
+func NewDeviceStatePublisher(r *Router, setter DeviceStateSetter, config DeviceStateConfig) *DeviceStatePublisher {
+    if config.Interval <= 0 {
+        config.Interval = 10 * time.Second
+    }
+
+    return &DeviceStatePublisher{
+        router:    r,
+        setter:    setter,
+        config:    NormalizeDeviceStateConfig(config),
+        published: make(map[string]string),
+    }
+}
+
+// NormalizeDeviceStateConfig fills in the default prefix and hint context
+func NormalizeDeviceStateConfig(config DeviceStateConfig) DeviceStateConfig {
+    if config.Prefix == "" {
+        config.Prefix = "ara-"
+    }
+    if config.HintContext == "" {
+        config.HintContext = "ara-trunk-hints"
+    }
+    return config
+}
+
+// DeviceName returns the custom device a provider's state is published on
+func DeviceName(config DeviceStateConfig, providerName string) string {
+    return "Custom:" + config.Prefix + providerName
+}
+
+// Run publishes state changes until the context is cancelled
+func (p *DeviceStatePublisher) Run(ctx context.Context) {
+    ticker := time.NewTicker(p.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        if _, err := p.Publish(ctx); err != nil {
+            logger.WithContext(ctx).WithError(err).Debug("Failed to publish device states")
+        }
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// Publish pushes the states that changed since the last run and returns how many were sent
+func (p *DeviceStatePublisher) Publish(ctx context.Context) (int, error) {
+    states, err := p.router.GetDeviceStates(ctx, p.config)
+    if err != nil {
+        return 0, err
+    }
+
+    sent := 0
+    for _, s := range states {
+        if p.published[s.Device] == s.State {
+            continue
+        }
+
+        if err := p.setter.SetDeviceState(s.Device, s.State); err != nil {
+            // Left unrecorded so the next run retries, AMI may be reconnecting
+            return sent, errors.Wrap(err, errors.ErrInternal, "failed to set device state").
+                WithContext("device", s.Device)
+        }
+
+        logger.WithContext(ctx).WithFields(map[string]interface{}{
+            "device":   s.Device,
+            "state":    s.State,
+            "previous": p.published[s.Device],
+        }).Debug("Device state published")
+
+        p.published[s.Device] = s.State
+        sent++
+    }
+
+    return sent, nil
+}
+
+// GetDeviceStates derives the trunk state of every provider from its health,
+// quarantine and channel usage
+func (r *Router) GetDeviceStates(ctx context.Context, config DeviceStateConfig) ([]*models.ProviderDeviceState, error) {
+    config = NormalizeDeviceStateConfig(config)
+
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT name, active, COALESCE(max_channels, 0)
+        FROM providers
+        ORDER BY name`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query providers")
+    }
+    defer rows.Close()
+
+    var states []*models.ProviderDeviceState
+    for rows.Next() {
+        var name string
+        var active bool
+        var maxChannels int
+        if err := rows.Scan(&name, &active, &maxChannels); err != nil {
+            continue
+        }
+
+        healthy, activeCalls := r.loadBalancer.providerLoad(name)
+        s := &models.ProviderDeviceState{
+            ProviderName: name,
+            Device:       DeviceName(config, name),
+            ActiveCalls:  activeCalls,
+            MaxChannels:  maxChannels,
+        }
+
+        switch {
+        case !active:
+            s.State, s.Reason = models.DeviceStateUnavailable, "inactive"
+        case r.quarantine.IsQuarantined(name):
+            s.State, s.Reason = models.DeviceStateUnavailable, "quarantined"
+        case !healthy:
+            s.State, s.Reason = models.DeviceStateUnavailable, "unhealthy"
+        case maxChannels > 0 && activeCalls >= int64(maxChannels):
+            s.State = models.DeviceStateBusy
+        case activeCalls > 0:
+            s.State = models.DeviceStateInUse
+        default:
+            s.State = models.DeviceStateNotInUse
+        }
+
+        states = append(states, s)
+    }
+
+    return states, rows.Err()
+}
+
+// DeviceStateHints renders the static dialplan hints for every provider. Realtime
+// extensions can't carry hints, so the output goes into a file included from extensions.conf.
+func (r *Router) DeviceStateHints(ctx context.Context, config DeviceStateConfig) (string, error) {
+    config = NormalizeDeviceStateConfig(config)
+
+    rows, err := r.db.QueryContext(ctx, "SELECT name FROM providers ORDER BY name")
+    if err != nil {
+        return "", errors.Wrap(err, errors.ErrDatabase, "failed to query providers")
+    }
+    defer rows.Close()
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "; Generated by router devstate hints, one hint per provider trunk\n")
+    fmt.Fprintf(&b, "[%s]\n", config.HintContext)
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil {
+            continue
+        }
+        fmt.Fprintf(&b, "exten => %s%s,hint,%s\n", config.Prefix, name, DeviceName(config, name))
+    }
+
+    return b.String(), rows.Err()
+}
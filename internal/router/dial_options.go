@@ -0,0 +1,283 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "strconv"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// dialTarget is what the builder needs to know about the provider dialed
+type dialTarget struct {
+    options   *models.DialOptions
+    host      string
+    port      int
+    registers bool
+}
+
+// dialLeg is an outbound leg handed back to the dialplan
+type dialLeg struct {
+    provider string
+    dnis     string
+    route    *models.DialOptions // options of the route, over those of the provider
+    recordID string              // records the called channel under this call ID, empty for none
+}
+
+// intermediateLeg is the response sending a call to S3 on its DID
+func (r *Router) intermediateLeg(ctx context.Context, callID, ani2, did, provider string, options *models.DialOptions) *models.CallResponse {
+    response := &models.CallResponse{
+        Status:      "success",
+        DIDAssigned: did,
+        NextHop:     "endpoint-" + provider,
+        ANIToSend:   ani2,  // ANI-2 = DNIS-1
+        DNISToSend:  did,   // DID
+    }
+
+    // Bind the DID to this call so the return leg can't be guessed
+    if r.correlation.Enabled() {
+        response.CorrelationToken = r.correlation.Sign(callID, did)
+        response.DNISToSend = r.correlation.AppendToDNIS(did, response.CorrelationToken)
+    }
+
+    // The called channel is recorded next to the caller's recording
+    r.buildDial(ctx, response, dialLeg{
+        provider: provider,
+        dnis:     response.DNISToSend,
+        route:    options,
+        recordID: callID,
+    })
+    return response
+}
+
+// finalLeg is the response sending a returned call on to S4
+func (r *Router) finalLeg(ctx context.Context, record *models.CallRecord) *models.CallResponse {
+    response := &models.CallResponse{
+        Status:     "success",
+        NextHop:    "endpoint-" + record.FinalProvider,
+        ANIToSend:  record.FinalANI(),   // Restore ANI-1
+        DNISToSend: record.FinalDNIS(),  // Restore DNIS-1
+    }
+    r.buildDial(ctx, response, dialLeg{
+        provider: record.FinalProvider,
+        dnis:     response.DNISToSend,
+        route:    record.DialOptions,
+    })
+    return response
+}
+
+// buildDial fills the Dial variables of the response for the leg. The dialplan
+// runs Dial(${DIAL_STRING},${DIAL_TIMEOUT},${DIAL_OPTIONS}) as is.
+func (r *Router) buildDial(ctx context.Context, response *models.CallResponse, leg dialLeg) {
+    target := r.dialTarget(ctx, leg.provider)
+    options := target.options.Merge(leg.route)
+
+    response.DialTimeout = options.Timeout
+    if response.DialTimeout <= 0 {
+        response.DialTimeout = int(r.config.DialTimeout.Seconds())
+    }
+    response.DialString = dialString(leg, target, options.Transport)
+    response.DialOptions = dialAppOptions(options, leg.recordID)
+}
+
+// dialString addresses the provider's endpoint. A transport hint puts the
+// provider's address in the request URI, registered providers have no fixed
+// address so they keep the plain form.
+func dialString(leg dialLeg, target *dialTarget, transport string) string {
+    endpoint := "endpoint-" + leg.provider
+    if transport == "" || target.registers || target.host == "" {
+        return fmt.Sprintf("PJSIP/%s@%s", leg.dnis, endpoint)
+    }
+
+    host := target.host
+    if target.port > 0 {
+        host += ":" + strconv.Itoa(target.port)
+    }
+    return fmt.Sprintf("PJSIP/%s/sip:%s@%s;transport=%s", endpoint, leg.dnis, host, transport)
+}
+
+// earlyMediaFlags are the Dial flags of the early media policies: R passes
+// ringing on but no audio until answer, r signals ringing to the caller itself
+var earlyMediaFlags = map[string]string{
+    models.EarlyMediaBlock:    "R",
+    models.EarlyMediaRingback: "r",
+}
+
+// dialAppOptions builds the Dial options. Dial takes a single b() and U(), so
+// the system subroutines take the provider and route contexts as arguments.
+func dialAppOptions(options *models.DialOptions, recordID string) string {
+    predial := earlyMediaFlags[options.EarlyMedia] + "b(sub-predial^s^1"
+    if options.CallerIDPres != "" || options.PreDialSub != "" {
+        predial += "(" + options.CallerIDPres + "^" + options.PreDialSub + ")"
+    }
+    predial += ")"
+
+    if recordID == "" && options.AnswerSub == "" {
+        return predial
+    }
+    return fmt.Sprintf("U(sub-answer^%s^%s)%s", recordID, options.AnswerSub, predial)
+}
+
+// dialTarget returns the stored options and address of a provider; lookup
+// failures only cost the leg its provider options
+func (r *Router) dialTarget(ctx context.Context, providerName string) *dialTarget {
+    cacheKey := "dial:" + providerName
+    if cached, ok := r.dialCache.get(cacheKey); ok {
+        return cached.(*dialTarget)
+    }
+
+    var (
+        timeout, maxAttempts                   sql.NullInt64
+        pres, predialSub, answerSub, transport sql.NullString
+        earlyMedia                             sql.NullString
+        authType                               string
+    )
+    target := &dialTarget{}
+    err := r.db.QueryRowContext(ctx, `
+        SELECT p.host, p.port, COALESCE(p.auth_type, ''),
+               o.timeout, o.callerid_pres, o.predial_sub, o.answer_sub, o.transport,
+               o.early_media, o.max_attempts
+        FROM providers p
+        LEFT JOIN provider_dial_options o ON o.provider_name = p.name
+        WHERE p.name = ?`, providerName).Scan(
+        &target.host, &target.port, &authType,
+        &timeout, &pres, &predialSub, &answerSub, &transport,
+        &earlyMedia, &maxAttempts,
+    )
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).WithField("provider", providerName).
+            Warn("Failed to load provider dial options")
+        return target
+    }
+
+    target.registers = (&models.Provider{AuthType: authType}).Registers()
+    target.options = &models.DialOptions{
+        Timeout:      int(timeout.Int64),
+        CallerIDPres: pres.String,
+        PreDialSub:   predialSub.String,
+        AnswerSub:    answerSub.String,
+        Transport:    transport.String,
+        EarlyMedia:   earlyMedia.String,
+        MaxAttempts:  int(maxAttempts.Int64),
+    }
+
+    r.dialCache.set(cacheKey, target)
+    return target
+}
+
+// SetProviderDialOptions creates or replaces the dial options of a provider
+func (r *Router) SetProviderDialOptions(ctx context.Context, options *models.ProviderDialOptions) error {
+    if err := options.Validate(); err != nil {
+        return errors.New(errors.ErrInternal, err.Error()).
+            WithContext("provider", options.ProviderName)
+    }
+
+    _, err := r.db.ExecContext(ctx, `
+        INSERT INTO provider_dial_options (
+            provider_name, timeout, callerid_pres, predial_sub, answer_sub, transport,
+            early_media, max_attempts
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            timeout = VALUES(timeout),
+            callerid_pres = VALUES(callerid_pres),
+            predial_sub = VALUES(predial_sub),
+            answer_sub = VALUES(answer_sub),
+            transport = VALUES(transport),
+            early_media = VALUES(early_media),
+            max_attempts = VALUES(max_attempts),
+            updated_at = NOW()`,
+        options.ProviderName, nullInt(options.Timeout), nullString(options.CallerIDPres),
+        nullString(options.PreDialSub), nullString(options.AnswerSub), nullString(options.Transport),
+        nullString(options.EarlyMedia), nullInt(options.MaxAttempts))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to store dial options")
+    }
+
+    r.cache.Invalidate(ctx, "dial:"+options.ProviderName)
+    return nil
+}
+
+// DeleteProviderDialOptions removes the dial options of a provider
+func (r *Router) DeleteProviderDialOptions(ctx context.Context, providerName string) error {
+    result, err := r.db.ExecContext(ctx,
+        "DELETE FROM provider_dial_options WHERE provider_name = ?", providerName)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete dial options")
+    }
+
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return errors.New(errors.ErrProviderNotFound, "dial options not found").
+            WithContext("provider", providerName)
+    }
+
+    r.cache.Invalidate(ctx, "dial:"+providerName)
+    return nil
+}
+
+// ListProviderDialOptions returns the providers with dial options
+func (r *Router) ListProviderDialOptions(ctx context.Context) ([]*models.ProviderDialOptions, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT provider_name, COALESCE(timeout, 0), COALESCE(callerid_pres, ''),
+               COALESCE(predial_sub, ''), COALESCE(answer_sub, ''), COALESCE(transport, ''),
+               COALESCE(early_media, ''), COALESCE(max_attempts, 0)
+        FROM provider_dial_options
+        ORDER BY provider_name`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query dial options")
+    }
+    defer rows.Close()
+
+    var list []*models.ProviderDialOptions
+    for rows.Next() {
+        var o models.ProviderDialOptions
+        if err := rows.Scan(&o.ProviderName, &o.Timeout, &o.CallerIDPres,
+            &o.PreDialSub, &o.AnswerSub, &o.Transport, &o.EarlyMedia, &o.MaxAttempts); err != nil {
+            continue
+        }
+        list = append(list, &o)
+    }
+
+    return list, rows.Err()
+}
+
+// SetRouteDialOptions replaces the dial options of a route, nil clears them
+func (r *Router) SetRouteDialOptions(ctx context.Context, routeName string, options *models.DialOptions) error {
+    if err := options.Validate(); err != nil {
+        return errors.New(errors.ErrInternal, err.Error()).
+            WithContext("route", routeName)
+    }
+
+    if _, err := r.GetRoute(ctx, routeName); err != nil {
+        return err
+    }
+
+    var value interface{}
+    if !options.IsEmpty() {
+        value, _ = json.Marshal(options)
+    }
+    if _, err := r.db.ExecContext(ctx,
+        "UPDATE provider_routes SET dial_options = ? WHERE name = ?", value, routeName); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update route dial options")
+    }
+
+    r.flushRoutes(ctx)
+    return nil
+}
+
+func nullInt(v int) interface{} {
+    if v == 0 {
+        return nil
+    }
+    return v
+}
+
+func nullString(v string) interface{} {
+    if v == "" {
+        return nil
+    }
+    return v
+}
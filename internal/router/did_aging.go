@@ -0,0 +1,174 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// DIDAgingConfig controls the quarantine of recycled DIDs
+type DIDAgingConfig struct {
+    // Quarantine is how long a number rests after it was removed from the
+    // pool or last carried a call before it rotates again once re-added, so
+    // late return legs of its previous calls aren't sent to a new call. Zero
+    // returns recycled numbers to rotation straight away.
+    Quarantine time.Duration
+}
+
+// availableDID is the condition of DIDs that can be allocated
+const availableDID = "in_use = 0 AND (quarantined_until IS NULL OR quarantined_until <= NOW())"
+
+// RemoveDIDs deletes numbers that aren't in use from the pool, keeping their
+// provider and last use in did_history. It returns the numbers removed.
+func (dm *DIDManager) RemoveDIDs(ctx context.Context, numbers []string, reason, user string) (int64, error) {
+    tx, err := dm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    var removed int64
+    for _, number := range numbers {
+        if _, err := tx.ExecContext(ctx, `
+            INSERT INTO did_history (number, event, provider_name, last_used_at, detail, user_id)
+            SELECT number, 'removed', provider_name, last_used_at, ?, ?
+            FROM dids WHERE number = ? AND in_use = 0`,
+            nullString(reason), nullString(user), number); err != nil {
+            return 0, errors.Wrap(err, errors.ErrDatabase, "failed to record DID history")
+        }
+
+        result, err := tx.ExecContext(ctx, "DELETE FROM dids WHERE number = ? AND in_use = 0", number)
+        if err != nil {
+            return 0, errors.Wrap(err, errors.ErrDatabase, "failed to delete DID")
+        }
+        n, _ := result.RowsAffected()
+        removed += n
+    }
+
+    if err := tx.Commit(); err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    dm.cache.Delete(ctx, "did:stats")
+    return removed, nil
+}
+
+// ActivateDIDs checks the history of numbers just added to the pool, in the
+// transaction that added them. Numbers removed or used within the quarantine
+// period are held back until it has passed. It returns the numbers held back.
+func (dm *DIDManager) ActivateDIDs(ctx context.Context, tx *sql.Tx, numbers []string, source, user string) (int, error) {
+    var quarantined int
+    for _, number := range numbers {
+        // The last removal and the last call, which outlives the DID in the usage log
+        var removed, used sql.NullTime
+        err := tx.QueryRowContext(ctx, `
+            SELECT
+                (SELECT MAX(created_at) FROM did_history WHERE number = ? AND event = 'removed'),
+                (SELECT MAX(released_at) FROM did_usage_log WHERE did_number = ?)`,
+            number, number).Scan(&removed, &used)
+        if err != nil {
+            return 0, errors.Wrap(err, errors.ErrDatabase, "failed to check DID history").WithContext("number", number)
+        }
+        lastSeen := removed
+        if used.Valid && (!lastSeen.Valid || used.Time.After(lastSeen.Time)) {
+            lastSeen = used
+        }
+
+        event, detail := models.DIDHistoryAdded, source
+        if lastSeen.Valid {
+            until := lastSeen.Time.Add(dm.aging.Quarantine)
+            detail = fmt.Sprintf("%s, recycled, last seen %s", source, lastSeen.Time.Format("2006-01-02 15:04"))
+            if until.After(time.Now()) {
+                if _, err := tx.ExecContext(ctx, "UPDATE dids SET quarantined_until = ? WHERE number = ?", until, number); err != nil {
+                    return 0, errors.Wrap(err, errors.ErrDatabase, "failed to quarantine DID").WithContext("number", number)
+                }
+                event = models.DIDHistoryQuarantined
+                detail += ", in rotation from " + until.Format("2006-01-02 15:04")
+                quarantined++
+            }
+        }
+
+        if _, err := tx.ExecContext(ctx, `
+            INSERT INTO did_history (number, event, provider_name, detail, user_id)
+            SELECT number, ?, provider_name, ?, ? FROM dids WHERE number = ?`,
+            event, detail, nullString(user), number); err != nil {
+            return 0, errors.Wrap(err, errors.ErrDatabase, "failed to record DID history")
+        }
+    }
+
+    if quarantined > 0 {
+        logger.WithContext(ctx).WithFields(map[string]interface{}{
+            "source":      source,
+            "quarantined": quarantined,
+            "quarantine":  dm.aging.Quarantine.String(),
+        }).Info("Recycled DIDs quarantined")
+    }
+    return quarantined, nil
+}
+
+// ReleaseQuarantine returns a quarantined number to rotation early
+func (dm *DIDManager) ReleaseQuarantine(ctx context.Context, number, user string) error {
+    tx, err := dm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    result, err := tx.ExecContext(ctx,
+        "UPDATE dids SET quarantined_until = NULL WHERE number = ? AND quarantined_until > NOW()", number)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to release DID quarantine")
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return errors.New(errors.ErrDIDNotAvailable, "DID is not quarantined").WithContext("number", number)
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+        INSERT INTO did_history (number, event, provider_name, detail, user_id)
+        SELECT number, 'released', provider_name, 'quarantine released early', ? FROM dids WHERE number = ?`,
+        nullString(user), number); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to record DID history")
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    dm.cache.Delete(ctx, "did:stats")
+    return nil
+}
+
+// DIDHistory returns the recorded history of a number, newest first
+func (dm *DIDManager) DIDHistory(ctx context.Context, number string) ([]*models.DIDHistoryEntry, error) {
+    rows, err := dm.db.QueryContext(ctx, `
+        SELECT id, number, event, COALESCE(provider_name, ''), last_used_at,
+               COALESCE(detail, ''), COALESCE(user_id, ''), created_at
+        FROM did_history
+        WHERE number = ?
+        ORDER BY created_at DESC, id DESC`, strings.TrimSpace(number))
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DID history")
+    }
+    defer rows.Close()
+
+    var history []*models.DIDHistoryEntry
+    for rows.Next() {
+        var h models.DIDHistoryEntry
+        var lastUsed sql.NullTime
+        if err := rows.Scan(&h.ID, &h.Number, &h.Event, &h.ProviderName, &lastUsed,
+            &h.Detail, &h.UserID, &h.CreatedAt); err != nil {
+            continue
+        }
+        if lastUsed.Valid {
+            h.LastUsedAt = &lastUsed.Time
+        }
+        history = append(history, &h)
+    }
+    return history, rows.Err()
+}
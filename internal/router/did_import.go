@@ -0,0 +1,418 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "encoding/csv"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/db"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// didImportBatch is how many DIDs a single INSERT of an import adds
+const didImportBatch = 500
+
+// didImportColumns are the columns of a DID file without a header row
+var didImportColumns = []string{"number", "country", "city", "monthly_cost", "per_minute_cost"}
+
+// didImportFields are the columns a header row may name, in any order
+var didImportFields = map[string]bool{
+    "number":          true,
+    "country":         true,
+    "city":            true,
+    "rate_center":     true,
+    "monthly_cost":    true,
+    "per_minute_cost": true,
+    "currency":        true,
+}
+
+// Outcomes of the rows of a DID import
+const (
+    DIDImportAdded      = "added"
+    DIDImportInvalid    = "invalid"
+    DIDImportDuplicate  = "duplicate" // listed earlier in the file
+    DIDImportExisting   = "existing"  // already in the pool
+    DIDImportFailed     = "failed"
+    DIDImportRolledBack = "rolled_back" // added, then undone as the import was cancelled
+)
+
+// DIDImportRow is a DID to import, Line its line in the file or zero for
+// numbers given on the command line. Status and Problem tell how it went,
+// Status stays empty for the rows a cancelled import never reached.
+type DIDImportRow struct {
+    Line    int        `json:"line,omitempty"`
+    DID     models.DID `json:"did"`
+    Status  string     `json:"status,omitempty"`
+    Problem string     `json:"problem,omitempty"`
+}
+
+// DIDImportOptions are the settings every DID of an import gets
+type DIDImportOptions struct {
+    Provider string
+    IsTest   bool
+    DryRun   bool // validates and reports without writing
+    User     string
+}
+
+// DIDImportReport is the outcome of a DID import. On a dry run the rows
+// marked added are those the import would add. A cancelled import writes
+// nothing, the rows it had added are marked rolled back.
+type DIDImportReport struct {
+    Rows        []*DIDImportRow `json:"rows"`
+    DryRun      bool            `json:"dry_run,omitempty"`
+    Cancelled   bool            `json:"cancelled,omitempty"`
+    Quarantined int             `json:"quarantined"`
+}
+
+// Count returns how many rows of the import ended with status
+func (r *DIDImportReport) Count(status string) int {
+    n := 0
+    for _, row := range r.Rows {
+        if row.Status == status {
+            n++
+        }
+    }
+    return n
+}
+
+// ParseDIDFile reads the DIDs of a CSV file. A header row names the columns
+// (number, country, city, rate_center, monthly_cost, per_minute_cost and
+// currency); files without one list number, country, city, monthly_cost and
+// per_minute_cost, only the number is required. Values that can't be read
+// mark their row invalid rather than fail the file.
+func ParseDIDFile(r io.Reader) ([]*DIDImportRow, error) {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    reader.TrimLeadingSpace = true
+
+    var records [][]string
+    var lines []int
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, errors.Wrap(err, errors.ErrInternal, "failed to read DID file")
+        }
+        line, _ := reader.FieldPos(0)
+        records = append(records, record)
+        lines = append(lines, line)
+    }
+
+    columns := didImportColumns
+    start := 0
+    if len(records) > 0 && len(records[0]) > 0 && !startsWithDigit(records[0][0]) {
+        columns = make([]string, len(records[0]))
+        for i, name := range records[0] {
+            name = strings.ToLower(strings.TrimSpace(name))
+            if !didImportFields[name] {
+                return nil, errors.New(errors.ErrInternal, "unknown column in DID file header").
+                    WithContext("column", name)
+            }
+            columns[i] = name
+        }
+        if !containsColumn(columns, "number") {
+            return nil, errors.New(errors.ErrInternal, "DID file header has no number column")
+        }
+        start = 1
+    }
+
+    var rows []*DIDImportRow
+    for i := start; i < len(records); i++ {
+        row := &DIDImportRow{Line: lines[i]}
+        blank := true
+        for j, value := range records[i] {
+            value = strings.TrimSpace(value)
+            if value != "" {
+                blank = false
+            }
+            if j < len(columns) {
+                setDIDImportField(row, columns[j], value)
+            }
+        }
+        if !blank {
+            rows = append(rows, row)
+        }
+    }
+    return rows, nil
+}
+
+func containsColumn(columns []string, name string) bool {
+    for _, c := range columns {
+        if c == name {
+            return true
+        }
+    }
+    return false
+}
+
+func startsWithDigit(value string) bool {
+    value = strings.TrimPrefix(strings.TrimSpace(value), "+")
+    return value != "" && value[0] >= '0' && value[0] <= '9'
+}
+
+func setDIDImportField(row *DIDImportRow, column, value string) {
+    switch column {
+    case "number":
+        row.DID.Number = value
+    case "country":
+        row.DID.Country = strings.ToUpper(value)
+    case "city":
+        row.DID.City = value
+    case "rate_center":
+        row.DID.RateCenter = value
+    case "currency":
+        row.DID.Currency = strings.ToUpper(value)
+    case "monthly_cost", "per_minute_cost":
+        if value == "" {
+            return
+        }
+        cost, err := strconv.ParseFloat(value, 64)
+        if err != nil {
+            row.invalid(fmt.Sprintf("invalid %s %q", column, value))
+            return
+        }
+        if column == "monthly_cost" {
+            row.DID.MonthlyCost = cost
+        } else {
+            row.DID.PerMinuteCost = cost
+        }
+    }
+}
+
+func (row *DIDImportRow) invalid(problem string) {
+    if row.Status == "" {
+        row.Status, row.Problem = DIDImportInvalid, problem
+    }
+}
+
+// validate checks a row, filling in the country of numbers listed without one
+func (row *DIDImportRow) validate() {
+    did := &row.DID
+    switch {
+    case did.Number == "":
+        row.invalid("no number")
+    case !numbering.IsE164(did.Number):
+        row.invalid("not an E.164 number")
+    case did.MonthlyCost < 0 || did.PerMinuteCost < 0:
+        row.invalid("negative cost")
+    case did.Currency != "" && !isCurrencyCode(did.Currency):
+        row.invalid(fmt.Sprintf("invalid currency %q", did.Currency))
+    }
+    if row.Status != "" {
+        return
+    }
+
+    country := numbering.CountryOf(did.Number)
+    switch {
+    case did.Country == "":
+        if country != numbering.Unknown {
+            did.Country = country
+        }
+    case !numbering.IsCountryCode(did.Country):
+        row.invalid(fmt.Sprintf("unknown country %s", did.Country))
+    case country != numbering.Unknown && country != did.Country:
+        row.invalid(fmt.Sprintf("number is in %s, not %s", country, did.Country))
+    }
+}
+
+func isCurrencyCode(code string) bool {
+    if len(code) != 3 {
+        return false
+    }
+    for _, c := range code {
+        if c < 'A' || c > 'Z' {
+            return false
+        }
+    }
+    return true
+}
+
+// ImportDIDs adds DIDs to the pool in batches, in one transaction. Rows that
+// aren't valid E.164 numbers, repeat an earlier row or are already in the
+// pool, whatever their formatting, are reported and skipped; the others are
+// added with the provider and test flag of the options. Recycled numbers are
+// quarantined as ActivateDIDs does. A dry run reports without writing.
+// Progress is called with the rows handled as the import goes.
+func (dm *DIDManager) ImportDIDs(ctx context.Context, rows []*DIDImportRow, opts DIDImportOptions,
+    progress func(n int)) (*DIDImportReport, error) {
+    report := &DIDImportReport{Rows: rows, DryRun: opts.DryRun}
+    if progress == nil {
+        progress = func(int) {}
+    }
+
+    existing, err := dm.poolNumbers(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    seen := make(map[string]int)
+    var pending []*DIDImportRow
+    for _, row := range rows {
+        row.validate()
+        if row.Status != "" {
+            continue
+        }
+        key := numbering.Normalize(row.DID.Number)
+        if line, dup := seen[key]; dup {
+            row.Status, row.Problem = DIDImportDuplicate, fmt.Sprintf("duplicate of line %d", line)
+            continue
+        }
+        seen[key] = row.Line
+        if existing[key] {
+            row.Status, row.Problem = DIDImportExisting, "already in the pool"
+            continue
+        }
+        pending = append(pending, row)
+    }
+    progress(len(rows) - len(pending))
+
+    if opts.DryRun {
+        for _, row := range pending {
+            row.Status = DIDImportAdded
+        }
+        progress(len(pending))
+        return report, nil
+    }
+
+    tx, err := dm.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    var added []string
+    for start := 0; start < len(pending); start += didImportBatch {
+        if ctx.Err() != nil {
+            report.Cancelled = true
+            break
+        }
+        end := start + didImportBatch
+        if end > len(pending) {
+            end = len(pending)
+        }
+        batch := pending[start:end]
+
+        if err := insertDIDs(ctx, tx, batch, opts); err != nil {
+            if ctx.Err() != nil {
+                report.Cancelled = true
+                break
+            }
+            if lostTransaction(err) {
+                return nil, importAborted(err, batch[0])
+            }
+            // Find the rows the batch failed on, MySQL keeps the transaction
+            // through a failed statement
+            for _, row := range batch {
+                if err := insertDIDs(ctx, tx, []*DIDImportRow{row}, opts); err != nil {
+                    if lostTransaction(err) {
+                        return nil, importAborted(err, row)
+                    }
+                    row.Status, row.Problem = DIDImportFailed, err.Error()
+                    continue
+                }
+                row.Status = DIDImportAdded
+                added = append(added, row.DID.Number)
+            }
+        } else {
+            for _, row := range batch {
+                row.Status = DIDImportAdded
+                added = append(added, row.DID.Number)
+            }
+        }
+        progress(len(batch))
+    }
+
+    if report.Cancelled {
+        for _, row := range pending {
+            if row.Status == DIDImportAdded {
+                row.Status = DIDImportRolledBack
+            }
+        }
+        return report, nil
+    }
+
+    // Recycled numbers wait out their quarantine before they rotate
+    if report.Quarantined, err = dm.ActivateDIDs(ctx, tx, added, "import", opts.User); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    dm.cache.Delete(ctx, "did:stats")
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "provider":    opts.Provider,
+        "rows":        len(rows),
+        "added":       len(added),
+        "quarantined": report.Quarantined,
+        "user":        opts.User,
+    }).Info("DIDs imported")
+    return report, nil
+}
+
+// lostTransaction reports whether err took the import's transaction with it:
+// MySQL rolls a deadlocked transaction back, a dropped connection loses it.
+// Rows inserted after that would not be part of what gets committed.
+func lostTransaction(err error) bool {
+    switch db.Classify(err) {
+    case db.ClassDeadlock, db.ClassConnection:
+        return true
+    }
+    return false
+}
+
+// importAborted is the error of an import whose transaction was lost at row,
+// none of its DIDs were added
+func importAborted(err error, row *DIDImportRow) error {
+    return errors.Wrap(err, errors.ErrDatabase, "DID import aborted, no DIDs were added").
+        WithContext("line", row.Line).
+        WithContext("class", db.Classify(err))
+}
+
+// poolNumbers returns the numbers of the pool, normalized
+func (dm *DIDManager) poolNumbers(ctx context.Context) (map[string]bool, error) {
+    rows, err := dm.db.QueryContext(ctx, "SELECT number FROM dids")
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DIDs")
+    }
+    defer rows.Close()
+
+    numbers := make(map[string]bool)
+    for rows.Next() {
+        var number string
+        if err := rows.Scan(&number); err != nil {
+            continue
+        }
+        numbers[numbering.Normalize(number)] = true
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DIDs")
+    }
+    return numbers, nil
+}
+
+// insertDIDs adds the rows to the pool with a single INSERT
+func insertDIDs(ctx context.Context, tx *sql.Tx, rows []*DIDImportRow, opts DIDImportOptions) error {
+    query := `
+        INSERT INTO dids (number, provider_name, in_use, country, city, rate_center,
+                          monthly_cost, per_minute_cost, currency, is_test)
+        VALUES ` + strings.TrimSuffix(strings.Repeat("(?, ?, 0, ?, ?, ?, ?, ?, ?, ?), ", len(rows)), ", ")
+    args := make([]interface{}, 0, len(rows)*9)
+    for _, row := range rows {
+        did := row.DID
+        args = append(args, did.Number, opts.Provider, nullString(did.Country), nullString(did.City),
+            nullString(did.RateCenter), did.MonthlyCost, did.PerMinuteCost, nullString(did.Currency), opts.IsTest)
+    }
+    _, err := tx.ExecContext(ctx, query, args...)
+    return err
+}
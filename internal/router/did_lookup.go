@@ -0,0 +1,173 @@
+package router
+
+import (
+    "context"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// lookupCallColumns are the call_records columns of every leg of a call
+const lookupCallColumns = `call_id, original_ani, original_dnis,
+            COALESCE(transformed_ani, ''), COALESCE(assigned_did, ''),
+            COALESCE(inbound_provider, ''), COALESCE(intermediate_provider, ''), COALESCE(final_provider, ''),
+            COALESCE(route_name, ''), status, COALESCE(current_step, ''), COALESCE(failure_reason, ''),
+            start_time, answer_time, end_time, COALESCE(duration, 0), COALESCE(billable_duration, 0),
+            COALESCE(intermediate_billable_duration, 0), COALESCE(final_billable_duration, 0),
+            COALESCE(sip_response_code, 0), COALESCE(hangup_cause, 0), COALESCE(dial_status, ''),
+            COALESCE(is_test, 0), COALESCE(disposition, '')`
+
+// LookupDIDCalls returns the calls that held a DID at a moment with all their
+// legs: allocations in the usage log overlapping the window either side of at,
+// and calls still in progress that had taken the DID by then. A zero at looks
+// up the call using the DID right now, on this instance or any other.
+func (r *Router) LookupDIDCalls(ctx context.Context, number string, at time.Time, window time.Duration) (*models.DIDCallLookup, error) {
+    lookup := &models.DIDCallLookup{
+        Number: strings.TrimSpace(number),
+        At:     at,
+        Window: window.String(),
+        Live:   at.IsZero(),
+    }
+    if lookup.Live {
+        lookup.At = time.Now()
+    }
+    from, to := lookup.At.Add(-window), lookup.At.Add(window)
+
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT `+didUsageColumns+`
+        FROM did_usage_log
+        WHERE did_number = ? AND released_at >= ? AND (allocated_at IS NULL OR allocated_at <= ?)
+        ORDER BY released_at`, lookup.Number, from, to)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DID usage")
+    }
+    usage, err := r.scanDIDUsage(ctx, rows)
+    rows.Close()
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DID usage")
+    }
+
+    byCall := make(map[string]*models.DIDCallMatch)
+    var callIDs []string
+    for _, u := range usage {
+        m := &models.DIDCallMatch{
+            Usage: u,
+            Exact: (u.AllocatedAt == nil || !u.AllocatedAt.After(lookup.At)) && !u.ReleasedAt.Before(lookup.At),
+        }
+        byCall[u.CallID] = m
+        lookup.Matches = append(lookup.Matches, m)
+        callIDs = append(callIDs, u.CallID)
+    }
+
+    // The legs of logged allocations, unless their call records were pruned
+    if len(callIDs) > 0 {
+        calls, err := r.queryLookupCalls(ctx, "call_id IN (?"+strings.Repeat(", ?", len(callIDs)-1)+")", stringArgs(callIDs)...)
+        if err != nil {
+            return nil, err
+        }
+        for _, call := range calls {
+            if m, ok := byCall[call.CallID]; ok {
+                m.Call = call
+            }
+        }
+    }
+
+    // Calls in progress aren't in the usage log until they release the DID
+    active, err := r.queryLookupCalls(ctx, "assigned_did = ? AND status IN ("+activeCallStatuses+") AND start_time <= ?",
+        lookup.Number, to)
+    if err != nil {
+        return nil, err
+    }
+    if callID := r.didManager.GetCallIDByDID(lookup.Number); callID != "" {
+        // The in-memory record of a call on this instance is the freshest
+        if record, ok := r.activeCalls.Get(callID); ok && !record.StartTime.After(to) {
+            active = append(active, record)
+        }
+    }
+    for _, call := range active {
+        m, ok := byCall[call.CallID]
+        if !ok {
+            m = &models.DIDCallMatch{}
+            byCall[call.CallID] = m
+            lookup.Matches = append(lookup.Matches, m)
+        }
+        if m.Usage == nil {
+            m.Call = call
+            m.Active = true
+            m.Exact = !call.StartTime.After(lookup.At)
+        }
+    }
+
+    sort.SliceStable(lookup.Matches, func(i, j int) bool {
+        if lookup.Matches[i].Exact != lookup.Matches[j].Exact {
+            return lookup.Matches[i].Exact
+        }
+        return matchStart(lookup.Matches[i]).Before(matchStart(lookup.Matches[j]))
+    })
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "did":     lookup.Number,
+        "at":      lookup.At,
+        "window":  lookup.Window,
+        "matches": len(lookup.Matches),
+    }).Debug("DID call lookup")
+
+    return lookup, nil
+}
+
+// queryLookupCalls returns the call records matching a condition with the
+// details of every leg
+func (r *Router) queryLookupCalls(ctx context.Context, condition string, args ...interface{}) ([]*models.CallRecord, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT `+lookupCallColumns+`
+        FROM call_records
+        WHERE `+condition, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query calls")
+    }
+    defer rows.Close()
+
+    var calls []*models.CallRecord
+    for rows.Next() {
+        var call models.CallRecord
+        err := rows.Scan(
+            &call.CallID, &call.OriginalANI, &call.OriginalDNIS,
+            &call.TransformedANI, &call.AssignedDID,
+            &call.InboundProvider, &call.IntermediateProvider, &call.FinalProvider,
+            &call.RouteName, &call.Status, &call.CurrentStep, &call.FailureReason,
+            &call.StartTime, &call.AnswerTime, &call.EndTime, &call.Duration, &call.BillableDuration,
+            &call.IntermediateBillable, &call.FinalBillable,
+            &call.SIPResponseCode, &call.HangupCause, &call.DialStatus,
+            &call.IsTest, &call.Disposition,
+        )
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to scan call record")
+            continue
+        }
+        calls = append(calls, &call)
+    }
+    return calls, rows.Err()
+}
+
+// matchStart is when the call of a match took the DID
+func matchStart(m *models.DIDCallMatch) time.Time {
+    if m.Usage != nil && m.Usage.AllocatedAt != nil {
+        return *m.Usage.AllocatedAt
+    }
+    if m.Call != nil {
+        return m.Call.StartTime
+    }
+    return time.Time{}
+}
+
+func stringArgs(values []string) []interface{} {
+    args := make([]interface{}, len(values))
+    for i, v := range values {
+        args[i] = v
+    }
+    return args
+}
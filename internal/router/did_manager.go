@@ -7,62 +7,93 @@ import (
     "sync"
     "time"
     
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
     "github.com/hamzaKhattat/ara-production-system/pkg/errors"
 )
 
 // DIDManager handles DID allocation and management
 type DIDManager struct {
-    db    *sql.DB
-    cache CacheInterface
+    db      *sql.DB
+    cache   CacheInterface
+    metrics MetricsInterface
+    fx      *FXRates
+    aging    DIDAgingConfig
+    rotation DIDRotationConfig
     
     mu         sync.RWMutex
     didToCall  map[string]string // DID -> CallID mapping
 }
 
 // NewDIDManager creates a new DID manager
-func NewDIDManager(db *sql.DB, cache CacheInterface) *DIDManager {
+func NewDIDManager(db *sql.DB, cache CacheInterface, metrics MetricsInterface, fx *FXRates, aging DIDAgingConfig,
+    rotation DIDRotationConfig) *DIDManager {
     return &DIDManager{
         db:        db,
         cache:     cache,
+        metrics:   metrics,
+        fx:        fx,
+        aging:     aging,
+        rotation:  rotation,
         didToCall: make(map[string]string),
     }
 }
 
-// AllocateDID allocates a DID for a call
-func (dm *DIDManager) AllocateDID(ctx context.Context, tx *sql.Tx, providerName, destination string) (string, error) {
+// AllocateDID allocates a DID for a call. Test DIDs are reserved for test
+// calls, which prefer them but fall back to production DIDs. DIDs cooling
+// down or at their hourly limit under the rotation policy are skipped.
+func (dm *DIDManager) AllocateDID(ctx context.Context, tx *sql.Tx, providerName, destination string, testMode bool) (string, error) {
+    start := time.Now()
+    
     // Use distributed lock to prevent race conditions
     lockKey := fmt.Sprintf("did:allocation:%s", providerName)
     unlock, err := dm.cache.Lock(ctx, lockKey, 5*time.Second)
     if err != nil {
+        dm.observeAllocation(providerName, start, "lock")
         return "", errors.Wrap(err, errors.ErrInternal, "failed to acquire DID lock")
     }
     defer unlock()
     
+    testFilter, testOrder := " AND COALESCE(is_test, 0) = 0", ""
+    if testMode {
+        testFilter, testOrder = "", "COALESCE(is_test, 0) DESC, "
+    }
+    
+    rotationFilter, rotationArgs := dm.rotation.filter()
+    
     // Try to get DID for specific provider first
     query := `
         SELECT number 
         FROM dids 
-        WHERE in_use = 0 AND provider_name = ?
-        ORDER BY last_used_at ASC, RAND()
+        WHERE ` + availableDID + ` AND provider_name = ?` + testFilter + rotationFilter + `
+        ORDER BY ` + testOrder + dm.rotation.order() + `
         LIMIT 1
         FOR UPDATE`
     
     var did string
-    err = tx.QueryRowContext(ctx, query, providerName).Scan(&did)
+    err = tx.QueryRowContext(ctx, query, append([]interface{}{providerName}, rotationArgs...)...).Scan(&did)
     
     if err == sql.ErrNoRows {
         // Try any available DID
         err = tx.QueryRowContext(ctx, `
             SELECT number 
             FROM dids 
-            WHERE in_use = 0
-            ORDER BY last_used_at ASC, RAND()
+            WHERE `+availableDID+testFilter+rotationFilter+`
+            ORDER BY `+testOrder+dm.rotation.order()+`
             LIMIT 1
-            FOR UPDATE`).Scan(&did)
+            FOR UPDATE`, rotationArgs...).Scan(&did)
     }
     
     if err != nil {
+        reason := "exhausted"
+        switch {
+        case err != sql.ErrNoRows:
+            reason = "database"
+        case dm.heldBack(ctx, tx, testFilter):
+            dm.observeAllocation(providerName, start, "rotation")
+            return "", errors.New(errors.ErrDIDNotAvailable, "no DIDs available under the rotation policy")
+        }
+        dm.observeAllocation(providerName, start, reason)
         return "", errors.New(errors.ErrDIDNotAvailable, "no available DIDs")
     }
     
@@ -72,27 +103,46 @@ func (dm *DIDManager) AllocateDID(ctx context.Context, tx *sql.Tx, providerName,
         SET in_use = 1, 
             destination = ?, 
             allocation_time = NOW(),
-            usage_count = COALESCE(usage_count, 0) + 1,
+            usage_count = COALESCE(usage_count, 0) + 1,` + didAllocationCounters + `
             updated_at = NOW()
         WHERE number = ?`
     
     if _, err := tx.ExecContext(ctx, updateQuery, destination, did); err != nil {
+        dm.observeAllocation(providerName, start, "database")
         return "", errors.Wrap(err, errors.ErrDatabase, "failed to allocate DID")
     }
+    dm.observeAllocation(providerName, start, "")
     
     // Clear DID cache
-    dm.cache.Delete(ctx, fmt.Sprintf("did:%s", did))
-    dm.cache.Delete(ctx, "did:stats")
+    dm.cache.Delete(ctx, "did:"+did, "did:stats")
     
     logger.WithContext(ctx).WithFields(map[string]interface{}{
         "did": did,
         "provider": providerName,
         "destination": destination,
+        "test": testMode,
     }).Debug("DID allocated")
     
     return did, nil
 }
 
+// observeAllocation records how long an allocation took, and why it failed
+// unless reason is empty: lock, exhausted, rotation or database
+func (dm *DIDManager) observeAllocation(providerName string, start time.Time, reason string) {
+    result := "allocated"
+    if reason != "" {
+        result = "failed"
+        dm.metrics.IncrementCounter("router_did_allocation_failures", map[string]string{
+            "provider": providerName,
+            "reason":   reason,
+        })
+    }
+    dm.metrics.ObserveHistogram("router_did_allocation_duration", time.Since(start).Seconds(), map[string]string{
+        "provider": providerName,
+        "result":   result,
+    })
+}
+
 // ReleaseDID releases a DID back to the pool
 func (dm *DIDManager) ReleaseDID(ctx context.Context, tx *sql.Tx, did string) error {
     if did == "" {
@@ -136,6 +186,21 @@ func (dm *DIDManager) UnregisterCallDID(did string) {
     delete(dm.didToCall, did)
 }
 
+// UnregisterCall removes the DID-to-Call mappings of a call, that of the
+// second intermediate of a parallel dial still ringing and those of the hops
+// it was handed to included
+func (dm *DIDManager) UnregisterCall(record *models.CallRecord) {
+    dm.mu.Lock()
+    defer dm.mu.Unlock()
+    delete(dm.didToCall, record.AssignedDID)
+    for _, leg := range record.PendingLegs() {
+        delete(dm.didToCall, leg.AssignedDID)
+    }
+    for _, hop := range record.HopLegs {
+        delete(dm.didToCall, hop.DID)
+    }
+}
+
 // GetCallIDByDID returns the call ID associated with a DID
 func (dm *DIDManager) GetCallIDByDID(did string) string {
     dm.mu.RLock()
@@ -269,7 +334,7 @@ func (dm *DIDManager) GetDIDDetails(ctx context.Context, did string) (map[string
 // GetAvailableDIDCount returns the count of available DIDs
 func (dm *DIDManager) GetAvailableDIDCount(ctx context.Context, providerName string) (int, error) {
     var count int
-    query := "SELECT COUNT(*) FROM dids WHERE in_use = 0"
+    query := "SELECT COUNT(*) FROM dids WHERE " + availableDID
     args := []interface{}{}
     
     if providerName != "" {
@@ -313,6 +378,62 @@ func (dm *DIDManager) CleanupStaleDIDs(ctx context.Context, timeout time.Duratio
     return nil
 }
 
+// ReleaseOrphanedDID releases a DID still in use by an allocation made before
+// the given time, reporting whether it did. A DID reallocated since is kept.
+func (dm *DIDManager) ReleaseOrphanedDID(ctx context.Context, did string, allocatedBefore time.Time) (bool, error) {
+    query := `
+        UPDATE dids 
+        SET in_use = 0, 
+            destination = NULL,
+            allocation_time = NULL,
+            released_at = NOW(),
+            last_used_at = NOW(),
+            updated_at = NOW()
+        WHERE number = ? AND in_use = 1
+        AND (allocation_time IS NULL OR allocation_time < ?)`
+    
+    result, err := dm.db.ExecContext(ctx, query, did, allocatedBefore)
+    if err != nil {
+        return false, errors.Wrap(err, errors.ErrDatabase, "failed to release DID")
+    }
+    
+    rows, _ := result.RowsAffected()
+    if rows == 0 {
+        return false, nil
+    }
+    
+    dm.UnregisterCallDID(did)
+    dm.cache.Delete(ctx, fmt.Sprintf("did:%s", did))
+    dm.cache.Delete(ctx, "did:stats")
+    return true, nil
+}
+
+// updatePoolMetrics sets the available and in use DIDs of each provider's pool
+func (dm *DIDManager) updatePoolMetrics(ctx context.Context) {
+    rows, err := dm.db.QueryContext(ctx, `
+        SELECT provider_name,
+               COALESCE(SUM(CASE WHEN `+availableDID+` THEN 1 ELSE 0 END), 0),
+               COALESCE(SUM(CASE WHEN in_use = 1 THEN 1 ELSE 0 END), 0)
+        FROM dids
+        GROUP BY provider_name`)
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Debug("Failed to query DID pool metrics")
+        return
+    }
+    defer rows.Close()
+    
+    for rows.Next() {
+        var provider string
+        var available, inUse int
+        if err := rows.Scan(&provider, &available, &inUse); err != nil {
+            continue
+        }
+        labels := map[string]string{"provider": provider}
+        dm.metrics.SetGauge("did_pool_available", float64(available), labels)
+        dm.metrics.SetGauge("did_pool_in_use", float64(inUse), labels)
+    }
+}
+
 // GetProviderDIDUtilization returns DID utilization by provider
 func (dm *DIDManager) GetProviderDIDUtilization(ctx context.Context) ([]map[string]interface{}, error) {
     query := `
@@ -0,0 +1,591 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// ManualOrderer queues DID orders for an operator to place with the supplier
+const ManualOrderer = "manual"
+
+// DIDProcurementConfig controls the DID pool watermark checks
+type DIDProcurementConfig struct {
+    Enabled  bool
+    Interval time.Duration // how often pools are checked against their watermarks
+}
+
+// DIDOrderer places DID orders with a supplier. Carrier APIs implement it and
+// are added with RegisterOrderer; pools name the orderer used for them.
+type DIDOrderer interface {
+    // Place submits an order and returns the supplier's reference. An empty
+    // reference leaves the order open for an operator to place.
+    Place(ctx context.Context, order *models.DIDOrder) (string, error)
+
+    // Fetch returns the numbers delivered for a submitted order that aren't
+    // in the pool yet, none while the supplier is still working on it
+    Fetch(ctx context.Context, order *models.DIDOrder) ([]string, error)
+}
+
+// manualOrderer leaves placing and delivering orders to operators
+type manualOrderer struct{}
+
+func (manualOrderer) Place(ctx context.Context, order *models.DIDOrder) (string, error) {
+    return "", nil
+}
+
+func (manualOrderer) Fetch(ctx context.Context, order *models.DIDOrder) ([]string, error) {
+    return nil, nil
+}
+
+// DIDProcurement orders numbers for DID pools running low and activates
+// delivered numbers into the pool
+type DIDProcurement struct {
+    db      *sql.DB
+    cache   CacheInterface
+    metrics MetricsInterface
+    dids    *DIDManager
+    config  DIDProcurementConfig
+
+    mu       sync.RWMutex
+    orderers map[string]DIDOrderer
+}
+
+// NewDIDProcurement creates a DID procurement manager with the manual orderer
+func NewDIDProcurement(db *sql.DB, cache CacheInterface, metrics MetricsInterface, dids *DIDManager, config DIDProcurementConfig) *DIDProcurement {
+    if config.Interval <= 0 {
+        config.Interval = 5 * time.Minute
+    }
+
+    return &DIDProcurement{
+        db:       db,
+        cache:    cache,
+        metrics:  metrics,
+        dids:     dids,
+        config:   config,
+        orderers: map[string]DIDOrderer{ManualOrderer: manualOrderer{}},
+    }
+}
+
+// RegisterOrderer makes an orderer available to watermarks and orders
+func (dp *DIDProcurement) RegisterOrderer(name string, orderer DIDOrderer) {
+    dp.mu.Lock()
+    dp.orderers[name] = orderer
+    dp.mu.Unlock()
+}
+
+func (dp *DIDProcurement) orderer(name string) (DIDOrderer, error) {
+    dp.mu.RLock()
+    defer dp.mu.RUnlock()
+    o, ok := dp.orderers[name]
+    if !ok {
+        return nil, errors.New(errors.ErrConfiguration, fmt.Sprintf("unknown DID orderer %q", name))
+    }
+    return o, nil
+}
+
+// SetWatermark creates or replaces the watermark of a pool
+func (dp *DIDProcurement) SetWatermark(ctx context.Context, w *models.DIDWatermark, user string) error {
+    if w.Orderer == "" {
+        w.Orderer = ManualOrderer
+    }
+    if w.MinAvailable < 0 || w.OrderQuantity <= 0 {
+        return errors.New(errors.ErrInternal, "a watermark needs a positive order quantity and a minimum of zero or more")
+    }
+    if _, err := dp.orderer(w.Orderer); err != nil {
+        return err
+    }
+
+    tx, err := dp.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `
+        INSERT INTO did_watermarks (provider_name, country, min_available, order_quantity, orderer, enabled)
+        VALUES (?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            min_available = VALUES(min_available),
+            order_quantity = VALUES(order_quantity),
+            orderer = VALUES(orderer),
+            enabled = VALUES(enabled)`,
+        w.ProviderName, w.Country, w.MinAvailable, w.OrderQuantity, w.Orderer, w.Enabled)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to set DID watermark")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "did_watermark",
+        EntityType: "provider",
+        EntityID:   w.ProviderName,
+        UserID:     user,
+        Action:     "set",
+        NewValue:   w,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+// ListWatermarks returns the watermarks of all pools
+func (dp *DIDProcurement) ListWatermarks(ctx context.Context) ([]*models.DIDWatermark, error) {
+    rows, err := dp.db.QueryContext(ctx, `
+        SELECT provider_name, country, min_available, order_quantity, orderer, enabled, updated_at
+        FROM did_watermarks
+        ORDER BY provider_name, country`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DID watermarks")
+    }
+    defer rows.Close()
+
+    var watermarks []*models.DIDWatermark
+    for rows.Next() {
+        var w models.DIDWatermark
+        if err := rows.Scan(&w.ProviderName, &w.Country, &w.MinAvailable, &w.OrderQuantity,
+            &w.Orderer, &w.Enabled, &w.UpdatedAt); err != nil {
+            continue
+        }
+        watermarks = append(watermarks, &w)
+    }
+    return watermarks, rows.Err()
+}
+
+// DeleteWatermark stops watching a pool
+func (dp *DIDProcurement) DeleteWatermark(ctx context.Context, provider, country, user string) error {
+    tx, err := dp.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    result, err := tx.ExecContext(ctx, "DELETE FROM did_watermarks WHERE provider_name = ? AND country = ?", provider, country)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete DID watermark")
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return errors.New(errors.ErrInternal, "DID watermark not found").WithContext("provider", provider)
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "did_watermark",
+        EntityType: "provider",
+        EntityID:   provider,
+        UserID:     user,
+        Action:     "delete",
+        Metadata:   map[string]interface{}{"country": country},
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+// CreateOrder records an order and places it with its orderer
+func (dp *DIDProcurement) CreateOrder(ctx context.Context, o *models.DIDOrder) error {
+    if o.Orderer == "" {
+        o.Orderer = ManualOrderer
+    }
+    if o.Quantity <= 0 {
+        return errors.New(errors.ErrInternal, "order quantity must be positive")
+    }
+    orderer, err := dp.orderer(o.Orderer)
+    if err != nil {
+        return err
+    }
+
+    o.Status = models.DIDOrderOpen
+    result, err := dp.db.ExecContext(ctx, `
+        INSERT INTO did_orders (provider_name, country, quantity, status, orderer, reason,
+            monthly_cost, per_minute_cost, currency, created_by)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+        o.ProviderName, o.Country, o.Quantity, o.Status, o.Orderer, nullString(o.Reason),
+        o.MonthlyCost, o.PerMinuteCost, nullString(o.Currency), nullString(o.CreatedBy))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to create DID order")
+    }
+    o.ID, _ = result.LastInsertId()
+
+    ref, placeErr := orderer.Place(ctx, o)
+    switch {
+    case placeErr != nil:
+        o.Status, o.Error = models.DIDOrderFailed, placeErr.Error()
+    case ref != "":
+        o.Status, o.Reference = models.DIDOrderSubmitted, ref
+    }
+    if o.Status != models.DIDOrderOpen {
+        if _, err := dp.db.ExecContext(ctx, "UPDATE did_orders SET status = ?, reference = ?, error = ? WHERE id = ?",
+            o.Status, nullString(o.Reference), nullString(o.Error), o.ID); err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to update DID order")
+        }
+    }
+
+    dp.metrics.IncrementCounter("router_did_orders", map[string]string{
+        "provider": o.ProviderName,
+        "status":   string(o.Status),
+    })
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "order":    o.ID,
+        "provider": o.ProviderName,
+        "country":  o.Country,
+        "quantity": o.Quantity,
+        "status":   o.Status,
+    }).Info("DID order created")
+
+    if placeErr != nil {
+        return errors.Wrap(placeErr, errors.ErrInternal, "failed to place DID order")
+    }
+    return nil
+}
+
+// GetOrder returns one order
+func (dp *DIDProcurement) GetOrder(ctx context.Context, id int64) (*models.DIDOrder, error) {
+    orders, err := dp.queryOrders(ctx, "WHERE id = ?", id)
+    if err != nil {
+        return nil, err
+    }
+    if len(orders) == 0 {
+        return nil, errors.New(errors.ErrInternal, "DID order not found").WithContext("id", id)
+    }
+    return orders[0], nil
+}
+
+// ListOrders returns the latest orders, pending ones only when pendingOnly is set
+func (dp *DIDProcurement) ListOrders(ctx context.Context, pendingOnly bool, limit int) ([]*models.DIDOrder, error) {
+    where := ""
+    if pendingOnly {
+        where = "WHERE status IN ('open', 'submitted')"
+    }
+    if limit <= 0 {
+        limit = 50
+    }
+    return dp.queryOrders(ctx, where+" ORDER BY id DESC LIMIT ?", limit)
+}
+
+// Submit records that an operator placed an open order with the supplier
+func (dp *DIDProcurement) Submit(ctx context.Context, id int64, reference, user string) error {
+    return dp.transition(ctx, id, models.DIDOrderSubmitted, reference, user)
+}
+
+// Cancel stops waiting for an order's numbers
+func (dp *DIDProcurement) Cancel(ctx context.Context, id int64, user string) error {
+    return dp.transition(ctx, id, models.DIDOrderCancelled, "", user)
+}
+
+func (dp *DIDProcurement) transition(ctx context.Context, id int64, status models.DIDOrderStatus, reference, user string) error {
+    o, err := dp.GetOrder(ctx, id)
+    if err != nil {
+        return err
+    }
+    if !o.Status.Pending() {
+        return errors.New(errors.ErrInternal, fmt.Sprintf("DID order is already %s", o.Status)).WithContext("id", id)
+    }
+    if reference == "" {
+        reference = o.Reference
+    }
+
+    tx, err := dp.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "UPDATE did_orders SET status = ?, reference = ? WHERE id = ?",
+        status, nullString(reference), id); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update DID order")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "did_order",
+        EntityType: "did_order",
+        EntityID:   fmt.Sprintf("%d", id),
+        UserID:     user,
+        Action:     string(status),
+        OldValue:   map[string]interface{}{"status": o.Status},
+        NewValue:   map[string]interface{}{"status": status, "reference": reference},
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    dp.metrics.IncrementCounter("router_did_orders", map[string]string{
+        "provider": o.ProviderName,
+        "status":   string(status),
+    })
+    return nil
+}
+
+// Deliver activates delivered numbers of a pending order into its pool, with
+// the order's provider, country and costs. Numbers already in the pool are
+// skipped; the order is delivered once its quantity has been activated.
+func (dp *DIDProcurement) Deliver(ctx context.Context, id int64, numbers []string, user string) (*models.DIDDelivery, error) {
+    o, err := dp.GetOrder(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+    if !o.Status.Pending() {
+        return nil, errors.New(errors.ErrInternal, fmt.Sprintf("DID order is already %s", o.Status)).WithContext("id", id)
+    }
+
+    tx, err := dp.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    stmt, err := tx.PrepareContext(ctx, `
+        INSERT IGNORE INTO dids (number, provider_name, country, in_use, monthly_cost, per_minute_cost, currency, metadata)
+        VALUES (?, ?, ?, 0, ?, ?, ?, JSON_OBJECT('did_order', ?))`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to prepare insert")
+    }
+    defer stmt.Close()
+
+    delivery := &models.DIDDelivery{Order: o}
+    var activated []string
+    seen := make(map[string]bool)
+    for _, number := range numbers {
+        number = strings.TrimSpace(number)
+        if number == "" || seen[number] {
+            continue
+        }
+        seen[number] = true
+
+        result, err := stmt.ExecContext(ctx, number, o.ProviderName, nullString(o.Country),
+            o.MonthlyCost, o.PerMinuteCost, nullString(o.Currency), o.ID)
+        if err != nil {
+            return nil, errors.Wrap(err, errors.ErrDatabase, "failed to activate DID").WithContext("number", number)
+        }
+        if n, _ := result.RowsAffected(); n == 0 {
+            delivery.Skipped = append(delivery.Skipped, number)
+            continue
+        }
+        activated = append(activated, number)
+    }
+    delivery.Activated = len(activated)
+
+    // Recycled numbers wait out their quarantine before they rotate
+    if delivery.Quarantined, err = dp.dids.ActivateDIDs(ctx, tx, activated, fmt.Sprintf("DID order %d", o.ID), user); err != nil {
+        return nil, err
+    }
+
+    o.Delivered += delivery.Activated
+    if o.Delivered >= o.Quantity {
+        o.Status = models.DIDOrderDelivered
+        now := time.Now()
+        o.DeliveredAt = &now
+    }
+    if _, err := tx.ExecContext(ctx, "UPDATE did_orders SET delivered = ?, status = ?, delivered_at = ? WHERE id = ?",
+        o.Delivered, o.Status, o.DeliveredAt, o.ID); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to update DID order")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "did_order",
+        EntityType: "did_order",
+        EntityID:   fmt.Sprintf("%d", o.ID),
+        UserID:     user,
+        Action:     "deliver",
+        NewValue:   map[string]interface{}{"activated": delivery.Activated, "delivered": o.Delivered, "status": o.Status},
+        Metadata:   map[string]interface{}{"skipped": len(delivery.Skipped)},
+    }); err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    dp.cache.Delete(ctx, "did:stats")
+    if o.Status == models.DIDOrderDelivered {
+        dp.metrics.IncrementCounter("router_did_orders", map[string]string{
+            "provider": o.ProviderName,
+            "status":   string(o.Status),
+        })
+    }
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "order":     o.ID,
+        "provider":  o.ProviderName,
+        "activated": delivery.Activated,
+        "skipped":   len(delivery.Skipped),
+        "held_back": delivery.Quarantined,
+        "status":    o.Status,
+    }).Info("DIDs activated from order")
+
+    return delivery, nil
+}
+
+// PoolAvailable counts the available production DIDs of a pool
+func (dp *DIDProcurement) PoolAvailable(ctx context.Context, provider, country string) (int, error) {
+    var count int
+    err := dp.db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM dids
+        WHERE `+availableDID+` AND COALESCE(is_test, 0) = 0 AND provider_name = ? AND (? = '' OR country = ?)`,
+        provider, country, country).Scan(&count)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to count available DIDs")
+    }
+    return count, nil
+}
+
+// RunChecks checks pools against their watermarks and collects orders
+// delivered by carrier APIs until the context ends
+func (dp *DIDProcurement) RunChecks(ctx context.Context) {
+    ticker := time.NewTicker(dp.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        dp.check(ctx)
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (dp *DIDProcurement) check(ctx context.Context) {
+    log := logger.WithContext(ctx)
+
+    // Only one router instance orders at a time
+    unlock, err := dp.cache.Lock(ctx, "did:procurement", 10*time.Minute)
+    if err != nil {
+        log.WithError(err).Debug("DID procurement check already running elsewhere")
+        return
+    }
+    defer unlock()
+
+    pending, err := dp.ListOrders(ctx, true, 1000)
+    if err != nil {
+        log.WithError(err).Warn("Failed to load DID orders")
+        return
+    }
+
+    ordered := make(map[string]bool)
+    for _, o := range pending {
+        ordered[o.ProviderName+"\x00"+o.Country] = true
+        if o.Status == models.DIDOrderSubmitted {
+            dp.collect(ctx, o)
+        }
+    }
+
+    watermarks, err := dp.ListWatermarks(ctx)
+    if err != nil {
+        log.WithError(err).Warn("Failed to load DID watermarks")
+        return
+    }
+
+    for _, w := range watermarks {
+        available, err := dp.PoolAvailable(ctx, w.ProviderName, w.Country)
+        if err != nil {
+            log.WithError(err).WithField("provider", w.ProviderName).Warn("Failed to count DID pool")
+            continue
+        }
+        dp.metrics.SetGauge("router_did_pool_available", float64(available), map[string]string{
+            "provider": w.ProviderName,
+            "country":  w.Country,
+        })
+
+        if !w.Enabled || available >= w.MinAvailable || ordered[w.ProviderName+"\x00"+w.Country] {
+            continue
+        }
+
+        o := &models.DIDOrder{
+            ProviderName: w.ProviderName,
+            Country:      w.Country,
+            Quantity:     w.OrderQuantity,
+            Orderer:      w.Orderer,
+            Reason:       fmt.Sprintf("%d available, below the watermark of %d", available, w.MinAvailable),
+            CreatedBy:    "watermark",
+        }
+        if err := dp.CreateOrder(ctx, o); err != nil {
+            log.WithError(err).WithField("provider", w.ProviderName).Error("ALERT: DID pool below watermark and the order failed")
+            continue
+        }
+
+        fields := map[string]interface{}{
+            "provider":  w.ProviderName,
+            "country":   w.Country,
+            "available": available,
+            "order":     o.ID,
+            "quantity":  o.Quantity,
+        }
+        if o.Status == models.DIDOrderOpen {
+            log.WithFields(fields).Error("ALERT: DID pool below watermark, order queued for an operator to place")
+        } else {
+            log.WithFields(fields).Warn("DID pool below watermark, order placed")
+        }
+    }
+}
+
+// collect activates the numbers a carrier API has delivered for an order
+func (dp *DIDProcurement) collect(ctx context.Context, o *models.DIDOrder) {
+    log := logger.WithContext(ctx).WithField("order", o.ID)
+
+    orderer, err := dp.orderer(o.Orderer)
+    if err != nil {
+        log.WithError(err).Warn("DID order has no orderer")
+        return
+    }
+    numbers, err := orderer.Fetch(ctx, o)
+    if err != nil {
+        log.WithError(err).Warn("Failed to fetch DID order delivery")
+        return
+    }
+    if len(numbers) == 0 {
+        return
+    }
+    if _, err := dp.Deliver(ctx, o.ID, numbers, o.Orderer); err != nil {
+        log.WithError(err).Error("ALERT: failed to activate delivered DIDs")
+    }
+}
+
+func (dp *DIDProcurement) queryOrders(ctx context.Context, where string, args ...interface{}) ([]*models.DIDOrder, error) {
+    rows, err := dp.db.QueryContext(ctx, `
+        SELECT id, provider_name, country, quantity, delivered, status, orderer,
+               COALESCE(reference, ''), COALESCE(reason, ''), monthly_cost, per_minute_cost,
+               COALESCE(currency, ''), COALESCE(error, ''), COALESCE(created_by, ''),
+               created_at, updated_at, delivered_at
+        FROM did_orders
+        `+where, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DID orders")
+    }
+    defer rows.Close()
+
+    var orders []*models.DIDOrder
+    for rows.Next() {
+        var o models.DIDOrder
+        var deliveredAt sql.NullTime
+        if err := rows.Scan(&o.ID, &o.ProviderName, &o.Country, &o.Quantity, &o.Delivered, &o.Status, &o.Orderer,
+            &o.Reference, &o.Reason, &o.MonthlyCost, &o.PerMinuteCost,
+            &o.Currency, &o.Error, &o.CreatedBy,
+            &o.CreatedAt, &o.UpdatedAt, &deliveredAt); err != nil {
+            continue
+        }
+        if deliveredAt.Valid {
+            o.DeliveredAt = &deliveredAt.Time
+        }
+        orders = append(orders, &o)
+    }
+    return orders, rows.Err()
+}
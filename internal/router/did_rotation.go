@@ -0,0 +1,207 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// Orders DIDs of the pool are allocated in
+const (
+    DIDOrderLeastRecent = "least_recent" // the DID released longest ago, ties at random
+    DIDOrderRoundRobin  = "round_robin"  // every DID of the pool in turn
+)
+
+// DIDRotationConfig keeps the same DIDs from being reused too aggressively.
+// Every allocation is counted on its DID whatever the policy, for the stats.
+type DIDRotationConfig struct {
+    MaxPerHour int           // allocations a DID takes in the hour from its first one, 0 for no limit
+    Cooldown   time.Duration // rest of a released DID before it is allocated again
+    Order      string        // DIDOrderLeastRecent or DIDOrderRoundRobin
+}
+
+// enforced reports whether the policy holds DIDs back from allocation
+func (c DIDRotationConfig) enforced() bool {
+    return c.MaxPerHour > 0 || c.Cooldown > 0
+}
+
+// filter is the condition the policy adds to allocation, with its arguments
+func (c DIDRotationConfig) filter() (string, []interface{}) {
+    var conditions []string
+    var args []interface{}
+    if c.Cooldown > 0 {
+        conditions = append(conditions, "(last_used_at IS NULL OR last_used_at <= NOW() - INTERVAL ? SECOND)")
+        args = append(args, int64(c.Cooldown.Seconds()))
+    }
+    if c.MaxPerHour > 0 {
+        conditions = append(conditions, "("+didHourOver+" OR hour_allocations < ?)")
+        args = append(args, c.MaxPerHour)
+    }
+    if len(conditions) == 0 {
+        return "", nil
+    }
+    return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// order is the ORDER BY of allocation, after test DIDs for test calls
+func (c DIDRotationConfig) order() string {
+    if c.Order == DIDOrderRoundRobin {
+        return "last_allocated_at ASC, number ASC"
+    }
+    return "last_used_at ASC, RAND()"
+}
+
+// didHourOver is the condition of DIDs whose allocation hour is over, or
+// that weren't allocated yet
+const didHourOver = "(hour_started_at IS NULL OR hour_started_at <= NOW() - INTERVAL 1 HOUR)"
+
+// didAllocationCounters count an allocation on its DID, in UPDATE dids SET.
+// MySQL assigns left to right: the hour is read before it restarts.
+const didAllocationCounters = `
+            last_allocated_at = NOW(6),
+            hour_allocations = CASE WHEN ` + didHourOver + ` THEN 1 ELSE COALESCE(hour_allocations, 0) + 1 END,
+            hour_started_at = CASE WHEN ` + didHourOver + ` THEN NOW() ELSE hour_started_at END,`
+
+// heldBack reports whether DIDs the rotation policy holds back could have
+// served an allocation that found none
+func (dm *DIDManager) heldBack(ctx context.Context, tx *sql.Tx, testFilter string) bool {
+    if !dm.rotation.enforced() {
+        return false
+    }
+    var n int
+    err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM dids WHERE "+availableDID+testFilter).Scan(&n)
+    return err == nil && n > 0
+}
+
+// DIDStatsOptions select the allocations the DID stats are computed on
+type DIDStatsOptions struct {
+    Period   time.Duration
+    Provider string // empty for the whole pool
+    Top      int    // most allocated DIDs listed
+}
+
+// didStatsBuckets are the upper bounds of the allocation ranges DIDs are
+// counted in, the last range is open
+var didStatsBuckets = []int64{0, 1, 5, 10, 25, 50, 100}
+
+// DIDStats shows how allocations spread over the DID pool in the period: the
+// allocations per DID, the DIDs most allocated and those the rotation policy
+// holds back right now. Allocations are counted from the usage log, those of
+// calls still up aren't in it yet.
+func (dm *DIDManager) DIDStats(ctx context.Context, opts DIDStatsOptions) (*models.DIDRotationStats, error) {
+    if opts.Period <= 0 {
+        return nil, errors.New(errors.ErrInternal, "DID stats period must be positive")
+    }
+    if opts.Top <= 0 {
+        opts.Top = 10
+    }
+
+    stats := &models.DIDRotationStats{
+        Until:      time.Now(),
+        Provider:   opts.Provider,
+        MaxPerHour: dm.rotation.MaxPerHour,
+        Cooldown:   dm.rotation.Cooldown.String(),
+        Order:      dm.rotation.Order,
+    }
+    stats.Since = stats.Until.Add(-opts.Period)
+
+    rows, err := dm.db.QueryContext(ctx, `
+        SELECT number, COALESCE(provider_name, ''), in_use, COUNT(u.id),
+               CASE WHEN `+didHourOver+` THEN 0 ELSE COALESCE(hour_allocations, 0) END,
+               COALESCE(in_use = 0 AND last_used_at > NOW() - INTERVAL ? SECOND, 0)
+        FROM dids
+        LEFT JOIN did_usage_log u ON u.did_number = dids.number AND COALESCE(u.allocated_at, u.released_at) >= ?
+        WHERE ? = '' OR provider_name = ?
+        GROUP BY number, provider_name, in_use, hour_started_at, hour_allocations, last_used_at`,
+        int64(dm.rotation.Cooldown.Seconds()), stats.Since, opts.Provider, opts.Provider)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DID allocations")
+    }
+    defer rows.Close()
+
+    var dids []*models.DIDAllocationCount
+    providers := make(map[string]*models.DIDProviderAllocations)
+    for rows.Next() {
+        did := &models.DIDAllocationCount{}
+        var inUse, cooling bool
+        if err := rows.Scan(&did.Number, &did.Provider, &inUse, &did.Allocations, &did.LastHour, &cooling); err != nil {
+            return nil, errors.Wrap(err, errors.ErrDatabase, "failed to scan DID allocations")
+        }
+        dids = append(dids, did)
+
+        p := providers[did.Provider]
+        if p == nil {
+            p = &models.DIDProviderAllocations{Provider: did.Provider}
+            providers[did.Provider] = p
+        }
+        p.DIDs++
+        p.Allocations += did.Allocations
+        if did.Allocations > p.Max {
+            p.Max = did.Allocations
+        }
+
+        if inUse {
+            stats.InUse++
+        }
+        if cooling && dm.rotation.Cooldown > 0 {
+            stats.CoolingDown++
+        }
+        if dm.rotation.MaxPerHour > 0 && did.LastHour >= int64(dm.rotation.MaxPerHour) {
+            stats.AtHourlyLimit++
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DID allocations")
+    }
+
+    stats.DIDs = len(dids)
+    stats.Buckets = make([]*models.DIDAllocationBucket, len(didStatsBuckets)+1)
+    for i := range stats.Buckets {
+        bucket := &models.DIDAllocationBucket{}
+        if i > 0 {
+            bucket.From = didStatsBuckets[i-1] + 1
+        }
+        if i < len(didStatsBuckets) {
+            max := didStatsBuckets[i]
+            bucket.To = &max
+        }
+        stats.Buckets[i] = bucket
+    }
+    for _, did := range dids {
+        stats.Allocations += did.Allocations
+        if did.Allocations > 0 {
+            stats.Used++
+        }
+        i := sort.Search(len(didStatsBuckets), func(i int) bool { return didStatsBuckets[i] >= did.Allocations })
+        stats.Buckets[i].DIDs++
+    }
+
+    sort.Slice(dids, func(i, j int) bool {
+        if dids[i].Allocations != dids[j].Allocations {
+            return dids[i].Allocations > dids[j].Allocations
+        }
+        return dids[i].Number < dids[j].Number
+    })
+    if len(dids) > 0 {
+        stats.Mean = float64(stats.Allocations) / float64(len(dids))
+        stats.Max = dids[0].Allocations
+        stats.Median = dids[len(dids)/2].Allocations
+        stats.P95 = dids[len(dids)*5/100].Allocations
+    }
+    for i := 0; i < len(dids) && i < opts.Top && dids[i].Allocations > 0; i++ {
+        stats.Top = append(stats.Top, dids[i])
+    }
+
+    for _, p := range providers {
+        stats.ByProvider = append(stats.ByProvider, p)
+    }
+    sort.Slice(stats.ByProvider, func(i, j int) bool {
+        return stats.ByProvider[i].Provider < stats.ByProvider[j].Provider
+    })
+    return stats, nil
+}
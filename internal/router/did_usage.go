@@ -0,0 +1,246 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "sort"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/db"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// ReleaseCallDID logs the allocation to did_usage_log and releases the DID.
+// The cost and revenue logged are those rateCall set on the record, in the
+// reporting currency so usage from providers invoicing in different
+// currencies adds up.
+func (dm *DIDManager) ReleaseCallDID(ctx context.Context, tx *sql.Tx, record *models.CallRecord) error {
+    if record.AssignedDID == "" {
+        return nil
+    }
+    
+    answered := record.Status == models.CallStatusCompleted || record.AnswerTime != nil
+    
+    _, err := tx.ExecContext(ctx, `
+        INSERT INTO did_usage_log (
+            did_number, call_id, route_name, inbound_provider, intermediate_provider,
+            final_provider, status, answered, allocated_at, released_at,
+            duration, billable_duration, cost, revenue, currency, is_test
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), ?, ?, ?, ?, ?, ?)`,
+        record.AssignedDID, record.CallID, record.RouteName, record.InboundProvider,
+        record.IntermediateProvider, record.FinalProvider, record.Status, answered,
+        record.StartTime, record.Duration, record.BillableDuration,
+        record.Cost, record.BilledAmount, dm.fx.Currency(), record.IsTest)
+    if db.IsRetryable(err) {
+        // The transaction was rolled back, the caller runs it again
+        return errors.Wrap(err, errors.ErrDatabase, "failed to log DID usage")
+    }
+    if err != nil {
+        // Losing a usage row must not keep the DID allocated
+        logger.WithContext(ctx).WithError(err).WithField("did", record.AssignedDID).Warn("Failed to log DID usage")
+    }
+    
+    // Legs still holding a DID, a second intermediate ringing or the hops of
+    // a serial fork, give it back with the call
+    for _, leg := range record.PendingLegs() {
+        if err := dm.ReleaseCallDID(ctx, tx, leg); err != nil {
+            return err
+        }
+    }
+    
+    // So do the hops of a route of several intermediates it was handed to
+    for _, leg := range record.ReachedHops() {
+        if err := dm.ReleaseCallDID(ctx, tx, leg); err != nil {
+            return err
+        }
+    }
+    
+    return dm.ReleaseDID(ctx, tx, record.AssignedDID)
+}
+
+// legRates returns the per minute rate of the call's DID and those of its
+// providers, keyed by name, in the reporting currency
+func (dm *DIDManager) legRates(ctx context.Context, tx *sql.Tx, record *models.CallRecord) (float64, map[string]float64) {
+    rates := make(map[string]float64, 3)
+    
+    var didRate float64
+    var didCurrency string
+    err := tx.QueryRowContext(ctx, "SELECT per_minute_cost, COALESCE(currency, '') FROM dids WHERE number = ?",
+        record.AssignedDID).Scan(&didRate, &didCurrency)
+    if err == nil {
+        didRate = dm.fx.Convert(ctx, didRate, didCurrency)
+    }
+    
+    rows, err := tx.QueryContext(ctx, `
+        SELECT name, cost_per_minute, COALESCE(currency, '')
+        FROM providers
+        WHERE name IN (?, ?, ?)`,
+        record.InboundProvider, record.IntermediateProvider, record.FinalProvider)
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to load provider rates")
+        return didRate, rates
+    }
+    defer rows.Close()
+    
+    for rows.Next() {
+        var name, currency string
+        var rate float64
+        if err := rows.Scan(&name, &rate, &currency); err != nil {
+            continue
+        }
+        rates[name] = dm.fx.Convert(ctx, rate, currency)
+    }
+    return didRate, rates
+}
+
+// GetDIDDetails returns a DID with its usage totals, per-route attribution and last calls.
+// Test calls only count towards the totals of test DIDs unless includeTest is set.
+func (r *Router) GetDIDDetails(ctx context.Context, number string, recent int, includeTest bool) (*models.DIDDetails, error) {
+    dids, _, err := r.didManager.queryDIDs(ctx, " WHERE number = ?", []interface{}{number}, models.ListOptions{Limit: 1})
+    if err != nil {
+        return nil, err
+    }
+    if len(dids) == 0 {
+        return nil, errors.New(errors.ErrDIDNotAvailable, "DID not found").WithContext("number", number)
+    }
+    
+    details := &models.DIDDetails{DID: dids[0]}
+    includeTest = includeTest || details.DID.IsTest
+    
+    summaries, err := r.queryDIDUsageSummaries(ctx, "''", number, includeTest)
+    if err != nil {
+        return nil, err
+    }
+    if len(summaries) > 0 {
+        details.Usage = *summaries[0]
+    }
+    
+    if details.ByRoute, err = r.queryDIDUsageSummaries(ctx, "COALESCE(route_name, '')", number, includeTest); err != nil {
+        return nil, err
+    }
+    
+    if details.Recent, err = r.queryDIDUsage(ctx, number, recent); err != nil {
+        return nil, err
+    }
+    
+    return details, nil
+}
+
+// queryDIDUsageSummaries sums the usage log per key. Rows logged while another
+// reporting currency was configured are converted to the current one.
+func (r *Router) queryDIDUsageSummaries(ctx context.Context, keyExpr, number string, includeTest bool) ([]*models.DIDUsageSummary, error) {
+    where := "WHERE did_number = ?"
+    if !includeTest {
+        where += " AND COALESCE(is_test, 0) = 0"
+    }
+    
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT `+keyExpr+` AS usage_key, COALESCE(currency, '') AS usage_currency, COUNT(*),
+            COALESCE(SUM(answered), 0), COALESCE(SUM(billable_duration), 0) / 60,
+            COALESCE(SUM(cost), 0), COALESCE(SUM(revenue), 0),
+            MIN(allocated_at), MAX(released_at)
+        FROM did_usage_log
+        `+where+`
+        GROUP BY usage_key, usage_currency`, number)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DID usage")
+    }
+    defer rows.Close()
+    
+    var summaries []*models.DIDUsageSummary
+    byKey := make(map[string]*models.DIDUsageSummary)
+    for rows.Next() {
+        var key, currency string
+        var allocations, answered int64
+        var minutes, cost, revenue float64
+        var firstUsed, lastUsed sql.NullTime
+        
+        if err := rows.Scan(&key, &currency, &allocations, &answered, &minutes,
+            &cost, &revenue, &firstUsed, &lastUsed); err != nil {
+            continue
+        }
+    
+        s, ok := byKey[key]
+        if !ok {
+            s = &models.DIDUsageSummary{Key: key, Currency: r.fx.Currency()}
+            byKey[key] = s
+            summaries = append(summaries, s)
+        }
+        s.Allocations += allocations
+        s.Answered += answered
+        s.TotalMinutes += minutes
+        s.Cost += r.fx.Convert(ctx, cost, currency)
+        s.Revenue += r.fx.Convert(ctx, revenue, currency)
+        if firstUsed.Valid && (s.FirstUsed == nil || firstUsed.Time.Before(*s.FirstUsed)) {
+            s.FirstUsed = &firstUsed.Time
+        }
+        if lastUsed.Valid && (s.LastUsed == nil || lastUsed.Time.After(*s.LastUsed)) {
+            s.LastUsed = &lastUsed.Time
+        }
+    }
+    
+    for _, s := range summaries {
+        if s.Allocations > 0 {
+            s.ASR = float64(s.Answered) / float64(s.Allocations) * 100
+        }
+        s.Margin = s.Revenue - s.Cost
+    }
+    sort.SliceStable(summaries, func(i, j int) bool {
+        return summaries[i].Allocations > summaries[j].Allocations
+    })
+    
+    return summaries, rows.Err()
+}
+
+func (r *Router) queryDIDUsage(ctx context.Context, number string, limit int) ([]*models.DIDUsage, error) {
+    if limit <= 0 {
+        limit = 10
+    }
+    
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT `+didUsageColumns+`
+        FROM did_usage_log
+        WHERE did_number = ?
+        ORDER BY released_at DESC
+        LIMIT ?`, number, limit)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query DID usage")
+    }
+    defer rows.Close()
+    
+    return r.scanDIDUsage(ctx, rows)
+}
+
+// didUsageColumns are the did_usage_log columns scanned by scanDIDUsage
+const didUsageColumns = `id, did_number, call_id, COALESCE(route_name, ''), COALESCE(inbound_provider, ''),
+            COALESCE(intermediate_provider, ''), COALESCE(final_provider, ''), COALESCE(status, ''),
+            answered, allocated_at, released_at, duration, billable_duration, cost, revenue,
+            COALESCE(currency, ''), COALESCE(is_test, 0)`
+
+func (r *Router) scanDIDUsage(ctx context.Context, rows *sql.Rows) ([]*models.DIDUsage, error) {
+    var usage []*models.DIDUsage
+    for rows.Next() {
+        var u models.DIDUsage
+        var allocatedAt sql.NullTime
+        
+        err := rows.Scan(&u.ID, &u.DIDNumber, &u.CallID, &u.RouteName, &u.InboundProvider,
+            &u.IntermediateProvider, &u.FinalProvider, &u.Status, &u.Answered,
+            &allocatedAt, &u.ReleasedAt, &u.Duration, &u.BillableDuration, &u.Cost, &u.Revenue,
+            &u.Currency, &u.IsTest)
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to scan DID usage")
+            continue
+        }
+        if allocatedAt.Valid {
+            u.AllocatedAt = &allocatedAt.Time
+        }
+        if u.Currency == "" {
+            u.Currency = r.fx.Currency()
+        }
+        
+        usage = append(usage, &u)
+    }
+    
+    return usage, rows.Err()
+}
@@ -0,0 +1,258 @@
+package router
+
+import (
+    "context"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+const dispositionCacheKey = "dispositions"
+
+func dispositionKey(source, code string) string {
+    return source + ":" + code
+}
+
+// hangupDisposition maps what Asterisk reported about the dialed leg to a
+// disposition. Answered and caller cancelled dial statuses are final, otherwise
+// the far end's SIP response is the most precise, then the Q.850 cause, then
+// the dial status Asterisk derived from them.
+func (r *Router) hangupDisposition(ctx context.Context, timing models.CallTiming) string {
+    mapping := r.dispositionMap(ctx)
+    status := strings.ToUpper(timing.DialStatus)
+
+    if status == "ANSWER" || status == "CANCEL" {
+        if d, ok := mapping[dispositionKey(models.DispositionSourceDialStatus, status)]; ok {
+            return d
+        }
+    }
+    if timing.SIPCode > 0 {
+        if d, ok := mapping[dispositionKey(models.DispositionSourceSIP, strconv.Itoa(timing.SIPCode))]; ok {
+            return d
+        }
+    }
+    if timing.HangupCause > 0 {
+        if d, ok := mapping[dispositionKey(models.DispositionSourceQ850, strconv.Itoa(timing.HangupCause))]; ok {
+            return d
+        }
+    }
+    if d, ok := mapping[dispositionKey(models.DispositionSourceDialStatus, status)]; ok {
+        return d
+    }
+    return models.DispositionUnknown
+}
+
+// dispositionMap returns the built-in mapping with the operator overrides
+// applied; when the overrides can't be read the built-in mapping is used
+func (r *Router) dispositionMap(ctx context.Context) map[string]string {
+    if cached, ok := r.dispositions.get(dispositionCacheKey); ok {
+        return cached.(map[string]string)
+    }
+
+    mapping := make(map[string]string, len(models.DefaultDispositionMappings))
+    for _, m := range models.DefaultDispositionMappings {
+        mapping[dispositionKey(m.Source, m.Code)] = m.Disposition
+    }
+
+    overrides, err := r.dispositionOverrides(ctx)
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to load disposition mapping overrides")
+        return mapping
+    }
+    for _, m := range overrides {
+        mapping[dispositionKey(m.Source, m.Code)] = m.Disposition
+    }
+
+    r.dispositions.set(dispositionCacheKey, mapping)
+    return mapping
+}
+
+func (r *Router) dispositionOverrides(ctx context.Context) ([]*models.DispositionMapping, error) {
+    rows, err := r.db.QueryContext(ctx, "SELECT source, code, disposition FROM disposition_map")
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query disposition mapping")
+    }
+    defer rows.Close()
+
+    var overrides []*models.DispositionMapping
+    for rows.Next() {
+        m := &models.DispositionMapping{Custom: true}
+        if err := rows.Scan(&m.Source, &m.Code, &m.Disposition); err != nil {
+            continue
+        }
+        overrides = append(overrides, m)
+    }
+    return overrides, rows.Err()
+}
+
+// ListDispositionMappings returns the mapping in effect, built-in codes an
+// operator overrode are flagged as custom
+func (r *Router) ListDispositionMappings(ctx context.Context) ([]*models.DispositionMapping, error) {
+    overrides, err := r.dispositionOverrides(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    custom := make(map[string]*models.DispositionMapping, len(overrides))
+    for _, m := range overrides {
+        custom[dispositionKey(m.Source, m.Code)] = m
+    }
+
+    var list []*models.DispositionMapping
+    for _, source := range models.DispositionSources {
+        for _, m := range models.DefaultDispositionMappings {
+            if m.Source != source {
+                continue
+            }
+            key := dispositionKey(m.Source, m.Code)
+            if override, ok := custom[key]; ok {
+                list = append(list, override)
+                delete(custom, key)
+                continue
+            }
+            mapping := m
+            list = append(list, &mapping)
+        }
+        for _, m := range overrides {
+            if _, ok := custom[dispositionKey(m.Source, m.Code)]; ok && m.Source == source {
+                list = append(list, m)
+            }
+        }
+    }
+    return list, nil
+}
+
+// SetDispositionMapping maps a code to a disposition, over the built-in mapping
+func (r *Router) SetDispositionMapping(ctx context.Context, mapping *models.DispositionMapping) error {
+    if err := normalizeDispositionMapping(mapping); err != nil {
+        return err
+    }
+
+    _, err := r.db.ExecContext(ctx, `
+        INSERT INTO disposition_map (source, code, disposition) VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE disposition = VALUES(disposition), updated_at = NOW()`,
+        mapping.Source, mapping.Code, mapping.Disposition)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to store disposition mapping")
+    }
+
+    r.cache.Invalidate(ctx, dispositionCacheKey)
+    return nil
+}
+
+// DeleteDispositionMapping removes an operator mapping, built-in codes go back
+// to their default disposition
+func (r *Router) DeleteDispositionMapping(ctx context.Context, source, code string) error {
+    mapping := &models.DispositionMapping{Source: source, Code: code, Disposition: models.DispositionUnknown}
+    if err := normalizeDispositionMapping(mapping); err != nil {
+        return err
+    }
+
+    result, err := r.db.ExecContext(ctx,
+        "DELETE FROM disposition_map WHERE source = ? AND code = ?", mapping.Source, mapping.Code)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete disposition mapping")
+    }
+
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return errors.New(errors.ErrInternal, "disposition mapping not found").
+            WithContext("source", mapping.Source).
+            WithContext("code", mapping.Code)
+    }
+
+    r.cache.Invalidate(ctx, dispositionCacheKey)
+    return nil
+}
+
+// normalizeDispositionMapping checks the mapping and puts its code in the form
+// hangupDisposition looks it up in
+func normalizeDispositionMapping(m *models.DispositionMapping) error {
+    m.Source = strings.ToLower(strings.TrimSpace(m.Source))
+    m.Code = strings.TrimSpace(m.Code)
+    m.Disposition = strings.ToLower(strings.TrimSpace(m.Disposition))
+
+    invalid := func(msg string) error {
+        return errors.New(errors.ErrInternal, msg).
+            WithContext("source", m.Source).
+            WithContext("code", m.Code)
+    }
+
+    switch m.Source {
+    case models.DispositionSourceSIP:
+        if code, err := strconv.Atoi(m.Code); err != nil || code < 100 || code > 699 {
+            return invalid("SIP codes are responses between 100 and 699")
+        }
+    case models.DispositionSourceQ850:
+        code, err := strconv.Atoi(m.Code)
+        if err != nil || code < 1 || code > 127 {
+            return invalid("Q.850 causes are between 1 and 127")
+        }
+        m.Code = strconv.Itoa(code)
+    case models.DispositionSourceDialStatus:
+        m.Code = strings.ToUpper(m.Code)
+        if m.Code == "" || strings.Trim(m.Code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+            return invalid("dial statuses are Asterisk DIALSTATUS values")
+        }
+    default:
+        return invalid("unknown code source, expected one of " + strings.Join(models.DispositionSources, ", "))
+    }
+
+    if !containsDisposition(m.Disposition) {
+        return errors.New(errors.ErrInternal, "unknown disposition").
+            WithContext("disposition", m.Disposition)
+    }
+    return nil
+}
+
+func containsDisposition(disposition string) bool {
+    for _, d := range models.Dispositions {
+        if d == disposition {
+            return true
+        }
+    }
+    return false
+}
+
+// DispositionReport counts the production calls started since the given time
+// per disposition, optionally for the calls one provider carried on any leg
+func (r *Router) DispositionReport(ctx context.Context, since time.Time, providerName string) ([]*models.DispositionCount, error) {
+    query := `
+        SELECT COALESCE(disposition, ?), COUNT(*)
+        FROM call_records
+        WHERE start_time >= ? AND COALESCE(is_test, 0) = 0`
+    args := []interface{}{models.DispositionUnknown, since}
+    if providerName != "" {
+        query += " AND (inbound_provider = ? OR intermediate_provider = ? OR final_provider = ?)"
+        args = append(args, providerName, providerName, providerName)
+    }
+    query += " GROUP BY 1 ORDER BY 2 DESC"
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query dispositions")
+    }
+    defer rows.Close()
+
+    var counts []*models.DispositionCount
+    total := 0
+    for rows.Next() {
+        var c models.DispositionCount
+        if err := rows.Scan(&c.Disposition, &c.Calls); err != nil {
+            continue
+        }
+        total += c.Calls
+        counts = append(counts, &c)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read dispositions")
+    }
+
+    for _, c := range counts {
+        c.Share = float64(c.Calls) * 100 / float64(total)
+    }
+    return counts, nil
+}
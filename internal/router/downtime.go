@@ -0,0 +1,261 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "sort"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// ListDowntime returns the provider and system downtime overlapping the
+// filter's period, oldest first, cut to the period. Provider downtime runs
+// from the health check that marked the provider down to the one that marked
+// it up again. System downtime is each stretch the router held back new
+// calls: an Asterisk restart pause of any node, recorded once calls resumed,
+// or a global kill switch. It is left out when a provider is asked for.
+func (r *Router) ListDowntime(ctx context.Context, filter models.DowntimeFilter) ([]*models.Downtime, error) {
+    if filter.Until.IsZero() {
+        filter.Until = time.Now()
+    }
+    if !filter.Since.Before(filter.Until) {
+        return nil, errors.New(errors.ErrInternal, "downtime period must end after it starts")
+    }
+
+    var list []*models.Downtime
+    if filter.Scope != models.DowntimeSystem {
+        outages, err := r.healthOutages(ctx, filter.Since, filter.Until, filter.Provider)
+        if err != nil {
+            return nil, err
+        }
+        for _, downtime := range outages {
+            list = append(list, downtime...)
+        }
+    }
+    if filter.Scope != models.DowntimeProvider && filter.Provider == "" {
+        system, err := r.systemDowntime(ctx, filter.Since, filter.Until)
+        if err != nil {
+            return nil, err
+        }
+        list = append(list, system...)
+    }
+
+    sort.SliceStable(list, func(i, j int) bool {
+        if list[i].Start.Equal(list[j].Start) {
+            return list[i].Entity < list[j].Entity
+        }
+        return list[i].Start.Before(list[j].Start)
+    })
+    return list, nil
+}
+
+// ProviderReliability works out the failures, MTTR and MTBF of each provider
+// down at some point of the period, or of one provider
+func (r *Router) ProviderReliability(ctx context.Context, since, until time.Time, provider string) (map[string]models.Reliability, error) {
+    outages, err := r.healthOutages(ctx, since, until, provider)
+    if err != nil {
+        return nil, err
+    }
+
+    result := make(map[string]models.Reliability, len(outages))
+    for name, downtime := range outages {
+        var seconds int64
+        for _, d := range downtime {
+            seconds += d.Seconds
+        }
+        result[name] = reliability(len(downtime), seconds, until.Sub(since))
+    }
+    return result, nil
+}
+
+// reliability summarises the failures of a period. A provider down when the
+// period starts counts that outage as a failure of the period.
+func reliability(failures int, downtimeSeconds int64, period time.Duration) models.Reliability {
+    rel := models.Reliability{Failures: failures, DowntimeSeconds: downtimeSeconds}
+    if failures == 0 {
+        return rel
+    }
+
+    mttr := downtimeSeconds / int64(failures)
+    rel.MTTRSeconds = &mttr
+    up := int64(period.Seconds()) - downtimeSeconds
+    if up < 0 {
+        up = 0
+    }
+    mtbf := up / int64(failures)
+    rel.MTBFSeconds = &mtbf
+    return rel
+}
+
+// healthOutages derives the downtime of each provider, or of one, from its
+// health events between start and end, taking the state it was in at start.
+// Outages are cut to the period; one still going on at end has no end.
+func (r *Router) healthOutages(ctx context.Context, start, end time.Time, provider string) (map[string][]*models.Downtime, error) {
+    where := ""
+    var args []interface{}
+    if provider != "" {
+        where = " AND provider_name = ?"
+        args = append(args, provider)
+    }
+    downSince := make(map[string]time.Time)
+
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT e.provider_name, e.event_type
+        FROM provider_events e
+        JOIN (
+            SELECT provider_name, MAX(id) AS id
+            FROM provider_events
+            WHERE event_type IN (?, ?) AND created_at < ?`+where+`
+            GROUP BY provider_name
+        ) last ON last.id = e.id`,
+        append([]interface{}{models.ProviderEventHealthDown, models.ProviderEventHealthUp, start}, args...)...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query provider health")
+    }
+    for rows.Next() {
+        var name, event string
+        if rows.Scan(&name, &event) == nil && event == models.ProviderEventHealthDown {
+            downSince[name] = start
+        }
+    }
+    rows.Close()
+
+    rows, err = r.db.QueryContext(ctx, `
+        SELECT provider_name, event_type, created_at
+        FROM provider_events
+        WHERE event_type IN (?, ?) AND created_at >= ? AND created_at < ?`+where+`
+        ORDER BY created_at, id`,
+        append([]interface{}{models.ProviderEventHealthDown, models.ProviderEventHealthUp, start, end}, args...)...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query provider health")
+    }
+    defer rows.Close()
+
+    outages := make(map[string][]*models.Downtime)
+    closeOutage := func(name string, at *time.Time) {
+        since, down := downSince[name]
+        if !down {
+            return
+        }
+        to := end
+        if at != nil {
+            to = *at
+        }
+        outages[name] = append(outages[name], &models.Downtime{
+            Scope:   models.DowntimeProvider,
+            Entity:  name,
+            Cause:   models.ProviderEventHealthDown,
+            Start:   since,
+            End:     at,
+            Seconds: int64(to.Sub(since).Seconds()),
+        })
+        delete(downSince, name)
+    }
+
+    for rows.Next() {
+        var name, event string
+        var at time.Time
+        if err := rows.Scan(&name, &event, &at); err != nil {
+            continue
+        }
+        switch event {
+        case models.ProviderEventHealthDown:
+            if _, down := downSince[name]; !down {
+                downSince[name] = at
+            }
+        case models.ProviderEventHealthUp:
+            closeOutage(name, &at)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read provider health")
+    }
+
+    // Still down when the period ends
+    for name := range downSince {
+        closeOutage(name, nil)
+    }
+    return outages, nil
+}
+
+// systemDowntime returns the recorded stretches without new calls that
+// overlap the period, and the global kill switch still stored
+func (r *Router) systemDowntime(ctx context.Context, start, end time.Time) ([]*models.Downtime, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT cause, entity, COALESCE(reason, ''), started_at, ended_at
+        FROM system_downtime
+        WHERE started_at < ? AND ended_at > ?
+        ORDER BY started_at, id`,
+        end, start)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query system downtime")
+    }
+    defer rows.Close()
+
+    var list []*models.Downtime
+    for rows.Next() {
+        d := &models.Downtime{Scope: models.DowntimeSystem}
+        var ended time.Time
+        if err := rows.Scan(&d.Cause, &d.Entity, &d.Reason, &d.Start, &ended); err != nil {
+            continue
+        }
+        list = append(list, clipDowntime(d, start, end, &ended))
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read system downtime")
+    }
+
+    // Recorded on release, or on being engaged again
+    switches, err := r.killSwitches.query(ctx, "WHERE scope = ?", models.BlockScopeGlobal)
+    if err != nil {
+        return nil, err
+    }
+    now := time.Now()
+    for _, k := range switches {
+        var ended *time.Time
+        if !k.Active(now) {
+            ended = k.ExpiresAt
+        }
+        if !k.EngagedAt.Before(end) || (ended != nil && !ended.After(start)) {
+            continue
+        }
+        list = append(list, clipDowntime(&models.Downtime{
+            Scope:  models.DowntimeSystem,
+            Cause:  models.DowntimeKillSwitch,
+            Reason: k.Reason,
+            Start:  k.EngagedAt,
+        }, start, end, ended))
+    }
+    return list, nil
+}
+
+// clipDowntime cuts the downtime to the period and works out its length.
+// Downtime going on past the period ends with it.
+func clipDowntime(d *models.Downtime, start, end time.Time, ended *time.Time) *models.Downtime {
+    if d.Start.Before(start) {
+        d.Start = start
+    }
+    to := end
+    if ended != nil && ended.Before(end) {
+        d.End = ended
+        to = *ended
+    } else if ended != nil {
+        d.End = &end
+    }
+    d.Seconds = int64(to.Sub(d.Start).Seconds())
+    return d
+}
+
+// recordSystemDowntime stores a stretch without new calls once it is over
+func recordSystemDowntime(ctx context.Context, db *sql.DB, d *models.Downtime) error {
+    _, err := db.ExecContext(ctx, `
+        INSERT INTO system_downtime (cause, entity, reason, started_at, ended_at)
+        VALUES (?, ?, ?, ?, ?)`,
+        d.Cause, d.Entity, truncateString(d.Reason, 255), d.Start, d.End)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to record system downtime")
+    }
+    return nil
+}
@@ -0,0 +1,346 @@
+package router
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// Failover triggers, what failed on the route a call leaves
+const (
+    failoverOnSelection = "no_provider"
+    failoverOnDial      = "dial_failed"
+)
+
+// SetRouteFailover sets the routes tried in order when the route has no
+// providers for a call or its provider can't take it, none clears them
+func (r *Router) SetRouteFailover(ctx context.Context, routeName string, failover []string) error {
+    if _, err := r.GetRoute(ctx, routeName); err != nil {
+        return err
+    }
+
+    seen := make(map[string]bool, len(failover))
+    for _, name := range failover {
+        switch {
+        case name == routeName:
+            return errors.New(errors.ErrConfiguration, "a route can't fail over to itself")
+        case seen[name]:
+            return errors.New(errors.ErrConfiguration, fmt.Sprintf("failover route %s given twice", name))
+        }
+        seen[name] = true
+        if _, err := r.GetRoute(ctx, name); err != nil {
+            return err
+        }
+    }
+
+    var value interface{}
+    if len(failover) > 0 {
+        value, _ = json.Marshal(failover)
+    }
+    if _, err := r.db.ExecContext(ctx,
+        "UPDATE provider_routes SET failover_routes = ? WHERE name = ?", value, routeName); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update route failover")
+    }
+
+    r.flushRoutes(ctx)
+    return nil
+}
+
+// selectRouteProviders picks the intermediate and final providers of a new
+// call on the route, a pass-through route has no intermediate. The reason of
+// a failure labels the failed call metric.
+func (r *Router) selectRouteProviders(ctx context.Context, route *models.ProviderRoute) (intermediate, final *models.Provider, reason string, err error) {
+    if !route.PassThrough {
+        intermediate, err = r.selectProvider(ctx, route, route.IntermediateProvider, route.IntermediateIsGroup, route.LoadBalanceMode)
+        if err != nil {
+            return nil, nil, "no_intermediate_provider", err
+        }
+    }
+
+    final, err = r.selectProvider(ctx, route, route.FinalProvider, route.FinalIsGroup, route.LoadBalanceMode)
+    if err != nil {
+        return nil, nil, "no_final_provider", err
+    }
+    return intermediate, final, "", nil
+}
+
+// nextFailoverRoute returns the first failover route of primary, in order,
+// that wasn't tried yet, takes the call and has providers for it. The
+// intermediate provider is only picked when the call needs a new one. Until
+// the call is on its final leg it stays on routes like its own, passing
+// through or not.
+func (r *Router) nextFailoverRoute(ctx context.Context, primary *models.ProviderRoute, tried []string, dnis, customer string,
+    withIntermediate bool) (*models.ProviderRoute, *models.Provider, *models.Provider, error) {
+    skip := make(map[string]bool, len(tried))
+    for _, name := range tried {
+        skip[name] = true
+    }
+    log := logger.WithContext(ctx).WithField("route", primary.Name)
+
+    for _, name := range primary.FailoverRoutes {
+        if skip[name] {
+            continue
+        }
+
+        route, err := r.GetRoute(ctx, name)
+        if err != nil {
+            log.WithError(err).WithField("failover", name).Warn("Failover route unavailable")
+            continue
+        }
+        // Test traffic stays on test routes, production on production ones
+        if !route.Enabled || route.IsTest != primary.IsTest || !r.RouteOpen(ctx, route, time.Now()) {
+            continue
+        }
+        if withIntermediate && route.PassThrough != primary.PassThrough {
+            continue
+        }
+        if r.killSwitches.Check(customer, route.Name) != nil || r.blocks.Check(dnis, customer, route.Name) != nil {
+            continue
+        }
+
+        var intermediate, final *models.Provider
+        if withIntermediate {
+            intermediate, final, _, err = r.selectRouteProviders(ctx, route)
+        } else {
+            final, err = r.selectProvider(ctx, route, route.FinalProvider, route.FinalIsGroup, route.LoadBalanceMode)
+        }
+        if err != nil {
+            log.WithError(err).WithField("failover", name).Debug("No provider on failover route")
+            continue
+        }
+        return route, intermediate, final, nil
+    }
+
+    return nil, nil, nil, errors.New(errors.ErrRouteNotFound, fmt.Sprintf("no failover route left for route %s", primary.Name))
+}
+
+// failoverOnNewCall moves a new call to a failover route when its route has
+// no providers for it
+func (r *Router) failoverOnNewCall(ctx context.Context, route *models.ProviderRoute, dnis, customer string) (*models.ProviderRoute, *models.Provider, *models.Provider, error) {
+    next, intermediate, final, err := r.nextFailoverRoute(ctx, route, []string{route.Name}, dnis, customer, true)
+    r.countRouteFailover("routing", route.Name, failoverOnSelection, err)
+    if err != nil {
+        return nil, nil, nil, err
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "route":    route.Name,
+        "failover": next.Name,
+    }).Warn("No provider on route, failing over")
+    return next, intermediate, final, nil
+}
+
+// ProcessDialFailure moves a leg whose provider couldn't take the call,
+// congested or unavailable, to the next failover route of the route the call
+// first matched. The inbound leg is found by its call ID, the return leg by
+// the DID it came in on.
+func (r *Router) ProcessDialFailure(ctx context.Context, callID, did, dialStatus string) (*models.CallResponse, error) {
+    record, exists := r.sharedCallRecord(ctx, callID)
+    if !exists {
+        if callID = r.callIDByDID(ctx, did); callID != "" {
+            record, exists = r.sharedCallRecord(ctx, callID)
+        }
+    }
+    if !exists || record == nil {
+        return nil, errors.New(errors.ErrCallNotFound, "no active call for failed leg").
+            WithContext("did", did)
+    }
+
+    primaryName := record.RouteName
+    if len(record.SkippedRoutes) > 0 {
+        primaryName = record.SkippedRoutes[0]
+    }
+    primary, err := r.GetRoute(ctx, primaryName)
+    if err != nil {
+        return nil, err
+    }
+    tried := append(append([]string{}, record.SkippedRoutes...), record.RouteName)
+
+    var response *models.CallResponse
+    var next string
+    stage := "intermediate"
+    switch record.Status {
+    case models.CallStatusActive:
+        response, next, err = r.failoverRouteIntermediate(ctx, record, primary, tried)
+    case models.CallStatusReturnedFromS3, models.CallStatusRoutingToS4:
+        stage = "final"
+        response, next, err = r.failoverRouteFinal(ctx, record, primary, tried)
+    default:
+        return nil, errors.New(errors.ErrCallNotFound, "call is not dialing a provider").
+            WithContext("call_id", record.CallID).
+            WithContext("status", record.Status)
+    }
+    r.countRouteFailover(stage, tried[len(tried)-1], failoverOnDial, err)
+    if err != nil {
+        return nil, err
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "call_id":     record.CallID,
+        "stage":       stage,
+        "dial_status": dialStatus,
+        "from":        tried[len(tried)-1],
+        "to":          next,
+    }).Warn("Provider couldn't take the call, failing over to another route")
+    return response, nil
+}
+
+// failoverRouteIntermediate sends the call to S3 again over the providers of
+// the next failover route, on a DID of its intermediate provider
+func (r *Router) failoverRouteIntermediate(ctx context.Context, record *models.CallRecord, primary *models.ProviderRoute,
+    tried []string) (*models.CallResponse, string, error) {
+    next, intermediate, final, err := r.nextFailoverRoute(ctx, primary, tried, record.OriginalDNIS, record.InboundProvider, true)
+    if err != nil {
+        return nil, "", err
+    }
+
+    restore, err := r.rerouteReservations(record, next.Name, callProviders(record, intermediate.Name, final.Name)...)
+    if err != nil {
+        return nil, "", err
+    }
+    committed := false
+    defer func() {
+        if !committed {
+            restore()
+        }
+    }()
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, "", errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    // The call takes a slot on the new route and gives back the old one
+    if err := r.incrementRouteCalls(ctx, tx, next.ID, next.MaxConcurrentCalls); err != nil {
+        return nil, "", err
+    }
+    if err := r.decrementRouteCalls(ctx, tx, record.RouteName); err != nil {
+        return nil, "", errors.Wrap(err, errors.ErrDatabase, "failed to update route call count")
+    }
+
+    // The DID of the provider that failed goes back to the pool, with those of
+    // the other intermediates the call was handed
+    previous := *record
+    previous.Status = models.CallStatusFailed
+    if err := r.didManager.ReleaseCallDID(ctx, tx, &previous); err != nil {
+        return nil, "", err
+    }
+
+    did, err := r.didManager.AllocateDID(ctx, tx, intermediate.Name, record.OriginalDNIS, record.IsTest)
+    if err != nil {
+        return nil, "", err
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+        UPDATE call_records SET route_name = ?, intermediate_provider = ?, final_provider = ?, assigned_did = ?
+        WHERE call_id = ?`,
+        next.Name, intermediate.Name, final.Name, did, record.CallID); err != nil {
+        return nil, "", errors.Wrap(err, errors.ErrDatabase, "failed to update call record")
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, "", errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    committed = true
+
+    r.didManager.UnregisterCall(&previous)
+    r.didManager.RegisterCallDID(did, record.CallID)
+    r.activeCalls.Update(record.CallID, func(record *models.CallRecord) {
+        record.SkippedRoutes = tried
+        record.SkippedIntermediate, record.SkippedFinal = nil, nil
+        record.RouteName = next.Name
+        record.IntermediateProvider = intermediate.Name
+        record.FinalProvider = final.Name
+        record.AssignedDID = did
+        record.ClearPendingLegs()
+        applyRoutePolicy(record, next)
+    })
+    r.syncFailover(ctx, record.CallID)
+    r.unshareCallDIDs(ctx, &previous)
+    r.shareCallDID(ctx, did, record.CallID)
+    r.routeQueues.wake(previous.RouteName)
+
+    r.moveActiveCall(previous.IntermediateProvider, intermediate.Name, record.IsTest)
+    r.loadBalancer.DecrementActiveCalls(previous.FinalProvider)
+    r.loadBalancer.IncrementActiveCalls(final.Name)
+
+    return r.intermediateLeg(ctx, record.CallID, record.TransformedANI, did, intermediate.Name, next.DialOptions), next.Name, nil
+}
+
+// failoverRouteFinal sends the returned call to a final provider of the next
+// failover route, S3 already carried it
+func (r *Router) failoverRouteFinal(ctx context.Context, record *models.CallRecord, primary *models.ProviderRoute,
+    tried []string) (*models.CallResponse, string, error) {
+    next, _, final, err := r.nextFailoverRoute(ctx, primary, tried, record.OriginalDNIS, record.InboundProvider, false)
+    if err != nil {
+        return nil, "", err
+    }
+
+    restore, err := r.rerouteReservations(record, next.Name, callProviders(record, record.IntermediateProvider, final.Name)...)
+    if err != nil {
+        return nil, "", err
+    }
+    committed := false
+    defer func() {
+        if !committed {
+            restore()
+        }
+    }()
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, "", errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if err := r.incrementRouteCalls(ctx, tx, next.ID, next.MaxConcurrentCalls); err != nil {
+        return nil, "", err
+    }
+    if err := r.decrementRouteCalls(ctx, tx, record.RouteName); err != nil {
+        return nil, "", errors.Wrap(err, errors.ErrDatabase, "failed to update route call count")
+    }
+
+    if _, err := tx.ExecContext(ctx,
+        "UPDATE call_records SET route_name = ?, final_provider = ? WHERE call_id = ?",
+        next.Name, final.Name, record.CallID); err != nil {
+        return nil, "", errors.Wrap(err, errors.ErrDatabase, "failed to update call record")
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, "", errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    committed = true
+
+    previousRoute, previousFinal := record.RouteName, record.FinalProvider
+    r.activeCalls.Update(record.CallID, func(record *models.CallRecord) {
+        record.SkippedRoutes = tried
+        record.SkippedFinal = nil
+        record.RouteName = next.Name
+        record.FinalProvider = final.Name
+    })
+    r.syncFailover(ctx, record.CallID)
+    r.routeQueues.wake(previousRoute)
+    r.moveActiveCall(previousFinal, final.Name, record.IsTest)
+
+    // The final leg keeps the dial options of the route the call came in on
+    return r.finalLeg(ctx, record), next.Name, nil
+}
+
+func (r *Router) countRouteFailover(stage, route, trigger string, err error) {
+    outcome := "failover"
+    if err != nil {
+        outcome = "exhausted"
+    }
+    r.metrics.IncrementCounter("router_route_failovers", map[string]string{
+        "stage":   stage,
+        "route":   route,
+        "trigger": trigger,
+        "outcome": outcome,
+    })
+}
@@ -0,0 +1,338 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "math"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// FASConfig controls false answer supervision detection
+type FASConfig struct {
+    Enabled          bool
+    Interval         time.Duration // how often scores are recomputed
+    Window           time.Duration // answered calls looked at
+    MinCalls         int           // answered calls needed before a provider can be flagged
+    FastAnswer       time.Duration // answers quicker than this are suspicious
+    ShortCall        time.Duration // answered calls shorter than this count as short
+    BillingIncrement time.Duration // durations ending on a multiple of this cluster
+    FlagScore        float64       // score from which a provider is flagged
+    Reduce           bool          // cut traffic to flagged providers
+    ReduceFactor     float64       // share of its normal traffic a flagged provider keeps
+}
+
+// Score weights, a provider answering everything instantly scores 50 on that alone
+const (
+    fasWeightFastAnswer = 0.5
+    fasWeightShortCall  = 0.25
+    fasWeightIncrement  = 0.25
+)
+
+func (c *FASConfig) setDefaults() {
+    if c.Interval <= 0 {
+        c.Interval = 15 * time.Minute
+    }
+    if c.Window <= 0 {
+        c.Window = 24 * time.Hour
+    }
+    if c.MinCalls <= 0 {
+        c.MinCalls = 30
+    }
+    if c.FastAnswer <= 0 {
+        c.FastAnswer = time.Second
+    }
+    if c.ShortCall <= 0 {
+        c.ShortCall = 6 * time.Second
+    }
+    if c.BillingIncrement <= 0 {
+        c.BillingIncrement = 60 * time.Second
+    }
+    if c.FlagScore <= 0 {
+        c.FlagScore = 50
+    }
+    if c.ReduceFactor <= 0 || c.ReduceFactor > 1 {
+        c.ReduceFactor = 0.25
+    }
+}
+
+// recordCallTiming stores what Asterisk reported about the answered leg: when it
+// was answered, how long that took and the talk time, which is what gets billed
+// once rounded by the billing rule of each leg's provider
+func (r *Router) recordCallTiming(ctx context.Context, callID string, timing models.CallTiming) error {
+    disposition := r.hangupDisposition(ctx, timing)
+    r.metrics.IncrementCounter("router_call_dispositions", map[string]string{
+        "disposition": disposition,
+    })
+
+    // The raw codes are kept next to the disposition so remapping stays explainable
+    query := `
+        UPDATE call_records
+        SET disposition = ?, hangup_cause = ?, dial_status = ?,
+            sip_response_code = COALESCE(?, sip_response_code)`
+    args := []interface{}{disposition, nullInt(timing.HangupCause), nullString(timing.DialStatus), nullInt(timing.SIPCode)}
+
+    if timing.IsAnswered() {
+        now := time.Now()
+        talk := int(timing.Answered.Seconds())
+
+        // Each leg is billed by its provider's rule, those of the hops too
+        record := &models.CallRecord{CallID: callID}
+        r.db.QueryRowContext(ctx, `
+            SELECT COALESCE(inbound_provider, ''), COALESCE(intermediate_provider, ''), COALESCE(final_provider, ''), metadata
+            FROM call_records WHERE call_id = ?`, callID).
+            Scan(&record.InboundProvider, &record.IntermediateProvider, &record.FinalProvider, &record.Metadata)
+        record.HopLegs = storedHopLegs(record.Metadata)
+        r.rateLegs(ctx, record, talk)
+
+        query += `, answer_time = ?, answer_delay_ms = ?, end_time = ?, duration = ?,
+            billable_duration = ?, intermediate_billable_duration = ?, final_billable_duration = ?`
+        args = append(args, now.Add(-timing.Answered), timing.AnswerDelay().Milliseconds(), now, talk,
+            record.BillableDuration, record.IntermediateBillable, record.FinalBillable)
+        if len(record.HopLegs) > 0 {
+            query += ", metadata = ?"
+            args = append(args, metadataValue(record.Metadata))
+        }
+    }
+
+    if _, err := r.db.ExecContext(ctx, query+" WHERE call_id = ?", append(args, callID)...); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to store call timing")
+    }
+    return nil
+}
+
+// EvaluateFAS scores every provider that carried answered calls in the window.
+// A call counts for each outbound provider it went through. Providers answering
+// almost instantly, with many very short calls or calls that end right at a
+// billing increment score high; with Reduce set flagged providers get only
+// ReduceFactor of their traffic until the score drops again.
+func (r *Router) EvaluateFAS(ctx context.Context, config FASConfig) ([]*models.FASScore, error) {
+    config.setDefaults()
+
+    // Whole seconds, the reset below compares against the stored TIMESTAMP
+    now := time.Now().Truncate(time.Second)
+    since := now.Add(-config.Window)
+    fast := config.FastAnswer.Milliseconds()
+    short := int(config.ShortCall.Seconds())
+    increment := int(config.BillingIncrement.Seconds())
+
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT provider, COUNT(*),
+               COALESCE(SUM(answer_delay_ms < ?), 0),
+               COALESCE(SUM(duration < ?), 0),
+               COALESCE(SUM(duration >= ? - 1 AND (MOD(duration, ?) <= 1 OR MOD(duration, ?) = ? - 1)), 0)
+        FROM (
+            SELECT intermediate_provider AS provider, answer_delay_ms, duration
+            FROM call_records
+            WHERE start_time >= ? AND answer_delay_ms IS NOT NULL AND COALESCE(is_test, 0) = 0
+              AND COALESCE(intermediate_provider, '') <> ''
+            UNION ALL
+            SELECT final_provider, answer_delay_ms, duration
+            FROM call_records
+            WHERE start_time >= ? AND answer_delay_ms IS NOT NULL AND COALESCE(is_test, 0) = 0
+              AND COALESCE(final_provider, '') <> ''
+        ) answered
+        GROUP BY provider`,
+        fast, short, increment, increment, increment, increment, since, since)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query answered calls")
+    }
+    defer rows.Close()
+
+    var scores []*models.FASScore
+    for rows.Next() {
+        s := &models.FASScore{WindowStart: since, EvaluatedAt: now}
+        if err := rows.Scan(&s.ProviderName, &s.AnsweredCalls, &s.FastAnswers, &s.ShortCalls, &s.IncrementCalls); err != nil {
+            return nil, errors.Wrap(err, errors.ErrDatabase, "failed to scan answered calls")
+        }
+        scoreFAS(s, config)
+        scores = append(scores, s)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read answered calls")
+    }
+
+    previous, err := r.GetFASScores(ctx)
+    if err != nil {
+        return nil, err
+    }
+    wasFlagged := make(map[string]bool, len(previous))
+    for _, p := range previous {
+        wasFlagged[p.ProviderName] = p.Flagged
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    for _, s := range scores {
+        s.Reduced = s.Flagged && config.Reduce
+        _, err := tx.ExecContext(ctx, `
+            INSERT INTO provider_fas_scores (
+                provider_name, answered_calls, fast_answers, short_calls, increment_calls,
+                score, flagged, reduced, flagged_at, window_start, evaluated_at
+            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, IF(?, ?, NULL), ?, ?)
+            ON DUPLICATE KEY UPDATE
+                answered_calls = VALUES(answered_calls), fast_answers = VALUES(fast_answers),
+                short_calls = VALUES(short_calls), increment_calls = VALUES(increment_calls),
+                score = VALUES(score), reduced = VALUES(reduced),
+                flagged_at = IF(VALUES(flagged), COALESCE(flagged_at, VALUES(flagged_at)), NULL),
+                flagged = VALUES(flagged), window_start = VALUES(window_start),
+                evaluated_at = VALUES(evaluated_at)`,
+            s.ProviderName, s.AnsweredCalls, s.FastAnswers, s.ShortCalls, s.IncrementCalls,
+            s.Score, s.Flagged, s.Reduced, s.Flagged, now, since, now)
+        if err != nil {
+            return nil, errors.Wrap(err, errors.ErrDatabase, "failed to store FAS score")
+        }
+    }
+
+    // Providers without answered calls in the window have nothing against them
+    _, err = tx.ExecContext(ctx, `
+        UPDATE provider_fas_scores
+        SET answered_calls = 0, fast_answers = 0, short_calls = 0, increment_calls = 0,
+            score = 0, flagged = FALSE, reduced = FALSE, flagged_at = NULL,
+            window_start = ?, evaluated_at = ?
+        WHERE evaluated_at < ?`,
+        since, now, now)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to reset FAS scores")
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to commit FAS scores")
+    }
+
+    log := logger.WithContext(ctx)
+    for _, s := range scores {
+        r.metrics.SetGauge("provider_fas_score", s.Score, map[string]string{
+            "provider": s.ProviderName,
+        })
+
+        fields := map[string]interface{}{
+            "provider":          s.ProviderName,
+            "score":             s.Score,
+            "answered_calls":    s.AnsweredCalls,
+            "fast_answer_ratio": s.FastAnswerRatio,
+            "short_call_ratio":  s.ShortCallRatio,
+            "increment_ratio":   s.IncrementRatio,
+            "reduced":           s.Reduced,
+        }
+        switch {
+        case s.Flagged && !wasFlagged[s.ProviderName]:
+            log.WithFields(fields).Error("ALERT: provider suspected of false answer supervision")
+        case !s.Flagged && wasFlagged[s.ProviderName]:
+            log.WithFields(fields).Info("Provider no longer suspected of false answer supervision")
+        }
+    }
+
+    return scores, nil
+}
+
+// scoreFAS turns the counts into ratios and a 0-100 score. Some calls always end
+// near an increment by chance, only the share above that counts.
+func scoreFAS(s *models.FASScore, config FASConfig) {
+    if s.AnsweredCalls == 0 {
+        return
+    }
+
+    answered := float64(s.AnsweredCalls)
+    s.FastAnswerRatio = float64(s.FastAnswers) / answered
+    s.ShortCallRatio = float64(s.ShortCalls) / answered
+    s.IncrementRatio = float64(s.IncrementCalls) / answered
+
+    var clustered float64
+    if increment := config.BillingIncrement.Seconds(); increment >= 6 {
+        chance := 3 / increment
+        clustered = math.Max(0, (s.IncrementRatio-chance)/(1-chance))
+    }
+
+    score := 100 * (fasWeightFastAnswer*s.FastAnswerRatio + fasWeightShortCall*s.ShortCallRatio + fasWeightIncrement*clustered)
+    s.Score = math.Round(score*100) / 100
+    s.Flagged = s.AnsweredCalls >= config.MinCalls && s.Score >= config.FlagScore
+}
+
+// GetFASScores returns the stored provider scores, most suspicious first
+func (r *Router) GetFASScores(ctx context.Context) ([]*models.FASScore, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT provider_name, answered_calls, fast_answers, short_calls, increment_calls,
+               score, flagged, reduced, flagged_at, window_start, evaluated_at
+        FROM provider_fas_scores
+        ORDER BY score DESC, provider_name`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query FAS scores")
+    }
+    defer rows.Close()
+
+    var scores []*models.FASScore
+    for rows.Next() {
+        var s models.FASScore
+        var flaggedAt, windowStart sql.NullTime
+        if err := rows.Scan(&s.ProviderName, &s.AnsweredCalls, &s.FastAnswers, &s.ShortCalls, &s.IncrementCalls,
+            &s.Score, &s.Flagged, &s.Reduced, &flaggedAt, &windowStart, &s.EvaluatedAt); err != nil {
+            continue
+        }
+        if flaggedAt.Valid {
+            s.FlaggedAt = &flaggedAt.Time
+        }
+        s.WindowStart = windowStart.Time
+        if s.AnsweredCalls > 0 {
+            answered := float64(s.AnsweredCalls)
+            s.FastAnswerRatio = float64(s.FastAnswers) / answered
+            s.ShortCallRatio = float64(s.ShortCalls) / answered
+            s.IncrementRatio = float64(s.IncrementCalls) / answered
+        }
+        scores = append(scores, &s)
+    }
+
+    return scores, rows.Err()
+}
+
+// RunFASDetection recomputes the scores on the configured interval and keeps
+// the traffic caps of this instance in line with the stored reductions
+func (r *Router) RunFASDetection(ctx context.Context, config FASConfig) {
+    config.setDefaults()
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    for {
+        r.runFASDetection(ctx, config)
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (r *Router) runFASDetection(ctx context.Context, config FASConfig) {
+    log := logger.WithContext(ctx)
+
+    // One instance scores, every instance applies the reductions
+    if unlock, err := r.cache.Lock(ctx, "fas:evaluate", 5*time.Minute); err == nil {
+        if _, err := r.EvaluateFAS(ctx, config); err != nil {
+            log.WithError(err).Warn("FAS evaluation failed")
+        }
+        unlock()
+    }
+
+    scores, err := r.GetFASScores(ctx)
+    if err != nil {
+        log.WithError(err).Debug("Failed to load FAS reductions")
+        return
+    }
+
+    caps := make(map[string]float64)
+    for _, s := range scores {
+        if s.Reduced && config.Reduce {
+            caps[s.ProviderName] = config.ReduceFactor
+        }
+    }
+    r.loadBalancer.SetTrafficCaps("fas", caps)
+}
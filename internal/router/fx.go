@@ -0,0 +1,193 @@
+package router
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// FXConfig sets the reporting currency and where exchange rates come from.
+// Rates are units of a currency per unit of the reporting currency, the way
+// most rate services quote them: with USD reporting, EUR 0.92.
+type FXConfig struct {
+    Currency        string             // ISO 4217 code costs and revenue are reported in
+    Rates           map[string]float64 // static rates, the fallback when URL is set
+    URL             string             // JSON source answering {"rates": {"EUR": 0.92}}
+    RefreshInterval time.Duration
+}
+
+// FXRates converts provider and DID rates to the reporting currency
+type FXRates struct {
+    config  FXConfig
+    metrics MetricsInterface
+    client  *http.Client
+
+    mu        sync.RWMutex
+    rates     map[string]float64
+    source    string
+    updatedAt time.Time
+    missing   map[string]bool // currencies already reported without a rate
+}
+
+// NewFXRates creates the converter, fetching rates from the configured source
+// in the background
+func NewFXRates(metrics MetricsInterface, config FXConfig) *FXRates {
+    config.Currency = strings.ToUpper(config.Currency)
+    if config.Currency == "" {
+        config.Currency = "USD"
+    }
+    if config.RefreshInterval <= 0 {
+        config.RefreshInterval = time.Hour
+    }
+
+    fx := &FXRates{
+        config:    config,
+        metrics:   metrics,
+        client:    &http.Client{Timeout: 10 * time.Second},
+        rates:     normalizeRates(config.Rates),
+        source:    "config",
+        updatedAt: time.Now(),
+        missing:   make(map[string]bool),
+    }
+
+    if config.URL != "" {
+        go fx.refreshRoutine()
+    }
+
+    return fx
+}
+
+// Currency returns the reporting currency
+func (fx *FXRates) Currency() string {
+    return fx.config.Currency
+}
+
+// Convert returns amount, in the given currency, in the reporting currency.
+// An empty currency is the reporting currency. Amounts in a currency without a
+// rate are returned unconverted and reported once, so a missing rate shows up
+// instead of silently zeroing costs.
+func (fx *FXRates) Convert(ctx context.Context, amount float64, currency string) float64 {
+    currency = strings.ToUpper(currency)
+    if amount == 0 || currency == "" || currency == fx.config.Currency {
+        return amount
+    }
+
+    fx.mu.RLock()
+    rate, ok := fx.rates[currency]
+    fx.mu.RUnlock()
+    if ok && rate > 0 {
+        return amount / rate
+    }
+
+    fx.metrics.IncrementCounter("router_fx_missing_rate", map[string]string{"currency": currency})
+    fx.mu.Lock()
+    reported := fx.missing[currency]
+    fx.missing[currency] = true
+    fx.mu.Unlock()
+    if !reported {
+        logger.WithContext(ctx).WithFields(map[string]interface{}{
+            "currency":  currency,
+            "reporting": fx.config.Currency,
+        }).Error("ALERT: no exchange rate for currency, amounts are reported unconverted")
+    }
+    return amount
+}
+
+// Rates returns the rates in use
+func (fx *FXRates) Rates() *models.ExchangeRates {
+    fx.mu.RLock()
+    defer fx.mu.RUnlock()
+
+    rates := make(map[string]float64, len(fx.rates))
+    for currency, rate := range fx.rates {
+        rates[currency] = rate
+    }
+    return &models.ExchangeRates{
+        Currency:  fx.config.Currency,
+        Rates:     rates,
+        Source:    fx.source,
+        UpdatedAt: fx.updatedAt,
+    }
+}
+
+func (fx *FXRates) refreshRoutine() {
+    ticker := time.NewTicker(fx.config.RefreshInterval)
+    defer ticker.Stop()
+
+    for {
+        ctx := context.Background()
+        if err := fx.refresh(ctx); err != nil {
+            // The last good rates stay in use
+            logger.WithContext(ctx).WithError(err).Warn("Failed to refresh exchange rates")
+            fx.metrics.IncrementCounter("router_fx_refresh_failures", nil)
+        }
+        <-ticker.C
+    }
+}
+
+// refresh fetches the rates from the configured source. Currencies the source
+// doesn't quote keep their static rate.
+func (fx *FXRates) refresh(ctx context.Context) error {
+    ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+    defer cancel()
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, fx.config.URL, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "invalid exchange rate source")
+    }
+    resp, err := fx.client.Do(req)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "failed to fetch exchange rates")
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return errors.New(errors.ErrInternal, fmt.Sprintf("exchange rate source answered %s", resp.Status))
+    }
+
+    var body struct {
+        Base  string             `json:"base"`
+        Rates map[string]float64 `json:"rates"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+        return errors.Wrap(err, errors.ErrInternal, "invalid exchange rate response")
+    }
+    if body.Base != "" && !strings.EqualFold(body.Base, fx.config.Currency) {
+        return errors.New(errors.ErrInternal, "exchange rates are not relative to the reporting currency").
+            WithContext("base", body.Base).
+            WithContext("currency", fx.config.Currency)
+    }
+
+    rates := normalizeRates(fx.config.Rates)
+    for currency, rate := range normalizeRates(body.Rates) {
+        rates[currency] = rate
+    }
+
+    fx.mu.Lock()
+    fx.rates = rates
+    fx.source = fx.config.URL
+    fx.updatedAt = time.Now()
+    fx.missing = make(map[string]bool)
+    fx.mu.Unlock()
+
+    logger.WithContext(ctx).WithField("currencies", len(rates)).Debug("Exchange rates refreshed")
+    return nil
+}
+
+func normalizeRates(in map[string]float64) map[string]float64 {
+    rates := make(map[string]float64, len(in))
+    for currency, rate := range in {
+        if rate > 0 {
+            rates[strings.ToUpper(currency)] = rate
+        }
+    }
+    return rates
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+    "context"
+    "strings"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// groupMembersKey is the cache key of a group's members, the one the group
+// service invalidates when they change
+func groupMembersKey(groupName string) string {
+    return "group:" + groupName + ":members"
+}
+
+// groupMembers returns the resolved members of a group. Group routes select
+// from them on every call, so they are kept in process for a few seconds
+// instead of decoding the Redis copy each time.
+func (r *Router) groupMembers(ctx context.Context, groupName string) ([]*models.Provider, error) {
+    key := groupMembersKey(groupName)
+    if cached, ok := r.groupCache.get(key); ok {
+        return cached.([]*models.Provider), nil
+    }
+
+    members, err := r.groupService.GetGroupMembers(ctx, groupName)
+    if err != nil {
+        return nil, err
+    }
+    r.groupCache.set(key, members)
+    return members, nil
+}
+
+// preResolveGroups resolves the groups a route dials while its lookup is
+// filled, so the calls it is cached for find their members in memory
+func (r *Router) preResolveGroups(ctx context.Context, route *models.ProviderRoute) {
+    legs := []struct {
+        name    string
+        isGroup bool
+    }{
+        {route.IntermediateProvider, route.IntermediateIsGroup},
+        {route.FinalProvider, route.FinalIsGroup},
+    }
+
+    for _, leg := range legs {
+        if !leg.isGroup || leg.name == "" {
+            continue
+        }
+        if _, err := r.groupMembers(ctx, leg.name); err != nil {
+            logger.WithContext(ctx).WithError(err).WithField("group", leg.name).Debug("Failed to pre-resolve group members")
+        }
+    }
+}
+
+// dropGroupCache drops the members of the group a group key names. Group
+// routes on the inbound side match by membership, so routes go with them.
+func (r *Router) dropGroupCache(key string) {
+    name := strings.TrimSuffix(strings.TrimPrefix(key, "group:"), ":members")
+    r.groupCache.invalidate(groupMembersKey(name))
+    r.routeCache.clear()
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+    "crypto/md5"
+    "encoding/binary"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// hashRing is a consistent hash ring with virtual nodes. Removing a provider
+// only remaps the callers that hashed onto its nodes.
+type hashRing struct {
+    members      []string
+    virtualNodes int
+    points       []ringPoint
+}
+
+type ringPoint struct {
+    hash     uint32
+    provider string
+}
+
+func newHashRing(members []string, virtualNodes int) *hashRing {
+    ring := &hashRing{
+        members:      members,
+        virtualNodes: virtualNodes,
+        points:       make([]ringPoint, 0, len(members)*virtualNodes),
+    }
+    
+    for _, member := range members {
+        for i := 0; i < virtualNodes; i++ {
+            ring.points = append(ring.points, ringPoint{
+                hash:     ringHash(member + "#" + strconv.Itoa(i)),
+                provider: member,
+            })
+        }
+    }
+    
+    sort.Slice(ring.points, func(i, j int) bool {
+        return ring.points[i].hash < ring.points[j].hash
+    })
+    
+    return ring
+}
+
+func ringHash(key string) uint32 {
+    sum := md5.Sum([]byte(key))
+    return binary.BigEndian.Uint32(sum[:4])
+}
+
+// ringSignature identifies a membership so rings are only rebuilt when it changes
+func ringSignature(members []string) string {
+    return strings.Join(members, ",")
+}
+
+// lookup returns the provider owning the key
+func (hr *hashRing) lookup(key string) string {
+    if len(hr.points) == 0 {
+        return ""
+    }
+    
+    h := ringHash(key)
+    idx := sort.Search(len(hr.points), func(i int) bool {
+        return hr.points[i].hash >= h
+    })
+    if idx == len(hr.points) {
+        idx = 0
+    }
+    
+    return hr.points[idx].provider
+}
+
+// ownership returns the share of the hash space owned by each provider in percent
+func (hr *hashRing) ownership() map[string]float64 {
+    shares := make(map[string]float64, len(hr.members))
+    if len(hr.points) == 0 {
+        return shares
+    }
+    
+    const space = float64(1 << 32)
+    for i, point := range hr.points {
+        // Each point owns the arc from the previous point up to itself
+        var arc float64
+        if i == 0 {
+            arc = float64(point.hash) + space - float64(hr.points[len(hr.points)-1].hash)
+        } else {
+            arc = float64(point.hash - hr.points[i-1].hash)
+        }
+        shares[point.provider] += arc / space * 100
+    }
+    
+    return shares
+}
@@ -0,0 +1,85 @@
+package router
+
+import (
+    "time"
+)
+
+// HealthPolicy controls how call outcomes turn into provider health
+type HealthPolicy struct {
+    FailureThreshold          int           // consecutive failures before a provider is marked unhealthy
+    ConsecutiveFailurePenalty int           // score points lost per consecutive failure
+    FailureRateWeight         int           // score points lost at a 100% failure rate
+    RecoveryWindow            time.Duration // quiet period before an unhealthy provider auto-recovers
+    MinSamples                int           // calls needed before the failure rate affects the score
+}
+
+// DefaultHealthPolicy returns the built-in health rules
+func DefaultHealthPolicy() HealthPolicy {
+    return HealthPolicy{
+        FailureThreshold:          5,
+        ConsecutiveFailurePenalty: 10,
+        FailureRateWeight:         50,
+        RecoveryWindow:            5 * time.Minute,
+        MinSamples:                1,
+    }
+}
+
+// withDefaults fills unset fields from base
+func (p HealthPolicy) withDefaults(base HealthPolicy) HealthPolicy {
+    if p.FailureThreshold <= 0 {
+        p.FailureThreshold = base.FailureThreshold
+    }
+    if p.ConsecutiveFailurePenalty < 0 {
+        p.ConsecutiveFailurePenalty = base.ConsecutiveFailurePenalty
+    }
+    if p.FailureRateWeight < 0 {
+        p.FailureRateWeight = base.FailureRateWeight
+    }
+    if p.RecoveryWindow <= 0 {
+        p.RecoveryWindow = base.RecoveryWindow
+    }
+    if p.MinSamples <= 0 {
+        p.MinSamples = base.MinSamples
+    }
+    return p
+}
+
+// SetHealthPolicies replaces the health rules; byType is keyed by provider type
+// and may be reloaded while calls are being routed
+func (lb *LoadBalancer) SetHealthPolicies(base HealthPolicy, byType map[string]HealthPolicy) {
+    base = base.withDefaults(DefaultHealthPolicy())
+    
+    policies := make(map[string]HealthPolicy, len(byType))
+    for providerType, policy := range byType {
+        policies[providerType] = policy.withDefaults(base)
+    }
+    
+    lb.policyMu.Lock()
+    lb.config.Health = base
+    lb.config.HealthByType = policies
+    lb.policyMu.Unlock()
+}
+
+// HealthPolicies returns the active default and per-type health rules
+func (lb *LoadBalancer) HealthPolicies() (HealthPolicy, map[string]HealthPolicy) {
+    lb.policyMu.RLock()
+    defer lb.policyMu.RUnlock()
+    
+    byType := make(map[string]HealthPolicy, len(lb.config.HealthByType))
+    for providerType, policy := range lb.config.HealthByType {
+        byType[providerType] = policy
+    }
+    
+    return lb.config.Health, byType
+}
+
+// healthPolicy returns the rules for a provider type, falling back to the default
+func (lb *LoadBalancer) healthPolicy(providerType string) HealthPolicy {
+    lb.policyMu.RLock()
+    defer lb.policyMu.RUnlock()
+    
+    if policy, ok := lb.config.HealthByType[providerType]; ok {
+        return policy
+    }
+    return lb.config.Health
+}
@@ -0,0 +1,259 @@
+package router
+
+import (
+    "context"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+const holidayCacheKey = "holidays:"
+
+// AddHoliday creates or renames a holiday of a country
+func (r *Router) AddHoliday(ctx context.Context, h *models.Holiday, user string) error {
+    if err := normalizeHoliday(h); err != nil {
+        return err
+    }
+    if h.Source == "" {
+        h.Source = models.HolidaySourceManual
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `
+        INSERT INTO holidays (country_code, holiday_date, name, source)
+        VALUES (?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE name = VALUES(name), source = VALUES(source)`,
+        h.CountryCode, h.Date, h.Name, h.Source)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to add holiday")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "holiday",
+        EntityType: "country",
+        EntityID:   h.CountryCode,
+        UserID:     user,
+        Action:     "create",
+        NewValue:   h,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    r.cache.Invalidate(ctx, holidayCacheKey+h.CountryCode)
+    return nil
+}
+
+// ImportHolidays adds holidays read from a calendar to a country. Holidays
+// added by hand are kept on their dates; with replace the holidays of earlier
+// imports are removed first.
+func (r *Router) ImportHolidays(ctx context.Context, country string, holidays []*models.Holiday, replace bool, user string) (int, error) {
+    country = strings.ToUpper(strings.TrimSpace(country))
+    if !numbering.IsCountryCode(country) {
+        return 0, errors.New(errors.ErrInternal, "country must be an ISO 3166 alpha-2 code").
+            WithContext("country", country)
+    }
+    for _, h := range holidays {
+        h.CountryCode = country
+        h.Source = models.HolidaySourceICal
+        if err := normalizeHoliday(h); err != nil {
+            return 0, err
+        }
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if replace {
+        if _, err := tx.ExecContext(ctx, "DELETE FROM holidays WHERE country_code = ? AND source = ?",
+            country, models.HolidaySourceICal); err != nil {
+            return 0, errors.Wrap(err, errors.ErrDatabase, "failed to remove imported holidays")
+        }
+    }
+
+    for _, h := range holidays {
+        _, err := tx.ExecContext(ctx, `
+            INSERT INTO holidays (country_code, holiday_date, name, source)
+            VALUES (?, ?, ?, ?)
+            ON DUPLICATE KEY UPDATE
+                name = IF(source = ?, name, VALUES(name)),
+                source = IF(source = ?, source, VALUES(source))`,
+            h.CountryCode, h.Date, h.Name, h.Source, models.HolidaySourceManual, models.HolidaySourceManual)
+        if err != nil {
+            return 0, errors.Wrap(err, errors.ErrDatabase, "failed to add holiday").WithContext("date", h.Date)
+        }
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "holiday",
+        EntityType: "country",
+        EntityID:   country,
+        UserID:     user,
+        Action:     "import",
+        Metadata:   map[string]interface{}{"holidays": len(holidays), "replace": replace},
+    }); err != nil {
+        return 0, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    r.cache.Invalidate(ctx, holidayCacheKey+country)
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "country":  country,
+        "holidays": len(holidays),
+        "replace":  replace,
+    }).Info("Holidays imported")
+    return len(holidays), nil
+}
+
+// DeleteHoliday removes a holiday of a country
+func (r *Router) DeleteHoliday(ctx context.Context, country, date, user string) error {
+    country = strings.ToUpper(strings.TrimSpace(country))
+
+    holidays, err := r.queryHolidays(ctx, "WHERE country_code = ? AND holiday_date = ?", country, date)
+    if err != nil {
+        return err
+    }
+    if len(holidays) == 0 {
+        return errors.New(errors.ErrInternal, "holiday not found").
+            WithContext("country", country).
+            WithContext("date", date)
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM holidays WHERE country_code = ? AND holiday_date = ?", country, date); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete holiday")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "holiday",
+        EntityType: "country",
+        EntityID:   country,
+        UserID:     user,
+        Action:     "delete",
+        OldValue:   holidays[0],
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    r.cache.Invalidate(ctx, holidayCacheKey+country)
+    return nil
+}
+
+// ListHolidays returns the holidays of a country, or of every country when
+// country is empty, in a year unless year is zero
+func (r *Router) ListHolidays(ctx context.Context, country string, year int) ([]*models.Holiday, error) {
+    var conditions []string
+    var args []interface{}
+    if country != "" {
+        conditions = append(conditions, "country_code = ?")
+        args = append(args, strings.ToUpper(country))
+    }
+    if year > 0 {
+        conditions = append(conditions, "holiday_date >= ?", "holiday_date < ?")
+        args = append(args, time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC).Format(models.HolidayDateFormat),
+            time.Date(year+1, 1, 1, 0, 0, 0, 0, time.UTC).Format(models.HolidayDateFormat))
+    }
+    return r.queryHolidays(ctx, whereClause(conditions), args...)
+}
+
+// HolidayOn returns the holiday of a country on the date of t, in t's
+// location, or nil. It is read from memory for time-based routing and
+// business hours; a calendar that can't be read has no holidays.
+func (r *Router) HolidayOn(ctx context.Context, country string, t time.Time) *models.Holiday {
+    country = strings.ToUpper(country)
+    key := holidayCacheKey + country
+
+    var byDate map[string]*models.Holiday
+    if cached, ok := r.holidayCache.get(key); ok {
+        byDate = cached.(map[string]*models.Holiday)
+    } else {
+        holidays, err := r.queryHolidays(ctx, "WHERE country_code = ?", country)
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).WithField("country", country).Warn("Failed to load holidays")
+            return nil
+        }
+        byDate = make(map[string]*models.Holiday, len(holidays))
+        for _, h := range holidays {
+            byDate[h.Date] = h
+        }
+        r.holidayCache.set(key, byDate)
+    }
+
+    return byDate[t.Format(models.HolidayDateFormat)]
+}
+
+// IsHoliday reports whether the date of t is a holiday of the country
+func (r *Router) IsHoliday(ctx context.Context, country string, t time.Time) bool {
+    return r.HolidayOn(ctx, country, t) != nil
+}
+
+func normalizeHoliday(h *models.Holiday) error {
+    h.CountryCode = strings.ToUpper(strings.TrimSpace(h.CountryCode))
+    h.Name = strings.TrimSpace(h.Name)
+
+    if !numbering.IsCountryCode(h.CountryCode) {
+        return errors.New(errors.ErrInternal, "country must be an ISO 3166 alpha-2 code").
+            WithContext("country", h.CountryCode)
+    }
+    if _, err := time.Parse(models.HolidayDateFormat, h.Date); err != nil {
+        return errors.New(errors.ErrInternal, "invalid holiday date, expected YYYY-MM-DD").
+            WithContext("date", h.Date)
+    }
+    if h.Name == "" {
+        return errors.New(errors.ErrInternal, "holiday name is required").WithContext("date", h.Date)
+    }
+    if len(h.Name) > 200 {
+        h.Name = h.Name[:200]
+    }
+    return nil
+}
+
+func (r *Router) queryHolidays(ctx context.Context, where string, args ...interface{}) ([]*models.Holiday, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT country_code, DATE_FORMAT(holiday_date, '%Y-%m-%d'), name, source, updated_at
+        FROM holidays `+where+`
+        ORDER BY holiday_date, country_code`, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query holidays")
+    }
+    defer rows.Close()
+
+    var holidays []*models.Holiday
+    for rows.Next() {
+        var h models.Holiday
+        if err := rows.Scan(&h.CountryCode, &h.Date, &h.Name, &h.Source, &h.UpdatedAt); err != nil {
+            continue
+        }
+        holidays = append(holidays, &h)
+    }
+    return holidays, rows.Err()
+}
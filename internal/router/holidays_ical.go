@@ -0,0 +1,203 @@
+package router
+
+import (
+    "bufio"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// maxHolidayDays bounds the days a single calendar event may cover
+const maxHolidayDays = 31
+
+// holidayRecurrenceYears is how far ahead yearly events without an end are expanded
+const holidayRecurrenceYears = 2
+
+// ParseHolidayCalendar reads the events of an iCalendar (RFC 5545) file as
+// holidays, one per day an event covers. Yearly recurring events are
+// expanded up to their UNTIL or COUNT, or holidayRecurrenceYears after the
+// current year; other recurrences are rejected, public holiday feeds list
+// movable holidays one occurrence at a time.
+func ParseHolidayCalendar(r io.Reader) ([]*models.Holiday, error) {
+    lines, err := unfoldICalLines(r)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to read calendar")
+    }
+
+    byDate := make(map[string]*models.Holiday)
+    var dates []string
+    add := func(day time.Time, name string) {
+        date := day.Format(models.HolidayDateFormat)
+        if _, exists := byDate[date]; exists {
+            return
+        }
+        byDate[date] = &models.Holiday{Date: date, Name: name, Source: models.HolidaySourceICal}
+        dates = append(dates, date)
+    }
+
+    var event map[string]string
+    events := 0
+    for _, line := range lines {
+        switch {
+        case line == "BEGIN:VEVENT":
+            event = make(map[string]string)
+        case line == "END:VEVENT":
+            if event == nil {
+                continue
+            }
+            days, err := icalEventDays(event)
+            if err != nil {
+                return nil, err
+            }
+            name := icalUnescape(event["SUMMARY"])
+            for _, day := range days {
+                add(day, name)
+            }
+            event = nil
+            events++
+        case event != nil:
+            name, value, ok := strings.Cut(line, ":")
+            if !ok {
+                continue
+            }
+            // Parameters such as VALUE=DATE only tell how the value is written
+            name, _, _ = strings.Cut(name, ";")
+            event[strings.ToUpper(name)] = value
+        }
+    }
+    if events == 0 {
+        return nil, errors.New(errors.ErrInternal, "calendar has no events")
+    }
+
+    holidays := make([]*models.Holiday, 0, len(dates))
+    for _, date := range dates {
+        holidays = append(holidays, byDate[date])
+    }
+    return holidays, nil
+}
+
+// unfoldICalLines joins the continuation lines of a calendar file
+func unfoldICalLines(r io.Reader) ([]string, error) {
+    var lines []string
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for scanner.Scan() {
+        line := strings.TrimRight(scanner.Text(), "\r")
+        if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+            lines[len(lines)-1] += line[1:]
+            continue
+        }
+        lines = append(lines, line)
+    }
+    return lines, scanner.Err()
+}
+
+// icalEventDays returns the days an event covers. DTEND is exclusive, a
+// missing one makes a single day event.
+func icalEventDays(event map[string]string) ([]time.Time, error) {
+    start, err := icalDate(event["DTSTART"])
+    if err != nil {
+        return nil, errors.New(errors.ErrInternal, "invalid event start in calendar").
+            WithContext("summary", event["SUMMARY"]).
+            WithContext("dtstart", event["DTSTART"])
+    }
+    length := 1
+    if end, err := icalDate(event["DTEND"]); err == nil && end.After(start) {
+        length = int(end.Sub(start).Hours() / 24)
+    }
+    if length > maxHolidayDays {
+        return nil, errors.New(errors.ErrInternal, "calendar event covers too many days").
+            WithContext("summary", event["SUMMARY"])
+    }
+
+    starts := []time.Time{start}
+    if rule := event["RRULE"]; rule != "" {
+        if starts, err = icalYearlyStarts(start, rule); err != nil {
+            return nil, errors.Wrap(err, errors.ErrInternal, "unsupported recurrence in calendar").
+                WithContext("summary", event["SUMMARY"]).
+                WithContext("rrule", rule)
+        }
+    }
+    for _, value := range strings.Split(event["EXDATE"], ",") {
+        if excluded, err := icalDate(value); err == nil {
+            for i, s := range starts {
+                if s.Equal(excluded) {
+                    starts = append(starts[:i], starts[i+1:]...)
+                    break
+                }
+            }
+        }
+    }
+
+    var days []time.Time
+    for _, s := range starts {
+        for i := 0; i < length; i++ {
+            days = append(days, s.AddDate(0, 0, i))
+        }
+    }
+    return days, nil
+}
+
+// icalYearlyStarts expands a FREQ=YEARLY rule on the event's own date
+func icalYearlyStarts(start time.Time, rule string) ([]time.Time, error) {
+    until := time.Date(time.Now().Year()+holidayRecurrenceYears, 12, 31, 0, 0, 0, 0, time.UTC)
+    count, interval := 0, 1
+    for _, part := range strings.Split(rule, ";") {
+        key, value, _ := strings.Cut(part, "=")
+        switch strings.ToUpper(key) {
+        case "FREQ":
+            if strings.ToUpper(value) != "YEARLY" {
+                return nil, errors.New(errors.ErrInternal, "only yearly recurrences are supported")
+            }
+        case "UNTIL":
+            t, err := icalDate(value)
+            if err != nil {
+                return nil, err
+            }
+            until = t
+        case "COUNT":
+            n, err := strconv.Atoi(value)
+            if err != nil || n <= 0 {
+                return nil, errors.New(errors.ErrInternal, "invalid recurrence count")
+            }
+            count = n
+        case "INTERVAL":
+            n, err := strconv.Atoi(value)
+            if err != nil || n <= 0 {
+                return nil, errors.New(errors.ErrInternal, "invalid recurrence interval")
+            }
+            interval = n
+        case "BYMONTH", "BYMONTHDAY":
+            // The event's own month and day, as written by most exporters
+        default:
+            return nil, errors.New(errors.ErrInternal, "only yearly recurrences on a fixed date are supported")
+        }
+    }
+
+    var starts []time.Time
+    for year := 0; ; year += interval {
+        s := start.AddDate(year, 0, 0)
+        if s.After(until) || (count > 0 && len(starts) == count) {
+            break
+        }
+        starts = append(starts, s)
+    }
+    return starts, nil
+}
+
+// icalDate reads the day of a DATE or DATE-TIME value
+func icalDate(value string) (time.Time, error) {
+    value = strings.TrimSpace(value)
+    if len(value) < 8 {
+        return time.Time{}, errors.New(errors.ErrInternal, "invalid calendar date")
+    }
+    return time.Parse("20060102", value[:8])
+}
+
+func icalUnescape(s string) string {
+    return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(strings.TrimSpace(s))
+}
@@ -0,0 +1,312 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// KillSwitchConfig controls how quickly switches engaged on another node or
+// from the CLI take effect
+type KillSwitchConfig struct {
+    RefreshInterval time.Duration
+}
+
+// KillSwitchManager rejects new inbound calls while an emergency stop is engaged
+type KillSwitchManager struct {
+    db      *sql.DB
+    metrics MetricsInterface
+    config  KillSwitchConfig
+
+    mu       sync.RWMutex
+    switches []*models.KillSwitch
+}
+
+// NewKillSwitchManager creates a kill switch manager
+func NewKillSwitchManager(db *sql.DB, metrics MetricsInterface, config KillSwitchConfig) *KillSwitchManager {
+    if config.RefreshInterval <= 0 {
+        config.RefreshInterval = 2 * time.Second
+    }
+
+    km := &KillSwitchManager{
+        db:      db,
+        metrics: metrics,
+        config:  config,
+    }
+
+    go km.refreshRoutine()
+
+    return km
+}
+
+// Check returns the engaged switch that stops a new call, nil when it may
+// proceed. An empty route checks the global and customer switches only.
+func (km *KillSwitchManager) Check(customer, route string) *models.KillSwitch {
+    now := time.Now()
+
+    km.mu.RLock()
+    defer km.mu.RUnlock()
+
+    for _, k := range km.switches {
+        if !k.Active(now) {
+            continue
+        }
+        switch k.Scope {
+        case models.BlockScopeGlobal:
+            return k
+        case models.BlockScopeCustomer:
+            if k.ScopeValue == customer {
+                return k
+            }
+        case models.BlockScopeRoute:
+            if route != "" && k.ScopeValue == route {
+                return k
+            }
+        }
+    }
+    return nil
+}
+
+// Engaged returns the switches in effect on this node
+func (km *KillSwitchManager) Engaged() []*models.KillSwitch {
+    now := time.Now()
+
+    km.mu.RLock()
+    defer km.mu.RUnlock()
+
+    engaged := make([]*models.KillSwitch, 0, len(km.switches))
+    for _, k := range km.switches {
+        if k.Active(now) {
+            engaged = append(engaged, k)
+        }
+    }
+    return engaged
+}
+
+// checkKillSwitch rejects a new call stopped by a kill switch
+func (r *Router) checkKillSwitch(ctx context.Context, customer, route string) error {
+    k := r.killSwitches.Check(customer, route)
+    if k == nil {
+        return nil
+    }
+
+    r.metrics.IncrementCounter("router_calls_failed", map[string]string{
+        "reason":   "kill_switch",
+        "provider": customer,
+        "route":    route,
+    })
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "customer": customer,
+        "route":    route,
+        "switch":   k.ID,
+        "scope":    k.Scope,
+    }).Warn("Call rejected by kill switch")
+
+    return errors.New(errors.ErrCallsSuspended, "new calls are suspended").
+        WithContext("switch_id", k.ID).
+        WithContext("scope", string(k.Scope)).
+        WithContext("reason", k.Reason)
+}
+
+// Engage stops new calls in the switch's scope. Engaging a scope that is
+// already stopped replaces its reason and expiry.
+func (km *KillSwitchManager) Engage(ctx context.Context, k *models.KillSwitch) error {
+    switch k.Scope {
+    case models.BlockScopeGlobal:
+        k.ScopeValue = ""
+    case models.BlockScopeCustomer, models.BlockScopeRoute:
+        if k.ScopeValue == "" {
+            return errors.New(errors.ErrInternal, "scoped kill switch needs a customer or route").
+                WithContext("scope", string(k.Scope))
+        }
+    default:
+        return errors.New(errors.ErrInternal, "invalid kill switch scope").
+            WithContext("scope", string(k.Scope))
+    }
+
+    if k.Reason == "" {
+        return errors.New(errors.ErrInternal, "kill switch needs a reason")
+    }
+
+    tx, err := km.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    // Engaging it again starts a new stretch of downtime
+    if k.Scope == models.BlockScopeGlobal {
+        if err := recordKillSwitchDowntime(ctx, tx, "scope = ? AND scope_value = ''", k.Scope); err != nil {
+            return err
+        }
+    }
+
+    result, err := tx.ExecContext(ctx, `
+        INSERT INTO kill_switches (scope, scope_value, reason, engaged_by, expires_at)
+        VALUES (?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), reason = VALUES(reason),
+            engaged_by = VALUES(engaged_by), engaged_at = NOW(), expires_at = VALUES(expires_at)`,
+        k.Scope, k.ScopeValue, k.Reason, k.EngagedBy, k.ExpiresAt)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to engage kill switch")
+    }
+    k.ID, _ = result.LastInsertId()
+    k.EngagedAt = time.Now()
+
+    if err := km.audit(ctx, tx, k.ID, k.EngagedBy, "engage", nil, k); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "scope":       k.Scope,
+        "scope_value": k.ScopeValue,
+        "reason":      k.Reason,
+        "engaged_by":  k.EngagedBy,
+    }).Error("ALERT: kill switch engaged, new calls are rejected")
+
+    km.refresh(ctx)
+    return nil
+}
+
+// Release lets new calls in again
+func (km *KillSwitchManager) Release(ctx context.Context, id int64, releasedBy string) error {
+    switches, err := km.query(ctx, "WHERE id = ?", id)
+    if err != nil {
+        return err
+    }
+    if len(switches) == 0 {
+        return errors.New(errors.ErrInternal, "kill switch not found").
+            WithContext("id", id)
+    }
+
+    tx, err := km.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if err := recordKillSwitchDowntime(ctx, tx, "id = ? AND scope = ?", id, models.BlockScopeGlobal); err != nil {
+        return err
+    }
+    if _, err := tx.ExecContext(ctx, "DELETE FROM kill_switches WHERE id = ?", id); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to release kill switch")
+    }
+
+    if err := km.audit(ctx, tx, id, releasedBy, "release", switches[0], nil); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "scope":       switches[0].Scope,
+        "scope_value": switches[0].ScopeValue,
+        "released_by": releasedBy,
+    }).Info("Kill switch released")
+
+    km.refresh(ctx)
+    return nil
+}
+
+// recordKillSwitchDowntime records the downtime of the global switch matching
+// the condition, up to now or its expiry
+func recordKillSwitchDowntime(ctx context.Context, tx *sql.Tx, where string, args ...interface{}) error {
+    _, err := tx.ExecContext(ctx, fmt.Sprintf(`
+        INSERT INTO system_downtime (cause, entity, reason, started_at, ended_at)
+        SELECT ?, '', reason, engaged_at, LEAST(NOW(), COALESCE(expires_at, NOW()))
+        FROM kill_switches
+        WHERE %s AND engaged_at < LEAST(NOW(), COALESCE(expires_at, NOW()))`, where),
+        append([]interface{}{models.DowntimeKillSwitch}, args...)...)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to record kill switch downtime")
+    }
+    return nil
+}
+
+// List returns the stored switches, expired ones included until released
+func (km *KillSwitchManager) List(ctx context.Context) ([]*models.KillSwitch, error) {
+    return km.query(ctx, "")
+}
+
+func (km *KillSwitchManager) query(ctx context.Context, where string, args ...interface{}) ([]*models.KillSwitch, error) {
+    rows, err := km.db.QueryContext(ctx, fmt.Sprintf(`
+        SELECT id, scope, scope_value, COALESCE(reason, ''), COALESCE(engaged_by, ''), engaged_at, expires_at
+        FROM kill_switches
+        %s
+        ORDER BY scope, scope_value`, where), args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query kill switches")
+    }
+    defer rows.Close()
+
+    var switches []*models.KillSwitch
+    for rows.Next() {
+        var k models.KillSwitch
+        var expires sql.NullTime
+        if err := rows.Scan(&k.ID, &k.Scope, &k.ScopeValue, &k.Reason, &k.EngagedBy, &k.EngagedAt, &expires); err != nil {
+            continue
+        }
+        if expires.Valid {
+            k.ExpiresAt = &expires.Time
+        }
+        switches = append(switches, &k)
+    }
+    return switches, rows.Err()
+}
+
+func (km *KillSwitchManager) audit(ctx context.Context, tx *sql.Tx, id int64, user, action string, oldValue, newValue interface{}) error {
+    return audit.Record(ctx, tx, audit.Entry{
+        EventType:  "kill_switch",
+        EntityType: "kill_switch",
+        EntityID:   fmt.Sprintf("%d", id),
+        UserID:     user,
+        Action:     action,
+        OldValue:   oldValue,
+        NewValue:   newValue,
+    })
+}
+
+// refreshRoutine picks up switches engaged from the CLI or other nodes
+func (km *KillSwitchManager) refreshRoutine() {
+    ticker := time.NewTicker(km.config.RefreshInterval)
+    defer ticker.Stop()
+
+    km.refresh(context.Background())
+    for range ticker.C {
+        km.refresh(context.Background())
+    }
+}
+
+func (km *KillSwitchManager) refresh(ctx context.Context) {
+    switches, err := km.List(ctx)
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Debug("Failed to refresh kill switches")
+        return
+    }
+
+    km.mu.Lock()
+    km.switches = switches
+    km.mu.Unlock()
+
+    counts := map[models.BlockScope]int{}
+    for _, k := range km.Engaged() {
+        counts[k.Scope]++
+    }
+    for _, scope := range []models.BlockScope{models.BlockScopeGlobal, models.BlockScopeCustomer, models.BlockScopeRoute} {
+        km.metrics.SetGauge("router_kill_switches_engaged", float64(counts[scope]), map[string]string{"scope": string(scope)})
+    }
+}
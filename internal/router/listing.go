@@ -0,0 +1,304 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "strings"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// Sort keys accepted by the list queries
+var (
+    didSortColumns = map[string]string{
+        "number":    "number",
+        "provider":  "provider_name",
+        "usage":     "usage_count",
+        "last_used": "last_used_at",
+        "created":   "created_at",
+        "country":   "country",
+        "cost":      "per_minute_cost",
+        "monthly":   "monthly_cost",
+    }
+    
+    routeSortColumns = map[string]string{
+        "name":     "pr.name",
+        "priority": "pr.priority",
+        "inbound":  "pr.inbound_provider",
+        "calls":    "pr.current_calls",
+        "created":  "pr.created_at",
+    }
+    
+    callSortColumns = map[string]string{
+        "start":    "start_time",
+        "route":    "route_name",
+        "status":   "status",
+        "duration": "duration",
+    }
+)
+
+// ListDIDs returns one page of DIDs matching the filter
+func (dm *DIDManager) ListDIDs(ctx context.Context, filter models.DIDFilter, opts models.ListOptions) ([]*models.DID, int64, error) {
+    var conditions []string
+    var args []interface{}
+    
+    if filter.Provider != "" {
+        conditions = append(conditions, "provider_name = ?")
+        args = append(args, filter.Provider)
+    }
+    switch filter.Status {
+    case "available":
+        conditions = append(conditions, availableDID)
+    case "in_use":
+        conditions = append(conditions, "in_use = 1")
+    case "quarantined":
+        conditions = append(conditions, "in_use = 0 AND quarantined_until > NOW()")
+    }
+    if filter.Prefix != "" {
+        // Prefix LIKE can use the unique index on number
+        conditions = append(conditions, "number LIKE ?")
+        args = append(args, escapeLike(filter.Prefix)+"%")
+    }
+    if filter.Pattern != "" {
+        conditions = append(conditions, "number LIKE ?")
+        args = append(args, strings.ReplaceAll(filter.Pattern, "*", "%"))
+    }
+    if filter.Country != "" {
+        conditions = append(conditions, "country = ?")
+        args = append(args, filter.Country)
+    }
+    if filter.MaxCost != nil {
+        conditions = append(conditions, "per_minute_cost <= ?")
+        args = append(args, *filter.MaxCost)
+    }
+    if filter.Test != nil {
+        conditions = append(conditions, "is_test = ?")
+        args = append(args, *filter.Test)
+    }
+    
+    return dm.queryDIDs(ctx, whereClause(conditions), args, opts)
+}
+
+// ListDIDs returns one page of the DID pool
+func (r *Router) ListDIDs(ctx context.Context, filter models.DIDFilter, opts models.ListOptions) ([]*models.DID, int64, error) {
+    return r.didManager.ListDIDs(ctx, filter, opts)
+}
+
+// queryDIDs runs a DID listing with an already built WHERE clause
+func (dm *DIDManager) queryDIDs(ctx context.Context, where string, args []interface{}, opts models.ListOptions) ([]*models.DID, int64, error) {
+    var total int64
+    if err := dm.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM dids"+where, args...).Scan(&total); err != nil {
+        return nil, 0, errors.Wrap(err, errors.ErrDatabase, "failed to count DIDs")
+    }
+    
+    order, pageArgs := opts.OrderClause(didSortColumns, "number")
+    rows, err := dm.db.QueryContext(ctx, `
+        SELECT id, number, COALESCE(provider_name, ''), in_use, COALESCE(destination, ''),
+               last_used_at, usage_count, COALESCE(country, ''), COALESCE(city, ''),
+               monthly_cost, per_minute_cost, COALESCE(currency, ''), COALESCE(is_test, 0),
+               CASE WHEN quarantined_until > NOW() THEN quarantined_until END,
+               created_at, updated_at
+        FROM dids`+where+order, append(args, pageArgs...)...)
+    if err != nil {
+        return nil, 0, errors.Wrap(err, errors.ErrDatabase, "failed to query DIDs")
+    }
+    defer rows.Close()
+    
+    var dids []*models.DID
+    for rows.Next() {
+        var did models.DID
+        var lastUsed, quarantined sql.NullTime
+        
+        err := rows.Scan(
+            &did.ID, &did.Number, &did.ProviderName, &did.InUse, &did.Destination,
+            &lastUsed, &did.UsageCount, &did.Country, &did.City,
+            &did.MonthlyCost, &did.PerMinuteCost, &did.Currency, &did.IsTest, &quarantined,
+            &did.CreatedAt, &did.UpdatedAt,
+        )
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to scan DID")
+            continue
+        }
+        if lastUsed.Valid {
+            did.LastUsedAt = &lastUsed.Time
+        }
+        if quarantined.Valid {
+            did.QuarantinedUntil = &quarantined.Time
+        }
+        
+        dids = append(dids, &did)
+    }
+    
+    return dids, total, rows.Err()
+}
+
+// ListRoutes returns one page of routes with their policies resolved
+func (r *Router) ListRoutes(ctx context.Context, filter models.RouteFilter, opts models.ListOptions) ([]*models.ProviderRoute, int64, error) {
+    var conditions []string
+    var args []interface{}
+    
+    if filter.Inbound != "" {
+        conditions = append(conditions, "pr.inbound_provider = ?")
+        args = append(args, filter.Inbound)
+    }
+    if filter.Provider != "" {
+        conditions = append(conditions, "(pr.inbound_provider = ? OR pr.intermediate_provider = ? OR pr.final_provider = ?)")
+        args = append(args, filter.Provider, filter.Provider, filter.Provider)
+    }
+    if filter.Policy != "" {
+        conditions = append(conditions, "pr.policy_name = ?")
+        args = append(args, filter.Policy)
+    }
+    if filter.Enabled != nil {
+        conditions = append(conditions, "pr.enabled = ?")
+        args = append(args, *filter.Enabled)
+    }
+    if filter.Test != nil {
+        conditions = append(conditions, "pr.is_test = ?")
+        args = append(args, *filter.Test)
+    }
+    if len(filter.Tags) > 0 {
+        tagConditions, tagArgs := models.TagSelectorSQL(
+            "pt.provider_name IN (pr.inbound_provider, pr.intermediate_provider, pr.final_provider)", filter.Tags)
+        conditions = append(conditions, tagConditions...)
+        args = append(args, tagArgs...)
+    }
+    where := whereClause(conditions)
+    
+    var total int64
+    if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM provider_routes pr"+where, args...).Scan(&total); err != nil {
+        return nil, 0, errors.Wrap(err, errors.ErrDatabase, "failed to count routes")
+    }
+    
+    order, pageArgs := opts.OrderClause(routeSortColumns, "pr.priority DESC, pr.name")
+    rows, err := r.db.QueryContext(ctx, routeSelect+where+order, append(args, pageArgs...)...)
+    if err != nil {
+        return nil, 0, errors.Wrap(err, errors.ErrDatabase, "failed to query routes")
+    }
+    defer rows.Close()
+    
+    var routes []*models.ProviderRoute
+    for rows.Next() {
+        route, err := scanRoute(rows)
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to scan route")
+            continue
+        }
+        routes = append(routes, route)
+    }
+    
+    return routes, total, rows.Err()
+}
+
+// activeCallStatuses are the call_records states of calls still in progress
+const activeCallStatuses = "'INITIATED', 'ACTIVE', 'RETURNED_FROM_S3', 'ROUTING_TO_S4'"
+
+// failedCallStatuses are the call_records states of calls that didn't connect
+const failedCallStatuses = "'FAILED', 'TIMEOUT'"
+
+// ListCalls returns one page of call records, newest first by default
+func (r *Router) ListCalls(ctx context.Context, filter models.CallFilter, opts models.ListOptions) ([]*models.CallRecord, int64, error) {
+    var conditions []string
+    var args []interface{}
+    
+    if filter.CallID != "" {
+        conditions = append(conditions, "call_id = ?")
+        args = append(args, filter.CallID)
+    }
+    if filter.ActiveOnly {
+        conditions = append(conditions, "status IN ("+activeCallStatuses+")")
+    }
+    if filter.FailedOnly {
+        conditions = append(conditions, "status IN ("+failedCallStatuses+")")
+    }
+    if filter.Status != "" {
+        conditions = append(conditions, "status = ?")
+        args = append(args, filter.Status)
+    }
+    if filter.Route != "" {
+        conditions = append(conditions, "route_name = ?")
+        args = append(args, filter.Route)
+    }
+    if filter.Provider != "" {
+        conditions = append(conditions, "(inbound_provider = ? OR intermediate_provider = ? OR final_provider = ?)")
+        args = append(args, filter.Provider, filter.Provider, filter.Provider)
+    }
+    if filter.Customer != "" {
+        conditions = append(conditions, "inbound_provider = ?")
+        args = append(args, filter.Customer)
+    }
+    if filter.ANI != "" {
+        conditions = append(conditions, "original_ani = ?")
+        args = append(args, filter.ANI)
+    }
+    if filter.DNIS != "" {
+        conditions = append(conditions, "original_dnis = ?")
+        args = append(args, filter.DNIS)
+    }
+    if filter.Disposition != "" {
+        conditions = append(conditions, "disposition = ?")
+        args = append(args, filter.Disposition)
+    }
+    if filter.Test != nil {
+        conditions = append(conditions, "is_test = ?")
+        args = append(args, *filter.Test)
+    }
+    where := whereClause(conditions)
+    
+    var total int64
+    if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM call_records"+where, args...).Scan(&total); err != nil {
+        return nil, 0, errors.Wrap(err, errors.ErrDatabase, "failed to count calls")
+    }
+    
+    order, pageArgs := opts.OrderClause(callSortColumns, "start_time DESC")
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT call_id, original_ani, original_dnis,
+               COALESCE(transformed_ani, ''), COALESCE(assigned_did, ''),
+               COALESCE(inbound_provider, ''), COALESCE(intermediate_provider, ''), COALESCE(final_provider, ''),
+               COALESCE(route_name, ''), status, COALESCE(current_step, ''),
+               start_time, answer_time, end_time, COALESCE(duration, 0), COALESCE(billable_duration, 0),
+               COALESCE(is_test, 0), COALESCE(disposition, ''), COALESCE(failure_reason, ''),
+               COALESCE(sip_response_code, 0), COALESCE(hangup_cause, 0), COALESCE(dial_status, '')
+        FROM call_records`+where+order, append(args, pageArgs...)...)
+    if err != nil {
+        return nil, 0, errors.Wrap(err, errors.ErrDatabase, "failed to query calls")
+    }
+    defer rows.Close()
+    
+    var calls []*models.CallRecord
+    for rows.Next() {
+        var call models.CallRecord
+        
+        err := rows.Scan(
+            &call.CallID, &call.OriginalANI, &call.OriginalDNIS,
+            &call.TransformedANI, &call.AssignedDID,
+            &call.InboundProvider, &call.IntermediateProvider, &call.FinalProvider,
+            &call.RouteName, &call.Status, &call.CurrentStep,
+            &call.StartTime, &call.AnswerTime, &call.EndTime, &call.Duration, &call.BillableDuration,
+            &call.IsTest, &call.Disposition, &call.FailureReason,
+            &call.SIPResponseCode, &call.HangupCause, &call.DialStatus,
+        )
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to scan call record")
+            continue
+        }
+        
+        calls = append(calls, &call)
+    }
+    
+    return calls, total, rows.Err()
+}
+
+func whereClause(conditions []string) string {
+    if len(conditions) == 0 {
+        return ""
+    }
+    return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// escapeLike escapes LIKE wildcards in user input
+func escapeLike(s string) string {
+    return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -2,37 +2,74 @@ package router
 
 import (
     "context"
-    "crypto/md5"
     "database/sql"
-    "encoding/binary"
     "encoding/json"  // Added missing import
     "fmt"
     "math/rand"
     "sort"
     "sync"
-    "sync/atomic"
     "time"
     
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/faults"
     "github.com/hamzaKhattat/ara-production-system/internal/models"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
     "github.com/hamzaKhattat/ara-production-system/pkg/errors"  // Added missing import
 )
 
+// LoadBalancerConfig holds load balancer tuning
+type LoadBalancerConfig struct {
+    HotCacheTTL      time.Duration // in-process provider list cache
+    HashVirtualNodes int           // virtual nodes per provider on the hash ring
+    SlowStartWindow  time.Duration // ramp-up period for providers after recovery
+    
+    Health       HealthPolicy            // default health rules
+    HealthByType map[string]HealthPolicy // overrides keyed by provider type
+}
+
 type LoadBalancer struct {
     db      *sql.DB
     cache   CacheInterface
     metrics MetricsInterface
+    writer  *WriteBehind
+    
+    // Health policies may be swapped at runtime, guarded by policyMu
+    policyMu sync.RWMutex
+    config   LoadBalancerConfig
+    
+    // In-process provider lists keyed by provider spec
+    providerCache *localCache
     
     mu sync.RWMutex
     
-    // Round-robin counters
-    rrCounters map[string]*uint64
+    // Round-robin positions keyed by provider spec or group name
+    rrMu       sync.Mutex
+    rrCounters map[string]uint64
+    rrDirty    map[string]bool
+    
+    // Consistent hash rings keyed like the round-robin positions
+    ringMu sync.RWMutex
+    rings  map[string]*hashRing
     
     // Provider health tracking
     providerHealth map[string]*ProviderHealthInfo
     
     // Response time tracking
     responseTimes map[string]*ResponseTimeTracker
+    
+    // Per destination country provider limits, nil when not tracked
+    countries *CountryTracker
+    
+    // Route, provider and destination prefix rate limits, nil when not enforced
+    rateLimits *RateLimiter
+    
+    // Traffic share limits by source, FAS detection or short call control,
+    // then by provider
+    capMu       sync.RWMutex
+    trafficCaps map[string]map[string]float64
+    
+    // Told of health transitions, set before the load balancer is used
+    onHealthEvent func(providerName, eventType, detail string)
 }
 
 type ProviderHealthInfo struct {
@@ -45,6 +82,10 @@ type ProviderHealthInfo struct {
     LastFailure         time.Time
     HealthScore         int
     IsHealthy           bool
+    RecoveredAt         time.Time // start of the slow-start window
+    ProviderType        string    // selects the health policy
+    OptionsFailures     int       // failed SIP OPTIONS checks in a row
+    OptionsDown         bool      // skipped until it answers OPTIONS again
 }
 
 type ResponseTimeTracker struct {
@@ -55,23 +96,44 @@ type ResponseTimeTracker struct {
     count        int
 }
 
-func NewLoadBalancer(db *sql.DB, cache CacheInterface, metrics MetricsInterface) *LoadBalancer {
+func NewLoadBalancer(db *sql.DB, cache CacheInterface, metrics MetricsInterface, writer *WriteBehind, config LoadBalancerConfig) *LoadBalancer {
+    if config.HashVirtualNodes <= 0 {
+        config.HashVirtualNodes = 160
+    }
+    
+    byType := config.HealthByType
+    config.HealthByType = nil
+    
     lb := &LoadBalancer{
         db:             db,
         cache:          cache,
         metrics:        metrics,
-        rrCounters:     make(map[string]*uint64),
+        writer:         writer,
+        config:         config,
+        providerCache:  newLocalCache("provider", config.HotCacheTTL, metrics),
+        rrCounters:     make(map[string]uint64),
+        rrDirty:        make(map[string]bool),
+        rings:          make(map[string]*hashRing),
         providerHealth: make(map[string]*ProviderHealthInfo),
         responseTimes:  make(map[string]*ResponseTimeTracker),
+        trafficCaps:    make(map[string]map[string]float64),
     }
     
+    lb.SetHealthPolicies(config.Health, byType)
+    lb.loadRoundRobin()
+    
     // Start health monitoring
     go lb.healthMonitor()
+    go lb.roundRobinRoutine()
     
     return lb
 }
 
 func (lb *LoadBalancer) SelectProvider(ctx context.Context, providerSpec string, mode models.LoadBalanceMode) (*models.Provider, error) {
+    if err := faults.Get().Error(faults.ProviderSelection); err != nil {
+        return nil, errors.Wrap(err, errors.ErrProviderNotFound, "provider selection failed")
+    }
+    
     // Get available providers
     providers, err := lb.getAvailableProviders(ctx, providerSpec)
     if err != nil {
@@ -87,7 +149,18 @@ func (lb *LoadBalancer) SelectProvider(ctx context.Context, providerSpec string,
     if len(healthyProviders) == 0 {
         // If no healthy providers, try all providers
         logger.WithContext(ctx).Warn("No healthy providers, using all available")
-        healthyProviders = providers
+        healthyProviders = append([]*models.Provider(nil), providers...)
+    }
+    
+    // Hold back providers that are still warming up after recovery
+    healthyProviders = lb.applySlowStart(healthyProviders, mode)
+    
+    healthyProviders, err = lb.applyCountryLimits(ctx, healthyProviders)
+    if err != nil {
+        return nil, err
+    }
+    if healthyProviders, err = lb.applyRateLimits(healthyProviders); err != nil {
+        return nil, err
     }
     
     // Select based on mode
@@ -105,19 +178,22 @@ func (lb *LoadBalancer) SelectProvider(ctx context.Context, providerSpec string,
     case models.LoadBalanceModeResponseTime:
         return lb.selectResponseTime(healthyProviders)
     case models.LoadBalanceModeHash:
-        // For hash mode, we need additional context (like call ID)
-        return lb.selectHash(ctx, healthyProviders)
+        return lb.selectHash(ctx, providerSpec, healthyProviders)
     default:
         return lb.selectRoundRobin(providerSpec, healthyProviders)
     }
 }
 
 func (lb *LoadBalancer) getAvailableProviders(ctx context.Context, providerSpec string) ([]*models.Provider, error) {
-    // Try cache first
-    cacheKey := fmt.Sprintf("providers:%s", providerSpec)
-    var providers []*models.Provider
+    // Try the in-process cache, then Redis
+    cacheKey := "providers:" + providerSpec
+    if cached, ok := lb.providerCache.get(cacheKey); ok {
+        return cached.([]*models.Provider), nil
+    }
     
-    if err := lb.cache.Get(ctx, cacheKey, &providers); err == nil {
+    var providers []*models.Provider
+    if err := lb.cache.Get(ctx, cacheKey, &providers); err == nil && len(providers) > 0 {
+        lb.providerCache.set(cacheKey, providers)
         return providers, nil
     }
     
@@ -170,6 +246,7 @@ func (lb *LoadBalancer) getAvailableProviders(ctx context.Context, providerSpec
     
     // Cache for 30 seconds
     lb.cache.Set(ctx, cacheKey, providers, 30*time.Second)
+    lb.providerCache.set(cacheKey, providers)
     
     return providers, nil
 }
@@ -180,12 +257,14 @@ func (lb *LoadBalancer) filterHealthyProviders(providers []*models.Provider) []*
     for _, p := range providers {
         health := lb.getProviderHealth(p.Name)
         
-        // Check if healthy
-        if health.IsHealthy {
-            // Check channel limits
-            if p.MaxChannels == 0 || health.ActiveCalls < int64(p.MaxChannels) {
-                healthy = append(healthy, p)
-            }
+        health.mu.Lock()
+        health.ProviderType = string(p.Type)
+        available := health.IsHealthy && !health.OptionsDown && (p.MaxChannels == 0 || health.ActiveCalls < int64(p.MaxChannels))
+        health.mu.Unlock()
+        
+        // Healthy and within channel limits
+        if available {
+            healthy = append(healthy, p)
         }
     }
     
@@ -197,17 +276,13 @@ func (lb *LoadBalancer) selectRoundRobin(key string, providers []*models.Provide
         return nil, errors.New(errors.ErrProviderNotFound, "no providers available")
     }
     
-    // Get or create counter
-    counter, exists := lb.rrCounters[key]
-    if !exists {
-        var c uint64
-        counter = &c
-        lb.rrCounters[key] = counter
-    }
+    lb.rrMu.Lock()
+    position := lb.rrCounters[key]
+    lb.rrCounters[key] = position + 1
+    lb.rrDirty[key] = true
+    lb.rrMu.Unlock()
     
-    // Increment and select
-    index := atomic.AddUint64(counter, 1) % uint64(len(providers))
-    return providers[index], nil
+    return providers[position%uint64(len(providers))], nil
 }
 
 func (lb *LoadBalancer) selectWeighted(providers []*models.Provider) (*models.Provider, error) {
@@ -217,8 +292,10 @@ func (lb *LoadBalancer) selectWeighted(providers []*models.Provider) (*models.Pr
     
     // Calculate total weight
     totalWeight := 0
-    for _, p := range providers {
-        totalWeight += p.Weight
+    weights := make([]int, len(providers))
+    for i, p := range providers {
+        weights[i] = lb.effectiveWeight(p)
+        totalWeight += weights[i]
     }
     
     if totalWeight == 0 {
@@ -228,8 +305,8 @@ func (lb *LoadBalancer) selectWeighted(providers []*models.Provider) (*models.Pr
     
     // Random weighted selection
     r := rand.Intn(totalWeight)
-    for _, p := range providers {
-        r -= p.Weight
+    for i, p := range providers {
+        r -= weights[i]
         if r < 0 {
             return p, nil
         }
@@ -332,15 +409,17 @@ func (lb *LoadBalancer) selectResponseTime(providers []*models.Provider) (*model
     return selectedProvider, nil
 }
 
-func (lb *LoadBalancer) selectHash(ctx context.Context, providers []*models.Provider) (*models.Provider, error) {
+func (lb *LoadBalancer) selectHash(ctx context.Context, key string, providers []*models.Provider) (*models.Provider, error) {
     if len(providers) == 0 {
         return nil, errors.New(errors.ErrProviderNotFound, "no providers available")
     }
     
-    // Get hash key from context (e.g., call ID or ANI)
+    // Hash on the caller so the same ANI keeps landing on the same provider
     hashKey := ""
-    if callID := ctx.Value("call_id"); callID != nil {
-        hashKey = callID.(string)
+    if ani, ok := ctx.Value("ani").(string); ok {
+        hashKey = ani
+    } else if callID, ok := ctx.Value("call_id").(string); ok {
+        hashKey = callID
     }
     
     if hashKey == "" {
@@ -348,13 +427,67 @@ func (lb *LoadBalancer) selectHash(ctx context.Context, providers []*models.Prov
         return providers[rand.Intn(len(providers))], nil
     }
     
-    // Calculate hash
-    h := md5.Sum([]byte(hashKey))
-    hashValue := binary.BigEndian.Uint32(h[:4])
+    name := lb.hashRingFor(key, providers).lookup(hashKey)
+    for _, p := range providers {
+        if p.Name == name {
+            return p, nil
+        }
+    }
+    
+    return providers[0], nil
+}
+
+// hashRingFor returns the ring for the key, rebuilding it when membership changed
+func (lb *LoadBalancer) hashRingFor(key string, providers []*models.Provider) *hashRing {
+    members := make([]string, len(providers))
+    for i, p := range providers {
+        members[i] = p.Name
+    }
+    sort.Strings(members)
+    signature := ringSignature(members)
+    
+    lb.ringMu.RLock()
+    ring, exists := lb.rings[key]
+    lb.ringMu.RUnlock()
     
-    // Select provider based on hash
-    index := hashValue % uint32(len(providers))
-    return providers[index], nil
+    if exists && ringSignature(ring.members) == signature {
+        return ring
+    }
+    
+    ring = newHashRing(members, lb.config.HashVirtualNodes)
+    
+    lb.ringMu.Lock()
+    lb.rings[key] = ring
+    lb.ringMu.Unlock()
+    
+    return ring
+}
+
+// GetHashRings returns the state of every hash ring, optionally resolving a lookup key
+func (lb *LoadBalancer) GetHashRings(lookupKey string) []*models.HashRingState {
+    lb.ringMu.RLock()
+    defer lb.ringMu.RUnlock()
+    
+    states := make([]*models.HashRingState, 0, len(lb.rings))
+    for key, ring := range lb.rings {
+        state := &models.HashRingState{
+            Key:          key,
+            Members:      ring.members,
+            VirtualNodes: ring.virtualNodes,
+            Ownership:    ring.ownership(),
+        }
+        if lookupKey != "" {
+            state.LookupKey = lookupKey
+            state.LookupResult = ring.lookup(lookupKey)
+        }
+        states = append(states, state)
+    }
+    
+    sort.Slice(states, func(i, j int) bool {
+        return states[i].Key < states[j].Key
+    })
+    
+    return states
 }
 
 func (lb *LoadBalancer) getProviderHealth(providerName string) *ProviderHealthInfo {
@@ -374,6 +507,20 @@ func (lb *LoadBalancer) getProviderHealth(providerName string) *ProviderHealthIn
     return health
 }
 
+// providerLoad reports health and active calls without tracking a new provider
+func (lb *LoadBalancer) providerLoad(providerName string) (bool, int64) {
+    lb.mu.RLock()
+    health, exists := lb.providerHealth[providerName]
+    lb.mu.RUnlock()
+    if !exists {
+        return true, 0
+    }
+    
+    health.mu.RLock()
+    defer health.mu.RUnlock()
+    return health.IsHealthy && !health.OptionsDown, health.ActiveCalls
+}
+
 func (lb *LoadBalancer) getAverageResponseTime(providerName string) float64 {
     lb.mu.RLock()
     defer lb.mu.RUnlock()
@@ -389,9 +536,13 @@ func (lb *LoadBalancer) getAverageResponseTime(providerName string) float64 {
     return tracker.sum / float64(tracker.count)
 }
 
-// Public methods for updating stats
+// Public methods for updating stats, an empty provider name is the
+// intermediate a pass-through call doesn't have and counts on none
 
 func (lb *LoadBalancer) IncrementActiveCalls(providerName string) {
+    if providerName == "" {
+        return
+    }
     health := lb.getProviderHealth(providerName)
     health.mu.Lock()
     health.ActiveCalls++
@@ -403,6 +554,9 @@ func (lb *LoadBalancer) IncrementActiveCalls(providerName string) {
 }
 
 func (lb *LoadBalancer) DecrementActiveCalls(providerName string) {
+    if providerName == "" {
+        return
+    }
     health := lb.getProviderHealth(providerName)
     health.mu.Lock()
     if health.ActiveCalls > 0 {
@@ -416,9 +570,14 @@ func (lb *LoadBalancer) DecrementActiveCalls(providerName string) {
 }
 
 func (lb *LoadBalancer) UpdateCallComplete(providerName string, success bool, duration time.Duration) {
+    if providerName == "" {
+        return
+    }
     health := lb.getProviderHealth(providerName)
     
     health.mu.Lock()
+    policy := lb.healthPolicy(health.ProviderType)
+    wasHealthy := health.IsHealthy
     health.TotalCalls++
     
     if success {
@@ -433,15 +592,22 @@ func (lb *LoadBalancer) UpdateCallComplete(providerName string, success bool, du
         health.LastFailure = time.Now()
         
         // Update health score
-        health.HealthScore = lb.calculateHealthScore(health)
+        health.HealthScore = lb.calculateHealthScore(health, policy)
         
         // Mark unhealthy if too many failures
-        if health.ConsecutiveFailures >= 5 {
+        if health.ConsecutiveFailures >= policy.FailureThreshold {
             health.IsHealthy = false
         }
     }
+    wentDown := wasHealthy && !health.IsHealthy
+    failures, score := health.ConsecutiveFailures, health.HealthScore
     health.mu.Unlock()
     
+    if wentDown {
+        lb.recordHealthEvent(providerName, models.ProviderEventHealthDown,
+            fmt.Sprintf("%d consecutive failures, health score %d", failures, score))
+    }
+    
     // Update metrics
     lb.metrics.IncrementCounter("provider_calls_total", map[string]string{
         "provider": providerName,
@@ -455,7 +621,7 @@ func (lb *LoadBalancer) UpdateCallComplete(providerName string, success bool, du
     }
     
     // Update database
-    go lb.updateProviderHealthDB(providerName, health)
+    lb.updateProviderHealthDB(providerName, health)
 }
 
 func (lb *LoadBalancer) updateResponseTime(providerName string, responseTime float64) {
@@ -489,16 +655,16 @@ func (lb *LoadBalancer) updateResponseTime(providerName string, responseTime flo
     tracker.currentIndex = (tracker.currentIndex + 1) % len(tracker.samples)
 }
 
-func (lb *LoadBalancer) calculateHealthScore(health *ProviderHealthInfo) int {
+func (lb *LoadBalancer) calculateHealthScore(health *ProviderHealthInfo, policy HealthPolicy) int {
     score := 100
     
     // Deduct for consecutive failures
-    score -= health.ConsecutiveFailures * 10
+    score -= health.ConsecutiveFailures * policy.ConsecutiveFailurePenalty
     
-    // Deduct for failure rate
-    if health.TotalCalls > 0 {
+    // Deduct for failure rate once there are enough samples
+    if health.TotalCalls > 0 && health.TotalCalls >= int64(policy.MinSamples) {
         failureRate := float64(health.FailedCalls) / float64(health.TotalCalls)
-        score -= int(failureRate * 50)
+        score -= int(failureRate * float64(policy.FailureRateWeight))
     }
     
     // Ensure score is between 0 and 100
@@ -511,6 +677,7 @@ func (lb *LoadBalancer) calculateHealthScore(health *ProviderHealthInfo) int {
     return score
 }
 
+// updateProviderHealthDB queues the health snapshot, ordered per provider
 func (lb *LoadBalancer) updateProviderHealthDB(providerName string, health *ProviderHealthInfo) {
     health.mu.RLock()
     defer health.mu.RUnlock()
@@ -530,10 +697,10 @@ func (lb *LoadBalancer) updateProviderHealthDB(providerName string, health *Prov
             is_healthy = VALUES(is_healthy),
             updated_at = NOW()`
     
-    lb.db.Exec(query, 
+    lb.writer.Submit(context.Background(), "provider:"+providerName, query,
         providerName, health.HealthScore, health.ActiveCalls,
         health.LastSuccess, health.LastFailure, health.ConsecutiveFailures,
-        health.IsHealthy,
+        health.IsHealthy && !health.OptionsDown,
     )
 }
 
@@ -548,29 +715,55 @@ func (lb *LoadBalancer) healthMonitor() {
 
 func (lb *LoadBalancer) checkProviderHealth() {
     lb.mu.Lock()
-    defer lb.mu.Unlock()
     
     now := time.Now()
+    var recovered []string
     
     for name, health := range lb.providerHealth {
         health.mu.Lock()
         
-        // Auto-recover if no failures in last 5 minutes
-        if !health.IsHealthy && now.Sub(health.LastFailure) > 5*time.Minute {
+        // Auto-recover once the policy's recovery window passes without failures
+        policy := lb.healthPolicy(health.ProviderType)
+        if !health.IsHealthy && now.Sub(health.LastFailure) > policy.RecoveryWindow {
             health.IsHealthy = true
             health.ConsecutiveFailures = 0
             health.HealthScore = 100
-            logger.WithField("provider", name).Info("Provider auto-recovered")
+            health.RecoveredAt = now
+            logger.WithField("provider", name).
+                WithField("slow_start_window", lb.config.SlowStartWindow.String()).
+                Info("Provider auto-recovered")
+            recovered = append(recovered, name)
         }
         
         // Check for stale providers
-        if health.ActiveCalls == 0 && now.Sub(health.LastSuccess) > 24*time.Hour {
+        if health.ActiveCalls == 0 && !health.OptionsDown && now.Sub(health.LastSuccess) > 24*time.Hour {
             // Remove from memory to save space
             delete(lb.providerHealth, name)
         }
         
         health.mu.Unlock()
     }
+    lb.mu.Unlock()
+    
+    for _, name := range recovered {
+        lb.recordHealthEvent(name, models.ProviderEventHealthUp, "no failures for the recovery window")
+    }
+}
+
+// recordHealthEvent queues a health transition on the provider's timeline,
+// behind the health snapshot of the same provider
+func (lb *LoadBalancer) recordHealthEvent(providerName, eventType, detail string) {
+    lb.writer.Submit(context.Background(), "provider:"+providerName, audit.ProviderEventInsert,
+        providerName, eventType, audit.SystemActor, detail)
+    
+    if lb.onHealthEvent != nil {
+        go lb.onHealthEvent(providerName, eventType, detail)
+    }
+}
+
+// OnHealthEvent sets the function told of provider health transitions
+func (lb *LoadBalancer) OnHealthEvent(fn func(providerName, eventType, detail string)) {
+    lb.onHealthEvent = fn
 }
 
 // GetProviderStats returns current stats for monitoring
@@ -579,6 +772,7 @@ func (lb *LoadBalancer) GetProviderStats() map[string]*models.ProviderStats {
     defer lb.mu.RUnlock()
     
     stats := make(map[string]*models.ProviderStats)
+    now := time.Now()
     
     for name, health := range lb.providerHealth {
         health.mu.RLock()
@@ -588,6 +782,8 @@ func (lb *LoadBalancer) GetProviderStats() map[string]*models.ProviderStats {
             successRate = float64(health.TotalCalls-health.FailedCalls) / float64(health.TotalCalls) * 100
         }
         
+        warmup := lb.warmupFactor(health, now)
+        
         stats[name] = &models.ProviderStats{
             ProviderName:    name,
             TotalCalls:      health.TotalCalls,
@@ -596,7 +792,9 @@ func (lb *LoadBalancer) GetProviderStats() map[string]*models.ProviderStats {
             SuccessRate:     successRate,
             AvgResponseTime: int(lb.getAverageResponseTime(name) * 1000), // Convert to ms
             LastCallTime:    health.LastSuccess,
-            IsHealthy:       health.IsHealthy,
+            IsHealthy:       health.IsHealthy && !health.OptionsDown,
+            WarmingUp:       health.IsHealthy && !health.OptionsDown && warmup < 1,
+            WarmupPercent:   warmup * 100,
         }
         
         health.mu.RUnlock()
@@ -604,10 +802,13 @@ func (lb *LoadBalancer) GetProviderStats() map[string]*models.ProviderStats {
     
     return stats
 }
-// Add this method to the LoadBalancer struct
-
 // SelectFromProviders selects a provider from a given list using the specified load balance mode
-func (lb *LoadBalancer) SelectFromProviders(ctx context.Context, providers []*models.Provider, mode models.LoadBalanceMode) (*models.Provider, error) {
+// The key identifies the provider list (e.g. the group name) for round-robin.
+func (lb *LoadBalancer) SelectFromProviders(ctx context.Context, key string, providers []*models.Provider, mode models.LoadBalanceMode) (*models.Provider, error) {
+    if err := faults.Get().Error(faults.ProviderSelection); err != nil {
+        return nil, errors.Wrap(err, errors.ErrProviderNotFound, "provider selection failed")
+    }
+    
     if len(providers) == 0 {
         return nil, errors.New(errors.ErrProviderNotFound, "no providers available")
     }
@@ -617,14 +818,23 @@ func (lb *LoadBalancer) SelectFromProviders(ctx context.Context, providers []*mo
     if len(healthyProviders) == 0 {
         // If no healthy providers, try all providers
         logger.WithContext(ctx).Warn("No healthy providers in list, using all available")
-        healthyProviders = providers
+        healthyProviders = append([]*models.Provider(nil), providers...)
+    }
+    
+    // Hold back providers that are still warming up after recovery
+    healthyProviders = lb.applySlowStart(healthyProviders, mode)
+    
+    healthyProviders, err := lb.applyCountryLimits(ctx, healthyProviders)
+    if err != nil {
+        return nil, err
+    }
+    if healthyProviders, err = lb.applyRateLimits(healthyProviders); err != nil {
+        return nil, err
     }
     
     // Select based on mode
     switch mode {
     case models.LoadBalanceModeRoundRobin:
-        // For groups, use the group name as the round-robin key
-        key := fmt.Sprintf("group:%v", time.Now().UnixNano()) // Unique key for this selection
         return lb.selectRoundRobin(key, healthyProviders)
     case models.LoadBalanceModeWeighted:
         return lb.selectWeighted(healthyProviders)
@@ -637,8 +847,57 @@ func (lb *LoadBalancer) SelectFromProviders(ctx context.Context, providers []*mo
     case models.LoadBalanceModeResponseTime:
         return lb.selectResponseTime(healthyProviders)
     case models.LoadBalanceModeHash:
-        return lb.selectHash(ctx, healthyProviders)
+        return lb.selectHash(ctx, key, healthyProviders)
     default:
-        return lb.selectRoundRobin(fmt.Sprintf("default:%v", time.Now().UnixNano()), healthyProviders)
+        return lb.selectRoundRobin(key, healthyProviders)
+    }
+}
+
+// loadRoundRobin restores round-robin positions saved by a previous run
+func (lb *LoadBalancer) loadRoundRobin() {
+    rows, err := lb.db.Query("SELECT rr_key, position FROM lb_round_robin")
+    if err != nil {
+        logger.WithError(err).Debug("Round-robin positions not restored")
+        return
+    }
+    defer rows.Close()
+    
+    lb.rrMu.Lock()
+    defer lb.rrMu.Unlock()
+    
+    for rows.Next() {
+        var key string
+        var position uint64
+        if err := rows.Scan(&key, &position); err != nil {
+            continue
+        }
+        lb.rrCounters[key] = position
+    }
+}
+
+func (lb *LoadBalancer) roundRobinRoutine() {
+    ticker := time.NewTicker(10 * time.Second)
+    defer ticker.Stop()
+    
+    for range ticker.C {
+        lb.persistRoundRobin()
+    }
+}
+
+// persistRoundRobin saves positions that moved since the last save
+func (lb *LoadBalancer) persistRoundRobin() {
+    lb.rrMu.Lock()
+    positions := make(map[string]uint64, len(lb.rrDirty))
+    for key := range lb.rrDirty {
+        positions[key] = lb.rrCounters[key]
+    }
+    lb.rrDirty = make(map[string]bool)
+    lb.rrMu.Unlock()
+    
+    for key, position := range positions {
+        lb.writer.Submit(context.Background(), "rr:"+key, `
+            INSERT INTO lb_round_robin (rr_key, position) VALUES (?, ?)
+            ON DUPLICATE KEY UPDATE position = VALUES(position)`,
+            key, position)
     }
 }
@@ -0,0 +1,134 @@
+package router
+
+import (
+    "context"
+    "strings"
+    "sync"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// localCache is an in-process TTL cache for data read on every call.
+// Values are stored as-is, so callers must treat them as read-only.
+type localCache struct {
+    name    string // cache label of the hit and miss counts
+    ttl     time.Duration
+    metrics MetricsInterface
+    
+    mu      sync.RWMutex
+    entries map[string]localEntry
+}
+
+type localEntry struct {
+    value   interface{}
+    expires int64
+}
+
+// newLocalCache creates a new local cache, a zero ttl disables it
+func newLocalCache(name string, ttl time.Duration, metrics MetricsInterface) *localCache {
+    return &localCache{
+        name:    name,
+        ttl:     ttl,
+        metrics: metrics,
+        entries: make(map[string]localEntry),
+    }
+}
+
+func (lc *localCache) get(key string) (interface{}, bool) {
+    if lc.ttl <= 0 {
+        return nil, false
+    }
+    
+    lc.mu.RLock()
+    entry, exists := lc.entries[key]
+    lc.mu.RUnlock()
+    
+    if !exists || time.Now().UnixNano() > entry.expires {
+        lc.count("miss")
+        return nil, false
+    }
+    lc.count("hit")
+    return entry.value, true
+}
+
+func (lc *localCache) count(result string) {
+    if lc.metrics == nil {
+        return
+    }
+    lc.metrics.IncrementCounter("router_local_cache_requests", map[string]string{
+        "cache":  lc.name,
+        "result": result,
+    })
+}
+
+func (lc *localCache) set(key string, value interface{}) {
+    if lc.ttl <= 0 {
+        return
+    }
+    
+    lc.mu.Lock()
+    lc.entries[key] = localEntry{value: value, expires: time.Now().Add(lc.ttl).UnixNano()}
+    lc.mu.Unlock()
+}
+
+func (lc *localCache) invalidate(key string) {
+    lc.mu.Lock()
+    delete(lc.entries, key)
+    lc.mu.Unlock()
+}
+
+// clear drops every entry
+func (lc *localCache) clear() {
+    lc.mu.Lock()
+    lc.entries = make(map[string]localEntry)
+    lc.mu.Unlock()
+}
+
+// purge drops expired entries
+func (lc *localCache) purge() {
+    now := time.Now().UnixNano()
+    
+    lc.mu.Lock()
+    for key, entry := range lc.entries {
+        if now > entry.expires {
+            delete(lc.entries, key)
+        }
+    }
+    lc.mu.Unlock()
+}
+
+// dropLocalCaches drops in-process entries made stale by a configuration
+// change on any node. A route or provider change can alter the route of any
+// inbound provider through groups and patterns, so those clear the lot;
+// changes are rare and the caches refill from Redis and the database.
+func (r *Router) dropLocalCaches(keys []string) {
+    for _, key := range keys {
+        switch {
+        case strings.HasPrefix(key, dispositionCacheKey):
+            r.dispositions.clear()
+        case strings.HasPrefix(key, "dial:"):
+            r.dialCache.invalidate(key)
+        case strings.HasPrefix(key, holidayCacheKey):
+            r.holidayCache.invalidate(key)
+        case strings.HasPrefix(key, "group:"):
+            r.dropGroupCache(key)
+        case strings.HasPrefix(key, "did:"), strings.HasPrefix(key, "endpoint:"), strings.HasPrefix(key, "dialplan:"):
+            // not cached in process
+        default:
+            r.routeCache.clear()
+            r.dialCache.clear()
+            r.groupCache.clear()
+            r.loadBalancer.providerCache.clear()
+        }
+    }
+}
+
+// flushRoutes drops every cached route after a route changes, on every node.
+// A route is cached under each inbound provider of its group, its prefixes and
+// its patterns, leaving none of them behind takes the whole namespace.
+func (r *Router) flushRoutes(ctx context.Context) {
+    if _, err := r.cache.Flush(ctx, "route"); err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to flush cached routes")
+    }
+}
@@ -0,0 +1,298 @@
+package router
+
+import (
+    "context"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// NoAnswerConfig controls failover of legs not answered before their ring timeout
+type NoAnswerConfig struct {
+    Enabled     bool
+    MaxAttempts int // providers tried per leg, the first one included
+}
+
+// ProcessNoAnswer moves a leg Asterisk cancelled at its ring timeout to
+// another provider of the route. The inbound leg is found by its call ID, the
+// return leg by the DID it came in on.
+func (r *Router) ProcessNoAnswer(ctx context.Context, callID, did string) (*models.CallResponse, error) {
+    record, exists := r.sharedCallRecord(ctx, callID)
+    if !exists {
+        if callID = r.callIDByDID(ctx, did); callID != "" {
+            record, exists = r.sharedCallRecord(ctx, callID)
+        }
+    }
+    if !exists || record == nil {
+        return nil, errors.New(errors.ErrCallNotFound, "no active call for unanswered leg").
+            WithContext("did", did)
+    }
+
+    route, err := r.GetRoute(ctx, record.RouteName)
+    if err != nil {
+        return nil, err
+    }
+
+    switch record.Status {
+    case models.CallStatusActive:
+        return r.failoverIntermediate(ctx, record, route)
+    case models.CallStatusReturnedFromS3, models.CallStatusRoutingToS4:
+        return r.failoverFinal(ctx, record, route)
+    default:
+        return nil, errors.New(errors.ErrCallNotFound, "call is not ringing a provider").
+            WithContext("call_id", record.CallID).
+            WithContext("status", record.Status)
+    }
+}
+
+// failoverIntermediate sends the call to another S3 on a DID of that provider
+func (r *Router) failoverIntermediate(ctx context.Context, record *models.CallRecord, route *models.ProviderRoute) (*models.CallResponse, error) {
+    // Both intermediates of a parallel dial and every hop of a serial fork
+    // rang out, the intermediate dialed first is the current one
+    skipped := append([]string{}, record.SkippedIntermediate...)
+    for _, leg := range record.PendingLegs() {
+        skipped = append(skipped, leg.IntermediateProvider)
+    }
+    skipped = append(skipped, record.IntermediateProvider)
+    next, err := r.alternateProvider(ctx, "intermediate", record, route, route.IntermediateProvider,
+        route.IntermediateIsGroup, skipped)
+    if err != nil {
+        return nil, err
+    }
+
+    restore, err := r.rerouteReservations(record, record.RouteName, callProviders(record, next.Name, record.FinalProvider)...)
+    if err != nil {
+        return nil, err
+    }
+    committed := false
+    defer func() {
+        if !committed {
+            restore()
+        }
+    }()
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    // The DIDs of the providers that didn't answer go back to the pool
+    previous := *record
+    previous.Status = models.CallStatusTimeout
+    if err := r.didManager.ReleaseCallDID(ctx, tx, &previous); err != nil {
+        return nil, err
+    }
+
+    did, err := r.didManager.AllocateDID(ctx, tx, next.Name, record.OriginalDNIS, record.IsTest)
+    if err != nil {
+        return nil, err
+    }
+
+    if _, err := tx.ExecContext(ctx,
+        "UPDATE call_records SET intermediate_provider = ?, assigned_did = ? WHERE call_id = ?",
+        next.Name, did, record.CallID); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to update call record")
+    }
+
+    if err := tx.Commit(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    committed = true
+
+    r.didManager.UnregisterCall(&previous)
+    r.didManager.RegisterCallDID(did, record.CallID)
+    r.activeCalls.Update(record.CallID, func(record *models.CallRecord) {
+        record.SkippedIntermediate = skipped
+        record.IntermediateProvider = next.Name
+        record.AssignedDID = did
+        record.ClearPendingLegs()
+    })
+    r.syncFailover(ctx, record.CallID)
+    r.unshareCallDIDs(ctx, &previous)
+    r.shareCallDID(ctx, did, record.CallID)
+    r.moveActiveCall(previous.IntermediateProvider, next.Name, record.IsTest)
+
+    r.logFailover(ctx, "intermediate", record, previous.IntermediateProvider, next.Name)
+    return r.intermediateLeg(ctx, record.CallID, record.TransformedANI, did, next.Name, route.DialOptions), nil
+}
+
+// failoverFinal sends the returned call to another S4
+func (r *Router) failoverFinal(ctx context.Context, record *models.CallRecord, route *models.ProviderRoute) (*models.CallResponse, error) {
+    skipped := append(append([]string{}, record.SkippedFinal...), record.FinalProvider)
+    next, err := r.alternateProvider(ctx, "final", record, route, route.FinalProvider,
+        route.FinalIsGroup, skipped)
+    if err != nil {
+        return nil, err
+    }
+
+    restore, err := r.rerouteReservations(record, record.RouteName, callProviders(record, record.IntermediateProvider, next.Name)...)
+    if err != nil {
+        return nil, err
+    }
+
+    if _, err := r.db.ExecContext(ctx,
+        "UPDATE call_records SET final_provider = ? WHERE call_id = ?",
+        next.Name, record.CallID); err != nil {
+        restore()
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to update call record")
+    }
+
+    previous := record.FinalProvider
+    r.activeCalls.Update(record.CallID, func(record *models.CallRecord) {
+        record.SkippedFinal = skipped
+        record.FinalProvider = next.Name
+    })
+    r.syncFailover(ctx, record.CallID)
+    r.moveActiveCall(previous, next.Name, record.IsTest)
+
+    r.logFailover(ctx, "final", record, previous, next.Name)
+    return r.finalLeg(ctx, record), nil
+}
+
+// rerouteReservations counts a call failing over, or handed to its next hop,
+// against the destination country and rate limit caps of the providers it
+// moves to. Until the move is written the call stays where it was, the
+// returned restore puts its reservations back there when the move doesn't go
+// through.
+func (r *Router) rerouteReservations(record *models.CallRecord, route string, providers ...string) (func(), error) {
+    callID, dnis := record.CallID, record.OriginalDNIS
+    from := callProviders(record, record.IntermediateProvider, record.FinalProvider)
+    country := numbering.CountryOf(dnis)
+    held := r.rateLimits.held(callID)
+
+    restoreCountry := func() {
+        r.countries.Release(callID)
+        // A call that hung up meanwhile holds nothing any more
+        if _, active := r.activeCalls.Get(callID); active {
+            r.countries.Reserve(callID, country, from...)
+        }
+    }
+
+    r.countries.Release(callID)
+    if err := r.countries.Reserve(callID, country, providers...); err != nil {
+        restoreCountry()
+        return nil, err
+    }
+    if err := r.rateLimits.Reroute(callID, route, dnis, providers...); err != nil {
+        restoreCountry()
+        return nil, err
+    }
+
+    return func() {
+        restoreCountry()
+        r.rateLimits.restore(callID, held)
+    }, nil
+}
+
+// alternateProvider picks a provider of the route's spec that hasn't rung out
+// on the call yet, as long as the leg has attempts left
+func (r *Router) alternateProvider(ctx context.Context, stage string, record *models.CallRecord, route *models.ProviderRoute,
+    spec string, isGroup bool, skipped []string) (*models.Provider, error) {
+    current := skipped[len(skipped)-1]
+    labels := map[string]string{"stage": stage, "provider": current, "route": record.RouteName}
+
+    maxAttempts := r.dialTarget(ctx, current).options.Merge(route.DialOptions).MaxAttempts
+    if maxAttempts <= 0 {
+        maxAttempts = r.config.NoAnswer.MaxAttempts
+    }
+    if !r.config.NoAnswer.Enabled || len(skipped) >= maxAttempts {
+        labels["outcome"] = "exhausted"
+        r.metrics.IncrementCounter("router_no_answer", labels)
+        return nil, errors.New(errors.ErrQuotaExceeded, "no answer attempts exhausted").
+            WithContext("call_id", record.CallID).
+            WithContext("attempts", len(skipped))
+    }
+
+    remaining, err := r.remainingProviders(ctx, route, spec, isGroup, skipped)
+    if err != nil {
+        return nil, err
+    }
+    if len(remaining) == 0 {
+        labels["outcome"] = "no_alternative"
+        r.metrics.IncrementCounter("router_no_answer", labels)
+        return nil, errors.New(errors.ErrProviderNotFound, "no alternative provider for unanswered leg").
+            WithContext("call_id", record.CallID).
+            WithContext("providers", spec)
+    }
+
+    remaining = r.weighRoute(route.Name, remaining)
+    next, err := r.loadBalancer.SelectFromProviders(ctx, "noanswer:"+spec, remaining, route.LoadBalanceMode)
+    if err != nil {
+        return nil, err
+    }
+
+    labels["outcome"] = "failover"
+    r.metrics.IncrementCounter("router_no_answer", labels)
+    return next, nil
+}
+
+// remainingProviders returns the providers of the route's spec the call can
+// still go to, those skipped and those the route excludes left out
+func (r *Router) remainingProviders(ctx context.Context, route *models.ProviderRoute, spec string, isGroup bool,
+    skipped []string) ([]*models.Provider, error) {
+    var candidates []*models.Provider
+    var err error
+    if isGroup {
+        candidates, err = r.groupMembers(ctx, spec)
+    } else {
+        candidates, err = r.loadBalancer.getAvailableProviders(ctx, spec)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    tried := make(map[string]bool, len(skipped))
+    for _, name := range skipped {
+        tried[name] = true
+    }
+    var remaining []*models.Provider
+    for _, p := range candidates {
+        if !tried[p.Name] && !route.Excludes(p.Name) {
+            remaining = append(remaining, p)
+        }
+    }
+    return remaining, nil
+}
+
+// moveActiveCall counts the call on the provider it failed over to. A ring out
+// counts as a failed call for the provider's health.
+func (r *Router) moveActiveCall(from, to string, isTest bool) {
+    if !isTest {
+        r.loadBalancer.UpdateCallComplete(from, false, 0)
+    }
+    r.loadBalancer.DecrementActiveCalls(from)
+    r.loadBalancer.IncrementActiveCalls(to)
+}
+
+// syncFailover shares the new provider of a call. The call record already has
+// it, so a call another instance changed meanwhile is only logged.
+func (r *Router) syncFailover(ctx context.Context, callID string) {
+    if err := r.syncSharedCall(ctx, callID); err != nil {
+        logger.WithContext(ctx).WithField("call_id", callID).Warn("Call changed on another instance while failing over")
+    }
+}
+
+func (r *Router) logFailover(ctx context.Context, stage string, record *models.CallRecord, from, to string) {
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "call_id": record.CallID,
+        "stage":   stage,
+        "route":   record.RouteName,
+        "from":    from,
+        "to":      to,
+    }).Warn("Leg not answered in time, failing over")
+}
+
+// callIDByDID finds the call a DID belongs to, the DNIS may carry the
+// correlation token as a suffix
+func (r *Router) callIDByDID(ctx context.Context, did string) string {
+    if callID := r.lookupCallIDByDID(ctx, did); callID != "" {
+        return callID
+    }
+    if baseDID, suffix := r.correlation.SplitDNIS(did); suffix != "" {
+        return r.lookupCallIDByDID(ctx, baseDID)
+    }
+    return ""
+}
@@ -0,0 +1,213 @@
+package router
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/sip"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// OptionsProbeConfig controls the SIP OPTIONS health checks of providers
+type OptionsProbeConfig struct {
+    Enabled          bool
+    Interval         time.Duration
+    Timeout          time.Duration // wait for a final response
+    FailureThreshold int           // failed checks in a row before a provider is skipped
+    Concurrency      int           // providers checked at once
+    UserAgent        string
+}
+
+// OptionsProber sends SIP OPTIONS to the providers with health checks
+// enabled and takes those that stop answering out of selection until they
+// answer again. Every router checks on its own, as it tracks call outcomes.
+type OptionsProber struct {
+    router *Router
+    config OptionsProbeConfig
+}
+
+// NewOptionsProber creates a new prober
+func NewOptionsProber(r *Router, config OptionsProbeConfig) *OptionsProber {
+    if config.Interval <= 0 {
+        config.Interval = 30 * time.Second
+    }
+    if config.Timeout <= 0 {
+        config.Timeout = sip.DefaultTimeout
+    }
+    if config.FailureThreshold <= 0 {
+        config.FailureThreshold = 3
+    }
+    if config.Concurrency <= 0 {
+        config.Concurrency = 10
+    }
+
+    return &OptionsProber{
+        router: r,
+        config: config,
+    }
+}
+
+// Run checks the providers every interval until the context is cancelled
+func (op *OptionsProber) Run(ctx context.Context) {
+    ticker := time.NewTicker(op.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        if err := op.CheckAll(ctx); err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to run provider OPTIONS checks")
+        }
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// CheckAll sends OPTIONS to every provider with health checks enabled
+func (op *OptionsProber) CheckAll(ctx context.Context) error {
+    providers, err := op.router.optionsTargets(ctx)
+    if err != nil {
+        return err
+    }
+
+    var wg sync.WaitGroup
+    slots := make(chan struct{}, op.config.Concurrency)
+    for _, p := range providers {
+        wg.Add(1)
+        slots <- struct{}{}
+        go func(p *models.Provider) {
+            defer wg.Done()
+            defer func() { <-slots }()
+            op.check(ctx, p)
+        }(p)
+    }
+    wg.Wait()
+    return nil
+}
+
+func (op *OptionsProber) check(ctx context.Context, p *models.Provider) {
+    resp, err := sip.SendOptions(ctx, sip.OptionsRequest{
+        Host:      p.Host,
+        Port:      p.Port,
+        Transport: p.Transport,
+        UserAgent: op.config.UserAgent,
+        Timeout:   op.config.Timeout,
+    })
+    if ctx.Err() != nil {
+        return
+    }
+
+    reachable := err == nil && resp.Reachable()
+    var latency time.Duration
+    detail := "OPTIONS "
+    switch {
+    case err != nil:
+        if appErr, ok := err.(*errors.AppError); ok {
+            detail += appErr.Message
+        } else {
+            detail += err.Error()
+        }
+    default:
+        latency = resp.Latency
+        detail += fmt.Sprintf("%d %s in %dms", resp.StatusCode, resp.Reason, latency.Milliseconds())
+    }
+
+    result := "reachable"
+    if !reachable {
+        result = "unreachable"
+        logger.WithContext(ctx).WithField("provider", p.Name).WithField("detail", detail).Debug("Provider failed OPTIONS check")
+    }
+    op.router.metrics.IncrementCounter("provider_options_checks", map[string]string{
+        "provider": p.Name,
+        "result":   result,
+    })
+    if err == nil {
+        op.router.metrics.ObserveHistogram("provider_options_latency", latency.Seconds(), map[string]string{
+            "provider": p.Name,
+        })
+    }
+
+    op.router.loadBalancer.recordOptionsCheck(p.Name, reachable, latency, detail, op.config.FailureThreshold)
+}
+
+// optionsTargets returns the active providers with health checks enabled
+// and a static host, registering customers have none to check
+func (r *Router) optionsTargets(ctx context.Context) ([]*models.Provider, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT name, host, port, COALESCE(transport, '')
+        FROM providers
+        WHERE active = 1 AND health_check_enabled = 1 AND auth_type <> 'register'
+          AND host <> '' AND host NOT LIKE '%/%'
+        ORDER BY name`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query providers")
+    }
+    defer rows.Close()
+
+    var providers []*models.Provider
+    for rows.Next() {
+        var p models.Provider
+        if err := rows.Scan(&p.Name, &p.Host, &p.Port, &p.Transport); err != nil {
+            continue
+        }
+        providers = append(providers, &p)
+    }
+    return providers, rows.Err()
+}
+
+// recordOptionsCheck applies an OPTIONS check result. A provider is skipped
+// after threshold failed checks in a row, whatever its call outcomes, and
+// comes back through slow start on the first check it answers.
+func (lb *LoadBalancer) recordOptionsCheck(providerName string, reachable bool, latency time.Duration, detail string, threshold int) {
+    health := lb.getProviderHealth(providerName)
+
+    health.mu.Lock()
+    wasDown := health.OptionsDown
+    if reachable {
+        health.OptionsFailures = 0
+        health.OptionsDown = false
+        if wasDown {
+            health.RecoveredAt = time.Now()
+        }
+    } else {
+        health.OptionsFailures++
+        if health.OptionsFailures >= threshold {
+            health.OptionsDown = true
+        }
+    }
+    down := health.OptionsDown
+    healthy := health.IsHealthy && !down
+    health.mu.Unlock()
+
+    switch {
+    case down && !wasDown:
+        logger.WithField("provider", providerName).WithField("detail", detail).Warn("Provider stopped answering OPTIONS")
+        lb.recordHealthEvent(providerName, models.ProviderEventHealthDown, detail)
+    case !down && wasDown:
+        logger.WithField("provider", providerName).Info("Provider answers OPTIONS again")
+        lb.recordHealthEvent(providerName, models.ProviderEventHealthUp, detail)
+    }
+
+    status := "healthy"
+    if !healthy {
+        status = "unhealthy"
+    }
+    lb.writer.Submit(context.Background(), "provider:"+providerName, `
+        UPDATE providers SET health_status = ?, last_health_check = NOW(), updated_at = updated_at
+        WHERE name = ?`,
+        status, providerName)
+    lb.writer.Submit(context.Background(), "provider:"+providerName, `
+        INSERT INTO provider_health (provider_name, latency_ms, is_healthy)
+        VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            latency_ms = VALUES(latency_ms),
+            is_healthy = VALUES(is_healthy),
+            updated_at = NOW()`,
+        providerName, latency.Milliseconds(), healthy)
+}
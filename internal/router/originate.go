@@ -0,0 +1,152 @@
+package router
+
+import (
+    "context"
+    "fmt"
+    "sync/atomic"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/agivars"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// CallOriginator places test calls into the inbound context, implemented by
+// the AMI manager
+type CallOriginator interface {
+    OriginateInbound(ctx context.Context, req models.InboundCallRequest) (*models.ProbeCallResult, error)
+}
+
+var originateSeq uint64
+
+// WithOriginatedRoute marks an incoming call as a test call the router
+// originated through the route
+func WithOriginatedRoute(ctx context.Context, route string) context.Context {
+    return context.WithValue(ctx, "originate_route", route)
+}
+
+// originatedRoute returns the route of a test call the router originated, nil
+// for other calls. The route takes the call whether enabled or not, as test
+// traffic.
+func (r *Router) originatedRoute(ctx context.Context) (*models.ProviderRoute, error) {
+    name, _ := ctx.Value("originate_route").(string)
+    if name == "" {
+        return nil, nil
+    }
+
+    route, err := r.GetRoute(ctx, name)
+    if err != nil {
+        return nil, err
+    }
+    route.IsTest = true
+    route.MatchedBy = "originate"
+    return route, nil
+}
+
+// OriginateCall places a test call end to end through a route, S1 to S2 to S3
+// and back to S4, and follows it until it hangs up. The call enters the
+// inbound context as if the route's inbound provider had sent it, so a route
+// can be verified before it's enabled. It runs as test traffic: test DIDs
+// first, the test call budget, and kept out of production stats.
+func (r *Router) OriginateCall(ctx context.Context, dialer CallOriginator, req models.OriginateCallRequest) (*models.OriginateCallResult, error) {
+    if req.ANI == "" || req.DNIS == "" {
+        return nil, errors.New(errors.ErrConfiguration, "test call needs an ANI and a DNIS")
+    }
+    route, err := r.GetRoute(ctx, req.Route)
+    if err != nil {
+        return nil, err
+    }
+
+    inbound := req.Inbound
+    if inbound == "" {
+        if route.InboundIsGroup || (route.InboundMatch != "" && route.InboundMatch != models.InboundMatchExact) {
+            return nil, errors.New(errors.ErrConfiguration, "route matches several inbound providers, name the one the test call comes from").
+                WithContext("route", route.Name)
+        }
+        inbound = route.InboundProvider
+    }
+    if req.Timeout <= 0 {
+        req.Timeout = 30 * time.Second
+    }
+    if req.Hold <= 0 {
+        req.Hold = 5 * time.Second
+    }
+
+    callID := fmt.Sprintf("originate-%d-%d", time.Now().Unix(), atomic.AddUint64(&originateSeq, 1))
+    log := logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "call_id": callID,
+        "route":   route.Name,
+        "inbound": inbound,
+    })
+    log.Info("Originating test call")
+
+    probe, err := dialer.OriginateInbound(ctx, models.InboundCallRequest{
+        CallID:  callID,
+        ANI:     req.ANI,
+        DNIS:    req.DNIS,
+        Timeout: req.Timeout,
+        Hold:    req.Hold,
+        Variables: map[string]string{
+            agivars.OriginateRoute:   route.Name,
+            agivars.OriginateInbound: inbound,
+        },
+    })
+    if err != nil {
+        r.countOriginatedCall(route.Name, "failed")
+        return nil, err
+    }
+
+    result := &models.OriginateCallResult{
+        CallID:    callID,
+        Route:     route.Name,
+        Inbound:   inbound,
+        Ringing:   probe.Ringing,
+        Answered:  probe.Answered,
+        PDDMs:     probe.PDD.Milliseconds(),
+        Cause:     probe.Cause,
+        CauseText: probe.CauseText,
+        Reason:    probe.Reason,
+        Call:      r.originatedCall(ctx, callID),
+    }
+
+    outcome := "failed"
+    switch {
+    case result.Answered:
+        outcome = "answered"
+    case result.Ringing:
+        outcome = "no_answer"
+    }
+    r.countOriginatedCall(route.Name, outcome)
+    log.WithField("outcome", outcome).Info("Test call ended")
+    return result, nil
+}
+
+// originatedCall reads the call record of a test call once its hangup handler
+// closed it, waiting a little for the handler to run
+func (r *Router) originatedCall(ctx context.Context, callID string) *models.CallRecord {
+    var call *models.CallRecord
+    for attempt := 0; attempt < 5; attempt++ {
+        calls, _, err := r.ListCalls(ctx, models.CallFilter{CallID: callID}, models.ListOptions{Limit: 1})
+        if err == nil && len(calls) > 0 {
+            call = calls[0]
+            if call.EndTime != nil {
+                break
+            }
+        }
+
+        select {
+        case <-time.After(500 * time.Millisecond):
+        case <-ctx.Done():
+            return call
+        }
+    }
+    return call
+}
+
+func (r *Router) countOriginatedCall(route, outcome string) {
+    r.metrics.IncrementCounter("router_originated_calls", map[string]string{
+        "route":   route,
+        "outcome": outcome,
+    })
+}
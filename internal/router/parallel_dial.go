@@ -0,0 +1,109 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// parallelRule is the routing_rules key of routes ringing two intermediates at once
+const parallelRule = "parallel_dial"
+
+// parseParallelDial reads whether a route rings two intermediates at once
+func parseParallelDial(rules models.JSON) bool {
+    enabled, _ := rules[parallelRule].(bool)
+    return enabled
+}
+
+// SetRouteParallelDial turns parallel dial of a route on or off. Other
+// routing rules are kept.
+func (r *Router) SetRouteParallelDial(ctx context.Context, routeName string, enabled bool) error {
+    route, err := r.GetRoute(ctx, routeName)
+    if err != nil {
+        return err
+    }
+
+    rules := route.RoutingRules
+    if rules == nil {
+        rules = models.JSON{}
+    }
+    if enabled {
+        rules[parallelRule] = true
+    } else {
+        delete(rules, parallelRule)
+    }
+
+    var value interface{}
+    if len(rules) > 0 {
+        value, _ = json.Marshal(rules)
+    }
+    if _, err := r.db.ExecContext(ctx,
+        "UPDATE provider_routes SET routing_rules = ? WHERE name = ?", value, routeName); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update route parallel dial")
+    }
+
+    r.flushRoutes(ctx)
+    return nil
+}
+
+// parallelIntermediate picks the second intermediate a new call rings and
+// allocates it a DID of its own. A route with no other provider for the leg,
+// or none with a free DID, rings the first one alone.
+func (r *Router) parallelIntermediate(ctx context.Context, tx *sql.Tx, route *models.ProviderRoute,
+    first *models.Provider, dnis string) (*models.Provider, string) {
+    log := logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "route": route.Name,
+        "first": first.Name,
+    })
+
+    candidates, err := r.remainingProviders(ctx, route, route.IntermediateProvider, route.IntermediateIsGroup,
+        []string{first.Name})
+    if err == nil && len(candidates) == 0 {
+        err = errors.New(errors.ErrProviderNotFound, "no second intermediate")
+    }
+    var second *models.Provider
+    if err == nil {
+        second, err = r.loadBalancer.SelectFromProviders(ctx, "parallel:"+route.IntermediateProvider,
+            r.weighRoute(route.Name, candidates), route.LoadBalanceMode)
+    }
+    if err != nil {
+        r.countParallelDial(route.Name, "single")
+        log.WithError(err).Debug("No second intermediate to ring, dialing one")
+        return nil, ""
+    }
+
+    did, err := r.didManager.AllocateDID(ctx, tx, second.Name, dnis, route.IsTest)
+    if err != nil {
+        r.countParallelDial(route.Name, "single")
+        log.WithError(err).WithField("second", second.Name).Debug("No DID for the second intermediate, dialing one")
+        return nil, ""
+    }
+    return second, did
+}
+
+// addParallelTarget adds the second intermediate to the Dial of the leg to
+// S3: Asterisk rings both targets and drops the other once one answers. Each
+// target carries the token of its own DID in dnis_suffix mode, the header
+// bound to the first DID reaches both in header mode.
+func (r *Router) addParallelTarget(ctx context.Context, response *models.CallResponse, callID, ani2, did, provider string,
+    options *models.DialOptions) {
+    second := r.intermediateLeg(ctx, callID, ani2, did, provider, options)
+    response.ParallelDID = did
+    response.DialString += "&" + second.DialString
+    if second.DialTimeout > response.DialTimeout {
+        response.DialTimeout = second.DialTimeout
+    }
+}
+
+// countParallelDial counts how a parallel dial went: single when only one
+// intermediate could be rung, first or second for the one that won
+func (r *Router) countParallelDial(route, outcome string) {
+    r.metrics.IncrementCounter("router_parallel_dial", map[string]string{
+        "route":   route,
+        "outcome": outcome,
+    })
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+    "context"
+    "encoding/json"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// passThroughRule is the routing_rules key of routes sending calls straight to S4
+const passThroughRule = "pass_through"
+
+// parsePassThrough reads whether a route sends calls straight to its final
+// provider, without an intermediate or DID
+func parsePassThrough(rules models.JSON) bool {
+    enabled, _ := rules[passThroughRule].(bool)
+    return enabled
+}
+
+// SetRoutePassThrough turns pass-through of a route on or off. The route keeps
+// its intermediate provider for when it's turned off again. Other routing
+// rules are kept.
+func (r *Router) SetRoutePassThrough(ctx context.Context, routeName string, enabled bool) error {
+    route, err := r.GetRoute(ctx, routeName)
+    if err != nil {
+        return err
+    }
+
+    rules := route.RoutingRules
+    if rules == nil {
+        rules = models.JSON{}
+    }
+    if enabled {
+        rules[passThroughRule] = true
+    } else {
+        delete(rules, passThroughRule)
+    }
+
+    var value interface{}
+    if len(rules) > 0 {
+        value, _ = json.Marshal(rules)
+    }
+    if _, err := r.db.ExecContext(ctx,
+        "UPDATE provider_routes SET routing_rules = ? WHERE name = ?", value, routeName); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update route pass-through")
+    }
+
+    r.flushRoutes(ctx)
+    return nil
+}
+
+// namedProviders leaves out the legs a call doesn't have, a pass-through call
+// has no intermediate
+func namedProviders(providers []string) []string {
+    named := providers[:0:0]
+    for _, provider := range providers {
+        if provider != "" {
+            named = append(named, provider)
+        }
+    }
+    return named
+}
@@ -0,0 +1,163 @@
+package router
+
+import (
+    "context"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// returnedLegs is how the legs of a call handed several intermediates, by a
+// parallel dial or a serial fork, ended once one brought the call back
+type returnedLegs struct {
+    leg      *models.CallRecord   // the call as the intermediate that brought it back was given it
+    hop      int                  // its place among the legs, 0 for the intermediate dialed first
+    parallel bool                 // the call rang two intermediates at once
+    losers   []*models.CallRecord // legs that rang without bringing the call back
+    unused   []*models.CallRecord // hops of a serial fork never dialed
+}
+
+// returnedLegOf finds the leg of the call that came back on did. Calls
+// handed a single intermediate have no other legs.
+func returnedLegOf(record *models.CallRecord, did string) *returnedLegs {
+    pending := record.PendingLegs()
+    if len(pending) == 0 {
+        return &returnedLegs{leg: record}
+    }
+
+    first := *record
+    first.ClearPendingLegs()
+    legs := append([]*models.CallRecord{&first}, pending...)
+
+    result := &returnedLegs{parallel: record.ParallelDID != ""}
+    for i, leg := range legs {
+        if leg.AssignedDID == did {
+            result.hop = i
+        }
+    }
+    result.leg = legs[result.hop]
+
+    // Hops of a serial fork after the one that took the call were never dialed,
+    // the intermediates of a parallel dial all rang
+    for i, leg := range legs {
+        switch {
+        case i == result.hop:
+        case i < result.hop || result.parallel:
+            if !result.parallel {
+                leg.Status = models.CallStatusTimeout
+            }
+            result.losers = append(result.losers, leg)
+        default:
+            result.unused = append(result.unused, leg)
+        }
+    }
+    return result
+}
+
+// pending reports whether the call had other legs when it came back
+func (rl *returnedLegs) pending() bool {
+    return len(rl.losers) > 0 || len(rl.unused) > 0
+}
+
+// claimReturnedLeg gives the call to the intermediate of leg, the first of
+// its legs to bring it back. The return legs of the others are rejected.
+func (r *Router) claimReturnedLeg(leg *models.CallRecord) error {
+    won := false
+    r.activeCalls.Update(leg.CallID, func(record *models.CallRecord) {
+        if len(record.PendingLegs()) == 0 {
+            return
+        }
+        won = true
+        record.IntermediateProvider, record.AssignedDID = leg.IntermediateProvider, leg.AssignedDID
+        record.ClearPendingLegs()
+    })
+    if !won {
+        return errors.New(errors.ErrCallNotFound, "another intermediate of the call brought it back first").
+            WithContext("call_id", leg.CallID).
+            WithContext("did", leg.AssignedDID)
+    }
+    return nil
+}
+
+// releaseReturnedLegs lets go of the legs that didn't bring the call back:
+// their DIDs go back to the pool and, when an intermediate other than the one
+// dialed first won, the call's active counts and limits move over to it. The
+// hops of a serial fork that rang out count as failed calls for their
+// providers' health, as unanswered legs failing over do. A DID failing to go
+// back stays in use until stale DIDs are cleaned up.
+func (r *Router) releaseReturnedLegs(ctx context.Context, legs *returnedLegs) {
+    leg := legs.leg
+    log := logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "call_id": leg.CallID,
+        "route":   leg.RouteName,
+        "winner":  leg.IntermediateProvider,
+        "hop":     legs.hop,
+    })
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err == nil {
+        defer tx.Rollback()
+        for _, loser := range legs.losers {
+            if err = r.didManager.ReleaseCallDID(ctx, tx, loser); err != nil {
+                break
+            }
+        }
+        for _, hop := range legs.unused {
+            if err != nil {
+                break
+            }
+            err = r.didManager.ReleaseDID(ctx, tx, hop.AssignedDID)
+        }
+        if err == nil && legs.hop > 0 {
+            _, err = tx.ExecContext(ctx,
+                "UPDATE call_records SET intermediate_provider = ?, assigned_did = ? WHERE call_id = ?",
+                leg.IntermediateProvider, leg.AssignedDID, leg.CallID)
+        }
+        if err == nil {
+            err = tx.Commit()
+        }
+    }
+    if err != nil {
+        log.WithError(err).Warn("Failed to release the DIDs of the legs that lost the call")
+    }
+
+    for _, other := range append(append([]*models.CallRecord{}, legs.losers...), legs.unused...) {
+        r.didManager.UnregisterCallDID(other.AssignedDID)
+        r.unshareCallDID(ctx, other.AssignedDID, leg.CallID)
+        if !legs.parallel && other.Status == models.CallStatusTimeout && !leg.IsTest {
+            r.loadBalancer.UpdateCallComplete(other.IntermediateProvider, false, 0)
+        }
+    }
+
+    if legs.hop > 0 {
+        first := legs.losers[0]
+        r.loadBalancer.DecrementActiveCalls(first.IntermediateProvider)
+        r.loadBalancer.IncrementActiveCalls(leg.IntermediateProvider)
+
+        // The call is up already, over a limit it keeps counting where it did
+        country := numbering.CountryOf(leg.OriginalDNIS)
+        r.countries.Release(leg.CallID)
+        if err := r.countries.Reserve(leg.CallID, country, leg.IntermediateProvider, leg.FinalProvider); err != nil {
+            r.countries.Reserve(leg.CallID, country, first.IntermediateProvider, leg.FinalProvider)
+            log.WithError(err).Warn("Intermediate that took the call over its country limit")
+        }
+        if err := r.rateLimits.Reroute(leg.CallID, leg.RouteName, leg.OriginalDNIS,
+            leg.IntermediateProvider, leg.FinalProvider); err != nil {
+            log.WithError(err).Warn("Intermediate that took the call over its rate limit")
+        }
+    }
+
+    if legs.parallel {
+        outcome := "first"
+        if legs.hop > 0 {
+            outcome = "second"
+        }
+        r.countParallelDial(leg.RouteName, outcome)
+        log.Info("Parallel dial answered")
+        return
+    }
+    r.countSerialFork(leg.RouteName, legs.hop)
+    log.Info("Serial fork answered")
+}
@@ -0,0 +1,270 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// QuarantineConfig controls automatic provider quarantine
+type QuarantineConfig struct {
+    Enabled          bool
+    FailureThreshold int
+    Window           time.Duration
+    RefreshInterval  time.Duration
+}
+
+// QuarantineManager quarantines providers that keep failing call verification
+type QuarantineManager struct {
+    db      *sql.DB
+    metrics MetricsInterface
+    config  QuarantineConfig
+
+    mu          sync.RWMutex
+    failures    map[string][]time.Time
+    quarantined map[string]*models.ProviderQuarantine
+}
+
+// NewQuarantineManager creates a new quarantine manager
+func NewQuarantineManager(db *sql.DB, metrics MetricsInterface, config QuarantineConfig) *QuarantineManager {
+    if config.FailureThreshold <= 0 {
+        config.FailureThreshold = 10
+    }
+    if config.Window <= 0 {
+        config.Window = 5 * time.Minute
+    }
+    if config.RefreshInterval <= 0 {
+        config.RefreshInterval = 15 * time.Second
+    }
+
+    qm := &QuarantineManager{
+        db:          db,
+        metrics:     metrics,
+        config:      config,
+        failures:    make(map[string][]time.Time),
+        quarantined: make(map[string]*models.ProviderQuarantine),
+    }
+
+    if config.Enabled {
+        go qm.refreshRoutine()
+    }
+
+    return qm
+}
+
+// IsQuarantined reports whether traffic from the provider must be rejected
+func (qm *QuarantineManager) IsQuarantined(providerName string) bool {
+    if !qm.config.Enabled || providerName == "" {
+        return false
+    }
+
+    qm.mu.RLock()
+    defer qm.mu.RUnlock()
+
+    _, exists := qm.quarantined[providerName]
+    return exists
+}
+
+// RecordFailure counts a verification failure and quarantines the provider
+// once the threshold is exceeded within the configured window
+func (qm *QuarantineManager) RecordFailure(ctx context.Context, providerName, reason string) {
+    if !qm.config.Enabled || providerName == "" {
+        return
+    }
+
+    now := time.Now()
+    cutoff := now.Add(-qm.config.Window)
+
+    qm.mu.Lock()
+    if _, exists := qm.quarantined[providerName]; exists {
+        qm.mu.Unlock()
+        return
+    }
+
+    // Keep only failures inside the window
+    recent := qm.failures[providerName][:0]
+    for _, t := range qm.failures[providerName] {
+        if t.After(cutoff) {
+            recent = append(recent, t)
+        }
+    }
+    recent = append(recent, now)
+    qm.failures[providerName] = recent
+
+    count := len(recent)
+    if count < qm.config.FailureThreshold {
+        qm.mu.Unlock()
+        return
+    }
+
+    quarantine := &models.ProviderQuarantine{
+        ProviderName:  providerName,
+        Reason:        reason,
+        FailureCount:  count,
+        QuarantinedAt: now,
+    }
+    qm.quarantined[providerName] = quarantine
+    delete(qm.failures, providerName)
+    qm.mu.Unlock()
+
+    if err := qm.storeQuarantine(ctx, quarantine); err != nil {
+        logger.WithContext(ctx).WithError(err).WithField("provider", providerName).Warn("Failed to persist provider quarantine")
+    }
+    qm.recordEvent(ctx, models.ProviderEvent{
+        ProviderName: providerName,
+        EventType:    models.ProviderEventQuarantined,
+        Actor:        audit.SystemActor,
+        Detail:       fmt.Sprintf("%d verification failures in %s: %s", count, qm.config.Window, reason),
+    })
+
+    qm.metrics.IncrementCounter("provider_quarantined", map[string]string{
+        "provider": providerName,
+    })
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "provider":      providerName,
+        "failure_count": count,
+        "window":        qm.config.Window.String(),
+        "reason":        reason,
+    }).Error("ALERT: provider quarantined after repeated verification failures")
+}
+
+// Release lifts an active quarantine
+func (qm *QuarantineManager) Release(ctx context.Context, providerName, releasedBy string) error {
+    result, err := qm.db.ExecContext(ctx, `
+        UPDATE provider_quarantine
+        SET released_at = NOW(), released_by = ?
+        WHERE provider_name = ? AND released_at IS NULL`,
+        releasedBy, providerName)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to release quarantine")
+    }
+
+    rows, _ := result.RowsAffected()
+    if rows == 0 {
+        return errors.New(errors.ErrProviderNotFound, "provider is not quarantined").
+            WithContext("provider", providerName)
+    }
+
+    qm.mu.Lock()
+    delete(qm.quarantined, providerName)
+    delete(qm.failures, providerName)
+    qm.mu.Unlock()
+
+    qm.recordEvent(ctx, models.ProviderEvent{
+        ProviderName: providerName,
+        EventType:    models.ProviderEventQuarantineReleased,
+        Actor:        releasedBy,
+    })
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "provider":    providerName,
+        "released_by": releasedBy,
+    }).Info("Provider quarantine released")
+
+    return nil
+}
+
+// ListQuarantined returns all active quarantines
+func (qm *QuarantineManager) ListQuarantined(ctx context.Context) ([]*models.ProviderQuarantine, error) {
+    rows, err := qm.db.QueryContext(ctx, `
+        SELECT id, provider_name, COALESCE(reason, ''), failure_count, quarantined_at
+        FROM provider_quarantine
+        WHERE released_at IS NULL
+        ORDER BY quarantined_at DESC`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query quarantined providers")
+    }
+    defer rows.Close()
+
+    var quarantines []*models.ProviderQuarantine
+    for rows.Next() {
+        var q models.ProviderQuarantine
+        if err := rows.Scan(&q.ID, &q.ProviderName, &q.Reason, &q.FailureCount, &q.QuarantinedAt); err != nil {
+            continue
+        }
+        quarantines = append(quarantines, &q)
+    }
+
+    return quarantines, rows.Err()
+}
+
+func (qm *QuarantineManager) storeQuarantine(ctx context.Context, q *models.ProviderQuarantine) error {
+    result, err := qm.db.ExecContext(ctx, `
+        INSERT INTO provider_quarantine (provider_name, reason, failure_count, quarantined_at)
+        VALUES (?, ?, ?, ?)`,
+        q.ProviderName, q.Reason, q.FailureCount, q.QuarantinedAt)
+    if err != nil {
+        return err
+    }
+
+    id, _ := result.LastInsertId()
+    qm.mu.Lock()
+    q.ID = id
+    qm.mu.Unlock()
+    return nil
+}
+
+func (qm *QuarantineManager) recordEvent(ctx context.Context, event models.ProviderEvent) {
+    if err := audit.RecordProviderEvent(ctx, qm.db, event); err != nil {
+        logger.WithContext(ctx).WithError(err).WithField("provider", event.ProviderName).Warn("Failed to record provider event")
+    }
+}
+
+// refreshRoutine keeps the in-memory set in sync with releases done from the CLI
+func (qm *QuarantineManager) refreshRoutine() {
+    ticker := time.NewTicker(qm.config.RefreshInterval)
+    defer ticker.Stop()
+
+    qm.refresh(context.Background())
+    for range ticker.C {
+        qm.refresh(context.Background())
+    }
+}
+
+// refresh merges the stored quarantines with those of this node. A stored
+// quarantine missing from the database was released, one this node started
+// after the query or never managed to store is kept and stored again.
+func (qm *QuarantineManager) refresh(ctx context.Context) {
+    started := time.Now()
+    quarantines, err := qm.ListQuarantined(ctx)
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Debug("Failed to refresh quarantined providers")
+        return
+    }
+
+    active := make(map[string]*models.ProviderQuarantine, len(quarantines))
+    for _, q := range quarantines {
+        active[q.ProviderName] = q
+    }
+
+    var unstored []*models.ProviderQuarantine
+    qm.mu.Lock()
+    for name, q := range qm.quarantined {
+        if _, stored := active[name]; stored {
+            continue
+        }
+        switch {
+        case q.QuarantinedAt.After(started):
+            active[name] = q
+        case q.ID == 0:
+            active[name] = q
+            unstored = append(unstored, q)
+        }
+    }
+    qm.quarantined = active
+    qm.mu.Unlock()
+
+    for _, q := range unstored {
+        if err := qm.storeQuarantine(ctx, q); err != nil {
+            logger.WithContext(ctx).WithError(err).WithField("provider", q.ProviderName).Debug("Failed to persist provider quarantine")
+        }
+    }
+}
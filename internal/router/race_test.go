@@ -0,0 +1,6 @@
+//go:build race
+
+package router
+
+// raceEnabled is set under the race detector, which slows every call down
+const raceEnabled = true
@@ -0,0 +1,503 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// RateLimitConfig controls the rate limits of routes, providers and destination prefixes
+type RateLimitConfig struct {
+    Enabled         bool
+    RefreshInterval time.Duration // reload of the limits stored in rate_limits
+}
+
+// RateLimiter enforces the calls per second and concurrent call caps of
+// routes, providers and destination prefixes. Counts are per router instance
+// like the load balancer active calls, each node applies the caps to the
+// calls it routes.
+type RateLimiter struct {
+    db      *sql.DB
+    metrics MetricsInterface
+    config  RateLimitConfig
+
+    mu     sync.Mutex
+    calls  map[string][]string    // limit keys counting the call, by call ID
+    active map[string]int         // by limit key
+    starts map[string][]time.Time // call starts of the last second, by limit key
+    limits map[string]*models.RateLimit
+}
+
+// NewRateLimiter creates a limiter and, when enabled, starts its refresh routine
+func NewRateLimiter(db *sql.DB, metrics MetricsInterface, config RateLimitConfig) *RateLimiter {
+    if config.RefreshInterval <= 0 {
+        config.RefreshInterval = 15 * time.Second
+    }
+
+    rl := &RateLimiter{
+        db:      db,
+        metrics: metrics,
+        config:  config,
+        calls:   make(map[string][]string),
+        active:  make(map[string]int),
+        starts:  make(map[string][]time.Time),
+        limits:  make(map[string]*models.RateLimit),
+    }
+
+    if config.Enabled {
+        go rl.refreshRoutine()
+    }
+
+    return rl
+}
+
+func rateLimitKey(scope, value string) string {
+    return scope + "|" + value
+}
+
+// keysLocked returns the limit keys a call counts against: its route, its
+// providers and the longest limited prefix of its destination
+func (rl *RateLimiter) keysLocked(route, dnis string, providers []string) []string {
+    keys := []string{rateLimitKey(models.RateLimitRoute, route)}
+    for _, provider := range namedProviders(providers) {
+        keys = append(keys, rateLimitKey(models.RateLimitProvider, provider))
+    }
+
+    number := numbering.Normalize(dnis)
+    prefix := ""
+    for _, limit := range rl.limits {
+        if limit.Scope == models.RateLimitPrefix && len(limit.Value) > len(prefix) && strings.HasPrefix(number, limit.Value) {
+            prefix = limit.Value
+        }
+    }
+    if prefix != "" {
+        keys = append(keys, rateLimitKey(models.RateLimitPrefix, prefix))
+    }
+    return keys
+}
+
+// exceededLocked returns the cap the key is at, empty when a call fits
+func (rl *RateLimiter) exceededLocked(key string, now time.Time) string {
+    limit, exists := rl.limits[key]
+    if !exists {
+        return ""
+    }
+
+    if limit.MaxConcurrent > 0 && rl.active[key] >= limit.MaxConcurrent {
+        return "max_concurrent"
+    }
+    if limit.MaxCPS > 0 && float64(rl.recentLocked(key, now)) >= limit.MaxCPS {
+        return "max_cps"
+    }
+    return ""
+}
+
+// recentLocked counts the call starts of the last second
+func (rl *RateLimiter) recentLocked(key string, now time.Time) int {
+    count := 0
+    cutoff := now.Add(-time.Second)
+    for _, t := range rl.starts[key] {
+        if t.After(cutoff) {
+            count++
+        }
+    }
+    return count
+}
+
+func (rl *RateLimiter) rejected(key, exceeded string) error {
+    limit := rl.limits[key]
+    rl.metrics.IncrementCounter("router_rate_limited", map[string]string{
+        "scope": limit.Scope,
+        "value": limit.Value,
+    })
+    return errors.New(errors.ErrRateLimited, "rate limit reached").
+        WithContext("scope", limit.Scope).
+        WithContext("value", limit.Value).
+        WithContext("limit", exceeded)
+}
+
+// Allows reports whether the provider may take another call
+func (rl *RateLimiter) Allows(provider string) bool {
+    if !rl.config.Enabled {
+        return true
+    }
+
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+
+    return rl.exceededLocked(rateLimitKey(models.RateLimitProvider, provider), time.Now()) == ""
+}
+
+// Reserve counts a new call of the route to the destination on the given
+// providers. It fails with ErrRateLimited when any of them is at its cap.
+func (rl *RateLimiter) Reserve(callID, route, dnis string, providers ...string) error {
+    if !rl.config.Enabled {
+        return nil
+    }
+    now := time.Now()
+
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+
+    keys := rl.keysLocked(route, dnis, providers)
+    for _, key := range keys {
+        if exceeded := rl.exceededLocked(key, now); exceeded != "" {
+            return rl.rejected(key, exceeded)
+        }
+    }
+
+    rl.calls[callID] = keys
+    rl.countLocked(keys, now)
+    return nil
+}
+
+// Reroute moves a call that failed over to other providers. Only caps the
+// call didn't count against yet are checked; when one is reached the call
+// keeps counting where it did.
+func (rl *RateLimiter) Reroute(callID, route, dnis string, providers ...string) error {
+    if !rl.config.Enabled {
+        return nil
+    }
+    now := time.Now()
+
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+
+    previous, exists := rl.calls[callID]
+    if !exists {
+        return nil
+    }
+    held := make(map[string]bool, len(previous))
+    for _, key := range previous {
+        held[key] = true
+    }
+
+    keys := rl.keysLocked(route, dnis, providers)
+    var added []string
+    for _, key := range keys {
+        if held[key] {
+            continue
+        }
+        if exceeded := rl.exceededLocked(key, now); exceeded != "" {
+            return rl.rejected(key, exceeded)
+        }
+        added = append(added, key)
+    }
+
+    rl.releaseLocked(previous)
+    rl.calls[callID] = keys
+    for _, key := range keys {
+        rl.active[key]++
+    }
+    // A failover is a new call setup on the providers it moves to
+    for _, key := range added {
+        rl.recordStartLocked(key, now)
+    }
+    return nil
+}
+
+func (rl *RateLimiter) countLocked(keys []string, now time.Time) {
+    for _, key := range keys {
+        rl.active[key]++
+        rl.recordStartLocked(key, now)
+    }
+}
+
+func (rl *RateLimiter) recordStartLocked(key string, now time.Time) {
+    cutoff := now.Add(-time.Second)
+    recent := rl.starts[key][:0]
+    for _, t := range rl.starts[key] {
+        if t.After(cutoff) {
+            recent = append(recent, t)
+        }
+    }
+    rl.starts[key] = append(recent, now)
+}
+
+// held returns the caps a call counts against, to restore them with restore
+func (rl *RateLimiter) held(callID string) []string {
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+
+    return append([]string(nil), rl.calls[callID]...)
+}
+
+// restore makes a call count against the caps held returned again, undoing a
+// Reroute of a failover that didn't go through. Calls released meanwhile stay
+// released.
+func (rl *RateLimiter) restore(callID string, keys []string) {
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+
+    current, exists := rl.calls[callID]
+    if !exists || len(keys) == 0 {
+        return
+    }
+    rl.releaseLocked(current)
+    rl.calls[callID] = keys
+    for _, key := range keys {
+        rl.active[key]++
+    }
+}
+
+// Release ends the call, it is a no-op for calls that were never reserved
+func (rl *RateLimiter) Release(callID string) {
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+
+    keys, exists := rl.calls[callID]
+    if !exists {
+        return
+    }
+    delete(rl.calls, callID)
+    rl.releaseLocked(keys)
+}
+
+func (rl *RateLimiter) releaseLocked(keys []string) {
+    for _, key := range keys {
+        if rl.active[key]--; rl.active[key] <= 0 {
+            delete(rl.active, key)
+        }
+    }
+}
+
+func (rl *RateLimiter) refreshRoutine() {
+    ticker := time.NewTicker(rl.config.RefreshInterval)
+    defer ticker.Stop()
+
+    rl.refresh(context.Background())
+    for range ticker.C {
+        rl.refresh(context.Background())
+    }
+}
+
+func (rl *RateLimiter) refresh(ctx context.Context) {
+    list, err := rl.query(ctx, "")
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Debug("Failed to refresh rate limits")
+        return
+    }
+
+    limits := make(map[string]*models.RateLimit, len(list))
+    for _, l := range list {
+        limits[rateLimitKey(l.Scope, l.Value)] = l
+    }
+
+    now := time.Now()
+    rl.mu.Lock()
+    rl.limits = limits
+    // Forget the starts of keys without recent calls
+    for key := range rl.starts {
+        if rl.recentLocked(key, now) == 0 {
+            delete(rl.starts, key)
+        }
+    }
+    rl.mu.Unlock()
+}
+
+func (rl *RateLimiter) query(ctx context.Context, where string, args ...interface{}) ([]*models.RateLimit, error) {
+    rows, err := rl.db.QueryContext(ctx, `
+        SELECT scope, scope_value, max_cps, max_concurrent, COALESCE(updated_by, ''), updated_at
+        FROM rate_limits `+where+`
+        ORDER BY scope, scope_value`, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query rate limits")
+    }
+    defer rows.Close()
+
+    var limits []*models.RateLimit
+    for rows.Next() {
+        var l models.RateLimit
+        if err := rows.Scan(&l.Scope, &l.Value, &l.MaxCPS, &l.MaxConcurrent, &l.UpdatedBy, &l.UpdatedAt); err != nil {
+            continue
+        }
+        limits = append(limits, &l)
+    }
+    return limits, rows.Err()
+}
+
+// SetRateLimit creates or updates the rate limit of a route, a provider or a
+// destination prefix. The routers pick it up at their next refresh, this one
+// at once.
+func (r *Router) SetRateLimit(ctx context.Context, limit *models.RateLimit, user string) error {
+    if limit.MaxCPS < 0 || limit.MaxConcurrent < 0 {
+        return errors.New(errors.ErrInternal, "rate limit caps can't be negative")
+    }
+    if limit.MaxCPS == 0 && limit.MaxConcurrent == 0 {
+        return errors.New(errors.ErrInternal, "rate limit needs a CPS or concurrent call cap")
+    }
+
+    switch limit.Scope {
+    case models.RateLimitRoute:
+        if _, err := r.GetRoute(ctx, limit.Value); err != nil {
+            return err
+        }
+    case models.RateLimitProvider:
+        var exists int
+        err := r.db.QueryRowContext(ctx, "SELECT 1 FROM providers WHERE name = ?", limit.Value).Scan(&exists)
+        if err == sql.ErrNoRows {
+            return errors.New(errors.ErrProviderNotFound, "provider not found").WithContext("provider", limit.Value)
+        }
+        if err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to get provider")
+        }
+    case models.RateLimitPrefix:
+        if limit.Value = numbering.Normalize(limit.Value); limit.Value == "" {
+            return errors.New(errors.ErrInternal, "prefix must contain digits")
+        }
+    default:
+        return errors.New(errors.ErrInternal, "rate limit scope must be route, provider or prefix").
+            WithContext("scope", limit.Scope)
+    }
+    limit.UpdatedBy = user
+
+    var old interface{}
+    if limits, err := r.rateLimits.query(ctx, "WHERE scope = ? AND scope_value = ?", limit.Scope, limit.Value); err != nil {
+        return err
+    } else if len(limits) > 0 {
+        old = limits[0]
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `
+        INSERT INTO rate_limits (scope, scope_value, max_cps, max_concurrent, updated_by)
+        VALUES (?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE max_cps = VALUES(max_cps), max_concurrent = VALUES(max_concurrent),
+            updated_by = VALUES(updated_by)`,
+        limit.Scope, limit.Value, limit.MaxCPS, limit.MaxConcurrent, nullString(user))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to set rate limit")
+    }
+
+    action := "update"
+    if old == nil {
+        action = "create"
+    }
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "rate_limit",
+        EntityType: limit.Scope,
+        EntityID:   limit.Value,
+        UserID:     user,
+        Action:     action,
+        OldValue:   old,
+        NewValue:   limit,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    r.rateLimits.refresh(ctx)
+    return nil
+}
+
+// DeleteRateLimit removes the rate limit of a route, a provider or a
+// destination prefix
+func (r *Router) DeleteRateLimit(ctx context.Context, scope, value, user string) error {
+    if scope == models.RateLimitPrefix {
+        value = numbering.Normalize(value)
+    }
+    limits, err := r.rateLimits.query(ctx, "WHERE scope = ? AND scope_value = ?", scope, value)
+    if err != nil {
+        return err
+    }
+    if len(limits) == 0 {
+        return errors.New(errors.ErrInternal, "rate limit not found").
+            WithContext("scope", scope).
+            WithContext("value", value)
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM rate_limits WHERE scope = ? AND scope_value = ?", scope, value); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete rate limit")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "rate_limit",
+        EntityType: scope,
+        EntityID:   value,
+        UserID:     user,
+        Action:     "delete",
+        OldValue:   limits[0],
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    r.rateLimits.refresh(ctx)
+    return nil
+}
+
+// ListRateLimits returns the rate limits, optionally of one scope, with the
+// live usage of this router instance
+func (r *Router) ListRateLimits(ctx context.Context, scope string) ([]*models.RateLimit, error) {
+    where := ""
+    var args []interface{}
+    if scope != "" {
+        where = "WHERE scope = ?"
+        args = append(args, scope)
+    }
+    limits, err := r.rateLimits.query(ctx, where, args...)
+    if err != nil {
+        return nil, err
+    }
+
+    rl := r.rateLimits
+    now := time.Now()
+    rl.mu.Lock()
+    for _, l := range limits {
+        key := rateLimitKey(l.Scope, l.Value)
+        l.ActiveCalls = rl.active[key]
+        l.CPS = float64(rl.recentLocked(key, now))
+    }
+    rl.mu.Unlock()
+
+    return limits, nil
+}
+
+// SetRateLimits makes provider selection skip providers at their rate limit
+func (lb *LoadBalancer) SetRateLimits(limits *RateLimiter) {
+    lb.rateLimits = limits
+}
+
+// applyRateLimits drops providers that can't take another call
+func (lb *LoadBalancer) applyRateLimits(providers []*models.Provider) ([]*models.Provider, error) {
+    if lb.rateLimits == nil || !lb.rateLimits.config.Enabled || len(providers) == 0 {
+        return providers, nil
+    }
+
+    allowed := providers[:0:0]
+    for _, p := range providers {
+        if lb.rateLimits.Allows(p.Name) {
+            allowed = append(allowed, p)
+        }
+    }
+
+    if len(allowed) == 0 {
+        return nil, errors.New(errors.ErrRateLimited, "all providers at their rate limit")
+    }
+    return allowed, nil
+}
@@ -0,0 +1,449 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "encoding/csv"
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// rateCall prices a finished call in the reporting currency. The customer is
+// billed the inbound leg at the longest prefix of its rate deck matching the
+// number dialled, plus the line's connection fee when the call was answered,
+// or at its cost_per_minute without a matching line. The cost is the DID and
+// intermediate provider rates on the intermediate leg, which the DID carries,
+// plus the final provider rate on the final leg.
+func (r *Router) rateCall(ctx context.Context, tx *sql.Tx, record *models.CallRecord) {
+    didRate, rates := r.didManager.legRates(ctx, tx, record)
+
+    record.Cost = (didRate + rates[record.IntermediateProvider]) * float64(record.IntermediateBillable) / 60
+    record.Cost += rates[record.FinalProvider] * float64(record.FinalBillable) / 60
+    record.BilledAmount = rates[record.InboundProvider] * float64(record.BillableDuration) / 60
+    record.RatePrefix = ""
+
+    if line := r.customerRate(ctx, tx, record.InboundProvider, record.OriginalDNIS); line != nil {
+        record.RatePrefix = line.Prefix
+        record.BilledAmount = r.fx.Convert(ctx, line.Rate, line.Currency) * float64(record.BillableDuration) / 60
+        if record.AnswerTime != nil && record.BillableDuration > 0 {
+            record.BilledAmount += r.fx.Convert(ctx, line.ConnectionFee, line.Currency)
+        }
+    }
+
+    record.Margin = record.BilledAmount - record.Cost
+    record.Currency = r.fx.Currency()
+
+    if !record.IsTest && record.BillableDuration > 0 && record.Margin < 0 {
+        r.metrics.IncrementCounter("router_negative_margin_calls", map[string]string{
+            "customer": record.InboundProvider,
+            "route":    record.RouteName,
+        })
+    }
+}
+
+// customerRate returns the rate deck line of a customer with the longest
+// prefix of the number, or nil
+func (r *Router) customerRate(ctx context.Context, tx *sql.Tx, customer, dnis string) *models.CustomerRate {
+    number := numbering.Normalize(dnis)
+    if customer == "" || number == "" {
+        return nil
+    }
+
+    var line models.CustomerRate
+    err := tx.QueryRowContext(ctx, `
+        SELECT prefix, rate, connection_fee, COALESCE(currency, '')
+        FROM customer_rates
+        WHERE customer = ? AND ? LIKE CONCAT(prefix, '%')
+        ORDER BY LENGTH(prefix) DESC
+        LIMIT 1`, customer, number).Scan(&line.Prefix, &line.Rate, &line.ConnectionFee, &line.Currency)
+    if err != nil {
+        if err != sql.ErrNoRows {
+            logger.WithContext(ctx).WithError(err).WithField("customer", customer).Warn("Failed to look up customer rate, billing the flat rate")
+        }
+        return nil
+    }
+    line.Customer = customer
+    return &line
+}
+
+// normalizeCustomerRate checks a rate deck line and keeps the digits of its prefix
+func normalizeCustomerRate(rate *models.CustomerRate) error {
+    if rate.Prefix = numbering.Normalize(rate.Prefix); rate.Prefix == "" {
+        return errors.New(errors.ErrInternal, "prefix must contain digits")
+    }
+    if rate.Rate < 0 || rate.ConnectionFee < 0 {
+        return errors.New(errors.ErrInternal, fmt.Sprintf("negative rate for prefix %s", rate.Prefix))
+    }
+    rate.Currency = strings.ToUpper(strings.TrimSpace(rate.Currency))
+    if rate.Currency != "" && len(rate.Currency) != 3 {
+        return errors.New(errors.ErrInternal, fmt.Sprintf("invalid currency %q, expected an ISO 4217 code", rate.Currency))
+    }
+    return nil
+}
+
+// checkCustomer fails unless name is an inbound provider
+func (r *Router) checkCustomer(ctx context.Context, name string) error {
+    var customers int
+    err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM providers WHERE name = ? AND type = ?",
+        name, models.ProviderTypeInbound).Scan(&customers)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to look up customer")
+    }
+    if customers == 0 {
+        return errors.New(errors.ErrProviderNotFound, "rate decks are for inbound providers only").
+            WithContext("customer", name)
+    }
+    return nil
+}
+
+// SetCustomerRate creates or updates a line of a customer's rate deck
+func (r *Router) SetCustomerRate(ctx context.Context, rate *models.CustomerRate, user string) error {
+    if err := normalizeCustomerRate(rate); err != nil {
+        return err
+    }
+    if err := r.checkCustomer(ctx, rate.Customer); err != nil {
+        return err
+    }
+    rate.UpdatedBy = user
+
+    var old interface{}
+    if rates, err := r.queryCustomerRates(ctx, "WHERE customer = ? AND prefix = ?", rate.Customer, rate.Prefix); err != nil {
+        return err
+    } else if len(rates) > 0 {
+        old = rates[0]
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if err := upsertCustomerRate(ctx, tx, rate); err != nil {
+        return err
+    }
+
+    action := "update"
+    if old == nil {
+        action = "create"
+    }
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "customer_rate",
+        EntityType: "customer",
+        EntityID:   rate.Customer,
+        UserID:     user,
+        Action:     action,
+        OldValue:   old,
+        NewValue:   rate,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+// ImportCustomerRates loads a rate deck into a customer's. With replace the
+// lines missing from the import are removed, otherwise they are kept.
+func (r *Router) ImportCustomerRates(ctx context.Context, customer string, rates []*models.CustomerRate, replace bool, user string) (int, error) {
+    if len(rates) == 0 {
+        return 0, errors.New(errors.ErrInternal, "rate deck is empty")
+    }
+    seen := make(map[string]bool, len(rates))
+    for _, rate := range rates {
+        rate.Customer = customer
+        rate.UpdatedBy = user
+        if err := normalizeCustomerRate(rate); err != nil {
+            return 0, err
+        }
+        if seen[rate.Prefix] {
+            return 0, errors.New(errors.ErrInternal, fmt.Sprintf("prefix %s listed twice in rate deck", rate.Prefix))
+        }
+        seen[rate.Prefix] = true
+    }
+    if err := r.checkCustomer(ctx, customer); err != nil {
+        return 0, err
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if replace {
+        if _, err := tx.ExecContext(ctx, "DELETE FROM customer_rates WHERE customer = ?", customer); err != nil {
+            return 0, errors.Wrap(err, errors.ErrDatabase, "failed to remove customer rates")
+        }
+    }
+    for _, rate := range rates {
+        if err := upsertCustomerRate(ctx, tx, rate); err != nil {
+            return 0, err
+        }
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "customer_rate",
+        EntityType: "customer",
+        EntityID:   customer,
+        UserID:     user,
+        Action:     "import",
+        Metadata:   map[string]interface{}{"rates": len(rates), "replace": replace},
+    }); err != nil {
+        return 0, err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "customer": customer,
+        "rates":    len(rates),
+        "replace":  replace,
+    }).Info("Customer rate deck imported")
+    return len(rates), nil
+}
+
+func upsertCustomerRate(ctx context.Context, tx *sql.Tx, rate *models.CustomerRate) error {
+    _, err := tx.ExecContext(ctx, `
+        INSERT INTO customer_rates (customer, prefix, rate, connection_fee, currency, description, updated_by)
+        VALUES (?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE rate = VALUES(rate), connection_fee = VALUES(connection_fee),
+            currency = VALUES(currency), description = VALUES(description), updated_by = VALUES(updated_by)`,
+        rate.Customer, rate.Prefix, rate.Rate, rate.ConnectionFee, nullString(rate.Currency),
+        nullString(rate.Description), nullString(rate.UpdatedBy))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to set customer rate").WithContext("prefix", rate.Prefix)
+    }
+    return nil
+}
+
+// DeleteCustomerRate removes a line of a customer's rate deck
+func (r *Router) DeleteCustomerRate(ctx context.Context, customer, prefix, user string) error {
+    prefix = numbering.Normalize(prefix)
+    rates, err := r.queryCustomerRates(ctx, "WHERE customer = ? AND prefix = ?", customer, prefix)
+    if err != nil {
+        return err
+    }
+    if len(rates) == 0 {
+        return errors.New(errors.ErrInternal, "customer rate not found").
+            WithContext("customer", customer).
+            WithContext("prefix", prefix)
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM customer_rates WHERE customer = ? AND prefix = ?", customer, prefix); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete customer rate")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "customer_rate",
+        EntityType: "customer",
+        EntityID:   customer,
+        UserID:     user,
+        Action:     "delete",
+        OldValue:   rates[0],
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+// ListCustomerRates returns the rate deck of a customer, or of every customer
+// when customer is empty, by prefix
+func (r *Router) ListCustomerRates(ctx context.Context, customer string) ([]*models.CustomerRate, error) {
+    if customer == "" {
+        return r.queryCustomerRates(ctx, "")
+    }
+    return r.queryCustomerRates(ctx, "WHERE customer = ?", customer)
+}
+
+func (r *Router) queryCustomerRates(ctx context.Context, where string, args ...interface{}) ([]*models.CustomerRate, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT customer, prefix, rate, connection_fee, COALESCE(currency, ''), COALESCE(description, ''),
+               COALESCE(updated_by, ''), updated_at
+        FROM customer_rates
+        `+where+`
+        ORDER BY customer, prefix`, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query customer rates")
+    }
+    defer rows.Close()
+
+    var rates []*models.CustomerRate
+    for rows.Next() {
+        var rate models.CustomerRate
+        if err := rows.Scan(&rate.Customer, &rate.Prefix, &rate.Rate, &rate.ConnectionFee, &rate.Currency,
+            &rate.Description, &rate.UpdatedBy, &rate.UpdatedAt); err != nil {
+            continue
+        }
+        rates = append(rates, &rate)
+    }
+    return rates, rows.Err()
+}
+
+// ParseRateDeck reads a CSV rate deck with the columns prefix, rate and the
+// optional connection_fee, currency and description. A first line that
+// doesn't start with a number is taken for a header.
+func ParseRateDeck(in io.Reader) ([]*models.CustomerRate, error) {
+    reader := csv.NewReader(in)
+    reader.FieldsPerRecord = -1
+    reader.TrimLeadingSpace = true
+    records, err := reader.ReadAll()
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to read rate deck")
+    }
+
+    var rates []*models.CustomerRate
+    for i, record := range records {
+        if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+            continue
+        }
+        if i == 0 && numbering.Normalize(record[0]) == "" {
+            continue
+        }
+        if len(record) < 2 {
+            return nil, errors.New(errors.ErrInternal, fmt.Sprintf("line %d: expected prefix and rate", i+1))
+        }
+
+        rate := &models.CustomerRate{Prefix: record[0]}
+        if rate.Rate, err = strconv.ParseFloat(strings.TrimSpace(record[1]), 64); err != nil {
+            return nil, errors.New(errors.ErrInternal, fmt.Sprintf("line %d: invalid rate %q", i+1, record[1]))
+        }
+        if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+            if rate.ConnectionFee, err = strconv.ParseFloat(strings.TrimSpace(record[2]), 64); err != nil {
+                return nil, errors.New(errors.ErrInternal, fmt.Sprintf("line %d: invalid connection fee %q", i+1, record[2]))
+            }
+        }
+        if len(record) > 3 {
+            rate.Currency = record[3]
+        }
+        if len(record) > 4 {
+            rate.Description = strings.TrimSpace(record[4])
+        }
+        rates = append(rates, rate)
+    }
+    return rates, nil
+}
+
+// GetBillingReport totals the rated production calls that ended in the
+// period per customer, with the DID rental of the period. Calls rated while
+// another reporting currency was configured are converted to the current one.
+func (r *Router) GetBillingReport(ctx context.Context, from, to time.Time) (*models.BillingReport, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT COALESCE(inbound_provider, ''), COALESCE(currency, ''), COUNT(*),
+               SUM(CASE WHEN answer_time IS NOT NULL THEN 1 ELSE 0 END),
+               COALESCE(SUM(billable_duration), 0) / 60,
+               COALESCE(SUM(billed_amount), 0), COALESCE(SUM(cost), 0)
+        FROM call_records
+        WHERE end_time >= ? AND end_time < ? AND billed_amount IS NOT NULL
+          AND COALESCE(is_test, 0) = 0
+        GROUP BY inbound_provider, currency`, from, to)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query billing")
+    }
+    defer rows.Close()
+
+    currency := r.fx.Currency()
+    report := &models.BillingReport{From: from, To: to, Total: models.BillingSummary{Currency: currency}}
+    byCustomer := make(map[string]*models.BillingSummary)
+    for rows.Next() {
+        var customer, rowCurrency string
+        var calls, answered int64
+        var minutes, revenue, cost float64
+        if err := rows.Scan(&customer, &rowCurrency, &calls, &answered, &minutes, &revenue, &cost); err != nil {
+            continue
+        }
+
+        s, ok := byCustomer[customer]
+        if !ok {
+            s = &models.BillingSummary{Customer: customer, Currency: currency}
+            byCustomer[customer] = s
+            report.Customers = append(report.Customers, s)
+        }
+        s.Calls += calls
+        s.Answered += answered
+        s.BilledMinutes += minutes
+        s.Revenue += r.fx.Convert(ctx, revenue, rowCurrency)
+        s.Cost += r.fx.Convert(ctx, cost, rowCurrency)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read billing")
+    }
+
+    total := &report.Total
+    for _, s := range report.Customers {
+        finishBillingSummary(s)
+        total.Calls += s.Calls
+        total.Answered += s.Answered
+        total.BilledMinutes += s.BilledMinutes
+        total.Revenue += s.Revenue
+        total.Cost += s.Cost
+    }
+    finishBillingSummary(total)
+    sort.SliceStable(report.Customers, func(i, j int) bool {
+        return report.Customers[i].Revenue > report.Customers[j].Revenue
+    })
+
+    rental, err := r.didRental(ctx, to.Sub(from))
+    if err != nil {
+        return nil, err
+    }
+    report.DIDRental = rental
+    report.NetMargin = total.Margin - rental
+    return report, nil
+}
+
+func finishBillingSummary(s *models.BillingSummary) {
+    s.Margin = s.Revenue - s.Cost
+    if s.Revenue > 0 {
+        s.MarginPercent = s.Margin / s.Revenue * 100
+    }
+}
+
+// didRental prorates the monthly cost of the production DIDs to a period,
+// months counted as 30 days
+func (r *Router) didRental(ctx context.Context, period time.Duration) (float64, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT COALESCE(currency, ''), COALESCE(SUM(monthly_cost), 0)
+        FROM dids
+        WHERE COALESCE(is_test, 0) = 0
+        GROUP BY currency`)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to query DID costs")
+    }
+    defer rows.Close()
+
+    var monthly float64
+    for rows.Next() {
+        var currency string
+        var cost float64
+        if err := rows.Scan(&currency, &cost); err != nil {
+            continue
+        }
+        monthly += r.fx.Convert(ctx, cost, currency)
+    }
+    return monthly * period.Hours() / (30 * 24), rows.Err()
+}
@@ -0,0 +1,109 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// ReadOnlyMode returns whether the management plane is frozen, by the
+// configuration or at runtime
+func (r *Router) ReadOnlyMode(ctx context.Context) (*models.ReadOnlyMode, error) {
+    mode := &models.ReadOnlyMode{Enabled: r.config.ReadOnly, Configured: r.config.ReadOnly}
+
+    var reason, setBy sql.NullString
+    var enabled bool
+    var setAt time.Time
+    err := r.db.QueryRowContext(ctx, "SELECT enabled, reason, set_by, set_at FROM read_only_mode WHERE id = 1").
+        Scan(&enabled, &reason, &setBy, &setAt)
+    if err == sql.ErrNoRows {
+        return mode, nil
+    }
+    if err != nil {
+        if mode.Configured {
+            return mode, nil
+        }
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query read-only mode")
+    }
+
+    if enabled {
+        mode.Enabled = true
+        mode.Reason, mode.SetBy, mode.SetAt = reason.String, setBy.String, &setAt
+    }
+    return mode, nil
+}
+
+// CheckWritable fails with READ_ONLY while the management plane is frozen.
+// Call processing never checks it.
+func (r *Router) CheckWritable(ctx context.Context) error {
+    mode, err := r.ReadOnlyMode(ctx)
+    if err != nil {
+        return err
+    }
+    if !mode.Enabled {
+        return nil
+    }
+
+    message := "management plane is read-only"
+    if mode.Reason != "" {
+        message += ": " + mode.Reason
+    }
+    return errors.New(errors.ErrReadOnly, message)
+}
+
+// SetReadOnly freezes or unfreezes the management plane on every node
+func (r *Router) SetReadOnly(ctx context.Context, enabled bool, reason, user string) error {
+    if !enabled && r.config.ReadOnly {
+        return errors.New(errors.ErrConfiguration, "read-only mode is set in the configuration")
+    }
+
+    old, err := r.ReadOnlyMode(ctx)
+    if err != nil {
+        return err
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, `
+        INSERT INTO read_only_mode (id, enabled, reason, set_by) VALUES (1, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE enabled = VALUES(enabled), reason = VALUES(reason), set_by = VALUES(set_by)`,
+        enabled, nullString(reason), nullString(user)); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to set read-only mode")
+    }
+
+    action := "enable"
+    if !enabled {
+        action = "disable"
+    }
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "read_only_mode",
+        EntityType: "system",
+        EntityID:   "management",
+        UserID:     user,
+        Action:     action,
+        OldValue:   old,
+        Metadata:   map[string]interface{}{"reason": reason},
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "enabled": enabled,
+        "reason":  reason,
+        "user":    user,
+    }).Warn("Management plane read-only mode changed")
+    return nil
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+    "sync"
+    "time"
+)
+
+// ReplayGuard gives return and final legs one-shot semantics
+type ReplayGuard struct {
+    mu       sync.Mutex
+    ttl      time.Duration
+    consumed map[string]consumedLeg
+}
+
+type consumedLeg struct {
+    callID     string
+    consumedAt time.Time
+}
+
+// NewReplayGuard creates a guard that remembers consumed legs for ttl
+func NewReplayGuard(ttl time.Duration) *ReplayGuard {
+    if ttl <= 0 {
+        ttl = 30 * time.Minute
+    }
+    
+    return &ReplayGuard{
+        ttl:      ttl,
+        consumed: make(map[string]consumedLeg),
+    }
+}
+
+// Consume marks the leg as used by callID. It returns false when the
+// same call already consumed it, i.e. the request is a replay.
+func (g *ReplayGuard) Consume(key, callID string) bool {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    
+    if leg, exists := g.consumed[key]; exists && leg.callID == callID && time.Since(leg.consumedAt) < g.ttl {
+        return false
+    }
+    
+    g.consumed[key] = consumedLeg{callID: callID, consumedAt: time.Now()}
+    return true
+}
+
+// Lookup returns the call that recently consumed the leg, if any
+func (g *ReplayGuard) Lookup(key string) (string, bool) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    
+    leg, exists := g.consumed[key]
+    if !exists || time.Since(leg.consumedAt) >= g.ttl {
+        return "", false
+    }
+    return leg.callID, true
+}
+
+// Cleanup drops expired entries
+func (g *ReplayGuard) Cleanup() {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    
+    for key, leg := range g.consumed {
+        if time.Since(leg.consumedAt) >= g.ttl {
+            delete(g.consumed, key)
+        }
+    }
+}
+
+func returnLegKey(did string) string {
+    return "return:" + did
+}
+
+func finalLegKey(ani, dnis string) string {
+    return "final:" + ani + "|" + dnis
+}
@@ -0,0 +1,137 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "sort"
+    "strings"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// exclusionRule is the routing_rules key of the providers a route never dials
+const exclusionRule = "exclude_providers"
+
+// parseRouteExclusions reads the excluded providers out of a route's routing rules
+func parseRouteExclusions(rules models.JSON) []string {
+    raw, ok := rules[exclusionRule]
+    if !ok || raw == nil {
+        return nil
+    }
+
+    data, err := json.Marshal(raw)
+    if err != nil {
+        return nil
+    }
+    var providers []string
+    if err := json.Unmarshal(data, &providers); err != nil || len(providers) == 0 {
+        return nil
+    }
+    return providers
+}
+
+// SetRouteExclusions replaces the providers a route never dials, none lets it
+// dial every provider of its legs again. Other routing rules are kept.
+func (r *Router) SetRouteExclusions(ctx context.Context, routeName string, providers []string, user string) error {
+    route, err := r.GetRoute(ctx, routeName)
+    if err != nil {
+        return err
+    }
+
+    seen := make(map[string]bool, len(providers))
+    var excluded []string
+    for _, name := range providers {
+        name = strings.TrimSpace(name)
+        if name == "" || seen[name] {
+            continue
+        }
+        seen[name] = true
+
+        var exists int
+        err := r.db.QueryRowContext(ctx, "SELECT 1 FROM providers WHERE name = ?", name).Scan(&exists)
+        if err == sql.ErrNoRows {
+            return errors.New(errors.ErrProviderNotFound, "provider not found").WithContext("provider", name)
+        }
+        if err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to get provider")
+        }
+        excluded = append(excluded, name)
+    }
+    sort.Strings(excluded)
+
+    rules := route.RoutingRules
+    if rules == nil {
+        rules = models.JSON{}
+    }
+    if len(excluded) == 0 {
+        delete(rules, exclusionRule)
+    } else {
+        rules[exclusionRule] = excluded
+    }
+
+    var value interface{}
+    if len(rules) > 0 {
+        value, _ = json.Marshal(rules)
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx,
+        "UPDATE provider_routes SET routing_rules = ? WHERE name = ?", value, routeName); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update route exclusions")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "route_exclusions",
+        EntityType: "route",
+        EntityID:   routeName,
+        UserID:     user,
+        Action:     "update",
+        OldValue:   route.ExcludedProviders,
+        NewValue:   excluded,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    r.flushRoutes(ctx)
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "route":    routeName,
+        "excluded": excluded,
+        "user":     user,
+    }).Info("Route provider exclusions set")
+    return nil
+}
+
+// excludeProviders drops the providers the route never dials from those a leg
+// resolved to, its groups flattened. A leg left with none fails rather than
+// fall back to an excluded provider.
+func excludeProviders(route *models.ProviderRoute, spec string, providers []*models.Provider) ([]*models.Provider, error) {
+    if len(route.ExcludedProviders) == 0 {
+        return providers, nil
+    }
+
+    allowed := make([]*models.Provider, 0, len(providers))
+    for _, p := range providers {
+        if !route.Excludes(p.Name) {
+            allowed = append(allowed, p)
+        }
+    }
+    if len(allowed) == 0 && len(providers) > 0 {
+        return nil, errors.New(errors.ErrProviderNotFound, "every provider of the leg is excluded by the route").
+            WithContext("route", route.Name).
+            WithContext("providers", spec)
+    }
+    return allowed, nil
+}
@@ -0,0 +1,279 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "strconv"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// hopsRule is the routing_rules key of the intermediates a route's calls go
+// through after its own
+const hopsRule = "hops"
+
+// parseRouteHops reads the hops out of a route's routing rules
+func parseRouteHops(rules models.JSON) []models.RouteHop {
+    raw, ok := rules[hopsRule]
+    if !ok || raw == nil {
+        return nil
+    }
+
+    data, err := json.Marshal(raw)
+    if err != nil {
+        return nil
+    }
+    var hops []models.RouteHop
+    if err := json.Unmarshal(data, &hops); err != nil || len(hops) == 0 {
+        return nil
+    }
+    return hops
+}
+
+// SetRouteHops replaces the intermediates calls of a route go through after
+// its own, in order, none leaves the route S1 to S2 to S3 and back to S4.
+// New calls take the hops, those in progress keep theirs. Other routing rules
+// are kept.
+func (r *Router) SetRouteHops(ctx context.Context, routeName string, hops []models.RouteHop, user string) error {
+    route, err := r.GetRoute(ctx, routeName)
+    if err != nil {
+        return err
+    }
+    if len(hops) > 0 && route.PassThrough {
+        return errors.New(errors.ErrConfiguration, "a pass-through route has no intermediates to add hops to").
+            WithContext("route", routeName)
+    }
+
+    for _, hop := range hops {
+        if hop.Manipulations != nil && (hop.Manipulations.DNISStripPrefix != "" || hop.Manipulations.DNISAddPrefix != "") {
+            return errors.New(errors.ErrConfiguration, "hops are sent their DID as DNIS, only the ANI can be manipulated").
+                WithContext("provider", hop.Provider)
+        }
+
+        query, notFound := "SELECT 1 FROM providers WHERE name = ?", "provider not found"
+        if hop.IsGroup {
+            query, notFound = "SELECT 1 FROM provider_groups WHERE name = ?", "provider group not found"
+        }
+        var exists int
+        err := r.db.QueryRowContext(ctx, query, hop.Provider).Scan(&exists)
+        if err == sql.ErrNoRows {
+            return errors.New(errors.ErrProviderNotFound, notFound).WithContext("provider", hop.Provider)
+        }
+        if err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to get provider")
+        }
+    }
+
+    rules := route.RoutingRules
+    if rules == nil {
+        rules = models.JSON{}
+    }
+    if len(hops) == 0 {
+        delete(rules, hopsRule)
+    } else {
+        rules[hopsRule] = hops
+    }
+
+    var value interface{}
+    if len(rules) > 0 {
+        value, _ = json.Marshal(rules)
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx,
+        "UPDATE provider_routes SET routing_rules = ? WHERE name = ?", value, routeName); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update route hops")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "route_hops",
+        EntityType: "route",
+        EntityID:   routeName,
+        UserID:     user,
+        Action:     "update",
+        OldValue:   route.Hops,
+        NewValue:   hops,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    r.flushRoutes(ctx)
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "route": routeName,
+        "hops":  len(hops),
+        "user":  user,
+    }).Info("Route hops set")
+    return nil
+}
+
+// hopLegOf finds the hop of the call that came back on did, as the call was
+// given to it with the hop's own policy, and its number. Nil when the DID is
+// that of the route's own intermediate.
+func hopLegOf(record *models.CallRecord, did string) (*models.CallRecord, int) {
+    for i, leg := range record.ReachedHops() {
+        if leg.AssignedDID != did || i >= len(record.Hops) {
+            continue
+        }
+
+        hop := record.Hops[i]
+        leg.TransformedANI = record.HopANI(i + 2)
+        if hop.VerificationEnabled != nil {
+            leg.VerificationEnabled = hop.VerificationEnabled
+        }
+        if hop.StrictMode != nil {
+            leg.StrictMode = hop.StrictMode
+        }
+        return leg, i + 2
+    }
+    return nil, 0
+}
+
+// markHopReturned records the hop on did bringing the call back
+func (r *Router) markHopReturned(callID, did string) {
+    r.activeCalls.Update(callID, func(record *models.CallRecord) {
+        for i := range record.HopLegs {
+            if record.HopLegs[i].DID == did && record.HopLegs[i].ReturnedAt == nil {
+                now := time.Now()
+                record.HopLegs[i].ReturnedAt = &now
+            }
+        }
+    })
+}
+
+// nextHop hands a call one of its intermediates brought back to the next hop
+// of its route, on a DID of the intermediate picked for the hop. The call
+// goes on to S4 once the last hop brought it back.
+func (r *Router) nextHop(ctx context.Context, record *models.CallRecord) (*models.CallResponse, error) {
+    index := len(record.HopLegs)
+    hop := record.Hops[index]
+    number := index + 2
+
+    // The route may have changed since the call took it, its hops stay those of the call
+    route, err := r.GetRoute(ctx, record.RouteName)
+    if err != nil {
+        route = &models.ProviderRoute{Name: record.RouteName}
+    }
+
+    provider, err := r.selectProvider(ctx, route, hop.Provider, hop.IsGroup, route.LoadBalanceMode)
+    if err != nil {
+        r.countHop(record, number, "no_provider")
+        return nil, err
+    }
+
+    // The hop's intermediate carries the call alongside those before it
+    providers := append(append([]string{record.IntermediateProvider}, hopProviders(record)...), provider.Name, record.FinalProvider)
+    restore, err := r.rerouteReservations(record, record.RouteName, providers...)
+    if err != nil {
+        r.countHop(record, number, "limited")
+        return nil, err
+    }
+    committed := false
+    defer func() {
+        if !committed {
+            restore()
+        }
+    }()
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    did, err := r.didManager.AllocateDID(ctx, tx, provider.Name, record.OriginalDNIS, record.IsTest)
+    if err != nil {
+        r.countHop(record, number, "no_did")
+        return nil, err
+    }
+
+    // A call hung up meanwhile gives the DID back with the rollback
+    handed := r.activeCalls.Update(record.CallID, func(record *models.CallRecord) {
+        record.HopLegs = append(record.HopLegs, models.HopLeg{
+            Provider: provider.Name,
+            DID:      did,
+            DialedAt: time.Now(),
+        })
+        record.CurrentStep = "S2_TO_HOP" + strconv.Itoa(number)
+    })
+    if !handed {
+        return nil, errors.New(errors.ErrCallNotFound, "call record not found").
+            WithContext("call_id", record.CallID)
+    }
+    if err := tx.Commit(); err != nil {
+        r.activeCalls.Update(record.CallID, func(record *models.CallRecord) {
+            record.HopLegs = record.HopLegs[:index]
+        })
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    committed = true
+    r.loadBalancer.IncrementActiveCalls(provider.Name)
+    r.didManager.RegisterCallDID(did, record.CallID)
+    r.shareCallDID(ctx, did, record.CallID)
+    if err := r.syncSharedCall(ctx, record.CallID); err != nil {
+        logger.WithContext(ctx).WithField("call_id", record.CallID).Warn("Call changed on another instance while handing it to its next hop")
+    }
+
+    r.countHop(record, number, "dialed")
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "call_id":  record.CallID,
+        "route":    record.RouteName,
+        "hop":      number,
+        "provider": provider.Name,
+        "did":      did,
+    }).Info("Handing call to next hop")
+
+    response := r.intermediateLeg(ctx, record.CallID, record.HopANI(number), did, provider.Name, record.DialOptions)
+    response.Hop = number
+    return response, nil
+}
+
+// hopProviders are the intermediates of the hops a call was handed to so far
+func hopProviders(record *models.CallRecord) []string {
+    providers := make([]string, 0, len(record.HopLegs))
+    for _, hop := range record.HopLegs {
+        providers = append(providers, hop.Provider)
+    }
+    return providers
+}
+
+// callProviders are the providers carrying a call on intermediate and final,
+// with those of the hops it went through in between
+func callProviders(record *models.CallRecord, intermediate, final string) []string {
+    return append(append([]string{intermediate}, hopProviders(record)...), final)
+}
+
+// incrementHopCalls and decrementHopCalls count the call as active on the
+// intermediates of its hops, as it is on its own intermediate and final
+func (r *Router) incrementHopCalls(record *models.CallRecord) {
+    for _, provider := range hopProviders(record) {
+        r.loadBalancer.IncrementActiveCalls(provider)
+    }
+}
+
+func (r *Router) decrementHopCalls(record *models.CallRecord) {
+    for _, provider := range hopProviders(record) {
+        r.loadBalancer.DecrementActiveCalls(provider)
+    }
+}
+
+func (r *Router) countHop(record *models.CallRecord, hop int, outcome string) {
+    r.metrics.IncrementCounter("router_route_hops", map[string]string{
+        "route":   record.RouteName,
+        "hop":     strconv.Itoa(hop),
+        "outcome": outcome,
+    })
+}
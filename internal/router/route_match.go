@@ -0,0 +1,159 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "regexp"
+    "strings"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+const patternRoutesKey = "route:patterns"
+
+// routeMatcher matches inbound provider names against a pattern route
+type routeMatcher struct {
+    route *models.ProviderRoute
+    re    *regexp.Regexp
+}
+
+func newRouteMatcher(route *models.ProviderRoute) (*routeMatcher, error) {
+    m := &routeMatcher{route: route}
+    if route.InboundMatch == models.InboundMatchRegex {
+        re, err := compileInboundPattern(route.InboundProvider)
+        if err != nil {
+            return nil, err
+        }
+        m.re = re
+    }
+    return m, nil
+}
+
+func (m *routeMatcher) matches(providerName string) bool {
+    switch m.route.InboundMatch {
+    case models.InboundMatchPrefix:
+        return strings.HasPrefix(providerName, m.route.InboundProvider)
+    case models.InboundMatchRegex:
+        return m.re.MatchString(providerName)
+    }
+    return false
+}
+
+// compileInboundPattern anchors the pattern so it must match the whole provider name
+func compileInboundPattern(pattern string) (*regexp.Regexp, error) {
+    return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// ValidateInboundPattern checks an inbound match before a route is stored
+func ValidateInboundPattern(match models.InboundMatchType, pattern string) error {
+    switch match {
+    case "", models.InboundMatchExact:
+        return nil
+    case models.InboundMatchPrefix:
+        if pattern == "" {
+            return errors.New(errors.ErrInternal, "prefix must not be empty")
+        }
+        return nil
+    case models.InboundMatchRegex:
+        if _, err := compileInboundPattern(pattern); err != nil {
+            return errors.Wrap(err, errors.ErrInternal, "invalid inbound regex")
+        }
+        return nil
+    }
+    
+    return errors.New(errors.ErrInternal, "unknown inbound match type").
+        WithContext("match", string(match))
+}
+
+// CatchAllConfig names the route used when no route matches the inbound provider
+type CatchAllConfig struct {
+    Enabled bool
+    Route   string
+}
+
+// getCatchAllRoute returns the configured catch-all route, nil when disabled
+func (r *Router) getCatchAllRoute(ctx context.Context, tx *sql.Tx) (*models.ProviderRoute, error) {
+    if !r.config.CatchAll.Enabled || r.config.CatchAll.Route == "" {
+        return nil, nil
+    }
+    
+    route, err := scanRoute(tx.QueryRowContext(ctx, routeSelect+" WHERE pr.name = ? AND pr.enabled = 1", r.config.CatchAll.Route))
+    if err == sql.ErrNoRows {
+        logger.WithContext(ctx).WithField("route", r.config.CatchAll.Route).Warn("Catch-all route is missing or disabled")
+        return nil, nil
+    }
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query catch-all route")
+    }
+    
+    route.MatchedBy = "catch_all"
+    return route, nil
+}
+
+// getPatternRoute returns the highest priority prefix or regex route matching
+// the provider and open at now, and whether a schedule took part in the choice
+func (r *Router) getPatternRoute(ctx context.Context, tx *sql.Tx, inboundProvider string, now time.Time) (*models.ProviderRoute, bool, error) {
+    matchers, err := r.patternRoutes(ctx, tx)
+    if err != nil {
+        return nil, false, err
+    }
+    
+    // Matchers are ordered by priority, the first open match wins
+    scheduled := false
+    for _, m := range matchers {
+        if !m.matches(inboundProvider) {
+            continue
+        }
+        if !m.route.Schedule.IsEmpty() {
+            scheduled = true
+            if !r.RouteOpen(ctx, m.route, now) {
+                continue
+            }
+        }
+        route := *m.route
+        route.MatchedBy = string(route.InboundMatch)
+        return &route, scheduled, nil
+    }
+    
+    return nil, scheduled, nil
+}
+
+func (r *Router) patternRoutes(ctx context.Context, tx *sql.Tx) ([]*routeMatcher, error) {
+    if cached, ok := r.routeCache.get(patternRoutesKey); ok {
+        return cached.([]*routeMatcher), nil
+    }
+    
+    rows, err := tx.QueryContext(ctx, routeSelect+`
+        WHERE pr.enabled = 1 AND pr.inbound_is_group = 0
+          AND pr.inbound_match IN ('prefix', 'regex')
+        ORDER BY pr.priority DESC, pr.weight DESC, pr.id`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query pattern routes")
+    }
+    defer rows.Close()
+    
+    var matchers []*routeMatcher
+    for rows.Next() {
+        route, err := scanRoute(rows)
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to scan pattern route")
+            continue
+        }
+        
+        m, err := newRouteMatcher(route)
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).WithField("route", route.Name).Warn("Skipping route with invalid inbound pattern")
+            continue
+        }
+        matchers = append(matchers, m)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read pattern routes")
+    }
+    
+    r.routeCache.set(patternRoutesKey, matchers)
+    return matchers, nil
+}
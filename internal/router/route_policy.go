@@ -0,0 +1,294 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// routeSelect resolves each route against its shared policy. Route columns win,
+// NULL route columns fall through to the policy and then to the defaults.
+// Manipulations are merged field by field.
+const routeSelect = `
+        SELECT pr.id, pr.name, COALESCE(pr.description, ''), pr.inbound_provider, pr.intermediate_provider,
+               pr.final_provider,
+               COALESCE(pr.load_balance_mode, rp.load_balance_mode, 'round_robin'),
+               pr.priority, pr.weight,
+               COALESCE(pr.max_concurrent_calls, rp.max_concurrent_calls, 0),
+               pr.current_calls, pr.enabled,
+               pr.failover_routes, pr.routing_rules, pr.metadata,
+               pr.inbound_is_group, pr.intermediate_is_group, pr.final_is_group,
+               COALESCE(pr.policy_name, ''),
+               COALESCE(pr.verification_enabled, rp.verification_enabled),
+               COALESCE(pr.strict_mode, rp.strict_mode),
+               JSON_MERGE_PATCH(COALESCE(rp.manipulations, JSON_OBJECT()), COALESCE(pr.manipulations, JSON_OBJECT())),
+               pr.created_at, pr.updated_at, COALESCE(pr.inbound_match, 'exact'),
+               COALESCE(pr.is_test, 0), pr.dial_options, COALESCE(pr.queue_timeout, 0)
+        FROM provider_routes pr
+        LEFT JOIN route_policies rp ON rp.name = pr.policy_name`
+
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+// scanRoute reads a row produced by routeSelect
+func scanRoute(row rowScanner) (*models.ProviderRoute, error) {
+    var route models.ProviderRoute
+    var inboundIsGroup, intermediateIsGroup, finalIsGroup sql.NullBool
+    var verificationEnabled, strictMode sql.NullBool
+    var failoverRoutes, manipulations, dialOptions []byte
+    
+    err := row.Scan(
+        &route.ID, &route.Name, &route.Description,
+        &route.InboundProvider, &route.IntermediateProvider, &route.FinalProvider,
+        &route.LoadBalanceMode, &route.Priority, &route.Weight,
+        &route.MaxConcurrentCalls, &route.CurrentCalls, &route.Enabled,
+        &failoverRoutes, &route.RoutingRules, &route.Metadata,
+        &inboundIsGroup, &intermediateIsGroup, &finalIsGroup,
+        &route.PolicyName, &verificationEnabled, &strictMode, &manipulations,
+        &route.CreatedAt, &route.UpdatedAt, &route.InboundMatch,
+        &route.IsTest, &dialOptions, &route.QueueTimeout,
+    )
+    if err != nil {
+        return nil, err
+    }
+    
+    // Set boolean flags
+    route.InboundIsGroup = inboundIsGroup.Valid && inboundIsGroup.Bool
+    route.IntermediateIsGroup = intermediateIsGroup.Valid && intermediateIsGroup.Bool
+    route.FinalIsGroup = finalIsGroup.Valid && finalIsGroup.Bool
+    
+    if verificationEnabled.Valid {
+        route.VerificationEnabled = &verificationEnabled.Bool
+    }
+    if strictMode.Valid {
+        route.StrictMode = &strictMode.Bool
+    }
+    
+    if len(failoverRoutes) > 0 {
+        json.Unmarshal(failoverRoutes, &route.FailoverRoutes)
+    }
+    
+    if len(manipulations) > 0 {
+        var m models.NumberManipulations
+        if err := json.Unmarshal(manipulations, &m); err == nil && !m.IsEmpty() {
+            route.Manipulations = &m
+        }
+    }
+    
+    if len(dialOptions) > 0 {
+        var o models.DialOptions
+        if err := json.Unmarshal(dialOptions, &o); err == nil && !o.IsEmpty() {
+            route.DialOptions = &o
+        }
+    }
+    
+    route.Schedule = parseRouteSchedule(route.RoutingRules)
+    route.ExcludedProviders = parseRouteExclusions(route.RoutingRules)
+    route.ParallelDial = parseParallelDial(route.RoutingRules)
+    route.PassThrough = parsePassThrough(route.RoutingRules)
+    route.Hops = parseRouteHops(route.RoutingRules)
+    
+    return &route, nil
+}
+
+// GetRoute returns a route by name with its policy resolved
+func (r *Router) GetRoute(ctx context.Context, name string) (*models.ProviderRoute, error) {
+    route, err := scanRoute(r.db.QueryRowContext(ctx, routeSelect+" WHERE pr.name = ?", name))
+    if err == sql.ErrNoRows {
+        return nil, errors.New(errors.ErrRouteNotFound, "route not found").
+            WithContext("route", name)
+    }
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query route")
+    }
+    
+    return route, nil
+}
+
+// applyRoutePolicy copies the resolved policy onto the call so later legs use it
+func applyRoutePolicy(record *models.CallRecord, route *models.ProviderRoute) {
+    record.VerificationEnabled = route.VerificationEnabled
+    record.StrictMode = route.StrictMode
+    record.Manipulations = route.Manipulations
+    record.DialOptions = route.DialOptions
+    record.Hops = nil
+    if !route.PassThrough {
+        record.Hops = route.Hops
+    }
+}
+
+// verificationEnabled reports whether the call's legs must be verified
+func (r *Router) verificationEnabled(record *models.CallRecord) bool {
+    if record.VerificationEnabled != nil {
+        return *record.VerificationEnabled
+    }
+    return r.config.VerificationEnabled
+}
+
+// strictMode reports whether a failed verification rejects the call
+func (r *Router) strictMode(record *models.CallRecord) bool {
+    if record.StrictMode != nil {
+        return *record.StrictMode
+    }
+    return r.config.StrictMode
+}
+
+// CreateRoutePolicy stores a new shared route policy
+func (r *Router) CreateRoutePolicy(ctx context.Context, policy *models.RoutePolicy) error {
+    result, err := r.db.ExecContext(ctx, `
+        INSERT INTO route_policies (
+            name, description, load_balance_mode, max_concurrent_calls,
+            verification_enabled, strict_mode, manipulations
+        ) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+        policy.Name, policy.Description, nullMode(policy.LoadBalanceMode), policy.MaxConcurrentCalls,
+        policy.VerificationEnabled, policy.StrictMode, manipulationsValue(policy.Manipulations))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to create route policy")
+    }
+    
+    id, _ := result.LastInsertId()
+    policy.ID = int(id)
+    return nil
+}
+
+// UpdateRoutePolicy replaces a policy and drops cached routes that inherit from it
+func (r *Router) UpdateRoutePolicy(ctx context.Context, policy *models.RoutePolicy) error {
+    result, err := r.db.ExecContext(ctx, `
+        UPDATE route_policies
+        SET description = ?, load_balance_mode = ?, max_concurrent_calls = ?,
+            verification_enabled = ?, strict_mode = ?, manipulations = ?
+        WHERE name = ?`,
+        policy.Description, nullMode(policy.LoadBalanceMode), policy.MaxConcurrentCalls,
+        policy.VerificationEnabled, policy.StrictMode, manipulationsValue(policy.Manipulations),
+        policy.Name)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update route policy")
+    }
+    
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        if _, err := r.GetRoutePolicy(ctx, policy.Name); err != nil {
+            return err
+        }
+    }
+    
+    r.flushRoutes(ctx)
+    return nil
+}
+
+// GetRoutePolicy returns a policy by name
+func (r *Router) GetRoutePolicy(ctx context.Context, name string) (*models.RoutePolicy, error) {
+    row := r.db.QueryRowContext(ctx, policySelect+" WHERE rp.name = ? GROUP BY rp.id", name)
+    
+    policy, err := scanRoutePolicy(row)
+    if err == sql.ErrNoRows {
+        return nil, errors.New(errors.ErrRouteNotFound, "route policy not found").
+            WithContext("policy", name)
+    }
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query route policy")
+    }
+    
+    return policy, nil
+}
+
+// ListRoutePolicies returns all policies with the number of routes using each
+func (r *Router) ListRoutePolicies(ctx context.Context) ([]*models.RoutePolicy, error) {
+    rows, err := r.db.QueryContext(ctx, policySelect+" GROUP BY rp.id ORDER BY rp.name")
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query route policies")
+    }
+    defer rows.Close()
+    
+    var policies []*models.RoutePolicy
+    for rows.Next() {
+        policy, err := scanRoutePolicy(rows)
+        if err != nil {
+            continue
+        }
+        policies = append(policies, policy)
+    }
+    
+    return policies, rows.Err()
+}
+
+// DeleteRoutePolicy removes a policy that no route references
+func (r *Router) DeleteRoutePolicy(ctx context.Context, name string) error {
+    policy, err := r.GetRoutePolicy(ctx, name)
+    if err != nil {
+        return err
+    }
+    
+    if policy.RouteCount > 0 {
+        return errors.New(errors.ErrInternal, "route policy is in use").
+            WithContext("policy", name).
+            WithContext("routes", policy.RouteCount)
+    }
+    
+    if _, err := r.db.ExecContext(ctx, "DELETE FROM route_policies WHERE name = ?", name); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete route policy")
+    }
+    
+    return nil
+}
+
+const policySelect = `
+        SELECT rp.id, rp.name, COALESCE(rp.description, ''), COALESCE(rp.load_balance_mode, ''),
+               rp.max_concurrent_calls, rp.verification_enabled, rp.strict_mode, rp.manipulations,
+               COUNT(pr.id), rp.created_at, rp.updated_at
+        FROM route_policies rp
+        LEFT JOIN provider_routes pr ON pr.policy_name = rp.name`
+
+func scanRoutePolicy(row rowScanner) (*models.RoutePolicy, error) {
+    var policy models.RoutePolicy
+    var maxCalls sql.NullInt64
+    var verificationEnabled, strictMode sql.NullBool
+    var manipulations []byte
+    
+    err := row.Scan(
+        &policy.ID, &policy.Name, &policy.Description, &policy.LoadBalanceMode,
+        &maxCalls, &verificationEnabled, &strictMode, &manipulations,
+        &policy.RouteCount, &policy.CreatedAt, &policy.UpdatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    
+    if maxCalls.Valid {
+        limit := int(maxCalls.Int64)
+        policy.MaxConcurrentCalls = &limit
+    }
+    if verificationEnabled.Valid {
+        policy.VerificationEnabled = &verificationEnabled.Bool
+    }
+    if strictMode.Valid {
+        policy.StrictMode = &strictMode.Bool
+    }
+    if len(manipulations) > 0 {
+        var m models.NumberManipulations
+        if err := json.Unmarshal(manipulations, &m); err == nil && !m.IsEmpty() {
+            policy.Manipulations = &m
+        }
+    }
+    
+    return &policy, nil
+}
+
+func nullMode(mode models.LoadBalanceMode) interface{} {
+    if mode == "" {
+        return nil
+    }
+    return string(mode)
+}
+
+// manipulationsValue stores an empty manipulation set as NULL
+func manipulationsValue(m *models.NumberManipulations) interface{} {
+    if m.IsEmpty() {
+        return nil
+    }
+    data, _ := json.Marshal(m)
+    return data
+}
@@ -0,0 +1,307 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+const prefixRoutesKey = "route:prefixes"
+
+// maxRoutePrefixLength is the width of route_prefixes.prefix
+const maxRoutePrefixLength = 20
+
+// prefixTrie holds the destination prefixes digit by digit, the deepest
+// node on a number's path is its longest matching prefix
+type prefixTrie struct {
+    root prefixNode
+}
+
+type prefixNode struct {
+    children map[byte]*prefixNode
+    prefix   string
+    route    *models.ProviderRoute // nil where no prefix of an enabled route ends
+}
+
+func (t *prefixTrie) insert(prefix string, route *models.ProviderRoute) {
+    node := &t.root
+    for i := 0; i < len(prefix); i++ {
+        if node.children == nil {
+            node.children = make(map[byte]*prefixNode)
+        }
+        child, ok := node.children[prefix[i]]
+        if !ok {
+            child = &prefixNode{}
+            node.children[prefix[i]] = child
+        }
+        node = child
+    }
+    node.prefix, node.route = prefix, route
+}
+
+// matches returns the nodes of the prefixes matching number, longest first
+func (t *prefixTrie) matches(number string) []*prefixNode {
+    var found []*prefixNode
+    node := &t.root
+    for i := 0; i < len(number); i++ {
+        if node = node.children[number[i]]; node == nil {
+            break
+        }
+        if node.route != nil {
+            found = append(found, node)
+        }
+    }
+
+    for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+        found[i], found[j] = found[j], found[i]
+    }
+    return found
+}
+
+// getDestinationRoute returns the route of the longest prefix of the
+// destination whose route is open at now, nil when no prefix matches. A
+// closed route passes the call on to the next shorter prefix.
+func (r *Router) getDestinationRoute(ctx context.Context, tx *sql.Tx, dnis string, now time.Time) (*models.ProviderRoute, error) {
+    trie, err := r.prefixRoutes(ctx, tx)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, node := range trie.matches(numbering.Normalize(dnis)) {
+        if !r.RouteOpen(ctx, node.route, now) {
+            continue
+        }
+        route := *node.route
+        route.MatchedBy = "destination"
+        logger.WithContext(ctx).WithFields(map[string]interface{}{
+            "prefix": node.prefix,
+            "route":  route.Name,
+        }).Debug("Destination prefix matched")
+        return &route, nil
+    }
+    return nil, nil
+}
+
+// prefixRoutes loads the prefix trie, kept in process with the other routes
+func (r *Router) prefixRoutes(ctx context.Context, tx *sql.Tx) (*prefixTrie, error) {
+    if cached, ok := r.routeCache.get(prefixRoutesKey); ok {
+        return cached.(*prefixTrie), nil
+    }
+
+    rows, err := tx.QueryContext(ctx, routeSelect+`
+        WHERE pr.enabled = 1 AND pr.name IN (SELECT route_name FROM route_prefixes)`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query prefix routes")
+    }
+    routes := make(map[string]*models.ProviderRoute)
+    for rows.Next() {
+        route, err := scanRoute(rows)
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to scan prefix route")
+            continue
+        }
+        routes[route.Name] = route
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read prefix routes")
+    }
+
+    trie := &prefixTrie{}
+    if len(routes) > 0 {
+        prefixes, err := r.queryRoutePrefixes(ctx, tx, "")
+        if err != nil {
+            return nil, err
+        }
+        // Prefixes of disabled routes are left out, shorter ones take their calls
+        for _, p := range prefixes {
+            if route, ok := routes[p.Route]; ok {
+                trie.insert(p.Prefix, route)
+            }
+        }
+    }
+
+    r.routeCache.set(prefixRoutesKey, trie)
+    return trie, nil
+}
+
+// AddRoutePrefix sends calls to a destination prefix to a route, or moves
+// the prefix to another route
+func (r *Router) AddRoutePrefix(ctx context.Context, p *models.RoutePrefix, user string) error {
+    prefix, err := normalizeRoutePrefix(p.Prefix)
+    if err != nil {
+        return err
+    }
+    p.Prefix = prefix
+    p.Description = strings.TrimSpace(p.Description)
+    p.UpdatedBy = user
+    if _, err := r.GetRoute(ctx, p.Route); err != nil {
+        return err
+    }
+
+    var old interface{}
+    if prefixes, err := r.queryRoutePrefixes(ctx, r.db, "WHERE prefix = ?", p.Prefix); err != nil {
+        return err
+    } else if len(prefixes) > 0 {
+        old = prefixes[0]
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `
+        INSERT INTO route_prefixes (prefix, route_name, description, updated_by)
+        VALUES (?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            route_name = VALUES(route_name), description = VALUES(description), updated_by = VALUES(updated_by)`,
+        p.Prefix, p.Route, nullString(p.Description), nullString(user))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to add route prefix")
+    }
+
+    action := "update"
+    if old == nil {
+        action = "create"
+    }
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "route_prefix",
+        EntityType: "route",
+        EntityID:   p.Route,
+        UserID:     user,
+        Action:     action,
+        OldValue:   old,
+        NewValue:   p,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    r.cache.Invalidate(ctx, prefixRoutesKey)
+    return nil
+}
+
+// DeleteRoutePrefix stops routing a destination prefix, its calls go to a
+// shorter prefix or by their inbound provider again
+func (r *Router) DeleteRoutePrefix(ctx context.Context, prefix, user string) error {
+    prefix, err := normalizeRoutePrefix(prefix)
+    if err != nil {
+        return err
+    }
+    prefixes, err := r.queryRoutePrefixes(ctx, r.db, "WHERE prefix = ?", prefix)
+    if err != nil {
+        return err
+    }
+    if len(prefixes) == 0 {
+        return errors.New(errors.ErrInternal, "route prefix not found").WithContext("prefix", prefix)
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM route_prefixes WHERE prefix = ?", prefix); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete route prefix")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "route_prefix",
+        EntityType: "route",
+        EntityID:   prefixes[0].Route,
+        UserID:     user,
+        Action:     "delete",
+        OldValue:   prefixes[0],
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    r.cache.Invalidate(ctx, prefixRoutesKey)
+    return nil
+}
+
+// ListRoutePrefixes returns the destination prefixes of a route, or of every
+// route when route is empty
+func (r *Router) ListRoutePrefixes(ctx context.Context, route string) ([]*models.RoutePrefix, error) {
+    if route == "" {
+        return r.queryRoutePrefixes(ctx, r.db, "")
+    }
+    return r.queryRoutePrefixes(ctx, r.db, "WHERE route_name = ?", route)
+}
+
+// MatchRoutePrefix returns the longest prefix matching a destination, nil
+// when none does. Whether its route is enabled or open isn't checked.
+func (r *Router) MatchRoutePrefix(ctx context.Context, dnis string) (*models.RoutePrefix, error) {
+    number := numbering.Normalize(dnis)
+    if number == "" {
+        return nil, nil
+    }
+
+    prefixes, err := r.queryRoutePrefixes(ctx, r.db, "WHERE ? LIKE CONCAT(prefix, '%')", number)
+    if err != nil || len(prefixes) == 0 {
+        return nil, err
+    }
+
+    longest := prefixes[0]
+    for _, p := range prefixes[1:] {
+        if len(p.Prefix) > len(longest.Prefix) {
+            longest = p
+        }
+    }
+    return longest, nil
+}
+
+// normalizeRoutePrefix keeps the digits of a prefix, a trailing * is allowed
+func normalizeRoutePrefix(prefix string) (string, error) {
+    digits := numbering.Normalize(strings.TrimSuffix(strings.TrimSpace(prefix), "*"))
+    if digits == "" {
+        return "", errors.New(errors.ErrInternal, "prefix must contain digits")
+    }
+    if len(digits) > maxRoutePrefixLength {
+        return "", errors.New(errors.ErrInternal, "prefix is too long").WithContext("prefix", digits)
+    }
+    return digits, nil
+}
+
+// rowQuerier is the database or a transaction
+type rowQuerier interface {
+    QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (r *Router) queryRoutePrefixes(ctx context.Context, db rowQuerier, where string, args ...interface{}) ([]*models.RoutePrefix, error) {
+    rows, err := db.QueryContext(ctx, `
+        SELECT prefix, route_name, COALESCE(description, ''), COALESCE(updated_by, ''), updated_at
+        FROM route_prefixes `+where+`
+        ORDER BY prefix`, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query route prefixes")
+    }
+    defer rows.Close()
+
+    var prefixes []*models.RoutePrefix
+    for rows.Next() {
+        var p models.RoutePrefix
+        if err := rows.Scan(&p.Prefix, &p.Route, &p.Description, &p.UpdatedBy, &p.UpdatedAt); err != nil {
+            continue
+        }
+        prefixes = append(prefixes, &p)
+    }
+    return prefixes, rows.Err()
+}
@@ -0,0 +1,246 @@
+package router
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// RouteQueueConfig controls how calls wait for capacity on routes with a
+// queue timeout
+type RouteQueueConfig struct {
+    PollInterval time.Duration // how often the first waiting call looks for a slot freed on another node
+    MaxWaiting   int           // calls waiting on one route on this node, further ones are rejected
+    MaxTimeout   time.Duration // cap on the queue timeout of routes
+}
+
+func (c *RouteQueueConfig) setDefaults() {
+    if c.PollInterval <= 0 {
+        c.PollInterval = 250 * time.Millisecond
+    }
+    if c.MaxWaiting <= 0 {
+        c.MaxWaiting = 100
+    }
+    if c.MaxTimeout <= 0 {
+        c.MaxTimeout = time.Minute
+    }
+}
+
+// routeQueues holds the calls waiting for a slot on saturated routes, first
+// come first served on each node
+type routeQueues struct {
+    mu      sync.Mutex
+    waiting map[string][]*routeWaiter // by route
+}
+
+type routeWaiter struct {
+    callID string
+    wake   chan struct{}
+}
+
+func newRouteQueues() *routeQueues {
+    return &routeQueues{waiting: make(map[string][]*routeWaiter)}
+}
+
+// join queues a call on a route and returns its position, zero when the
+// queue is full
+func (q *routeQueues) join(route string, w *routeWaiter, max int) int {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    if len(q.waiting[route]) >= max {
+        return 0
+    }
+    q.waiting[route] = append(q.waiting[route], w)
+    return len(q.waiting[route])
+}
+
+// leave removes a call from a route's queue and wakes the next one
+func (q *routeQueues) leave(route string, w *routeWaiter) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    waiting := q.waiting[route]
+    for i, other := range waiting {
+        if other == w {
+            waiting = append(waiting[:i], waiting[i+1:]...)
+            break
+        }
+    }
+    if len(waiting) == 0 {
+        delete(q.waiting, route)
+        return
+    }
+    q.waiting[route] = waiting
+    signal(waiting[0].wake)
+}
+
+// first reports whether the call is at the head of its route's queue
+func (q *routeQueues) first(route string, w *routeWaiter) bool {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    waiting := q.waiting[route]
+    return len(waiting) > 0 && waiting[0] == w
+}
+
+// wake tells the first call waiting on a route that a slot was freed
+func (q *routeQueues) wake(route string) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    if waiting := q.waiting[route]; len(waiting) > 0 {
+        signal(waiting[0].wake)
+    }
+}
+
+// length returns how many calls wait on a route
+func (q *routeQueues) length(route string) int {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    return len(q.waiting[route])
+}
+
+func signal(ch chan struct{}) {
+    select {
+    case ch <- struct{}{}:
+    default:
+    }
+}
+
+// routeQueueResult is how a call got its slot on a queueing route
+type routeQueueResult struct {
+    Position int           // place in the queue when the call joined it, zero when it didn't wait
+    Waited   time.Duration
+    Timeout  time.Duration
+}
+
+// queueForRoute reserves a slot on a route that queues calls, waiting up to
+// the route's queue timeout when it is at its concurrent call limit. The slot
+// is taken outside the call's transaction and must be released with
+// releaseRouteSlot unless the call is set up.
+func (r *Router) queueForRoute(ctx context.Context, callID string, route *models.ProviderRoute) (*routeQueueResult, error) {
+    config := r.config.RouteQueue
+    config.setDefaults()
+
+    timeout := time.Duration(route.QueueTimeout) * time.Second
+    if timeout > config.MaxTimeout {
+        timeout = config.MaxTimeout
+    }
+    result := &routeQueueResult{Timeout: timeout}
+
+    // Calls already waiting go first
+    if r.routeQueues.length(route.Name) == 0 {
+        if ok, err := r.reserveRouteSlot(ctx, route); err != nil || ok {
+            return result, err
+        }
+    }
+
+    labels := map[string]string{"route": route.Name}
+    w := &routeWaiter{callID: callID, wake: make(chan struct{}, 1)}
+    result.Position = r.routeQueues.join(route.Name, w, config.MaxWaiting)
+    if result.Position == 0 {
+        r.metrics.IncrementCounter("router_route_queue", map[string]string{"route": route.Name, "outcome": "full"})
+        return nil, errors.New(errors.ErrQuotaExceeded, "route queue full").
+            WithContext("route", route.Name)
+    }
+    r.metrics.SetGauge("router_route_queue_waiting", float64(r.routeQueues.length(route.Name)), labels)
+
+    log := logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "call_id":  callID,
+        "route":    route.Name,
+        "position": result.Position,
+    })
+    log.Info("Route at capacity, call queued")
+
+    start := time.Now()
+    defer func() {
+        r.routeQueues.leave(route.Name, w)
+        result.Waited = time.Since(start)
+        r.metrics.SetGauge("router_route_queue_waiting", float64(r.routeQueues.length(route.Name)), labels)
+        r.metrics.ObserveHistogram("router_route_queue_wait", result.Waited.Seconds(), labels)
+    }()
+
+    deadline := time.NewTimer(timeout)
+    defer deadline.Stop()
+    poll := time.NewTicker(config.PollInterval)
+    defer poll.Stop()
+
+    for {
+        if r.routeQueues.first(route.Name, w) {
+            ok, err := r.reserveRouteSlot(ctx, route)
+            if err != nil {
+                return nil, err
+            }
+            if ok {
+                r.metrics.IncrementCounter("router_route_queue", map[string]string{"route": route.Name, "outcome": "slot"})
+                log.WithField("waited", time.Since(start).Seconds()).Info("Queued call got a route slot")
+                return result, nil
+            }
+        }
+
+        select {
+        case <-w.wake:
+        case <-poll.C:
+        case <-deadline.C:
+            r.metrics.IncrementCounter("router_route_queue", map[string]string{"route": route.Name, "outcome": "timeout"})
+            log.Warn("Queued call timed out waiting for route capacity")
+            return nil, errors.New(errors.ErrQuotaExceeded, "route queue timed out").
+                WithContext("route", route.Name).
+                WithContext("queue_position", result.Position).
+                WithContext("queue_wait", int(timeout.Seconds())).
+                WithContext("queue_timeout", int(timeout.Seconds()))
+        case <-ctx.Done():
+            return nil, errors.Wrap(ctx.Err(), errors.ErrInternal, "call left the route queue")
+        }
+    }
+}
+
+// reserveRouteSlot takes a slot on the route when it is under its limit
+func (r *Router) reserveRouteSlot(ctx context.Context, route *models.ProviderRoute) (bool, error) {
+    result, err := r.db.ExecContext(ctx, `
+        UPDATE provider_routes SET current_calls = current_calls + 1
+        WHERE id = ? AND current_calls < ?`,
+        route.ID, route.MaxConcurrentCalls)
+    if err != nil {
+        return false, errors.Wrap(err, errors.ErrDatabase, "failed to reserve route slot")
+    }
+    rows, _ := result.RowsAffected()
+    return rows > 0, nil
+}
+
+// releaseRouteSlot gives back a slot queueForRoute reserved for a call that
+// wasn't set up
+func (r *Router) releaseRouteSlot(ctx context.Context, route *models.ProviderRoute) {
+    // The caller may be gone, the slot is freed regardless
+    ctx = context.WithoutCancel(ctx)
+    if _, err := r.db.ExecContext(ctx,
+        "UPDATE provider_routes SET current_calls = GREATEST(current_calls - 1, 0) WHERE id = ?", route.ID); err != nil {
+        logger.WithContext(ctx).WithError(err).WithField("route", route.Name).Warn("Failed to release route slot")
+    }
+    r.routeQueues.wake(route.Name)
+}
+
+// SetRouteQueueTimeout sets how long calls wait for capacity when the route
+// is at its concurrent call limit, zero rejects them right away
+func (r *Router) SetRouteQueueTimeout(ctx context.Context, routeName string, seconds int) error {
+    if seconds < 0 {
+        return errors.New(errors.ErrInternal, "queue timeout can't be negative")
+    }
+
+    if _, err := r.GetRoute(ctx, routeName); err != nil {
+        return err
+    }
+
+    if _, err := r.db.ExecContext(ctx,
+        "UPDATE provider_routes SET queue_timeout = ? WHERE name = ?", nullInt(seconds), routeName); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update route queue timeout")
+    }
+
+    r.flushRoutes(ctx)
+    return nil
+}
@@ -0,0 +1,285 @@
+package router
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// scheduleRule is the routing_rules key of a route's schedule
+const scheduleRule = "schedule"
+
+var (
+    dayIndex = map[string]int{
+        "sun": 0, "sunday": 0, "mon": 1, "monday": 1, "tue": 2, "tuesday": 2, "wed": 3, "wednesday": 3,
+        "thu": 4, "thursday": 4, "fri": 5, "friday": 5, "sat": 6, "saturday": 6,
+    }
+
+    // Loading a zone reads the zoneinfo database, schedules are checked per call
+    scheduleZones sync.Map
+)
+
+// ParseScheduleWindow reads a window like "mon-fri 08:00-18:00 America/Caracas".
+// Days are names or ranges separated by commas, or daily; the zone is
+// optional and UTC when left out. 24:00 ends a window at midnight.
+func ParseScheduleWindow(spec string) (models.ScheduleWindow, error) {
+    fields := strings.Fields(spec)
+    if len(fields) < 2 || len(fields) > 3 {
+        return models.ScheduleWindow{}, errors.New(errors.ErrConfiguration,
+            fmt.Sprintf("invalid schedule %q, expected days HH:MM-HH:MM [timezone]", spec))
+    }
+
+    days, err := parseScheduleDays(fields[0])
+    if err != nil {
+        return models.ScheduleWindow{}, err
+    }
+    start, end, ok := strings.Cut(fields[1], "-")
+    if !ok {
+        return models.ScheduleWindow{}, errors.New(errors.ErrConfiguration,
+            fmt.Sprintf("invalid schedule hours %q, expected HH:MM-HH:MM", fields[1]))
+    }
+
+    window := models.ScheduleWindow{Days: days, Start: start, End: end}
+    if len(fields) == 3 {
+        window.Timezone = fields[2]
+    }
+    return window, validateScheduleWindow(&window)
+}
+
+func parseScheduleDays(spec string) ([]string, error) {
+    spec = strings.ToLower(spec)
+    if spec == "daily" || spec == "*" {
+        return append([]string{}, models.Weekdays...), nil
+    }
+
+    on := make(map[int]bool)
+    for _, part := range strings.Split(spec, ",") {
+        from, to, isRange := strings.Cut(part, "-")
+        first, ok := dayIndex[from]
+        if !ok {
+            return nil, errors.New(errors.ErrConfiguration, fmt.Sprintf("unknown day %q in schedule", from))
+        }
+        last := first
+        if isRange {
+            if last, ok = dayIndex[to]; !ok {
+                return nil, errors.New(errors.ErrConfiguration, fmt.Sprintf("unknown day %q in schedule", to))
+            }
+        }
+        // Ranges may wrap around the week, fri-mon
+        for d := first; ; d = (d + 1) % 7 {
+            on[d] = true
+            if d == last {
+                break
+            }
+        }
+    }
+
+    var days []string
+    for d, name := range models.Weekdays {
+        if on[d] {
+            days = append(days, name)
+        }
+    }
+    return days, nil
+}
+
+// ValidateRouteSchedule checks the windows and holiday country of a
+// schedule, normalizing its day names and country code
+func ValidateRouteSchedule(s *models.RouteSchedule) error {
+    if s.IsEmpty() {
+        return nil
+    }
+
+    for i := range s.Windows {
+        if err := validateScheduleWindow(&s.Windows[i]); err != nil {
+            return err
+        }
+    }
+    if s.Holidays != "" {
+        s.Holidays = strings.ToUpper(strings.TrimSpace(s.Holidays))
+        if !numbering.IsCountryCode(s.Holidays) {
+            return errors.New(errors.ErrConfiguration, "schedule holidays must be an ISO 3166 alpha-2 country code")
+        }
+    }
+    return nil
+}
+
+func validateScheduleWindow(w *models.ScheduleWindow) error {
+    if len(w.Days) == 0 {
+        return errors.New(errors.ErrConfiguration, "schedule window has no days")
+    }
+    seen := make(map[int]bool, len(w.Days))
+    for _, name := range w.Days {
+        d, ok := dayIndex[strings.ToLower(name)]
+        if !ok {
+            return errors.New(errors.ErrConfiguration, fmt.Sprintf("unknown day %q in schedule", name))
+        }
+        seen[d] = true
+    }
+    days := make([]string, 0, len(seen))
+    for d, name := range models.Weekdays {
+        if seen[d] {
+            days = append(days, name)
+        }
+    }
+    w.Days = days
+
+    start, err := clockMinutes(w.Start)
+    if err != nil {
+        return err
+    }
+    end, err := clockMinutes(w.End)
+    if err != nil {
+        return err
+    }
+    if start == end || start == 24*60 {
+        return errors.New(errors.ErrConfiguration,
+            fmt.Sprintf("empty schedule window %s-%s, use 00:00-24:00 for a whole day", w.Start, w.End))
+    }
+
+    if _, err := scheduleZone(w.Timezone); err != nil {
+        return err
+    }
+    return nil
+}
+
+// clockMinutes returns the minutes past midnight of HH:MM
+func clockMinutes(clock string) (int, error) {
+    if clock == "24:00" {
+        return 24 * 60, nil
+    }
+    t, err := time.Parse("15:04", clock)
+    if err != nil {
+        return 0, errors.New(errors.ErrConfiguration, fmt.Sprintf("invalid time %q in schedule, expected HH:MM", clock))
+    }
+    return t.Hour()*60 + t.Minute(), nil
+}
+
+func scheduleZone(name string) (*time.Location, error) {
+    if name == "" {
+        return time.UTC, nil
+    }
+    if loc, ok := scheduleZones.Load(name); ok {
+        return loc.(*time.Location), nil
+    }
+
+    loc, err := time.LoadLocation(name)
+    if err != nil {
+        return nil, errors.New(errors.ErrConfiguration, fmt.Sprintf("unknown time zone %q in schedule", name))
+    }
+    scheduleZones.Store(name, loc)
+    return loc, nil
+}
+
+// parseRouteSchedule reads the schedule out of a route's routing rules
+func parseRouteSchedule(rules models.JSON) *models.RouteSchedule {
+    raw, ok := rules[scheduleRule]
+    if !ok || raw == nil {
+        return nil
+    }
+
+    data, err := json.Marshal(raw)
+    if err != nil {
+        return nil
+    }
+    var schedule models.RouteSchedule
+    if err := json.Unmarshal(data, &schedule); err != nil || schedule.IsEmpty() {
+        return nil
+    }
+    return &schedule
+}
+
+// RouteOpen reports whether a route takes calls at now: it has no schedule,
+// or now falls in one of its windows and isn't a holiday it is closed on
+func (r *Router) RouteOpen(ctx context.Context, route *models.ProviderRoute, now time.Time) bool {
+    schedule := route.Schedule
+    if schedule.IsEmpty() {
+        return true
+    }
+
+    for _, w := range schedule.Windows {
+        loc, err := scheduleZone(w.Timezone)
+        if err != nil {
+            continue
+        }
+        local := now.In(loc)
+        if !windowContains(w, local) {
+            continue
+        }
+        if schedule.Holidays != "" && r.IsHoliday(ctx, schedule.Holidays, local) {
+            return false
+        }
+        return true
+    }
+    return false
+}
+
+// windowContains reports whether t, in the window's zone, falls in it. The
+// part of a window past midnight belongs to the day it started on.
+func windowContains(w models.ScheduleWindow, t time.Time) bool {
+    start, err := clockMinutes(w.Start)
+    if err != nil {
+        return false
+    }
+    end, err := clockMinutes(w.End)
+    if err != nil {
+        return false
+    }
+
+    day := int(t.Weekday())
+    minute := t.Hour()*60 + t.Minute()
+    on := func(d int) bool {
+        for _, name := range w.Days {
+            if dayIndex[name] == d {
+                return true
+            }
+        }
+        return false
+    }
+
+    if start < end {
+        return on(day) && minute >= start && minute < end
+    }
+    return (on(day) && minute >= start) || (on((day+6)%7) && minute < end)
+}
+
+// SetRouteSchedule replaces the schedule of a route, an empty schedule keeps
+// the route open at all times. Other routing rules are kept.
+func (r *Router) SetRouteSchedule(ctx context.Context, routeName string, schedule *models.RouteSchedule) error {
+    if err := ValidateRouteSchedule(schedule); err != nil {
+        return err
+    }
+    route, err := r.GetRoute(ctx, routeName)
+    if err != nil {
+        return err
+    }
+
+    rules := route.RoutingRules
+    if rules == nil {
+        rules = models.JSON{}
+    }
+    if schedule.IsEmpty() {
+        delete(rules, scheduleRule)
+    } else {
+        rules[scheduleRule] = schedule
+    }
+
+    var value interface{}
+    if len(rules) > 0 {
+        value, _ = json.Marshal(rules)
+    }
+    if _, err := r.db.ExecContext(ctx,
+        "UPDATE provider_routes SET routing_rules = ? WHERE name = ?", value, routeName); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update route schedule")
+    }
+
+    r.flushRoutes(ctx)
+    return nil
+}
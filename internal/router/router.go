@@ -7,14 +7,23 @@ import (
     "fmt"
     "strings"
     "sync"
+    "sync/atomic"
     "time"
     
+    "github.com/hamzaKhattat/ara-production-system/internal/db"
     "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
     "github.com/hamzaKhattat/ara-production-system/internal/provider"
     "github.com/hamzaKhattat/ara-production-system/pkg/logger"
     "github.com/hamzaKhattat/ara-production-system/pkg/errors"
 )
 
+// recordingDir is where MixMonitor writes call recordings
+const recordingDir = "/var/spool/asterisk/monitor/"
+
+// incomingStageLabels are shared to avoid a map allocation per call
+var incomingStageLabels = map[string]string{"stage": "incoming"}
+
 // Router handles call routing logic
 type Router struct {
     db           *sql.DB
@@ -22,9 +31,49 @@ type Router struct {
     loadBalancer *LoadBalancer
     metrics      MetricsInterface
     didManager   *DIDManager
-    
-    mu          sync.RWMutex
-    activeCalls map[string]*models.CallRecord
+    quarantine   *QuarantineManager
+    countries    *CountryTracker
+    rateLimits   *RateLimiter
+    shortCalls   *ShortCallMonitor
+    blocks       *BlockManager
+    killSwitches *KillSwitchManager
+    alerts       *AlertManager
+    fx           *FXRates
+    apiTokens    *APITokenManager
+    cdrExports   *CDRExporter
+    procurement  *DIDProcurement
+    backups      *BackupManager
+    testTraffic  *TestTrafficLimiter
+    correlation  *CorrelationSigner
+    replayGuard  *ReplayGuard
+    groupService *provider.GroupService
+    routeCache   *localCache
+    dialCache    *localCache
+    dispositions *localCache
+    holidayCache *localCache
+    groupCache   *localCache
+    writer       *WriteBehind
+    
+    // The dashboard summary, built by one caller at a time
+    summaryMu    sync.Mutex
+    summaryCache *localCache
+    
+    activeCalls *callMap
+    
+    // Active calls kept in Redis for the other AGI instances, nil when not shared
+    shared *sharedCalls
+    
+    // Calls waiting for capacity on saturated routes
+    routeQueues *routeQueues
+    
+    // Holds new calls back while a restarted Asterisk loads ARA, nil when disabled
+    restart atomic.Pointer[RestartCoordinator]
+    
+    // Weights of the current hour of the route weight curves, nil until the scheduler ran
+    curveWeights atomic.Pointer[curveWeights]
+    
+    // Weight shifts of routes over their cost ceiling, nil until evaluated
+    costShifts atomic.Pointer[costShifts]
     
     config Config
 }
@@ -37,6 +86,42 @@ type Config struct {
     MaxRetries           int
     VerificationEnabled  bool
     StrictMode           bool
+    Quarantine           QuarantineConfig
+    CountryLimits        CountryLimitConfig
+    RateLimits           RateLimitConfig
+    ShortCalls           ShortCallConfig
+    Blocking             BlockingConfig
+    KillSwitch           KillSwitchConfig
+    Alerts               AlertConfig
+    FX                   FXConfig
+    CDRExport            CDRExportConfig
+    Contracts            ContractConfig
+    SLA                  SLAConfig
+    Scorecard            ScorecardConfig
+    WeightCurves         WeightCurveConfig
+    CostCeilings         CostCeilingConfig
+    RouteQueue           RouteQueueConfig
+    DIDProcurement       DIDProcurementConfig
+    DIDAging             DIDAgingConfig
+    DIDRotation          DIDRotationConfig
+    Backup               BackupConfig
+    TestMode             TestModeConfig
+    Correlation          CorrelationConfig
+    Recovery             RecoveryConfig
+    SharedCalls          SharedCallConfig
+    NodeID               string        // stored on the calls this node routes, to recover them after a restart
+    ReadOnly             bool          // management plane frozen by the configuration
+    HotCacheTTL          time.Duration // in-process cache for routes and providers
+    SummaryTTL           time.Duration // how long the dashboard summary is served from memory
+    GroupCacheTTL        time.Duration // in-process cache of resolved group members
+    GroupMemberLimit     int           // most members a provider group takes
+    DialTimeout          time.Duration // ring time of legs without a provider or route timeout
+    NoAnswer             NoAnswerConfig
+    SerialFork           SerialForkConfig
+    Abandoned            AbandonedConfig
+    CatchAll             CatchAllConfig
+    LoadBalancer         LoadBalancerConfig
+    WriteBehind          WriteBehindConfig
 }
 
 // CacheInterface defines cache operations
@@ -44,7 +129,10 @@ type CacheInterface interface {
     Get(ctx context.Context, key string, dest interface{}) error
     Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
     Delete(ctx context.Context, keys ...string) error
+    Invalidate(ctx context.Context, keys ...string) error // Delete after a configuration change, on every node
+    OnInvalidate(fn func(keys []string))
     Lock(ctx context.Context, key string, ttl time.Duration) (func(), error)
+    Flush(ctx context.Context, namespaces ...string) ([]string, error) // Invalidate whole namespaces, on every node
 }
 
 // MetricsInterface defines metrics operations
@@ -56,16 +144,76 @@ type MetricsInterface interface {
 
 // NewRouter creates a new router instance
 func NewRouter(db *sql.DB, cache CacheInterface, metrics MetricsInterface, config Config) *Router {
+    writer := NewWriteBehind(db, metrics, config.WriteBehind)
+    
+    lbConfig := config.LoadBalancer
+    lbConfig.HotCacheTTL = config.HotCacheTTL
+    
+    if config.DialTimeout <= 0 {
+        config.DialTimeout = 180 * time.Second
+    }
+    if config.NoAnswer.MaxAttempts <= 0 {
+        config.NoAnswer.MaxAttempts = 2
+    }
+    if config.SerialFork.Hops <= 0 {
+        config.SerialFork.Hops = 2
+    }
+    if config.DIDRotation.Order != DIDOrderRoundRobin {
+        config.DIDRotation.Order = DIDOrderLeastRecent
+    }
+    if config.Abandoned.Grace <= 0 {
+        config.Abandoned.Grace = 10 * time.Second
+    }
+    
+    groupService := provider.NewGroupService(db, cache)
+    groupService.SetMemberLimit(config.GroupMemberLimit)
+    
+    fx := NewFXRates(metrics, config.FX)
+    didManager := NewDIDManager(db, cache, metrics, fx, config.DIDAging, config.DIDRotation)
+    
     r := &Router{
         db:           db,
         cache:        cache,
-        loadBalancer: NewLoadBalancer(db, cache, metrics),
+        loadBalancer: NewLoadBalancer(db, cache, metrics, writer, lbConfig),
         metrics:      metrics,
-        didManager:   NewDIDManager(db, cache),
-        activeCalls:  make(map[string]*models.CallRecord),
+        didManager:   didManager,
+        quarantine:   NewQuarantineManager(db, metrics, config.Quarantine),
+        countries:    NewCountryTracker(db, metrics, config.CountryLimits),
+        rateLimits:   NewRateLimiter(db, metrics, config.RateLimits),
+        blocks:       NewBlockManager(db, metrics, config.Blocking),
+        killSwitches: NewKillSwitchManager(db, metrics, config.KillSwitch),
+        alerts:       NewAlertManager(db, metrics, config.Alerts),
+        fx:           fx,
+        apiTokens:    NewAPITokenManager(db),
+        cdrExports:   NewCDRExporter(db, cache, metrics, fx, config.CDRExport),
+        procurement:  NewDIDProcurement(db, cache, metrics, didManager, config.DIDProcurement),
+        backups:      NewBackupManager(db, cache, metrics, config.Backup),
+        testTraffic:  NewTestTrafficLimiter(config.TestMode),
+        correlation:  NewCorrelationSigner(config.Correlation),
+        replayGuard:  NewReplayGuard(config.StaleCallTimeout),
+        groupService: groupService,
+        routeCache:   newLocalCache("route", config.HotCacheTTL, metrics),
+        dialCache:    newLocalCache("dial", config.HotCacheTTL, metrics),
+        dispositions: newLocalCache("dispositions", config.HotCacheTTL, metrics),
+        holidayCache: newLocalCache("holidays", config.HotCacheTTL, metrics),
+        groupCache:   newLocalCache("group", config.GroupCacheTTL, metrics),
+        writer:       writer,
+        summaryCache: newLocalCache("summary", config.SummaryTTL, metrics),
+        activeCalls:  newCallMap(metrics),
+        routeQueues:  newRouteQueues(),
         config:       config,
     }
     
+    if store, ok := cache.(sharedStore); ok && config.SharedCalls.Enabled {
+        r.shared = newSharedCalls(store, config.SharedCalls, config.StaleCallTimeout)
+    }
+    
+    r.loadBalancer.SetCountryLimits(r.countries)
+    r.loadBalancer.SetRateLimits(r.rateLimits)
+    r.loadBalancer.OnHealthEvent(r.alerts.healthAlert)
+    cache.OnInvalidate(r.dropLocalCaches)
+    r.shortCalls = NewShortCallMonitor(db, metrics, r.loadBalancer, config.ShortCalls)
+    
     // Start cleanup routine
     go r.cleanupRoutine()
     
@@ -83,6 +231,42 @@ func (r *Router) ProcessIncomingCall(ctx context.Context, callID, ani, dnis, inb
     
     log.Info("Processing incoming call from S1")
     
+    // Hash load balancing keys on the caller
+    ctx = context.WithValue(ctx, "ani", ani)
+    
+    // Country limits apply to the destination the caller dialled
+    country := numbering.CountryOf(dnis)
+    ctx = context.WithValue(ctx, "country", country)
+    
+    start := time.Now()
+    defer func() {
+        r.metrics.ObserveHistogram("router_processing_time", time.Since(start).Seconds(), incomingStageLabels)
+    }()
+    
+    // Emergency stops reject new calls, calls already up are left alone
+    if err := r.checkKillSwitch(ctx, inboundProvider, ""); err != nil {
+        return nil, err
+    }
+    if err := r.checkAsteriskRestart(ctx, inboundProvider); err != nil {
+        return nil, err
+    }
+    
+    if err := r.checkQuarantine(inboundProvider); err != nil {
+        log.Warn("Rejecting call from quarantined provider")
+        return nil, err
+    }
+    
+    if !r.shortCalls.Admit(inboundProvider) {
+        r.metrics.IncrementCounter("router_calls_failed", map[string]string{
+            "reason":   "short_call_throttle",
+            "provider": inboundProvider,
+            "route":    "",
+        })
+        log.Warn("Throttling call from customer over its short call limit")
+        return nil, errors.New(errors.ErrQuotaExceeded, "short call ratio over contractual limit").
+            WithContext("provider", inboundProvider)
+    }
+    
     // Start transaction
     tx, err := r.db.BeginTx(ctx, nil)
     if err != nil {
@@ -90,47 +274,181 @@ func (r *Router) ProcessIncomingCall(ctx context.Context, callID, ani, dnis, inb
     }
     defer tx.Rollback()
     
-    // Get route for this inbound provider (supports groups)
-    route, err := r.getRouteForProvider(ctx, tx, inboundProvider)
+    // Test calls the router originated take their own route, then destination
+    // prefixes pick the route, then the inbound provider (supports groups)
+    route, err := r.originatedRoute(ctx)
+    if err == nil && route == nil {
+        route, err = r.getDestinationRoute(ctx, tx, dnis, time.Now())
+    }
+    if err == nil && route == nil {
+        route, err = r.getRouteForProvider(ctx, tx, inboundProvider)
+    }
     if err != nil {
         r.metrics.IncrementCounter("router_calls_failed", map[string]string{
             "reason": "no_route",
             "provider": inboundProvider,
+            "route": "",
         })
         return nil, err
     }
     
-    log.WithField("route", route.Name).Debug("Found route for inbound provider")
+    log.WithFields(map[string]interface{}{
+        "route": route.Name,
+        "matched_by": route.MatchedBy,
+    }).Debug("Found route for call")
     
-    // Select intermediate provider (handle group or individual)
-    intermediateProvider, err := r.selectProvider(ctx, route.IntermediateProvider, route.IntermediateIsGroup, route.LoadBalanceMode)
-    if err != nil {
+    r.metrics.IncrementCounter("router_route_matches", map[string]string{
+        "match": route.MatchedBy,
+        "route": route.Name,
+    })
+    
+    if err := r.checkKillSwitch(ctx, inboundProvider, route.Name); err != nil {
+        return nil, err
+    }
+    
+    // Blocked destinations never get a provider or DID
+    if err := r.checkBlocked(ctx, dnis, inboundProvider, route); err != nil {
         r.metrics.IncrementCounter("router_calls_failed", map[string]string{
-            "reason": "no_intermediate_provider",
+            "reason": "destination_blocked",
+            "provider": inboundProvider,
             "route": route.Name,
         })
         return nil, err
     }
     
-    // Select final provider (handle group or individual)
-    finalProvider, err := r.selectProvider(ctx, route.FinalProvider, route.FinalIsGroup, route.LoadBalanceMode)
+    established := false
+    
+    // Routes that queue take the call's slot up front, waiting for capacity
+    // at their limit without holding the transaction
+    var queued *routeQueueResult
+    if route.QueueTimeout > 0 && route.MaxConcurrentCalls > 0 {
+        tx.Rollback()
+        if queued, err = r.queueForRoute(ctx, callID, route); err != nil {
+            r.metrics.IncrementCounter("router_calls_failed", map[string]string{
+                "reason": "route_capacity",
+                "provider": inboundProvider,
+                "route": route.Name,
+            })
+            return nil, err
+        }
+        queuedRoute := route
+        defer func() {
+            if !established && queued != nil {
+                r.releaseRouteSlot(ctx, queuedRoute)
+            }
+        }()
+        
+        if tx, err = r.db.BeginTx(ctx, nil); err != nil {
+            return nil, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+        }
+        defer tx.Rollback()
+    }
+    
+    // Select intermediate and final providers (handle group or individual)
+    intermediateProvider, finalProvider, reason, err := r.selectRouteProviders(ctx, route)
+    var skippedRoutes []string
+    if err != nil && len(route.FailoverRoutes) > 0 {
+        // The failover route reserves its own slot, the queued one is given back
+        if failover, intermediate, final, ferr := r.failoverOnNewCall(ctx, route, dnis, inboundProvider); ferr == nil {
+            if queued != nil {
+                r.releaseRouteSlot(ctx, route)
+                queued = nil
+            }
+            skippedRoutes = []string{route.Name}
+            route, intermediateProvider, finalProvider, err = failover, intermediate, final, nil
+        }
+    }
     if err != nil {
+        spec := route.IntermediateProvider
+        if reason == "no_final_provider" {
+            spec = route.FinalProvider
+        }
         r.metrics.IncrementCounter("router_calls_failed", map[string]string{
-            "reason": "no_final_provider",
+            "reason": reason,
+            "provider": spec,
             "route": route.Name,
         })
         return nil, err
     }
     
-    // Allocate DID
-    did, err := r.didManager.AllocateDID(ctx, tx, intermediateProvider.Name, dnis)
-    if err != nil {
+    // Pass-through routes have no intermediate, the call goes straight to S4
+    intermediate := ""
+    if intermediateProvider != nil {
+        intermediate = intermediateProvider.Name
+    }
+    
+    // Count the call against the destination country, released again unless it is set up
+    if err := r.countries.Reserve(callID, country, intermediate, finalProvider.Name); err != nil {
+        r.metrics.IncrementCounter("router_calls_failed", map[string]string{
+            "reason": "country_limit",
+            "provider": intermediate,
+            "route": route.Name,
+        })
+        return nil, err
+    }
+    defer func() {
+        if !established {
+            r.countries.Release(callID)
+        }
+    }()
+    
+    // Route, provider and destination prefix caps, the dialplan plays congestion over them
+    if err := r.rateLimits.Reserve(callID, route.Name, dnis, intermediate, finalProvider.Name); err != nil {
         r.metrics.IncrementCounter("router_calls_failed", map[string]string{
-            "reason": "no_did_available",
-            "provider": intermediateProvider.Name,
+            "reason": "rate_limited",
+            "provider": intermediate,
+            "route": route.Name,
         })
         return nil, err
     }
+    defer func() {
+        if !established {
+            r.rateLimits.Release(callID)
+        }
+    }()
+    
+    // Test routes get their own, much smaller, traffic budget
+    if route.IsTest {
+        if err := r.testTraffic.Acquire(callID); err != nil {
+            r.metrics.IncrementCounter("router_test_calls", map[string]string{
+                "route": route.Name,
+                "outcome": "rate_limited",
+            })
+            return nil, err
+        }
+        defer func() {
+            if !established {
+                r.testTraffic.Release(callID)
+            }
+        }()
+    }
+    
+    // Allocate DID, pass-through calls take none from the pool
+    var did string
+    if !route.PassThrough {
+        did, err = r.didManager.AllocateDID(ctx, tx, intermediate, dnis, route.IsTest)
+        if err != nil {
+            r.metrics.IncrementCounter("router_calls_failed", map[string]string{
+                "reason": "no_did_available",
+                "provider": intermediate,
+                "route": route.Name,
+            })
+            return nil, err
+        }
+    }
+    
+    // Parallel dial rings a second intermediate on a DID of its own
+    var parallel *models.Provider
+    var parallelDID string
+    if route.ParallelDial && !route.PassThrough {
+        parallel, parallelDID = r.parallelIntermediate(ctx, tx, route, intermediateProvider, dnis)
+    }
+    
+    // A serial fork hands the dialplan the intermediates to try next, each on a DID of its own
+    var fork []models.ForkHop
+    if r.config.SerialFork.Enabled && parallel == nil && !route.PassThrough {
+        fork = r.forkHops(ctx, tx, route, intermediateProvider, dnis)
+    }
     
     // Create call record
     record := &models.CallRecord{
@@ -140,24 +458,50 @@ func (r *Router) ProcessIncomingCall(ctx context.Context, callID, ani, dnis, inb
         TransformedANI:       dnis, // ANI-2 = DNIS-1
         AssignedDID:          did,
         InboundProvider:      inboundProvider,
-        IntermediateProvider: intermediateProvider.Name,
+        IntermediateProvider: intermediate,
         FinalProvider:        finalProvider.Name,
         RouteName:            route.Name,
         Status:               models.CallStatusActive,
         CurrentStep:          "S1_TO_S2",
         StartTime:            time.Now(),
-        RecordingPath:        fmt.Sprintf("/var/spool/asterisk/monitor/%s.wav", callID),
+        RecordingPath:        recordingDir + callID + ".wav",
+        IsTest:               route.IsTest,
+        SkippedRoutes:        skippedRoutes,
+    }
+    applyRoutePolicy(record, route)
+    if route.PassThrough {
+        record.TransformedANI = ""
+        record.Status = models.CallStatusRoutingToS4
+        record.CurrentStep = "S2_TO_S4"
+    }
+    if parallel != nil {
+        record.ParallelIntermediate = parallel.Name
+        record.ParallelDID = parallelDID
     }
+    record.ForkHops = fork
     
     // Store call record in database
     if err := r.storeCallRecord(ctx, tx, record); err != nil {
         r.didManager.ReleaseDID(ctx, tx, did)
+        for _, leg := range record.PendingLegs() {
+            r.didManager.ReleaseDID(ctx, tx, leg.AssignedDID)
+        }
         return nil, err
     }
     
-    // Update route current calls
-    if err := r.incrementRouteCalls(ctx, tx, route.ID); err != nil {
-        log.WithError(err).Warn("Failed to update route call count")
+    // Reserve a slot on the route, enforcing the concurrent call limit atomically
+    if queued == nil {
+        if err := r.incrementRouteCalls(ctx, tx, route.ID, route.MaxConcurrentCalls); err != nil {
+            if errors.GetCode(err) == string(errors.ErrQuotaExceeded) {
+                r.metrics.IncrementCounter("router_calls_failed", map[string]string{
+                    "reason": "route_capacity",
+                    "provider": inboundProvider,
+                    "route": route.Name,
+                })
+                return nil, err
+            }
+            log.WithError(err).Warn("Failed to update route call count")
+        }
     }
     
     // Commit transaction
@@ -165,32 +509,50 @@ func (r *Router) ProcessIncomingCall(ctx context.Context, callID, ani, dnis, inb
         return nil, errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
     }
     
+    established = true
+    
     // Store in memory after successful commit
-    r.mu.Lock()
-    r.activeCalls[callID] = record
-    r.didManager.RegisterCallDID(did, callID)
-    r.mu.Unlock()
+    r.activeCalls.Set(callID, record)
+    if did != "" {
+        r.didManager.RegisterCallDID(did, callID)
+    }
+    for _, leg := range record.PendingLegs() {
+        r.didManager.RegisterCallDID(leg.AssignedDID, callID)
+    }
+    r.shareCall(ctx, record)
     
     // Update metrics
-    r.updateMetricsForNewCall(route.Name)
+    r.updateMetricsForNewCall(record)
     
     // Update load balancer stats
-    r.loadBalancer.IncrementActiveCalls(intermediateProvider.Name)
+    r.loadBalancer.IncrementActiveCalls(intermediate)
     r.loadBalancer.IncrementActiveCalls(finalProvider.Name)
     
-    // Prepare response
-    response := &models.CallResponse{
-        Status:      "success",
-        DIDAssigned: did,
-        NextHop:     fmt.Sprintf("endpoint-%s", intermediateProvider.Name),
-        ANIToSend:   dnis,  // ANI-2 = DNIS-1
-        DNISToSend:  did,   // DID
+    // Prepare response, a pass-through call is dialed to S4 with the ANI and
+    // DNIS of the route policy
+    var response *models.CallResponse
+    if route.PassThrough {
+        response = r.finalLeg(ctx, record)
+    } else {
+        response = r.intermediateLeg(ctx, callID, dnis, did, intermediate, route.DialOptions)
+    }
+    if parallel != nil {
+        r.addParallelTarget(ctx, response, callID, dnis, parallelDID, parallel.Name, route.DialOptions)
+    }
+    r.addForkHops(ctx, response, callID, dnis, fork, route.DialOptions)
+    if queued != nil {
+        response.QueuePosition = queued.Position
+        response.QueueWait = int(queued.Waited.Seconds())
+        response.QueueTimeout = int(queued.Timeout.Seconds())
     }
     
     log.WithFields(map[string]interface{}{
         "did_assigned": did,
         "next_hop": response.NextHop,
-        "intermediate": intermediateProvider.Name,
+        "intermediate": intermediate,
+        "pass_through": route.PassThrough,
+        "parallel": record.ParallelIntermediate,
+        "fork_hops": len(fork),
         "final": finalProvider.Name,
     }).Info("Incoming call processed successfully")
     
@@ -198,7 +560,8 @@ func (r *Router) ProcessIncomingCall(ctx context.Context, callID, ani, dnis, inb
 }
 
 // ProcessReturnCall handles call returning from S3 (Step 3 in UML)
-func (r *Router) ProcessReturnCall(ctx context.Context, ani2, did, provider, sourceIP string) (*models.CallResponse, error) {
+// The token is the correlation token received in a SIP header, empty when not present.
+func (r *Router) ProcessReturnCall(ctx context.Context, ani2, did, token, provider, sourceIP string) (*models.CallResponse, error) {
     log := logger.WithContext(ctx).WithFields(map[string]interface{}{
         "ani2": ani2,
         "did": did,
@@ -208,53 +571,122 @@ func (r *Router) ProcessReturnCall(ctx context.Context, ani2, did, provider, sou
     
     log.Info("Processing return call from S3")
     
+    if err := r.checkQuarantine(provider); err != nil {
+        log.Warn("Rejecting return call from quarantined provider")
+        return nil, err
+    }
+    
     // Find call by DID
-    callID := r.didManager.GetCallIDByDID(did)
+    callID := r.lookupCallIDByDID(ctx, did)
     if callID == "" {
+        // The DNIS may carry the correlation token as a suffix
+        if baseDID, suffix := r.correlation.SplitDNIS(did); suffix != "" {
+            if callID = r.lookupCallIDByDID(ctx, baseDID); callID != "" {
+                did = baseDID
+                if token == "" {
+                    token = suffix
+                }
+            }
+        }
+    }
+    if callID == "" {
+        if prevCallID, consumed := r.replayGuard.Lookup(returnLegKey(did)); consumed {
+            return nil, r.rejectReplay(ctx, "return", prevCallID, did, provider, sourceIP)
+        }
         return nil, errors.New(errors.ErrCallNotFound, "no active call for DID").
             WithContext("did", did)
     }
     
-    r.mu.RLock()
-    record, exists := r.activeCalls[callID]
-    r.mu.RUnlock()
+    record, exists := r.sharedCallRecord(ctx, callID)
     
     if !exists || record == nil {
         return nil, errors.New(errors.ErrCallNotFound, "call record not found")
     }
     
+    // Calls handed several intermediates are checked against the one that brought the call back
+    legs := returnedLegOf(record, did)
+    
+    // Routes of several intermediates bring the call back once per hop
+    hopLeg, hop := hopLegOf(record, did)
+    if hopLeg != nil {
+        legs = &returnedLegs{leg: hopLeg}
+    }
+    leg := legs.leg
+    
+    // Correlation tokens are enforced regardless of strict mode
+    if r.correlation.Enabled() {
+        if err := r.verifyCorrelationToken(ctx, record, did, token, sourceIP); err != nil {
+            r.metrics.IncrementCounter("router_verification_failed", map[string]string{
+                "stage": "return",
+                "reason": "token_mismatch",
+            })
+            r.quarantine.RecordFailure(ctx, provider, err.Error())
+            return nil, err
+        }
+    }
+    
     // Verify if enabled
-    if r.config.VerificationEnabled {
-        if err := r.verifyReturnCall(ctx, record, ani2, did, provider, sourceIP); err != nil {
+    if r.verificationEnabled(leg) {
+        if err := r.verifyReturnCall(ctx, leg, ani2, did, provider, sourceIP); err != nil {
             r.metrics.IncrementCounter("router_verification_failed", map[string]string{
                 "stage": "return",
                 "reason": "verification_failed",
             })
+            r.quarantine.RecordFailure(ctx, provider, err.Error())
             
-            if r.config.StrictMode {
+            if r.strictMode(leg) {
                 return nil, err
             }
             log.WithError(err).Warn("Verification failed but continuing (strict mode disabled)")
         }
     }
     
+    // A DID may only bring a call back once
+    if !r.replayGuard.Consume(returnLegKey(did), callID) {
+        return nil, r.rejectReplay(ctx, "return", callID, did, provider, sourceIP)
+    }
+    
+    // The first intermediate of a parallel dial or serial fork back keeps the call
+    if legs.pending() {
+        if err := r.claimReturnedLeg(leg); err != nil {
+            log.WithError(err).Info("Rejecting return call of a leg that lost the call")
+            return nil, err
+        }
+    }
+    
     // Update call state
-    r.updateCallState(callID, models.CallStatusReturnedFromS3, "S3_TO_S2")
+    step := "S3_TO_S2"
+    if hop > 0 {
+        step = fmt.Sprintf("HOP%d_TO_S2", hop)
+        r.markHopReturned(callID, did)
+    }
+    r.updateCallState(callID, models.CallStatusReturnedFromS3, step)
+    if err := r.syncSharedCall(ctx, callID); err != nil {
+        // Another instance took the return leg first
+        return nil, r.rejectReplay(ctx, "return", callID, did, provider, sourceIP)
+    }
+    if legs.pending() {
+        r.releaseReturnedLegs(ctx, legs)
+    }
     
     // Update metrics
-    r.metrics.IncrementCounter("router_calls_processed", map[string]string{
-        "stage": "return",
-        "route": record.RouteName,
-    })
+    if record.IsTest {
+        r.metrics.IncrementCounter("router_test_calls", testCallLabels(record, "returned"))
+    } else {
+        r.metrics.IncrementCounter("router_calls_processed", map[string]string{
+            "stage": "return",
+            "route": record.RouteName,
+        })
+    }
     
-    // Build response for routing to S4
-    response := &models.CallResponse{
-        Status:     "success",
-        NextHop:    fmt.Sprintf("endpoint-%s", record.FinalProvider),
-        ANIToSend:  record.OriginalANI,   // Restore ANI-1
-        DNISToSend: record.OriginalDNIS,  // Restore DNIS-1
+    // The call goes through the hops of its route before S4
+    if current, ok := r.activeCalls.Get(callID); ok && len(current.HopLegs) < len(current.Hops) {
+        return r.nextHop(ctx, current)
     }
     
+    // Build response for routing to S4
+    response := r.finalLeg(ctx, record)
+    
     log.WithFields(map[string]interface{}{
         "call_id": callID,
         "next_hop": response.NextHop,
@@ -276,9 +708,17 @@ func (r *Router) ProcessFinalCall(ctx context.Context, callID, ani, dnis, provid
     
     log.Info("Processing final call from S4")
     
+    if err := r.checkQuarantine(provider); err != nil {
+        log.Warn("Rejecting final call from quarantined provider")
+        return err
+    }
+    
     // Find call record
-    record := r.findCallRecord(callID, ani, dnis)
+    record := r.findCallRecord(ctx, callID, ani, dnis)
     if record == nil {
+        if prevCallID, consumed := r.replayGuard.Lookup(finalLegKey(ani, dnis)); consumed {
+            return r.rejectReplay(ctx, "final", prevCallID, dnis, provider, sourceIP)
+        }
         return errors.New(errors.ErrCallNotFound, "call not found").
             WithContext("call_id", callID).
             WithContext("ani", ani).
@@ -289,122 +729,199 @@ func (r *Router) ProcessFinalCall(ctx context.Context, callID, ani, dnis, provid
     actualCallID := r.getActualCallID(callID, record)
     
     // Verify if enabled
-    if r.config.VerificationEnabled {
+    if r.verificationEnabled(record) {
         if err := r.verifyFinalCall(ctx, record, ani, dnis, provider, sourceIP); err != nil {
             r.metrics.IncrementCounter("router_verification_failed", map[string]string{
                 "stage": "final",
                 "reason": "verification_failed",
             })
+            r.quarantine.RecordFailure(ctx, provider, err.Error())
             
-            if r.config.StrictMode {
+            if r.strictMode(record) {
                 return err
             }
             log.WithError(err).Warn("Verification failed but continuing")
         }
     }
     
+    if !r.replayGuard.Consume(finalLegKey(record.OriginalANI, record.OriginalDNIS), actualCallID) {
+        return r.rejectReplay(ctx, "final", actualCallID, dnis, provider, sourceIP)
+    }
+    
     // Complete the call
     return r.completeCall(ctx, actualCallID, record)
 }
 
-// ProcessHangup handles call hangup from AGI
-func (r *Router) ProcessHangup(ctx context.Context, callID string) error {
+// ProcessHangup handles call hangup from AGI, timing is what Asterisk reported
+// about the dialed leg
+func (r *Router) ProcessHangup(ctx context.Context, callID string, timing models.CallTiming) error {
     log := logger.WithContext(ctx).WithField("call_id", callID)
     
-    r.mu.RLock()
-    record, exists := r.activeCalls[callID]
-    r.mu.RUnlock()
+    record, exists := r.sharedCallRecord(ctx, callID)
     
-    if !exists {
-        // Already cleaned up
-        return nil
-    }
-    
-    log.WithField("status", record.Status).Info("Processing hangup")
-    
-    // Only process if not already completed
-    if record.Status != models.CallStatusCompleted {
-        r.handleIncompleteCall(ctx, callID, record)
+    if exists {
+        log.WithField("status", record.Status).Info("Processing hangup")
+        
+        // Only process if not already completed
+        if record.Status != models.CallStatusCompleted {
+            r.handleIncompleteCall(ctx, callID, record)
+        }
     }
     
-    return nil
+    // Completed calls are already cleaned up but only now know their talk time
+    return r.recordCallTiming(ctx, callID, timing)
 }
 
 // Helper methods
 
 func (r *Router) getRouteForProvider(ctx context.Context, tx *sql.Tx, inboundProvider string) (*models.ProviderRoute, error) {
-    // Try cache first
-    cacheKey := fmt.Sprintf("route:inbound:%s", inboundProvider)
-    var route models.ProviderRoute
+    start := time.Now()
+    
+    // Try the in-process cache, then Redis
+    cacheKey := "route:inbound:" + inboundProvider
+    if cached, ok := r.routeCache.get(cacheKey); ok {
+        r.observeRouteLookup(start, "memory")
+        return cached.(*models.ProviderRoute), nil
+    }
     
+    var route models.ProviderRoute
     if err := r.cache.Get(ctx, cacheKey, &route); err == nil {
+        r.routeCache.set(cacheKey, &route)
+        r.observeRouteLookup(start, "redis")
         return &route, nil
     }
+    defer r.observeRouteLookup(start, "database")
+    
+    // Group routes match the groups of the provider, nested ones included
+    groups, err := r.groupService.GetProviderGroups(ctx, inboundProvider)
+    if err != nil {
+        return nil, err
+    }
     
     // Query database for both direct and group matches
-    query := `
-        SELECT pr.id, pr.name, pr.description, pr.inbound_provider, pr.intermediate_provider, 
-               pr.final_provider, pr.load_balance_mode, pr.priority, pr.weight,
-               pr.max_concurrent_calls, pr.current_calls, pr.enabled,
-               pr.failover_routes, pr.routing_rules, pr.metadata,
-               pr.inbound_is_group, pr.intermediate_is_group, pr.final_is_group
-        FROM provider_routes pr
+    query := routeSelect + `
         WHERE pr.enabled = 1 AND (
-            (pr.inbound_provider = ? AND pr.inbound_is_group = 0) OR
-            (pr.inbound_is_group = 1 AND EXISTS (
-                SELECT 1 FROM provider_group_members pgm
-                JOIN provider_groups pg ON pgm.group_id = pg.id
-                WHERE pg.name = pr.inbound_provider AND pgm.provider_name = ?
-            ))
+            (pr.inbound_provider = ? AND pr.inbound_is_group = 0 AND COALESCE(pr.inbound_match, 'exact') = 'exact')`
+    args := []interface{}{inboundProvider}
+    if len(groups) > 0 {
+        query += `
+            OR (pr.inbound_is_group = 1 AND pr.inbound_provider IN (?` + strings.Repeat(", ?", len(groups)-1) + `))`
+        for _, group := range groups {
+            args = append(args, group)
+        }
+    }
+    query += `
         )
-        ORDER BY pr.priority DESC, pr.weight DESC
-        LIMIT 1`
-    
-    var inboundIsGroup, intermediateIsGroup, finalIsGroup sql.NullBool
-    
-    err := tx.QueryRowContext(ctx, query, inboundProvider, inboundProvider).Scan(
-        &route.ID, &route.Name, &route.Description,
-        &route.InboundProvider, &route.IntermediateProvider, &route.FinalProvider,
-        &route.LoadBalanceMode, &route.Priority, &route.Weight,
-        &route.MaxConcurrentCalls, &route.CurrentCalls, &route.Enabled,
-        &route.FailoverRoutes, &route.RoutingRules, &route.Metadata,
-        &inboundIsGroup, &intermediateIsGroup, &finalIsGroup,
-    )
+        ORDER BY pr.priority DESC, pr.weight DESC`
     
-    if err == sql.ErrNoRows {
-        return nil, errors.New(errors.ErrRouteNotFound, "no route for provider").
-            WithContext("provider", inboundProvider)
-    }
+    rows, err := tx.QueryContext(ctx, query, args...)
     if err != nil {
         return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query route")
     }
     
-    // Set boolean flags
-    route.InboundIsGroup = inboundIsGroup.Valid && inboundIsGroup.Bool
-    route.IntermediateIsGroup = intermediateIsGroup.Valid && intermediateIsGroup.Bool
-    route.FinalIsGroup = finalIsGroup.Valid && finalIsGroup.Bool
+    // The first route open now takes the call, routes closed by their schedule pass it on
+    now := time.Now()
+    scheduled := false
+    var found *models.ProviderRoute
+    for rows.Next() {
+        candidate, err := scanRoute(rows)
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to scan route")
+            continue
+        }
+        if !candidate.Schedule.IsEmpty() {
+            scheduled = true
+        }
+        if r.RouteOpen(ctx, candidate, now) {
+            found = candidate
+            break
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read routes")
+    }
+    if found != nil {
+        found.MatchedBy = string(models.InboundMatchExact)
+        if found.InboundIsGroup {
+            found.MatchedBy = "group"
+        }
+    }
     
-    // Check concurrent call limit
-    if route.MaxConcurrentCalls > 0 && route.CurrentCalls >= route.MaxConcurrentCalls {
-        return nil, errors.New(errors.ErrQuotaExceeded, "route at maximum capacity")
+    // Prefix and regex routes only win over exact and group routes on higher priority
+    pattern, patternScheduled, err := r.getPatternRoute(ctx, tx, inboundProvider, now)
+    if err != nil {
+        return nil, err
+    }
+    scheduled = scheduled || patternScheduled
+    if pattern != nil && (found == nil || pattern.Priority > found.Priority) {
+        found = pattern
     }
     
-    // Cache for 1 minute
-    r.cache.Set(ctx, cacheKey, route, time.Minute)
+    // Fall back to the catch-all route when nothing specific matches
+    if found == nil {
+        if found, err = r.getCatchAllRoute(ctx, tx); err != nil {
+            return nil, err
+        }
+        if found != nil && !found.Schedule.IsEmpty() {
+            scheduled = true
+            if !r.RouteOpen(ctx, found, now) {
+                found = nil
+            }
+        }
+    }
     
-    return &route, nil
+    if found == nil {
+        return nil, errors.New(errors.ErrRouteNotFound, "no route for provider").
+            WithContext("provider", inboundProvider)
+    }
+    
+    // Cache for 1 minute, the concurrent call limit is enforced by incrementRouteCalls.
+    // Schedule windows open and close on the minute, a choice they made holds until then.
+    ttl := time.Minute
+    if scheduled {
+        ttl = time.Until(now.Truncate(time.Minute).Add(time.Minute))
+    }
+    r.cache.Set(ctx, cacheKey, found, ttl)
+    r.preResolveGroups(ctx, found)
+    if !scheduled {
+        r.routeCache.set(cacheKey, found)
+    }
+    
+    return found, nil
 }
 
-func (r *Router) selectProvider(ctx context.Context, providerSpec string, isGroup bool, mode models.LoadBalanceMode) (*models.Provider, error) {
+// observeRouteLookup records how long finding the route of a call took by
+// where it was found: memory, redis or database
+func (r *Router) observeRouteLookup(start time.Time, source string) {
+    r.metrics.ObserveHistogram("router_route_lookup_duration", time.Since(start).Seconds(), map[string]string{
+        "source": source,
+    })
+}
+
+// selectProvider picks the provider of a leg of the route, leaving out the
+// providers it excludes and weighted by its weight curves and cost ceiling
+// where it has them
+func (r *Router) selectProvider(ctx context.Context, route *models.ProviderRoute, providerSpec string, isGroup bool, mode models.LoadBalanceMode) (*models.Provider, error) {
     if isGroup {
-        return r.selectProviderFromGroup(ctx, providerSpec, mode)
+        return r.selectProviderFromGroup(ctx, route, providerSpec, mode)
+    }
+    if !r.routeReweighted(route.Name) && len(route.ExcludedProviders) == 0 {
+        return r.loadBalancer.SelectProvider(ctx, providerSpec, mode)
     }
-    return r.loadBalancer.SelectProvider(ctx, providerSpec, mode)
+    
+    providers, err := r.loadBalancer.getAvailableProviders(ctx, providerSpec)
+    if err != nil {
+        return nil, err
+    }
+    if providers, err = excludeProviders(route, providerSpec, providers); err != nil {
+        return nil, err
+    }
+    return r.loadBalancer.SelectFromProviders(ctx, providerSpec, r.weighRoute(route.Name, providers), mode)
 }
 
-func (r *Router) selectProviderFromGroup(ctx context.Context, groupName string, mode models.LoadBalanceMode) (*models.Provider, error) {
-    groupService := provider.NewGroupService(r.db, r.cache)
-    members, err := groupService.GetGroupMembers(ctx, groupName)
+func (r *Router) selectProviderFromGroup(ctx context.Context, route *models.ProviderRoute, groupName string, mode models.LoadBalanceMode) (*models.Provider, error) {
+    members, err := r.groupMembers(ctx, groupName)
     if err != nil {
         return nil, err
     }
@@ -413,7 +930,23 @@ func (r *Router) selectProviderFromGroup(ctx context.Context, groupName string,
         return nil, errors.New(errors.ErrProviderNotFound, "no providers in group")
     }
     
-    return r.loadBalancer.SelectFromProviders(ctx, members, mode)
+    // Exclusions apply to the resolved members, nested groups included
+    if members, err = excludeProviders(route, "group:"+groupName, members); err != nil {
+        return nil, err
+    }
+    
+    return r.loadBalancer.SelectFromProviders(ctx, "group:"+groupName, r.weighRoute(route.Name, members), mode)
+}
+
+// weighRoute returns the providers with the weights the route gives them, of
+// its weight curves and then its cost ceiling
+func (r *Router) weighRoute(route string, providers []*models.Provider) []*models.Provider {
+    return applyCostShift(applyCurveWeights(providers, r.routeCurveWeights(route)), r.routeCostShift(route))
+}
+
+// routeReweighted reports whether the route changes the weights of its providers
+func (r *Router) routeReweighted(route string) bool {
+    return len(r.routeCurveWeights(route)) > 0 || r.routeCostShift(route) != nil
 }
 
 func (r *Router) storeCallRecord(ctx context.Context, tx *sql.Tx, record *models.CallRecord) error {
@@ -421,17 +954,16 @@ func (r *Router) storeCallRecord(ctx context.Context, tx *sql.Tx, record *models
         INSERT INTO call_records (
             call_id, original_ani, original_dnis, transformed_ani, assigned_did,
             inbound_provider, intermediate_provider, final_provider, route_name,
-            status, current_step, start_time, recording_path, metadata
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-    
-    metadata, _ := json.Marshal(record.Metadata)
+            status, current_step, start_time, recording_path, metadata, is_test, router_node
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
     
     _, err := tx.ExecContext(ctx, query,
         record.CallID, record.OriginalANI, record.OriginalDNIS,
         record.TransformedANI, record.AssignedDID,
         record.InboundProvider, record.IntermediateProvider, record.FinalProvider,
         record.RouteName, record.Status, record.CurrentStep,
-        record.StartTime, record.RecordingPath, metadata,
+        record.StartTime, record.RecordingPath, metadataValue(record.Metadata), record.IsTest,
+        nullString(r.config.NodeID),
     )
     
     if err != nil {
@@ -446,17 +978,20 @@ func (r *Router) updateCallRecord(ctx context.Context, tx *sql.Tx, record *model
         UPDATE call_records 
         SET status = ?, current_step = ?, failure_reason = ?,
             answer_time = ?, end_time = ?, duration = ?,
-            billable_duration = ?, sip_response_code = ?,
-            quality_score = ?, metadata = ?
+            billable_duration = ?, intermediate_billable_duration = ?,
+            final_billable_duration = ?, sip_response_code = ?,
+            quality_score = ?, metadata = ?, billed_amount = ?,
+            cost = ?, margin = ?, currency = ?, rate_prefix = ?
         WHERE call_id = ?`
     
-    metadata, _ := json.Marshal(record.Metadata)
-    
     _, err := tx.ExecContext(ctx, query,
         record.Status, record.CurrentStep, record.FailureReason,
         record.AnswerTime, record.EndTime, record.Duration,
-        record.BillableDuration, record.SIPResponseCode,
-        record.QualityScore, metadata, record.CallID,
+        record.BillableDuration, record.IntermediateBillable,
+        record.FinalBillable, record.SIPResponseCode,
+        record.QualityScore, metadataValue(record.Metadata), record.BilledAmount,
+        record.Cost, record.Margin, nullString(record.Currency), nullString(record.RatePrefix),
+        record.CallID,
     )
     
     if err != nil {
@@ -466,11 +1001,31 @@ func (r *Router) updateCallRecord(ctx context.Context, tx *sql.Tx, record *model
     return nil
 }
 
-func (r *Router) incrementRouteCalls(ctx context.Context, tx *sql.Tx, routeID int) error {
-    _, err := tx.ExecContext(ctx, 
-        "UPDATE provider_routes SET current_calls = current_calls + 1 WHERE id = ?", 
-        routeID)
-    return err
+// incrementRouteCalls reserves a slot on the route; the limit is the resolved
+// one since it may be inherited from the route policy
+func (r *Router) incrementRouteCalls(ctx context.Context, tx *sql.Tx, routeID, maxCalls int) error {
+    result, err := tx.ExecContext(ctx, `
+        UPDATE provider_routes SET current_calls = current_calls + 1
+        WHERE id = ? AND (? = 0 OR current_calls < ?)`,
+        routeID, maxCalls, maxCalls)
+    if err != nil {
+        return err
+    }
+    
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return errors.New(errors.ErrQuotaExceeded, "route at maximum capacity").
+            WithContext("route_id", routeID)
+    }
+    return nil
+}
+
+// metadataValue stores empty metadata as NULL instead of marshalling it on every write
+func metadataValue(metadata models.JSON) interface{} {
+    if len(metadata) == 0 {
+        return nil
+    }
+    data, _ := json.Marshal(metadata)
+    return data
 }
 
 func (r *Router) decrementRouteCalls(ctx context.Context, tx *sql.Tx, routeName string) error {
@@ -481,102 +1036,86 @@ func (r *Router) decrementRouteCalls(ctx context.Context, tx *sql.Tx, routeName
 }
 
 func (r *Router) updateCallState(callID string, status models.CallStatus, step string) {
-    r.mu.Lock()
-    defer r.mu.Unlock()
-    
-    if record, exists := r.activeCalls[callID]; exists {
+    r.activeCalls.Update(callID, func(record *models.CallRecord) {
         record.Status = status
         record.CurrentStep = step
-    }
+        if status == models.CallStatusReturnedFromS3 && record.ReturnedAt == nil {
+            now := time.Now()
+            record.ReturnedAt = &now
+        }
+    })
 }
 
-func (r *Router) findCallRecord(callID, ani, dnis string) *models.CallRecord {
-    r.mu.RLock()
-    defer r.mu.RUnlock()
-    
-    // Try direct lookup first
-    if record, exists := r.activeCalls[callID]; exists {
+func (r *Router) findCallRecord(ctx context.Context, callID, ani, dnis string) *models.CallRecord {
+    // Try direct lookup first, the only one another instance can answer
+    if record, exists := r.sharedCallRecord(ctx, callID); exists {
         return record
     }
     
     // Try to find by ANI/DNIS combination
-    for _, rec := range r.activeCalls {
-        if rec.OriginalANI == ani && rec.OriginalDNIS == dnis {
-            return rec
+    var found *models.CallRecord
+    r.activeCalls.Range(func(_ string, rec *models.CallRecord) bool {
+        if rec.FinalANI() == ani && rec.FinalDNIS() == dnis {
+            found = rec
+            return false
         }
-    }
+        return true
+    })
     
-    return nil
+    return found
 }
 
 func (r *Router) getActualCallID(providedID string, record *models.CallRecord) string {
-    r.mu.RLock()
-    defer r.mu.RUnlock()
-    
     // If we have the record with provided ID, use it
-    if _, exists := r.activeCalls[providedID]; exists {
+    if _, exists := r.activeCalls.Get(providedID); exists {
         return providedID
     }
     
     // Otherwise find the actual ID
-    for id, rec := range r.activeCalls {
+    actualID := providedID
+    r.activeCalls.Range(func(id string, rec *models.CallRecord) bool {
         if rec == record {
-            return id
+            actualID = id
+            return false
         }
-    }
+        return true
+    })
     
-    return providedID
+    return actualID
 }
 
 func (r *Router) completeCall(ctx context.Context, callID string, record *models.CallRecord) error {
     // Calculate duration
     duration := time.Since(record.StartTime)
     
-    // Start transaction for cleanup
-    tx, err := r.db.BeginTx(ctx, nil)
-    if err != nil {
-        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
-    }
-    defer tx.Rollback()
-    
     // Update call record
     now := time.Now()
     record.Status = models.CallStatusCompleted
     record.CurrentStep = "COMPLETED"
     record.EndTime = &now
     record.Duration = int(duration.Seconds())
-    record.BillableDuration = record.Duration
+    r.rateLegs(ctx, record, record.Duration)
     
-    if err := r.updateCallRecord(ctx, tx, record); err != nil {
-        logger.WithContext(ctx).WithError(err).Error("Failed to update call record")
+    if err := r.closeCallRecord(ctx, "complete_call", record); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to close call record")
     }
     
-    // Release DID
-    if err := r.didManager.ReleaseDID(ctx, tx, record.AssignedDID); err != nil {
-        logger.WithContext(ctx).WithError(err).Error("Failed to release DID")
+    // Update load balancer stats, test calls don't count towards provider success rates
+    if !record.IsTest {
+        r.loadBalancer.UpdateCallComplete(record.IntermediateProvider, true, duration)
+        r.loadBalancer.UpdateCallComplete(record.FinalProvider, true, duration)
     }
-    
-    // Update route current calls
-    if err := r.decrementRouteCalls(ctx, tx, record.RouteName); err != nil {
-        logger.WithContext(ctx).WithError(err).Warn("Failed to update route call count")
-    }
-    
-    // Commit transaction
-    if err := tx.Commit(); err != nil {
-        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
-    }
-    
-    // Update load balancer stats
-    r.loadBalancer.UpdateCallComplete(record.IntermediateProvider, true, duration)
-    r.loadBalancer.UpdateCallComplete(record.FinalProvider, true, duration)
     r.loadBalancer.DecrementActiveCalls(record.IntermediateProvider)
     r.loadBalancer.DecrementActiveCalls(record.FinalProvider)
+    r.decrementHopCalls(record)
     
     // Clean up memory
-    r.mu.Lock()
-    delete(r.activeCalls, callID)
-    r.didManager.UnregisterCallDID(record.AssignedDID)
-    r.mu.Unlock()
+    r.activeCalls.Delete(callID)
+    r.didManager.UnregisterCall(record)
+    r.unshareCall(ctx, record)
+    r.countries.Release(callID)
+    r.rateLimits.Release(callID)
+    r.testTraffic.Release(callID)
     
     // Update metrics
     r.updateMetricsForCompletedCall(record, duration)
@@ -590,6 +1129,40 @@ func (r *Router) completeCall(ctx context.Context, callID string, record *models
     return nil
 }
 
+// closeCallRecord rates a call, writes its end, releases its DID and frees
+// its route slot in one transaction, run again if MySQL rolls it back on a
+// deadlock or lock wait timeout. Other failures of a step are logged and the
+// remaining steps still committed.
+func (r *Router) closeCallRecord(ctx context.Context, operation string, record *models.CallRecord) error {
+    log := logger.WithContext(ctx).WithField("call_id", record.CallID)
+    
+    // A call waiting on the route may take the freed slot
+    defer r.routeQueues.wake(record.RouteName)
+    
+    return db.RetryTx(ctx, r.db, operation, func(tx *sql.Tx) error {
+        r.rateCall(ctx, tx, record)
+        if err := r.updateCallRecord(ctx, tx, record); err != nil {
+            if db.IsRetryable(err) {
+                return err
+            }
+            log.WithError(err).Error("Failed to update call record")
+        }
+        if err := r.didManager.ReleaseCallDID(ctx, tx, record); err != nil {
+            if db.IsRetryable(err) {
+                return err
+            }
+            log.WithError(err).Error("Failed to release DID")
+        }
+        if err := r.decrementRouteCalls(ctx, tx, record.RouteName); err != nil {
+            if db.IsRetryable(err) {
+                return err
+            }
+            log.WithError(err).Warn("Failed to update route call count")
+        }
+        return nil
+    })
+}
+
 func (r *Router) handleIncompleteCall(ctx context.Context, callID string, record *models.CallRecord) {
     // Determine final status
     status := models.CallStatusAbandoned
@@ -598,55 +1171,68 @@ func (r *Router) handleIncompleteCall(ctx context.Context, callID string, record
     }
     
     // Update call state
-    r.mu.Lock()
-    record.Status = status
-    record.CurrentStep = "HANGUP"
     now := time.Now()
-    record.EndTime = &now
-    record.Duration = int(now.Sub(record.StartTime).Seconds())
-    r.mu.Unlock()
+    r.activeCalls.Update(callID, func(record *models.CallRecord) {
+        record.Status = status
+        record.CurrentStep = "HANGUP"
+        record.EndTime = &now
+        record.Duration = int(now.Sub(record.StartTime).Seconds())
+    })
     
     // Update in database
-    tx, err := r.db.BeginTx(ctx, nil)
-    if err == nil {
-        r.updateCallRecord(ctx, tx, record)
-        r.didManager.ReleaseDID(ctx, tx, record.AssignedDID)
-        r.decrementRouteCalls(ctx, tx, record.RouteName)
-        tx.Commit()
+    if err := r.closeCallRecord(ctx, "incomplete_call", record); err != nil {
+        logger.WithContext(ctx).WithError(err).WithField("call_id", callID).Error("Failed to close call record")
     }
     
     // Update stats
-    r.loadBalancer.UpdateCallComplete(record.IntermediateProvider, false, 0)
-    r.loadBalancer.UpdateCallComplete(record.FinalProvider, false, 0)
+    if !record.IsTest {
+        r.loadBalancer.UpdateCallComplete(record.IntermediateProvider, false, 0)
+        r.loadBalancer.UpdateCallComplete(record.FinalProvider, false, 0)
+    }
     r.loadBalancer.DecrementActiveCalls(record.IntermediateProvider)
     r.loadBalancer.DecrementActiveCalls(record.FinalProvider)
+    r.decrementHopCalls(record)
     
     // Clean up
-    r.mu.Lock()
-    delete(r.activeCalls, callID)
-    r.didManager.UnregisterCallDID(record.AssignedDID)
-    r.mu.Unlock()
+    r.activeCalls.Delete(callID)
+    r.didManager.UnregisterCall(record)
+    r.unshareCall(ctx, record)
+    r.countries.Release(callID)
+    r.rateLimits.Release(callID)
+    r.testTraffic.Release(callID)
+    
+    if record.IsTest {
+        r.metrics.IncrementCounter("router_test_calls", testCallLabels(record, string(status)))
+        return
+    }
     
     r.metrics.IncrementCounter("router_calls_failed", map[string]string{
-        "route": record.RouteName,
         "reason": string(status),
+        "provider": record.InboundProvider,
+        "route": record.RouteName,
     })
 }
 
-func (r *Router) updateMetricsForNewCall(routeName string) {
-    r.metrics.IncrementCounter("router_calls_processed", map[string]string{
-        "stage": "incoming",
-        "route": routeName,
-    })
-    
-    r.mu.RLock()
-    activeCount := len(r.activeCalls)
-    r.mu.RUnlock()
+func (r *Router) updateMetricsForNewCall(record *models.CallRecord) {
+    if record.IsTest {
+        r.metrics.IncrementCounter("router_test_calls", testCallLabels(record, "started"))
+    } else {
+        r.metrics.IncrementCounter("router_calls_processed", map[string]string{
+            "stage": "incoming",
+            "route": record.RouteName,
+        })
+    }
     
-    r.metrics.SetGauge("router_active_calls", float64(activeCount), nil)
+    r.metrics.SetGauge("router_active_calls", float64(r.activeCalls.Len()), nil)
 }
 
 func (r *Router) updateMetricsForCompletedCall(record *models.CallRecord, duration time.Duration) {
+    if record.IsTest {
+        r.metrics.IncrementCounter("router_test_calls", testCallLabels(record, "completed"))
+        r.metrics.SetGauge("router_active_calls", float64(r.activeCalls.Len()), nil)
+        return
+    }
+    
     r.metrics.IncrementCounter("router_calls_completed", map[string]string{
         "route": record.RouteName,
         "intermediate": record.IntermediateProvider,
@@ -657,15 +1243,26 @@ func (r *Router) updateMetricsForCompletedCall(record *models.CallRecord, durati
         "route": record.RouteName,
     })
     
-    r.mu.RLock()
-    activeCount := len(r.activeCalls)
-    r.mu.RUnlock()
-    
-    r.metrics.SetGauge("router_active_calls", float64(activeCount), nil)
+    r.metrics.SetGauge("router_active_calls", float64(r.activeCalls.Len()), nil)
 }
 
 // Verification methods
 
+func (r *Router) checkQuarantine(providerName string) error {
+    if !r.quarantine.IsQuarantined(providerName) {
+        return nil
+    }
+    
+    r.metrics.IncrementCounter("router_calls_failed", map[string]string{
+        "reason":   "provider_quarantined",
+        "provider": providerName,
+        "route":    "",
+    })
+    
+    return errors.New(errors.ErrAuthFailed, "provider is quarantined").
+        WithContext("provider", providerName)
+}
+
 func (r *Router) verifyReturnCall(ctx context.Context, record *models.CallRecord, ani2, did, provider, sourceIP string) error {
     verification := &models.CallVerification{
         CallID:           record.CallID,
@@ -676,14 +1273,18 @@ func (r *Router) verifyReturnCall(ctx context.Context, record *models.CallRecord
         ReceivedDNIS:     did,
         SourceIP:         sourceIP,
     }
+    // Hops of a route of several intermediates may be sent another ANI
+    if record.TransformedANI != "" {
+        verification.ExpectedANI = record.TransformedANI
+    }
     
     // Verify ANI transformation
-    if ani2 != record.OriginalDNIS {
+    if ani2 != verification.ExpectedANI {
         verification.Verified = false
-        verification.FailureReason = fmt.Sprintf("ANI mismatch: expected %s, got %s", record.OriginalDNIS, ani2)
+        verification.FailureReason = fmt.Sprintf("ANI mismatch: expected %s, got %s", verification.ExpectedANI, ani2)
         r.storeVerification(ctx, verification)
         return errors.New(errors.ErrAuthFailed, "ANI verification failed").
-            WithContext("expected", record.OriginalDNIS).
+            WithContext("expected", verification.ExpectedANI).
             WithContext("received", ani2)
     }
     
@@ -711,18 +1312,18 @@ func (r *Router) verifyFinalCall(ctx context.Context, record *models.CallRecord,
     verification := &models.CallVerification{
         CallID:           record.CallID,
         VerificationStep: "S4_TO_S2",
-        ExpectedANI:      record.OriginalANI,
-        ExpectedDNIS:     record.OriginalDNIS,
+        ExpectedANI:      record.FinalANI(),
+        ExpectedDNIS:     record.FinalDNIS(),
         ReceivedANI:      ani,
         ReceivedDNIS:     dnis,
         SourceIP:         sourceIP,
     }
     
-    // Verify ANI/DNIS restoration
-    if ani != record.OriginalANI || dnis != record.OriginalDNIS {
+    // Verify ANI/DNIS restoration, after any route policy manipulation
+    if ani != verification.ExpectedANI || dnis != verification.ExpectedDNIS {
         verification.Verified = false
         verification.FailureReason = fmt.Sprintf("ANI/DNIS mismatch: expected %s/%s, got %s/%s",
-            record.OriginalANI, record.OriginalDNIS, ani, dnis)
+            verification.ExpectedANI, verification.ExpectedDNIS, ani, dnis)
         r.storeVerification(ctx, verification)
         return errors.New(errors.ErrAuthFailed, "ANI/DNIS verification failed")
     }
@@ -747,6 +1348,69 @@ func (r *Router) verifyFinalCall(ctx context.Context, record *models.CallRecord,
     return nil
 }
 
+func (r *Router) verifyCorrelationToken(ctx context.Context, record *models.CallRecord, did, token, sourceIP string) error {
+    // A leg without a token is a guess at the DID
+    if token != "" && r.correlation.Verify(record.CallID, did, token) {
+        return nil
+    }
+    
+    // Both intermediates of a parallel dial get the header bound to the first DID,
+    // DNIS suffixes are signed for the DID each target dials
+    if token != "" && did == record.ParallelDID && r.correlation.Mode() == CorrelationModeHeader &&
+        r.correlation.Verify(record.CallID, record.AssignedDID, token) {
+        return nil
+    }
+    
+    verification := &models.CallVerification{
+        CallID:           record.CallID,
+        VerificationStep: "S3_TO_S2",
+        ExpectedDNIS:     did,
+        ReceivedDNIS:     did,
+        SourceIP:         sourceIP,
+        Verified:         false,
+        FailureReason:    fmt.Sprintf("Token mismatch: invalid or missing correlation token for DID %s", did),
+    }
+    r.storeVerification(ctx, verification)
+    
+    return errors.New(errors.ErrAuthFailed, "correlation token verification failed").
+        WithContext("did", did)
+}
+
+// rejectReplay logs, records and counts a leg that was already consumed
+func (r *Router) rejectReplay(ctx context.Context, stage, callID, dnis, provider, sourceIP string) error {
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "stage":     stage,
+        "call_id":   callID,
+        "dnis":      dnis,
+        "provider":  provider,
+        "source_ip": sourceIP,
+    }).Warn("Replay attempt rejected")
+    
+    step := "S3_TO_S2"
+    if stage == "final" {
+        step = "S4_TO_S2"
+    }
+    
+    r.storeVerification(ctx, &models.CallVerification{
+        CallID:           callID,
+        VerificationStep: step,
+        ReceivedDNIS:     dnis,
+        SourceIP:         sourceIP,
+        Verified:         false,
+        FailureReason:    fmt.Sprintf("Replay detected: %s leg already consumed", stage),
+    })
+    
+    r.metrics.IncrementCounter("router_replay_attempts", map[string]string{
+        "stage":    stage,
+        "provider": provider,
+    })
+    r.quarantine.RecordFailure(ctx, provider, "replay detected")
+    
+    return errors.New(errors.ErrAuthFailed, "call leg already consumed").
+        WithContext("stage", stage).
+        WithContext("call_id", callID)
+}
+
 func (r *Router) verifySourceIP(ctx context.Context, sourceIP, providerName string, verification *models.CallVerification) error {
     expectedIP, err := r.getProviderIP(ctx, providerName)
     if err == nil && expectedIP != "" {
@@ -761,6 +1425,7 @@ func (r *Router) verifySourceIP(ctx context.Context, sourceIP, providerName stri
     return nil
 }
 
+// storeVerification queues the verification row, ordered per call
 func (r *Router) storeVerification(ctx context.Context, verification *models.CallVerification) {
     query := `
         INSERT INTO call_verifications (
@@ -769,22 +1434,22 @@ func (r *Router) storeVerification(ctx context.Context, verification *models.Cal
             verified, failure_reason
         ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
     
-    if _, err := r.db.ExecContext(ctx, query,
+    r.writer.Submit(ctx, verification.CallID, query,
         verification.CallID, verification.VerificationStep,
         verification.ExpectedANI, verification.ExpectedDNIS,
         verification.ReceivedANI, verification.ReceivedDNIS,
         verification.SourceIP, verification.ExpectedIP,
         verification.Verified, verification.FailureReason,
-    ); err != nil {
-        logger.WithContext(ctx).WithError(err).Warn("Failed to store verification record")
-    }
+    )
 }
 
 func (r *Router) getProviderIP(ctx context.Context, providerName string) (string, error) {
     var host string
-    err := r.db.QueryRowContext(ctx,
-        "SELECT host FROM providers WHERE name = ?",
-        providerName).Scan(&host)
+    err := db.Retry(ctx, "provider_ip", func() error {
+        return r.db.QueryRowContext(ctx,
+            "SELECT host FROM providers WHERE name = ?",
+            providerName).Scan(&host)
+    })
     
     if err != nil {
         return "", err
@@ -811,21 +1476,38 @@ func (r *Router) cleanupRoutine() {
     for range ticker.C {
         ctx := context.Background()
         r.cleanupStaleCalls(ctx)
+        r.replayGuard.Cleanup()
+        r.routeCache.purge()
+        r.dialCache.purge()
+        r.dispositions.purge()
+        r.groupCache.purge()
+        r.loadBalancer.providerCache.purge()
         r.didManager.CleanupStaleDIDs(ctx, r.config.StaleCallTimeout)
+        r.didManager.updatePoolMetrics(ctx)
     }
 }
 
 func (r *Router) cleanupStaleCalls(ctx context.Context) {
     log := logger.WithContext(ctx)
     
-    r.mu.Lock()
-    defer r.mu.Unlock()
+    // Calls another instance closed aren't stale
+    r.dropClosedSharedCalls(ctx)
     
     now := time.Now()
     cleaned := 0
     
-    for callID, record := range r.activeCalls {
+    // Collect first so no shard lock is held during database work
+    stale := make(map[string]*models.CallRecord)
+    r.activeCalls.Range(func(callID string, record *models.CallRecord) bool {
         if now.Sub(record.StartTime) > r.config.StaleCallTimeout {
+            stale[callID] = record
+        }
+        return true
+    })
+    
+    for callID, record := range stale {
+        // Removing the call first keeps a concurrent hangup from completing it twice
+        if r.activeCalls.Delete(callID) {
             log.WithField("call_id", callID).Warn("Cleaning up stale call")
             
             // Mark as timeout
@@ -835,23 +1517,24 @@ func (r *Router) cleanupStaleCalls(ctx context.Context) {
             record.Duration = int(now.Sub(record.StartTime).Seconds())
             
             // Update in database
-            tx, err := r.db.BeginTx(ctx, nil)
-            if err == nil {
-                r.updateCallRecord(ctx, tx, record)
-                r.didManager.ReleaseDID(ctx, tx, record.AssignedDID)
-                r.decrementRouteCalls(ctx, tx, record.RouteName)
-                tx.Commit()
+            if err := r.closeCallRecord(ctx, "stale_call", record); err != nil {
+                log.WithError(err).WithField("call_id", callID).Error("Failed to close stale call record")
             }
             
             // Update stats
-            r.loadBalancer.UpdateCallComplete(record.IntermediateProvider, false, 0)
-            r.loadBalancer.UpdateCallComplete(record.FinalProvider, false, 0)
+            if !record.IsTest {
+                r.loadBalancer.UpdateCallComplete(record.IntermediateProvider, false, 0)
+                r.loadBalancer.UpdateCallComplete(record.FinalProvider, false, 0)
+            }
             r.loadBalancer.DecrementActiveCalls(record.IntermediateProvider)
             r.loadBalancer.DecrementActiveCalls(record.FinalProvider)
+            r.decrementHopCalls(record)
             
-            // Remove from memory
-            delete(r.activeCalls, callID)
-            r.didManager.UnregisterCallDID(record.AssignedDID)
+            r.didManager.UnregisterCall(record)
+            r.unshareCall(ctx, record)
+            r.countries.Release(callID)
+            r.rateLimits.Release(callID)
+            r.testTraffic.Release(callID)
             
             cleaned++
         }
@@ -869,12 +1552,11 @@ func (r *Router) cleanupStaleCalls(ctx context.Context) {
 
 // GetStatistics returns current router statistics
 func (r *Router) GetStatistics(ctx context.Context) (map[string]interface{}, error) {
-    r.mu.RLock()
-    activeCalls := len(r.activeCalls)
-    r.mu.RUnlock()
+    activeCalls := r.activeCalls.Len()
     
     stats := map[string]interface{}{
-        "active_calls": activeCalls,
+        "active_calls":      activeCalls,
+        "active_test_calls": r.testTraffic.Active(),
     }
     
     // Get DID statistics
@@ -889,9 +1571,10 @@ func (r *Router) GetStatistics(ctx context.Context) (map[string]interface{}, err
     
     // Get route statistics
     rows, err := r.db.QueryContext(ctx, `
-        SELECT name, current_calls, max_concurrent_calls
-        FROM provider_routes
-        WHERE enabled = 1
+        SELECT pr.name, pr.current_calls, COALESCE(pr.max_concurrent_calls, rp.max_concurrent_calls, 0)
+        FROM provider_routes pr
+        LEFT JOIN route_policies rp ON rp.name = pr.policy_name
+        WHERE pr.enabled = 1
     `)
     
     if err == nil {
@@ -922,10 +1605,7 @@ func (r *Router) GetStatistics(ctx context.Context) (map[string]interface{}, err
 
 // GetActiveCall returns details of an active call
 func (r *Router) GetActiveCall(ctx context.Context, callID string) (*models.CallRecord, error) {
-    r.mu.RLock()
-    defer r.mu.RUnlock()
-    
-    record, exists := r.activeCalls[callID]
+    record, exists := r.activeCalls.Get(callID)
     if !exists {
         return nil, errors.New(errors.ErrCallNotFound, "call not found")
     }
@@ -935,23 +1615,87 @@ func (r *Router) GetActiveCall(ctx context.Context, callID string) (*models.Call
 
 // GetActiveCalls returns all active calls
 func (r *Router) GetActiveCalls(ctx context.Context) ([]*models.CallRecord, error) {
-    r.mu.RLock()
-    defer r.mu.RUnlock()
-    
-    calls := make([]*models.CallRecord, 0, len(r.activeCalls))
-    for _, record := range r.activeCalls {
+    calls := make([]*models.CallRecord, 0, r.activeCalls.Len())
+    r.activeCalls.Range(func(_ string, record *models.CallRecord) bool {
         calls = append(calls, record)
-    }
+        return true
+    })
     
     return calls, nil
 }
 
+// Close saves round-robin positions and flushes the write-behind queue
+func (r *Router) Close() {
+    r.loadBalancer.persistRoundRobin()
+    r.writer.Close()
+}
+
 // GetLoadBalancer returns the load balancer instance
 func (r *Router) GetLoadBalancer() *LoadBalancer {
     return r.loadBalancer
 }
 
+// GetBlockManager returns the destination block manager
+func (r *Router) GetBlockManager() *BlockManager {
+    return r.blocks
+}
+
+// GetKillSwitches returns the kill switch manager
+func (r *Router) GetKillSwitches() *KillSwitchManager {
+    return r.killSwitches
+}
+
+// GetAlerts returns the alert and incident manager
+func (r *Router) GetAlerts() *AlertManager {
+    return r.alerts
+}
+
+// GetFX returns the currency converter of cost reports
+func (r *Router) GetFX() *FXRates {
+    return r.fx
+}
+
+// GetAPITokens returns the customer API token manager
+func (r *Router) GetAPITokens() *APITokenManager {
+    return r.apiTokens
+}
+
+// GetCDRExports returns the scheduled customer CDR exporter
+func (r *Router) GetCDRExports() *CDRExporter {
+    return r.cdrExports
+}
+
+// GetDIDProcurement returns the DID pool watermark and order manager
+func (r *Router) GetDIDProcurement() *DIDProcurement {
+    return r.procurement
+}
+
+// GetBackups returns the routing configuration snapshot manager
+func (r *Router) GetBackups() *BackupManager {
+    return r.backups
+}
+
+// GetShortCallMonitor returns the short call ratio monitor
+func (r *Router) GetShortCallMonitor() *ShortCallMonitor {
+    return r.shortCalls
+}
+
+// GetCountryTracker returns the per destination country call tracker
+func (r *Router) GetCountryTracker() *CountryTracker {
+    return r.countries
+}
+
+// GetQuarantineManager returns the provider quarantine manager
+func (r *Router) GetQuarantineManager() *QuarantineManager {
+    return r.quarantine
+}
+
 // GetDIDManager returns the DID manager instance
 func (r *Router) GetDIDManager() *DIDManager {
     return r.didManager
 }
+
+// GetCorrelation returns the correlation token signer
+func (r *Router) GetCorrelation() *CorrelationSigner {
+    return r.correlation
+}
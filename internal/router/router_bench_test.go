@@ -0,0 +1,301 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "encoding/json"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// BenchmarkProcessIncomingCall measures the in-process cost of routing a
+// call from S1, the <1ms p99 budget of the hot path. The database answers
+// every query at once, so the numbers are the router's own work: route and
+// provider lookups, the DID allocation and the call record.
+func BenchmarkProcessIncomingCall(b *testing.B) {
+    benchLogger(b)
+    
+    b.Run("local_cache_hit", func(b *testing.B) {
+        r := newBenchRouter(b)
+        r.ProcessIncomingCall(context.Background(), "warmup", "15551230000", "15557654321", benchCustomer)
+    
+        b.ReportAllocs()
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+            callID := fmt.Sprintf("bench-hit-%d", i)
+            if _, err := r.ProcessIncomingCall(context.Background(), callID, "15551230000", "15557654321", benchCustomer); err != nil {
+                b.Fatal(err)
+            }
+        }
+    })
+    
+    // Every call finds the in-process caches empty, as after a configuration
+    // change, and reads routes and providers back from Redis
+    b.Run("local_cache_miss", func(b *testing.B) {
+        r := newBenchRouter(b)
+    
+        b.ReportAllocs()
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+            r.routeCache.clear()
+            r.loadBalancer.providerCache.clear()
+    
+            callID := fmt.Sprintf("bench-miss-%d", i)
+            if _, err := r.ProcessIncomingCall(context.Background(), callID, "15551230000", "15557654321", benchCustomer); err != nil {
+                b.Fatal(err)
+            }
+        }
+    })
+}
+
+// Budget of a call from S1 routed off warm caches, in allocations and in p99
+// latency of the router's own work. TestProcessIncomingCallBudget fails past it.
+const (
+    incomingCallAllocBudget   = 200
+    incomingCallLatencyBudget = time.Millisecond
+)
+
+func TestProcessIncomingCallBudget(t *testing.T) {
+    if raceEnabled {
+        t.Skip("the budget is that of a build without the race detector")
+    }
+    benchLogger(t)
+    r := newBenchRouter(t)
+    ctx := context.Background()
+    r.ProcessIncomingCall(ctx, "warmup", "15551230000", "15557654321", benchCustomer)
+    
+    const runs = 1000
+    callIDs := make([]string, runs+1)
+    for i := range callIDs {
+        callIDs[i] = fmt.Sprintf("budget-%d", i)
+    }
+    
+    next := 0
+    allocs := testing.AllocsPerRun(runs, func() {
+        if _, err := r.ProcessIncomingCall(ctx, callIDs[next], "15551230000", "15557654321", benchCustomer); err != nil {
+            t.Fatal(err)
+        }
+        next++
+    })
+    if allocs > incomingCallAllocBudget {
+        t.Errorf("incoming call allocates %.0f times, the budget is %d", allocs, incomingCallAllocBudget)
+    }
+    
+    latencies := make([]time.Duration, runs)
+    for i := range latencies {
+        start := time.Now()
+        if _, err := r.ProcessIncomingCall(ctx, fmt.Sprintf("budget-latency-%d", i), "15551230000", "15557654321", benchCustomer); err != nil {
+            t.Fatal(err)
+        }
+        latencies[i] = time.Since(start)
+    }
+    sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+    if p99 := latencies[runs*99/100]; p99 > incomingCallLatencyBudget {
+        t.Errorf("incoming call p99 is %s, the budget is %s", p99, incomingCallLatencyBudget)
+    }
+}
+
+const benchCustomer = "s1-customer"
+
+var benchLoggerOnce sync.Once
+
+// benchLogger keeps the router's per call log lines out of the numbers
+func benchLogger(tb testing.TB) {
+    benchLoggerOnce.Do(func() {
+        if err := logger.Init(logger.Config{Level: "error", Format: "text", Output: "stdout"}); err != nil {
+            tb.Fatal(err)
+        }
+        logger.SetOutput(io.Discard)
+    })
+}
+
+// newBenchRouter returns a router whose database and Redis answer at once,
+// with the route of benchCustomer and its providers in Redis
+func newBenchRouter(tb testing.TB) *Router {
+    db, err := sql.Open(benchDriverName, "")
+    if err != nil {
+        tb.Fatal(err)
+    }
+    tb.Cleanup(func() { db.Close() })
+    
+    cache := newBenchCache()
+    r := NewRouter(db, cache, benchMetrics{}, Config{
+        CallCleanupInterval: time.Minute,
+        HotCacheTTL:         time.Minute,
+        GroupCacheTTL:       time.Minute,
+        StaleCallTimeout:    time.Hour,
+    })
+    
+    ctx := context.Background()
+    route := &models.ProviderRoute{
+        ID:                   1,
+        Name:                 "bench-route",
+        InboundProvider:      benchCustomer,
+        IntermediateProvider: "s3-intermediate",
+        FinalProvider:        "s4-final",
+        LoadBalanceMode:      models.LoadBalanceModeRoundRobin,
+        Enabled:              true,
+        MatchedBy:            string(models.InboundMatchExact),
+    }
+    cache.Set(ctx, "route:inbound:"+benchCustomer, route, time.Hour)
+    for _, name := range []string{route.IntermediateProvider, route.FinalProvider} {
+        cache.Set(ctx, "providers:"+name, []*models.Provider{{
+            ID:           len(name),
+            Name:         name,
+            Type:         models.ProviderTypeIntermediate,
+            Host:         "192.0.2.10",
+            Port:         5060,
+            Active:       true,
+            HealthStatus: "healthy",
+        }}, time.Hour)
+    }
+    return r
+}
+
+// benchCache is an in-memory stand-in for Redis, values go through JSON as
+// they would over the wire
+type benchCache struct {
+    mu     sync.RWMutex
+    values map[string][]byte
+}
+
+func newBenchCache() *benchCache {
+    return &benchCache{values: make(map[string][]byte)}
+}
+
+func (c *benchCache) Get(ctx context.Context, key string, dest interface{}) error {
+    c.mu.RLock()
+    data, ok := c.values[key]
+    c.mu.RUnlock()
+    if !ok {
+        return errors.New(errors.ErrRedis, "cache miss")
+    }
+    return json.Unmarshal(data, dest)
+}
+
+func (c *benchCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+    data, err := json.Marshal(value)
+    if err != nil {
+        return err
+    }
+    c.mu.Lock()
+    c.values[key] = data
+    c.mu.Unlock()
+    return nil
+}
+
+func (c *benchCache) Delete(ctx context.Context, keys ...string) error {
+    c.mu.Lock()
+    for _, key := range keys {
+        delete(c.values, key)
+    }
+    c.mu.Unlock()
+    return nil
+}
+
+func (c *benchCache) Invalidate(ctx context.Context, keys ...string) error {
+    return c.Delete(ctx, keys...)
+}
+
+func (c *benchCache) Flush(ctx context.Context, namespaces ...string) ([]string, error) {
+    c.mu.Lock()
+    for key := range c.values {
+        for _, ns := range namespaces {
+            if strings.HasPrefix(key, ns+":") {
+                delete(c.values, key)
+            }
+        }
+    }
+    c.mu.Unlock()
+    return namespaces, nil
+}
+
+func (c *benchCache) OnInvalidate(fn func(keys []string)) {}
+
+func (c *benchCache) Lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+    return func() {}, nil
+}
+
+// benchMetrics drops every metric
+type benchMetrics struct{}
+
+func (benchMetrics) IncrementCounter(name string, labels map[string]string)                {}
+func (benchMetrics) ObserveHistogram(name string, value float64, labels map[string]string) {}
+func (benchMetrics) SetGauge(name string, value float64, labels map[string]string)         {}
+
+// benchDriver is a database answering every query at once: DID lookups with
+// a fresh number, other queries with no rows and writes with one row affected
+const benchDriverName = "router-bench"
+
+var benchDIDs uint64
+
+func init() {
+    sql.Register(benchDriverName, benchDriver{})
+}
+
+type benchDriver struct{}
+
+func (benchDriver) Open(name string) (driver.Conn, error) { return benchConn{}, nil }
+
+type benchConn struct{}
+
+func (benchConn) Prepare(query string) (driver.Stmt, error) { return benchStmt{query: query}, nil }
+func (benchConn) Close() error                              { return nil }
+func (benchConn) Begin() (driver.Tx, error)                 { return benchTx{}, nil }
+
+func (benchConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    return benchQuery(query), nil
+}
+
+func (benchConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+    return driver.RowsAffected(1), nil
+}
+
+type benchStmt struct{ query string }
+
+func (benchStmt) Close() error  { return nil }
+func (benchStmt) NumInput() int { return -1 }
+
+func (benchStmt) Exec(args []driver.Value) (driver.Result, error)  { return driver.RowsAffected(1), nil }
+func (s benchStmt) Query(args []driver.Value) (driver.Rows, error) { return benchQuery(s.query), nil }
+
+type benchTx struct{}
+
+func (benchTx) Commit() error   { return nil }
+func (benchTx) Rollback() error { return nil }
+
+func benchQuery(query string) driver.Rows {
+    if strings.Contains(query, "SELECT number") && strings.Contains(query, "FROM dids") {
+        did := fmt.Sprintf("1555%07d", atomic.AddUint64(&benchDIDs, 1))
+        return &benchRows{columns: []string{"number"}, values: [][]driver.Value{{did}}}
+    }
+    return &benchRows{}
+}
+
+type benchRows struct {
+    columns []string
+    values  [][]driver.Value
+}
+
+func (r *benchRows) Columns() []string { return r.columns }
+func (r *benchRows) Close() error      { return nil }
+
+func (r *benchRows) Next(dest []driver.Value) error {
+    if len(r.values) == 0 {
+        return io.EOF
+    }
+    copy(dest, r.values[0])
+    r.values = r.values[1:]
+    return nil
+}
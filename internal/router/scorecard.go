@@ -0,0 +1,280 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "math"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// ScorecardConfig controls how provider scorecards weigh their metrics
+type ScorecardConfig struct {
+    Weights map[string]float64 // by metric, DefaultScorecardWeights for those missing
+}
+
+// DefaultScorecardWeights weigh quality over compliance and cost
+var DefaultScorecardWeights = map[string]float64{
+    models.ScoreASR:          25,
+    models.ScoreACD:          15,
+    models.ScorePDD:          15,
+    models.ScoreMOS:          15,
+    models.ScoreVerification: 10,
+    models.ScoreSLA:          10,
+    models.ScoreCost:         10,
+}
+
+// scoreRange maps a metric value linearly onto a score, bad scores 0 and
+// good 100, values beyond either end are clamped
+type scoreRange struct {
+    bad  float64
+    good float64
+}
+
+var scorecardRanges = map[string]scoreRange{
+    models.ScoreASR:          {bad: 20, good: 60},     // percent answered
+    models.ScoreACD:          {bad: 30, good: 180},    // seconds per answered call
+    models.ScorePDD:          {bad: 8000, good: 2000}, // milliseconds
+    models.ScoreMOS:          {bad: 3.0, good: 4.3},
+    models.ScoreVerification: {bad: 5, good: 0}, // percent of verifications failed
+    models.ScoreSLA:          {bad: 3, good: 0}, // breaches
+}
+
+func (rng scoreRange) score(value float64) float64 {
+    score := (value - rng.bad) / (rng.good - rng.bad) * 100
+    return math.Max(0, math.Min(100, score))
+}
+
+// ProviderScorecard scores a provider over the period up to now, with the
+// period before it for the trend. Metrics without data are left out and the
+// weights of the others scaled up. Cost is the provider's current rate
+// against active providers of the same type, so it has no trend.
+func (r *Router) ProviderScorecard(ctx context.Context, name string, period time.Duration) (*models.ProviderScorecard, error) {
+    if period <= 0 {
+        return nil, errors.New(errors.ErrInternal, "scorecard period must be positive")
+    }
+
+    card := &models.ProviderScorecard{ProviderName: name, Currency: r.fx.Currency()}
+    var rate float64
+    var currency string
+    err := r.db.QueryRowContext(ctx,
+        "SELECT type, cost_per_minute, COALESCE(currency, '') FROM providers WHERE name = ?",
+        name).Scan(&card.Type, &rate, &currency)
+    if err == sql.ErrNoRows {
+        return nil, errors.New(errors.ErrProviderNotFound, "provider not found").WithContext("provider", name)
+    }
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to get provider")
+    }
+
+    card.Until = time.Now()
+    card.Since = card.Until.Add(-period)
+
+    current, err := r.scorecardValues(ctx, name, card.Since, card.Until, &card.Calls)
+    if err != nil {
+        return nil, err
+    }
+    previous, err := r.scorecardValues(ctx, name, card.Since.Add(-period), card.Since, &card.PreviousCalls)
+    if err != nil {
+        return nil, err
+    }
+
+    cost, costScore, err := r.scorecardCost(ctx, card.Type, r.fx.Convert(ctx, rate, currency))
+    if err != nil {
+        return nil, err
+    }
+
+    for _, metric := range models.ScorecardMetrics {
+        weight, ok := r.config.Scorecard.Weights[metric]
+        if !ok {
+            weight = DefaultScorecardWeights[metric]
+        }
+        m := models.ScorecardMetric{Name: metric, Weight: weight}
+        if metric == models.ScoreCost {
+            m.Value, m.Score = &cost, &costScore
+        } else {
+            m.Value, m.Score = current[metric], scoreValue(metric, current[metric])
+            m.PreviousValue, m.PreviousScore = previous[metric], scoreValue(metric, previous[metric])
+        }
+        card.Metrics = append(card.Metrics, m)
+    }
+
+    card.Score = weightedScore(card.Metrics, func(m *models.ScorecardMetric) *float64 { return m.Score })
+    if weightedScore(card.Metrics, func(m *models.ScorecardMetric) *float64 { return m.PreviousScore }) != nil {
+        card.PreviousScore = weightedScore(card.Metrics, func(m *models.ScorecardMetric) *float64 {
+            if m.Name == models.ScoreCost {
+                // The same in both periods, so it doesn't move the trend
+                return m.Score
+            }
+            return m.PreviousScore
+        })
+    }
+
+    rel, err := r.ProviderReliability(ctx, card.Since, card.Until, name)
+    if err != nil {
+        return nil, err
+    }
+    card.Reliability = rel[name]
+    return card, nil
+}
+
+// scorecardValues measures the provider from start to end, nil for the
+// metrics nothing was measured for
+func (r *Router) scorecardValues(ctx context.Context, name string, start, end time.Time, calls *int64) (map[string]*float64, error) {
+    values := make(map[string]*float64)
+
+    var answered int64
+    var acd, pdd, mos sql.NullFloat64
+    err := r.db.QueryRowContext(ctx, `
+        SELECT COUNT(*), COALESCE(SUM(answered), 0),
+               AVG(CASE WHEN answered THEN seconds END),
+               AVG(CASE WHEN answered THEN pdd END),
+               AVG(NULLIF(mos, 0))
+        FROM (
+            SELECT answer_time IS NOT NULL AS answered, answer_delay_ms AS pdd, quality_score AS mos,
+                   CASE
+                       WHEN final_provider = ? THEN final_billable_duration
+                       WHEN intermediate_provider = ? THEN intermediate_billable_duration
+                       ELSE billable_duration
+                   END AS seconds
+            FROM call_records
+            WHERE start_time >= ? AND start_time < ? AND COALESCE(is_test, 0) = 0
+              AND ? IN (inbound_provider, intermediate_provider, final_provider)
+        ) legs`,
+        name, name, start, end, name).Scan(calls, &answered, &acd, &pdd, &mos)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query scorecard call statistics")
+    }
+    if *calls > 0 {
+        asr := float64(answered) / float64(*calls) * 100
+        values[models.ScoreASR] = &asr
+    }
+    values[models.ScoreACD] = nullFloat(acd)
+    values[models.ScorePDD] = nullFloat(pdd)
+    values[models.ScoreMOS] = nullFloat(mos)
+
+    var total, failed int64
+    err = r.db.QueryRowContext(ctx, `
+        SELECT COUNT(*), COALESCE(SUM(CASE WHEN cv.verified = 0 THEN 1 ELSE 0 END), 0)
+        FROM call_verifications cv
+        LEFT JOIN call_records cr ON cr.call_id = cv.call_id
+        WHERE cv.created_at >= ? AND cv.created_at < ? AND `+verificationProviderExpr+` = ?`,
+        start, end, name).Scan(&total, &failed)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query scorecard verifications")
+    }
+    if total > 0 {
+        rate := failureRate(total, failed)
+        values[models.ScoreVerification] = &rate
+    }
+
+    if values[models.ScoreSLA], err = r.scorecardSLABreaches(ctx, name, start, end); err != nil {
+        return nil, err
+    }
+    return values, nil
+}
+
+// scorecardSLABreaches counts the SLA breaches of the months overlapping start
+// to end, nil when the provider has no SLA. Months without a stored report,
+// such as the running one, are measured.
+func (r *Router) scorecardSLABreaches(ctx context.Context, name string, start, end time.Time) (*float64, error) {
+    if _, err := r.GetSLA(ctx, name); err != nil {
+        if errors.GetCode(err) == string(errors.ErrProviderNotFound) {
+            return nil, nil
+        }
+        return nil, err
+    }
+
+    stored, err := r.ListSLAReports(ctx, name, "")
+    if err != nil {
+        return nil, err
+    }
+    byMonth := make(map[string]*models.SLAReport, len(stored))
+    for _, report := range stored {
+        byMonth[report.Month] = report
+    }
+
+    var breaches float64
+    for month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.Local); month.Before(end); month = month.AddDate(0, 1, 0) {
+        report := byMonth[month.Format(slaMonthFormat)]
+        if report == nil {
+            reports, err := r.BuildSLAReports(ctx, month, name)
+            if err != nil {
+                return nil, err
+            }
+            if len(reports) == 0 {
+                continue
+            }
+            report = reports[0]
+        }
+        breaches += float64(len(report.Breaches))
+    }
+    return &breaches, nil
+}
+
+// scorecardCost scores a per minute rate against the active providers of the
+// same type, the cheapest scoring 100 and the dearest 0
+func (r *Router) scorecardCost(ctx context.Context, providerType models.ProviderType, rate float64) (float64, float64, error) {
+    rows, err := r.db.QueryContext(ctx,
+        "SELECT cost_per_minute, COALESCE(currency, '') FROM providers WHERE type = ? AND active = 1",
+        providerType)
+    if err != nil {
+        return 0, 0, errors.Wrap(err, errors.ErrDatabase, "failed to query provider rates")
+    }
+    defer rows.Close()
+
+    cheapest, dearest := rate, rate
+    for rows.Next() {
+        var peer float64
+        var currency string
+        if err := rows.Scan(&peer, &currency); err != nil {
+            continue
+        }
+        peer = r.fx.Convert(ctx, peer, currency)
+        cheapest = math.Min(cheapest, peer)
+        dearest = math.Max(dearest, peer)
+    }
+    if err := rows.Err(); err != nil {
+        return 0, 0, errors.Wrap(err, errors.ErrDatabase, "failed to read provider rates")
+    }
+
+    if dearest == cheapest {
+        return rate, 100, nil
+    }
+    return rate, (dearest - rate) / (dearest - cheapest) * 100, nil
+}
+
+func scoreValue(metric string, value *float64) *float64 {
+    if value == nil {
+        return nil
+    }
+    score := scorecardRanges[metric].score(*value)
+    return &score
+}
+
+// weightedScore averages the scores by weight, nil when no metric is scored
+func weightedScore(metrics []models.ScorecardMetric, score func(*models.ScorecardMetric) *float64) *float64 {
+    var sum, weights float64
+    for i := range metrics {
+        s := score(&metrics[i])
+        if s == nil || metrics[i].Weight <= 0 {
+            continue
+        }
+        sum += *s * metrics[i].Weight
+        weights += metrics[i].Weight
+    }
+    if weights == 0 {
+        return nil
+    }
+    total := sum / weights
+    return &total
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+    if !v.Valid {
+        return nil
+    }
+    return &v.Float64
+}
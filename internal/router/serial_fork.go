@@ -0,0 +1,74 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "strconv"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// SerialForkConfig controls the intermediates handed to the dialplan with a
+// new call, dialed in turn when the one before doesn't take it
+type SerialForkConfig struct {
+    Enabled bool
+    Hops    int // intermediates tried after the first one, at most
+}
+
+// forkHops picks the intermediates a new call is dialed on in turn after the
+// first one and allocates each a DID of its own. A leg whose dial options
+// limit its attempts gets no more hops than those; providers without a free
+// DID are left out.
+func (r *Router) forkHops(ctx context.Context, tx *sql.Tx, route *models.ProviderRoute,
+    first *models.Provider, dnis string) []models.ForkHop {
+    hops := r.config.SerialFork.Hops
+    if attempts := r.dialTarget(ctx, first.Name).options.Merge(route.DialOptions).MaxAttempts; attempts > 0 && attempts-1 < hops {
+        hops = attempts - 1
+    }
+
+    var fork []models.ForkHop
+    tried := []string{first.Name}
+    for len(fork) < hops {
+        candidates, err := r.remainingProviders(ctx, route, route.IntermediateProvider, route.IntermediateIsGroup, tried)
+        if err != nil || len(candidates) == 0 {
+            break
+        }
+        next, err := r.loadBalancer.SelectFromProviders(ctx, "fork:"+route.IntermediateProvider,
+            r.weighRoute(route.Name, candidates), route.LoadBalanceMode)
+        if err != nil {
+            break
+        }
+        tried = append(tried, next.Name)
+
+        did, err := r.didManager.AllocateDID(ctx, tx, next.Name, dnis, route.IsTest)
+        if err != nil {
+            logger.WithContext(ctx).WithError(err).WithFields(map[string]interface{}{
+                "route":    route.Name,
+                "provider": next.Name,
+            }).Debug("No DID for an intermediate of the serial fork, leaving it out")
+            continue
+        }
+        fork = append(fork, models.ForkHop{Provider: next.Name, DID: did})
+    }
+    return fork
+}
+
+// addForkHops hands the dialplan the legs of the serial fork, each with the
+// Dial of its intermediate and a token of its own DID
+func (r *Router) addForkHops(ctx context.Context, response *models.CallResponse, callID, ani2 string,
+    fork []models.ForkHop, options *models.DialOptions) {
+    for _, hop := range fork {
+        response.ForkHops = append(response.ForkHops,
+            r.intermediateLeg(ctx, callID, ani2, hop.DID, hop.Provider, options))
+    }
+}
+
+// countSerialFork counts the hop of a serial fork that took the call, 0 for
+// the intermediate dialed first
+func (r *Router) countSerialFork(route string, hop int) {
+    r.metrics.IncrementCounter("router_serial_fork", map[string]string{
+        "route": route,
+        "hop":   strconv.Itoa(hop),
+    })
+}
@@ -0,0 +1,353 @@
+package router
+
+import (
+    "context"
+    "encoding/json"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// SharedCallConfig controls keeping the active calls in Redis, so that AGI
+// instances behind a load balancer can each take any leg of a call
+type SharedCallConfig struct {
+    Enabled    bool
+    TTL        time.Duration // a call is dropped from Redis this long after its last update, at least StaleCallTimeout
+    MaxRetries int           // attempts of a write that lost a race with another instance
+}
+
+// sharedStore is the Redis access shared calls need, the cache provides it
+type sharedStore interface {
+    Get(ctx context.Context, key string, dest interface{}) error
+    Update(ctx context.Context, key string, ttl time.Duration, retries int, fn func(current []byte) ([]byte, error)) error
+    Exists(ctx context.Context, keys ...string) ([]bool, error)
+}
+
+// errSharedCallChanged is returned when another instance updated a call since
+// this one loaded it
+var errSharedCallChanged = errors.New(errors.ErrInternal, "call changed on another instance")
+
+// sharedCall is a call as kept in Redis. Its version goes up with every
+// write; an instance holding an older one reloads the call before using it.
+type sharedCall struct {
+    Version int64              `json:"version"`
+    Node    string             `json:"node"` // the instance that wrote it last
+    Record  *models.CallRecord `json:"record"`
+}
+
+// sharedCalls tracks the versions of the calls held in memory. A call without
+// a version never made it to Redis and is only known to this instance.
+type sharedCalls struct {
+    store  sharedStore
+    config SharedCallConfig
+
+    mu       sync.Mutex
+    versions map[string]int64
+}
+
+func newSharedCalls(store sharedStore, config SharedCallConfig, staleTimeout time.Duration) *sharedCalls {
+    // Expiring sooner would have other instances take the call for closed
+    if config.TTL < staleTimeout {
+        config.TTL = staleTimeout
+    }
+    if config.MaxRetries <= 0 {
+        config.MaxRetries = 5
+    }
+
+    return &sharedCalls{
+        store:    store,
+        config:   config,
+        versions: make(map[string]int64),
+    }
+}
+
+func sharedCallKey(callID string) string {
+    return "call:" + callID
+}
+
+func sharedDIDKey(did string) string {
+    return "call:did:" + did
+}
+
+func (sc *sharedCalls) version(callID string) (int64, bool) {
+    sc.mu.Lock()
+    defer sc.mu.Unlock()
+    v, ok := sc.versions[callID]
+    return v, ok
+}
+
+func (sc *sharedCalls) setVersion(callID string, version int64) {
+    sc.mu.Lock()
+    sc.versions[callID] = version
+    sc.mu.Unlock()
+}
+
+func (sc *sharedCalls) forget(callID string) {
+    sc.mu.Lock()
+    delete(sc.versions, callID)
+    sc.mu.Unlock()
+}
+
+// shareCall puts a new call and its DID in Redis. Without Redis the call
+// stays known to this instance only.
+func (r *Router) shareCall(ctx context.Context, record *models.CallRecord) {
+    if r.shared == nil {
+        return
+    }
+
+    data, err := json.Marshal(&sharedCall{Version: 1, Node: r.config.NodeID, Record: record})
+    if err != nil {
+        return
+    }
+    err = r.shared.store.Update(ctx, sharedCallKey(record.CallID), r.shared.config.TTL, r.shared.config.MaxRetries,
+        func([]byte) ([]byte, error) { return data, nil })
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).WithField("call_id", record.CallID).Warn("Failed to share call, other instances won't find it")
+        r.metrics.IncrementCounter("router_shared_calls", map[string]string{"event": "write_failed"})
+        return
+    }
+    r.shared.setVersion(record.CallID, 1)
+    r.shareCallDID(ctx, record.AssignedDID, record.CallID)
+    for _, leg := range record.PendingLegs() {
+        r.shareCallDID(ctx, leg.AssignedDID, record.CallID)
+    }
+    for _, hop := range record.HopLegs {
+        r.shareCallDID(ctx, hop.DID, record.CallID)
+    }
+}
+
+// shareCallDID maps a DID to its call in Redis
+func (r *Router) shareCallDID(ctx context.Context, did, callID string) {
+    if r.shared == nil || did == "" {
+        return
+    }
+
+    data, _ := json.Marshal(callID)
+    err := r.shared.store.Update(ctx, sharedDIDKey(did), r.shared.config.TTL, r.shared.config.MaxRetries,
+        func([]byte) ([]byte, error) { return data, nil })
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).WithField("did", did).Warn("Failed to share DID of call")
+    }
+}
+
+// unshareCallDID removes a DID's mapping, unless it already maps to another call
+func (r *Router) unshareCallDID(ctx context.Context, did, callID string) {
+    if r.shared == nil || did == "" {
+        return
+    }
+
+    err := r.shared.store.Update(ctx, sharedDIDKey(did), r.shared.config.TTL, r.shared.config.MaxRetries,
+        func(current []byte) ([]byte, error) {
+            var owner string
+            if current != nil && json.Unmarshal(current, &owner) == nil && owner != callID {
+                return current, nil
+            }
+            return nil, nil
+        })
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).WithField("did", did).Warn("Failed to remove shared DID of call")
+    }
+}
+
+// unshareCallDIDs removes the mappings of the call's DID and of the DIDs of
+// its pending legs and hops
+func (r *Router) unshareCallDIDs(ctx context.Context, record *models.CallRecord) {
+    r.unshareCallDID(ctx, record.AssignedDID, record.CallID)
+    for _, leg := range record.PendingLegs() {
+        r.unshareCallDID(ctx, leg.AssignedDID, record.CallID)
+    }
+    for _, hop := range record.HopLegs {
+        r.unshareCallDID(ctx, hop.DID, record.CallID)
+    }
+}
+
+// syncSharedCall writes the call as held in memory to Redis. When another
+// instance updated the call since this one loaded it, nothing is written, the
+// call in memory is reloaded and errSharedCallChanged returned. Redis failures
+// are logged and leave the call to this instance.
+func (r *Router) syncSharedCall(ctx context.Context, callID string) error {
+    if r.shared == nil {
+        return nil
+    }
+    expected, ok := r.shared.version(callID)
+    if !ok {
+        return nil
+    }
+
+    var snapshot models.CallRecord
+    if !r.activeCalls.Update(callID, func(record *models.CallRecord) { snapshot = *record }) {
+        return nil
+    }
+
+    err := r.shared.store.Update(ctx, sharedCallKey(callID), r.shared.config.TTL, r.shared.config.MaxRetries,
+        func(current []byte) ([]byte, error) {
+            var call sharedCall
+            if current == nil || json.Unmarshal(current, &call) != nil || call.Version != expected {
+                return nil, errSharedCallChanged
+            }
+            return json.Marshal(&sharedCall{Version: expected + 1, Node: r.config.NodeID, Record: &snapshot})
+        })
+    switch {
+    case err == errSharedCallChanged:
+        r.metrics.IncrementCounter("router_shared_calls", map[string]string{"event": "conflict"})
+        r.sharedCallRecord(ctx, callID)
+        return err
+    case err != nil:
+        logger.WithContext(ctx).WithError(err).WithField("call_id", callID).Warn("Failed to share call update")
+        r.metrics.IncrementCounter("router_shared_calls", map[string]string{"event": "write_failed"})
+        return nil
+    }
+    r.shared.setVersion(callID, expected+1)
+    return nil
+}
+
+// unshareCall removes a closed call and its DID from Redis
+func (r *Router) unshareCall(ctx context.Context, record *models.CallRecord) {
+    if r.shared == nil {
+        return
+    }
+    r.shared.forget(record.CallID)
+
+    err := r.shared.store.Update(ctx, sharedCallKey(record.CallID), r.shared.config.TTL, r.shared.config.MaxRetries,
+        func([]byte) ([]byte, error) { return nil, nil })
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).WithField("call_id", record.CallID).Warn("Failed to remove shared call")
+    }
+    r.unshareCallDIDs(ctx, record)
+}
+
+// lookupCallIDByDID finds the call a DID was assigned to, on any instance
+func (r *Router) lookupCallIDByDID(ctx context.Context, did string) string {
+    if callID := r.didManager.GetCallIDByDID(did); callID != "" || r.shared == nil {
+        return callID
+    }
+
+    var callID string
+    if r.shared.store.Get(ctx, sharedDIDKey(did), &callID) != nil {
+        return ""
+    }
+    return callID
+}
+
+// sharedCallRecord returns an active call, from memory unless another
+// instance routed it or updated it since this one last saw it. A call held in
+// memory that is gone from Redis was closed by another instance and is
+// dropped.
+func (r *Router) sharedCallRecord(ctx context.Context, callID string) (*models.CallRecord, bool) {
+    local, exists := r.activeCalls.Get(callID)
+    if r.shared == nil {
+        return local, exists
+    }
+
+    var call sharedCall
+    if err := r.shared.store.Get(ctx, sharedCallKey(callID), &call); err != nil || call.Record == nil {
+        // A miss also stands in for Redis failing, only a known call may be closed
+        if _, known := r.shared.version(callID); exists && known {
+            if found, err := r.shared.store.Exists(ctx, sharedCallKey(callID)); err == nil && !found[0] {
+                r.dropSharedCall(ctx, callID)
+                return nil, false
+            }
+        }
+        return local, exists
+    }
+
+    version, _ := r.shared.version(callID)
+    switch {
+    case exists && version >= call.Version:
+        return local, true
+    case exists:
+        r.activeCalls.Update(callID, func(record *models.CallRecord) { *record = *call.Record })
+        r.shared.setVersion(callID, call.Version)
+        r.metrics.IncrementCounter("router_shared_calls", map[string]string{"event": "reloaded"})
+        return local, true
+    }
+
+    // Routed by another instance, this one carries the call on from here
+    record := call.Record
+    r.activeCalls.Set(callID, record)
+    r.shared.setVersion(callID, call.Version)
+    if record.AssignedDID != "" {
+        r.didManager.RegisterCallDID(record.AssignedDID, callID)
+    }
+    for _, leg := range record.PendingLegs() {
+        r.didManager.RegisterCallDID(leg.AssignedDID, callID)
+    }
+    for _, hop := range record.HopLegs {
+        r.didManager.RegisterCallDID(hop.DID, callID)
+        if hop.ReturnedAt != nil {
+            r.replayGuard.Consume(returnLegKey(hop.DID), callID)
+        }
+    }
+    r.loadBalancer.IncrementActiveCalls(record.IntermediateProvider)
+    r.loadBalancer.IncrementActiveCalls(record.FinalProvider)
+    r.incrementHopCalls(record)
+    switch record.Status {
+    case models.CallStatusReturnedFromS3, models.CallStatusRoutingToS4:
+        if record.AssignedDID != "" {
+            r.replayGuard.Consume(returnLegKey(record.AssignedDID), callID)
+        }
+    }
+
+    r.metrics.IncrementCounter("router_shared_calls", map[string]string{"event": "adopted"})
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "call_id": callID,
+        "node":    call.Node,
+        "status":  record.Status,
+    }).Info("Took over call from another instance")
+    return record, true
+}
+
+// dropSharedCall forgets a call another instance closed, without touching
+// its call record
+func (r *Router) dropSharedCall(ctx context.Context, callID string) {
+    record, exists := r.activeCalls.Get(callID)
+    r.shared.forget(callID)
+    if !exists || !r.activeCalls.Delete(callID) {
+        return
+    }
+
+    r.loadBalancer.DecrementActiveCalls(record.IntermediateProvider)
+    r.loadBalancer.DecrementActiveCalls(record.FinalProvider)
+    r.decrementHopCalls(record)
+    r.didManager.UnregisterCall(record)
+    r.countries.Release(callID)
+    r.rateLimits.Release(callID)
+    r.testTraffic.Release(callID)
+
+    r.metrics.IncrementCounter("router_shared_calls", map[string]string{"event": "dropped"})
+    logger.WithContext(ctx).WithField("call_id", callID).Debug("Dropped call closed by another instance")
+}
+
+// dropClosedSharedCalls drops the calls held in memory that another instance
+// closed since
+func (r *Router) dropClosedSharedCalls(ctx context.Context) {
+    if r.shared == nil {
+        return
+    }
+
+    var ids, keys []string
+    r.activeCalls.Range(func(callID string, _ *models.CallRecord) bool {
+        if _, known := r.shared.version(callID); known {
+            ids = append(ids, callID)
+            keys = append(keys, sharedCallKey(callID))
+        }
+        return true
+    })
+    if len(ids) == 0 {
+        return
+    }
+
+    found, err := r.shared.store.Exists(ctx, keys...)
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to check shared calls")
+        return
+    }
+    for i, callID := range ids {
+        if !found[i] {
+            r.dropSharedCall(ctx, callID)
+        }
+    }
+}
@@ -0,0 +1,313 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "math"
+    "math/rand"
+    "sort"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// ShortCallConfig controls short call ratio tracking
+type ShortCallConfig struct {
+    Enabled        bool
+    Threshold      time.Duration // answered calls shorter than this are short
+    Window         time.Duration // answered calls the ratio is computed over
+    Interval       time.Duration // how often ratios are recomputed
+    MinCalls       int           // answered calls needed before a limit applies
+    ThrottleFactor float64       // share of its normal traffic a throttled provider keeps
+}
+
+// ShortCallMonitor tracks the share of short answered calls per inbound
+// customer and outbound provider and applies provider_short_call_limits.
+// Each router instance evaluates on its own, throttling is local like the
+// load balancer state.
+type ShortCallMonitor struct {
+    db      *sql.DB
+    metrics MetricsInterface
+    lb      *LoadBalancer
+    config  ShortCallConfig
+
+    mu        sync.RWMutex
+    stats     []*models.ShortCallStats
+    exceeded  map[string]bool    // by direction and provider
+    throttled map[string]float64 // inbound customers
+}
+
+// NewShortCallMonitor creates a monitor and starts its evaluation routine when enabled
+func NewShortCallMonitor(db *sql.DB, metrics MetricsInterface, lb *LoadBalancer, config ShortCallConfig) *ShortCallMonitor {
+    if config.Threshold <= 0 {
+        config.Threshold = 6 * time.Second
+    }
+    if config.Window <= 0 {
+        config.Window = time.Hour
+    }
+    if config.Interval <= 0 {
+        config.Interval = 5 * time.Minute
+    }
+    if config.MinCalls <= 0 {
+        config.MinCalls = 20
+    }
+    if config.ThrottleFactor <= 0 || config.ThrottleFactor > 1 {
+        config.ThrottleFactor = 0.5
+    }
+
+    sm := &ShortCallMonitor{
+        db:        db,
+        metrics:   metrics,
+        lb:        lb,
+        config:    config,
+        exceeded:  make(map[string]bool),
+        throttled: make(map[string]float64),
+    }
+
+    if config.Enabled {
+        go sm.evaluateRoutine()
+    }
+
+    return sm
+}
+
+// Admit reports whether a new call from the inbound customer may proceed,
+// throttled customers only get ThrottleFactor of their calls through
+func (sm *ShortCallMonitor) Admit(inboundProvider string) bool {
+    sm.mu.RLock()
+    factor, throttled := sm.throttled[inboundProvider]
+    sm.mu.RUnlock()
+
+    return !throttled || rand.Float64() < factor
+}
+
+// Stats returns the ratios of the last evaluation
+func (sm *ShortCallMonitor) Stats() []*models.ShortCallStats {
+    sm.mu.RLock()
+    defer sm.mu.RUnlock()
+
+    return sm.stats
+}
+
+// Compute returns the short call ratios over the window without acting on them
+func (sm *ShortCallMonitor) Compute(ctx context.Context) ([]*models.ShortCallStats, error) {
+    limits, err := sm.limitsByProvider(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    since := time.Now().Add(-sm.config.Window)
+    threshold := int(sm.config.Threshold.Seconds())
+
+    // A call counts for its customer and for each outbound provider it went through
+    rows, err := sm.db.QueryContext(ctx, `
+        SELECT direction, provider, COUNT(*), COALESCE(SUM(duration < ?), 0)
+        FROM (
+            SELECT 'inbound' AS direction, inbound_provider AS provider, duration
+            FROM call_records
+            WHERE start_time >= ? AND answer_time IS NOT NULL AND COALESCE(is_test, 0) = 0
+              AND COALESCE(inbound_provider, '') <> ''
+            UNION ALL
+            SELECT 'outbound', intermediate_provider, duration
+            FROM call_records
+            WHERE start_time >= ? AND answer_time IS NOT NULL AND COALESCE(is_test, 0) = 0
+              AND COALESCE(intermediate_provider, '') <> ''
+            UNION ALL
+            SELECT 'outbound', final_provider, duration
+            FROM call_records
+            WHERE start_time >= ? AND answer_time IS NOT NULL AND COALESCE(is_test, 0) = 0
+              AND COALESCE(final_provider, '') <> ''
+        ) answered
+        GROUP BY direction, provider`,
+        threshold, since, since, since)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query answered calls")
+    }
+    defer rows.Close()
+
+    var stats []*models.ShortCallStats
+    for rows.Next() {
+        s := &models.ShortCallStats{}
+        if err := rows.Scan(&s.Direction, &s.ProviderName, &s.AnsweredCalls, &s.ShortCalls); err != nil {
+            return nil, errors.Wrap(err, errors.ErrDatabase, "failed to scan answered calls")
+        }
+        if s.AnsweredCalls > 0 {
+            s.Ratio = math.Round(float64(s.ShortCalls)/float64(s.AnsweredCalls)*10000) / 100
+        }
+        if limit, exists := limits[s.ProviderName]; exists {
+            s.MaxRatio = limit.MaxRatio
+            s.Action = limit.Action
+            s.Exceeded = s.AnsweredCalls >= sm.config.MinCalls && s.Ratio > limit.MaxRatio
+            s.Throttled = s.Exceeded && limit.Action == models.ShortCallActionThrottle
+        }
+        stats = append(stats, s)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read answered calls")
+    }
+
+    sort.Slice(stats, func(i, j int) bool {
+        if stats[i].Ratio != stats[j].Ratio {
+            return stats[i].Ratio > stats[j].Ratio
+        }
+        return stats[i].ProviderName < stats[j].ProviderName
+    })
+
+    return stats, nil
+}
+
+// Evaluate recomputes the ratios, alerts on providers over their limit and
+// throttles those whose limit says so: inbound customers have new calls
+// rejected, outbound providers get less traffic from the load balancer
+func (sm *ShortCallMonitor) Evaluate(ctx context.Context) ([]*models.ShortCallStats, error) {
+    stats, err := sm.Compute(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    exceeded := make(map[string]bool)
+    throttled := make(map[string]float64)
+    caps := make(map[string]float64)
+    for _, s := range stats {
+        sm.metrics.SetGauge("router_short_call_ratio", s.Ratio, map[string]string{
+            "provider":  s.ProviderName,
+            "direction": s.Direction,
+        })
+
+        if !s.Exceeded {
+            continue
+        }
+        exceeded[s.Direction+"|"+s.ProviderName] = true
+        if s.Throttled {
+            if s.Direction == models.DirectionInbound {
+                throttled[s.ProviderName] = sm.config.ThrottleFactor
+            } else {
+                caps[s.ProviderName] = sm.config.ThrottleFactor
+            }
+        }
+    }
+
+    sm.mu.Lock()
+    previous := sm.exceeded
+    sm.stats = stats
+    sm.exceeded = exceeded
+    sm.throttled = throttled
+    sm.mu.Unlock()
+
+    sm.lb.SetTrafficCaps("short_calls", caps)
+
+    log := logger.WithContext(ctx)
+    for _, s := range stats {
+        key := s.Direction + "|" + s.ProviderName
+        fields := map[string]interface{}{
+            "provider":       s.ProviderName,
+            "direction":      s.Direction,
+            "ratio":          s.Ratio,
+            "max_ratio":      s.MaxRatio,
+            "answered_calls": s.AnsweredCalls,
+            "throttled":      s.Throttled,
+        }
+        switch {
+        case s.Exceeded && !previous[key]:
+            log.WithFields(fields).Error("ALERT: short call ratio over contractual limit")
+        case !s.Exceeded && previous[key]:
+            log.WithFields(fields).Info("Short call ratio back within limit")
+        }
+    }
+
+    return stats, nil
+}
+
+func (sm *ShortCallMonitor) evaluateRoutine() {
+    ticker := time.NewTicker(sm.config.Interval)
+    defer ticker.Stop()
+
+    for {
+        if _, err := sm.Evaluate(context.Background()); err != nil {
+            logger.WithError(err).Debug("Failed to evaluate short call ratios")
+        }
+        <-ticker.C
+    }
+}
+
+// SetLimit creates or updates the short call limit of a provider
+func (sm *ShortCallMonitor) SetLimit(ctx context.Context, limit *models.ShortCallLimit) error {
+    if limit.MaxRatio <= 0 || limit.MaxRatio >= 100 {
+        return errors.New(errors.ErrInternal, "max ratio must be a percentage between 0 and 100").
+            WithContext("max_ratio", limit.MaxRatio)
+    }
+    if limit.Action == "" {
+        limit.Action = models.ShortCallActionAlert
+    }
+    if limit.Action != models.ShortCallActionAlert && limit.Action != models.ShortCallActionThrottle {
+        return errors.New(errors.ErrInternal, "action must be alert or throttle").
+            WithContext("action", limit.Action)
+    }
+
+    _, err := sm.db.ExecContext(ctx, `
+        INSERT INTO provider_short_call_limits (provider_name, max_ratio, action)
+        VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            max_ratio = VALUES(max_ratio),
+            action = VALUES(action),
+            updated_at = NOW()`,
+        limit.ProviderName, limit.MaxRatio, limit.Action)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to store short call limit")
+    }
+    return nil
+}
+
+// DeleteLimit removes the short call limit of a provider
+func (sm *ShortCallMonitor) DeleteLimit(ctx context.Context, providerName string) error {
+    result, err := sm.db.ExecContext(ctx,
+        "DELETE FROM provider_short_call_limits WHERE provider_name = ?", providerName)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete short call limit")
+    }
+
+    if rows, _ := result.RowsAffected(); rows == 0 {
+        return errors.New(errors.ErrProviderNotFound, "short call limit not found").
+            WithContext("provider", providerName)
+    }
+    return nil
+}
+
+// ListLimits returns the configured short call limits
+func (sm *ShortCallMonitor) ListLimits(ctx context.Context) ([]*models.ShortCallLimit, error) {
+    rows, err := sm.db.QueryContext(ctx, `
+        SELECT provider_name, max_ratio, action
+        FROM provider_short_call_limits
+        ORDER BY provider_name`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query short call limits")
+    }
+    defer rows.Close()
+
+    var limits []*models.ShortCallLimit
+    for rows.Next() {
+        var l models.ShortCallLimit
+        if err := rows.Scan(&l.ProviderName, &l.MaxRatio, &l.Action); err != nil {
+            continue
+        }
+        limits = append(limits, &l)
+    }
+
+    return limits, rows.Err()
+}
+
+func (sm *ShortCallMonitor) limitsByProvider(ctx context.Context) (map[string]*models.ShortCallLimit, error) {
+    limits, err := sm.ListLimits(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    byProvider := make(map[string]*models.ShortCallLimit, len(limits))
+    for _, l := range limits {
+        byProvider[l.ProviderName] = l
+    }
+    return byProvider, nil
+}
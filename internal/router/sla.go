@@ -0,0 +1,606 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "math"
+    "sort"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// SLAConfig controls provider SLA tracking and the monthly compliance reports
+type SLAConfig struct {
+    Enabled  bool
+    Interval time.Duration // how often the running month is checked and last month's reports looked for
+}
+
+func (c *SLAConfig) setDefaults() {
+    if c.Interval <= 0 {
+        c.Interval = time.Hour
+    }
+}
+
+// slaMonthFormat names report months
+const slaMonthFormat = "2006-01"
+
+// SetSLA creates or replaces the SLA targets of a provider
+func (r *Router) SetSLA(ctx context.Context, s *models.ProviderSLA, user string) error {
+    if s.MaxPDDMs < 0 || s.MinASR < 0 || s.MinAvailability < 0 ||
+        s.PDDCredit < 0 || s.ASRCredit < 0 || s.AvailabilityCredit < 0 || s.MaxCredit < 0 {
+        return errors.New(errors.ErrInternal, "SLA targets can't be negative")
+    }
+    if s.MinASR > 100 || s.MinAvailability > 100 ||
+        s.PDDCredit > 100 || s.ASRCredit > 100 || s.AvailabilityCredit > 100 || s.MaxCredit > 100 {
+        return errors.New(errors.ErrInternal, "SLA percentages can't exceed 100")
+    }
+
+    old, err := r.GetSLA(ctx, s.ProviderName)
+    if err != nil && errors.GetCode(err) != string(errors.ErrProviderNotFound) {
+        return err
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `
+        INSERT INTO provider_slas (provider_name, max_pdd_ms, min_asr, min_availability,
+            pdd_credit, asr_credit, availability_credit, max_credit, notes)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            max_pdd_ms = VALUES(max_pdd_ms),
+            min_asr = VALUES(min_asr),
+            min_availability = VALUES(min_availability),
+            pdd_credit = VALUES(pdd_credit),
+            asr_credit = VALUES(asr_credit),
+            availability_credit = VALUES(availability_credit),
+            max_credit = VALUES(max_credit),
+            notes = VALUES(notes)`,
+        s.ProviderName, s.MaxPDDMs, s.MinASR, s.MinAvailability,
+        s.PDDCredit, s.ASRCredit, s.AvailabilityCredit, s.MaxCredit, nullString(s.Notes))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to set SLA")
+    }
+
+    action := "update"
+    var oldValue interface{}
+    if old == nil {
+        action = "create"
+    } else {
+        oldValue = old
+    }
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "provider_sla",
+        EntityType: "provider",
+        EntityID:   s.ProviderName,
+        UserID:     user,
+        Action:     action,
+        OldValue:   oldValue,
+        NewValue:   s,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithField("provider", s.ProviderName).Info("Provider SLA set")
+    return nil
+}
+
+// GetSLA returns the SLA targets of a provider
+func (r *Router) GetSLA(ctx context.Context, provider string) (*models.ProviderSLA, error) {
+    slas, err := r.querySLAs(ctx, "WHERE provider_name = ?", provider)
+    if err != nil {
+        return nil, err
+    }
+    if len(slas) == 0 {
+        return nil, errors.New(errors.ErrProviderNotFound, "provider has no SLA").WithContext("provider", provider)
+    }
+    return slas[0], nil
+}
+
+// ListSLAs returns the SLA targets of every provider that has them
+func (r *Router) ListSLAs(ctx context.Context) ([]*models.ProviderSLA, error) {
+    return r.querySLAs(ctx, "")
+}
+
+// DeleteSLA stops tracking a provider's SLA. Its past reports are kept.
+func (r *Router) DeleteSLA(ctx context.Context, provider, user string) error {
+    old, err := r.GetSLA(ctx, provider)
+    if err != nil {
+        return err
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM provider_slas WHERE provider_name = ?", provider); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete SLA")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "provider_sla",
+        EntityType: "provider",
+        EntityID:   provider,
+        UserID:     user,
+        Action:     "delete",
+        OldValue:   old,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+// ParseSLAMonth parses a report month as YYYY-MM, in local time like the
+// month boundaries of the reports
+func ParseSLAMonth(month string) (time.Time, error) {
+    t, err := time.ParseInLocation(slaMonthFormat, month, time.Local)
+    if err != nil {
+        return time.Time{}, errors.New(errors.ErrInternal, "invalid SLA month, expected YYYY-MM").WithContext("month", month)
+    }
+    return t, nil
+}
+
+// BuildSLAReports measures every provider with an SLA over the month holding
+// the given time, up to now for the month still running, without storing the
+// reports. A call counts for each provider it went through from S2 and as
+// answered for all of them once answered end to end. PDD is taken as the
+// answer delay Asterisk reports for the answered leg.
+func (r *Router) BuildSLAReports(ctx context.Context, month time.Time, provider string) ([]*models.SLAReport, error) {
+    slas, err := r.ListSLAs(ctx)
+    if err != nil || len(slas) == 0 {
+        return nil, err
+    }
+    if provider != "" {
+        var found []*models.ProviderSLA
+        for _, s := range slas {
+            if s.ProviderName == provider {
+                found = append(found, s)
+            }
+        }
+        if len(found) == 0 {
+            return nil, errors.New(errors.ErrProviderNotFound, "provider has no SLA").WithContext("provider", provider)
+        }
+        slas = found
+    }
+
+    now := time.Now()
+    start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.Local)
+    end := start.AddDate(0, 1, 0)
+    if start.After(now) {
+        return nil, errors.New(errors.ErrInternal, "SLA month hasn't started").WithContext("month", start.Format(slaMonthFormat))
+    }
+    complete := !end.After(now)
+    if !complete {
+        end = now
+    }
+
+    reports := make(map[string]*models.SLAReport, len(slas))
+    for _, s := range slas {
+        reports[s.ProviderName] = &models.SLAReport{
+            ProviderName: s.ProviderName,
+            Month:        start.Format(slaMonthFormat),
+            Availability: 100,
+            Currency:     r.fx.Currency(),
+            Target:       s,
+            Complete:     complete,
+            GeneratedAt:  now,
+        }
+    }
+
+    if err := r.slaCallStats(ctx, start, end, reports); err != nil {
+        return nil, err
+    }
+    if err := r.slaOutages(ctx, start, end, reports); err != nil {
+        return nil, err
+    }
+
+    result := make([]*models.SLAReport, 0, len(slas))
+    for _, s := range slas {
+        report := reports[s.ProviderName]
+        scoreSLAReport(report, end.Sub(start))
+        result = append(result, report)
+    }
+    return result, nil
+}
+
+// slaCallStats fills in the calls, answers, PDD and spend of each report
+func (r *Router) slaCallStats(ctx context.Context, start, end time.Time, reports map[string]*models.SLAReport) error {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT provider, COUNT(*), COALESCE(SUM(answered), 0), AVG(pdd), COALESCE(SUM(seconds), 0) / 60
+        FROM (
+            SELECT intermediate_provider AS provider, answer_time IS NOT NULL AS answered,
+                   answer_delay_ms AS pdd, intermediate_billable_duration AS seconds
+            FROM call_records
+            WHERE start_time >= ? AND start_time < ? AND COALESCE(is_test, 0) = 0
+              AND COALESCE(intermediate_provider, '') <> ''
+            UNION ALL
+            SELECT final_provider, answer_time IS NOT NULL, answer_delay_ms, final_billable_duration
+            FROM call_records
+            WHERE start_time >= ? AND start_time < ? AND COALESCE(is_test, 0) = 0
+              AND COALESCE(final_provider, '') <> ''
+        ) legs
+        WHERE provider IN (SELECT provider_name FROM provider_slas)
+        GROUP BY provider`,
+        start, end, start, end)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to query SLA call statistics")
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var provider string
+        var calls, answered int64
+        var pdd sql.NullFloat64
+        var minutes float64
+        if err := rows.Scan(&provider, &calls, &answered, &pdd, &minutes); err != nil {
+            return errors.Wrap(err, errors.ErrDatabase, "failed to scan SLA call statistics")
+        }
+        report, ok := reports[provider]
+        if !ok {
+            continue
+        }
+        report.Calls = calls
+        report.Answered = answered
+        report.AvgPDDMs = int(math.Round(pdd.Float64))
+        report.Minutes = minutes
+    }
+    if err := rows.Err(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to read SLA call statistics")
+    }
+
+    rates, err := r.db.QueryContext(ctx, `
+        SELECT p.name, p.cost_per_minute, COALESCE(p.currency, '')
+        FROM providers p
+        JOIN provider_slas s ON s.provider_name = p.name`)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to query provider rates")
+    }
+    defer rates.Close()
+
+    for rates.Next() {
+        var name, currency string
+        var rate float64
+        if err := rates.Scan(&name, &rate, &currency); err != nil {
+            continue
+        }
+        if report, ok := reports[name]; ok {
+            report.Spend = report.Minutes * r.fx.Convert(ctx, rate, currency)
+        }
+    }
+    return rates.Err()
+}
+
+// slaOutages fills in the outages of each report from the health events of
+// the month, with the state the provider was in when it started
+func (r *Router) slaOutages(ctx context.Context, start, end time.Time, reports map[string]*models.SLAReport) error {
+    outages, err := r.healthOutages(ctx, start, end, "")
+    if err != nil {
+        return err
+    }
+
+    for provider, downtime := range outages {
+        report, ok := reports[provider]
+        if !ok {
+            continue
+        }
+        for _, d := range downtime {
+            // Still down when the month ends
+            to := end
+            if d.End != nil {
+                to = *d.End
+            }
+            report.Outages = append(report.Outages, models.SLAOutage{Start: d.Start, End: to, Seconds: d.Seconds})
+        }
+    }
+    return nil
+}
+
+// scoreSLAReport works out availability, the breaches and the credit of a
+// report. PDD and ASR are not judged for a month without calls.
+func scoreSLAReport(report *models.SLAReport, period time.Duration) {
+    s := report.Target
+
+    for _, o := range report.Outages {
+        report.DowntimeSeconds += o.Seconds
+    }
+    setSLAReliability(report, period)
+    if period > 0 {
+        report.Availability = 100 * (1 - float64(report.DowntimeSeconds)/period.Seconds())
+        if report.Availability < 0 {
+            report.Availability = 0
+        }
+    }
+    if report.Calls > 0 {
+        report.ASR = float64(report.Answered) / float64(report.Calls) * 100
+    }
+
+    report.Breaches = nil
+    if s.MaxPDDMs > 0 && report.Answered > 0 && report.AvgPDDMs > s.MaxPDDMs {
+        report.Breaches = append(report.Breaches, models.SLABreach{
+            Metric: models.SLAMetricPDD, Target: float64(s.MaxPDDMs), Actual: float64(report.AvgPDDMs), Credit: s.PDDCredit,
+        })
+    }
+    if s.MinASR > 0 && report.Calls > 0 && report.ASR < s.MinASR {
+        report.Breaches = append(report.Breaches, models.SLABreach{
+            Metric: models.SLAMetricASR, Target: s.MinASR, Actual: report.ASR, Credit: s.ASRCredit,
+        })
+    }
+    if s.MinAvailability > 0 && report.Availability < s.MinAvailability {
+        report.Breaches = append(report.Breaches, models.SLABreach{
+            Metric: models.SLAMetricAvailability, Target: s.MinAvailability, Actual: report.Availability, Credit: s.AvailabilityCredit,
+        })
+    }
+
+    report.CreditPercent = 0
+    for _, b := range report.Breaches {
+        report.CreditPercent += b.Credit
+    }
+    if s.MaxCredit > 0 && report.CreditPercent > s.MaxCredit {
+        report.CreditPercent = s.MaxCredit
+    }
+    report.Credit = report.Spend * report.CreditPercent / 100
+}
+
+// setSLAReliability works out the MTTR and MTBF of a report from its outages
+func setSLAReliability(report *models.SLAReport, period time.Duration) {
+    rel := reliability(len(report.Outages), report.DowntimeSeconds, period)
+    report.Failures = rel.Failures
+    report.MTTRSeconds = rel.MTTRSeconds
+    report.MTBFSeconds = rel.MTBFSeconds
+}
+
+// GenerateSLAReports builds the reports of a month and stores them, replacing
+// the ones generated for it before
+func (r *Router) GenerateSLAReports(ctx context.Context, month time.Time, provider string) ([]*models.SLAReport, error) {
+    reports, err := r.BuildSLAReports(ctx, month, provider)
+    if err != nil {
+        return nil, err
+    }
+    for _, report := range reports {
+        if err := r.storeSLAReport(ctx, report); err != nil {
+            return nil, err
+        }
+    }
+    return reports, nil
+}
+
+func (r *Router) storeSLAReport(ctx context.Context, report *models.SLAReport) error {
+    breaches, _ := json.Marshal(report.Breaches)
+    outages, _ := json.Marshal(report.Outages)
+    target, _ := json.Marshal(report.Target)
+
+    _, err := r.db.ExecContext(ctx, `
+        INSERT INTO provider_sla_reports (provider_name, month, calls, answered, asr, avg_pdd_ms,
+            availability, downtime_seconds, minutes, spend, currency, credit_percent, credit,
+            breaches, outages, target, complete, generated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            calls = VALUES(calls),
+            answered = VALUES(answered),
+            asr = VALUES(asr),
+            avg_pdd_ms = VALUES(avg_pdd_ms),
+            availability = VALUES(availability),
+            downtime_seconds = VALUES(downtime_seconds),
+            minutes = VALUES(minutes),
+            spend = VALUES(spend),
+            currency = VALUES(currency),
+            credit_percent = VALUES(credit_percent),
+            credit = VALUES(credit),
+            breaches = VALUES(breaches),
+            outages = VALUES(outages),
+            target = VALUES(target),
+            complete = VALUES(complete),
+            generated_at = VALUES(generated_at)`,
+        report.ProviderName, report.Month, report.Calls, report.Answered, report.ASR, report.AvgPDDMs,
+        report.Availability, report.DowntimeSeconds, report.Minutes, report.Spend, nullString(report.Currency),
+        report.CreditPercent, report.Credit, string(breaches), string(outages), string(target),
+        report.Complete, report.GeneratedAt)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to store SLA report").
+            WithContext("provider", report.ProviderName)
+    }
+    return nil
+}
+
+// ListSLAReports returns stored reports, newest month first, optionally of
+// one provider or month
+func (r *Router) ListSLAReports(ctx context.Context, provider, month string) ([]*models.SLAReport, error) {
+    where := "WHERE 1 = 1"
+    var args []interface{}
+    if provider != "" {
+        where += " AND provider_name = ?"
+        args = append(args, provider)
+    }
+    if month != "" {
+        where += " AND month = ?"
+        args = append(args, month)
+    }
+
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT provider_name, month, calls, answered, asr, avg_pdd_ms, availability, downtime_seconds,
+               minutes, spend, COALESCE(currency, ''), credit_percent, credit,
+               COALESCE(breaches, 'null'), COALESCE(outages, 'null'), COALESCE(target, 'null'),
+               complete, generated_at
+        FROM provider_sla_reports
+        `+where+`
+        ORDER BY month DESC, provider_name`, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query SLA reports")
+    }
+    defer rows.Close()
+
+    var reports []*models.SLAReport
+    for rows.Next() {
+        var report models.SLAReport
+        var breaches, outages, target string
+        if err := rows.Scan(&report.ProviderName, &report.Month, &report.Calls, &report.Answered, &report.ASR,
+            &report.AvgPDDMs, &report.Availability, &report.DowntimeSeconds, &report.Minutes, &report.Spend,
+            &report.Currency, &report.CreditPercent, &report.Credit, &breaches, &outages, &target,
+            &report.Complete, &report.GeneratedAt); err != nil {
+            continue
+        }
+        json.Unmarshal([]byte(breaches), &report.Breaches)
+        json.Unmarshal([]byte(outages), &report.Outages)
+        json.Unmarshal([]byte(target), &report.Target)
+
+        // Not stored, the outages have all it takes
+        if start, err := ParseSLAMonth(report.Month); err == nil {
+            end := start.AddDate(0, 1, 0)
+            if !report.Complete && report.GeneratedAt.Before(end) {
+                end = report.GeneratedAt
+            }
+            setSLAReliability(&report, end.Sub(start))
+        }
+        reports = append(reports, &report)
+    }
+    return reports, rows.Err()
+}
+
+// RunSLAReports exports the running month's compliance and stores last
+// month's reports once it is over, until the context ends
+func (r *Router) RunSLAReports(ctx context.Context) {
+    config := r.config.SLA
+    config.setDefaults()
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    for {
+        r.runSLAReports(ctx)
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (r *Router) runSLAReports(ctx context.Context) {
+    log := logger.WithContext(ctx)
+    now := time.Now()
+
+    // Every instance exports the gauges, one stores the reports
+    current, err := r.BuildSLAReports(ctx, now, "")
+    if err != nil {
+        log.WithError(err).Warn("SLA check failed")
+        return
+    }
+    for _, report := range current {
+        breached := make(map[string]bool)
+        for _, b := range report.Breaches {
+            breached[b.Metric] = true
+        }
+        for _, metric := range []string{models.SLAMetricPDD, models.SLAMetricASR, models.SLAMetricAvailability} {
+            value := 0.0
+            if breached[metric] {
+                value = 1
+            }
+            r.metrics.SetGauge("router_sla_breach", value, map[string]string{"provider": report.ProviderName, "metric": metric})
+        }
+    }
+
+    unlock, err := r.cache.Lock(ctx, "sla:reports", 5*time.Minute)
+    if err != nil {
+        return
+    }
+    defer unlock()
+
+    previous := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0)
+    month := previous.Format(slaMonthFormat)
+    stored, err := r.ListSLAReports(ctx, "", month)
+    if err != nil {
+        log.WithError(err).Warn("Failed to look up SLA reports")
+        return
+    }
+    done := make(map[string]bool, len(stored))
+    for _, report := range stored {
+        done[report.ProviderName] = report.Complete
+    }
+
+    missing := 0
+    for _, report := range current {
+        if !done[report.ProviderName] {
+            missing++
+        }
+    }
+    if missing == 0 {
+        return
+    }
+
+    reports, err := r.BuildSLAReports(ctx, previous, "")
+    if err != nil {
+        log.WithError(err).Warn("Failed to build SLA reports")
+        return
+    }
+    for _, report := range reports {
+        if done[report.ProviderName] {
+            continue
+        }
+        if err := r.storeSLAReport(ctx, report); err != nil {
+            log.WithError(err).Warn("Failed to store SLA report")
+            continue
+        }
+
+        fields := map[string]interface{}{
+            "provider": report.ProviderName,
+            "month":    report.Month,
+            "credit":   fmt.Sprintf("%.2f %s", report.Credit, report.Currency),
+        }
+        if report.Compliant() {
+            log.WithFields(fields).Info("Provider SLA report stored")
+            continue
+        }
+        for _, b := range report.Breaches {
+            log.WithFields(fields).WithField("metric", b.Metric).
+                Error(fmt.Sprintf("ALERT: provider SLA breached, %s %.2f against a target of %.2f", b.Metric, b.Actual, b.Target))
+        }
+    }
+}
+
+func (r *Router) querySLAs(ctx context.Context, where string, args ...interface{}) ([]*models.ProviderSLA, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT provider_name, max_pdd_ms, min_asr, min_availability, pdd_credit, asr_credit,
+               availability_credit, max_credit, COALESCE(notes, ''), updated_at
+        FROM provider_slas
+        `+where, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query SLAs")
+    }
+    defer rows.Close()
+
+    var slas []*models.ProviderSLA
+    for rows.Next() {
+        var s models.ProviderSLA
+        if err := rows.Scan(&s.ProviderName, &s.MaxPDDMs, &s.MinASR, &s.MinAvailability, &s.PDDCredit,
+            &s.ASRCredit, &s.AvailabilityCredit, &s.MaxCredit, &s.Notes, &s.UpdatedAt); err != nil {
+            continue
+        }
+        slas = append(slas, &s)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    sort.Slice(slas, func(i, j int) bool { return slas[i].ProviderName < slas[j].ProviderName })
+    return slas, nil
+}
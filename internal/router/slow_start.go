@@ -0,0 +1,115 @@
+package router
+
+import (
+    "math"
+    "math/rand"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+)
+
+// slowStartFloor is the share of traffic a provider gets right after recovery
+const slowStartFloor = 0.1
+
+// warmupFactor returns the fraction of its normal traffic a provider may take,
+// ramping linearly from slowStartFloor to 1 over the slow-start window
+func (lb *LoadBalancer) warmupFactor(health *ProviderHealthInfo, now time.Time) float64 {
+    if lb.config.SlowStartWindow <= 0 || health.RecoveredAt.IsZero() {
+        return 1
+    }
+    
+    elapsed := now.Sub(health.RecoveredAt)
+    if elapsed >= lb.config.SlowStartWindow {
+        return 1
+    }
+    
+    factor := float64(elapsed) / float64(lb.config.SlowStartWindow)
+    if factor < slowStartFloor {
+        factor = slowStartFloor
+    }
+    
+    return factor
+}
+
+// providerWarmup is the share of its normal traffic a provider may take, the
+// lower of its slow-start factor and any traffic cap
+func (lb *LoadBalancer) providerWarmup(providerName string) float64 {
+    health := lb.getProviderHealth(providerName)
+    
+    health.mu.RLock()
+    factor := lb.warmupFactor(health, time.Now())
+    health.mu.RUnlock()
+    
+    if limit, capped := lb.trafficCap(providerName); capped && limit < factor {
+        factor = limit
+    }
+    return factor
+}
+
+// SetTrafficCaps replaces the traffic share limits a source sets, keyed by
+// provider. A provider capped by several sources gets the lowest share.
+func (lb *LoadBalancer) SetTrafficCaps(source string, caps map[string]float64) {
+    lb.capMu.Lock()
+    if len(caps) == 0 {
+        delete(lb.trafficCaps, source)
+    } else {
+        lb.trafficCaps[source] = caps
+    }
+    lb.capMu.Unlock()
+}
+
+func (lb *LoadBalancer) trafficCap(providerName string) (float64, bool) {
+    lb.capMu.RLock()
+    defer lb.capMu.RUnlock()
+    
+    lowest, capped := 1.0, false
+    for _, caps := range lb.trafficCaps {
+        if limit, ok := caps[providerName]; ok && limit < lowest {
+            lowest, capped = limit, true
+        }
+    }
+    return lowest, capped
+}
+
+func (lb *LoadBalancer) hasTrafficCaps() bool {
+    lb.capMu.RLock()
+    defer lb.capMu.RUnlock()
+    
+    return len(lb.trafficCaps) > 0
+}
+
+// effectiveWeight scales the configured weight of a warming or capped provider
+func (lb *LoadBalancer) effectiveWeight(p *models.Provider) int {
+    factor := lb.providerWarmup(p.Name)
+    if factor >= 1 || p.Weight <= 0 {
+        return p.Weight
+    }
+    
+    return int(math.Max(1, math.Round(float64(p.Weight)*factor)))
+}
+
+// applySlowStart thins warming and capped providers out of the candidate list for modes
+// that do not use weights. Weighted mode scales weights instead and hash mode
+// keeps its ring stable, so both are left untouched.
+func (lb *LoadBalancer) applySlowStart(providers []*models.Provider, mode models.LoadBalanceMode) []*models.Provider {
+    if len(providers) < 2 || (lb.config.SlowStartWindow <= 0 && !lb.hasTrafficCaps()) {
+        return providers
+    }
+    if mode == models.LoadBalanceModeWeighted || mode == models.LoadBalanceModeHash {
+        return providers
+    }
+    
+    admitted := make([]*models.Provider, 0, len(providers))
+    for _, p := range providers {
+        if factor := lb.providerWarmup(p.Name); factor < 1 && rand.Float64() >= factor {
+            continue
+        }
+        admitted = append(admitted, p)
+    }
+    
+    if len(admitted) == 0 {
+        return providers
+    }
+    
+    return admitted
+}
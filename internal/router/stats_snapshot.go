@@ -0,0 +1,392 @@
+package router
+
+import (
+    "context"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/internal/numbering"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// StatsSnapshotConfig controls the daily statistics snapshot worker
+type StatsSnapshotConfig struct {
+    Enabled      bool
+    Interval     time.Duration
+    BackfillDays int           // days looked back for missing snapshots
+    RawRetention time.Duration // 0 keeps call_records forever
+}
+
+// StatsFilter narrows down the daily statistics history
+type StatsFilter struct {
+    Dimension string
+    Key       string
+    Since     time.Time
+    Until     time.Time
+
+    // ExcludeHolidays leaves out the holidays of HolidayCountry, or of each
+    // row's own country in the country dimension, so baselines are built
+    // from ordinary days
+    ExcludeHolidays bool
+    HolidayCountry  string
+}
+
+// deleteBatchSize bounds each call_records prune so replication and locks stay short
+const deleteBatchSize = 5000
+
+// dailyAccumulator sums the calls of one dimension key
+type dailyAccumulator map[string]*models.DailyCallStats
+
+func (a dailyAccumulator) add(dimension, key string, answered, completed, failed bool, duration, billable int64, cost, revenue float64) {
+    if key == "" {
+        key = "unknown"
+    }
+
+    s, ok := a[dimension+"\x00"+key]
+    if !ok {
+        s = &models.DailyCallStats{Dimension: dimension, Key: key}
+        a[dimension+"\x00"+key] = s
+    }
+
+    s.TotalCalls++
+    if answered {
+        s.AnsweredCalls++
+    }
+    if completed {
+        s.CompletedCalls++
+    }
+    if failed {
+        s.FailedCalls++
+    }
+    s.TotalDuration += duration
+    s.BillableDuration += billable
+    s.Cost += cost
+    s.Revenue += revenue
+}
+
+// SnapshotDailyStats aggregates one day of production call_records into call_stats_daily.
+// Running it again for the same day replaces that day's rows.
+func (r *Router) SnapshotDailyStats(ctx context.Context, day time.Time) (int, error) {
+    start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+    end := start.AddDate(0, 0, 1)
+    date := start.Format("2006-01-02") // DATE columns take the local day, not its UTC instant
+
+    // Re-running a day whose raw records are gone would wipe its stats
+    var pruned bool
+    err := r.db.QueryRowContext(ctx, "SELECT raw_pruned FROM call_stats_snapshots WHERE stat_date = ?", date).Scan(&pruned)
+    if err == nil && pruned {
+        return 0, errors.New(errors.ErrInternal, "raw call records of this day have been pruned").
+            WithContext("date", date)
+    }
+
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT cr.original_dnis, COALESCE(cr.inbound_provider, ''), COALESCE(cr.intermediate_provider, ''),
+               COALESCE(cr.final_provider, ''), COALESCE(cr.route_name, ''), cr.status,
+               cr.answer_time IS NOT NULL, COALESCE(cr.duration, 0), COALESCE(cr.billable_duration, 0),
+               COALESCE(u.cost, 0), COALESCE(u.revenue, 0), COALESCE(u.currency, '')
+        FROM call_records cr
+        LEFT JOIN did_usage_log u ON u.call_id = cr.call_id
+        WHERE cr.start_time >= ? AND cr.start_time < ? AND COALESCE(cr.is_test, 0) = 0`,
+        start, end)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to query call records")
+    }
+    defer rows.Close()
+
+    acc := make(dailyAccumulator)
+    calls := 0
+    for rows.Next() {
+        var dnis, inbound, intermediate, final, route string
+        var status models.CallStatus
+        var answered bool
+        var duration, billable int64
+        var cost, revenue float64
+        var currency string
+
+        if err := rows.Scan(&dnis, &inbound, &intermediate, &final, &route, &status,
+            &answered, &duration, &billable, &cost, &revenue, &currency); err != nil {
+            logger.WithContext(ctx).WithError(err).Warn("Failed to scan call record")
+            continue
+        }
+        calls++
+        cost = r.fx.Convert(ctx, cost, currency)
+        revenue = r.fx.Convert(ctx, revenue, currency)
+
+        completed := status == models.CallStatusCompleted
+        answered = answered || completed
+        failed := status == models.CallStatusFailed || status == models.CallStatusAbandoned || status == models.CallStatusTimeout
+
+        // A call counts once for every provider that carried one of its legs
+        seen := make(map[string]bool, 3)
+        for _, p := range []string{inbound, intermediate, final} {
+            if p == "" || seen[p] {
+                continue
+            }
+            seen[p] = true
+            acc.add(models.StatsDimensionProvider, p, answered, completed, failed, duration, billable, cost, revenue)
+        }
+        acc.add(models.StatsDimensionRoute, route, answered, completed, failed, duration, billable, cost, revenue)
+        acc.add(models.StatsDimensionCountry, numbering.CountryOf(dnis), answered, completed, failed, duration, billable, cost, revenue)
+    }
+    if err := rows.Err(); err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to read call records")
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM call_stats_daily WHERE stat_date = ?", date); err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to clear daily stats")
+    }
+
+    for _, s := range acc {
+        _, err := tx.ExecContext(ctx, `
+            INSERT INTO call_stats_daily (
+                stat_date, dimension, dimension_key, total_calls, answered_calls,
+                completed_calls, failed_calls, total_duration, billable_duration, cost, revenue, currency
+            ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+            date, s.Dimension, s.Key, s.TotalCalls, s.AnsweredCalls,
+            s.CompletedCalls, s.FailedCalls, s.TotalDuration, s.BillableDuration, s.Cost, s.Revenue, r.fx.Currency())
+        if err != nil {
+            return 0, errors.Wrap(err, errors.ErrDatabase, "failed to store daily stats").
+                WithContext("dimension", s.Dimension).WithContext("key", s.Key)
+        }
+    }
+
+    if _, err := tx.ExecContext(ctx, `
+        INSERT INTO call_stats_snapshots (stat_date, call_count, row_count)
+        VALUES (?, ?, ?)
+        ON DUPLICATE KEY UPDATE call_count = VALUES(call_count), row_count = VALUES(row_count), created_at = NOW()`,
+        date, calls, len(acc)); err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to record snapshot")
+    }
+
+    if err := tx.Commit(); err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to commit daily stats")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "date":  date,
+        "calls": calls,
+        "rows":  len(acc),
+    }).Info("Daily statistics snapshot written")
+
+    return len(acc), nil
+}
+
+// SnapshotPendingDays snapshots every finished day within the backfill window
+// that has no snapshot yet and returns the days written
+func (r *Router) SnapshotPendingDays(ctx context.Context, backfillDays int) ([]time.Time, error) {
+    if backfillDays <= 0 {
+        backfillDays = 7
+    }
+
+    now := time.Now()
+    today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+    first := today.AddDate(0, 0, -backfillDays)
+
+    rows, err := r.db.QueryContext(ctx, "SELECT stat_date FROM call_stats_snapshots WHERE stat_date >= ?", first.Format("2006-01-02"))
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query snapshots")
+    }
+    done := make(map[string]bool)
+    for rows.Next() {
+        var d time.Time
+        if err := rows.Scan(&d); err == nil {
+            done[d.Format("2006-01-02")] = true
+        }
+    }
+    rows.Close()
+
+    var written []time.Time
+    for day := first; day.Before(today); day = day.AddDate(0, 0, 1) {
+        if done[day.Format("2006-01-02")] {
+            continue
+        }
+        if _, err := r.SnapshotDailyStats(ctx, day); err != nil {
+            return written, err
+        }
+        written = append(written, day)
+    }
+
+    return written, nil
+}
+
+// PruneCallRecords deletes raw call records older than retention, day by day and only
+// for days that have been snapshotted, in small batches
+func (r *Router) PruneCallRecords(ctx context.Context, retention time.Duration) (int64, error) {
+    if retention <= 0 {
+        return 0, nil
+    }
+
+    cutoff := time.Now().Add(-retention)
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT stat_date FROM call_stats_snapshots
+        WHERE raw_pruned = FALSE AND stat_date < ?
+        ORDER BY stat_date`, cutoff.Format("2006-01-02"))
+    if err != nil {
+        return 0, errors.Wrap(err, errors.ErrDatabase, "failed to query snapshots")
+    }
+    var days []time.Time
+    for rows.Next() {
+        var d time.Time
+        if err := rows.Scan(&d); err == nil {
+            days = append(days, time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.Local))
+        }
+    }
+    rows.Close()
+
+    var total int64
+    for _, day := range days {
+        // A day is only pruned once it has fully passed the retention window
+        if day.AddDate(0, 0, 1).After(cutoff) {
+            break
+        }
+
+        for {
+            result, err := r.db.ExecContext(ctx, `
+                DELETE FROM call_records
+                WHERE start_time >= ? AND start_time < ? AND status NOT IN (`+activeCallStatuses+`)
+                LIMIT ?`, day, day.AddDate(0, 0, 1), deleteBatchSize)
+            if err != nil {
+                return total, errors.Wrap(err, errors.ErrDatabase, "failed to prune call records")
+            }
+
+            n, _ := result.RowsAffected()
+            total += n
+            if n < deleteBatchSize {
+                break
+            }
+            if ctx.Err() != nil {
+                return total, ctx.Err()
+            }
+        }
+
+        if _, err := r.db.ExecContext(ctx, "UPDATE call_stats_snapshots SET raw_pruned = TRUE WHERE stat_date = ?",
+            day.Format("2006-01-02")); err != nil {
+            return total, errors.Wrap(err, errors.ErrDatabase, "failed to mark snapshot pruned")
+        }
+    }
+
+    if total > 0 {
+        logger.WithContext(ctx).WithFields(map[string]interface{}{
+            "deleted": total,
+            "days":    len(days),
+        }).Info("Pruned raw call records")
+    }
+
+    return total, nil
+}
+
+// RunStatsSnapshots snapshots finished days and prunes raw records until the context ends
+func (r *Router) RunStatsSnapshots(ctx context.Context, config StatsSnapshotConfig) {
+    if config.Interval <= 0 {
+        config.Interval = time.Hour
+    }
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    for {
+        r.runStatsSnapshot(ctx, config)
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (r *Router) runStatsSnapshot(ctx context.Context, config StatsSnapshotConfig) {
+    log := logger.WithContext(ctx)
+
+    // Only one router instance snapshots at a time
+    unlock, err := r.cache.Lock(ctx, "stats:snapshot", 10*time.Minute)
+    if err != nil {
+        log.WithError(err).Debug("Stats snapshot already running elsewhere")
+        return
+    }
+    defer unlock()
+
+    if _, err := r.SnapshotPendingDays(ctx, config.BackfillDays); err != nil {
+        log.WithError(err).Warn("Daily statistics snapshot failed")
+        return
+    }
+
+    if _, err := r.PruneCallRecords(ctx, config.RawRetention); err != nil {
+        log.WithError(err).Warn("Failed to prune call records")
+    }
+}
+
+// GetDailyStats returns snapshotted days, oldest first
+func (r *Router) GetDailyStats(ctx context.Context, filter StatsFilter) ([]*models.DailyCallStats, error) {
+    if filter.Until.IsZero() {
+        filter.Until = time.Now()
+    }
+    if filter.Since.IsZero() {
+        filter.Since = filter.Until.AddDate(0, 0, -30)
+    }
+
+    switch filter.Dimension {
+    case models.StatsDimensionProvider, models.StatsDimensionRoute, models.StatsDimensionCountry:
+    default:
+        return nil, errors.New(errors.ErrInternal, "dimension must be provider, route or country").
+            WithContext("dimension", filter.Dimension)
+    }
+    if filter.ExcludeHolidays && filter.HolidayCountry == "" && filter.Dimension != models.StatsDimensionCountry {
+        return nil, errors.New(errors.ErrInternal, "a holiday country is needed to exclude holidays outside the country dimension")
+    }
+
+    conditions := []string{"dimension = ?", "stat_date >= ?", "stat_date < ?"}
+    args := []interface{}{filter.Dimension, filter.Since.Format("2006-01-02"), filter.Until.Format("2006-01-02")}
+    if filter.Key != "" {
+        conditions = append(conditions, "dimension_key = ?")
+        args = append(args, filter.Key)
+    }
+
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT stat_date, dimension, dimension_key, total_calls, answered_calls, completed_calls,
+               failed_calls, total_duration, billable_duration, cost, revenue, COALESCE(currency, '')
+        FROM call_stats_daily`+whereClause(conditions)+`
+        ORDER BY stat_date, dimension_key`, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query daily stats")
+    }
+    defer rows.Close()
+
+    var stats []*models.DailyCallStats
+    for rows.Next() {
+        var s models.DailyCallStats
+        if err := rows.Scan(&s.Date, &s.Dimension, &s.Key, &s.TotalCalls, &s.AnsweredCalls, &s.CompletedCalls,
+            &s.FailedCalls, &s.TotalDuration, &s.BillableDuration, &s.Cost, &s.Revenue, &s.Currency); err != nil {
+            continue
+        }
+        if filter.ExcludeHolidays {
+            country := filter.HolidayCountry
+            if country == "" {
+                country = s.Key
+            }
+            if r.IsHoliday(ctx, country, s.Date) {
+                continue
+            }
+        }
+        // Days snapshotted in another reporting currency
+        s.Cost = r.fx.Convert(ctx, s.Cost, s.Currency)
+        s.Revenue = r.fx.Convert(ctx, s.Revenue, s.Currency)
+        s.Currency = r.fx.Currency()
+        if s.TotalCalls > 0 {
+            s.ASR = float64(s.AnsweredCalls) / float64(s.TotalCalls) * 100
+        }
+        if s.AnsweredCalls > 0 {
+            s.ACD = float64(s.TotalDuration) / float64(s.AnsweredCalls)
+        }
+        stats = append(stats, &s)
+    }
+
+    return stats, rows.Err()
+}
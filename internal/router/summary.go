@@ -0,0 +1,120 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// summaryFailures is how many failure reasons the summary lists
+const summaryFailures = 5
+
+// Summary returns the dashboard summary. It is built from three queries and
+// served from memory for SummaryTTL, so any number of wallboards cost the
+// database one set of queries per TTL.
+func (r *Router) Summary(ctx context.Context) (*models.Summary, error) {
+    r.summaryMu.Lock()
+    defer r.summaryMu.Unlock()
+
+    if cached, ok := r.summaryCache.get("summary"); ok {
+        return cached.(*models.Summary), nil
+    }
+
+    now := time.Now()
+    s := &models.Summary{
+        GeneratedAt:        now,
+        NodeActiveCalls:    r.activeCalls.Len(),
+        UnhealthyProviders: []models.UnhealthyProvider{},
+        TopFailures:        []models.FailureCount{},
+    }
+    hourAgo := now.Add(-time.Hour)
+
+    var calls, ended, answered, lastMinute sql.NullInt64
+    var didsInUse sql.NullInt64
+    err := r.db.QueryRowContext(ctx, `
+        SELECT
+            (SELECT COUNT(*) FROM call_records
+             WHERE status IN (?, ?, ?, ?) AND end_time IS NULL AND COALESCE(is_test, 0) = 0),
+            COUNT(*),
+            SUM(end_time IS NOT NULL),
+            SUM(answer_time IS NOT NULL),
+            SUM(start_time >= ?),
+            (SELECT COUNT(*) FROM dids),
+            (SELECT SUM(in_use) FROM dids)
+        FROM call_records
+        WHERE start_time >= ? AND COALESCE(is_test, 0) = 0`,
+        models.CallStatusInitiated, models.CallStatusActive,
+        models.CallStatusReturnedFromS3, models.CallStatusRoutingToS4,
+        now.Add(-time.Minute), hourAgo).
+        Scan(&s.ActiveCalls, &calls, &ended, &answered, &lastMinute, &s.DIDs.Total, &didsInUse)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query summary")
+    }
+
+    s.CallsLastHour = calls.Int64
+    s.AnsweredLastHour = answered.Int64
+    if ended.Int64 > 0 {
+        s.ASRLastHour = float64(answered.Int64) / float64(ended.Int64) * 100
+    }
+    s.CPS = float64(lastMinute.Int64) / 60
+    s.DIDs.InUse = didsInUse.Int64
+    s.DIDs.Available = s.DIDs.Total - s.DIDs.InUse
+    if s.DIDs.Total > 0 {
+        s.DIDs.Utilization = float64(s.DIDs.InUse) / float64(s.DIDs.Total) * 100
+    }
+
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT h.provider_name, h.health_score, h.consecutive_failures, h.last_failure_at
+        FROM provider_health h
+        JOIN providers p ON p.name = h.provider_name
+        WHERE h.is_healthy = 0 AND p.active = 1
+        ORDER BY h.health_score, h.provider_name`)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query provider health")
+    }
+    for rows.Next() {
+        var p models.UnhealthyProvider
+        var lastFailure sql.NullTime
+        if err := rows.Scan(&p.Name, &p.HealthScore, &p.ConsecutiveFailures, &lastFailure); err != nil {
+            continue
+        }
+        if lastFailure.Valid {
+            p.LastFailure = &lastFailure.Time
+        }
+        s.UnhealthyProviders = append(s.UnhealthyProviders, p)
+    }
+    rows.Close()
+
+    // Calls closed without a disposition, such as those the router rejected,
+    // count under their status
+    rows, err = r.db.QueryContext(ctx, `
+        SELECT COALESCE(NULLIF(disposition, ''), LOWER(status)) AS reason, COUNT(*)
+        FROM call_records
+        WHERE start_time >= ? AND end_time IS NOT NULL AND answer_time IS NULL
+          AND status <> ? AND COALESCE(disposition, '') NOT IN (?, ?)
+          AND COALESCE(is_test, 0) = 0
+        GROUP BY reason
+        ORDER BY COUNT(*) DESC, reason
+        LIMIT ?`,
+        hourAgo, models.CallStatusCompleted, models.DispositionAnswered, models.DispositionCancelled, summaryFailures)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query failure reasons")
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var f models.FailureCount
+        if err := rows.Scan(&f.Reason, &f.Calls); err != nil {
+            continue
+        }
+        s.TopFailures = append(s.TopFailures, f)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to read failure reasons")
+    }
+
+    r.summaryCache.set("summary", s)
+    return s, nil
+}
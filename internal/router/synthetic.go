@@ -0,0 +1,439 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// SyntheticConfig controls scheduled synthetic test calls
+type SyntheticConfig struct {
+    Enabled       bool
+    CheckInterval time.Duration // how often due probes are looked for
+    Timeout       time.Duration // ring timeout of a probe call
+    DefaultANI    string
+}
+
+// SyntheticDialer places probe calls, implemented by the AMI manager
+type SyntheticDialer interface {
+    ProbeCall(ctx context.Context, req models.ProbeCallRequest) (*models.ProbeCallResult, error)
+}
+
+// SyntheticResultFilter narrows down probe results
+type SyntheticResultFilter struct {
+    Probe    string
+    Provider string
+    Since    time.Time
+    Limit    int
+}
+
+// SyntheticProber runs due probes and records their results apart from customer traffic
+type SyntheticProber struct {
+    router *Router
+    dialer SyntheticDialer
+    config SyntheticConfig
+}
+
+// NewSyntheticProber creates a new prober
+func NewSyntheticProber(r *Router, dialer SyntheticDialer, config SyntheticConfig) *SyntheticProber {
+    if config.CheckInterval <= 0 {
+        config.CheckInterval = 30 * time.Second
+    }
+    if config.Timeout <= 0 {
+        config.Timeout = 30 * time.Second
+    }
+
+    return &SyntheticProber{
+        router: r,
+        dialer: dialer,
+        config: config,
+    }
+}
+
+// Run probes due checks until the context is cancelled
+func (sp *SyntheticProber) Run(ctx context.Context) {
+    ticker := time.NewTicker(sp.config.CheckInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+            sp.runDue(ctx)
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (sp *SyntheticProber) runDue(ctx context.Context) {
+    log := logger.WithContext(ctx)
+
+    // One router instance places the probe calls
+    unlock, err := sp.router.cache.Lock(ctx, "synthetic:probes", 10*time.Minute)
+    if err != nil {
+        return
+    }
+    defer unlock()
+
+    probes, err := sp.router.ListSyntheticProbes(ctx)
+    if err != nil {
+        log.WithError(err).Warn("Failed to load synthetic probes")
+        return
+    }
+
+    now := time.Now()
+    for _, probe := range probes {
+        if !probe.Enabled || (probe.LastRunAt != nil && now.Sub(*probe.LastRunAt) < probe.Interval) {
+            continue
+        }
+        if _, err := sp.RunProbe(ctx, probe); err != nil {
+            log.WithError(err).WithField("probe", probe.Name).Warn("Synthetic probe failed")
+        }
+    }
+}
+
+// RunProbe calls each provider the probe covers and stores the results
+func (sp *SyntheticProber) RunProbe(ctx context.Context, probe *models.SyntheticProbe) ([]*models.SyntheticResult, error) {
+    providers, err := sp.router.syntheticTargets(ctx, probe)
+    if err != nil {
+        return nil, err
+    }
+
+    if _, err := sp.router.db.ExecContext(ctx, "UPDATE synthetic_probes SET last_run_at = NOW() WHERE id = ?", probe.ID); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to update probe")
+    }
+
+    ani := probe.ANI
+    if ani == "" {
+        ani = sp.config.DefaultANI
+    }
+
+    var results []*models.SyntheticResult
+    for _, providerName := range providers {
+        started := time.Now()
+        call, err := sp.dialer.ProbeCall(ctx, models.ProbeCallRequest{
+            Endpoint:     "endpoint-" + providerName,
+            DNIS:         probe.DNIS,
+            CallerID:     ani,
+            Timeout:      sp.config.Timeout,
+            CancelOnRing: probe.Mode != models.SyntheticModeAnswer,
+        })
+        if ctx.Err() != nil {
+            return results, ctx.Err()
+        }
+
+        result := syntheticResult(probe, providerName, started, call, err)
+        sp.router.recordSyntheticResult(ctx, result)
+        results = append(results, result)
+    }
+
+    return results, nil
+}
+
+// syntheticResult classifies a probe call
+func syntheticResult(probe *models.SyntheticProbe, providerName string, started time.Time, call *models.ProbeCallResult, err error) *models.SyntheticResult {
+    result := &models.SyntheticResult{
+        Probe:     probe.Name,
+        Provider:  providerName,
+        Route:     probe.Route,
+        StartedAt: started,
+    }
+
+    if err != nil {
+        result.Outcome = models.SyntheticOutcomeFailed
+        result.Reason = err.Error()
+        return result
+    }
+
+    result.PDD = call.PDD.Milliseconds()
+    result.Cause = call.Cause
+    result.Reason = call.Reason
+    if result.Reason == "" {
+        result.Reason = call.CauseText
+    }
+
+    switch {
+    case call.Answered:
+        result.Outcome = models.SyntheticOutcomeAnswered
+    case call.Ringing:
+        result.Outcome = models.SyntheticOutcomeRinging
+    case call.Reason == "timeout":
+        result.Outcome = models.SyntheticOutcomeTimeout
+    case call.Cause == 17:
+        result.Outcome = models.SyntheticOutcomeBusy
+    case call.Cause == 18 || call.Cause == 19:
+        result.Outcome = models.SyntheticOutcomeNoAnswer
+    default:
+        result.Outcome = models.SyntheticOutcomeFailed
+    }
+
+    // Cancel probes only need the far end to ring, answer probes need it to pick up
+    if probe.Mode == models.SyntheticModeAnswer {
+        result.Success = call.Answered
+    } else {
+        result.Success = call.Answered || call.Ringing
+    }
+
+    return result
+}
+
+// syntheticTargets resolves the providers a probe calls: its provider, or the
+// outbound legs of its route with groups expanded to their members, less the
+// providers the route excludes
+func (r *Router) syntheticTargets(ctx context.Context, probe *models.SyntheticProbe) ([]string, error) {
+    if probe.Provider != "" {
+        return []string{probe.Provider}, nil
+    }
+
+    route, err := r.GetRoute(ctx, probe.Route)
+    if err != nil {
+        return nil, err
+    }
+
+    var targets []string
+    seen := make(map[string]bool)
+    legs := []struct {
+        name    string
+        isGroup bool
+    }{
+        {route.IntermediateProvider, route.IntermediateIsGroup},
+        {route.FinalProvider, route.FinalIsGroup},
+    }
+    for _, leg := range legs {
+        names := []string{leg.name}
+        if leg.isGroup {
+            members, err := r.groupMembers(ctx, leg.name)
+            if err != nil {
+                return nil, err
+            }
+            names = names[:0]
+            for _, m := range members {
+                names = append(names, m.Name)
+            }
+        }
+        for _, name := range names {
+            if !seen[name] && !route.Excludes(name) {
+                seen[name] = true
+                targets = append(targets, name)
+            }
+        }
+    }
+
+    return targets, nil
+}
+
+// recordSyntheticResult stores a probe result and updates the synthetic metrics
+func (r *Router) recordSyntheticResult(ctx context.Context, result *models.SyntheticResult) {
+    if len(result.Reason) > 255 {
+        result.Reason = result.Reason[:255]
+    }
+    
+    _, err := r.db.ExecContext(ctx, `
+        INSERT INTO synthetic_results (probe_name, provider, route_name, started_at, outcome, success, pdd_ms, cause, reason)
+        VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?)`,
+        result.Probe, result.Provider, result.Route, result.StartedAt, result.Outcome,
+        result.Success, result.PDD, result.Cause, result.Reason)
+    if err != nil {
+        logger.WithContext(ctx).WithError(err).Warn("Failed to store synthetic result")
+    }
+
+    r.metrics.IncrementCounter("synthetic_calls", map[string]string{
+        "provider": result.Provider,
+        "route":    result.Route,
+        "outcome":  result.Outcome,
+    })
+    if result.PDD > 0 {
+        r.metrics.ObserveHistogram("synthetic_pdd", float64(result.PDD)/1000, map[string]string{
+            "provider": result.Provider,
+        })
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "probe":    result.Probe,
+        "provider": result.Provider,
+        "outcome":  result.Outcome,
+        "pdd_ms":   result.PDD,
+    }).Debug("Synthetic probe call finished")
+}
+
+// AddSyntheticProbe creates or replaces a probe
+func (r *Router) AddSyntheticProbe(ctx context.Context, probe *models.SyntheticProbe) error {
+    if (probe.Provider == "") == (probe.Route == "") {
+        return errors.New(errors.ErrInternal, "a probe targets either a provider or a route")
+    }
+    if probe.DNIS == "" {
+        return errors.New(errors.ErrInternal, "probe destination number is required")
+    }
+    if probe.Mode == "" {
+        probe.Mode = models.SyntheticModeCancel
+    }
+    if probe.Mode != models.SyntheticModeCancel && probe.Mode != models.SyntheticModeAnswer {
+        return errors.New(errors.ErrInternal, "probe mode must be cancel or answer").
+            WithContext("mode", probe.Mode)
+    }
+    if probe.Interval < time.Minute {
+        probe.Interval = time.Minute
+    }
+
+    if probe.Route != "" {
+        if _, err := r.GetRoute(ctx, probe.Route); err != nil {
+            return err
+        }
+    }
+
+    _, err := r.db.ExecContext(ctx, `
+        INSERT INTO synthetic_probes (name, provider, route_name, dnis, ani, mode, interval_seconds, enabled)
+        VALUES (?, NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), ?, ?, ?)
+        ON DUPLICATE KEY UPDATE
+            provider = VALUES(provider), route_name = VALUES(route_name), dnis = VALUES(dnis),
+            ani = VALUES(ani), mode = VALUES(mode), interval_seconds = VALUES(interval_seconds),
+            enabled = VALUES(enabled)`,
+        probe.Name, probe.Provider, probe.Route, probe.DNIS, probe.ANI, probe.Mode,
+        int(probe.Interval.Seconds()), probe.Enabled)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to save probe")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "probe":    probe.Name,
+        "provider": probe.Provider,
+        "route":    probe.Route,
+        "interval": probe.Interval.String(),
+    }).Info("Synthetic probe saved")
+
+    return nil
+}
+
+// GetSyntheticProbe returns a probe by name
+func (r *Router) GetSyntheticProbe(ctx context.Context, name string) (*models.SyntheticProbe, error) {
+    probe, err := scanSyntheticProbe(r.db.QueryRowContext(ctx, syntheticProbeSelect+" WHERE name = ?", name))
+    if err == sql.ErrNoRows {
+        return nil, errors.New(errors.ErrInternal, "synthetic probe not found").
+            WithContext("probe", name)
+    }
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to get probe")
+    }
+    return probe, nil
+}
+
+// ListSyntheticProbes returns every probe by name
+func (r *Router) ListSyntheticProbes(ctx context.Context) ([]*models.SyntheticProbe, error) {
+    rows, err := r.db.QueryContext(ctx, syntheticProbeSelect+" ORDER BY name")
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to list probes")
+    }
+    defer rows.Close()
+
+    var probes []*models.SyntheticProbe
+    for rows.Next() {
+        probe, err := scanSyntheticProbe(rows)
+        if err != nil {
+            continue
+        }
+        probes = append(probes, probe)
+    }
+
+    return probes, rows.Err()
+}
+
+// SetSyntheticProbeEnabled pauses or resumes a probe
+func (r *Router) SetSyntheticProbeEnabled(ctx context.Context, name string, enabled bool) error {
+    result, err := r.db.ExecContext(ctx, "UPDATE synthetic_probes SET enabled = ? WHERE name = ?", enabled, name)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update probe")
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        if _, err := r.GetSyntheticProbe(ctx, name); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// DeleteSyntheticProbe removes a probe, its results are kept
+func (r *Router) DeleteSyntheticProbe(ctx context.Context, name string) error {
+    result, err := r.db.ExecContext(ctx, "DELETE FROM synthetic_probes WHERE name = ?", name)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete probe")
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return errors.New(errors.ErrInternal, "synthetic probe not found").
+            WithContext("probe", name)
+    }
+    return nil
+}
+
+// GetSyntheticResults returns probe results, newest first
+func (r *Router) GetSyntheticResults(ctx context.Context, filter SyntheticResultFilter) ([]*models.SyntheticResult, error) {
+    conditions := []string{}
+    args := []interface{}{}
+    if filter.Probe != "" {
+        conditions = append(conditions, "probe_name = ?")
+        args = append(args, filter.Probe)
+    }
+    if filter.Provider != "" {
+        conditions = append(conditions, "provider = ?")
+        args = append(args, filter.Provider)
+    }
+    if !filter.Since.IsZero() {
+        conditions = append(conditions, "started_at >= ?")
+        args = append(args, filter.Since)
+    }
+    if filter.Limit <= 0 {
+        filter.Limit = 50
+    }
+    args = append(args, filter.Limit)
+
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT id, probe_name, provider, COALESCE(route_name, ''), started_at, outcome,
+               success, pdd_ms, cause, COALESCE(reason, '')
+        FROM synthetic_results`+whereClause(conditions)+`
+        ORDER BY started_at DESC, id DESC
+        LIMIT ?`, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query synthetic results")
+    }
+    defer rows.Close()
+
+    var results []*models.SyntheticResult
+    for rows.Next() {
+        var res models.SyntheticResult
+        if err := rows.Scan(&res.ID, &res.Probe, &res.Provider, &res.Route, &res.StartedAt, &res.Outcome,
+            &res.Success, &res.PDD, &res.Cause, &res.Reason); err != nil {
+            continue
+        }
+        results = append(results, &res)
+    }
+
+    return results, rows.Err()
+}
+
+const syntheticProbeSelect = `
+    SELECT id, name, COALESCE(provider, ''), COALESCE(route_name, ''), dnis, COALESCE(ani, ''),
+           mode, interval_seconds, enabled, last_run_at, created_at
+    FROM synthetic_probes`
+
+func scanSyntheticProbe(row rowScanner) (*models.SyntheticProbe, error) {
+    var probe models.SyntheticProbe
+    var interval int
+    var lastRun sql.NullTime
+
+    err := row.Scan(&probe.ID, &probe.Name, &probe.Provider, &probe.Route, &probe.DNIS, &probe.ANI,
+        &probe.Mode, &interval, &probe.Enabled, &lastRun, &probe.CreatedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    probe.Mode = strings.ToLower(probe.Mode)
+    probe.Interval = time.Duration(interval) * time.Second
+    if lastRun.Valid {
+        probe.LastRunAt = &lastRun.Time
+    }
+    return &probe, nil
+}
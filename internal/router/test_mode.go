@@ -0,0 +1,133 @@
+package router
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// TestModeConfig limits the traffic of routes marked as test
+type TestModeConfig struct {
+    MaxConcurrent int // 0 disables the limit
+    MaxCPS        int // 0 disables the limit
+}
+
+// TestTrafficLimiter caps concurrent calls and call setups per second of test traffic
+type TestTrafficLimiter struct {
+    config TestModeConfig
+
+    mu      sync.Mutex
+    active  map[string]struct{}
+    started []time.Time
+}
+
+// NewTestTrafficLimiter creates a new limiter
+func NewTestTrafficLimiter(config TestModeConfig) *TestTrafficLimiter {
+    return &TestTrafficLimiter{
+        config: config,
+        active: make(map[string]struct{}),
+    }
+}
+
+// Acquire admits a test call or returns a quota error
+func (tl *TestTrafficLimiter) Acquire(callID string) error {
+    now := time.Now()
+
+    tl.mu.Lock()
+    defer tl.mu.Unlock()
+
+    if tl.config.MaxConcurrent > 0 && len(tl.active) >= tl.config.MaxConcurrent {
+        return errors.New(errors.ErrQuotaExceeded, "test traffic concurrent call limit reached").
+            WithContext("limit", tl.config.MaxConcurrent)
+    }
+
+    if tl.config.MaxCPS > 0 {
+        cutoff := now.Add(-time.Second)
+        recent := tl.started[:0]
+        for _, t := range tl.started {
+            if t.After(cutoff) {
+                recent = append(recent, t)
+            }
+        }
+        tl.started = recent
+
+        if len(recent) >= tl.config.MaxCPS {
+            return errors.New(errors.ErrQuotaExceeded, "test traffic CPS limit reached").
+                WithContext("limit", tl.config.MaxCPS)
+        }
+        tl.started = append(tl.started, now)
+    }
+
+    tl.active[callID] = struct{}{}
+    return nil
+}
+
+// Release frees the slot of a test call, unknown calls are ignored
+func (tl *TestTrafficLimiter) Release(callID string) {
+    tl.mu.Lock()
+    delete(tl.active, callID)
+    tl.mu.Unlock()
+}
+
+// Active returns the number of test calls in progress
+func (tl *TestTrafficLimiter) Active() int {
+    tl.mu.Lock()
+    defer tl.mu.Unlock()
+    return len(tl.active)
+}
+
+// SetDIDTest marks DIDs as test numbers or returns them to production
+func (r *Router) SetDIDTest(ctx context.Context, numbers []string, isTest bool) (int64, error) {
+    var updated int64
+    for _, number := range numbers {
+        result, err := r.db.ExecContext(ctx, "UPDATE dids SET is_test = ? WHERE number = ?", isTest, number)
+        if err != nil {
+            return updated, errors.Wrap(err, errors.ErrDatabase, "failed to update DID").
+                WithContext("number", number)
+        }
+        rows, _ := result.RowsAffected()
+        updated += rows
+    }
+
+    r.cache.Delete(ctx, "did:stats")
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "dids":    len(numbers),
+        "updated": updated,
+        "test":    isTest,
+    }).Info("DID test flag updated")
+
+    return updated, nil
+}
+
+// SetRouteTest marks a route as test traffic or returns it to production
+func (r *Router) SetRouteTest(ctx context.Context, name string, isTest bool) error {
+    if _, err := r.GetRoute(ctx, name); err != nil {
+        return err
+    }
+
+    if _, err := r.db.ExecContext(ctx, "UPDATE provider_routes SET is_test = ? WHERE name = ?", isTest, name); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to update route")
+    }
+
+    r.flushRoutes(ctx)
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "route": name,
+        "test":  isTest,
+    }).Info("Route test flag updated")
+
+    return nil
+}
+
+// testCallLabels tags the test call counter
+func testCallLabels(record *models.CallRecord, outcome string) map[string]string {
+    return map[string]string{
+        "route":   record.RouteName,
+        "outcome": outcome,
+    }
+}
@@ -0,0 +1,222 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// VerificationReportFilter narrows down a verification report
+type VerificationReportFilter struct {
+    Since    time.Time
+    Until    time.Time
+    Provider string
+    Tags     models.Tags // verified provider carries the tags
+    Step     string
+    Interval string // hour or day
+}
+
+// verificationProviderExpr resolves the provider that was verified at each step
+const verificationProviderExpr = `COALESCE(CASE cv.verification_step
+            WHEN 'S3_TO_S2' THEN cr.intermediate_provider
+            WHEN 'S4_TO_S2' THEN cr.final_provider
+            ELSE cr.inbound_provider
+        END, 'unknown')`
+
+// verificationReasonExpr strips the expected/received values from a failure reason
+const verificationReasonExpr = `COALESCE(NULLIF(SUBSTRING_INDEX(cv.failure_reason, ':', 1), ''), 'unknown')`
+
+// GetVerificationReport aggregates call_verifications by step, failure reason and provider
+func (r *Router) GetVerificationReport(ctx context.Context, filter VerificationReportFilter) (*models.VerificationReport, error) {
+    if filter.Until.IsZero() {
+        filter.Until = time.Now()
+    }
+    if filter.Since.IsZero() {
+        filter.Since = filter.Until.Add(-24 * time.Hour)
+    }
+    if filter.Interval == "" {
+        filter.Interval = "hour"
+    }
+
+    var bucketFormat string
+    switch filter.Interval {
+    case "hour":
+        bucketFormat = "%Y-%m-%d %H:00:00"
+    case "day":
+        bucketFormat = "%Y-%m-%d 00:00:00"
+    default:
+        return nil, errors.New(errors.ErrInternal, "invalid report interval").
+            WithContext("interval", filter.Interval)
+    }
+
+    where, args := buildVerificationWhere(filter)
+
+    report := &models.VerificationReport{
+        Since:    filter.Since,
+        Until:    filter.Until,
+        Interval: filter.Interval,
+    }
+
+    // Overall totals
+    query := fmt.Sprintf(`
+        SELECT COUNT(*), COALESCE(SUM(CASE WHEN cv.verified = 0 THEN 1 ELSE 0 END), 0)
+        FROM call_verifications cv
+        LEFT JOIN call_records cr ON cr.call_id = cv.call_id
+        %s`, where)
+
+    if err := r.db.QueryRowContext(ctx, query, args...).Scan(&report.Total, &report.Failed); err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query verification totals")
+    }
+    report.FailureRate = failureRate(report.Total, report.Failed)
+
+    var err error
+    if report.ByStep, err = r.queryVerificationBreakdown(ctx, "cv.verification_step", where, args); err != nil {
+        return nil, err
+    }
+
+    if report.ByProvider, err = r.queryVerificationBreakdown(ctx, verificationProviderExpr, where, args); err != nil {
+        return nil, err
+    }
+
+    // Reasons only make sense for failed verifications
+    failedWhere := where + " AND cv.verified = 0"
+    if report.ByReason, err = r.queryVerificationBreakdown(ctx, verificationReasonExpr, failedWhere, args); err != nil {
+        return nil, err
+    }
+
+    if report.Failures, err = r.queryVerificationFailures(ctx, failedWhere, args); err != nil {
+        return nil, err
+    }
+
+    if report.Timeline, err = r.queryVerificationTimeline(ctx, bucketFormat, where, args); err != nil {
+        return nil, err
+    }
+
+    return report, nil
+}
+
+func buildVerificationWhere(filter VerificationReportFilter) (string, []interface{}) {
+    conditions := []string{"cv.created_at >= ?", "cv.created_at < ?"}
+    args := []interface{}{filter.Since, filter.Until}
+
+    if filter.Step != "" {
+        conditions = append(conditions, "cv.verification_step = ?")
+        args = append(args, filter.Step)
+    }
+
+    if filter.Provider != "" {
+        conditions = append(conditions, verificationProviderExpr+" = ?")
+        args = append(args, filter.Provider)
+    }
+
+    if len(filter.Tags) > 0 {
+        tagConditions, tagArgs := models.TagSelectorSQL("pt.provider_name = "+verificationProviderExpr, filter.Tags)
+        conditions = append(conditions, tagConditions...)
+        args = append(args, tagArgs...)
+    }
+
+    return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (r *Router) queryVerificationBreakdown(ctx context.Context, keyExpr, where string, args []interface{}) ([]*models.VerificationBreakdown, error) {
+    query := fmt.Sprintf(`
+        SELECT %s AS report_key,
+            COUNT(*) AS total,
+            SUM(CASE WHEN cv.verified = 0 THEN 1 ELSE 0 END) AS failed
+        FROM call_verifications cv
+        LEFT JOIN call_records cr ON cr.call_id = cv.call_id
+        %s
+        GROUP BY report_key
+        ORDER BY failed DESC, total DESC`, keyExpr, where)
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query verification breakdown")
+    }
+    defer rows.Close()
+
+    var breakdown []*models.VerificationBreakdown
+    for rows.Next() {
+        var b models.VerificationBreakdown
+        if err := rows.Scan(&b.Key, &b.Total, &b.Failed); err != nil {
+            continue
+        }
+        b.FailureRate = failureRate(b.Total, b.Failed)
+        breakdown = append(breakdown, &b)
+    }
+
+    return breakdown, rows.Err()
+}
+
+func (r *Router) queryVerificationFailures(ctx context.Context, where string, args []interface{}) ([]*models.VerificationFailure, error) {
+    query := fmt.Sprintf(`
+        SELECT %s AS provider, cv.verification_step, %s AS reason,
+            COUNT(*) AS failures, MAX(cv.created_at) AS last_seen
+        FROM call_verifications cv
+        LEFT JOIN call_records cr ON cr.call_id = cv.call_id
+        %s
+        GROUP BY provider, cv.verification_step, reason
+        ORDER BY failures DESC`, verificationProviderExpr, verificationReasonExpr, where)
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query verification failures")
+    }
+    defer rows.Close()
+
+    var failures []*models.VerificationFailure
+    for rows.Next() {
+        var f models.VerificationFailure
+        if err := rows.Scan(&f.Provider, &f.Step, &f.Reason, &f.Count, &f.LastSeen); err != nil {
+            continue
+        }
+        failures = append(failures, &f)
+    }
+
+    return failures, rows.Err()
+}
+
+func (r *Router) queryVerificationTimeline(ctx context.Context, bucketFormat, where string, args []interface{}) ([]*models.VerificationBucket, error) {
+    query := fmt.Sprintf(`
+        SELECT DATE_FORMAT(cv.created_at, '%s') AS period, cv.verification_step,
+            COUNT(*) AS total,
+            SUM(CASE WHEN cv.verified = 0 THEN 1 ELSE 0 END) AS failed
+        FROM call_verifications cv
+        LEFT JOIN call_records cr ON cr.call_id = cv.call_id
+        %s
+        GROUP BY period, cv.verification_step
+        ORDER BY period`, bucketFormat, where)
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query verification timeline")
+    }
+    defer rows.Close()
+
+    var timeline []*models.VerificationBucket
+    for rows.Next() {
+        var b models.VerificationBucket
+        var period sql.NullString
+        if err := rows.Scan(&period, &b.Step, &b.Total, &b.Failed); err != nil {
+            continue
+        }
+        if t, err := time.Parse("2006-01-02 15:04:05", period.String); err == nil {
+            b.PeriodStart = t
+        }
+        timeline = append(timeline, &b)
+    }
+
+    return timeline, rows.Err()
+}
+
+func failureRate(total, failed int64) float64 {
+    if total == 0 {
+        return 0
+    }
+    return float64(failed) / float64(total) * 100
+}
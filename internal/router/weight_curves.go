@@ -0,0 +1,354 @@
+package router
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/hamzaKhattat/ara-production-system/internal/audit"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// WeightCurveConfig controls the scheduler applying route weight curves
+type WeightCurveConfig struct {
+    Enabled  bool
+    Interval time.Duration // how often curves are reloaded and the hour's weights applied
+}
+
+func (c *WeightCurveConfig) setDefaults() {
+    if c.Interval <= 0 {
+        c.Interval = time.Minute
+    }
+}
+
+// curveWeights are the weights the scheduler applied, by route and provider
+type curveWeights map[string]map[string]int
+
+// SetWeightCurve creates or replaces the weight curve of a provider on a route
+func (r *Router) SetWeightCurve(ctx context.Context, c *models.WeightCurve, user string) error {
+    for _, w := range c.Weights {
+        if w < 0 {
+            return errors.New(errors.ErrInternal, "curve weights can't be negative")
+        }
+    }
+    if c.Timezone != "" {
+        if _, err := time.LoadLocation(c.Timezone); err != nil {
+            return errors.New(errors.ErrInternal, "unknown time zone").WithContext("timezone", c.Timezone)
+        }
+    }
+
+    route, err := r.GetRoute(ctx, c.RouteName)
+    if err != nil {
+        return err
+    }
+    if !r.routeDials(ctx, route, c.ProviderName) {
+        return errors.New(errors.ErrProviderNotFound, "provider is not dialed by the route").
+            WithContext("route", c.RouteName).
+            WithContext("provider", c.ProviderName)
+    }
+
+    var old interface{}
+    if curves, err := r.queryWeightCurves(ctx, "WHERE route_name = ? AND provider_name = ?", c.RouteName, c.ProviderName); err != nil {
+        return err
+    } else if len(curves) > 0 {
+        old = curves[0]
+    }
+
+    weights, _ := json.Marshal(c.Weights)
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    _, err = tx.ExecContext(ctx, `
+        INSERT INTO route_weight_curves (route_name, provider_name, weights, timezone)
+        VALUES (?, ?, ?, ?)
+        ON DUPLICATE KEY UPDATE weights = VALUES(weights), timezone = VALUES(timezone)`,
+        c.RouteName, c.ProviderName, string(weights), nullString(c.Timezone))
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to set weight curve")
+    }
+
+    action := "update"
+    if old == nil {
+        action = "create"
+    }
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "route_weight_curve",
+        EntityType: "route",
+        EntityID:   c.RouteName,
+        UserID:     user,
+        Action:     action,
+        OldValue:   old,
+        NewValue:   c,
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+
+    logger.WithContext(ctx).WithFields(map[string]interface{}{
+        "route":    c.RouteName,
+        "provider": c.ProviderName,
+    }).Info("Route weight curve set")
+    return nil
+}
+
+// ListWeightCurves returns the weight curves of a route, or of every route
+// when route is empty
+func (r *Router) ListWeightCurves(ctx context.Context, route string) ([]*models.WeightCurve, error) {
+    if route == "" {
+        return r.queryWeightCurves(ctx, "")
+    }
+    return r.queryWeightCurves(ctx, "WHERE route_name = ?", route)
+}
+
+// DeleteWeightCurve removes the weight curve of a provider on a route, which
+// goes back to its own weight at the next scheduler run
+func (r *Router) DeleteWeightCurve(ctx context.Context, route, provider, user string) error {
+    curves, err := r.queryWeightCurves(ctx, "WHERE route_name = ? AND provider_name = ?", route, provider)
+    if err != nil {
+        return err
+    }
+    if len(curves) == 0 {
+        return errors.New(errors.ErrRouteNotFound, "route has no weight curve for the provider").
+            WithContext("route", route).
+            WithContext("provider", provider)
+    }
+
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to start transaction")
+    }
+    defer tx.Rollback()
+
+    if _, err := tx.ExecContext(ctx, "DELETE FROM route_weight_curves WHERE route_name = ? AND provider_name = ?", route, provider); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to delete weight curve")
+    }
+
+    if err := audit.Record(ctx, tx, audit.Entry{
+        EventType:  "route_weight_curve",
+        EntityType: "route",
+        EntityID:   route,
+        UserID:     user,
+        Action:     "delete",
+        OldValue:   curves[0],
+    }); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(); err != nil {
+        return errors.Wrap(err, errors.ErrDatabase, "failed to commit transaction")
+    }
+    return nil
+}
+
+// RunWeightCurves applies the weight of the current hour of every curve until
+// the context ends. Each change is logged once per node and recorded on the
+// provider's timeline by one of them.
+func (r *Router) RunWeightCurves(ctx context.Context) {
+    config := r.config.WeightCurves
+    config.setDefaults()
+
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+
+    for {
+        r.applyWeightCurves(ctx, time.Now())
+
+        select {
+        case <-ticker.C:
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func (r *Router) applyWeightCurves(ctx context.Context, now time.Time) {
+    log := logger.WithContext(ctx)
+
+    curves, err := r.ListWeightCurves(ctx, "")
+    if err != nil {
+        log.WithError(err).Warn("Failed to load route weight curves")
+        return
+    }
+
+    applied := make(curveWeights)
+    for _, c := range curves {
+        if applied[c.RouteName] == nil {
+            applied[c.RouteName] = make(map[string]int)
+        }
+        applied[c.RouteName][c.ProviderName] = c.WeightAt(now)
+    }
+
+    var previous curveWeights
+    if p := r.curveWeights.Swap(&applied); p != nil {
+        previous = *p
+    }
+
+    type change struct {
+        route, provider string
+        to              int
+        removed         bool
+    }
+    var changes []change
+    for route, providers := range applied {
+        for provider, weight := range providers {
+            if from, known := previous[route][provider]; !known || from != weight {
+                changes = append(changes, change{route: route, provider: provider, to: weight})
+            }
+        }
+    }
+    for route, providers := range previous {
+        for provider := range providers {
+            if _, still := applied[route][provider]; !still {
+                changes = append(changes, change{route: route, provider: provider, removed: true})
+            }
+        }
+    }
+    if len(changes) == 0 {
+        return
+    }
+    sort.Slice(changes, func(i, j int) bool {
+        if changes[i].route != changes[j].route {
+            return changes[i].route < changes[j].route
+        }
+        return changes[i].provider < changes[j].provider
+    })
+
+    hour := now.Truncate(time.Hour).Unix()
+    for _, c := range changes {
+        fields := map[string]interface{}{
+            "route":    c.route,
+            "provider": c.provider,
+            "weight":   c.to,
+        }
+        detail := fmt.Sprintf("route %s weight curve: %d", c.route, c.to)
+        if c.removed {
+            log.WithFields(fields).Info("Route weight curve removed, provider weight restored")
+            detail = fmt.Sprintf("route %s weight curve removed", c.route)
+        } else {
+            log.WithFields(fields).Info("Route weight curve applied")
+            r.metrics.SetGauge("router_curve_weight", float64(c.to), map[string]string{"route": c.route, "provider": c.provider})
+        }
+
+        // Every node applies the curves, the first to take the change records
+        // it on the timeline. The lock is left to expire so no other does.
+        if previous == nil {
+            continue
+        }
+        key := fmt.Sprintf("weight_curves:%s:%s:%d:%d:%t", c.route, c.provider, hour, c.to, c.removed)
+        if _, err := r.cache.Lock(ctx, key, 2*time.Hour); err != nil {
+            continue
+        }
+        if err := audit.RecordProviderEvent(ctx, r.db, models.ProviderEvent{
+            ProviderName: c.provider,
+            EventType:    models.ProviderEventWeightsChanged,
+            Actor:        audit.SystemActor,
+            Detail:       detail,
+        }); err != nil {
+            log.WithError(err).Warn("Failed to record weight curve change")
+        }
+    }
+}
+
+// routeDials reports whether a provider can be picked for an outbound leg of the route
+func (r *Router) routeDials(ctx context.Context, route *models.ProviderRoute, provider string) bool {
+    for _, p := range r.routeCandidates(ctx, route) {
+        if p.Name == provider {
+            return true
+        }
+    }
+    return false
+}
+
+// routeCandidates returns the providers that can be picked for the outbound
+// legs of the route
+func (r *Router) routeCandidates(ctx context.Context, route *models.ProviderRoute) []*models.Provider {
+    var providers []*models.Provider
+    for _, leg := range []struct {
+        spec    string
+        isGroup bool
+    }{
+        {route.IntermediateProvider, route.IntermediateIsGroup},
+        {route.FinalProvider, route.FinalIsGroup},
+    } {
+        var candidates []*models.Provider
+        if leg.isGroup {
+            candidates, _ = r.groupMembers(ctx, leg.spec)
+        } else {
+            candidates, _ = r.loadBalancer.getAvailableProviders(ctx, leg.spec)
+        }
+        for _, p := range candidates {
+            if !route.Excludes(p.Name) {
+                providers = append(providers, p)
+            }
+        }
+    }
+    return providers
+}
+
+// routeCurveWeights returns the weights the scheduler applied on a route, nil
+// when it has no curves
+func (r *Router) routeCurveWeights(route string) map[string]int {
+    applied := r.curveWeights.Load()
+    if applied == nil {
+        return nil
+    }
+    return (*applied)[route]
+}
+
+// applyCurveWeights returns the providers with the weights of their curves.
+// Providers are copied, the cached ones are shared.
+func applyCurveWeights(providers []*models.Provider, weights map[string]int) []*models.Provider {
+    if len(weights) == 0 {
+        return providers
+    }
+    result := make([]*models.Provider, len(providers))
+    for i, p := range providers {
+        weight, ok := weights[p.Name]
+        if !ok {
+            result[i] = p
+            continue
+        }
+        copied := *p
+        copied.Weight = weight
+        result[i] = &copied
+    }
+    return result
+}
+
+func (r *Router) queryWeightCurves(ctx context.Context, where string, args ...interface{}) ([]*models.WeightCurve, error) {
+    rows, err := r.db.QueryContext(ctx, `
+        SELECT route_name, provider_name, weights, COALESCE(timezone, ''), updated_at
+        FROM route_weight_curves
+        `+where+`
+        ORDER BY route_name, provider_name`, args...)
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrDatabase, "failed to query weight curves")
+    }
+    defer rows.Close()
+
+    var curves []*models.WeightCurve
+    for rows.Next() {
+        var c models.WeightCurve
+        var weights string
+        if err := rows.Scan(&c.RouteName, &c.ProviderName, &weights, &c.Timezone, &c.UpdatedAt); err != nil {
+            continue
+        }
+        if err := json.Unmarshal([]byte(weights), &c.Weights); err != nil {
+            logger.WithContext(ctx).WithError(err).WithField("route", c.RouteName).Warn("Invalid weight curve")
+            continue
+        }
+        curves = append(curves, &c)
+    }
+    return curves, rows.Err()
+}
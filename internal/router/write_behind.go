@@ -0,0 +1,235 @@
+package router
+
+import (
+    "context"
+    "database/sql"
+    "hash/fnv"
+    "sync"
+    "sync/atomic"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+// WriteBehindConfig controls the asynchronous writer for non-critical updates
+type WriteBehindConfig struct {
+    Enabled        bool
+    Lanes          int           // ordered queues, writes with the same key share a lane
+    QueueSize      int           // capacity of each lane
+    BatchSize      int           // writes committed per transaction
+    FlushInterval  time.Duration // max time a write waits for its batch
+    EnqueueTimeout time.Duration // how long Submit waits on a full lane before reporting backpressure
+}
+
+type writeOp struct {
+    key   string
+    query string
+    args  []interface{}
+}
+
+// WriteBehind queues non-critical writes (verifications, provider health) and
+// commits them in batches. Writes for the same key are applied in submission order.
+type WriteBehind struct {
+    db      *sql.DB
+    metrics MetricsInterface
+    config  WriteBehindConfig
+    
+    lanes   []chan writeOp
+    pending int64
+    wg      sync.WaitGroup
+    
+    mu     sync.RWMutex
+    closed bool
+}
+
+// NewWriteBehind creates a new write-behind queue
+func NewWriteBehind(db *sql.DB, metrics MetricsInterface, config WriteBehindConfig) *WriteBehind {
+    if config.Lanes <= 0 {
+        config.Lanes = 4
+    }
+    if config.QueueSize <= 0 {
+        config.QueueSize = 1000
+    }
+    if config.BatchSize <= 0 {
+        config.BatchSize = 50
+    }
+    if config.FlushInterval <= 0 {
+        config.FlushInterval = 100 * time.Millisecond
+    }
+    if config.EnqueueTimeout <= 0 {
+        config.EnqueueTimeout = 50 * time.Millisecond
+    }
+    
+    wb := &WriteBehind{
+        db:      db,
+        metrics: metrics,
+        config:  config,
+    }
+    
+    if config.Enabled {
+        wb.lanes = make([]chan writeOp, config.Lanes)
+        for i := range wb.lanes {
+            wb.lanes[i] = make(chan writeOp, config.QueueSize)
+            wb.wg.Add(1)
+            go wb.run(wb.lanes[i])
+        }
+    }
+    
+    return wb
+}
+
+// Submit queues a write. When the queue is disabled or closed the write is
+// executed inline. A full lane blocks the caller until it has room, which slows
+// it down instead of dropping data or writing ahead of queued writes for the
+// same key; lanes still full after EnqueueTimeout are logged.
+func (wb *WriteBehind) Submit(ctx context.Context, key, query string, args ...interface{}) {
+    op := writeOp{key: key, query: query, args: args}
+    
+    wb.mu.RLock()
+    if !wb.config.Enabled || wb.closed {
+        wb.mu.RUnlock()
+        wb.execInline(ctx, op)
+        return
+    }
+    
+    lane := wb.lanes[wb.laneFor(key)]
+    select {
+    case lane <- op:
+        wb.mu.RUnlock()
+        wb.queued(1)
+        return
+    default:
+    }
+    
+    timer := time.NewTimer(wb.config.EnqueueTimeout)
+    select {
+    case lane <- op:
+        timer.Stop()
+        wb.mu.RUnlock()
+        wb.queued(1)
+        return
+    case <-timer.C:
+    }
+    
+    // Backpressure: the caller waits for the lane, the worker keeps draining
+    // it and Close waits for us to let go of the lock
+    logger.WithContext(ctx).WithField("key", key).Warn("Write-behind queue full, waiting for room")
+    wb.metrics.IncrementCounter("write_behind_events", map[string]string{"event": "overflow"})
+    select {
+    case lane <- op:
+        wb.mu.RUnlock()
+        wb.queued(1)
+    case <-ctx.Done():
+        wb.mu.RUnlock()
+        wb.metrics.IncrementCounter("write_behind_events", map[string]string{"event": "write_failed"})
+        logger.WithContext(ctx).WithError(ctx.Err()).WithField("key", key).Warn("Write-behind write dropped")
+    }
+}
+
+// Close stops accepting writes and flushes everything still queued
+func (wb *WriteBehind) Close() {
+    wb.mu.Lock()
+    if wb.closed {
+        wb.mu.Unlock()
+        return
+    }
+    wb.closed = true
+    for _, lane := range wb.lanes {
+        close(lane)
+    }
+    wb.mu.Unlock()
+    
+    wb.wg.Wait()
+}
+
+// Pending returns the number of queued writes
+func (wb *WriteBehind) Pending() int64 {
+    return atomic.LoadInt64(&wb.pending)
+}
+
+func (wb *WriteBehind) laneFor(key string) int {
+    h := fnv.New32a()
+    h.Write([]byte(key))
+    return int(h.Sum32() % uint32(len(wb.lanes)))
+}
+
+func (wb *WriteBehind) queued(delta int64) {
+    pending := atomic.AddInt64(&wb.pending, delta)
+    wb.metrics.SetGauge("write_behind_pending", float64(pending), nil)
+}
+
+func (wb *WriteBehind) run(lane chan writeOp) {
+    defer wb.wg.Done()
+    
+    ticker := time.NewTicker(wb.config.FlushInterval)
+    defer ticker.Stop()
+    
+    batch := make([]writeOp, 0, wb.config.BatchSize)
+    
+    for {
+        select {
+        case op, ok := <-lane:
+            if !ok {
+                wb.flush(batch)
+                return
+            }
+            batch = append(batch, op)
+            if len(batch) >= wb.config.BatchSize {
+                wb.flush(batch)
+                batch = batch[:0]
+            }
+        case <-ticker.C:
+            if len(batch) > 0 {
+                wb.flush(batch)
+                batch = batch[:0]
+            }
+        }
+    }
+}
+
+// flush commits a batch in one transaction, falling back to single writes on failure
+func (wb *WriteBehind) flush(batch []writeOp) {
+    if len(batch) == 0 {
+        return
+    }
+    defer wb.queued(-int64(len(batch)))
+    
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+    
+    err := wb.execBatch(ctx, batch)
+    if err == nil {
+        wb.metrics.IncrementCounter("write_behind_events", map[string]string{"event": "batch_committed"})
+        return
+    }
+    
+    wb.metrics.IncrementCounter("write_behind_events", map[string]string{"event": "batch_failed"})
+    logger.WithError(err).WithField("size", len(batch)).Warn("Write-behind batch failed, retrying writes one by one")
+    
+    for _, op := range batch {
+        wb.execInline(ctx, op)
+    }
+}
+
+func (wb *WriteBehind) execBatch(ctx context.Context, batch []writeOp) error {
+    tx, err := wb.db.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    
+    for _, op := range batch {
+        if _, err := tx.ExecContext(ctx, op.query, op.args...); err != nil {
+            return err
+        }
+    }
+    
+    return tx.Commit()
+}
+
+func (wb *WriteBehind) execInline(ctx context.Context, op writeOp) {
+    if _, err := wb.db.ExecContext(ctx, op.query, op.args...); err != nil {
+        wb.metrics.IncrementCounter("write_behind_events", map[string]string{"event": "write_failed"})
+        logger.WithContext(ctx).WithError(err).WithField("key", op.key).Warn("Write-behind write failed")
+    }
+}
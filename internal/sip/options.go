@@ -0,0 +1,232 @@
+// Package sip sends the SIP OPTIONS requests provider health checks are made
+// of. It speaks just enough SIP for that: a single request over UDP, TCP or
+// TLS, without authentication or retransmissions, read until its final response.
+package sip
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "crypto/rand"
+    "crypto/tls"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net"
+    "strconv"
+    "strings"
+    "time"
+    
+    "github.com/hamzaKhattat/ara-production-system/pkg/errors"
+)
+
+// DefaultTimeout bounds an OPTIONS request when the caller sets no deadline
+const DefaultTimeout = 5 * time.Second
+
+// OptionsRequest is an OPTIONS request to a SIP peer
+type OptionsRequest struct {
+    Host      string
+    Port      int    // 5060, or 5061 for TLS, when zero
+    Transport string // udp, tcp or tls, udp when empty
+    FromUser  string // user part of the From URI, ara-health when empty
+    UserAgent string
+    Timeout   time.Duration
+    TLS       *tls.Config // for the tls transport, verifying Host when nil
+}
+
+// OptionsResponse is the final response to an OPTIONS request
+type OptionsResponse struct {
+    StatusCode int
+    Reason     string
+    Server     string // Server or User-Agent header of the peer
+    Latency    time.Duration
+}
+
+// Reachable reports whether the peer is up to take calls: any final response
+// shows it is there, except 503 which peers send while overloaded or in
+// maintenance
+func (r *OptionsResponse) Reachable() bool {
+    return r.StatusCode >= 200 && r.StatusCode != 503
+}
+
+// SendOptions sends an OPTIONS request and waits for its final response,
+// provisional responses are skipped
+func SendOptions(ctx context.Context, req OptionsRequest) (*OptionsResponse, error) {
+    transport := strings.ToLower(req.Transport)
+    if transport == "" {
+        transport = "udp"
+    }
+    port := req.Port
+    if port == 0 {
+        port = 5060
+        if transport == "tls" {
+            port = 5061
+        }
+    }
+    timeout := req.Timeout
+    if timeout <= 0 {
+        timeout = DefaultTimeout
+    }
+    
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+    deadline, _ := ctx.Deadline()
+    
+    address := net.JoinHostPort(req.Host, strconv.Itoa(port))
+    start := time.Now()
+    
+    var conn net.Conn
+    var err error
+    dialer := &net.Dialer{}
+    switch transport {
+    case "udp", "tcp":
+        conn, err = dialer.DialContext(ctx, transport, address)
+    case "tls":
+        config := req.TLS
+        if config == nil {
+            config = &tls.Config{ServerName: req.Host, MinVersion: tls.VersionTLS12}
+        }
+        conn, err = (&tls.Dialer{NetDialer: dialer, Config: config}).DialContext(ctx, "tcp", address)
+    default:
+        return nil, errors.New(errors.ErrInternal, fmt.Sprintf("unsupported SIP transport %q", req.Transport))
+    }
+    if err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to connect to SIP peer").WithContext("address", address)
+    }
+    defer conn.Close()
+    conn.SetDeadline(deadline)
+    
+    callID := token(16)
+    message := buildOptions(req, transport, address, conn.LocalAddr(), callID)
+    if _, err := conn.Write([]byte(message)); err != nil {
+        return nil, errors.Wrap(err, errors.ErrInternal, "failed to send SIP OPTIONS").WithContext("address", address)
+    }
+    
+    stream := bufio.NewReader(conn)
+    for {
+        var resp *OptionsResponse
+        var respCallID string
+        if transport == "udp" {
+            buf := make([]byte, 65535)
+            n, err := conn.Read(buf)
+            if err != nil {
+                return nil, readError(err, address)
+            }
+            resp, respCallID, err = parseResponse(bufio.NewReader(bytes.NewReader(buf[:n])))
+            if err != nil {
+                // Stray datagrams on the socket aren't ours, keep waiting
+                continue
+            }
+        } else {
+            if resp, respCallID, err = parseResponse(stream); err != nil {
+                return nil, readError(err, address)
+            }
+        }
+    
+        if respCallID != callID || resp.StatusCode < 200 {
+            continue
+        }
+        resp.Latency = time.Since(start)
+        return resp, nil
+    }
+}
+
+func readError(err error, address string) error {
+    if ne, ok := err.(net.Error); ok && ne.Timeout() {
+        return errors.New(errors.ErrInternal, "no response to SIP OPTIONS").WithContext("address", address)
+    }
+    return errors.Wrap(err, errors.ErrInternal, "failed to read SIP response").WithContext("address", address)
+}
+
+func buildOptions(req OptionsRequest, transport, address string, local net.Addr, callID string) string {
+    fromUser := req.FromUser
+    if fromUser == "" {
+        fromUser = "ara-health"
+    }
+    localHost, localPort, _ := net.SplitHostPort(local.String())
+    localAddress := net.JoinHostPort(localHost, localPort)
+    
+    scheme := "sip"
+    if transport == "tls" {
+        scheme = "sips"
+    }
+    uri := fmt.Sprintf("%s:%s", scheme, address)
+    
+    var b strings.Builder
+    fmt.Fprintf(&b, "OPTIONS %s SIP/2.0\r\n", uri)
+    fmt.Fprintf(&b, "Via: SIP/2.0/%s %s;branch=z9hG4bK%s;rport\r\n", strings.ToUpper(transport), localAddress, token(8))
+    fmt.Fprintf(&b, "Max-Forwards: 70\r\n")
+    fmt.Fprintf(&b, "From: <%s:%s@%s>;tag=%s\r\n", scheme, fromUser, localAddress, token(6))
+    fmt.Fprintf(&b, "To: <%s>\r\n", uri)
+    fmt.Fprintf(&b, "Call-ID: %s\r\n", callID)
+    fmt.Fprintf(&b, "CSeq: 1 OPTIONS\r\n")
+    fmt.Fprintf(&b, "Contact: <%s:%s@%s>\r\n", scheme, fromUser, localAddress)
+    fmt.Fprintf(&b, "Accept: application/sdp\r\n")
+    if req.UserAgent != "" {
+        fmt.Fprintf(&b, "User-Agent: %s\r\n", req.UserAgent)
+    }
+    fmt.Fprintf(&b, "Content-Length: 0\r\n\r\n")
+    return b.String()
+}
+
+// parseResponse reads a response and returns it with its Call-ID, skipping
+// its body
+func parseResponse(r *bufio.Reader) (*OptionsResponse, string, error) {
+    status, err := r.ReadString('\n')
+    if err != nil {
+        return nil, "", err
+    }
+    parts := strings.SplitN(strings.TrimSpace(status), " ", 3)
+    if len(parts) < 2 || parts[0] != "SIP/2.0" {
+        return nil, "", errors.New(errors.ErrInternal, "malformed SIP status line")
+    }
+    code, err := strconv.Atoi(parts[1])
+    if err != nil {
+        return nil, "", errors.New(errors.ErrInternal, "malformed SIP status code")
+    }
+    
+    resp := &OptionsResponse{StatusCode: code}
+    if len(parts) == 3 {
+        resp.Reason = parts[2]
+    }
+    
+    var callID string
+    length := 0
+    for {
+        line, err := r.ReadString('\n')
+        if err != nil {
+            return nil, "", err
+        }
+        line = strings.TrimRight(line, "\r\n")
+        if line == "" {
+            break
+        }
+    
+        name, value, ok := strings.Cut(line, ":")
+        if !ok {
+            continue
+        }
+        value = strings.TrimSpace(value)
+        switch strings.ToLower(strings.TrimSpace(name)) {
+        case "call-id", "i":
+            callID = value
+        case "server", "user-agent":
+            resp.Server = value
+        case "content-length", "l":
+            length, _ = strconv.Atoi(value)
+        }
+    }
+    
+    if length > 0 {
+        if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+            return nil, "", err
+        }
+    }
+    return resp, callID, nil
+}
+
+func token(n int) string {
+    b := make([]byte, n)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
@@ -16,18 +16,23 @@ const (
     ErrConfiguration    ErrorCode = "CONFIG_ERROR"
     
     // Business logic errors
-    ErrProviderNotFound ErrorCode = "PROVIDER_NOT_FOUND"
-    ErrDIDNotAvailable  ErrorCode = "DID_NOT_AVAILABLE"
-    ErrRouteNotFound    ErrorCode = "ROUTE_NOT_FOUND"
-    ErrCallNotFound     ErrorCode = "CALL_NOT_FOUND"
-    ErrInvalidIP        ErrorCode = "INVALID_IP"
-    ErrAuthFailed       ErrorCode = "AUTH_FAILED"
-    ErrQuotaExceeded    ErrorCode = "QUOTA_EXCEEDED"
+    ErrProviderNotFound   ErrorCode = "PROVIDER_NOT_FOUND"
+    ErrDIDNotAvailable    ErrorCode = "DID_NOT_AVAILABLE"
+    ErrRouteNotFound      ErrorCode = "ROUTE_NOT_FOUND"
+    ErrCallNotFound       ErrorCode = "CALL_NOT_FOUND"
+    ErrInvalidIP          ErrorCode = "INVALID_IP"
+    ErrAuthFailed         ErrorCode = "AUTH_FAILED"
+    ErrQuotaExceeded      ErrorCode = "QUOTA_EXCEEDED"
+    ErrDestinationBlocked ErrorCode = "DESTINATION_BLOCKED"
+    ErrCallsSuspended     ErrorCode = "CALLS_SUSPENDED"
+    ErrRateLimited        ErrorCode = "RATE_LIMITED"
+    ErrReadOnly           ErrorCode = "READ_ONLY"
     
     // AGI errors
-    ErrAGITimeout       ErrorCode = "AGI_TIMEOUT"
-    ErrAGIInvalidCmd    ErrorCode = "AGI_INVALID_COMMAND"
-    ErrAGIConnection    ErrorCode = "AGI_CONNECTION_ERROR"
+    ErrAGITimeout          ErrorCode = "AGI_TIMEOUT"
+    ErrAGIInvalidCmd       ErrorCode = "AGI_INVALID_COMMAND"
+    ErrAGIConnection       ErrorCode = "AGI_CONNECTION_ERROR"
+    ErrAGIMalformedRequest ErrorCode = "AGI_MALFORMED_REQUEST"
 )
 
 type AppError struct {
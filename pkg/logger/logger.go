@@ -3,7 +3,9 @@ package logger
 import (
     "context"
     "fmt"
+    "io"
     "os"
+    "strings"
     "time"
     
     "github.com/sirupsen/logrus"
@@ -17,6 +19,10 @@ type Logger struct {
 
 var (
     defaultLogger *Logger
+    
+    // String values of these fields are passed through mask, nil when nothing is masked
+    maskedFields map[string]bool
+    mask         func(string) string
 )
 
 type Config struct {
@@ -25,6 +31,10 @@ type Config struct {
     Output     string
     File       FileConfig
     Fields     map[string]interface{}
+    
+    // Fields whose string values are written through Mask, such as caller numbers
+    MaskFields []string
+    Mask       func(string) string
 }
 
 type FileConfig struct {
@@ -88,6 +98,15 @@ func Init(cfg Config) error {
         fields[k] = v
     }
     
+    maskedFields, mask = nil, nil
+    if cfg.Mask != nil && len(cfg.MaskFields) > 0 {
+        maskedFields = make(map[string]bool, len(cfg.MaskFields))
+        for _, f := range cfg.MaskFields {
+            maskedFields[strings.ToLower(f)] = true
+        }
+        mask = cfg.Mask
+    }
+    
     defaultLogger = &Logger{
         Logger: log,
         fields: fields,
@@ -123,12 +142,14 @@ func (l *Logger) WithFields(fields map[string]interface{}) *Logger {
         newFields[k] = v
     }
     for k, v := range fields {
+        if s, ok := v.(string); ok && maskedFields[strings.ToLower(k)] {
+            v = mask(s)
+        }
         newFields[k] = v
     }
     
-    entry := l.Logger.WithFields(newFields)
     return &Logger{
-        Logger: entry.Logger,
+        Logger: l.Logger,
         fields: newFields,
     }
 }
@@ -144,21 +165,29 @@ func (l *Logger) WithError(err error) *Logger {
     })
 }
 
-// Log methods that use the logger fields
+// Log methods that use the logger fields, lines below the level cost no entry
 func (l *Logger) Debug(args ...interface{}) {
-    l.Logger.WithFields(l.fields).Debug(args...)
+    if l.Logger.IsLevelEnabled(logrus.DebugLevel) {
+        l.Logger.WithFields(l.fields).Debug(args...)
+    }
 }
 
 func (l *Logger) Info(args ...interface{}) {
-    l.Logger.WithFields(l.fields).Info(args...)
+    if l.Logger.IsLevelEnabled(logrus.InfoLevel) {
+        l.Logger.WithFields(l.fields).Info(args...)
+    }
 }
 
 func (l *Logger) Warn(args ...interface{}) {
-    l.Logger.WithFields(l.fields).Warn(args...)
+    if l.Logger.IsLevelEnabled(logrus.WarnLevel) {
+        l.Logger.WithFields(l.fields).Warn(args...)
+    }
 }
 
 func (l *Logger) Error(args ...interface{}) {
-    l.Logger.WithFields(l.fields).Error(args...)
+    if l.Logger.IsLevelEnabled(logrus.ErrorLevel) {
+        l.Logger.WithFields(l.fields).Error(args...)
+    }
 }
 
 func (l *Logger) Fatal(args ...interface{}) {
@@ -209,3 +238,10 @@ func WithError(err error) *Logger {
     }
     return &Logger{Logger: logrus.New(), fields: make(logrus.Fields)}
 }
+
+// SetOutput redirects the log, for commands that take over the terminal
+func SetOutput(w io.Writer) {
+    if defaultLogger != nil {
+        defaultLogger.Logger.SetOutput(w)
+    }
+}
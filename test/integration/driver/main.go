@@ -0,0 +1,334 @@
+// Command driver exercises a running router the way Asterisk does: it speaks
+// FastAGI for every leg of the call flow, checks the resulting call state in
+// MySQL and confirms over AMI that Asterisk loaded the generated dialplan.
+package main
+
+import (
+    "bufio"
+    "context"
+    "database/sql"
+    "flag"
+    "fmt"
+    "net"
+    "os"
+    "strings"
+    "time"
+
+    _ "github.com/go-sql-driver/mysql"
+    "github.com/hamzaKhattat/ara-production-system/internal/agivars"
+    "github.com/hamzaKhattat/ara-production-system/internal/ami"
+    "github.com/hamzaKhattat/ara-production-system/internal/ara"
+    dbpkg "github.com/hamzaKhattat/ara-production-system/internal/db"
+    "github.com/hamzaKhattat/ara-production-system/internal/models"
+    "github.com/hamzaKhattat/ara-production-system/pkg/logger"
+)
+
+var (
+    agiAddr  = flag.String("agi", "127.0.0.1:14573", "Router AGI address")
+    dsn      = flag.String("dsn", "asterisk:asterisk@tcp(127.0.0.1:13306)/asterisk_ara_test?parseTime=true&multiStatements=true", "Test database DSN")
+    fixtures = flag.String("fixtures", "", "SQL fixtures to load before running")
+    amiHost  = flag.String("ami-host", "127.0.0.1", "Asterisk AMI host")
+    amiPort  = flag.Int("ami-port", 15038, "Asterisk AMI port")
+    amiUser  = flag.String("ami-user", "routerami", "Asterisk AMI username")
+    amiPass  = flag.String("ami-pass", "routerpass", "Asterisk AMI password")
+    skipAMI  = flag.Bool("skip-ami", false, "Skip the Asterisk checks")
+)
+
+// agiResult holds the variables a router session set on the channel
+type agiResult map[string]string
+
+func main() {
+    flag.Parse()
+
+    if err := logger.Init(logger.Config{Level: "warn", Format: "text", Output: "stdout"}); err != nil {
+        fail("init logger: %v", err)
+    }
+
+    db, err := sql.Open("mysql", *dsn)
+    if err != nil {
+        fail("open database: %v", err)
+    }
+    defer db.Close()
+
+    if *fixtures != "" {
+        loadFixtures(db, *fixtures)
+    }
+
+    checkDialplan(db)
+
+    if !*skipAMI {
+        checkAsterisk()
+    }
+
+    checkCallFlow(db)
+
+    fmt.Println("PASS")
+}
+
+// fixtureProviders mirror the providers in fixtures.sql
+var fixtureProviders = []*models.Provider{
+    {Name: "it-s1", Type: models.ProviderTypeInbound, Host: "10.10.0.1", Port: 5060, AuthType: "ip", Codecs: []string{"ulaw"}},
+    {Name: "it-s3", Type: models.ProviderTypeIntermediate, Host: "10.10.0.3", Port: 5060, AuthType: "ip", Codecs: []string{"ulaw"}},
+    {Name: "it-s4", Type: models.ProviderTypeFinal, Host: "10.10.0.4", Port: 5060, AuthType: "ip", Codecs: []string{"ulaw"}},
+}
+
+// loadFixtures inserts the test data and creates ARA endpoints through the ARA manager
+func loadFixtures(db *sql.DB, path string) {
+    step("load fixtures")
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        fail("read fixtures: %v", err)
+    }
+    if _, err := db.Exec(string(data)); err != nil {
+        fail("load fixtures: %v", err)
+    }
+
+    manager := ara.NewManager(db, dbpkg.GetCache())
+    for _, p := range fixtureProviders {
+        if err := manager.CreateEndpoint(context.Background(), p); err != nil {
+            fail("create endpoint for %s: %v", p.Name, err)
+        }
+    }
+}
+
+// checkDialplan verifies that every router context was generated and calls the AGI server
+func checkDialplan(db *sql.DB) {
+    step("dialplan generation")
+
+    expected := map[string]string{
+        "from-provider-inbound":      agivars.RequestProcessIncoming,
+        "from-provider-intermediate": agivars.RequestProcessReturn,
+        "from-provider-final":        agivars.RequestProcessFinal,
+        "hangup-handler":             agivars.RequestHangup,
+    }
+
+    for context, request := range expected {
+        var count int
+        err := db.QueryRow(`
+            SELECT COUNT(*) FROM extensions
+            WHERE context = ? AND app = 'AGI' AND appdata LIKE ?`,
+            context, "%/"+request).Scan(&count)
+        if err != nil {
+            fail("query extensions: %v", err)
+        }
+        if count != 1 {
+            fail("context %s: expected one AGI %s step, found %d", context, request, count)
+        }
+    }
+
+    // The stored dialplan must agree with the variables the AGI server reads and sets
+    rows, err := db.Query("SELECT app, appdata FROM extensions")
+    if err != nil {
+        fail("query extensions: %v", err)
+    }
+    var steps []agivars.DialplanStep
+    for rows.Next() {
+        var s agivars.DialplanStep
+        if err := rows.Scan(&s.App, &s.AppData); err != nil {
+            fail("scan extension: %v", err)
+        }
+        steps = append(steps, s)
+    }
+    rows.Close()
+    if err := agivars.CheckDialplan(steps); err != nil {
+        fail("AGI variable contract: %v", err)
+    }
+
+    var endpoints int
+    if err := db.QueryRow("SELECT COUNT(*) FROM ps_endpoints WHERE id LIKE 'endpoint-it-%'").Scan(&endpoints); err != nil {
+        fail("query endpoints: %v", err)
+    }
+    if endpoints != 3 {
+        fail("expected 3 ARA endpoints for the fixtures, found %d", endpoints)
+    }
+}
+
+// checkAsterisk confirms Asterisk reads the realtime dialplan and endpoints
+func checkAsterisk() {
+    step("asterisk realtime")
+
+    manager := ami.NewManager(ami.Config{
+        Host:           *amiHost,
+        Port:           *amiPort,
+        Username:       *amiUser,
+        Password:       *amiPass,
+        ActionTimeout:  10 * time.Second,
+        ConnectTimeout: 10 * time.Second,
+        PingInterval:   time.Minute,
+        BufferSize:     100,
+    })
+
+    ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+    defer cancel()
+
+    if err := manager.ConnectWithRetry(ctx, 10); err != nil {
+        fail("connect to AMI: %v", err)
+    }
+    defer manager.Close()
+
+    resp, err := manager.SendAction(ami.Action{
+        Action: "Command",
+        Fields: map[string]string{"Command": "dialplan show from-provider-inbound"},
+    })
+    if err != nil {
+        fail("dialplan show: %v", err)
+    }
+    if resp["Response"] == "Error" {
+        fail("dialplan show failed: %s", resp["Message"])
+    }
+
+    resp, err = manager.SendAction(ami.Action{
+        Action: "Command",
+        Fields: map[string]string{"Command": "pjsip show endpoint endpoint-it-s3"},
+    })
+    if err != nil {
+        fail("pjsip show endpoint: %v", err)
+    }
+    if resp["Response"] == "Error" {
+        fail("endpoint-it-s3 not visible to Asterisk: %s", resp["Message"])
+    }
+}
+
+// checkCallFlow drives a full S1 -> S3 -> S4 call through the AGI server
+func checkCallFlow(db *sql.DB) {
+    callID := fmt.Sprintf("it-%d", time.Now().UnixNano())
+    ani := "15550001111"
+    dnis := "15550002222"
+
+    step("S1 -> S2 processIncoming")
+    incoming := runAGI(agivars.RequestProcessIncoming, map[string]string{
+        "agi_uniqueid":  callID,
+        "agi_callerid":  ani,
+        "agi_extension": dnis,
+        "agi_channel":   "PJSIP/endpoint-it-s1-00000001",
+    }, nil)
+    expectVar(incoming, agivars.RouterStatus, agivars.StatusSuccess)
+    expectVar(incoming, agivars.ANIToSend, dnis)
+    expectVar(incoming, agivars.NextHop, "endpoint-it-s3")
+    did := incoming[agivars.DIDAssigned]
+    if did == "" {
+        fail("no DID assigned")
+    }
+
+    var inUse bool
+    if err := db.QueryRow("SELECT in_use FROM dids WHERE number = ?", did).Scan(&inUse); err != nil || !inUse {
+        fail("DID %s not marked in use (err=%v)", did, err)
+    }
+
+    step("S3 -> S2 processReturn")
+    returned := runAGI(agivars.RequestProcessReturn, map[string]string{
+        "agi_uniqueid":  callID + "-ret",
+        "agi_callerid":  dnis,
+        "agi_extension": incoming[agivars.DNISToSend],
+        "agi_channel":   "PJSIP/endpoint-it-s3-00000002",
+    }, map[string]string{
+        agivars.SourceIP:         "10.10.0.3:5060",
+        agivars.CorrelationToken: incoming[agivars.CorrelationToken],
+    })
+    expectVar(returned, agivars.RouterStatus, agivars.StatusSuccess)
+    expectVar(returned, agivars.ANIToSend, ani)
+    expectVar(returned, agivars.DNISToSend, dnis)
+    expectVar(returned, agivars.NextHop, "endpoint-it-s4")
+
+    step("S3 -> S2 replay is rejected")
+    replayed := runAGI(agivars.RequestProcessReturn, map[string]string{
+        "agi_uniqueid":  callID + "-replay",
+        "agi_callerid":  dnis,
+        "agi_extension": incoming[agivars.DNISToSend],
+        "agi_channel":   "PJSIP/endpoint-it-s3-00000003",
+    }, map[string]string{
+        agivars.SourceIP:         "10.10.0.3:5060",
+        agivars.CorrelationToken: incoming[agivars.CorrelationToken],
+    })
+    expectVar(replayed, agivars.RouterStatus, agivars.StatusFailed)
+
+    step("S4 -> S2 processFinal")
+    runAGI(agivars.RequestProcessFinal, map[string]string{
+        "agi_uniqueid":  callID + "-fin",
+        "agi_callerid":  ani,
+        "agi_extension": dnis,
+        "agi_channel":   "PJSIP/endpoint-it-s4-00000004",
+    }, map[string]string{
+        agivars.SourceIP: "10.10.0.4:5060",
+    })
+
+    var status string
+    if err := db.QueryRow("SELECT status FROM call_records WHERE call_id = ?", callID).Scan(&status); err != nil {
+        fail("load call record: %v", err)
+    }
+    if status != "COMPLETED" {
+        fail("call record status: expected COMPLETED, got %s", status)
+    }
+
+    if err := db.QueryRow("SELECT in_use FROM dids WHERE number = ?", did).Scan(&inUse); err != nil || inUse {
+        fail("DID %s not released after completion (err=%v)", did, err)
+    }
+}
+
+// runAGI plays the Asterisk side of a FastAGI session. GET VARIABLE is
+// answered from vars, SET VARIABLE is recorded and returned.
+func runAGI(request string, headers map[string]string, vars map[string]string) agiResult {
+    conn, err := net.DialTimeout("tcp", *agiAddr, 5*time.Second)
+    if err != nil {
+        fail("connect to AGI server: %v", err)
+    }
+    defer conn.Close()
+    conn.SetDeadline(time.Now().Add(15 * time.Second))
+
+    writer := bufio.NewWriter(conn)
+    fmt.Fprintf(writer, "agi_request: agi://%s/%s\n", *agiAddr, request)
+    for k, v := range headers {
+        fmt.Fprintf(writer, "%s: %s\n", k, v)
+    }
+    writer.WriteString("\n")
+    writer.Flush()
+
+    result := agiResult{}
+    reader := bufio.NewReader(conn)
+
+    for {
+        line, err := reader.ReadString('\n')
+        if err != nil {
+            return result
+        }
+        line = strings.TrimSpace(line)
+
+        switch {
+        case strings.HasPrefix(line, "SET VARIABLE "):
+            parts := strings.SplitN(strings.TrimPrefix(line, "SET VARIABLE "), " ", 2)
+            if len(parts) == 2 {
+                result[parts[0]] = strings.Trim(parts[1], "\"")
+            }
+            writer.WriteString("200 result=1\n")
+        case strings.HasPrefix(line, "GET VARIABLE "):
+            name := strings.TrimPrefix(line, "GET VARIABLE ")
+            if value, ok := vars[name]; ok && value != "" {
+                fmt.Fprintf(writer, "200 result=1 (%s)\n", value)
+            } else {
+                writer.WriteString("200 result=0\n")
+            }
+        case strings.HasPrefix(line, "200 "):
+            // Final response from the router, the session is over
+            return result
+        default:
+            writer.WriteString("510 Invalid or unknown command\n")
+        }
+        writer.Flush()
+    }
+}
+
+func expectVar(result agiResult, name, expected string) {
+    if result[name] != expected {
+        fail("%s: expected %q, got %q (error: %s)", name, expected, result[name], result[agivars.RouterError])
+    }
+}
+
+func step(name string) {
+    fmt.Printf("==> %s\n", name)
+}
+
+func fail(format string, args ...interface{}) {
+    fmt.Fprintf(os.Stderr, "FAIL: "+format+"\n", args...)
+    os.Exit(1)
+}
@@ -0,0 +1,13 @@
+-- Providers, DIDs and a route for the S1 -> S2 -> S3 -> S2 -> S4 call flow
+
+INSERT INTO providers (name, type, host, port, auth_type, active, transport, codecs) VALUES
+    ('it-s1', 'inbound', '10.10.0.1', 5060, 'ip', 1, 'udp', '["ulaw"]'),
+    ('it-s3', 'intermediate', '10.10.0.3', 5060, 'ip', 1, 'udp', '["ulaw"]'),
+    ('it-s4', 'final', '10.10.0.4', 5060, 'ip', 1, 'udp', '["ulaw"]');
+
+INSERT INTO dids (number, provider_name, provider_id, in_use, country) VALUES
+    ('19990000001', 'it-s3', (SELECT id FROM providers WHERE name = 'it-s3'), 0, 'US'),
+    ('19990000002', 'it-s3', (SELECT id FROM providers WHERE name = 'it-s3'), 0, 'US');
+
+INSERT INTO provider_routes (name, inbound_provider, intermediate_provider, final_provider, load_balance_mode, enabled) VALUES
+    ('it-route', 'it-s1', 'it-s3', 'it-s4', 'round_robin', 1);
@@ -0,0 +1,72 @@
+#!/bin/bash
+# Integration test harness: brings up MySQL, Redis and Asterisk (ARA on the
+# test database), initializes the schema with the router binary, starts the
+# AGI server and drives a full call flow against it.
+#
+# Usage: test/integration/run.sh [--keep]
+
+set -euo pipefail
+
+cd "$(dirname "$0")"
+ROOT="$(cd ../.. && pwd)"
+COMPOSE="docker compose -p ara-router-it -f docker-compose.yml"
+CONFIG="$PWD/config.yaml"
+ROUTER="$ROOT/bin/router"
+LOG_DIR="$PWD/logs"
+KEEP=0
+
+[ "${1:-}" = "--keep" ] && KEEP=1
+
+cleanup() {
+    [ -n "${ROUTER_PID:-}" ] && kill "$ROUTER_PID" 2>/dev/null || true
+    if [ "$KEEP" -eq 0 ]; then
+        $COMPOSE down -v --remove-orphans >/dev/null 2>&1 || true
+    fi
+}
+trap cleanup EXIT
+
+mysql_exec() {
+    $COMPOSE exec -T mysql mysql -uasterisk -pasterisk asterisk_ara_test "$@"
+}
+
+wait_for() {
+    local name="$1"; shift
+    for _ in $(seq 1 60); do
+        if "$@" >/dev/null 2>&1; then
+            return 0
+        fi
+        sleep 1
+    done
+    echo "Timed out waiting for $name" >&2
+    exit 1
+}
+
+mkdir -p "$LOG_DIR"
+
+echo "==> Building router"
+(cd "$ROOT" && go build -o "$ROUTER" ./cmd/router)
+
+echo "==> Starting MySQL and Redis"
+$COMPOSE up -d mysql redis
+wait_for mysql mysql_exec -e "SELECT 1"
+
+echo "==> Initializing schema"
+"$ROUTER" -config "$CONFIG" -init-db > "$LOG_DIR/init-db.log" 2>&1
+
+# Point the generated AGI URLs at the router running on the docker host
+mysql_exec -e "UPDATE extensions SET appdata = REPLACE(appdata, 'agi://localhost:4573', 'agi://router:14573') WHERE app = 'AGI'"
+
+echo "==> Starting Asterisk"
+$COMPOSE up -d --build asterisk
+
+echo "==> Starting AGI server"
+"$ROUTER" -config "$CONFIG" -agi > "$LOG_DIR/router.log" 2>&1 &
+ROUTER_PID=$!
+wait_for "AGI server" bash -c "exec 3<>/dev/tcp/127.0.0.1/14573"
+
+echo "==> Running driver"
+if ! (cd "$ROOT" && go run ./test/integration/driver -fixtures "$PWD/fixtures.sql"); then
+    echo "--- router log ---" >&2
+    tail -n 100 "$LOG_DIR/router.log" >&2
+    exit 1
+fi